@@ -0,0 +1,106 @@
+#!/usr/bin/env python3
+"""
+延迟加载特征数据的内存基准测试 / Memory Benchmark for Lazily Loaded Features
+
+用合成提供者（默认200个标的、10年日线、20个字段）比较两种只用到$close的取数方式的耗时和
+内存分配峰值：立即获取全部字段（get_features），与延迟加载后只访问$close
+（get_features(..., lazy=True)）
+Uses a synthetic provider (200 instruments, 10 years of daily bars and 20
+fields by default) to compare the time and peak allocation of two ways to
+fetch data when only $close is used: fetching every field up front
+(get_features), and loading lazily then touching only $close
+(get_features(..., lazy=True))
+
+用法 / Usage:
+    python scripts/benchmark_lazy_features.py --instruments 200 --fields 20
+"""
+
+import argparse
+import os
+import sys
+import time
+import tracemalloc
+
+import numpy as np
+import pandas as pd
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.core.data_manager import DataManager
+from src.infrastructure.data_provider import DataProvider
+
+
+class SyntheticProvider(DataProvider):
+    """按需生成随机游走价格的提供者 / Provider generating random-walk prices on demand"""
+    
+    name = "synthetic"
+    
+    def __init__(self, instruments: int, years: int, fields: int):
+        self._codes = [f"SH{600000 + i}" for i in range(instruments)]
+        self._fields = ["$close"] + [f"$f{i}" for i in range(1, fields)]
+        self._index = pd.bdate_range("2015-01-01", periods=years * 244, name="datetime")
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        rng = np.random.default_rng(self._codes.index(instrument))
+        data = {
+            name: 100.0 * np.exp(np.cumsum(rng.normal(0, 0.01, len(self._index))))
+            for name in fields
+        }
+        return pd.DataFrame(data, index=self._index)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(self._index)
+    
+    def list_instruments(self, market="all"):
+        return list(self._codes)
+    
+    def list_fields(self, instrument=None):
+        return list(self._fields)
+
+
+def _eager(manager, codes, fields):
+    result = manager.get_features(codes, fields)
+    return [result[code].column_array("$close")[0].mean() for code in result]
+
+
+def _lazy(manager, codes, fields):
+    result = manager.get_features(codes, fields, lazy=True)
+    return [result[code].column_array("$close")[0].mean() for code in result]
+
+
+def _measure(fn, manager, codes, fields):
+    """(耗时秒数, 内存分配峰值MB) / (time in seconds, peak allocation in MB)"""
+    tracemalloc.start()
+    started = time.perf_counter()
+    fn(manager, codes, fields)
+    elapsed = time.perf_counter() - started
+    _, peak = tracemalloc.get_traced_memory()
+    tracemalloc.stop()
+    return elapsed, peak / 1024 / 1024
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Benchmark memory of eager vs lazy feature loading")
+    parser.add_argument("--instruments", type=int, default=200, help="标的数 / Number of instruments")
+    parser.add_argument("--years", type=int, default=10, help="年数，每年244个交易日 / Years of 244 sessions")
+    parser.add_argument("--fields", type=int, default=20, help="字段数 / Number of fields")
+    args = parser.parse_args()
+    
+    provider = SyntheticProvider(args.instruments, args.years, args.fields)
+    manager = DataManager(enable_cache=False, provider=provider)
+    codes = provider.list_instruments()
+    fields = provider.list_fields()
+    modes = [("eager (all fields)", _eager), ("lazy ($close only)", _lazy)]
+    
+    print(f"标的 / instruments: {args.instruments}, 行数 / rows: {args.years * 244}, 字段 / fields: {args.fields}")
+    print(f"{'mode':<24}{'time (s)':>10}{'peak alloc (MB)':>18}")
+    for label, fn in modes:
+        elapsed, peak = _measure(fn, manager, codes, fields)
+        print(f"{label:<24}{elapsed:>10.3f}{peak:>18.1f}")
+
+
+if __name__ == "__main__":
+    main()
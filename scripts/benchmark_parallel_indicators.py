@@ -0,0 +1,83 @@
+#!/usr/bin/env python3
+"""
+多标的指标并行计算基准测试 / Parallel Indicator Computation Benchmark
+
+对合成的多标的日线（默认300个标的、10年）用indicators.apply()计算MACD，比较顺序计算与
+不同并发数的线程池、进程池的耗时和加速比。MACD是逐元素递推，线程池受GIL限制，
+进程池应随核数接近线性加速
+Computes MACD with indicators.apply() over synthetic daily bars for many
+instruments (300 instruments over 10 years by default), comparing the wall
+time and speedup of sequential computation against thread and process pools
+of several sizes. MACD is an element-wise recursion, so threads are held back
+by the GIL while processes should scale close to linearly with the cores
+
+用法 / Usage:
+    python scripts/benchmark_parallel_indicators.py --instruments 300 --years 10
+"""
+
+import argparse
+import functools
+import os
+import sys
+import time
+
+import numpy as np
+import pandas as pd
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.core import indicators
+from src.core.feature_frame import FeatureFrame
+
+
+def _make_frames(instruments: int, years: int):
+    rng = np.random.default_rng(0)
+    index = pd.bdate_range("2015-01-01", periods=years * 244, name="datetime")
+    return {
+        f"SH{600000 + i}": FeatureFrame(
+            {"$close": 100.0 * np.exp(np.cumsum(rng.normal(0, 0.01, len(index))))}, index=index
+        )
+        for i in range(instruments)
+    }
+
+
+def _worker_counts(limit: int):
+    counts = [1]
+    while counts[-1] * 2 <= limit:
+        counts.append(counts[-1] * 2)
+    if counts[-1] != limit:
+        counts.append(limit)
+    return counts
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Benchmark parallel indicator computation across instruments")
+    parser.add_argument("--instruments", type=int, default=300, help="标的数 / Number of instruments")
+    parser.add_argument("--years", type=int, default=10, help="年数，每年244个交易日 / Years of 244 sessions")
+    parser.add_argument("--max-workers", type=int, default=os.cpu_count() or 1, help="最大并发数 / Largest worker count")
+    args = parser.parse_args()
+    
+    frames = _make_frames(args.instruments, args.years)
+    fn = functools.partial(indicators.macd, fast=12, slow=26, signal=9)
+    
+    started = time.perf_counter()
+    expected = {code: fn(frame.column_array("$close")[0]) for code, frame in frames.items()}
+    sequential = time.perf_counter() - started
+    
+    print(f"标的 / instruments: {args.instruments}, 行数 / rows: {args.years * 244}")
+    print(f"{'pool':<10}{'workers':>8}{'time (s)':>10}{'speedup':>10}")
+    print(f"{'none':<10}{1:>8}{sequential:>10.3f}{1.0:>10.2f}")
+    for label, processes in (("threads", False), ("processes", True)):
+        for workers in _worker_counts(args.max_workers):
+            started = time.perf_counter()
+            result = indicators.apply(frames, fn, max_workers=workers, processes=processes)
+            elapsed = time.perf_counter() - started
+            assert all(np.allclose(result[code], expected[code], equal_nan=True) for code in frames)
+            print(f"{label:<10}{workers:>8}{elapsed:>10.3f}{sequential / elapsed:>10.2f}")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,107 @@
+#!/usr/bin/env python3
+"""
+Parquet与CSV文件读写基准测试 / Parquet vs CSV File I/O Benchmark
+
+生成一个合成的1分钟K线数据（默认100万行、5个字段），分别保存为CSV和不同压缩算法的
+Parquet文件，比较写入耗时、文件大小、读取全部字段和只读取$close的耗时
+Builds one synthetic 1-minute frame (1M rows and 5 fields by default), saves it
+as CSV and as Parquet with each compression codec, and compares write time,
+file size, and the time to read every field and to read $close alone
+
+用法 / Usage:
+    python scripts/benchmark_parquet_io.py --rows 1000000
+"""
+
+import argparse
+import os
+import sys
+import tempfile
+import time
+
+import numpy as np
+import pandas as pd
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.infrastructure.parquet_provider import read_parquet, write_parquet
+
+
+FIELDS = ["$open", "$high", "$low", "$close", "$volume"]
+
+# 分钟数据使用较大的行组，约为一个月的1分钟K线
+ROW_GROUP_ROWS = 100_000
+
+
+def _make_frame(rows: int) -> pd.DataFrame:
+    rng = np.random.default_rng(0)
+    index = pd.date_range("2020-01-02 09:31", periods=rows, freq="min", name="datetime")
+    close = 100.0 * np.exp(np.cumsum(rng.normal(0, 0.0005, rows)))
+    return pd.DataFrame({
+        "$open": close * (1 + rng.normal(0, 0.0002, rows)),
+        "$high": close * 1.001,
+        "$low": close * 0.999,
+        "$close": close,
+        "$volume": rng.integers(100, 10_000, rows).astype(float),
+    }, index=index)
+
+
+def _read_csv(path, fields=None):
+    columns = None if fields is None else ["datetime"] + [f.lstrip("$") for f in fields]
+    frame = pd.read_csv(path, usecols=columns, index_col="datetime", parse_dates=["datetime"])
+    return frame.rename(columns=lambda c: f"${c}")
+
+
+def _best(fn, repeat):
+    best = float("inf")
+    for _ in range(repeat):
+        started = time.perf_counter()
+        fn()
+        best = min(best, time.perf_counter() - started)
+    return best
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Benchmark Parquet vs CSV file reads and writes")
+    parser.add_argument("--rows", type=int, default=1_000_000, help="行数 / Number of rows")
+    parser.add_argument("--repeat", type=int, default=3, help="重复次数，取最快一次 / Repeats, best is reported")
+    args = parser.parse_args()
+    
+    frame = _make_frame(args.rows)
+    
+    with tempfile.TemporaryDirectory() as data_dir:
+        csv_path = os.path.join(data_dir, "SH600000.csv")
+        csv_frame = frame.rename(columns=lambda c: c.lstrip("$"))
+        formats = [(
+            "csv",
+            csv_path,
+            lambda: csv_frame.to_csv(csv_path),
+            lambda: _read_csv(csv_path),
+            lambda: _read_csv(csv_path, ["$close"]),
+        )]
+        for compression in ("none", "snappy", "zstd"):
+            path = os.path.join(data_dir, f"SH600000.{compression}.parquet")
+            formats.append((
+                f"parquet/{compression}",
+                path,
+                lambda path=path, compression=compression: write_parquet(
+                    path, frame, row_group_size=ROW_GROUP_ROWS, compression=compression
+                ),
+                lambda path=path: read_parquet(path),
+                lambda path=path: read_parquet(path, ["$close"]),
+            ))
+        
+        print(f"行数 / rows: {args.rows}, 字段 / fields: {len(FIELDS)}")
+        print(f"{'format':<18}{'write (s)':>12}{'size (MB)':>12}{'read all (s)':>14}{'read $close (s)':>17}")
+        for label, path, write, read_all, read_close in formats:
+            write_time = _best(write, 1)
+            size = os.path.getsize(path) / 1024 / 1024
+            read_all_time = _best(read_all, args.repeat)
+            read_close_time = _best(read_close, args.repeat)
+            print(f"{label:<18}{write_time:>12.3f}{size:>12.1f}{read_all_time:>14.3f}{read_close_time:>17.3f}")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,96 @@
+#!/usr/bin/env python3
+"""
+Parquet与CSV提供者读取基准测试 / Parquet vs CSV Provider Benchmark
+
+在临时目录中生成相同的合成日线数据（默认10年、5个字段），分别以CSV和Parquet
+格式保存，比较完整区间读取和一年窗口读取的耗时
+Writes the same synthetic daily bars (10 years, 5 fields by default) as CSV
+and Parquet into a temporary directory and compares the time of a full-range
+read and of a one-year window read
+
+用法 / Usage:
+    python scripts/benchmark_parquet_provider.py --instruments 20 --years 10
+"""
+
+import argparse
+import os
+import sys
+import tempfile
+import time
+
+import numpy as np
+import pandas as pd
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.parquet_provider import ParquetDataProvider, write_parquet
+
+
+FIELDS = ["$open", "$high", "$low", "$close", "$volume"]
+
+
+def _make_frame(index: pd.DatetimeIndex, seed: int) -> pd.DataFrame:
+    rng = np.random.default_rng(seed)
+    close = 100.0 * np.exp(np.cumsum(rng.normal(0, 0.01, len(index))))
+    return pd.DataFrame({
+        "$open": close * (1 + rng.normal(0, 0.002, len(index))),
+        "$high": close * 1.01,
+        "$low": close * 0.99,
+        "$close": close,
+        "$volume": rng.integers(1_000, 100_000, len(index)).astype(float),
+    }, index=index)
+
+
+def _write_dataset(data_dir: str, codes, index: pd.DatetimeIndex) -> None:
+    for seed, code in enumerate(codes):
+        frame = _make_frame(index, seed)
+        write_parquet(os.path.join(data_dir, f"{code}.parquet"), frame)
+        csv_frame = frame.rename(columns=lambda c: c.lstrip("$"))
+        csv_frame.index.name = "date"
+        csv_frame.to_csv(os.path.join(data_dir, f"{code}.csv"))
+
+
+def _time_reads(provider, codes, start_time, end_time, repeat):
+    best = float("inf")
+    rows = 0
+    for _ in range(repeat):
+        started = time.perf_counter()
+        rows = sum(
+            len(provider.load_features(code, FIELDS, start_time=start_time, end_time=end_time))
+            for code in codes
+        )
+        best = min(best, time.perf_counter() - started)
+    return best, rows
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Benchmark Parquet vs CSV feature reads")
+    parser.add_argument("--instruments", type=int, default=20, help="标的数量 / Number of instruments")
+    parser.add_argument("--years", type=int, default=10, help="年数 / Number of years")
+    parser.add_argument("--repeat", type=int, default=3, help="重复次数，取最快一次 / Repeats, best is reported")
+    args = parser.parse_args()
+    
+    end = pd.Timestamp("2025-06-30")
+    start = end - pd.DateOffset(years=args.years)
+    index = pd.bdate_range(start, end, name="datetime")
+    codes = [f"SH{600000 + i}" for i in range(args.instruments)]
+    window = ((end - pd.DateOffset(years=1)).strftime("%Y-%m-%d"), end.strftime("%Y-%m-%d"))
+    
+    with tempfile.TemporaryDirectory() as data_dir:
+        _write_dataset(data_dir, codes, index)
+        providers = [CSVDataProvider(data_dir), ParquetDataProvider(data_dir)]
+        
+        print(f"标的数 / instruments: {args.instruments}, 年数 / years: {args.years}, 字段 / fields: {len(FIELDS)}")
+        print(f"{'provider':<10}{'range':<12}{'time (s)':>12}{'rows':>10}")
+        for label, (start_time, end_time) in [("full", (None, None)), ("1 year", window)]:
+            for provider in providers:
+                elapsed, rows = _time_reads(provider, codes, start_time, end_time, args.repeat)
+                print(f"{provider.name:<10}{label:<12}{elapsed:>12.3f}{rows:>10}")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,99 @@
+#!/usr/bin/env python3
+"""
+批量下载数据 / Bulk Data Download
+
+在研究开始前把整个标的池的数据下载为本地Parquet目录，中断后再次运行会跳过已经完整的文件，
+结束时打印每个文件的行数和校验和清单（JSON）。逻辑在src.core.bulk_download中，
+本脚本只解析参数。
+Downloads a whole universe into a local Parquet directory before research
+starts; a rerun after an interruption skips the files already complete, and
+the run ends by printing a JSON manifest of row counts and checksums. The
+logic lives in src.core.bulk_download; this script only parses arguments.
+
+用法 / Usage:
+    python scripts/qdump.py --universe SH000300 --fields '$open,$close,$volume' \\
+        --start 2020-01-01 --end 2024-12-31 --out ./data/parquet --source-dir ./data/csv --rate-limit 5
+"""
+
+import argparse
+import json
+import os
+import signal
+import sys
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.core.bulk_download import DEFAULT_DOWNLOAD_WORKERS, DownloadOptions, DownloadSpec, bulk_download
+from src.core.data_manager import DataManager
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.parquet_provider import ParquetDataProvider
+from src.utils.request_context import ContextCancelledError, RequestContext
+from src.utils.retry import RetryPolicy
+
+
+def _split(text):
+    return [item.strip() for item in text.split(",") if item.strip()]
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Download a universe into a local Parquet directory")
+    target = parser.add_mutually_exclusive_group(required=True)
+    target.add_argument("--universe", help="指数代码或股票池名称，如SH000300 / Index code or pool name")
+    target.add_argument("--instruments", help="逗号分隔的标的代码 / Comma-separated instrument codes")
+    parser.add_argument("--fields", required=True, help="逗号分隔的字段，如$open,$close / Comma-separated fields")
+    parser.add_argument("--start", default=None, help="开始时间 / Start time")
+    parser.add_argument("--end", default=None, help="结束时间 / End time")
+    parser.add_argument("--freq", default="day", help="数据频率 / Data frequency")
+    parser.add_argument("--out", required=True, help="输出目录 / Output directory")
+    parser.add_argument("--source-dir", default=None, help="CSV或Parquet源数据目录 / CSV or Parquet source directory")
+    parser.add_argument("--format", choices=("csv", "parquet"), default="csv", help="源数据格式 / Source format")
+    parser.add_argument("--provider", default=None, help="已注册的提供者名称 / Registered provider name")
+    parser.add_argument("--workers", type=int, default=DEFAULT_DOWNLOAD_WORKERS, help="并行下载数 / Parallel downloads")
+    parser.add_argument("--rate-limit", type=float, default=None, help="每秒最多请求数 / Requests per second at most")
+    parser.add_argument("--retries", type=int, default=3, help="包括第一次在内的最多尝试次数 / Attempts per request")
+    parser.add_argument("--no-resume", action="store_true", help="重新下载已经完整的文件 / Download complete files again")
+    args = parser.parse_args()
+    
+    provider = args.provider
+    if args.source_dir is not None:
+        provider_class = CSVDataProvider if args.format == "csv" else ParquetDataProvider
+        provider = provider_class(args.source_dir)
+    
+    spec = DownloadSpec(
+        args.universe if args.universe is not None else _split(args.instruments),
+        _split(args.fields),
+        start=args.start,
+        end=args.end,
+        freq=args.freq
+    )
+    options = DownloadOptions(
+        max_workers=args.workers,
+        rate_limit=args.rate_limit,
+        retry=RetryPolicy(max_attempts=args.retries),
+        provider=provider,
+        progress=lambda done, total: print(f"\r{done}/{total}", end="", file=sys.stderr, flush=True),
+        resume=not args.no_resume
+    )
+    
+    ctx = RequestContext()
+    signal.signal(signal.SIGINT, lambda signum, frame: ctx.cancel("SIGINT"))
+    signal.signal(signal.SIGTERM, lambda signum, frame: ctx.cancel("SIGTERM"))
+    try:
+        manifest = bulk_download(ctx, spec, args.out, options, manager=DataManager(enable_cache=False))
+    except ContextCancelledError:
+        print("\ninterrupted, rerun the same command to resume", file=sys.stderr)
+        sys.exit(130)
+    finally:
+        if not isinstance(provider, (str, type(None))):
+            provider.close()
+    
+    print(file=sys.stderr)
+    print(json.dumps(manifest.to_dict(), indent=2, ensure_ascii=False))
+    sys.exit(0 if manifest.complete else 1)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,60 @@
+#!/usr/bin/env python3
+"""
+数据提供者gRPC服务 / Data Provider gRPC Server
+
+把一个数据目录（CSV或Parquet）通过DataService共享出去，其他机器上的回测用
+GRPCProvider连接，不再各自保存一份数据
+Shares one data directory (CSV or Parquet) through DataService, so backtests on
+other machines connect with GRPCProvider instead of each keeping a copy
+
+用法 / Usage:
+    python scripts/serve_data.py --data-dir ./data --address 0.0.0.0:50052 --max-concurrent 16
+"""
+
+import argparse
+import os
+import signal
+import sys
+
+# 添加项目根目录到路径
+project_root = os.path.join(os.path.dirname(__file__), '..')
+if project_root not in sys.path:
+    sys.path.insert(0, project_root)
+
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.parquet_provider import ParquetDataProvider
+from src.server.data_service import listen_and_serve_data
+from src.utils.request_context import RequestContext
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Serve a data directory over gRPC")
+    parser.add_argument("--data-dir", required=True, help="数据目录 / Data directory")
+    parser.add_argument("--format", choices=("csv", "parquet"), default="csv", help="文件格式 / File format")
+    parser.add_argument("--timezone", default="Asia/Shanghai", help="交易所时区 / Exchange timezone")
+    parser.add_argument("--address", default="0.0.0.0:50052", help="监听地址 / Listen address")
+    parser.add_argument("--workers", type=int, default=8, help="处理请求的线程数 / Worker threads")
+    parser.add_argument(
+        "--max-concurrent", type=int, default=None,
+        help="同时处理的请求上限，默认不限 / Cap on requests in flight, no cap by default"
+    )
+    args = parser.parse_args()
+    
+    provider_class = CSVDataProvider if args.format == "csv" else ParquetDataProvider
+    provider = provider_class(args.data_dir, timezone=args.timezone)
+    
+    ctx = RequestContext()
+    signal.signal(signal.SIGTERM, lambda signum, frame: ctx.cancel("SIGTERM"))
+    try:
+        listen_and_serve_data(
+            args.address, provider, ctx,
+            max_workers=args.workers, max_concurrent_requests=args.max_concurrent
+        )
+    except KeyboardInterrupt:
+        pass
+    finally:
+        provider.close()
+
+
+if __name__ == "__main__":
+    main()
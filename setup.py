@@ -38,6 +38,6 @@ setup(
     },
     include_package_data=True,
     package_data={
-        "": ["*.yaml", "*.yml"],
+        "": ["*.yaml", "*.yml", "*.proto"],
     },
 )
@@ -26,6 +26,138 @@ from .backtest_manager import (
     BacktestManagerError
 )
 
+from .backtest_engine import (
+    BacktestEngine,
+    EngineConfig,
+    EngineResult,
+    PnLBreakdown,
+    Strategy,
+    BarContext,
+    LookaheadError,
+    BacktestInterruptedError,
+    Snapshotter,
+    Order,
+    OrderSide,
+    OrderType,
+    TimeInForce,
+    Fill,
+    FillKind,
+    CorporateActionRecord,
+    RiskLimits,
+    LimitAction,
+    RiskLimitError,
+    RoundingPolicy,
+    TickSize,
+    LotSize,
+    LotRoundingError,
+    A_SHARE_ROUNDING,
+    pre_trade_check,
+    ExecutionMode,
+    SuspensionPolicy,
+    Portfolio,
+    CostBasis,
+    CostModel,
+    ZeroCost,
+    FixedBpsCommission,
+    BasisPointsModel,
+    AShareCostModel,
+    PerShareCommission,
+    SlippageModel,
+    FixedBpsSlippage,
+    SpreadSlippage,
+    VolumeShareSlippage,
+    RandomSlippage,
+    CombinedCost
+)
+
+from .engine_config import (
+    COST_MODELS,
+    load_engine_config,
+    engine_config_from_dict,
+    engine_config_to_dict,
+    write_engine_config
+)
+
+from .rebalance import (
+    TargetWeightStrategy,
+    RebalanceSchedule,
+    MonthEnd,
+    MonthStart,
+    QuarterEnd,
+    Weekly,
+    CalendarDays,
+    EveryNDays,
+    DateList,
+    WeightPolicy,
+    normalize_weights,
+    target_orders
+)
+
+from .baselines import (
+    BuyAndHold,
+    EqualWeight,
+    RebalanceFrequency
+)
+
+from .attribution import (
+    AttributionRow,
+    PnLAttribution,
+    TradeStats,
+    attribute
+)
+
+from .sizing import (
+    PositionSizer,
+    FixedShares,
+    FixedFraction,
+    VolatilityTarget,
+    SignalStrategy
+)
+
+from .execution import (
+    ExecutionScheduler,
+    ScheduleStyle,
+    HorizonPolicy,
+    ScheduleStatus,
+    ScheduleReport
+)
+
+from .walk_forward import (
+    WalkForwardConfig,
+    WalkForwardResult,
+    Fold,
+    FoldResult,
+    StrategyFactory,
+    WindowSize,
+    fold_windows,
+    period_windows,
+    to_period,
+    walk_forward
+)
+
+from .grid_search import (
+    GridSearchConfig,
+    GridSearchResult,
+    GridRun,
+    PartialGridSearchError,
+    GRID_METRICS,
+    parameter_grid,
+    grid_search
+)
+
+from .benchmark_index import (
+    IndexWeighting,
+    MissingPrice,
+    build_index
+)
+
+from .paper_trading import (
+    PaperTraderConfig,
+    PaperTrader,
+    PaperTradingResult,
+    Reconciliation
+)
+
 from .visualization_manager import (
     VisualizationManager,
     VisualizationManagerError
@@ -80,6 +212,105 @@ __all__ = [
     "BacktestResult",
     "Trade",
     "BacktestManagerError",
+    "BacktestEngine",
+    "EngineConfig",
+    "EngineResult",
+    "PnLBreakdown",
+    "Strategy",
+    "BarContext",
+    "LookaheadError",
+    "BacktestInterruptedError",
+    "Snapshotter",
+    "Order",
+    "OrderSide",
+    "OrderType",
+    "TimeInForce",
+    "Fill",
+    "FillKind",
+    "CorporateActionRecord",
+    "RiskLimits",
+    "LimitAction",
+    "RiskLimitError",
+    "RoundingPolicy",
+    "TickSize",
+    "LotSize",
+    "LotRoundingError",
+    "A_SHARE_ROUNDING",
+    "pre_trade_check",
+    "ExecutionMode",
+    "SuspensionPolicy",
+    "Portfolio",
+    "CostBasis",
+    "CostModel",
+    "ZeroCost",
+    "FixedBpsCommission",
+    "BasisPointsModel",
+    "AShareCostModel",
+    "PerShareCommission",
+    "SlippageModel",
+    "FixedBpsSlippage",
+    "SpreadSlippage",
+    "VolumeShareSlippage",
+    "RandomSlippage",
+    "CombinedCost",
+    "COST_MODELS",
+    "load_engine_config",
+    "engine_config_from_dict",
+    "engine_config_to_dict",
+    "write_engine_config",
+    "TargetWeightStrategy",
+    "RebalanceSchedule",
+    "MonthEnd",
+    "MonthStart",
+    "QuarterEnd",
+    "Weekly",
+    "CalendarDays",
+    "EveryNDays",
+    "DateList",
+    "WeightPolicy",
+    "normalize_weights",
+    "target_orders",
+    "BuyAndHold",
+    "EqualWeight",
+    "RebalanceFrequency",
+    "AttributionRow",
+    "PnLAttribution",
+    "TradeStats",
+    "attribute",
+    "PositionSizer",
+    "FixedShares",
+    "FixedFraction",
+    "VolatilityTarget",
+    "SignalStrategy",
+    "ExecutionScheduler",
+    "ScheduleStyle",
+    "HorizonPolicy",
+    "ScheduleStatus",
+    "ScheduleReport",
+    "WalkForwardConfig",
+    "WalkForwardResult",
+    "Fold",
+    "FoldResult",
+    "StrategyFactory",
+    "WindowSize",
+    "fold_windows",
+    "period_windows",
+    "to_period",
+    "walk_forward",
+    "GridSearchConfig",
+    "GridSearchResult",
+    "GridRun",
+    "PartialGridSearchError",
+    "GRID_METRICS",
+    "parameter_grid",
+    "grid_search",
+    "IndexWeighting",
+    "MissingPrice",
+    "build_index",
+    "PaperTraderConfig",
+    "PaperTrader",
+    "PaperTradingResult",
+    "Reconciliation",
     "VisualizationManager",
     "VisualizationManagerError",
     "ReportGenerator",
@@ -0,0 +1,439 @@
+"""
+盈亏归因模块 / P&L Attribution Module
+把回测结果的盈亏按标的、行业和月份分解为价格盈亏、分红和成本拖累，并统计每笔交易
+Splits a backtest result's P&L by instrument, sector and month into price
+P&L, dividends and cost drag, and computes per-trade statistics
+
+每个标的每日的盈亏来自EngineResult.instrument_pnl：分红为当日记入的税前分红，成本拖累为当日
+成交的手续费、税费和滑点加上代扣的分红税，价格盈亏为其余部分（滑点已包含在成交价中，这里从成本
+中加回），因此三项之和等于该标的的盈亏，所有标的之和等于权益的变动。组合以Money记账，
+权益与各标的盈亏之和的差额（residual）不超过每笔现金变动一个Money单位，见reconciles()。
+Each instrument's daily P&L comes from EngineResult.instrument_pnl: the
+dividends are the pre-tax dividends booked that day, the cost drag is that
+day's commission, tax and slippage on fills plus dividend tax withheld, and
+the price P&L is the rest (slippage is already in the fill price, so it is
+added back here), so the three pieces sum to the instrument's P&L and the
+instruments sum to the change in equity. The portfolio books cash as Money,
+and the gap between equity and the instruments' sum (residual) stays within
+one Money unit per cash movement, see reconciles().
+
+一笔交易是一个标的从空仓开仓到回到空仓（或反手）的过程，回测结束时仍持有的仓位不计入交易统计。
+传入价格数据时按持有期间每根K线的$high和$low（没有时用$close）计算最大不利偏移（MAE）和最大
+有利偏移（MFE）；拆股之前的K线按拆股比例换算到拆股后的股本。
+A trade runs from opening a position from flat to being flat again (or
+reversing); positions still open at the end are left out of the trade
+statistics. Given the price data, the maximum adverse and favorable
+excursions (MAE and MFE) use each bar's $high and $low while held, or $close
+without them; bars before a split are converted to the post-split share
+count.
+
+Examples:
+    >>> result = run(config, strategy)
+    >>> report = result.attribution(prices=config.data)
+    >>> report.write_csv("attribution/")
+"""
+
+import math
+from dataclasses import asdict, dataclass, field
+from pathlib import Path
+from typing import TYPE_CHECKING, Any, Dict, List, Mapping, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..core.money import SCALE
+from ..core.sectors import get_sector
+from .backtest_engine import CLOSE_FIELD, HIGH_FIELD, LOW_FIELD, OrderSide
+
+if TYPE_CHECKING:
+    from .backtest_engine import EngineResult
+
+
+# 没有行业的标的归入的分组 / Group of instruments without a sector
+UNCLASSIFIED_SECTOR = "unclassified"
+
+_EPSILON = 1e-9
+
+
+@dataclass
+class AttributionRow:
+    """
+    一个分组的盈亏分解 / P&L breakdown of one group
+    
+    total = price + dividends - costs
+    
+    Attributes:
+        key: 标的代码、行业代码或月份（如"2025-01"） / Instrument code, sector code or month, e.g. "2025-01"
+        price: 价格盈亏，不计成本 / Price P&L before costs
+        dividends: 税前分红，空头支付的分红为负数 / Pre-tax dividends, negative for those a short paid over
+        costs: 成本拖累：手续费、税费、滑点和代扣的分红税 / Cost drag: commission, tax, slippage and dividend tax
+    """
+    key: str
+    price: float = 0.0
+    dividends: float = 0.0
+    costs: float = 0.0
+    
+    @property
+    def total(self) -> float:
+        """扣除成本后的盈亏 / P&L after costs"""
+        return self.price + self.dividends - self.costs
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为字典，包含total / Convert to a dict including total"""
+        return {**asdict(self), "total": self.total}
+
+
+@dataclass
+class TradeStats:
+    """
+    一笔已了结交易的统计 / Statistics of one closed trade
+    
+    价格以计价货币表示，盈亏以基准货币表示
+    Prices are in the quote currency and P&L in the base currency
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        direction: 1为多头，-1为空头 / 1 for long, -1 for short
+        entry_time: 开仓成交时间 / Time of the opening fill
+        exit_time: 了结成交时间 / Time of the closing fill
+        quantity: 持有期间的最大持仓数量（拆股后的股本） / Largest quantity held, in post-split shares
+        entry_price: 开仓和加仓成交的均价 / Average price of the opening fills
+        exit_price: 减仓和平仓成交的均价 / Average price of the closing fills
+        holding_days: 开仓之后到了结为止的交易日数 / Trading days from the entry to the exit
+        return_: 按均价计算的收益率，不计成本，空头下跌为正 / Return on the average prices before costs, positive when a short falls
+        pnl: 已实现盈亏减去这笔交易成交的手续费和税费 / Realized P&L less the commission and tax of its fills
+        mae: 最大不利偏移，相对开仓均价，0或负数；没有价格数据时为None /
+            Maximum adverse excursion from the entry price, zero or negative; None without prices
+        mfe: 最大有利偏移，相对开仓均价，0或正数；没有价格数据时为None /
+            Maximum favorable excursion from the entry price, zero or positive; None without prices
+    """
+    instrument: str
+    direction: int
+    entry_time: pd.Timestamp
+    exit_time: pd.Timestamp
+    quantity: float
+    entry_price: float
+    exit_price: float
+    holding_days: int
+    return_: float
+    pnl: float
+    mae: Optional[float] = None
+    mfe: Optional[float] = None
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为字典，return_写作return / Convert to a dict with return_ written as return"""
+        data = asdict(self)
+        data["return"] = data.pop("return_")
+        return data
+
+
+@dataclass
+class PnLAttribution:
+    """
+    回测结果的盈亏归因 / P&L attribution of a backtest result
+    
+    Attributes:
+        initial_equity: 期初权益 / Starting equity
+        final_equity: 最终权益 / Final equity
+        by_instrument: 每个持有过的标的一行，按盈亏绝对值从大到小排列 /
+            One row per instrument ever held, by absolute P&L, largest first
+        by_sector: 每个行业一行，没有任何标的注册行业时为空 / One row per sector; empty when no instrument has one
+        by_month: 每个自然月一行，按时间排列 / One row per calendar month in order
+        trades: 已了结的交易，按了结时间排列 / Closed trades in exit order
+        tolerance: reconciles()允许的差额 / Gap reconciles() allows
+    """
+    initial_equity: float
+    final_equity: float
+    by_instrument: List[AttributionRow] = field(default_factory=list)
+    by_sector: List[AttributionRow] = field(default_factory=list)
+    by_month: List[AttributionRow] = field(default_factory=list)
+    trades: List[TradeStats] = field(default_factory=list)
+    tolerance: float = 1.0 / SCALE
+    
+    @property
+    def change(self) -> float:
+        """权益的变动 / Change in equity"""
+        return self.final_equity - self.initial_equity
+    
+    @property
+    def total(self) -> AttributionRow:
+        """全部标的合计 / Sum over all instruments"""
+        return _sum_rows("total", self.by_instrument)
+    
+    @property
+    def residual(self) -> float:
+        """权益变动减去各标的盈亏之和 / Change in equity less the instruments' P&L"""
+        return self.change - self.total.total
+    
+    def reconciles(self) -> bool:
+        """
+        各部分是否与权益变动一致 / Whether the pieces add up to the change in equity
+        
+        按标的、行业和月份的合计都与权益变动相差不超过tolerance
+        The totals by instrument, by sector and by month are each within
+        tolerance of the change in equity
+        """
+        totals = [self.total.total, _sum_rows("", self.by_month).total]
+        if self.by_sector:
+            totals.append(_sum_rows("", self.by_sector).total)
+        return all(abs(self.change - total) <= self.tolerance for total in totals)
+    
+    def frames(self) -> Dict[str, pd.DataFrame]:
+        """
+        转换为表格 / Convert to tables
+        
+        Returns:
+            Dict[str, pd.DataFrame]: instruments、sectors、months和trades四张表 /
+                The instruments, sectors, months and trades tables
+        """
+        columns = ["key", "price", "dividends", "costs", "total"]
+        trade_columns = [
+            "instrument", "direction", "entry_time", "exit_time", "quantity", "entry_price", "exit_price",
+            "holding_days", "return", "pnl", "mae", "mfe"
+        ]
+        return {
+            "instruments": pd.DataFrame([r.to_dict() for r in self.by_instrument], columns=columns),
+            "sectors": pd.DataFrame([r.to_dict() for r in self.by_sector], columns=columns),
+            "months": pd.DataFrame([r.to_dict() for r in self.by_month], columns=columns),
+            "trades": pd.DataFrame([t.to_dict() for t in self.trades], columns=trade_columns),
+        }
+    
+    def write_csv(self, directory: Union[str, Path]) -> None:
+        """
+        把frames()写入目录下的CSV文件 / Write frames() as CSV files in a directory
+        
+        文件名为attribution_instruments.csv、attribution_sectors.csv、attribution_months.csv和
+        attribution_trades.csv
+        The files are attribution_instruments.csv, attribution_sectors.csv,
+        attribution_months.csv and attribution_trades.csv
+        
+        Args:
+            directory: 目录，不存在时创建 / Directory, created when missing
+        """
+        directory = Path(directory)
+        directory.mkdir(parents=True, exist_ok=True)
+        for name, frame in self.frames().items():
+            frame.to_csv(directory / f"attribution_{name}.csv", index=False)
+
+
+def attribute(result: "EngineResult", prices: Optional[Mapping[str, pd.DataFrame]] = None) -> PnLAttribution:
+    """
+    计算回测结果的盈亏归因 / Compute the P&L attribution of a backtest result
+    
+    Args:
+        result: 回测结果 / Backtest result
+        prices: 标的代码到价格数据（如EngineConfig.data），用于计算MAE和MFE；None时不计算 /
+            Instrument code to price data, such as EngineConfig.data, for MAE and MFE; None skips them
+    
+    Returns:
+        PnLAttribution: 盈亏归因 / P&L attribution
+    
+    Raises:
+        ValueError: 结果没有期初权益或每个标的的盈亏时抛出 /
+            Raised when the result has no starting equity or per-instrument P&L
+    """
+    if result.initial_cash is None:
+        raise ValueError("result has no initial_cash, so its P&L can't be attributed")
+    pnl = pd.DataFrame(result.instrument_pnl, dtype=float)
+    if len(pnl.columns) == 0 and (result.trades or result.corporate_actions):
+        raise ValueError("result has no instrument_pnl, so its P&L can't be attributed")
+    days = pnl.index
+    codes = [str(code) for code in pnl.columns]
+    column = {code: i for i, code in enumerate(codes)}
+    total = np.diff(pnl.to_numpy(), axis=0, prepend=0.0)
+    dividends = np.zeros_like(total)
+    costs = np.zeros_like(total)
+    for t in result.trades:
+        day = _day(days, t.time)
+        if day is not None and t.instrument in column:
+            costs[day, column[t.instrument]] += (t.commission + t.tax + t.slippage) * t.fx_rate
+    for r in result.corporate_actions:
+        day = _day(days, r.time)
+        code = r.action.instrument
+        if r.kind != "dividend" or day is None or code not in column:
+            continue
+        dividends[day, column[code]] += r.cash + r.tax
+        costs[day, column[code]] += r.tax
+    price = total - dividends + costs
+    
+    by_instrument = [
+        AttributionRow(code, math.fsum(price[:, i]), math.fsum(dividends[:, i]), math.fsum(costs[:, i]))
+        for i, code in enumerate(codes)
+    ]
+    by_instrument.sort(key=lambda row: abs(row.total), reverse=True)
+    
+    sectors = {code: get_sector(code) for code in codes}
+    by_sector: List[AttributionRow] = []
+    if any(sector is not None for sector in sectors.values()):
+        groups: Dict[str, List[AttributionRow]] = {}
+        for row in by_instrument:
+            groups.setdefault(sectors[row.key] or UNCLASSIFIED_SECTOR, []).append(row)
+        by_sector = [_sum_rows(sector, rows) for sector, rows in groups.items()]
+        by_sector.sort(key=lambda row: abs(row.total), reverse=True)
+    
+    months = np.asarray(days.strftime("%Y-%m"))
+    by_month = [
+        AttributionRow(
+            month,
+            math.fsum(price[months == month].ravel()),
+            math.fsum(dividends[months == month].ravel()),
+            math.fsum(costs[months == month].ravel())
+        )
+        for month in dict.fromkeys(months)
+    ]
+    
+    fills = len(result.trades) + len(result.corporate_actions)
+    return PnLAttribution(
+        initial_equity=float(result.initial_cash),
+        final_equity=result.final_equity,
+        by_instrument=by_instrument,
+        by_sector=by_sector,
+        by_month=by_month,
+        trades=_trade_stats(result, prices),
+        tolerance=(fills + 1) / SCALE
+    )
+
+
+class _OpenTrade:
+    """正在持有的交易 / Trade still being held"""
+    
+    def __init__(self, instrument: str, direction: int, time: pd.Timestamp):
+        self.instrument = instrument
+        self.direction = direction
+        self.entry_time = time
+        self.entry_quantity = 0.0
+        self.entry_value = 0.0
+        self.exit_quantity = 0.0
+        self.exit_value = 0.0
+        self.held = 0.0
+        self.largest = 0.0
+        self.pnl = 0.0
+        self.splits: List[Tuple[pd.Timestamp, float]] = []  # (拆股时间, 比例)
+    
+    def split(self, time: pd.Timestamp, ratio: float) -> None:
+        self.entry_quantity *= ratio
+        self.exit_quantity *= ratio
+        self.held *= ratio
+        self.largest *= ratio
+        self.splits.append((time, ratio))
+
+
+def _trade_stats(result: "EngineResult", prices: Optional[Mapping[str, pd.DataFrame]]) -> List[TradeStats]:
+    """按成交和拆股重建每笔已了结的交易 / Rebuild the closed trades from the fills and splits"""
+    events = [(r.time, 0, i, r) for i, r in enumerate(result.corporate_actions) if r.kind == "split"]
+    events += [(t.time, 1, i, t) for i, t in enumerate(result.trades)]
+    # 公司行为在当日开盘前应用，先于当日的成交
+    events.sort(key=lambda e: (e[0], e[1], e[2]))
+    
+    days = result.equity_curve.index
+    trades: List[TradeStats] = []
+    open_trades: Dict[str, _OpenTrade] = {}
+    for time, is_fill, _, event in events:
+        if not is_fill:
+            trade = open_trades.get(event.action.instrument)
+            if trade is not None and abs(event.quantity) > _EPSILON:
+                trade.split(time, event.new_quantity / event.quantity)
+            continue
+        fill = event
+        change = fill.quantity if fill.side is OrderSide.BUY else -fill.quantity
+        fee = (fill.commission + fill.tax) * fill.fx_rate
+        trade = open_trades.get(fill.instrument)
+        if trade is None:
+            trade = open_trades[fill.instrument] = _OpenTrade(fill.instrument, 1 if change > 0 else -1, fill.time)
+        if trade.direction * change > 0:
+            trade.entry_quantity += fill.quantity
+            trade.entry_value += fill.quantity * fill.price
+            trade.held += change
+            trade.largest = max(trade.largest, abs(trade.held))
+            trade.pnl -= fee
+            continue
+        closed = min(fill.quantity, abs(trade.held))
+        trade.exit_quantity += closed
+        trade.exit_value += closed * fill.price
+        trade.held += trade.direction * closed
+        trade.pnl += fill.realized_pnl - fee * closed / fill.quantity
+        if abs(trade.held) > _EPSILON:
+            continue
+        trades.append(_close(trade, fill.time, days, prices))
+        del open_trades[fill.instrument]
+        remaining = fill.quantity - closed
+        if remaining > _EPSILON:
+            # 反手：剩余的数量在这笔成交上开了新仓
+            reverse = open_trades[fill.instrument] = _OpenTrade(fill.instrument, -trade.direction, fill.time)
+            reverse.entry_quantity = remaining
+            reverse.entry_value = remaining * fill.price
+            reverse.held = remaining * reverse.direction
+            reverse.largest = remaining
+            reverse.pnl = -fee * remaining / fill.quantity
+    return trades
+
+
+def _close(
+    trade: _OpenTrade,
+    time: pd.Timestamp,
+    days: pd.DatetimeIndex,
+    prices: Optional[Mapping[str, pd.DataFrame]]
+) -> TradeStats:
+    """了结一笔交易并计算其统计 / Close a trade and compute its statistics"""
+    entry_price = trade.entry_value / trade.entry_quantity
+    exit_price = trade.exit_value / trade.exit_quantity
+    mae = mfe = None
+    frame = None if prices is None else prices.get(trade.instrument)
+    if frame is not None:
+        mae, mfe = _excursions(frame, trade, time, entry_price)
+    return TradeStats(
+        instrument=trade.instrument,
+        direction=trade.direction,
+        entry_time=trade.entry_time,
+        exit_time=time,
+        quantity=trade.largest,
+        entry_price=entry_price,
+        exit_price=exit_price,
+        holding_days=int(((days > trade.entry_time) & (days <= time)).sum()),
+        return_=trade.direction * (exit_price / entry_price - 1.0),
+        pnl=trade.pnl,
+        mae=mae,
+        mfe=mfe
+    )
+
+
+def _excursions(
+    frame: pd.DataFrame,
+    trade: _OpenTrade,
+    exit_time: pd.Timestamp,
+    entry_price: float
+) -> Tuple[Optional[float], Optional[float]]:
+    """持有期间的(MAE, MFE)，没有有效价格时为(None, None) / (MAE, MFE) while held; (None, None) without valid prices"""
+    held = frame.loc[(frame.index >= trade.entry_time) & (frame.index <= exit_time)]
+    if held.empty or CLOSE_FIELD not in held.columns:
+        return None, None
+    highs = held[HIGH_FIELD if HIGH_FIELD in held.columns else CLOSE_FIELD].to_numpy(dtype=float)
+    lows = held[LOW_FIELD if LOW_FIELD in held.columns else CLOSE_FIELD].to_numpy(dtype=float)
+    # 拆股前的价格换算到拆股后的股本
+    factor = np.ones(len(held))
+    for time, ratio in trade.splits:
+        factor[held.index < time] *= ratio
+    highs, lows = highs / factor, lows / factor
+    valid = np.isfinite(highs) & np.isfinite(lows)
+    if not valid.any():
+        return None, None
+    high, low = float(highs[valid].max()), float(lows[valid].min())
+    if trade.direction > 0:
+        return min(low / entry_price - 1.0, 0.0), max(high / entry_price - 1.0, 0.0)
+    return min(1.0 - high / entry_price, 0.0), max(1.0 - low / entry_price, 0.0)
+
+
+def _day(days: pd.DatetimeIndex, time: pd.Timestamp) -> Optional[int]:
+    """时间所在交易日的位置，早于第一个交易日时为None / Position of the trading day holding time; None before the first"""
+    position = int(days.searchsorted(time, side="right")) - 1
+    return None if position < 0 else position
+
+
+def _sum_rows(key: str, rows: List[AttributionRow]) -> AttributionRow:
+    """把多行相加 / Add up rows"""
+    return AttributionRow(
+        key,
+        math.fsum(r.price for r in rows),
+        math.fsum(r.dividends for r in rows),
+        math.fsum(r.costs for r in rows)
+    )
@@ -0,0 +1,3314 @@
+"""
+回测引擎模块 / Backtest Engine Module
+按交易日历逐日驱动策略回调，按执行方式撮合订单，记录资金、持仓、成交和权益曲线
+Steps a strategy callback over the trading calendar day by day, fills orders
+according to the execution mode and records cash, positions, trades and the
+equity curve
+
+长时间的回测可以定期（或收到SIGTERM时）把状态写入检查点文件，进程中断后用
+BacktestEngine.resume()从检查点继续，结果与不中断的回测完全相同
+A long backtest can write its state to a checkpoint file periodically (or on
+SIGTERM), and BacktestEngine.resume() carries on from the checkpoint after the
+process dies, with a result identical to an uninterrupted run
+"""
+
+import copy
+import json
+import math
+import numbers
+import os
+import pickle
+import random
+import signal
+import threading
+from abc import ABC, abstractmethod
+from dataclasses import dataclass, field, replace
+from decimal import Decimal
+from enum import Enum
+from pathlib import Path
+from typing import TYPE_CHECKING, Any, Callable, Dict, Iterable, List, Mapping, Optional, TextIO, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..core.currency import BASE_CURRENCY, FXProvider, get_currency
+from ..core.data_manager import DataManager
+from ..core.delisting import Delisting, get_delisting
+from ..core.expression_engine import ExpressionError, is_raw_field, parse_expression
+from ..core.feature_frame import Bar, FeatureFrame, TimeLike, tradable_mask
+from ..core.futures import get_futures_spec
+from ..core.money import _DECIMAL_ROUNDING, Money, RoundingMode
+from ..core.portfolio import CostBasis, InsufficientCashError, Portfolio, ShortSellingError
+from ..core.price_adjustment import AdjustMode, to_adjust_mode
+from ..core.request_time import DEFAULT_TIMEZONE, format_rfc3339
+from ..core.trading_calendar import TradingCalendar, get_calendar
+from ..core.universe import Universe
+from ..infrastructure.data_provider import (
+    CashDividend,
+    CorporateAction,
+    DataProvider,
+    RightsIssue,
+    Split,
+    match_market
+)
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import (
+    BacktestError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+from ..utils.random_streams import RandomStreams, derive_seed, new_seed
+
+if TYPE_CHECKING:
+    from .attribution import PnLAttribution
+    from .rebalance import RebalanceSchedule
+
+
+OPEN_FIELD = "$open"
+HIGH_FIELD = "$high"
+LOW_FIELD = "$low"
+CLOSE_FIELD = "$close"
+VWAP_FIELD = "$vwap"
+
+# 资金和持仓比较时允许的浮点误差
+_EPSILON = 1e-9
+
+
+def _is_positive(value) -> bool:
+    """是否为有限的正数 / Whether value is a finite positive number"""
+    if not isinstance(value, numbers.Real) or isinstance(value, bool):
+        return False
+    return math.isfinite(value) and value > 0
+
+
+class OrderSide(Enum):
+    """订单方向 / Order side"""
+    BUY = "buy"
+    SELL = "sell"
+
+
+class OrderType(Enum):
+    """
+    订单类型 / Order type
+    
+    止损单在K线价格触及止损价后触发：买入止损在最高价不低于止损价时触发，卖出止损在
+    最低价不高于止损价时触发。触发后STOP按市价成交，STOP_LIMIT按限价成交。
+    A stop triggers once the bar trades through its stop price: a buy stop
+    when the high reaches it and a sell stop when the low does. Once
+    triggered, STOP fills as a market order and STOP_LIMIT as a limit order.
+    """
+    MARKET = "market"  # 市价单
+    LIMIT = "limit"  # 限价单
+    STOP = "stop"  # 止损市价单
+    STOP_LIMIT = "stop_limit"  # 止损限价单
+
+
+class TimeInForce(Enum):
+    """
+    订单有效期 / Time in force
+    
+    DAY在Order.valid_for根K线内有效（默认为1，即当日）；GTC到回测结束前一直有效；
+    IOC只在第一根K线上撮合，未成交的部分立即取消。
+    DAY works for Order.valid_for bars (1 by default, i.e. the day), GTC until
+    the backtest ends, and IOC only on its first bar, cancelling whatever did
+    not fill there.
+    """
+    DAY = "day"
+    GTC = "gtc"
+    IOC = "ioc"
+
+
+class ExecutionMode(Enum):
+    """
+    订单执行方式 / When orders fill
+    
+    NEXT_OPEN、NEXT_CLOSE和NEXT_VWAP在策略看到K线之后的下一根K线成交，策略无法以已看到的
+    价格成交；SAME_CLOSE以策略刚看到的收盘价成交，结果偏乐观，仅用于收盘前
+    下单的近似。
+    NEXT_OPEN, NEXT_CLOSE and NEXT_VWAP fill on the bar after the one the
+    strategy saw, so a strategy can never trade at a price it has already
+    observed. SAME_CLOSE fills at the close the strategy has just seen; it is
+    optimistic and only approximates trading into the close.
+    
+    NEXT_VWAP需要$volume字段，成交量为0的K线没有成交均价，视为停牌；数据包含$vwap时以其为成交价，
+    否则用典型价格(最高价 + 最低价 + 收盘价) / 3近似，缺少最高、最低价时用开盘价和收盘价的均值，
+    加载数据时对缺少$vwap的标的记录警告。止损和限价仍按K线的最高、最低价判断是否触发，
+    只有成交价取成交量加权均价，且不劣于限价。
+    NEXT_VWAP needs $volume, as a bar without volume has no average price and
+    counts as suspended. The fill price is $vwap when the data has it;
+    otherwise it falls back to the typical price (high + low + close) / 3, or
+    the mean of open and close without highs and lows, and loading the data
+    logs a warning for each instrument lacking $vwap. Stops and limits still
+    trigger on the bar's high and low; only the fill price is the VWAP, never
+    worse than the limit.
+    """
+    NEXT_OPEN = "next_open"  # 下一根K线开盘价
+    NEXT_CLOSE = "next_close"  # 下一根K线收盘价
+    NEXT_VWAP = "next_vwap"  # 下一根K线成交量加权均价
+    SAME_CLOSE = "same_close"  # 当前K线收盘价
+
+
+class SuspensionPolicy(Enum):
+    """
+    停牌标的上的订单如何处理 / What happens to orders on a suspended instrument
+    
+    停牌按Bar.tradable判断，即成交量为0或停牌标记$suspended非零。CARRY和EXPIRE下停牌期间的K线
+    不计入订单的valid_for，IOC订单仍然直接取消。
+    Suspension follows Bar.tradable: zero volume or a nonzero $suspended
+    flag. Under CARRY and EXPIRE the suspended bars don't count against an
+    order's valid_for, and IOC orders are still cancelled outright.
+    """
+    REJECT = "reject"  # 直接拒绝
+    CARRY = "carry"  # 保留到复牌
+    EXPIRE = "expire"  # 保留到复牌，停牌超过suspension_expiry根K线时过期
+
+
+class FillKind(Enum):
+    """
+    成交类型 / Fill kind
+    
+    DELIST是回测引擎在退市日收盘后按退市结算价强制平仓的成交，见delisting模块；
+    RIGHTS是策略认购配股时按配股价买入的新股
+    DELIST is the forced liquidation the engine books at the settlement price
+    after the close of the delisting date, see the delisting module; RIGHTS
+    is the new shares bought at the subscription price when the strategy
+    takes up a rights issue
+    """
+    TRADE = "trade"  # 订单成交
+    DELIST = "delist"  # 退市结算
+    RIGHTS = "rights"  # 配股认购
+
+
+@dataclass(frozen=True)
+class Order:
+    """
+    策略下达的订单 / Order submitted by a strategy
+    
+    未指定order_type时按价格推断：只有limit_price为限价单，只有stop_price为止损单，
+    两者都有为止损限价单，都没有为市价单。订单在无法按价格成交（停牌、未达到限价、
+    未触发止损）时按tif保持有效；现金或持仓不足时立即拒绝。
+    Without order_type the type follows the prices: limit_price alone makes a
+    limit order, stop_price alone a stop, both a stop-limit and neither a
+    market order. An order that cannot fill on price (suspension, limit not
+    reached, stop not triggered) stays working as its tif allows;
+    insufficient cash or position rejects it at once.
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        side: 买卖方向，可传"buy"/"sell" / Side; "buy"/"sell" are accepted
+        quantity: 数量，必须为正数 / Quantity, must be positive
+        limit_price: 限价，买单不高于、卖单不低于该价格成交 /
+            Limit; buys fill at or below it, sells at or above it
+        valid_for: DAY订单的有效K线数，None表示到回测结束前一直有效；GTC订单为None，
+            IOC订单为1 / Bars a DAY order stays working, None keeping it until the
+            backtest ends; None for GTC and 1 for IOC orders
+        stop_price: 止损价 / Stop price
+        order_type: 订单类型，可传"limit"等，None时按价格推断 /
+            Order type, "limit" etc. are accepted; None infers it from the prices
+        tif: 有效期，可传"gtc"等 / Time in force; "gtc" etc. are accepted
+    """
+    instrument: str
+    side: OrderSide
+    quantity: float
+    limit_price: Optional[float] = None
+    valid_for: Optional[int] = 1
+    stop_price: Optional[float] = None
+    order_type: Optional[OrderType] = None
+    tif: TimeInForce = TimeInForce.DAY
+    
+    def __post_init__(self):
+        object.__setattr__(self, "side", OrderSide(self.side))
+        object.__setattr__(self, "tif", TimeInForce(self.tif))
+        if not _is_positive(self.quantity):
+            raise ValueError(f"Order quantity must be a positive number, got {self.quantity!r}")
+        if self.limit_price is not None and not _is_positive(self.limit_price):
+            raise ValueError(f"limit_price must be a positive number, got {self.limit_price!r}")
+        if self.stop_price is not None and not _is_positive(self.stop_price):
+            raise ValueError(f"stop_price must be a positive number, got {self.stop_price!r}")
+        if self.valid_for is not None and (
+            not isinstance(self.valid_for, int) or isinstance(self.valid_for, bool) or self.valid_for < 1
+        ):
+            raise ValueError(f"valid_for must be a positive integer or None, got {self.valid_for!r}")
+        
+        has_limit, has_stop = self.limit_price is not None, self.stop_price is not None
+        inferred = {
+            (False, False): OrderType.MARKET,
+            (True, False): OrderType.LIMIT,
+            (False, True): OrderType.STOP,
+            (True, True): OrderType.STOP_LIMIT,
+        }[(has_limit, has_stop)]
+        order_type = inferred if self.order_type is None else OrderType(self.order_type)
+        if order_type is not inferred:
+            raise ValueError(
+                f"{order_type.value} order doesn't match limit_price={self.limit_price!r} "
+                f"and stop_price={self.stop_price!r}"
+            )
+        object.__setattr__(self, "order_type", order_type)
+        
+        if self.tif is TimeInForce.GTC:
+            object.__setattr__(self, "valid_for", None)
+        elif self.tif is TimeInForce.IOC:
+            object.__setattr__(self, "valid_for", 1)
+    
+    @property
+    def is_limit(self) -> bool:
+        """是否有限价（限价单或止损限价单） / Whether the order has a limit (limit or stop-limit)"""
+        return self.limit_price is not None
+    
+    @property
+    def is_stop(self) -> bool:
+        """是否为止损单或止损限价单 / Whether this is a stop or stop-limit order"""
+        return self.stop_price is not None
+
+
+@dataclass
+class Fill:
+    """
+    成交记录 / Executed trade
+    
+    Attributes:
+        time: 成交K线时间 / Time of the bar the order filled on
+        instrument: 标的代码 / Instrument code
+        side: 买卖方向 / Side
+        quantity: 成交数量 / Filled quantity
+        price: 含滑点的成交价 / Fill price including slippage
+        commission: 手续费（含过户费等交易费用） / Commission, including fees such as transfer fees
+        tax: 印花税等税费，与commission一起从现金中扣除 / Taxes such as stamp tax, charged to cash along with commission
+        slippage: 滑点成本，即成交价相对执行价的不利差额乘以数量，已包含在price中 /
+            Slippage cost, the adverse gap between fill and execution price times quantity; already in price
+        kind: 成交类型，退市结算为FillKind.DELIST，配股认购为FillKind.RIGHTS /
+            Fill kind, FillKind.DELIST for a delisting settlement and FillKind.RIGHTS for a rights subscription
+        realized_pnl: 这笔成交按组合的成本核算方法实现的盈亏（不含费用，基准货币），开仓为0 /
+            P&L the fill realized under the portfolio's cost basis, excluding costs, in the base currency; 0 when opening
+        fx_rate: 成交时标的计价货币兑基准货币的汇率；price、commission、tax和slippage以计价货币表示 /
+            Rate of the quote currency into the base currency at the fill; price, commission, tax
+            and slippage are in the quote currency
+        resumption_gap: 在停牌后复牌的第一根K线上成交时，执行价相对停牌前最后收盘价的涨跌幅，
+            其他成交为None / For a fill on the first bar after a suspension, the move of
+            the execution price from the last close before it; None for other fills
+    """
+    time: pd.Timestamp
+    instrument: str
+    side: OrderSide
+    quantity: float
+    price: float
+    commission: float
+    tax: float = 0.0
+    slippage: float = 0.0
+    kind: FillKind = FillKind.TRADE
+    realized_pnl: float = 0.0
+    fx_rate: float = 1.0
+    resumption_gap: Optional[float] = None
+    
+    @property
+    def value(self) -> float:
+        """成交金额（不含手续费） / Traded value excluding commission"""
+        return self.quantity * self.price
+
+
+@dataclass
+class RejectedOrder:
+    """
+    未成交的订单 / Order that could not be filled
+    
+    Attributes:
+        time: 尝试成交的时间，回测结束时未成交的订单为最后一个交易日 /
+            Time the fill was attempted; the last day for orders left at the end
+        order: 原始订单 / Original order
+        reason: 原因 / Reason
+    """
+    time: pd.Timestamp
+    order: Order
+    reason: str
+
+
+@dataclass
+class CorporateActionRecord:
+    """
+    应用到持仓的公司行为 / Corporate action applied to a position
+    
+    Attributes:
+        time: 应用事件的交易日，即除权日或之后的第一个交易日 / Trading day the event applied on, the ex-date or the first one after
+        action: 公司行为事件 / Corporate action event
+        quantity: 应用前的持仓数量 / Quantity held before the event
+        new_quantity: 应用后的持仓数量 / Quantity held after the event
+        cash: 现金变动（基准货币），分红为税后金额，认购配股为负数 / Change in cash in the base currency,
+            net of tax for a dividend and negative for a rights subscription
+        tax: 代扣的分红税（基准货币） / Dividend tax withheld, in the base currency
+        note: 说明，如放弃配股的原因 / Note, e.g. why rights were not taken up
+    """
+    time: pd.Timestamp
+    action: CorporateAction
+    quantity: float
+    new_quantity: float
+    cash: float = 0.0
+    tax: float = 0.0
+    note: str = ""
+    
+    @property
+    def kind(self) -> str:
+        """事件类型：dividend、split或rights / Event kind: dividend, split or rights"""
+        return self.action.kind
+
+
+# 滑点函数：(订单, 参考价) -> 成交价 / Slippage function: (order, reference price) -> fill price
+SlippageFunction = Callable[[Order, float], float]
+# 手续费函数：(订单, 成交价) -> 手续费 / Commission function: (order, fill price) -> commission
+CommissionFunction = Callable[[Order, float], float]
+
+
+def no_slippage(order: Order, price: float) -> float:
+    """不计滑点 / No slippage"""
+    return price
+
+
+def fixed_bps_slippage(bps: float) -> SlippageFunction:
+    """
+    固定基点滑点：买入价上浮，卖出价下浮 / Fixed basis-point slippage against the trader
+    
+    Args:
+        bps: 基点数，1bp = 0.01% / Basis points, 1bp = 0.01%
+    
+    Returns:
+        SlippageFunction: 滑点函数 / Slippage function
+    """
+    if bps < 0:
+        raise ValueError(f"bps must be non-negative, got {bps}")
+    rate = bps / 10000.0
+    
+    def model(order: Order, price: float) -> float:
+        if order.side is OrderSide.BUY:
+            return price * (1.0 + rate)
+        return price * (1.0 - rate)
+    
+    return model
+
+
+def no_commission(order: Order, price: float) -> float:
+    """不计手续费 / No commission"""
+    return 0.0
+
+
+def percent_commission(rate: float, minimum: float = 0.0) -> CommissionFunction:
+    """
+    按成交金额比例收取手续费 / Commission as a fraction of traded value
+    
+    Args:
+        rate: 费率，如0.0003表示万三 / Rate, e.g. 0.0003 for 3bp
+        minimum: 单笔最低手续费 / Minimum commission per fill
+    
+    Returns:
+        CommissionFunction: 手续费函数 / Commission function
+    """
+    if rate < 0 or minimum < 0:
+        raise ValueError(f"rate and minimum must be non-negative, got {rate}, {minimum}")
+    
+    def model(order: Order, price: float) -> float:
+        return max(order.quantity * price * rate, minimum)
+    
+    return model
+
+
+VOLUME_FIELD = "$volume"
+
+
+class CostModel:
+    """
+    交易成本模型 / Trading cost model
+    
+    commission()和tax()为每笔成交的费用，分别记入Fill.commission和Fill.tax；slippage()返回每单位的
+    价格冲击（非负），由fill_price()按方向应用：买入价上浮，卖出价下浮，任何模型都不会让滑点
+    对交易者有利。基类不计任何成本，子类覆盖其中的方法；用CombinedCost组合费用模型和
+    SlippageModel。引擎把费用按EngineConfig.rounding舍入到万分之一后再记入成交和现金。
+    commission() and tax() are the fees of a fill, booked to Fill.commission
+    and Fill.tax; slippage() returns the per-unit price impact (non-negative)
+    and fill_price() applies it against the trader: buys fill higher and sells
+    lower, so no model can make slippage work in the trader's favour. The base
+    class charges nothing and subclasses override what they need; CombinedCost
+    joins a fee model with a SlippageModel. The engine rounds the fees to 1e-4
+    under EngineConfig.rounding before booking them to the fill and to cash.
+    
+    带随机性的模型（如RandomSlippage）覆盖seeded()，从引擎传入的随机数生成器抽样，
+    不使用全局的random模块，因此相同的EngineConfig.seed得到相同的成交。
+    Stochastic models (such as RandomSlippage) override seeded() to draw from
+    the generator the engine hands them rather than the global random module,
+    so the same EngineConfig.seed gives the same fills.
+    
+    Attributes:
+        needs_volume: 是否需要$volume字段，为True时引擎会获取成交量 /
+            Whether the model reads $volume; the engine fetches it when set
+    """
+    
+    needs_volume = False
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        """
+        计算手续费 / Compute the commission
+        
+        Args:
+            order: 订单 / Order
+            fill_price: 含滑点的成交价 / Fill price including slippage
+        
+        Returns:
+            float: 手续费 / Commission
+        """
+        return 0.0
+    
+    def tax(self, order: Order, fill_price: float) -> float:
+        """
+        计算税费，如印花税 / Compute taxes such as stamp tax
+        
+        Args:
+            order: 订单 / Order
+            fill_price: 含滑点的成交价 / Fill price including slippage
+        
+        Returns:
+            float: 税费 / Tax
+        """
+        return 0.0
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        """
+        计算每单位的价格冲击 / Compute the per-unit price impact
+        
+        Args:
+            order: 订单 / Order
+            ref_price: 参考价（执行价） / Reference (execution) price
+            volume: 成交K线的成交量，数据中没有时为None / Volume of the fill bar, None when the data has none
+        
+        Returns:
+            float: 非负的价格冲击 / Non-negative price impact
+        """
+        return 0.0
+    
+    def fill_price(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        """
+        含滑点的成交价 / Fill price including slippage
+        
+        Raises:
+            ValueError: slippage()返回负数或非有限值时抛出 / Raised when slippage() returns a negative or non-finite value
+        """
+        impact = float(self.slippage(order, ref_price, volume))
+        if not math.isfinite(impact) or impact < 0:
+            raise ValueError(f"{type(self).__name__}.slippage() must return a non-negative number, got {impact!r}")
+        if order.side is OrderSide.BUY:
+            return ref_price + impact
+        return ref_price - impact
+    
+    def seeded(self, rng: random.Random) -> "CostModel":
+        """
+        返回从rng抽样的模型，引擎在每次回测开始时调用 / Return the model drawing from rng; the engine calls it as each run starts
+        
+        确定性的模型返回自身；随机模型返回使用rng的副本，不修改原模型，
+        因此同一个模型可以在多次回测中复用
+        Deterministic models return themselves; stochastic ones return a copy
+        using rng and leave the original alone, so one model can be reused
+        across runs
+        
+        Args:
+            rng: 本次回测的随机数生成器 / Random generator of this run
+        
+        Returns:
+            CostModel: 从rng抽样的模型 / Model drawing from rng
+        """
+        return self
+
+
+class SlippageModel(CostModel):
+    """
+    只计滑点的成本模型 / Cost model that only prices slippage
+    
+    子类只实现slippage()，与费用模型通过CombinedCost组合使用，也可以单独作为cost_model
+    Subclasses only implement slippage(); combine one with a fee model through
+    CombinedCost, or use it alone as cost_model
+    """
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        return 0.0
+    
+    def tax(self, order: Order, fill_price: float) -> float:
+        return 0.0
+
+
+class ZeroCost(CostModel):
+    """不计手续费、税费和滑点，用于无摩擦测试和研究 / No fees or slippage, for frictionless testing and research"""
+
+
+class FixedBpsCommission(CostModel):
+    """
+    按成交金额的固定基点收取手续费 / Commission at fixed basis points of traded value
+    
+    Examples:
+        >>> FixedBpsCommission(3, minimum=5.0)  # 万三，最低5元 / 3bp, at least 5 per fill
+    """
+    
+    def __init__(self, bps: float, minimum: float = 0.0):
+        """
+        Args:
+            bps: 基点数，1bp = 0.01% / Basis points, 1bp = 0.01%
+            minimum: 单笔最低手续费 / Minimum commission per fill
+        """
+        if bps < 0 or minimum < 0:
+            raise ValueError(f"bps and minimum must be non-negative, got {bps}, {minimum}")
+        self.bps = bps
+        self.minimum = minimum
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        return max(order.quantity * fill_price * self.bps / 10000.0, self.minimum)
+
+
+# 按成交金额的固定基点计算全部交易成本的简单模型 / Simple model charging all costs as basis points of traded value
+BasisPointsModel = FixedBpsCommission
+
+
+class AShareCostModel(CostModel):
+    """
+    A股交易成本 / Chinese A-share trading costs
+    
+    佣金双向收取，有单笔最低佣金；印花税只在卖出时收取；过户费双向收取，只适用于
+    transfer_fee_markets中的市场（默认上交所）。佣金和过户费记入Fill.commission，印花税
+    记入Fill.tax。默认费率为当前的常见水平，均可配置。
+    Commission is charged on both sides with a per-fill minimum, stamp tax on
+    sells only, and the transfer fee on both sides but only in
+    transfer_fee_markets (Shanghai by default). Commission and transfer fee go
+    to Fill.commission and stamp tax to Fill.tax. The default rates are common
+    current levels and all of them are configurable.
+    
+    Examples:
+        >>> AShareCostModel(commission_rate=0.0003, stamp_tax_rate=0.001)  # 2023年8月之前的印花税
+        >>> CombinedCost(AShareCostModel(), FixedBpsSlippage(5))
+    """
+    
+    def __init__(
+        self,
+        commission_rate: float = 0.00025,
+        min_commission: float = 5.0,
+        stamp_tax_rate: float = 0.0005,
+        transfer_fee_rate: float = 0.00001,
+        transfer_fee_markets: Iterable[str] = ("SH",)
+    ):
+        """
+        Args:
+            commission_rate: 佣金费率，按成交金额 / Commission rate of traded value
+            min_commission: 单笔最低佣金 / Minimum commission per fill
+            stamp_tax_rate: 卖出印花税率 / Stamp tax rate on sells
+            transfer_fee_rate: 过户费率，按成交金额 / Transfer fee rate of traded value
+            transfer_fee_markets: 收取过户费的市场（交易所前缀） / Markets (exchange prefixes) charging the transfer fee
+        """
+        rates = (commission_rate, min_commission, stamp_tax_rate, transfer_fee_rate)
+        if any(rate < 0 for rate in rates):
+            raise ValueError(f"cost rates must be non-negative, got {rates}")
+        self.commission_rate = commission_rate
+        self.min_commission = min_commission
+        self.stamp_tax_rate = stamp_tax_rate
+        self.transfer_fee_rate = transfer_fee_rate
+        self.transfer_fee_markets = tuple(transfer_fee_markets)
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        value = order.quantity * fill_price
+        fee = max(value * self.commission_rate, self.min_commission)
+        if any(match_market(order.instrument, market) for market in self.transfer_fee_markets):
+            fee += value * self.transfer_fee_rate
+        return fee
+    
+    def tax(self, order: Order, fill_price: float) -> float:
+        if order.side is OrderSide.SELL:
+            return order.quantity * fill_price * self.stamp_tax_rate
+        return 0.0
+
+
+class PerShareCommission(CostModel):
+    """
+    按股数收取手续费 / Commission per share traded
+    
+    Examples:
+        >>> PerShareCommission(0.005, minimum=1.0)
+    """
+    
+    def __init__(self, per_share: float, minimum: float = 0.0):
+        """
+        Args:
+            per_share: 每股手续费 / Commission per share
+            minimum: 单笔最低手续费 / Minimum commission per fill
+        """
+        if per_share < 0 or minimum < 0:
+            raise ValueError(f"per_share and minimum must be non-negative, got {per_share}, {minimum}")
+        self.per_share = per_share
+        self.minimum = minimum
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        return max(order.quantity * self.per_share, self.minimum)
+
+
+class FixedBpsSlippage(SlippageModel):
+    """
+    按执行价的固定基点计算滑点 / Slippage at fixed basis points of the execution price
+    
+    Examples:
+        >>> FixedBpsSlippage(5)
+    """
+    
+    def __init__(self, bps: float):
+        """
+        Args:
+            bps: 基点数，1bp = 0.01% / Basis points, 1bp = 0.01%
+        """
+        if bps < 0:
+            raise ValueError(f"bps must be non-negative, got {bps}")
+        self.bps = bps
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        return ref_price * self.bps / 10000.0
+
+
+class SpreadSlippage(SlippageModel):
+    """
+    按买卖价差计算滑点 / Slippage from the bid-ask spread
+    
+    执行价视为买卖中间价，市价成交需要跨过半个价差；价差以执行价的基点表示，
+    可以设置最小价位，使价差不小于一个价位
+    The execution price is taken as the mid, and trading crosses half the
+    spread; the spread is in basis points of the execution price and can be
+    floored at one tick
+    
+    Examples:
+        >>> SpreadSlippage(10, tick=0.01)  # 价差10bp，至少一分钱 / 10bp spread, at least one cent
+    """
+    
+    def __init__(self, spread_bps: float, tick: float = 0.0):
+        """
+        Args:
+            spread_bps: 买卖价差，执行价的基点数 / Bid-ask spread in basis points of the execution price
+            tick: 最小价位，价差不小于它 / Tick size the spread is floored at
+        """
+        if spread_bps < 0 or tick < 0:
+            raise ValueError(f"spread_bps and tick must be non-negative, got {spread_bps}, {tick}")
+        self.spread_bps = spread_bps
+        self.tick = tick
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        return max(ref_price * self.spread_bps / 10000.0, self.tick) / 2.0
+
+
+class VolumeShareSlippage(SlippageModel):
+    """
+    按订单占成交量比例计算滑点 / Slippage from the order's share of bar volume
+    
+    价格冲击为ref_price * price_impact * share ** 2，share为订单数量占成交K线成交量的
+    比例，上限为1；数据没有成交量或成交量为0时按share = 1计算，宁可高估成本
+    The impact is ref_price * price_impact * share ** 2, where share is the
+    order quantity over the fill bar's volume, capped at 1. Without volume data
+    or on a zero-volume bar share is taken as 1, erring towards overstating costs
+    """
+    
+    needs_volume = True
+    
+    def __init__(self, price_impact: float = 0.1):
+        """
+        Args:
+            price_impact: 订单等于全部成交量时的价格冲击比例 / Impact fraction when the order equals the whole volume
+        """
+        if price_impact < 0:
+            raise ValueError(f"price_impact must be non-negative, got {price_impact}")
+        self.price_impact = price_impact
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        if volume is None or not math.isfinite(volume) or volume <= 0:
+            share = 1.0
+        else:
+            share = min(order.quantity / volume, 1.0)
+        return ref_price * self.price_impact * share ** 2
+
+
+class RandomSlippage(SlippageModel):
+    """
+    随机滑点 / Random slippage
+    
+    每笔成交的价格冲击为执行价的N(mean_bps, std_bps)个基点，小于0时取0。
+    在回测中由引擎按EngineConfig.seed播种；单独使用时可以传入rng。
+    Each fill's impact is N(mean_bps, std_bps) basis points of the execution
+    price, floored at zero. In a backtest the engine seeds it from
+    EngineConfig.seed; on its own it can be given an rng.
+    
+    Examples:
+        >>> CombinedCost(AShareCostModel(), RandomSlippage(5, 3))
+    """
+    
+    def __init__(self, mean_bps: float, std_bps: float, rng: Optional[random.Random] = None):
+        """
+        Args:
+            mean_bps: 滑点均值，基点数 / Mean slippage in basis points
+            std_bps: 滑点标准差，基点数 / Standard deviation of the slippage in basis points
+            rng: 随机数生成器，None表示新建一个未播种的生成器 / Random generator, None creates an unseeded one
+        """
+        if mean_bps < 0 or std_bps < 0:
+            raise ValueError(f"mean_bps and std_bps must be non-negative, got {mean_bps}, {std_bps}")
+        self.mean_bps = mean_bps
+        self.std_bps = std_bps
+        self._rng = rng or random.Random()
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        bps = self._rng.normalvariate(self.mean_bps, self.std_bps)
+        return ref_price * max(bps, 0.0) / 10000.0
+    
+    def seeded(self, rng: random.Random) -> "RandomSlippage":
+        model = copy.copy(self)
+        model._rng = rng
+        return model
+
+
+class CombinedCost(CostModel):
+    """
+    组合费用模型和滑点模型 / Combine a fee model with a slippage model
+    
+    Examples:
+        >>> CombinedCost(FixedBpsCommission(3), VolumeShareSlippage(0.1))
+        >>> CombinedCost(AShareCostModel(), SpreadSlippage(10))
+    """
+    
+    def __init__(self, commission: CostModel, slippage: CostModel):
+        """
+        Args:
+            commission: 提供commission()和tax()的模型 / Model providing commission() and tax()
+            slippage: 提供slippage()的模型，通常为SlippageModel / Model providing slippage(), usually a SlippageModel
+        """
+        self._commission = commission
+        self._slippage = slippage
+        self.needs_volume = slippage.needs_volume
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        return self._commission.commission(order, fill_price)
+    
+    def tax(self, order: Order, fill_price: float) -> float:
+        return self._commission.tax(order, fill_price)
+    
+    def slippage(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        return self._slippage.slippage(order, ref_price, volume)
+    
+    def fill_price(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        return self._slippage.fill_price(order, ref_price, volume)
+    
+    def seeded(self, rng: random.Random) -> "CombinedCost":
+        return CombinedCost(self._commission.seeded(rng), self._slippage.seeded(rng))
+
+
+class _FunctionCost(CostModel):
+    """把EngineConfig.slippage和commission函数包装为成本模型 / Wraps the EngineConfig slippage and commission functions"""
+    
+    def __init__(self, slippage: SlippageFunction, commission: CommissionFunction):
+        self._slippage = slippage
+        self._commission = commission
+    
+    def commission(self, order: Order, fill_price: float) -> float:
+        return self._commission(order, fill_price)
+    
+    def fill_price(self, order: Order, ref_price: float, volume: Optional[float] = None) -> float:
+        # 滑点函数直接返回成交价
+        return self._slippage(order, ref_price)
+
+
+class LimitAction(Enum):
+    """订单违反风险限制时的处理方式 / What happens to an order that breaks a risk limit"""
+    REJECT = "reject"  # 拒绝整笔订单
+    TRIM = "trim"  # 削减到限制允许的数量
+
+
+# 风险限制的名称，即RiskLimits中对应的属性名 / Names of the risk limits, the matching RiskLimits attributes
+RISK_LIMITS = (
+    "max_position_weight",
+    "max_gross_exposure",
+    "max_net_exposure",
+    "max_daily_turnover",
+    "max_volume_share",
+)
+
+
+class LotRoundingError(BacktestError):
+    """
+    整手取整错误 / Lot rounding error
+    
+    订单数量按RoundingPolicy取整到整手后为0时抛出
+    Raised when an order's quantity rounds to zero whole lots under a RoundingPolicy
+    """
+    
+    def __init__(self, order: Order, lot: int):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            order: 被拒绝的订单 / The rejected order
+            lot: 每手数量 / Quantity per lot
+        """
+        self.order = order
+        self.lot = lot
+        error_info = ErrorInfo(
+            error_code="BCK0012",
+            error_message_zh=f"订单数量{order.quantity:g}不足一手（{lot}）: {order.instrument}",
+            error_message_en=f"Order to {order.side.value} {order.quantity:g} {order.instrument} rounds to zero lots of {lot}",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.LOW,
+            technical_details=(
+                f"instrument={order.instrument}, side={order.side.value}, quantity={order.quantity}, lot={lot}"
+            ),
+            suggested_actions=[f"把订单数量设为{lot}的整数倍", "或把RoundingPolicy.quantity_mode设为UP或HALF_UP"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def _round_multiple(value: float, step: float, mode: RoundingMode) -> float:
+    """按十进制取整到step的整数倍，避免0.01这样的步长的二进制误差 / Round to a multiple of step in decimal, free of binary error"""
+    step = Decimal(str(step))
+    units = (Decimal(str(value)) / step).quantize(Decimal(1), rounding=_DECIMAL_ROUNDING[mode])
+    return float(units * step)
+
+
+@dataclass(frozen=True)
+class TickSize:
+    """
+    最小价位 / Tick size
+    
+    Attributes:
+        size: 价格的最小变动单位，如A股为0.01 / Smallest price increment, e.g. 0.01 for A-shares
+    """
+    size: float
+    
+    def __post_init__(self):
+        if not _is_positive(self.size):
+            raise ValueError(f"tick size must be a positive number, got {self.size!r}")
+    
+    def snap(self, price: float, mode: RoundingMode = RoundingMode.HALF_UP) -> float:
+        """
+        把价格取整到最小价位的整数倍 / Round a price to a whole number of ticks
+        
+        Args:
+            price: 价格 / Price
+            mode: 取整方式，默认取最近的价位 / Rounding mode; the nearest tick by default
+        
+        Returns:
+            float: 取整后的价格 / Rounded price
+        """
+        return _round_multiple(price, self.size, RoundingMode(mode))
+
+
+@dataclass(frozen=True)
+class LotSize:
+    """
+    每手数量 / Lot size
+    
+    Attributes:
+        size: 每手的股数或合约数，如A股为100 / Shares or contracts per lot, e.g. 100 for A-shares
+    """
+    size: int = 100
+    
+    def __post_init__(self):
+        if not isinstance(self.size, int) or isinstance(self.size, bool) or self.size < 1:
+            raise ValueError(f"lot size must be a positive integer, got {self.size!r}")
+    
+    def round(self, quantity: float, mode: RoundingMode = RoundingMode.DOWN) -> float:
+        """
+        把数量取整到整手 / Round a quantity to whole lots
+        
+        Args:
+            quantity: 数量 / Quantity
+            mode: 取整方式，默认向0截断 / Rounding mode; towards zero by default
+        
+        Returns:
+            float: 取整后的数量，可能为0 / Rounded quantity, possibly 0
+        """
+        return _round_multiple(quantity, self.size, RoundingMode(mode))
+
+
+@dataclass(frozen=True)
+class RoundingPolicy:
+    """
+    价格和数量的取整规则 / Rounding rules for prices and quantities
+    
+    设置tick时，订单的限价和止损价在下单时、成交价在计算滑点之后取整到最小价位；设置lot时，
+    订单数量在下单时取整到整手，取整为0的订单被拒绝，按成交量比例部分成交的数量向下取整到整手。
+    卖出全部多头持仓的订单不取整数量，以便卖出拆股、送股留下的零股。
+    With tick set, limit and stop prices snap to the tick when the order is
+    submitted and fill prices once slippage is applied; with lot set, order
+    quantities round to whole lots on submission, an order rounding to zero
+    is rejected, and partial fills under a participation limit round down to
+    whole lots. A sell that closes the whole long position keeps its
+    quantity, so odd lots left by splits and bonus issues can still be sold.
+    
+    Attributes:
+        tick: 最小价位，None表示不取整价格 / Tick size; None leaves prices as they are
+        lot: 每手数量，None表示不取整数量 / Lot size; None leaves quantities as they are
+        price_mode: 价格的取整方式，默认取最近的价位 / Price rounding; the nearest tick by default
+        quantity_mode: 订单数量的取整方式，默认向0截断，如150股取整为100股，UP时为200股 /
+            Quantity rounding; towards zero by default, so 150 shares become 100, or 200 with UP
+    
+    Examples:
+        >>> EngineConfig(..., rounding_policy=A_SHARE_ROUNDING)
+        >>> RoundingPolicy(TickSize(0.01), LotSize(100), quantity_mode=RoundingMode.HALF_UP)
+    """
+    tick: Optional[TickSize] = None
+    lot: Optional[LotSize] = None
+    price_mode: RoundingMode = RoundingMode.HALF_UP
+    quantity_mode: RoundingMode = RoundingMode.DOWN
+    
+    def __post_init__(self):
+        object.__setattr__(self, "price_mode", RoundingMode(self.price_mode))
+        object.__setattr__(self, "quantity_mode", RoundingMode(self.quantity_mode))
+    
+    def price(self, price: float) -> float:
+        """把价格取整到最小价位，没有设置tick时原样返回 / Snap a price to the tick; unchanged without a tick"""
+        return price if self.tick is None else self.tick.snap(price, self.price_mode)
+    
+    def apply(self, order: Order, held: float = 0.0) -> Order:
+        """
+        按规则取整订单的价格和数量 / Round an order's prices and quantity by the policy
+        
+        Args:
+            order: 订单 / Order
+            held: 当前持仓，卖出全部多头的订单不取整数量 / Current position; a sell of the whole long position keeps its quantity
+        
+        Returns:
+            Order: 取整后的订单，没有变化时为原订单 / Rounded order; the same order when nothing changes
+        
+        Raises:
+            LotRoundingError: 数量取整为0时抛出 / Raised when the quantity rounds to zero
+        """
+        changes = {}
+        if order.limit_price is not None:
+            changes["limit_price"] = self.price(order.limit_price)
+        if order.stop_price is not None:
+            changes["stop_price"] = self.price(order.stop_price)
+        closing = order.side is OrderSide.SELL and abs(order.quantity - held) <= _EPSILON
+        if self.lot is not None and not closing:
+            quantity = self.lot.round(order.quantity, self.quantity_mode)
+            if quantity <= 0:
+                raise LotRoundingError(order, self.lot.size)
+            changes["quantity"] = quantity
+        if all(getattr(order, name) == value for name, value in changes.items()):
+            return order
+        return replace(order, **changes)
+
+
+# A股：最小价位0.01元，每手100股 / A-shares: 0.01 yuan tick and 100-share lots
+A_SHARE_ROUNDING = RoundingPolicy(TickSize(0.01), LotSize(100))
+
+
+class RiskLimitError(BacktestError):
+    """
+    风险限制错误 / Risk limit error
+    
+    订单按成交后的假想组合违反REJECT限制，或按TRIM限制削减后没有剩余数量时抛出
+    Raised when an order breaks a REJECT limit on the post-trade hypothetical
+    portfolio, or when a TRIM limit leaves nothing of it
+    """
+    
+    def __init__(self, order: Order, limit: str, reason: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            order: 被拒绝的订单 / The rejected order
+            limit: 违反的限制，RISK_LIMITS中的名称 / The limit broken, a name from RISK_LIMITS
+            reason: 原因 / Reason
+        """
+        self.order = order
+        self.limit = limit
+        self.reason = reason
+        error_info = ErrorInfo(
+            error_code="BCK0011",
+            error_message_zh=f"订单违反风险限制{limit}: {reason}",
+            error_message_en=f"Order to {order.side.value} {order.quantity:g} {order.instrument} breaks risk limit {limit}",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.LOW,
+            technical_details=(
+                f"instrument={order.instrument}, side={order.side.value}, quantity={order.quantity}, limit={limit}"
+            ),
+            suggested_actions=["减少订单数量", f"放宽RiskLimits.{limit}，或把该限制的处理方式设为LimitAction.TRIM"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+@dataclass(frozen=True)
+class RiskLimits:
+    """
+    交易前风险限制 / Pre-trade risk limits
+    
+    每个限制都按订单成交后的假想组合计算：已有持仓按估值价格、订单标的按执行价估值，不计交易成本；
+    比例的分母为假想组合的权益，日换手率的分母为当日第一笔成交之前的权益。已经超过限制的组合仍然
+    可以下达降低该指标的订单，限制只阻止订单把指标推到限制（或原来的水平）以上。为None的限制不检查。
+    Every limit is evaluated on the hypothetical portfolio after the order
+    fills: holdings at their marks and the order's instrument at the
+    execution price, costs ignored. Ratios are over that portfolio's equity,
+    except daily turnover, which is over the equity before the day's first
+    fill. A portfolio already past a limit may still trade it back down; a
+    limit only stops an order from pushing its measure above the limit (or
+    above where it already was). Limits left as None are not checked.
+    
+    Attributes:
+        max_position_weight: 单个标的持仓市值的绝对值占权益的最大比例 /
+            Largest absolute position value in one instrument as a share of equity
+        max_gross_exposure: 全部持仓市值绝对值之和占权益的最大比例 /
+            Largest sum of absolute position values as a share of equity
+        max_net_exposure: 持仓市值（多头减空头）的绝对值占权益的最大比例 /
+            Largest absolute long-minus-short value as a share of equity
+        max_daily_turnover: 当日成交金额占权益的最大比例 / Largest value traded in a day as a share of equity
+        max_volume_share: 单笔订单数量占所在K线成交量的最大比例，没有成交量时订单被拒绝 /
+            Largest order quantity as a share of its bar's volume; orders are rejected without volume
+        action: 违反限制时的处理方式，可以是一个LimitAction，也可以是限制名到LimitAction的映射，
+            映射中未列出的限制为REJECT；可传"trim"等。削减整数数量的订单时向下取整 /
+            What happens on a breach: one LimitAction, or a map of limit name to
+            LimitAction with REJECT for unlisted limits; "trim" etc. are accepted.
+            Orders for whole units are trimmed down to whole units
+    """
+    max_position_weight: Optional[float] = None
+    max_gross_exposure: Optional[float] = None
+    max_net_exposure: Optional[float] = None
+    max_daily_turnover: Optional[float] = None
+    max_volume_share: Optional[float] = None
+    action: Union[LimitAction, str, Mapping[str, Union[LimitAction, str]]] = LimitAction.REJECT
+    
+    def __post_init__(self):
+        for name in RISK_LIMITS:
+            value = getattr(self, name)
+            if value is not None and not _is_positive(value):
+                raise ValueError(f"{name} must be a positive number, got {value!r}")
+        if self.max_volume_share is not None and self.max_volume_share > 1:
+            raise ValueError(f"max_volume_share must be in (0, 1], got {self.max_volume_share!r}")
+        if isinstance(self.action, Mapping):
+            unknown = sorted(set(self.action) - set(RISK_LIMITS))
+            if unknown:
+                raise ValueError(f"Unknown risk limits {unknown}, expected names from {list(RISK_LIMITS)}")
+            actions = {name: LimitAction(action) for name, action in self.action.items()}
+        else:
+            actions = dict.fromkeys(RISK_LIMITS, LimitAction(self.action))
+        object.__setattr__(self, "_actions", actions)
+    
+    def action_for(self, limit: str) -> LimitAction:
+        """某个限制的处理方式 / What happens on a breach of one limit"""
+        return self._actions.get(limit, LimitAction.REJECT)
+
+
+def pre_trade_check(
+    portfolio: Portfolio,
+    order: Order,
+    limits: RiskLimits,
+    price: float,
+    volume: Optional[float] = None,
+    traded_value: float = 0.0,
+    day_equity: Optional[float] = None
+) -> Order:
+    """
+    按风险限制检查订单 / Check an order against risk limits
+    
+    与回测引擎使用同一套规则，可以在实盘下单前调用
+    Applies the same rules as the backtest engine, so it can guard live orders
+    before they are sent
+    
+    Args:
+        portfolio: 下单前的组合 / Portfolio before the order
+        order: 订单 / Order
+        limits: 风险限制 / Risk limits
+        price: 预计执行价（计价货币） / Expected execution price, in the quote currency
+        volume: 订单所在K线的成交量，设置max_volume_share时需要 /
+            Volume of the bar the order trades on; needed with max_volume_share
+        traded_value: 当日已成交的金额（基准货币） / Value already traded today, in the base currency
+        day_equity: 日换手率的分母，None表示使用组合当前的权益 /
+            Denominator of daily turnover; None uses the portfolio's current equity
+    
+    Returns:
+        Order: 通过检查的订单，被TRIM限制削减时为数量减少后的订单 /
+            The order that passes, with a smaller quantity when a TRIM limit cut it
+    
+    Raises:
+        RiskLimitError: 违反REJECT限制，或削减后没有剩余数量时抛出 /
+            Raised on a breach of a REJECT limit, or when trimming leaves nothing
+    """
+    quantity, _ = _risk_check(portfolio, order, limits, price, volume, traded_value, day_equity)
+    return order if quantity == order.quantity else replace(order, quantity=quantity)
+
+
+def _risk_check(
+    portfolio: Portfolio,
+    order: Order,
+    limits: RiskLimits,
+    price: float,
+    volume: Optional[float],
+    traded_value: float,
+    day_equity: Optional[float]
+) -> Tuple[float, Optional[str]]:
+    """
+    按风险限制检查订单 / Check an order against risk limits
+    
+    Returns:
+        Tuple[float, Optional[str]]: (允许的数量, 削减的原因)，没有削减时原因为None /
+            (allowed quantity, why it was trimmed); the reason is None when it wasn't
+    """
+    spec = get_futures_spec(order.instrument)
+    unit = price * portfolio.fx_rate(order.instrument) * (spec.multiplier if spec is not None else 1.0)
+    sign = 1.0 if order.side is OrderSide.BUY else -1.0
+    holdings = portfolio.holdings
+    held = holdings.pop(order.instrument, None)
+    # 订单标的改按执行价估值；按执行价成交不改变权益
+    held_quantity = 0.0 if held is None else held.quantity
+    before = held_quantity * unit
+    equity = portfolio.equity + before - (0.0 if held is None else held.market_value)
+    # 顺着订单方向的持仓，买单为持仓数量，卖单为其相反数
+    along = sign * held_quantity
+    
+    # 每个限制允许的最大数量及超出时的原因
+    caps: Dict[str, Tuple[float, str]] = {}
+    if limits.max_position_weight is not None:
+        bound = max(limits.max_position_weight * equity, abs(before))
+        caps["max_position_weight"] = (bound / unit - along, f"持仓占权益的比例将超过{limits.max_position_weight:g}")
+    if limits.max_gross_exposure is not None:
+        others = sum(abs(p.market_value) for p in holdings.values())
+        bound = max(limits.max_gross_exposure * equity, others + abs(before))
+        caps["max_gross_exposure"] = (
+            (bound - others) / unit - along, f"总敞口占权益的比例将超过{limits.max_gross_exposure:g}"
+        )
+    if limits.max_net_exposure is not None:
+        net = sum(p.market_value for p in holdings.values()) + before
+        bound = max(limits.max_net_exposure * equity, abs(net))
+        caps["max_net_exposure"] = ((bound - sign * net) / unit, f"净敞口占权益的比例将超过{limits.max_net_exposure:g}")
+    if limits.max_daily_turnover is not None:
+        base = portfolio.equity if day_equity is None else day_equity
+        caps["max_daily_turnover"] = (
+            (limits.max_daily_turnover * base - traded_value) / unit,
+            f"当日换手率将超过{limits.max_daily_turnover:g}"
+        )
+    if limits.max_volume_share is not None:
+        if volume is None or not math.isfinite(volume) or volume <= 0:
+            caps["max_volume_share"] = (0.0, "没有成交量数据")
+        else:
+            caps["max_volume_share"] = (
+                limits.max_volume_share * volume, f"订单数量将超过K线成交量的{limits.max_volume_share:g}"
+            )
+    
+    quantity = order.quantity
+    trimmed = None
+    for limit, (cap, _) in caps.items():
+        if limits.action_for(limit) is LimitAction.TRIM and quantity > cap + _EPSILON:
+            quantity, trimmed = max(cap, 0.0), limit
+    if trimmed is not None and float(order.quantity).is_integer():
+        quantity = float(math.floor(quantity + _EPSILON))
+    for limit, (cap, reason) in caps.items():
+        if limits.action_for(limit) is LimitAction.REJECT and quantity > cap + _EPSILON:
+            raise RiskLimitError(order, limit, reason)
+    if quantity <= _EPSILON:
+        raise RiskLimitError(order, trimmed, caps[trimmed][1])
+    if trimmed is None:
+        return quantity, None
+    return quantity, f"按风险限制{trimmed}削减为{quantity:g}: {caps[trimmed][1]}"
+
+
+@dataclass
+class EngineConfig:
+    """
+    回测引擎配置 / Backtest engine configuration
+    
+    Attributes:
+        start_time: 回测开始日期 / Backtest start date
+        end_time: 回测结束日期（包含） / Backtest end date (inclusive)
+        instruments: 标的代码、代码列表或标的池，为None时使用data中的全部标的。标的池按时间点
+            使用：每根K线只有当日的成分股出现在bars和ctx.members中，不是成分股的标的不能买入，
+            已有的持仓仍然可以卖出 / Code, list of codes or universe; None uses every
+            instrument in data. A universe applies point-in-time: on each bar only
+            that day's members appear in bars and ctx.members, and non-members
+            can't be bought while held positions can still be sold
+        fields: 策略需要的额外字段或表达式，$open和$close总是会获取 /
+            Extra fields or expressions for the strategy; $open and $close are always fetched
+        initial_cash: 初始资金 / Starting cash
+        execution_mode: 订单执行方式 / When orders fill
+        slippage: 滑点函数，设置cost_model时不能使用 / Slippage function, not allowed with cost_model
+        commission: 手续费函数，设置cost_model时不能使用 / Commission function, not allowed with cost_model
+        cost_model: 交易成本模型，None表示使用slippage和commission函数 /
+            Trading cost model; None uses the slippage and commission functions
+        allow_short: 是否允许卖出超过持仓（做空） / Whether sells beyond the position (shorts) are allowed
+        participation_rate: 每根K线上一个标的的成交量最多占该K线成交量的比例，超出的部分按
+            订单的tif留到之后的K线或取消；None表示不限制 / Largest share of a bar's volume an
+            instrument's fills may take on that bar, the rest carried or cancelled per
+            the order's tif; None for no limit
+        risk_limits: 交易前风险限制，在成交之前按成交后的假想组合检查每笔订单，违反限制的订单被拒绝或
+            削减，记入rejected_orders；None表示不检查 / Pre-trade risk limits checking each order
+            on the post-trade hypothetical portfolio before it fills; breaching orders are
+            rejected or trimmed and recorded in rejected_orders. None checks nothing
+        cost_basis: 组合的成本核算方法 / Cost basis of the portfolio
+        rounding: 手续费、税费和现金的舍入方式，精确到万分之一，默认银行家舍入 /
+            Rounding of commissions, taxes and cash to 1e-4, banker's rounding by default
+        seed: 随机成本模型和策略随机数流（BarContext.rng()）的随机种子，相同的种子和输入得到
+            相同的成交和权益曲线；None表示随机选取，实际使用的种子记录在EngineResult.seed中 /
+            Seed for stochastic cost models and the strategy's random streams
+            (BarContext.rng()); the same seed and inputs give the same fills and
+            equity curve. None picks one at random and records it in EngineResult.seed
+        lookahead_guard: 是否防止未来函数：策略读取当前K线之后的数据时抛出LookaheadError，
+            fields中负偏移的Ref（如Ref($close,-1)）在运行前被拒绝；关闭后恢复不做检查的旧行为 /
+            Whether to guard against lookahead: a strategy reading data after the
+            current bar gets LookaheadError, and a negative Ref offset in fields
+            (e.g. Ref($close,-1)) is rejected before the run. Turning it off
+            restores the old unchecked behaviour
+        base_currency: 组合记账和权益曲线使用的货币 / Currency of the books and the equity curve
+        fx: 外币标的（见currency模块）折算为base_currency的汇率，全部标的都以base_currency计价时
+            可以为None / Rates converting foreign-currency instruments (see the currency
+            module) into base_currency; may be None when every instrument is quoted in it
+        checkpoint_path: 检查点文件，设置时收到SIGTERM会在当前K线结束后写入检查点并抛出
+            BacktestInterruptedError / Checkpoint file; when set, SIGTERM writes a checkpoint
+            once the current bar is done and raises BacktestInterruptedError
+        checkpoint_every: 每隔多少根K线写入一次检查点，None表示只在SIGTERM时写入，需要checkpoint_path /
+            Bars between checkpoints, None to write one only on SIGTERM; needs checkpoint_path
+        corporate_actions: 在除权日把现金分红、拆股和配股应用到持仓，并通过BarContext.actions()提供给
+            策略：True表示通过数据管理器的get_corporate_actions()获取（包括业绩公告），也可以是预先获取的
+            标的代码到事件列表的映射。价格数据应为不复权价格，因此不能与前、后复权同时使用 /
+            Apply cash dividends, splits and rights issues to positions on their
+            ex-dates and show them to the strategy through BarContext.actions(): True
+            fetches them, earnings announcements included, through the data manager's
+            get_corporate_actions(), or pass a pre-fetched mapping of code to events.
+            Prices should be unadjusted, so this can't be combined with pre or post
+            adjustment
+        dividend_tax_rate: 多头收到现金分红时代扣的税率 / Tax withheld from cash dividends on long positions
+        rounding_policy: 价格和数量的取整规则，也可以是交易所前缀（如"SH"，见match_market()）到规则的映射，
+            按顺序使用第一个匹配的规则，没有匹配时不取整；None表示不取整 / Rounding of prices and
+            quantities, or a mapping of exchange prefix (e.g. "SH", see match_market()) to
+            rules where the first match applies and nothing matching means no rounding;
+            None rounds nothing
+        suspension: 停牌标的上的订单的处理方式，停牌根据数据中的$volume和$suspended判断，需要时在fields中
+            加入这两个字段 / Handling of orders on suspended instruments; suspension is read
+            from $volume and $suspended in the data, so add them to fields as needed
+        suspension_expiry: EXPIRE方式下订单最多等待的停牌K线数 /
+            Suspended bars an order waits at most under EXPIRE
+        calendar: 交易日历或市场名称，None表示按数据中出现的日期步进 /
+            Trading calendar or market name; None steps over the dates present in the data
+        provider: 数据提供者，传给get_features() / Data provider passed to get_features()
+        adjust: 复权方式，传给get_features() / Price adjustment passed to get_features()
+        data: 预先获取的特征数据，提供时不再调用get_features() /
+            Pre-fetched feature data; get_features() is not called when given
+    """
+    start_time: str
+    end_time: str
+    instruments: Optional[Union[str, List[str], Universe]] = None
+    fields: List[str] = field(default_factory=list)
+    initial_cash: float = 1_000_000.0
+    execution_mode: ExecutionMode = ExecutionMode.NEXT_OPEN
+    slippage: SlippageFunction = no_slippage
+    commission: CommissionFunction = no_commission
+    cost_model: Optional[CostModel] = None
+    allow_short: bool = False
+    participation_rate: Optional[float] = None
+    risk_limits: Optional[RiskLimits] = None
+    cost_basis: CostBasis = CostBasis.AVERAGE
+    rounding: RoundingMode = RoundingMode.HALF_EVEN
+    seed: Optional[int] = None
+    lookahead_guard: bool = True
+    base_currency: str = BASE_CURRENCY
+    fx: Optional[FXProvider] = None
+    checkpoint_path: Optional[Union[str, Path]] = None
+    checkpoint_every: Optional[int] = None
+    corporate_actions: Union[bool, Dict[str, List[CorporateAction]]] = False
+    dividend_tax_rate: float = 0.0
+    rounding_policy: Optional[Union[RoundingPolicy, Dict[str, RoundingPolicy]]] = None
+    suspension: SuspensionPolicy = SuspensionPolicy.CARRY
+    suspension_expiry: Optional[int] = None
+    calendar: Optional[Union[str, TradingCalendar]] = None
+    provider: Optional[Union[str, DataProvider]] = None
+    adjust: Optional[Union[str, AdjustMode]] = None
+    data: Optional[Dict[str, pd.DataFrame]] = None
+    
+    def write(self, stream: Union[str, Path, TextIO], format: Optional[str] = None) -> None:
+        """
+        把配置写成YAML或JSON文档，load_engine_config()可以读回，见engine_config模块 /
+        Write the configuration as YAML or JSON that load_engine_config() reads back, see the engine_config module
+        
+        Args:
+            stream: 文件路径或文本流 / File path or text stream
+            format: "yaml"或"json"，None表示按文件后缀判断 / "yaml" or "json"; None goes by the file suffix
+        
+        Raises:
+            ValueError: 配置包含无法用文档表示的设置（如data或fx）时抛出 /
+                Raised when the configuration holds settings a document can't express, such as data or fx
+        """
+        from .engine_config import write_engine_config
+        write_engine_config(self, stream, format)
+
+
+@dataclass
+class PnLBreakdown:
+    """
+    盈亏的成本分解 / Cost breakdown of P&L
+    
+    gross为不计任何交易成本时的盈亏，net = gross - commission - tax - slippage
+    gross is the P&L before any trading cost, and
+    net = gross - commission - tax - slippage
+    
+    Attributes:
+        gross: 成本前盈亏 / P&L before costs
+        commission: 手续费合计 / Total commission
+        tax: 税费合计 / Total taxes
+        slippage: 滑点成本合计 / Total slippage cost
+    """
+    gross: float
+    commission: float
+    tax: float
+    slippage: float
+    
+    @property
+    def costs(self) -> float:
+        """交易成本合计 / Total trading costs"""
+        return self.commission + self.tax + self.slippage
+    
+    @property
+    def net(self) -> float:
+        """扣除成本后的盈亏 / P&L after costs"""
+        return self.gross - self.costs
+    
+    def to_dict(self) -> Dict[str, float]:
+        """转换为字典，包含net / Convert to a dict including net"""
+        return {
+            "gross": self.gross,
+            "commission": self.commission,
+            "tax": self.tax,
+            "slippage": self.slippage,
+            "net": self.net,
+        }
+
+
+@dataclass
+class EngineResult:
+    """
+    回测引擎结果 / Backtest engine result
+    
+    equity_curve、cash_curve和daily_positions以交易日为索引，可以像价格数据一样
+    用slice()或result["2025-01-01", "2025-06-30"]按日期区间截取。
+    equity_curve, cash_curve and daily_positions are indexed by trading day, so
+    the result can be cut to a date range with slice() or
+    result["2025-01-01", "2025-06-30"] just like price data.
+    
+    Attributes:
+        equity_curve: 每个交易日所有成交之后按收盘价计算的总权益 /
+            Total equity after each day's fills, marked at the close
+        trades: 成交记录，按成交顺序排列 / Fills in execution order
+        positions: 回测结束时的非零持仓 / Final non-zero positions
+        cash: 回测结束时的现金 / Final cash
+        rejected_orders: 被拒绝或过期的订单 / Orders that were rejected or expired
+        cash_curve: 每个交易日结束时的现金 / Cash at the end of each day
+        daily_positions: 每个交易日结束时的持仓，每个持有过的标的一列 /
+            Positions at the end of each day, one column per instrument ever held
+        initial_cash: 期初权益，用于盈亏分解；截取后为区间开始前一日的权益 /
+            Starting equity used by pnl_breakdown(); after slice() the equity of the day before the range
+        seed: 本次回测使用的随机种子，传给EngineConfig.seed可以重现 /
+            Seed the run used; pass it as EngineConfig.seed to reproduce the run
+        currency_exposure: 每个交易日结束时按计价货币汇总、折算为基准货币的持仓市值，每种持有过的
+            货币一列 / Market value in the base currency summed by quote currency at the end of
+            each day, one column per currency ever held
+        corporate_actions: 应用到持仓的公司行为，按应用顺序排列；认购配股的成交同时记入trades /
+            Corporate actions applied to positions in the order applied; rights
+            subscriptions are also in trades
+        instrument_pnl: 每个交易日结束时各标的自期初以来的累计盈亏（扣除费用、计入分红），每个持有过的
+            标的一列，各列之和等于权益减期初权益 / Cumulative P&L of each instrument since the start at
+            the end of each day, net of fees and with dividends, one column per instrument ever held;
+            the columns sum to equity minus the starting equity
+    """
+    equity_curve: pd.Series
+    trades: List[Fill]
+    positions: Dict[str, float]
+    cash: float
+    rejected_orders: List[RejectedOrder] = field(default_factory=list)
+    cash_curve: pd.Series = field(default_factory=lambda: pd.Series(dtype=float))
+    daily_positions: FeatureFrame = field(default_factory=FeatureFrame)
+    initial_cash: Optional[float] = None
+    seed: Optional[int] = None
+    currency_exposure: FeatureFrame = field(default_factory=FeatureFrame)
+    corporate_actions: List[CorporateActionRecord] = field(default_factory=list)
+    instrument_pnl: FeatureFrame = field(default_factory=FeatureFrame)
+    
+    @property
+    def final_equity(self) -> float:
+        """最终权益 / Final equity"""
+        if self.equity_curve.empty:
+            return self.cash
+        return float(self.equity_curve.iloc[-1])
+    
+    @property
+    def returns(self) -> pd.Series:
+        """日收益率序列，首日为0 / Daily returns, 0 on the first day"""
+        return self.equity_curve.pct_change().fillna(0.0)
+    
+    @property
+    def drawdown(self) -> pd.Series:
+        """每日相对此前最高权益的回撤，为0或负数 / Daily drawdown from the running peak, zero or negative"""
+        peak = self.equity_curve.cummax()
+        return (self.equity_curve / peak.where(peak > 0) - 1.0).rename("drawdown")
+    
+    def equity_frame(self) -> pd.DataFrame:
+        """
+        逐日的权益、现金、收益率和回撤 / Daily equity, cash, return and drawdown
+        
+        Returns:
+            pd.DataFrame: 以交易日为索引，列为equity、cash、return和drawdown /
+                Indexed by trading day with columns equity, cash, return and drawdown
+        """
+        index = self.equity_curve.index
+        cash = self.cash_curve.to_numpy(dtype=float) if len(self.cash_curve) == len(index) else np.nan
+        return pd.DataFrame({
+            "equity": self.equity_curve.to_numpy(dtype=float),
+            "cash": cash,
+            "return": self.returns.to_numpy(dtype=float),
+            "drawdown": self.drawdown.to_numpy(dtype=float),
+        }, index=pd.DatetimeIndex(index, name="date"))
+    
+    @property
+    def resumption_fills(self) -> List[Fill]:
+        """
+        停牌后复牌第一根K线上的成交，用于检查跳空风险 / Fills on the first bar after a suspension, for auditing gap risk
+        
+        成交的resumption_gap为执行价相对停牌前最后收盘价的涨跌幅
+        Each fill's resumption_gap is the move of its execution price from the last close before the suspension
+        """
+        return [t for t in self.trades if t.resumption_gap is not None]
+    
+    def trades_frame(self) -> pd.DataFrame:
+        """
+        把成交记录转换为表格 / Convert the fills to a table
+        
+        entry_time为这笔成交所属持仓（从空仓开始）的开仓时间；exit_time在成交减少或了结持仓时
+        为成交时间，开仓和加仓时为空
+        entry_time is when the position the fill belongs to was opened from
+        flat; exit_time is the fill time when it reduces or closes the position
+        and empty when it opens or adds to one
+        
+        Returns:
+            pd.DataFrame: 每笔成交一行，列为time、instrument、side、quantity、price、value、
+                commission、tax、slippage、kind、entry_time、exit_time和realized_pnl / One row
+                per fill with columns time, instrument, side, quantity, price, value,
+                commission, tax, slippage, kind, entry_time, exit_time and realized_pnl
+        """
+        columns = [
+            "time", "instrument", "side", "quantity", "price", "value", "commission", "tax", "slippage", "kind",
+            "entry_time", "exit_time", "realized_pnl"
+        ]
+        return pd.DataFrame(
+            [
+                [
+                    t.time, t.instrument, t.side.value, t.quantity, t.price, t.value,
+                    t.commission, t.tax, t.slippage, t.kind.value, entry, exit_time, t.realized_pnl
+                ]
+                for t, (entry, exit_time) in zip(self.trades, _holding_times(self.trades))
+            ],
+            columns=columns
+        )
+    
+    def corporate_actions_frame(self) -> pd.DataFrame:
+        """
+        把公司行为记录转换为表格 / Convert the corporate action records to a table
+        
+        Returns:
+            pd.DataFrame: 每个事件一行，列为time、instrument、kind、ex_date、quantity、new_quantity、
+                cash、tax和note / One row per event with columns time, instrument, kind,
+                ex_date, quantity, new_quantity, cash, tax and note
+        """
+        columns = ["time", "instrument", "kind", "ex_date", "quantity", "new_quantity", "cash", "tax", "note"]
+        return pd.DataFrame(
+            [
+                [
+                    r.time, r.action.instrument, r.kind, r.action.ex_date, r.quantity, r.new_quantity,
+                    r.cash, r.tax, r.note
+                ]
+                for r in self.corporate_actions
+            ],
+            columns=columns
+        )
+    
+    def write_equity_csv(self, path: str) -> None:
+        """把equity_frame()写入CSV文件 / Write equity_frame() to a CSV file"""
+        self.equity_frame().to_csv(path)
+    
+    def write_trades_csv(self, path: str) -> None:
+        """把trades_frame()写入CSV文件 / Write trades_frame() to a CSV file"""
+        self.trades_frame().to_csv(path, index=False)
+    
+    def write_csv(self, directory: Union[str, Path], timezone: str = DEFAULT_TIMEZONE) -> None:
+        """
+        把权益、成交和持仓分别写入目录下的CSV文件 / Write the equity, trades and positions as CSV files in a directory
+        
+        写入equity.csv（equity_frame()）、trades.csv（trades_frame()）、positions.csv
+        （daily_positions）和corporate_actions.csv（corporate_actions_frame()）。时间写作带偏移的
+        RFC3339，不带时区的时间视为timezone的本地时间；浮点数按能原样读回的精度写出。
+        Writes equity.csv (equity_frame()), trades.csv (trades_frame()),
+        positions.csv (daily_positions) and corporate_actions.csv
+        (corporate_actions_frame()). Times are RFC3339 with an offset, naive
+        ones taken as local to timezone, and floats are written with enough
+        digits to read back exactly.
+        
+        Args:
+            directory: 目录，不存在时创建 / Directory, created when missing
+            timezone: 不带时区的时间所在的时区 / Timezone of naive times
+        """
+        directory = Path(directory)
+        directory.mkdir(parents=True, exist_ok=True)
+        for name, frame, index in self._export_frames(timezone):
+            frame.to_csv(directory / f"{name}.csv", index=index)
+    
+    def write_json(self, stream: Union[str, Path, TextIO], timezone: str = DEFAULT_TIMEZONE) -> None:
+        """
+        把结果写成一个JSON文档 / Write the result as a single JSON document
+        
+        文档包含initial_cash、final_equity、cash、seed、positions（最终持仓），以及与write_csv()
+        的四个文件逐行对应的equity、trades、daily_positions和corporate_actions记录列表和
+        rejected_orders；NaN写作null。
+        The document holds initial_cash, final_equity, cash, seed, positions
+        (the final ones), the equity, trades, daily_positions and
+        corporate_actions record lists matching the rows of write_csv()'s four
+        files, and rejected_orders; NaN is written as null.
+        
+        Args:
+            stream: 文件路径或文本流 / File path or text stream
+            timezone: 不带时区的时间所在的时区 / Timezone of naive times
+        """
+        document: Dict[str, Any] = {
+            "initial_cash": self.initial_cash,
+            "final_equity": self.final_equity,
+            "cash": self.cash,
+            "seed": self.seed,
+            "positions": dict(self.positions),
+        }
+        for name, frame, index in self._export_frames(timezone):
+            if index:
+                frame = frame.reset_index()
+            records = frame.astype(object).where(frame.notna(), None).to_dict(orient="records")
+            document["daily_positions" if name == "positions" else name] = records
+        document["rejected_orders"] = [
+            {
+                "time": format_rfc3339(r.time, timezone),
+                "instrument": r.order.instrument,
+                "side": r.order.side.value,
+                "quantity": r.order.quantity,
+                "reason": r.reason,
+            }
+            for r in self.rejected_orders
+        ]
+        
+        if isinstance(stream, (str, Path)):
+            with open(stream, "w", encoding="utf-8") as f:
+                json.dump(document, f, ensure_ascii=False, allow_nan=False)
+        else:
+            json.dump(document, stream, ensure_ascii=False, allow_nan=False)
+    
+    def _export_frames(self, timezone: str) -> List[Tuple[str, pd.DataFrame, bool]]:
+        """write_csv()和write_json()导出的(名称, 表格, 是否带索引) / (name, table, has index) exported by both writers"""
+        def times(values) -> List[Optional[str]]:
+            return [None if pd.isna(v) else format_rfc3339(v, timezone) for v in values]
+        
+        equity = self.equity_frame()
+        equity.index = pd.Index(times(equity.index), name="date")
+        trades = self.trades_frame()
+        for column in ("time", "entry_time", "exit_time"):
+            trades[column] = times(trades[column])
+        positions = pd.DataFrame(self.daily_positions, copy=True)
+        positions.index = pd.Index(times(positions.index), name="date")
+        actions = self.corporate_actions_frame()
+        for column in ("time", "ex_date"):
+            actions[column] = times(actions[column])
+        return [
+            ("equity", equity, True), ("trades", trades, False), ("positions", positions, True),
+            ("corporate_actions", actions, False)
+        ]
+    
+    def write_html(self, path: str, title: Optional[str] = None, rf: float = 0.0) -> None:
+        """
+        写入自包含的HTML报告 / Write a self-contained HTML report
+        
+        报告包含权益、回撤、月度收益、持仓市值占比、绩效汇总和可排序的成交列表，
+        不引用外部资源，可以离线打开，见engine_report模块
+        The report holds the equity, drawdown, monthly returns, invested share,
+        metrics summary and a sortable trade list, with nothing external, so it
+        opens offline; see the engine_report module
+        
+        Args:
+            path: 文件路径 / File path
+            title: 报告标题，None时使用默认标题 / Report title, None for the default
+            rf: 年化无风险利率 / Annual risk-free rate
+        """
+        from .engine_report import DEFAULT_TITLE, write_html
+        write_html(self, path, title or DEFAULT_TITLE, rf)
+    
+    def pnl_breakdown(self) -> PnLBreakdown:
+        """
+        把盈亏分解为成本前盈亏和各项交易成本 / Split P&L into pre-cost P&L and each trading cost
+        
+        net为最终权益减去期初权益，成本为trades中各项之和（税费另含代扣的分红税），gross由两者推出
+        net is final equity minus starting equity, the costs are summed over
+        trades (with dividend tax withheld counted as tax) and gross follows
+        from the two
+        
+        Returns:
+            PnLBreakdown: 盈亏分解 / Breakdown of the P&L
+        
+        Raises:
+            ValueError: 结果没有期初权益时抛出 / Raised when the result has no starting equity
+        """
+        if self.initial_cash is None:
+            raise ValueError("result has no initial_cash, so its P&L can't be broken down")
+        commission = sum(t.commission * t.fx_rate for t in self.trades)
+        tax = sum(t.tax * t.fx_rate for t in self.trades) + sum(r.tax for r in self.corporate_actions)
+        slippage = sum(t.slippage * t.fx_rate for t in self.trades)
+        net = self.final_equity - self.initial_cash
+        return PnLBreakdown(
+            gross=net + commission + tax + slippage,
+            commission=commission,
+            tax=tax,
+            slippage=slippage
+        )
+    
+    def attribution(self, prices: Optional[Mapping[str, pd.DataFrame]] = None) -> "PnLAttribution":
+        """
+        按标的、行业和月份分解盈亏，并统计每笔交易 / Break P&L down by instrument, sector and month, with per-trade statistics
+        
+        每一项分为价格盈亏、分红和成本拖累，合计与权益变动一致，见attribution模块
+        Each piece splits into price P&L, dividends and cost drag, and the
+        totals reconcile with the change in equity; see the attribution module
+        
+        Args:
+            prices: 标的代码到价格数据（如EngineConfig.data），用于计算MAE和MFE；None时不计算 /
+                Instrument code to price data, such as EngineConfig.data, for MAE and MFE; None skips them
+        
+        Returns:
+            PnLAttribution: 盈亏归因 / P&L attribution
+        
+        Raises:
+            ValueError: 结果没有期初权益或每个标的的盈亏时抛出 /
+                Raised when the result has no starting equity or per-instrument P&L
+        """
+        from .attribution import attribute
+        return attribute(self, prices)
+    
+    def slice(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> "EngineResult":
+        """
+        按日期区间截取结果（包含边界） / Cut the result to a date range (inclusive)
+        
+        截取后的positions和cash为区间最后一个交易日结束时的状态，
+        trades、rejected_orders和corporate_actions只保留区间内的记录
+        The sliced positions and cash are the state at the end of the last day
+        in the range; trades, rejected_orders and corporate_actions keep only
+        records inside it
+        
+        Args:
+            start: 开始时间（包含），None表示不限 / Start (inclusive), None for unbounded
+            end: 结束时间（包含），None表示不限 / End (inclusive), None for unbounded
+        
+        Returns:
+            EngineResult: 区间内的结果 / Result within the range
+        """
+        lo = None if start is None else pd.Timestamp(start)
+        hi = None if end is None else pd.Timestamp(end)
+        
+        def inside(t: pd.Timestamp) -> bool:
+            return (lo is None or t >= lo) and (hi is None or t <= hi)
+        
+        mask = [inside(t) for t in self.equity_curve.index]
+        cash_curve = self.cash_curve[mask] if len(self.cash_curve) == len(mask) else self.cash_curve
+        daily_positions = self.daily_positions.slice(start, end)
+        if len(daily_positions):
+            last = daily_positions.iloc[-1]
+            positions = {str(code): float(qty) for code, qty in last.items() if abs(qty) > _EPSILON}
+        else:
+            positions = {}
+        first = next((i for i, kept in enumerate(mask) if kept), None)
+        if first is None:
+            initial_cash = None
+        elif first == 0:
+            initial_cash = self.initial_cash
+        else:
+            initial_cash = float(self.equity_curve.iloc[first - 1])
+        instrument_pnl = self.instrument_pnl.slice(start, end)
+        if first and len(instrument_pnl) and len(self.instrument_pnl) == len(mask):
+            # 从区间开始前一日起累计，与initial_cash一致
+            instrument_pnl = instrument_pnl - self.instrument_pnl.iloc[first - 1]
+        return EngineResult(
+            equity_curve=self.equity_curve[mask],
+            trades=[t for t in self.trades if inside(t.time)],
+            positions=positions,
+            cash=float(cash_curve.iloc[-1]) if len(cash_curve) else self.cash,
+            rejected_orders=[r for r in self.rejected_orders if inside(r.time)],
+            cash_curve=cash_curve,
+            daily_positions=daily_positions,
+            initial_cash=initial_cash,
+            seed=self.seed,
+            currency_exposure=self.currency_exposure.slice(start, end),
+            corporate_actions=[r for r in self.corporate_actions if inside(r.time)],
+            instrument_pnl=instrument_pnl
+        )
+    
+    def __getitem__(self, key) -> "EngineResult":
+        # 与FeatureFrame一致的result["2025-01-01", "2025-06-30"]区间截取
+        if not (isinstance(key, tuple) and len(key) == 2):
+            raise TypeError("EngineResult only supports result[start, end] date-range slicing")
+        return self.slice(*key)
+
+
+class LookaheadError(BacktestError):
+    """
+    未来数据访问错误 / Lookahead access error
+    
+    开启lookahead_guard时，策略读取当前K线之后的数据时抛出，不会被包装为策略错误
+    Raised when a strategy reads data after the current bar with
+    lookahead_guard on; it is not wrapped as a strategy failure
+    """
+    
+    def __init__(self, instrument: Optional[str], fields: List[str], time: pd.Timestamp, as_of: pd.Timestamp):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            fields: 访问的字段 / Fields accessed
+            time: 访问的时间 / Time accessed
+            as_of: 当前K线时间 / Time of the current bar
+        """
+        self.instrument = instrument
+        self.fields = fields
+        self.time = time
+        self.as_of = as_of
+        names = ", ".join(fields)
+        error_info = ErrorInfo(
+            error_code="BCK0007",
+            error_message_zh=f"策略在{as_of}读取了之后的数据: {instrument} [{names}] @ {time}",
+            error_message_en=f"Strategy on bar {as_of} read later data: {instrument} [{names}] at {time}",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.HIGH,
+            technical_details=f"instrument={instrument}, fields={fields}, time={time}, as_of={as_of}",
+            suggested_actions=[
+                "只通过ctx.history()和ctx.bar()读取截至当前K线的数据",
+                "确认确实需要时设置EngineConfig.lookahead_guard=False"
+            ],
+            recoverable=False
+        )
+        super().__init__(error_info)
+
+
+class BacktestInterruptedError(BacktestError):
+    """
+    回测中断错误 / Backtest interrupted error
+    
+    收到SIGTERM后在写完检查点时抛出，用BacktestEngine.resume()继续
+    Raised once the checkpoint is written after SIGTERM; carry on with BacktestEngine.resume()
+    """
+    
+    def __init__(self, path: Path, time: pd.Timestamp):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            path: 检查点文件 / Checkpoint file
+            time: 最后完成的K线时间 / Time of the last bar completed
+        """
+        self.path = path
+        self.time = time
+        error_info = ErrorInfo(
+            error_code="BCK0009",
+            error_message_zh=f"回测在{time}之后中断，检查点已写入{path}",
+            error_message_en=f"Backtest interrupted after {time}; checkpoint written to {path}",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"path={path}, time={time}",
+            suggested_actions=["用BacktestEngine.resume()从检查点继续回测"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def _checkpoint_error(path: Union[str, Path], reason: str) -> BacktestError:
+    """检查点无法读取或与回测不匹配 / The checkpoint can't be read or doesn't match the backtest"""
+    return BacktestError(ErrorInfo(
+        error_code="BCK0010",
+        error_message_zh=f"无法从检查点{path}恢复回测: {reason}",
+        error_message_en=f"Can't resume the backtest from checkpoint {path}: {reason}",
+        category=ErrorCategory.BACKTEST,
+        severity=ErrorSeverity.MEDIUM,
+        technical_details=f"path={path}",
+        suggested_actions=["使用写入检查点时的配置和数据恢复", "或删除检查点重新回测"],
+        recoverable=True
+    ))
+
+
+class _GuardedFrame(FeatureFrame):
+    """
+    截至as_of的历史数据 / History up to as_of
+    
+    按位置切片得到，与回测数据共享内存；range()、slice()、bar_at()和日期区间索引请求
+    as_of之后的时间时抛出LookaheadError，而不是像FeatureFrame一样截取或返回空结果
+    Obtained by positional slicing, so it shares memory with the backtest
+    data; range(), slice(), bar_at() and date-range indexing raise
+    LookaheadError for times after as_of instead of clamping or coming back
+    empty the way FeatureFrame does
+    """
+    
+    _metadata = ["_as_of", "_instrument"]
+    _as_of: Optional[pd.Timestamp] = None
+    _instrument: Optional[str] = None
+    
+    @property
+    def _constructor(self):
+        return _GuardedFrame
+    
+    def _check(self, t: Optional[TimeLike]) -> None:
+        if t is None or self._as_of is None:
+            return
+        ts = pd.Timestamp(t)
+        if ts > self._as_of:
+            raise LookaheadError(self._instrument, [str(c) for c in self.columns], ts, self._as_of)
+    
+    def slice(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> "FeatureFrame":
+        self._check(start)
+        self._check(end)
+        return super().slice(start, end)
+    
+    def bar_at(self, t: TimeLike) -> Tuple[Optional[Bar], bool]:
+        self._check(t)
+        return super().bar_at(t)
+
+
+def _holding_times(trades: List[Fill]) -> List[Tuple[pd.Timestamp, Optional[pd.Timestamp]]]:
+    """每笔成交的(开仓时间, 平仓时间) / (entry time, exit time) of each fill, see EngineResult.trades_frame()"""
+    held: Dict[str, float] = {}
+    opened: Dict[str, pd.Timestamp] = {}
+    result = []
+    for t in trades:
+        before = held.get(t.instrument, 0.0)
+        change = t.quantity if t.side is OrderSide.BUY else -t.quantity
+        after = before + change
+        if abs(before) <= _EPSILON:
+            opened[t.instrument] = t.time
+        reducing = abs(before) > _EPSILON and before * change < 0
+        result.append((opened[t.instrument], t.time if reducing else None))
+        if reducing and before * after < 0 and abs(after) > _EPSILON:
+            # 反手：剩余的数量在这笔成交上开了新仓
+            opened[t.instrument] = t.time
+        held[t.instrument] = after
+    return result
+
+
+class _InstrumentData:
+    """单个标的的数据及按时间查找行位置的索引 / One instrument's data with a time lookup"""
+    
+    def __init__(self, frame: pd.DataFrame):
+        if not frame.index.is_monotonic_increasing:
+            frame = frame.sort_index()
+        self.frame = frame if isinstance(frame, FeatureFrame) else FeatureFrame(frame)
+        self.index = self.frame.index
+        self.opens = self._prices(OPEN_FIELD)
+        self.highs = self._prices(HIGH_FIELD)
+        self.lows = self._prices(LOW_FIELD)
+        self.closes = self._prices(CLOSE_FIELD)
+        self.volumes = self._prices(VOLUME_FIELD)
+        self.vwaps = self._prices(VWAP_FIELD)
+        self.tradable = tradable_mask(self.frame)
+        self._guarded: Optional[_GuardedFrame] = None
+    
+    @property
+    def guarded(self) -> _GuardedFrame:
+        """共享内存的受保护视图，首次使用时创建 / Guarded view sharing memory, created on first use"""
+        if self._guarded is None:
+            self._guarded = _GuardedFrame(self.frame, copy=False)
+        return self._guarded
+    
+    def _prices(self, name: str) -> Optional[np.ndarray]:
+        if name not in self.frame.columns:
+            return None
+        return self.frame[name].to_numpy(dtype=float)
+    
+    def vwap(self, row: int) -> Optional[float]:
+        """该行的成交量加权均价，近似方法见ExecutionMode.NEXT_VWAP；没有有效价格时为None / The row's VWAP, see ExecutionMode.NEXT_VWAP; None without a valid price"""
+        if self.vwaps is not None:
+            price = float(self.vwaps[row])
+            if math.isfinite(price) and price > 0:
+                return price
+        if self.highs is not None and self.lows is not None:
+            columns = (self.highs, self.lows, self.closes)
+        else:
+            columns = (self.opens, self.closes)
+        prices = [float(c[row]) for c in columns if c is not None]
+        if not prices or not all(math.isfinite(p) and p > 0 for p in prices):
+            return None
+        return sum(prices) / len(prices)
+    
+    def end_position(self, t: pd.Timestamp) -> int:
+        """t及之前的行数 / Number of rows at or before t"""
+        return int(self.index.searchsorted(t, side="right"))
+    
+    def row_at(self, t: pd.Timestamp) -> Optional[int]:
+        """t处的行位置，没有K线时为None / Row position at t, None when there is no bar"""
+        pos = self.end_position(t)
+        if pos == 0 or self.index[pos - 1] != t:
+            return None
+        return pos - 1
+    
+    def suspended(self, row: int) -> bool:
+        """该行是否停牌 / Whether the row is suspended"""
+        return self.tradable is not None and not self.tradable[row]
+    
+    def last_traded_close(self, row: int) -> Optional[float]:
+        """
+        复牌的行之前最后一根可成交K线的收盘价 / Close of the last tradable bar before a row that resumes trading
+        
+        该行不是停牌后的第一行时为None / None when the row does not follow a suspension
+        """
+        if row == 0 or not self.suspended(row - 1) or self.closes is None:
+            return None
+        for before in range(row - 1, -1, -1):
+            close = float(self.closes[before])
+            if not self.suspended(before) and math.isfinite(close) and close > 0:
+                return close
+        return None
+
+
+class BarContext:
+    """
+    策略在每根K线上看到的行情上下文 / Market data a strategy sees on each bar
+    
+    只暴露截至当前交易日（包含）的数据，不持有任何指向之后数据的公开入口，
+    从结构上杜绝未来函数。开启guard时history()返回的视图在请求之后的时间时抛出
+    LookaheadError，指出访问的字段和时间，而不是静默地截取。
+    Exposes only data up to and including the current day and offers no public
+    path to anything later, so lookahead is ruled out by construction. With
+    guard on, the views history() returns raise LookaheadError naming the
+    fields and time when asked for a later time, rather than silently clamping.
+    """
+    
+    def __init__(
+        self,
+        time: pd.Timestamp,
+        data: Dict[str, _InstrumentData],
+        members: Optional[List[str]] = None,
+        guard: bool = False,
+        events: Optional[List[CorporateAction]] = None,
+        applied: Tuple[int, int] = (0, 0),
+        calendar: Optional[TradingCalendar] = None,
+        start: Optional[pd.Timestamp] = None,
+        streams: Optional[RandomStreams] = None
+    ):
+        self._time = time
+        self.__data = data
+        self._members = members
+        self._guard = guard
+        self._history: Dict[str, FeatureFrame] = {}
+        self._events = events or []
+        self._applied = applied
+        self._calendar = calendar
+        self._start = start
+        self._streams = streams
+    
+    @property
+    def time(self) -> pd.Timestamp:
+        """当前K线时间 / Time of the current bar"""
+        return self._time
+    
+    @property
+    def calendar(self) -> Optional[TradingCalendar]:
+        """回测的交易日历，按数据中出现的日期步进时为None / The backtest's calendar, None when stepping over the data's dates"""
+        return self._calendar
+    
+    def is_due(self, schedule: "RebalanceSchedule") -> bool:
+        """
+        按回测的交易日历判断当日是否为调仓日 / Whether today is a rebalance day on the backtest's calendar
+        
+        计划从回测的第一个交易日开始
+        The schedule starts on the backtest's first day
+        
+        Args:
+            schedule: 调仓计划，如MonthStart() / Rebalance schedule, e.g. MonthStart()
+        
+        Returns:
+            bool: 当日是调仓日时返回True / True when today is a rebalance day
+        
+        Raises:
+            ValueError: 回测没有交易日历时抛出 / Raised when the backtest has no calendar
+        """
+        if self._calendar is None:
+            raise ValueError("rebalance schedules need a trading calendar; set EngineConfig.calendar")
+        day = self._time.normalize()
+        return schedule.is_due(day, self._calendar, day if self._start is None else self._start)
+    
+    def rng(self, *keys: Any) -> random.Random:
+        """
+        策略使用的随机数生成器 / Random generator for the strategy
+        
+        由EngineConfig.seed派生，每个名称一个独立的流，跨K线保持状态并写入检查点，
+        因此相同的种子和数据得到相同的成交。策略应从这里取随机数，而不是全局的random模块；
+        组合了多个子策略的策略可以为每个子策略取一个名称。
+        Derived from EngineConfig.seed with an independent stream per name,
+        keeping its state across bars and in checkpoints, so the same seed and
+        data give the same fills. Strategies should draw from here rather than
+        the global random module; a strategy combining several can name one
+        stream per part.
+        
+        Args:
+            *keys: 流的名称，没有名称时为策略的默认流 / Stream names; none for the strategy's default stream
+        
+        Returns:
+            random.Random: 该名称的随机数流 / The name's stream
+        
+        Raises:
+            ValueError: 上下文不是由引擎创建时抛出 / Raised when the context wasn't created by an engine
+        """
+        if self._streams is None:
+            raise ValueError("this context has no random streams; it must come from a backtest or paper run")
+        return self._streams.stream(*keys)
+    
+    @property
+    def instruments(self) -> List[str]:
+        """回测中的全部标的 / All instruments in the backtest"""
+        return list(self.__data.keys())
+    
+    @property
+    def members(self) -> List[str]:
+        """
+        当日可以买入的标的 / Instruments that can be bought today
+        
+        回测使用标的池时为当日的成分股，否则为全部标的
+        The universe's members on the day when the backtest uses one, every instrument otherwise
+        """
+        if self._members is None:
+            return self.instruments
+        return list(self._members)
+    
+    def history(self, instrument: str, n: Optional[int] = None) -> FeatureFrame:
+        """
+        获取截至当前K线（包含）的历史数据 / Get history up to and including the current bar
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            n: 只取最后n行，None表示全部 / Only the last n rows; None for all
+        
+        Returns:
+            FeatureFrame: 与回测数据共享内存的视图，未知标的返回空数据 /
+                View sharing memory with the backtest data; empty for an unknown instrument
+        """
+        frame = self._history.get(instrument)
+        if frame is None:
+            data = self.__data.get(instrument)
+            if data is None:
+                return FeatureFrame()
+            source = data.guarded if self._guard else data.frame
+            frame = source.iloc[:data.end_position(self._time)]
+            if self._guard:
+                frame._as_of = self._time
+                frame._instrument = instrument
+            self._history[instrument] = frame
+        return frame if n is None else frame.last(n)
+    
+    def bar(self, instrument: str) -> Optional[Bar]:
+        """
+        获取当前K线 / Get the current bar
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            Optional[Bar]: 当日没有K线（停牌或未知标的）时为None /
+                None when there is no bar today (suspended or unknown instrument)
+        """
+        bar, found = self.history(instrument).bar_at(self._time)
+        return bar if found else None
+    
+    def bars(self) -> Dict[str, Bar]:
+        """当日有K线的成分股 / Bars of every member trading today"""
+        result = {}
+        for code in self.members:
+            bar = self.bar(code)
+            if bar is not None:
+                result[code] = bar
+        return result
+    
+    def actions(self, instrument: Optional[str] = None) -> List[CorporateAction]:
+        """
+        当日生效的公司行为 / Corporate actions taking effect today
+        
+        开启EngineConfig.corporate_actions时为除权日（不是交易日时为之后的第一个交易日）落在当日的事件，
+        包括不改变持仓的业绩公告；否则为空列表
+        With EngineConfig.corporate_actions on, the events whose ex-date (or
+        the first trading day after it) is today, earnings announcements
+        included; an empty list otherwise
+        
+        Args:
+            instrument: 只取该标的的事件，None表示全部标的 / Only this instrument's events; None for every instrument
+        
+        Returns:
+            List[CorporateAction]: 按除权日排列的事件 / Events in ex-date order
+        """
+        start, stop = self._applied
+        return [a for a in self._events[start:stop] if instrument is None or a.instrument == instrument]
+    
+    def upcoming_actions(self, days: int, instrument: Optional[str] = None) -> List[CorporateAction]:
+        """
+        之后days个自然日内（包含）的公司行为 / Corporate actions within the next days calendar days (inclusive)
+        
+        除权日和业绩公告日通常提前公布，因此视为当日已知，不受lookahead_guard限制，可以用来避免
+        在业绩公告前开仓
+        Ex-dates and announcement dates are usually published ahead, so they
+        count as known today and lookahead_guard does not apply; use this to
+        avoid opening positions into an earnings announcement
+        
+        Args:
+            days: 向后查看的自然日数 / Calendar days to look ahead
+            instrument: 只取该标的的事件，None表示全部标的 / Only this instrument's events; None for every instrument
+        
+        Returns:
+            List[CorporateAction]: 除权日晚于当日、不晚于当日之后days天的事件，按除权日排列 /
+                Events with ex-dates after today and at most days later, in ex-date order
+        
+        Raises:
+            ValueError: days为负数时抛出 / Raised for a negative days
+        """
+        if days < 0:
+            raise ValueError(f"days must be non-negative, got {days}")
+        horizon = self._time + pd.Timedelta(days=days)
+        result = []
+        for action in self._events[self._applied[1]:]:
+            if action.ex_date > horizon:
+                break
+            if action.ex_date > self._time and (instrument is None or action.instrument == instrument):
+                result.append(action)
+        return result
+
+
+StrategyCallback = Callable[[BarContext, Portfolio, Dict[str, Bar]], Optional[Iterable[Order]]]
+
+
+class Strategy(ABC):
+    """
+    策略接口 / Strategy interface
+    
+    引擎在每个交易日收盘后调用on_bar()，返回的订单按ExecutionMode成交
+    The engine calls on_bar() after each day's close; returned orders fill
+    according to the ExecutionMode
+    """
+    
+    @abstractmethod
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        """
+        处理一根K线 / Handle one bar
+        
+        Args:
+            ctx: 截至当前K线的行情上下文 / Market data up to the current bar
+            portfolio: 当日成交后的组合副本，修改不影响回测 /
+                Copy of the portfolio after today's fills; changing it does not affect the backtest
+            bars: 当日有K线的标的到K线的映射 / Instrument code to today's bar, for instruments trading today
+        
+        Returns:
+            Optional[Iterable[Order]]: 要下达的订单，None表示不下单 / Orders to submit; None for none
+        """
+    
+    def on_rights_issue(self, offer: RightsIssue, entitled: float, portfolio: Portfolio) -> bool:
+        """
+        决定是否认购配股 / Decide whether to take up a rights issue
+        
+        开启EngineConfig.corporate_actions时，引擎在除权日开盘前对持有多头的标的调用此方法，
+        认购时按配股价买入entitled股，不收手续费。默认放弃认购。
+        With EngineConfig.corporate_actions on, the engine calls this before the
+        open of the ex-date for each instrument held long; taking up buys
+        entitled shares at the subscription price with no commission. The
+        default declines.
+        
+        Args:
+            offer: 配股事件 / Rights issue
+            entitled: 可认购的股数 / Shares the position is entitled to
+            portfolio: 组合副本，修改不影响回测 / Copy of the portfolio; changing it does not affect the backtest
+        
+        Returns:
+            bool: 是否认购 / Whether to subscribe
+        """
+        return False
+
+
+class _CallbackStrategy(Strategy):
+    """把普通函数包装为策略 / Wraps a plain function as a strategy"""
+    
+    def __init__(self, callback: StrategyCallback):
+        self._callback = callback
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        return self._callback(ctx, portfolio, bars)
+
+
+class Snapshotter(ABC):
+    """
+    状态可以保存的策略 / Strategy whose state can be saved
+    
+    跨K线保存状态的策略同时实现该接口，检查点中会保存snapshot()的返回值，恢复时传给
+    restore()；未实现该接口的策略视为没有跨K线的状态
+    A strategy keeping state across bars implements this too: checkpoints
+    hold what snapshot() returns and resuming passes it to restore(). Strategies
+    without it are taken to keep no state across bars
+    
+    Examples:
+        >>> class Momentum(Strategy, Snapshotter):
+        ...     def snapshot(self):
+        ...         return {"scores": self.scores}
+        ...     def restore(self, state):
+        ...         self.scores = state["scores"]
+    """
+    
+    @abstractmethod
+    def snapshot(self) -> Any:
+        """返回可以pickle的策略状态 / Return the strategy state, which must be picklable"""
+    
+    @abstractmethod
+    def restore(self, state: Any) -> None:
+        """
+        恢复snapshot()返回的状态 / Restore a state returned by snapshot()
+        
+        Args:
+            state: 写入检查点时snapshot()的返回值 / What snapshot() returned when the checkpoint was written
+        """
+
+
+@dataclass
+class _WorkingOrder:
+    """尚未成交的订单及剩余有效K线数 / Unfilled order with the bars it has left"""
+    order: Order
+    bars_left: Optional[int]
+    remaining: float = field(init=False)
+    triggered: bool = False
+    halted_bars: int = 0
+    
+    def __post_init__(self):
+        self.remaining = self.order.quantity
+    
+    @property
+    def pending(self) -> Order:
+        """未成交部分的订单 / Order for the part not yet filled"""
+        if self.remaining == self.order.quantity:
+            return self.order
+        return replace(self.order, quantity=self.remaining)
+
+
+# 检查点文件格式的版本 / Version of the checkpoint file format
+CHECKPOINT_VERSION = 2
+
+
+@dataclass
+class _RunState:
+    """回测循环中可以写入检查点的状态 / State of the backtest loop that checkpoints capture"""
+    portfolio: Portfolio
+    seed: int
+    cursor: int = 0  # 下一根要处理的K线
+    trades: List[Fill] = field(default_factory=list)
+    rejected: List[RejectedOrder] = field(default_factory=list)
+    working: List[_WorkingOrder] = field(default_factory=list)
+    equity: List[float] = field(default_factory=list)
+    cash: List[float] = field(default_factory=list)
+    daily_positions: List[Dict[str, float]] = field(default_factory=list)
+    exposures: List[Dict[str, float]] = field(default_factory=list)
+    instrument_pnl: List[Dict[str, float]] = field(default_factory=list)
+    action_cursor: int = 0  # 下一个要应用的公司行为
+    actions: List[CorporateActionRecord] = field(default_factory=list)
+    streams: Optional[RandomStreams] = None  # 策略的随机数流，旧检查点中没有
+
+
+class BacktestEngine:
+    """
+    回测引擎 / Backtest engine
+    
+    职责 / Responsibilities:
+    - 通过get_features()获取数据（或使用预先获取的数据） / Fetch data through get_features() (or use pre-fetched data)
+    - 按交易日历逐日调用策略 / Call the strategy on every trading day
+    - 按执行方式和交易成本模型撮合订单 / Fill orders through the execution mode and the cost model
+    - 记录资金、持仓、成交和权益曲线 / Track cash, positions, fills and the equity curve
+    
+    买入金额超过现金的订单会被拒绝；allow_short为False时卖出数量超过持仓的订单
+    也会被拒绝。同一根K线上的订单按下达顺序依次成交。
+    Buys beyond the cash are rejected, and so are sells beyond the position
+    unless allow_short is set. Orders on one bar fill in the order they were submitted.
+    
+    NEXT_OPEN方式下限价和止损按K线的开高低价撮合：限价买单在最低价不高于限价时以
+    min(开盘价, 限价)成交，限价卖单在最高价不低于限价时以max(开盘价, 限价)成交；止损在
+    K线触及止损价时触发，开盘即越过止损价时以开盘价成交。数据没有$high和$low时最高、
+    最低价取开盘价和收盘价中的较大、较小值，可以在fields中加入这两个字段。收盘价方式下
+    K线只有收盘价一个价格。
+    In NEXT_OPEN mode limits and stops fill against the bar's open, high and
+    low: a limit buy fills at min(open, limit) when the low reaches the limit
+    and a limit sell at max(open, limit) when the high does; a stop triggers
+    when the bar trades through it and fills at the open when the bar gaps
+    through. Without $high and $low in the data the high and low are the
+    larger and smaller of open and close, so add those fields to fields. In
+    the close modes the bar has the close as its only price.
+    
+    已退市的标的（见delisting模块）只使用退市日（包含）之前的数据；退市日收盘后剩余的
+    持仓按退市结算价强制平仓，记为FillKind.DELIST的成交，之后该标的的订单被拒绝。
+    A delisted instrument (see the delisting module) only has data up to and
+    including its delisting date; whatever is still held after that day's
+    close is force-liquidated at the settlement price as a FillKind.DELIST
+    fill, and later orders for it are rejected.
+    
+    停牌的K线（见Bar.tradable）上不撮合订单，按suspension拒绝订单或保留到复牌，复牌第一根K线上的
+    成交按该K线的价格成交并记录resumption_gap（见EngineResult.resumption_fills）。停牌期间持仓
+    按最后成交价估值，在组合中标记为流动性不足（Portfolio.illiquid）。
+    Orders don't fill on suspended bars (see Bar.tradable); suspension
+    decides whether they are rejected or carried until trading resumes, and
+    fills on the first bar after it happen at that bar's prices with
+    resumption_gap set (see EngineResult.resumption_fills). While suspended,
+    a position is valued at its last traded price and flagged illiquid in the
+    portfolio (Portfolio.illiquid).
+    
+    开启corporate_actions时，公司行为在除权日（不是交易日时为之后的第一个交易日）开盘前应用：
+    现金分红按前一日收盘后的持仓记入现金，多头扣除dividend_tax_rate的税款，空头支付分红；
+    拆股调整持仓数量和平均成本；配股由策略的on_rights_issue()决定是否按配股价认购。每个事件
+    记入EngineResult.corporate_actions，认购的配股同时记为FillKind.RIGHTS的成交。策略通过
+    BarContext.actions()看到当日的事件（包括业绩公告），通过BarContext.upcoming_actions()看到之后的事件。
+    With corporate_actions on, each event applies before the open of its
+    ex-date (or the first trading day after it): a cash dividend goes to cash
+    on the position held after the previous close, less dividend_tax_rate
+    withheld from longs and paid by shorts; a split rescales the quantity and
+    average cost; and the strategy's on_rights_issue() decides whether to
+    subscribe to a rights issue at its price. Every event is recorded in
+    EngineResult.corporate_actions, and subscribed rights are also a
+    FillKind.RIGHTS fill. The strategy sees the day's events, earnings
+    announcements included, through BarContext.actions() and those ahead
+    through BarContext.upcoming_actions().
+    
+    设置risk_limits时，每笔订单在撮合时、计算成交价之前按RiskLimits检查：违反REJECT限制的订单被拒绝，
+    违反TRIM限制的订单按允许的数量成交，其余部分取消；两种情况都以违反的限制和原因记入rejected_orders。
+    With risk_limits set, each order is checked against them when it comes
+    up for a fill, before the fill price is worked out: a breach of a REJECT
+    limit rejects it, and a breach of a TRIM limit fills what the limit allows
+    and cancels the rest, either way recorded in rejected_orders with the
+    limit and the reason.
+    
+    设置checkpoint_path时，每checkpoint_every根K线结束后（以及收到SIGTERM时）把组合、未成交订单、
+    随机数状态、策略状态（见Snapshotter）和当前位置写入检查点；resume()用相同的配置和数据从
+    检查点继续，结果与不中断的回测完全相同。检查点用pickle保存，只能读取自己写入的文件。
+    With checkpoint_path set, the portfolio, working orders, random state,
+    strategy state (see Snapshotter) and the cursor are written to a
+    checkpoint after every checkpoint_every bars (and on SIGTERM); resume()
+    carries on from it with the same configuration and data, giving a result
+    identical to an uninterrupted run. Checkpoints are pickles, so only load
+    files you wrote yourself.
+    """
+    
+    def __init__(self, config: EngineConfig, data_manager: Optional[DataManager] = None):
+        """
+        初始化回测引擎 / Initialize backtest engine
+        
+        Args:
+            config: 引擎配置 / Engine configuration
+            data_manager: 获取数据使用的数据管理器，None时按需创建 /
+                Data manager used to fetch data; created on demand when None
+        """
+        if config.initial_cash < 0:
+            raise ValueError(f"initial_cash must be non-negative, got {config.initial_cash}")
+        if config.instruments is None and config.data is None:
+            raise ValueError("Either instruments or data must be given")
+        if config.cost_model is not None and (
+            config.slippage is not no_slippage or config.commission is not no_commission
+        ):
+            raise ValueError("cost_model cannot be combined with the slippage or commission functions")
+        if config.participation_rate is not None and not (
+            _is_positive(config.participation_rate) and config.participation_rate <= 1
+        ):
+            raise ValueError(f"participation_rate must be in (0, 1], got {config.participation_rate!r}")
+        if config.checkpoint_every is not None:
+            if not isinstance(config.checkpoint_every, int) or config.checkpoint_every < 1:
+                raise ValueError(f"checkpoint_every must be a positive integer, got {config.checkpoint_every!r}")
+            if config.checkpoint_path is None:
+                raise ValueError("checkpoint_every needs checkpoint_path")
+        if config.corporate_actions is not False and config.adjust is not None and (
+            to_adjust_mode(config.adjust) is not AdjustMode.NONE
+        ):
+            raise ValueError("corporate_actions needs unadjusted prices, so it cannot be combined with adjust")
+        if not 0 <= config.dividend_tax_rate <= 1:
+            raise ValueError(f"dividend_tax_rate must be in [0, 1], got {config.dividend_tax_rate!r}")
+        suspension = SuspensionPolicy(config.suspension)
+        if suspension is SuspensionPolicy.EXPIRE and (
+            not isinstance(config.suspension_expiry, int) or config.suspension_expiry < 1
+        ):
+            raise ValueError(f"suspension_expiry must be a positive integer, got {config.suspension_expiry!r}")
+        
+        self._config = config
+        self._mode = ExecutionMode(config.execution_mode)
+        self._suspension = suspension
+        self._costs = config.cost_model or _FunctionCost(config.slippage, config.commission)
+        self._run_costs = self._costs
+        self._data_manager = data_manager
+        self._universe = config.instruments if isinstance(config.instruments, Universe) else None
+        self._interrupted = threading.Event()
+        self._logger = get_logger(__name__)
+    
+    def run(self, strategy: Union[Strategy, StrategyCallback]) -> EngineResult:
+        """
+        运行回测 / Run the backtest
+        
+        Args:
+            strategy: 策略实例，或参数与Strategy.on_bar()相同的函数 /
+                Strategy instance, or a function with the arguments of Strategy.on_bar()
+        
+        Returns:
+            EngineResult: 回测结果 / Backtest result
+        
+        Raises:
+            BacktestError: 回测区间内没有交易日、缺少成交价字段、策略抛出异常或外币标的没有汇率时抛出 /
+                Raised when there are no trading days in the range, a price field
+                is missing, or the strategy raises; also when foreign-currency
+                instruments have no FX provider
+            BacktestInterruptedError: 设置checkpoint_path时收到SIGTERM，写完检查点后抛出 /
+                Raised on SIGTERM with checkpoint_path set, once the checkpoint is written
+            DataError: 获取数据失败，或交易日没有可用汇率时抛出 /
+                Raised when fetching data fails or a trading day has no usable FX rate
+            ExpressionError: 开启lookahead_guard时fields中有引用未来数据的表达式 /
+                Raised with lookahead_guard on when an expression in fields reads future rows
+            LookaheadError: 开启lookahead_guard时策略读取了当前K线之后的数据 /
+                Raised with lookahead_guard on when the strategy reads data after the current bar
+        """
+        return self._run(strategy)
+    
+    def resume(self, path: Union[str, Path], strategy: Union[Strategy, StrategyCallback]) -> EngineResult:
+        """
+        从检查点继续回测 / Carry on a backtest from a checkpoint
+        
+        引擎的配置和数据应与写入检查点的回测相同；strategy为新的策略实例，实现Snapshotter时
+        先恢复检查点中的状态。返回的结果包含检查点之前的部分，与不中断的回测相同。
+        The engine should have the configuration and data of the backtest that
+        wrote the checkpoint; strategy is a fresh instance, restored from the
+        checkpoint first when it implements Snapshotter. The result covers the
+        bars before the checkpoint too, just as an uninterrupted run would.
+        
+        Args:
+            path: 检查点文件 / Checkpoint file
+            strategy: 策略实例或回调函数 / Strategy instance or callback
+        
+        Returns:
+            EngineResult: 完整的回测结果 / Result of the whole backtest
+        
+        Raises:
+            BacktestError: 检查点无法读取，或其交易日与本次回测不一致时抛出，其余同run() /
+                Raised when the checkpoint can't be read or its trading days differ
+                from this backtest's; otherwise as run()
+        """
+        try:
+            with open(path, "rb") as f:
+                checkpoint = pickle.load(f)
+        except (OSError, EOFError, pickle.UnpicklingError) as e:
+            raise _checkpoint_error(path, str(e)) from e
+        if not isinstance(checkpoint, dict) or checkpoint.get("version") != CHECKPOINT_VERSION:
+            raise _checkpoint_error(path, f"not a version {CHECKPOINT_VERSION} checkpoint")
+        return self._run(strategy, checkpoint, path)
+    
+    def _run(
+        self,
+        strategy: Union[Strategy, StrategyCallback],
+        checkpoint: Optional[Dict[str, Any]] = None,
+        checkpoint_source: Optional[Union[str, Path]] = None
+    ) -> EngineResult:
+        """运行回测，提供checkpoint时从其位置继续 / Run the backtest, from checkpoint's cursor when given"""
+        if not isinstance(strategy, Strategy):
+            strategy = _CallbackStrategy(strategy)
+        
+        config = self._config
+        if config.lookahead_guard:
+            self._check_future_references()
+        data = self._load_data()
+        days = self._trading_days(data)
+        calendar = get_calendar(config.calendar) if isinstance(config.calendar, str) else config.calendar
+        events = self._load_corporate_actions(data)
+        delistings = {code: d for code, d in ((code, self._delisting(code)) for code in data) if d is not None}
+        if not days:
+            raise BacktestError(ErrorInfo(
+                error_code="BCK0001",
+                error_message_zh=f"回测区间内没有交易日: {config.start_time} 至 {config.end_time}",
+                error_message_en=f"No trading days between {config.start_time} and {config.end_time}",
+                category=ErrorCategory.BACKTEST,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=f"instruments={list(data.keys())}",
+                suggested_actions=["检查回测区间和数据范围", "检查标的代码是否正确"],
+                recoverable=True
+            ))
+        
+        base = config.base_currency.upper()
+        foreign = sorted({get_currency(code) for code in data} - {base})
+        if foreign and config.fx is None:
+            raise BacktestError(ErrorInfo(
+                error_code="BCK0008",
+                error_message_zh=f"回测包含以{', '.join(foreign)}计价的标的，但没有提供汇率",
+                error_message_en=f"Instruments quoted in {', '.join(foreign)} need an FX provider to value in {base}",
+                category=ErrorCategory.BACKTEST,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=f"base_currency={base}, foreign={foreign}",
+                suggested_actions=["在EngineConfig.fx中提供FXProvider", "或把base_currency设为标的的计价货币"],
+                recoverable=True
+            ))
+        
+        if checkpoint is None:
+            seed = config.seed if config.seed is not None else new_seed()
+            rng = random.Random(seed)
+            state = _RunState(Portfolio(
+                config.initial_cash, allow_short=config.allow_short, cost_basis=config.cost_basis,
+                rounding=config.rounding, base_currency=base
+            ), seed)
+        else:
+            state, rng = self._restore(checkpoint, checkpoint_source, strategy, days)
+        seed = state.seed
+        if state.streams is None:
+            state.streams = RandomStreams(derive_seed(seed, "strategy"))
+        self._run_costs = self._costs.seeded(rng)
+        self._logger.info(
+            f"{'开始' if checkpoint is None else '继续'}回测: {len(data)}个标的, {len(days)}个交易日, "
+            f"{days[min(state.cursor, len(days) - 1)].date()} 至 {days[-1].date()}, "
+            f"执行方式{self._mode.value}, 随机种子{seed}"
+        )
+        
+        portfolio = state.portfolio
+        trades = state.trades
+        rejected = state.rejected
+        # 信号只能在主线程中处理
+        handle_sigterm = config.checkpoint_path is not None and threading.current_thread() is threading.main_thread()
+        previous_handler = signal.signal(signal.SIGTERM, self._on_sigterm) if handle_sigterm else None
+        self._interrupted.clear()
+        try:
+            for i in range(state.cursor, len(days)):
+                day = days[i]
+                if foreign:
+                    # 当日的成交和估值都按当日汇率折算
+                    portfolio.set_fx_rates({c: config.fx.rate(c, base, day) for c in foreign})
+                applied = (state.action_cursor, state.action_cursor)
+                if events:
+                    self._apply_corporate_actions(day, events, state, strategy)
+                    applied = (applied[0], state.action_cursor)
+                # 先撮合之前下达的订单，再让策略看到当日数据
+                if self._mode is not ExecutionMode.SAME_CLOSE:
+                    state.working = self._work(state.working, day, data, portfolio, trades, rejected)
+                
+                closes = {}
+                halted = []
+                for code, item in data.items():
+                    row = item.row_at(day)
+                    if row is not None and item.suspended(row):
+                        # 停牌的标的沿用最后成交价估值
+                        halted.append(code)
+                    elif row is not None and item.closes is not None:
+                        closes[code] = float(item.closes[row])
+                portfolio.mark_to_market(closes, illiquid=halted)
+                
+                members = None
+                if self._universe is not None:
+                    members = [code for code in self._universe.members(day) if code in data]
+                ctx = BarContext(
+                    day, data, members, guard=config.lookahead_guard, events=events, applied=applied,
+                    calendar=calendar, start=days[0], streams=state.streams
+                )
+                orders = self._call_strategy(strategy, day, strategy.on_bar, ctx, portfolio.copy(), ctx.bars())
+                self._submit(orders, day, portfolio, state)
+                
+                if self._mode is ExecutionMode.SAME_CLOSE:
+                    state.working = self._work(state.working, day, data, portfolio, trades, rejected)
+                self._settle_delistings(day, data, delistings, portfolio, trades)
+                
+                state.equity.append(portfolio.equity)
+                state.cash.append(portfolio.cash)
+                state.daily_positions.append(portfolio.positions)
+                state.exposures.append(portfolio.currency_exposure())
+                state.instrument_pnl.append(portfolio.pnl_by_instrument())
+                state.cursor = i + 1
+                
+                if self._interrupted.is_set():
+                    path = self._save_checkpoint(state, rng, strategy, days)
+                    raise BacktestInterruptedError(path, day)
+                every = config.checkpoint_every
+                if every is not None and state.cursor % every == 0 and state.cursor < len(days):
+                    self._save_checkpoint(state, rng, strategy, days)
+        finally:
+            if handle_sigterm:
+                signal.signal(signal.SIGTERM, signal.SIG_DFL if previous_handler is None else previous_handler)
+        
+        for item in state.working:
+            rejected.append(RejectedOrder(time=days[-1], order=item.pending, reason="回测结束前未能成交"))
+        
+        self._logger.info(f"回测完成: {len(trades)}笔成交, {len(rejected)}笔订单被拒绝或过期")
+        index = pd.DatetimeIndex(days)
+        daily_positions, exposures = state.daily_positions, state.exposures
+        held = sorted({code for positions in daily_positions for code in positions})
+        traded = sorted({code for pnl in state.instrument_pnl for code in pnl})
+        currencies = sorted({c for exposure in exposures for c in exposure})
+        return EngineResult(
+            equity_curve=pd.Series(state.equity, index=index, name="equity", dtype=float),
+            trades=trades,
+            positions=portfolio.positions,
+            cash=portfolio.cash,
+            rejected_orders=rejected,
+            cash_curve=pd.Series(state.cash, index=index, name="cash", dtype=float),
+            daily_positions=FeatureFrame(
+                [[p.get(code, 0.0) for code in held] for p in daily_positions],
+                index=index,
+                columns=held,
+                dtype=float
+            ),
+            initial_cash=config.initial_cash,
+            seed=seed,
+            currency_exposure=FeatureFrame(
+                [[e.get(c, 0.0) for c in currencies] for e in exposures],
+                index=index,
+                columns=currencies,
+                dtype=float
+            ),
+            corporate_actions=state.actions,
+            instrument_pnl=FeatureFrame(
+                [[pnl.get(code, 0.0) for code in traded] for pnl in state.instrument_pnl],
+                index=index,
+                columns=traded,
+                dtype=float
+            )
+        )
+    
+    @staticmethod
+    def _call_strategy(strategy: Strategy, day: pd.Timestamp, callback: Callable[..., Any], *args) -> Any:
+        """调用策略方法，把异常包装为BacktestError / Call a strategy method, wrapping its errors in BacktestError"""
+        try:
+            return callback(*args)
+        except LookaheadError:
+            raise
+        except Exception as e:
+            raise BacktestError(ErrorInfo(
+                error_code="BCK0002",
+                error_message_zh=f"策略在{day.date()}处理K线时出错: {e}",
+                error_message_en=f"Strategy failed on bar {day.date()}: {e}",
+                category=ErrorCategory.BACKTEST,
+                severity=ErrorSeverity.HIGH,
+                technical_details=f"strategy={type(strategy).__name__}, callback={callback.__name__}, time={day}",
+                suggested_actions=[f"检查策略{callback.__name__}()的实现"],
+                recoverable=False,
+                original_exception=e
+            )) from e
+    
+    def _apply_corporate_actions(
+        self,
+        day: pd.Timestamp,
+        events: List[CorporateAction],
+        state: _RunState,
+        strategy: Strategy
+    ) -> None:
+        """在开盘前应用除权日不晚于当日的公司行为 / Apply the corporate actions with ex-dates up to the day before the open"""
+        portfolio = state.portfolio
+        while state.action_cursor < len(events) and events[state.action_cursor].ex_date <= day:
+            action = events[state.action_cursor]
+            state.action_cursor += 1
+            code = action.instrument
+            held = portfolio.position(code)
+            if abs(held) <= _EPSILON:
+                continue
+            record = CorporateActionRecord(time=day, action=action, quantity=held, new_quantity=held)
+            if isinstance(action, CashDividend):
+                record.cash, record.tax = portfolio.pay_dividend(code, action.per_share, self._config.dividend_tax_rate)
+            elif isinstance(action, Split):
+                record.new_quantity = portfolio.split(code, action.ratio)
+            elif isinstance(action, RightsIssue):
+                if held < 0:
+                    # 空头没有配股权
+                    continue
+                entitled = held * action.ratio
+                if not self._call_strategy(
+                    strategy, day, strategy.on_rights_issue, action, entitled, portfolio.copy()
+                ):
+                    record.note = "放弃配股"
+                else:
+                    cash = portfolio.cash
+                    try:
+                        portfolio.buy(code, entitled, action.price, time=day)
+                    except InsufficientCashError:
+                        record.note = "现金不足，未能认购配股"
+                    else:
+                        record.new_quantity = portfolio.position(code)
+                        record.cash = portfolio.cash - cash
+                        state.trades.append(Fill(
+                            time=day,
+                            instrument=code,
+                            side=OrderSide.BUY,
+                            quantity=entitled,
+                            price=action.price,
+                            commission=0.0,
+                            kind=FillKind.RIGHTS,
+                            fx_rate=portfolio.fx_rate(code)
+                        ))
+            else:
+                continue
+            state.actions.append(record)
+            self._logger.info(
+                f"标的{code}应用{record.kind}: 持仓{held:g}->{record.new_quantity:g}, 现金{record.cash:+g}"
+            )
+    
+    def _on_sigterm(self, signum, frame) -> None:
+        """SIGTERM处理函数，当前K线结束后写入检查点 / SIGTERM handler; the checkpoint follows once the current bar is done"""
+        self._logger.info("收到SIGTERM，当前K线结束后写入检查点")
+        self._interrupted.set()
+    
+    def _save_checkpoint(
+        self,
+        state: _RunState,
+        rng: random.Random,
+        strategy: Strategy,
+        days: List[pd.Timestamp]
+    ) -> Path:
+        """
+        写入检查点，先写临时文件再替换，中途崩溃不会损坏已有的检查点 /
+        Write a checkpoint through a temporary file, so a crash midway leaves the previous one intact
+        
+        Returns:
+            Path: 检查点文件 / Checkpoint file
+        """
+        path = Path(self._config.checkpoint_path)
+        checkpoint = {
+            "version": CHECKPOINT_VERSION,
+            "days": len(days),
+            "time": days[state.cursor - 1],
+            "state": state,
+            "rng": rng.getstate(),
+            "strategy": strategy.snapshot() if isinstance(strategy, Snapshotter) else None,
+        }
+        path.parent.mkdir(parents=True, exist_ok=True)
+        temp = path.with_name(path.name + ".tmp")
+        with open(temp, "wb") as f:
+            pickle.dump(checkpoint, f, protocol=pickle.HIGHEST_PROTOCOL)
+        os.replace(temp, path)
+        self._logger.info(f"已写入检查点: {path}, 完成{state.cursor}/{len(days)}个交易日")
+        return path
+    
+    def _restore(
+        self,
+        checkpoint: Dict[str, Any],
+        path: Union[str, Path],
+        strategy: Strategy,
+        days: List[pd.Timestamp]
+    ) -> Tuple[_RunState, random.Random]:
+        """
+        从检查点恢复循环状态、随机数状态和策略状态 / Restore the loop, random and strategy state from a checkpoint
+        
+        Raises:
+            BacktestError: 检查点的交易日与本次回测不一致，或策略无法恢复状态时抛出 /
+                Raised when the checkpoint's trading days differ from this backtest's
+                or the strategy can't take its state
+        """
+        state: _RunState = checkpoint["state"]
+        if checkpoint["days"] != len(days) or days[state.cursor - 1] != checkpoint["time"]:
+            raise _checkpoint_error(
+                path, f"written after {checkpoint['time']} of {checkpoint['days']} days, "
+                f"this backtest has {len(days)} days"
+            )
+        if checkpoint["strategy"] is not None:
+            if not isinstance(strategy, Snapshotter):
+                raise _checkpoint_error(path, f"{type(strategy).__name__} doesn't implement Snapshotter")
+            strategy.restore(checkpoint["strategy"])
+        rng = random.Random()
+        rng.setstate(checkpoint["rng"])
+        return state, rng
+    
+    def load(self) -> Tuple[Dict[str, FeatureFrame], List[pd.Timestamp]]:
+        """
+        获取回测数据和回测逐日步进的交易日 / Fetch the data and the days the backtest steps over
+        
+        需要先按交易日划分区间再逐段回测时使用，传给EngineConfig.data后不会重复获取
+        For callers that split the range by trading day before running pieces
+        of it; passing the frames back as EngineConfig.data avoids fetching twice
+        
+        Returns:
+            Tuple[Dict[str, FeatureFrame], List[pd.Timestamp]]: 每个标的的数据和区间内的交易日 /
+                Each instrument's data and the trading days in the range
+        
+        Raises:
+            BacktestError: 缺少成交价字段时抛出 / Raised when a price field is missing
+            DataError: 获取数据失败时抛出 / Raised when fetching data fails
+        """
+        data = self._load_data()
+        return {code: item.frame for code, item in data.items()}, self._trading_days(data)
+    
+    def _check_future_references(self) -> None:
+        """拒绝fields中引用未来数据的表达式 / Reject expressions in fields that read future rows"""
+        for text in self._config.fields:
+            if is_raw_field(text):
+                continue
+            position = parse_expression(text).future_reference_position
+            if position is not None:
+                raise ExpressionError(
+                    text, position, "Ref with a negative offset reads future rows; set lookahead_guard=False to allow it"
+                )
+    
+    def _load_data(self) -> Dict[str, _InstrumentData]:
+        """获取回测数据并检查成交价字段 / Load the data and check the price fields"""
+        config = self._config
+        frames = config.data
+        codes = config.instruments
+        if self._universe is not None:
+            # 获取区间内所有成分股的完整数据，被剔除的标的在剔除之后仍有K线可以卖出
+            codes = self._universe.members_between(config.start_time, config.end_time)
+        if frames is None:
+            fields = [OPEN_FIELD, CLOSE_FIELD] + [f for f in config.fields if f not in (OPEN_FIELD, CLOSE_FIELD)]
+            if self._needs_volume and VOLUME_FIELD not in fields:
+                fields.append(VOLUME_FIELD)
+            if self._data_manager is None:
+                self._data_manager = DataManager(enable_cache=False)
+            frames = self._data_manager.get_features(
+                codes,
+                fields,
+                start_time=config.start_time,
+                end_time=config.end_time,
+                provider=config.provider,
+                calendar=config.calendar,
+                adjust=config.adjust
+            )
+            frames.raise_for_errors()
+        elif codes is not None:
+            if isinstance(codes, str):
+                codes = [codes]
+            frames = {code: frames[code] for code in codes if code in frames}
+        
+        price_field = OPEN_FIELD if self._mode is ExecutionMode.NEXT_OPEN else CLOSE_FIELD
+        required = {price_field, CLOSE_FIELD}
+        if config.participation_rate is not None or self._mode is ExecutionMode.NEXT_VWAP:
+            required.add(VOLUME_FIELD)
+        data = {}
+        for code, frame in frames.items():
+            delisting = self._delisting(code)
+            if delisting is not None:
+                # 预先获取的数据可能包含退市日之后的行
+                frame = frame[~delisting.delisted_mask(frame.index)]
+            missing = [f for f in required if f not in frame.columns]
+            if missing:
+                raise BacktestError(ErrorInfo(
+                    error_code="BCK0003",
+                    error_message_zh=f"标的{code}缺少回测需要的字段: {', '.join(sorted(missing))}",
+                    error_message_en=f"Instrument {code} is missing required fields: {', '.join(sorted(missing))}",
+                    category=ErrorCategory.BACKTEST,
+                    severity=ErrorSeverity.MEDIUM,
+                    technical_details=f"instrument={code}, columns={list(frame.columns)}",
+                    suggested_actions=[
+                        f"确保数据包含{OPEN_FIELD}和{CLOSE_FIELD}字段",
+                        f"设置participation_rate或使用NEXT_VWAP执行方式时数据还需要包含{VOLUME_FIELD}字段"
+                    ],
+                    recoverable=True
+                ))
+            if self._mode is ExecutionMode.NEXT_VWAP and VWAP_FIELD not in frame.columns:
+                self._logger.warning(f"标的{code}缺少{VWAP_FIELD}字段, NEXT_VWAP以典型价格近似成交均价")
+            data[code] = _InstrumentData(frame)
+        return data
+    
+    def _load_corporate_actions(self, data: Dict[str, _InstrumentData]) -> List[CorporateAction]:
+        """回测标的在回测区间内的公司行为，按除权日排列 / Corporate actions of the instruments in the range, by ex-date"""
+        config = self._config
+        if config.corporate_actions is False:
+            return []
+        if config.corporate_actions is True:
+            if self._data_manager is None:
+                self._data_manager = DataManager(enable_cache=False)
+            actions = self._data_manager.get_corporate_actions(
+                list(data), config.start_time, config.end_time, provider=config.provider, earnings=True
+            )
+        else:
+            actions = config.corporate_actions
+        start, end = pd.Timestamp(config.start_time), pd.Timestamp(config.end_time)
+        events = [
+            action for code in data for action in actions.get(code, [])
+            if start <= action.ex_date <= end
+        ]
+        # 同一除权日的事件保持提供者给出的顺序
+        return sorted(events, key=lambda action: action.ex_date)
+    
+    @property
+    def _needs_volume(self) -> bool:
+        """执行方式、成本模型、成交量比例限制或风险限制是否需要成交量 / Whether the execution mode, cost model, participation limit or risk limits read volume"""
+        limits = self._config.risk_limits
+        return (
+            self._mode is ExecutionMode.NEXT_VWAP
+            or self._costs.needs_volume or self._config.participation_rate is not None
+            or (limits is not None and limits.max_volume_share is not None)
+        )
+    
+    def _trading_days(self, data: Dict[str, _InstrumentData]) -> List[pd.Timestamp]:
+        """回测逐日步进的交易日 / Days the backtest steps over"""
+        config = self._config
+        start = pd.Timestamp(config.start_time)
+        end = pd.Timestamp(config.end_time)
+        if config.calendar is not None:
+            calendar = config.calendar
+            if isinstance(calendar, str):
+                calendar = get_calendar(calendar)
+            return calendar.between(start, end)
+        
+        if not data:
+            return []
+        index = data[next(iter(data))].index
+        for item in list(data.values())[1:]:
+            index = index.union(item.index)
+        return [t for t in index if start <= t <= end]
+    
+    def _work(
+        self,
+        working: List[_WorkingOrder],
+        day: pd.Timestamp,
+        data: Dict[str, _InstrumentData],
+        portfolio: Portfolio,
+        trades: List[Fill],
+        rejected: List[RejectedOrder]
+    ) -> List[_WorkingOrder]:
+        """
+        在当日K线上尝试撮合全部有效订单 / Try every working order on the day's bar
+        
+        Returns:
+            List[_WorkingOrder]: 仍然有效的订单 / Orders still working afterwards
+        """
+        remaining = []
+        # 当日每个标的已成交的数量，成交量比例限制由同一标的的所有订单共享
+        traded: Dict[str, float] = {}
+        # 日换手率以当日第一笔成交之前的权益为分母
+        day_equity = portfolio.equity
+        for item in working:
+            source = data.get(item.order.instrument)
+            row = None if source is None else source.row_at(day)
+            if row is not None and source.suspended(row):
+                reason = self._hold_suspended(item)
+                if reason is None:
+                    remaining.append(item)
+                else:
+                    rejected.append(RejectedOrder(time=day, order=item.pending, reason=reason))
+                continue
+            retry, reason = self._execute(item, day, data, portfolio, trades, traded, day_equity)
+            if reason is None:
+                continue
+            if retry and item.order.tif is TimeInForce.IOC:
+                reason = f"IOC订单未成交的部分已取消: {reason}"
+            elif retry:
+                if item.bars_left is not None:
+                    item.bars_left -= 1
+                if item.bars_left is None or item.bars_left > 0:
+                    remaining.append(item)
+                    continue
+                reason = f"订单已过期: {reason}"
+            rejected.append(RejectedOrder(time=day, order=item.pending, reason=reason))
+        return remaining
+    
+    def _rounding(self, code: str) -> Optional[RoundingPolicy]:
+        """标的适用的取整规则 / Rounding policy that applies to an instrument"""
+        policy = self._config.rounding_policy
+        if policy is None or isinstance(policy, RoundingPolicy):
+            return policy
+        return next((p for market, p in policy.items() if match_market(code, market)), None)
+    
+    def _submit(
+        self,
+        orders: Optional[Iterable[Order]],
+        day: pd.Timestamp,
+        portfolio: Portfolio,
+        state: _RunState
+    ) -> None:
+        """按取整规则处理策略下达的订单并加入有效订单 / Round the strategy's orders by the policy and add them to the working ones"""
+        for order in orders or []:
+            policy = self._rounding(order.instrument)
+            if policy is not None:
+                try:
+                    order = policy.apply(order, portfolio.position(order.instrument))
+                except LotRoundingError as e:
+                    state.rejected.append(RejectedOrder(time=day, order=order, reason=e.error_info.error_message_zh))
+                    continue
+            state.working.append(_WorkingOrder(order, order.valid_for))
+    
+    def _hold_suspended(self, working: _WorkingOrder) -> Optional[str]:
+        """
+        按停牌处理方式处理停牌标的上的订单 / Apply the suspension policy to an order on a suspended instrument
+        
+        Returns:
+            Optional[str]: 订单被拒绝或过期的原因，继续保留时为None / Why the order was rejected or expired; None to keep it
+        """
+        code = working.order.instrument
+        if working.order.tif is TimeInForce.IOC:
+            return f"IOC订单未成交的部分已取消: 标的当日停牌: {code}"
+        if self._suspension is SuspensionPolicy.REJECT:
+            return f"标的当日停牌: {code}"
+        working.halted_bars += 1
+        if self._suspension is SuspensionPolicy.EXPIRE and working.halted_bars > self._config.suspension_expiry:
+            return f"订单已过期: 标的停牌超过{self._config.suspension_expiry}根K线: {code}"
+        return None
+    
+    def _execute(
+        self,
+        working: _WorkingOrder,
+        day: pd.Timestamp,
+        data: Dict[str, _InstrumentData],
+        portfolio: Portfolio,
+        trades: List[Fill],
+        traded: Dict[str, float],
+        day_equity: float
+    ) -> Tuple[bool, Optional[str]]:
+        """
+        在当日K线上撮合一笔订单的剩余部分 / Fill what is left of one order on the day's bar
+        
+        成交价不会劣于限价；触发的止损和部分成交记在working上，之后的K线继续撮合
+        A fill never prices worse than the limit; a triggered stop and a partial
+        fill are recorded on working so later bars carry on from there
+        
+        Returns:
+            Tuple[bool, Optional[str]]: (是否可以在之后的K线重试, 未成交原因)，全部成交时原因为None /
+                (whether a later bar may retry, reason it did not fully fill); the reason is None once fully filled
+        """
+        order = working.order
+        item = data.get(order.instrument)
+        if item is None:
+            return False, f"未知标的: {order.instrument}"
+        delisting = self._delisting(order.instrument)
+        if delisting is not None and delisting.is_delisted(day):
+            return False, f"标的已于{delisting.date.date()}退市: {order.instrument}"
+        if (
+            order.side is OrderSide.BUY and self._universe is not None
+            and not self._universe.is_member(order.instrument, day)
+        ):
+            return False, f"标的当日不是标的池成分股: {order.instrument}"
+        row = item.row_at(day)
+        bar = None if row is None else self._bar_prices(item, row)
+        if bar is None:
+            return True, "当日没有可成交的价格（停牌或数据缺失）"
+        
+        reference, reason = self._reference_price(working, bar)
+        if reference is None:
+            return True, reason
+        
+        volume = None if item.volumes is None else float(item.volumes[row])
+        quantity = working.remaining
+        rate = self._config.participation_rate
+        policy = self._rounding(order.instrument)
+        if rate is not None:
+            liquidity = rate * volume if volume is not None and math.isfinite(volume) and volume > 0 else 0.0
+            quantity = min(quantity, liquidity - traded.get(order.instrument, 0.0))
+            if policy is not None and policy.lot is not None and quantity < working.remaining:
+                # 部分成交只成交整手
+                quantity = policy.lot.round(max(quantity, 0.0))
+            if quantity <= _EPSILON:
+                return True, f"成交量已达到参与比例上限{rate}"
+        
+        trimmed = None
+        limits = self._config.risk_limits
+        if limits is not None:
+            try:
+                quantity, trimmed = _risk_check(
+                    portfolio, replace(order, quantity=quantity), limits, reference, volume,
+                    self._traded_value(trades, day), day_equity
+                )
+            except RiskLimitError as e:
+                return False, e.error_info.error_message_zh
+        
+        filled = working.pending if quantity == working.remaining else replace(order, quantity=quantity)
+        buying = order.side is OrderSide.BUY
+        price = float(self._run_costs.fill_price(filled, reference, volume))
+        if policy is not None:
+            price = policy.price(price)
+        if order.is_limit:
+            price = min(price, order.limit_price) if buying else max(price, order.limit_price)
+        # 费用在成交记录中就按组合的舍入方式取整，与记入现金的金额一致
+        rounding = self._config.rounding
+        commission = float(Money.of(float(self._run_costs.commission(filled, price)), rounding))
+        tax = float(Money.of(float(self._run_costs.tax(filled, price)), rounding))
+        slippage = (price - reference if buying else reference - price) * quantity
+        
+        fill = Fill(
+            time=day,
+            instrument=order.instrument,
+            side=order.side,
+            quantity=quantity,
+            price=price,
+            commission=commission,
+            tax=tax,
+            slippage=slippage
+        )
+        last_close = item.last_traded_close(row)
+        if last_close is not None:
+            fill.resumption_gap = reference / last_close - 1
+        try:
+            fill.fx_rate = portfolio.fx_rate(order.instrument)
+            fill.realized_pnl = portfolio.apply_fill(fill)
+        except (InsufficientCashError, ShortSellingError) as e:
+            return False, e.error_info.error_message_zh
+        
+        trades.append(fill)
+        traded[order.instrument] = traded.get(order.instrument, 0.0) + quantity
+        working.remaining -= quantity
+        if trimmed is not None:
+            return False, f"{trimmed}，剩余{working.remaining:g}已取消"
+        if working.remaining > _EPSILON:
+            return True, f"成交量已达到参与比例上限{rate}，剩余{working.remaining:g}未成交"
+        return False, None
+    
+    @staticmethod
+    def _traded_value(trades: List[Fill], day: pd.Timestamp) -> float:
+        """当日订单已成交的金额（基准货币） / Value the day's orders have traded so far, in the base currency"""
+        total = 0.0
+        for fill in reversed(trades):
+            if fill.time != day:
+                break
+            if fill.kind is FillKind.TRADE:
+                spec = get_futures_spec(fill.instrument)
+                total += fill.value * fill.fx_rate * (spec.multiplier if spec is not None else 1.0)
+        return total
+    
+    def _delisting(self, code: str) -> Optional[Delisting]:
+        """标的的退市信息，使用标的池时以标的池为准 / Delisting of an instrument, the universe's when there is one"""
+        if self._universe is not None:
+            return self._universe.delisting(code)
+        return get_delisting(code)
+    
+    def _settle_delistings(
+        self,
+        day: pd.Timestamp,
+        data: Dict[str, _InstrumentData],
+        delistings: Dict[str, Delisting],
+        portfolio: Portfolio,
+        trades: List[Fill]
+    ) -> None:
+        """在退市日收盘后按结算价了结已退市标的的持仓 / Settle positions in instruments delisted by the day's close"""
+        for code, delisting in delistings.items():
+            held = portfolio.position(code)
+            if abs(held) <= _EPSILON or day.normalize() < delisting.date:
+                continue
+            item = data[code]
+            closes = [] if item.closes is None else item.closes[:item.end_position(day)]
+            valid = [c for c in closes if math.isfinite(c) and c > 0]
+            price = delisting.settlement(float(valid[-1]) if valid else None)
+            realized = portfolio.settle(code, price, day)
+            trades.append(Fill(
+                time=day,
+                instrument=code,
+                side=OrderSide.SELL if held > 0 else OrderSide.BUY,
+                quantity=abs(held),
+                price=price,
+                commission=0.0,
+                kind=FillKind.DELIST,
+                realized_pnl=realized,
+                fx_rate=portfolio.fx_rate(code)
+            ))
+            self._logger.info(f"标的{code}于{delisting.date.date()}退市, 按结算价{price:g}平仓{held:g}")
+    
+    def _bar_prices(self, item: _InstrumentData, row: int) -> Optional[Tuple[float, float, float]]:
+        """
+        订单在这根K线上的(成交价, 最高价, 最低价) / (fill price, high, low) an order trades at on the bar
+        
+        成交价在NEXT_OPEN下是开盘价，NEXT_VWAP下是成交量加权均价，止损和限价按K线真实的最高、
+        最低价判断是否触发；收盘价方式下三者都是收盘价；没有有效价格时为None
+        The fill price is the open under NEXT_OPEN and the VWAP under
+        NEXT_VWAP, while stops and limits trigger on the bar's real high and
+        low. All three are the close in the close modes; None without a valid
+        price
+        """
+        if self._mode is ExecutionMode.NEXT_VWAP:
+            price = item.vwap(row)
+            if price is None:
+                return None
+        elif self._mode is ExecutionMode.NEXT_OPEN:
+            price = float(item.opens[row])
+            if not math.isfinite(price) or price <= 0:
+                return None
+        else:
+            close = float(item.closes[row])
+            return (close, close, close) if math.isfinite(close) and close > 0 else None
+        
+        # 缺少最高、最低价时只知道开盘价、收盘价和成交价之间的范围
+        known = [price] + [
+            float(c[row]) for c in (item.opens, item.closes)
+            if c is not None and math.isfinite(c[row]) and c[row] > 0
+        ]
+        high = float(item.highs[row]) if item.highs is not None else math.nan
+        low = float(item.lows[row]) if item.lows is not None else math.nan
+        high = max(known + ([high] if math.isfinite(high) else []))
+        low = min(known + ([low] if math.isfinite(low) and low > 0 else []))
+        return price, high, low
+    
+    @staticmethod
+    def _reference_price(working: _WorkingOrder, bar: Tuple[float, float, float]) -> Tuple[Optional[float], str]:
+        """
+        订单在这根K线上的执行价（滑点之前） / Execution price of the order on the bar, before slippage
+        
+        Returns:
+            Tuple[Optional[float], str]: (执行价, 不能成交的原因)，不能成交时执行价为None /
+                (execution price, reason it can't fill); the price is None when it can't
+        """
+        order = working.order
+        open_, high, low = bar
+        buying = order.side is OrderSide.BUY
+        
+        if order.is_stop and not working.triggered:
+            stop = order.stop_price
+            if (buying and high < stop) or (not buying and low > stop):
+                return None, f"未触发止损价{stop}"
+            working.triggered = True
+            gapped = open_ >= stop if buying else open_ <= stop
+            if not order.is_limit:
+                # 开盘即越过止损价时以开盘价成交
+                return (open_ if gapped else stop), ""
+            if not gapped:
+                # 在K线中途触发，只知道触发时的价格为止损价，触发之后的走势未知
+                if (buying and stop <= order.limit_price) or (not buying and stop >= order.limit_price):
+                    return stop, ""
+                return None, f"已触发止损价{stop}，未达到限价{order.limit_price}"
+        
+        if not order.is_limit:
+            return open_, ""
+        limit = order.limit_price
+        if buying and low <= limit:
+            return min(open_, limit), ""
+        if not buying and high >= limit:
+            return max(open_, limit), ""
+        return None, f"未达到限价{limit}"
+
+
+def run(
+    config: EngineConfig,
+    strategy: Union[Strategy, StrategyCallback],
+    data_manager: Optional[DataManager] = None
+) -> EngineResult:
+    """
+    使用给定配置运行一次回测 / Run one backtest with the given configuration
+    
+    等价于BacktestEngine(config, data_manager).run(strategy)
+    Same as BacktestEngine(config, data_manager).run(strategy)
+    
+    Args:
+        config: 引擎配置 / Engine configuration
+        strategy: 策略实例或回调函数 / Strategy instance or callback
+        data_manager: 数据管理器 / Data manager
+    
+    Returns:
+        EngineResult: 回测结果 / Backtest result
+    """
+    return BacktestEngine(config, data_manager).run(strategy)
+
+
+def resume(
+    config: EngineConfig,
+    path: Union[str, Path],
+    strategy: Union[Strategy, StrategyCallback],
+    data_manager: Optional[DataManager] = None
+) -> EngineResult:
+    """
+    使用给定配置从检查点继续回测 / Carry on a backtest from a checkpoint with the given configuration
+    
+    等价于BacktestEngine(config, data_manager).resume(path, strategy)
+    Same as BacktestEngine(config, data_manager).resume(path, strategy)
+    
+    Args:
+        config: 写入检查点时的引擎配置 / Engine configuration the checkpoint was written with
+        path: 检查点文件 / Checkpoint file
+        strategy: 策略实例或回调函数 / Strategy instance or callback
+        data_manager: 数据管理器 / Data manager
+    
+    Returns:
+        EngineResult: 完整的回测结果 / Result of the whole backtest
+    """
+    return BacktestEngine(config, data_manager).resume(path, strategy)
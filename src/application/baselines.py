@@ -0,0 +1,211 @@
+"""
+基准策略模块 / Baseline Strategy Module
+买入持有和等权组合两个基准策略，与其他策略一样通过回测引擎运行，用于比较指标
+Two baseline strategies, buy-and-hold and an equal-weight basket, that run
+through the backtest engine like any other strategy so their metrics can be
+compared
+
+BuyAndHold在标的第一次有收盘价的K线按权重建仓，之后不再交易；EqualWeight在第一根K线等权
+建仓，之后按调仓频率（不调仓、每月末或每季度末）恢复等权。两者都按收盘价计算整手的目标持仓，
+订单的成交方式由引擎的执行模式决定。
+BuyAndHold buys its weight on the first bar where the instrument has a
+close and never trades again; EqualWeight buys equal weights on the first
+bar and restores them at the rebalance frequency (never, every month end or
+every quarter end). Both size whole-lot targets at the close, and the
+engine's execution mode decides how the orders fill.
+
+Examples:
+    >>> config = EngineConfig(start_time="2024-01-01", end_time="2024-12-31", instruments=codes)
+    >>> baseline = run(config, BuyAndHold("SH510300"))
+    >>> basket = run(config, EqualWeight(codes, "monthly"))
+"""
+
+import math
+from enum import Enum
+from typing import Any, Dict, Iterable, List, Optional, Union
+
+import pandas as pd
+
+from ..core.feature_frame import Bar
+from ..core.portfolio import Portfolio
+from ..core.trading_calendar import TradingCalendar
+from .backtest_engine import CLOSE_FIELD, BarContext, Order, Snapshotter, Strategy
+from .rebalance import (
+    A_SHARE_LOT,
+    MonthEnd,
+    MonthStart,
+    QuarterEnd,
+    RebalanceSchedule,
+    TargetWeightStrategy,
+    Weekly,
+    target_orders
+)
+
+
+class RebalanceFrequency(Enum):
+    """等权组合的调仓频率 / Rebalance frequency of the equal-weight basket"""
+    NONE = "none"  # 只在第一根K线建仓
+    WEEKLY = "weekly"  # 每周第一个交易日
+    MONTH_START = "month_start"  # 每月第一个交易日
+    MONTHLY = "monthly"  # 每月最后一个交易日
+    QUARTERLY = "quarterly"  # 每季度最后一个交易日
+
+
+_FREQUENCY_SCHEDULES = {
+    RebalanceFrequency.WEEKLY: Weekly,
+    RebalanceFrequency.MONTH_START: MonthStart,
+    RebalanceFrequency.MONTHLY: MonthEnd,
+    RebalanceFrequency.QUARTERLY: QuarterEnd,
+}
+
+
+class BuyAndHold(Strategy, Snapshotter):
+    """
+    买入持有 / Buy and hold
+    
+    在标的第一次有收盘价的K线按权重买入整手，之后不再下单；建仓订单未能成交（如涨停）时
+    也不会重试，结果中可以从rejected_orders看到
+    Buys whole lots worth its weight on the first bar where the instrument has
+    a close and places no order after that; an entry order that fails to fill
+    (say, at the limit-up price) is not retried and shows up in rejected_orders
+    """
+    
+    def __init__(self, instrument: str, weight: float = 1.0, lot_size: int = A_SHARE_LOT):
+        """
+        初始化策略 / Initialize strategy
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            weight: 建仓时占组合权益的比例，范围(0, 1] / Share of the equity bought, in (0, 1]
+            lot_size: 每手股数 / Shares per lot
+        """
+        if not 0 < weight <= 1:
+            raise ValueError(f"weight must be in (0, 1], got {weight!r}")
+        if lot_size < 1:
+            raise ValueError(f"lot_size must be positive, got {lot_size}")
+        self.instrument = instrument
+        self.weight = float(weight)
+        self._lot_size = lot_size
+        self._entered: Optional[pd.Timestamp] = None
+    
+    @property
+    def entry_time(self) -> Optional[pd.Timestamp]:
+        """下建仓订单的K线时间，尚未建仓时为None / Time of the bar the entry was placed on, None before it"""
+        return self._entered
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        if self._entered is not None:
+            return None
+        bar = bars.get(self.instrument)
+        if not _has_close(bar):
+            return None
+        self._entered = ctx.time
+        close = float(bar[CLOSE_FIELD])
+        return target_orders(portfolio, {self.instrument: self.weight}, {self.instrument: close}, self._lot_size)
+    
+    def snapshot(self) -> Any:
+        return {"entered": self._entered}
+    
+    def restore(self, state: Any) -> None:
+        self._entered = state["entered"]
+    
+    def __repr__(self) -> str:
+        return f"BuyAndHold({self.instrument!r}, weight={self.weight:g})"
+
+
+class EqualWeight(TargetWeightStrategy, Snapshotter):
+    """
+    等权组合 / Equal-weight basket
+    
+    第一根有标的报价的K线和每个调仓日把组合调整为当日有收盘价的标的等权；当日没有收盘价
+    （停牌或尚未上市）的标的不分配权重，资金留作现金直到下一次调仓
+    On the first bar quoting any of the instruments and on every rebalance
+    day the portfolio moves to equal weights over the instruments with a
+    close that day; one without a close (suspended or not yet listed) gets no
+    weight and its share stays in cash until the next rebalance
+    """
+    
+    def __init__(
+        self,
+        instruments: Iterable[str],
+        rebalance: Union[str, RebalanceFrequency, RebalanceSchedule] = RebalanceFrequency.NONE,
+        calendar: Optional[Union[str, TradingCalendar]] = "SSE",
+        lot_size: int = A_SHARE_LOT,
+        min_trade_value: float = 0.0
+    ):
+        """
+        初始化策略 / Initialize strategy
+        
+        Args:
+            instruments: 标的代码 / Instrument codes
+            rebalance: 调仓频率，或任意调仓计划 / Rebalance frequency, or any rebalance schedule
+            calendar: 解析调仓计划的交易日历或市场名称，None表示使用回测的交易日历 /
+                Trading calendar or market name resolving the schedule, None for the backtest's calendar
+            lot_size: 每手股数 / Shares per lot
+            min_trade_value: 低于该成交额的调仓交易被跳过 / Rebalance trades worth less than this are skipped
+        """
+        self.instruments: List[str] = list(dict.fromkeys(instruments))
+        if not self.instruments:
+            raise ValueError("instruments must not be empty")
+        if isinstance(rebalance, RebalanceSchedule):
+            schedule: Optional[RebalanceSchedule] = rebalance
+        else:
+            frequency = RebalanceFrequency(rebalance)
+            schedule = _FREQUENCY_SCHEDULES[frequency]() if frequency in _FREQUENCY_SCHEDULES else None
+        super().__init__(
+            self._equal_weights, _FirstBarAnd(schedule), calendar,
+            lot_size=lot_size, min_trade_value=min_trade_value
+        )
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        # 计划从第一根有标的报价的K线开始
+        if self._start is None and not any(_has_close(bars.get(code)) for code in self.instruments):
+            return None
+        return super().on_bar(ctx, portfolio, bars)
+    
+    def _equal_weights(self, ctx: BarContext) -> Dict[str, float]:
+        quoted = [code for code in self.instruments if _has_close(ctx.bar(code))]
+        return {code: 1.0 / len(quoted) for code in quoted}
+    
+    def snapshot(self) -> Any:
+        return {"start": self._start, "rebalances": list(self._rebalances)}
+    
+    def restore(self, state: Any) -> None:
+        self._start = state["start"]
+        self._rebalances = list(state["rebalances"])
+    
+    def __repr__(self) -> str:
+        return f"EqualWeight({len(self.instruments)} instruments, {self.schedule!r})"
+
+
+class _FirstBarAnd(RebalanceSchedule):
+    """计划开始当日以及内层计划的调仓日 / The schedule's start plus the days of an inner schedule"""
+    
+    def __init__(self, inner: Optional[RebalanceSchedule]):
+        self.inner = inner
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if day == start:
+            return True
+        return self.inner is not None and self.inner.is_due(day, calendar, start)
+    
+    def __repr__(self) -> str:
+        return "FirstBar()" if self.inner is None else f"FirstBar() + {self.inner!r}"
+
+
+def _has_close(bar: Optional[Bar]) -> bool:
+    """K线有有效的收盘价 / Whether a bar has a usable close"""
+    if bar is None:
+        return False
+    close = bar.get(CLOSE_FIELD)
+    return close is not None and math.isfinite(close) and close > 0
@@ -0,0 +1,231 @@
+"""
+自定义指数模块 / Custom Index Module
+由一篮子标的的价格按权重编制指数，作为自定义的业绩基准
+Builds an index from the prices of a basket of instruments and their
+weights, to serve as a custom benchmark
+
+指数按除数法计算：指数点位 = sum(成分股份数 * 价格) / 除数。调仓日收盘后按当日收盘价重新计算
+份数，并调整除数使当日点位不变，因此权重重置不会造成点位跳变。成分股在调仓日之间纳入或剔除时
+同样调整除数：剔除的成分股在剔除当日之前的最后价格移出，其权重按比例分给其他成分股；纳入的
+成分股在纳入当日收盘后与其他成分股一起重新计算权重。
+The index follows the divisor method: level = sum(shares * price) / divisor.
+After the close of a rebalance day the shares are recomputed at that day's
+closes and the divisor adjusted so the day's level stays put, so resetting
+the weights never makes the level jump. Constituents entering or leaving
+between rebalances adjust the divisor the same way: a leaver is taken out
+at its last price before the day it leaves, its weight going to the others
+in proportion, and an entrant joins with a reweighting of all constituents
+after the close of the day it enters.
+
+结果是以交易日为索引的普通pd.Series，可以用metrics.price_returns()转换为收益率后传给beta()、
+tracking_error()等相对基准的指标。
+The result is an ordinary pd.Series indexed by trading day; turn it into
+returns with metrics.price_returns() to feed beta(), tracking_error() and
+the other benchmark-relative metrics.
+
+Examples:
+    >>> frames = manager.get_features(codes, ["$close", "$market_cap"], "2024-01-01", "2024-12-31")
+    >>> index = build_index(codes, "market_cap", MonthEnd(), frames)
+    >>> beta(price_returns(result.equity_curve), price_returns(index))
+"""
+
+import math
+from enum import Enum
+from typing import Dict, Iterable, List, Mapping, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..core.trading_calendar import TimeLike, TradingCalendar, get_calendar
+from ..core.universe import Universe
+from .backtest_engine import CLOSE_FIELD
+from .rebalance import DateList, RebalanceSchedule
+
+
+# 市值加权使用的字段 / Field read by market-cap weighting
+MARKET_CAP_FIELD = "$market_cap"
+
+# 指数的基点 / Base level of the index
+DEFAULT_BASE = 1000.0
+
+
+class IndexWeighting(Enum):
+    """成分股的加权方式 / How constituents are weighted"""
+    EQUAL = "equal"  # 等权
+    MARKET_CAP = "market_cap"  # 按调仓日的市值加权
+
+
+class MissingPrice(Enum):
+    """
+    成分股当日没有价格时的处理方式 / What to do when a constituent has no price on a day
+    
+    REDISTRIBUTE在当日把该成分股移出，权重按比例分给其他成分股，恢复报价后重新计算权重；
+    CARRY沿用最后价格，该成分股当日对指数没有贡献涨跌
+    REDISTRIBUTE takes the constituent out for the day, its weight going to the
+    others in proportion, and reweights once it trades again; CARRY keeps its
+    last price, so it contributes no move that day
+    """
+    REDISTRIBUTE = "redistribute"  # 移出并把权重分给其他成分股
+    CARRY = "carry"  # 沿用最后价格
+
+
+WeightingLike = Union[str, IndexWeighting, Mapping[str, float]]
+
+
+def build_index(
+    universe: Union[Universe, Iterable[str]],
+    weighting: WeightingLike,
+    schedule: Union[RebalanceSchedule, Iterable[TimeLike]],
+    prices: Mapping[str, Union[pd.DataFrame, pd.Series]],
+    calendar: Union[str, TradingCalendar] = "SSE",
+    missing: Union[str, MissingPrice] = MissingPrice.REDISTRIBUTE,
+    base: float = DEFAULT_BASE,
+    start_time: Optional[TimeLike] = None,
+    end_time: Optional[TimeLike] = None,
+    name: str = "index"
+) -> pd.Series:
+    """
+    由一篮子标的编制指数 / Build an index from a basket of instruments
+    
+    Args:
+        universe: 标的池或固定的标的代码列表，标的池按每个交易日的成分股计算 /
+            Universe or a fixed list of codes; a universe counts the members of each day
+        weighting: 加权方式，或标的代码到权重的映射（不在映射中的标的不纳入，权重在现有成分股中
+            归一化） / Weighting, or a mapping of code to weight (codes outside it are
+            left out and the weights are normalized over the constituents present)
+        schedule: 调仓计划，日期列表按DateList处理 / Rebalance schedule; a list of dates becomes a DateList
+        prices: 标的代码到以时间为索引的价格的映射，DataFrame使用$close列，市值加权时还需要
+            $market_cap列（向前填充）；FeatureResult可以直接传入 / Mapping of code to
+            time-indexed prices; a DataFrame is read from $close, plus $market_cap
+            (forward-filled) for market-cap weighting; a FeatureResult works as is
+        calendar: 交易日历或市场名称，指数在其交易日上计算 / Trading calendar or market name whose days the index steps over
+        missing: 成分股当日没有价格时的处理方式 / What to do when a constituent has no price on a day
+        base: 第一个有价格的交易日的点位 / Level on the first day with prices
+        start_time: 开始时间，None表示价格数据的第一天 / Start, None for the first day of the prices
+        end_time: 结束时间，None表示价格数据的最后一天 / End, None for the last day of the prices
+        name: 结果的名称 / Name of the result
+    
+    Returns:
+        pd.Series: 以交易日为索引的指数点位，第一个有价格的交易日之前为NaN /
+            Index level by trading day, NaN before the first day with prices
+    
+    Raises:
+        ValueError: 没有价格数据、基点不是正数、权重为负数，或市值加权时缺少$market_cap时抛出 /
+            Raised without price data, for a non-positive base or negative weights,
+            or when market-cap weighting finds no $market_cap
+    """
+    kind, explicit = _weighting(weighting)
+    missing = MissingPrice(missing)
+    if not (math.isfinite(base) and base > 0):
+        raise ValueError(f"base must be a positive number, got {base!r}")
+    schedule = schedule if isinstance(schedule, RebalanceSchedule) else DateList(schedule)
+    calendar = get_calendar(calendar) if isinstance(calendar, str) else calendar
+    
+    closes = {code: _column(code, data, CLOSE_FIELD) for code, data in prices.items()}
+    spans = [(s.index[0], s.index[-1]) for s in closes.values() if len(s)]
+    if not spans:
+        raise ValueError("prices hold no data to build the index from")
+    days = calendar.between(
+        start_time if start_time is not None else min(first for first, _ in spans),
+        end_time if end_time is not None else max(last for _, last in spans)
+    )
+    index = pd.DatetimeIndex(days, name="datetime")
+    if not days:
+        return pd.Series(dtype=float, index=index, name=name)
+    table = {code: _on_days(s, index) for code, s in closes.items()}
+    caps = {}
+    if kind is IndexWeighting.MARKET_CAP:
+        caps = {
+            code: _on_days(_column(code, data, MARKET_CAP_FIELD), index, ffill=True)
+            for code, data in prices.items()
+        }
+    codes = None if isinstance(universe, Universe) else list(dict.fromkeys(universe))
+    
+    def members_on(day: pd.Timestamp) -> List[str]:
+        return universe.members(day) if codes is None else codes
+    
+    def reweight(row: int, today: Dict[str, float], level: float) -> Tuple[Dict[str, float], float]:
+        """按当日收盘价重新计算的(份数, 除数) / (shares, divisor) recomputed at the day's closes"""
+        if kind is IndexWeighting.MARKET_CAP:
+            raw = {code: float(caps[code][row]) for code in today}
+        elif explicit is not None:
+            raw = {code: explicit[code] for code in today}
+        else:
+            raw = dict.fromkeys(today, 1.0)
+        return {code: value / today[code] for code, value in raw.items()}, sum(raw.values()) / level
+    
+    shares: Dict[str, float] = {}
+    last: Dict[str, float] = {}
+    divisor = 1.0
+    level: Optional[float] = None
+    levels: List[float] = []
+    for row, day in enumerate(days):
+        members = [
+            code for code in members_on(day)
+            if code in table and (explicit is None or explicit.get(code, 0.0) > 0)
+        ]
+        # 市值加权时还没有市值的标的等到有市值后再纳入
+        today = {
+            code: float(table[code][row]) for code in members
+            if table[code][row] > 0 and (not caps or caps[code][row] > 0)
+        }
+        if level is not None:
+            dropped = [
+                code for code in shares
+                if code not in members or (missing is MissingPrice.REDISTRIBUTE and code not in today)
+            ]
+            if dropped:
+                for code in dropped:
+                    del shares[code]
+                # 按剔除前的价格调整除数，前一日的点位不变
+                kept = sum(q * last[code] for code, q in shares.items())
+                if kept > 0:
+                    divisor = kept / level
+            if shares:
+                level = sum(q * today.get(code, last[code]) for code, q in shares.items()) / divisor
+        last.update(today)
+        
+        entrants = any(code not in shares for code in today)
+        due = schedule.is_due(day, calendar, days[0])
+        if today and (level is None or due or entrants or not shares):
+            if level is None:
+                level = base
+            shares, divisor = reweight(row, today, level)
+        levels.append(math.nan if level is None else level)
+    return pd.Series(levels, index=index, name=name, dtype=float)
+
+
+def _weighting(weighting: WeightingLike) -> Tuple[Optional[IndexWeighting], Optional[Dict[str, float]]]:
+    """
+    (加权方式, 指定的权重)，指定权重时加权方式为None
+    (weighting, explicit weights); the weighting is None with explicit weights
+    """
+    if isinstance(weighting, Mapping):
+        for code, weight in weighting.items():
+            if not math.isfinite(weight) or weight < 0:
+                raise ValueError(f"index weight of {code} must be a non-negative number, got {weight!r}")
+        return None, {code: float(weight) for code, weight in weighting.items()}
+    return IndexWeighting(weighting), None
+
+
+def _column(code: str, data: Union[pd.DataFrame, pd.Series], name: str) -> pd.Series:
+    """价格数据中的一列，按时间升序 / One column of the price data, in time order"""
+    if isinstance(data, pd.Series):
+        if name != CLOSE_FIELD:
+            raise ValueError(f"prices of {code} are a series, so they carry no {name}")
+        series = data
+    elif name in data.columns:
+        series = data[name]
+    else:
+        raise ValueError(f"prices of {code} have no {name} column")
+    series = pd.Series(series.to_numpy(dtype=float), index=pd.DatetimeIndex(series.index).normalize())
+    return series[~series.index.duplicated(keep="last")].sort_index()
+
+
+def _on_days(series: pd.Series, index: pd.DatetimeIndex, ffill: bool = False) -> np.ndarray:
+    """对齐到交易日的数值，无效值为NaN / Values aligned to the trading days, NaN where invalid"""
+    if ffill:
+        series = series.reindex(series.index.union(index)).ffill()
+    values = series.reindex(index).to_numpy(dtype=float)
+    values[~np.isfinite(values)] = np.nan
+    return values
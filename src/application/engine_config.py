@@ -0,0 +1,431 @@
+"""
+回测配置文件模块 / Backtest Configuration File Module
+从YAML或JSON文档读取EngineConfig并写回同样的文档，团队可以共享回测设置而不必共享代码
+Reads an EngineConfig from a YAML or JSON document and writes one back, so a
+team can share a backtest setup without sharing code
+
+文档的键与EngineConfig的字段同名，未出现的字段取默认值；枚举写作其取值（如"next_open"）；
+cost_model写作{"type": ...}加上该模型的参数（见COST_MODELS），或者写作
+{"commission": {...}, "slippage": {...}}表示CombinedCost。data、fx、slippage和commission函数、
+rounding_policy，以及标的池、交易日历、数据提供者对象和预先获取的公司行为无法用文档表示，
+需要在代码中设置。未知的键默认报错，strict=False时只记录警告。
+Keys are named after the EngineConfig fields and missing ones take the
+defaults. Enums are written as their values (e.g. "next_open"); cost_model
+is {"type": ...} plus that model's parameters (see COST_MODELS), or
+{"commission": {...}, "slippage": {...}} for a CombinedCost. data, fx, the
+slippage and commission functions, rounding_policy, and universe, calendar
+and provider objects or pre-fetched corporate actions can't be expressed in
+a document and have to be set in code. Unknown keys are an error by
+default and only a warning with strict=False.
+
+Examples:
+    >>> config = load_engine_config(io.StringIO('''
+    ... start_time: 2020-01-01
+    ... end_time: 2024-12-31
+    ... instruments: [SH600000, SZ000001]
+    ... execution_mode: next_vwap
+    ... cost_model:
+    ...   commission: {type: a_share, min_commission: 5}
+    ...   slippage: {type: fixed_bps_slippage, bps: 5}
+    ... '''))
+    >>> config.write("backtest.yaml")
+"""
+
+import difflib
+import json
+from dataclasses import fields as dataclass_fields
+from enum import Enum
+from pathlib import Path
+from typing import Any, Dict, List, Mapping, Optional, TextIO, Tuple, Type, Union
+
+import pandas as pd
+import yaml
+
+from ..core.money import RoundingMode
+from ..core.portfolio import CostBasis
+from ..core.price_adjustment import AdjustMode, to_adjust_mode
+from ..infrastructure.logger_system import get_logger
+from .backtest_engine import (
+    RISK_LIMITS,
+    AShareCostModel,
+    BacktestEngine,
+    CombinedCost,
+    CostModel,
+    EngineConfig,
+    ExecutionMode,
+    FixedBpsCommission,
+    FixedBpsSlippage,
+    LimitAction,
+    PerShareCommission,
+    RandomSlippage,
+    RiskLimits,
+    SpreadSlippage,
+    SuspensionPolicy,
+    VolumeShareSlippage,
+    ZeroCost
+)
+
+
+# 文档中的成本模型类型到(模型类, 构造参数) / Cost model type in a document to (model class, constructor parameters)
+COST_MODELS: Dict[str, Tuple[type, Tuple[str, ...]]] = {
+    "zero": (ZeroCost, ()),
+    "fixed_bps_commission": (FixedBpsCommission, ("bps", "minimum")),
+    "a_share": (AShareCostModel, (
+        "commission_rate", "min_commission", "stamp_tax_rate", "transfer_fee_rate", "transfer_fee_markets"
+    )),
+    "per_share": (PerShareCommission, ("per_share", "minimum")),
+    "fixed_bps_slippage": (FixedBpsSlippage, ("bps",)),
+    "spread": (SpreadSlippage, ("spread_bps", "tick")),
+    "volume_share": (VolumeShareSlippage, ("price_impact",)),
+    "random": (RandomSlippage, ("mean_bps", "std_bps")),
+}
+
+_ENUMS: Dict[str, Type[Enum]] = {
+    "execution_mode": ExecutionMode,
+    "cost_basis": CostBasis,
+    "rounding": RoundingMode,
+    "suspension": SuspensionPolicy,
+    "adjust": AdjustMode,
+}
+_NUMBERS = ("initial_cash", "participation_rate", "dividend_tax_rate")
+_INTEGERS = ("seed", "checkpoint_every", "suspension_expiry")
+_BOOLEANS = ("allow_short", "lookahead_guard", "corporate_actions")
+_STRINGS = ("start_time", "end_time", "base_currency", "calendar", "provider", "checkpoint_path")
+_OPTIONAL = (
+    "instruments", "cost_model", "participation_rate", "risk_limits", "seed", "checkpoint_path",
+    "checkpoint_every", "suspension_expiry", "calendar", "provider", "adjust"
+)
+# 只能在代码中设置的字段 / Fields only code can set
+_CODE_ONLY = ("slippage", "commission", "fx", "rounding_policy", "data")
+_KEYS = tuple(f.name for f in dataclass_fields(EngineConfig) if f.name not in _CODE_ONLY)
+
+
+class _Loader(yaml.SafeLoader):
+    """日期保持为字符串的SafeLoader，非法日期由EngineConfig的校验报告 / SafeLoader keeping dates as strings"""
+
+
+_Loader.yaml_implicit_resolvers = {
+    first: [(tag, regexp) for tag, regexp in resolvers if tag != "tag:yaml.org,2002:timestamp"]
+    for first, resolvers in yaml.SafeLoader.yaml_implicit_resolvers.items()
+}
+
+
+def load_engine_config(source: Union[str, Path, TextIO], strict: bool = True) -> EngineConfig:
+    """
+    从YAML或JSON文档读取回测配置 / Read a backtest configuration from a YAML or JSON document
+    
+    Args:
+        source: 文件路径或文本流，JSON文档也按YAML解析 / File path or text stream; JSON documents parse as YAML too
+        strict: 为True时未知的键报错，否则只记录警告 / Whether unknown keys are an error rather than a warning
+    
+    Returns:
+        EngineConfig: 校验过的配置 / The validated configuration
+    
+    Raises:
+        ValueError: 文档无法解析、缺少start_time或end_time、取值不合法，或strict时有未知的键 /
+            Raised for an unparsable document, a missing start_time or end_time, an
+            invalid value, or an unknown key when strict
+    """
+    if isinstance(source, (str, Path)):
+        with open(source, "r", encoding="utf-8") as f:
+            text = f.read()
+    else:
+        text = source.read()
+    try:
+        document = yaml.load(text, Loader=_Loader)
+    except yaml.YAMLError as e:
+        raise ValueError(f"not a valid YAML or JSON document: {e}") from None
+    return engine_config_from_dict(document, strict)
+
+
+def engine_config_from_dict(document: Mapping[str, Any], strict: bool = True) -> EngineConfig:
+    """
+    从已解析的文档构造回测配置 / Build a backtest configuration from a parsed document
+    
+    Args:
+        document: 键为EngineConfig字段名的映射 / Mapping keyed by EngineConfig field names
+        strict: 为True时未知的键报错，否则只记录警告 / Whether unknown keys are an error rather than a warning
+    
+    Returns:
+        EngineConfig: 校验过的配置 / The validated configuration
+    
+    Raises:
+        ValueError: 缺少start_time或end_time、取值不合法，或strict时有未知的键 /
+            Raised for a missing start_time or end_time, an invalid value, or an unknown key when strict
+    """
+    if not isinstance(document, Mapping):
+        raise ValueError(f"the document must be a mapping of EngineConfig fields, got {type(document).__name__}")
+    code_only = [key for key in _CODE_ONLY if key in document]
+    if code_only:
+        raise ValueError(f"{', '.join(code_only)} can't be set in a document; set it on the EngineConfig in code")
+    _check_keys(document, _KEYS, "", strict)
+    missing = [key for key in ("start_time", "end_time") if key not in document]
+    if missing:
+        raise ValueError(f"{' and '.join(missing)} {'is' if len(missing) == 1 else 'are'} required")
+    
+    kwargs = {}
+    for key in _KEYS:
+        if key not in document:
+            continue
+        value = document[key]
+        if value is None:
+            if key not in _OPTIONAL:
+                raise ValueError(f"{key} can't be null")
+            kwargs[key] = None
+        else:
+            kwargs[key] = _parse(key, value, strict)
+    config = EngineConfig(**kwargs)
+    if pd.Timestamp(config.start_time) > pd.Timestamp(config.end_time):
+        raise ValueError(f"start_time {config.start_time} is after end_time {config.end_time}")
+    # 其余的组合规则与引擎相同
+    BacktestEngine(config)
+    return config
+
+
+def engine_config_to_dict(config: EngineConfig) -> Dict[str, Any]:
+    """
+    把回测配置转换为可以写成YAML或JSON的文档 / Convert a backtest configuration to a YAML or JSON document
+    
+    start_time和end_time总是写出，其余字段只写出与默认值不同的
+    start_time and end_time are always written, the other fields only when they differ from the defaults
+    
+    Args:
+        config: 回测配置 / Backtest configuration
+    
+    Returns:
+        Dict[str, Any]: 按EngineConfig字段顺序排列的文档 / Document in EngineConfig field order
+    
+    Raises:
+        ValueError: 配置包含无法用文档表示的设置时抛出 / Raised when the configuration holds settings a document can't express
+    """
+    defaults = EngineConfig(start_time=config.start_time, end_time=config.end_time)
+    for key in _CODE_ONLY:
+        if getattr(config, key) is not getattr(defaults, key):
+            raise ValueError(f"{key} can't be written to a document; set it in code after loading")
+    document = {}
+    for key in _KEYS:
+        value = _dump(key, getattr(config, key))
+        if key in ("start_time", "end_time") or value != _dump(key, getattr(defaults, key)):
+            document[key] = value
+    return document
+
+
+def write_engine_config(
+    config: EngineConfig,
+    stream: Union[str, Path, TextIO],
+    format: Optional[str] = None
+) -> None:
+    """
+    把回测配置写成YAML或JSON文档，load_engine_config()可以读回相同的配置 /
+    Write a backtest configuration as YAML or JSON that load_engine_config() reads back unchanged
+    
+    Args:
+        config: 回测配置 / Backtest configuration
+        stream: 文件路径或文本流 / File path or text stream
+        format: "yaml"或"json"，None表示按文件后缀判断，.json为JSON，其他为YAML /
+            "yaml" or "json"; None goes by the file suffix, JSON for .json and YAML otherwise
+    
+    Raises:
+        ValueError: 格式未知，或配置包含无法用文档表示的设置时抛出 /
+            Raised for an unknown format or settings a document can't express
+    """
+    if format is None:
+        is_json = isinstance(stream, (str, Path)) and Path(stream).suffix.lower() == ".json"
+        format = "json" if is_json else "yaml"
+    if format not in ("yaml", "json"):
+        raise ValueError(f"format must be 'yaml' or 'json', got {format!r}")
+    document = engine_config_to_dict(config)
+    if format == "json":
+        text = json.dumps(document, indent=2, ensure_ascii=False) + "\n"
+    else:
+        text = yaml.safe_dump(document, sort_keys=False, allow_unicode=True)
+    if isinstance(stream, (str, Path)):
+        with open(stream, "w", encoding="utf-8") as f:
+            f.write(text)
+    else:
+        stream.write(text)
+
+
+def _check_keys(document: Mapping[str, Any], allowed: Tuple[str, ...], prefix: str, strict: bool) -> None:
+    """未知的键在strict时报错，否则记录警告，并提示最接近的键 / Unknown keys raise when strict and warn otherwise, suggesting the closest key"""
+    unknown = []
+    for key in document:
+        if key in allowed:
+            continue
+        close = difflib.get_close_matches(str(key), allowed, n=1)
+        unknown.append(f"{prefix}{key}" + (f" (did you mean {prefix}{close[0]}?)" if close else ""))
+    if not unknown:
+        return
+    if strict:
+        raise ValueError(f"unknown keys: {', '.join(unknown)}")
+    get_logger(__name__).warning(f"忽略未知的配置项: {', '.join(unknown)}")
+
+
+def _parse(key: str, value: Any, strict: bool) -> Any:
+    """解析并校验一个字段 / Parse and check one field"""
+    if key in ("start_time", "end_time"):
+        return _date(key, value)
+    if key in _ENUMS:
+        return _enum(key, value)
+    if key in _NUMBERS:
+        return _number(key, value)
+    if key in _INTEGERS:
+        if isinstance(value, bool) or not isinstance(value, int):
+            raise ValueError(f"{key} must be an integer, got {value!r}")
+        return value
+    if key in _BOOLEANS:
+        if not isinstance(value, bool):
+            raise ValueError(f"{key} must be true or false, got {value!r}")
+        return value
+    if key in _STRINGS:
+        if not isinstance(value, str):
+            raise ValueError(f"{key} must be a string, got {value!r}")
+        return value
+    if key == "instruments":
+        if isinstance(value, str):
+            return value
+        return _strings(key, value)
+    if key == "fields":
+        return _strings(key, value)
+    if key == "cost_model":
+        return _cost_model(key, value, strict)
+    return _risk_limits(key, value, strict)
+
+
+def _date(key: str, value: Any) -> str:
+    """日期必须能被pd.Timestamp解析 / Dates must parse with pd.Timestamp"""
+    if isinstance(value, str):
+        try:
+            parsed = pd.Timestamp(value)
+        except (ValueError, TypeError) as e:
+            raise ValueError(f"{key}: {value!r} is not a valid date ({e}); write it like 2020-01-31") from None
+        if not pd.isna(parsed):
+            return value
+    raise ValueError(f"{key}: {value!r} is not a valid date; write it like 2020-01-31")
+
+
+def _enum(key: str, value: Any) -> Enum:
+    """枚举按取值解析，adjust与get_features()一样不区分大小写 / Enums parse by value; adjust is case-insensitive as in get_features()"""
+    try:
+        return to_adjust_mode(value) if key == "adjust" else _ENUMS[key](value)
+    except ValueError:
+        choices = ", ".join(m.value for m in _ENUMS[key])
+        raise ValueError(f"{key} must be one of {choices}, got {value!r}") from None
+
+
+def _number(key: str, value: Any) -> float:
+    # PyYAML把1e6这样不带小数点的指数写法读作字符串
+    if isinstance(value, str):
+        try:
+            return float(value)
+        except ValueError:
+            pass
+    if isinstance(value, bool) or not isinstance(value, (int, float)):
+        raise ValueError(f"{key} must be a number, got {value!r}")
+    return value
+
+
+def _strings(key: str, value: Any) -> List[str]:
+    if not isinstance(value, list) or not all(isinstance(item, str) for item in value):
+        raise ValueError(f"{key} must be a list of strings, got {value!r}")
+    return list(value)
+
+
+def _cost_model(key: str, value: Any, strict: bool) -> CostModel:
+    """解析{"type": ...}或{"commission": ..., "slippage": ...} / Parse {"type": ...} or {"commission": ..., "slippage": ...}"""
+    if not isinstance(value, Mapping):
+        raise ValueError(f"{key} must be a mapping with a type, or with commission and slippage, got {value!r}")
+    if "type" not in value:
+        _check_keys(value, ("commission", "slippage"), f"{key}.", strict)
+        missing = [part for part in ("commission", "slippage") if part not in value]
+        if missing:
+            raise ValueError(f"{key} needs a type, or both commission and slippage; {' and '.join(missing)} missing")
+        return CombinedCost(
+            _cost_model(f"{key}.commission", value["commission"], strict),
+            _cost_model(f"{key}.slippage", value["slippage"], strict)
+        )
+    kind = value["type"]
+    if kind not in COST_MODELS:
+        raise ValueError(f"{key}.type must be one of {', '.join(COST_MODELS)}, got {kind!r}")
+    cls, parameters = COST_MODELS[kind]
+    _check_keys(value, ("type",) + parameters, f"{key}.", strict)
+    kwargs = {}
+    for name in parameters:
+        if name not in value:
+            continue
+        if name == "transfer_fee_markets":
+            kwargs[name] = tuple(_strings(f"{key}.{name}", value[name]))
+        else:
+            kwargs[name] = _number(f"{key}.{name}", value[name])
+    try:
+        return cls(**kwargs)
+    except (TypeError, ValueError) as e:
+        raise ValueError(f"{key}: {e}") from None
+
+
+def _risk_limits(key: str, value: Any, strict: bool) -> RiskLimits:
+    if not isinstance(value, Mapping):
+        raise ValueError(f"{key} must be a mapping of limits, got {value!r}")
+    _check_keys(value, RISK_LIMITS + ("action",), f"{key}.", strict)
+    kwargs = {
+        name: None if value[name] is None else _number(f"{key}.{name}", value[name])
+        for name in RISK_LIMITS if name in value
+    }
+    try:
+        if "action" in value:
+            action = value["action"]
+            if isinstance(action, Mapping):
+                kwargs["action"] = {name: LimitAction(a) for name, a in action.items()}
+            else:
+                kwargs["action"] = LimitAction(action)
+        return RiskLimits(**kwargs)
+    except ValueError as e:
+        raise ValueError(f"{key}: {e}") from None
+
+
+def _dump(key: str, value: Any) -> Any:
+    """把一个字段转换为文档中的取值 / Convert one field to its document value"""
+    if value is None:
+        return None
+    if key in _ENUMS:
+        return _enum(key, value).value
+    if key == "instruments":
+        if isinstance(value, str):
+            return value
+        if not isinstance(value, (list, tuple)):
+            raise ValueError(f"instruments: a {type(value).__name__} can't be written; give its name or the codes")
+        return list(value)
+    if key == "fields":
+        return list(value)
+    if key in ("calendar", "provider"):
+        if not isinstance(value, str):
+            raise ValueError(f"{key}: a {type(value).__name__} object can't be written; give its name")
+        return value
+    if key == "corporate_actions" and not isinstance(value, bool):
+        raise ValueError("corporate_actions: pre-fetched events can't be written; use true to fetch them")
+    if key == "checkpoint_path":
+        return str(value)
+    if key == "cost_model":
+        return _dump_cost_model(value)
+    if key == "risk_limits":
+        document = {name: getattr(value, name) for name in RISK_LIMITS if getattr(value, name) is not None}
+        action = value.action
+        if isinstance(action, Mapping):
+            document["action"] = {name: LimitAction(a).value for name, a in action.items()}
+        else:
+            document["action"] = LimitAction(action).value
+        return document
+    return value
+
+
+def _dump_cost_model(model: CostModel) -> Dict[str, Any]:
+    if type(model) is CombinedCost:
+        return {"commission": _dump_cost_model(model._commission), "slippage": _dump_cost_model(model._slippage)}
+    for kind, (cls, parameters) in COST_MODELS.items():
+        if type(model) is cls:
+            document: Dict[str, Any] = {"type": kind}
+            for name in parameters:
+                value = getattr(model, name)
+                document[name] = list(value) if isinstance(value, tuple) else value
+            return document
+    raise ValueError(f"cost_model: {type(model).__name__} has no document form; see COST_MODELS")
@@ -0,0 +1,469 @@
+"""
+订单执行调度模块 / Order Execution Scheduling Module
+把策略的目标仓位变化拆分为之后若干根K线上的子订单，并按决策时价格计算执行缺口
+Slices a strategy's desired position changes into child orders over the
+following bars, and measures the implementation shortfall against the
+decision-time price
+
+ExecutionScheduler包装一个策略：策略下达的市价单不直接提交，而是作为一个调度计划，
+从当前K线起的horizon根K线上每根K线提交一笔子订单。TWAP把剩余数量平均分到剩余的K线上；
+VWAP按当前K线成交量相对最近volume_lookback根K线平均成交量的比例放大或缩小当前的一份。
+每笔子订单不超过当前K线成交量的max_participation（子订单在之后的K线成交，以当前K线的成交量
+作为预测），未满一手的部分留到之后的K线。同一标的的新订单取代尚未完成的计划。限价单、止损单
+不调度，原样提交。
+ExecutionScheduler wraps a strategy: the market orders it places are not
+submitted directly but become a schedule, one child order per bar over the
+horizon bars from the current one. TWAP spreads the remaining quantity
+evenly over the bars left; VWAP scales the current share up or down by the
+current bar's volume relative to the average of the last volume_lookback
+bars. No child exceeds max_participation of the current bar's volume (the
+child fills on a later bar, and the current volume stands in as the
+forecast), and anything short of a lot waits for a later bar. A new order on
+an instrument supersedes its unfinished schedule. Limit and stop orders are
+not scheduled and pass through unchanged.
+
+horizon根K线结束时仍未完成的计划按horizon_policy处理：EXTEND继续按参与比例上限提交，
+最多再延长max_extension根K线；CANCEL取消剩余数量。已完成数量按组合持仓的变化计算。
+A schedule unfinished after its horizon follows horizon_policy: EXTEND keeps
+submitting up to the participation cap, for at most max_extension more bars,
+and CANCEL drops the rest. The quantity done is read from the change in the
+portfolio position.
+
+回测结束后reports()把成交记录归到各个计划，按决策时（策略下单的K线）的收盘价计算执行缺口：
+已成交部分相对决策价的不利差额、费用，以及未成交部分到计划结束时的价格变动（机会成本）。
+同一个策略换用不同的调度方式分别回测，即可比较执行缺口。
+After the run reports() assigns the fills to their schedules and measures
+the implementation shortfall against the close of the decision bar (the bar
+the strategy placed the order on): the adverse difference of the fills to
+the decision price, the fees, and the price move on the unfilled part up to
+the end of the schedule (the opportunity cost). Running one strategy with
+different schedules makes them comparable.
+
+Examples:
+    >>> scheduler = ExecutionScheduler(strategy, style="vwap", horizon=5, max_participation=0.1)
+    >>> result = run(EngineConfig(..., fields=["$volume"]), scheduler)
+    >>> [r.shortfall_bps for r in scheduler.reports(result)]
+"""
+
+import bisect
+import math
+from dataclasses import dataclass, replace
+from enum import Enum
+from typing import Any, Dict, Iterable, List, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..core.feature_frame import Bar
+from ..core.portfolio import Portfolio
+from ..infrastructure.data_provider import RightsIssue
+from .backtest_engine import (
+    CLOSE_FIELD,
+    VOLUME_FIELD,
+    BarContext,
+    EngineResult,
+    ExecutionMode,
+    FillKind,
+    Order,
+    OrderSide,
+    OrderType,
+    Snapshotter,
+    Strategy
+)
+from .rebalance import A_SHARE_LOT
+
+
+_EPSILON = 1e-9
+
+# VWAP默认比较的历史K线数 / Bars of history VWAP compares against by default
+DEFAULT_VOLUME_LOOKBACK = 20
+
+
+class ScheduleStyle(Enum):
+    """子订单的数量分配方式 / How child quantities are allotted"""
+    TWAP = "twap"  # 剩余数量平均分到剩余的K线
+    VWAP = "vwap"  # 按当前K线的相对成交量放大或缩小
+
+
+class HorizonPolicy(Enum):
+    """到达horizon时仍未完成的计划的处理方式 / What happens to a schedule unfinished at its horizon"""
+    EXTEND = "extend"  # 继续按参与比例上限提交
+    CANCEL = "cancel"  # 取消剩余数量
+
+
+class ScheduleStatus(Enum):
+    """调度计划的状态 / State of a schedule"""
+    ACTIVE = "active"  # 回测结束时仍在执行
+    COMPLETE = "complete"  # 全部完成
+    CANCELLED = "cancelled"  # 按horizon_policy取消了剩余数量
+    SUPERSEDED = "superseded"  # 被同一标的的新订单取代
+
+
+@dataclass
+class _Schedule:
+    """执行中的调度计划 / Schedule being worked"""
+    instrument: str
+    sign: int
+    quantity: float
+    decision_time: pd.Timestamp
+    decision_price: float
+    start_position: float
+    slices: int = 0
+    status: ScheduleStatus = ScheduleStatus.ACTIVE
+    end_time: Optional[pd.Timestamp] = None
+    end_price: Optional[float] = None
+    
+    def remaining(self, position: float) -> float:
+        """按持仓变化计算的剩余数量 / Remaining quantity judged by the position change"""
+        done = self.sign * (position - self.start_position)
+        return max(self.quantity - max(done, 0.0), 0.0)
+    
+    def finish(self, status: ScheduleStatus, time: pd.Timestamp, price: Optional[float]) -> None:
+        self.status = status
+        self.end_time = time
+        self.end_price = price
+
+
+@dataclass
+class ScheduleReport:
+    """
+    调度计划的执行结果 / Outcome of a schedule
+    
+    金额以标的计价货币表示，缺口为正表示成本
+    Amounts are in the instrument's quote currency; a positive shortfall is a cost
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        side: 买卖方向 / Side
+        decision_time: 策略下单的K线时间 / Bar the strategy placed the order on
+        decision_price: 决策K线的收盘价 / Close of the decision bar
+        quantity: 目标数量 / Quantity wanted
+        filled: 成交数量 / Quantity filled
+        average_price: 成交均价，没有成交时为None / Average fill price, None without fills
+        fees: 成交的手续费和税费 / Commissions and taxes of the fills
+        end_price: 计划结束时的收盘价，用于计算机会成本 / Close when the schedule ended, for the opportunity cost
+        slices: 计划经历的K线数 / Bars the schedule was worked over
+        status: 计划状态 / Schedule status
+        end_time: 计划结束的K线时间，仍在执行时为None / Bar the schedule ended on, None while active
+    """
+    instrument: str
+    side: OrderSide
+    decision_time: pd.Timestamp
+    decision_price: float
+    quantity: float
+    filled: float
+    average_price: Optional[float]
+    fees: float
+    end_price: float
+    slices: int
+    status: ScheduleStatus
+    end_time: Optional[pd.Timestamp] = None
+    
+    @property
+    def unfilled(self) -> float:
+        """未成交数量 / Quantity left unfilled"""
+        return max(self.quantity - self.filled, 0.0)
+    
+    @property
+    def execution_cost(self) -> float:
+        """成交价相对决策价的不利差额 / Adverse difference of the fills to the decision price"""
+        if self.average_price is None:
+            return 0.0
+        return self._sign * (self.average_price - self.decision_price) * self.filled
+    
+    @property
+    def opportunity_cost(self) -> float:
+        """未成交部分从决策到计划结束的不利价格变动 / Adverse move on the unfilled part up to the end"""
+        return self._sign * (self.end_price - self.decision_price) * self.unfilled
+    
+    @property
+    def shortfall(self) -> float:
+        """执行缺口：执行成本、费用和机会成本之和 / Implementation shortfall: execution cost, fees and opportunity cost"""
+        return self.execution_cost + self.fees + self.opportunity_cost
+    
+    @property
+    def shortfall_bps(self) -> float:
+        """执行缺口占决策时目标金额的基点数 / Shortfall in basis points of the decision-time target value"""
+        return self.shortfall / (self.decision_price * self.quantity) * 1e4
+    
+    @property
+    def _sign(self) -> int:
+        return 1 if self.side is OrderSide.BUY else -1
+    
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "instrument": self.instrument,
+            "side": self.side.value,
+            "decision_time": self.decision_time.isoformat(),
+            "decision_price": self.decision_price,
+            "quantity": self.quantity,
+            "filled": self.filled,
+            "average_price": self.average_price,
+            "fees": self.fees,
+            "end_price": self.end_price,
+            "end_time": None if self.end_time is None else self.end_time.isoformat(),
+            "slices": self.slices,
+            "status": self.status.value,
+            "shortfall": self.shortfall,
+            "shortfall_bps": self.shortfall_bps,
+        }
+
+
+class ExecutionScheduler(Strategy, Snapshotter):
+    """
+    把策略的市价单拆分为子订单 / Slices a strategy's market orders into child orders
+    
+    回测需要$volume字段（加入EngineConfig.fields）；没有成交量的K线上，设置了max_participation时
+    不提交子订单。execution_mode必须与回测或模拟盘的执行方式一致，reports()据此把成交归到子订单。
+    The run needs the $volume field (add it to EngineConfig.fields); with
+    max_participation set, no child goes out on a bar without volume.
+    execution_mode must match the backtest's or paper trader's, as reports()
+    relies on it to tie fills to child orders.
+    """
+    
+    def __init__(
+        self,
+        strategy: Strategy,
+        style: Union[str, ScheduleStyle] = ScheduleStyle.TWAP,
+        horizon: int = 5,
+        max_participation: Optional[float] = 0.1,
+        horizon_policy: Union[str, HorizonPolicy] = HorizonPolicy.EXTEND,
+        max_extension: Optional[int] = None,
+        volume_lookback: int = DEFAULT_VOLUME_LOOKBACK,
+        lot_size: int = A_SHARE_LOT,
+        execution_mode: Union[str, ExecutionMode] = ExecutionMode.NEXT_OPEN
+    ):
+        """
+        初始化调度器 / Initialize scheduler
+        
+        Args:
+            strategy: 被包装的策略 / Wrapped strategy
+            style: 数量分配方式 / How child quantities are allotted
+            horizon: 计划分布的K线数，从决策K线起 / Bars a schedule is spread over, from the decision bar on
+            max_participation: 子订单占当前K线成交量的上限，None表示不限制 /
+                Cap of a child as a share of the current bar's volume, None for no cap
+            horizon_policy: 到达horizon时仍未完成的处理方式 / What to do when the horizon ends unfinished
+            max_extension: EXTEND时最多延长的K线数，None表示直到完成 / Bars EXTEND adds at most, None until done
+            volume_lookback: VWAP比较的历史K线数 / Bars of history VWAP compares against
+            lot_size: 每手股数 / Shares per lot
+            execution_mode: 回测的订单执行方式 / Execution mode of the run
+        """
+        if not isinstance(horizon, int) or isinstance(horizon, bool) or horizon < 1:
+            raise ValueError(f"horizon must be a positive integer, got {horizon!r}")
+        if max_participation is not None and not 0 < max_participation <= 1:
+            raise ValueError(f"max_participation must be in (0, 1], got {max_participation!r}")
+        if max_extension is not None and (not isinstance(max_extension, int) or max_extension < 0):
+            raise ValueError(f"max_extension must be a non-negative integer or None, got {max_extension!r}")
+        if not isinstance(volume_lookback, int) or volume_lookback < 1:
+            raise ValueError(f"volume_lookback must be a positive integer, got {volume_lookback!r}")
+        if not isinstance(lot_size, int) or isinstance(lot_size, bool) or lot_size < 1:
+            raise ValueError(f"lot_size must be a positive integer, got {lot_size!r}")
+        self._strategy = strategy
+        self._style = ScheduleStyle(style)
+        self._horizon = horizon
+        self._max_participation = max_participation
+        self._policy = HorizonPolicy(horizon_policy)
+        self._max_extension = max_extension
+        self._volume_lookback = volume_lookback
+        self._lot_size = lot_size
+        self._mode = ExecutionMode(execution_mode)
+        self._schedules: List[_Schedule] = []
+        # 每个标的的子订单：(提交的K线时间, 计划序号)，按时间升序
+        self._children: Dict[str, List[Tuple[pd.Timestamp, int]]] = {}
+        self._last_close: Dict[str, float] = {}
+    
+    @property
+    def strategy(self) -> Strategy:
+        """被包装的策略 / Wrapped strategy"""
+        return self._strategy
+    
+    @property
+    def active(self) -> List[str]:
+        """有执行中计划的标的 / Instruments with a schedule being worked"""
+        return [s.instrument for s in self._schedules if s.status is ScheduleStatus.ACTIVE]
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        day = ctx.time
+        for code, bar in bars.items():
+            close = bar.get(CLOSE_FIELD)
+            if close is not None and math.isfinite(float(close)):
+                self._last_close[code] = float(close)
+        
+        orders: List[Order] = []
+        changes: Dict[str, float] = {}
+        for order in self._strategy.on_bar(ctx, portfolio, bars) or []:
+            if order.order_type is not OrderType.MARKET or self._close(ctx, order.instrument) is None:
+                orders.append(order)
+                continue
+            sign = 1 if order.side is OrderSide.BUY else -1
+            changes[order.instrument] = changes.get(order.instrument, 0.0) + sign * order.quantity
+        for code, change in changes.items():
+            self._start(code, change, ctx, portfolio)
+        
+        for index, schedule in enumerate(self._schedules):
+            if schedule.status is ScheduleStatus.ACTIVE:
+                child = self._slice(schedule, ctx, portfolio)
+                if child is not None:
+                    self._children.setdefault(schedule.instrument, []).append((day, index))
+                    orders.append(child)
+        return orders or None
+    
+    def on_rights_issue(self, offer: RightsIssue, entitled: float, portfolio: Portfolio) -> bool:
+        return self._strategy.on_rights_issue(offer, entitled, portfolio)
+    
+    def reports(self, result: EngineResult) -> List[ScheduleReport]:
+        """
+        按成交记录计算每个计划的执行结果 / Outcome of every schedule from the fills of a run
+        
+        Args:
+            result: 使用本调度器的回测结果 / Result of the run using this scheduler
+        
+        Returns:
+            List[ScheduleReport]: 按计划开始的顺序 / In the order the schedules started
+        """
+        filled = [0.0] * len(self._schedules)
+        value = [0.0] * len(self._schedules)
+        fees = [0.0] * len(self._schedules)
+        for fill in result.trades:
+            if fill.kind is not FillKind.TRADE:
+                continue
+            index = self._owner(fill.instrument, fill.time)
+            if index is None or self._schedules[index].sign != (1 if fill.side is OrderSide.BUY else -1):
+                continue
+            filled[index] += fill.quantity
+            value[index] += fill.quantity * fill.price
+            fees[index] += fill.commission + fill.tax
+        
+        reports = []
+        for index, schedule in enumerate(self._schedules):
+            end_price = schedule.end_price
+            if end_price is None:
+                end_price = self._last_close.get(schedule.instrument, schedule.decision_price)
+            reports.append(ScheduleReport(
+                instrument=schedule.instrument,
+                side=OrderSide.BUY if schedule.sign > 0 else OrderSide.SELL,
+                decision_time=schedule.decision_time,
+                decision_price=schedule.decision_price,
+                quantity=schedule.quantity,
+                filled=filled[index],
+                average_price=value[index] / filled[index] if filled[index] > _EPSILON else None,
+                fees=fees[index],
+                end_price=end_price,
+                slices=schedule.slices,
+                status=schedule.status,
+                end_time=schedule.end_time
+            ))
+        return reports
+    
+    def snapshot(self) -> Any:
+        inner = self._strategy.snapshot() if isinstance(self._strategy, Snapshotter) else None
+        return {
+            "schedules": [replace(s) for s in self._schedules],
+            "children": {code: list(items) for code, items in self._children.items()},
+            "last_close": dict(self._last_close),
+            "strategy": inner,
+        }
+    
+    def restore(self, state: Any) -> None:
+        self._schedules = [replace(s) for s in state["schedules"]]
+        self._children = {code: list(items) for code, items in state["children"].items()}
+        self._last_close = dict(state["last_close"])
+        if isinstance(self._strategy, Snapshotter):
+            self._strategy.restore(state["strategy"])
+    
+    def _start(self, code: str, change: float, ctx: BarContext, portfolio: Portfolio) -> None:
+        """为一个标的开始新计划，取代尚未完成的计划 / Start a schedule for an instrument, superseding the open one"""
+        close = self._close(ctx, code)
+        for schedule in self._schedules:
+            if schedule.instrument == code and schedule.status is ScheduleStatus.ACTIVE:
+                schedule.finish(ScheduleStatus.SUPERSEDED, ctx.time, close)
+        if abs(change) <= _EPSILON:
+            return
+        self._schedules.append(_Schedule(
+            instrument=code,
+            sign=1 if change > 0 else -1,
+            quantity=abs(change),
+            decision_time=ctx.time,
+            decision_price=close,
+            start_position=portfolio.position(code)
+        ))
+    
+    def _slice(self, schedule: _Schedule, ctx: BarContext, portfolio: Portfolio) -> Optional[Order]:
+        """计算计划在当前K线的子订单 / Child order of a schedule on the current bar"""
+        code = schedule.instrument
+        close = self._close(ctx, code)
+        remaining = schedule.remaining(portfolio.position(code))
+        if remaining <= _EPSILON:
+            schedule.finish(ScheduleStatus.COMPLETE, ctx.time, close)
+            return None
+        
+        bars_left = self._horizon - schedule.slices
+        if bars_left <= 0:
+            extended = schedule.slices - self._horizon
+            if self._policy is HorizonPolicy.CANCEL or (
+                self._max_extension is not None and extended >= self._max_extension
+            ):
+                schedule.finish(ScheduleStatus.CANCELLED, ctx.time, close)
+                return None
+            bars_left = 1
+        # 停牌等没有K线的日子也计入计划的K线数
+        schedule.slices += 1
+        bar = ctx.bar(code)
+        if bar is None:
+            return None
+        
+        volume = bar.get(VOLUME_FIELD)
+        volume = float(volume) if volume is not None and math.isfinite(float(volume)) and volume > 0 else None
+        share = 1.0
+        if self._style is ScheduleStyle.VWAP and volume is not None:
+            share = self._relative_volume(ctx, code, volume)
+        quantity = remaining * share / (share + bars_left - 1)
+        if self._max_participation is not None:
+            quantity = min(quantity, self._max_participation * volume if volume is not None else 0.0)
+        if quantity < remaining - _EPSILON:
+            quantity = math.floor(quantity / self._lot_size + _EPSILON) * self._lot_size
+        else:
+            quantity = remaining
+        if quantity <= _EPSILON:
+            return None
+        return Order(code, OrderSide.BUY if schedule.sign > 0 else OrderSide.SELL, quantity)
+    
+    def _relative_volume(self, ctx: BarContext, code: str, volume: float) -> float:
+        """当前K线成交量相对之前平均成交量的比例 / Current volume relative to the average before it"""
+        history = ctx.history(code, self._volume_lookback + 1)
+        if VOLUME_FIELD not in history.columns or len(history) < 2:
+            return 1.0
+        previous = history[VOLUME_FIELD].to_numpy(dtype=float)[:-1]
+        previous = previous[np.isfinite(previous)]
+        average = previous.mean() if len(previous) else 0.0
+        return volume / average if average > 0 else 1.0
+    
+    def _close(self, ctx: BarContext, code: str) -> Optional[float]:
+        """当前K线的收盘价 / Close of the current bar"""
+        bar = ctx.bar(code)
+        close = None if bar is None else bar.get(CLOSE_FIELD)
+        if close is None or not math.isfinite(float(close)):
+            return None
+        return float(close)
+    
+    def _owner(self, code: str, time: pd.Timestamp) -> Optional[int]:
+        """
+        成交所属的计划：成交之前最近提交的子订单 / Schedule owning a fill: the latest child submitted before it
+        
+        SAME_CLOSE模式下子订单在提交的K线上成交，其余模式在之后的K线上成交
+        Under SAME_CLOSE a child fills on the bar it was submitted on, otherwise on a later bar
+        """
+        children = self._children.get(code)
+        if not children:
+            return None
+        times = [t for t, _ in children]
+        if self._mode is ExecutionMode.SAME_CLOSE:
+            position = bisect.bisect_right(times, time)
+        else:
+            position = bisect.bisect_left(times, time)
+        return children[position - 1][1] if position > 0 else None
@@ -0,0 +1,330 @@
+"""
+参数网格搜索模块 / Parameter Grid Search Module
+对策略参数的笛卡尔积逐一回测，按选定的绩效指标排序
+Backtests every combination in the Cartesian product of strategy parameters
+and ranks them by a chosen performance metric
+
+数据只获取一次，所有组合在有界的线程池中并行回测，共享同一份只读的FeatureFrame；
+策略工厂和策略不应修改数据。每个组合使用相同的随机种子（EngineConfig.seed，为None时
+选取一个并记录在结果中），因此随机成本模型和策略的随机数流（ctx.rng()）对所有组合一致；
+每次回测的随机数只来自自己的引擎，与线程的调度顺序无关，相同的种子和数据得到完全相同的成交。
+Data is fetched once and every combination is backtested in parallel on a
+bounded thread pool sharing the same read-only FeatureFrames; strategy
+factories and strategies must not modify the data. Every combination runs
+with the same random seed (EngineConfig.seed, or one picked and recorded in
+the result when it is None), so stochastic cost models and the strategies'
+random streams (ctx.rng()) treat all of them alike. Each run draws only from
+its own engine, whatever order the threads run in, so the same seed and data
+give identical fills.
+
+ctx取消或超时后不再开始新的组合，正在运行的回测会完成，然后抛出PartialGridSearchError，
+其result为已完成的组合。
+Once ctx is cancelled or past its deadline no further combinations start;
+the runs in flight complete, then PartialGridSearchError is raised with the
+finished combinations in its result.
+
+Examples:
+    >>> result = grid_search(
+    ...     GridSearchConfig(engine=EngineConfig(start_time="2020-01-01", end_time="2024-12-31", instruments=codes)),
+    ...     lambda params: MACrossStrategy(int(params["fast"]), int(params["slow"])),
+    ...     {"fast": [5, 10, 20], "slow": [30, 60, 120]}
+    ... )
+    >>> result.best.params
+    {'fast': 10.0, 'slow': 60.0}
+    >>> result.to_csv("grid.csv")
+"""
+
+import itertools
+from collections import deque
+from concurrent.futures import FIRST_COMPLETED, Future, ThreadPoolExecutor, wait
+from dataclasses import dataclass, field, replace
+from typing import Callable, Dict, List, Mapping, Optional, Sequence, Tuple, Union
+
+import pandas as pd
+
+from ..core.data_manager import DataManager, default_max_workers
+from ..core.metrics import FreqLike, Summary, summary
+from ..infrastructure.logger_system import get_logger
+from ..utils.random_streams import new_seed
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from .backtest_engine import BacktestEngine, EngineConfig, EngineResult, Strategy, StrategyCallback
+
+
+# 网格搜索可以排序的指标 / Metrics a grid search can rank by
+GRID_METRICS = (
+    "total_return", "annualized_return", "annualized_vol", "sharpe", "sortino",
+    "max_drawdown", "calmar", "cagr", "final_equity"
+)
+
+# 越小越好的指标 / Metrics where lower is better
+_LOWER_IS_BETTER = frozenset({"annualized_vol", "max_drawdown"})
+
+# 参数组合 / One parameter combination
+Params = Dict[str, float]
+
+# 根据一组参数构造策略 / Builds the strategy for one parameter combination
+ParamsFactory = Callable[[Params], Union[Strategy, StrategyCallback]]
+
+
+@dataclass
+class GridSearchConfig:
+    """
+    网格搜索配置 / Grid search configuration
+    
+    Attributes:
+        engine: 每次回测使用的引擎配置，seed为所有组合共用的随机种子 /
+            Engine configuration of every run; seed is shared by all combinations
+        metric: 排序指标，见GRID_METRICS，默认为夏普比率 / Ranking metric from GRID_METRICS, Sharpe by default
+        ascending: 是否升序排列，None表示annualized_vol和max_drawdown升序、其他指标降序 /
+            Sort ascending; None sorts annualized_vol and max_drawdown ascending and the rest descending
+        max_workers: 并发回测数，None表示CPU核数 / Concurrent runs, None for the CPU count
+        rf: 计算绩效时的年化无风险利率 / Annual risk-free rate for the metrics
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    """
+    engine: EngineConfig
+    metric: str = "sharpe"
+    ascending: Optional[bool] = None
+    max_workers: Optional[int] = None
+    rf: float = 0.0
+    freq: FreqLike = "day"
+
+
+@dataclass
+class GridRun:
+    """
+    一个参数组合的回测结果 / Backtest result of one parameter combination
+    
+    Attributes:
+        params: 参数组合 / Parameter combination
+        result: 回测结果 / Backtest result
+        metrics: 绩效汇总 / Performance summary
+    """
+    params: Params
+    result: EngineResult
+    metrics: Summary
+    
+    def value(self, metric: str) -> Optional[float]:
+        """
+        获取一个指标的值，max_drawdown为回撤幅度 / Get one metric, max_drawdown being the drawdown magnitude
+        
+        Raises:
+            ValueError: 指标不在GRID_METRICS中时抛出 / Raised for a metric outside GRID_METRICS
+        """
+        _check_metric(metric)
+        if metric == "final_equity":
+            return self.result.final_equity
+        if metric == "max_drawdown":
+            return self.metrics.max_drawdown.magnitude
+        return getattr(self.metrics, metric)
+
+
+@dataclass
+class GridSearchResult:
+    """
+    网格搜索结果 / Grid search result
+    
+    Attributes:
+        runs: 成功的组合，按metric排序，最好的在前；指标为NaN的组合排在最后 /
+            Successful combinations ranked by metric, best first; NaN metrics sort last
+        metric: 排序指标 / Ranking metric
+        seed: 所有组合共用的随机种子 / Random seed shared by every combination
+        errors: 回测失败的组合及其错误，按组合的枚举顺序 /
+            Combinations whose backtest failed with their errors, in enumeration order
+    """
+    runs: List[GridRun]
+    metric: str
+    seed: int
+    errors: List[Tuple[Params, Exception]] = field(default_factory=list)
+    
+    @property
+    def best(self) -> Optional[GridRun]:
+        """排名第一的组合，没有成功的组合时为None / The top-ranked combination; None when none succeeded"""
+        return self.runs[0] if self.runs else None
+    
+    def table(self) -> pd.DataFrame:
+        """
+        所有成功组合的参数和指标 / Parameters and metrics of every successful combination
+        
+        Returns:
+            pd.DataFrame: 每个组合一行，按排名排列，以从1开始的名次为索引；参数列在前，
+                之后为GRID_METRICS中的指标和成交笔数 / One row per combination in rank
+                order, indexed by rank from 1; parameter columns first, then the
+                GRID_METRICS values and the trade count
+        """
+        rows = []
+        for run in self.runs:
+            row = dict(run.params)
+            row.update({metric: run.value(metric) for metric in GRID_METRICS})
+            row["trades"] = len(run.result.trades)
+            rows.append(row)
+        return pd.DataFrame(rows, index=pd.RangeIndex(1, len(rows) + 1, name="rank"))
+    
+    def to_csv(self, path_or_buf=None, **kwargs) -> Optional[str]:
+        """
+        把table()导出为CSV / Export table() as CSV
+        
+        Args:
+            path_or_buf: 文件路径或文件对象，None时返回CSV文本 / File path or object; None returns the CSV text
+            **kwargs: 传给DataFrame.to_csv()的其他参数 / Other DataFrame.to_csv() arguments
+        
+        Returns:
+            Optional[str]: path_or_buf为None时的CSV文本 / The CSV text when path_or_buf is None
+        """
+        return self.table().to_csv(path_or_buf, **kwargs)
+
+
+class PartialGridSearchError(ContextCancelledError):
+    """
+    网格搜索中途取消错误 / Grid search cancelled part way
+    
+    result为已完成的组合，pending为尚未开始的组合，cause为上下文的原始错误
+    result holds the combinations that finished, pending the ones never
+    started, and cause the context's own error
+    """
+    
+    def __init__(self, cause: ContextCancelledError, result: GridSearchResult, pending: List[Params]):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            cause: 上下文的错误 / The context's error
+            result: 已完成组合的结果 / Result of the finished combinations
+            pending: 未开始的组合 / Combinations that never started
+        """
+        self.cause = cause
+        self.result = result
+        self.pending: List[Params] = list(pending)
+        super().__init__(deadline_exceeded=cause.deadline_exceeded, reason=cause.reason)
+
+
+def parameter_grid(grid: Mapping[str, Sequence[float]]) -> List[Params]:
+    """
+    枚举参数的笛卡尔积 / Enumerate the Cartesian product of parameter values
+    
+    最后一个参数变化最快，如{"fast": [5, 10], "slow": [30, 60]}得到
+    (5, 30)、(5, 60)、(10, 30)、(10, 60)
+    The last parameter varies fastest, so {"fast": [5, 10], "slow": [30, 60]}
+    gives (5, 30), (5, 60), (10, 30), (10, 60)
+    
+    Args:
+        grid: 参数名到候选值的映射 / Mapping of parameter name to candidate values
+    
+    Returns:
+        List[Params]: 所有参数组合，值转换为float / Every combination with the values as floats
+    
+    Raises:
+        ValueError: 网格为空或某个参数没有候选值时抛出 / Raised for an empty grid or a parameter without values
+    """
+    if not grid:
+        raise ValueError("grid must name at least one parameter")
+    names = list(grid)
+    values = []
+    for name in names:
+        candidates = [float(v) for v in grid[name]]
+        if not candidates:
+            raise ValueError(f"parameter {name!r} has no values")
+        values.append(candidates)
+    return [dict(zip(names, combination)) for combination in itertools.product(*values)]
+
+
+def grid_search(
+    config: GridSearchConfig,
+    factory: ParamsFactory,
+    grid: Mapping[str, Sequence[float]],
+    data_manager: Optional[DataManager] = None,
+    ctx: Optional[RequestContext] = None
+) -> GridSearchResult:
+    """
+    运行参数网格搜索 / Run a parameter grid search
+    
+    Args:
+        config: 网格搜索配置 / Grid search configuration
+        factory: 策略工厂，参数为一个组合，在工作线程中调用 /
+            Strategy factory called with one combination, on a worker thread
+        grid: 参数名到候选值的映射 / Mapping of parameter name to candidate values
+        data_manager: 获取数据使用的数据管理器 / Data manager used to fetch data
+        ctx: 请求上下文，取消后不再开始新的组合 / Request context; once done no further combinations start
+    
+    Returns:
+        GridSearchResult: 按指标排序的结果 / Results ranked by the metric
+    
+    Raises:
+        ValueError: 网格、指标或并发数不合法时抛出 / Raised for an invalid grid, metric or worker count
+        PartialGridSearchError: 上下文取消或超时时在正在运行的回测完成后抛出 /
+            Raised once the runs in flight finish when the context is cancelled or times out
+        DataError: 获取数据失败时抛出 / Raised when fetching data fails
+    """
+    logger = get_logger(__name__)
+    ctx = ctx or background()
+    _check_metric(config.metric)
+    combinations = parameter_grid(grid)
+    workers = config.max_workers or default_max_workers()
+    if workers < 1:
+        raise ValueError(f"max_workers must be positive, got {config.max_workers}")
+    ctx.check()
+    
+    seed = config.engine.seed if config.engine.seed is not None else new_seed()
+    frames, _ = BacktestEngine(config.engine, data_manager).load()
+    engine_config = replace(config.engine, data=frames, seed=seed)
+    
+    def run(params: Params) -> GridRun:
+        result = BacktestEngine(engine_config).run(factory(params))
+        metrics = summary(result.equity_curve, rf=config.rf, freq=config.freq, kind="equity")
+        return GridRun(dict(params), result, metrics)
+    
+    logger.info(f"网格搜索: {len(combinations)}个参数组合, 并发数 {min(workers, len(combinations))}, 种子 {seed}")
+    pending = deque(enumerate(combinations))
+    running: Dict[Future, Tuple[int, Params]] = {}
+    finished: Dict[int, GridRun] = {}
+    failed: Dict[int, Tuple[Params, Exception]] = {}
+    with ThreadPoolExecutor(max_workers=min(workers, len(combinations))) as executor:
+        while pending or running:
+            # 取消后不再提交新的组合，只等待正在运行的回测
+            while pending and len(running) < workers and not ctx.cancelled:
+                number, params = pending.popleft()
+                running[executor.submit(run, params)] = (number, params)
+            if not running:
+                break
+            done, _ = wait(list(running), return_when=FIRST_COMPLETED)
+            for future in done:
+                number, params = running.pop(future)
+                try:
+                    finished[number] = future.result()
+                except Exception as e:
+                    logger.warning(f"参数组合 {params} 回测失败: {e}")
+                    failed[number] = (params, e)
+    
+    result = GridSearchResult(
+        _rank([finished[n] for n in sorted(finished)], config.metric, config.ascending),
+        config.metric,
+        seed,
+        [failed[n] for n in sorted(failed)]
+    )
+    if pending:
+        error = ctx.err()
+        logger.info(f"网格搜索已取消 - 已完成: {len(finished) + len(failed)}, 未开始: {len(pending)}")
+        raise PartialGridSearchError(error, result, [params for _, params in pending]) from error
+    best = result.best
+    if best is not None:
+        logger.info(f"网格搜索完成: 最优参数 {best.params}, {config.metric} = {best.value(config.metric)}")
+    return result
+
+
+def _check_metric(metric: str) -> None:
+    """指标必须在GRID_METRICS中 / The metric must be one of GRID_METRICS"""
+    if metric not in GRID_METRICS:
+        raise ValueError(f"metric must be one of {', '.join(GRID_METRICS)}, got {metric!r}")
+
+
+def _rank(runs: List[GridRun], metric: str, ascending: Optional[bool]) -> List[GridRun]:
+    """按指标稳定排序，NaN和None排在最后 / Stable sort by the metric with NaN and None last"""
+    if ascending is None:
+        ascending = metric in _LOWER_IS_BETTER
+    
+    def key(run: GridRun) -> Tuple[bool, float]:
+        value = run.value(metric)
+        if value is None or value != value:
+            return True, 0.0
+        return False, value if ascending else -value
+    
+    return sorted(runs, key=key)
@@ -0,0 +1,528 @@
+"""
+模拟盘模块 / Paper Trading Module
+用实时K线订阅驱动与回测相同的Strategy，不连接券商：订单在之后到达的K线上按回测引擎的撮合规则
+和交易成本模型成交
+Drives the same Strategy used in backtests off a live bar subscription,
+without a broker: orders fill on the bars that arrive afterwards through the
+backtest engine's fill rules and cost models
+
+每个K线时间的处理顺序与回测中的交易日相同：先在新K线上撮合之前下达的订单，再按收盘价估值，
+最后调用策略的on_bar()，ctx.history()看到截至当前K线的最近history根K线。所有订阅的标的都收到
+某个时间的K线，或任一标的收到更晚的K线时，该时间才被处理；之后才到达的该时间的K线、
+已处理时间的修订K线都被忽略。
+Each bar time goes through the steps of a backtest day: orders submitted
+earlier are tried on the new bars first, then the portfolio is marked at
+the closes and the strategy's on_bar() is called, with ctx.history() seeing
+the latest history bars up to the current one. A bar time is processed once
+every subscribed instrument has delivered it or any instrument delivers a
+later one; bars for that time arriving afterwards, and revisions of times
+already processed, are ignored.
+
+每个有成交、新订单或拒单的K线时间处理完后，组合、未成交订单、最近的K线、随机数状态和
+策略状态（见Snapshotter）写入state_path，重启时从中恢复，已经处理过的K线时间不会重复处理。
+ctx取消后订阅关闭，已缓冲的K线处理完后写入状态再返回。
+After each bar time with fills, new orders or rejections, the portfolio,
+working orders, recent bars, random state and strategy state (see
+Snapshotter) are written to state_path; a restart resumes from there and
+never processes a bar time twice. Once ctx is cancelled the subscription
+closes, and the buffered bars are processed and the state written before
+returning.
+
+每笔订单在成交或被拒绝时记入对账记录，对比下单时预期的数量和价格（限价单为限价，其他订单为
+下单时的收盘价）与实际的成交。时间比当前时钟晚超过max_clock_skew秒的K线视为时钟错误而丢弃。
+公司行为和退市结算不在模拟盘中处理。
+Every order is entered in the reconciliation log as it fills or is
+rejected, comparing the quantity and price expected when it was submitted
+(the limit for limit orders, the close at submission otherwise) with what
+was applied. Bars timed more than max_clock_skew seconds after the wall clock
+are dropped as clock errors. Corporate actions and delisting settlements
+are not handled in paper trading.
+
+Examples:
+    >>> ctx = RequestContext()
+    >>> subscription = manager.subscribe(ctx, codes, ["$open", "$close", "$volume"], "1min")
+    >>> config = PaperTraderConfig(engine=EngineConfig("", "", instruments=codes), state_path="paper.pkl")
+    >>> trader = PaperTrader(config, strategy)
+    >>> result = trader.run(subscription)  # ctx.cancel()后返回
+"""
+
+import json
+import math
+import os
+import pickle
+import random
+from dataclasses import dataclass, field, replace
+from pathlib import Path
+from typing import Any, Callable, Dict, List, Optional, Tuple, Union
+
+import pandas as pd
+
+from ..core.currency import get_currency
+from ..core.feature_frame import FeatureFrame
+from ..core.portfolio import Portfolio
+from ..infrastructure.logger_system import get_logger
+from ..infrastructure.subscription import DEFAULT_HISTORY, LiveBar, Subscription
+from ..utils.error_handler import BacktestError, ErrorInfo, ErrorCategory, ErrorSeverity
+from ..utils.random_streams import RandomStreams, derive_seed, new_seed
+from .backtest_engine import (
+    CLOSE_FIELD,
+    OPEN_FIELD,
+    VOLUME_FIELD,
+    VWAP_FIELD,
+    _EPSILON,
+    BacktestEngine,
+    BarContext,
+    EngineConfig,
+    ExecutionMode,
+    Fill,
+    OrderSide,
+    RejectedOrder,
+    Snapshotter,
+    Strategy,
+    StrategyCallback,
+    _CallbackStrategy,
+    _InstrumentData,
+    _WorkingOrder
+)
+
+
+# 状态文件格式的版本 / Version of the state file format
+PAPER_STATE_VERSION = 1
+
+
+@dataclass
+class PaperTraderConfig:
+    """
+    模拟盘配置 / Paper trader configuration
+    
+    Attributes:
+        engine: 撮合、交易成本、组合和标的池的配置，与回测相同；start_time、end_time、fields和data等
+            获取数据的字段不使用 / Fill, cost, portfolio and universe settings, as in a
+            backtest; the data fields such as start_time, end_time, fields and data are unused
+        state_path: 状态文件，存在时从中恢复 / State file, resumed from when it exists
+        reconciliation_path: 对账日志文件，每条记录一行JSON，追加写入；None表示只保存在结果中 /
+            Reconciliation log, one JSON record per line, appended to; None keeps it in the result only
+        max_clock_skew: K线时间最多比当前时钟晚的秒数 / Seconds a bar time may run ahead of the wall clock
+        history: 每个标的保留的最近K线数 / Recent bars kept per instrument
+    """
+    engine: EngineConfig
+    state_path: Union[str, Path]
+    reconciliation_path: Optional[Union[str, Path]] = None
+    max_clock_skew: float = 5.0
+    history: int = DEFAULT_HISTORY
+
+
+@dataclass(frozen=True)
+class Reconciliation:
+    """
+    订单的预期与实际成交的对账记录 / Reconciliation of an order's expected and applied fill
+    
+    Attributes:
+        time: 成交或被拒绝的K线时间 / Time of the bar the order filled or was rejected on
+        submitted: 下单的K线时间 / Time of the bar the order was submitted on
+        instrument: 标的代码 / Instrument code
+        side: 买卖方向 / Side
+        expected_quantity: 这根K线之前未成交的数量 / Quantity left unfilled before the bar
+        filled_quantity: 实际成交的数量 / Quantity applied
+        expected_price: 下单时预期的价格 / Price expected at submission
+        fill_price: 实际成交价，没有成交时为NaN / Price applied, NaN without a fill
+        reason: 未成交部分被拒绝或过期的原因 / Why the unfilled rest was rejected or expired
+    """
+    time: pd.Timestamp
+    submitted: pd.Timestamp
+    instrument: str
+    side: OrderSide
+    expected_quantity: float
+    filled_quantity: float
+    expected_price: float
+    fill_price: float = math.nan
+    reason: Optional[str] = None
+    
+    @property
+    def price_gap(self) -> float:
+        """成交价相对预期价格的涨跌幅，没有成交时为NaN / Fill price's move from the expected one, NaN without a fill"""
+        if not math.isfinite(self.fill_price) or self.expected_price <= 0:
+            return math.nan
+        return self.fill_price / self.expected_price - 1
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为可以写入JSON的字典 / Convert to a JSON-friendly dict"""
+        return {
+            "time": self.time.isoformat(),
+            "submitted": self.submitted.isoformat(),
+            "instrument": self.instrument,
+            "side": self.side.value,
+            "expected_quantity": self.expected_quantity,
+            "filled_quantity": self.filled_quantity,
+            "expected_price": self.expected_price,
+            "fill_price": None if math.isnan(self.fill_price) else self.fill_price,
+            "reason": self.reason,
+        }
+
+
+@dataclass
+class PaperTradingResult:
+    """
+    模拟盘结果 / Paper trading result
+    
+    Attributes:
+        portfolio: 最后的组合 / Final portfolio
+        trades: 成交记录，包括重启之前的成交 / Fills, including those before restarts
+        rejected_orders: 被拒绝或过期的订单 / Orders that were rejected or expired
+        reconciliation: 对账记录 / Reconciliation records
+        equity_curve: 每个K线时间处理完后的总权益 / Total equity after each bar time
+        last_time: 最后处理的K线时间 / Last bar time processed
+    """
+    portfolio: Portfolio
+    trades: List[Fill]
+    rejected_orders: List[RejectedOrder]
+    reconciliation: List[Reconciliation]
+    equity_curve: pd.Series
+    last_time: Optional[pd.Timestamp] = None
+    
+    def reconciliation_frame(self) -> pd.DataFrame:
+        """对账记录表，每条记录一行 / Reconciliation records, one row each"""
+        columns = [
+            "time", "submitted", "instrument", "side", "expected_quantity", "filled_quantity",
+            "expected_price", "fill_price", "price_gap", "reason"
+        ]
+        rows = [
+            [
+                r.time, r.submitted, r.instrument, r.side.value, r.expected_quantity, r.filled_quantity,
+                r.expected_price, r.fill_price, r.price_gap, r.reason
+            ]
+            for r in self.reconciliation
+        ]
+        return pd.DataFrame(rows, columns=columns)
+
+
+@dataclass
+class _Pending:
+    """未成交订单下单时的时间和预期价格 / Submission time and expected price of a working order"""
+    working: _WorkingOrder
+    submitted: pd.Timestamp
+    expected_price: float
+
+
+@dataclass
+class _PaperState:
+    """写入状态文件的模拟盘状态 / Paper trading state written to the state file"""
+    portfolio: Portfolio
+    seed: int
+    working: List[_WorkingOrder] = field(default_factory=list)
+    pending: List[_Pending] = field(default_factory=list)
+    trades: List[Fill] = field(default_factory=list)
+    rejected: List[RejectedOrder] = field(default_factory=list)
+    reconciliation: List[Reconciliation] = field(default_factory=list)
+    times: List[pd.Timestamp] = field(default_factory=list)
+    equity: List[float] = field(default_factory=list)
+    bars: Dict[str, List[Tuple[pd.Timestamp, Dict[str, float]]]] = field(default_factory=dict)
+    last_time: Optional[pd.Timestamp] = None
+    logged: int = 0  # 已写入对账日志的记录数
+    streams: Optional[RandomStreams] = None  # 策略的随机数流，旧状态文件中没有
+
+
+def _state_error(path: Union[str, Path], reason: str) -> BacktestError:
+    """状态文件无法读取 / The state file can't be read"""
+    return BacktestError(ErrorInfo(
+        error_code="BCK0013",
+        error_message_zh=f"无法从状态文件{path}恢复模拟盘: {reason}",
+        error_message_en=f"Can't resume paper trading from state file {path}: {reason}",
+        category=ErrorCategory.BACKTEST,
+        severity=ErrorSeverity.MEDIUM,
+        technical_details=f"path={path}",
+        suggested_actions=["确认状态文件由PaperTrader写入", "或删除状态文件重新开始"],
+        recoverable=True
+    ))
+
+
+class PaperTrader:
+    """
+    模拟盘 / Paper trader
+    
+    职责 / Responsibilities:
+    - 消费实时K线订阅，按K线时间调用策略 / Consume a live bar subscription and call the strategy per bar time
+    - 用回测引擎的撮合规则和交易成本模型在之后的K线上成交 / Fill on later bars through the backtest engine's fill rules and cost models
+    - 在每次成交后保存状态，重启后继续 / Save the state after every fill and carry on after a restart
+    - 记录预期与实际成交的对账记录 / Log the expected against the applied fills
+    """
+    
+    def __init__(
+        self,
+        config: PaperTraderConfig,
+        strategy: Union[Strategy, StrategyCallback],
+        clock: Callable[[], pd.Timestamp] = pd.Timestamp.now
+    ):
+        """
+        初始化模拟盘，state_path存在时从中恢复 / Initialize, resuming from state_path when it exists
+        
+        Args:
+            config: 模拟盘配置 / Paper trader configuration
+            strategy: 策略实例，或参数与Strategy.on_bar()相同的函数；实现Snapshotter时从状态文件恢复
+                策略状态 / Strategy instance, or a function with the arguments of
+                Strategy.on_bar(); restored from the state file when it implements Snapshotter
+            clock: 当前时间，与K线时间使用同一时区 / Current time, in the same timezone as the bar times
+        
+        Raises:
+            ValueError: max_clock_skew为负数或history不是正数时抛出，其余同BacktestEngine /
+                Raised for a negative max_clock_skew or a non-positive history; otherwise as BacktestEngine
+            BacktestError: 状态文件无法读取时抛出 / Raised when the state file can't be read
+        """
+        if not (config.max_clock_skew >= 0):
+            raise ValueError(f"max_clock_skew must be non-negative, got {config.max_clock_skew!r}")
+        if not isinstance(config.history, int) or config.history < 1:
+            raise ValueError(f"history must be a positive integer, got {config.history!r}")
+        engine = config.engine
+        self._config = config
+        # 模拟盘不获取数据，引擎只用于撮合
+        self._engine = BacktestEngine(
+            engine if engine.instruments is not None or engine.data is not None else replace(engine, data={})
+        )
+        self._mode = ExecutionMode(engine.execution_mode)
+        self._strategy = strategy if isinstance(strategy, Strategy) else _CallbackStrategy(strategy)
+        self._clock = clock
+        self._logger = get_logger(__name__)
+        
+        path = Path(config.state_path)
+        if path.exists():
+            self._state, self._rng = self._load(path)
+            self._logger.info(f"从状态文件{path}恢复模拟盘, 最后处理的K线时间: {self._state.last_time}")
+        else:
+            seed = engine.seed if engine.seed is not None else new_seed()
+            self._rng = random.Random(seed)
+            self._state = _PaperState(Portfolio(
+                engine.initial_cash, allow_short=engine.allow_short, cost_basis=engine.cost_basis,
+                rounding=engine.rounding, base_currency=engine.base_currency.upper()
+            ), seed)
+        if self._state.streams is None:
+            self._state.streams = RandomStreams(derive_seed(self._state.seed, "strategy"))
+        self._engine._run_costs = self._engine._costs.seeded(self._rng)
+    
+    @property
+    def portfolio(self) -> Portfolio:
+        """当前组合的副本 / Copy of the current portfolio"""
+        return self._state.portfolio.copy()
+    
+    @property
+    def last_time(self) -> Optional[pd.Timestamp]:
+        """最后处理的K线时间 / Last bar time processed"""
+        return self._state.last_time
+    
+    def run(self, subscription: Subscription) -> PaperTradingResult:
+        """
+        消费订阅直到其关闭 / Consume the subscription until it closes
+        
+        Args:
+            subscription: 实时K线订阅，字段中应有$close，NEXT_OPEN方式下还应有$open /
+                Live bar subscription whose fields hold $close, and $open in NEXT_OPEN mode
+        
+        Returns:
+            PaperTradingResult: 订阅关闭时的结果 / Result once the subscription closes
+        
+        Raises:
+            ValueError: 订阅缺少成交价字段，或外币标的没有汇率时抛出 /
+                Raised when the subscription lacks a price field or foreign-currency
+                instruments have no FX provider
+            BacktestError: 策略抛出异常时抛出，该K线时间不写入状态 /
+                Raised when the strategy raises; that bar time is not written to the state
+            Exception: 订阅的生产者出错结束时，写入状态后抛出该错误 /
+                The producer's error when the subscription stops on one, raised after the state is written
+        """
+        required = [CLOSE_FIELD] + ([OPEN_FIELD] if self._mode is ExecutionMode.NEXT_OPEN else [])
+        if self._mode is ExecutionMode.NEXT_VWAP:
+            required.append(VOLUME_FIELD)
+        missing = [name for name in required if name not in subscription.fields]
+        if missing:
+            raise ValueError(f"subscription lacks the fields {missing} for {self._mode.value} fills")
+        if self._mode is ExecutionMode.NEXT_VWAP and VWAP_FIELD not in subscription.fields:
+            self._logger.warning(f"订阅缺少{VWAP_FIELD}字段, NEXT_VWAP以典型价格近似成交均价")
+        engine = self._config.engine
+        base = engine.base_currency.upper()
+        foreign = sorted({get_currency(code) for code in subscription.instruments} - {base})
+        if foreign and engine.fx is None:
+            raise ValueError(f"instruments quoted in {', '.join(foreign)} need an FX provider to value in {base}")
+        
+        instruments = subscription.instruments
+        buffered: Dict[pd.Timestamp, Dict[str, LiveBar]] = {}
+        self._logger.info(f"开始模拟盘: {len(instruments)}个标的, 频率{subscription.freq}, 执行方式{self._mode.value}")
+        for bar in subscription:
+            if not self._accept(bar):
+                continue
+            buffered.setdefault(bar.time, {})[bar.instrument] = bar
+            for t in sorted(buffered):
+                if t >= bar.time and len(buffered[t]) < len(instruments):
+                    break
+                self._step(t, buffered.pop(t), subscription.fields, foreign)
+        # 订阅关闭后处理剩余的K线
+        for t in sorted(buffered):
+            self._step(t, buffered.pop(t), subscription.fields, foreign)
+        self._save()
+        
+        state = self._state
+        self._logger.info(f"模拟盘结束: {len(state.trades)}笔成交, 最后处理的K线时间: {state.last_time}")
+        if subscription.error is not None:
+            raise subscription.error
+        return PaperTradingResult(
+            portfolio=state.portfolio.copy(),
+            trades=list(state.trades),
+            rejected_orders=list(state.rejected),
+            reconciliation=list(state.reconciliation),
+            equity_curve=pd.Series(state.equity, index=pd.DatetimeIndex(state.times), name="equity", dtype=float),
+            last_time=state.last_time
+        )
+    
+    def _accept(self, bar: LiveBar) -> bool:
+        """K线是否需要处理 / Whether the bar is to be processed"""
+        last = self._state.last_time
+        if last is not None and bar.time <= last:
+            self._logger.debug(f"忽略已处理时间的K线: {bar.instrument} @ {bar.time}, revised={bar.revised}")
+            return False
+        skew = (bar.time - self._clock()).total_seconds()
+        if skew > self._config.max_clock_skew:
+            self._logger.warning(
+                f"丢弃标的{bar.instrument}的K线 {bar.time}: 比当前时钟晚{skew:.1f}秒，"
+                f"超过允许的{self._config.max_clock_skew:g}秒"
+            )
+            return False
+        return True
+    
+    def _step(self, t: pd.Timestamp, bars: Dict[str, LiveBar], fields: List[str], foreign: List[str]) -> None:
+        """处理一个K线时间 / Process one bar time"""
+        state = self._state
+        engine = self._engine
+        config = self._config.engine
+        portfolio = state.portfolio
+        for code, bar in bars.items():
+            history = state.bars.setdefault(code, [])
+            history.append((bar.time, dict(bar.fields)))
+            del history[:-self._config.history]
+        data = {
+            code: _InstrumentData(FeatureFrame(
+                [[values.get(name, math.nan) for name in fields] for _, values in rows],
+                index=pd.DatetimeIndex([time for time, _ in rows]),
+                columns=fields,
+                dtype=float
+            ))
+            for code, rows in state.bars.items()
+        }
+        if foreign:
+            base = config.base_currency.upper()
+            portfolio.set_fx_rates({c: config.fx.rate(c, base, t) for c in foreign})
+        
+        done = (len(state.trades), len(state.rejected))
+        if self._mode is not ExecutionMode.SAME_CLOSE:
+            self._fill(t, data)
+        
+        closes = {}
+        halted = []
+        for code, item in data.items():
+            row = item.row_at(t)
+            if row is not None and item.suspended(row):
+                halted.append(code)
+            elif row is not None and item.closes is not None:
+                closes[code] = float(item.closes[row])
+        portfolio.mark_to_market(closes, illiquid=halted)
+        
+        members = None
+        if engine._universe is not None:
+            members = [code for code in engine._universe.members(t) if code in data]
+        ctx = BarContext(t, data, members, guard=config.lookahead_guard, streams=state.streams)
+        strategy = self._strategy
+        orders = engine._call_strategy(strategy, t, strategy.on_bar, ctx, portfolio.copy(), ctx.bars())
+        submitted = len(state.working)
+        rejected = len(state.rejected)
+        engine._submit(orders, t, portfolio, state)
+        for item in state.working[submitted:]:
+            order = item.order
+            expected = order.limit_price if order.is_limit else closes.get(order.instrument, math.nan)
+            state.pending.append(_Pending(item, t, float(expected)))
+        for record in state.rejected[rejected:]:
+            # 下单时按取整规则被拒绝的订单
+            state.reconciliation.append(Reconciliation(
+                t, t, record.order.instrument, record.order.side, record.order.quantity, 0.0,
+                closes.get(record.order.instrument, math.nan), reason=record.reason
+            ))
+        
+        if self._mode is ExecutionMode.SAME_CLOSE:
+            self._fill(t, data)
+        
+        state.times.append(t)
+        state.equity.append(portfolio.equity)
+        state.last_time = t
+        if (len(state.trades), len(state.rejected)) != done or len(state.working) > submitted:
+            self._save()
+    
+    def _fill(self, t: pd.Timestamp, data: Dict[str, _InstrumentData]) -> None:
+        """在K线上撮合未成交订单并记录对账 / Fill working orders on the bar and reconcile them"""
+        state = self._state
+        tracked = [(pending, pending.working.remaining) for pending in state.pending]
+        trades, rejected = len(state.trades), len(state.rejected)
+        state.working = self._engine._work(
+            state.working, t, data, state.portfolio, state.trades, state.rejected
+        )
+        # 每笔订单在一根K线上至多成交一次，成交和拒单都按订单顺序追加
+        fills = iter(state.trades[trades:])
+        rejections = iter(state.rejected[rejected:])
+        still = {id(item) for item in state.working}
+        kept = []
+        for pending, before in tracked:
+            item = pending.working
+            filled = before - item.remaining
+            fill = next(fills) if filled > _EPSILON else None
+            reason = None
+            if id(item) not in still and item.remaining > _EPSILON:
+                reason = next(rejections).reason
+            if fill is not None or reason is not None:
+                state.reconciliation.append(Reconciliation(
+                    t, pending.submitted, item.order.instrument, item.order.side, before,
+                    fill.quantity if fill is not None else 0.0, pending.expected_price,
+                    fill.price if fill is not None else math.nan, reason
+                ))
+            if id(item) in still:
+                kept.append(pending)
+        state.pending = kept
+    
+    def _save(self) -> None:
+        """
+        追加新的对账记录并写入状态文件，先写临时文件再替换 /
+        Append the new reconciliation records and write the state file through a temporary file
+        """
+        state = self._state
+        log = self._config.reconciliation_path
+        if log is not None and state.logged < len(state.reconciliation):
+            Path(log).parent.mkdir(parents=True, exist_ok=True)
+            with open(log, "a", encoding="utf-8") as f:
+                for record in state.reconciliation[state.logged:]:
+                    f.write(json.dumps(record.to_dict(), ensure_ascii=False) + "\n")
+            state.logged = len(state.reconciliation)
+        
+        path = Path(self._config.state_path)
+        snapshot = {
+            "version": PAPER_STATE_VERSION,
+            "state": state,
+            "rng": self._rng.getstate(),
+            "strategy": self._strategy.snapshot() if isinstance(self._strategy, Snapshotter) else None,
+        }
+        path.parent.mkdir(parents=True, exist_ok=True)
+        temp = path.with_name(path.name + ".tmp")
+        with open(temp, "wb") as f:
+            pickle.dump(snapshot, f, protocol=pickle.HIGHEST_PROTOCOL)
+        os.replace(temp, path)
+        self._logger.debug(f"已写入模拟盘状态: {path}, 最后处理的K线时间: {state.last_time}")
+    
+    def _load(self, path: Path) -> Tuple[_PaperState, random.Random]:
+        """从状态文件恢复模拟盘、随机数和策略的状态 / Restore the paper, random and strategy state from the state file"""
+        try:
+            with open(path, "rb") as f:
+                snapshot = pickle.load(f)
+        except (OSError, EOFError, pickle.UnpicklingError) as e:
+            raise _state_error(path, str(e)) from e
+        if not isinstance(snapshot, dict) or snapshot.get("version") != PAPER_STATE_VERSION:
+            raise _state_error(path, f"not a version {PAPER_STATE_VERSION} state file")
+        if snapshot["strategy"] is not None:
+            if not isinstance(self._strategy, Snapshotter):
+                raise _state_error(path, f"{type(self._strategy).__name__} doesn't implement Snapshotter")
+            self._strategy.restore(snapshot["strategy"])
+        rng = random.Random()
+        rng.setstate(snapshot["rng"])
+        return snapshot["state"], rng
@@ -5,6 +5,12 @@ Performance Analyzer for the qlib trading system.
 This module provides functionality to analyze historical performance of assets
 and generate recommendations based on multiple metrics.
 本模块提供分析资产历史表现并基于多个指标生成推荐的功能。
+
+年化收益、波动率和最大回撤委托给src.core.metrics计算；需要在收益率或权益序列上
+直接计算指标的新代码请使用src.core.metrics。
+Annualized return, volatility and max drawdown are delegated to
+src.core.metrics; new code that computes metrics on return or equity series
+should use src.core.metrics directly.
 """
 
 import pandas as pd
@@ -13,6 +19,7 @@ from typing import List, Dict, Optional, Tuple
 from datetime import datetime, timedelta
 from pathlib import Path
 
+from ..core import metrics as perf
 from ..models.market_models import (
     AssetMetrics, AssetRecommendation, PerformanceReport
 )
@@ -370,25 +377,22 @@ class PerformanceAnalyzer:
             
             # Annualized return
             # 年化收益率
-            trading_days = len(returns)
-            years = trading_days / 252  # Assuming 252 trading days per year
-            annual_return = (1 + total_return) ** (1 / years) - 1 if years > 0 else 0
+            annual_return = perf.annualized_return(returns)
             
             # Volatility (annualized)
             # 波动率（年化）
-            volatility = returns.std() * np.sqrt(252)
+            volatility = perf.annualized_vol(returns)
             
-            # Sharpe ratio
-            # 夏普比率
+            # Sharpe ratio: annual excess return over annual volatility
+            # 夏普比率：年化超额收益与年化波动率之比
             excess_return = annual_return - self.risk_free_rate
             sharpe_ratio = excess_return / volatility if volatility > 0 else 0
             
             # Maximum drawdown
             # 最大回撤
-            cumulative = (1 + returns).cumprod()
-            running_max = cumulative.expanding().max()
-            drawdown = (cumulative - running_max) / running_max
-            max_drawdown = drawdown.min()
+            # Reported as a negative fraction, e.g. -0.15 for 15%
+            # 以负数表示，如-0.15表示15%
+            max_drawdown = -perf.max_drawdown(returns).magnitude
             
             # Win rate
             # 胜率
@@ -0,0 +1,464 @@
+"""
+定期调仓模块 / Rebalancing Module
+按调仓计划把组合调整到目标权重
+Moves the portfolio to target weights on a rebalance schedule
+
+调仓计划基于交易日历：每月第一个或最后一个交易日、每季度最后一个交易日、每周固定的星期、每月固定的
+日期、每N个交易日或给定的日期列表。按名义日期定义的计划（MonthStart、Weekly、CalendarDays、
+DateList）在名义日期休市时顺延到之后的第一个交易日，因此元旦休市时MonthStart在1月的第一个交易日
+调仓。调仓日收盘后按当日收盘价把目标权重换算为整手的目标持仓，先卖后买；成交额低于下限的零碎
+交易被跳过，单次调仓的换手率可以设置上限。
+Schedules are resolved against a trading calendar: the first or last
+trading day of each month, the last of each quarter, a weekday every week,
+fixed days of the month, every N trading days, or a list of dates.
+Schedules defined by nominal dates (MonthStart, Weekly, CalendarDays,
+DateList) roll a nominal date that isn't a trading day forward to the next
+one, so MonthStart fires on January's first trading day when New Year's Day
+is a holiday. After the close of a rebalance day the target weights are
+turned into whole-lot target positions at that day's closes, sells going
+before buys; dust trades below a minimum value are skipped and the turnover
+of one rebalance can be capped.
+
+Examples:
+    >>> strategy = TargetWeightStrategy(
+    ...     lambda ctx: {"SH600000": 0.5, "SZ000001": 0.5},
+    ...     MonthEnd(),
+    ...     min_trade_value=1000.0,
+    ...     max_turnover=0.5
+    ... )
+    >>> result = run(EngineConfig(start_time="2024-01-01", end_time="2024-12-31", instruments=codes), strategy)
+"""
+
+import math
+from abc import ABC, abstractmethod
+from enum import Enum
+from typing import Callable, Dict, Iterable, List, Mapping, Optional, Union
+
+import pandas as pd
+
+from ..core.feature_frame import Bar
+from ..core.portfolio import Portfolio
+from ..core.trading_calendar import _WEEKDAYS, TimeLike, TradingCalendar, get_calendar
+from .backtest_engine import CLOSE_FIELD, BarContext, Order, OrderSide, Strategy
+
+
+# A股一手的股数 / Shares per board lot on A-share markets
+A_SHARE_LOT = 100
+
+# 目标权重之和与1的允许误差 / Tolerance on the target weights summing to 1
+WEIGHT_TOLERANCE = 1e-6
+
+_EPSILON = 1e-9
+
+WeightFunction = Callable[[BarContext], Mapping[str, float]]
+
+
+class WeightPolicy(Enum):
+    """目标权重之和不为1时的处理方式 / What to do when target weights don't sum to 1"""
+    NORMALIZE = "normalize"  # 按比例缩放到合计为1
+    REJECT = "reject"  # 抛出ValueError
+
+
+class RebalanceSchedule(ABC):
+    """
+    调仓计划 / Rebalance schedule
+    
+    按交易日历判断某个交易日是否调仓
+    Tells, against a trading calendar, whether a trading day is a rebalance day
+    """
+    
+    @abstractmethod
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        """
+        判断某日是否调仓 / Whether a day is a rebalance day
+        
+        Args:
+            day: 日期 / Date
+            calendar: 交易日历 / Trading calendar
+            start: 计划开始的日期，即回测的第一个交易日 / Start of the schedule, the backtest's first day
+        
+        Returns:
+            bool: 调仓日返回True，非交易日总是False / True on a rebalance day, always False off the calendar
+        """
+    
+    def dates(self, start: TimeLike, end: TimeLike, calendar: TradingCalendar) -> List[pd.Timestamp]:
+        """
+        列出区间内的调仓日 / List the rebalance days in a range
+        
+        Args:
+            start: 开始日期（包含），也是计划的开始 / Start date (inclusive), also where the schedule starts
+            end: 结束日期（包含） / End date (inclusive)
+            calendar: 交易日历 / Trading calendar
+        
+        Returns:
+            List[pd.Timestamp]: 升序排列的调仓日 / Rebalance days in ascending order
+        """
+        days = calendar.between(start, end)
+        if not days:
+            return []
+        return [day for day in days if self.is_due(day, calendar, days[0])]
+
+
+class MonthEnd(RebalanceSchedule):
+    """每月最后一个交易日 / Last trading day of every month"""
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day):
+            return False
+        following = calendar.next(day)
+        return (following.year, following.month) != (day.year, day.month)
+    
+    def __repr__(self) -> str:
+        return "MonthEnd()"
+
+
+class MonthStart(RebalanceSchedule):
+    """每月第一个交易日，1日休市时顺延 / First trading day of every month, rolling past a holiday on the 1st"""
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day):
+            return False
+        previous = calendar.prev(day)
+        return (previous.year, previous.month) != (day.year, day.month)
+    
+    def __repr__(self) -> str:
+        return "MonthStart()"
+
+
+class QuarterEnd(RebalanceSchedule):
+    """每季度最后一个交易日 / Last trading day of every quarter"""
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day):
+            return False
+        following = calendar.next(day)
+        return (following.year, following.quarter) != (day.year, day.quarter)
+    
+    def __repr__(self) -> str:
+        return "QuarterEnd()"
+
+
+class Weekly(RebalanceSchedule):
+    """
+    每周固定的星期 / A fixed weekday every week
+    
+    该日休市时顺延到之后的第一个交易日
+    When that day is closed the schedule rolls forward to the next trading day
+    """
+    
+    def __init__(self, weekday: Union[int, str] = 0):
+        """
+        Args:
+            weekday: 星期，0为周一，也可以是"Monday"等名称 / Weekday, 0 for Monday, or a name such as "Monday"
+        """
+        if isinstance(weekday, str):
+            names = [name.lower() for name in _WEEKDAYS]
+            if weekday.lower() not in names:
+                raise ValueError(f"unknown weekday: {weekday!r}, expected one of {', '.join(_WEEKDAYS)}")
+            weekday = names.index(weekday.lower())
+        if not isinstance(weekday, int) or isinstance(weekday, bool) or not 0 <= weekday <= 6:
+            raise ValueError(f"weekday must be between 0 (Monday) and 6 (Sunday), got {weekday!r}")
+        self.weekday = weekday
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day):
+            return False
+        return any(d.weekday() == self.weekday for d in _rolled_into(day, calendar))
+    
+    def __repr__(self) -> str:
+        return f"Weekly({_WEEKDAYS[self.weekday]!r})"
+
+
+class CalendarDays(RebalanceSchedule):
+    """
+    每月固定的日期 / Fixed days of every month
+    
+    该日休市时顺延到之后的第一个交易日；超过当月天数的日期（如2月的30日）按当月最后一天处理
+    A closed day rolls forward to the next trading day; a day past the end
+    of a month (say the 30th in February) counts as the month's last day
+    """
+    
+    def __init__(self, *days: int):
+        """
+        Args:
+            days: 每月的日期，1至31 / Days of the month, 1 to 31
+        """
+        if not days:
+            raise ValueError("at least one day of the month is required")
+        for d in days:
+            if not isinstance(d, int) or isinstance(d, bool) or not 1 <= d <= 31:
+                raise ValueError(f"days of the month must be integers between 1 and 31, got {d!r}")
+        self.days = sorted(set(days))
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day):
+            return False
+        for d in _rolled_into(day, calendar):
+            if d.day in self.days or (d.is_month_end and self.days[-1] > d.day):
+                return True
+        return False
+    
+    def __repr__(self) -> str:
+        return f"CalendarDays({', '.join(str(d) for d in self.days)})"
+
+
+class EveryNDays(RebalanceSchedule):
+    """从计划开始起每N个交易日，开始当日即调仓 / Every N trading days from the start, the start included"""
+    
+    def __init__(self, n: int):
+        """
+        Args:
+            n: 调仓间隔的交易日数 / Trading days between rebalances
+        """
+        if not isinstance(n, int) or isinstance(n, bool) or n < 1:
+            raise ValueError(f"n must be a positive integer, got {n!r}")
+        self.n = n
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        if not calendar.is_trading_day(day) or day < start:
+            return False
+        return (len(calendar.between(start, day)) - 1) % self.n == 0
+    
+    def __repr__(self) -> str:
+        return f"EveryNDays({self.n})"
+
+
+class DateList(RebalanceSchedule):
+    """
+    给定的调仓日期 / Explicit rebalance dates
+    
+    非交易日顺延到之后的第一个交易日
+    A date that isn't a trading day rolls forward to the next one
+    """
+    
+    def __init__(self, dates: Iterable[TimeLike]):
+        """
+        Args:
+            dates: 调仓日期 / Rebalance dates
+        """
+        self._dates = sorted({pd.Timestamp(d).normalize() for d in dates})
+        self._resolved: Dict[str, frozenset] = {}
+    
+    @property
+    def requested(self) -> List[pd.Timestamp]:
+        """顺延之前的日期 / The dates before rolling"""
+        return list(self._dates)
+    
+    def is_due(self, day: pd.Timestamp, calendar: TradingCalendar, start: pd.Timestamp) -> bool:
+        resolved = self._resolved.get(calendar.market)
+        if resolved is None:
+            resolved = frozenset(d if calendar.is_trading_day(d) else calendar.next(d) for d in self._dates)
+            self._resolved[calendar.market] = resolved
+        return pd.Timestamp(day).normalize() in resolved
+    
+    def __repr__(self) -> str:
+        return f"DateList({len(self._dates)} dates)"
+
+
+def _rolled_into(day: pd.Timestamp, calendar: TradingCalendar) -> pd.DatetimeIndex:
+    """顺延到交易日day的自然日，即上一个交易日之后到day为止 / Calendar days rolling into day, from after the previous trading day to day"""
+    return pd.date_range(calendar.prev(day) + pd.Timedelta(days=1), pd.Timestamp(day).normalize(), freq="D")
+
+
+def normalize_weights(
+    weights: Mapping[str, float],
+    policy: Union[str, WeightPolicy] = WeightPolicy.NORMALIZE
+) -> Dict[str, float]:
+    """
+    检查并按需缩放目标权重 / Check target weights and scale them as configured
+    
+    空的权重表示全部持有现金
+    Empty weights mean holding only cash
+    
+    Args:
+        weights: 标的代码到目标权重的映射，权重为0的标的被清仓 /
+            Instrument code to target weight; a zero weight closes the position
+        policy: 权重之和不为1时的处理方式 / What to do when the weights don't sum to 1
+    
+    Returns:
+        Dict[str, float]: 合计为1的权重，权重为0的标的被去掉 / Weights summing to 1, zero weights dropped
+    
+    Raises:
+        ValueError: 权重为负数或非有限值，或REJECT时合计不为1时抛出 /
+            Raised for negative or non-finite weights, or under REJECT when they don't sum to 1
+    """
+    policy = WeightPolicy(policy)
+    for code, weight in weights.items():
+        if not math.isfinite(weight) or weight < 0:
+            raise ValueError(f"target weight of {code} must be a non-negative number, got {weight!r}")
+    kept = {code: float(weight) for code, weight in weights.items() if weight > 0}
+    if not kept:
+        return {}
+    total = sum(kept.values())
+    if abs(total - 1.0) <= WEIGHT_TOLERANCE:
+        return kept
+    if policy is WeightPolicy.REJECT:
+        raise ValueError(f"target weights must sum to 1, got {total:g}")
+    return {code: weight / total for code, weight in kept.items()}
+
+
+def target_orders(
+    portfolio: Portfolio,
+    weights: Mapping[str, float],
+    prices: Mapping[str, float],
+    lot_size: int = A_SHARE_LOT,
+    min_trade_value: float = 0.0,
+    max_turnover: Optional[float] = None
+) -> List[Order]:
+    """
+    生成把组合调整到目标权重的订单 / Build the orders moving a portfolio to target weights
+    
+    目标持仓为权重乘以组合权益再按价格向下取整到整手。持有但不在weights中的标的被清仓，
+    清仓的卖单不受最小成交额限制，可以卖出零股。换手率为买卖成交额合计除以权益，超过
+    上限时所有交易按比例缩小后重新取整手。没有价格的标的不交易。
+    A target position is the weight times the portfolio's equity, converted at
+    the price and rounded down to whole lots. Instruments held but missing
+    from weights are sold off; those sells ignore the minimum trade value and
+    may include odd lots. Turnover is the value bought plus sold over the
+    equity; beyond the cap every trade shrinks in proportion and is rounded
+    to whole lots again. Instruments without a price aren't traded.
+    
+    Args:
+        portfolio: 当前组合 / Current portfolio
+        weights: 标的代码到目标权重的映射 / Instrument code to target weight
+        prices: 标的代码到计算目标持仓使用的价格的映射 / Instrument code to the price used for sizing
+        lot_size: 每手股数 / Shares per lot
+        min_trade_value: 低于该成交额的交易被跳过 / Trades worth less than this are skipped
+        max_turnover: 换手率上限，None表示不限制 / Turnover cap, None for no cap
+    
+    Returns:
+        List[Order]: 先卖后买的市价单 / Market orders, sells before buys
+    """
+    if lot_size < 1:
+        raise ValueError(f"lot_size must be positive, got {lot_size}")
+    if min_trade_value < 0:
+        raise ValueError(f"min_trade_value must be non-negative, got {min_trade_value}")
+    if max_turnover is not None and not max_turnover > 0:
+        raise ValueError(f"max_turnover must be positive, got {max_turnover!r}")
+    
+    equity = portfolio.equity
+    held = portfolio.positions
+    trades: Dict[str, float] = {}
+    for code in sorted(set(weights) | set(held)):
+        price = prices.get(code)
+        if price is None or not math.isfinite(price) or price <= 0:
+            continue
+        target = _round_lots(weights.get(code, 0.0) * equity / price, lot_size)
+        delta = target - held.get(code, 0.0)
+        if abs(delta) > _EPSILON:
+            trades[code] = delta
+    
+    if max_turnover is not None and equity > 0:
+        turnover = sum(abs(delta) * prices[code] for code, delta in trades.items()) / equity
+        if turnover > max_turnover:
+            scale = max_turnover / turnover
+            trades = {code: _round_lots(delta * scale, lot_size) for code, delta in trades.items()}
+    
+    sells, buys = [], []
+    for code, delta in trades.items():
+        if abs(delta) <= _EPSILON:
+            continue
+        closing = abs(held.get(code, 0.0) + delta) <= _EPSILON
+        if abs(delta) * prices[code] < min_trade_value and not closing:
+            continue
+        if delta < 0:
+            sells.append(Order(code, OrderSide.SELL, -delta))
+        else:
+            buys.append(Order(code, OrderSide.BUY, delta))
+    return sells + buys
+
+
+def _round_lots(quantity: float, lot_size: int) -> float:
+    """向零取整到整手 / Round towards zero to whole lots"""
+    lots = math.floor(abs(quantity) / lot_size + _EPSILON)
+    return math.copysign(lots * lot_size, quantity) if lots else 0.0
+
+
+class TargetWeightStrategy(Strategy):
+    """
+    按计划调仓到目标权重的策略 / Strategy rebalancing to target weights on a schedule
+    
+    调仓日调用weights得到目标权重，按当日收盘价用target_orders()生成订单；其他交易日不下单
+    On a rebalance day weights gives the target weights and target_orders()
+    builds the orders at that day's closes; no orders on other days
+    """
+    
+    def __init__(
+        self,
+        weights: WeightFunction,
+        schedule: Union[RebalanceSchedule, Iterable[TimeLike]],
+        calendar: Optional[Union[str, TradingCalendar]] = "SSE",
+        lot_size: int = A_SHARE_LOT,
+        min_trade_value: float = 0.0,
+        max_turnover: Optional[float] = None,
+        weight_policy: Union[str, WeightPolicy] = WeightPolicy.NORMALIZE
+    ):
+        """
+        初始化策略 / Initialize strategy
+        
+        Args:
+            weights: 给定行情上下文、返回标的代码到目标权重映射的函数 /
+                Function from the bar context to a mapping of instrument code to target weight
+            schedule: 调仓计划，日期列表按DateList处理 / Rebalance schedule; a list of dates becomes a DateList
+            calendar: 解析调仓计划的交易日历或市场名称，None表示使用回测的交易日历 /
+                Trading calendar or market name resolving the schedule, None for the backtest's calendar
+            lot_size: 每手股数 / Shares per lot
+            min_trade_value: 低于该成交额的交易被跳过 / Trades worth less than this are skipped
+            max_turnover: 单次调仓的换手率上限，None表示不限制 / Turnover cap of one rebalance, None for no cap
+            weight_policy: 目标权重之和不为1时的处理方式 / What to do when the weights don't sum to 1
+        """
+        if lot_size < 1:
+            raise ValueError(f"lot_size must be positive, got {lot_size}")
+        if min_trade_value < 0:
+            raise ValueError(f"min_trade_value must be non-negative, got {min_trade_value}")
+        if max_turnover is not None and not max_turnover > 0:
+            raise ValueError(f"max_turnover must be positive, got {max_turnover!r}")
+        self._weights = weights
+        self._schedule = schedule if isinstance(schedule, RebalanceSchedule) else DateList(schedule)
+        self._calendar = get_calendar(calendar) if isinstance(calendar, str) else calendar
+        self._lot_size = lot_size
+        self._min_trade_value = min_trade_value
+        self._max_turnover = max_turnover
+        self._policy = WeightPolicy(weight_policy)
+        self._start: Optional[pd.Timestamp] = None
+        self._rebalances: List[pd.Timestamp] = []
+    
+    @property
+    def schedule(self) -> RebalanceSchedule:
+        """调仓计划 / Rebalance schedule"""
+        return self._schedule
+    
+    @property
+    def rebalance_dates(self) -> List[pd.Timestamp]:
+        """已经调仓的交易日 / Days rebalanced so far"""
+        return list(self._rebalances)
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        day = ctx.time.normalize()
+        if self._start is None:
+            self._start = day
+        calendar = self._calendar or ctx.calendar
+        if calendar is None:
+            raise ValueError("rebalance schedules need a trading calendar; pass calendar or set EngineConfig.calendar")
+        if not self._schedule.is_due(day, calendar, self._start):
+            return None
+        
+        weights = normalize_weights(self._weights(ctx), self._policy)
+        prices = {}
+        for code in set(weights) | set(portfolio.positions):
+            # 已被剔除出标的池的持仓不在bars中，仍按当日收盘价卖出
+            bar = bars.get(code) or ctx.bar(code)
+            if bar is not None and bar.get(CLOSE_FIELD) is not None:
+                prices[code] = float(bar[CLOSE_FIELD])
+        self._rebalances.append(day)
+        return target_orders(
+            portfolio, weights, prices,
+            lot_size=self._lot_size,
+            min_trade_value=self._min_trade_value,
+            max_turnover=self._max_turnover
+        )
@@ -2,6 +2,12 @@
 报告生成器模块 / Report Generator Module
 负责生成各种类型的报告，包括训练报告、回测报告和HTML报告
 Responsible for generating various types of reports including training reports, backtest reports, and HTML reports
+
+BacktestEngine的结果请使用src.application.engine_report（EngineResult.write_html()）生成
+HTML报告，本模块的回测报告和HTML报告仅为BacktestResult的旧调用方保留。
+For BacktestEngine results use src.application.engine_report
+(EngineResult.write_html()) for the HTML report; the backtest and HTML
+reports here are kept only for existing BacktestResult callers.
 """
 
 import pandas as pd
@@ -553,6 +559,9 @@ class ReportGenerator:
         """
         生成HTML报告 / Generate HTML Report
         
+        已弃用，BacktestEngine的结果请使用src.application.engine_report.write_html()
+        Deprecated; use src.application.engine_report.write_html() for BacktestEngine results
+        
         Args:
             result: 回测结果 / Backtest result
             output_path: 输出路径 / Output path
@@ -0,0 +1,406 @@
+"""
+仓位管理模块 / Position Sizing Module
+把目标信号和组合状态换算为下单数量，代替在on_bar中写死股数
+Turns a target signal plus the portfolio state into an order quantity,
+instead of hard-coding share counts in on_bar
+
+信号为正表示做多，为负表示做空，为0表示空仓；FixedFraction和VolatilityTarget按信号的大小
+缩放仓位，FixedShares只看方向。目标持仓向零取整到整手，下单数量为目标持仓减去当前持仓。
+买入所需的现金（含cost_model估算的费用）超过可用现金时，数量缩小到买得起的整手数，
+而不是交给引擎拒绝整笔订单。
+A positive signal means long, a negative one short and 0 flat; FixedFraction
+and VolatilityTarget scale the position by the signal's size, FixedShares
+only looks at its sign. Target positions are rounded towards zero to whole
+lots, and the order quantity is the target less the current position. When a
+buy needs more cash than is available (fees estimated by cost_model
+included), the quantity shrinks to the whole lots that are affordable
+instead of leaving the engine to reject the whole order.
+
+Examples:
+    >>> sizer = VolatilityTarget(0.15, lookback=20)
+    >>> strategy = SignalStrategy(lambda ctx: {"SH600000": 1.0}, sizer, cost_model=AShareCostModel())
+    >>> result = run(EngineConfig(start_time="2024-01-01", end_time="2024-12-31", instruments=codes), strategy)
+"""
+
+import math
+from abc import ABC, abstractmethod
+from typing import Callable, Dict, Iterable, List, Mapping, Optional, Sequence
+
+import pandas as pd
+
+from ..core.feature_frame import Bar
+from ..core.futures import get_futures_spec
+from ..core.metrics import FreqLike, annualized_vol, price_returns
+from ..core.portfolio import Portfolio
+from .backtest_engine import CLOSE_FIELD, BarContext, CostModel, Order, OrderSide, Strategy
+from .rebalance import A_SHARE_LOT
+
+
+_EPSILON = 1e-9
+
+SignalFunction = Callable[[BarContext], Mapping[str, float]]
+
+
+class PositionSizer(ABC):
+    """
+    仓位管理规则 / Position sizing rule
+    
+    子类实现target()给出目标持仓；quantity()和order()负责取整手、计算与当前持仓的差额和
+    现金约束
+    Subclasses implement target() to give the target position; quantity() and
+    order() handle the lot rounding, the difference to the current position and
+    the cash constraint
+    
+    Attributes:
+        needs_returns: target()是否需要收益率历史 / Whether target() reads the return history
+    """
+    
+    needs_returns = False
+    
+    def __init__(self, lot_size: int = A_SHARE_LOT):
+        """
+        Args:
+            lot_size: 每手股数 / Shares per lot
+        """
+        if not isinstance(lot_size, int) or isinstance(lot_size, bool) or lot_size < 1:
+            raise ValueError(f"lot_size must be a positive integer, got {lot_size!r}")
+        self.lot_size = lot_size
+    
+    @abstractmethod
+    def target(
+        self,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None
+    ) -> Optional[float]:
+        """
+        计算目标持仓 / Compute the target position
+        
+        Args:
+            signal: 目标信号，正为多头、负为空头、0为空仓 / Target signal: positive long, negative short, 0 flat
+            portfolio: 当前组合 / Current portfolio
+            price: 估算仓位使用的价格 / Price used for sizing
+            returns: 标的的逐期收益率历史，按时间升序 / The instrument's per-period returns, oldest first
+        
+        Returns:
+            Optional[float]: 取整手之前的目标持仓（空头为负数），数据不足无法计算时为None /
+                Target position before lot rounding (negative for shorts); None when the data is too short
+        """
+    
+    def quantity(
+        self,
+        instrument: str,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None,
+        cost_model: Optional[CostModel] = None,
+        cash: Optional[float] = None
+    ) -> float:
+        """
+        计算下单数量 / Compute the order quantity
+        
+        买入超过可用现金时缩小到买得起的整手数。费用按price估算，实际成交价不同时（如次日开盘价
+        加滑点）买单仍可能被拒绝。期货按保证金交易，不做现金检查。
+        A buy beyond the available cash shrinks to the whole lots that are
+        affordable. Fees are estimated at price, so a buy can still be rejected
+        when the actual fill price differs (such as the next open plus
+        slippage). Futures trade on margin and skip the cash check.
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            signal: 目标信号 / Target signal
+            portfolio: 当前组合 / Current portfolio
+            price: 估算仓位使用的价格 / Price used for sizing
+            returns: 标的的逐期收益率历史 / The instrument's per-period returns
+            cost_model: 估算买入费用的成本模型，None表示不计费用 / Cost model estimating buy fees, None for none
+            cash: 可用现金，None表示组合的现金 / Available cash, None for the portfolio's cash
+        
+        Returns:
+            float: 带符号的下单数量，正为买入、负为卖出、0为不交易 /
+                Signed order quantity: positive buys, negative sells, 0 no trade
+        
+        Raises:
+            ValueError: 信号不是有限数或价格不是正数时抛出 /
+                Raised for a non-finite signal or a non-positive price
+        """
+        if not math.isfinite(signal):
+            raise ValueError(f"signal of {instrument} must be finite, got {signal!r}")
+        if not (math.isfinite(price) and price > 0):
+            raise ValueError(f"price of {instrument} must be a positive number, got {price!r}")
+        target = self.target(signal, portfolio, price, returns)
+        if target is None:
+            return 0.0
+        delta = _round_lots(target, self.lot_size) - portfolio.position(instrument)
+        if abs(delta) <= _EPSILON:
+            return 0.0
+        if delta < 0 or get_futures_spec(instrument) is not None:
+            return delta
+        available = portfolio.cash if cash is None else cash
+        return self._affordable(instrument, delta, price, available, cost_model)
+    
+    def order(
+        self,
+        instrument: str,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None,
+        cost_model: Optional[CostModel] = None,
+        cash: Optional[float] = None
+    ) -> Optional[Order]:
+        """
+        生成调整到目标持仓的市价单 / Build the market order moving to the target position
+        
+        参数与quantity()相同 / Takes the same arguments as quantity()
+        
+        Returns:
+            Optional[Order]: 市价单，不需要交易时为None / Market order, None when no trade is needed
+        """
+        delta = self.quantity(instrument, signal, portfolio, price, returns, cost_model, cash)
+        if abs(delta) <= _EPSILON:
+            return None
+        return Order(instrument, OrderSide.BUY if delta > 0 else OrderSide.SELL, abs(delta))
+    
+    def _affordable(
+        self,
+        instrument: str,
+        quantity: float,
+        price: float,
+        cash: float,
+        cost_model: Optional[CostModel]
+    ) -> float:
+        """把买入数量缩小到现金足以支付的整手数 / Shrink a buy to the whole lots the cash can pay for"""
+        def cost(q: float) -> float:
+            if cost_model is None:
+                return q * price
+            order = Order(instrument, OrderSide.BUY, q)
+            return q * price + float(cost_model.commission(order, price)) + float(cost_model.tax(order, price))
+        
+        if quantity * price > cash:
+            quantity = _round_lots(max(cash, 0.0) / price, self.lot_size)
+        while quantity > 0:
+            excess = cost(quantity) - cash
+            if excess <= _EPSILON:
+                break
+            # 按超出的金额减仓，每次至少一手
+            quantity = _round_lots(quantity - max(excess / price, self.lot_size), self.lot_size)
+        return max(quantity, 0.0)
+
+
+class FixedShares(PositionSizer):
+    """
+    固定股数 / Fixed number of shares
+    
+    信号为正时持有n股多头，为负时持有n股空头，为0时空仓
+    Holds n shares long on a positive signal, n short on a negative one and nothing on 0
+    
+    Examples:
+        >>> FixedShares(1000).order("SH600000", 1.0, portfolio, 10.0)
+    """
+    
+    def __init__(self, n: int, lot_size: int = A_SHARE_LOT):
+        """
+        Args:
+            n: 股数，必须为整手 / Shares, a whole number of lots
+            lot_size: 每手股数 / Shares per lot
+        """
+        super().__init__(lot_size)
+        if not isinstance(n, int) or isinstance(n, bool) or n < 1 or n % lot_size:
+            raise ValueError(f"n must be a positive multiple of the {lot_size}-share lot, got {n!r}")
+        self.n = n
+    
+    def target(
+        self,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None
+    ) -> Optional[float]:
+        return 0.0 if signal == 0 else math.copysign(self.n, signal)
+    
+    def __repr__(self) -> str:
+        return f"FixedShares({self.n})"
+
+
+class FixedFraction(PositionSizer):
+    """
+    按权益的固定比例持仓 / Position worth a fixed fraction of equity
+    
+    目标市值为signal * f * 权益
+    The target market value is signal * f * equity
+    
+    Examples:
+        >>> FixedFraction(0.1)  # 每个标的10%的权益 / 10% of equity per instrument
+    """
+    
+    def __init__(self, f: float, lot_size: int = A_SHARE_LOT):
+        """
+        Args:
+            f: 信号为1时占权益的比例，在(0, 1]之间 / Share of equity at a signal of 1, in (0, 1]
+            lot_size: 每手股数 / Shares per lot
+        """
+        super().__init__(lot_size)
+        if not (math.isfinite(f) and 0 < f <= 1):
+            raise ValueError(f"f must be in (0, 1], got {f!r}")
+        self.f = f
+    
+    def target(
+        self,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None
+    ) -> Optional[float]:
+        return signal * self.f * portfolio.equity / price
+    
+    def __repr__(self) -> str:
+        return f"FixedFraction({self.f})"
+
+
+class VolatilityTarget(PositionSizer):
+    """
+    波动率目标 / Volatility targeting
+    
+    按最近lookback期收益率的年化波动率σ，目标市值为signal * min(annual_vol / σ, max_leverage) * 权益，
+    波动越大仓位越小。有效收益率不足lookback期时不交易；σ为0时按max_leverage持仓。
+    With σ the annualized volatility of the last lookback returns, the target
+    market value is signal * min(annual_vol / σ, max_leverage) * equity, so the
+    position shrinks as volatility rises. With fewer than lookback valid
+    returns there is no trade; a σ of 0 holds max_leverage.
+    
+    Examples:
+        >>> VolatilityTarget(0.15, lookback=20).order("SH600000", 1.0, portfolio, 10.0, returns=recent_returns)
+    """
+    
+    needs_returns = True
+    
+    def __init__(
+        self,
+        annual_vol: float,
+        lookback: int,
+        max_leverage: float = 1.0,
+        freq: FreqLike = "day",
+        lot_size: int = A_SHARE_LOT
+    ):
+        """
+        Args:
+            annual_vol: 目标年化波动率，如0.15 / Target annualized volatility, such as 0.15
+            lookback: 估计波动率使用的收益率期数，至少为2 / Returns used to estimate volatility, at least 2
+            max_leverage: 持仓市值占权益的最大倍数 / Largest position value as a multiple of equity
+            freq: 收益率的数据频率或每年期数 / Frequency of the returns or periods per year
+            lot_size: 每手股数 / Shares per lot
+        """
+        super().__init__(lot_size)
+        if not (math.isfinite(annual_vol) and annual_vol > 0):
+            raise ValueError(f"annual_vol must be positive, got {annual_vol!r}")
+        if not isinstance(lookback, int) or isinstance(lookback, bool) or lookback < 2:
+            raise ValueError(f"lookback must be an integer of at least 2, got {lookback!r}")
+        if not (math.isfinite(max_leverage) and max_leverage > 0):
+            raise ValueError(f"max_leverage must be positive, got {max_leverage!r}")
+        self.annual_vol = annual_vol
+        self.lookback = lookback
+        self.max_leverage = max_leverage
+        self.freq = freq
+    
+    def target(
+        self,
+        signal: float,
+        portfolio: Portfolio,
+        price: float,
+        returns: Optional[Sequence[float]] = None
+    ) -> Optional[float]:
+        if returns is None:
+            raise ValueError("VolatilityTarget needs the instrument's return history")
+        recent = pd.Series(returns, dtype=float).dropna().iloc[-self.lookback:]
+        if len(recent) < self.lookback:
+            return None
+        vol = annualized_vol(recent, self.freq)
+        leverage = self.max_leverage if vol == 0 else min(self.annual_vol / vol, self.max_leverage)
+        return signal * leverage * portfolio.equity / price
+    
+    def __repr__(self) -> str:
+        return f"VolatilityTarget({self.annual_vol}, lookback={self.lookback})"
+
+
+def _round_lots(quantity: float, lot_size: int) -> float:
+    """向零取整到整手 / Round towards zero to whole lots"""
+    lots = math.floor(abs(quantity) / lot_size + _EPSILON)
+    return math.copysign(lots * lot_size, quantity) if lots else 0.0
+
+
+class SignalStrategy(Strategy):
+    """
+    按信号和仓位管理规则下单的策略 / Strategy trading signals through a position sizer
+    
+    每根K线调用signals得到标的的目标信号，按当日收盘价用sizer换算为订单，先卖后买；同一根K线上
+    的多笔买单共用可用现金。不在signals结果中的持仓保持不变。
+    On every bar signals gives the instruments' target signals and sizer turns
+    them into orders at that day's closes, sells before buys; the buys of one
+    bar share the available cash. Positions missing from the signals are left
+    alone.
+    """
+    
+    def __init__(
+        self,
+        signals: SignalFunction,
+        sizer: PositionSizer,
+        cost_model: Optional[CostModel] = None
+    ):
+        """
+        初始化策略 / Initialize strategy
+        
+        Args:
+            signals: 给定行情上下文、返回标的代码到目标信号映射的函数 /
+                Function from the bar context to a mapping of instrument code to target signal
+            sizer: 仓位管理规则 / Position sizing rule
+            cost_model: 估算买入费用的成本模型，通常与EngineConfig.cost_model相同 /
+                Cost model estimating buy fees, usually the same as EngineConfig.cost_model
+        """
+        self._signals = signals
+        self._sizer = sizer
+        self._cost_model = cost_model
+    
+    @property
+    def sizer(self) -> PositionSizer:
+        """仓位管理规则 / Position sizing rule"""
+        return self._sizer
+    
+    def on_bar(
+        self,
+        ctx: BarContext,
+        portfolio: Portfolio,
+        bars: Dict[str, Bar]
+    ) -> Optional[Iterable[Order]]:
+        sells: List[Order] = []
+        buys: List[Order] = []
+        cash = portfolio.cash
+        for code, signal in sorted(self._signals(ctx).items()):
+            bar = bars.get(code) or ctx.bar(code)
+            if bar is None or bar.get(CLOSE_FIELD) is None:
+                continue
+            price = float(bar[CLOSE_FIELD])
+            returns = self._returns(ctx, code) if self._sizer.needs_returns else None
+            order = self._sizer.order(code, signal, portfolio, price, returns, self._cost_model, cash)
+            if order is None:
+                continue
+            if order.side is OrderSide.SELL:
+                sells.append(order)
+            else:
+                buys.append(order)
+                cash -= order.quantity * price + self._fees(order, price)
+        return sells + buys
+    
+    def _returns(self, ctx: BarContext, code: str) -> List[float]:
+        """截至当前K线的收盘价收益率 / Close-to-close returns up to the current bar"""
+        history = ctx.history(code)
+        if CLOSE_FIELD not in history.columns:
+            return []
+        return price_returns(history[CLOSE_FIELD]).tolist()
+    
+    def _fees(self, order: Order, price: float) -> float:
+        """估算的买入费用 / Estimated fees of a buy"""
+        if self._cost_model is None:
+            return 0.0
+        return float(self._cost_model.commission(order, price)) + float(self._cost_model.tax(order, price))
@@ -0,0 +1,482 @@
+"""
+滚动前推回测模块 / Walk-Forward Backtest Module
+把回测区间按交易日切分为训练窗口和测试窗口，逐段回测并把样本外结果拼接为一条权益曲线
+Splits the backtest range into train and test windows by trading day, runs
+each test window out of sample and stitches the results into one equity curve
+
+每一折先用训练窗口的数据构造策略（策略工厂可以在这里拟合参数），再在紧随其后的测试
+窗口上回测。测试窗口之间不重叠，每一折都从EngineConfig.initial_cash的空仓开始，
+拼接的权益曲线由各折的日收益率连乘得到。策略在测试窗口内通过ctx.history()仍能看到
+训练窗口的数据，但看不到当日之后的数据。
+Each fold first builds the strategy from the train window's data (the
+strategy factory can fit parameters there), then backtests it on the test
+window right after. Test windows never overlap and every fold starts flat
+with EngineConfig.initial_cash; the stitched equity curve compounds the
+folds' daily returns. Inside a test window ctx.history() still reaches back
+into the train window but never past the current day.
+
+每一折的引擎种子由根种子（EngineConfig.seed，为None时选取一个并记录在结果中）和折的序号派生，
+各折的随机成本模型和策略随机数流相互独立，整个滚动前推仍可以用根种子重现。
+Each fold's engine seed is derived from the root seed (EngineConfig.seed, or
+one picked and recorded in the result when it is None) and the fold number,
+so the folds' stochastic cost models and strategy streams are independent
+while the whole walk-forward still reproduces from the root seed.
+
+窗口长度可以是交易日数，也可以是"24M"、"6M"、"1Y"、"13W"这样的日历期间；日历期间的
+边界落在非交易日时取其后的第一个交易日。交易日少于min_train_size或min_test_size的折
+会被跳过并记录警告。
+Window sizes are either trading-day counts or calendar periods such as
+"24M", "6M", "1Y" or "13W"; a period boundary that falls on a non-trading
+day snaps to the next trading day. Folds with fewer trading days than
+min_train_size or min_test_size are skipped with a warning.
+
+Examples:
+    >>> config = WalkForwardConfig(
+    ...     engine=EngineConfig(start_time="2020-01-01", end_time="2024-12-31", instruments=codes),
+    ...     train_size="24M",
+    ...     test_size="6M"
+    ... )
+    >>> result = walk_forward(config, lambda fold: MomentumStrategy.fit(fold.train_data))
+    >>> print(result.metrics)
+"""
+
+import re
+from dataclasses import dataclass, field, replace
+from typing import Callable, Dict, List, Optional, Sequence, Tuple, Union
+
+import pandas as pd
+
+from ..core.data_manager import DataManager
+from ..core.feature_frame import FeatureFrame
+from ..core.metrics import FreqLike, Summary, summary
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import BacktestError, ErrorCategory, ErrorInfo, ErrorSeverity
+from ..utils.random_streams import derive_seed, new_seed
+from .backtest_engine import BacktestEngine, EngineConfig, EngineResult, Strategy, StrategyCallback
+
+
+# 窗口长度：交易日数、"6M"这样的日历期间或pd.DateOffset /
+# Window size: a trading-day count, a calendar period such as "6M", or a pd.DateOffset
+WindowSize = Union[int, str, pd.DateOffset]
+
+_PERIOD = re.compile(r"(\d+)\s*([DWMY])", re.IGNORECASE)
+_PERIOD_UNITS = {"D": "days", "W": "weeks", "M": "months", "Y": "years"}
+
+
+@dataclass
+class WalkForwardConfig:
+    """
+    滚动前推回测配置 / Walk-forward configuration
+    
+    Attributes:
+        engine: 整个区间的引擎配置，start_time和end_time为全部折的范围 /
+            Engine configuration for the whole range; start_time and end_time span every fold
+        train_size: 训练窗口的交易日数或日历期间（如"24M"），0表示不训练 /
+            Train window in trading days or as a calendar period (e.g. "24M"); 0 for no training
+        test_size: 测试窗口的交易日数或日历期间（如"6M"） /
+            Test window in trading days or as a calendar period (e.g. "6M")
+        step: 相邻两折向前推进的距离，None表示等于test_size，不能小于test_size；
+            三者要么都是交易日数，要么都是日历期间 / Distance between the starts of
+            consecutive folds; None means test_size, and it can't be smaller than
+            test_size. The three sizes are either all trading days or all periods
+        anchored: 为True时训练窗口总是从区间第一个交易日开始并逐折扩大 /
+            When True every train window starts on the first day and grows fold by fold
+        keep_partial: 最后一个不足test_size的测试窗口是否仍然回测 /
+            Whether a final test window shorter than test_size is still run
+        min_train_size: 训练窗口的最少交易日数，不足的折跳过并记录警告 /
+            Fewest trading days in a train window; shorter folds are skipped with a warning
+        min_test_size: 测试窗口的最少交易日数，不足的折跳过并记录警告 /
+            Fewest trading days in a test window; shorter folds are skipped with a warning
+        rf: 计算绩效时的年化无风险利率 / Annual risk-free rate for the metrics
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    """
+    engine: EngineConfig
+    train_size: WindowSize
+    test_size: WindowSize
+    step: Optional[WindowSize] = None
+    anchored: bool = False
+    keep_partial: bool = False
+    min_train_size: int = 0
+    min_test_size: int = 1
+    rf: float = 0.0
+    freq: FreqLike = "day"
+
+
+@dataclass
+class Fold:
+    """
+    一折的训练和测试窗口 / Train and test windows of one fold
+    
+    Attributes:
+        number: 折的序号，从0开始 / Fold number, counting from 0
+        train_start: 训练窗口第一个交易日，不训练时为None / First train day; None without training
+        train_end: 训练窗口最后一个交易日，不训练时为None / Last train day; None without training
+        test_start: 测试窗口第一个交易日 / First test day
+        test_end: 测试窗口最后一个交易日 / Last test day
+        train_data: 截取到训练窗口的每个标的的数据 / Each instrument's data cut to the train window
+        partial: 测试窗口是否短于test_size / Whether the test window is shorter than test_size
+        seed: 该折回测使用的随机种子，策略工厂需要随机数时可以用它播种 /
+            Random seed of the fold's backtest; a strategy factory needing randomness can seed from it
+    """
+    number: int
+    train_start: Optional[pd.Timestamp]
+    train_end: Optional[pd.Timestamp]
+    test_start: pd.Timestamp
+    test_end: pd.Timestamp
+    train_data: Dict[str, FeatureFrame] = field(default_factory=dict, repr=False)
+    partial: bool = False
+    seed: Optional[int] = None
+
+
+# 根据一折的训练数据构造该折使用的策略 / Builds the strategy for a fold from its train data
+StrategyFactory = Callable[[Fold], Union[Strategy, StrategyCallback]]
+
+
+@dataclass
+class FoldResult:
+    """
+    一折的样本外结果 / Out-of-sample result of one fold
+    
+    Attributes:
+        fold: 折的窗口 / The fold's windows
+        result: 测试窗口的回测结果 / Backtest result on the test window
+        returns: 测试窗口的日收益率，首日相对期初资金计算 /
+            Daily returns over the test window, the first day against the starting cash
+        metrics: 测试窗口的绩效汇总 / Performance summary of the test window
+    """
+    fold: Fold
+    result: EngineResult
+    returns: pd.Series
+    metrics: Summary
+
+
+@dataclass
+class WalkForwardResult:
+    """
+    滚动前推回测结果 / Walk-forward result
+    
+    Attributes:
+        folds: 每一折的结果，按时间顺序 / Each fold's result in time order
+        equity_curve: 拼接的样本外权益曲线，从initial_cash开始连乘各折的日收益率 /
+            Stitched out-of-sample equity, compounding the folds' daily returns from initial_cash
+        metrics: 拼接后的整体绩效 / Performance of the stitched curve
+        skipped: 因交易日不足而跳过的折的(test_start, test_end) /
+            (test_start, test_end) of the folds skipped for having too few trading days
+        seed: 派生各折种子的根种子，传给EngineConfig.seed可以重现 /
+            Root seed the fold seeds derive from; pass it as EngineConfig.seed to reproduce the run
+    """
+    folds: List[FoldResult]
+    equity_curve: pd.Series
+    metrics: Summary
+    skipped: List[Tuple[pd.Timestamp, pd.Timestamp]] = field(default_factory=list)
+    seed: Optional[int] = None
+    
+    @property
+    def returns(self) -> pd.Series:
+        """拼接的样本外日收益率 / Stitched out-of-sample daily returns"""
+        return pd.concat([f.returns for f in self.folds]).rename("returns")
+    
+    def fold_table(self) -> pd.DataFrame:
+        """
+        每一折的窗口和主要指标 / Each fold's windows and headline metrics
+        
+        Returns:
+            pd.DataFrame: 每折一行，以折的序号为索引 / One row per fold indexed by fold number
+        """
+        rows = []
+        for item in self.folds:
+            fold, stats = item.fold, item.metrics
+            rows.append({
+                "train_start": fold.train_start,
+                "train_end": fold.train_end,
+                "test_start": fold.test_start,
+                "test_end": fold.test_end,
+                "partial": fold.partial,
+                "total_return": stats.total_return,
+                "sharpe": stats.sharpe,
+                "max_drawdown": stats.max_drawdown.magnitude,
+                "trades": len(item.result.trades),
+            })
+        return pd.DataFrame(rows, index=pd.RangeIndex(len(rows), name="fold"))
+
+
+def fold_windows(
+    days: int,
+    train_size: int,
+    test_size: int,
+    step: Optional[int] = None,
+    anchored: bool = False,
+    keep_partial: bool = False
+) -> List[Tuple[int, int, int]]:
+    """
+    按交易日位置切分训练和测试窗口 / Split trading-day positions into train and test windows
+    
+    Args:
+        days: 交易日个数 / Number of trading days
+        train_size: 训练窗口长度 / Train window length
+        test_size: 测试窗口长度 / Test window length
+        step: 推进步长，None表示等于test_size / Step between folds; None means test_size
+        anchored: 训练窗口是否固定从位置0开始 / Whether train windows are anchored at position 0
+        keep_partial: 是否保留最后一个不完整的测试窗口 / Whether a final short test window is kept
+    
+    Returns:
+        List[Tuple[int, int, int]]: 每折的(train_start, test_start, test_end)，test_end不包含 /
+            (train_start, test_start, test_end) per fold with test_end exclusive
+    
+    Raises:
+        ValueError: 长度或步长不合法时抛出 / Raised for invalid sizes or step
+    """
+    step = test_size if step is None else step
+    if train_size < 0:
+        raise ValueError(f"train_size must be non-negative, got {train_size}")
+    if test_size <= 0:
+        raise ValueError(f"test_size must be positive, got {test_size}")
+    if step < test_size:
+        raise ValueError(
+            f"step must be at least test_size so test windows don't overlap, got step={step}, test_size={test_size}"
+        )
+    
+    windows = []
+    test_start = train_size
+    while test_start < days:
+        test_end = min(test_start + test_size, days)
+        if test_end - test_start < test_size and not keep_partial:
+            break
+        windows.append((0 if anchored else test_start - train_size, test_start, test_end))
+        test_start += step
+    return windows
+
+
+def period_windows(
+    days: Sequence[pd.Timestamp],
+    train_size: Union[str, pd.DateOffset, int],
+    test_size: Union[str, pd.DateOffset],
+    step: Optional[Union[str, pd.DateOffset]] = None,
+    anchored: bool = False,
+    keep_partial: bool = False,
+    start: Optional[pd.Timestamp] = None,
+    end: Optional[pd.Timestamp] = None
+) -> List[Tuple[int, int, int]]:
+    """
+    按日历期间切分训练和测试窗口 / Split trading days into train and test windows by calendar period
+    
+    第k折的测试窗口从区间起点加train_size再加k个step开始，长度为test_size；
+    落在非交易日的边界取其后的第一个交易日
+    Fold k's test window starts train_size plus k steps after the start of the
+    range and spans test_size; a boundary on a non-trading day snaps to the
+    next trading day
+    
+    Args:
+        days: 升序排列的交易日 / Trading days in ascending order
+        train_size: 训练期间，0表示不训练 / Train period; 0 for no training
+        test_size: 测试期间 / Test period
+        step: 推进期间，None表示等于test_size / Step between folds; None means test_size
+        anchored: 训练窗口是否固定从第一个交易日开始 / Whether train windows are anchored at the first day
+        keep_partial: 是否保留超出区间末尾的最后一个测试窗口 /
+            Whether a final test window running past the end of the range is kept
+        start: 区间的起点，None表示第一个交易日 / Start of the range, None for the first trading day
+        end: 区间的最后一天（包含），None表示最后一个交易日 / Last day of the range (inclusive), None for the last trading day
+    
+    Returns:
+        List[Tuple[int, int, int]]: 每折的(train_start, test_start, test_end)交易日位置，test_end不包含 /
+            (train_start, test_start, test_end) trading-day positions per fold with test_end exclusive
+    
+    Raises:
+        ValueError: 期间格式错误、不为正或步长小于test_size时抛出 /
+            Raised for a malformed or non-positive period, or a step shorter than test_size
+    """
+    return [window[:3] for window in _period_windows(
+        days, train_size, test_size, step, anchored, keep_partial, start, end
+    )]
+
+
+def _period_windows(
+    days: Sequence[pd.Timestamp],
+    train_size: Union[str, pd.DateOffset, int],
+    test_size: Union[str, pd.DateOffset],
+    step: Optional[Union[str, pd.DateOffset]],
+    anchored: bool,
+    keep_partial: bool,
+    start: Optional[pd.Timestamp],
+    end: Optional[pd.Timestamp]
+) -> List[Tuple[int, int, int, bool]]:
+    """period_windows()的实现，另外返回每折是否不完整 / period_windows() plus whether each fold is partial"""
+    index = pd.DatetimeIndex(days)
+    if not len(index):
+        return []
+    train = None if isinstance(train_size, int) and train_size == 0 else to_period(train_size, "train_size")
+    test = to_period(test_size, "test_size")
+    step = test if step is None else to_period(step, "step")
+    first = index[0] if start is None else pd.Timestamp(start)
+    if first + step < first + test:
+        raise ValueError(
+            f"step must be at least test_size so test windows don't overlap, got step={step}, test_size={test}"
+        )
+    last = (index[-1] if end is None else pd.Timestamp(end)) + pd.Timedelta(days=1)
+    
+    offset = pd.DateOffset(days=0) if train is None else train
+    windows = []
+    k = 0
+    while True:
+        # 从起点按k个步长计算，避免月末日期逐折漂移 / Counted from the origin so month ends don't drift fold by fold
+        origin = first + offset + step * k
+        k += 1
+        test_start = int(index.searchsorted(origin))
+        if test_start >= len(index):
+            break
+        bound = origin + test
+        partial = bound > last
+        if partial and not keep_partial:
+            break
+        test_end = int(index.searchsorted(bound))
+        if train is None:
+            train_start = test_start
+        else:
+            train_start = 0 if anchored else int(index.searchsorted(origin - train))
+        windows.append((train_start, test_start, test_end, partial))
+        if partial:
+            break
+    return windows
+
+
+def to_period(value: Union[str, pd.DateOffset], name: str = "size") -> pd.DateOffset:
+    """
+    把"6M"这样的期间转换为pd.DateOffset / Convert a period such as "6M" to a pd.DateOffset
+    
+    支持D（日）、W（周）、M（月）和Y（年） / D (days), W (weeks), M (months) and Y (years) are supported
+    
+    Raises:
+        ValueError: 格式错误或不为正时抛出 / Raised for a malformed or non-positive period
+    """
+    if isinstance(value, pd.DateOffset):
+        return value
+    match = _PERIOD.fullmatch(value.strip()) if isinstance(value, str) else None
+    if match is None:
+        raise ValueError(f"{name} must be a period such as '6M', '1Y', '13W' or '90D', got {value!r}")
+    count = int(match.group(1))
+    if count <= 0:
+        raise ValueError(f"{name} must be positive, got {value!r}")
+    return pd.DateOffset(**{_PERIOD_UNITS[match.group(2).upper()]: count})
+
+
+def walk_forward(
+    config: WalkForwardConfig,
+    factory: StrategyFactory,
+    data_manager: Optional[DataManager] = None
+) -> WalkForwardResult:
+    """
+    运行滚动前推回测 / Run a walk-forward backtest
+    
+    数据只获取一次，每一折调用factory(fold)得到新的策略并在测试窗口上回测
+    Data is fetched once; each fold calls factory(fold) for a fresh strategy
+    and backtests it on the test window
+    
+    Args:
+        config: 滚动前推配置 / Walk-forward configuration
+        factory: 策略工厂，参数为当前折，可以在其中用fold.train_data拟合参数 /
+            Strategy factory called with the fold; it can fit parameters on fold.train_data
+        data_manager: 获取数据使用的数据管理器 / Data manager used to fetch data
+    
+    Returns:
+        WalkForwardResult: 各折和拼接后的结果 / Per-fold and stitched results
+    
+    Raises:
+        ValueError: 窗口长度或步长不合法时抛出 / Raised for invalid window sizes or step
+        BacktestError: 交易日不足一折或某一折回测失败时抛出 /
+            Raised when there aren't enough trading days for one fold or a fold's backtest fails
+    """
+    logger = get_logger(__name__)
+    frames, days = BacktestEngine(config.engine, data_manager).load()
+    windows, skipped = [], []
+    for train_start, test_start, test_end, partial in _windows(config, days):
+        train_count, test_count = test_start - train_start, test_end - test_start
+        if train_count < config.min_train_size or test_count < config.min_test_size:
+            span = (days[test_start], days[max(test_start, test_end - 1)])
+            logger.warning(
+                f"跳过滚动前推窗口 {span[0].date()} 至 {span[1].date()}: 训练{train_count}个交易日, "
+                f"测试{test_count}个交易日, 少于最低要求({config.min_train_size}, {config.min_test_size})"
+            )
+            skipped.append(span)
+            continue
+        windows.append((train_start, test_start, test_end, partial))
+    if not windows:
+        raise BacktestError(ErrorInfo(
+            error_code="BCK0006",
+            error_message_zh=(
+                f"{len(days)}个交易日不足以构成一折: 训练窗口{config.train_size}, 测试窗口{config.test_size}"
+            ),
+            error_message_en=(
+                f"{len(days)} trading days are not enough for one fold with "
+                f"train_size={config.train_size!r} and test_size={config.test_size!r}"
+            ),
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"start={config.engine.start_time}, end={config.engine.end_time}",
+            suggested_actions=["延长回测区间", "缩短训练或测试窗口", "设置keep_partial=True运行不完整的测试窗口"],
+            recoverable=True
+        ))
+    
+    initial_cash = config.engine.initial_cash
+    seed = config.engine.seed if config.engine.seed is not None else new_seed()
+    folds: List[FoldResult] = []
+    for number, (train_start, test_start, test_end, partial) in enumerate(windows):
+        train_days = days[train_start:test_start]
+        fold = Fold(
+            number=number,
+            train_start=train_days[0] if train_days else None,
+            train_end=train_days[-1] if train_days else None,
+            test_start=days[test_start],
+            test_end=days[test_end - 1],
+            train_data={
+                code: frame.slice(train_days[0], train_days[-1]) for code, frame in frames.items()
+            } if train_days else {},
+            partial=partial,
+            seed=derive_seed(seed, "fold", number)
+        )
+        logger.info(
+            f"滚动前推第{number + 1}/{len(windows)}折: 测试{fold.test_start.date()} 至 {fold.test_end.date()}"
+        )
+        engine_config = replace(
+            config.engine,
+            start_time=str(fold.test_start),
+            end_time=str(fold.test_end),
+            data=frames,
+            seed=fold.seed
+        )
+        result = BacktestEngine(engine_config).run(factory(fold))
+        returns = _fold_returns(result, initial_cash)
+        folds.append(FoldResult(fold, result, returns, summary(returns, rf=config.rf, freq=config.freq)))
+    
+    stitched = pd.concat([f.returns for f in folds])
+    equity = (initial_cash * (1.0 + stitched).cumprod()).rename("equity")
+    logger.info(f"滚动前推完成: {len(folds)}折, {len(stitched)}个样本外交易日, 种子 {seed}")
+    return WalkForwardResult(folds, equity, summary(stitched, rf=config.rf, freq=config.freq), skipped, seed)
+
+
+def _windows(config: WalkForwardConfig, days: List[pd.Timestamp]) -> List[Tuple[int, int, int, bool]]:
+    """按配置的窗口类型切分，返回(train_start, test_start, test_end, partial) / Split by the configured window kind"""
+    if isinstance(config.test_size, (str, pd.DateOffset)):
+        return _period_windows(
+            days, config.train_size, config.test_size, config.step, config.anchored, config.keep_partial,
+            pd.Timestamp(config.engine.start_time), pd.Timestamp(config.engine.end_time)
+        )
+    for name in ("train_size", "step"):
+        value = getattr(config, name)
+        if value is not None and not isinstance(value, int):
+            raise ValueError(f"{name} must be a trading-day count when test_size is one, got {value!r}")
+    return [
+        (train_start, test_start, test_end, test_end - test_start < config.test_size)
+        for train_start, test_start, test_end in fold_windows(
+            len(days), config.train_size, config.test_size, config.step, config.anchored, config.keep_partial
+        )
+    ]
+
+
+def _fold_returns(result: EngineResult, initial_cash: float) -> pd.Series:
+    """测试窗口的日收益率，首日相对期初资金 / Test-window daily returns, the first day against the starting cash"""
+    equity = result.equity_curve
+    previous = equity.shift(1)
+    if len(previous):
+        previous.iloc[0] = initial_cash
+    returns = equity / previous.where(previous > 0) - 1.0
+    return returns.fillna(0.0).rename("returns")
@@ -23,11 +23,88 @@ from .config_manager import (
 
 from .data_manager import (
     DataManager,
+    FeatureOptions,
     MissingValueStrategy,
     ValidationResult,
     DataInfo
 )
 
+from .feature_frame import Bar, FeatureFrame, FeatureResult, FeatureFetchError
+from .lazy_frame import LazyFeatureFrame
+from .instrument import InstrumentCodeError, normalize_instrument, split_instrument
+from .expression_engine import (
+    Expression,
+    ExpressionError,
+    parse_expression,
+    register_function
+)
+
+from .feature_stream import Chunk, FeatureIterator, FeatureRequest
+from .query import Query, QuerySyntaxError, parse_query
+from .request_time import DEFAULT_TIMEZONE, RequestTimeError, parse_request_time, parse_request_range
+from .trading_calendar import (
+    TradingCalendar,
+    ContinuousCalendar,
+    FillPolicy,
+    DEFAULT_FILL_KEY,
+    register_calendar,
+    get_calendar,
+    trading_days
+)
+from .delisting import Delisting, register_delisting, register_delistings, get_delisting
+from .currency import (
+    BASE_CURRENCY,
+    FXProvider,
+    FXRateUnavailableError,
+    register_currency,
+    get_currency,
+    fx_pair
+)
+from .money import Money, MoneyOverflowError, RoundingMode
+from .sectors import register_sector, register_sectors, get_sector
+from .universe import Universe, register_universe, get_universe, universe_members
+from .universe_filter import (
+    ST_FIELD,
+    InstrumentFilter,
+    FilteredUniverse,
+    MinListingDays,
+    MinADV,
+    ExcludeST,
+    ExcludeSuspended
+)
+from .data_update import (
+    DataStore,
+    ParquetStore,
+    CacheStore,
+    InstrumentUpdate,
+    UpdateSummary,
+    update as update_store
+)
+from .bulk_download import (
+    DownloadSpec,
+    DownloadOptions,
+    ManifestEntry,
+    DownloadManifest,
+    bulk_download
+)
+from .futures import (
+    InstrumentType,
+    FuturesSpec,
+    register_futures,
+    get_futures_spec,
+    AdjustMethod,
+    RollEvent,
+    RollRule,
+    VolumeRoll,
+    ExpiryRoll,
+    ContinuousSeries,
+    ContinuousFuturesProvider,
+    stitch
+)
+from .price_adjustment import AdjustMode
+from .fundamentals import DEFAULT_MAX_STALENESS, align_point_in_time
+from .validation import DataValidationError, ValidationOptions, ValidationReport
+
 from .model_factory import ModelFactory
 from .portfolio_manager import PortfolioManager
 from .risk_manager import RiskManager
@@ -49,9 +126,95 @@ __all__ = [
     'VisualizationConfig',
     'CLIConfig',
     'DataManager',
+    'FeatureOptions',
     'MissingValueStrategy',
     'ValidationResult',
     'DataInfo',
+    'Bar',
+    'FeatureFrame',
+    'LazyFeatureFrame',
+    'InstrumentCodeError',
+    'normalize_instrument',
+    'split_instrument',
+    'FeatureResult',
+    'FeatureFetchError',
+    'Expression',
+    'ExpressionError',
+    'parse_expression',
+    'register_function',
+    'Chunk',
+    'FeatureIterator',
+    'FeatureRequest',
+    'Query',
+    'QuerySyntaxError',
+    'parse_query',
+    'DEFAULT_TIMEZONE',
+    'RequestTimeError',
+    'parse_request_time',
+    'parse_request_range',
+    'TradingCalendar',
+    'ContinuousCalendar',
+    'FillPolicy',
+    'DEFAULT_FILL_KEY',
+    'register_calendar',
+    'get_calendar',
+    'trading_days',
+    'Delisting',
+    'register_delisting',
+    'register_delistings',
+    'get_delisting',
+    'BASE_CURRENCY',
+    'FXProvider',
+    'FXRateUnavailableError',
+    'register_currency',
+    'get_currency',
+    'fx_pair',
+    'Money',
+    'MoneyOverflowError',
+    'RoundingMode',
+    'register_sector',
+    'register_sectors',
+    'get_sector',
+    'Universe',
+    'register_universe',
+    'get_universe',
+    'universe_members',
+    'ST_FIELD',
+    'InstrumentFilter',
+    'FilteredUniverse',
+    'MinListingDays',
+    'MinADV',
+    'ExcludeST',
+    'ExcludeSuspended',
+    'DataStore',
+    'ParquetStore',
+    'CacheStore',
+    'InstrumentUpdate',
+    'UpdateSummary',
+    'update_store',
+    'DownloadSpec',
+    'DownloadOptions',
+    'ManifestEntry',
+    'DownloadManifest',
+    'bulk_download',
+    'InstrumentType',
+    'FuturesSpec',
+    'register_futures',
+    'get_futures_spec',
+    'AdjustMethod',
+    'RollEvent',
+    'RollRule',
+    'VolumeRoll',
+    'ExpiryRoll',
+    'ContinuousSeries',
+    'ContinuousFuturesProvider',
+    'stitch',
+    'AdjustMode',
+    'DEFAULT_MAX_STALENESS',
+    'align_point_in_time',
+    'DataValidationError',
+    'ValidationOptions',
+    'ValidationReport',
     'ModelFactory',
     'PortfolioManager',
     'RiskManager'
@@ -0,0 +1,333 @@
+"""
+批量下载模块 / Bulk Download Module
+在研究开始前为整个标的池一次性建立本地数据存储
+Seeds a local data store for a whole universe before research starts
+
+每个标的单独获取并原子地写为<INSTRUMENT>.parquet（布局与ParquetDataProvider相同），
+多个标的在线程池中并行下载，rate_limit限制每秒发起的请求数。文件先写临时文件再原子替换，
+因此目标目录中存在、且包含所有请求字段的文件一定是完整的：中断后再次运行时这些标的直接跳过，
+只下载其余标的。失败的标的记录在清单中，不影响其他标的。
+Each instrument is fetched on its own and written atomically as
+<INSTRUMENT>.parquet (the ParquetDataProvider layout), several at a time on a
+worker pool, with rate_limit capping the requests started per second. Files
+are written to a temporary name and swapped in, so a file present in the
+destination with every requested field is always complete: a run after an
+interruption skips those instruments and only downloads the rest. An
+instrument that fails is recorded in the manifest and does not stop the others.
+
+Examples:
+    >>> spec = DownloadSpec("SH000300", ["$open", "$close", "$volume"], start="2020-01-01")
+    >>> manifest = bulk_download(RequestContext(), spec, "./data/parquet", DownloadOptions(rate_limit=5))
+    >>> manifest.total_rows
+"""
+
+import hashlib
+import threading
+import time
+from concurrent.futures import FIRST_COMPLETED, ThreadPoolExecutor, wait
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Any, Dict, List, Optional, Sequence, Union
+
+from ..infrastructure.data_provider import DataProvider, SUPPORTED_FREQS
+from ..infrastructure.logger_system import get_logger
+from ..utils.request_context import ContextCancelledError, RequestContext
+from ..utils.retry import RetryPolicy
+from .data_manager import DataManager, ProgressCallback
+from .data_update import ParquetStore
+from .expression_engine import is_raw_field
+from .universe import Universe, get_universe
+
+
+# 默认的并行下载数 / Default number of parallel downloads
+DEFAULT_DOWNLOAD_WORKERS = 4
+
+# 计算校验和时每次读取的字节数
+_CHECKSUM_CHUNK = 1 << 20
+
+
+@dataclass
+class DownloadSpec:
+    """
+    下载内容 / What to download
+    
+    Attributes:
+        universe: 指数代码或股票池名称（按get_universe()展开为区间内的成分股）、标的代码列表或标的池 /
+            Index code or pool name (expanded with get_universe() to the members
+            during the range), a list of instrument codes, or a Universe
+        fields: 原始字段，如["$open", "$close"] / Raw fields such as ["$open", "$close"]
+        start: 开始时间，None表示不限 / Start time, None for no bound
+        end: 结束时间，None表示到最新 / End time, None for the latest data
+        freq: 数据频率 / Data frequency
+    """
+    universe: Union[str, Sequence[str], Universe]
+    fields: List[str]
+    start: Optional[str] = None
+    end: Optional[str] = None
+    freq: str = "day"
+    
+    def __post_init__(self):
+        self.fields = list(dict.fromkeys(self.fields))
+        if not self.fields:
+            raise ValueError("download needs at least one field")
+        expressions = [f for f in self.fields if not is_raw_field(f)]
+        if expressions:
+            raise ValueError(f"only raw fields can be downloaded, got expressions: {expressions}")
+        if self.freq not in SUPPORTED_FREQS:
+            raise ValueError(f"unsupported freq: {self.freq!r}, expected one of {', '.join(SUPPORTED_FREQS)}")
+    
+    def instruments(self) -> List[str]:
+        """
+        要下载的标的代码，去重并保持顺序 / Instrument codes to download, deduplicated in order
+        
+        Raises:
+            DataError: 找不到标的池的成分股文件时抛出 / Raised when the universe has no membership file
+        """
+        universe = get_universe(self.universe) if isinstance(self.universe, str) else self.universe
+        if isinstance(universe, Universe):
+            return universe.members_between(self.start, self.end)
+        return list(dict.fromkeys(universe))
+
+
+@dataclass
+class DownloadOptions:
+    """
+    下载选项 / Download options
+    
+    Attributes:
+        max_workers: 并行下载的标的数 / Instruments downloaded in parallel
+        rate_limit: 每秒最多发起的请求数，None表示不限 / Requests started per second at most, None for no limit
+        retry: 遇到暂时性错误时的重试策略，None表示使用管理器的默认策略 /
+            Retry policy for transient failures, None uses the manager default
+        provider: 提供者实例或已注册的名称，None表示管理器的默认提供者 /
+            Provider instance or registered name, None for the manager's default
+        progress: 进度回调progress(done, total)，与get_features()的相同；跳过的标的也计入 /
+            Progress callback progress(done, total), the same as get_features()'s; skipped instruments count
+        resume: 是否跳过目标目录中已经完整的文件 / Whether to skip files already complete in the destination
+        compression: Parquet压缩算法 / Parquet compression codec
+    """
+    max_workers: int = DEFAULT_DOWNLOAD_WORKERS
+    rate_limit: Optional[float] = None
+    retry: Optional[RetryPolicy] = None
+    provider: Optional[Union[str, DataProvider]] = None
+    progress: Optional[ProgressCallback] = None
+    resume: bool = True
+    compression: str = "snappy"
+    
+    def __post_init__(self):
+        if self.max_workers < 1:
+            raise ValueError(f"max_workers must be positive, got {self.max_workers}")
+        if self.rate_limit is not None and not self.rate_limit > 0:
+            raise ValueError(f"rate_limit must be positive, got {self.rate_limit!r}")
+
+
+@dataclass
+class ManifestEntry:
+    """
+    清单中的一个文件 / One file of the manifest
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        path: 相对于目标目录的文件路径 / File path relative to the destination
+        rows: 行数 / Row count
+        sha256: 文件内容的SHA-256 / SHA-256 of the file contents
+        resumed: 是否为之前运行留下的完整文件 / Whether the complete file was left by an earlier run
+    """
+    instrument: str
+    path: str
+    rows: int
+    sha256: str
+    resumed: bool = False
+    
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "instrument": self.instrument,
+            "path": self.path,
+            "rows": self.rows,
+            "sha256": self.sha256,
+            "resumed": self.resumed,
+        }
+
+
+@dataclass
+class DownloadManifest:
+    """
+    批量下载的清单 / Manifest of a bulk download
+    
+    Attributes:
+        files: 每个已完成标的的文件，按请求顺序 / File of every completed instrument, in request order
+        failed: 失败的标的及错误信息 / Instruments that failed with their error messages
+    """
+    files: Dict[str, ManifestEntry] = field(default_factory=dict)
+    failed: Dict[str, str] = field(default_factory=dict)
+    
+    @property
+    def total_rows(self) -> int:
+        """所有文件的总行数 / Rows across every file"""
+        return sum(entry.rows for entry in self.files.values())
+    
+    @property
+    def complete(self) -> bool:
+        """是否没有失败的标的 / Whether no instrument failed"""
+        return not self.failed
+    
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "files": [entry.to_dict() for entry in self.files.values()],
+            "failed": dict(self.failed),
+            "total_rows": self.total_rows,
+        }
+
+
+def bulk_download(
+    ctx: RequestContext,
+    spec: DownloadSpec,
+    dest: Union[str, Path],
+    options: Optional[DownloadOptions] = None,
+    manager: Optional[DataManager] = None
+) -> DownloadManifest:
+    """
+    把标的池的数据下载到本地Parquet目录 / Download a universe into a local Parquet directory
+    
+    ctx取消或超时后不再开始新的标的，正在写入的文件不会留下；已经写完的文件保留，
+    之后以resume运行时跳过
+    Once ctx is done no new instrument starts and no half-written file is
+    left behind; the files already written stay and a resumed run skips them
+    
+    Args:
+        ctx: 请求上下文，控制取消和超时 / Request context controlling cancellation and deadline
+        spec: 下载内容 / What to download
+        dest: 目标目录，布局与ParquetDataProvider相同 / Destination directory in the ParquetDataProvider layout
+        options: 下载选项，None表示使用默认选项 / Download options, None for the defaults
+        manager: 获取数据的数据管理器，None表示新建一个不带缓存的管理器 /
+            Data manager fetching the data, None creates one without a cache
+    
+    Returns:
+        DownloadManifest: 每个文件的行数和校验和，以及失败的标的 / Row count and checksum of every file, and the failures
+    
+    Raises:
+        ContextCancelledError: 下载期间上下文取消或超时时抛出 / Raised when the context is done during the download
+        DataError: 找不到标的池的成分股文件时抛出 / Raised when the universe has no membership file
+    """
+    options = options or DownloadOptions()
+    manager = manager or DataManager(enable_cache=False)
+    store = ParquetStore(str(dest), compression=options.compression)
+    limiter = _RateLimiter(options.rate_limit) if options.rate_limit is not None else None
+    logger = get_logger(__name__)
+    ctx.check()
+    
+    codes = spec.instruments()
+    manifest = DownloadManifest()
+    if not codes:
+        return manifest
+    logger.info(f"开始批量下载 - 标的: {len(codes)}, 字段: {spec.fields}, 目录: {store.data_dir}")
+    
+    executor = ThreadPoolExecutor(max_workers=min(len(codes), options.max_workers))
+    worker_ctx = ctx.child()
+    futures = {}
+    try:
+        futures = {
+            code: executor.submit(_download_one, worker_ctx, manager, store, spec, options, limiter, code)
+            for code in codes
+        }
+        pending = set(futures.values())
+        while pending:
+            ctx.check()
+            done, pending = wait(pending, timeout=0.05, return_when=FIRST_COMPLETED)
+            if options.progress is not None:
+                finished = len(codes) - len(pending) - len(done)
+                for count in range(finished + 1, finished + len(done) + 1):
+                    options.progress(count, len(codes))
+        ctx.check()
+    except ContextCancelledError:
+        worker_ctx.cancel("bulk download cancelled")
+        for future in futures.values():
+            future.cancel()
+        logger.info(f"批量下载已取消 - 已完成: {sum(f.done() and not f.cancelled() for f in futures.values())}")
+        raise
+    finally:
+        executor.shutdown(wait=True)
+    
+    # 按请求顺序汇总，清单内容与完成顺序无关
+    for code in codes:
+        try:
+            manifest.files[code] = futures[code].result()
+        except ContextCancelledError:
+            raise
+        except Exception as e:
+            logger.error(f"批量下载失败: {code}, 错误: {str(e)}")
+            manifest.failed[code] = str(e)
+    logger.info(
+        f"批量下载完成 - 文件: {len(manifest.files)}, 失败: {len(manifest.failed)}, 行数: {manifest.total_rows}"
+    )
+    return manifest
+
+
+def _download_one(
+    ctx: RequestContext,
+    manager: DataManager,
+    store: ParquetStore,
+    spec: DownloadSpec,
+    options: DownloadOptions,
+    limiter: Optional["_RateLimiter"],
+    code: str
+) -> ManifestEntry:
+    """下载一个标的，文件已经完整时跳过 / Download one instrument, skipping it when its file is complete"""
+    ctx.check()
+    path = store.path(code, spec.freq)
+    if options.resume:
+        stored = store.index(code, spec.fields, spec.freq)
+        if stored is not None:
+            return _entry(store, code, path, len(stored), resumed=True)
+    
+    if limiter is not None:
+        limiter.acquire(ctx)
+    result = manager.get_features_ctx(
+        ctx, [code], spec.fields,
+        start_time=spec.start, end_time=spec.end, freq=spec.freq,
+        max_workers=1, provider=options.provider, retry=options.retry
+    )
+    if code in result.errors:
+        raise result.errors[code]
+    frame = result[code][spec.fields]
+    ctx.check()
+    store.replace_tail(code, frame, None, spec.freq)
+    return _entry(store, code, path, len(frame), resumed=False)
+
+
+def _entry(store: ParquetStore, code: str, path: Path, rows: int, resumed: bool) -> ManifestEntry:
+    """为写好的文件生成清单条目 / Build the manifest entry of a written file"""
+    digest = hashlib.sha256()
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(_CHECKSUM_CHUNK), b""):
+            digest.update(chunk)
+    return ManifestEntry(
+        instrument=code,
+        path=path.relative_to(store.data_dir).as_posix(),
+        rows=rows,
+        sha256=digest.hexdigest(),
+        resumed=resumed
+    )
+
+
+class _RateLimiter:
+    """
+    按固定间隔发放请求名额 / Hands out request slots at a fixed interval
+    
+    线程安全；等待名额时ctx取消会立即返回并抛出
+    Thread-safe; a cancelled ctx ends the wait for a slot and raises
+    """
+    
+    def __init__(self, rate: float):
+        self._interval = 1.0 / rate
+        self._next = time.monotonic()
+        self._lock = threading.Lock()
+    
+    def acquire(self, ctx: RequestContext) -> None:
+        with self._lock:
+            now = time.monotonic()
+            slot = max(now, self._next)
+            self._next = slot + self._interval
+        delay = slot - now
+        if delay > 0 and ctx.wait(delay):
+            ctx.check()
@@ -0,0 +1,243 @@
+"""
+配对交易模块 / Pair Trading Module
+计算两个标的的价差、OLS对冲比例，并用ADF检验判断价差是否平稳
+Computes the spread of two instruments and the OLS hedge ratio, and tests the
+spread for stationarity with the augmented Dickey-Fuller test
+
+ADF检验的回归带常数项：Δy_t = α + γ·y_{t-1} + Σ β_i·Δy_{t-i} + ε_t，统计量为γ的t值。
+原假设为存在单位根（不平稳），统计量越小越倾向于拒绝。p值按Fuller的临界值表（含常数项，
+Hamilton表B.6情形2）在统计量和样本量两个方向上线性插值，只是近似值，并限定在[0.01, 0.99]。
+The ADF regression has a constant: Δy_t = α + γ·y_{t-1} + Σ β_i·Δy_{t-i} + ε_t,
+and the statistic is the t-value of γ. The null is a unit root (not
+stationary), so smaller statistics argue for rejecting it. The p-value is
+interpolated linearly in both the statistic and the sample size from
+Fuller's critical values with a constant (Hamilton table B.6, case 2); it is
+approximate and bounded to [0.01, 0.99].
+
+检验价差时对冲比例是估计出来的，严格的Engle-Granger检验临界值更小，这里的p值偏乐观。
+When testing a spread the hedge ratio is itself estimated, so the strict
+Engle-Granger critical values are lower and the p-value here is optimistic.
+
+Examples:
+    >>> a, _ = frame_a.column("$close")
+    >>> b, _ = frame_b.column("$close")
+    >>> beta = ols_beta(a, b)
+    >>> stat, p_value = adf_test(spread(a, b, beta))
+"""
+
+import math
+from typing import Dict, List, NamedTuple, Optional, Sequence
+
+import numpy as np
+
+from .stats import InsufficientDataError
+
+
+# Fuller临界值表的累积概率，以及各样本量下统计量的分位数
+_PROBABILITIES = np.array([0.01, 0.025, 0.05, 0.10, 0.90, 0.95, 0.975, 0.99])
+_SAMPLE_SIZES = np.array([25, 50, 100, 250, 500, math.inf])
+_QUANTILES = np.array([
+    [-3.75, -3.33, -3.00, -2.63, -0.37, 0.00, 0.34, 0.72],
+    [-3.58, -3.22, -2.93, -2.60, -0.40, -0.03, 0.29, 0.66],
+    [-3.51, -3.17, -2.89, -2.58, -0.42, -0.05, 0.26, 0.63],
+    [-3.46, -3.14, -2.88, -2.57, -0.42, -0.06, 0.24, 0.62],
+    [-3.44, -3.13, -2.87, -2.57, -0.43, -0.07, 0.24, 0.61],
+    [-3.43, -3.12, -2.86, -2.57, -0.44, -0.07, 0.23, 0.60],
+])
+
+
+class ADFResult(NamedTuple):
+    """ADF检验结果 / Augmented Dickey-Fuller test result"""
+    stat: float  # γ的t值 / t-value of γ
+    p_value: float  # 插值得到的近似p值 / Approximate interpolated p-value
+
+
+def spread(a: Sequence[float], b: Sequence[float], hedge_ratio: float) -> List[float]:
+    """
+    计算价差a - hedge_ratio * b / Compute the spread a - hedge_ratio * b
+    
+    Args:
+        a: 第一个标的的价格序列 / Prices of the first instrument
+        b: 与a等长的第二个标的的价格序列 / Prices of the second instrument, as long as a
+        hedge_ratio: 对冲比例，每单位a对应的b的数量 / Hedge ratio, units of b per unit of a
+    
+    Returns:
+        List[float]: 与输入等长的价差，任一价格为NaN的位置为NaN /
+            Spread as long as the input, NaN wherever either price is
+    
+    Raises:
+        ValueError: 两个序列长度不同或对冲比例不是有限数时抛出 /
+            Raised when the lengths differ or the hedge ratio is not finite
+    """
+    x, y = _pair(a, b)
+    if not math.isfinite(hedge_ratio):
+        raise ValueError(f"hedge_ratio must be finite, got {hedge_ratio}")
+    return (x - hedge_ratio * y).tolist()
+
+
+def ols_beta(y: Sequence[float], x: Sequence[float]) -> float:
+    """
+    带常数项的y对x的OLS回归斜率，作为对冲比例 / Slope of the OLS regression of y on x with a constant, as a hedge ratio
+    
+    只使用两个序列在同一位置都不是NaN的数据对
+    Only positions where neither series is NaN are used
+    
+    Args:
+        y: 被解释变量，如配对中的第一个标的 / Dependent series, e.g. the first leg of the pair
+        x: 与y等长的解释变量 / Explanatory series as long as y
+    
+    Returns:
+        float: 斜率 / Slope
+    
+    Raises:
+        ValueError: 长度不同或x在有效数据对上为常数时抛出 /
+            Raised when the lengths differ or x is constant over the valid pairs
+        InsufficientDataError: 有效数据对少于两个时抛出 / Raised with fewer than two valid pairs
+    """
+    dependent, explanatory = _pair(y, x)
+    both = ~(np.isnan(dependent) | np.isnan(explanatory))
+    pairs = int(both.sum())
+    if pairs < 2:
+        raise InsufficientDataError(f"OLS needs at least 2 valid pairs, got {pairs}")
+    dx = explanatory[both] - explanatory[both].mean()
+    dy = dependent[both] - dependent[both].mean()
+    variance = float((dx * dx).sum())
+    if variance == 0:
+        raise ValueError("x is constant, so the slope is undefined")
+    return float((dx * dy).sum() / variance)
+
+
+def adf_test(series: Sequence[float], lags: Optional[int] = None) -> ADFResult:
+    """
+    增广Dickey-Fuller检验 / Augmented Dickey-Fuller test
+    
+    检验前去掉NaN。lags为None时在0到Schwert规则12·(n/100)^(1/4)之间按AIC选择滞后阶数，
+    各阶数在相同的样本上比较。
+    NaNs are dropped first. With lags None the lag order is chosen by AIC
+    between 0 and Schwert's rule 12·(n/100)^(1/4), comparing every order on
+    the same sample.
+    
+    Args:
+        series: 数值序列，如spread()的结果 / Numeric sequence, such as the result of spread()
+        lags: 差分滞后阶数，None表示自动选择 / Number of lagged differences, None to choose automatically
+    
+    Returns:
+        ADFResult: (统计量, 近似p值)，可以解包为stat, p_value = adf_test(...) /
+            (statistic, approximate p-value); unpacks as stat, p_value = adf_test(...)
+    
+    Raises:
+        ValueError: lags为负数或序列为常数时抛出 / Raised for negative lags or a constant series
+        InsufficientDataError: 有效值太少，无法估计回归时抛出 / Raised with too few valid values to fit the regression
+    """
+    values = np.asarray(series, dtype=float)
+    if values.ndim != 1:
+        raise ValueError(f"series must be one-dimensional, got shape {values.shape}")
+    values = values[~np.isnan(values)]
+    if lags is not None and (isinstance(lags, bool) or not isinstance(lags, (int, np.integer)) or lags < 0):
+        raise ValueError(f"lags must be a non-negative integer, got {lags!r}")
+    if len(values) and np.ptp(values) == 0:
+        raise ValueError("series is constant, so the ADF regression is degenerate")
+    
+    if lags is None:
+        max_lags = int(12 * (len(values) / 100) ** 0.25)
+        # 至少保留比参数多2个观测值
+        max_lags = max(min(max_lags, (len(values) - 5) // 2), 0)
+        _check_length(values, max_lags)
+        lags = min(range(max_lags + 1), key=lambda k: _regress(values, k, max_lags)[1])
+    _check_length(values, lags)
+    stat, _ = _regress(values, lags, lags)
+    return ADFResult(stat, adf_p_value(stat, len(values) - 1 - lags))
+
+
+def adf_critical_values(n: int) -> Dict[str, float]:
+    """
+    ADF检验在样本量n下的临界值 / ADF critical values for a sample of n
+    
+    Args:
+        n: 回归使用的观测值数 / Number of observations in the regression
+    
+    Returns:
+        Dict[str, float]: "1%"、"5%"和"10%"的临界值 / Critical values at "1%", "5%" and "10%"
+    """
+    quantiles = _quantiles(n)
+    return {"1%": float(quantiles[0]), "5%": float(quantiles[2]), "10%": float(quantiles[3])}
+
+
+def adf_p_value(stat: float, n: int) -> float:
+    """
+    由ADF统计量插值近似p值 / Interpolate an approximate p-value from an ADF statistic
+    
+    Args:
+        stat: ADF统计量 / ADF statistic
+        n: 回归使用的观测值数 / Number of observations in the regression
+    
+    Returns:
+        float: 在[0.01, 0.99]之间的近似p值，统计量为NaN时为NaN /
+            Approximate p-value in [0.01, 0.99], NaN for a NaN statistic
+    """
+    if math.isnan(stat):
+        return float("nan")
+    return float(np.interp(stat, _quantiles(n), _PROBABILITIES))
+
+
+def _quantiles(n: int) -> np.ndarray:
+    """按1/n在各样本量的分位数之间线性插值 / Interpolate the quantiles between sample sizes in 1/n"""
+    inverse = 1.0 / _SAMPLE_SIZES
+    target = 1.0 / max(n, 1)
+    # np.interp要求横坐标升序
+    order = np.argsort(inverse)
+    return np.array([
+        np.interp(target, inverse[order], _QUANTILES[order, column])
+        for column in range(len(_PROBABILITIES))
+    ])
+
+
+def _check_length(values: np.ndarray, lags: int) -> None:
+    """回归的观测值必须比参数多至少两个 / The regression needs at least two more observations than parameters"""
+    observations = len(values) - 1 - lags
+    parameters = 2 + lags
+    if observations < parameters + 2:
+        raise InsufficientDataError(
+            f"ADF with {lags} lags needs at least {2 * lags + 5} valid values, got {len(values)}"
+        )
+
+
+def _regress(values: np.ndarray, lags: int, start: int):
+    """
+    拟合ADF回归 / Fit the ADF regression
+    
+    从第start个差分开始取样本，使不同滞后阶数在相同的样本上比较
+    The sample starts at difference number start, so different lag orders are
+    compared on the same sample
+    
+    Returns:
+        Tuple[float, float]: (γ的t值, AIC) / (t-value of γ, AIC)
+    """
+    diffs = np.diff(values)
+    rows = np.arange(start, len(diffs))
+    columns = [np.ones(len(rows)), values[rows]]
+    columns.extend(diffs[rows - lag] for lag in range(1, lags + 1))
+    design = np.column_stack(columns)
+    target = diffs[rows]
+    
+    coef, _, rank, _ = np.linalg.lstsq(design, target, rcond=None)
+    residuals = target - design @ coef
+    observations, parameters = design.shape
+    rss = float(residuals @ residuals)
+    if rank < parameters or rss == 0:
+        return float("nan"), math.inf
+    sigma2 = rss / (observations - parameters)
+    variance = sigma2 * np.linalg.inv(design.T @ design)[1, 1]
+    aic = observations * math.log(rss / observations) + 2 * parameters
+    return float(coef[1] / math.sqrt(variance)), aic
+
+
+def _pair(a: Sequence[float], b: Sequence[float]):
+    """转换为等长的一维浮点数组 / Convert to 1-D float arrays of equal length"""
+    x = np.asarray(a, dtype=float)
+    y = np.asarray(b, dtype=float)
+    if x.ndim != 1 or y.ndim != 1:
+        raise ValueError(f"series must be one-dimensional, got shapes {x.shape} and {y.shape}")
+    if len(x) != len(y):
+        raise ValueError(f"series must have the same length, got {len(x)} and {len(y)}")
+    return x, y
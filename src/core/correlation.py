@@ -0,0 +1,151 @@
+"""
+相关系数矩阵模块 / Correlation Matrix Module
+计算一篮子标的收益率之间的相关系数矩阵，用于配对交易和因子研究
+Computes the correlation matrix of returns across a basket of instruments,
+for pair trading and factor research
+
+每个标的先在自己的K线上计算逐期收益率，再按时间对齐；每对标的只使用两者都有收益率的
+时刻。数据不足的标的不会以NaN行的形式出现在矩阵中，而是连同原因列在excluded中。
+Each instrument's returns are computed on its own bars before the series are
+aligned on time, and each pair only uses timestamps where both have a return.
+Instruments without enough data don't show up as NaN rows; they are listed in
+excluded together with the reason.
+
+Examples:
+    >>> result = manager.get_features(codes, ["$close"], "2023-01-01", "2023-12-31")
+    >>> matrix = correlation_matrix(result, "$close")
+    >>> matrix.get("SH600000", "SH601398")
+"""
+
+from dataclasses import dataclass
+from typing import Dict, List, Mapping
+
+import numpy as np
+import pandas as pd
+
+from .stats import InsufficientDataError
+
+
+DEFAULT_MIN_PERIODS = 20
+
+
+@dataclass
+class CorrelationMatrix:
+    """
+    相关系数矩阵 / Correlation matrix
+    
+    Attributes:
+        frame: 以标的代码为行和列的对称矩阵，对角线为1 /
+            Symmetric matrix labelled by instrument code with ones on the diagonal
+        excluded: 被排除的标的及原因 / Excluded instruments and why
+    """
+    frame: pd.DataFrame
+    excluded: Dict[str, str]
+    
+    @property
+    def instruments(self) -> List[str]:
+        """矩阵中的标的代码 / Instrument codes in the matrix"""
+        return list(self.frame.index)
+    
+    def get(self, a: str, b: str) -> float:
+        """
+        获取两个标的的相关系数 / Get the correlation of two instruments
+        
+        Args:
+            a: 标的代码 / Instrument code
+            b: 标的代码 / Instrument code
+        
+        Returns:
+            float: 相关系数 / Correlation
+        
+        Raises:
+            KeyError: 标的不在矩阵中（未请求或被排除）时抛出 /
+                Raised when an instrument isn't in the matrix, because it wasn't requested or was excluded
+        """
+        for code in (a, b):
+            if code not in self.frame.index:
+                reason = self.excluded.get(code)
+                raise KeyError(f"{code} was excluded: {reason}" if reason else code)
+        return float(self.frame.at[a, b])
+
+
+def correlation_matrix(
+    frames: Mapping[str, pd.DataFrame],
+    field: str = "$close",
+    min_periods: int = DEFAULT_MIN_PERIODS
+) -> CorrelationMatrix:
+    """
+    计算收益率相关系数矩阵 / Compute the return correlation matrix
+    
+    以下标的会被排除：缺少field列；有效收益率少于min_periods期；收益率没有波动。此后若仍有
+    两个标的重叠的期数少于min_periods，则逐个排除重叠不足次数最多的标的（相同时排除有效期数
+    最少的），直到所有标的两两之间都有足够的重叠数据。
+    Instruments are excluded when they lack the field column, have fewer than
+    min_periods valid returns, or have returns that never vary. After that,
+    while some pair overlaps on fewer than min_periods timestamps, the
+    instrument in the most such pairs is dropped (the one with fewer valid
+    returns on a tie), until every remaining pair has enough overlapping data.
+    
+    Args:
+        frames: 以标的代码为键的数据，如FeatureResult / Frames keyed by instrument code, e.g. a FeatureResult
+        field: 价格字段或表达式列名 / Price field or expression column name
+        min_periods: 每对标的至少需要的重叠收益率期数 / Minimum overlapping returns per pair
+    
+    Returns:
+        CorrelationMatrix: 相关系数矩阵 / Correlation matrix
+    
+    Raises:
+        ValueError: min_periods小于2时抛出 / Raised when min_periods is less than 2
+        InsufficientDataError: 剩余标的少于两个时抛出，错误信息包含被排除的标的 /
+            Raised with fewer than two instruments left; the message lists the excluded ones
+    """
+    if min_periods < 2:
+        raise ValueError(f"min_periods must be at least 2, got {min_periods}")
+    
+    excluded: Dict[str, str] = {}
+    columns = {}
+    for code, frame in frames.items():
+        if field not in frame.columns:
+            excluded[code] = f"missing field {field}"
+            continue
+        prices = frame[field].astype(float).replace([np.inf, -np.inf], np.nan)
+        returns = prices / prices.where(prices > 0).shift(1) - 1.0
+        count = int(returns.notna().sum())
+        if count < min_periods:
+            excluded[code] = f"{count} valid returns, fewer than {min_periods}"
+        elif returns.std() == 0:
+            excluded[code] = "returns have no variance"
+        else:
+            columns[code] = returns
+    returns = pd.DataFrame(columns, dtype=float)
+    
+    while len(returns.columns) >= 2:
+        valid = returns.notna().astype(float)
+        overlap = valid.T.dot(valid)
+        short = overlap < min_periods
+        if not short.to_numpy().any():
+            break
+        ranking = pd.DataFrame({
+            "short": short.sum(axis=1),
+            "valid": np.diag(overlap)
+        }).sort_values(["short", "valid"], ascending=[False, True], kind="stable")
+        code = ranking.index[0]
+        partner = short.loc[code][short.loc[code]].index[0]
+        excluded[code] = (
+            f"{int(overlap.at[code, partner])} returns overlapping {partner}, fewer than {min_periods}"
+        )
+        returns = returns.drop(columns=code)
+    
+    if len(returns.columns) < 2:
+        details = ", ".join(f"{code} ({reason})" for code, reason in excluded.items())
+        raise InsufficientDataError(
+            f"correlation matrix needs at least 2 instruments with enough data, "
+            f"got {len(returns.columns)}; excluded: {details or 'none'}"
+        )
+    
+    matrix = returns.corr(min_periods=min_periods)
+    # 完全相同的收益率可能因浮点误差得到略大于1的值
+    matrix = matrix.clip(-1.0, 1.0).mask(np.eye(len(matrix), dtype=bool), 1.0)
+    matrix.index.name = "instrument"
+    matrix.columns.name = "instrument"
+    return CorrelationMatrix(frame=matrix, excluded=excluded)
@@ -0,0 +1,129 @@
+"""
+截面运算模块 / Cross-Sectional Operations Module
+在同一时刻的所有标的之间计算排名、标准化、去均值和缩尾
+Rank, z-score, demean and winsorize across instruments at each timestamp
+
+输入为以时间为行、标的为列的宽表，返回形状相同的宽表。每一行单独计算，
+某个标的在该行缺失（NaN）时不参与该行的统计量，结果中仍为NaN。
+Inputs are wide frames with timestamps as rows and instruments as columns,
+and the result has the same shape. Each row is computed on its own; an
+instrument missing (NaN) on a row is left out of that row's statistics and
+stays NaN in the result.
+
+表达式中可以使用CSRank、CSZScore、CSDemean和CSWinsorize，见expression_engine。
+The expression engine exposes these as CSRank, CSZScore, CSDemean and
+CSWinsorize.
+
+Examples:
+    >>> result = manager.get_features(codes, ["$close"], "2023-01-01", "2023-12-31")
+    >>> ranks = cs_rank(to_wide(result, "$close"))
+"""
+
+from typing import Mapping
+
+import numpy as np
+import pandas as pd
+
+
+def cs_rank(frame: pd.DataFrame) -> pd.DataFrame:
+    """
+    截面百分位排名 / Cross-sectional percentile rank
+    
+    排名取值(0, 1]，相同值取平均排名，与Rolling.rank的约定一致
+    Ranks lie in (0, 1] with ties averaged, matching Rolling.rank
+    
+    Args:
+        frame: 时间×标的宽表 / Time-by-instrument wide frame
+    
+    Returns:
+        pd.DataFrame: 形状相同的排名 / Ranks of the same shape
+    """
+    return _as_frame(frame).rank(axis=1, method="average", pct=True)
+
+
+def cs_zscore(frame: pd.DataFrame) -> pd.DataFrame:
+    """
+    截面标准化 / Cross-sectional z-score
+    
+    减去截面均值后除以截面样本标准差（ddof=1）；有效标的少于两个或
+    所有值相同的行为NaN
+    Subtracts the row mean and divides by the row's sample std (ddof=1);
+    rows with fewer than two valid instruments or no dispersion are NaN
+    
+    Args:
+        frame: 时间×标的宽表 / Time-by-instrument wide frame
+    
+    Returns:
+        pd.DataFrame: 形状相同的标准分 / Z-scores of the same shape
+    """
+    frame = _as_frame(frame)
+    std = frame.std(axis=1, ddof=1)
+    return _demean(frame).div(std.where(std > 0), axis=0)
+
+
+def cs_demean(frame: pd.DataFrame) -> pd.DataFrame:
+    """
+    截面去均值 / Cross-sectional demean
+    
+    Args:
+        frame: 时间×标的宽表 / Time-by-instrument wide frame
+    
+    Returns:
+        pd.DataFrame: 形状相同的去均值结果 / Demeaned values of the same shape
+    """
+    return _demean(_as_frame(frame))
+
+
+def cs_winsorize(frame: pd.DataFrame, lower: float, upper: float) -> pd.DataFrame:
+    """
+    截面缩尾 / Cross-sectional winsorize
+    
+    把每一行截断到该行的lower和upper分位数之间，分位数按线性插值计算
+    Clips each row to its lower and upper quantiles, computed with linear
+    interpolation
+    
+    Args:
+        frame: 时间×标的宽表 / Time-by-instrument wide frame
+        lower: 下分位数，取值[0, 1] / Lower quantile in [0, 1]
+        upper: 上分位数，取值[lower, 1] / Upper quantile in [lower, 1]
+    
+    Returns:
+        pd.DataFrame: 形状相同的缩尾结果 / Winsorized values of the same shape
+    
+    Raises:
+        ValueError: 分位数不满足0 <= lower <= upper <= 1时抛出 /
+            Raised unless 0 <= lower <= upper <= 1
+    """
+    lower, upper = float(lower), float(upper)
+    if not 0.0 <= lower <= upper <= 1.0:
+        raise ValueError(f"quantiles must satisfy 0 <= lower <= upper <= 1, got {lower} and {upper}")
+    frame = _as_frame(frame)
+    bounds = frame.quantile([lower, upper], axis=1)
+    return frame.clip(lower=bounds.iloc[0], upper=bounds.iloc[1], axis=0)
+
+
+def to_wide(frames: Mapping[str, pd.DataFrame], field: str) -> pd.DataFrame:
+    """
+    把多标的结果中的一个字段转为宽表 / Pivot one field of a multi-instrument result into a wide frame
+    
+    Args:
+        frames: 以标的代码为键的数据，如FeatureResult / Frames keyed by instrument code, e.g. a FeatureResult
+        field: 字段或表达式列名 / Field or expression column name
+    
+    Returns:
+        pd.DataFrame: 行为所有标的时间的并集、列为标的代码的宽表 /
+            Wide frame over the union of timestamps with one column per instrument
+    """
+    columns = {code: frame[field] for code, frame in frames.items()}
+    wide = pd.DataFrame(columns, dtype=float)
+    wide.columns.name = "instrument"
+    return wide
+
+
+def _as_frame(frame: pd.DataFrame) -> pd.DataFrame:
+    """转为浮点宽表，正负无穷视为缺失 / Cast to float, treating infinities as missing"""
+    return pd.DataFrame(frame).astype(float).replace([np.inf, -np.inf], np.nan)
+
+
+def _demean(frame: pd.DataFrame) -> pd.DataFrame:
+    return frame.sub(frame.mean(axis=1), axis=0)
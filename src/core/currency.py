@@ -0,0 +1,246 @@
+"""
+货币模块 / Currency Module
+标的的计价货币，以及把外币金额折算为基准货币的每日汇率
+Quote currencies of instruments and the daily FX rates that convert foreign
+amounts into a base currency
+
+标的的货币先查register_currency()注册的代码，再按交易所前缀（SH、SZ、BJ为人民币，HK为港币），
+都没有时为人民币。汇率是普通的时间序列，代码为两个货币代码相连，如"HKDCNY"表示1港币兑换的
+人民币，由任意数据提供者按$close字段提供；只有反向序列（如"CNYHKD"）时取倒数。估值日没有
+汇率时使用此前最近的汇率，但不能早于max_staleness，否则抛出FXRateUnavailableError。
+An instrument's currency comes from register_currency() first, then from
+its exchange prefix (SH, SZ and BJ in yuan, HK in Hong Kong dollars), and is
+the yuan otherwise. FX rates are ordinary time series whose code joins two
+currency codes, e.g. "HKDCNY" for the yuan one Hong Kong dollar buys, served
+by any data provider as the $close field; with only the reverse series (e.g.
+"CNYHKD") its reciprocal is used. A valuation date without a rate uses the
+latest earlier one, but no older than max_staleness, past which
+FXRateUnavailableError is raised.
+
+Examples:
+    >>> fx = FXProvider({"HKDCNY": pd.Series([0.92, 0.93], index=pd.to_datetime(["2025-01-02", "2025-01-03"]))})
+    >>> fx.rate("HKD", "CNY", "2025-01-06")
+    0.93
+    >>> get_currency("HK00700")
+    'HKD'
+"""
+
+import math
+import threading
+from typing import Dict, Mapping, Optional, Union
+
+import pandas as pd
+
+from ..infrastructure.data_provider import DataProvider, InstrumentNotFoundError
+from ..utils.error_handler import DataError, ErrorCategory, ErrorInfo, ErrorSeverity
+from .feature_frame import TimeLike
+
+
+# 组合和回测未指定时使用的基准货币 / Base currency when a portfolio or backtest names none
+BASE_CURRENCY = "CNY"
+
+RATE_FIELD = "$close"
+
+# 交易所前缀对应的货币 / Currency of each exchange prefix
+_MARKET_CURRENCIES: Dict[str, str] = {"SH": "CNY", "SZ": "CNY", "BJ": "CNY", "HK": "HKD"}
+
+# 单独注册的标的货币，键为标的代码
+_CURRENCIES: Dict[str, str] = {}
+_currencies_lock = threading.Lock()
+
+
+class FXRateUnavailableError(DataError):
+    """
+    汇率不可用错误 / FX rate unavailable error
+    
+    没有该货币对的汇率序列，或估值日之前max_staleness内没有汇率时抛出
+    Raised when there is no series for the currency pair, or no rate within
+    max_staleness before the valuation date
+    """
+    
+    def __init__(self, pair: str, time: Optional[pd.Timestamp] = None, last: Optional[pd.Timestamp] = None):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            pair: 货币对，如"HKDCNY" / Currency pair, e.g. "HKDCNY"
+            time: 估值日，没有汇率序列时为None / Valuation date, None when the series is missing
+            last: 估值日之前最后一个汇率的日期 / Date of the last rate before the valuation date
+        """
+        self.pair = pair
+        self.time = time
+        self.last = last
+        if time is None:
+            message_zh, message_en = f"没有汇率序列: {pair}", f"No FX series for {pair}"
+        else:
+            since = f"，最近的汇率在{last}" if last is not None else ""
+            message_zh = f"{pair}在{time}没有可用的汇率{since}"
+            message_en = f"No usable {pair} rate on {time}" + (f", the latest is from {last}" if last is not None else "")
+        error_info = ErrorInfo(
+            error_code="DAT0035",
+            error_message_zh=message_zh,
+            error_message_en=message_en,
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"pair={pair}, time={time}, last={last}",
+            suggested_actions=[
+                f"确认数据源提供{pair}（或反向货币对）的汇率序列",
+                "汇率停更时增大FXProvider的max_staleness"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def register_currency(instrument: str, currency: str) -> None:
+    """
+    注册或覆盖标的的计价货币 / Register or replace the quote currency of an instrument
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+        currency: 三位货币代码，如"HKD" / Three-letter currency code, e.g. "HKD"
+    """
+    currency = _check_currency(currency)
+    with _currencies_lock:
+        _CURRENCIES[instrument] = currency
+
+
+def get_currency(instrument: str) -> str:
+    """
+    查找标的的计价货币 / Look up the quote currency of an instrument
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+    
+    Returns:
+        str: 货币代码，未注册且前缀未知时为BASE_CURRENCY /
+            Currency code; BASE_CURRENCY when neither registered nor a known prefix
+    """
+    currency = _CURRENCIES.get(instrument)
+    if currency is not None:
+        return currency
+    return _MARKET_CURRENCIES.get(instrument[:2].upper(), BASE_CURRENCY)
+
+
+def fx_pair(from_currency: str, to_currency: str) -> str:
+    """汇率序列的代码，如fx_pair("HKD", "CNY")为"HKDCNY" / Code of the FX series, e.g. "HKDCNY" for fx_pair("HKD", "CNY")"""
+    return f"{_check_currency(from_currency)}{_check_currency(to_currency)}"
+
+
+def _check_currency(currency: str) -> str:
+    if not (isinstance(currency, str) and len(currency) == 3 and currency.isalpha()):
+        raise ValueError(f"currency must be a three-letter code such as HKD, got {currency!r}")
+    return currency.upper()
+
+
+class FXProvider:
+    """
+    每日汇率 / Daily FX rates
+    
+    汇率序列第一次使用时读取并缓存，之后的查询不再访问数据源
+    Each series is read and cached on first use, so later lookups don't
+    touch the source again
+    """
+    
+    def __init__(
+        self,
+        source: Union[DataProvider, Mapping[str, pd.Series]],
+        max_staleness: Union[str, pd.Timedelta] = "7D"
+    ):
+        """
+        初始化汇率提供者 / Initialize FX provider
+        
+        Args:
+            source: 按货币对代码提供$close序列的数据提供者，或货币对到汇率序列的映射 /
+                Data provider serving $close under the pair code, or a mapping of pair to rate series
+            max_staleness: 估值日没有汇率时可以沿用的最旧汇率距估值日的时间 /
+                How old the latest earlier rate may be when the valuation date has none
+        """
+        self._max_staleness = pd.Timedelta(max_staleness)
+        if self._max_staleness < pd.Timedelta(0):
+            raise ValueError(f"max_staleness must be non-negative, got {max_staleness}")
+        self._provider = source if isinstance(source, DataProvider) else None
+        self._series: Dict[str, Optional[pd.Series]] = {}
+        if self._provider is None:
+            for pair, series in source.items():
+                self._series[pair] = self._clean(series).rename(pair)
+        self._lock = threading.Lock()
+    
+    @property
+    def max_staleness(self) -> pd.Timedelta:
+        """可以沿用的汇率的最长时间 / Longest a rate may be carried forward"""
+        return self._max_staleness
+    
+    def rates(self, from_currency: str, to_currency: str) -> pd.Series:
+        """
+        获取汇率序列 / Get the rate series
+        
+        Args:
+            from_currency: 被折算的货币 / Currency converted from
+            to_currency: 折算成的货币 / Currency converted into
+        
+        Returns:
+            pd.Series: 以日期为索引，每单位from_currency兑换的to_currency /
+                Indexed by date, units of to_currency per unit of from_currency
+        
+        Raises:
+            FXRateUnavailableError: 两个方向的序列都没有时抛出 / Raised when neither direction has a series
+        """
+        pair = fx_pair(from_currency, to_currency)
+        if from_currency.upper() == to_currency.upper():
+            raise ValueError(f"{pair} converts a currency into itself")
+        series = self._load(pair)
+        if series is not None:
+            return series
+        inverse = self._load(fx_pair(to_currency, from_currency))
+        if inverse is not None:
+            return (1.0 / inverse).rename(pair)
+        raise FXRateUnavailableError(pair)
+    
+    def rate(self, from_currency: str, to_currency: str, time: TimeLike) -> float:
+        """
+        获取估值日的汇率 / Get the rate on a valuation date
+        
+        Args:
+            from_currency: 被折算的货币 / Currency converted from
+            to_currency: 折算成的货币 / Currency converted into
+            time: 估值日 / Valuation date
+        
+        Returns:
+            float: 每单位from_currency兑换的to_currency，相同货币为1 /
+                Units of to_currency per unit of from_currency; 1 for the same currency
+        
+        Raises:
+            FXRateUnavailableError: 没有序列，或max_staleness内没有汇率时抛出 /
+                Raised without a series or without a rate within max_staleness
+        """
+        if from_currency.upper() == to_currency.upper():
+            return 1.0
+        series = self.rates(from_currency, to_currency)
+        ts = pd.Timestamp(time)
+        pos = int(series.index.searchsorted(ts, side="right"))
+        if pos == 0:
+            raise FXRateUnavailableError(series.name, ts)
+        last = series.index[pos - 1]
+        if ts - last > self._max_staleness:
+            raise FXRateUnavailableError(series.name, ts, last)
+        return float(series.iloc[pos - 1])
+    
+    def _load(self, pair: str) -> Optional[pd.Series]:
+        with self._lock:
+            if pair in self._series or self._provider is None:
+                return self._series.get(pair)
+            try:
+                frame = self._provider.load_features(pair, [RATE_FIELD])
+                series = self._clean(frame[RATE_FIELD].rename(pair))
+            except InstrumentNotFoundError:
+                series = None
+            self._series[pair] = series
+            return series
+    
+    @staticmethod
+    def _clean(series: pd.Series) -> pd.Series:
+        """去掉缺失和非正数的汇率并按日期排序 / Drop missing and non-positive rates and sort by date"""
+        series = pd.Series(series, dtype=float)
+        series.index = pd.DatetimeIndex(series.index)
+        return series[(series > 0) & (series < math.inf)].sort_index()
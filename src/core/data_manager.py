@@ -4,15 +4,35 @@
 Responsible for data download, validation, integrity check, and missing value handling
 """
 
+import logging
+import os
+import time
+
+import numpy as np
 import pandas as pd
+from concurrent.futures import FIRST_COMPLETED, ThreadPoolExecutor, wait
 from pathlib import Path
-from typing import Optional, Dict, Any, Tuple, List
-from dataclasses import dataclass
+from typing import Callable, Optional, Dict, Any, Tuple, List, Union
+from dataclasses import dataclass, fields as dataclass_fields, replace
 from datetime import datetime
 from enum import Enum
 
-from ..infrastructure.logger_system import get_logger
+from ..infrastructure.logger_system import current_logger, get_logger, log_enabled
 from ..infrastructure.qlib_wrapper import QlibWrapper, QlibDataError
+from ..infrastructure.data_provider import (
+    ALL_MARKET,
+    AdjustmentsUnavailableError,
+    CorporateAction,
+    DataProvider,
+    FreqLike,
+    FundamentalsUnavailableError,
+    QlibDataProvider,
+    get_provider,
+    get_default_provider,
+    is_intraday,
+    to_freq
+)
+from ..infrastructure.subscription import Subscription
 from ..utils.error_handler import (
     DataError,
     ErrorInfo,
@@ -22,6 +42,58 @@ from ..utils.error_handler import (
     get_error_handler
 )
 from ..utils.cache_manager import get_cache_manager
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from ..utils.retry import RetryPolicy
+from .delisting import get_delisting
+from .feature_frame import DISPLAY_TZ_ATTR, TIMEZONE_ATTR, FeatureFetchError, FeatureFrame, FeatureResult, PartialFetchError
+from .fundamentals import DEFAULT_MAX_STALENESS, load_with_fundamentals, to_staleness
+from .expression_engine import Expression, ExpressionError, parse_expression, is_raw_field
+from .feature_stream import FeatureIterator, FeatureRequest, plan_windows
+from .instrument import InstrumentCodeError, normalize_instrument
+from .lazy_frame import LazyFeatureFrame
+from .market_sessions import instrument_calendar
+from .request_time import DEFAULT_TIMEZONE, check_timezone, format_request_time, parse_request_range
+from .trading_calendar import (
+    DEFAULT_FILL_KEY,
+    FillPolicy,
+    FillPolicyLike,
+    TradingCalendar,
+    get_calendar as get_trading_calendar
+)
+from .query import parse_query
+from .universe import Universe, get_universe
+from .validation import DataValidationError, ValidationOptions, ValidationReport, repair_frame, validate_frame
+from .price_adjustment import AdjustMode, FACTOR_FIELD, adjust_prices, needs_factor, to_adjust_mode
+
+
+# 进度回调，参数为(已完成的标的数, 标的总数)，每完成一个标的调用一次，总在调用线程中调用，
+# 因此不需要线程安全 / Progress callback taking (instruments done, total instruments), called once
+# per finished instrument and always on the calling thread, so it needn't be thread-safe
+ProgressCallback = Callable[[int, int], None]
+
+
+def default_max_workers() -> int:
+    """默认并发线程数，等于CPU核数 / Default worker count, the number of CPUs"""
+    return os.cpu_count() or 1
+
+
+def _fill_missing(
+    frame: pd.DataFrame,
+    default: FillPolicy,
+    policies: Dict[str, FillPolicy]
+) -> pd.DataFrame:
+    """按列的填充策略填充缺失值，未列出的列使用default / Fill missing values per column, default for unlisted columns"""
+    groups: Dict[FillPolicy, List[str]] = {}
+    for column in frame.columns:
+        groups.setdefault(policies.get(column, default), []).append(column)
+    for policy, columns in groups.items():
+        if policy == FillPolicy.FORWARD_FILL:
+            frame[columns] = frame[columns].ffill()
+        elif policy == FillPolicy.BACKWARD_FILL:
+            frame[columns] = frame[columns].bfill()
+        elif policy == FillPolicy.ZERO:
+            frame[columns] = frame[columns].fillna(0)
+    return frame
 
 
 class MissingValueStrategy(Enum):
@@ -60,6 +132,163 @@ class DataInfo:
     last_updated: Optional[str] = None
 
 
+@dataclass(frozen=True)
+class FeatureOptions:
+    """
+    get_features()单次调用的选项 / Per-call options of get_features()
+    
+    与查询本身（标的、字段和时间区间）分开，可以构造一次后在多次调用之间复用；调用时的关键字
+    参数按名称覆盖其中的字段。以下的ctx指get_features_ctx()的请求上下文。
+    Kept apart from the query itself (instruments, fields and range) so one
+    instance can be built once and reused across calls; keyword arguments at
+    the call override its fields by name. ctx below is the request context of
+    get_features_ctx().
+    
+    Attributes:
+        freq: 数据频率，"1min"、"5min"、"15min"、"60min"、"day"或对应的Freq，默认为"day"；
+            返回的索引为完整时间戳，提供者没有该频率的数据时抛出UnsupportedFrequencyError /
+            Data frequency, one of "1min", "5min", "15min", "60min" or "day"
+            (default) or the matching Freq; the index holds full timestamps, and
+            UnsupportedFrequencyError is raised when the provider has no bars at it
+        max_workers: 并发线程数，None表示使用管理器默认值（默认为CPU核数） /
+            Worker count, None uses the manager default (the CPU count unless configured)
+        provider: 提供者实例或已注册的提供者名称（如"csv"），None表示使用默认提供者 /
+            Provider instance or registered provider name (e.g. "csv"), None uses the default
+        calendar: 交易日历或市场名称（如"SSE"），提供时区间收缩到交易日并丢弃非交易日的行 /
+            Trading calendar or market name (e.g. "SSE"); snaps the range and drops non-session rows
+        align: 是否把所有标的对齐到共享时间轴 / Whether to align instruments onto a shared time axis
+        fill_policy: 对齐时缺失K线的填充策略，可以是一个策略，也可以是字段到策略的映射，
+            映射中DEFAULT_FILL_KEY（"*"）的策略用于未列出的字段，没有时为FillPolicy.NAN。
+            每一列依次取：映射中该列本身的策略；表达式列引用的原始字段的策略（全部相同时）；
+            默认策略。DROP删除整行，只能作为默认策略 / Fill policy for missing bars
+            when aligning: one policy, or a map of field to policy whose
+            DEFAULT_FILL_KEY ("*") entry covers unlisted fields, FillPolicy.NAN
+            without one. Each column takes, in order, its own entry in the map;
+            for an expression, the policy of the raw fields it references when
+            they all agree; the default. DROP removes whole rows and can only be
+            the default
+        adjust: 复权方式，"none"不复权、"pre"前复权、"post"后复权，None表示按提供者原样返回；
+            复权在查询时根据$factor计算，表达式使用复权后的价格 / Adjustment mode:
+            "none", "pre" (forward) or "post" (backward); None returns prices as the
+            provider stores them. Applied at query time from $factor, and
+            expressions see the adjusted prices
+        timeout: 本次请求的超时秒数，与ctx的截止时间取较早者 /
+            Timeout of this request in seconds; the earlier of it and ctx's deadline applies
+        retry: 提供者调用遇到暂时性错误时的重试策略，None表示使用管理器的默认策略；
+            重试用尽的标的以RetryExhaustedError记录在errors中 / Retry policy for
+            transient provider failures, None uses the manager default; instruments
+            that exhaust it are recorded in errors as RetryExhaustedError
+        strict: 严格模式，未通过校验的标的以DataValidationError记录在errors中而不返回数据 /
+            Strict mode: instruments failing validation are recorded in errors as
+            DataValidationError instead of being returned
+        validation: 校验和修复选项，提供或strict为True时校验每个标的（在对齐之前），报告在
+            FeatureResult.reports中；缺失交易日只在提供calendar时检查 /
+            Validation and repair options; when given, or when strict is True, each
+            instrument is validated before alignment and the reports land in
+            FeatureResult.reports. Missing trading days are only checked with a calendar
+        progress: 进度回调progress(done, total)，每完成一个标的（成功或失败）调用一次，共total次，
+            最后一次done等于total；并行获取时也只在调用线程中调用，回调不需要线程安全。
+            截面表达式的计算不计入进度 / Progress callback progress(done, total), called
+            once per finished instrument, failed or not, so total times with the last
+            call at done == total. Even when fetching in parallel it is only called on
+            the calling thread, so it needn't be thread-safe. Cross-sectional
+            evaluation afterwards is not counted
+        fail_fast: 为True时某个标的失败即取消其余标的，并抛出只包含该标的的FeatureFetchError /
+            When True the first failing instrument cancels the others and a
+            FeatureFetchError holding just that instrument is raised
+        timezone: 交易所时区，None表示使用calendar的时区，没有时使用管理器的默认时区 /
+            Exchange timezone; None uses calendar's timezone, falling back to the manager default
+        lazy: 为True时不立即获取数据，结果中的值为LazyFeatureFrame，每个字段在第一次访问时
+            才为该标的加载（见core.lazy_frame）；加载在ctx下进行，错误在访问时抛出。不能与
+            align、strict、validation或截面表达式同时使用 / When True nothing is fetched
+            up front and the result holds LazyFeatureFrames, each field loaded for its
+            instrument on first access (see core.lazy_frame); loads run under ctx and
+            errors are raised on access. Cannot be combined with align, strict,
+            validation or cross-sectional expressions
+        defer_expressions: 为True时原始字段照常获取，表达式只解析不计算，结果中的值为
+            LazyFeatureFrame，每个表达式列在第一次访问时才计算并保存，未访问的列不计算；
+            计算在ctx下进行，错误在访问时抛出。限制与lazy相同 / When True the raw fields
+            are fetched as usual but expressions are only parsed, and the result holds
+            LazyFeatureFrames whose expression columns are each computed and kept on
+            first access, so columns never read are never computed; evaluation runs
+            under ctx and errors are raised on access. Same restrictions as lazy
+        utc: 为True时把每个标的的交易所本地时间索引按其市场的时区（见core.market_sessions）
+            转换为UTC，不同市场的标的因此可以直接对齐比较；夏令时切换前后不会产生重复或缺失的
+            K线。attrs["timezone"]为该标的的交易所时区，resample_bars()按其当地日期划分日线。
+            不能与lazy、defer_expressions或align同时使用 / When True each instrument's
+            exchange-local index is converted to UTC from its market's timezone
+            (see core.market_sessions), so instruments of different markets line up
+            directly, with no bars duplicated or lost around daylight-saving changes.
+            attrs["timezone"] holds the exchange timezone, whose local dates
+            resample_bars() splits days by. Cannot be combined with lazy,
+            defer_expressions or align
+        display_tz: utc为True时切片使用的时区，存入attrs["display_tz"]，FeatureFrame.slice()
+            按其解释"2025-01-02"等不带时区的时间；None表示解释请求时间所用的时区 /
+            With utc, the timezone slicing reads naive times such as "2025-01-02"
+            in, stored as attrs["display_tz"] for FeatureFrame.slice(); None uses
+            the timezone the request times are read in
+    
+    Raises:
+        ValueError: lazy、defer_expressions或utc与不支持的选项同时使用时抛出 /
+            Raised when lazy, defer_expressions or utc is combined with an unsupported option
+    """
+    freq: FreqLike = "day"
+    max_workers: Optional[int] = None
+    provider: Optional[Union[str, DataProvider]] = None
+    calendar: Optional[Union[str, TradingCalendar]] = None
+    align: bool = False
+    fill_policy: FillPolicyLike = FillPolicy.NAN
+    adjust: Optional[Union[str, AdjustMode]] = None
+    timeout: Optional[float] = None
+    retry: Optional[RetryPolicy] = None
+    strict: bool = False
+    validation: Optional[ValidationOptions] = None
+    progress: Optional[ProgressCallback] = None
+    fail_fast: bool = False
+    timezone: Optional[str] = None
+    lazy: bool = False
+    defer_expressions: bool = False
+    utc: bool = False
+    display_tz: Optional[str] = None
+    
+    def __post_init__(self):
+        if self.deferred and (self.align or self.strict or self.validation is not None):
+            option = "lazy" if self.lazy else "defer_expressions"
+            raise ValueError(
+                f"{option} cannot be combined with align, strict, validation or cross-sectional expressions"
+            )
+        if self.utc and (self.deferred or self.align):
+            raise ValueError("utc cannot be combined with lazy, defer_expressions or align")
+    
+    @property
+    def deferred(self) -> bool:
+        """是否推迟加载或计算（lazy或defer_expressions） / Whether loading or evaluation is deferred (lazy or defer_expressions)"""
+        return self.lazy or self.defer_expressions
+    
+    @classmethod
+    def of(cls, options: Optional["FeatureOptions"], overrides: Dict[str, Any]) -> "FeatureOptions":
+        """
+        在options上按名称应用覆盖 / Apply overrides by name on top of options
+        
+        Args:
+            options: 基础选项，None表示默认选项 / Base options, None for the defaults
+            overrides: 字段名到取值的映射 / Mapping of field name to value
+        
+        Returns:
+            FeatureOptions: 覆盖后的选项，没有覆盖时为options本身 / The overridden options, options itself without overrides
+        
+        Raises:
+            TypeError: 覆盖中有未知的字段名时抛出 / Raised when an override names an unknown field
+        """
+        options = options if options is not None else cls()
+        if not overrides:
+            return options
+        unknown = sorted(set(overrides) - {f.name for f in dataclass_fields(cls)})
+        if unknown:
+            raise TypeError(f"unknown feature options: {', '.join(unknown)}")
+        return replace(options, **overrides)
+
+
 # 移除旧的异常类，使用新的错误处理系统
 # Removed old exception class, using new error handling system
 
@@ -75,18 +304,51 @@ class DataManager:
     - 处理缺失值
     """
     
-    def __init__(self, qlib_wrapper: Optional[QlibWrapper] = None, enable_cache: bool = True):
+    def __init__(
+        self,
+        qlib_wrapper: Optional[QlibWrapper] = None,
+        enable_cache: bool = True,
+        max_workers: Optional[int] = None,
+        provider: Optional[DataProvider] = None,
+        retry_policy: Optional[RetryPolicy] = None,
+        fundamental_staleness: Optional[Union[str, pd.Timedelta]] = DEFAULT_MAX_STALENESS,
+        timezone: str = DEFAULT_TIMEZONE
+    ):
         """
         初始化数据管理器
         
         Args:
             qlib_wrapper: QlibWrapper实例，如果为None则创建新实例
             enable_cache: 是否启用缓存 / Whether to enable cache
+            max_workers: 多标的并发获取和表达式计算的默认线程数，None表示CPU核数 /
+                Default worker count for multi-instrument fetches and expression evaluation, None for the CPU count
+            provider: 特征数据提供者，None表示使用set_default_provider()设置的全局默认提供者，
+                未设置时使用基于qlib_wrapper的提供者 / Feature data provider; None uses the
+                global default from set_default_provider(), falling back to the qlib_wrapper-backed provider
+            retry_policy: 提供者调用遇到暂时性错误时的默认重试策略，None表示不重试 /
+                Default retry policy for transient provider failures, None disables retries
+            fundamental_staleness: 基本面字段（如$pb）距离公告日的最大陈旧期，超过后为NaN，
+                None表示一直向前填充 / Max age of a fundamental field (e.g. $pb) past its
+                announcement before it turns NaN; None forward-fills indefinitely
+            timezone: 默认的交易所时区，只有日期的请求时间解释为该时区的零点，带偏移的时间转换到该时区 /
+                Default exchange timezone; date-only request times mean midnight there
+                and times with an offset are converted to it
         """
+        if max_workers is None:
+            max_workers = default_max_workers()
+        if max_workers < 1:
+            raise ValueError(f"max_workers must be positive, got {max_workers}")
+        
         self._qlib_wrapper = qlib_wrapper or QlibWrapper()
+        self._provider = provider
+        self._qlib_provider = QlibDataProvider(self._qlib_wrapper)
         self._logger = get_logger(__name__)
         self._initialized = False
         self._enable_cache = enable_cache
+        self._max_workers = max_workers
+        self._retry_policy = retry_policy
+        self._fundamental_staleness = to_staleness(fundamental_staleness)
+        self._timezone = check_timezone(timezone)
         # 限制内存缓存大小为50个条目，避免内存泄漏
         self._cache_manager = get_cache_manager(max_memory_items=50) if enable_cache else None
     
@@ -103,7 +365,7 @@ class DataManager:
             data_path: 数据路径 / Data path
             region: 市场区域，默认为"cn" / Market region, default is "cn"
             auto_mount: 是否自动挂载数据 / Whether to auto-mount data
-            
+        
         Raises:
             DataError: 初始化失败时抛出 / Raised when initialization fails
         """
@@ -119,7 +381,7 @@ class DataManager:
             
             self._initialized = True
             self._logger.info("数据管理器初始化成功")
-            
+        
         except Exception as e:
             error_info = ErrorInfo(
                 error_code="DAT0001",
@@ -157,7 +419,7 @@ class DataManager:
             interval: 数据间隔，默认为"1d"（日线） / Data interval, default is "1d" (daily)
             start_date: 开始日期（可选） / Start date (optional)
             end_date: 结束日期（可选） / End date (optional)
-            
+        
         Raises:
             DataError: 下载失败时抛出 / Raised when download fails
         """
@@ -192,7 +454,7 @@ class DataManager:
                     "数据下载功能需要手动执行qlib的数据下载命令。"
                     "请参考qlib文档进行数据下载。"
                 )
-                
+            
             except ImportError as e:
                 error_info = ErrorInfo(
                     error_code="DAT0002",
@@ -210,7 +472,7 @@ class DataManager:
                     original_exception=e
                 )
                 raise DataError(error_info)
-            
+        
         except DataError:
             raise
         except Exception as e:
@@ -246,7 +508,7 @@ class DataManager:
             start_date: 开始日期（可选）
             end_date: 结束日期（可选）
             instruments: 股票池，默认为"csi300"
-            
+        
         Returns:
             ValidationResult: 验证结果
         """
@@ -328,7 +590,7 @@ class DataManager:
                         issues.append(f"数据缺失率过高: {missing_ratio:.2%}")
                     elif missing_ratio > 0.1:
                         issues.append(f"数据存在缺失值: {missing_ratio:.2%}")
-                    
+            
             except Exception as e:
                 issues.append(f"样本数据获取失败: {str(e)}")
             
@@ -360,7 +622,7 @@ class DataManager:
                 self._cache_manager.set(cache_key, result, ttl=3600)
             
             return result
-            
+        
         except Exception as e:
             error_msg = f"数据验证失败: {str(e)}"
             self._logger.error(error_msg, exc_info=True)
@@ -370,6 +632,1144 @@ class DataManager:
                 issues=[error_msg]
             )
     
+    def get_features(
+        self,
+        instruments: Union[str, List[str], Universe],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        options: Optional[FeatureOptions] = None,
+        **overrides: Any
+    ) -> FeatureResult:
+        """
+        获取一个或多个标的的特征数据 / Get feature data for one or more instruments
+        
+        等价于使用不会取消的上下文调用get_features_ctx()，参数说明见该方法
+        Same as get_features_ctx() with a context that is never cancelled; see
+        it for the parameters
+        """
+        return self.get_features_ctx(background(), instruments, fields, start_time, end_time, options, **overrides)
+    
+    def query(self, text: str, provider: Optional[Union[str, DataProvider]] = None, **options: Any) -> FeatureResult:
+        """
+        按查询文本获取特征数据 / Get feature data from query text
+        
+        查询写作"标的.字段[开始:结束]@频率"，如"SH000300.$close[2025-01-01:2025-06-30]"、
+        "SH600000,SZ000001.Mean($close, 5)[2025-01-01:]@5min"；"CSI300.*.$close[...]"
+        展开为指数在区间内的成分股，与传入get_universe("CSI300")相同。语法见query模块。
+        The query reads "INSTRUMENTS.FIELD[start:end]@freq", e.g.
+        "SH000300.$close[2025-01-01:2025-06-30]" or
+        "SH600000,SZ000001.Mean($close, 5)[2025-01-01:]@5min";
+        "CSI300.*.$close[...]" expands to the index's constituents over the range,
+        the same as passing get_universe("CSI300"). See the query module for the
+        grammar.
+        
+        Args:
+            text: 查询文本 / Query text
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+            **options: 传给get_features()的其他参数，如adjust、align / Other get_features() arguments, such as adjust or align
+        
+        Returns:
+            FeatureResult: 与get_features()相同，列以字段文本命名 / Same as get_features(), the column named by the field text
+        
+        Raises:
+            QuerySyntaxError: 查询格式错误时抛出，包含出错位置 / Raised with the offending position on malformed queries
+            DataError: 通配的指数找不到成分股文件时抛出 / Raised when a wildcard index has no membership file
+        """
+        parsed = parse_query(text)
+        instruments = get_universe(parsed.universe) if parsed.universe is not None else parsed.instruments
+        self._logger.debug(f"查询: {text}")
+        return self.get_features(
+            instruments, [parsed.field],
+            start_time=parsed.start_time, end_time=parsed.end_time, freq=parsed.freq,
+            provider=provider, **options
+        )
+    
+    def get_features_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: Union[str, List[str], Universe],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        options: Optional[FeatureOptions] = None,
+        **overrides: Any
+    ) -> FeatureResult:
+        """
+        获取一个或多个标的的特征数据 / Get feature data for one or more instruments
+        
+        每个标的的读取和表达式计算在线程池中单独进行，结果按请求顺序组装，与完成顺序无关。
+        某个标的失败不会影响其他标的，失败的标的记录在返回结果的errors中；fail_fast为True时
+        第一个失败的标的会取消其余标的。
+        Each instrument is read and has its expressions evaluated on its own in a
+        worker pool, and the result is assembled in request order whatever the
+        completion order. A failure on one instrument does not abort the others
+        and is recorded in the result's errors; with fail_fast the first failure
+        cancels the rest.
+        
+        ctx取消或超时后，尚未开始的标的不再获取，正在读取的提供者在下一次检查时中止，
+        调用抛出PartialFetchError（ContextCancelledError的子类），其result为已经完成的标的，
+        pending为未完成的标的。
+        Once ctx is cancelled or past its deadline, instruments not yet started
+        are skipped, providers mid-read stop at their next check, and the call
+        raises PartialFetchError (a ContextCancelledError) whose result holds
+        the instruments that completed and whose pending lists the rest.
+        
+        Args:
+            ctx: 请求上下文，控制取消和超时 / Request context controlling cancellation and deadline
+            instruments: 标的代码、标的代码列表或标的池，如"SH000300"、["SH000300", "SH000905"]
+                或get_universe("SH000300")；标的池展开为区间内任意时刻的成分股，
+                每个标的只保留其作为成分股期间的行。代码可以是"600000.SH"、"sh.600000"等写法，
+                统一为内部形式（见core.instrument），结果以内部形式为键；无法识别的代码以
+                InstrumentCodeError记录在errors中 / Instrument code, list of codes, or a
+                Universe; a universe expands to everyone who was a member during the
+                range, each keeping only the rows from its membership periods. Codes
+                may use spellings such as "600000.SH" or "sh.600000" and are
+                canonicalized (see core.instrument), keying the result by the internal
+                form; unrecognized codes are recorded in errors as InstrumentCodeError
+            fields: 字段或表达式列表，如["$close", "$close/Ref($close,1)-1"]，
+                表达式列以表达式文本命名；CSRank等截面函数在同一时刻的所有请求标的之间计算 /
+                Fields or expressions; expression columns are named by their text.
+                Cross-sectional functions such as CSRank work across every requested
+                instrument at each timestamp
+            start_time: 开始时间，"2025-01-01"或带偏移的RFC3339时间如"2025-01-01T09:30:00+08:00" /
+                Start time, "2025-01-01" or RFC3339 with an offset such as "2025-01-01T09:30:00+08:00"
+            end_time: 结束时间，格式同start_time，只有日期时包含当天 /
+                End time in the same formats; a date-only end includes its whole day
+            options: 本次调用的选项，None表示全部使用默认值，见FeatureOptions /
+                Options of this call, None for all defaults; see FeatureOptions
+            **overrides: 按名称覆盖options中的字段，如freq="5min"、adjust="pre"；
+                未知的名称抛出TypeError / Fields of options overridden by name, such as
+                freq="5min" or adjust="pre"; unknown names raise TypeError
+        
+        Returns:
+            FeatureResult: 以标的代码为键的结果，键顺序与请求顺序一致（标的池按代码排序） /
+                Result keyed by instrument code, in request order (sorted for a universe)
+        
+        Raises:
+            RequestTimeError: 时间格式不受支持或start_time晚于end_time时在获取数据前抛出 /
+                Raised before any fetch for an unsupported time format or a start after the end
+            ExpressionError: 表达式有语法错误时在获取数据前抛出 /
+                Raised before any fetch when an expression is malformed
+            ValueError: fill_policy无效，把DROP用于单个字段，或lazy、utc与不支持的选项同时使用时在获取数据前抛出 /
+                Raised before any fetch for an invalid fill_policy, DROP given for a single
+                field, or lazy or utc combined with an unsupported option
+            UnsupportedFrequencyError: 提供者不支持freq时在获取数据前抛出 /
+                Raised before any fetch when the provider does not support freq
+            PartialFetchError: 获取过程中上下文取消或超时时抛出 /
+                Raised when the context is done in the middle of the fetch
+            FeatureFetchError: fail_fast为True且有标的失败时抛出，errors为失败的标的 /
+                Raised with fail_fast when an instrument fails; errors names it
+            ContextCancelledError: 开始获取前上下文已取消或超时时抛出 /
+                Raised when the context is done before the fetch starts
+        """
+        options = FeatureOptions.of(options, overrides)
+        ctx = ctx if options.timeout is None else ctx.child(options.timeout)
+        ctx.check()
+        retry = options.retry or self._retry_policy
+        freq = to_freq(options.freq)
+        data_provider = self._resolve_provider(options.provider)
+        data_provider.check_freq(freq)
+        calendar = options.calendar
+        trading_calendar = get_trading_calendar(calendar) if isinstance(calendar, str) else calendar
+        start_time, end_time = self._parse_range(start_time, end_time, options.timezone, trading_calendar)
+        if trading_calendar is not None:
+            start_time, end_time = self._snap_to_sessions(trading_calendar, start_time, end_time, freq)
+        end_time = self._inclusive_end(end_time, freq)
+        
+        frames: Dict[str, pd.DataFrame] = {}
+        errors: Dict[str, Exception] = {}
+        universe = instruments if isinstance(instruments, Universe) else None
+        if universe is not None:
+            codes = universe.members_between(start_time, end_time)
+            self._logger.debug(f"标的池 {universe.name} 展开为 {len(codes)} 个标的")
+        else:
+            codes = self._normalize_codes([instruments] if isinstance(instruments, str) else list(instruments), errors)
+        # 去重并保持请求顺序
+        codes = list(dict.fromkeys(codes))
+        if options.fail_fast and errors:
+            raise FeatureFetchError(errors)
+        
+        adjust_mode = None if options.adjust is None else to_adjust_mode(options.adjust)
+        
+        # 在获取数据前解析所有表达式，语法错误立即返回
+        expressions = {
+            field: parse_expression(field)
+            for field in fields if not is_raw_field(field)
+        }
+        default_fill, column_fills = self._fill_policies(options.fill_policy, fields, expressions)
+        # 截面表达式需要所有标的的数据：各标的只加载其原始字段，全部获取完成后统一计算，
+        # 标的池的成分股过滤也推迟到截面计算之后
+        panel_expressions = {f: e for f, e in expressions.items() if e.cross_sectional}
+        if options.deferred and panel_expressions:
+            option = "lazy" if options.lazy else "defer_expressions"
+            raise ValueError(f"{option} cannot be combined with cross-sectional expressions")
+        display_tz = options.display_tz
+        if options.utc:
+            if display_tz is None:
+                display_tz = options.timezone or (trading_calendar.timezone if trading_calendar is not None else None)
+            display_tz = check_timezone(display_tz or self._timezone)
+        fetch_fields = fields
+        fetch_expressions = expressions
+        fetch_universe = universe
+        if panel_expressions:
+            fetch_fields = [f for f in fields if f not in panel_expressions]
+            for expression in panel_expressions.values():
+                fetch_fields.extend(expression.fields)
+            fetch_fields = list(dict.fromkeys(fetch_fields))
+            fetch_expressions = {f: e for f, e in expressions.items() if f not in panel_expressions}
+            fetch_universe = None
+        
+        self._logger.debug(
+            f"获取特征数据 - 提供者: {data_provider.name}, 标的: {codes}, 字段: {fields}, "
+            f"时间范围: {start_time} 至 {end_time}, 频率: {freq}"
+        )
+        
+        if not codes:
+            return FeatureResult(frames, errors)
+        if options.lazy:
+            for code in codes:
+                frames[code] = LazyFeatureFrame(code, fields, self._lazy_loader(
+                    data_provider, code, expressions, start_time, end_time, freq,
+                    trading_calendar, ctx, universe, adjust_mode, retry
+                ))
+            return FeatureResult(frames, errors)
+        
+        workers = options.max_workers or self._max_workers
+        executor = ThreadPoolExecutor(max_workers=min(len(codes), workers))
+        # 各标的在子上下文中获取，fail_fast时取消它即可中止其余标的
+        worker_ctx = ctx.child()
+        futures = {}
+        try:
+            futures = {
+                code: executor.submit(
+                    self._fetch_instrument_features,
+                    data_provider, code, fetch_fields, fetch_expressions,
+                    start_time, end_time, freq, trading_calendar, worker_ctx, fetch_universe, adjust_mode, retry,
+                    options.defer_expressions
+                )
+                for code in codes
+            }
+            failed = self._wait_all(ctx, list(futures.values()), options.progress, options.fail_fast)
+            if failed is not None:
+                code = next(c for c, future in futures.items() if future is failed)
+                error = failed.exception()
+                worker_ctx.cancel(f"instrument {code} failed")
+                for future in futures.values():
+                    future.cancel()
+                self._logger.info(f"标的 {code} 获取失败，已取消其余标的: {error}")
+                raise FeatureFetchError({code: error}) from error
+            # 按请求顺序收集结果，保证返回顺序确定
+            for code in codes:
+                try:
+                    frames[code] = futures[code].result()
+                except ContextCancelledError:
+                    raise
+                except Exception as e:
+                    if log_enabled(logging.WARNING):
+                        current_logger().warning("跳过标的 %s, 获取失败: %s", code, e)
+                    errors[code] = e
+        except ContextCancelledError as e:
+            for future in futures.values():
+                future.cancel()
+            # 截面表达式需要所有标的，部分结果无法计算，全部视为未完成
+            partial, pending = self._collect_partial(codes, futures, usable=not panel_expressions)
+            self._logger.info(f"特征数据获取已取消 - 已完成: {list(partial)}, 未完成: {pending}")
+            raise PartialFetchError(e, partial, pending) from e
+        finally:
+            # 取消时不等待仍在运行的任务，它们会在下一次检查上下文时退出
+            executor.shutdown(wait=not worker_ctx.cancelled)
+        
+        if panel_expressions and frames:
+            frames = self._evaluate_cross_section(frames, fields, panel_expressions, ctx, universe)
+            for code in [code for code, frame in frames.items() if frame.empty]:
+                del frames[code]
+                errors[code] = self._no_data_error(code, fields, start_time, end_time, freq)
+                if log_enabled(logging.WARNING):
+                    current_logger().warning("跳过标的 %s, 截面计算后没有数据", code)
+        
+        reports: Dict[str, ValidationReport] = {}
+        if options.strict or options.validation is not None:
+            # 标的池只保留成分股期间的行，非成分股期间不算缺失
+            bounds = (None, None) if universe is not None else (start_time, end_time)
+            reports = self._validate_frames(
+                frames, errors, trading_calendar, bounds, options.validation or ValidationOptions(), options.strict
+            )
+        
+        if options.align and frames:
+            frames = self._align_frames(
+                frames, trading_calendar, start_time, end_time, freq, default_fill, universe, column_fills
+            )
+        if options.utc:
+            frames = self._to_utc(frames, errors, display_tz)
+        
+        return FeatureResult(frames, errors, reports)
+    
+    def _to_utc(
+        self,
+        frames: Dict[str, pd.DataFrame],
+        errors: Dict[str, Exception],
+        display_tz: str
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        把各标的的索引从其交易所时区转换为UTC / Convert each instrument's index from its exchange timezone to UTC
+        
+        无法转换的标的（如有不存在的本地时间）记录在errors中
+        Instruments that can't be converted (say, with wall times that don't exist) go to errors
+        """
+        converted = {}
+        for code, frame in frames.items():
+            try:
+                calendar = instrument_calendar(code)
+                frame = FeatureFrame(frame, copy=False)
+                frame.index = calendar.to_utc(frame.index)
+            except (DataError, ValueError) as e:
+                if log_enabled(logging.WARNING):
+                    current_logger().warning("跳过标的 %s, 无法转换为UTC: %s", code, e)
+                errors[code] = e
+                continue
+            frame.attrs[TIMEZONE_ATTR] = calendar.timezone
+            frame.attrs[DISPLAY_TZ_ATTR] = display_tz
+            converted[code] = frame
+        return converted
+    
+    def _validate_frames(
+        self,
+        frames: Dict[str, pd.DataFrame],
+        errors: Dict[str, Exception],
+        calendar: Optional[TradingCalendar],
+        bounds: Tuple[Optional[str], Optional[str]],
+        options: ValidationOptions,
+        strict: bool
+    ) -> Dict[str, ValidationReport]:
+        """
+        校验（并按选项修复）每个标的的数据 / Validate, and repair if configured, every instrument
+        
+        修复后的数据替换frames中的原数据；严格模式下未通过校验的标的从frames移到errors
+        Repaired frames replace the originals in frames; in strict mode the
+        instruments that fail are moved from frames to errors
+        
+        Returns:
+            Dict[str, ValidationReport]: 各标的的校验报告 / Per-instrument validation reports
+        """
+        start_time, end_time = bounds
+        reports = {}
+        for code in list(frames):
+            if options.repairs:
+                frames[code], report = repair_frame(frames[code], options, calendar, start_time, end_time, code)
+            else:
+                report = validate_frame(
+                    frames[code], calendar, start_time, end_time, options.volume_zscore, code, options.max_gap
+                )
+            reports[code] = report
+            if report.repairs and log_enabled(logging.WARNING):
+                current_logger().warning("标的 %s 已修复 %d 处数据", code, len(report.repairs))
+            if strict and not report.ok:
+                del frames[code]
+                errors[code] = DataValidationError(report)
+                if log_enabled(logging.WARNING):
+                    current_logger().warning("跳过标的 %s, 数据未通过校验: %s", code, report.counts())
+        return reports
+    
+    def _collect_partial(
+        self,
+        codes: List[str],
+        futures: Dict[str, Any],
+        usable: bool = True
+    ) -> Tuple[FeatureResult, List[str]]:
+        """
+        收集取消时已经完成的标的 / Collect the instruments that had completed when cancelled
+        
+        Returns:
+            Tuple[FeatureResult, List[str]]: (已完成标的的结果, 未完成的标的) /
+                (result of the completed instruments, instruments still pending)
+        """
+        frames: Dict[str, pd.DataFrame] = {}
+        errors: Dict[str, Exception] = {}
+        pending = []
+        for code in codes:
+            future = futures.get(code)
+            if future is None or not future.done() or future.cancelled():
+                pending.append(code)
+                continue
+            error = future.exception()
+            if error is None and usable:
+                frames[code] = future.result()
+            elif error is not None and not isinstance(error, ContextCancelledError):
+                errors[code] = error
+            else:
+                pending.append(code)
+        return FeatureResult(frames, errors), pending
+    
+    def _wait_all(
+        self,
+        ctx: RequestContext,
+        futures: List[Any],
+        progress: Optional[ProgressCallback] = None,
+        fail_fast: bool = False
+    ) -> Optional[Any]:
+        """
+        等待所有任务完成，期间轮询上下文 / Wait for every future, polling the context
+        
+        Args:
+            ctx: 请求上下文 / Request context
+            futures: 要等待的任务 / Futures to wait for
+            progress: 每完成一个任务调用一次的进度回调，fail_fast返回前也报告该轮完成的任务 /
+                Progress callback called once per finished future, including the round fail_fast returns on
+            fail_fast: 是否在第一个失败的任务处返回 / Whether to return at the first failed future
+        
+        Returns:
+            Optional[Any]: fail_fast时第一个失败的任务，否则为None /
+                The first failed future with fail_fast, None otherwise
+        
+        Raises:
+            ContextCancelledError: 等待期间上下文取消或超时时抛出 /
+                Raised when the context is done while waiting
+        """
+        total = len(futures)
+        pending = set(futures)
+        while pending:
+            ctx.check()
+            remaining = ctx.remaining()
+            timeout = 0.05 if remaining is None else min(0.05, remaining)
+            done, pending = wait(pending, timeout=timeout, return_when=FIRST_COMPLETED)
+            if progress is not None:
+                # 同一轮完成多个任务时逐个报告，回调次数总是等于已完成的任务数，失败返回前也先报告
+                finished = total - len(pending) - len(done)
+                for count in range(finished + 1, finished + len(done) + 1):
+                    progress(count, total)
+            if fail_fast:
+                # 按提交顺序找第一个失败的任务，同一轮完成多个时结果确定
+                failed = [f for f in futures if f in done and self._failed(f)]
+                if failed:
+                    return failed[0]
+        ctx.check()
+        return None
+    
+    @staticmethod
+    def _failed(future: Any) -> bool:
+        """任务因标的自身的错误失败（不含上下文取消） / Whether a future failed on its own, not by cancellation"""
+        if future.cancelled():
+            return False
+        error = future.exception()
+        return error is not None and not isinstance(error, ContextCancelledError)
+    
+    def get_features_stream(self, request: FeatureRequest) -> FeatureIterator:
+        """
+        按时间分块流式获取特征数据 / Stream feature data in time chunks
+        
+        与get_features()返回相同的数据，但每次只加载一个块，适合长区间、多标的的
+        流式聚合。块的划分基于提供者的交易日历，提供request.calendar时只保留其中的交易日。
+        Yields the same data as get_features() but loads one chunk at a time,
+        for streaming aggregates over long ranges and many instruments. Chunks
+        are planned from the provider's calendar, restricted to request.calendar's
+        trading days when one is given.
+        
+        Args:
+            request: 特征数据请求 / Feature request
+        
+        Returns:
+            FeatureIterator: 数据块迭代器 / Chunk iterator
+        
+        Raises:
+            RequestTimeError: 时间格式不受支持或开始时间晚于结束时间时抛出 /
+                Raised for an unsupported time format or a start after the end
+            ExpressionError: 表达式有语法错误或包含截面函数时抛出 /
+                Raised when an expression is malformed or uses a cross-sectional function
+            UnsupportedFrequencyError: 提供者不支持request.freq时抛出 /
+                Raised when the provider does not support request.freq
+        """
+        data_provider = self._resolve_provider(request.provider)
+        data_provider.check_freq(request.freq)
+        calendar = request.calendar
+        trading_calendar = get_trading_calendar(calendar) if isinstance(calendar, str) else calendar
+        start_time, end_time = self._parse_range(
+            request.start_time, request.end_time, request.timezone, trading_calendar
+        )
+        end_time = self._inclusive_end(end_time, request.freq)
+        
+        expressions = {
+            field: parse_expression(field)
+            for field in request.fields if not is_raw_field(field)
+        }
+        # 流式获取逐个标的加载，无法计算截面函数
+        for field, expression in expressions.items():
+            if expression.cross_sectional:
+                raise ExpressionError(
+                    field, expression.cross_section_position,
+                    "cross-sectional functions are not supported when streaming; use get_features()"
+                )
+        
+        ctx = request.context or background()
+        sessions = data_provider.calendar_ctx(
+            ctx, start_time=start_time, end_time=end_time, freq=request.freq
+        )
+        if trading_calendar is not None:
+            mask = trading_calendar.session_mask(pd.DatetimeIndex(sessions), request.freq)
+            sessions = [ts for ts, ok in zip(sessions, mask) if ok]
+        windows = plan_windows(sessions, request.chunk_by)
+        
+        self._logger.debug(
+            f"创建特征数据流 - 提供者: {data_provider.name}, 标的数量: {len(request.instruments)}, "
+            f"块数: {len(windows)}, 分块方式: {request.chunk_by}"
+        )
+        return FeatureIterator(
+            data_provider, request, expressions, windows, trading_calendar, self._fundamental_staleness
+        )
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: Union[str, List[str]],
+        fields: List[str],
+        freq: FreqLike = "1min",
+        provider: Optional[Union[str, DataProvider]] = None
+    ) -> Subscription:
+        """
+        订阅实时K线 / Subscribe to live bars
+        
+        只支持原始字段；表达式需要历史数据，应由调用方在收到K线后自行计算。
+        Raw fields only; expressions need history and are left to the caller
+        once bars arrive.
+        
+        Args:
+            ctx: 请求上下文，取消或超时时关闭订阅 / Request context; the subscription closes when it is done
+            instruments: 标的代码或标的代码列表 / Instrument code or list of codes
+            fields: 原始字段列表，如["$close"] / Raw fields, e.g. ["$close"]
+            freq: 数据频率 / Data frequency
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+        
+        Returns:
+            Subscription: 可迭代的K线订阅 / Iterable bar subscription
+        
+        Raises:
+            ValueError: 字段中包含表达式时抛出 / Raised when a field is an expression
+            UnsupportedFrequencyError: 提供者不支持freq时抛出 /
+                Raised when the provider does not support freq
+        """
+        expressions = [field for field in fields if not is_raw_field(field)]
+        if expressions:
+            raise ValueError(f"subscriptions only take raw fields, got expressions {expressions}")
+        codes = [instruments] if isinstance(instruments, str) else list(instruments)
+        freq = to_freq(freq)
+        data_provider = self._resolve_provider(provider)
+        self._logger.info(
+            f"订阅实时K线 - 提供者: {data_provider.name}, 标的: {codes}, 字段: {fields}, 频率: {freq}"
+        )
+        return data_provider.subscribe(ctx, codes, fields, freq)
+    
+    def _evaluate_cross_section(
+        self,
+        frames: Dict[str, pd.DataFrame],
+        fields: List[str],
+        expressions: Dict[str, Expression],
+        ctx: RequestContext,
+        universe: Optional[Universe] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        在所有标的上计算截面表达式 / Evaluate cross-sectional expressions across all instruments
+        
+        把各标的的数据拼成(instrument, datetime)多级索引后计算，每个时刻的统计量
+        只包含该时刻有数据的标的。提供标的池时，截面统计只包含当时的成分股，
+        计算完成后再去掉非成分股期间的行。
+        The frames are stacked into an (instrument, datetime) MultiIndex before
+        evaluation, so each timestamp's statistics only include instruments with
+        data there. With a universe the statistics only include the members at
+        each timestamp, and rows outside the membership periods are dropped
+        afterwards.
+        
+        Args:
+            frames: 各标的已加载原始字段和非截面列的数据 /
+                Per-instrument frames holding the raw fields and non-cross-sectional columns
+            fields: 请求的字段，决定输出列的顺序 / Requested fields, giving the column order
+            expressions: 截面表达式 / Cross-sectional expressions
+            ctx: 请求上下文 / Request context
+            universe: 标的池 / Universe
+        
+        Returns:
+            Dict[str, pd.DataFrame]: 列顺序与fields一致的数据，可能为空 /
+                Frames with columns in the order of fields; may be empty
+        """
+        panel = pd.concat(frames, names=["instrument"])
+        mask = None
+        if universe is not None:
+            mask = pd.Series(
+                np.concatenate([universe.membership_mask(code, frame.index) for code, frame in frames.items()]),
+                index=panel.index
+            )
+        values = {field: expression.evaluate(panel, ctx, mask) for field, expression in expressions.items()}
+        
+        result = {}
+        for code, frame in frames.items():
+            columns = {
+                field: values[field].xs(code, level="instrument").reindex(frame.index)
+                if field in values else frame[field]
+                for field in fields
+            }
+            data = pd.DataFrame(columns, index=frame.index)
+            if universe is not None:
+                data = data[universe.membership_mask(code, data.index)]
+            result[code] = data
+        return result
+    
+    def _align_frames(
+        self,
+        frames: Dict[str, pd.DataFrame],
+        calendar: Optional[TradingCalendar],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str,
+        fill_policy: FillPolicy,
+        universe: Optional[Universe] = None,
+        column_policies: Optional[Dict[str, FillPolicy]] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        把所有标的对齐到共享时间轴 / Align every instrument onto a shared time axis
+        
+        Args:
+            frames: 各标的的数据 / Per-instrument frames
+            calendar: 交易日历 / Trading calendar
+            start_time: 开始时间 / Start time
+            end_time: 结束时间 / End time
+            freq: 数据频率 / Data frequency
+            fill_policy: 缺失K线的默认填充策略 / Default fill policy for missing bars
+            universe: 标的池，提供退市信息 / Universe, providing the delistings
+            column_policies: 列到填充策略的映射，未列出的列使用fill_policy /
+                Column to fill policy; unlisted columns use fill_policy
+        
+        Returns:
+            Dict[str, pd.DataFrame]: 行索引完全相同的数据，已退市标的在退市日之后的行为NaN /
+                Frames sharing an identical index; a delisted instrument's rows after its delisting are NaN
+        """
+        if calendar is not None and freq == "day":
+            lower = start_time or min(frame.index.min() for frame in frames.values())
+            upper = end_time or max(frame.index.max() for frame in frames.values())
+            axis = pd.DatetimeIndex(calendar.between(lower, upper), name="datetime")
+        else:
+            axis = frames[next(iter(frames))].index
+            for frame in frames.values():
+                axis = axis.union(frame.index)
+        
+        if fill_policy == FillPolicy.DROP:
+            for frame in frames.values():
+                axis = axis[axis.isin(frame.index)]
+        
+        column_policies = column_policies or {}
+        label = fill_policy.value
+        if any(policy != fill_policy for policy in column_policies.values()):
+            label = ", ".join(f"{column}={policy.value}" for column, policy in column_policies.items())
+        
+        warn = log_enabled(logging.WARNING)
+        aligned = {}
+        for code, frame in frames.items():
+            missing = int((~axis.isin(frame.index)).sum()) if warn else 0
+            frame = _fill_missing(frame.reindex(axis), fill_policy, column_policies)
+            delisting = get_delisting(code) if universe is None else universe.delisting(code)
+            if delisting is not None:
+                # 不把退市前最后的价格填充到退市之后
+                frame.loc[delisting.delisted_mask(frame.index)] = np.nan
+            aligned[code] = frame
+            if missing:
+                current_logger().warning(
+                    "标的 %s 对齐时补入 %d 根缺失K线, 填充策略: %s", code, missing, label
+                )
+        
+        self._logger.debug(
+            f"已对齐 {len(aligned)} 个标的到共享时间轴, 行数: {len(axis)}, "
+            f"填充策略: {label}"
+        )
+        return aligned
+    
+    @staticmethod
+    def _fill_policies(
+        fill_policy: FillPolicyLike,
+        fields: List[str],
+        expressions: Dict[str, Expression]
+    ) -> Tuple[FillPolicy, Dict[str, FillPolicy]]:
+        """
+        解析每一列的填充策略，优先顺序见get_features_ctx() /
+        Resolve the fill policy of every column, in the precedence described by get_features_ctx()
+        
+        Returns:
+            Tuple[FillPolicy, Dict[str, FillPolicy]]: (默认策略, 每个请求字段的策略) /
+                (default policy, policy of every requested field)
+        """
+        if isinstance(fill_policy, (FillPolicy, str)):
+            policy = FillPolicy(fill_policy)
+            return policy, {field: policy for field in fields}
+        explicit = {field: FillPolicy(policy) for field, policy in fill_policy.items()}
+        default = explicit.pop(DEFAULT_FILL_KEY, FillPolicy.NAN)
+        for field, policy in explicit.items():
+            if policy == FillPolicy.DROP:
+                raise ValueError(f"{field}: drop removes whole rows and can only be the default fill policy")
+        
+        columns = {}
+        for field in fields:
+            policy = explicit.get(field)
+            if policy is None and field in expressions:
+                inherited = {explicit.get(name, default) for name in expressions[field].fields}
+                if len(inherited) == 1:
+                    policy = inherited.pop()
+            columns[field] = default if policy is None else policy
+        return default, columns
+    
+    def _resolve_provider(
+        self,
+        provider: Optional[Union[str, DataProvider]]
+    ) -> DataProvider:
+        """
+        解析要使用的数据提供者 / Resolve the data provider to use
+        
+        Args:
+            provider: 提供者实例、名称或None / Provider instance, name, or None
+        
+        Returns:
+            DataProvider: 提供者实例 / Provider instance
+        """
+        default = self._provider or get_default_provider() or self._qlib_provider
+        if provider is None:
+            selected = default
+        elif isinstance(provider, DataProvider):
+            selected = provider
+        elif provider == default.name:
+            selected = default
+        elif provider == self._qlib_provider.name:
+            selected = self._qlib_provider
+        else:
+            selected = get_provider(provider)
+        if log_enabled(logging.DEBUG):
+            current_logger().debug(
+                "使用数据提供者: %s, 请求的提供者: %s", selected.name, getattr(provider, "name", provider)
+            )
+        return selected
+    
+    def _snap_to_sessions(
+        self,
+        calendar: TradingCalendar,
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str
+    ) -> Tuple[Optional[str], Optional[str]]:
+        """
+        把查询区间收缩到最近的交易日 / Snap the query range to the nearest trading days
+        
+        落在交易日的边界保持不变；非交易日的开始时间取下一个交易日，
+        结束时间取上一个交易日（日内频率取该日收盘前的最后时刻）。
+        Bounds on a trading day are kept; a non-trading start moves to the next
+        trading day and a non-trading end moves back to the previous one (the
+        end of that day for intraday frequencies).
+        
+        Returns:
+            Tuple[Optional[str], Optional[str]]: 收缩后的区间 / Snapped range
+        """
+        snapped_start, snapped_end = start_time, end_time
+        if start_time is not None and not calendar.is_trading_day(start_time):
+            snapped_start = calendar.next(start_time).strftime("%Y-%m-%d")
+        if end_time is not None and not calendar.is_trading_day(end_time):
+            snapped_end = calendar.prev(end_time).strftime("%Y-%m-%d")
+            if freq != "day":
+                snapped_end += " 23:59:59"
+        
+        if (snapped_start, snapped_end) != (start_time, end_time):
+            self._logger.debug(
+                f"时间范围已按{calendar.market}交易日历调整: "
+                f"{start_time} 至 {end_time} -> {snapped_start} 至 {snapped_end}"
+            )
+        return snapped_start, snapped_end
+    
+    def _parse_range(
+        self,
+        start_time: Optional[str],
+        end_time: Optional[str],
+        timezone: Optional[str],
+        calendar: Optional[TradingCalendar]
+    ) -> Tuple[Optional[str], Optional[str]]:
+        """
+        把请求区间解析为交易所本地时间的字符串 / Parse the request range into exchange-local strings
+        
+        时区依次取timezone、交易日历的时区和管理器的默认时区
+        The timezone is timezone, else the calendar's, else the manager default
+        """
+        if timezone is None:
+            timezone = calendar.timezone if calendar is not None and calendar.timezone else self._timezone
+        start, end = parse_request_range(start_time, end_time, timezone)
+        return format_request_time(start), format_request_time(end)
+    
+    def _inclusive_end(self, end_time: Optional[str], freq: str) -> Optional[str]:
+        """
+        日内频率下把只有日期的结束时间扩展到当天结束 / Extend a date-only end to the end of that day for intraday data
+        
+        end_time="2025-01-03"在日频下包含当天的K线，日内频率下同样应包含当天所有分钟K线
+        end_time="2025-01-03" includes that day's bar for daily data, so for
+        intraday data it must include every minute bar of the day as well
+        """
+        if end_time is None or not is_intraday(freq):
+            return end_time
+        ts = pd.Timestamp(end_time)
+        if ts != ts.normalize():
+            return end_time
+        return (ts + pd.Timedelta(days=1) - pd.Timedelta(seconds=1)).isoformat(sep=" ")
+    
+    def get_calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: FreqLike = "day",
+        provider: Optional[Union[str, DataProvider]] = None,
+        timeout: Optional[float] = None,
+        retry: Optional[RetryPolicy] = None
+    ) -> List[pd.Timestamp]:
+        """
+        获取数据提供者的交易日历 / Get the trading calendar of a data provider
+        
+        等价于使用不会取消的上下文调用get_calendar_ctx()
+        Same as get_calendar_ctx() with a context that is never cancelled
+        """
+        return self.get_calendar_ctx(
+            background(), start_time=start_time, end_time=end_time, freq=freq, provider=provider,
+            timeout=timeout, retry=retry
+        )
+    
+    def get_calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: FreqLike = "day",
+        provider: Optional[Union[str, DataProvider]] = None,
+        timeout: Optional[float] = None,
+        retry: Optional[RetryPolicy] = None
+    ) -> List[pd.Timestamp]:
+        """
+        在请求上下文中获取数据提供者的交易日历 / Get a provider's trading calendar under a request context
+        
+        Args:
+            ctx: 请求上下文 / Request context
+            start_time: 开始时间（包含） / Start time (inclusive)
+            end_time: 结束时间（包含） / End time (inclusive)
+            freq: 数据频率，默认为"day" / Data frequency, default is "day"
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+            timeout: 本次请求的超时秒数 / Timeout of this request in seconds
+            retry: 重试策略，None表示使用管理器的默认策略 / Retry policy, None uses the manager default
+        
+        Returns:
+            List[pd.Timestamp]: 升序排列的交易时间 / Trading timestamps in ascending order
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+            RetryExhaustedError: 重试用尽时抛出 / Raised when retries are exhausted
+        """
+        if timeout is not None:
+            ctx = ctx.child(timeout)
+        freq = to_freq(freq)
+        data_provider = self._resolve_provider(provider)
+        data_provider.check_freq(freq)
+        end_time = self._inclusive_end(end_time, freq)
+        
+        def load() -> List[pd.Timestamp]:
+            return data_provider.calendar_ctx(ctx, start_time=start_time, end_time=end_time, freq=freq)
+        
+        retry = retry or self._retry_policy
+        calendar = load() if retry is None else retry.call(ctx, load, on_retry=self._log_retry("calendar"))
+        self._logger.debug(f"获取交易日历 - 提供者: {data_provider.name}, 交易日数量: {len(calendar)}")
+        return calendar
+    
+    def list_fields(
+        self,
+        instrument: str,
+        freq: str = "day",
+        provider: Optional[Union[str, DataProvider]] = None
+    ) -> List[str]:
+        """
+        列出标的可用的原始字段 / List the raw fields available for an instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            freq: 数据频率，默认为"day" / Data frequency, default is "day"
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+        
+        Returns:
+            List[str]: 排序、去重后的字段，如["$close", "$open"] / Sorted, deduplicated fields, e.g. ["$close", "$open"]
+        
+        Raises:
+            MetadataUnavailableError: 提供者不支持列出字段时抛出 / Raised when the provider cannot list fields
+            DataError: 标的不存在时抛出 / Raised when the instrument doesn't exist
+        """
+        return self._resolve_provider(provider).list_fields(instrument, freq=freq)
+    
+    def list_instruments(
+        self,
+        market: str = ALL_MARKET,
+        freq: str = "day",
+        provider: Optional[Union[str, DataProvider]] = None
+    ) -> List[str]:
+        """
+        列出市场中的标的 / List the instruments of a market
+        
+        Args:
+            market: qlib股票池（如"csi300"），本地文件提供者为交易所前缀（如"SH"），"all"表示所有标的 /
+                qlib pool such as "csi300", an exchange prefix such as "SH" for
+                file providers, "all" for every instrument
+            freq: 数据频率，默认为"day" / Data frequency, default is "day"
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+        
+        Returns:
+            List[str]: 排序、去重后的标的代码 / Sorted, deduplicated instrument codes
+        
+        Raises:
+            MetadataUnavailableError: 提供者不支持列出标的时抛出 / Raised when the provider cannot list instruments
+        """
+        return self._resolve_provider(provider).list_instruments(market, freq=freq)
+    
+    def get_corporate_actions(
+        self,
+        instruments: Union[str, List[str]],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        provider: Optional[Union[str, DataProvider]] = None,
+        earnings: bool = False
+    ) -> Dict[str, List[CorporateAction]]:
+        """
+        获取标的的公司行为事件 / Get the corporate action events of instruments
+        
+        Args:
+            instruments: 标的代码或代码列表 / Instrument code or list of codes
+            start_time: 除权日下限（包含） / Earliest ex-date (inclusive)
+            end_time: 除权日上限（包含） / Latest ex-date (inclusive)
+            provider: 提供者实例或已注册的提供者名称，None表示使用默认提供者 /
+                Provider instance or registered provider name, None uses the default
+            earnings: 是否同时获取业绩公告（Earnings），提供者不提供基本面数据时没有业绩公告 /
+                Whether to include earnings announcements (Earnings); there are none when
+                the provider serves no fundamentals
+        
+        Returns:
+            Dict[str, List[CorporateAction]]: 标的代码到按除权日排列的事件，没有除权除息数据的标的为空列表 /
+                Instrument code to events in ex-date order; an empty list for instruments without records
+        """
+        data_provider = self._resolve_provider(provider)
+        codes = [instruments] if isinstance(instruments, str) else list(dict.fromkeys(instruments))
+        actions = {}
+        for code in codes:
+            try:
+                actions[code] = data_provider.corporate_actions(code, start_time=start_time, end_time=end_time)
+            except AdjustmentsUnavailableError:
+                actions[code] = []
+            if earnings:
+                try:
+                    announced = data_provider.earnings(code, start_time=start_time, end_time=end_time)
+                except FundamentalsUnavailableError:
+                    announced = []
+                # 同一天的除权事件排在业绩公告之前
+                actions[code] = sorted(actions[code] + announced, key=lambda action: action.ex_date)
+        self._logger.debug(
+            f"获取公司行为 - 提供者: {data_provider.name}, 标的: {len(codes)}, "
+            f"事件: {sum(len(events) for events in actions.values())}"
+        )
+        return actions
+    
+    def _fetch_instrument_features(
+        self,
+        data_provider: DataProvider,
+        instrument: str,
+        fields: List[str],
+        expressions: Dict[str, Expression],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str,
+        calendar: Optional[TradingCalendar] = None,
+        ctx: Optional[RequestContext] = None,
+        universe: Optional[Universe] = None,
+        adjust: Optional[AdjustMode] = None,
+        retry: Optional[RetryPolicy] = None,
+        defer: bool = False
+    ) -> Union[pd.DataFrame, LazyFeatureFrame]:
+        """
+        获取单个标的的特征数据 / Fetch feature data for a single instrument
+        
+        提供交易日历时先丢弃非交易日的行，再计算表达式，
+        因此Ref等函数只在交易日之间偏移
+        With a calendar, non-session rows are dropped before expressions are
+        evaluated, so Ref and friends only shift across sessions
+        
+        提供标的池时，表达式计算完成后才去掉非成分股期间的行，
+        因此纳入首日的Ref等函数仍能看到纳入前的数据
+        With a universe, rows outside the membership periods are dropped after
+        expressions are evaluated, so Ref and friends on the first member day
+        still see the data from before inclusion
+        
+        已退市的标的（见core.delisting）只返回退市日（包含）之前的行
+        A delisted instrument (see core.delisting) only returns rows up to and
+        including its delisting date
+        
+        先从提供者加载原始字段，再在该标的的序列上计算表达式列；
+        基本面字段按公告日对齐到K线上（见core.fundamentals）
+        Loads the raw fields from the provider, then evaluates expression
+        columns over this instrument's series; fundamental fields are aligned
+        onto the bars by announcement date (see core.fundamentals)
+        
+        defer为True时不计算表达式，返回原始字段已加载的LazyFeatureFrame，表达式列在第一次
+        访问时在完整的原始数据上计算，再去掉非成分股期间和退市后的行
+        With defer, expressions are left unevaluated and a LazyFeatureFrame with
+        the raw fields loaded is returned; an expression column is computed on
+        first access over the full raw data, then trimmed of the rows outside
+        membership and after delisting
+        
+        Returns:
+            Union[pd.DataFrame, LazyFeatureFrame]: 以时间为索引、列顺序与fields一致的数据 /
+                Time-indexed data with columns in the order of fields
+        """
+        base_fields = [f for f in fields if f not in expressions]
+        for expression in expressions.values():
+            base_fields.extend(expression.fields)
+        base_fields = list(dict.fromkeys(base_fields))
+        load_fields = base_fields
+        adjusting = adjust is not None and needs_factor(base_fields, adjust, data_provider.adjusted_prices)
+        if adjusting and FACTOR_FIELD not in base_fields:
+            load_fields = base_fields + [FACTOR_FIELD]
+        
+        ctx = ctx or background()
+        started = time.perf_counter() if log_enabled(logging.DEBUG) else None
+        
+        def load() -> pd.DataFrame:
+            return load_with_fundamentals(
+                data_provider,
+                ctx,
+                instrument,
+                load_fields,
+                start_time,
+                end_time,
+                freq,
+                self._fundamental_staleness
+            )
+        
+        if retry is None:
+            data = load()
+        else:
+            data = retry.call(ctx, load, instrument=instrument, on_retry=self._log_retry(instrument))
+        
+        if calendar is not None and data is not None and not data.empty:
+            data = data[calendar.session_mask(pd.DatetimeIndex(data.index), freq)]
+        
+        # 没有数据的标的视为缺失，显式报错而不是静默丢弃
+        if data is None or data.empty:
+            raise self._no_data_error(instrument, fields, start_time, end_time, freq)
+        
+        # 复权在交易日过滤之后进行，前复权以区间内最后一个交易日为基准
+        if adjusting:
+            data = adjust_prices(data, adjust, data_provider.adjusted_prices)[base_fields]
+        
+        keep = np.ones(len(data), dtype=bool)
+        if universe is not None:
+            keep &= universe.membership_mask(instrument, data.index)
+        delisting = get_delisting(instrument) if universe is None else universe.delisting(instrument)
+        if delisting is not None:
+            keep &= ~delisting.delisted_mask(data.index)
+        if not keep.any():
+            raise self._no_data_error(instrument, fields, start_time, end_time, freq)
+        
+        if defer:
+            raw = [field for field in fields if field not in expressions]
+            base = data
+            
+            def evaluate(names: List[str]) -> pd.DataFrame:
+                columns = {name: expressions[name].evaluate(base, ctx) for name in names}
+                return pd.DataFrame(columns, index=base.index)[keep]
+            
+            frame = LazyFeatureFrame(instrument, fields, evaluate, preloaded=data[raw][keep])
+        elif expressions:
+            columns = {
+                field: expressions[field].evaluate(data, ctx) if field in expressions else data[field]
+                for field in fields
+            }
+            data = pd.DataFrame(columns, index=data.index)
+        if not keep.all():
+            data = data[keep]
+        if started is not None:
+            current_logger().debug(
+                "标的 %s 获取完成 - 提供者: %s, 行数: %d, 耗时: %.3f秒",
+                instrument, data_provider.name, len(data), time.perf_counter() - started
+            )
+        return frame if defer else data
+    
+    def _normalize_codes(self, codes: List[str], errors: Dict[str, Exception]) -> List[str]:
+        """
+        把请求的代码统一为内部形式 / Canonicalize the requested codes
+        
+        无法识别的代码以InstrumentCodeError记录在errors中（键为原始代码），不参与获取
+        Unrecognized codes are recorded in errors as InstrumentCodeError, keyed
+        by the code as given, and are not fetched
+        """
+        normalized = []
+        for code in codes:
+            try:
+                normalized.append(normalize_instrument(code))
+            except InstrumentCodeError as e:
+                if log_enabled(logging.WARNING):
+                    current_logger().warning("跳过标的 %s, 代码无法识别: %s", code, e.reason)
+                errors[code] = e
+        return normalized
+    
+    def _lazy_loader(
+        self,
+        data_provider: DataProvider,
+        instrument: str,
+        expressions: Dict[str, Expression],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str,
+        calendar: Optional[TradingCalendar],
+        ctx: RequestContext,
+        universe: Optional[Universe],
+        adjust: Optional[AdjustMode],
+        retry: Optional[RetryPolicy]
+    ) -> Callable[[List[str]], pd.DataFrame]:
+        """按需加载单个标的部分字段的函数 / Function loading some fields of one instrument on demand"""
+        def load(fields: List[str]) -> pd.DataFrame:
+            return self._fetch_instrument_features(
+                data_provider, instrument, fields,
+                {field: expressions[field] for field in fields if field in expressions},
+                start_time, end_time, freq, calendar, ctx, universe, adjust, retry
+            )
+        return load
+    
+    def _log_retry(self, target: str):
+        """重试前记录警告的回调 / Callback logging a warning before each retry"""
+        def log(attempt: int, error: Exception, wait: float) -> None:
+            self._logger.warning(f"{target} 第{attempt}次获取失败，{wait:.2f}秒后重试: {str(error)}")
+        return log
+    
+    def _no_data_error(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str
+    ) -> DataError:
+        """构造标的没有数据的错误 / Build the no-data error for an instrument"""
+        error_info = ErrorInfo(
+            error_code="DAT0010",
+            error_message_zh=f"标的没有数据: {instrument}",
+            error_message_en=f"No data for instrument: {instrument}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=(
+                f"instrument={instrument}, fields={fields}, "
+                f"start_time={start_time}, end_time={end_time}, freq={freq}"
+            ),
+            suggested_actions=[
+                "检查标的代码是否正确",
+                "验证时间范围是否在数据覆盖范围内"
+            ],
+            recoverable=True
+        )
+        return DataError(error_info)
+    
     def handle_missing_values(
         self,
         data: pd.DataFrame,
@@ -383,10 +1783,10 @@ class DataManager:
             data: 包含缺失值的数据 / Data containing missing values
             strategy: 缺失值处理策略 / Missing value handling strategy
             fill_value: 填充值（当strategy为ZERO时使用） / Fill value (used when strategy is ZERO)
-            
+        
         Returns:
             pd.DataFrame: 处理后的数据 / Processed data
-            
+        
         Raises:
             DataError: 处理失败时抛出 / Raised when processing fails
         """
@@ -440,7 +1840,7 @@ class DataManager:
             )
             
             return result
-            
+        
         except DataError:
             raise
         except Exception as e:
@@ -468,7 +1868,7 @@ class DataManager:
         
         Returns:
             DataInfo: 数据信息对象 / Data information object
-            
+        
         Raises:
             DataError: 获取失败时抛出 / Raised when retrieval fails
         """
@@ -517,7 +1917,7 @@ class DataManager:
             )
             
             return data_info
-            
+        
         except DataError:
             raise
         except Exception as e:
@@ -552,7 +1952,7 @@ class DataManager:
             required_start: 所需的开始日期
             required_end: 所需的结束日期
             instruments: 股票池
-            
+        
         Returns:
             Tuple[bool, str]: (是否覆盖, 消息)
         """
@@ -585,7 +1985,7 @@ class DataManager:
                 )
                 self._logger.warning(message)
                 return False, message
-                
+        
         except Exception as e:
             error_msg = f"数据覆盖检查失败: {str(e)}"
             self._logger.error(error_msg, exc_info=True)
@@ -605,6 +2005,16 @@ class DataManager:
         """获取QlibWrapper实例"""
         return self._qlib_wrapper
     
+    @property
+    def timezone(self) -> str:
+        """解释请求时间的默认交易所时区 / Default exchange timezone for request times"""
+        return self._timezone
+    
+    @property
+    def provider(self) -> DataProvider:
+        """请求未指定提供者时使用的数据提供者 / Data provider used when a request names none"""
+        return self._resolve_provider(None)
+    
     def clear_cache(self) -> None:
         """
         清理缓存以释放内存 / Clear cache to free memory
@@ -0,0 +1,395 @@
+"""
+增量数据更新模块 / Incremental Data Update Module
+检查本地存储中每个标的最后一根K线的时间，只从数据提供者获取之后的新数据并原子地追加
+Looks up the last stored bar of each instrument in a local store, fetches only
+the bars after it from a data provider and appends them atomically
+
+数据提供者经常在次日修订最近一根K线（如重新公布收盘价），因此每次更新都会重新获取
+最后overlap根已存储的K线，与存储中的值比较，有差异时以新数据为准并计入修订行数。
+写入总是先写临时文件再原子替换，更新中途崩溃不会留下截断的文件。
+Providers often restate the most recent bar (e.g. a corrected close) the next
+day, so every update re-fetches the last overlap stored bars as well, compares
+them with the stored values and, where they differ, keeps the new data and
+counts the rows as revised. Writes always go to a temporary file that is
+atomically renamed, so a crash mid-update never leaves a truncated file.
+
+Examples:
+    >>> store = ParquetStore("~/data/parquet")
+    >>> summary = update(store, ["SH600000", "SZ000001"], ["$open", "$close", "$volume"], provider=provider)
+    >>> summary.rows_added
+    {'SH600000': 1, 'SZ000001': 1}
+"""
+
+import os
+import tempfile
+import time
+from abc import ABC, abstractmethod
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Dict, List, Optional, Sequence
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.data_provider import DataProvider, FieldNotFoundError, get_default_provider
+from ..infrastructure.logger_system import get_logger
+from ..infrastructure.parquet_provider import read_parquet, write_parquet
+from ..utils.feature_cache import CacheEntry, FeatureCache
+
+
+# 每次更新重新获取并核对的已存储K线数 / Stored bars re-fetched and reconciled on every update
+DEFAULT_OVERLAP = 5
+
+# 判断已存储的值是否被修订的相对误差 / Relative tolerance when deciding whether a stored value was revised
+REVISION_TOLERANCE = 1e-9
+
+
+class DataStore(ABC):
+    """
+    本地K线存储 / Local bar store
+    
+    存储按标的保存以时间为索引的字段数据；replace_tail必须是原子的，读者只能看到
+    替换之前或之后的完整数据
+    The store keeps time-indexed field data per instrument; replace_tail must
+    be atomic, so readers only ever see the complete data from before or after
+    the replacement
+    """
+    
+    @abstractmethod
+    def index(self, instrument: str, fields: List[str], freq: str = "day") -> Optional[pd.DatetimeIndex]:
+        """
+        已存储的K线时间 / Timestamps of the stored bars
+        
+        Returns:
+            Optional[pd.DatetimeIndex]: 升序的时间，标的不存在或缺少某个字段时为None /
+                Ascending timestamps; None when the instrument is not stored or lacks a field
+        """
+    
+    @abstractmethod
+    def read(self, instrument: str, fields: List[str], start: pd.Timestamp, freq: str = "day") -> pd.DataFrame:
+        """读取start（包含）之后的已存储数据 / Read the stored rows from start (inclusive) on"""
+    
+    @abstractmethod
+    def replace_tail(
+        self,
+        instrument: str,
+        frame: pd.DataFrame,
+        start: Optional[pd.Timestamp],
+        freq: str = "day"
+    ) -> None:
+        """
+        原子地用frame替换start（包含）之后的数据，start为None时替换全部 /
+        Atomically replace the rows from start (inclusive) on with frame; None start replaces everything
+        """
+
+
+class ParquetStore(DataStore):
+    """
+    Parquet目录存储，布局与ParquetDataProvider相同 / Parquet directory store in the ParquetDataProvider layout
+    
+    每个标的一个<INSTRUMENT>.parquet文件，分钟数据位于以频率命名的子目录中。替换时
+    读出整个文件，合并后写入同一目录下的临时文件，再用os.replace原子替换。
+    One <INSTRUMENT>.parquet file per instrument, minute bars in a
+    subdirectory named after the frequency. A replacement reads the whole
+    file, writes the merged data to a temporary file in the same directory
+    and atomically swaps it in with os.replace.
+    """
+    
+    def __init__(self, data_dir: str, compression: str = "snappy"):
+        """
+        初始化存储 / Initialize store
+        
+        Args:
+            data_dir: Parquet文件目录 / Directory holding the Parquet files
+            compression: 写入时的压缩算法 / Compression codec used for writes
+        """
+        self._data_dir = Path(data_dir).expanduser()
+        self._compression = compression
+    
+    @property
+    def data_dir(self) -> Path:
+        """Parquet文件目录 / Parquet directory"""
+        return self._data_dir
+    
+    def index(self, instrument: str, fields: List[str], freq: str = "day") -> Optional[pd.DatetimeIndex]:
+        path = self.path(instrument, freq)
+        if not path.exists():
+            return None
+        try:
+            return read_parquet(str(path), fields).index
+        except FieldNotFoundError:
+            return None
+    
+    def read(self, instrument: str, fields: List[str], start: pd.Timestamp, freq: str = "day") -> pd.DataFrame:
+        return read_parquet(str(self.path(instrument, freq)), fields, start_time=start)
+    
+    def replace_tail(
+        self,
+        instrument: str,
+        frame: pd.DataFrame,
+        start: Optional[pd.Timestamp],
+        freq: str = "day"
+    ) -> None:
+        path = self.path(instrument, freq)
+        if start is not None and path.exists():
+            stored = read_parquet(str(path))
+            # 没有更新的列在被替换的行上保留原值
+            kept = [c for c in stored.columns if c not in frame.columns]
+            tail = frame.join(stored.loc[stored.index >= start, kept])
+            frame = pd.concat([stored[stored.index < start], tail])[list(stored.columns) + [
+                c for c in frame.columns if c not in stored.columns
+            ]]
+        
+        path.parent.mkdir(parents=True, exist_ok=True)
+        fd, tmp_name = tempfile.mkstemp(dir=path.parent, prefix=f".{path.stem}.", suffix=".tmp")
+        os.close(fd)
+        try:
+            write_parquet(tmp_name, frame, compression=self._compression, instrument=instrument)
+            os.replace(tmp_name, path)
+        except BaseException:
+            Path(tmp_name).unlink(missing_ok=True)
+            raise
+    
+    def path(self, instrument: str, freq: str = "day") -> Path:
+        """标的的Parquet文件路径 / Parquet file of an instrument"""
+        directory = self._data_dir if freq == "day" else self._data_dir / freq
+        return directory / f"{instrument}.parquet"
+
+
+class CacheStore(DataStore):
+    """
+    特征缓存存储 / Feature cache store
+    
+    每个字段是FeatureCache中的一个条目，逐个原子写入；同一标的的读改写通过
+    FeatureCache.lock()串行化。更新后条目的覆盖区间延伸到最后一根K线，
+    CachedDataProvider之后的请求不会重复获取这些数据。
+    Each field is one FeatureCache entry, each written atomically;
+    read-modify-write of an instrument is serialized with FeatureCache.lock().
+    After an update the entries cover through the last bar, so later
+    CachedDataProvider requests don't fetch that data again.
+    """
+    
+    def __init__(self, cache: FeatureCache):
+        """
+        初始化存储 / Initialize store
+        
+        Args:
+            cache: 特征缓存 / Feature cache
+        """
+        self._cache = cache
+    
+    @property
+    def cache(self) -> FeatureCache:
+        """特征缓存 / Feature cache"""
+        return self._cache
+    
+    def index(self, instrument: str, fields: List[str], freq: str = "day") -> Optional[pd.DatetimeIndex]:
+        # 只计入所有字段都有数据的时间
+        index = None
+        for f in fields:
+            entry = self._cache.read(instrument, f, freq)
+            if entry is None:
+                return None
+            stored = entry.series.dropna().index
+            index = stored if index is None else index.intersection(stored)
+        return index.sort_values() if index is not None else None
+    
+    def read(self, instrument: str, fields: List[str], start: pd.Timestamp, freq: str = "day") -> pd.DataFrame:
+        columns = {}
+        for f in fields:
+            entry = self._cache.read(instrument, f, freq)
+            series = pd.Series(dtype=float) if entry is None else entry.series
+            columns[f] = series[series.index >= start]
+        return pd.DataFrame(columns, columns=list(fields))
+    
+    def replace_tail(
+        self,
+        instrument: str,
+        frame: pd.DataFrame,
+        start: Optional[pd.Timestamp],
+        freq: str = "day"
+    ) -> None:
+        last = frame.index.max() if len(frame) else None
+        with self._cache.lock(instrument, freq):
+            for f in frame.columns:
+                entry = self._cache.read(instrument, f, freq)
+                series = frame[f].astype(float)
+                if entry is not None and start is not None:
+                    series = pd.concat([entry.series[entry.series.index < start], series])
+                series = series[~series.index.duplicated(keep="last")].sort_index()
+                series.index.name = "datetime"
+                series.name = f
+                
+                if entry is None or start is None:
+                    covered_start, covered_end = None, last
+                else:
+                    covered_start = entry.start
+                    covered_end = entry.end if entry.end is None or last is None else max(entry.end, last)
+                self._cache.write(
+                    instrument, f, freq,
+                    CacheEntry(series=series, start=covered_start, end=covered_end, created_at=time.time())
+                )
+
+
+@dataclass
+class InstrumentUpdate:
+    """
+    单个标的的更新结果 / Update result of one instrument
+    
+    Attributes:
+        rows_added: 追加的新K线数 / New bars appended
+        rows_revised: 被修订的已存储K线数 / Stored bars that were revised
+        last_time: 更新后最后一根K线的时间，没有数据时为None / Last bar after the update, None without data
+        full_history: 是否因本地没有数据而获取了全部历史 / Whether the full history was fetched for lack of local data
+    """
+    rows_added: int = 0
+    rows_revised: int = 0
+    last_time: Optional[pd.Timestamp] = None
+    full_history: bool = False
+
+
+@dataclass
+class UpdateSummary:
+    """
+    增量更新汇总 / Incremental update summary
+    
+    Attributes:
+        instruments: 每个成功更新的标的的结果 / Result of every instrument updated
+        failed: 更新失败的标的及错误信息，失败的标的存储保持不变 /
+            Instruments that failed with their error messages; their stored data is unchanged
+    """
+    instruments: Dict[str, InstrumentUpdate] = field(default_factory=dict)
+    failed: Dict[str, str] = field(default_factory=dict)
+    
+    @property
+    def rows_added(self) -> Dict[str, int]:
+        """每个标的追加的新K线数 / New bars appended per instrument"""
+        return {code: result.rows_added for code, result in self.instruments.items()}
+    
+    @property
+    def rows_revised(self) -> Dict[str, int]:
+        """每个标的被修订的K线数 / Revised bars per instrument"""
+        return {code: result.rows_revised for code, result in self.instruments.items()}
+    
+    @property
+    def total_added(self) -> int:
+        """追加的新K线总数 / Total new bars appended"""
+        return sum(result.rows_added for result in self.instruments.values())
+
+
+def update(
+    store: DataStore,
+    instruments: Sequence[str],
+    fields: List[str],
+    provider: Optional[DataProvider] = None,
+    end_time: Optional[str] = None,
+    freq: str = "day",
+    overlap: int = DEFAULT_OVERLAP
+) -> UpdateSummary:
+    """
+    增量更新本地存储 / Incrementally update a local store
+    
+    本地没有某个标的（或缺少某个字段）时获取其全部历史；否则从倒数第overlap根已存储
+    的K线开始获取，修订的K线和之后的新K线一起原子地写回。某个标的失败时记录在
+    UpdateSummary.failed中，继续更新其他标的。
+    An instrument that isn't stored (or lacks a field) gets its full history;
+    otherwise the fetch starts at the overlap-th last stored bar, and revised
+    bars are written back atomically together with the new ones. An
+    instrument that fails is recorded in UpdateSummary.failed and the others
+    carry on.
+    
+    Args:
+        store: 本地存储，如ParquetStore或CacheStore / Local store, e.g. ParquetStore or CacheStore
+        instruments: 标的代码列表 / Instrument codes
+        fields: 字段列表，如["$open", "$close"] / Fields such as ["$open", "$close"]
+        provider: 数据提供者，None表示使用默认提供者 / Data provider, None uses the default provider
+        end_time: 获取数据的结束时间，None表示到最新 / End of the fetch, None for the latest data
+        freq: 数据频率 / Data frequency
+        overlap: 重新获取并核对的已存储K线数 / Stored bars re-fetched and reconciled
+    
+    Returns:
+        UpdateSummary: 每个标的追加和修订的行数 / Rows appended and revised per instrument
+    
+    Raises:
+        ValueError: 没有数据提供者、字段为空或overlap不是正数时抛出 /
+            Raised without a data provider, with no fields, or when overlap is not positive
+    """
+    if not fields:
+        raise ValueError("update needs at least one field")
+    if overlap < 1:
+        raise ValueError(f"overlap must be positive, got {overlap}")
+    provider = provider or get_default_provider()
+    if provider is None:
+        raise ValueError("update needs a data provider, pass provider= or set a default provider")
+    logger = get_logger(__name__)
+    
+    summary = UpdateSummary()
+    for instrument in dict.fromkeys(instruments):
+        try:
+            summary.instruments[instrument] = _update_instrument(
+                store, provider, instrument, list(fields), end_time, freq, overlap
+            )
+        except Exception as e:
+            logger.error(f"增量更新失败: {instrument}, 错误: {str(e)}")
+            summary.failed[instrument] = str(e)
+    
+    logger.info(
+        f"增量更新完成 - 标的: {len(summary.instruments)}, 失败: {len(summary.failed)}, "
+        f"新增行数: {summary.total_added}, "
+        f"修订行数: {sum(r.rows_revised for r in summary.instruments.values())}"
+    )
+    return summary
+
+
+def _update_instrument(
+    store: DataStore,
+    provider: DataProvider,
+    instrument: str,
+    fields: List[str],
+    end_time: Optional[str],
+    freq: str,
+    overlap: int
+) -> InstrumentUpdate:
+    """更新一个标的 / Update one instrument"""
+    stored_index = store.index(instrument, fields, freq)
+    if stored_index is None or len(stored_index) == 0:
+        fetched = _clean(provider.load_features(instrument, fields, end_time=end_time, freq=freq), fields)
+        if fetched.empty:
+            return InstrumentUpdate(full_history=True)
+        store.replace_tail(instrument, fetched, None, freq)
+        return InstrumentUpdate(rows_added=len(fetched), last_time=fetched.index[-1], full_history=True)
+    
+    last = stored_index[-1]
+    start = stored_index[-min(overlap, len(stored_index))]
+    fetched = _clean(provider.load_features(instrument, fields, start_time=start, end_time=end_time, freq=freq), fields)
+    fetched = fetched[fetched.index >= start]
+    stored = store.read(instrument, fields, start, freq)
+    
+    added = fetched[fetched.index > last]
+    revised = _revised_rows(stored, fetched[fetched.index <= last])
+    if added.empty and revised == 0:
+        return InstrumentUpdate(last_time=last)
+    
+    # 提供者没有返回的已存储K线保持不变
+    merged = pd.concat([stored, fetched])
+    merged = merged[~merged.index.duplicated(keep="last")].sort_index()
+    store.replace_tail(instrument, merged, start, freq)
+    return InstrumentUpdate(rows_added=len(added), rows_revised=revised, last_time=merged.index[-1])
+
+
+def _clean(frame: pd.DataFrame, fields: List[str]) -> pd.DataFrame:
+    """按时间排序、去重，并去掉所有字段都缺失的行 / Sort, dedupe and drop rows missing every field"""
+    frame = frame[list(fields)].sort_index()
+    frame = frame[~frame.index.duplicated(keep="last")]
+    return frame.dropna(how="all")
+
+
+def _revised_rows(stored: pd.DataFrame, fetched: pd.DataFrame) -> int:
+    """重叠区间内取值不同的行数，两边都为NaN视为相同 / Overlapping rows whose values differ; NaN on both sides counts as equal"""
+    common = stored.index.intersection(fetched.index)
+    if len(common) == 0:
+        return 0
+    old = stored.loc[common, fetched.columns].to_numpy(dtype=float)
+    new = fetched.loc[common].to_numpy(dtype=float)
+    same = np.isclose(old, new, rtol=REVISION_TOLERANCE, atol=0.0, equal_nan=True)
+    return int((~same.all(axis=1)).sum())
@@ -0,0 +1,163 @@
+"""
+退市模块 / Delisting Module
+记录标的的退市日期和退市结算价，供数据获取、标的池和回测引擎使用
+Records the delisting date and final settlement of instruments for data
+fetching, universes and the backtest engine
+
+退市日是最后一个交易日。get_features()返回的数据截止到退市日（包含），标的池在退市日
+之后不再包含该标的，回测引擎在退市日收盘后按结算价强制平仓，成交记为FillKind.DELIST。
+结算价可以直接给出，也可以按回收比例乘以最后一个收盘价计算，两者都不给时按最后一个
+收盘价结算。
+The delisting date is the last trading day. get_features() returns bars up to
+and including it, universes drop the instrument after it, and the backtest
+engine force-liquidates positions at the settlement price after its close,
+recording the fill as FillKind.DELIST. The settlement is either a price or a
+recovery rate applied to the last close; with neither it is the last close.
+
+Examples:
+    >>> register_delisting(Delisting("SZ000033", "2017-07-06", recovery_rate=0.0))
+    >>> get_delisting("SZ000033").settlement(1.28)
+    0.0
+"""
+
+import math
+import threading
+from dataclasses import dataclass
+from datetime import date, datetime
+from typing import Dict, Iterable, Optional, Union
+
+import numpy as np
+import pandas as pd
+
+
+TimeLike = Union[str, date, datetime, pd.Timestamp]
+
+
+@dataclass(frozen=True)
+class Delisting:
+    """
+    标的的退市信息 / Delisting of an instrument
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        date: 退市日，即最后一个交易日 / Delisting date, the last trading day
+        settlement_price: 退市结算价，None表示按回收比例计算 /
+            Final settlement price; None derives it from the recovery rate
+        recovery_rate: 结算价占最后一个收盘价的比例，在[0, 1]之间，None表示1 /
+            Settlement as a share of the last close, in [0, 1]; None means 1
+    """
+    instrument: str
+    date: TimeLike
+    settlement_price: Optional[float] = None
+    recovery_rate: Optional[float] = None
+    
+    def __post_init__(self):
+        day = pd.Timestamp(self.date)
+        if day.tzinfo is not None:
+            day = day.tz_localize(None)
+        object.__setattr__(self, "date", day.normalize())
+        if self.settlement_price is not None and self.recovery_rate is not None:
+            raise ValueError(f"{self.instrument}: give either settlement_price or recovery_rate, not both")
+        if self.settlement_price is not None and not (
+            math.isfinite(self.settlement_price) and self.settlement_price >= 0
+        ):
+            raise ValueError(f"settlement_price must be non-negative, got {self.settlement_price}")
+        if self.recovery_rate is not None and not 0 <= self.recovery_rate <= 1:
+            raise ValueError(f"recovery_rate must be in [0, 1], got {self.recovery_rate}")
+    
+    def settlement(self, last_close: Optional[float]) -> float:
+        """
+        计算退市结算价 / Compute the settlement price
+        
+        Args:
+            last_close: 退市日（包含）之前最后一个收盘价，没有时为None /
+                Last close at or before the delisting date, None when there is none
+        
+        Returns:
+            float: 结算价 / Settlement price
+        
+        Raises:
+            ValueError: 没有给出结算价且没有收盘价时抛出 /
+                Raised when there is no settlement price and no close to derive it from
+        """
+        if self.settlement_price is not None:
+            return float(self.settlement_price)
+        rate = 1.0 if self.recovery_rate is None else float(self.recovery_rate)
+        if rate == 0:
+            return 0.0
+        if last_close is None or not math.isfinite(last_close) or last_close <= 0:
+            raise ValueError(f"{self.instrument} has no close to settle its delisting at")
+        return float(last_close) * rate
+    
+    def is_delisted(self, t: TimeLike) -> bool:
+        """
+        t所在的日期是否在退市日之后 / Whether the day of t is after the delisting date
+        
+        Args:
+            t: 时间 / Time
+        
+        Returns:
+            bool: 退市日之后返回True，退市日当天仍可交易 / True after the delisting date; the day itself still trades
+        """
+        ts = pd.Timestamp(t)
+        if ts.tzinfo is not None:
+            ts = ts.tz_localize(None)
+        return ts.normalize() > self.date
+    
+    def delisted_mask(self, index: pd.DatetimeIndex) -> np.ndarray:
+        """
+        标记索引中退市日之后的行 / Mark the rows of an index after the delisting date
+        
+        Args:
+            index: 时间索引 / Time index
+        
+        Returns:
+            np.ndarray: 布尔掩码，退市日当天的分钟K线不算退市之后 /
+                Boolean mask; intraday bars on the delisting date are not after it
+        """
+        index = pd.DatetimeIndex(index)
+        if index.tz is not None:
+            index = index.tz_localize(None)
+        return np.asarray(index.normalize() > self.date)
+
+
+# 已注册的退市信息，键为标的代码
+_DELISTINGS: Dict[str, Delisting] = {}
+_delistings_lock = threading.Lock()
+
+
+def register_delisting(delisting: Delisting) -> None:
+    """
+    注册或覆盖标的的退市信息 / Register or replace the delisting of an instrument
+    
+    Args:
+        delisting: 退市信息 / Delisting
+    """
+    if not isinstance(delisting, Delisting):
+        raise TypeError(f"delisting must be a Delisting, got {type(delisting).__name__}")
+    with _delistings_lock:
+        _DELISTINGS[delisting.instrument] = delisting
+
+
+def register_delistings(delistings: Iterable[Delisting]) -> None:
+    """
+    批量注册退市信息 / Register several delistings
+    
+    Args:
+        delistings: 退市信息 / Delistings
+    """
+    for delisting in delistings:
+        register_delisting(delisting)
+
+
+def get_delisting(instrument: str) -> Optional[Delisting]:
+    """
+    查找标的的退市信息 / Look up the delisting of an instrument
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+    
+    Returns:
+        Optional[Delisting]: 退市信息，未退市时为None / The delisting, None for a listed instrument
+    """
+    return _DELISTINGS.get(instrument)
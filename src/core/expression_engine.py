@@ -0,0 +1,977 @@
+"""
+字段表达式引擎模块 / Field Expression Engine Module
+解析并计算形如"$close/Ref($close,1)-1"、"Mean($close,20)"的派生字段
+Parses and evaluates derived fields such as "$close/Ref($close,1)-1" and "Mean($close,20)"
+
+语法 / Grammar:
+    comparison := additive (("<" | "<=" | ">" | ">=" | "==" | "!=") additive)*
+    additive   := term (("+" | "-") term)*
+    term       := unary (("*" | "/") unary)*
+    unary      := "-" unary | primary
+    primary    := NUMBER | FIELD | NAME "(" comparison ("," comparison)* ")" | "(" comparison ")"
+
+缺失值约定 / NaN conventions:
+    - 滚动窗口函数（Mean/Std/Sum/Max/Min）的前window-1行为NaN /
+      Rolling functions (Mean/Std/Sum/Max/Min) are NaN for the first window-1 rows
+    - Ref($x, n)的前n行为NaN / Ref($x, n) is NaN for the first n rows
+    - 技术指标函数（EMA/WMA/RSI/MACD/MACDSignal/MACDHist/ATR/KDJK/KDJD/KDJJ/
+      BollUpper/BollLower）与indicators模块中的同名函数一致，包括预热期和
+      递推初值（如EMA以第一个完整窗口的简单平均为初值） / Technical indicator
+      functions (EMA/WMA/RSI/MACD/MACDSignal/MACDHist/ATR/KDJK/KDJD/KDJJ/
+      BollUpper/BollLower) match the functions of the same name in the
+      indicators module, lead-in and recursive seeding included (EMA, for
+      instance, is seeded with the simple average of the first full window)
+    - 递推指标依赖全部历史，分块计算时带入约20个时间常数的历史，块边界之后的
+      结果与一次性计算的相对误差约为e^-20 / Recursive indicators depend on the
+      whole history; chunked evaluation carries about 20 time constants of
+      history, so past a chunk boundary results differ from a single pass by
+      a relative error of about e^-20
+    - 任一输入为NaN时算术和比较结果为NaN，除以0的结果为NaN /
+      Arithmetic and comparisons are NaN when any input is NaN; division by zero is NaN
+    - 比较运算返回1.0（真）或0.0（假） / Comparisons return 1.0 (true) or 0.0 (false)
+    - 截面函数（CSRank/CSZScore/CSDemean/CSWinsorize）在同一时刻的标的之间计算，
+      该时刻为NaN的标的不参与统计 / Cross-sectional functions (CSRank/CSZScore/
+      CSDemean/CSWinsorize) work across the instruments at each timestamp, and
+      instruments that are NaN there are left out of the statistics
+"""
+
+import re
+import threading
+from dataclasses import dataclass
+from typing import Callable, Dict, Iterable, List, Optional, Set, Union
+
+import numpy as np
+import pandas as pd
+
+from . import indicators
+from .cross_section import cs_demean, cs_rank, cs_winsorize, cs_zscore
+from ..utils.request_context import RequestContext
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+# 原始字段名，如"$close"
+_FIELD_PATTERN = re.compile(r"\$[A-Za-z_][A-Za-z0-9_]*")
+_NAME_PATTERN = re.compile(r"[A-Za-z_][A-Za-z0-9_]*")
+_NUMBER_PATTERN = re.compile(r"(\d+\.\d*|\.\d+|\d+)([eE][+-]?\d+)?")
+
+_COMPARISON_OPS = ("<=", ">=", "==", "!=", "<", ">")
+_SINGLE_CHAR_TOKENS = "+-*/(),"
+
+
+class ExpressionError(DataError):
+    """
+    表达式错误 / Expression error
+    
+    position为出错字符在表达式中的偏移（从0开始）
+    position is the 0-based character offset of the offending token
+    """
+    
+    def __init__(self, expression: str, position: int, message: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            expression: 表达式文本 / Expression text
+            position: 出错位置 / Offending position
+            message: 错误描述 / Error description
+        """
+        self.expression = expression
+        self.position = position
+        self.reason = message
+        pointer = " " * position + "^"
+        error_info = ErrorInfo(
+            error_code="DAT0015",
+            error_message_zh=f"表达式错误（位置 {position}）: {message}",
+            error_message_en=f"Expression error at position {position}: {message}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"{expression}\n{pointer}",
+            suggested_actions=[
+                "检查括号是否匹配",
+                "检查函数名和参数个数是否正确",
+                "确认字段名以$开头，如$close"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+@dataclass
+class Token:
+    """词法单元 / Lexical token"""
+    kind: str  # NUMBER, FIELD, NAME, OP, END
+    value: str
+    position: int
+
+
+def tokenize(text: str) -> List[Token]:
+    """
+    把表达式切分为词法单元 / Split an expression into tokens
+    
+    Args:
+        text: 表达式文本 / Expression text
+    
+    Returns:
+        List[Token]: 以END结尾的词法单元列表 / Tokens terminated by END
+    
+    Raises:
+        ExpressionError: 遇到无法识别的字符时抛出 / Raised on an unrecognized character
+    """
+    tokens: List[Token] = []
+    i = 0
+    while i < len(text):
+        ch = text[i]
+        if ch.isspace():
+            i += 1
+            continue
+        
+        if ch == "$":
+            match = _FIELD_PATTERN.match(text, i)
+            if not match:
+                raise ExpressionError(text, i, "'$' must be followed by a field name")
+            tokens.append(Token("FIELD", match.group(), i))
+            i = match.end()
+            continue
+        
+        if ch.isdigit() or (ch == "." and i + 1 < len(text) and text[i + 1].isdigit()):
+            match = _NUMBER_PATTERN.match(text, i)
+            tokens.append(Token("NUMBER", match.group(), i))
+            i = match.end()
+            continue
+        
+        if ch.isalpha() or ch == "_":
+            match = _NAME_PATTERN.match(text, i)
+            tokens.append(Token("NAME", match.group(), i))
+            i = match.end()
+            continue
+        
+        op = next((o for o in _COMPARISON_OPS if text.startswith(o, i)), None)
+        if op is not None:
+            tokens.append(Token("OP", op, i))
+            i += len(op)
+            continue
+        
+        if ch in _SINGLE_CHAR_TOKENS:
+            tokens.append(Token("OP", ch, i))
+            i += 1
+            continue
+        
+        raise ExpressionError(text, i, f"unexpected character {ch!r}")
+    
+    tokens.append(Token("END", "", len(text)))
+    return tokens
+
+
+class Node:
+    """语法树节点基类 / Base AST node"""
+    position: int = 0
+
+
+@dataclass
+class NumberNode(Node):
+    """数值常量 / Numeric literal"""
+    value: float
+    position: int
+
+
+@dataclass
+class FieldNode(Node):
+    """原始字段引用 / Raw field reference"""
+    name: str
+    position: int
+
+
+@dataclass
+class UnaryNode(Node):
+    """一元运算 / Unary operation"""
+    op: str
+    operand: Node
+    position: int
+
+
+@dataclass
+class BinaryNode(Node):
+    """二元运算 / Binary operation"""
+    op: str
+    left: Node
+    right: Node
+    position: int
+
+
+@dataclass
+class CallNode(Node):
+    """函数调用 / Function call"""
+    name: str
+    args: List[Node]
+    position: int
+
+
+SeriesOrScalar = Union[pd.Series, float]
+
+
+@dataclass
+class FunctionSpec:
+    """
+    表达式函数定义 / Expression function definition
+    
+    Attributes:
+        arity: 参数个数 / Number of arguments
+        impl: 实现，参数为已计算的参数值 / Implementation taking evaluated arguments
+        int_args: 必须为整数常量的参数下标 / Indices of arguments that must be integer literals
+        min_int: 整数参数的最小值 / Minimum value of the integer arguments
+        lookback: 根据整数参数计算需要向前看的行数，None表示取整数参数的最大值 /
+            Rows of history needed given the integer arguments; None uses the largest one
+        float_args: 必须为数值常量的参数下标，以float传入 /
+            Indices of arguments that must be numeric literals, passed as float
+        cross_sectional: 是否为截面函数；截面函数的序列参数为时间×标的宽表，
+            返回形状相同的宽表 / Whether the function is cross-sectional; its series
+            arguments are time-by-instrument wide frames and it returns one of the same shape
+    """
+    arity: int
+    impl: Callable[..., SeriesOrScalar]
+    int_args: tuple = ()
+    min_int: Optional[int] = None
+    lookback: Optional[Callable[..., int]] = None
+    float_args: tuple = ()
+    cross_sectional: bool = False
+    
+    def history(self, int_values: List[int]) -> int:
+        """计算需要向前看的行数 / Rows of history needed"""
+        if self.lookback is not None:
+            return max(0, int(self.lookback(*int_values)))
+        return max([0] + [int(v) for v in int_values])
+
+
+def _ref(series: pd.Series, n: int) -> pd.Series:
+    return series.shift(n)
+
+
+def _rolling(method: str) -> Callable[[pd.Series, int], pd.Series]:
+    def impl(series: pd.Series, window: int) -> pd.Series:
+        return getattr(series.rolling(window, min_periods=window), method)()
+    return impl
+
+
+def _window_lookback(window: int) -> int:
+    return window - 1
+
+
+# 递推指标分块计算时带入的时间常数个数 / Time constants of history carried for recursive indicators
+_RECURSIVE_TIME_CONSTANTS = 20
+
+
+def _ema_lookback(window: int) -> int:
+    # EMA的时间常数约为(window + 1) / 2
+    return _RECURSIVE_TIME_CONSTANTS * (window + 1) // 2
+
+
+def _wilder_lookback(window: int) -> int:
+    # Wilder平滑的时间常数约为window
+    return _RECURSIVE_TIME_CONSTANTS * window
+
+
+def _kdj_lookback(window: int, k_smooth: int, d_smooth: int) -> int:
+    return window - 1 + _RECURSIVE_TIME_CONSTANTS * (k_smooth + d_smooth)
+
+
+def _like(series: pd.Series, values: List[float]) -> pd.Series:
+    """把指标结果放回输入的索引上 / Put indicator values back on the input's index"""
+    return pd.Series(values, index=series.index, dtype=float)
+
+
+def _values(series: pd.Series) -> np.ndarray:
+    return series.to_numpy(dtype=float)
+
+
+def _ema_op(series: pd.Series, window: int) -> pd.Series:
+    return _like(series, indicators.ema(_values(series), window))
+
+
+def _wma_op(series: pd.Series, window: int) -> pd.Series:
+    return _like(series, indicators.wma(_values(series), window))
+
+
+def _rsi_op(series: pd.Series, window: int) -> pd.Series:
+    return _like(series, indicators.rsi(_values(series), window))
+
+
+def _macd_op(part: str) -> Callable[..., pd.Series]:
+    def impl(series: pd.Series, fast: int, slow: int, signal: int = 1) -> pd.Series:
+        result = indicators.macd(_values(series), fast, slow, signal)
+        return _like(series, getattr(result, part))
+    return impl
+
+
+def _atr_op(high: pd.Series, low: pd.Series, close: pd.Series, window: int) -> pd.Series:
+    return _like(close, indicators.atr(_values(high), _values(low), _values(close), window))
+
+
+def _kdj_op(part: str) -> Callable[..., pd.Series]:
+    def impl(
+        high: pd.Series, low: pd.Series, close: pd.Series, window: int, k_smooth: int, d_smooth: int
+    ) -> pd.Series:
+        result = indicators.kdj(_values(high), _values(low), _values(close), window, k_smooth, d_smooth)
+        return _like(close, getattr(result, part))
+    return impl
+
+
+def _bollinger_op(part: str) -> Callable[[pd.Series, int, float], pd.Series]:
+    def impl(series: pd.Series, window: int, k: float) -> pd.Series:
+        return _like(series, getattr(indicators.bollinger(_values(series), window, k), part))
+    return impl
+
+
+FUNCTIONS: Dict[str, FunctionSpec] = {
+    "Ref": FunctionSpec(2, _ref, int_args=(1,)),
+    "Mean": FunctionSpec(2, _rolling("mean"), int_args=(1,), min_int=1, lookback=_window_lookback),
+    "Std": FunctionSpec(2, _rolling("std"), int_args=(1,), min_int=1, lookback=_window_lookback),
+    "Sum": FunctionSpec(2, _rolling("sum"), int_args=(1,), min_int=1, lookback=_window_lookback),
+    "Max": FunctionSpec(2, _rolling("max"), int_args=(1,), min_int=1, lookback=_window_lookback),
+    "Min": FunctionSpec(2, _rolling("min"), int_args=(1,), min_int=1, lookback=_window_lookback),
+    "EMA": FunctionSpec(2, _ema_op, int_args=(1,), min_int=1, lookback=_ema_lookback),
+    "WMA": FunctionSpec(2, _wma_op, int_args=(1,), min_int=1, lookback=_window_lookback),
+    "RSI": FunctionSpec(2, _rsi_op, int_args=(1,), min_int=1, lookback=_wilder_lookback),
+    # MACD为DIF线（快线EMA - 慢线EMA），MACDSignal为DEA线，MACDHist为DIF - DEA
+    "MACD": FunctionSpec(
+        3, _macd_op("macd"), int_args=(1, 2), min_int=1, lookback=lambda fast, slow: _ema_lookback(slow)
+    ),
+    "MACDSignal": FunctionSpec(
+        4, _macd_op("signal"), int_args=(1, 2, 3), min_int=1,
+        lookback=lambda fast, slow, signal: _ema_lookback(slow) + _ema_lookback(signal)
+    ),
+    "MACDHist": FunctionSpec(
+        4, _macd_op("histogram"), int_args=(1, 2, 3), min_int=1,
+        lookback=lambda fast, slow, signal: _ema_lookback(slow) + _ema_lookback(signal)
+    ),
+    "ATR": FunctionSpec(4, _atr_op, int_args=(3,), min_int=1, lookback=lambda window: _wilder_lookback(window) + 1),
+    "KDJK": FunctionSpec(6, _kdj_op("k"), int_args=(3, 4, 5), min_int=1, lookback=_kdj_lookback),
+    "KDJD": FunctionSpec(6, _kdj_op("d"), int_args=(3, 4, 5), min_int=1, lookback=_kdj_lookback),
+    "KDJJ": FunctionSpec(6, _kdj_op("j"), int_args=(3, 4, 5), min_int=1, lookback=_kdj_lookback),
+    "BollUpper": FunctionSpec(
+        3, _bollinger_op("upper"), int_args=(1,), min_int=1, lookback=_window_lookback, float_args=(2,)
+    ),
+    "BollLower": FunctionSpec(
+        3, _bollinger_op("lower"), int_args=(1,), min_int=1, lookback=_window_lookback, float_args=(2,)
+    ),
+    "CSRank": FunctionSpec(1, cs_rank, cross_sectional=True),
+    "CSZScore": FunctionSpec(1, cs_zscore, cross_sectional=True),
+    "CSDemean": FunctionSpec(1, cs_demean, cross_sectional=True),
+    "CSWinsorize": FunctionSpec(3, cs_winsorize, float_args=(1, 2), cross_sectional=True),
+}
+_functions_lock = threading.Lock()
+
+
+def register_function(
+    name: str,
+    arity: int,
+    impl: Callable[..., SeriesOrScalar],
+    int_args: tuple = (),
+    min_int: Optional[int] = None,
+    lookback: Optional[Callable[..., int]] = None,
+    float_args: tuple = (),
+    cross_sectional: bool = False
+) -> None:
+    """
+    注册表达式函数 / Register an expression function
+    
+    同名函数会被覆盖。impl接收已计算的参数：序列参数为pd.Series，
+    int_args中的参数为int。
+    A function registered under the same name is replaced. impl receives the
+    evaluated arguments: series arguments as pd.Series, int_args as int.
+    
+    Args:
+        name: 函数名，如"Sum" / Function name, e.g. "Sum"
+        arity: 参数个数 / Number of arguments
+        impl: 函数实现 / Implementation
+        int_args: 必须为整数常量的参数下标 / Indices of integer-literal arguments
+        min_int: 整数参数的最小值 / Minimum value of the integer arguments
+        lookback: 根据整数参数计算需要向前看的行数，用于分块计算；
+            None表示取整数参数的最大值 / Rows of history needed given the integer
+            arguments, used by chunked evaluation; None uses the largest one
+        float_args: 必须为数值常量的参数下标 / Indices of numeric-literal arguments
+        cross_sectional: 是否为截面函数，impl接收并返回时间×标的宽表 /
+            Whether the function is cross-sectional; impl takes and returns
+            time-by-instrument wide frames
+    """
+    if not _NAME_PATTERN.fullmatch(name):
+        raise ValueError(f"invalid function name: {name!r}")
+    if arity < 0:
+        raise ValueError(f"arity must be >= 0, got {arity}")
+    with _functions_lock:
+        FUNCTIONS[name] = FunctionSpec(
+            arity, impl, tuple(int_args), min_int, lookback, tuple(float_args), cross_sectional
+        )
+
+
+def _get_function(name: str) -> Optional[FunctionSpec]:
+    with _functions_lock:
+        return FUNCTIONS.get(name)
+
+
+class _Parser:
+    """递归下降解析器 / Recursive-descent parser"""
+    
+    def __init__(self, text: str, known_fields: Optional[Set[str]] = None):
+        self._text = text
+        self._tokens = tokenize(text)
+        self._index = 0
+        self._known_fields = known_fields
+    
+    @property
+    def _current(self) -> Token:
+        return self._tokens[self._index]
+    
+    def _advance(self) -> Token:
+        token = self._tokens[self._index]
+        self._index += 1
+        return token
+    
+    def _error(self, position: int, message: str) -> ExpressionError:
+        return ExpressionError(self._text, position, message)
+    
+    def parse(self) -> Node:
+        if self._current.kind == "END":
+            raise self._error(0, "empty expression")
+        node = self._comparison()
+        token = self._current
+        if token.kind != "END":
+            if token.value == ")":
+                raise self._error(token.position, "unbalanced ')'")
+            raise self._error(token.position, f"unexpected token {token.value!r}")
+        return node
+    
+    def _comparison(self) -> Node:
+        node = self._additive()
+        while self._current.kind == "OP" and self._current.value in _COMPARISON_OPS:
+            op = self._advance()
+            node = BinaryNode(op.value, node, self._additive(), op.position)
+        return node
+    
+    def _additive(self) -> Node:
+        node = self._term()
+        while self._current.kind == "OP" and self._current.value in ("+", "-"):
+            op = self._advance()
+            node = BinaryNode(op.value, node, self._term(), op.position)
+        return node
+    
+    def _term(self) -> Node:
+        node = self._unary()
+        while self._current.kind == "OP" and self._current.value in ("*", "/"):
+            op = self._advance()
+            node = BinaryNode(op.value, node, self._unary(), op.position)
+        return node
+    
+    def _unary(self) -> Node:
+        if self._current.kind == "OP" and self._current.value == "-":
+            op = self._advance()
+            return UnaryNode("-", self._unary(), op.position)
+        return self._primary()
+    
+    def _primary(self) -> Node:
+        token = self._current
+        
+        if token.kind == "NUMBER":
+            self._advance()
+            return NumberNode(float(token.value), token.position)
+        
+        if token.kind == "FIELD":
+            self._advance()
+            if self._known_fields is not None and token.value not in self._known_fields:
+                raise self._error(token.position, f"unknown field {token.value}")
+            return FieldNode(token.value, token.position)
+        
+        if token.kind == "NAME":
+            return self._call()
+        
+        if token.kind == "OP" and token.value == "(":
+            self._advance()
+            node = self._comparison()
+            self._expect_close(token)
+            return node
+        
+        if token.kind == "END":
+            raise self._error(token.position, "unexpected end of expression")
+        raise self._error(token.position, f"unexpected token {token.value!r}")
+    
+    def _call(self) -> Node:
+        name = self._advance()
+        spec = _get_function(name.value)
+        if spec is None:
+            raise self._error(name.position, f"unknown function {name.value}")
+        
+        open_paren = self._current
+        if not (open_paren.kind == "OP" and open_paren.value == "("):
+            raise self._error(open_paren.position, f"expected '(' after {name.value}")
+        self._advance()
+        
+        args: List[Node] = []
+        if not (self._current.kind == "OP" and self._current.value == ")"):
+            args.append(self._comparison())
+            while self._current.kind == "OP" and self._current.value == ",":
+                self._advance()
+                args.append(self._comparison())
+        self._expect_close(open_paren)
+        
+        if len(args) != spec.arity:
+            raise self._error(
+                name.position,
+                f"{name.value} expects {spec.arity} arguments, got {len(args)}"
+            )
+        for i in spec.int_args:
+            self._check_int_arg(name.value, args[i], spec.min_int)
+        for i in spec.float_args:
+            if _constant(args[i]) is None:
+                raise self._error(args[i].position, f"{name.value} requires a numeric constant here")
+        
+        return CallNode(name.value, args, name.position)
+    
+    def _check_int_arg(self, func: str, arg: Node, min_int: Optional[int]) -> None:
+        # 允许负数常量，如Ref($close,-1)
+        value = _constant(arg)
+        if value is None or value != int(value):
+            raise self._error(arg.position, f"{func} requires an integer constant here")
+        if min_int is not None and value < min_int:
+            raise self._error(arg.position, f"{func} window must be >= {min_int}")
+    
+    def _expect_close(self, open_token: Token) -> None:
+        token = self._current
+        if token.kind == "OP" and token.value == ")":
+            self._advance()
+            return
+        if token.kind == "END":
+            raise self._error(open_token.position, "unbalanced '(' (missing ')')")
+        raise self._error(token.position, f"expected ')' but found {token.value!r}")
+
+
+def _constant(node: Node) -> Optional[float]:
+    """数值常量（可带负号）的值，其他节点返回None / Value of a (possibly negated) numeric literal, None otherwise"""
+    if isinstance(node, NumberNode):
+        return node.value
+    if isinstance(node, UnaryNode) and isinstance(node.operand, NumberNode):
+        return -node.operand.value
+    return None
+
+
+def _int_value(node: Node) -> int:
+    return int(_constant(node))
+
+
+class Expression:
+    """
+    已解析的表达式 / Parsed expression
+    
+    在单个标的的时间序列上计算，Ref等函数在该标的内部按行偏移；
+    包含截面函数的表达式需要在(instrument, datetime)多级索引的数据上计算
+    Evaluated over a single instrument's time series; Ref and friends shift
+    rows within that instrument. Expressions using cross-sectional functions
+    need a frame with an (instrument, datetime) MultiIndex
+    """
+    
+    def __init__(self, text: str, root: Node):
+        """
+        初始化表达式 / Initialize expression
+        
+        Args:
+            text: 表达式文本 / Expression text
+            root: 语法树根节点 / AST root
+        """
+        self.text = text
+        self.root = root
+        self.fields: List[str] = list(dict.fromkeys(_collect_fields(root)))
+    
+    @property
+    def lookback(self) -> int:
+        """
+        计算当前行需要的历史行数 / Rows of history needed to compute the current row
+        
+        例如Mean(Ref($close,1),5)需要5行历史。分块计算时把上一块末尾的这些行
+        带入下一块，使块边界两侧的结果与一次性计算一致。
+        For example Mean(Ref($close,1),5) needs 5 rows of history. Chunked
+        evaluation carries that many rows from the previous chunk so results
+        on both sides of a chunk boundary match a single-pass evaluation.
+        """
+        return _lookback(self.root)
+    
+    @property
+    def cross_sectional(self) -> bool:
+        """是否包含截面函数，如CSRank / Whether the expression uses a cross-sectional function such as CSRank"""
+        return _cross_section_call(self.root) is not None
+    
+    @property
+    def cross_section_position(self) -> Optional[int]:
+        """第一个截面函数调用的位置，没有时为None / Position of the first cross-sectional call, None without one"""
+        node = _cross_section_call(self.root)
+        return None if node is None else node.position
+    
+    @property
+    def future_reference_position(self) -> Optional[int]:
+        """
+        第一个引用未来数据的调用的位置，没有时为None / Position of the first call reading future rows, None without one
+        
+        Ref($close,-1)把下一行的值移到当前行，回测中会造成未来函数
+        Ref($close,-1) moves the next row's value onto the current one, which is lookahead in a backtest
+        """
+        node = _future_reference(self.root)
+        return None if node is None else node.position
+    
+    def evaluate(
+        self,
+        frame: pd.DataFrame,
+        ctx: Optional[RequestContext] = None,
+        mask: Optional[pd.Series] = None
+    ) -> pd.Series:
+        """
+        在数据上计算表达式 / Evaluate the expression over a frame
+        
+        frame为(instrument, datetime)多级索引时按标的分组计算，
+        Ref等函数不会跨标的偏移；截面函数则按时间分组，在同一时刻的标的之间计算。
+        When frame has an (instrument, datetime) MultiIndex the expression is
+        evaluated per instrument, so Ref and friends never shift across
+        instruments, while cross-sectional functions group by timestamp and
+        work across the instruments at each one.
+        
+        Args:
+            frame: 以时间为索引、包含所引用原始字段的数据 / Time-indexed frame holding the referenced fields
+            ctx: 请求上下文，每个函数调用和标的之间检查取消 /
+                Request context, checked before every function call and instrument
+            mask: 与frame索引对齐的布尔序列，截面函数只在为True的行之间计算，
+                其余行的截面结果为NaN；时间序列函数不受影响 / Boolean series aligned
+                to frame; cross-sectional functions only take the True rows into
+                account and are NaN elsewhere, while time-series functions still
+                see every row
+        
+        Returns:
+            pd.Series: 与frame索引对齐的结果 / Result aligned to the frame's index
+        
+        Raises:
+            ExpressionError: 所引用的字段不在数据中、函数计算失败，或在单个标的上使用截面函数时抛出，
+                包含出错位置 / Raised with the offending position when a field is absent,
+                a function fails, or a cross-sectional function is used on a single instrument
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        if isinstance(frame.index, pd.MultiIndex) and "instrument" in frame.index.names:
+            if self.cross_sectional:
+                value = self._eval_panel(self.root, frame, ctx, mask)
+                if not isinstance(value, pd.Series):
+                    value = pd.Series(float(value), index=frame.index)
+                value = value.astype(float).replace([np.inf, -np.inf], np.nan)
+                value.name = self.text
+                return value
+            parts = [
+                self._evaluate_single(group, ctx)
+                for _, group in frame.groupby(level="instrument", sort=False)
+            ]
+            if not parts:
+                return pd.Series(dtype=float, index=frame.index, name=self.text)
+            value = pd.concat(parts).reindex(frame.index)
+            value.name = self.text
+            return value
+        return self._evaluate_single(frame, ctx)
+    
+    def _evaluate_single(self, frame: pd.DataFrame, ctx: Optional[RequestContext]) -> pd.Series:
+        if ctx is not None:
+            ctx.check()
+        value = self._eval(self.root, frame, ctx)
+        if not isinstance(value, pd.Series):
+            value = pd.Series(float(value), index=frame.index)
+        value = value.astype(float).replace([np.inf, -np.inf], np.nan)
+        value.name = self.text
+        return value
+    
+    def _eval(
+        self,
+        node: Node,
+        frame: pd.DataFrame,
+        ctx: Optional[RequestContext] = None
+    ) -> SeriesOrScalar:
+        if isinstance(node, NumberNode):
+            return node.value
+        
+        if isinstance(node, FieldNode):
+            if node.name not in frame.columns:
+                raise ExpressionError(self.text, node.position, f"field {node.name} not in data")
+            return frame[node.name].astype(float)
+        
+        if isinstance(node, UnaryNode):
+            return -self._eval(node.operand, frame, ctx)
+        
+        if isinstance(node, BinaryNode):
+            left = self._eval(node.left, frame, ctx)
+            right = self._eval(node.right, frame, ctx)
+            return _apply_binary(node.op, left, right)
+        
+        if isinstance(node, CallNode):
+            spec = self._spec(node)
+            if spec.cross_sectional:
+                raise ExpressionError(
+                    self.text, node.position,
+                    f"{node.name} is cross-sectional and needs an (instrument, datetime) frame"
+                )
+            args = self._args(node, spec, lambda arg: self._eval(arg, frame, ctx), frame.index)
+            if ctx is not None:
+                ctx.check()
+            return self._call(node, spec, args)
+        
+        raise ExpressionError(self.text, node.position, f"unsupported node {type(node).__name__}")
+    
+    def _eval_panel(
+        self,
+        node: Node,
+        frame: pd.DataFrame,
+        ctx: Optional[RequestContext] = None,
+        mask: Optional[pd.Series] = None
+    ) -> SeriesOrScalar:
+        """
+        在多标的数据上计算包含截面函数的节点 / Evaluate a node holding cross-sectional calls over a multi-instrument frame
+        
+        不含截面函数的子树按标的分组计算；截面函数把参数转为时间×标的宽表后计算，
+        再按原索引展开；参数中含截面函数的时间序列函数按标的分组应用
+        Subtrees without cross-sectional calls are evaluated per instrument.
+        Cross-sectional calls pivot their arguments into time-by-instrument
+        wide frames and unpivot the result onto the original index.
+        Time-series calls over cross-sectional arguments are applied per
+        instrument.
+        """
+        if isinstance(node, NumberNode):
+            return node.value
+        if _cross_section_call(node) is None:
+            return self._per_instrument(frame, ctx, lambda group: self._eval(node, group, ctx))
+        
+        if isinstance(node, UnaryNode):
+            return -self._eval_panel(node.operand, frame, ctx, mask)
+        
+        if isinstance(node, BinaryNode):
+            left = self._eval_panel(node.left, frame, ctx, mask)
+            right = self._eval_panel(node.right, frame, ctx, mask)
+            return _apply_binary(node.op, left, right)
+        
+        spec = self._spec(node)
+        args = self._args(node, spec, lambda arg: self._eval_panel(arg, frame, ctx, mask), frame.index)
+        if ctx is not None:
+            ctx.check()
+        
+        if spec.cross_sectional:
+            if mask is not None:
+                args = [
+                    arg.where(mask.reindex(frame.index, fill_value=False).astype(bool))
+                    if isinstance(arg, pd.Series) else arg
+                    for arg in args
+                ]
+            wide = [
+                arg.unstack(level="instrument") if isinstance(arg, pd.Series) else arg
+                for arg in args
+            ]
+            value = self._call(node, spec, wide).unstack()
+            if list(value.index.names) != list(frame.index.names):
+                value = value.reorder_levels(frame.index.names)
+            return value.reindex(frame.index)
+        
+        def apply(group: pd.DataFrame) -> SeriesOrScalar:
+            return self._call(node, spec, [
+                arg.reindex(group.index) if isinstance(arg, pd.Series) else arg
+                for arg in args
+            ])
+        return self._per_instrument(frame, ctx, apply)
+    
+    def _per_instrument(
+        self,
+        frame: pd.DataFrame,
+        ctx: Optional[RequestContext],
+        compute: Callable[[pd.DataFrame], SeriesOrScalar]
+    ) -> pd.Series:
+        """按标的分组计算并拼回原索引 / Compute per instrument and stitch back onto the original index"""
+        parts = []
+        for _, group in frame.groupby(level="instrument", sort=False):
+            if ctx is not None:
+                ctx.check()
+            value = compute(group)
+            if not isinstance(value, pd.Series):
+                value = pd.Series(float(value), index=group.index)
+            parts.append(value)
+        if not parts:
+            return pd.Series(dtype=float, index=frame.index)
+        return pd.concat(parts).reindex(frame.index)
+    
+    def _spec(self, node: CallNode) -> FunctionSpec:
+        spec = _get_function(node.name)
+        if spec is None:
+            raise ExpressionError(self.text, node.position, f"unknown function {node.name}")
+        return spec
+    
+    def _args(
+        self,
+        node: CallNode,
+        spec: FunctionSpec,
+        evaluate: Callable[[Node], SeriesOrScalar],
+        index: pd.Index
+    ) -> list:
+        """计算函数参数，序列参数中的常量展开为序列 / Evaluate call arguments, broadcasting constants in series positions"""
+        args = []
+        for i, arg in enumerate(node.args):
+            if i in spec.int_args:
+                args.append(_int_value(arg))
+            elif i in spec.float_args:
+                args.append(_constant(arg))
+            else:
+                value = evaluate(arg)
+                if not isinstance(value, pd.Series):
+                    value = pd.Series(float(value), index=index)
+                args.append(value)
+        return args
+    
+    def _call(self, node: CallNode, spec: FunctionSpec, args: list) -> SeriesOrScalar:
+        try:
+            return spec.impl(*args)
+        except ExpressionError:
+            raise
+        except Exception as e:
+            raise ExpressionError(
+                self.text, node.position, f"{node.name} failed: {e}"
+            ) from e
+    
+    def __repr__(self) -> str:
+        return f"Expression({self.text!r})"
+
+
+def _apply_binary(op: str, left: SeriesOrScalar, right: SeriesOrScalar) -> SeriesOrScalar:
+    """计算二元运算 / Apply a binary operator"""
+    if op == "+":
+        return left + right
+    if op == "-":
+        return left - right
+    if op == "*":
+        return left * right
+    if op == "/":
+        if not isinstance(left, pd.Series) and not isinstance(right, pd.Series):
+            return np.nan if right == 0 else left / right
+        return left / right
+    
+    # 比较运算返回0/1，任一输入为NaN时结果为NaN
+    compare = {
+        "<": np.less,
+        "<=": np.less_equal,
+        ">": np.greater,
+        ">=": np.greater_equal,
+        "==": np.equal,
+        "!=": np.not_equal,
+    }[op]
+    result = compare(left, right)
+    if not isinstance(result, pd.Series):
+        if pd.isna(left) or pd.isna(right):
+            return np.nan
+        return float(result)
+    
+    result = result.astype(float)
+    missing = pd.Series(False, index=result.index)
+    if isinstance(left, pd.Series):
+        missing |= left.isna()
+    if isinstance(right, pd.Series):
+        missing |= right.isna()
+    return result.mask(missing)
+
+
+def _lookback(node: Node) -> int:
+    """计算节点需要的历史行数 / Rows of history a node needs"""
+    if isinstance(node, UnaryNode):
+        return _lookback(node.operand)
+    if isinstance(node, BinaryNode):
+        return max(_lookback(node.left), _lookback(node.right))
+    if isinstance(node, CallNode):
+        spec = _get_function(node.name)
+        int_args = spec.int_args if spec is not None else ()
+        float_args = spec.float_args if spec is not None else ()
+        own = spec.history([_int_value(node.args[i]) for i in int_args]) if spec else 0
+        inner = [
+            _lookback(arg) for i, arg in enumerate(node.args)
+            if i not in int_args and i not in float_args
+        ]
+        return own + max([0] + inner)
+    return 0
+
+
+def _cross_section_call(node: Node) -> Optional[CallNode]:
+    """查找第一个截面函数调用 / Find the first cross-sectional call"""
+    if isinstance(node, UnaryNode):
+        return _cross_section_call(node.operand)
+    if isinstance(node, BinaryNode):
+        return _cross_section_call(node.left) or _cross_section_call(node.right)
+    if isinstance(node, CallNode):
+        spec = _get_function(node.name)
+        if spec is not None and spec.cross_sectional:
+            return node
+        for arg in node.args:
+            found = _cross_section_call(arg)
+            if found is not None:
+                return found
+    return None
+
+
+def _future_reference(node: Node) -> Optional[CallNode]:
+    """查找第一个负偏移的Ref调用 / Find the first Ref call with a negative offset"""
+    if isinstance(node, UnaryNode):
+        return _future_reference(node.operand)
+    if isinstance(node, BinaryNode):
+        return _future_reference(node.left) or _future_reference(node.right)
+    if isinstance(node, CallNode):
+        if node.name == "Ref" and len(node.args) == 2:
+            offset = _constant(node.args[1])
+            if offset is not None and offset < 0:
+                return node
+        for arg in node.args:
+            found = _future_reference(arg)
+            if found is not None:
+                return found
+    return None
+
+
+def _collect_fields(node: Node) -> Iterable[str]:
+    """收集表达式中引用的原始字段 / Collect raw fields referenced by the expression"""
+    if isinstance(node, FieldNode):
+        yield node.name
+    elif isinstance(node, UnaryNode):
+        yield from _collect_fields(node.operand)
+    elif isinstance(node, BinaryNode):
+        yield from _collect_fields(node.left)
+        yield from _collect_fields(node.right)
+    elif isinstance(node, CallNode):
+        for arg in node.args:
+            yield from _collect_fields(arg)
+
+
+def is_raw_field(field: str) -> bool:
+    """
+    判断是否为原始字段（如"$close"）而不是表达式 / Whether a field is raw (e.g. "$close")
+    
+    Args:
+        field: 字段或表达式 / Field or expression
+    
+    Returns:
+        bool: 是原始字段返回True / True for a raw field
+    """
+    return _FIELD_PATTERN.fullmatch(field.strip()) is not None
+
+
+def parse_expression(text: str, known_fields: Optional[Iterable[str]] = None) -> Expression:
+    """
+    解析表达式 / Parse an expression
+    
+    Args:
+        text: 表达式文本 / Expression text
+        known_fields: 可用字段集合，提供时在解析阶段检查未知字段 /
+            Available fields; when given, unknown fields are rejected at parse time
+    
+    Returns:
+        Expression: 已解析的表达式 / Parsed expression
+    
+    Raises:
+        ExpressionError: 语法错误、未知函数或未知字段时抛出，包含出错位置 /
+            Raised with the offending position on syntax errors, unknown functions or fields
+    """
+    known = set(known_fields) if known_fields is not None else None
+    root = _Parser(text, known).parse()
+    return Expression(text, root)
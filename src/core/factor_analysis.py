@@ -0,0 +1,413 @@
+"""
+因子评估模块 / Factor Evaluation Module
+用IC、Rank IC、分位数组合收益、多空收益和换手率评估因子对未来收益的预测能力
+Judges how well a factor predicts returns with IC, rank IC, quantile portfolio
+returns, the long-short spread and turnover
+
+quantile_buckets()按字段或表达式把每个日期的标的分到分位数桶中，top_minus_bottom()
+由分桶结果计算最高桶减最低桶的收益，用于构建多空因子组合。
+quantile_buckets() splits each date's instruments into quantile buckets by a
+field or expression, and top_minus_bottom() turns the buckets into the
+top-minus-bottom return used for long-short factor portfolios.
+
+因子和收益均为以时间为行、标的为列的宽表（见cross_section.to_wide）。t行的远期收益是
+从t到t+horizon根K线的收盘价收益率，t行的因子值应在t收盘时已知，两者因此不会相互泄露。
+每一行只使用因子和收益都有效的标的。
+Factors and returns are wide frames with timestamps as rows and instruments as
+columns (see cross_section.to_wide). Row t of the forward returns is the
+close-to-close return from t to t + horizon bars, and row t of the factor
+should be known at t's close, so neither leaks into the other. Each row only
+uses instruments where both the factor and the return are valid.
+
+Examples:
+    >>> prices = to_wide(manager.get_features(codes, ["$close"], "2023-01-01", "2023-12-31"), "$close")
+    >>> reports = {name: evaluate(factor, forward_returns(prices, 5)) for name, factor in factors.items()}
+    >>> print(compare(reports))
+"""
+
+from dataclasses import dataclass
+from typing import Any, Dict, List, Mapping
+
+import numpy as np
+import pandas as pd
+
+from . import stats
+from .cross_section import _as_frame
+from .expression_engine import parse_expression
+
+
+DEFAULT_QUANTILES = 5
+
+
+def forward_returns(prices: pd.DataFrame, horizon: int = 1) -> pd.DataFrame:
+    """
+    计算远期收益 / Compute forward returns
+    
+    t行为prices[t + horizon] / prices[t] - 1，最后horizon行为NaN
+    Row t is prices[t + horizon] / prices[t] - 1; the last horizon rows are NaN
+    
+    Args:
+        prices: 时间×标的价格宽表 / Time-by-instrument price frame
+        horizon: 持有的K线数，如1、5、20 / Holding period in bars, e.g. 1, 5 or 20
+    
+    Returns:
+        pd.DataFrame: 形状相同的远期收益 / Forward returns of the same shape
+    
+    Raises:
+        ValueError: horizon不是正整数时抛出 / Raised unless horizon is a positive integer
+    """
+    if isinstance(horizon, bool) or not isinstance(horizon, (int, np.integer)) or horizon < 1:
+        raise ValueError(f"horizon must be a positive integer, got {horizon!r}")
+    prices = _as_frame(prices)
+    return prices.shift(-int(horizon)) / prices.where(prices > 0) - 1.0
+
+
+@dataclass
+class FactorReport:
+    """
+    因子评估结果 / Factor evaluation report
+    
+    分位数收益和多空收益是每行的horizon期远期收益，horizon大于1时相邻行的持有期重叠。
+    Quantile and long-short returns are the per-row forward returns over the
+    horizon, so rows overlap when the horizon is longer than one bar.
+    
+    Attributes:
+        ic: 每行因子与收益的皮尔逊相关系数 / Per-row Pearson correlation of factor and return
+        rank_ic: 每行的Spearman秩相关系数 / Per-row Spearman rank correlation
+        quantile_returns: 每行各分位数组合的等权平均收益，列为1到quantiles，1为因子最小 /
+            Per-row equal-weighted return of each quantile, columns 1 to quantiles with 1 the lowest factor
+        long_short: 最高分位数减最低分位数的收益 / Top quantile minus bottom quantile return
+        turnover: 每行各分位数中上一行不在该分位数的标的比例 /
+            Per-row share of each quantile's members that weren't in it on the previous row
+    """
+    ic: pd.Series
+    rank_ic: pd.Series
+    quantile_returns: pd.DataFrame
+    long_short: pd.Series
+    turnover: pd.DataFrame
+    
+    @property
+    def quantiles(self) -> int:
+        """分位数个数 / Number of quantiles"""
+        return len(self.quantile_returns.columns)
+    
+    @property
+    def ic_mean(self) -> float:
+        """IC均值 / Mean IC"""
+        return stats.nan_mean(self.ic)
+    
+    @property
+    def ic_std(self) -> float:
+        """IC标准差 / IC standard deviation"""
+        return stats.nan_std(self.ic)
+    
+    @property
+    def icir(self) -> float:
+        """IC均值除以IC标准差，未年化 / Mean IC over its standard deviation, not annualized"""
+        return _ratio(self.ic_mean, self.ic_std)
+    
+    @property
+    def rank_ic_mean(self) -> float:
+        """Rank IC均值 / Mean rank IC"""
+        return stats.nan_mean(self.rank_ic)
+    
+    @property
+    def rank_icir(self) -> float:
+        """Rank IC均值除以其标准差 / Mean rank IC over its standard deviation"""
+        return _ratio(self.rank_ic_mean, stats.nan_std(self.rank_ic))
+    
+    @property
+    def mean_quantile_returns(self) -> pd.Series:
+        """各分位数的平均收益 / Mean return of each quantile"""
+        return pd.Series(
+            {q: stats.nan_mean(self.quantile_returns[q]) for q in self.quantile_returns.columns},
+            dtype=float
+        )
+    
+    @property
+    def mean_turnover(self) -> float:
+        """多空两端（最高和最低分位数）的平均换手率 / Mean turnover of the long-short legs (top and bottom quantiles)"""
+        if self.turnover.empty:
+            return float("nan")
+        legs = self.turnover[[self.turnover.columns[0], self.turnover.columns[-1]]]
+        return stats.nan_mean(legs.to_numpy().ravel())
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为只含标量的字典，便于汇总多个因子 / Convert to a dict of scalars for comparing factors"""
+        data = {
+            "periods": int(self.ic.notna().sum()),
+            "ic_mean": self.ic_mean,
+            "ic_std": self.ic_std,
+            "icir": self.icir,
+            "rank_ic_mean": self.rank_ic_mean,
+            "rank_icir": self.rank_icir,
+        }
+        for q, value in self.mean_quantile_returns.items():
+            data[f"q{q}_return"] = value
+        data["long_short"] = stats.nan_mean(self.long_short)
+        data["turnover"] = self.mean_turnover
+        return data
+    
+    def to_frame(self) -> pd.DataFrame:
+        """
+        把逐行序列合并为一张表 / Combine the per-row series into one table
+        
+        Returns:
+            pd.DataFrame: 列为ic、rank_ic、q1..qN、long_short和turnover_q1..turnover_qN /
+                Columns ic, rank_ic, q1..qN, long_short and turnover_q1..turnover_qN
+        """
+        frame = pd.DataFrame({"ic": self.ic, "rank_ic": self.rank_ic})
+        for q in self.quantile_returns.columns:
+            frame[f"q{q}"] = self.quantile_returns[q]
+        frame["long_short"] = self.long_short
+        for q in self.turnover.columns:
+            frame[f"turnover_q{q}"] = self.turnover[q]
+        return frame
+    
+    def to_csv(self, path: str) -> None:
+        """把to_frame()写入CSV文件 / Write to_frame() to a CSV file"""
+        self.to_frame().to_csv(path)
+    
+    def __str__(self) -> str:
+        lines = [
+            f"期数 / Periods:              {int(self.ic.notna().sum())}",
+            f"IC均值 / Mean IC:            {self.ic_mean:.4f}",
+            f"ICIR:                        {self.icir:.2f}",
+            f"Rank IC均值 / Mean rank IC:  {self.rank_ic_mean:.4f}",
+            f"Rank ICIR:                   {self.rank_icir:.2f}",
+        ]
+        for q, value in self.mean_quantile_returns.items():
+            lines.append(f"{f'Q{q}收益 / Q{q} return:':<27}{value:.4%}")
+        lines.append(f"多空收益 / Long-short:       {stats.nan_mean(self.long_short):.4%}")
+        lines.append(f"换手率 / Turnover:           {self.mean_turnover:.2%}")
+        return "\n".join(lines)
+
+
+def evaluate(
+    factor: pd.DataFrame,
+    returns: pd.DataFrame,
+    quantiles: int = DEFAULT_QUANTILES
+) -> FactorReport:
+    """
+    评估因子 / Evaluate a factor
+    
+    factor和returns按行和列的交集对齐。有效标的少于两个的行IC为NaN，少于quantiles个的行
+    不分组；分位数按quantile_labels()的规则划分，相同的因子值落在同一组。多空收益为
+    有收益的最高组减最低组，与top_minus_bottom(quantile_buckets(...))一致。
+    factor and returns are aligned on the intersection of rows and columns.
+    Rows with fewer than two valid instruments have NaN IC, and rows with fewer
+    than quantiles are not bucketed. Quantiles follow quantile_labels(), so
+    equal factor values share a bucket. The long-short return is the highest
+    bucket holding a return minus the lowest, as in
+    top_minus_bottom(quantile_buckets(...)).
+    
+    Args:
+        factor: 时间×标的因子宽表 / Time-by-instrument factor frame
+        returns: 时间×标的远期收益宽表，通常来自forward_returns() /
+            Time-by-instrument forward returns, usually from forward_returns()
+        quantiles: 分位数个数 / Number of quantiles
+    
+    Returns:
+        FactorReport: 评估结果 / Evaluation report
+    
+    Raises:
+        ValueError: quantiles小于2时抛出 / Raised when quantiles is less than 2
+    """
+    quantiles = _check_quantiles(quantiles)
+    factor, returns = _as_frame(factor).align(_as_frame(returns), join="inner")
+    valid = factor.notna() & returns.notna()
+    factor = factor.where(valid)
+    returns = returns.where(valid)
+    
+    ic = _row_correlation(factor, returns)
+    rank_ic = _row_correlation(factor.rank(axis=1), returns.rank(axis=1))
+    
+    buckets = quantile_labels(factor, quantiles)
+    buckets[valid.sum(axis=1) < quantiles] = np.nan
+    labels = list(range(1, quantiles + 1))
+    quantile_returns = pd.DataFrame(
+        {q: returns.where(buckets == q).mean(axis=1) for q in labels},
+        index=factor.index, columns=labels, dtype=float
+    )
+    turnover = pd.DataFrame(
+        {q: _turnover(buckets == q) for q in labels},
+        index=factor.index, columns=labels, dtype=float
+    )
+    # 相同值可能使两端的组为空，取实际有收益的最高和最低组
+    filled = quantile_returns.notna().sum(axis=1)
+    top = quantile_returns.ffill(axis=1).iloc[:, -1]
+    bottom = quantile_returns.bfill(axis=1).iloc[:, 0]
+    return FactorReport(
+        ic=ic,
+        rank_ic=rank_ic,
+        quantile_returns=quantile_returns,
+        long_short=(top - bottom).where(filled >= 2),
+        turnover=turnover
+    )
+
+
+def quantile_labels(factor: pd.DataFrame, buckets: int = DEFAULT_QUANTILES) -> pd.DataFrame:
+    """
+    按每行的因子排名标记分位数桶 / Label every row's instruments with a quantile bucket
+    
+    每行有效的n个标的按因子从小到大取平均排名r，桶号为floor((r - 0.5) / n * buckets) + 1。
+    相同的因子值排名相同，总是落在同一个桶中，因此各桶的标的数可以不同；n小于buckets时
+    只有部分桶有标的，最小和最大的标的仍分别落在靠近两端的桶中。
+    Each row's n valid instruments get their average rank r by ascending
+    factor, and the bucket is floor((r - 0.5) / n * buckets) + 1. Equal factor
+    values share a rank and always land in the same bucket, so bucket sizes
+    can differ; with n below buckets only some buckets are filled, the
+    smallest and largest instruments still landing near the two ends.
+    
+    Args:
+        factor: 时间×标的因子宽表 / Time-by-instrument factor frame
+        buckets: 分位数个数 / Number of buckets
+    
+    Returns:
+        pd.DataFrame: 形状相同的桶号，1为因子最小，缺失的因子为NaN /
+            Bucket numbers of the same shape, 1 for the lowest factor and NaN where the factor is missing
+    
+    Raises:
+        ValueError: buckets小于2时抛出 / Raised when buckets is less than 2
+    """
+    buckets = _check_quantiles(buckets)
+    factor = _as_frame(factor)
+    counts = factor.notna().sum(axis=1)
+    ranks = factor.rank(axis=1, method="average")
+    return np.floor((ranks - 0.5).mul(buckets).div(counts.where(counts > 0), axis=0)) + 1
+
+
+def quantile_buckets(
+    frames: Mapping[str, pd.DataFrame],
+    expression: str,
+    buckets: int = DEFAULT_QUANTILES
+) -> Dict[pd.Timestamp, List[List[str]]]:
+    """
+    按字段或表达式把每个日期的标的分到分位数桶中 / Split each date's instruments into quantile buckets
+    
+    表达式在全部标的组成的面板上计算，可以使用CSRank等截面函数。分桶规则见quantile_labels()。
+    The expression is evaluated over a panel of every instrument, so
+    cross-sectional functions such as CSRank work. See quantile_labels() for
+    how buckets are assigned.
+    
+    Args:
+        frames: 以标的代码为键的数据，如FeatureResult / Frames keyed by instrument code, e.g. a FeatureResult
+        expression: 排名使用的字段或表达式，如"$close / Ref($close, 20) - 1" /
+            Field or expression to rank by, e.g. "$close / Ref($close, 20) - 1"
+        buckets: 分位数个数 / Number of buckets
+    
+    Returns:
+        Dict[pd.Timestamp, List[List[str]]]: 每个日期的buckets个标的列表，第一个为因子最小的桶，
+            桶内按因子从小到大排列；没有有效因子值的日期不出现，标的少于buckets时部分列表为空 /
+            Per date, buckets lists of instruments with the lowest-factor bucket first
+            and each list in ascending factor order; dates without a valid factor
+            are left out, and some lists are empty when there are fewer instruments than buckets
+    
+    Raises:
+        ValueError: buckets小于2时抛出 / Raised when buckets is less than 2
+        ExpressionError: 表达式无法解析或计算时抛出 / Raised when the expression can't be parsed or evaluated
+    """
+    buckets = _check_quantiles(buckets)
+    parsed = parse_expression(expression)
+    frames = {code: frame for code, frame in frames.items() if len(frame)}
+    if not frames:
+        return {}
+    panel = pd.concat(frames, names=["instrument"])
+    factor = _as_frame(parsed.evaluate(panel).unstack(level="instrument"))
+    labels = quantile_labels(factor, buckets)
+    
+    result: Dict[pd.Timestamp, List[List[str]]] = {}
+    for time, row in labels.iterrows():
+        row = row.dropna()
+        if row.empty:
+            continue
+        values = factor.loc[time]
+        groups: List[List[str]] = [[] for _ in range(buckets)]
+        for code in sorted(row.index, key=lambda c: (values[c], str(c))):
+            groups[int(row[code]) - 1].append(code)
+        result[time] = groups
+    return result
+
+
+def top_minus_bottom(
+    buckets: Mapping[pd.Timestamp, List[List[str]]],
+    returns: pd.DataFrame
+) -> pd.Series:
+    """
+    最高桶减最低桶的等权收益 / Equal-weighted return of the top bucket minus the bottom bucket
+    
+    每个日期取有有效收益的最高和最低桶，标的少于buckets时即为实际有标的的两端；
+    只有一个这样的桶或日期不在returns中时为NaN。
+    Each date uses the highest and lowest buckets holding a valid return, which
+    with fewer instruments than buckets are the filled ends; the value is NaN
+    when only one such bucket exists or the date isn't in returns.
+    
+    Args:
+        buckets: quantile_buckets()的结果 / Result of quantile_buckets()
+        returns: 时间×标的远期收益宽表，通常来自forward_returns() /
+            Time-by-instrument forward returns, usually from forward_returns()
+    
+    Returns:
+        pd.Series: 以日期为索引的多空收益 / Long-short return indexed by date
+    """
+    returns = _as_frame(returns)
+    spread = {}
+    for time, groups in buckets.items():
+        spread[time] = np.nan
+        if time not in returns.index:
+            continue
+        row = returns.loc[time]
+        means = [row.reindex(group).mean() for group in groups if group]
+        means = [m for m in means if not np.isnan(m)]
+        if len(means) >= 2:
+            spread[time] = means[-1] - means[0]
+    return pd.Series(spread, dtype=float, name="top_minus_bottom")
+
+
+def compare(reports: Mapping[str, FactorReport]) -> pd.DataFrame:
+    """
+    汇总多个因子的评估结果 / Tabulate several factor reports
+    
+    Args:
+        reports: 以因子名为键的评估结果 / Reports keyed by factor name
+    
+    Returns:
+        pd.DataFrame: 每个因子一行、列为FactorReport.to_dict()的键 /
+            One row per factor with the keys of FactorReport.to_dict() as columns
+    """
+    frame = pd.DataFrame([report.to_dict() for report in reports.values()], index=list(reports))
+    frame.index.name = "factor"
+    return frame
+
+
+def _row_correlation(x: pd.DataFrame, y: pd.DataFrame) -> pd.Series:
+    """逐行皮尔逊相关系数，x和y的缺失位置相同 / Row-wise Pearson correlation; x and y share their missing cells"""
+    dx = x.sub(x.mean(axis=1), axis=0)
+    dy = y.sub(y.mean(axis=1), axis=0)
+    denominator = np.sqrt((dx * dx).sum(axis=1) * (dy * dy).sum(axis=1))
+    correlation = (dx * dy).sum(axis=1) / denominator.where(denominator > 0)
+    correlation[x.notna().sum(axis=1) < 2] = np.nan
+    return correlation.clip(-1.0, 1.0)
+
+
+def _turnover(members: pd.DataFrame) -> pd.Series:
+    """每行成员中上一行不是成员的比例 / Share of each row's members that weren't members on the previous row"""
+    previous = members.shift(1, fill_value=False)
+    size = members.sum(axis=1)
+    kept = (members & previous).sum(axis=1)
+    turnover = 1.0 - kept / size.where(size > 0)
+    # 首行和上一行未分组的行没有可比较的成员
+    turnover[previous.sum(axis=1) == 0] = np.nan
+    return turnover
+
+
+def _check_quantiles(quantiles: int) -> int:
+    if isinstance(quantiles, bool) or not isinstance(quantiles, (int, np.integer)) or quantiles < 2:
+        raise ValueError(f"quantiles must be an integer of at least 2, got {quantiles!r}")
+    return int(quantiles)
+
+
+def _ratio(numerator: float, denominator: float) -> float:
+    if np.isnan(denominator) or denominator == 0:
+        return float("nan")
+    return numerator / denominator
@@ -0,0 +1,1279 @@
+"""
+特征数据结果模块 / Feature Result Module
+提供多标的特征查询的结果容器、带类型访问方法的单标的数据和错误类型
+Provides the result container, the typed per-instrument frame and error types
+for multi-instrument feature queries
+"""
+
+from dataclasses import dataclass, field
+from datetime import date, datetime
+from typing import Any, Dict, List, Optional, Tuple, Type, Union
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.data_provider import FieldNotFoundError, FreqLike, to_freq
+from ..infrastructure.parquet_provider import DEFAULT_ROW_GROUP_ROWS, read_parquet, write_parquet
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+from ..utils.request_context import ContextCancelledError
+from .frame_snapshot import StreamLike, read_snapshot, write_snapshot
+from .frame_join import DEFAULT_SUFFIXES, MethodLike, align_frames, align_results, join_frames, join_results
+from .imputation import ExcessiveImputationError, FillReport, ImputeMethodLike, fill_frame, fill_results
+from .metrics import ReturnKind, price_returns
+from .price_adjustment import AdjustMode, adjust_prices, to_adjust_mode
+from .trading_calendar import FillPolicy, TradingCalendar, localize_time
+from .validation import (
+    DEFAULT_VOLUME_ZSCORE,
+    ValidationOptions,
+    ValidationReport,
+    repair_frame,
+    validate_frame
+)
+
+
+# 成交量为0或停牌标记非零的K线视为停牌，不能成交 / A bar with zero volume or a nonzero suspension flag is suspended and can't trade
+VOLUME_FIELD = "$volume"
+SUSPENDED_FIELD = "$suspended"
+
+
+class FeatureFetchError(DataError):
+    """
+    多标的特征获取错误 / Multi-instrument feature fetch error
+    
+    包装每个失败标的的错误，成功的标的不受影响；用of()按错误类型筛选标的
+    Wraps the per-instrument errors; successful instruments are unaffected.
+    of() picks the instruments that failed with one error type
+    
+    Examples:
+        >>> error = result.error
+        >>> unknown = error.of(InstrumentNotFoundError) if error else {}
+    """
+    
+    def __init__(self, errors: Dict[str, Exception]):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            errors: 标的代码到错误的映射 / Mapping of instrument code to error
+        """
+        self.errors: Dict[str, Exception] = dict(errors)
+        failed = ", ".join(self.errors.keys())
+        error_info = ErrorInfo(
+            error_code="DAT0009",
+            error_message_zh=f"部分标的获取失败: {failed}",
+            error_message_en=f"Failed to fetch some instruments: {failed}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details="; ".join(
+                f"{code}: {error}" for code, error in self.errors.items()
+            ),
+            suggested_actions=[
+                "检查失败的标的代码是否正确",
+                "验证时间范围是否在数据覆盖范围内"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+    
+    def of(self, error_type: Type[Exception]) -> Dict[str, Exception]:
+        """
+        获取某种类型的错误 / Get the errors of one type
+        
+        Args:
+            error_type: 错误类型，子类同样匹配，如InstrumentNotFoundError /
+                Error type, subclasses included, e.g. InstrumentNotFoundError
+        
+        Returns:
+            Dict[str, Exception]: 标的代码到该类型错误的映射 / Instrument code to the errors of that type
+        """
+        return {code: error for code, error in self.errors.items() if isinstance(error, error_type)}
+
+
+class PartialFetchError(ContextCancelledError):
+    """
+    部分获取错误 / Partial fetch error
+    
+    多标的获取中途上下文取消或超时时抛出。result为已经完成的标的（其中失败的标的在
+    result.errors中），pending为尚未完成的标的，cause为上下文的原始错误。
+    Raised when the context is cancelled or times out in the middle of a
+    multi-instrument fetch. result holds the instruments that completed (with
+    failed ones in result.errors), pending the ones that did not, and cause
+    the context's own error.
+    """
+    
+    def __init__(
+        self,
+        cause: ContextCancelledError,
+        result: "FeatureResult",
+        pending: List[str]
+    ):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            cause: 上下文的错误 / The context's error
+            result: 已完成标的的结果 / Result of the completed instruments
+            pending: 未完成的标的 / Instruments that did not complete
+        """
+        self.cause = cause
+        self.result = result
+        self.pending: List[str] = list(pending)
+        super().__init__(deadline_exceeded=cause.deadline_exceeded, reason=cause.reason)
+
+
+TimeLike = Union[str, date, datetime, pd.Timestamp]
+
+# 重采样K线时各字段的聚合方式，未列出的字段取区间内最后一个值
+OHLCV_AGGREGATIONS = {
+    "$open": "first",
+    "$high": "max",
+    "$low": "min",
+    "$close": "last",
+    "$volume": "sum",
+    "$amount": "sum",
+}
+
+# 周线、月线结果中标记区间是否完整的列
+COMPLETE_COLUMN = "complete"
+
+# 未提供交易日历时按周一至周五划分周线、月线的交易日
+_WEEKDAY_CALENDAR = TradingCalendar("WEEKDAYS")
+
+# attrs中标的所在交易所的时区，UTC索引的数据按其划分交易日
+# attrs key of the instrument's exchange timezone, whose dates split a UTC-indexed frame into days
+TIMEZONE_ATTR = "timezone"
+# attrs中切片时解释不带时区的时间所用的时区 / attrs key of the timezone naive slice bounds are read in
+DISPLAY_TZ_ATTR = "display_tz"
+
+
+def _to_timestamp(value: Optional[TimeLike]) -> Optional[pd.Timestamp]:
+    """把时间参数转换为Timestamp / Convert a time argument to a Timestamp"""
+    if value is None:
+        return None
+    return pd.Timestamp(value)
+
+
+def _target_interval(freq: str) -> pd.Timedelta:
+    """目标频率的K线长度，用于和数据的K线间隔比较 / Bar length of a target frequency, to compare with the data's interval"""
+    if freq == "day":
+        return pd.Timedelta(days=1)
+    if freq == "week":
+        return pd.Timedelta(days=7)
+    if freq == "month":
+        return pd.Timedelta(days=28)
+    try:
+        step = pd.Timedelta(freq)
+    except ValueError:
+        raise ValueError(f"unknown freq {freq!r}, expected day, week, month or a minute frequency such as 5min")
+    if step <= pd.Timedelta(0):
+        raise ValueError(f"freq must be positive, got {freq}")
+    return step
+
+
+def _bar_labels(
+    index: pd.DatetimeIndex,
+    step: pd.Timedelta,
+    sessions: List[Tuple[pd.Timedelta, pd.Timedelta]]
+) -> pd.DatetimeIndex:
+    """
+    计算每行所属的目标K线结束时刻 / End time of the target bar each row belongs to
+    
+    区间左开右闭并以结束时刻标记。落在交易时段内的行以时段开盘为起点分组，
+    最后一根不超过收盘时刻（如上交所60分钟K线为10:30、11:30、14:00、15:00）；
+    其余的行按整点对齐分组。
+    Bins are right-closed and labelled by their end. Rows inside a session are
+    binned from the session open and the last bin is capped at the close (so
+    SSE 60-minute bars end at 10:30, 11:30, 14:00 and 15:00); other rows use
+    clock-aligned bins.
+    """
+    labels = np.asarray(index.ceil(step).values)
+    days = index.normalize()
+    time_of_day = index - days
+    for open_time, close_time in sessions:
+        in_session = np.asarray((time_of_day >= open_time) & (time_of_day <= close_time))
+        if not in_session.any():
+            continue
+        elapsed = np.asarray((time_of_day[in_session] - open_time) / step, dtype=float)
+        # 开盘时刻的行归入第一根K线
+        count = np.maximum(1, np.ceil(elapsed)).astype(np.int64)
+        session_open = np.asarray((days[in_session] + open_time).values)
+        session_close = np.asarray((days[in_session] + close_time).values)
+        ends = session_open + (count * step.value).astype("timedelta64[ns]")
+        labels[in_session] = np.minimum(ends, session_close)
+    return pd.DatetimeIndex(labels, name=index.name)
+
+
+def _is_time_like(value: Any) -> bool:
+    """判断是否可以解析为时间 / Whether a value can be parsed as a time"""
+    if value is None or isinstance(value, (date, datetime, pd.Timestamp)):
+        return True
+    if not isinstance(value, str):
+        return False
+    try:
+        pd.Timestamp(value)
+        return True
+    except (ValueError, TypeError):
+        return False
+
+
+@dataclass
+class Bar:
+    """
+    单根K线 / Single bar
+    
+    Attributes:
+        time: 时间 / Bar time
+        fields: 字段名到数值的映射，如{"$close": 10.2} / Field name to value, e.g. {"$close": 10.2}
+    """
+    time: pd.Timestamp
+    fields: Dict[str, float] = field(default_factory=dict)
+    
+    def __getitem__(self, name: str) -> float:
+        return self.fields[name]
+    
+    def get(self, name: str, default: Optional[float] = None) -> Optional[float]:
+        """获取字段值 / Get a field value"""
+        return self.fields.get(name, default)
+    
+    @property
+    def tradable(self) -> bool:
+        """
+        当日是否可以成交 / Whether the bar can trade
+        
+        成交量为0或停牌标记（SUSPENDED_FIELD）非零时为False；缺少这两个字段或取值为NaN时视为可以成交
+        False for zero volume or a nonzero suspension flag (SUSPENDED_FIELD);
+        missing fields and NaN values count as tradable
+        """
+        return not (self.fields.get(VOLUME_FIELD) == 0 or _flagged(self.fields.get(SUSPENDED_FIELD)))
+
+
+def tradable_mask(frame: pd.DataFrame) -> Optional[np.ndarray]:
+    """
+    逐行的可成交标记，规则与Bar.tradable相同 / Per-row tradability, by the same rule as Bar.tradable
+    
+    Args:
+        frame: 单标的数据 / One instrument's data
+    
+    Returns:
+        Optional[np.ndarray]: 与行对应的布尔数组，缺少成交量和停牌标记字段时为None /
+            Boolean array over the rows; None when the frame has neither the volume nor the suspension field
+    """
+    if VOLUME_FIELD not in frame.columns and SUSPENDED_FIELD not in frame.columns:
+        return None
+    tradable = np.ones(len(frame), dtype=bool)
+    if VOLUME_FIELD in frame.columns:
+        tradable &= frame[VOLUME_FIELD].to_numpy(dtype=float) != 0
+    if SUSPENDED_FIELD in frame.columns:
+        flags = frame[SUSPENDED_FIELD].to_numpy(dtype=float)
+        tradable &= ~(np.isfinite(flags) & (flags != 0))
+    return tradable
+
+
+def _flagged(value: Optional[float]) -> bool:
+    """停牌标记是否为非零的有效值 / Whether a suspension flag is a valid nonzero value"""
+    return value is not None and np.isfinite(value) and value != 0
+
+
+class FeatureFrame(pd.DataFrame):
+    """
+    单标的特征数据 / Per-instrument feature frame
+    
+    以时间为索引的DataFrame，额外提供带类型的访问方法range()和column()，
+    缺失日期和缺失字段返回明确的结果或错误，而不是KeyError。原有的
+    frame["2025-01-01", "2025-06-30"]字符串索引方式保持可用。
+    A time-indexed DataFrame with the typed accessors range() and column(), so
+    missing dates and fields give well-defined results or errors rather than
+    a KeyError. The old frame["2025-01-01", "2025-06-30"] string indexing keeps
+    working.
+    
+    数据按列存储，每个字段一段连续数组，所有字段共享时间索引。需要整列计算（如技术指标）时
+    用column_array()直接取得列数组而不复制；column()和range()把每个值转换为Python对象，
+    适合少量数据。
+    Data is stored by column, one contiguous array per field with a shared
+    time index. Whole-column work such as indicators should take the column
+    array with column_array(), which doesn't copy; column() and range() turn
+    every value into a Python object and suit small reads.
+    """
+    
+    @property
+    def _constructor(self):
+        return FeatureFrame
+    
+    def __getitem__(self, key):
+        # 兼容frame["2025-01-01", "2025-06-30"]形式的日期区间索引
+        if (
+            isinstance(key, tuple)
+            and len(key) == 2
+            and not isinstance(self.columns, pd.MultiIndex)
+            and key not in self.columns
+            and all(_is_time_like(k) for k in key)
+        ):
+            return self.slice(*key)
+        return super().__getitem__(key)
+    
+    def range(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> List[Bar]:
+        """
+        获取时间区间内的K线 / Get the bars within a time range
+        
+        区间会被截取到已有数据的范围内，区间内没有数据时返回空列表
+        The range is clamped to the available data; an empty list is returned
+        when the window holds no bars
+        
+        Args:
+            start: 开始时间（包含），None表示不限 / Start (inclusive), None for unbounded
+            end: 结束时间（包含），None表示不限 / End (inclusive), None for unbounded
+        
+        Returns:
+            List[Bar]: 按时间升序排列的K线 / Bars in ascending time order
+        
+        Raises:
+            DataError: 开始时间晚于结束时间时抛出 / Raised when start is after end
+        """
+        start_ts, end_ts = _to_timestamp(start), _to_timestamp(end)
+        if start_ts is not None and end_ts is not None and start_ts > end_ts:
+            error_info = ErrorInfo(
+                error_code="DAT0016",
+                error_message_zh=f"时间区间无效，开始时间晚于结束时间: {start_ts} > {end_ts}",
+                error_message_en=f"Invalid time range, start is after end: {start_ts} > {end_ts}",
+                category=ErrorCategory.DATA,
+                severity=ErrorSeverity.LOW,
+                technical_details=f"start={start}, end={end}",
+                suggested_actions=["交换开始时间和结束时间"],
+                recoverable=True
+            )
+            raise DataError(error_info)
+        
+        window = self.slice(start_ts, end_ts)
+        columns = [str(c) for c in window.columns]
+        return [
+            Bar(time=ts, fields=dict(zip(columns, (float(v) for v in row))))
+            for ts, row in zip(window.index, window.itertuples(index=False, name=None))
+        ]
+    
+    def column(self, name: str) -> Tuple[List[float], List[pd.Timestamp]]:
+        """
+        获取单个字段的数值和对应时间 / Get the values of one field with their times
+        
+        Args:
+            name: 字段名，如"$close" / Field name, e.g. "$close"
+        
+        Returns:
+            Tuple[List[float], List[pd.Timestamp]]: (数值, 时间)，两者长度相同 /
+                (values, times) of equal length
+        
+        Raises:
+            FieldNotFoundError: 字段不存在时抛出 / Raised when the field is absent
+        """
+        values, index = self.column_array(name)
+        return values.tolist(), list(index)
+    
+    def column_array(self, name: str) -> Tuple[np.ndarray, pd.Index]:
+        """
+        获取单个字段的数值数组和时间索引 / Get the value array of one field with the time index
+        
+        float64的列返回与数据共享内存的只读视图，不复制；其他类型的列转换为新的float64数组
+        A float64 column comes back as a read-only view sharing memory with the
+        data, with no copy; other dtypes are converted into a new float64 array
+        
+        Args:
+            name: 字段名，如"$close" / Field name, e.g. "$close"
+        
+        Returns:
+            Tuple[np.ndarray, pd.Index]: (一维float64数组, 时间索引)，两者长度相同 /
+                (1-D float64 array, time index) of equal length
+        
+        Raises:
+            FieldNotFoundError: 字段不存在时抛出 / Raised when the field is absent
+        """
+        if name not in self.columns:
+            raise FieldNotFoundError([name], [str(c) for c in self.columns], self.attrs.get("instrument"))
+        
+        values = self[name].to_numpy(dtype=np.float64, copy=False)
+        # 视图只读，调用方写入时报错而不是悄悄修改数据
+        values = values.view()
+        values.flags.writeable = False
+        return values, self.index
+    
+    def returns(
+        self,
+        name: str = "$close",
+        kind: Union[str, ReturnKind] = ReturnKind.SIMPLE,
+        invalid: str = "nan"
+    ) -> Tuple[List[float], List[pd.Timestamp]]:
+        """
+        获取单个价格字段的逐期收益率和对应时间 / Get the per-period returns of one price field with their times
+        
+        结果比数据少一行，第一行没有收益率；非正价格的处理见metrics.price_returns()
+        The result is one row shorter, as the first row has no return; see
+        metrics.price_returns() for non-positive prices
+        
+        Args:
+            name: 价格字段名 / Price field name
+            kind: "simple"为p_t / p_{t-1} - 1，"log"为ln(p_t / p_{t-1}) /
+                "simple" for p_t / p_{t-1} - 1, "log" for ln(p_t / p_{t-1})
+            invalid: 遇到非正价格时"nan"返回NaN，"raise"抛出ValueError /
+                On a non-positive price "nan" yields NaN and "raise" raises ValueError
+        
+        Returns:
+            Tuple[List[float], List[pd.Timestamp]]: (收益率, 每期结束的时间)，两者长度相同 /
+                (returns, time each period ends) of equal length
+        
+        Raises:
+            FieldNotFoundError: 字段不存在时抛出 / Raised when the field is absent
+            ValueError: invalid="raise"时遇到非正价格 / Raised on a non-positive price with invalid="raise"
+        """
+        if name not in self.columns:
+            raise FieldNotFoundError([name], [str(c) for c in self.columns], self.attrs.get("instrument"))
+        
+        returns = price_returns(self[name], kind, invalid)
+        return [float(v) for v in returns], list(returns.index)
+    
+    def slice(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None,
+        display_tz: Optional[str] = None,
+        ambiguous: str = "raise"
+    ) -> "FeatureFrame":
+        """
+        按时间区间切片（包含边界） / Slice by time range (inclusive)
+        
+        时间索引有序时按位置切片，返回与原数据共享内存的视图，
+        在循环中反复切片不会复制底层数据。落在非交易日的边界截取到区间内
+        最近的行；开始时间晚于结束时间时返回空视图。
+        On a sorted time index this is a positional slice that returns a view
+        sharing memory with the original, so slicing repeatedly in a loop does
+        not copy the underlying data. Bounds on non-trading days clamp to the
+        nearest contained rows; an inverted range returns an empty view.
+        
+        索引带时区（如get_features(..., utc=True)的UTC索引）时，不带时区的边界如"2025-01-02"
+        按display_tz的当地时间解释，display_tz为None时使用attrs["display_tz"]，两者都没有时报错；
+        带偏移的边界不受影响。
+        On a tz-aware index (such as the UTC index of get_features(..., utc=True))
+        a naive bound such as "2025-01-02" is read as wall time in display_tz,
+        or attrs["display_tz"] when that is None, and raises with neither;
+        bounds with an offset are unaffected.
+        
+        Args:
+            start: 开始时间（包含），None表示不限 / Start (inclusive), None for unbounded
+            end: 结束时间（包含），None表示不限 / End (inclusive), None for unbounded
+            display_tz: 解释不带时区的边界所用的时区，如"America/New_York" /
+                Timezone naive bounds are read in, e.g. "America/New_York"
+            ambiguous: 边界在夏令时结束时重复的一小时内时的取法，"raise"、"earliest"或"latest" /
+                How a bound in the hour repeated when daylight saving ends resolves:
+                "raise", "earliest" or "latest"
+        
+        Returns:
+            FeatureFrame: 区间内的数据 / Rows within the range
+        
+        Raises:
+            ValueError: 索引带时区而边界不带时区且没有display_tz，或边界的本地时间不唯一或不存在时抛出 /
+                Raised for a naive bound on a tz-aware index without display_tz, or
+                a bound whose wall time is ambiguous or doesn't exist
+        """
+        start_ts = self._index_time(start, display_tz, ambiguous)
+        end_ts = self._index_time(end, display_tz, ambiguous)
+        lo, hi = self._window_bounds(start_ts, end_ts)
+        if lo is None:
+            # 索引无序时退回到布尔掩码（会复制数据）
+            return self.loc[self._window_mask(start_ts, end_ts)]
+        return self.iloc[lo:hi]
+    
+    def bar_at(self, t: TimeLike) -> Tuple[Optional[Bar], bool]:
+        """
+        获取单个时间点的K线 / Get the bar at a single time
+        
+        命名为bar_at以免覆盖DataFrame.at索引器
+        Named bar_at so that the DataFrame.at indexer stays intact
+        
+        Args:
+            t: 时间，如"2025-01-02" / Time, e.g. "2025-01-02"
+        
+        Returns:
+            Tuple[Optional[Bar], bool]: (K线, 是否存在)，不存在时为(None, False) /
+                (bar, found); (None, False) when there is no bar at t
+        """
+        ts = self._index_time(t)
+        lo, hi = self._window_bounds(ts, ts)
+        if lo is None:
+            positions = np.flatnonzero(self.index == ts)
+            lo, hi = (positions[0], positions[0] + 1) if len(positions) else (0, 0)
+        if hi <= lo:
+            return None, False
+        
+        row = self.iloc[lo]
+        fields = {str(c): float(v) for c, v in zip(self.columns, row.to_numpy())}
+        return Bar(time=self.index[lo], fields=fields), True
+    
+    def last(self, n):
+        """
+        获取最后n行 / Get the last n rows
+        
+        n为整数时按行数取；传入时间偏移（如"3D"）时保持DataFrame.last的行为
+        An integer n counts rows; a time offset (e.g. "3D") keeps the
+        DataFrame.last behaviour
+        
+        Args:
+            n: 行数，超过数据长度时返回全部 / Row count; all rows when n exceeds the length
+        
+        Returns:
+            FeatureFrame: 与原数据共享内存的视图 / View sharing memory with the original
+        """
+        if not isinstance(n, (int, np.integer)) or isinstance(n, bool):
+            return super().last(n)
+        if n < 0:
+            raise ValueError(f"n must be non-negative, got {n}")
+        if n == 0:
+            return self.iloc[0:0]
+        return self.iloc[-n:]
+    
+    def write_parquet(
+        self,
+        path: str,
+        instrument: Optional[str] = None,
+        compression: str = "snappy",
+        row_group_size: int = DEFAULT_ROW_GROUP_ROWS
+    ) -> None:
+        """
+        写入Parquet文件，可用read_parquet()或ParquetDataProvider读回 /
+        Write a Parquet file that read_parquet() or ParquetDataProvider can read back
+        
+        按列存储，读取单个字段时只解码该列；时间索引和列类型保持不变
+        Columnar, so reading one field decodes only that column; the time index
+        and column dtypes are preserved
+        
+        Args:
+            path: 文件路径 / File path
+            instrument: 写入文件元数据的标的代码，None表示使用attrs["instrument"] /
+                Instrument stored in the file metadata, None uses attrs["instrument"]
+            compression: 压缩算法，"snappy"、"zstd"、"gzip"或"none" /
+                Compression codec: "snappy", "zstd", "gzip" or "none"
+            row_group_size: 每个行组的行数，分钟数据可以取更大的值 /
+                Rows per row group; minute data can use larger groups
+        
+        Raises:
+            ValueError: 压缩算法不受支持时抛出 / Raised for an unsupported compression codec
+        """
+        if instrument is None:
+            instrument = self.attrs.get("instrument")
+        write_parquet(
+            path, self, row_group_size=row_group_size,
+            compression=compression, instrument=instrument
+        )
+    
+    @classmethod
+    def read_parquet(
+        cls,
+        path: str,
+        fields: Optional[List[str]] = None,
+        start_time: Optional[TimeLike] = None,
+        end_time: Optional[TimeLike] = None
+    ) -> "FeatureFrame":
+        """
+        读取Parquet文件 / Read a Parquet file
+        
+        Args:
+            path: 文件路径 / File path
+            fields: 字段列表，None表示读取所有列 / Fields, None reads every column
+            start_time: 开始时间 / Start time
+            end_time: 结束时间 / End time
+        
+        Returns:
+            FeatureFrame: 以datetime为索引的数据，attrs["instrument"]为标的代码 /
+                Frame indexed by datetime with the instrument in attrs["instrument"]
+        
+        Raises:
+            DataError: 文件不存在、格式错误或字段缺失时抛出 /
+                Raised when the file is missing, malformed, or lacks a field
+        
+        Examples:
+            >>> result["SH600000"].write_parquet("SH600000.parquet", compression="zstd")
+            >>> close = FeatureFrame.read_parquet("SH600000.parquet", ["$close"])
+        """
+        frame = read_parquet(path, fields, start_time=start_time, end_time=end_time)
+        result = cls(frame)
+        result.attrs = dict(frame.attrs)
+        return result
+    
+    def save(self, stream: StreamLike) -> None:
+        """
+        保存为二进制快照，可用load()读回 / Save as a binary snapshot that load() can read back
+        
+        时间、字段名和数值逐位保持不变（包括NaN），格式见frame_snapshot
+        Timestamps, field names and values round-trip bit for bit, NaNs
+        included; see frame_snapshot for the layout
+        
+        Args:
+            stream: 可写的二进制文件对象或文件路径 / Writable binary file object or file path
+        
+        Raises:
+            ValueError: 列名不是唯一的字符串或列不是数值类型时抛出 /
+                Raised when column names aren't unique strings or a column isn't numeric
+        """
+        write_snapshot(stream, self)
+    
+    @classmethod
+    def load(cls, stream: StreamLike) -> "FeatureFrame":
+        """
+        读取save()写入的二进制快照 / Read a binary snapshot written by save()
+        
+        Args:
+            stream: 可读的二进制文件对象或文件路径 / Readable binary file object or file path
+        
+        Returns:
+            FeatureFrame: 保存时的数据，attrs["instrument"]为保存时的标的代码（如有） /
+                The frame as saved, with attrs["instrument"] when it had one
+        
+        Raises:
+            DataError: 不是快照、版本不受支持或数据被截断时抛出 /
+                Raised for data that isn't a snapshot, an unsupported version, or a truncated snapshot
+        
+        Examples:
+            >>> result["SH600000"].save("SH600000.qtfs")
+            >>> frame = FeatureFrame.load("SH600000.qtfs")
+        """
+        frame = read_snapshot(stream)
+        result = cls(frame)
+        result.attrs = dict(frame.attrs)
+        return result
+    
+    def bar_interval(self) -> Optional[pd.Timedelta]:
+        """
+        推断K线间隔 / Infer the bar interval
+        
+        所有行都在零点时为一天，否则为相邻两根K线之间的最小间隔；无法判断时为None
+        One day when every row sits at midnight, otherwise the smallest gap
+        between consecutive bars; None when it can't be told
+        
+        Returns:
+            Optional[pd.Timedelta]: K线间隔，没有数据或只有一根日内K线时为None /
+                Bar interval, None without rows or with a single intraday bar
+        """
+        index = pd.DatetimeIndex(self.index)
+        if not len(index):
+            return None
+        if (index == index.normalize()).all():
+            return pd.Timedelta(days=1)
+        stamps = np.unique(index.asi8)
+        if len(stamps) < 2:
+            return None
+        return pd.Timedelta(int(np.diff(stamps).min()), "ns")
+    
+    def can_resample(self, freq: FreqLike) -> bool:
+        """
+        是否可以聚合到该频率 / Whether the bars can be aggregated to a frequency
+        
+        目标频率比数据更细（如日线转分钟线）时需要升采样，resample_bars()不支持
+        A target finer than the data (say daily to minute bars) would need
+        upsampling, which resample_bars() doesn't do
+        
+        Args:
+            freq: 目标频率，取值同resample_bars() / Target frequency, as for resample_bars()
+        
+        Returns:
+            bool: 目标K线不短于数据的K线间隔时返回True，间隔无法判断时也返回True /
+                True when target bars are no shorter than the data's interval, or the interval is unknown
+        
+        Raises:
+            ValueError: 频率无法解析时抛出 / Raised when the frequency cannot be parsed
+        """
+        source = self.bar_interval()
+        return source is None or _target_interval(to_freq(freq)) >= source
+    
+    def resample_bars(
+        self,
+        freq: FreqLike = "day",
+        calendar: Optional[TradingCalendar] = None
+    ) -> "FeatureFrame":
+        """
+        把K线聚合为更低频率的K线 / Aggregate bars up to a lower frequency
+        
+        $open取第一个值，$high取最大值，$low取最小值，$close取最后一个值，
+        $volume和$amount求和，其余字段取最后一个值；缺失值被跳过。
+        命名为resample_bars以免覆盖DataFrame.resample。
+        $open takes the first value, $high the max, $low the min, $close the
+        last, $volume and $amount the sum, and any other field the last value;
+        missing values are skipped. Named resample_bars so that
+        DataFrame.resample stays intact.
+        
+        周线按周一开始的自然周划分（不使用ISO周编号，跨年的一周不会被拆开），
+        月线按自然月划分，每根K线以区间内最后一行的日期为索引。
+        结果在最后增加complete列：数据从区间中途开始（首个区间）或在区间最后一个
+        交易日之前结束（末尾区间）时为False，交易日按calendar判断，因此长假前提前
+        结束的一周仍是完整的。
+        Weekly bars follow Monday-based calendar weeks (no ISO week numbers, so
+        a week spanning New Year stays whole) and monthly bars follow calendar
+        months; each bar is indexed by the date of its last row. A trailing
+        complete column is False when the data starts mid-period (first
+        period) or stops before the period's last trading day (last period).
+        Trading days come from calendar, so a week cut short by a holiday is
+        still complete.
+        
+        带时区的索引（如UTC）按交易所本地时间划分：日线、周线、月线按当地日期而不是UTC零点分组，
+        日内K线按当地的交易时段对齐后换算回原时区，时区依次取calendar、attrs["timezone"]和
+        attrs["display_tz"]。结果保留原数据的attrs。
+        A tz-aware index (UTC, say) is split by exchange-local time: daily,
+        weekly and monthly bars group by local date rather than UTC midnight,
+        and intraday bins follow the local sessions before mapping back to the
+        original timezone. The timezone is calendar's, else attrs["timezone"],
+        else attrs["display_tz"]. The result keeps the frame's attrs.
+        
+        Args:
+            freq: 目标频率，"day"、"week"、"month"、分钟频率如"5min"、"60min"或Freq /
+                Target frequency: "day", "week", "month", a minute frequency
+                such as "5min" or "60min", or a Freq
+            calendar: 交易日历，提供时日内K线按其交易时段开盘时刻对齐，周线、月线按其
+                交易日判断区间是否完整；None时周线、月线以周一至周五为交易日 /
+                Trading calendar; intraday bins start at its session opens and
+                weekly or monthly bars use its trading days to tell complete
+                periods. Weekly and monthly bars assume Monday to Friday without one
+        
+        Returns:
+            FeatureFrame: 以目标K线结束时刻为索引的数据，日频以（当地）日期为索引 /
+                Frame indexed by each target bar's end time, or by (local) date for "day"
+        
+        Raises:
+            ValueError: 频率无法解析，或目标频率比数据更细（升采样）时抛出 /
+                Raised when the frequency cannot be parsed or is finer than the data (upsampling)
+        """
+        freq = to_freq(freq)
+        if not self.can_resample(freq):
+            raise ValueError(
+                f"cannot resample bars {self.bar_interval()} apart to {freq}: "
+                f"the target is finer than the data and upsampling is not supported"
+            )
+        if freq in ("week", "month"):
+            return self._resample_periods(freq, calendar or _WEEKDAY_CALENDAR)
+        
+        index, local = self._local_index(calendar)
+        if freq == "day":
+            labels = local.normalize()
+        else:
+            step = pd.Timedelta(freq)
+            if step <= pd.Timedelta(0):
+                raise ValueError(f"freq must be positive, got {freq}")
+            sessions = calendar.sessions if calendar is not None else []
+            labels = _bar_labels(local, step, sessions)
+            if index.tz is not None:
+                # 按每行自己的UTC偏移换算回去，夏令时切换前后的K线不会重复或缺失
+                labels = pd.DatetimeIndex(index + (labels - local), name=index.name)
+        
+        grouped = pd.DataFrame(self).groupby(labels, sort=True)
+        columns = {}
+        for name in self.columns:
+            how = OHLCV_AGGREGATIONS.get(str(name), "last")
+            # 全部缺失的区间求和结果为NaN而不是0
+            columns[name] = grouped[name].sum(min_count=1) if how == "sum" else grouped[name].agg(how)
+        
+        result = pd.DataFrame(columns, columns=list(self.columns))
+        result.index.name = self.index.name
+        frame = FeatureFrame(result)
+        frame.attrs = dict(self.attrs)
+        return frame
+    
+    def _resample_periods(self, freq: str, calendar: TradingCalendar) -> "FeatureFrame":
+        """聚合为周线或月线 / Aggregate into weekly or monthly bars"""
+        _, index = self._local_index(calendar)
+        days = index.normalize()
+        if freq == "week":
+            starts = days - pd.to_timedelta(days.dayofweek, unit="D")
+            ends = starts + pd.Timedelta(days=6)
+        else:
+            starts = days.to_period("M").to_timestamp()
+            ends = starts + pd.offsets.MonthEnd(0)
+        
+        grouped = pd.DataFrame(self).groupby(np.asarray(starts), sort=True)
+        columns = {}
+        for name in self.columns:
+            how = OHLCV_AGGREGATIONS.get(str(name), "last")
+            columns[name] = grouped[name].sum(min_count=1) if how == "sum" else grouped[name].agg(how)
+        result = pd.DataFrame(columns, columns=list(self.columns))
+        
+        period_days = pd.Series(days, index=starts).groupby(level=0, sort=True)
+        first_days, last_days = period_days.min(), period_days.max()
+        period_ends = pd.Series(ends, index=starts).groupby(level=0, sort=True).first()
+        complete = np.ones(len(result), dtype=bool)
+        if len(result):
+            # 只有首尾两个区间可能被数据区间截断
+            sessions = calendar.between(result.index[0], period_ends.iloc[0])
+            if sessions and first_days.iloc[0] > sessions[0]:
+                complete[0] = False
+            sessions = calendar.between(result.index[-1], period_ends.iloc[-1])
+            if sessions and last_days.iloc[-1] < sessions[-1]:
+                complete[-1] = False
+        result[COMPLETE_COLUMN] = complete
+        result.index = pd.DatetimeIndex(last_days.to_numpy(), name=self.index.name)
+        frame = FeatureFrame(result)
+        frame.attrs = dict(self.attrs)
+        return frame
+    
+    def validate(
+        self,
+        calendar: Optional[TradingCalendar] = None,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None,
+        volume_zscore: Optional[float] = DEFAULT_VOLUME_ZSCORE,
+        max_gap: Optional[Union[str, pd.Timedelta]] = None
+    ) -> ValidationReport:
+        """
+        校验数据 / Validate the data
+        
+        检查乱序的行、重复时间戳、缺失的交易日和非交易日的K线（需要calendar）、超过max_gap的
+        时间缺口、非正价格、最高价低于最低价和成交量异常，见core.validation。只在调用时检查，
+        读取数据时不会自动进行
+        Checks for out-of-order rows, duplicate timestamps, missing trading
+        days and bars on non-trading days (with a calendar), gaps longer than
+        max_gap, non-positive prices, highs below lows and volume spikes; see
+        core.validation. It only runs when called, never as part of a read
+        
+        Args:
+            calendar: 交易日历，None表示不检查缺失交易日和非交易日的K线 /
+                Trading calendar, None skips the missing-day and non-trading-day checks
+            start: 检查缺失交易日的开始时间，None表示第一行 / Start of the missing-day check, None for the first row
+            end: 检查缺失交易日的结束时间，None表示最后一行 / End of the missing-day check, None for the last row
+            volume_zscore: 成交量标准分阈值，None表示不检查 / Volume z-score threshold, None disables the check
+            max_gap: 相邻两行的最大时间间隔，如"10D"，None表示不检查时间缺口 /
+                Longest time between consecutive rows, e.g. "10D"; None skips the gap check
+        
+        Returns:
+            ValidationReport: 校验报告，每个问题带有类型、时间戳和描述 /
+                Validation report; each issue carries its kind, timestamps and message
+        """
+        return validate_frame(self, calendar, start, end, volume_zscore, self.attrs.get("instrument"), max_gap)
+    
+    def repair(
+        self,
+        calendar: Optional[TradingCalendar] = None,
+        max_fill_days: int = 1,
+        drop_duplicates: bool = True,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None,
+        volume_zscore: Optional[float] = DEFAULT_VOLUME_ZSCORE,
+        max_gap: Optional[Union[str, pd.Timedelta]] = None
+    ) -> Tuple["FeatureFrame", ValidationReport]:
+        """
+        修复小的缺口和重复行 / Repair small gaps and duplicates
+        
+        Args:
+            calendar: 交易日历，填充缺口时需要 / Trading calendar, needed to fill gaps
+            max_fill_days: 最多向前填充的连续缺失交易日数 / Longest run of missing trading days to forward-fill
+            drop_duplicates: 是否删除重复时间戳，保留最后一行 / Whether to drop duplicate timestamps, keeping the last row
+            start: 检查缺失交易日的开始时间 / Start of the missing-day check
+            end: 检查缺失交易日的结束时间 / End of the missing-day check
+            volume_zscore: 成交量标准分阈值 / Volume z-score threshold
+            max_gap: 相邻两行的最大时间间隔 / Longest time between consecutive rows
+        
+        Returns:
+            Tuple[FeatureFrame, ValidationReport]: (修复后的数据, 修复后的校验报告，包含所有修改) /
+                (repaired frame, report of the repaired frame including every change)
+        """
+        options = ValidationOptions(
+            volume_zscore=volume_zscore, max_fill_days=max_fill_days, drop_duplicates=drop_duplicates,
+            max_gap=max_gap
+        )
+        frame, report = repair_frame(self, options, calendar, start, end, self.attrs.get("instrument"))
+        result = FeatureFrame(frame)
+        result.attrs = dict(self.attrs)
+        return result, report
+    
+    def fill_missing(
+        self,
+        method: ImputeMethodLike,
+        value: Optional[float] = None,
+        max_gap: Optional[int] = None,
+        columns: Optional[List[str]] = None,
+        inplace: bool = False,
+        max_fraction: Optional[float] = None
+    ) -> Tuple["FeatureFrame", FillReport]:
+        """
+        填充缺失值 / Fill missing values
+        
+        命名为fill_missing以免覆盖DataFrame.fillna；各方法见core.imputation，截面中位数需要
+        全部标的，用FeatureResult.fill_missing()
+        Named fill_missing so that DataFrame.fillna stays intact; see
+        core.imputation for the methods, and FeatureResult.fill_missing() for
+        the cross-sectional median, which needs the whole universe
+        
+        Args:
+            method: "ffill"、"bfill"、"constant"或"interpolate" / "ffill", "bfill", "constant" or "interpolate"
+            value: constant使用的值 / Value used by constant
+            max_gap: 可以填充的最长连续缺失值个数，更长的缺口保留为NaN；None表示不限 /
+                Longest run of missing values filled, longer gaps stay NaN; None for any
+            columns: 要填充的列，默认为所有数值列 / Columns to fill, every numeric column by default
+            inplace: 是否直接修改本数据 / Whether to modify this frame itself
+            max_fraction: 任一列填充比例超过该值时抛出错误，None表示不检查 /
+                Raise when any column's filled share is over this, None disables the check
+        
+        Returns:
+            Tuple[FeatureFrame, FillReport]: (填充后的数据，inplace时为本数据, 每列填充数量的报告) /
+                (filled frame, this frame when inplace, report of the values filled per column)
+        
+        Raises:
+            ValueError: 方法或参数无效，或对日线数据插值时抛出 /
+                Raised for an invalid method or argument, or when interpolating daily data
+            ExcessiveImputationError: 填充比例超过max_fraction时抛出，inplace时本数据已被修改 /
+                Raised when the filled share is over max_fraction; with inplace this frame is already modified
+        """
+        frame, report = fill_frame(self, method, value, max_gap, columns, inplace)
+        if not inplace:
+            frame = FeatureFrame(frame)
+            frame.attrs = dict(self.attrs)
+        if max_fraction is not None and report.exceeds(max_fraction):
+            raise ExcessiveImputationError(self.attrs.get("instrument"), report, max_fraction)
+        return frame, report
+    
+    def adjust(self, mode: Union[str, AdjustMode], adjusted_source: bool = False) -> "FeatureFrame":
+        """
+        按$factor列换算复权价格 / Convert prices to an adjustment mode using the $factor column
+        
+        价格字段乘以累计因子，成交量按相反比例换算；前复权以本数据的最后一行为基准，
+        见core.price_adjustment
+        Price fields are scaled by the cumulative factor and volumes inversely;
+        forward adjustment is based on the last row of this frame; see
+        core.price_adjustment
+        
+        Args:
+            mode: "none"、"pre"、"post"或AdjustMode / "none", "pre", "post" or an AdjustMode
+            adjusted_source: 本数据的价格是否已经是后复权价 / Whether this frame's prices are already backward-adjusted
+        
+        Returns:
+            FeatureFrame: 换算后的数据，没有$factor列时原样返回 / Converted frame; unchanged without a $factor column
+        
+        Raises:
+            ValueError: 未知的复权方式 / Unknown mode
+        """
+        result = FeatureFrame(adjust_prices(self, to_adjust_mode(mode), adjusted_source))
+        result.attrs = dict(self.attrs)
+        return result
+    
+    def align_with(
+        self,
+        other: pd.DataFrame,
+        method: MethodLike = FillPolicy.NAN,
+        how: str = "outer"
+    ) -> Tuple["FeatureFrame", "FeatureFrame"]:
+        """
+        与另一个数据对齐到同一时间索引 / Align with another frame onto the same time index
+        
+        命名为align_with以免覆盖DataFrame.align。other为日线、本数据为日内数据时，日线值按交易日
+        广播到当日的每根K线上，见core.frame_join。
+        Named align_with so that DataFrame.align stays intact. When other is
+        daily and this frame intraday, each daily value is broadcast onto the
+        bars of its day; see core.frame_join.
+        
+        Args:
+            other: 以时间为索引的数据 / Time-indexed frame
+            method: 不匹配行的填充方式，FillPolicy或"ffill"、"bfill"、"nan" /
+                Fill method of non-matching rows, a FillPolicy or "ffill", "bfill", "nan"
+            how: "inner"、"outer"或"left" / "inner", "outer" or "left"
+        
+        Returns:
+            Tuple[FeatureFrame, FeatureFrame]: 索引相同的(本数据, other) / (this frame, other) sharing one index
+        
+        Raises:
+            ValueError: 参数无效或索引中有重复时间戳时抛出 / Raised for invalid arguments or duplicate timestamps
+        """
+        left, right = align_frames(self, other, method, how)
+        left, right = FeatureFrame(left), FeatureFrame(right)
+        left.attrs, right.attrs = dict(self.attrs), dict(other.attrs)
+        return left, right
+    
+    def join_with(
+        self,
+        other: pd.DataFrame,
+        how: str = "left",
+        method: MethodLike = FillPolicy.NAN,
+        suffixes: Optional[Tuple[str, str]] = DEFAULT_SUFFIXES
+    ) -> "FeatureFrame":
+        """
+        按时间索引合并另一个数据的列 / Join another frame's columns on the time index
+        
+        命名为join_with以免覆盖DataFrame.join，行的对齐方式与align_with()相同
+        Named join_with so that DataFrame.join stays intact; rows are aligned as in align_with()
+        
+        Args:
+            other: 以时间为索引的数据 / Time-indexed frame
+            how: "inner"、"outer"或"left" / "inner", "outer" or "left"
+            method: 不匹配行的填充方式 / Fill method of non-matching rows
+            suffixes: 同名列在本数据和other中分别追加的后缀，None表示有同名列时抛出错误 /
+                Suffixes appended to colliding columns of this frame and other, None to raise on any collision
+        
+        Returns:
+            FeatureFrame: 合并后的数据 / Joined frame
+        
+        Raises:
+            ValueError: 参数无效、索引中有重复时间戳或列名冲突时抛出 /
+                Raised for invalid arguments, duplicate timestamps or colliding columns
+        """
+        result = FeatureFrame(join_frames(self, other, how, method, suffixes))
+        result.attrs = dict(self.attrs)
+        return result
+    
+    def _index_time(
+        self,
+        value: Optional[TimeLike],
+        display_tz: Optional[str] = None,
+        ambiguous: str = "raise"
+    ) -> Optional[pd.Timestamp]:
+        """把时间参数转换为可与索引比较的时间 / Turn a time argument into one comparable with the index"""
+        ts = _to_timestamp(value)
+        tz = getattr(self.index, "tz", None)
+        if ts is None or tz is None:
+            return ts
+        timezone = display_tz or self.attrs.get(DISPLAY_TZ_ATTR)
+        if ts.tzinfo is None and timezone is None:
+            raise ValueError(
+                f"{value!r} has no timezone but the index is in {tz}; "
+                f"pass display_tz or give the time an offset"
+            )
+        return localize_time(ts, timezone or str(tz), ambiguous)
+    
+    def _local_index(self, calendar: Optional[TradingCalendar]) -> Tuple[pd.DatetimeIndex, pd.DatetimeIndex]:
+        """
+        (索引, 交易所本地时间)，带时区的索引按日历、attrs["timezone"]、attrs["display_tz"]的时区转换 /
+        (index, exchange-local wall time); a tz-aware index converts to the
+        calendar's timezone, else attrs["timezone"], else attrs["display_tz"]
+        """
+        index = pd.DatetimeIndex(self.index)
+        if index.tz is None:
+            return index, index
+        timezone = (
+            (calendar.timezone if calendar is not None else None)
+            or self.attrs.get(TIMEZONE_ATTR)
+            or self.attrs.get(DISPLAY_TZ_ATTR)
+        )
+        local = index.tz_convert(timezone) if timezone else index
+        return index, local.tz_localize(None)
+    
+    def _window_bounds(
+        self,
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> Tuple[Optional[int], Optional[int]]:
+        """
+        时间区间对应的行位置[lo, hi) / Row positions [lo, hi) of a time window
+        
+        Returns:
+            Tuple[Optional[int], Optional[int]]: 索引无序时为(None, None) /
+                (None, None) when the index is not sorted
+        """
+        if not self.index.is_monotonic_increasing:
+            return None, None
+        lo = 0 if start is None else int(self.index.searchsorted(start, side="left"))
+        hi = len(self.index) if end is None else int(self.index.searchsorted(end, side="right"))
+        return lo, max(lo, hi)
+    
+    def _window_mask(
+        self,
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> np.ndarray:
+        """时间区间（包含边界）的行掩码 / Row mask of an inclusive time window"""
+        mask = np.ones(len(self.index), dtype=bool)
+        if start is not None:
+            mask &= self.index >= start
+        if end is not None:
+            mask &= self.index <= end
+        return mask
+
+
+class FeatureResult(dict):
+    """
+    多标的特征查询结果 / Multi-instrument feature query result
+    
+    以标的代码为键、每个标的的时间索引FeatureFrame为值的字典。
+    键的顺序与请求中标的的顺序一致（失败的标的不在字典中），
+    与并发获取的完成顺序无关。
+    A dict keyed by instrument code whose values are time-indexed FeatureFrames.
+    Keys follow the order the instruments were requested in (failed ones are
+    absent), independent of the order concurrent fetches complete in.
+    
+    get_features(..., lazy=True)的结果中值为LazyFeatureFrame（见core.lazy_frame）
+    With get_features(..., lazy=True) the values are LazyFeatureFrames (see
+    core.lazy_frame)
+    """
+    
+    def __init__(
+        self,
+        frames: Optional[Dict[str, pd.DataFrame]] = None,
+        errors: Optional[Dict[str, Exception]] = None,
+        reports: Optional[Dict[str, ValidationReport]] = None
+    ):
+        """
+        初始化结果 / Initialize result
+        
+        Args:
+            frames: 成功获取的数据 / Successfully fetched frames
+            errors: 失败标的的错误 / Errors of failed instruments
+            reports: 请求校验时各标的的校验报告，包括未通过校验的标的 /
+                Per-instrument validation reports when validation was requested,
+                including the instruments that failed it
+        """
+        super().__init__({
+            # 延迟加载的数据不是DataFrame，原样保存
+            code: frame if isinstance(frame, FeatureFrame) or not isinstance(frame, pd.DataFrame) else FeatureFrame(frame)
+            for code, frame in (frames or {}).items()
+        })
+        self.errors: Dict[str, Exception] = dict(errors or {})
+        self.reports: Dict[str, ValidationReport] = dict(reports or {})
+    
+    @property
+    def error(self) -> Optional[FeatureFetchError]:
+        """
+        获取包装了所有失败标的的错误 / Get the error wrapping all failed instruments
+        
+        Returns:
+            Optional[FeatureFetchError]: 没有失败时返回None / None when nothing failed
+        """
+        if not self.errors:
+            return None
+        return FeatureFetchError(self.errors)
+    
+    @property
+    def instruments(self) -> List[str]:
+        """成功获取的标的列表 / Instruments fetched successfully"""
+        return list(self.keys())
+    
+    def instrument(self, code: str) -> Tuple[Optional[FeatureFrame], bool]:
+        """
+        查询单个标的的数据 / Look up the frame of a single instrument
+        
+        Args:
+            code: 标的代码 / Instrument code
+        
+        Returns:
+            Tuple[Optional[FeatureFrame], bool]: (数据, 是否存在)，不存在时为(None, False) /
+                (frame, found); (None, False) when the code is absent
+        """
+        frame = self.get(code)
+        return frame, frame is not None
+    
+    def raise_for_errors(self) -> None:
+        """
+        存在失败标的时抛出错误 / Raise if any instrument failed
+        
+        Raises:
+            FeatureFetchError: 存在失败标的时抛出 / Raised when any instrument failed
+        """
+        error = self.error
+        if error is not None:
+            raise error
+    
+    def align_with(
+        self,
+        other: Dict[str, pd.DataFrame],
+        method: MethodLike = FillPolicy.NAN,
+        how: str = "outer"
+    ) -> Tuple["FeatureResult", "FeatureResult"]:
+        """
+        按标的对齐另一组结果 / Align with another result instrument by instrument
+        
+        how同时决定保留的标的和时间索引；只在一侧存在的标的在另一侧为全部是NaN的数据。
+        两侧的错误各自保留。
+        how picks both the instruments and the time index kept; an instrument
+        on one side only gets an all-NaN frame on the other. Each side keeps
+        its own errors.
+        
+        Args:
+            other: 标的代码到数据的映射，如另一个FeatureResult / Instrument code to frame, e.g. another FeatureResult
+            method: 不匹配行的填充方式 / Fill method of non-matching rows
+            how: "inner"、"outer"或"left" / "inner", "outer" or "left"
+        
+        Returns:
+            Tuple[FeatureResult, FeatureResult]: 标的和索引都相同的(本结果, other) /
+                (this result, other) with the same instruments and indexes
+        """
+        left, right = align_results(self, other, method, how)
+        return (
+            FeatureResult(left, self.errors),
+            FeatureResult(right, getattr(other, "errors", None))
+        )
+    
+    def join_with(
+        self,
+        other: Dict[str, pd.DataFrame],
+        how: str = "left",
+        method: MethodLike = FillPolicy.NAN,
+        suffixes: Optional[Tuple[str, str]] = DEFAULT_SUFFIXES
+    ) -> "FeatureResult":
+        """
+        按标的合并另一组结果的列 / Join another result's columns instrument by instrument
+        
+        标的和行的对齐方式与align_with()相同；other的错误只在本结果没有该标的的错误时保留，
+        已经出现在结果中的标的不再列为错误
+        Instruments and rows are aligned as in align_with(); other's errors are
+        kept unless this result has an error for the same instrument, and
+        instruments present in the joined result are no longer listed as errors
+        
+        Args:
+            other: 标的代码到数据的映射，如另一个FeatureResult / Instrument code to frame, e.g. another FeatureResult
+            how: "inner"、"outer"或"left" / "inner", "outer" or "left"
+            method: 不匹配行的填充方式 / Fill method of non-matching rows
+            suffixes: 同名列在两侧分别追加的后缀，None表示有同名列时抛出错误 /
+                Suffixes appended to colliding columns of each side, None to raise on any collision
+        
+        Returns:
+            FeatureResult: 合并后的结果 / Joined result
+        
+        Raises:
+            ValueError: 参数无效或列名冲突时抛出 / Raised for invalid arguments or colliding columns
+        """
+        frames = join_results(self, other, how, method, suffixes)
+        errors = {**getattr(other, "errors", {}), **self.errors}
+        return FeatureResult(frames, {code: e for code, e in errors.items() if code not in frames})
+    
+    def fill_missing(
+        self,
+        method: ImputeMethodLike,
+        value: Optional[float] = None,
+        max_gap: Optional[int] = None,
+        columns: Optional[List[str]] = None,
+        inplace: bool = False,
+        max_fraction: Optional[float] = None
+    ) -> Tuple["FeatureResult", Dict[str, FillReport]]:
+        """
+        填充每个标的的缺失值 / Fill missing values instrument by instrument
+        
+        除FeatureFrame.fill_missing()的方法外支持"cs_median"：用同一时间戳所有标的的中位数填充，
+        只用该时间戳的值，不会用到之后的数据
+        Supports "cs_median" on top of the methods of FeatureFrame.fill_missing():
+        fill with the median over every instrument at the same timestamp, using
+        only that timestamp's values and never a later one
+        
+        Args:
+            method: 填充方法 / Fill method
+            value: constant使用的值 / Value used by constant
+            max_gap: 可以填充的最长连续缺失值个数 / Longest run of missing values filled
+            columns: 要填充的列，默认为每个标的的所有数值列 / Columns to fill, every numeric column by default
+            inplace: 是否直接修改每个标的的数据 / Whether to modify each instrument's frame itself
+            max_fraction: 填充比例超过该值的标的从结果中移除，记录为ExcessiveImputationError /
+                Instruments whose filled share is over this are dropped and recorded as an ExcessiveImputationError
+        
+        Returns:
+            Tuple[FeatureResult, Dict[str, FillReport]]: (填充后的结果, 每个标的的填充报告，包括被移除的标的) /
+                (filled result, fill report of each instrument, dropped ones included)
+        
+        Raises:
+            ValueError: 方法或参数无效时抛出 / Raised for an invalid method or argument
+        """
+        frames, reports = fill_results(self, method, value, max_gap, columns, inplace)
+        errors = dict(self.errors)
+        result: Dict[str, pd.DataFrame] = {}
+        for code, frame in frames.items():
+            if max_fraction is not None and reports[code].exceeds(max_fraction):
+                errors[code] = ExcessiveImputationError(code, reports[code], max_fraction)
+                continue
+            if not inplace:
+                frame = FeatureFrame(frame)
+                frame.attrs = dict(self[code].attrs)
+            result[code] = frame
+        return FeatureResult(result, errors, self.reports), reports
@@ -0,0 +1,326 @@
+"""
+特征数据流式读取模块 / Feature Stream Module
+按时间分块逐块读取特征数据，避免长区间、多标的查询一次性占用大量内存
+Reads feature data chunk by chunk over time so that long, multi-instrument
+queries don't materialize everything in memory at once
+
+内存特性 / Memory characteristics:
+    迭代器同一时刻只持有当前块的原始数据，加上表达式所需的历史行
+    （见Expression.lookback）和整个区间的交易日列表。峰值内存约为
+    O(块行数 × 字段数 + 交易日数)，与标的数量和区间长度基本无关；
+    一次性获取的峰值内存为O(标的数 × 总行数 × 字段数)。
+    The iterator holds only the raw data of the current chunk, plus the
+    history rows expressions need (see Expression.lookback) and the list of
+    sessions in the range. Peak memory is about O(chunk rows × fields +
+    sessions), largely independent of the number of instruments and the
+    length of the range; the eager path peaks at O(instruments × rows × fields).
+"""
+
+import logging
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple, Union
+
+import pandas as pd
+
+from ..infrastructure.data_provider import DataProvider, FreqLike, to_freq
+from ..infrastructure.logger_system import current_logger, get_logger, log_enabled
+from ..utils.request_context import RequestContext, ContextCancelledError, background
+from .expression_engine import Expression
+from .feature_frame import FeatureFrame
+from .fundamentals import DEFAULT_MAX_STALENESS, load_with_fundamentals
+from .trading_calendar import TradingCalendar
+
+
+# 按月分块
+CHUNK_BY_MONTH = "month"
+
+
+@dataclass
+class FeatureRequest:
+    """
+    特征数据请求 / Feature data request
+    
+    Attributes:
+        instruments: 标的代码列表 / Instrument codes
+        fields: 字段或表达式列表 / Fields or expressions
+        start_time: 开始时间，"2025-01-01"或带偏移的RFC3339时间 / Start time, "2025-01-01" or RFC3339 with an offset
+        end_time: 结束时间，格式同start_time / End time in the same formats
+        freq: 数据频率，可以是Freq / Data frequency, a Freq is accepted too
+        chunk_by: 分块方式，"month"按自然月分块，整数按固定行数分块 /
+            Chunking: "month" for calendar months, an int for a fixed row count
+        provider: 提供者实例或已注册名称，None表示默认提供者 /
+            Provider instance or registered name, None for the default
+        calendar: 交易日历或市场名称 / Trading calendar or market name
+        context: 请求上下文，用于取消 / Request context for cancellation
+        timezone: 交易所时区，None表示使用calendar的时区，没有时使用DataManager的默认时区 /
+            Exchange timezone; None uses calendar's timezone, falling back to the DataManager default
+    """
+    instruments: Union[str, List[str]]
+    fields: List[str]
+    start_time: Optional[str] = None
+    end_time: Optional[str] = None
+    freq: FreqLike = "day"
+    chunk_by: Union[str, int] = CHUNK_BY_MONTH
+    provider: Optional[Union[str, DataProvider]] = None
+    calendar: Optional[Union[str, TradingCalendar]] = None
+    context: Optional[RequestContext] = None
+    timezone: Optional[str] = None
+    
+    def __post_init__(self):
+        if isinstance(self.instruments, str):
+            self.instruments = [self.instruments]
+        self.freq = to_freq(self.freq)
+        if isinstance(self.chunk_by, int):
+            if self.chunk_by < 1:
+                raise ValueError(f"chunk_by must be positive, got {self.chunk_by}")
+        elif self.chunk_by != CHUNK_BY_MONTH:
+            raise ValueError(f"chunk_by must be '{CHUNK_BY_MONTH}' or a row count, got {self.chunk_by!r}")
+
+
+@dataclass
+class Chunk:
+    """
+    数据块 / Data chunk
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        frame: 该块的数据 / Data of this chunk
+        sequence: 该标的内的块序号（从0开始） / Chunk number within the instrument (0-based)
+        start: 块的开始时间 / Chunk start
+        end: 块的结束时间 / Chunk end
+    """
+    instrument: str
+    frame: FeatureFrame
+    sequence: int
+    start: pd.Timestamp
+    end: pd.Timestamp
+
+
+@dataclass
+class _InstrumentState:
+    instrument: str
+    window: int = 0
+    sequence: int = 0
+    carry: Optional[pd.DataFrame] = None
+    emitted_until: Optional[pd.Timestamp] = None
+
+
+class FeatureIterator:
+    """
+    特征数据迭代器 / Feature data iterator
+    
+    标的按请求顺序依次输出，每个标的内部的块按时间升序输出。
+    某个标的失败时记录在errors中并跳到下一个标的；请求上下文取消后
+    迭代结束，error返回取消原因。
+    Instruments are emitted in request order and, within each instrument,
+    chunks in ascending time order. A failing instrument is recorded in errors
+    and skipped; once the request context is cancelled iteration stops and
+    error holds the cancellation.
+    
+    Examples:
+        >>> iterator = manager.get_features_stream(FeatureRequest(["SH600000"], ["$close"]))
+        >>> while True:
+        ...     chunk, ok = iterator.next()
+        ...     if not ok:
+        ...         break
+        ...     process(chunk.frame)
+    """
+    
+    def __init__(
+        self,
+        provider: DataProvider,
+        request: FeatureRequest,
+        expressions: Dict[str, Expression],
+        windows: List[Tuple[pd.Timestamp, pd.Timestamp]],
+        calendar: Optional[TradingCalendar] = None,
+        max_staleness: Optional[pd.Timedelta] = DEFAULT_MAX_STALENESS
+    ):
+        """
+        初始化迭代器 / Initialize iterator
+        
+        Args:
+            provider: 数据提供者 / Data provider
+            request: 特征数据请求 / Feature request
+            expressions: 已解析的表达式 / Parsed expressions
+            windows: 按时间升序排列的块区间 / Chunk windows in ascending time order
+            calendar: 交易日历，提供时只输出交易日的行 / Calendar; only session rows are emitted
+            max_staleness: 基本面字段的最大陈旧期 / Max staleness of fundamental fields
+        """
+        self._provider = provider
+        self._request = request
+        self._expressions = expressions
+        self._windows = windows
+        self._calendar = calendar
+        self._max_staleness = max_staleness
+        self._context = request.context or background()
+        self._logger = get_logger(__name__)
+        
+        base_fields = [f for f in request.fields if f not in expressions]
+        for expression in expressions.values():
+            base_fields.extend(expression.fields)
+        self._base_fields = list(dict.fromkeys(base_fields))
+        self._lookback = max([0] + [e.lookback for e in expressions.values()])
+        
+        self._codes = list(dict.fromkeys(request.instruments))
+        self._position = 0
+        self._state: Optional[_InstrumentState] = None
+        self._error: Optional[ContextCancelledError] = None
+        self._closed = False
+        self.errors: Dict[str, Exception] = {}
+    
+    @property
+    def error(self) -> Optional[ContextCancelledError]:
+        """迭代因取消而结束时的错误 / Error when iteration ended because of cancellation"""
+        return self._error
+    
+    def next(self) -> Tuple[Optional[Chunk], bool]:
+        """
+        获取下一个数据块 / Get the next chunk
+        
+        Returns:
+            Tuple[Optional[Chunk], bool]: (数据块, 是否还有数据)，结束时为(None, False) /
+                (chunk, ok); (None, False) once exhausted or cancelled
+        """
+        while not self._closed:
+            if self._context.err() is not None:
+                self._error = self._context.err()
+                self._logger.info(f"特征数据流已取消: {self._error}")
+                self.close()
+                break
+            
+            if self._state is None:
+                if self._position >= len(self._codes):
+                    self.close()
+                    break
+                self._state = _InstrumentState(self._codes[self._position])
+                self._position += 1
+            
+            state = self._state
+            if state.window >= len(self._windows):
+                self._state = None
+                continue
+            
+            window_start, window_end = self._windows[state.window]
+            state.window += 1
+            try:
+                chunk = self._load_chunk(state, window_start, window_end)
+            except ContextCancelledError as e:
+                # 读取中途取消，不计为该标的的错误
+                self._error = e
+                self._logger.info(f"特征数据流已取消: {e}")
+                self.close()
+                break
+            except Exception as e:
+                if log_enabled(logging.WARNING):
+                    current_logger().warning("跳过标的 %s, 流式获取失败: %s", state.instrument, e)
+                self.errors[state.instrument] = e
+                self._state = None
+                continue
+            
+            if chunk is not None:
+                return chunk, True
+        
+        return None, False
+    
+    def __iter__(self):
+        return self
+    
+    def __next__(self) -> Chunk:
+        chunk, ok = self.next()
+        if not ok:
+            if self._error is not None:
+                raise self._error
+            raise StopIteration
+        return chunk
+    
+    def close(self) -> None:
+        """
+        结束迭代并释放持有的数据 / Stop iterating and release held data
+        """
+        self._closed = True
+        self._state = None
+    
+    def _load_chunk(
+        self,
+        state: _InstrumentState,
+        window_start: pd.Timestamp,
+        window_end: pd.Timestamp
+    ) -> Optional[Chunk]:
+        """加载一个块并计算表达式 / Load one chunk and evaluate expressions"""
+        raw = load_with_fundamentals(
+            self._provider,
+            self._context,
+            state.instrument,
+            self._base_fields,
+            window_start,
+            window_end,
+            self._request.freq,
+            self._max_staleness
+        )
+        if raw is None or raw.empty:
+            return None
+        if self._calendar is not None:
+            raw = raw[self._calendar.session_mask(pd.DatetimeIndex(raw.index), self._request.freq)]
+            if raw.empty:
+                return None
+        
+        # 块之间按时间严格递增，防止提供者返回边界上重复的行
+        if state.emitted_until is not None:
+            raw = raw[raw.index > state.emitted_until]
+            if raw.empty:
+                return None
+        
+        if self._expressions:
+            data = raw if state.carry is None else pd.concat([state.carry, raw])
+            columns = {
+                f: self._expressions[f].evaluate(data, self._context) if f in self._expressions else data[f]
+                for f in self._request.fields
+            }
+            frame = pd.DataFrame(columns, index=data.index).iloc[-len(raw):]
+            state.carry = data.iloc[-self._lookback:] if self._lookback else None
+        else:
+            frame = raw[self._request.fields]
+        
+        state.emitted_until = frame.index[-1]
+        chunk = Chunk(
+            instrument=state.instrument,
+            frame=FeatureFrame(frame),
+            sequence=state.sequence,
+            start=frame.index[0],
+            end=frame.index[-1]
+        )
+        state.sequence += 1
+        return chunk
+
+
+def plan_windows(
+    sessions: List[pd.Timestamp],
+    chunk_by: Union[str, int]
+) -> List[Tuple[pd.Timestamp, pd.Timestamp]]:
+    """
+    根据交易时间划分块区间 / Split sessions into chunk windows
+    
+    Args:
+        sessions: 升序排列的交易时间 / Sessions in ascending order
+        chunk_by: "month"或每块的行数 / "month" or rows per chunk
+    
+    Returns:
+        List[Tuple[pd.Timestamp, pd.Timestamp]]: 每块的(开始, 结束)，均包含 /
+            Inclusive (start, end) of every chunk
+    """
+    if not sessions:
+        return []
+    index = pd.DatetimeIndex(sessions)
+    
+    if chunk_by == CHUNK_BY_MONTH:
+        windows = []
+        months = index.to_period("M")
+        for month in months.unique():
+            in_month = index[months == month]
+            windows.append((in_month[0], in_month[-1]))
+        return windows
+    
+    return [
+        (index[i], index[min(i + chunk_by, len(index)) - 1])
+        for i in range(0, len(index), chunk_by)
+    ]
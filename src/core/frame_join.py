@@ -0,0 +1,286 @@
+"""
+数据对齐与合并模块 / Frame Alignment and Join Module
+按时间索引对齐、合并两个单标的数据，或按标的合并两组多标的数据，支持不同频率的数据
+Aligns and joins two per-instrument frames on their time index, or two
+multi-instrument results on the instrument axis, including frames of
+different frequencies
+
+日线数据合并到日内数据上时按交易日广播：每根日内K线取同一交易日的日线值，日线值只从
+自己的时间戳（当日零点）起生效，不会用到之后交易日的数据。其余情况按时间戳精确匹配。
+When a daily frame is joined onto an intraday frame it is broadcast per
+trading day: every intraday bar takes the daily value of its own day, and a
+daily value only applies from its own timestamp (midnight of the day)
+forward, so no later day leaks in. Everything else matches on exact
+timestamps.
+
+Examples:
+    >>> factor = daily["SH600000"][["momentum"]]
+    >>> joined = minute["SH600000"].join_with(factor, how="left")
+    >>> left, right = result_a["SH600000"].align_with(result_b["SH600000"], FillPolicy.FORWARD_FILL)
+"""
+
+from typing import Dict, Iterable, List, Mapping, Optional, Tuple, Union
+
+import pandas as pd
+
+from .trading_calendar import FillPolicy
+
+
+# 支持的合并方式 / Supported join kinds
+JOIN_HOWS = ("inner", "outer", "left")
+# 列名冲突时左、右两侧列名的默认后缀 / Default suffixes of colliding left and right columns
+DEFAULT_SUFFIXES = ("", "_right")
+
+MethodLike = Union[str, FillPolicy]
+
+
+def align_frames(
+    left: pd.DataFrame,
+    right: pd.DataFrame,
+    method: MethodLike = FillPolicy.NAN,
+    how: str = "outer"
+) -> Tuple[pd.DataFrame, pd.DataFrame]:
+    """
+    把两个数据对齐到同一时间索引 / Align two frames onto the same time index
+    
+    left为日内数据、right为日线数据时，right按交易日广播到left的K线上（见模块说明）；
+    此时left中没有对应日线的K线视为不匹配。
+    When left is intraday and right is daily, right is broadcast onto left's
+    bars per trading day (see the module docstring); bars of a day without a
+    daily row count as non-matching.
+    
+    Args:
+        left: 以时间为索引的数据 / Time-indexed frame
+        right: 以时间为索引的数据 / Time-indexed frame
+        method: 不匹配的行在缺少数据的一侧的填充方式："ffill"取之前最近的行，"bfill"取之后最近的
+            行，"nan"保留为NaN；已有的NaN不会被填充 / How the side lacking a row fills it:
+            "ffill" takes the nearest earlier row, "bfill" the nearest later row
+            and "nan" leaves NaN; existing NaNs are never filled
+        how: "inner"只保留两侧都有的行，"outer"保留所有行，"left"保留left的行 /
+            "inner" keeps rows on both sides, "outer" every row and "left" the rows of left
+    
+    Returns:
+        Tuple[pd.DataFrame, pd.DataFrame]: 索引相同的(left, right) / (left, right) sharing one index
+    
+    Raises:
+        ValueError: how或method无效，或索引中有重复时间戳时抛出 /
+            Raised for an invalid how or method, or duplicate timestamps in an index
+    """
+    if how not in JOIN_HOWS:
+        raise ValueError(f"how must be one of {JOIN_HOWS}, got {how!r}")
+    policy = FillPolicy(method)
+    if policy == FillPolicy.DROP:
+        raise ValueError("method must be ffill, bfill or nan; use how='inner' to drop non-matching rows")
+    if policy == FillPolicy.ZERO:
+        raise ValueError("method must be ffill, bfill or nan; fill the joined frame with fillna(0) instead")
+    left, right = _sorted(left, "left"), _sorted(right, "right")
+    
+    if _broadcasts(left, right):
+        return _broadcast(left, right, policy, how)
+    
+    if how == "left":
+        index = left.index
+    elif how == "inner":
+        index = left.index[left.index.isin(right.index)]
+    else:
+        index = left.index.union(right.index)
+    return _reindex(left, index, policy), _reindex(right, index, policy)
+
+
+def join_frames(
+    left: pd.DataFrame,
+    right: pd.DataFrame,
+    how: str = "left",
+    method: MethodLike = FillPolicy.NAN,
+    suffixes: Optional[Tuple[str, str]] = DEFAULT_SUFFIXES
+) -> pd.DataFrame:
+    """
+    按时间索引合并两个数据的列 / Join the columns of two frames on their time index
+    
+    行的对齐方式与align_frames()相同，结果的列为left的列加上right的列
+    Rows are aligned as in align_frames(); the result holds left's columns
+    followed by right's
+    
+    Args:
+        left: 以时间为索引的数据 / Time-indexed frame
+        right: 以时间为索引的数据 / Time-indexed frame
+        how: 合并方式，见align_frames() / Join kind, see align_frames()
+        method: 不匹配行的填充方式，见align_frames() / Fill method of non-matching rows, see align_frames()
+        suffixes: 两侧同名列分别追加的后缀，None表示有同名列时抛出错误 /
+            Suffixes appended to colliding left and right columns, None to raise on any collision
+    
+    Returns:
+        pd.DataFrame: 合并后的数据 / Joined frame
+    
+    Raises:
+        ValueError: 参数无效，suffixes为None时有同名列，或追加后缀后列名仍然冲突时抛出 /
+            Raised for invalid arguments, for colliding columns when suffixes is
+            None, or when columns still collide after the suffixes
+    """
+    left, right = align_frames(left, right, method, how)
+    collisions = set(left.columns) & set(right.columns)
+    if collisions and suffixes is None:
+        raise ValueError(f"columns {sorted(str(c) for c in collisions)} appear on both sides")
+    if collisions:
+        left = left.rename(columns={c: f"{c}{suffixes[0]}" for c in collisions})
+        right = right.rename(columns={c: f"{c}{suffixes[1]}" for c in collisions})
+    columns = list(left.columns) + list(right.columns)
+    duplicated = sorted({str(c) for c in columns if columns.count(c) > 1})
+    if duplicated:
+        raise ValueError(f"columns {duplicated} collide, pass suffixes to tell them apart")
+    return pd.concat([left, right], axis=1)
+
+
+def align_results(
+    left: Mapping[str, pd.DataFrame],
+    right: Mapping[str, pd.DataFrame],
+    method: MethodLike = FillPolicy.NAN,
+    how: str = "outer"
+) -> Tuple[Dict[str, pd.DataFrame], Dict[str, pd.DataFrame]]:
+    """
+    按标的对齐两组多标的数据 / Align two multi-instrument results instrument by instrument
+    
+    how同时用于标的和时间索引；只在一侧存在的标的，另一侧为全部是NaN的数据
+    how applies to both the instruments and the time index; an instrument
+    present on one side only gets an all-NaN frame on the other
+    
+    Args:
+        left: 标的代码到数据的映射，如FeatureResult / Instrument code to frame, e.g. a FeatureResult
+        right: 标的代码到数据的映射 / Instrument code to frame
+        method: 不匹配行的填充方式，见align_frames() / Fill method of non-matching rows, see align_frames()
+        how: 合并方式，见align_frames() / Join kind, see align_frames()
+    
+    Returns:
+        Tuple[Dict[str, pd.DataFrame], Dict[str, pd.DataFrame]]: 标的相同的(left, right) /
+            (left, right) holding the same instruments
+    """
+    left_columns, right_columns = _columns(left.values()), _columns(right.values())
+    aligned_left, aligned_right = {}, {}
+    for code in _join_codes(left, right, how):
+        if code not in right:
+            frame = _sorted(left[code], "left")
+            aligned_left[code], aligned_right[code] = frame, _empty(right_columns, frame.index)
+        elif code not in left:
+            frame = _sorted(right[code], "right")
+            aligned_left[code], aligned_right[code] = _empty(left_columns, frame.index), frame
+        else:
+            aligned_left[code], aligned_right[code] = align_frames(left[code], right[code], method, how)
+    return aligned_left, aligned_right
+
+
+def join_results(
+    left: Mapping[str, pd.DataFrame],
+    right: Mapping[str, pd.DataFrame],
+    how: str = "left",
+    method: MethodLike = FillPolicy.NAN,
+    suffixes: Optional[Tuple[str, str]] = DEFAULT_SUFFIXES
+) -> Dict[str, pd.DataFrame]:
+    """
+    按标的合并两组多标的数据的列 / Join the columns of two multi-instrument results instrument by instrument
+    
+    标的和行的对齐方式与align_results()相同
+    Instruments and rows are aligned as in align_results()
+    
+    Args:
+        left: 标的代码到数据的映射，如FeatureResult / Instrument code to frame, e.g. a FeatureResult
+        right: 标的代码到数据的映射 / Instrument code to frame
+        how: 合并方式，见align_frames() / Join kind, see align_frames()
+        method: 不匹配行的填充方式，见align_frames() / Fill method of non-matching rows, see align_frames()
+        suffixes: 两侧同名列分别追加的后缀，None表示有同名列时抛出错误 /
+            Suffixes appended to colliding left and right columns, None to raise on any collision
+    
+    Returns:
+        Dict[str, pd.DataFrame]: 标的代码到合并后数据的映射 / Instrument code to joined frame
+    """
+    aligned_left, aligned_right = align_results(left, right, method, how)
+    return {
+        code: join_frames(aligned_left[code], aligned_right[code], "left", method, suffixes)
+        for code in aligned_left
+    }
+
+
+def _is_daily(index: pd.DatetimeIndex) -> bool:
+    """所有时间戳都在零点 / Whether every timestamp falls on midnight"""
+    return len(index) > 0 and bool((index == index.normalize()).all())
+
+
+def _broadcasts(left: pd.DataFrame, right: pd.DataFrame) -> bool:
+    """是否把日线数据right广播到日内数据left上 / Whether daily right is broadcast onto intraday left"""
+    return _is_daily(right.index) and len(left.index) > 0 and not _is_daily(left.index)
+
+
+def _broadcast(
+    left: pd.DataFrame,
+    right: pd.DataFrame,
+    policy: FillPolicy,
+    how: str
+) -> Tuple[pd.DataFrame, pd.DataFrame]:
+    """按交易日把日线数据广播到日内K线上 / Broadcast daily rows onto intraday bars per trading day"""
+    days = left.index.normalize()
+    matched = days.isin(right.index)
+    values = right.reindex(days)
+    values.index = left.index
+    if policy != FillPolicy.NAN and not matched.all():
+        # 没有当日日线的K线按填充方式取其他交易日的日线
+        fallback = right.reindex(left.index, method=policy.value)
+        values.loc[~matched] = fallback.loc[~matched].to_numpy()
+    
+    if how == "inner":
+        return left[matched], values[matched]
+    if how == "left":
+        return left, values
+    # 没有日内K线的交易日以日线自身的时间戳保留
+    extra = right.index[~right.index.isin(days)]
+    index = left.index.union(extra)
+    aligned_left = left.reindex(index)
+    aligned_right = values.reindex(index)
+    if len(extra):
+        aligned_left.loc[extra] = _reindex(left, extra, policy).to_numpy()
+        aligned_right.loc[extra] = right.loc[extra].to_numpy()
+    return aligned_left, aligned_right
+
+
+def _reindex(frame: pd.DataFrame, index: pd.DatetimeIndex, policy: FillPolicy) -> pd.DataFrame:
+    """重建索引，只填充新增的行 / Reindex, filling only the rows that were added"""
+    if policy == FillPolicy.NAN:
+        return frame.reindex(index)
+    return frame.reindex(index, method=policy.value)
+
+
+def _sorted(frame: pd.DataFrame, side: str) -> pd.DataFrame:
+    """按时间排序，重复时间戳无法对齐 / Sort by time; duplicate timestamps can't be aligned"""
+    if frame.index.has_duplicates:
+        raise ValueError(f"{side} frame has duplicate timestamps, drop them first (see FeatureFrame.repair)")
+    if not frame.index.is_monotonic_increasing:
+        frame = frame.sort_index(kind="stable")
+    return frame
+
+
+def _join_codes(left: Mapping[str, pd.DataFrame], right: Mapping[str, pd.DataFrame], how: str) -> List[str]:
+    """
+    按合并方式选出标的 / Pick the instruments of a join kind
+    
+    顺序为left中的顺序，outer时再追加只在right中的标的
+    In left's order, followed by the right-only ones for outer
+    """
+    if how not in JOIN_HOWS:
+        raise ValueError(f"how must be one of {JOIN_HOWS}, got {how!r}")
+    if how == "inner":
+        return [code for code in left if code in right]
+    codes = list(left)
+    if how == "outer":
+        codes.extend(code for code in right if code not in left)
+    return codes
+
+
+def _columns(frames: Iterable[pd.DataFrame]) -> List:
+    """一组数据中出现的所有列，保持首次出现的顺序 / Every column of some frames, in order of first appearance"""
+    columns: Dict = {}
+    for frame in frames:
+        columns.update(dict.fromkeys(frame.columns))
+    return list(columns)
+
+
+def _empty(columns: List, index: pd.DatetimeIndex) -> pd.DataFrame:
+    """给定列和索引、全部为NaN的数据 / All-NaN frame with the given columns and index"""
+    return pd.DataFrame(float("nan"), index=index, columns=columns)
@@ -0,0 +1,213 @@
+"""
+特征数据快照模块 / Feature Frame Snapshot Module
+把以时间为索引的数据保存为紧凑的二进制快照并读回，时间、字段名和数值列逐位保持不变
+Saves time-indexed frames as a compact binary snapshot and reads them back,
+keeping timestamps, field names and numeric columns bit-for-bit identical
+
+快照格式（所有整数均为小端序）：
+    4字节魔数b"QTFS"，1字节格式版本
+    uint32行数，uint32列数
+    字符串：时区（无时区为空串）、索引名、标的代码（attrs["instrument"]）
+    int64[行数]：纳秒时间戳，NaT为int64最小值
+    每列：字符串列名、字符串numpy类型（如"<f8"）、行数个该类型的值
+其中字符串为1字节是否为None的标记，加uint32字节数和UTF-8内容。读取时按版本号选择
+解析方式，以后的格式变化只需增加版本号，旧快照仍可读取。
+Snapshot layout (every integer little-endian):
+    4-byte magic b"QTFS", 1-byte format version
+    uint32 row count, uint32 column count
+    strings: timezone (empty when naive), index name, instrument (attrs["instrument"])
+    int64[rows]: nanosecond timestamps, NaT as the int64 minimum
+    per column: string name, string numpy dtype (e.g. "<f8"), rows values of that dtype
+A string is a 1-byte None marker plus a uint32 byte length and UTF-8 bytes.
+Readers dispatch on the version, so a later format only needs a new version
+number and old snapshots stay readable.
+
+Examples:
+    >>> with open("research.qtfs", "wb") as f:
+    ...     frame.save(f)
+    >>> frame = FeatureFrame.load("research.qtfs")
+"""
+
+import struct
+from pathlib import Path
+from typing import BinaryIO, Callable, Dict, Optional, Union
+
+import numpy as np
+import pandas as pd
+
+from ..utils.error_handler import DataError, ErrorCategory, ErrorInfo, ErrorSeverity
+
+
+# 快照文件开头的魔数 / Magic bytes opening every snapshot
+MAGIC = b"QTFS"
+
+# 当前写入的格式版本 / Format version written now
+SNAPSHOT_VERSION = 1
+
+# 可以保存的列类型：浮点、整数、无符号整数和布尔 / Column kinds that can be saved: float, int, unsigned and bool
+_SUPPORTED_KINDS = "fiub"
+
+_HEADER = struct.Struct("<II")
+_LENGTH = struct.Struct("<I")
+
+StreamLike = Union[str, Path, BinaryIO]
+
+
+def write_snapshot(stream: StreamLike, frame: pd.DataFrame) -> None:
+    """
+    把数据写为二进制快照 / Write a frame as a binary snapshot
+    
+    Args:
+        stream: 可写的二进制文件对象或文件路径 / Writable binary file object or file path
+        frame: 以DatetimeIndex为索引、列名为字符串、列为数值或布尔类型的数据 /
+            Frame with a DatetimeIndex, string column names and numeric or bool columns
+    
+    Raises:
+        ValueError: 索引不是时间、列名不是唯一的字符串或列类型不受支持时抛出 /
+            Raised when the index isn't a DatetimeIndex, column names aren't unique
+            strings, or a column dtype is unsupported
+    """
+    if not isinstance(frame.index, pd.DatetimeIndex):
+        raise ValueError(f"snapshot needs a DatetimeIndex, got {type(frame.index).__name__}")
+    if frame.columns.has_duplicates:
+        raise ValueError(f"snapshot column names must be unique, got {list(frame.columns)}")
+    for name, dtype in frame.dtypes.items():
+        if not isinstance(name, str):
+            raise ValueError(f"snapshot column names must be strings, got {name!r}")
+        if not isinstance(dtype, np.dtype) or dtype.kind not in _SUPPORTED_KINDS:
+            raise ValueError(f"column {name!r} has unsupported dtype {dtype}, expected numeric or bool")
+    
+    index = frame.index
+    timezone = "" if index.tz is None else str(index.tz)
+    if index.tz is not None:
+        index = index.tz_convert("UTC").tz_localize(None)
+    stamps = index.as_unit("ns").asi8 if hasattr(index, "as_unit") else index.asi8
+    
+    parts = [MAGIC, bytes([SNAPSHOT_VERSION]), _HEADER.pack(len(frame), frame.shape[1])]
+    parts.append(_pack_string(timezone))
+    parts.append(_pack_string(frame.index.name))
+    parts.append(_pack_string(frame.attrs.get("instrument")))
+    parts.append(np.asarray(stamps, dtype="<i8").tobytes())
+    for position, name in enumerate(frame.columns):
+        values = frame.iloc[:, position].to_numpy()
+        dtype = values.dtype.newbyteorder("<")
+        parts.append(_pack_string(name))
+        parts.append(_pack_string(dtype.str))
+        parts.append(values.astype(dtype, copy=False).tobytes())
+    
+    _with_stream(stream, "wb", lambda f: f.write(b"".join(parts)))
+
+
+def read_snapshot(stream: StreamLike) -> pd.DataFrame:
+    """
+    读取二进制快照 / Read a binary snapshot
+    
+    Args:
+        stream: 可读的二进制文件对象或文件路径 / Readable binary file object or file path
+    
+    Returns:
+        pd.DataFrame: 与写入时相同的数据，attrs["instrument"]为写入时的标的代码（如有） /
+            The frame as written, with attrs["instrument"] when one was saved
+    
+    Raises:
+        DataError: 不是快照、版本不受支持或数据被截断时抛出 /
+            Raised for data that isn't a snapshot, an unsupported version, or a truncated snapshot
+    """
+    return _with_stream(stream, "rb", _read)
+
+
+def _read(f: BinaryIO) -> pd.DataFrame:
+    reader = _Reader(f)
+    if reader.take(len(MAGIC)) != MAGIC:
+        raise _snapshot_error("not a frame snapshot, bad magic bytes")
+    version = reader.take(1)[0]
+    parse = _READERS.get(version)
+    if parse is None:
+        raise _snapshot_error(f"unsupported snapshot version {version}, expected one of {sorted(_READERS)}")
+    return parse(reader)
+
+
+def _read_v1(reader: "_Reader") -> pd.DataFrame:
+    rows, columns = _HEADER.unpack(reader.take(_HEADER.size))
+    timezone = reader.string()
+    index_name = reader.string()
+    instrument = reader.string()
+    stamps = np.frombuffer(reader.take(rows * 8), dtype="<i8")
+    index = pd.DatetimeIndex(stamps.astype("datetime64[ns]"), name=index_name)
+    if timezone:
+        index = index.tz_localize("UTC").tz_convert(timezone)
+    
+    data: Dict[str, np.ndarray] = {}
+    for _ in range(columns):
+        name = reader.string()
+        try:
+            dtype = np.dtype(reader.string())
+        except TypeError as e:
+            raise _snapshot_error(f"bad dtype for column {name!r}: {e}") from e
+        if dtype.kind not in _SUPPORTED_KINDS:
+            raise _snapshot_error(f"unsupported dtype {dtype} for column {name!r}")
+        data[name] = np.frombuffer(reader.take(rows * dtype.itemsize), dtype=dtype).astype(dtype.newbyteorder("="))
+    
+    frame = pd.DataFrame(data, index=index, columns=list(data))
+    if instrument is not None:
+        frame.attrs["instrument"] = instrument
+    return frame
+
+
+# 按格式版本选择解析函数 / Parser per format version
+_READERS: Dict[int, Callable[["_Reader"], pd.DataFrame]] = {1: _read_v1}
+
+
+class _Reader:
+    """从流中读取定长数据，数据不足时抛出错误 / Reads fixed-size chunks, raising when the stream ends early"""
+    
+    def __init__(self, f: BinaryIO):
+        self._f = f
+    
+    def take(self, size: int) -> bytes:
+        chunk = self._f.read(size)
+        if len(chunk) != size:
+            raise _snapshot_error(f"snapshot truncated, wanted {size} bytes, got {len(chunk)}")
+        return chunk
+    
+    def string(self) -> Optional[str]:
+        if self.take(1) == b"\x00":
+            return None
+        length, = _LENGTH.unpack(self.take(_LENGTH.size))
+        try:
+            return self.take(length).decode("utf-8")
+        except UnicodeDecodeError as e:
+            raise _snapshot_error(f"bad string in snapshot: {e}") from e
+
+
+def _pack_string(value: Optional[str]) -> bytes:
+    if value is None:
+        return b"\x00"
+    encoded = str(value).encode("utf-8")
+    return b"\x01" + _LENGTH.pack(len(encoded)) + encoded
+
+
+def _with_stream(stream: StreamLike, mode: str, action):
+    """对文件对象直接操作，对路径打开文件后操作 / Act on a file object, or open a path first"""
+    if isinstance(stream, (str, Path)):
+        with open(Path(stream).expanduser(), mode) as f:
+            return action(f)
+    return action(stream)
+
+
+def _snapshot_error(message: str) -> DataError:
+    """构造快照解析失败的错误 / Build the error for a snapshot that fails to parse"""
+    error_info = ErrorInfo(
+        error_code="DAT0032",
+        error_message_zh=f"解析数据快照失败: {message}",
+        error_message_en=f"Failed to parse frame snapshot: {message}",
+        category=ErrorCategory.DATA,
+        severity=ErrorSeverity.MEDIUM,
+        technical_details=message,
+        suggested_actions=[
+            "确认文件是由FeatureFrame.save()写入的",
+            "确认文件没有损坏或被截断"
+        ],
+        recoverable=True
+    )
+    return DataError(error_info)
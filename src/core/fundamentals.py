@@ -0,0 +1,163 @@
+"""
+基本面字段模块 / Fundamentals Module
+把提供者返回的基本面公告记录按时点对齐到K线上
+Aligns the fundamental announcement records a provider returns onto bars,
+point in time
+
+每个值从公告日起才出现在数据中，而不是从报告期末起，回测因此不会提前看到尚未公布的
+财报。两次公告之间向前填充，距离公告日超过max_staleness后变为NaN。公告日为D的值从D日
+的第一根K线起可见；收盘后发布的公告应由提供者记为下一个交易日。
+A value appears from its announcement date onward, never from the fiscal
+period end, so backtests can't see a report before it was published. Values
+are forward-filled between announcements and become NaN once they are more
+than max_staleness past their announcement. A value announced on day D is
+visible from D's first bar; providers should date after-close announcements
+to the next session.
+"""
+
+from typing import List, Optional, Union
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.data_provider import DataProvider, is_fundamental
+from ..utils.request_context import RequestContext
+
+
+# 默认最大陈旧期：超过两个季度没有新公告时视为缺失
+DEFAULT_MAX_STALENESS = pd.Timedelta(days=180)
+
+
+def to_staleness(value: Optional[Union[str, pd.Timedelta]]) -> Optional[pd.Timedelta]:
+    """
+    解析最大陈旧期 / Parse a max staleness
+    
+    Args:
+        value: 时长，如"90D"或pd.Timedelta(days=90)，None表示不限 /
+            Duration such as "90D" or pd.Timedelta(days=90), None for no limit
+    
+    Returns:
+        Optional[pd.Timedelta]: 解析后的时长 / Parsed duration
+    
+    Raises:
+        ValueError: 时长为负数时抛出 / Raised for a negative duration
+    """
+    if value is None:
+        return None
+    staleness = pd.Timedelta(value)
+    if staleness < pd.Timedelta(0):
+        raise ValueError(f"max_staleness must be non-negative, got {value!r}")
+    return staleness
+
+
+def align_point_in_time(
+    records: pd.DataFrame,
+    index: pd.DatetimeIndex,
+    fields: List[str],
+    max_staleness: Optional[pd.Timedelta] = DEFAULT_MAX_STALENESS
+) -> pd.DataFrame:
+    """
+    把公告记录按时点对齐到时间轴 / Align announcement records onto a time axis, point in time
+    
+    每个字段单独对齐：某次公告缺少的字段沿用该字段上一次公告的值，陈旧期也从那次公告算起。
+    同一公告日有多条记录时以最后一条为准。
+    Each field is aligned on its own: a field an announcement leaves out keeps
+    that field's previous announced value, with staleness counted from that
+    announcement. Among several records on one announcement date the last wins.
+    
+    Args:
+        records: 以公告日为升序索引的记录 / Records indexed by announcement date, ascending
+        index: 目标时间轴 / Target time axis
+        fields: 要对齐的字段 / Fields to align
+        max_staleness: 最大陈旧期，None表示一直向前填充 / Max staleness, None forward-fills indefinitely
+    
+    Returns:
+        pd.DataFrame: 以index为索引、fields为列的数据 / Data indexed by index with fields as columns
+    """
+    index = pd.DatetimeIndex(index)
+    times = index.to_numpy()
+    columns = {}
+    for field in fields:
+        if field in records.columns:
+            series = records[field].dropna()
+        else:
+            series = pd.Series(dtype=float, index=pd.DatetimeIndex([]))
+        announced = pd.DatetimeIndex(series.index).to_numpy()
+        values = series.to_numpy(dtype=float)
+        # 每个时刻之前（包含）最后一次公告的位置；有序且重复时side="right"取到最后一条
+        positions = np.searchsorted(announced, times, side="right") - 1
+        known = positions >= 0
+        aligned = np.full(len(times), np.nan)
+        aligned[known] = values[positions[known]]
+        if max_staleness is not None and known.any():
+            age = times[known] - announced[positions[known]]
+            stale = np.zeros(len(times), dtype=bool)
+            stale[known] = age > max_staleness.to_timedelta64()
+            aligned[stale] = np.nan
+        columns[field] = aligned
+    return pd.DataFrame(columns, index=index, columns=list(fields))
+
+
+def load_with_fundamentals(
+    provider: DataProvider,
+    ctx: RequestContext,
+    instrument: str,
+    fields: List[str],
+    start_time: Optional[str],
+    end_time: Optional[str],
+    freq: str,
+    max_staleness: Optional[pd.Timedelta] = DEFAULT_MAX_STALENESS
+) -> pd.DataFrame:
+    """
+    加载K线字段和基本面字段 / Load bar fields together with fundamental fields
+    
+    K线字段通过load_features_ctx()加载，基本面字段通过fundamentals_ctx()加载后按时点对齐到
+    K线时间上；只请求基本面字段时使用提供者的交易日历作为时间轴。公告记录从
+    start_time - max_staleness起获取，区间开头的值因此能沿用区间之前的公告。
+    Bar fields come from load_features_ctx() and fundamental fields from
+    fundamentals_ctx(), aligned point in time onto the bar times; with only
+    fundamental fields the provider's calendar is the time axis. Records are
+    fetched from start_time - max_staleness so that the first rows can carry
+    announcements made before the range.
+    
+    Args:
+        provider: 数据提供者 / Data provider
+        ctx: 请求上下文 / Request context
+        instrument: 标的代码 / Instrument code
+        fields: 原始字段 / Raw fields
+        start_time: 开始时间 / Start time
+        end_time: 结束时间 / End time
+        freq: 数据频率 / Data frequency
+        max_staleness: 基本面字段的最大陈旧期 / Max staleness of fundamental fields
+    
+    Returns:
+        pd.DataFrame: 以时间为索引、列顺序与fields一致的数据 / Time-indexed data with columns in the order of fields
+    """
+    fundamental_fields = [f for f in fields if is_fundamental(f)]
+    bar_fields = [f for f in fields if not is_fundamental(f)]
+    if not fundamental_fields:
+        return provider.load_features_ctx(
+            ctx, instrument, fields, start_time=start_time, end_time=end_time, freq=freq
+        )
+    
+    if bar_fields:
+        data = provider.load_features_ctx(
+            ctx, instrument, bar_fields, start_time=start_time, end_time=end_time, freq=freq
+        )
+    else:
+        calendar = provider.calendar_ctx(ctx, start_time=start_time, end_time=end_time, freq=freq)
+        data = pd.DataFrame(index=pd.DatetimeIndex(calendar, name="datetime"))
+    # 只有时间轴、没有列的DataFrame的empty也为True，因此按行数判断
+    if data is None or len(data.index) == 0:
+        return data
+    
+    lookback_start = None
+    if max_staleness is not None:
+        lookback_start = str(pd.DatetimeIndex(data.index)[0] - max_staleness)
+    records = provider.fundamentals_ctx(
+        ctx, [instrument], fundamental_fields,
+        start_time=lookback_start, end_time=str(pd.DatetimeIndex(data.index)[-1])
+    ).get(instrument, pd.DataFrame())
+    aligned = align_point_in_time(records, pd.DatetimeIndex(data.index), fundamental_fields, max_staleness)
+    aligned.index = data.index
+    return pd.concat([data, aligned], axis=1)[list(fields)]
@@ -0,0 +1,631 @@
+"""
+期货合约模块 / Futures Module
+期货品种的合约乘数和保证金，以及由各月份合约拼接的连续合约
+Contract multipliers and margins of futures products, and continuous
+contracts stitched from the individual delivery months
+
+合约代码为品种、四位年月和交易所，如"IF2503.CFE"；去掉年月的"IF.CFE"表示连续合约。
+连续合约在每个交易日使用一个月份合约的数据，按换月规则（成交量反超或到期前N个交易日）
+从近月换到下一个月份。换月在换月日收盘时进行，此后使用新合约；换月日之前（包含）的
+价格按差值或比例向后复权，保证最新一段与实际合约价格一致且换月处没有跳空。
+Contract codes are the product, a four-digit year and month, and the
+exchange, e.g. "IF2503.CFE"; dropping the year and month, "IF.CFE" is the
+continuous contract. Each trading day of a continuous contract uses one
+delivery month, rolling from the front month to the next on a roll rule
+(volume crossover or N trading days before expiry). The roll happens at the
+close of the roll day and the new contract is used from then on; prices up
+to and including the roll day are back-adjusted by the difference or the
+ratio, so the latest segment matches the real contract and the rolls leave no gaps.
+
+期货持仓在Portfolio中按合约乘数计算盈亏、按保证金比例占用资金，见portfolio模块。
+交易成本模型看到的是每点价格，期货手续费宜使用按手数计费的PerShareCommission。
+Portfolio values futures positions with the multiplier and holds margin at
+the margin rate, see the portfolio module. Cost models see per-point prices,
+so futures commissions are best set per contract with PerShareCommission.
+
+Examples:
+    >>> provider = ContinuousFuturesProvider(get_provider("qlib"), ExpiryRoll(3), AdjustMethod.DIFFERENCE)
+    >>> frame = provider.load_features("IF.CFE", ["$close"], "2024-01-01", "2024-12-31")
+    >>> provider.roll_schedule("IF.CFE", "2024-01-01", "2024-12-31")
+"""
+
+import re
+from abc import ABC, abstractmethod
+from dataclasses import dataclass
+from enum import Enum
+from typing import Dict, Iterable, List, Mapping, Optional, Tuple
+
+import pandas as pd
+
+from ..infrastructure.data_provider import ALL_MARKET, DataProvider, InstrumentNotFoundError
+from ..utils.error_handler import DataError, ErrorCategory, ErrorInfo, ErrorSeverity
+from ..utils.request_context import RequestContext
+from .feature_frame import FeatureFrame
+from .price_adjustment import PRICE_FIELDS
+from .trading_calendar import TradingCalendar
+
+
+CLOSE_FIELD = "$close"
+VOLUME_FIELD = "$volume"
+
+# 品种、可选的四位年月和交易所，如IF2503.CFE或IF.CFE
+_CODE = re.compile(r"^([A-Z]{1,2})(\d{4})?\.([A-Z]+)$")
+
+
+class InstrumentType(Enum):
+    """标的类型 / Instrument type"""
+    STOCK = "stock"
+    FUTURES = "futures"
+
+
+@dataclass(frozen=True)
+class FuturesSpec:
+    """
+    期货品种 / Futures product
+    
+    Attributes:
+        root: 品种代码，如"IF" / Product code, e.g. "IF"
+        exchange: 交易所后缀，如"CFE" / Exchange suffix, e.g. "CFE"
+        multiplier: 合约乘数，每点价格对应的金额 / Contract multiplier, the money value of one price point
+        margin_rate: 保证金比例，占合约名义价值的比例 / Margin rate as a share of the notional value
+    """
+    root: str
+    exchange: str
+    multiplier: float
+    margin_rate: float
+    
+    @property
+    def continuous_code(self) -> str:
+        """连续合约代码，如IF.CFE / Continuous contract code, e.g. IF.CFE"""
+        return f"{self.root}.{self.exchange}"
+    
+    def contract_code(self, year: int, month: int) -> str:
+        """
+        月份合约代码 / Code of one delivery month
+        
+        Args:
+            year: 年份 / Year
+            month: 月份 / Month
+        
+        Returns:
+            str: 如"IF2503.CFE" / E.g. "IF2503.CFE"
+        """
+        return f"{self.root}{year % 100:02d}{month:02d}.{self.exchange}"
+
+
+# 中金所股指期货，保证金为交易所标准，期货公司通常会上浮
+_SPECS: Dict[Tuple[str, str], FuturesSpec] = {
+    (spec.root, spec.exchange): spec
+    for spec in (
+        FuturesSpec("IF", "CFE", 300.0, 0.12),
+        FuturesSpec("IH", "CFE", 300.0, 0.12),
+        FuturesSpec("IC", "CFE", 200.0, 0.12),
+        FuturesSpec("IM", "CFE", 200.0, 0.12),
+    )
+}
+
+
+def register_futures(spec: FuturesSpec) -> None:
+    """
+    注册或覆盖期货品种 / Register or replace a futures product
+    
+    Args:
+        spec: 期货品种 / Futures product
+    
+    Raises:
+        ValueError: 乘数不是正数或保证金比例不在(0, 1]时抛出 /
+            Raised unless the multiplier is positive and the margin rate is in (0, 1]
+    """
+    if not spec.multiplier > 0:
+        raise ValueError(f"multiplier must be positive, got {spec.multiplier}")
+    if not 0 < spec.margin_rate <= 1:
+        raise ValueError(f"margin_rate must be in (0, 1], got {spec.margin_rate}")
+    _SPECS[(spec.root, spec.exchange)] = spec
+
+
+def get_futures_spec(code: str) -> Optional[FuturesSpec]:
+    """
+    查找代码所属的期货品种 / Find the futures product of a code
+    
+    Args:
+        code: 月份合约或连续合约代码 / Delivery month or continuous contract code
+    
+    Returns:
+        Optional[FuturesSpec]: 期货品种，不是已注册的期货代码时为None /
+            The product; None unless the code belongs to a registered product
+    """
+    match = _CODE.match(code)
+    if match is None:
+        return None
+    return _SPECS.get((match.group(1), match.group(3)))
+
+
+def instrument_type(code: str) -> InstrumentType:
+    """已注册期货品种的代码为期货，其余为股票 / Codes of a registered futures product are futures, the rest stocks"""
+    return InstrumentType.STOCK if get_futures_spec(code) is None else InstrumentType.FUTURES
+
+
+def is_continuous(code: str) -> bool:
+    """是否为连续合约代码，如IF.CFE / Whether the code is a continuous contract such as IF.CFE"""
+    match = _CODE.match(code)
+    return match is not None and match.group(2) is None and get_futures_spec(code) is not None
+
+
+def contract_expiry(code: str, calendar: Optional[TradingCalendar] = None) -> Optional[pd.Timestamp]:
+    """
+    月份合约的最后交易日 / Last trading day of a delivery month
+    
+    中金所股指期货在合约月份的第三个星期五到期，遇节假日顺延到下一个交易日
+    CFFEX index futures expire on the third Friday of the delivery month,
+    moved to the next trading day when that is a holiday
+    
+    Args:
+        code: 月份合约代码 / Delivery month code
+        calendar: 用于顺延节假日的交易日历 / Trading calendar used to move past holidays
+    
+    Returns:
+        Optional[pd.Timestamp]: 最后交易日，代码中没有年月时为None /
+            The last trading day; None when the code has no year and month
+    """
+    match = _CODE.match(code)
+    if match is None or match.group(2) is None:
+        return None
+    year, month = 2000 + int(match.group(2)[:2]), int(match.group(2)[2:])
+    first = pd.Timestamp(year=year, month=month, day=1)
+    expiry = first + pd.Timedelta(days=(4 - first.dayofweek) % 7 + 14)
+    if calendar is not None and not calendar.is_trading_day(expiry):
+        expiry = calendar.next(expiry)
+    return expiry
+
+
+class AdjustMethod(Enum):
+    """连续合约的复权方式 / Back-adjustment of a continuous contract"""
+    NONE = "none"  # 不复权，换月处保留跳空
+    DIFFERENCE = "difference"  # 换月日及之前的价格加上新旧合约的价差
+    RATIO = "ratio"  # 换月日及之前的价格乘以新旧合约的价格比
+
+
+@dataclass(frozen=True)
+class RollEvent:
+    """
+    一次换月 / One roll
+    
+    换月在time当日收盘时以两个合约的收盘价进行：平掉from_contract、开仓to_contract
+    The roll trades at the close of time at both contracts' closes: closing
+    from_contract and opening to_contract
+    
+    Attributes:
+        time: 换月日，旧合约的最后一个使用日 / Roll day, the last day on the old contract
+        from_contract: 换出的合约 / Contract rolled out of
+        to_contract: 换入的合约 / Contract rolled into
+        from_price: 旧合约换月日的收盘价 / Old contract's close on the roll day
+        to_price: 新合约换月日的收盘价 / New contract's close on the roll day
+    """
+    time: pd.Timestamp
+    from_contract: str
+    to_contract: str
+    from_price: float
+    to_price: float
+    
+    @property
+    def gap(self) -> float:
+        """新旧合约的价差 / Price difference of new over old"""
+        return self.to_price - self.from_price
+    
+    @property
+    def ratio(self) -> float:
+        """新旧合约的价格比 / Price ratio of new over old"""
+        return self.to_price / self.from_price
+
+
+class RollRule(ABC):
+    """
+    换月规则 / Roll rule
+    
+    给出当前合约换到下一个合约的换月日
+    Picks the day to roll from the current contract to the next one
+    """
+    
+    # 规则需要的字段，除$close外 / Fields the rule reads besides $close
+    fields: Tuple[str, ...] = ()
+    
+    @abstractmethod
+    def roll_date(
+        self,
+        current: pd.DataFrame,
+        following: pd.DataFrame,
+        expiry: Optional[pd.Timestamp],
+        days: pd.DatetimeIndex
+    ) -> Optional[pd.Timestamp]:
+        """
+        选择换月日 / Pick the roll day
+        
+        Args:
+            current: 当前合约在可换月区间内的数据 / Current contract's data over the days a roll may happen
+            following: 下一个合约同一区间的数据，与current有相同的索引 /
+                Next contract's data over the same days, on the same index as current
+            expiry: 当前合约的最后交易日，未知时为None / Current contract's last trading day; None when unknown
+            days: 全部合约的交易日 / Trading days of all contracts
+        
+        Returns:
+            Optional[pd.Timestamp]: 换月日，区间内不换月时为None / The roll day; None for no roll in the range
+        """
+        raise NotImplementedError
+
+
+class VolumeRoll(RollRule):
+    """
+    成交量反超换月 / Roll on volume crossover
+    
+    下一个合约的成交量第一次超过当前合约的当日换月
+    Rolls on the first day the next contract trades more volume than the current one
+    """
+    
+    fields = (VOLUME_FIELD,)
+    
+    def roll_date(
+        self,
+        current: pd.DataFrame,
+        following: pd.DataFrame,
+        expiry: Optional[pd.Timestamp],
+        days: pd.DatetimeIndex
+    ) -> Optional[pd.Timestamp]:
+        crossed = following[VOLUME_FIELD] > current[VOLUME_FIELD]
+        return crossed.index[crossed.to_numpy()][0] if crossed.any() else None
+
+
+class ExpiryRoll(RollRule):
+    """
+    到期前N个交易日换月 / Roll N trading days before expiry
+    
+    Attributes:
+        days_before: 换月日与最后交易日之间的交易日数，0表示在最后交易日换月 /
+            Trading days between the roll day and the last trading day; 0 rolls on the last trading day
+    """
+    
+    def __init__(self, days_before: int = 3):
+        if days_before < 0:
+            raise ValueError(f"days_before must be non-negative, got {days_before}")
+        self.days_before = days_before
+    
+    def roll_date(
+        self,
+        current: pd.DataFrame,
+        following: pd.DataFrame,
+        expiry: Optional[pd.Timestamp],
+        days: pd.DatetimeIndex
+    ) -> Optional[pd.Timestamp]:
+        if expiry is None or expiry > days[-1]:
+            return None
+        target = days[max(int(days.searchsorted(expiry, side="right")) - 1 - self.days_before, 0)]
+        eligible = current.index[current.index <= target]
+        # 换月日已经过去时（如上一次换月较晚）尽早换月
+        return eligible[-1] if len(eligible) else current.index[0]
+
+
+@dataclass
+class ContinuousSeries:
+    """
+    拼接的连续合约 / Stitched continuous contract
+    
+    Attributes:
+        code: 连续合约代码 / Continuous contract code
+        frame: 复权后的数据 / Back-adjusted data
+        contracts: 每个交易日使用的月份合约 / Delivery month used on each day
+        rolls: 按时间排列的换月 / Rolls in time order
+        adjust: 复权方式 / Back-adjustment method
+    """
+    code: str
+    frame: FeatureFrame
+    contracts: pd.Series
+    rolls: List[RollEvent]
+    adjust: AdjustMethod
+    
+    def schedule(self) -> pd.DataFrame:
+        """
+        换月计划 / Roll schedule
+        
+        Returns:
+            pd.DataFrame: 以换月日为索引，列为from_contract、to_contract、from_price、to_price、gap和ratio /
+                Indexed by roll day with from_contract, to_contract, from_price, to_price, gap and ratio
+        """
+        columns = ["from_contract", "to_contract", "from_price", "to_price", "gap", "ratio"]
+        rows = [
+            [r.from_contract, r.to_contract, r.from_price, r.to_price, r.gap, r.ratio]
+            for r in self.rolls
+        ]
+        return pd.DataFrame(rows, index=pd.DatetimeIndex([r.time for r in self.rolls], name="time"), columns=columns)
+    
+    def roll_on(self, time) -> Optional[RollEvent]:
+        """
+        某个交易日的换月 / The roll on a trading day
+        
+        Args:
+            time: 交易日 / Trading day
+        
+        Returns:
+            Optional[RollEvent]: 当日的换月，不换月时为None / The day's roll; None when there is none
+        """
+        time = pd.Timestamp(time)
+        return next((r for r in self.rolls if r.time == time), None)
+
+
+def stitch(
+    code: str,
+    contracts: Mapping[str, pd.DataFrame],
+    rule: RollRule,
+    adjust: AdjustMethod = AdjustMethod.RATIO,
+    calendar: Optional[TradingCalendar] = None
+) -> ContinuousSeries:
+    """
+    由各月份合约拼接连续合约 / Stitch a continuous contract from the delivery months
+    
+    合约按最后交易日排序，从数据中最早的合约开始，每次只换到排序中的下一个合约。
+    只有两个合约都有收盘价的交易日可以换月；当前合约的数据在区间结束前中断时，
+    规则没有给出换月日也会在最后一个可换月的交易日换月。
+    Contracts are ordered by last trading day; the series starts on the
+    earliest and only ever rolls to the next one in that order. Only days
+    where both contracts have a close can be roll days, and when the current
+    contract's data stops before the range does, the roll happens on the last
+    such day even if the rule picked none.
+    
+    Args:
+        code: 连续合约代码 / Continuous contract code
+        contracts: 月份合约代码到数据的映射，需要$close和规则使用的字段 /
+            Delivery month code to data, with $close and the fields the rule reads
+        rule: 换月规则 / Roll rule
+        adjust: 复权方式 / Back-adjustment method
+        calendar: 计算最后交易日时顺延节假日的交易日历 / Calendar moving expiries past holidays
+    
+    Returns:
+        ContinuousSeries: 连续合约 / The continuous contract
+    
+    Raises:
+        DataError: 缺少字段或两个相邻合约没有共同交易日而无法换月时抛出 /
+            Raised when a field is missing or two adjacent contracts share no day to roll on
+    """
+    adjust = AdjustMethod(adjust)
+    frames = {c: f.sort_index() for c, f in contracts.items() if len(f)}
+    for contract, frame in frames.items():
+        missing = [f for f in (CLOSE_FIELD,) + tuple(rule.fields) if f not in frame.columns]
+        if missing:
+            raise _stitch_error(code, f"contract {contract} is missing fields {missing}")
+    if not frames:
+        return ContinuousSeries(code, FeatureFrame(), pd.Series(dtype=object, name="contract"), [], adjust)
+    
+    def order(contract: str) -> Tuple[pd.Timestamp, str]:
+        return contract_expiry(contract, calendar) or frames[contract].index[-1], contract
+    
+    ordered = sorted(frames, key=order)
+    days = frames[ordered[0]].index
+    for frame in list(frames.values())[1:]:
+        days = days.union(frame.index)
+    
+    pieces: List[pd.DataFrame] = []
+    labels: List[pd.Series] = []
+    rolls: List[RollEvent] = []
+    active, after = ordered[0], None
+    for following in ordered[1:]:
+        current, nxt = frames[active], frames[following]
+        if after is not None:
+            current, nxt = current[current.index > after], nxt[nxt.index > after]
+        common = current.index.intersection(nxt.index)
+        both = current.loc[common, CLOSE_FIELD].notna() & nxt.loc[common, CLOSE_FIELD].notna()
+        common = common[both.to_numpy()]
+        day = None
+        if len(common):
+            day = rule.roll_date(current.loc[common], nxt.loc[common], contract_expiry(active, calendar), days)
+        if day is None:
+            if frames[active].index[-1] >= days[-1]:
+                break
+            if not len(common):
+                raise _stitch_error(code, f"contracts {active} and {following} share no day to roll on")
+            day = common[-1]
+        rolls.append(RollEvent(
+            time=day,
+            from_contract=active,
+            to_contract=following,
+            from_price=float(current.at[day, CLOSE_FIELD]),
+            to_price=float(nxt.at[day, CLOSE_FIELD])
+        ))
+        piece = current[current.index <= day]
+        pieces.append(piece)
+        labels.append(pd.Series(active, index=piece.index))
+        active, after = following, day
+    
+    last = frames[active] if after is None else frames[active][frames[active].index > after]
+    pieces.append(last)
+    labels.append(pd.Series(active, index=last.index))
+    
+    stitched = pd.concat(pieces)
+    if adjust is not AdjustMethod.NONE:
+        prices = [f for f in PRICE_FIELDS if f in stitched.columns]
+        values = stitched[prices].to_numpy(dtype=float, copy=True)
+        for roll in rolls:
+            earlier = stitched.index <= roll.time
+            if adjust is AdjustMethod.DIFFERENCE:
+                values[earlier] += roll.gap
+            else:
+                values[earlier] *= roll.ratio
+        stitched[prices] = values
+    stitched.attrs["instrument"] = code
+    return ContinuousSeries(
+        code=code,
+        frame=FeatureFrame(stitched),
+        contracts=pd.concat(labels).rename("contract"),
+        rolls=rolls,
+        adjust=adjust
+    )
+
+
+class ContinuousFuturesProvider(DataProvider):
+    """
+    支持连续合约的数据提供者 / Data provider serving continuous contracts
+    
+    包装任意数据提供者：连续合约代码（如"IF.CFE"）按换月规则由底层提供者中的月份合约
+    拼接，其余代码直接交给底层提供者
+    Wraps any data provider: continuous codes such as "IF.CFE" are stitched
+    from the delivery months in the wrapped provider on the roll rule, and
+    every other code goes straight to the wrapped provider
+    """
+    
+    def __init__(
+        self,
+        provider: DataProvider,
+        rule: Optional[RollRule] = None,
+        adjust: AdjustMethod = AdjustMethod.RATIO,
+        contracts: Optional[Mapping[str, Iterable[str]]] = None,
+        calendar: Optional[TradingCalendar] = None
+    ):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            provider: 提供月份合约数据的提供者 / Provider serving the delivery months
+            rule: 换月规则，None表示成交量反超换月 / Roll rule; None rolls on volume crossover
+            adjust: 复权方式 / Back-adjustment method
+            contracts: 连续合约代码到月份合约的映射，None表示从provider.list_instruments()中查找 /
+                Continuous code to its delivery months; None looks them up in provider.list_instruments()
+            calendar: 计算最后交易日时顺延节假日的交易日历 / Calendar moving expiries past holidays
+        """
+        self._provider = provider
+        self._rule = rule or VolumeRoll()
+        self._adjust = AdjustMethod(adjust)
+        self._contracts = {code: list(codes) for code, codes in (contracts or {}).items()}
+        self._calendar = calendar
+        self.name = f"futures({provider.name})"
+        self.adjusted_prices = provider.adjusted_prices
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        return self._provider.freqs
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        if not is_continuous(instrument):
+            return self._provider.load_features(instrument, fields, start_time, end_time, freq)
+        series = self.continuous(instrument, start_time, end_time, freq, fields)
+        return series.frame[list(fields)]
+    
+    def continuous(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day",
+        fields: Optional[List[str]] = None
+    ) -> ContinuousSeries:
+        """
+        拼接连续合约 / Stitch a continuous contract
+        
+        换月只在查询区间内判断，不同区间的复权基准可能不同
+        Rolls are decided within the queried range only, so different ranges
+        can have different adjustment bases
+        
+        Args:
+            instrument: 连续合约代码 / Continuous contract code
+            start_time: 开始时间（包含） / Start time (inclusive)
+            end_time: 结束时间（包含） / End time (inclusive)
+            freq: 数据频率 / Data frequency
+            fields: 需要的字段，None表示只取$close / Fields wanted; None for $close only
+        
+        Returns:
+            ContinuousSeries: 连续合约 / The continuous contract
+        
+        Raises:
+            ValueError: 不是连续合约代码时抛出 / Raised for a code that isn't a continuous contract
+            InstrumentNotFoundError: 找不到任何月份合约时抛出 / Raised when no delivery month is found
+            DataError: 加载或拼接失败时抛出 / Raised when loading or stitching fails
+        """
+        if not is_continuous(instrument):
+            raise ValueError(f"{instrument!r} is not a continuous futures code such as 'IF.CFE'")
+        wanted = list(dict.fromkeys(list(fields or []) + [CLOSE_FIELD] + list(self._rule.fields)))
+        codes = self._contracts_of(instrument, freq)
+        frames = {}
+        for code in codes:
+            try:
+                frames[code] = self._provider.load_features(code, wanted, start_time, end_time, freq)
+            except InstrumentNotFoundError:
+                continue
+        if not frames:
+            raise InstrumentNotFoundError(instrument, self.name, f"no delivery months among {codes}")
+        return stitch(instrument, frames, self._rule, self._adjust, self._calendar)
+    
+    def roll_schedule(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        连续合约在区间内的换月计划 / Roll schedule of a continuous contract over a range
+        
+        回测可以据此在换月日模拟平旧开新的交易成本
+        Backtests can use it to model the close-old, open-new trade cost on roll days
+        
+        Returns:
+            pd.DataFrame: 见ContinuousSeries.schedule() / See ContinuousSeries.schedule()
+        """
+        return self.continuous(instrument, start_time, end_time, freq).schedule()
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        return self._provider.calendar(start_time, end_time, freq)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        codes = self._provider.list_instruments(market, freq)
+        continuous = {
+            spec.continuous_code for spec in (get_futures_spec(code) for code in codes) if spec is not None
+        }
+        return sorted(set(codes) | continuous | set(self._contracts))
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        if not is_continuous(instrument):
+            return self._provider.list_fields(instrument, freq)
+        codes = self._contracts_of(instrument, freq)
+        if not codes:
+            raise InstrumentNotFoundError(instrument, self.name)
+        return self._provider.list_fields(codes[-1], freq)
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        self._provider.healthcheck(ctx)
+    
+    def close(self) -> None:
+        self._provider.close()
+    
+    def _contracts_of(self, instrument: str, freq: str) -> List[str]:
+        """连续合约的月份合约 / Delivery months of a continuous contract"""
+        if instrument in self._contracts:
+            return self._contracts[instrument]
+        spec = get_futures_spec(instrument)
+        pattern = re.compile(rf"^{spec.root}\d{{4}}\.{spec.exchange}$")
+        return sorted(code for code in self._provider.list_instruments(ALL_MARKET, freq) if pattern.match(code))
+
+
+def _stitch_error(code: str, message: str) -> DataError:
+    """构造连续合约拼接失败的错误 / Build the error for a continuous contract that can't be stitched"""
+    error_info = ErrorInfo(
+        error_code="DAT0033",
+        error_message_zh=f"无法拼接连续合约{code}: {message}",
+        error_message_en=f"Cannot stitch continuous contract {code}: {message}",
+        category=ErrorCategory.DATA,
+        severity=ErrorSeverity.MEDIUM,
+        technical_details=message,
+        suggested_actions=[
+            "确认各月份合约的数据包含$close和换月规则需要的字段",
+            "确认相邻月份合约有重叠的交易日"
+        ],
+        recoverable=True
+    )
+    return DataError(error_info)
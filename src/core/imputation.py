@@ -0,0 +1,316 @@
+"""
+缺失值填充模块 / Missing-Value Imputation Module
+填充特征数据中的缺失值，避免一个缺口通过表达式传播到所有下游因子
+Fills missing values in feature frames so that one gap doesn't propagate
+NaN through every downstream expression
+
+支持的方法：ffill用之前最近的值，bfill用之后最近的值（回测中会引入未来数据），constant用
+固定值，interpolate在同一交易日内按时间线性插值（只用于日内数据），cs_median用同一时间戳
+所有标的的中位数（只用于多标的结果）。截面中位数只取该时间戳本身的值，不会用到之后的数据。
+Supported methods: ffill takes the nearest earlier value, bfill the nearest
+later one (which leaks future data into a backtest), constant a fixed value,
+interpolate interpolates linearly in time within one trading day (intraday
+data only) and cs_median takes the median of every instrument at the same
+timestamp (multi-instrument results only). A cross-sectional median only
+uses values of that very timestamp, never a later one.
+
+max_gap限制可以填充的缺口：连续超过max_gap个缺失值的缺口整段保留为NaN，而不是只填充
+前max_gap个。每次填充返回FillReport，记录每列填充的数量，用于拒绝需要过多填充的数据。
+max_gap bounds the gaps that get filled: a run of more than max_gap missing
+values stays NaN as a whole rather than having its first max_gap values
+filled. Every fill returns a FillReport with the number of values filled
+per column, so frames that needed too much imputation can be rejected.
+
+Examples:
+    >>> filled, report = result["SH600000"].fill_missing("ffill", max_gap=2)
+    >>> report.exceeds(0.05)
+    []
+    >>> filled, reports = result.fill_missing("cs_median", max_fraction=0.1)
+"""
+
+from dataclasses import dataclass, field
+from enum import Enum
+from typing import Dict, List, Mapping, Optional, Sequence, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..utils.error_handler import DataError, ErrorInfo, ErrorCategory, ErrorSeverity
+
+
+class ImputeMethod(Enum):
+    """缺失值填充方法 / Missing-value fill method"""
+    FORWARD_FILL = "ffill"  # 用之前最近的值填充
+    BACKWARD_FILL = "bfill"  # 用之后最近的值填充，回测中会引入未来数据
+    CONSTANT = "constant"  # 用固定值填充
+    INTERPOLATE = "interpolate"  # 同一交易日内按时间线性插值，只用于日内数据
+    CS_MEDIAN = "cs_median"  # 同一时间戳所有标的的中位数，只用于多标的结果
+
+
+ImputeMethodLike = Union[str, ImputeMethod]
+
+
+@dataclass
+class FillReport:
+    """
+    缺失值填充报告 / Missing-value fill report
+    
+    Attributes:
+        method: 填充方法 / Fill method
+        rows: 数据的行数 / Number of rows of the frame
+        filled: 每列填充的值的数量，包括没有填充的列 / Values filled per column, unfilled columns included
+        remaining: 每列填充后仍然缺失的值的数量 / Values per column still missing after the fill
+    """
+    method: ImputeMethod
+    rows: int
+    filled: Dict[str, int] = field(default_factory=dict)
+    remaining: Dict[str, int] = field(default_factory=dict)
+    
+    @property
+    def total(self) -> int:
+        """填充的值的总数 / Total number of values filled"""
+        return sum(self.filled.values())
+    
+    def fraction(self, column: str) -> float:
+        """
+        某列被填充的值占行数的比例 / Share of a column's rows that were filled
+        
+        Args:
+            column: 列名 / Column name
+        
+        Returns:
+            float: 填充比例，没有行时为0 / Share filled, 0 without rows
+        """
+        return self.filled.get(column, 0) / self.rows if self.rows else 0.0
+    
+    @property
+    def max_fraction(self) -> float:
+        """所有列中最高的填充比例 / Highest share filled over all columns"""
+        return max((self.fraction(column) for column in self.filled), default=0.0)
+    
+    def exceeds(self, max_fraction: float) -> List[str]:
+        """
+        填充比例超过阈值的列 / Columns whose filled share is over a threshold
+        
+        Args:
+            max_fraction: 允许的最高填充比例，范围[0, 1] / Highest share allowed, in [0, 1]
+        
+        Returns:
+            List[str]: 超过阈值的列 / Columns over the threshold
+        """
+        return [column for column in self.filled if self.fraction(column) > max_fraction]
+    
+    def to_dict(self) -> Dict[str, object]:
+        """转换为可序列化的字典 / Convert to a serializable dict"""
+        return {
+            "method": self.method.value,
+            "rows": self.rows,
+            "filled": dict(self.filled),
+            "remaining": dict(self.remaining),
+        }
+    
+    def __str__(self) -> str:
+        filled = ", ".join(f"{column}={n}" for column, n in self.filled.items() if n)
+        return f"{self.method.value}: {filled or '-'} / {self.rows} rows"
+
+
+class ExcessiveImputationError(DataError):
+    """
+    填充过多错误 / Excessive imputation error
+    
+    某列被填充的比例超过max_fraction时抛出，或在FeatureResult.errors中记录；report为填充报告
+    Raised, or recorded in FeatureResult.errors, when the filled share of a
+    column is over max_fraction; report holds the fill report
+    """
+    
+    def __init__(self, instrument: Optional[str], report: FillReport, max_fraction: float):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            report: 填充报告 / Fill report
+            max_fraction: 允许的最高填充比例 / Highest share allowed
+        """
+        self.instrument = instrument
+        self.report = report
+        self.max_fraction = max_fraction
+        columns = ", ".join(report.exceeds(max_fraction))
+        name = instrument or "-"
+        error_info = ErrorInfo(
+            error_code="DAT0039",
+            error_message_zh=f"标的数据填充的缺失值过多: {name} ({columns})",
+            error_message_en=f"Too many missing values filled for instrument: {name} ({columns})",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"{report}; max_fraction={max_fraction:g}",
+            suggested_actions=[
+                "检查数据源中对应字段的缺失情况",
+                "缩短时间范围或提高max_fraction"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def fill_frame(
+    frame: pd.DataFrame,
+    method: ImputeMethodLike,
+    value: Optional[float] = None,
+    max_gap: Optional[int] = None,
+    columns: Optional[Sequence[str]] = None,
+    inplace: bool = False
+) -> Tuple[pd.DataFrame, FillReport]:
+    """
+    填充单标的数据的缺失值 / Fill the missing values of a per-instrument frame
+    
+    Args:
+        frame: 以时间为索引、按时间排序的数据 / Time-indexed frame in time order
+        method: "ffill"、"bfill"、"constant"或"interpolate" / "ffill", "bfill", "constant" or "interpolate"
+        value: constant使用的值 / Value used by constant
+        max_gap: 可以填充的最长连续缺失值个数，None表示不限 / Longest run of missing values filled, None for any
+        columns: 要填充的列，默认为所有数值列 / Columns to fill, every numeric column by default
+        inplace: 是否直接修改frame / Whether to modify frame itself
+    
+    Returns:
+        Tuple[pd.DataFrame, FillReport]: (填充后的数据，inplace时为frame本身, 填充报告) /
+            (filled frame, frame itself when inplace, fill report)
+    
+    Raises:
+        ValueError: 方法或参数无效，或对日线数据插值时抛出 /
+            Raised for an invalid method or argument, or when interpolating daily data
+    """
+    kind = _to_method(method, value, max_gap)
+    if kind == ImputeMethod.CS_MEDIAN:
+        raise ValueError("cs_median needs the whole universe; use FeatureResult.fill_missing() instead")
+    if kind == ImputeMethod.INTERPOLATE:
+        index = pd.DatetimeIndex(frame.index)
+        if len(index) and (index == index.normalize()).all():
+            raise ValueError("interpolate is only supported for intraday frames; use ffill for daily data")
+    names = _fill_columns(frame, columns)
+    filled = {name: _fill_series(frame[name], kind, value) for name in names}
+    return _apply(frame, filled, kind, max_gap, inplace)
+
+
+def fill_results(
+    frames: Mapping[str, pd.DataFrame],
+    method: ImputeMethodLike,
+    value: Optional[float] = None,
+    max_gap: Optional[int] = None,
+    columns: Optional[Sequence[str]] = None,
+    inplace: bool = False
+) -> Tuple[Dict[str, pd.DataFrame], Dict[str, FillReport]]:
+    """
+    填充多标的数据的缺失值 / Fill the missing values of multi-instrument frames
+    
+    cs_median用同一时间戳有值的标的的中位数填充，时间戳按精确匹配，没有其他标的有值的时间戳
+    保留为NaN；其余方法逐个标的调用fill_frame()
+    cs_median fills with the median over the instruments that have a value
+    at the same timestamp, matched exactly, and leaves NaN where no other
+    instrument has one; every other method calls fill_frame() per instrument
+    
+    Args:
+        frames: 标的代码到以时间为索引的数据 / Instrument code to time-indexed frame
+        method: 填充方法 / Fill method
+        value: constant使用的值 / Value used by constant
+        max_gap: 可以填充的最长连续缺失值个数 / Longest run of missing values filled
+        columns: 要填充的列，默认为每个数据的所有数值列 / Columns to fill, every numeric column of each frame by default
+        inplace: 是否直接修改每个数据 / Whether to modify each frame itself
+    
+    Returns:
+        Tuple[Dict[str, pd.DataFrame], Dict[str, FillReport]]: (填充后的数据, 每个标的的填充报告) /
+            (filled frames, fill report of each instrument)
+    
+    Raises:
+        ValueError: 方法或参数无效时抛出 / Raised for an invalid method or argument
+    """
+    kind = _to_method(method, value, max_gap)
+    if kind != ImputeMethod.CS_MEDIAN:
+        results = {code: fill_frame(frame, kind, value, max_gap, columns, inplace) for code, frame in frames.items()}
+        return {code: r[0] for code, r in results.items()}, {code: r[1] for code, r in results.items()}
+    
+    names = {code: _fill_columns(frame, columns) for code, frame in frames.items()}
+    medians: Dict[str, pd.Series] = {}
+    for name in dict.fromkeys(n for cols in names.values() for n in cols):
+        # 每行只取同一时间戳的值，不会用到之后的数据
+        wide = pd.concat(
+            {code: frame[name] for code, frame in frames.items() if name in names[code]}, axis=1
+        )
+        medians[name] = wide.median(axis=1, skipna=True)
+    
+    filled_frames: Dict[str, pd.DataFrame] = {}
+    reports: Dict[str, FillReport] = {}
+    for code, frame in frames.items():
+        filled = {
+            name: frame[name].fillna(medians[name].reindex(frame.index))
+            for name in names[code]
+        }
+        filled_frames[code], reports[code] = _apply(frame, filled, kind, max_gap, inplace)
+    return filled_frames, reports
+
+
+def _to_method(method: ImputeMethodLike, value: Optional[float], max_gap: Optional[int]) -> ImputeMethod:
+    """校验并转换填充方法 / Validate and convert a fill method"""
+    try:
+        kind = ImputeMethod(method)
+    except ValueError:
+        choices = tuple(m.value for m in ImputeMethod)
+        raise ValueError(f"method must be one of {choices}, got {method!r}") from None
+    if kind == ImputeMethod.CONSTANT and value is None:
+        raise ValueError("constant fill needs a value")
+    if max_gap is not None and max_gap < 1:
+        raise ValueError(f"max_gap must be positive, got {max_gap}")
+    return kind
+
+
+def _fill_columns(frame: pd.DataFrame, columns: Optional[Sequence[str]]) -> List[str]:
+    """要填充的列 / Columns to fill"""
+    if columns is None:
+        return [name for name in frame.columns if pd.api.types.is_numeric_dtype(frame[name])]
+    missing = [name for name in columns if name not in frame.columns]
+    if missing:
+        raise ValueError(f"columns not in frame: {missing}")
+    return list(columns)
+
+
+def _fill_series(series: pd.Series, kind: ImputeMethod, value: Optional[float]) -> pd.Series:
+    """不考虑max_gap填充一列 / Fill one column ignoring max_gap"""
+    if kind == ImputeMethod.FORWARD_FILL:
+        return series.ffill()
+    if kind == ImputeMethod.BACKWARD_FILL:
+        return series.bfill()
+    if kind == ImputeMethod.CONSTANT:
+        return series.fillna(value)
+    # 按交易日分组插值，不跨隔夜插值
+    index = pd.DatetimeIndex(series.index)
+    days = index.tz_localize(None).normalize() if index.tz is not None else index.normalize()
+    return series.groupby(np.asarray(days)).transform(
+        lambda day: day.interpolate(method="time", limit_area="inside")
+    )
+
+
+def _apply(
+    frame: pd.DataFrame,
+    filled: Dict[str, pd.Series],
+    kind: ImputeMethod,
+    max_gap: Optional[int],
+    inplace: bool
+) -> Tuple[pd.DataFrame, FillReport]:
+    """按max_gap取舍填充值，写入数据并生成报告 / Apply max_gap, write the fills and build the report"""
+    report = FillReport(kind, len(frame))
+    target = frame if inplace else frame.copy()
+    for name, values in filled.items():
+        missing = frame[name].isna()
+        if max_gap is not None:
+            values = values.where(~missing | (_run_lengths(missing) <= max_gap))
+        report.filled[name] = int((missing & values.notna()).sum())
+        report.remaining[name] = int(values.isna().sum())
+        if report.filled[name]:
+            target[name] = values
+    return target, report
+
+
+def _run_lengths(missing: pd.Series) -> pd.Series:
+    """每个缺失值所在的连续缺失段的长度，非缺失值为0 / Length of the run of missing values each one sits in, 0 elsewhere"""
+    runs = (~missing).cumsum()
+    return missing.groupby(runs).transform("sum").where(missing, 0)
@@ -0,0 +1,589 @@
+"""
+技术指标模块 / Technical Indicators Module
+在特征数据的列上计算SMA、EMA、WMA、RSI、MACD、ATR、KDJ和布林带
+Computes SMA, EMA, WMA, RSI, MACD, ATR, KDJ and Bollinger Bands over feature columns
+
+所有函数接受数值序列（如FeatureFrame.column()返回的数值列表、column_array()
+返回的不复制的数组、numpy数组或pd.Series），返回与输入等长的列表。预热期（数据不足一个窗口）的值为NaN，
+各函数的文档注明了预热期长度。SMA、WMA和布林带中包含NaN的窗口结果为NaN；
+EMA、RSI、ATR和KDJ等递推指标在输入为NaN的位置输出NaN，并跳过该值继续递推。
+Every function takes a numeric sequence (such as the values list returned by
+FeatureFrame.column(), the uncopied array from column_array(), a numpy array
+or a pd.Series) and returns lists as long as the input. Values in the warm-up period (less than one window of
+data) are NaN, with the lead-in length documented per function. For SMA, WMA
+and Bollinger Bands any window holding a NaN is NaN; recursive indicators
+such as EMA, RSI, ATR and KDJ output NaN where the input is NaN and skip it in
+the recursion.
+
+apply()在线程池或进程池中对多个标的并行计算同一个指标。
+apply() computes one indicator over many instruments in parallel on a
+thread or process pool.
+
+Examples:
+    >>> values, times = frame.column("$close")
+    >>> sma20 = sma(values, 20)
+    >>> macd_line, signal_line, histogram = macd(values)
+    >>> signals = apply(result, partial(macd, fast=12, slow=26), processes=True)
+"""
+
+import os
+from concurrent.futures import ProcessPoolExecutor, ThreadPoolExecutor
+from typing import Any, Callable, Dict, List, Mapping, NamedTuple, Optional, Sequence, Type, TypeVar
+
+import numpy as np
+import pandas as pd
+from numpy.lib.stride_tricks import sliding_window_view
+
+from ..utils.error_handler import DataError, ErrorInfo, ErrorCategory, ErrorSeverity
+
+
+T = TypeVar("T")
+
+
+class MACDResult(NamedTuple):
+    """MACD指标 / MACD indicator"""
+    macd: List[float]  # 快线EMA - 慢线EMA / fast EMA - slow EMA
+    signal: List[float]  # MACD的EMA / EMA of the MACD line
+    histogram: List[float]  # MACD - 信号线 / MACD - signal
+
+
+class KDJResult(NamedTuple):
+    """KDJ随机指标 / KDJ stochastic oscillator"""
+    k: List[float]  # RSV的平滑 / Smoothed RSV
+    d: List[float]  # K的平滑 / Smoothed K
+    j: List[float]  # 3K - 2D
+
+
+class BollingerBands(NamedTuple):
+    """布林带 / Bollinger Bands"""
+    middle: List[float]  # 移动平均 / Moving average
+    upper: List[float]  # 均值 + k倍标准差 / Mean + k standard deviations
+    lower: List[float]  # 均值 - k倍标准差 / Mean - k standard deviations
+
+
+def _as_array(series: Sequence[float]) -> np.ndarray:
+    """转换为一维浮点数组 / Convert to a 1-D float array"""
+    values = np.asarray(series, dtype=float)
+    if values.ndim != 1:
+        raise ValueError(f"series must be one-dimensional, got shape {values.shape}")
+    return values
+
+
+def _as_arrays(*series: Sequence[float]) -> List[np.ndarray]:
+    """转换为等长的一维浮点数组 / Convert to 1-D float arrays of equal length"""
+    arrays = [_as_array(s) for s in series]
+    if len({len(a) for a in arrays}) > 1:
+        raise ValueError(f"series must have equal lengths, got {[len(a) for a in arrays]}")
+    return arrays
+
+
+def _check_window(window: int, name: str = "window") -> None:
+    """窗口必须是正整数 / A window must be a positive integer"""
+    if isinstance(window, bool) or not isinstance(window, (int, np.integer)):
+        raise TypeError(f"{name} must be an integer, got {type(window).__name__}")
+    if window < 1:
+        raise ValueError(f"{name} must be positive, got {window}")
+
+
+def _rolling(values: np.ndarray, window: int, reducer) -> np.ndarray:
+    """对每个完整窗口调用reducer，前window-1个值为NaN / Reduce every full window; the first window-1 are NaN"""
+    out = np.full(len(values), np.nan)
+    if window <= len(values):
+        out[window - 1:] = reducer(sliding_window_view(values, window), axis=1)
+    return out
+
+
+def _first_full_window(valid: np.ndarray, window: int):
+    """第一段连续window个有效值的结束位置，没有时返回None / End of the first run of window valid values, or None"""
+    run = 0
+    for i, ok in enumerate(valid):
+        run = run + 1 if ok else 0
+        if run == window:
+            return i
+    return None
+
+
+def _ema(values: np.ndarray, window: int) -> np.ndarray:
+    """
+    指数移动平均的核心实现 / Core exponential moving average
+    
+    以第一个完整窗口的简单平均为初值，此后按ema += alpha * (x - ema)递推；
+    递推形式不会累积alpha的幂，长序列也保持数值稳定。初值之前的NaN被跳过，
+    之后遇到NaN时输出NaN并保持状态不变。
+    Seeded with the simple average of the first full window of valid values,
+    then updated as ema += alpha * (x - ema); the update never accumulates
+    powers of alpha, so it stays stable over long series. NaNs before the seed
+    are skipped; later NaNs output NaN and leave the state unchanged.
+    """
+    out = np.full(len(values), np.nan)
+    seed_end = _first_full_window(~np.isnan(values), window)
+    if seed_end is None:
+        return out
+    
+    alpha = 2.0 / (window + 1)
+    state = float(np.mean(values[seed_end - window + 1:seed_end + 1]))
+    out[seed_end] = state
+    for i in range(seed_end + 1, len(values)):
+        x = values[i]
+        if np.isnan(x):
+            continue
+        state += alpha * (x - state)
+        out[i] = state
+    return out
+
+
+def _wilder(values: np.ndarray, window: int) -> np.ndarray:
+    """
+    Wilder平滑 / Wilder smoothing
+    
+    以第一个完整窗口的简单平均为初值，此后按avg = (avg * (window - 1) + x) / window
+    递推；NaN的处理与_ema相同
+    Seeded with the simple average of the first full window of valid values,
+    then avg = (avg * (window - 1) + x) / window; NaNs are handled as in _ema
+    """
+    out = np.full(len(values), np.nan)
+    seed_end = _first_full_window(~np.isnan(values), window)
+    if seed_end is None:
+        return out
+    
+    state = float(np.mean(values[seed_end - window + 1:seed_end + 1]))
+    out[seed_end] = state
+    for i in range(seed_end + 1, len(values)):
+        x = values[i]
+        if np.isnan(x):
+            continue
+        state = (state * (window - 1) + x) / window
+        out[i] = state
+    return out
+
+
+def sma(series: Sequence[float], window: int) -> List[float]:
+    """
+    简单移动平均 / Simple moving average
+    
+    Args:
+        series: 数值序列 / Numeric series
+        window: 窗口长度 / Window length
+    
+    Returns:
+        List[float]: 与输入等长，前window-1个值为NaN；窗口大于序列长度时全部为NaN /
+            As long as the input with window-1 leading NaNs; all NaN when the
+            window exceeds the series
+    
+    Raises:
+        ValueError: 窗口不是正数时抛出 / Raised for a non-positive window
+    """
+    _check_window(window)
+    return _rolling(_as_array(series), window, np.mean).tolist()
+
+
+def ema(series: Sequence[float], window: int) -> List[float]:
+    """
+    指数移动平均 / Exponential moving average
+    
+    平滑系数alpha = 2 / (window + 1)，以前window个值的简单平均为初值
+    Smoothing factor alpha = 2 / (window + 1), seeded with the simple average
+    of the first window values
+    
+    Args:
+        series: 数值序列 / Numeric series
+        window: 窗口长度 / Window length
+    
+    Returns:
+        List[float]: 与输入等长，前window-1个值为NaN / As long as the input with window-1 leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数时抛出 / Raised for a non-positive window
+    """
+    _check_window(window)
+    return _ema(_as_array(series), window).tolist()
+
+
+def wma(series: Sequence[float], window: int) -> List[float]:
+    """
+    线性加权移动平均 / Linearly weighted moving average
+    
+    窗口内最早的值权重为1，最新的值权重为window
+    The oldest value in the window has weight 1 and the newest weight window
+    
+    Args:
+        series: 数值序列 / Numeric series
+        window: 窗口长度 / Window length
+    
+    Returns:
+        List[float]: 与输入等长，前window-1个值为NaN / As long as the input with window-1 leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数时抛出 / Raised for a non-positive window
+    """
+    _check_window(window)
+    weights = np.arange(1, window + 1, dtype=float)
+    weights /= weights.sum()
+    return _rolling(_as_array(series), window, lambda windows, axis: windows @ weights).tolist()
+
+
+def rsi(series: Sequence[float], window: int = 14) -> List[float]:
+    """
+    相对强弱指数（Wilder平滑） / Relative strength index (Wilder smoothing)
+    
+    平均涨幅和平均跌幅以前window个价格变动的简单平均为初值，此后按
+    avg = (avg * (window - 1) + x) / window平滑。区间内只涨不跌时为100，
+    只跌不涨时为0，价格不变时为50。
+    Average gain and loss are seeded with the simple average of the first
+    window price changes and smoothed as avg = (avg * (window - 1) + x) / window
+    afterwards. The value is 100 with only gains, 0 with only losses and 50
+    when the price is flat.
+    
+    Args:
+        series: 价格序列 / Price series
+        window: 窗口长度，默认14 / Window length, default 14
+    
+    Returns:
+        List[float]: 0到100之间的值，与输入等长，前window个值为NaN /
+            Values in [0, 100] as long as the input, with window leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数时抛出 / Raised for a non-positive window
+    """
+    _check_window(window)
+    values = _as_array(series)
+    out = np.full(len(values), np.nan)
+    if len(values) <= window:
+        return out.tolist()
+    
+    changes = np.diff(values)
+    gains = np.where(changes > 0, changes, 0.0)
+    losses = np.where(changes < 0, -changes, 0.0)
+    seed_end = _first_full_window(~np.isnan(changes), window)
+    if seed_end is None:
+        return out.tolist()
+    
+    avg_gain = float(np.mean(gains[seed_end - window + 1:seed_end + 1]))
+    avg_loss = float(np.mean(losses[seed_end - window + 1:seed_end + 1]))
+    out[seed_end + 1] = _rsi_value(avg_gain, avg_loss)
+    for i in range(seed_end + 1, len(changes)):
+        if np.isnan(changes[i]):
+            continue
+        avg_gain = (avg_gain * (window - 1) + gains[i]) / window
+        avg_loss = (avg_loss * (window - 1) + losses[i]) / window
+        out[i + 1] = _rsi_value(avg_gain, avg_loss)
+    return out.tolist()
+
+
+def _rsi_value(avg_gain: float, avg_loss: float) -> float:
+    if avg_loss == 0:
+        return 50.0 if avg_gain == 0 else 100.0
+    return 100.0 - 100.0 / (1.0 + avg_gain / avg_loss)
+
+
+def macd(
+    series: Sequence[float],
+    fast: int = 12,
+    slow: int = 26,
+    signal: int = 9
+) -> MACDResult:
+    """
+    指数平滑异同移动平均线 / Moving average convergence divergence
+    
+    Args:
+        series: 价格序列 / Price series
+        fast: 快线EMA窗口，默认12 / Fast EMA window, default 12
+        slow: 慢线EMA窗口，默认26 / Slow EMA window, default 26
+        signal: 信号线EMA窗口，默认9 / Signal EMA window, default 9
+    
+    Returns:
+        MACDResult: (macd, signal, histogram)，均与输入等长；macd前slow-1个值为NaN，
+            signal和histogram前slow+signal-2个值为NaN / All as long as the input;
+            macd has slow-1 leading NaNs, signal and histogram slow+signal-2
+    
+    Raises:
+        ValueError: 窗口不是正数或fast不小于slow时抛出 /
+            Raised for a non-positive window or when fast is not below slow
+    """
+    _check_window(fast, "fast")
+    _check_window(slow, "slow")
+    _check_window(signal, "signal")
+    if fast >= slow:
+        raise ValueError(f"fast must be smaller than slow, got fast={fast}, slow={slow}")
+    
+    values = _as_array(series)
+    macd_line = _ema(values, fast) - _ema(values, slow)
+    signal_line = _ema(macd_line, signal)
+    return MACDResult(
+        macd=macd_line.tolist(),
+        signal=signal_line.tolist(),
+        histogram=(macd_line - signal_line).tolist()
+    )
+
+
+def atr(
+    high: Sequence[float],
+    low: Sequence[float],
+    close: Sequence[float],
+    window: int = 14
+) -> List[float]:
+    """
+    平均真实波幅（Wilder平滑） / Average true range (Wilder smoothing)
+    
+    真实波幅为max(最高 - 最低, |最高 - 前收|, |最低 - 前收|)，从第二根K线开始计算；
+    以前window个真实波幅的简单平均为初值，此后按Wilder方式平滑
+    The true range is max(high - low, |high - prior close|, |low - prior close|),
+    starting from the second bar; it is seeded with the simple average of the
+    first window true ranges and Wilder-smoothed afterwards
+    
+    Args:
+        high: 最高价序列 / High prices
+        low: 最低价序列 / Low prices
+        close: 收盘价序列 / Close prices
+        window: 窗口长度，默认14 / Window length, default 14
+    
+    Returns:
+        List[float]: 与输入等长，前window个值为NaN / As long as the input with window leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数或序列长度不同时抛出 /
+            Raised for a non-positive window or series of different lengths
+    """
+    _check_window(window)
+    highs, lows, closes = _as_arrays(high, low, close)
+    out = np.full(len(closes), np.nan)
+    if len(closes) <= window:
+        return out.tolist()
+    
+    prior = closes[:-1]
+    true_range = np.fmax(
+        highs[1:] - lows[1:],
+        np.fmax(np.abs(highs[1:] - prior), np.abs(lows[1:] - prior))
+    )
+    # fmax会忽略单个NaN，任一输入缺失时真实波幅应为NaN
+    missing = np.isnan(highs[1:]) | np.isnan(lows[1:]) | np.isnan(prior)
+    true_range[missing] = np.nan
+    out[1:] = _wilder(true_range, window)
+    return out.tolist()
+
+
+def kdj(
+    high: Sequence[float],
+    low: Sequence[float],
+    close: Sequence[float],
+    window: int = 9,
+    k_smooth: int = 3,
+    d_smooth: int = 3
+) -> KDJResult:
+    """
+    KDJ随机指标 / KDJ stochastic oscillator
+    
+    RSV = (收盘 - window内最低) / (window内最高 - window内最低) * 100；
+    K = ((k_smooth - 1) * 前K + RSV) / k_smooth，D = ((d_smooth - 1) * 前D + K) / d_smooth，
+    K和D的初值为50；J = 3K - 2D。窗口内最高等于最低时RSV没有定义，K和D保持不变。
+    RSV = (close - lowest low) / (highest high - lowest low) * 100 over the
+    window; K = ((k_smooth - 1) * prior K + RSV) / k_smooth and
+    D = ((d_smooth - 1) * prior D + K) / d_smooth, both starting from 50;
+    J = 3K - 2D. When the highest high equals the lowest low RSV is undefined
+    and K and D stay unchanged.
+    
+    Args:
+        high: 最高价序列 / High prices
+        low: 最低价序列 / Low prices
+        close: 收盘价序列 / Close prices
+        window: RSV窗口长度，默认9 / RSV window length, default 9
+        k_smooth: K的平滑期数，默认3 / K smoothing periods, default 3
+        d_smooth: D的平滑期数，默认3 / D smoothing periods, default 3
+    
+    Returns:
+        KDJResult: (k, d, j)，均与输入等长，前window-1个值为NaN /
+            All as long as the input with window-1 leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数或序列长度不同时抛出 /
+            Raised for a non-positive window or series of different lengths
+    """
+    _check_window(window)
+    _check_window(k_smooth, "k_smooth")
+    _check_window(d_smooth, "d_smooth")
+    highs, lows, closes = _as_arrays(high, low, close)
+    highest = _rolling(highs, window, np.max)
+    lowest = _rolling(lows, window, np.min)
+    
+    k_line = np.full(len(closes), np.nan)
+    d_line = np.full(len(closes), np.nan)
+    k_state = d_state = 50.0
+    for i in range(window - 1, len(closes)):
+        span = highest[i] - lowest[i]
+        if np.isnan(span) or np.isnan(closes[i]):
+            continue
+        if span > 0:
+            rsv = (closes[i] - lowest[i]) / span * 100.0
+            k_state = ((k_smooth - 1) * k_state + rsv) / k_smooth
+            d_state = ((d_smooth - 1) * d_state + k_state) / d_smooth
+        k_line[i] = k_state
+        d_line[i] = d_state
+    return KDJResult(k=k_line.tolist(), d=d_line.tolist(), j=(3 * k_line - 2 * d_line).tolist())
+
+
+def bollinger(series: Sequence[float], window: int = 20, k: float = 2.0) -> BollingerBands:
+    """
+    布林带 / Bollinger Bands
+    
+    中轨为简单移动平均，上下轨为中轨加减k倍总体标准差（ddof=0）
+    The middle band is the simple moving average; the upper and lower bands
+    add and subtract k population standard deviations (ddof=0)
+    
+    Args:
+        series: 价格序列 / Price series
+        window: 窗口长度，默认20 / Window length, default 20
+        k: 标准差倍数，默认2 / Number of standard deviations, default 2
+    
+    Returns:
+        BollingerBands: (middle, upper, lower)，均与输入等长，前window-1个值为NaN /
+            All as long as the input with window-1 leading NaNs
+    
+    Raises:
+        ValueError: 窗口不是正数或k为负数时抛出 / Raised for a non-positive window or a negative k
+    """
+    _check_window(window)
+    if k < 0:
+        raise ValueError(f"k must be non-negative, got {k}")
+    
+    values = _as_array(series)
+    middle = _rolling(values, window, np.mean)
+    deviation = _rolling(values, window, np.std)
+    return BollingerBands(
+        middle=middle.tolist(),
+        upper=(middle + k * deviation).tolist(),
+        lower=(middle - k * deviation).tolist()
+    )
+
+
+class IndicatorApplyError(DataError):
+    """
+    多标的指标计算错误 / Multi-instrument indicator error
+    
+    包装每个失败标的的错误，results中保留其余标的的结果；用of()按错误类型筛选标的
+    Wraps the per-instrument errors while results keeps the other instruments'
+    results; of() picks the instruments that failed with one error type
+    """
+    
+    def __init__(self, errors: Dict[str, Exception], results: Dict[str, Any]):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            errors: 标的代码到错误的映射 / Mapping of instrument code to error
+            results: 成功标的的结果 / Results of the instruments that succeeded
+        """
+        self.errors: Dict[str, Exception] = dict(errors)
+        self.results: Dict[str, Any] = dict(results)
+        failed = ", ".join(self.errors.keys())
+        error_info = ErrorInfo(
+            error_code="DAT0037",
+            error_message_zh=f"部分标的指标计算失败: {failed}",
+            error_message_en=f"Indicator failed for some instruments: {failed}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details="; ".join(
+                f"{code}: {error!r}" for code, error in self.errors.items()
+            ),
+            suggested_actions=[
+                "检查失败标的的数据长度和缺失值",
+                "成功标的的结果见results"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+    
+    def of(self, error_type: Type[Exception]) -> Dict[str, Exception]:
+        """
+        获取某种类型的错误 / Get the errors of one type
+        
+        Args:
+            error_type: 错误类型，子类同样匹配 / Error type, subclasses included
+        
+        Returns:
+            Dict[str, Exception]: 标的代码到该类型错误的映射 / Instrument code to the errors of that type
+        """
+        return {code: error for code, error in self.errors.items() if isinstance(error, error_type)}
+
+
+def _field_values(frame: Any, field: str) -> np.ndarray:
+    """取出一个标的的字段数组，调用方的数据不会被修改 / Pull one instrument's field array, read-only so the caller's data stays intact"""
+    if hasattr(frame, "column_array"):
+        # FeatureFrame和LazyFeatureFrame返回只读视图
+        return frame.column_array(field)[0]
+    values = _as_array(frame[field] if isinstance(frame, pd.DataFrame) else frame).view()
+    values.flags.writeable = False
+    return values
+
+
+def apply(
+    frames: Mapping[str, Any],
+    fn: Callable[[np.ndarray], T],
+    field: str = "$close",
+    max_workers: Optional[int] = None,
+    processes: bool = False
+) -> Dict[str, T]:
+    """
+    对多个标的并行计算同一个指标 / Compute one indicator over many instruments in parallel
+    
+    每个标的在工作池中单独调用fn(values)，values为该标的field列的只读数组；结果按frames的顺序
+    组装，与完成顺序无关。某个标的失败不影响其他标的，所有标的完成后统一抛出
+    IndicatorApplyError。
+    Each instrument runs fn(values) on its own in the worker pool, values being
+    a read-only array of its field column; results are assembled in the order
+    of frames whatever the completion order. A failure on one instrument does
+    not affect the others, and IndicatorApplyError is raised once all have
+    finished.
+    
+    线程池适合主要由numpy向量运算组成、计算时释放GIL的函数（如sma、bollinger）；EMA、MACD、
+    RSI等逐元素递推的函数受GIL限制，要按核数加速需使用processes=True，此时fn必须可以pickle
+    （模块级函数或functools.partial），数组会复制到子进程。
+    Threads suit functions made of numpy vector operations that release the
+    GIL (such as sma or bollinger); element-wise recursions such as EMA, MACD
+    and RSI are held back by the GIL and need processes=True to scale with the
+    core count, in which case fn must be picklable (a module-level function or
+    a functools.partial) and the arrays are copied to the workers.
+    
+    Args:
+        frames: 标的代码到FeatureFrame、LazyFeatureFrame、DataFrame或数值序列的映射，
+            如get_features()的结果 / Mapping of instrument code to a FeatureFrame,
+            LazyFeatureFrame, DataFrame or numeric sequence, such as a get_features() result
+        fn: 指标函数，如sma或partial(macd, fast=12) / Indicator function, e.g. sma or partial(macd, fast=12)
+        field: 传给fn的字段，frames的值为数值序列时忽略 / Field passed to fn, ignored for numeric sequences
+        max_workers: 并发数，None表示CPU核数 / Worker count, None for the CPU count
+        processes: 为True时使用进程池 / Use a process pool when True
+    
+    Returns:
+        Dict[str, T]: 标的代码到fn返回值的映射，顺序与frames一致 / Instrument code to fn's result, in the order of frames
+    
+    Raises:
+        ValueError: max_workers不是正数时抛出 / Raised for a non-positive max_workers
+        IndicatorApplyError: 有标的取数或计算失败时抛出，results为成功的标的 /
+            Raised when any instrument fails to load or compute; results holds the ones that succeeded
+    """
+    workers = max_workers or os.cpu_count() or 1
+    if workers < 1:
+        raise ValueError(f"max_workers must be positive, got {max_workers}")
+    
+    results: Dict[str, T] = {}
+    errors: Dict[str, Exception] = {}
+    series: Dict[str, np.ndarray] = {}
+    for code, frame in frames.items():
+        try:
+            series[code] = _field_values(frame, field)
+        except Exception as e:
+            errors[code] = e
+    
+    if series:
+        pool = ProcessPoolExecutor if processes else ThreadPoolExecutor
+        with pool(max_workers=min(len(series), workers)) as executor:
+            futures = {code: executor.submit(fn, values) for code, values in series.items()}
+            for code, future in futures.items():
+                try:
+                    results[code] = future.result()
+                except Exception as e:
+                    errors[code] = e
+    
+    if errors:
+        ordered = {code: errors[code] for code in frames if code in errors}
+        raise IndicatorApplyError(ordered, results)
+    return results
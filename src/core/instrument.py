@@ -0,0 +1,165 @@
+"""
+标的代码模块 / Instrument Code Module
+把常见的标的代码写法统一为内部使用的形式，如"000300.SH"、"sh.000300"都转换为"SH000300"
+Canonicalizes the common spellings of instrument codes into the internal
+form, so "000300.SH" and "sh.000300" both become "SH000300"
+
+内部形式为交易所前缀加代码，A股（SH、SZ、BJ）为6位数字，港股（HK）为5位数字。接受的写法
+（不区分大小写，首尾空白忽略）：
+- 前缀形式：SH600000、sh600000、SH.600000、sh:600000
+- 后缀形式：600000.SH、600000.SS（Yahoo）、000001.XSHE（聚宽），港股不足5位时补零，如0700.HK
+- 期货合约代码，如IF2503.CFE、IF.CFE（见core.futures），原样转为大写
+- 纯字母代码，如美股AAPL或汇率HKDCNY，原样转为大写
+The internal form is the exchange prefix and the symbol, six digits for
+A-shares (SH, SZ, BJ) and five for Hong Kong (HK). Accepted spellings,
+case-insensitive and with surrounding whitespace ignored:
+- prefixed: SH600000, sh600000, SH.600000, sh:600000
+- suffixed: 600000.SH, 600000.SS (Yahoo), 000001.XSHE (JoinQuant); Hong Kong
+  symbols shorter than five digits are zero-padded, as in 0700.HK
+- futures contract codes such as IF2503.CFE or IF.CFE (see core.futures),
+  upper-cased as they are
+- letter-only codes such as the US ticker AAPL or the FX pair HKDCNY,
+  upper-cased as they are
+
+Examples:
+    >>> normalize_instrument("000300.SH")
+    'SH000300'
+    >>> split_instrument("sh.600000")
+    ('SH', '600000')
+"""
+
+import re
+from typing import Dict, Tuple
+
+from ..utils.error_handler import DataError, ErrorInfo, ErrorCategory, ErrorSeverity
+from .futures import _CODE as _FUTURES_CODE
+
+
+# 交易所前缀及其代码位数 / Exchange prefixes and their symbol lengths
+MARKET_SYMBOL_DIGITS: Dict[str, int] = {"SH": 6, "SZ": 6, "BJ": 6, "HK": 5}
+
+# 后缀写法中的交易所名称 / Exchange names used by suffixed spellings
+_SUFFIXES: Dict[str, str] = {
+    "SH": "SH", "SS": "SH", "XSHG": "SH",
+    "SZ": "SZ", "XSHE": "SZ",
+    "BJ": "BJ",
+    "HK": "HK", "XHKG": "HK",
+}
+
+_PREFIXED = re.compile(r"^([A-Z]{2})[.:]?(\d+)$")
+_SUFFIXED = re.compile(r"^(\d+)\.([A-Z]+)$")
+_LETTERS = re.compile(r"^[A-Z]+$")
+
+
+class InstrumentCodeError(DataError):
+    """
+    标的代码格式错误 / Malformed instrument code
+    
+    code为原始代码，reason说明无法识别的原因
+    code is the code as given and reason says why it was not recognized
+    """
+    
+    def __init__(self, code: str, reason: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            code: 原始代码 / Code as given
+            reason: 无法识别的原因 / Why the code was not recognized
+        """
+        self.code = code
+        self.reason = reason
+        error_info = ErrorInfo(
+            error_code="DAT0038",
+            error_message_zh=f"无法识别的标的代码 {code!r}: {reason}",
+            error_message_en=f"Unrecognized instrument code {code!r}: {reason}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.LOW,
+            technical_details=f"code={code!r}",
+            suggested_actions=[
+                "使用SH600000、600000.SH或sh.600000等写法",
+                "港股代码为5位数字，如HK00700或00700.HK"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def normalize_instrument(code: str) -> str:
+    """
+    把标的代码统一为内部形式 / Canonicalize an instrument code into the internal form
+    
+    Args:
+        code: 标的代码，写法见模块说明 / Instrument code in any of the spellings in the module docs
+    
+    Returns:
+        str: 内部形式的代码，如"SH600000" / Code in the internal form, e.g. "SH600000"
+    
+    Raises:
+        InstrumentCodeError: 代码无法识别时抛出 / Raised when the code is not recognized
+    """
+    if not isinstance(code, str):
+        raise InstrumentCodeError(str(code), f"expected a string, got {type(code).__name__}")
+    text = code.strip().upper()
+    if not text:
+        raise InstrumentCodeError(code, "empty code")
+    
+    match = _PREFIXED.match(text)
+    if match is not None:
+        market, symbol = match.groups()
+        if market not in MARKET_SYMBOL_DIGITS:
+            expected = ", ".join(MARKET_SYMBOL_DIGITS)
+            raise InstrumentCodeError(code, f"unknown exchange prefix {market!r}, expected one of {expected}")
+        return market + _check_symbol(code, market, symbol)
+    
+    match = _SUFFIXED.match(text)
+    if match is not None:
+        symbol, suffix = match.groups()
+        market = _SUFFIXES.get(suffix)
+        if market is None:
+            expected = ", ".join(_SUFFIXES)
+            raise InstrumentCodeError(code, f"unknown exchange suffix {suffix!r}, expected one of {expected}")
+        return market + _check_symbol(code, market, symbol)
+    
+    if _FUTURES_CODE.match(text) or _LETTERS.match(text):
+        return text
+    raise InstrumentCodeError(code, "expected an exchange prefix or suffix such as SH600000 or 600000.SH")
+
+
+def split_instrument(code: str) -> Tuple[str, str]:
+    """
+    拆分为交易所和代码 / Split into the exchange and the symbol
+    
+    期货合约的交易所为后缀，如"IF2503.CFE"拆分为("CFE", "IF2503")；纯字母代码没有交易所，
+    返回("", 代码)
+    For futures contracts the exchange is the suffix, so "IF2503.CFE" splits
+    into ("CFE", "IF2503"); letter-only codes have no exchange and give
+    ("", code)
+    
+    Args:
+        code: 标的代码，任意接受的写法 / Instrument code in any accepted spelling
+    
+    Returns:
+        Tuple[str, str]: (交易所, 代码)，如("SH", "600000") / (exchange, symbol), e.g. ("SH", "600000")
+    
+    Raises:
+        InstrumentCodeError: 代码无法识别时抛出 / Raised when the code is not recognized
+    """
+    canonical = normalize_instrument(code)
+    futures = _FUTURES_CODE.match(canonical)
+    if futures is not None:
+        root, month, exchange = futures.groups()
+        return exchange, root + (month or "")
+    if _LETTERS.match(canonical):
+        return "", canonical
+    return canonical[:2], canonical[2:]
+
+
+def _check_symbol(code: str, market: str, symbol: str) -> str:
+    """检查代码位数，港股不足5位时补零 / Check the symbol length, zero-padding short Hong Kong symbols"""
+    digits = MARKET_SYMBOL_DIGITS[market]
+    if market == "HK" and len(symbol) < digits:
+        symbol = symbol.zfill(digits)
+    if len(symbol) != digits:
+        raise InstrumentCodeError(code, f"{market} symbols have {digits} digits, got {symbol!r}")
+    return symbol
@@ -0,0 +1,297 @@
+"""
+延迟加载特征数据模块 / Lazy Feature Frame Module
+按字段延迟加载的单标的特征数据：字段在第一次访问时才从提供者（经过缓存）读取
+Per-instrument feature data loaded field by field: a field is only read from
+the provider (through the cache) the first time it is accessed
+
+每个字段加载后保存为一段连续的float64数组（非数值字段保持原类型），同一标的的所有字段
+共享第一个加载字段的时间索引。column_array()和slice()返回共享内存的视图，不复制数据。
+多个线程可以同时访问同一个LazyFeatureFrame，每个字段只加载一次。
+get_features(..., defer_expressions=True)返回的数据中原始字段已经加载，只有表达式列在第一次
+访问时才计算。
+Each loaded field is kept as one contiguous float64 array (non-numeric fields
+keep their dtype), and every field of the instrument shares the time index of
+the first field loaded. column_array() and slice() return views sharing
+memory, with no copy. Several threads may access one LazyFeatureFrame at once
+and each field is loaded only once. With get_features(...,
+defer_expressions=True) the raw fields come loaded and only the expression
+columns are computed on first access.
+
+Examples:
+    >>> result = manager.get_features(codes, ["$open", "$close", "$volume"], lazy=True)
+    >>> values, index = result["SH600000"].column_array("$close")  # 只加载$close
+    >>> ma20 = rolling(values, 20).mean()
+    >>> result = manager.get_features(codes, ["$close", "Mean($close,5)", "Std($close,20)"], defer_expressions=True)
+    >>> result["SH600000"]["Mean($close,5)"]  # 只计算Mean($close,5)
+"""
+
+import threading
+from typing import Callable, Dict, List, Optional, Sequence, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.data_provider import FieldNotFoundError
+from .feature_frame import FeatureFrame, TimeLike, _to_timestamp
+
+
+# 加载函数接收字段列表，返回以时间为索引、包含这些列的DataFrame
+Loader = Callable[[List[str]], pd.DataFrame]
+
+
+class _ColumnStore:
+    """
+    一个标的已加载的列和共享时间索引 / Loaded columns and the shared time index of one instrument
+    
+    切片共享同一个存储，因此在切片上访问字段也会为原数据加载该字段
+    Slices share the store, so accessing a field on a slice loads it for the
+    original frame as well
+    """
+    
+    def __init__(
+        self,
+        instrument: str,
+        fields: Sequence[str],
+        loader: Loader,
+        preloaded: Optional[pd.DataFrame] = None
+    ):
+        self.instrument = instrument
+        self.fields = list(dict.fromkeys(fields))
+        self._loader = loader
+        self._columns: Dict[str, np.ndarray] = {}
+        self._index: Optional[pd.Index] = None
+        if preloaded is not None:
+            self._index = preloaded.index
+            for name in preloaded.columns:
+                self._columns[name] = _to_column(preloaded[name])
+        self._lock = threading.Lock()
+        self._field_locks: Dict[str, threading.Lock] = {}
+    
+    @property
+    def loaded(self) -> List[str]:
+        with self._lock:
+            return [name for name in self.fields if name in self._columns]
+    
+    def index(self) -> pd.Index:
+        if self._index is None:
+            self.get(self.fields[0])
+        return self._index
+    
+    def get(self, name: str) -> np.ndarray:
+        if name not in self.fields:
+            raise FieldNotFoundError([name], self.fields, self.instrument)
+        column = self._columns.get(name)
+        if column is not None:
+            return column
+        with self._lock:
+            field_lock = self._field_locks.setdefault(name, threading.Lock())
+        # 每个字段单独加锁：不同字段可以并发加载，同一字段只加载一次
+        with field_lock:
+            column = self._columns.get(name)
+            if column is None:
+                column = self._load(name)
+            return column
+    
+    def _load(self, name: str) -> np.ndarray:
+        series = self._loader([name])[name]
+        with self._lock:
+            if self._index is None:
+                self._index = series.index
+            elif not series.index.equals(self._index):
+                series = series.reindex(self._index)
+            column = _to_column(series)
+            self._columns[name] = column
+        return column
+
+
+def _to_column(series: pd.Series) -> np.ndarray:
+    """转换为连续的只读数组，数值和布尔列为float64 / Convert to a contiguous read-only array, float64 for numeric and bool columns"""
+    if pd.api.types.is_numeric_dtype(series.dtype) or pd.api.types.is_bool_dtype(series.dtype):
+        values = np.ascontiguousarray(series.to_numpy(dtype=np.float64, na_value=np.nan))
+    else:
+        values = np.ascontiguousarray(series.to_numpy())
+    values.flags.writeable = False
+    return values
+
+
+class LazyFeatureFrame:
+    """
+    按字段延迟加载的单标的特征数据 / Per-instrument feature frame loaded field by field
+    
+    由get_features(..., lazy=True)返回。访问方法与FeatureFrame相同：column()、column_array()、
+    slice()和frame["$close"]；load()加载全部字段并返回普通的FeatureFrame。字段的加载错误
+    （如提供者没有该字段或该标的没有数据）在第一次访问时抛出，下一次访问会重新加载。
+    Returned by get_features(..., lazy=True). The accessors match FeatureFrame:
+    column(), column_array(), slice() and frame["$close"]; load() loads every
+    field and returns a plain FeatureFrame. Load errors, such as a field the
+    provider lacks or an instrument without data, are raised on first access,
+    and the next access tries again.
+    """
+    
+    def __init__(
+        self,
+        instrument: str,
+        fields: Sequence[str],
+        loader: Loader,
+        preloaded: Optional[pd.DataFrame] = None,
+        _store: Optional[_ColumnStore] = None,
+        _window: Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]] = (None, None)
+    ):
+        """
+        初始化 / Initialize
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            fields: 可以访问的字段或表达式 / Fields or expressions that can be accessed
+            loader: 加载函数，loader(fields)返回以时间为索引、包含这些列的DataFrame /
+                Load function; loader(fields) returns a time-indexed DataFrame holding those columns
+            preloaded: 已经加载的字段，其索引作为共享时间索引 /
+                Fields already loaded, whose index becomes the shared time index
+        """
+        if not fields and _store is None:
+            raise ValueError("fields must not be empty")
+        self._store = _store or _ColumnStore(instrument, fields, loader, preloaded)
+        self._window = _window
+    
+    def __repr__(self) -> str:
+        return (
+            f"LazyFeatureFrame(instrument={self.instrument!r}, fields={self.columns}, "
+            f"loaded={self.loaded})"
+        )
+    
+    @property
+    def instrument(self) -> str:
+        """标的代码 / Instrument code"""
+        return self._store.instrument
+    
+    @property
+    def columns(self) -> List[str]:
+        """可以访问的字段，与请求顺序一致 / Fields that can be accessed, in request order"""
+        return list(self._store.fields)
+    
+    @property
+    def loaded(self) -> List[str]:
+        """已经加载的字段 / Fields loaded so far"""
+        return self._store.loaded
+    
+    @property
+    def index(self) -> pd.Index:
+        """
+        时间索引，还没有加载任何字段时先加载第一个字段 / Time index; loads the first field when none is loaded yet
+        """
+        return self._store.index()[self._positions()]
+    
+    def __len__(self) -> int:
+        return len(self.index)
+    
+    def __contains__(self, name: object) -> bool:
+        return name in self._store.fields
+    
+    def __getitem__(self, name: str) -> pd.Series:
+        """
+        获取单个字段的序列，与数据共享内存 / Get one field as a series sharing memory with the data
+        
+        Raises:
+            FieldNotFoundError: 字段不在请求的字段中时抛出 / Raised when the field was not requested
+        """
+        values, index = self.column_array(name)
+        return pd.Series(values, index=index, name=name, copy=False)
+    
+    def column(self, name: str) -> Tuple[List[float], List[pd.Timestamp]]:
+        """
+        获取单个字段的数值和对应时间，见FeatureFrame.column() / Get the values of one field with their times, see FeatureFrame.column()
+        
+        Raises:
+            FieldNotFoundError: 字段不在请求的字段中时抛出 / Raised when the field was not requested
+        """
+        values, index = self.column_array(name)
+        return values.tolist(), list(index)
+    
+    def column_array(self, name: str) -> Tuple[np.ndarray, pd.Index]:
+        """
+        获取单个字段的只读数组视图和时间索引，第一次访问时加载该字段 /
+        Get a read-only array view of one field with the time index, loading the field on first access
+        
+        Args:
+            name: 字段名，如"$close" / Field name, e.g. "$close"
+        
+        Returns:
+            Tuple[np.ndarray, pd.Index]: (一维数组视图, 时间索引)，两者长度相同 /
+                (1-D array view, time index) of equal length
+        
+        Raises:
+            FieldNotFoundError: 字段不在请求的字段中时抛出 / Raised when the field was not requested
+        """
+        values = self._store.get(name)
+        positions = self._positions()
+        return values[positions], self._store.index()[positions]
+    
+    def slice(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> "LazyFeatureFrame":
+        """
+        按时间区间切片（包含边界） / Slice by time range (inclusive)
+        
+        切片不触发加载，与原数据共享已加载和之后加载的字段
+        Slicing loads nothing, and the slice shares the fields loaded so far and
+        later with the original
+        
+        Args:
+            start: 开始时间（包含），None表示不限 / Start (inclusive), None for unbounded
+            end: 结束时间（包含），None表示不限 / End (inclusive), None for unbounded
+        
+        Returns:
+            LazyFeatureFrame: 区间内的数据 / Rows within the range
+        """
+        start_ts, end_ts = _to_timestamp(start), _to_timestamp(end)
+        current_start, current_end = self._window
+        if current_start is not None and (start_ts is None or start_ts < current_start):
+            start_ts = current_start
+        if current_end is not None and (end_ts is None or end_ts > current_end):
+            end_ts = current_end
+        return LazyFeatureFrame(
+            self.instrument, self.columns, self._store._loader, _store=self._store, _window=(start_ts, end_ts)
+        )
+    
+    def load(self, fields: Optional[Sequence[str]] = None) -> FeatureFrame:
+        """
+        加载字段并返回FeatureFrame / Load fields and return a FeatureFrame
+        
+        Args:
+            fields: 要加载的字段，None表示全部字段 / Fields to load, None for all of them
+        
+        Returns:
+            FeatureFrame: 列顺序与fields一致 / Columns in the order of fields
+        
+        Raises:
+            FieldNotFoundError: 字段不在请求的字段中时抛出 / Raised when a field was not requested
+        """
+        names = self.columns if fields is None else list(fields)
+        columns = {}
+        for name in names:
+            columns[name], index = self.column_array(name)
+        if not names:
+            index = self.index
+        frame = FeatureFrame(columns, index=index, columns=names)
+        frame.attrs["instrument"] = self.instrument
+        return frame
+    
+    def _positions(self) -> Union[slice, np.ndarray]:
+        """当前时间区间在共享索引中的位置 / Positions of the current window in the shared index"""
+        start, end = self._window
+        if start is None and end is None:
+            return slice(None)
+        index = self._store.index()
+        if not index.is_monotonic_increasing:
+            # 索引无序时退回到布尔掩码（会复制数据）
+            mask = np.ones(len(index), dtype=bool)
+            if start is not None:
+                mask &= index >= start
+            if end is not None:
+                mask &= index <= end
+            return mask
+        lo = 0 if start is None else int(index.searchsorted(start, side="left"))
+        hi = len(index) if end is None else int(index.searchsorted(end, side="right"))
+        return slice(lo, max(lo, hi))
@@ -0,0 +1,118 @@
+"""
+标的交易时段模块 / Instrument Session Module
+查找标的所在市场的交易日历，日历给出该市场的时区、日内交易时段和午休
+Looks up the trading calendar of an instrument's market, which carries the
+market's timezone, intraday sessions and lunch break
+
+标的的市场先查register_instrument_calendar()注册的代码，再按交易所：SH、SZ、BJ和期货交易所
+为A股日历（Asia/Shanghai，午休11:30-13:00），HK为港交所日历（Asia/Hong_Kong，午休
+12:00-13:00），1至5位纯字母代码为纽交所日历（America/New_York，没有午休，随夏令时切换）；
+其余代码（如6位字母的汇率HKDCNY）使用A股日历。
+An instrument's market comes from register_instrument_calendar() first,
+then from its exchange: SH, SZ, BJ and the futures exchanges use the
+A-share calendar (Asia/Shanghai, lunch 11:30-13:00), HK the HKEX calendar
+(Asia/Hong_Kong, lunch 12:00-13:00) and letter-only codes of one to five
+letters the NYSE calendar (America/New_York, no lunch break, observing
+daylight saving); anything else, such as the six-letter FX pair HKDCNY,
+falls back to the A-share calendar.
+
+数据提供者以交易所本地时间（不带时区）标记K线，不同市场的标的放在一起比较前用
+TradingCalendar.to_utc()转换为UTC，见DataManager.get_features(..., utc=True)。
+Providers stamp bars with exchange-local wall time (naive); convert with
+TradingCalendar.to_utc() before comparing instruments of different markets,
+see DataManager.get_features(..., utc=True).
+
+Examples:
+    >>> instrument_calendar("HK00700").timezone
+    'Asia/Hong_Kong'
+    >>> instrument_calendar("AAPL").breaks
+    []
+    >>> register_instrument_calendar("BABA", "HKEX")
+"""
+
+import re
+import threading
+from typing import Dict
+
+from .instrument import normalize_instrument, split_instrument
+from .trading_calendar import TradingCalendar, get_calendar
+
+
+# 没有对应市场的代码使用的日历 / Calendar of codes matching no market
+DEFAULT_MARKET = "CN"
+
+# 交易所前缀对应的日历 / Calendar of each exchange prefix
+_MARKET_CALENDARS: Dict[str, str] = {"SH": "SSE", "SZ": "SZSE", "BJ": "CN", "HK": "HKEX"}
+
+# 美股代码：1至5位字母 / US tickers: one to five letters
+_US_TICKER = re.compile(r"^[A-Z]{1,5}$")
+US_MARKET = "NYSE"
+
+# 单独注册的标的日历，键为内部形式的标的代码
+_INSTRUMENT_CALENDARS: Dict[str, str] = {}
+_instrument_calendars_lock = threading.Lock()
+
+
+def register_instrument_calendar(instrument: str, market: str) -> None:
+    """
+    注册或覆盖标的所在市场的日历 / Register or replace the calendar of an instrument's market
+    
+    用于在其他市场上市的标的，如在港交所交易但代码为纯字母的标的
+    For listings the code doesn't give away, such as a letter-only code
+    trading in Hong Kong
+    
+    Args:
+        instrument: 标的代码，任意接受的写法 / Instrument code in any accepted spelling
+        market: 日历的市场名称，如"HKEX" / Market name of the calendar, e.g. "HKEX"
+    
+    Raises:
+        DataError: 未知市场时抛出 / Raised for an unknown market
+    """
+    get_calendar(market)
+    with _instrument_calendars_lock:
+        _INSTRUMENT_CALENDARS[normalize_instrument(instrument)] = market
+
+
+def instrument_market(instrument: str) -> str:
+    """
+    标的所在市场的日历名称 / Calendar name of an instrument's market
+    
+    Args:
+        instrument: 标的代码，任意接受的写法 / Instrument code in any accepted spelling
+    
+    Returns:
+        str: 市场名称，如"SSE"、"HKEX"、"NYSE" / Market name, e.g. "SSE", "HKEX", "NYSE"
+    
+    Raises:
+        InstrumentCodeError: 代码无法识别时抛出 / Raised when the code is not recognized
+    """
+    code = normalize_instrument(instrument)
+    market = _INSTRUMENT_CALENDARS.get(code)
+    if market is not None:
+        return market
+    exchange, symbol = split_instrument(code)
+    if exchange in _MARKET_CALENDARS:
+        return _MARKET_CALENDARS[exchange]
+    if not exchange and _US_TICKER.match(symbol):
+        return US_MARKET
+    return DEFAULT_MARKET
+
+
+def instrument_calendar(instrument: str) -> TradingCalendar:
+    """
+    标的所在市场的交易日历 / Trading calendar of an instrument's market
+    
+    日历的timezone、sessions和breaks分别为该市场的时区、日内交易时段和午休
+    The calendar's timezone, sessions and breaks are the market's timezone,
+    intraday sessions and lunch break
+    
+    Args:
+        instrument: 标的代码，任意接受的写法 / Instrument code in any accepted spelling
+    
+    Returns:
+        TradingCalendar: 交易日历 / Trading calendar
+    
+    Raises:
+        InstrumentCodeError: 代码无法识别时抛出 / Raised when the code is not recognized
+    """
+    return get_calendar(instrument_market(instrument))
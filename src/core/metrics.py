@@ -0,0 +1,1029 @@
+"""
+绩效指标模块 / Performance Metrics Module
+在收益率或权益序列上计算年化收益、波动率、夏普、索提诺、最大回撤、卡玛比率，
+相对基准的贝塔、阿尔法、跟踪误差和信息比率，以及交易列表的胜率和盈亏比
+Computes annualized return, volatility, Sharpe, Sortino, max drawdown and
+Calmar on return or equity series, benchmark-relative beta, alpha, tracking
+error and information ratio, plus win rate and profit factor over trades
+
+相对基准的指标（beta、alpha、tracking_error、information_ratio）要求策略和基准
+收益率逐期对齐：两者长度必须相同，均为Series时索引也必须相同，否则抛出ValueError；
+任一方为NaN的期一起跳过。这些指标在无法定义时（少于两期、基准方差或跟踪误差为0）
+返回NaN，因为0.0本身是有意义的取值。relative()自动在共同日期上对齐两个带时间索引
+的序列，一次计算上述指标以及捕获率、相对回撤和滚动贝塔。
+Benchmark-relative metrics (beta, alpha, tracking_error, information_ratio)
+need strategy and benchmark returns aligned period by period: both must have
+the same length, and the same index when both are Series, or ValueError is
+raised; periods where either is NaN are skipped together. They return NaN when undefined
+(fewer than two periods, zero benchmark variance or tracking error), since
+0.0 is itself a meaningful value. relative() aligns two time-indexed series on
+their common dates itself and computes all of them together with capture
+ratios, active drawdown and a rolling beta.
+
+基于期数的年化收益（annualized_return）按期数换算年数；基于日历时间的年复合
+增长率（cagr、EquityCurve.cagr）按首尾时间间隔换算年数，两者在有停牌或
+节假日较多时会略有差异。
+annualized_return converts the number of periods into years, while the
+calendar-based compound annual growth rate (cagr, EquityCurve.cagr) uses the
+time between the first and last timestamps; the two differ slightly when
+there are many holidays or gaps.
+
+收益率序列中的NaN（停牌、缺失数据）会被跳过，不计入期数。数据不足时
+（空序列、只有一期、波动率为0）比率类指标返回0.0，而不是除零或NaN。
+年化因子由数据频率决定：日线为252，分钟线按每个交易日240分钟（A股交易时长）
+换算，如5min为252 * 48。
+NaNs in a return series (suspensions, missing data) are skipped and do not
+count as periods. When there is too little data (empty series, a single
+period, zero volatility) ratio metrics return 0.0 instead of dividing by zero
+or returning NaN. The annualization factor follows the data frequency: 252
+for daily bars, and minute bars scale by 240 minutes per trading day (the
+A-share session length), e.g. 252 * 48 for "5min".
+
+attribution()把回测结果的收益和波动率按标的分解：收益贡献为标的的累计盈亏（扣除费用、计入分红）
+除以期初权益，各标的之和等于组合的累计收益；波动率贡献为每日贡献与组合收益的协方差除以组合
+波动率，各标的之和等于组合的年化波动率。
+attribution() splits a backtest result's return and volatility by
+instrument: the return contribution is the instrument's cumulative P&L, net of
+fees and with dividends, over the starting equity, so the contributions sum
+to the portfolio's total return; the volatility contribution is the
+covariance of its daily contributions with the portfolio return over the
+portfolio volatility, so those sum to the annualized portfolio volatility.
+
+Examples:
+    >>> result = engine.run(strategy)
+    >>> print(summary(result.equity_curve, kind="equity"))
+"""
+
+import math
+from dataclasses import dataclass, asdict
+from enum import Enum
+from typing import Any, Dict, Iterable, List, NamedTuple, Optional, Sequence, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.data_provider import SUPPORTED_FREQS, freq_minutes, is_intraday
+from ..infrastructure.logger_system import get_logger
+
+
+TRADING_DAYS_PER_YEAR = 252
+MINUTES_PER_TRADING_DAY = 240
+DAYS_PER_YEAR = 365.25
+
+# 频率，或直接给出每年的期数 / A frequency, or the number of periods per year
+FreqLike = Union[str, float]
+
+
+# 遇到非正价格时的处理方式 / How non-positive prices are handled
+INVALID_PRICE_MODES = ("nan", "raise")
+
+
+class ReturnKind(Enum):
+    """收益率类型 / Return kind"""
+    SIMPLE = "simple"  # p_t / p_{t-1} - 1
+    LOG = "log"  # ln(p_t / p_{t-1})
+
+
+class Drawdown(NamedTuple):
+    """最大回撤 / Maximum drawdown"""
+    magnitude: float  # 回撤幅度，0.25表示25% / Depth as a fraction, 0.25 for 25%
+    peak: Optional[pd.Timestamp]  # 回撤开始的高点 / Peak before the drawdown
+    trough: Optional[pd.Timestamp]  # 回撤的最低点 / Lowest point of the drawdown
+
+
+def periods_per_year(freq: FreqLike = "day", minutes_per_day: int = MINUTES_PER_TRADING_DAY) -> float:
+    """
+    获取年化因子 / Get the annualization factor
+    
+    Args:
+        freq: 数据频率，如"day"、"5min"；传入数字时直接作为每年期数 /
+            Data frequency such as "day" or "5min"; a number is used as the periods per year
+        minutes_per_day: 每个交易日的交易分钟数 / Trading minutes per day
+    
+    Returns:
+        float: 每年的期数 / Periods per year
+    
+    Raises:
+        ValueError: 频率不受支持时抛出 / Raised for an unsupported frequency
+    """
+    if isinstance(freq, (int, float)) and not isinstance(freq, bool):
+        if freq <= 0:
+            raise ValueError(f"periods per year must be positive, got {freq}")
+        return float(freq)
+    if freq not in SUPPORTED_FREQS:
+        raise ValueError(f"Unsupported frequency {freq!r}, expected one of {SUPPORTED_FREQS}")
+    if not is_intraday(freq):
+        return float(TRADING_DAYS_PER_YEAR)
+    return TRADING_DAYS_PER_YEAR * minutes_per_day / freq_minutes(freq)
+
+
+def equity_to_returns(equity: Union[pd.Series, Sequence[float]]) -> pd.Series:
+    """
+    把权益序列转换为收益率序列 / Convert an equity series to returns
+    
+    第一个权益点只作为起点，不产生收益率
+    The first equity point is only the starting value and yields no return
+    
+    Args:
+        equity: 权益序列 / Equity series
+    
+    Returns:
+        pd.Series: 比输入少一期的收益率序列 / Returns, one period shorter than the input
+    """
+    return _as_series(equity).pct_change().iloc[1:]
+
+
+def price_returns(
+    prices: Union[pd.Series, Sequence[float]],
+    kind: Union[str, ReturnKind] = ReturnKind.SIMPLE,
+    invalid: str = "nan"
+) -> pd.Series:
+    """
+    把价格序列转换为逐期收益率 / Convert a price series to per-period returns
+    
+    结果比价格序列少一期：第t期的收益率以t为索引，第一期没有收益率。价格为NaN的期收益率为NaN；
+    价格非正时收益率没有意义，invalid决定这样的期为NaN还是抛出错误。周线、月线收益率可以先用
+    FeatureFrame.resample_bars()重采样再计算。
+    The result is one shorter than the prices: the return of period t is
+    indexed by t and the first period has none. A NaN price gives NaN returns;
+    a non-positive price has no meaningful return, and invalid picks whether
+    such steps are NaN or raise. For weekly or monthly returns resample first
+    with FeatureFrame.resample_bars().
+    
+    Args:
+        prices: 价格序列 / Price series
+        kind: "simple"或"log"，或ReturnKind / "simple" or "log", or a ReturnKind
+        invalid: "nan"把涉及非正价格的期设为NaN，"raise"抛出ValueError /
+            "nan" sets the steps touching a non-positive price to NaN, "raise" raises ValueError
+    
+    Returns:
+        pd.Series: 收益率序列，长度为len(prices) - 1（空序列时为0） /
+            Returns of length len(prices) - 1 (0 for empty prices)
+    
+    Raises:
+        ValueError: kind或invalid无效，或invalid="raise"时遇到非正价格 /
+            Raised for an invalid kind or invalid, or a non-positive price with invalid="raise"
+    """
+    kind = ReturnKind(kind)
+    if invalid not in INVALID_PRICE_MODES:
+        raise ValueError(f"invalid must be one of {INVALID_PRICE_MODES}, got {invalid!r}")
+    prices = _as_series(prices)
+    bad = prices <= 0
+    if bad.any():
+        if invalid == "raise":
+            first = prices.index[bad.to_numpy().argmax()]
+            raise ValueError(f"non-positive price {prices[first]} at {first}, returns are undefined")
+        prices = prices.mask(bad)
+    
+    ratio = prices / prices.shift(1)
+    returns = np.log(ratio) if kind is ReturnKind.LOG else ratio - 1.0
+    return returns.iloc[1:]
+
+
+def annualized_return(returns: Union[pd.Series, Sequence[float]], freq: FreqLike = "day") -> float:
+    """
+    年化收益率（几何） / Annualized (geometric) return
+    
+    Args:
+        returns: 每期收益率 / Per-period returns
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化收益率，没有有效数据时为0.0 / Annualized return; 0.0 without valid data
+    """
+    values = _valid(returns)
+    if len(values) == 0:
+        return 0.0
+    growth = float(np.prod(1.0 + values))
+    if growth <= 0:
+        return -1.0
+    return growth ** (periods_per_year(freq) / len(values)) - 1.0
+
+
+def annualized_vol(returns: Union[pd.Series, Sequence[float]], freq: FreqLike = "day") -> float:
+    """
+    年化波动率 / Annualized volatility
+    
+    Args:
+        returns: 每期收益率 / Per-period returns
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化的样本标准差，少于两期时为0.0 / Annualized sample std; 0.0 with fewer than two periods
+    """
+    values = _valid(returns)
+    if len(values) < 2:
+        return 0.0
+    return float(np.std(values, ddof=1) * math.sqrt(periods_per_year(freq)))
+
+
+def sharpe(
+    returns: Union[pd.Series, Sequence[float]],
+    rf: float = 0.0,
+    freq: FreqLike = "day"
+) -> float:
+    """
+    夏普比率 / Sharpe ratio
+    
+    Args:
+        returns: 每期收益率 / Per-period returns
+        rf: 年化无风险利率，如0.02 / Annual risk-free rate, e.g. 0.02
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化的超额收益均值与标准差之比，标准差为0时为0.0 /
+            Annualized mean excess return over its std; 0.0 when the std is zero
+    """
+    excess = _excess(returns, rf, freq)
+    if len(excess) < 2:
+        return 0.0
+    std = float(np.std(excess, ddof=1))
+    if std == 0 or not math.isfinite(std):
+        return 0.0
+    return float(np.mean(excess)) / std * math.sqrt(periods_per_year(freq))
+
+
+def sortino(
+    returns: Union[pd.Series, Sequence[float]],
+    rf: float = 0.0,
+    freq: FreqLike = "day"
+) -> float:
+    """
+    索提诺比率 / Sortino ratio
+    
+    Args:
+        returns: 每期收益率 / Per-period returns
+        rf: 年化无风险利率，同时作为目标收益 / Annual risk-free rate, also the target return
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化的超额收益均值与下行偏差之比，没有下行时为0.0 /
+            Annualized mean excess return over the downside deviation; 0.0 without downside
+    """
+    excess = _excess(returns, rf, freq)
+    if len(excess) == 0:
+        return 0.0
+    downside = math.sqrt(float(np.mean(np.minimum(excess, 0.0) ** 2)))
+    if downside == 0:
+        return 0.0
+    return float(np.mean(excess)) / downside * math.sqrt(periods_per_year(freq))
+
+
+def max_drawdown(returns: Union[pd.Series, Sequence[float]]) -> Drawdown:
+    """
+    最大回撤及其高点、低点时间 / Maximum drawdown with its peak and trough times
+    
+    从初始净值1.0开始复利累计，NaN期的净值保持不变
+    Compounds from a starting value of 1.0; the value is unchanged over NaN periods
+    
+    Args:
+        returns: 每期收益率，带时间索引时返回高低点时间 /
+            Per-period returns; peak and trough times are given for a time index
+    
+    Returns:
+        Drawdown: 回撤幅度和高低点，没有回撤时幅度为0.0、时间为None /
+            Depth and peak/trough; 0.0 and None times when there is no drawdown
+    """
+    series = _as_series(returns)
+    values = series.to_numpy(dtype=float)
+    if len(values) == 0:
+        return Drawdown(0.0, None, None)
+    
+    wealth = np.cumprod(1.0 + np.nan_to_num(values, nan=0.0))
+    return _deepest(wealth, np.maximum.accumulate(np.maximum(wealth, 1.0)), series.index)
+
+
+def _equity_drawdown(equity: pd.Series) -> Drawdown:
+    """在权益序列上直接计算最大回撤，起点即为回撤基准 / Max drawdown measured on the equity itself, based at its first point"""
+    values = equity.to_numpy(dtype=float)
+    if len(values) < 2:
+        return Drawdown(0.0, None, None)
+    return _deepest(values, np.maximum.accumulate(values), equity.index)
+
+
+def _deepest(values: np.ndarray, peaks: np.ndarray, index: pd.Index) -> Drawdown:
+    """取相对历史峰值的最深回撤 / Deepest drawdown of values below their running peaks"""
+    with np.errstate(divide="ignore", invalid="ignore"):
+        drawdowns = np.where(peaks > 0, 1.0 - values / peaks, 0.0)
+    trough = int(np.argmax(drawdowns))
+    magnitude = float(drawdowns[trough])
+    if magnitude <= 0:
+        return Drawdown(0.0, None, None)
+    
+    # 高点为低点之前最后一次达到峰值的时间，峰值为初始净值时取第一期
+    at_peak = np.flatnonzero(values[:trough + 1] >= peaks[trough])
+    peak = int(at_peak[-1]) if len(at_peak) else 0
+    if isinstance(index, pd.DatetimeIndex):
+        return Drawdown(magnitude, index[peak], index[trough])
+    return Drawdown(magnitude, None, None)
+
+
+def calmar(returns: Union[pd.Series, Sequence[float]], freq: FreqLike = "day") -> float:
+    """
+    卡玛比率 / Calmar ratio
+    
+    Args:
+        returns: 每期收益率 / Per-period returns
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化收益率与最大回撤之比，没有回撤时为0.0 /
+            Annualized return over max drawdown; 0.0 when there is no drawdown
+    """
+    drawdown = max_drawdown(returns).magnitude
+    if drawdown == 0:
+        return 0.0
+    return annualized_return(returns, freq) / drawdown
+
+
+def beta(
+    returns: Union[pd.Series, Sequence[float]],
+    benchmark: Union[pd.Series, Sequence[float]]
+) -> float:
+    """
+    相对基准的贝塔 / Beta against a benchmark
+    
+    Args:
+        returns: 策略每期收益率 / Per-period strategy returns
+        benchmark: 对齐的基准每期收益率，如SH000300 / Aligned per-period benchmark returns, e.g. SH000300
+    
+    Returns:
+        float: 协方差与基准方差之比，基准方差为0或少于两期时为NaN /
+            Covariance over benchmark variance; NaN with zero benchmark variance or fewer than two periods
+    
+    Raises:
+        ValueError: 两个序列没有对齐时抛出 / Raised when the series are not aligned
+    """
+    strategy, bench = _paired(returns, benchmark)
+    if len(strategy) < 2:
+        return math.nan
+    variance = float(np.var(bench, ddof=1))
+    if variance == 0 or not math.isfinite(variance):
+        return math.nan
+    covariance = float(np.cov(strategy, bench, ddof=1)[0, 1])
+    return covariance / variance
+
+
+def alpha(
+    returns: Union[pd.Series, Sequence[float]],
+    benchmark: Union[pd.Series, Sequence[float]],
+    rf: float = 0.0,
+    freq: FreqLike = "day"
+) -> float:
+    """
+    詹森阿尔法 / Jensen's alpha
+    
+    每期阿尔法为策略超额收益均值减去贝塔乘以基准超额收益均值，再乘以每年期数年化
+    The per-period alpha is the mean strategy excess return less beta times
+    the mean benchmark excess return, annualized by multiplying by the
+    periods per year
+    
+    Args:
+        returns: 策略每期收益率 / Per-period strategy returns
+        benchmark: 对齐的基准每期收益率 / Aligned per-period benchmark returns
+        rf: 年化无风险利率 / Annual risk-free rate
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化阿尔法，贝塔无法定义时为NaN / Annualized alpha; NaN when beta is undefined
+    
+    Raises:
+        ValueError: 两个序列没有对齐时抛出 / Raised when the series are not aligned
+    """
+    slope = beta(returns, benchmark)
+    if math.isnan(slope):
+        return math.nan
+    strategy, bench = _paired(returns, benchmark)
+    periods = periods_per_year(freq)
+    per_period_rf = rf / periods
+    excess = float(np.mean(strategy)) - per_period_rf
+    bench_excess = float(np.mean(bench)) - per_period_rf
+    return (excess - slope * bench_excess) * periods
+
+
+def information_ratio(
+    returns: Union[pd.Series, Sequence[float]],
+    benchmark: Union[pd.Series, Sequence[float]],
+    freq: FreqLike = "day"
+) -> float:
+    """
+    信息比率 / Information ratio
+    
+    Args:
+        returns: 策略每期收益率 / Per-period strategy returns
+        benchmark: 对齐的基准每期收益率 / Aligned per-period benchmark returns
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化的主动收益均值与跟踪误差之比，跟踪误差为0或少于两期时为NaN /
+            Annualized mean active return over tracking error; NaN with zero tracking error or fewer than two periods
+    
+    Raises:
+        ValueError: 两个序列没有对齐时抛出 / Raised when the series are not aligned
+    """
+    strategy, bench = _paired(returns, benchmark)
+    if len(strategy) < 2:
+        return math.nan
+    active = strategy - bench
+    tracking = float(np.std(active, ddof=1))
+    if tracking == 0 or not math.isfinite(tracking):
+        return math.nan
+    return float(np.mean(active)) / tracking * math.sqrt(periods_per_year(freq))
+
+
+def tracking_error(
+    returns: Union[pd.Series, Sequence[float]],
+    benchmark: Union[pd.Series, Sequence[float]],
+    freq: FreqLike = "day"
+) -> float:
+    """
+    跟踪误差 / Tracking error
+    
+    Args:
+        returns: 策略每期收益率 / Per-period strategy returns
+        benchmark: 对齐的基准每期收益率 / Aligned per-period benchmark returns
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        float: 年化的主动收益样本标准差，少于两期时为NaN /
+            Annualized sample std of active returns; NaN with fewer than two periods
+    
+    Raises:
+        ValueError: 两个序列没有对齐时抛出 / Raised when the series are not aligned
+    """
+    strategy, bench = _paired(returns, benchmark)
+    if len(strategy) < 2:
+        return math.nan
+    return float(np.std(strategy - bench, ddof=1) * math.sqrt(periods_per_year(freq)))
+
+
+def win_rate(trades: Iterable[Any]) -> float:
+    """
+    盈利交易占比 / Fraction of winning trades
+    
+    Args:
+        trades: 每笔交易的盈亏，或带pnl属性的交易对象 /
+            Per-trade P&L, or trade objects with a pnl attribute
+    
+    Returns:
+        float: 盈利交易数 / 交易数，没有交易时为0.0 / Winners over trades; 0.0 without trades
+    """
+    pnls = _pnls(trades)
+    if len(pnls) == 0:
+        return 0.0
+    return float(np.count_nonzero(pnls > 0)) / len(pnls)
+
+
+def profit_factor(trades: Iterable[Any]) -> float:
+    """
+    盈亏比（总盈利 / 总亏损） / Profit factor (gross profit over gross loss)
+    
+    Args:
+        trades: 每笔交易的盈亏，或带pnl属性的交易对象 /
+            Per-trade P&L, or trade objects with a pnl attribute
+    
+    Returns:
+        float: 没有亏损时有盈利为inf、否则为0.0 / inf when there are profits but no losses, else 0.0
+    """
+    pnls = _pnls(trades)
+    profit = float(pnls[pnls > 0].sum())
+    loss = float(-pnls[pnls < 0].sum())
+    if loss == 0:
+        return math.inf if profit > 0 else 0.0
+    return profit / loss
+
+
+def cagr(equity: pd.Series) -> float:
+    """
+    年复合增长率（按日历时间） / Compound annual growth rate over calendar time
+    
+    Args:
+        equity: 以时间为索引的权益序列，NaN被忽略 / Time-indexed equity series; NaNs are ignored
+    
+    Returns:
+        float: 年复合增长率，少于两个有效点、首尾时间相同或初始权益不为正时为0.0 /
+            CAGR; 0.0 with fewer than two valid points, no elapsed time or a non-positive start
+    """
+    return EquityCurve(equity).cagr()
+
+
+class EquityCurve:
+    """
+    权益曲线 / Equity curve
+    
+    在带时间戳的权益序列上计算常用统计，NaN点在构造时去掉。少于两个点时
+    各项指标为0.0。
+    Computes standard statistics on a timestamped equity series; NaN points
+    are dropped on construction. Every metric is 0.0 with fewer than two points.
+    
+    Examples:
+        >>> curve = EquityCurve(result.equity_curve)
+        >>> curve.sharpe(risk_free=0.02, periods_per_year=252)
+        >>> depth, peak, trough = curve.max_drawdown()
+    """
+    
+    def __init__(
+        self,
+        values: Union[pd.Series, Sequence[float]],
+        timestamps: Optional[Sequence[Any]] = None
+    ):
+        """
+        初始化权益曲线 / Initialize equity curve
+        
+        Args:
+            values: 权益值，为pd.Series时使用其时间索引 /
+                Equity values; the time index is used for a pd.Series
+            timestamps: 与values等长的时间戳，values为pd.Series时可省略 /
+                Timestamps as long as values; optional when values is a pd.Series
+        """
+        if timestamps is not None:
+            if len(timestamps) != len(values):
+                raise ValueError(
+                    f"timestamps and values must have the same length, got {len(timestamps)} and {len(values)}"
+                )
+            series = pd.Series(np.asarray(values, dtype=float), index=pd.DatetimeIndex(timestamps))
+        else:
+            series = _as_series(values)
+        self._series = series[np.isfinite(series.to_numpy(dtype=float))]
+    
+    @property
+    def series(self) -> pd.Series:
+        """去掉NaN后的权益序列 / Equity series without NaNs"""
+        return self._series
+    
+    @property
+    def returns(self) -> pd.Series:
+        """每期收益率，不含首个权益点 / Per-period returns, starting after the first point"""
+        return equity_to_returns(self._series)
+    
+    def __len__(self) -> int:
+        return len(self._series)
+    
+    def sharpe(self, risk_free: float = 0.0, periods_per_year: FreqLike = TRADING_DAYS_PER_YEAR) -> float:
+        """
+        夏普比率 / Sharpe ratio
+        
+        Args:
+            risk_free: 年化无风险利率 / Annual risk-free rate
+            periods_per_year: 每年期数或数据频率 / Periods per year or data frequency
+        
+        Returns:
+            float: 夏普比率，曲线持平时为0.0 / Sharpe ratio; 0.0 for a flat curve
+        """
+        if len(self) < 2:
+            return 0.0
+        return sharpe(self.returns, risk_free, periods_per_year)
+    
+    def volatility(self, periods_per_year: FreqLike = TRADING_DAYS_PER_YEAR) -> float:
+        """
+        年化波动率 / Annualized volatility
+        
+        Args:
+            periods_per_year: 每年期数或数据频率 / Periods per year or data frequency
+        
+        Returns:
+            float: 年化波动率 / Annualized volatility
+        """
+        if len(self) < 2:
+            return 0.0
+        return annualized_vol(self.returns, periods_per_year)
+    
+    def max_drawdown(self) -> Drawdown:
+        """
+        最大回撤及其高点、低点时间 / Maximum drawdown with its peak and trough times
+        
+        Returns:
+            Drawdown: (幅度, 高点时间, 低点时间) / (depth, peak time, trough time)
+        """
+        return _equity_drawdown(self._series)
+    
+    def cagr(self) -> float:
+        """
+        年复合增长率（按日历时间） / Compound annual growth rate over calendar time
+        
+        Returns:
+            float: 年复合增长率 / CAGR
+        """
+        if len(self) < 2 or not isinstance(self._series.index, pd.DatetimeIndex):
+            return 0.0
+        first, last = float(self._series.iloc[0]), float(self._series.iloc[-1])
+        years = (self._series.index[-1] - self._series.index[0]).total_seconds() / (DAYS_PER_YEAR * 86400)
+        if first <= 0 or years <= 0:
+            return 0.0
+        if last <= 0:
+            return -1.0
+        return (last / first) ** (1.0 / years) - 1.0
+
+
+@dataclass
+class Summary:
+    """
+    绩效汇总 / Performance summary
+    
+    Attributes:
+        periods: 有效期数 / Number of valid periods
+        total_return: 累计收益率 / Cumulative return
+        annualized_return: 年化收益率 / Annualized return
+        annualized_vol: 年化波动率 / Annualized volatility
+        sharpe: 夏普比率 / Sharpe ratio
+        sortino: 索提诺比率 / Sortino ratio
+        max_drawdown: 最大回撤 / Maximum drawdown
+        calmar: 卡玛比率 / Calmar ratio
+        cagr: 按日历时间的年复合增长率，仅在输入为带时间索引的权益序列时计算 /
+            Calendar-time CAGR, only computed for a time-indexed equity series
+        win_rate: 胜率，没有传入交易时为None / Win rate; None without trades
+        profit_factor: 盈亏比，没有传入交易时为None / Profit factor; None without trades
+    """
+    periods: int
+    total_return: float
+    annualized_return: float
+    annualized_vol: float
+    sharpe: float
+    sortino: float
+    max_drawdown: Drawdown
+    calmar: float
+    cagr: Optional[float] = None
+    win_rate: Optional[float] = None
+    profit_factor: Optional[float] = None
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为字典，回撤展开为三个字段 / Convert to a dict with the drawdown flattened"""
+        data = asdict(self)
+        drawdown = data.pop("max_drawdown")
+        data["max_drawdown"] = drawdown[0]
+        data["max_drawdown_peak"] = drawdown[1]
+        data["max_drawdown_trough"] = drawdown[2]
+        return data
+    
+    def __str__(self) -> str:
+        def date(t: Optional[pd.Timestamp]) -> str:
+            return "-" if t is None else str(t.date() if t == t.normalize() else t)
+        
+        lines = [
+            f"期数 / Periods:              {self.periods}",
+            f"累计收益 / Total return:     {self.total_return:.2%}",
+            f"年化收益 / Annual return:    {self.annualized_return:.2%}",
+            f"年化波动 / Annual vol:       {self.annualized_vol:.2%}",
+            f"夏普比率 / Sharpe:           {self.sharpe:.2f}",
+            f"索提诺比率 / Sortino:        {self.sortino:.2f}",
+            f"最大回撤 / Max drawdown:     {self.max_drawdown.magnitude:.2%} "
+            f"({date(self.max_drawdown.peak)} -> {date(self.max_drawdown.trough)})",
+            f"卡玛比率 / Calmar:           {self.calmar:.2f}",
+        ]
+        if self.cagr is not None:
+            lines.append(f"年复合增长 / CAGR:           {self.cagr:.2%}")
+        if self.win_rate is not None:
+            lines.append(f"胜率 / Win rate:             {self.win_rate:.2%}")
+        if self.profit_factor is not None:
+            lines.append(f"盈亏比 / Profit factor:      {self.profit_factor:.2f}")
+        return "\n".join(lines)
+
+
+def summary(
+    series: Union[pd.Series, Sequence[float]],
+    rf: float = 0.0,
+    freq: FreqLike = "day",
+    trades: Optional[Iterable[Any]] = None,
+    kind: str = "returns"
+) -> Summary:
+    """
+    一次计算全部指标 / Compute every metric at once
+    
+    Args:
+        series: 收益率或权益序列 / Return or equity series
+        rf: 年化无风险利率 / Annual risk-free rate
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+        trades: 每笔交易的盈亏（可选），提供时计算胜率和盈亏比 /
+            Optional per-trade P&L; win rate and profit factor are computed when given
+        kind: "returns"表示收益率序列，"equity"表示权益序列。权益序列的收益率从第二个点
+            开始计算，回撤以第一个点为基准，与EquityCurve一致 /
+            "returns" for a return series, "equity" for an equity series. Equity
+            returns start at the second point and drawdowns are based at the
+            first, matching EquityCurve
+    
+    Returns:
+        Summary: 绩效汇总 / Performance summary
+    """
+    growth = None
+    if kind == "equity":
+        curve = EquityCurve(series)
+        returns = curve.returns
+        drawdown = curve.max_drawdown()
+        if isinstance(curve.series.index, pd.DatetimeIndex):
+            growth = curve.cagr()
+    elif kind == "returns":
+        returns = _as_series(series)
+        drawdown = max_drawdown(returns)
+    else:
+        raise ValueError(f"kind must be 'returns' or 'equity', got {kind!r}")
+    
+    values = _valid(returns)
+    trade_list = None if trades is None else list(trades)
+    return Summary(
+        periods=len(values),
+        total_return=float(np.prod(1.0 + values)) - 1.0 if len(values) else 0.0,
+        annualized_return=annualized_return(returns, freq),
+        annualized_vol=annualized_vol(returns, freq),
+        sharpe=sharpe(returns, rf, freq),
+        sortino=sortino(returns, rf, freq),
+        max_drawdown=drawdown,
+        calmar=calmar(returns, freq),
+        cagr=growth,
+        win_rate=None if trade_list is None else win_rate(trade_list),
+        profit_factor=None if trade_list is None else profit_factor(trade_list)
+    )
+
+
+@dataclass
+class RelativeMetrics:
+    """
+    相对基准的绩效 / Performance relative to a benchmark
+    
+    Attributes:
+        periods: 对齐后的期数 / Periods after alignment
+        dropped: 只出现在一个序列中而被去掉的日期数 / Dates dropped because only one series had them
+        beta: 全区间贝塔（OLS） / Full-period beta (OLS)
+        alpha: 年化詹森阿尔法 / Annualized Jensen's alpha
+        tracking_error: 年化跟踪误差 / Annualized tracking error
+        information_ratio: 信息比率 / Information ratio
+        up_capture: 上行捕获率，基准上涨期的策略平均收益与基准平均收益之比 /
+            Up capture, mean strategy over mean benchmark return on periods the benchmark rose
+        down_capture: 下行捕获率，基准下跌期的同一比值 / Down capture, the same ratio on periods it fell
+        active_drawdown: 策略相对基准净值（策略净值/基准净值）的最大回撤 /
+            Max drawdown of the strategy's wealth relative to the benchmark's
+        rolling_beta: 滚动贝塔，窗口内数据不足或基准方差为0时为NaN /
+            Rolling beta; NaN until the window fills and where the benchmark variance is zero
+        active_returns: 每期主动收益（策略减基准） / Per-period active returns (strategy less benchmark)
+    """
+    periods: int
+    dropped: int
+    beta: float
+    alpha: float
+    tracking_error: float
+    information_ratio: float
+    up_capture: float
+    down_capture: float
+    active_drawdown: Drawdown
+    rolling_beta: pd.Series
+    active_returns: pd.Series
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为标量字典，回撤展开为三个字段，不含序列 / Convert to a dict of scalars with the drawdown flattened, without the series"""
+        data = {
+            name: getattr(self, name)
+            for name in (
+                "periods", "dropped", "beta", "alpha", "tracking_error",
+                "information_ratio", "up_capture", "down_capture"
+            )
+        }
+        data["active_drawdown"] = self.active_drawdown.magnitude
+        data["active_drawdown_peak"] = self.active_drawdown.peak
+        data["active_drawdown_trough"] = self.active_drawdown.trough
+        return data
+    
+    def __str__(self) -> str:
+        lines = [
+            f"期数 / Periods:              {self.periods}",
+            f"贝塔 / Beta:                 {self.beta:.2f}",
+            f"阿尔法 / Alpha:              {self.alpha:.2%}",
+            f"跟踪误差 / Tracking error:   {self.tracking_error:.2%}",
+            f"信息比率 / Info ratio:       {self.information_ratio:.2f}",
+            f"上行捕获 / Up capture:       {self.up_capture:.2%}",
+            f"下行捕获 / Down capture:     {self.down_capture:.2%}",
+            f"相对回撤 / Active drawdown:  {self.active_drawdown.magnitude:.2%}",
+        ]
+        return "\n".join(lines)
+
+
+def relative(
+    strategy: pd.Series,
+    benchmark: pd.Series,
+    window: int = 60,
+    rf: float = 0.0,
+    freq: FreqLike = "day",
+    kind: str = "returns",
+    max_dropped: float = 0.05,
+    strict: bool = False
+) -> RelativeMetrics:
+    """
+    计算相对基准的全部指标 / Compute every benchmark-relative metric
+    
+    两个序列按共同日期自动对齐；只出现在一个序列中的日期被去掉，去掉的比例（相对两者
+    日期的并集）超过max_dropped时记录警告，strict为True时抛出错误。权益序列先在共同
+    日期上对齐再计算收益率，使两边的收益率覆盖相同的区间。
+    The two series are aligned on their common dates; dates only one of them
+    has are dropped, and when the dropped share of the union of their dates
+    exceeds max_dropped a warning is logged, or an error raised in strict
+    mode. Equity series are aligned before computing returns, so both sides'
+    returns span the same intervals.
+    
+    Args:
+        strategy: 带时间索引的策略收益率或权益 / Time-indexed strategy returns or equity
+        benchmark: 带时间索引的基准收益率或权益，如SH000300 / Time-indexed benchmark returns or equity, e.g. SH000300
+        window: 滚动贝塔的窗口期数 / Periods in the rolling beta window
+        rf: 年化无风险利率 / Annual risk-free rate
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+        kind: "returns"表示收益率序列，"equity"表示权益或价格序列 /
+            "returns" for return series, "equity" for equity or price series
+        max_dropped: 允许去掉的日期比例 / Share of dates that may be dropped
+        strict: 超过max_dropped时是否抛出错误 / Whether exceeding max_dropped raises
+    
+    Returns:
+        RelativeMetrics: 相对基准的绩效 / Benchmark-relative performance
+    
+    Raises:
+        ValueError: 参数无效，或strict为True且去掉的日期过多时抛出 /
+            Raised for invalid arguments, or in strict mode when too many dates are dropped
+    
+    Examples:
+        >>> report = relative(result.equity_curve, hs300_close, window=60, kind="equity")
+        >>> report.rolling_beta.plot()
+    """
+    if kind not in ("returns", "equity"):
+        raise ValueError(f"kind must be 'returns' or 'equity', got {kind!r}")
+    if not isinstance(window, int) or isinstance(window, bool) or window < 2:
+        raise ValueError(f"window must be an integer of at least 2, got {window!r}")
+    if not 0 <= max_dropped <= 1:
+        raise ValueError(f"max_dropped must be between 0 and 1, got {max_dropped}")
+    
+    left, right = _as_series(strategy), _as_series(benchmark)
+    union = left.index.union(right.index)
+    common = left.index.intersection(right.index).sort_values()
+    dropped = len(union) - len(common)
+    if union.size and dropped / len(union) > max_dropped:
+        message = (
+            f"{dropped} of {len(union)} dates are not shared by strategy and benchmark "
+            f"({dropped / len(union):.1%} > max_dropped {max_dropped:.1%})"
+        )
+        if strict:
+            raise ValueError(message)
+        get_logger(__name__).warning(f"策略与基准的日期不一致，已去掉{dropped}个日期: {message}")
+    left, right = left.loc[common], right.loc[common]
+    if kind == "equity":
+        left, right = left.pct_change().iloc[1:], right.pct_change().iloc[1:]
+    
+    valid = np.isfinite(left.to_numpy()) & np.isfinite(right.to_numpy())
+    left, right = left[valid], right[valid]
+    active = left - right
+    periods = len(left)
+    
+    variance = right.rolling(window).var()
+    rolling_beta = (left.rolling(window).cov(right) / variance).where(variance > 0)
+    
+    return RelativeMetrics(
+        periods=periods,
+        dropped=dropped,
+        beta=beta(left, right),
+        alpha=alpha(left, right, rf, freq),
+        tracking_error=tracking_error(left, right, freq),
+        information_ratio=information_ratio(left, right, freq),
+        up_capture=_capture(left, right, right > 0),
+        down_capture=_capture(left, right, right < 0),
+        active_drawdown=max_drawdown((1.0 + left) / (1.0 + right) - 1.0),
+        rolling_beta=rolling_beta,
+        active_returns=active
+    )
+
+
+@dataclass
+class InstrumentContribution:
+    """
+    单个标的的收益和风险贡献 / Return and risk contribution of one instrument
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        pnl: 累计盈亏，扣除费用、计入分红，基准货币 / Cumulative P&L net of fees with dividends, in the base currency
+        return_contribution: 对组合累计收益的贡献，即pnl除以期初权益 /
+            Contribution to the total return, pnl over the starting equity
+        volatility_contribution: 对组合年化波动率的边际贡献，可以为负数（对冲） /
+            Marginal contribution to the annualized volatility; negative for a hedge
+    """
+    instrument: str
+    pnl: float
+    return_contribution: float
+    volatility_contribution: float
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为字典 / Convert to a dict"""
+        return asdict(self)
+
+
+def attribution(result: Any, freq: FreqLike = "day") -> List[InstrumentContribution]:
+    """
+    按标的分解回测的收益和波动率 / Attribute a backtest's return and volatility to instruments
+    
+    第t日标的i的贡献为其当日盈亏除以前一日权益，各标的之和即组合当日收益；波动率贡献为
+    cov(c_i, r) / σ(r)，按年化，各标的之和等于annualized_vol(r)。少于两期或组合波动率为0时
+    波动率贡献为0.0。
+    Instrument i's contribution on day t is its P&L that day over the previous
+    day's equity, and these sum to the portfolio return that day; the
+    volatility contribution is cov(c_i, r) / σ(r), annualized, and the
+    contributions sum to annualized_vol(r). With fewer than two periods or zero
+    portfolio volatility it is 0.0.
+    
+    Args:
+        result: 带instrument_pnl、equity_curve和initial_cash的回测结果，如EngineResult /
+            Backtest result with instrument_pnl, equity_curve and initial_cash, such as EngineResult
+        freq: 数据频率或每年期数 / Data frequency or periods per year
+    
+    Returns:
+        List[InstrumentContribution]: 每个持有过的标的一项，按收益贡献的绝对值从大到小排列 /
+            One entry per instrument ever held, by absolute return contribution, largest first
+    
+    Raises:
+        ValueError: 期初权益不是正数，或instrument_pnl与equity_curve的索引不一致时抛出 /
+            Raised for a non-positive starting equity, or when instrument_pnl and equity_curve have different indexes
+    
+    Examples:
+        >>> for item in attribution(engine.run(strategy))[:5]:
+        ...     print(item.instrument, f"{item.return_contribution:.2%}")
+    """
+    pnl = pd.DataFrame(result.instrument_pnl, dtype=float)
+    equity = _as_series(result.equity_curve)
+    if pnl.empty or len(pnl.columns) == 0:
+        return []
+    if not pnl.index.equals(equity.index):
+        raise ValueError("instrument_pnl and equity_curve must share the same index")
+    initial = result.initial_cash
+    if initial is None:
+        # 没有期初权益时由首日权益和首日盈亏倒推
+        initial = float(equity.iloc[0] - pnl.iloc[0].sum())
+    if not (math.isfinite(initial) and initial > 0):
+        raise ValueError(f"starting equity must be a positive number, got {initial}")
+    
+    previous = equity.shift(1).fillna(initial).to_numpy(dtype=float)
+    daily = pnl.diff().fillna(pnl.iloc[0]).to_numpy(dtype=float)
+    contributions = daily / previous[:, None]
+    portfolio = contributions.sum(axis=1)
+    vol = float(np.std(portfolio, ddof=1)) if len(portfolio) > 1 else 0.0
+    if vol > 0:
+        covariance = (contributions - contributions.mean(axis=0)).T @ (portfolio - portfolio.mean())
+        marginal = covariance / (len(portfolio) - 1) / vol * math.sqrt(periods_per_year(freq))
+    else:
+        marginal = np.zeros(len(pnl.columns))
+    
+    final = pnl.iloc[-1]
+    items = [
+        InstrumentContribution(
+            instrument=str(code),
+            pnl=float(final[code]),
+            return_contribution=float(final[code]) / initial,
+            volatility_contribution=float(marginal[i])
+        )
+        for i, code in enumerate(pnl.columns)
+    ]
+    items.sort(key=lambda item: abs(item.return_contribution), reverse=True)
+    return items
+
+
+def _capture(strategy: pd.Series, benchmark: pd.Series, mask: pd.Series) -> float:
+    """基准满足条件的期上策略与基准平均收益之比，没有这样的期时为NaN / Mean strategy over mean benchmark return where mask holds; NaN without such periods"""
+    if not mask.any():
+        return math.nan
+    return float(strategy[mask].mean() / benchmark[mask].mean())
+
+
+def _as_series(values: Union[pd.Series, Sequence[float]]) -> pd.Series:
+    """转换为浮点Series / Convert to a float Series"""
+    if isinstance(values, pd.Series):
+        return values.astype(float)
+    return pd.Series(np.asarray(values, dtype=float))
+
+
+def _valid(returns: Union[pd.Series, Sequence[float]]) -> np.ndarray:
+    """去掉NaN后的收益率 / Returns with NaNs removed"""
+    values = _as_series(returns).to_numpy(dtype=float)
+    return values[np.isfinite(values)]
+
+
+def _paired(
+    returns: Union[pd.Series, Sequence[float]],
+    benchmark: Union[pd.Series, Sequence[float]]
+) -> Tuple[np.ndarray, np.ndarray]:
+    """检查对齐并去掉任一方为NaN的期 / Check alignment and drop periods where either side is NaN"""
+    strategy, bench = _as_series(returns), _as_series(benchmark)
+    if len(strategy) != len(bench):
+        raise ValueError(
+            f"returns and benchmark must have equal lengths, got {len(strategy)} and {len(bench)}"
+        )
+    if (
+        isinstance(returns, pd.Series) and isinstance(benchmark, pd.Series)
+        and not strategy.index.equals(bench.index)
+    ):
+        raise ValueError("returns and benchmark must share the same index")
+    left, right = strategy.to_numpy(dtype=float), bench.to_numpy(dtype=float)
+    valid = np.isfinite(left) & np.isfinite(right)
+    return left[valid], right[valid]
+
+
+def _excess(returns: Union[pd.Series, Sequence[float]], rf: float, freq: FreqLike) -> np.ndarray:
+    """每期超额收益 / Per-period excess returns"""
+    return _valid(returns) - rf / periods_per_year(freq)
+
+
+def _pnls(trades: Iterable[Any]) -> np.ndarray:
+    """取出每笔交易的盈亏 / Extract per-trade P&L"""
+    return np.asarray(
+        [getattr(t, "pnl", t) for t in trades],
+        dtype=float
+    )
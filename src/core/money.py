@@ -0,0 +1,217 @@
+"""
+定点金额模块 / Fixed-Point Money Module
+以万分之一为单位的整数表示金额，避免长时间回测中现金余额的浮点误差累积
+Represents money as an integer count of 1e-4 units, so cash balances don't
+pick up float rounding drift over long backtests
+
+价格和数量仍是浮点数，只在进入组合的边界处转换一次：成交金额、手续费和税费按舍入方式
+（默认银行家舍入，即四舍六入五取偶）转换为Money，之后的加减都是精确的整数运算。
+运算结果超出int64范围时抛出MoneyOverflowError。float(money)把金额转换回浮点数，
+用于权益曲线和绩效指标。
+Prices and quantities stay floats and are converted once at the portfolio
+boundary: traded values, commissions and taxes become Money under a
+rounding mode (banker's rounding, half to even, by default), and all sums
+after that are exact integer arithmetic. Results beyond the int64 range
+raise MoneyOverflowError. float(money) converts back for the equity curve
+and the metrics.
+
+Examples:
+    >>> Money.of(0.1) + Money.of(0.2) == Money.of(0.3)
+    True
+    >>> Money.of(1.00005), Money.of(1.00015)
+    (Money('1.0000'), Money('1.0002'))
+"""
+
+from decimal import Decimal, InvalidOperation, ROUND_DOWN, ROUND_HALF_EVEN, ROUND_HALF_UP, ROUND_UP
+from enum import Enum
+from functools import total_ordering
+from typing import Iterable, Union
+
+
+# 每个金额单位为万分之一
+SCALE = 10_000
+DECIMALS = 4
+INT64_MIN = -(2 ** 63)
+INT64_MAX = 2 ** 63 - 1
+
+_QUANTUM = Decimal(1).scaleb(-DECIMALS)
+
+
+class MoneyOverflowError(OverflowError):
+    """金额超出int64范围 / Money outside the int64 range"""
+
+
+class RoundingMode(Enum):
+    """
+    浮点数转换为金额时的舍入方式 / Rounding when a float becomes money
+    
+    HALF_EVEN为银行家舍入，正好一半时取偶数，长期累计没有方向性偏差
+    HALF_EVEN is banker's rounding, taking the even unit on exact halves, so
+    repeated rounding has no directional bias
+    """
+    HALF_EVEN = "half_even"  # 四舍六入五取偶
+    HALF_UP = "half_up"  # 四舍五入，一半时远离0
+    DOWN = "down"  # 向0截断
+    UP = "up"  # 远离0进位
+
+
+_DECIMAL_ROUNDING = {
+    RoundingMode.HALF_EVEN: ROUND_HALF_EVEN,
+    RoundingMode.HALF_UP: ROUND_HALF_UP,
+    RoundingMode.DOWN: ROUND_DOWN,
+    RoundingMode.UP: ROUND_UP,
+}
+
+MoneyLike = Union["Money", int, float, str, Decimal]
+
+
+def _check_range(units: int) -> int:
+    """金额单位数必须在int64范围内 / The unit count must fit in an int64"""
+    if not INT64_MIN <= units <= INT64_MAX:
+        raise MoneyOverflowError(f"money of {units} units (1e-{DECIMALS}) overflows int64")
+    return units
+
+
+@total_ordering
+class Money:
+    """
+    定点金额 / Fixed-point amount of money
+    
+    不可变，支持与Money的加减、比较，与int或float相乘（结果按舍入方式取整）以及取负和绝对值。
+    与浮点数相加需要先用Money.of()显式转换。
+    Immutable; supports addition, subtraction and comparison with Money,
+    multiplication by an int or float (rounded under the rounding mode),
+    negation and abs(). Adding a float takes an explicit Money.of() first.
+    
+    Attributes:
+        units: 以万分之一为单位的整数 / Integer count of 1e-4 units
+    """
+    
+    __slots__ = ("_units",)
+    
+    def __init__(self, units: int = 0):
+        """
+        Args:
+            units: 以万分之一为单位的整数，如Money(12345)表示1.2345 /
+                Integer count of 1e-4 units, e.g. Money(12345) is 1.2345
+        """
+        if isinstance(units, bool) or not isinstance(units, int):
+            raise TypeError(f"units must be an int, got {type(units).__name__}; use Money.of() for amounts")
+        self._units = _check_range(units)
+    
+    @classmethod
+    def of(cls, amount: MoneyLike, rounding: RoundingMode = RoundingMode.HALF_EVEN) -> "Money":
+        """
+        把金额转换为Money / Convert an amount to Money
+        
+        浮点数按其最短的十进制表示转换，因此1.00005视为正好一半，按舍入方式取整
+        A float converts through its shortest decimal form, so 1.00005 counts
+        as an exact half and rounds under the rounding mode
+        
+        Args:
+            amount: 金额，可以是Money、int、float、str或Decimal / Amount as Money, int, float, str or Decimal
+            rounding: 超出万分之一精度时的舍入方式 / Rounding beyond 1e-4
+        
+        Returns:
+            Money: 金额 / Money
+        
+        Raises:
+            ValueError: 金额为NaN、无穷大或无法解析时抛出 / Raised for NaN, infinity or an unparsable amount
+            MoneyOverflowError: 超出int64范围时抛出 / Raised beyond the int64 range
+        """
+        if isinstance(amount, Money):
+            return amount
+        if isinstance(amount, bool):
+            raise TypeError("amount must be a number, got bool")
+        try:
+            value = Decimal(repr(amount)) if isinstance(amount, float) else Decimal(amount)
+        except (InvalidOperation, TypeError, ValueError) as e:
+            raise ValueError(f"invalid amount of money: {amount!r}") from e
+        if not value.is_finite():
+            raise ValueError(f"amount of money must be finite, got {amount!r}")
+        units = value.scaleb(DECIMALS).quantize(Decimal(1), rounding=_DECIMAL_ROUNDING[RoundingMode(rounding)])
+        return cls(int(units))
+    
+    @classmethod
+    def total(cls, amounts: Iterable["Money"]) -> "Money":
+        """精确求和 / Exact sum"""
+        return cls(_check_range(sum(Money.of(a)._units for a in amounts)))
+    
+    @property
+    def units(self) -> int:
+        """以万分之一为单位的整数 / Integer count of 1e-4 units"""
+        return self._units
+    
+    def to_decimal(self) -> Decimal:
+        """精确的十进制值 / Exact decimal value"""
+        return Decimal(self._units).scaleb(-DECIMALS).quantize(_QUANTUM)
+    
+    def times(self, factor: float, rounding: RoundingMode = RoundingMode.HALF_EVEN) -> "Money":
+        """
+        乘以一个系数并取整 / Multiply by a factor and round
+        
+        Args:
+            factor: 系数，如费率 / Factor, such as a fee rate
+            rounding: 舍入方式 / Rounding mode
+        
+        Returns:
+            Money: 乘积 / Product
+        """
+        factor_value = Decimal(repr(factor)) if isinstance(factor, float) else Decimal(factor)
+        return Money.of(self.to_decimal() * factor_value, rounding)
+    
+    def __add__(self, other: "Money") -> "Money":
+        if not isinstance(other, Money):
+            return NotImplemented
+        return Money(_check_range(self._units + other._units))
+    
+    def __sub__(self, other: "Money") -> "Money":
+        if not isinstance(other, Money):
+            return NotImplemented
+        return Money(_check_range(self._units - other._units))
+    
+    def __mul__(self, factor: Union[int, float]) -> "Money":
+        if isinstance(factor, bool) or not isinstance(factor, (int, float)):
+            return NotImplemented
+        if isinstance(factor, int):
+            return Money(_check_range(self._units * factor))
+        return self.times(factor)
+    
+    __rmul__ = __mul__
+    
+    def __neg__(self) -> "Money":
+        return Money(_check_range(-self._units))
+    
+    def __abs__(self) -> "Money":
+        return Money(_check_range(abs(self._units)))
+    
+    def __eq__(self, other) -> bool:
+        if not isinstance(other, Money):
+            return NotImplemented
+        return self._units == other._units
+    
+    def __lt__(self, other: "Money") -> bool:
+        if not isinstance(other, Money):
+            return NotImplemented
+        return self._units < other._units
+    
+    def __hash__(self) -> int:
+        return hash(self._units)
+    
+    def __bool__(self) -> bool:
+        return self._units != 0
+    
+    def __float__(self) -> float:
+        return self._units / SCALE
+    
+    def __str__(self) -> str:
+        return str(self.to_decimal())
+    
+    def __repr__(self) -> str:
+        return f"Money('{self}')"
+    
+    def __reduce__(self):
+        return (Money, (self._units,))
+
+
+ZERO = Money(0)
@@ -0,0 +1,1114 @@
+"""
+组合核算模块 / Portfolio Accounting Module
+记录现金、持仓和平均成本，区分已实现和未实现盈亏，可独立于回测引擎手动模拟成交
+Tracks cash, positions and average cost and separates realized from
+unrealized P&L; usable on its own to simulate fills by hand, independent of
+the backtest engine
+
+持仓采用平均成本法：同方向加仓时按数量加权更新平均成本，减仓时按平均成本
+结算已实现盈亏且平均成本不变，从多头直接卖成空头（或反之）时先平掉原有持仓，
+剩余部分以成交价作为新的平均成本。空头持仓数量为负数。手续费从现金中扣除并
+单独累计，不计入已实现盈亏。
+Positions use average-cost accounting: adding in the same direction updates
+the quantity-weighted average cost, reducing realizes P&L against the average
+cost and leaves it unchanged, and a fill that crosses from long to short (or
+back) first closes the existing position and opens the remainder at the fill
+price. Short positions have negative quantities. Commissions come out of cash
+and are accumulated separately rather than in realized P&L.
+
+也可以选择先进先出法（CostBasis.FIFO）：每次开仓记为一个批次，减仓时从最早的批次开始
+结算，平均成本为剩余批次的加权平均。每次结算都记入已实现盈亏明细（ledger）。
+组合可以通过to_json()/from_json()保存和恢复，便于在实盘会话之间延续状态。
+First-in-first-out accounting (CostBasis.FIFO) is available too: every
+opening fill becomes a lot, reductions settle against the oldest lots first,
+and the average cost is the weighted average of the remaining lots. Every
+settlement is recorded in the realized P&L ledger. A portfolio can be saved
+and restored with to_json()/from_json() to carry state across live sessions.
+
+已注册期货品种的合约（见futures模块）按保证金交易：开仓不支付名义价值，只要求权益减去
+已占用保证金后足以支付新开仓位的保证金和手续费；盈亏按合约乘数计算，平仓盈亏计入现金，
+持仓按未实现盈亏计入权益。期货总是可以开空仓，不受allow_short限制。
+Contracts of a registered futures product (see the futures module) trade on
+margin: opening pays no notional, it only needs equity less the margin in
+use to cover the new position's margin and commission. P&L is scaled by the
+contract multiplier, closed P&L goes to cash, and open positions count
+toward equity by their unrealized P&L. Futures can always be sold short,
+whatever allow_short says.
+
+现金、初始现金和累计手续费以定点金额（见money模块）记账：成交金额、手续费和期货平仓盈亏在
+记入时按rounding舍入到万分之一元，之后的累加都是精确的，因此任何一串最终平仓的成交之后，
+现金都正好等于初始现金减去全部费用再加上已实现盈亏。cash、commissions和equity仍返回浮点数。
+Cash, starting cash and commissions are kept as fixed-point money (see the
+money module): traded values, commissions and futures closed P&L are
+rounded to 1e-4 under rounding as they are booked and summed exactly after
+that, so after any run of fills that ends flat, cash is exactly starting
+cash less all costs plus realized P&L. cash, commissions and equity still
+return floats.
+
+组合以base_currency记账，标的的计价货币见currency模块。外币标的的成交价、手续费和估值价格在
+记入时按set_fx_rates()或mark_to_market()给出的最新汇率折算为基准货币，因此平均成本、已实现
+盈亏（含汇兑损益）和权益都以基准货币计；没有汇率时外币标的不能成交或估值。
+The portfolio keeps its books in base_currency; see the currency module for
+instruments' quote currencies. Fill prices, commissions and marks of
+foreign-currency instruments are converted into the base currency at the
+latest rate given to set_fx_rates() or mark_to_market() as they are booked,
+so average costs, realized P&L (FX gains included) and equity are all in
+the base currency; without a rate a foreign instrument can't be traded or marked.
+
+公司行为通过pay_dividend()和split()记入：现金分红（扣除代扣税后）计入现金并单独累计在dividends中，
+拆股按比例调整持仓数量、平均成本和批次，不影响现金和盈亏。
+Corporate actions are booked through pay_dividend() and split(): a cash
+dividend, net of withholding tax, goes to cash and accumulates separately in
+dividends, and a split rescales the quantity, average cost and lots without
+touching cash or P&L.
+"""
+
+import json
+import math
+from dataclasses import dataclass, field, replace
+from datetime import datetime
+from enum import Enum
+from typing import Any, Dict, Iterable, List, Mapping, Optional, Set, Tuple
+
+from .currency import BASE_CURRENCY, FXRateUnavailableError, get_currency
+from .futures import get_futures_spec
+from .money import ZERO, Money, RoundingMode
+from ..utils.error_handler import (
+    BacktestError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+# 数量和金额比较时允许的浮点误差
+_EPSILON = 1e-9
+
+
+class InsufficientCashError(BacktestError):
+    """
+    现金不足错误 / Insufficient cash error
+    
+    买入金额加手续费超过可用现金时抛出
+    Raised when a buy plus its commission costs more than the available cash
+    """
+    
+    def __init__(self, instrument: str, required: float, available: float):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            required: 需要的现金 / Cash required
+            available: 可用现金 / Cash available
+        """
+        self.required = required
+        self.available = available
+        error_info = ErrorInfo(
+            error_code="BCK0004",
+            error_message_zh=f"现金不足: 买入{instrument}需要{required:.2f}, 可用{available:.2f}",
+            error_message_en=f"Insufficient cash to buy {instrument}: need {required:.2f}, have {available:.2f}",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.LOW,
+            technical_details=f"instrument={instrument}, required={required}, available={available}",
+            suggested_actions=["减少买入数量", "先卖出其他持仓释放现金"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class ShortSellingError(BacktestError):
+    """
+    禁止做空错误 / Short selling not allowed error
+    
+    未开启allow_short时卖出数量超过多头持仓时抛出
+    Raised when a sell exceeds the long position and allow_short is off
+    """
+    
+    def __init__(self, instrument: str, quantity: float, held: float):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            quantity: 卖出数量 / Quantity to sell
+            held: 当前持仓 / Quantity held
+        """
+        self.quantity = quantity
+        self.held = held
+        error_info = ErrorInfo(
+            error_code="BCK0005",
+            error_message_zh=f"持仓不足且未允许做空: 卖出{instrument} {quantity}, 持有{held}",
+            error_message_en=f"Selling {quantity} {instrument} with {held} held would go short, which is not allowed",
+            category=ErrorCategory.BACKTEST,
+            severity=ErrorSeverity.LOW,
+            technical_details=f"instrument={instrument}, quantity={quantity}, held={held}",
+            suggested_actions=["卖出数量不超过持仓", "如需做空，创建组合时设置allow_short=True"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class CostBasis(Enum):
+    """成本核算方法 / Cost basis method"""
+    AVERAGE = "average"  # 加权平均成本
+    FIFO = "fifo"  # 先进先出
+
+
+@dataclass(frozen=True)
+class Lot:
+    """
+    先进先出法下的开仓批次 / Open lot under FIFO accounting
+    
+    Attributes:
+        quantity: 剩余数量，总为正数，方向与持仓一致 / Remaining quantity, always positive, in the position's direction
+        price: 开仓价 / Opening price
+    """
+    quantity: float
+    price: float
+
+
+@dataclass(frozen=True)
+class RealizedPnL:
+    """
+    一次结算的已实现盈亏明细 / Ledger entry of one settlement
+    
+    平均成本法下每笔减仓成交一条；先进先出法下每个被结算的批次一条
+    One entry per reducing fill with average cost; one per settled lot with FIFO
+    
+    Attributes:
+        time: 成交时间，未提供时为None / Fill time, None when not given
+        instrument: 标的代码 / Instrument code
+        quantity: 平掉的持仓数量，平空头时为负数 / Quantity closed, negative when closing a short
+        open_price: 开仓成本 / Opening cost
+        close_price: 平仓价 / Closing price
+        pnl: 已实现盈亏（不含手续费） / Realized P&L excluding commissions
+    """
+    time: Optional[datetime]
+    instrument: str
+    quantity: float
+    open_price: float
+    close_price: float
+    pnl: float
+
+
+@dataclass
+class Position:
+    """
+    单个标的的持仓 / Position in one instrument
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        quantity: 持仓数量，空头为负数 / Quantity held, negative when short
+        avg_cost: 平均成本，空仓时为0 / Average cost, 0 when flat
+        realized_pnl: 该标的累计已实现盈亏（不含手续费） / Realized P&L to date, excluding commissions
+        last_price: 最近一次估值价格，未估值时为None / Latest mark price, None before the first mark
+        lots: 先进先出法下的开仓批次，从早到晚排列；平均成本法下为空 /
+            Open lots under FIFO, oldest first; empty with average cost
+        multiplier: 合约乘数，股票为1 / Contract multiplier, 1 for stocks
+        margin_rate: 期货的保证金比例，股票为None / Margin rate of futures, None for stocks
+        currency: 标的的计价货币；价格和盈亏已折算为组合的基准货币 /
+            Quote currency of the instrument; prices and P&L are already in the portfolio's base currency
+        fees: 该标的累计支付的手续费和税费 / Commissions and taxes paid on the instrument to date
+        dividends: 该标的累计记入现金的税后分红，空头支付的分红为负数 /
+            After-tax dividends booked to cash to date, negative for dividends a short paid over
+    """
+    instrument: str
+    quantity: float = 0.0
+    avg_cost: float = 0.0
+    realized_pnl: float = 0.0
+    last_price: Optional[float] = None
+    lots: List[Lot] = field(default_factory=list)
+    multiplier: float = 1.0
+    margin_rate: Optional[float] = None
+    currency: str = BASE_CURRENCY
+    fees: float = 0.0
+    dividends: float = 0.0
+    
+    @property
+    def is_flat(self) -> bool:
+        """是否空仓 / Whether there is no position"""
+        return abs(self.quantity) <= _EPSILON
+    
+    @property
+    def is_futures(self) -> bool:
+        """是否为保证金交易的期货持仓 / Whether this is a futures position traded on margin"""
+        return self.margin_rate is not None
+    
+    @property
+    def mark(self) -> float:
+        """估值价格，未估值时使用平均成本 / Mark price; the average cost before the first mark"""
+        return self.avg_cost if self.last_price is None else self.last_price
+    
+    @property
+    def market_value(self) -> float:
+        """持仓市值，期货为名义价值，空头为负数 / Market value, the notional for futures, negative when short"""
+        return self.quantity * self.mark * self.multiplier
+    
+    @property
+    def unrealized_pnl(self) -> float:
+        """未实现盈亏 / Unrealized P&L"""
+        return self.quantity * (self.mark - self.avg_cost) * self.multiplier
+    
+    @property
+    def margin(self) -> float:
+        """按估值价格占用的保证金，股票为0 / Margin held at the mark price, 0 for stocks"""
+        if self.margin_rate is None:
+            return 0.0
+        return abs(self.market_value) * self.margin_rate
+    
+    @property
+    def equity_value(self) -> float:
+        """计入权益的价值：股票为市值，期货为未实现盈亏 / Value counted in equity: market value for stocks, unrealized P&L for futures"""
+        return self.unrealized_pnl if self.is_futures else self.market_value
+    
+    @property
+    def total_pnl(self) -> float:
+        """已实现加未实现盈亏减费用再加分红 / Realized plus unrealized P&L less fees plus dividends"""
+        return self.realized_pnl + self.unrealized_pnl - self.fees + self.dividends
+
+
+class Portfolio:
+    """
+    组合 / Portfolio
+    
+    成交通过buy()/sell()或apply_fill()逐笔记入，部分成交即为多次调用；mark_to_market()更新
+    估值价格。买入不允许透支现金；allow_short为False时卖出不能超过多头持仓。
+    Fills are booked one at a time through buy()/sell() or apply_fill(), so a
+    partial fill is just one more call; mark_to_market() updates the mark
+    prices. Buys may not overdraw cash, and sells may not exceed the long
+    position unless allow_short is set.
+    
+    Examples:
+        >>> portfolio = Portfolio(100000.0)
+        >>> portfolio.buy("SH600000", 1000, 10.0)
+        0.0
+        >>> portfolio.mark_to_market({"SH600000": 10.5})
+        >>> portfolio.unrealized_pnl()
+        500.0
+    """
+    
+    def __init__(
+        self,
+        cash: float,
+        allow_short: bool = False,
+        cost_basis: CostBasis = CostBasis.AVERAGE,
+        rounding: RoundingMode = RoundingMode.HALF_EVEN,
+        base_currency: str = BASE_CURRENCY
+    ):
+        """
+        初始化组合 / Initialize portfolio
+        
+        Args:
+            cash: 初始现金（基准货币），可以是Money / Starting cash in the base currency, possibly as Money
+            allow_short: 是否允许卖出超过持仓（做空） / Whether sells beyond the position (shorts) are allowed
+            cost_basis: 成本核算方法，可传"average"/"fifo" / Cost basis; "average"/"fifo" are accepted
+            rounding: 金额记入现金时的舍入方式，默认银行家舍入 / Rounding as amounts reach cash, banker's rounding by default
+            base_currency: 记账的基准货币 / Currency the books are kept in
+        """
+        if not isinstance(cash, Money) and not math.isfinite(cash):
+            raise ValueError(f"cash must be a non-negative number, got {cash}")
+        self._rounding = RoundingMode(rounding)
+        self._cash = Money.of(cash, self._rounding)
+        if self._cash < ZERO:
+            raise ValueError(f"cash must be a non-negative number, got {cash}")
+        self._initial_cash = self._cash
+        self._allow_short = allow_short
+        self._cost_basis = CostBasis(cost_basis)
+        self._positions: Dict[str, Position] = {}
+        self._marks: Dict[str, float] = {}
+        self._commissions = ZERO
+        self._dividends = ZERO
+        self._ledger: List[RealizedPnL] = []
+        self._base_currency = base_currency.upper()
+        self._fx_rates: Dict[str, float] = {}
+        self._illiquid: Set[str] = set()
+    
+    @property
+    def cash(self) -> float:
+        """可用现金 / Available cash"""
+        return float(self._cash)
+    
+    @property
+    def cash_money(self) -> Money:
+        """可用现金的精确金额 / Exact amount of available cash"""
+        return self._cash
+    
+    @property
+    def initial_cash(self) -> float:
+        """初始现金 / Starting cash"""
+        return float(self._initial_cash)
+    
+    @property
+    def rounding(self) -> RoundingMode:
+        """金额的舍入方式 / Rounding mode of amounts"""
+        return self._rounding
+    
+    @property
+    def base_currency(self) -> str:
+        """记账的基准货币 / Currency the books are kept in"""
+        return self._base_currency
+    
+    @property
+    def fx_rates(self) -> Dict[str, float]:
+        """各外币兑基准货币的最新汇率 / Latest rate of each foreign currency into the base currency"""
+        return dict(self._fx_rates)
+    
+    @property
+    def allow_short(self) -> bool:
+        """是否允许做空 / Whether shorting is allowed"""
+        return self._allow_short
+    
+    @property
+    def cost_basis(self) -> CostBasis:
+        """成本核算方法 / Cost basis method"""
+        return self._cost_basis
+    
+    @property
+    def ledger(self) -> List[RealizedPnL]:
+        """已实现盈亏明细，按结算顺序排列 / Realized P&L entries in settlement order"""
+        return list(self._ledger)
+    
+    @property
+    def commissions(self) -> float:
+        """累计手续费 / Commissions paid to date"""
+        return float(self._commissions)
+    
+    @property
+    def commissions_money(self) -> Money:
+        """累计手续费的精确金额 / Exact amount of commissions paid to date"""
+        return self._commissions
+    
+    @property
+    def dividends(self) -> float:
+        """累计收到的税后现金分红，空头支付的分红为负数 / Net cash dividends received, negative for those paid on shorts"""
+        return float(self._dividends)
+    
+    @property
+    def positions(self) -> Dict[str, float]:
+        """非零持仓的数量 / Quantities of the non-zero positions"""
+        return {code: p.quantity for code, p in self._positions.items() if not p.is_flat}
+    
+    @property
+    def holdings(self) -> Dict[str, Position]:
+        """非零持仓的明细（副本） / Details of the non-zero positions (copies)"""
+        return {code: _copy_position(p) for code, p in self._positions.items() if not p.is_flat}
+    
+    @property
+    def illiquid(self) -> List[str]:
+        """
+        流动性不足的非零持仓 / Non-zero positions that are illiquid
+        
+        即最近一次mark_to_market()时不能成交（如停牌）的标的，按最后成交价估值
+        Instruments that could not trade (e.g. suspended) at the latest
+        mark_to_market(), valued at their last traded price
+        """
+        return sorted(code for code in self._illiquid if code in self.positions)
+    
+    def is_illiquid(self, instrument: str) -> bool:
+        """
+        标的是否流动性不足 / Whether an instrument is illiquid
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            bool: 最近一次mark_to_market()时不能成交时返回True / True when it could not trade at the latest mark_to_market()
+        """
+        return instrument in self._illiquid
+    
+    @property
+    def market_value(self) -> float:
+        """持仓总市值，期货按名义价值 / Total market value of the positions, futures at their notional"""
+        return sum(p.market_value for p in self._positions.values())
+    
+    @property
+    def margin(self) -> float:
+        """期货持仓占用的保证金 / Margin held by the futures positions"""
+        return sum(p.margin for p in self._positions.values())
+    
+    @property
+    def equity(self) -> float:
+        """现金加股票市值和期货未实现盈亏 / Cash plus stock market value and futures unrealized P&L"""
+        return float(self._cash) + sum(p.equity_value for p in self._positions.values())
+    
+    def currency_exposure(self) -> Dict[str, float]:
+        """
+        按计价货币汇总的持仓市值 / Market value of the positions summed by quote currency
+        
+        Returns:
+            Dict[str, float]: 货币代码到折算为基准货币的市值，期货按名义价值，空头为负数 /
+                Currency code to market value in the base currency, futures at their notional, shorts negative
+        """
+        exposure: Dict[str, float] = {}
+        for p in self._positions.values():
+            if not p.is_flat:
+                exposure[p.currency] = exposure.get(p.currency, 0.0) + p.market_value
+        return exposure
+    
+    def fx_rate(self, instrument: str) -> float:
+        """
+        标的计价货币兑基准货币的最新汇率 / Latest rate of the instrument's currency into the base currency
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            float: 汇率，计价货币为基准货币时为1 / The rate; 1 when the instrument is in the base currency
+        
+        Raises:
+            FXRateUnavailableError: 还没有给出该货币的汇率时抛出 / Raised before a rate for the currency is given
+        """
+        currency = get_currency(instrument)
+        if currency == self._base_currency:
+            return 1.0
+        rate = self._fx_rates.get(currency)
+        if rate is None:
+            raise FXRateUnavailableError(f"{currency}{self._base_currency}")
+        return rate
+    
+    def set_fx_rates(self, rates: Mapping[str, float]) -> None:
+        """
+        更新外币兑基准货币的汇率 / Update the rates of foreign currencies into the base currency
+        
+        之后的成交和估值按新汇率折算，已记入的成本不变
+        Later fills and marks convert at the new rates; costs already booked stay as they are
+        
+        Args:
+            rates: 货币代码到每单位该货币兑换的基准货币 / Currency code to base-currency units per unit
+        
+        Raises:
+            ValueError: 汇率不是正数时抛出 / Raised for a rate that isn't a positive number
+        """
+        for currency, rate in rates.items():
+            if not (math.isfinite(rate) and rate > 0):
+                raise ValueError(f"FX rate of {currency} must be a positive number, got {rate}")
+            if currency.upper() != self._base_currency:
+                self._fx_rates[currency.upper()] = float(rate)
+    
+    def position(self, instrument: str) -> float:
+        """
+        获取单个标的的持仓数量 / Get the quantity held in one instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            float: 持仓数量，空头为负数，未持有时为0 / Quantity, negative when short, 0 when flat
+        """
+        position = self._positions.get(instrument)
+        return 0.0 if position is None else position.quantity
+    
+    def holding(self, instrument: str) -> Optional[Position]:
+        """
+        获取单个标的的持仓明细 / Get the position details of one instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            Optional[Position]: 持仓明细的副本，从未交易过时为None /
+                Copy of the position, None when the instrument was never traded
+        """
+        position = self._positions.get(instrument)
+        return None if position is None else _copy_position(position)
+    
+    def avg_cost(self, instrument: str) -> float:
+        """
+        获取平均成本 / Get the average cost
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            float: 平均成本，空仓时为0 / Average cost, 0 when flat
+        """
+        position = self._positions.get(instrument)
+        return 0.0 if position is None else position.avg_cost
+    
+    def realized_pnl(self, instrument: Optional[str] = None) -> float:
+        """
+        已实现盈亏（不含手续费） / Realized P&L excluding commissions
+        
+        Args:
+            instrument: 标的代码，None表示全部标的 / Instrument code; None for all instruments
+        
+        Returns:
+            float: 已实现盈亏 / Realized P&L
+        """
+        if instrument is not None:
+            position = self._positions.get(instrument)
+            return 0.0 if position is None else position.realized_pnl
+        return sum(p.realized_pnl for p in self._positions.values())
+    
+    def unrealized_pnl(self, instrument: Optional[str] = None) -> float:
+        """
+        按最近估值价格计算的未实现盈亏 / Unrealized P&L at the latest marks
+        
+        Args:
+            instrument: 标的代码，None表示全部标的 / Instrument code; None for all instruments
+        
+        Returns:
+            float: 未实现盈亏 / Unrealized P&L
+        """
+        if instrument is not None:
+            position = self._positions.get(instrument)
+            return 0.0 if position is None else position.unrealized_pnl
+        return sum(p.unrealized_pnl for p in self._positions.values())
+    
+    @property
+    def total_pnl(self) -> float:
+        """已实现加未实现盈亏减手续费再加分红，等于权益减初始现金 /
+        Realized plus unrealized P&L less commissions plus dividends; equals equity minus starting cash"""
+        return self.realized_pnl() + self.unrealized_pnl() - float(self._commissions) + float(self._dividends)
+    
+    def pnl_by_instrument(self) -> Dict[str, float]:
+        """
+        每个持有过的标的的总盈亏 / Total P&L of each instrument ever held
+        
+        已实现加未实现盈亏减该标的的费用再加分红，各标的之和等于total_pnl
+        Realized plus unrealized P&L less the instrument's fees plus its
+        dividends; the values sum to total_pnl
+        
+        Returns:
+            Dict[str, float]: 标的代码到基准货币的盈亏，包括已经平仓的标的 /
+                Instrument code to P&L in the base currency, flat instruments included
+        """
+        return {code: p.total_pnl for code, p in self._positions.items()}
+    
+    def apply_fill(self, fill: Any) -> float:
+        """
+        记入一笔成交记录 / Book a fill record
+        
+        税费（可选的tax属性）与手续费一起计入费用
+        Taxes (the optional tax attribute) are charged together with the commission
+        
+        Args:
+            fill: 带instrument、side（"buy"/"sell"或OrderSide）、quantity、price、commission和time
+                属性的成交，如backtest_engine.Fill / Fill with instrument, side ("buy"/"sell" or
+                OrderSide), quantity, price, commission and time attributes, such as backtest_engine.Fill
+        
+        Returns:
+            float: 本笔成交的已实现盈亏 / Realized P&L of this fill
+        
+        Raises:
+            InsufficientCashError: 买入现金不足时抛出 / Raised when a buy lacks cash
+            ShortSellingError: 未允许做空且卖出超过多头持仓时抛出 / Raised when a sell would go short without allow_short
+        """
+        side = getattr(fill.side, "value", fill.side)
+        commission = getattr(fill, "commission", 0.0) + getattr(fill, "tax", 0.0)
+        time = getattr(fill, "time", None)
+        if side == "buy":
+            return self.buy(fill.instrument, fill.quantity, fill.price, commission, time)
+        if side == "sell":
+            return self.sell(fill.instrument, fill.quantity, fill.price, commission, time)
+        raise ValueError(f"fill side must be 'buy' or 'sell', got {fill.side!r}")
+    
+    def buy(
+        self,
+        instrument: str,
+        quantity: float,
+        price: float,
+        commission: float = 0.0,
+        time: Optional[datetime] = None
+    ) -> float:
+        """
+        记入一笔买入成交 / Book a buy fill
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            quantity: 成交数量 / Filled quantity
+            price: 成交价 / Fill price
+            commission: 手续费 / Commission
+            time: 成交时间，记入已实现盈亏明细 / Fill time, recorded in the ledger
+        
+        Returns:
+            float: 本笔成交的已实现盈亏（回补空头时非零） / Realized P&L of this fill (non-zero when covering a short)
+        
+        Raises:
+            InsufficientCashError: 现金不足时抛出，期货为可用保证金不足，组合保持不变 /
+                Raised on insufficient cash, or free margin for futures; the portfolio is unchanged
+        """
+        _check_fill(quantity, price, commission)
+        rate = self.fx_rate(instrument)
+        price, commission = price * rate, commission * rate
+        if get_futures_spec(instrument) is not None:
+            return self._trade_futures(instrument, quantity, price, commission, time)
+        fee = self._money(commission)
+        cost = self._money(quantity * price) + fee
+        if cost > self._cash:
+            raise InsufficientCashError(instrument, float(cost), float(self._cash))
+        self._cash -= cost
+        self._commissions += fee
+        realized = self._book(instrument, quantity, price, time)
+        self._positions[instrument].fees += float(fee)
+        return realized
+    
+    def sell(
+        self,
+        instrument: str,
+        quantity: float,
+        price: float,
+        commission: float = 0.0,
+        time: Optional[datetime] = None
+    ) -> float:
+        """
+        记入一笔卖出成交 / Book a sell fill
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            quantity: 成交数量 / Filled quantity
+            price: 成交价 / Fill price
+            commission: 手续费 / Commission
+            time: 成交时间，记入已实现盈亏明细 / Fill time, recorded in the ledger
+        
+        Returns:
+            float: 本笔成交的已实现盈亏 / Realized P&L of this fill
+        
+        Raises:
+            ShortSellingError: 未允许做空且卖出超过多头持仓时抛出，组合保持不变 /
+                Raised when selling beyond the long position without allow_short; the portfolio is unchanged
+            InsufficientCashError: 期货开空仓的可用保证金不足时抛出 / Raised when a futures short lacks free margin
+        """
+        _check_fill(quantity, price, commission)
+        rate = self.fx_rate(instrument)
+        price, commission = price * rate, commission * rate
+        if get_futures_spec(instrument) is not None:
+            return self._trade_futures(instrument, -quantity, price, commission, time)
+        held = self.position(instrument)
+        if not self._allow_short and quantity > max(held, 0.0) + _EPSILON:
+            raise ShortSellingError(instrument, quantity, held)
+        fee = self._money(commission)
+        self._cash += self._money(quantity * price) - fee
+        self._commissions += fee
+        realized = self._book(instrument, -quantity, price, time)
+        self._positions[instrument].fees += float(fee)
+        return realized
+    
+    def settle(self, instrument: str, price: float, time: Optional[datetime] = None) -> float:
+        """
+        按结算价了结全部持仓，如退市结算 / Close out the whole position at a settlement price, e.g. on delisting
+        
+        结算不收手续费、不检查现金，结算价可以为0（全部损失）
+        Settlement charges no commission, skips the cash check and may be at a
+        price of 0 (a total loss)
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            price: 结算价 / Settlement price
+            time: 结算时间，记入已实现盈亏明细 / Settlement time, recorded in the ledger
+        
+        Returns:
+            float: 结算的已实现盈亏，未持有时为0 / Realized P&L of the settlement, 0 when flat
+        
+        Raises:
+            ValueError: 结算价为负数或标的为期货时抛出 / Raised for a negative price or a futures contract
+        """
+        if not (math.isfinite(price) and price >= 0):
+            raise ValueError(f"settlement price must be a non-negative number, got {price}")
+        if get_futures_spec(instrument) is not None:
+            raise ValueError(f"{instrument} is a futures contract and can't be settled as a delisting")
+        held = self.position(instrument)
+        if held == 0:
+            return 0.0
+        price *= self.fx_rate(instrument)
+        self._cash += self._money(held * price)
+        position = self._positions[instrument]
+        position.last_price = float(price)
+        self._marks[instrument] = float(price)
+        return self._book(instrument, -held, price, time)
+    
+    def pay_dividend(self, instrument: str, per_share: float, tax_rate: float = 0.0) -> Tuple[float, float]:
+        """
+        按当前持仓记入现金分红 / Book a cash dividend on the current position
+        
+        多头收到分红并按tax_rate代扣税款；空头向出借人支付全额分红，不涉及税款
+        A long position receives the dividend less tax_rate withheld; a short
+        pays the full dividend over to the lender, with no tax involved
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            per_share: 每股税前分红，以计价货币表示 / Pre-tax dividend per share in the quote currency
+            tax_rate: 代扣税率，如0.1 / Withholding tax rate, e.g. 0.1
+        
+        Returns:
+            Tuple[float, float]: (记入现金的金额, 代扣的税款)，均为基准货币，未持有时为(0, 0) /
+                (amount booked to cash, tax withheld), both in the base currency; (0, 0) when flat
+        
+        Raises:
+            ValueError: 分红为负数、税率不在[0, 1]内或标的为期货时抛出 /
+                Raised for a negative dividend, a tax rate outside [0, 1] or a futures contract
+        """
+        if not (math.isfinite(per_share) and per_share >= 0):
+            raise ValueError(f"dividend per share must be a non-negative number, got {per_share}")
+        if not 0 <= tax_rate <= 1:
+            raise ValueError(f"tax_rate must be in [0, 1], got {tax_rate}")
+        if get_futures_spec(instrument) is not None:
+            raise ValueError(f"{instrument} is a futures contract and pays no dividend")
+        held = self.position(instrument)
+        if held == 0:
+            return 0.0, 0.0
+        gross = self._money(held * per_share * self.fx_rate(instrument))
+        tax = self._money(float(gross) * tax_rate) if held > 0 else ZERO
+        self._cash += gross - tax
+        self._dividends += gross - tax
+        self._positions[instrument].dividends += float(gross - tax)
+        return float(gross - tax), float(tax)
+    
+    def split(self, instrument: str, ratio: float) -> float:
+        """
+        按拆股比例调整持仓 / Rescale a position by a split ratio
+        
+        持仓数量乘以ratio，平均成本、批次价格和估值价格除以ratio，持仓市值、现金和盈亏不变
+        The quantity is multiplied by ratio and the average cost, lot prices
+        and mark divided by it, leaving market value, cash and P&L unchanged
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            ratio: 每股变为几股 / New shares per share
+        
+        Returns:
+            float: 调整后的持仓数量 / Quantity after the split
+        
+        Raises:
+            ValueError: 比例不是正数或标的为期货时抛出 / Raised for a non-positive ratio or a futures contract
+        """
+        if not (math.isfinite(ratio) and ratio > 0):
+            raise ValueError(f"split ratio must be a positive number, got {ratio}")
+        if get_futures_spec(instrument) is not None:
+            raise ValueError(f"{instrument} is a futures contract and can't be split")
+        position = self._positions.get(instrument)
+        if instrument in self._marks:
+            self._marks[instrument] /= ratio
+        if position is None:
+            return 0.0
+        position.quantity *= ratio
+        position.avg_cost /= ratio
+        position.lots = [Lot(lot.quantity * ratio, lot.price / ratio) for lot in position.lots]
+        if position.last_price is not None:
+            position.last_price /= ratio
+        return position.quantity
+    
+    def mark_to_market(
+        self,
+        prices: Mapping[str, float],
+        fx_rates: Optional[Mapping[str, float]] = None,
+        illiquid: Optional[Iterable[str]] = None
+    ) -> None:
+        """
+        更新估值价格 / Update the mark prices
+        
+        Args:
+            prices: 标的代码到以计价货币表示的价格，NaN和非正数价格被忽略 /
+                Instrument code to price in its quote currency; NaN and non-positive prices are ignored
+            fx_rates: 先传给set_fx_rates()的汇率，None表示沿用已有汇率 /
+                Rates passed to set_fx_rates() first; None keeps the current ones
+            illiquid: 当前不能成交的标的，替换之前的标记；这些标的的价格被忽略，沿用最后成交价估值。
+                None表示沿用已有标记 / Instruments that can't trade now, replacing the
+                previous flags; their prices are ignored so they stay at the last
+                traded price. None keeps the current flags
+        
+        Raises:
+            FXRateUnavailableError: 外币标的没有汇率时抛出 / Raised when a foreign instrument has no rate
+        """
+        if fx_rates is not None:
+            self.set_fx_rates(fx_rates)
+        if illiquid is not None:
+            self._illiquid = set(illiquid)
+        for code, price in prices.items():
+            if price is None or not math.isfinite(price) or price <= 0 or code in self._illiquid:
+                continue
+            price = price * self.fx_rate(code)
+            self._marks[code] = float(price)
+            position = self._positions.get(code)
+            if position is not None:
+                position.last_price = float(price)
+    
+    def copy(self) -> "Portfolio":
+        """返回独立的副本 / Return an independent copy"""
+        other = Portfolio(
+            self._initial_cash, self._allow_short, self._cost_basis, self._rounding, self._base_currency
+        )
+        other._fx_rates = dict(self._fx_rates)
+        other._cash = self._cash
+        other._commissions = self._commissions
+        other._dividends = self._dividends
+        other._marks = dict(self._marks)
+        other._positions = {code: _copy_position(p) for code, p in self._positions.items()}
+        other._ledger = list(self._ledger)
+        other._illiquid = set(self._illiquid)
+        return other
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """
+        转为可JSON序列化的字典 / Convert to a JSON-serializable dict
+        
+        包括已经平仓的标的，以保留其已实现盈亏；金额保存为精确的十进制字符串 /
+        Flat instruments are kept for their realized P&L; amounts are saved as exact decimal strings
+        """
+        return {
+            "cash": str(self._cash),
+            "initial_cash": str(self._initial_cash),
+            "allow_short": self._allow_short,
+            "cost_basis": self._cost_basis.value,
+            "rounding": self._rounding.value,
+            "base_currency": self._base_currency,
+            "fx_rates": dict(self._fx_rates),
+            "commissions": str(self._commissions),
+            "dividends": str(self._dividends),
+            "marks": dict(self._marks),
+            "positions": [
+                {
+                    "instrument": p.instrument,
+                    "quantity": p.quantity,
+                    "avg_cost": p.avg_cost,
+                    "realized_pnl": p.realized_pnl,
+                    "last_price": p.last_price,
+                    "lots": [[lot.quantity, lot.price] for lot in p.lots],
+                    "multiplier": p.multiplier,
+                    "margin_rate": p.margin_rate,
+                    "currency": p.currency,
+                    "fees": p.fees,
+                    "dividends": p.dividends,
+                }
+                for p in self._positions.values()
+            ],
+            "ledger": [
+                {
+                    "time": None if e.time is None else e.time.isoformat(),
+                    "instrument": e.instrument,
+                    "quantity": e.quantity,
+                    "open_price": e.open_price,
+                    "close_price": e.close_price,
+                    "pnl": e.pnl,
+                }
+                for e in self._ledger
+            ],
+            "illiquid": sorted(self._illiquid),
+        }
+    
+    @classmethod
+    def from_dict(cls, data: Mapping[str, Any]) -> "Portfolio":
+        """
+        从to_dict()的结果恢复组合 / Restore a portfolio from to_dict() output
+        
+        旧版本把金额保存为浮点数，同样可以恢复 / Older versions saved amounts as floats, which restore too
+        
+        Raises:
+            ValueError: 缺少字段或取值无效时抛出 / Raised on a missing field or invalid value
+        """
+        try:
+            rounding = RoundingMode(data.get("rounding", RoundingMode.HALF_EVEN.value))
+            portfolio = cls(
+                Money.of(data["initial_cash"], rounding), data["allow_short"], data["cost_basis"], rounding,
+                data.get("base_currency", BASE_CURRENCY)
+            )
+            portfolio._fx_rates = {code: float(rate) for code, rate in data.get("fx_rates", {}).items()}
+            portfolio._cash = Money.of(data["cash"], rounding)
+            portfolio._commissions = Money.of(data["commissions"], rounding)
+            portfolio._dividends = Money.of(data.get("dividends", 0), rounding)
+            portfolio._marks = {code: float(price) for code, price in data["marks"].items()}
+            for item in data["positions"]:
+                # 旧版本保存的组合没有乘数和保证金比例，按品种补上
+                default = _new_position(item["instrument"])
+                margin_rate = item.get("margin_rate", default.margin_rate)
+                portfolio._positions[item["instrument"]] = Position(
+                    instrument=item["instrument"],
+                    quantity=float(item["quantity"]),
+                    avg_cost=float(item["avg_cost"]),
+                    realized_pnl=float(item["realized_pnl"]),
+                    last_price=None if item["last_price"] is None else float(item["last_price"]),
+                    lots=[Lot(float(q), float(p)) for q, p in item["lots"]],
+                    multiplier=float(item.get("multiplier", default.multiplier)),
+                    margin_rate=None if margin_rate is None else float(margin_rate),
+                    currency=item.get("currency", default.currency),
+                    fees=float(item.get("fees", 0.0)),
+                    dividends=float(item.get("dividends", 0.0))
+                )
+            portfolio._ledger = [
+                RealizedPnL(
+                    time=None if e["time"] is None else datetime.fromisoformat(e["time"]),
+                    instrument=e["instrument"],
+                    quantity=float(e["quantity"]),
+                    open_price=float(e["open_price"]),
+                    close_price=float(e["close_price"]),
+                    pnl=float(e["pnl"])
+                )
+                for e in data["ledger"]
+            ]
+            portfolio._illiquid = set(data.get("illiquid", []))
+        except (KeyError, TypeError) as e:
+            raise ValueError(f"invalid portfolio data: {e!r}") from e
+        return portfolio
+    
+    def to_json(self, indent: Optional[int] = None) -> str:
+        """
+        序列化为JSON / Serialize to JSON
+        
+        Args:
+            indent: 缩进空格数，None表示紧凑格式 / Indent width, None for compact output
+        
+        Returns:
+            str: JSON文本 / JSON text
+        """
+        return json.dumps(self.to_dict(), indent=indent, ensure_ascii=False)
+    
+    @classmethod
+    def from_json(cls, text: str) -> "Portfolio":
+        """
+        从to_json()的结果恢复组合 / Restore a portfolio from to_json() output
+        
+        Raises:
+            ValueError: JSON无效或缺少字段时抛出 / Raised on invalid JSON or a missing field
+        """
+        return cls.from_dict(json.loads(text))
+    
+    def _trade_futures(
+        self,
+        instrument: str,
+        signed_quantity: float,
+        price: float,
+        commission: float,
+        time: Optional[datetime]
+    ) -> float:
+        """按保证金记入期货成交，平仓盈亏计入现金 / Book a futures fill on margin, closed P&L going to cash"""
+        spec = get_futures_spec(instrument)
+        position = self._positions.get(instrument)
+        held = 0.0 if position is None else position.quantity
+        if held == 0 or (held > 0) == (signed_quantity > 0):
+            opened, released = abs(signed_quantity), 0.0
+        else:
+            # 反手时平掉的部分先释放保证金
+            closed = min(abs(signed_quantity), abs(held))
+            opened = abs(signed_quantity) - closed
+            released = closed * position.mark * spec.multiplier * spec.margin_rate
+        fee = self._money(commission)
+        required = opened * price * spec.multiplier * spec.margin_rate + float(fee)
+        available = self.equity - self.margin + released
+        if opened > 0 and required > available + _EPSILON:
+            raise InsufficientCashError(instrument, required, available)
+        self._cash -= fee
+        self._commissions += fee
+        realized = self._book(instrument, signed_quantity, price, time)
+        self._positions[instrument].fees += float(fee)
+        self._cash += self._money(realized)
+        return realized
+    
+    def _money(self, amount: float) -> Money:
+        """按组合的舍入方式把金额转换为Money / Convert an amount to Money under the portfolio's rounding"""
+        return Money.of(amount, self._rounding)
+    
+    def _book(
+        self,
+        instrument: str,
+        signed_quantity: float,
+        price: float,
+        time: Optional[datetime] = None
+    ) -> float:
+        """按成本核算方法记入带方向的成交数量 / Book a signed fill quantity under the cost basis"""
+        position = self._positions.get(instrument)
+        if position is None:
+            position = self._positions[instrument] = _new_position(instrument)
+        if position.last_price is None:
+            # 未估值过的标的先用已知的估值价格，没有时用成交价
+            position.last_price = self._marks.get(instrument, price)
+        
+        if self._cost_basis is CostBasis.FIFO:
+            realized = self._book_fifo(position, signed_quantity, price, time)
+        else:
+            realized = self._book_average(position, signed_quantity, price, time)
+        position.realized_pnl += realized
+        return realized
+    
+    def _book_average(
+        self,
+        position: Position,
+        signed_quantity: float,
+        price: float,
+        time: Optional[datetime]
+    ) -> float:
+        held = position.quantity
+        if held == 0 or (held > 0) == (signed_quantity > 0):
+            total = held + signed_quantity
+            position.avg_cost = (abs(held) * position.avg_cost + abs(signed_quantity) * price) / abs(total)
+            position.quantity = total
+            return 0.0
+        
+        closed = min(abs(held), abs(signed_quantity))
+        direction = 1.0 if held > 0 else -1.0
+        realized = closed * (price - position.avg_cost) * direction * position.multiplier
+        self._ledger.append(RealizedPnL(
+            time, position.instrument, closed * direction, position.avg_cost, price, realized
+        ))
+        position.quantity = held + signed_quantity
+        if abs(position.quantity) <= _EPSILON:
+            position.quantity = 0.0
+            position.avg_cost = 0.0
+        elif (position.quantity > 0) != (held > 0):
+            # 反手：剩余部分以成交价开仓
+            position.avg_cost = price
+        return realized
+    
+    def _book_fifo(
+        self,
+        position: Position,
+        signed_quantity: float,
+        price: float,
+        time: Optional[datetime]
+    ) -> float:
+        held = position.quantity
+        realized = 0.0
+        if held == 0 or (held > 0) == (signed_quantity > 0):
+            position.lots.append(Lot(abs(signed_quantity), price))
+            position.quantity = held + signed_quantity
+        else:
+            direction = 1.0 if held > 0 else -1.0
+            remaining = abs(signed_quantity)
+            while remaining > _EPSILON and position.lots:
+                lot = position.lots[0]
+                closed = min(lot.quantity, remaining)
+                pnl = closed * (price - lot.price) * direction * position.multiplier
+                self._ledger.append(RealizedPnL(
+                    time, position.instrument, closed * direction, lot.price, price, pnl
+                ))
+                realized += pnl
+                remaining -= closed
+                if lot.quantity - closed <= _EPSILON:
+                    position.lots.pop(0)
+                else:
+                    position.lots[0] = Lot(lot.quantity - closed, lot.price)
+            position.quantity = held + signed_quantity
+            if abs(position.quantity) <= _EPSILON:
+                position.quantity = 0.0
+                position.lots = []
+            elif remaining > _EPSILON:
+                # 反手：剩余部分以成交价开仓
+                position.lots = [Lot(remaining, price)]
+        
+        total = sum(lot.quantity for lot in position.lots)
+        position.avg_cost = sum(lot.quantity * lot.price for lot in position.lots) / total if total else 0.0
+        return realized
+
+
+def _new_position(instrument: str) -> Position:
+    """新建持仓，期货带上品种的乘数和保证金比例 / A new position, with the product's multiplier and margin rate for futures"""
+    spec = get_futures_spec(instrument)
+    currency = get_currency(instrument)
+    if spec is None:
+        return Position(instrument, currency=currency)
+    return Position(instrument, multiplier=spec.multiplier, margin_rate=spec.margin_rate, currency=currency)
+
+
+def _copy_position(position: Position) -> Position:
+    """复制持仓，批次列表不共享 / Copy a position without sharing its lot list"""
+    return replace(position, lots=list(position.lots))
+
+
+def _check_fill(quantity: float, price: float, commission: float) -> None:
+    """成交数量和价格必须为正数，手续费不能为负 / Quantity and price must be positive, commission non-negative"""
+    if not (math.isfinite(quantity) and quantity > 0):
+        raise ValueError(f"quantity must be a positive number, got {quantity}")
+    if not (math.isfinite(price) and price > 0):
+        raise ValueError(f"price must be a positive number, got {price}")
+    if not (math.isfinite(commission) and commission >= 0):
+        raise ValueError(f"commission must be a non-negative number, got {commission}")
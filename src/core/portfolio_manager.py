@@ -5,6 +5,14 @@ Portfolio Manager for managing investment portfolios.
 This module provides functionality for creating and managing portfolios,
 tracking positions, calculating portfolio values, and maintaining trade history.
 本模块提供创建和管理投资组合、跟踪持仓、计算组合价值和维护交易历史的功能。
+
+已弃用：新代码请使用src.core.portfolio.Portfolio，它支持平均成本和先进先出核算、
+空头、期货保证金以及JSON持久化，回测引擎和模拟盘都基于它。本模块仅为依赖
+src.models.trading_models的旧调用方保留。
+Deprecated: new code should use src.core.portfolio.Portfolio, which covers
+average-cost and FIFO accounting, shorts, futures margin and JSON
+persistence, and is what the backtest engine and paper trading build on.
+This module is kept only for callers of src.models.trading_models.
 """
 
 import uuid
@@ -24,6 +32,9 @@ class PortfolioManager:
     This class handles portfolio creation, position updates, value calculations,
     trade history tracking, and returns calculation.
     该类处理投资组合创建、持仓更新、价值计算、交易历史跟踪和收益率计算。
+    
+    已弃用，请改用src.core.portfolio.Portfolio
+    Deprecated; use src.core.portfolio.Portfolio instead
     """
     
     def __init__(self, logger: Optional[LoggerSystem] = None):
@@ -0,0 +1,125 @@
+"""
+复权模块 / Price Adjustment Module
+在查询时根据复权因子($factor)计算不复权、前复权和后复权价格
+Computes unadjusted, forward-adjusted and backward-adjusted prices from the
+adjustment factor ($factor) at query time
+
+没有$factor列的提供者可以提供除权除息记录（DataProvider.adjustments()），
+由infrastructure.data_provider.adjustment_factor()换算为$factor
+Providers without a $factor column can serve split and dividend records
+instead (DataProvider.adjustments()), which
+infrastructure.data_provider.adjustment_factor() turns into $factor
+"""
+
+from enum import Enum
+from typing import Iterable, Union
+
+import pandas as pd
+
+from ..infrastructure.data_provider import FACTOR_FIELD
+
+# 按复权因子同比例调整的价格字段
+PRICE_FIELDS = ("$open", "$high", "$low", "$close", "$vwap")
+
+# 按复权因子反比例调整的成交量字段（成交额不变）
+VOLUME_FIELDS = ("$volume",)
+
+
+class AdjustMode(Enum):
+    """
+    复权方式 / Adjustment mode
+    """
+    NONE = "none"  # 不复权，原始成交价
+    PRE = "pre"  # 前复权，以查询区间最后一天的价格为基准
+    POST = "post"  # 后复权，以上市首日的价格为基准
+
+
+def to_adjust_mode(adjust: Union[str, AdjustMode]) -> AdjustMode:
+    """
+    解析复权方式 / Parse an adjustment mode
+    
+    Args:
+        adjust: "none"、"pre"、"post"或AdjustMode / "none", "pre", "post" or an AdjustMode
+    
+    Returns:
+        AdjustMode: 复权方式 / Adjustment mode
+    
+    Raises:
+        ValueError: 未知的复权方式 / Unknown mode
+    """
+    if isinstance(adjust, AdjustMode):
+        return adjust
+    try:
+        return AdjustMode(str(adjust).lower())
+    except ValueError:
+        raise ValueError(
+            f"adjust must be one of {[m.value for m in AdjustMode]}, got {adjust!r}"
+        ) from None
+
+
+def needs_factor(fields: Iterable[str], mode: AdjustMode, adjusted_source: bool) -> bool:
+    """
+    判断是否需要加载复权因子 / Whether the adjustment factor has to be loaded
+    
+    Args:
+        fields: 要加载的原始字段 / Raw fields to load
+        mode: 复权方式 / Adjustment mode
+        adjusted_source: 提供者返回的价格是否已经是后复权价 /
+            Whether the provider's prices are already backward-adjusted
+    
+    Returns:
+        bool: 有价格或成交量字段且需要换算时返回True /
+            True when price or volume fields need converting
+    """
+    if mode == AdjustMode.NONE and not adjusted_source:
+        return False
+    if mode == AdjustMode.POST and adjusted_source:
+        return False
+    return any(f in PRICE_FIELDS or f in VOLUME_FIELDS for f in fields)
+
+
+def adjust_prices(
+    data: pd.DataFrame,
+    mode: AdjustMode,
+    adjusted_source: bool = False
+) -> pd.DataFrame:
+    """
+    按复权方式换算价格和成交量 / Convert prices and volumes to an adjustment mode
+    
+    后复权价 = 原始价 * 因子；前复权价 = 原始价 * 因子 / 区间最后一天的因子，
+    因此区间最后一天的前复权价等于原始价。成交量按相反比例换算，使成交额保持不变。
+    停牌等缺失的因子沿用前一个值。
+    Backward-adjusted = raw * factor; forward-adjusted = raw * factor / the
+    factor on the last day of the window, so the last bar of a forward-adjusted
+    series equals the raw price. Volumes are scaled inversely so turnover is
+    unchanged. Missing factors (e.g. suspensions) carry the previous value forward.
+    
+    Args:
+        data: 包含$factor列的单标的数据 / Per-instrument data holding a $factor column
+        mode: 复权方式 / Adjustment mode
+        adjusted_source: data中的价格是否已经是后复权价（如qlib数据） /
+            Whether data's prices are already backward-adjusted (as with qlib data)
+    
+    Returns:
+        pd.DataFrame: 换算后的数据，$factor列保持不变 / Converted data; $factor is left as is
+    """
+    if FACTOR_FIELD not in data.columns or data.empty:
+        return data
+    
+    factor = data[FACTOR_FIELD].ffill().bfill()
+    # 先换算到原始价，再换算到目标复权方式
+    to_raw = 1.0 / factor if adjusted_source else 1.0
+    if mode == AdjustMode.NONE:
+        scale = to_raw
+    elif mode == AdjustMode.POST:
+        scale = to_raw * factor
+    else:
+        scale = to_raw * factor / factor.iloc[-1]
+    
+    adjusted = data.copy()
+    for field in data.columns:
+        if field in PRICE_FIELDS:
+            adjusted[field] = data[field] * scale
+        elif field in VOLUME_FIELDS:
+            adjusted[field] = data[field] / scale
+    return adjusted
@@ -0,0 +1,244 @@
+"""
+查询语法模块 / Query Syntax Module
+用一行文本描述一次特征数据请求，如"SH000300.$close[2025-01-01:2025-06-30]"
+Describes one feature request in a single line of text, such as
+"SH000300.$close[2025-01-01:2025-06-30]"
+
+语法为"标的.字段[开始:结束]@频率"：
+- 标的为一个代码或逗号分隔的多个代码；"CSI300.*"这样的通配写法展开为该指数的成分股，
+  与get_universe()使用同样的成分股文件
+- 字段为原始字段或表达式，如"$close"、"Mean($close, 5)"
+- 时间区间可以省略，开始或结束留空表示不限；时间的格式与get_features()相同
+- 频率可以省略，默认为日线
+The grammar is "INSTRUMENTS.FIELD[start:end]@freq":
+- INSTRUMENTS is one code or a comma-separated list; a wildcard such as
+  "CSI300.*" expands to the index constituents, read from the same
+  membership files as get_universe()
+- FIELD is a raw field or an expression, such as "$close" or "Mean($close, 5)"
+- The range may be left out, and an empty start or end is unbounded; times
+  take the same formats as get_features()
+- The frequency may be left out and defaults to daily
+
+Examples:
+    >>> parse_query("SH600000,SZ000001.Mean($close, 5)[2025-01-01:]@5min")
+    Query(instruments=['SH600000', 'SZ000001'], universe=None, field='Mean($close, 5)', start_time='2025-01-01', end_time=None, freq='5min')
+"""
+
+from dataclasses import dataclass, field as dataclass_field
+from typing import List, Optional, Tuple
+
+from ..infrastructure.data_provider import SUPPORTED_FREQS, to_freq
+from ..utils.error_handler import DataError, ErrorInfo, ErrorCategory, ErrorSeverity
+from .expression_engine import ExpressionError, parse_expression
+from .request_time import RequestTimeError, parse_request_time
+
+
+_CODE_CHARS = frozenset("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_")
+
+
+class QuerySyntaxError(DataError):
+    """
+    查询语法错误 / Query syntax error
+    
+    position为出错字符在查询文本中的偏移（从0开始），字段中的表达式错误也换算到查询文本中
+    position is the 0-based offset of the offending character in the query
+    text; errors inside the field expression are mapped back onto it too
+    """
+    
+    def __init__(self, query: str, position: int, message: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            query: 查询文本 / Query text
+            position: 出错位置 / Offending position
+            message: 错误描述 / Error description
+        """
+        self.query = query
+        self.position = position
+        self.reason = message
+        pointer = " " * position + "^"
+        error_info = ErrorInfo(
+            error_code="DAT0036",
+            error_message_zh=f"查询语法错误（位置 {position}）: {message}",
+            error_message_en=f"Query syntax error at position {position}: {message}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"{query}\n{pointer}",
+            suggested_actions=[
+                "查询格式为 标的.字段[开始:结束]@频率，如SH000300.$close[2025-01-01:2025-06-30]",
+                "多个标的用逗号分隔，指数成分股写作CSI300.*"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+@dataclass
+class Query:
+    """
+    解析后的查询 / Parsed query
+    
+    universe不为None时instruments为空，标的为该指数在区间内的成分股
+    When universe is set, instruments is empty and the instruments are the
+    index's constituents over the range
+    """
+    instruments: List[str] = dataclass_field(default_factory=list)
+    universe: Optional[str] = None
+    field: str = ""
+    start_time: Optional[str] = None
+    end_time: Optional[str] = None
+    freq: str = "day"
+
+
+def parse_query(text: str) -> Query:
+    """
+    解析查询文本 / Parse query text
+    
+    Args:
+        text: 查询文本，如"SH000300.$close[2025-01-01:2025-06-30]@day" /
+            Query text, e.g. "SH000300.$close[2025-01-01:2025-06-30]@day"
+    
+    Returns:
+        Query: 解析后的查询 / Parsed query
+    
+    Raises:
+        QuerySyntaxError: 查询格式错误时抛出，包含出错位置 / Raised with the offending position on malformed queries
+    """
+    return _QueryParser(text).parse()
+
+
+class _QueryParser:
+    """逐字符解析查询文本 / Scans query text one character at a time"""
+    
+    def __init__(self, text: str):
+        self._text = text
+        self._pos = 0
+    
+    def _error(self, position: int, message: str) -> QuerySyntaxError:
+        return QuerySyntaxError(self._text, position, message)
+    
+    def _peek(self) -> str:
+        return self._text[self._pos] if self._pos < len(self._text) else ""
+    
+    def _skip_spaces(self) -> None:
+        while self._peek().isspace():
+            self._pos += 1
+    
+    def parse(self) -> Query:
+        query = Query()
+        self._skip_spaces()
+        if not self._peek():
+            raise self._error(self._pos, "empty query")
+        query.instruments, query.universe = self._instruments()
+        query.field = self._field()
+        self._skip_spaces()
+        if self._peek() == "[":
+            query.start_time, query.end_time = self._range()
+            self._skip_spaces()
+        if self._peek() == "@":
+            query.freq = self._freq()
+            self._skip_spaces()
+        if self._peek():
+            raise self._error(self._pos, f"unexpected character {self._peek()!r}, expected '[' or '@'")
+        return query
+    
+    def _code(self) -> str:
+        self._skip_spaces()
+        start = self._pos
+        while self._peek() in _CODE_CHARS:
+            self._pos += 1
+        if self._pos == start:
+            found = repr(self._peek()) if self._peek() else "end of query"
+            raise self._error(self._pos, f"expected an instrument code, found {found}")
+        code = self._text[start:self._pos]
+        self._skip_spaces()
+        return code
+    
+    def _instruments(self) -> Tuple[List[str], Optional[str]]:
+        codes = [self._code()]
+        while self._peek() == ",":
+            self._pos += 1
+            codes.append(self._code())
+        if self._peek() != ".":
+            found = repr(self._peek()) if self._peek() else "end of query"
+            raise self._error(self._pos, f"expected '.' between the instruments and the field, found {found}")
+        self._pos += 1
+        if self._peek() != "*":
+            return list(dict.fromkeys(codes)), None
+        if len(codes) > 1:
+            raise self._error(self._pos, "a '*' wildcard takes a single index code")
+        self._pos += 1
+        if self._peek() != ".":
+            found = repr(self._peek()) if self._peek() else "end of query"
+            raise self._error(self._pos, f"expected '.' after the '*' wildcard, found {found}")
+        self._pos += 1
+        return [], codes[0]
+    
+    def _field(self) -> str:
+        start = self._pos
+        depth = 0
+        while self._peek():
+            char = self._peek()
+            if char == "(":
+                depth += 1
+            elif char == ")":
+                depth -= 1
+            elif depth == 0 and char in "[@":
+                break
+            self._pos += 1
+        text = self._text[start:self._pos]
+        field = text.strip()
+        if not field:
+            raise self._error(start, "expected a field or expression after '.'")
+        offset = start + len(text) - len(text.lstrip())
+        try:
+            parse_expression(field)
+        except ExpressionError as e:
+            raise self._error(offset + e.position, e.reason)
+        return field
+    
+    def _range(self) -> Tuple[Optional[str], Optional[str]]:
+        opening = self._pos
+        close = self._text.find("]", opening)
+        if close < 0:
+            raise self._error(opening, "unclosed '['")
+        body_start = opening + 1
+        body = self._text[body_start:close]
+        colons = [i for i, char in enumerate(body) if char == ":"]
+        if not colons:
+            raise self._error(close, "expected ':' between the start and end of the range")
+        # RFC3339时间本身带冒号，取两侧都能解析为时间的那个冒号
+        first_error = None
+        for colon in colons:
+            start, start_error = self._time(body[:colon], body_start, "start_time")
+            end, end_error = self._time(body[colon + 1:], body_start + colon + 1, "end_time")
+            if start_error is None and end_error is None:
+                self._pos = close + 1
+                return start, end
+            if first_error is None:
+                first_error = start_error or end_error
+        raise first_error
+    
+    def _time(self, text: str, offset: int, name: str) -> Tuple[Optional[str], Optional[QuerySyntaxError]]:
+        value = text.strip()
+        if not value:
+            return None, None
+        position = offset + len(text) - len(text.lstrip())
+        try:
+            parse_request_time(value, name)
+        except RequestTimeError as e:
+            return None, self._error(position, str(e))
+        return value, None
+    
+    def _freq(self) -> str:
+        self._pos += 1
+        self._skip_spaces()
+        start = self._pos
+        while self._peek() and not self._peek().isspace():
+            self._pos += 1
+        text = self._text[start:self._pos]
+        freq = to_freq(text)
+        if freq not in SUPPORTED_FREQS:
+            raise self._error(start, f"unknown frequency {text!r}, expected one of {', '.join(SUPPORTED_FREQS)}")
+        return freq
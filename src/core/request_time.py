@@ -0,0 +1,205 @@
+"""
+请求时间解析模块 / Request Time Parsing Module
+解析数据请求的开始和结束时间，统一转换为交易所本地时间
+Parses the start and end times of a data request into exchange-local time
+
+只接受两种格式：
+    "2025-01-01"                  只有日期，表示交易所时区当天的零点
+    "2025-01-01T09:30:00+08:00"   带时区偏移的完整RFC3339时间（UTC可写作Z），转换到交易所时区
+不带偏移的时间如"2025-01-01 09:30"无法确定时区，会被拒绝。数据提供者的时间索引是
+交易所本地时间（不带时区），因此解析结果同样不带时区。
+Exactly two formats are accepted:
+    "2025-01-01"                  date only, midnight in the exchange's timezone
+    "2025-01-01T09:30:00+08:00"   full RFC3339 with an offset (Z for UTC), converted to the exchange's timezone
+A time without an offset such as "2025-01-01 09:30" is ambiguous about its
+timezone and is rejected. Providers index bars by exchange-local wall time
+(naive), so parsed times are naive as well.
+
+Examples:
+    >>> parse_request_time("2025-01-02T01:30:00Z", "start_time")
+    Timestamp('2025-01-02 09:30:00')
+    >>> parse_request_range("2025-01-01", "2025-06-30", timezone="America/New_York")
+    (Timestamp('2025-01-01 00:00:00'), Timestamp('2025-06-30 00:00:00'))
+"""
+
+import re
+from datetime import date, datetime
+from typing import Optional, Tuple, Union
+
+import pandas as pd
+
+
+# 未指定时使用的交易所时区 / Exchange timezone used when none is given
+DEFAULT_TIMEZONE = "Asia/Shanghai"
+
+TimeLike = Union[str, date, datetime, pd.Timestamp]
+
+_DATE = re.compile(r"\d{4}-\d{2}-\d{2}")
+_RFC3339 = re.compile(r"\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,9})?(Z|[+-]\d{2}:\d{2})")
+
+_EXPECTED = "expected a date such as 2025-01-01 or RFC3339 with an offset such as 2025-01-01T09:30:00+08:00"
+
+
+class RequestTimeError(ValueError):
+    """
+    请求时间无法解析或区间颠倒 / Request time that can't be parsed, or an inverted range
+    
+    Attributes:
+        field: 出错的参数名，如"start_time" / Name of the offending parameter, e.g. "start_time"
+        value: 传入的值 / The value given
+    """
+    
+    def __init__(self, field: str, value, message: str):
+        super().__init__(message)
+        self.field = field
+        self.value = value
+
+
+def check_timezone(timezone: str) -> str:
+    """
+    确认时区名称有效 / Check that a timezone name is valid
+    
+    Returns:
+        str: 原样返回的时区名称 / The timezone name, unchanged
+    
+    Raises:
+        ValueError: 未知时区时抛出 / Raised for an unknown timezone
+    """
+    try:
+        pd.Timestamp("2000-01-01").tz_localize(timezone)
+    except Exception:
+        raise ValueError(f"unknown timezone {timezone!r}, expected an IANA name such as {DEFAULT_TIMEZONE}")
+    return timezone
+
+
+def parse_request_time(
+    value: Optional[TimeLike],
+    field: str,
+    timezone: str = DEFAULT_TIMEZONE
+) -> Optional[pd.Timestamp]:
+    """
+    把请求时间解析为交易所本地时间 / Parse a request time into exchange-local time
+    
+    字符串只接受"2025-01-01"或带偏移的RFC3339时间；date、datetime和Timestamp对象中
+    不带时区的视为交易所本地时间，带时区的转换到交易所时区
+    Strings must be "2025-01-01" or RFC3339 with an offset; naive date,
+    datetime and Timestamp objects are taken as exchange-local and aware ones
+    are converted to the exchange's timezone
+    
+    Args:
+        value: 请求时间，None或空字符串表示不限 / Request time, None or an empty string for unbounded
+        field: 参数名，用于错误信息 / Parameter name for error messages
+        timezone: 交易所时区，如"Asia/Shanghai" / Exchange timezone, e.g. "Asia/Shanghai"
+    
+    Returns:
+        Optional[pd.Timestamp]: 不带时区的交易所本地时间，不限时为None /
+            Naive exchange-local time, None when unbounded
+    
+    Raises:
+        RequestTimeError: 格式不受支持或日期无效时抛出 / Raised for an unsupported format or an invalid date
+    """
+    return _parse(value, field, timezone)[0]
+
+
+def parse_request_range(
+    start: Optional[TimeLike],
+    end: Optional[TimeLike],
+    timezone: str = DEFAULT_TIMEZONE,
+    start_field: str = "start_time",
+    end_field: str = "end_time"
+) -> Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]]:
+    """
+    解析请求的时间区间 / Parse the time range of a request
+    
+    只有日期的结束时间包含当天，因此start="2025-01-01T09:30:00+08:00"、end="2025-01-01"
+    不算颠倒
+    A date-only end includes its whole day, so start="2025-01-01T09:30:00+08:00"
+    with end="2025-01-01" is not inverted
+    
+    Args:
+        start: 开始时间 / Start time
+        end: 结束时间 / End time
+        timezone: 交易所时区 / Exchange timezone
+        start_field: 开始时间的参数名 / Parameter name of the start
+        end_field: 结束时间的参数名 / Parameter name of the end
+    
+    Returns:
+        Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]]: 解析后的开始和结束时间 / Parsed start and end
+    
+    Raises:
+        RequestTimeError: 任一时间无法解析，或开始时间晚于结束时间时抛出 /
+            Raised when either time fails to parse or the start is after the end
+        ValueError: 未知时区时抛出 / Raised for an unknown timezone
+    """
+    check_timezone(timezone)
+    start_ts, _ = _parse(start, start_field, timezone)
+    end_ts, end_is_date = _parse(end, end_field, timezone)
+    if start_ts is not None and end_ts is not None:
+        last = end_ts + pd.Timedelta(days=1) - pd.Timedelta(1, "ns") if end_is_date else end_ts
+        if start_ts > last:
+            raise RequestTimeError(
+                start_field, start, f"{start_field} {start} is after {end_field} {end}"
+            )
+    return start_ts, end_ts
+
+
+def format_request_time(ts: Optional[pd.Timestamp]) -> Optional[str]:
+    """
+    把解析后的时间转换回提供者使用的字符串 / Format a parsed time as the string providers take
+    
+    零点写作"2025-01-01"，其他时间写作"2025-01-01 09:30:00"
+    Midnight becomes "2025-01-01" and any other time "2025-01-01 09:30:00"
+    """
+    if ts is None:
+        return None
+    if ts == ts.normalize():
+        return ts.strftime("%Y-%m-%d")
+    return ts.isoformat(sep=" ")
+
+
+def format_rfc3339(ts: pd.Timestamp, timezone: str = DEFAULT_TIMEZONE) -> str:
+    """
+    把时间写成带偏移的RFC3339字符串 / Format a time as RFC3339 with an offset
+    
+    不带时区的时间视为交易所本地时间，与parse_request_time()互为逆操作
+    Naive times are taken as exchange-local, the inverse of parse_request_time()
+    
+    Args:
+        ts: 时间 / Time
+        timezone: 交易所时区 / Exchange timezone
+    
+    Returns:
+        str: 如"2025-01-02T00:00:00+08:00" / E.g. "2025-01-02T00:00:00+08:00"
+    """
+    ts = pd.Timestamp(ts)
+    if ts.tzinfo is None:
+        ts = ts.tz_localize(timezone)
+    return ts.isoformat()
+
+
+def _parse(value: Optional[TimeLike], field: str, timezone: str) -> Tuple[Optional[pd.Timestamp], bool]:
+    """解析时间并返回是否只有日期 / Parse a time and tell whether it was date-only"""
+    if value is None or (isinstance(value, str) and not value.strip()):
+        return None, False
+    if isinstance(value, str):
+        text = value.strip()
+        date_only = _DATE.fullmatch(text) is not None
+        if not date_only and _RFC3339.fullmatch(text) is None:
+            raise RequestTimeError(field, value, f"invalid {field}: {value!r}, {_EXPECTED}")
+    elif isinstance(value, (date, datetime, pd.Timestamp)):
+        text = value
+        date_only = not isinstance(value, datetime)
+    else:
+        raise RequestTimeError(
+            field, value, f"invalid {field}: expected a string or datetime, got {type(value).__name__}"
+        )
+    
+    try:
+        ts = pd.Timestamp(text)
+    except (ValueError, TypeError) as e:
+        raise RequestTimeError(field, value, f"invalid {field}: {value!r}, {e}") from e
+    if ts is pd.NaT:
+        raise RequestTimeError(field, value, f"invalid {field}: {value!r}, {_EXPECTED}")
+    if ts.tzinfo is not None:
+        ts = ts.tz_convert(timezone).tz_localize(None)
+    return ts, date_only
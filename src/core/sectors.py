@@ -0,0 +1,71 @@
+"""
+行业分类模块 / Sector Classification Module
+标的所属行业的代码，用于按行业汇总持仓和盈亏
+Sector codes of instruments, for grouping positions and P&L by sector
+
+行业没有默认值：只有register_sector()或register_sectors()注册过的标的才有行业，
+其余标的的get_sector()为None。行业代码是任意非空字符串，如申万一级行业"801780"或
+"银行"，同一份分析里使用同一套分类即可。
+There is no default sector: only instruments given to register_sector() or
+register_sectors() have one, and get_sector() is None for the rest. A
+sector code is any non-empty string, such as the SW level-1 code "801780" or
+"银行"; use one classification per analysis.
+
+Examples:
+    >>> register_sectors({"SH600000": "银行", "SH600519": "食品饮料"})
+    >>> get_sector("SH600000")
+    '银行'
+"""
+
+import threading
+from typing import Dict, Mapping, Optional
+
+
+# 注册的标的行业，键为标的代码
+_SECTORS: Dict[str, str] = {}
+_sectors_lock = threading.Lock()
+
+
+def register_sector(instrument: str, sector: str) -> None:
+    """
+    注册或覆盖标的的行业 / Register or replace the sector of an instrument
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+        sector: 行业代码 / Sector code
+    
+    Raises:
+        ValueError: 行业代码为空时抛出 / Raised for an empty sector code
+    """
+    register_sectors({instrument: sector})
+
+
+def register_sectors(sectors: Mapping[str, str]) -> None:
+    """
+    批量注册标的的行业 / Register the sectors of several instruments
+    
+    Args:
+        sectors: 标的代码到行业代码 / Instrument code to sector code
+    
+    Raises:
+        ValueError: 任一行业代码为空时抛出，此时不注册任何标的 /
+            Raised when any sector code is empty, registering none of them
+    """
+    for instrument, sector in sectors.items():
+        if not isinstance(sector, str) or not sector.strip():
+            raise ValueError(f"sector of {instrument} must be a non-empty string, got {sector!r}")
+    with _sectors_lock:
+        _SECTORS.update({instrument: sector.strip() for instrument, sector in sectors.items()})
+
+
+def get_sector(instrument: str) -> Optional[str]:
+    """
+    查找标的的行业 / Look up the sector of an instrument
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+    
+    Returns:
+        Optional[str]: 行业代码，未注册时为None / Sector code, None when not registered
+    """
+    return _SECTORS.get(instrument)
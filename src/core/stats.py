@@ -0,0 +1,119 @@
+"""
+忽略NaN的统计函数模块 / NaN-aware Statistics Module
+对含缺失值的序列计算均值、标准差、求和和相关系数，跳过NaN而不是让结果变为NaN
+Computes means, standard deviations, sums and correlations over series with
+missing values, skipping NaNs instead of letting them poison the result
+
+向前填充或按日历重新索引后的序列常常包含NaN。与indicators模块相同，所有函数接受数值序列
+（列表、numpy数组或pd.Series）；没有有效值时返回NaN，不会抛出异常或产生警告。
+Forward-filled or reindexed series often hold NaNs. As in the indicators
+module every function takes a numeric sequence (list, numpy array or
+pd.Series); with no valid values the result is NaN, without raising or warning.
+
+Examples:
+    >>> values, times = frame.column("$close")
+    >>> nan_mean(values)
+    >>> nan_correlation(returns_a, returns_b)
+"""
+
+from typing import Sequence
+
+import numpy as np
+
+
+class InsufficientDataError(ValueError):
+    """有效数据点不足错误 / Too few valid data points"""
+
+
+def _valid(series: Sequence[float]) -> np.ndarray:
+    """转换为一维浮点数组并去掉NaN / Convert to a 1-D float array without NaNs"""
+    values = np.asarray(series, dtype=float)
+    if values.ndim != 1:
+        raise ValueError(f"series must be one-dimensional, got shape {values.shape}")
+    return values[~np.isnan(values)]
+
+
+def nan_sum(series: Sequence[float]) -> float:
+    """
+    忽略NaN求和 / Sum ignoring NaNs
+    
+    Args:
+        series: 数值序列 / Numeric sequence
+    
+    Returns:
+        float: 有效值之和，没有有效值时为NaN（而不是0） / Sum of the valid values; NaN (not 0) when there are none
+    """
+    values = _valid(series)
+    return float(values.sum()) if len(values) else float("nan")
+
+
+def nan_mean(series: Sequence[float]) -> float:
+    """
+    忽略NaN求均值 / Mean ignoring NaNs
+    
+    Args:
+        series: 数值序列 / Numeric sequence
+    
+    Returns:
+        float: 有效值的均值，没有有效值时为NaN / Mean of the valid values, NaN when there are none
+    """
+    values = _valid(series)
+    return float(values.mean()) if len(values) else float("nan")
+
+
+def nan_std(series: Sequence[float], ddof: int = 1) -> float:
+    """
+    忽略NaN求标准差 / Standard deviation ignoring NaNs
+    
+    Args:
+        series: 数值序列 / Numeric sequence
+        ddof: 自由度修正，默认1为样本标准差 / Delta degrees of freedom; 1 (default) gives the sample deviation
+    
+    Returns:
+        float: 有效值的标准差，有效值不超过ddof个时为NaN /
+            Deviation of the valid values, NaN with ddof or fewer of them
+    """
+    values = _valid(series)
+    if len(values) <= ddof:
+        return float("nan")
+    return float(values.std(ddof=ddof))
+
+
+def nan_correlation(a: Sequence[float], b: Sequence[float]) -> float:
+    """
+    忽略NaN的皮尔逊相关系数 / Pearson correlation ignoring NaNs
+    
+    只使用两个序列在同一位置都不是NaN的数据对
+    Only positions where neither series is NaN are used
+    
+    Args:
+        a: 数值序列 / Numeric sequence
+        b: 与a等长的数值序列 / Numeric sequence as long as a
+    
+    Returns:
+        float: 相关系数，取值[-1, 1]；任一序列在有效数据对上为常数时为NaN /
+            Correlation in [-1, 1]; NaN when either series is constant over the valid pairs
+    
+    Raises:
+        ValueError: 两个序列长度不同时抛出 / Raised when the lengths differ
+        InsufficientDataError: 有效数据对少于两个时抛出 / Raised with fewer than two valid pairs
+    """
+    x = np.asarray(a, dtype=float)
+    y = np.asarray(b, dtype=float)
+    if x.ndim != 1 or y.ndim != 1:
+        raise ValueError(f"series must be one-dimensional, got shapes {x.shape} and {y.shape}")
+    if len(x) != len(y):
+        raise ValueError(f"series must have the same length, got {len(x)} and {len(y)}")
+    
+    both = ~(np.isnan(x) | np.isnan(y))
+    pairs = int(both.sum())
+    if pairs < 2:
+        raise InsufficientDataError(f"correlation needs at least 2 valid pairs, got {pairs}")
+    
+    dx = x[both] - x[both].mean()
+    dy = y[both] - y[both].mean()
+    denominator = np.sqrt((dx * dx).sum() * (dy * dy).sum())
+    if denominator == 0:
+        return float("nan")
+    # 浮点误差可能使结果略微超出[-1, 1]
+    return float(np.clip((dx * dy).sum() / denominator, -1.0, 1.0))
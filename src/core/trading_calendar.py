@@ -0,0 +1,664 @@
+"""
+交易日历模块 / Trading Calendar Module
+提供交易所交易日历（如上交所/深交所、港交所、纽交所）和7x24小时市场的连续日历
+Provides exchange trading calendars (e.g. SSE/SZSE, HKEX, NYSE) and a
+continuous calendar for 24/7 markets such as crypto
+
+交易日和交易时段按交易所当地的日期和时刻判断；带时区的时间先用to_local()转换到日历的时区，
+交易所本地时间用to_utc()转换为UTC，两者都能正确处理夏令时切换
+Trading days and sessions are judged by the exchange's local date and time
+of day; tz-aware times go through to_local() into the calendar's timezone
+first, and to_utc() turns exchange-local wall times into UTC, both handling
+daylight-saving changes
+"""
+
+import threading
+from datetime import date, datetime
+from enum import Enum
+from pathlib import Path
+from typing import Dict, Iterable, List, Mapping, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+import yaml
+
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+TimeLike = Union[str, date, datetime, pd.Timestamp]
+# 日内交易时段，(开盘, 收盘)，如("09:30", "11:30")
+SessionLike = Tuple[str, str]
+
+# 内置日历数据文件目录
+CALENDAR_DIR = Path(__file__).parent.parent.parent / "config" / "calendars"
+
+_WEEKDAYS = ["Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"]
+
+# 7x24小时市场的名称
+CONTINUOUS_MARKETS = ("CRYPTO", "24/7", "CONTINUOUS")
+
+# 本地时间出现两次（夏令时结束时回拨的一小时）时的取法：报错、取较早或较晚的一次
+# How a local time that occurs twice (the hour repeated when daylight saving
+# ends) resolves: raise, or take the earlier or later occurrence
+AMBIGUOUS_CHOICES = ("raise", "earliest", "latest")
+
+
+class FillPolicy(Enum):
+    """
+    对齐到共享日历时缺失K线的填充策略 / Fill policy for missing bars when aligning to a shared calendar
+    """
+    FORWARD_FILL = "ffill"  # 用上一根K线填充
+    BACKWARD_FILL = "bfill"  # 用下一根K线填充，回测中会引入未来数据
+    NAN = "nan"  # 保留为NaN
+    ZERO = "zero"  # 填充为0，如成交量
+    DROP = "drop"  # 删除任一标的缺失的交易日
+
+
+# 按字段的填充策略中表示未列出字段的键 / Key of the per-field policy map covering unlisted fields
+DEFAULT_FILL_KEY = "*"
+
+# 单一策略（或其取值），或字段到策略的映射 / One policy (or its value), or a map of field to policy
+FillPolicyLike = Union[FillPolicy, str, Mapping[str, Union[FillPolicy, str]]]
+
+
+def _to_day(value: TimeLike) -> np.datetime64:
+    """把时间转换为日期（去掉时分秒） / Convert a time to its calendar day"""
+    ts = pd.Timestamp(value)
+    if ts.tzinfo is not None:
+        ts = ts.tz_localize(None)
+    return np.datetime64(ts.normalize().date(), "D")
+
+
+def _to_timestamp(day: np.datetime64) -> pd.Timestamp:
+    return pd.Timestamp(day)
+
+
+def _format_session(session: Tuple[pd.Timedelta, pd.Timedelta]) -> SessionLike:
+    """把交易时段转换回"HH:MM"形式 / Convert a session back to "HH:MM" form"""
+    return tuple(
+        f"{int(t.total_seconds()) // 3600:02d}:{int(t.total_seconds()) % 3600 // 60:02d}"
+        for t in session
+    )
+
+
+class TradingCalendar:
+    """
+    交易日历 / Trading calendar
+    
+    交易日为不在周末且不在休市日列表中的日期；半日市仍是交易日，
+    可通过is_half_day()识别。所有方法只看日期部分，时分秒会被忽略。
+    Trading days are dates that are neither weekend days nor listed holidays;
+    half-day sessions are still trading days and can be told apart with
+    is_half_day(). All methods look at the date only; the time of day is ignored.
+    
+    sessions给出每个交易日内的连续交易时段（如上交所的上午、下午两段），
+    session_mask()在日内频率下据此去掉午休等非交易时段的K线。
+    sessions lists the continuous trading sessions within each day (e.g. the
+    morning and afternoon sessions of SSE); for intraday frequencies
+    session_mask() uses them to drop bars that fall in the lunch break or
+    outside trading hours.
+    """
+    
+    def __init__(
+        self,
+        market: str,
+        holidays: Optional[Iterable[TimeLike]] = None,
+        weekends: Iterable[str] = ("Saturday", "Sunday"),
+        timezone: Optional[str] = None,
+        half_days: Optional[Iterable[TimeLike]] = None,
+        sessions: Optional[Iterable[SessionLike]] = None
+    ):
+        """
+        初始化交易日历 / Initialize trading calendar
+        
+        Args:
+            market: 市场名称，如"SSE" / Market name, e.g. "SSE"
+            holidays: 落在工作日的休市日 / Weekday closures
+            weekends: 非交易的星期，如["Saturday", "Sunday"] / Non-trading weekdays
+            timezone: 交易所时区 / Exchange timezone
+            half_days: 提前收盘的半日市 / Early-close half-day sessions
+            sessions: 日内交易时段，如[("09:30", "11:30"), ("13:00", "15:00")]，
+                None表示全天交易 / Intraday sessions, None trades around the clock
+        """
+        weekend_set = set(weekends)
+        unknown = weekend_set - set(_WEEKDAYS)
+        if unknown:
+            raise ValueError(f"unknown weekday names: {sorted(unknown)}")
+        
+        self.market = market
+        self.timezone = timezone
+        self._holidays = sorted({_to_day(h) for h in (holidays or [])})
+        self._half_days = sorted({_to_day(h) for h in (half_days or [])})
+        self._weekends = [day for day in _WEEKDAYS if day in weekend_set]
+        self._weekmask = [day not in weekend_set for day in _WEEKDAYS]
+        self._busdaycal = np.busdaycalendar(
+            weekmask=self._weekmask,
+            holidays=self._holidays
+        )
+        self._sessions = sorted(
+            (pd.Timedelta(f"{open_time}:00"), pd.Timedelta(f"{close_time}:00"))
+            for open_time, close_time in (sessions or [])
+        )
+        for open_time, close_time in self._sessions:
+            if open_time >= close_time:
+                raise ValueError(f"session opens after it closes: {open_time} >= {close_time}")
+    
+    @property
+    def sessions(self) -> List[Tuple[pd.Timedelta, pd.Timedelta]]:
+        """
+        日内交易时段，以距零点的时间差表示 / Intraday sessions as offsets from midnight
+        
+        为空表示全天交易 / Empty when trading around the clock
+        """
+        return list(self._sessions)
+    
+    @property
+    def breaks(self) -> List[Tuple[pd.Timedelta, pd.Timedelta]]:
+        """
+        相邻交易时段之间的休市（如午休），以距零点的时间差表示 /
+        Breaks between consecutive sessions (e.g. the lunch break) as offsets from midnight
+        """
+        return [
+            (close_time, next_open)
+            for (_, close_time), (next_open, _) in zip(self._sessions, self._sessions[1:])
+            if close_time < next_open
+        ]
+    
+    @property
+    def holidays(self) -> List[pd.Timestamp]:
+        """休市日列表 / Holiday list"""
+        return [_to_timestamp(h) for h in self._holidays]
+    
+    @property
+    def half_days(self) -> List[pd.Timestamp]:
+        """半日市列表 / Half-day session list"""
+        return [_to_timestamp(h) for h in self._half_days]
+    
+    def is_half_day(self, t: TimeLike) -> bool:
+        """
+        判断是否为半日市 / Whether a date is a half-day session
+        
+        Args:
+            t: 时间 / Time
+        
+        Returns:
+            bool: 是交易日且提前收盘时返回True / True on an early-close trading day
+        """
+        day = _to_day(t)
+        return day in self._half_days and self.is_trading_day(day)
+    
+    def with_holidays(
+        self,
+        holidays: Iterable[TimeLike] = (),
+        half_days: Iterable[TimeLike] = (),
+        market: Optional[str] = None
+    ) -> "TradingCalendar":
+        """
+        合并额外的休市表，返回新日历 / Merge extra holiday tables into a new calendar
+        
+        Args:
+            holidays: 额外的休市日 / Extra closures
+            half_days: 额外的半日市 / Extra half-day sessions
+            market: 新日历的市场名称，None表示沿用当前名称 / Name of the new calendar
+        
+        Returns:
+            TradingCalendar: 新的交易日历，当前日历不变 / New calendar; this one is unchanged
+        """
+        return TradingCalendar(
+            market=market or self.market,
+            holidays=list(self._holidays) + [_to_day(h) for h in holidays],
+            weekends=self._weekends,
+            timezone=self.timezone,
+            half_days=list(self._half_days) + [_to_day(h) for h in half_days],
+            sessions=[_format_session(s) for s in self._sessions]
+        )
+    
+    def is_trading_day(self, t: TimeLike) -> bool:
+        """
+        判断是否为交易日 / Whether a date is a trading day
+        
+        Args:
+            t: 时间 / Time
+        
+        Returns:
+            bool: 是交易日返回True / True on a trading day
+        """
+        return bool(np.is_busday(_to_day(t), busdaycal=self._busdaycal))
+    
+    def next(self, t: TimeLike) -> pd.Timestamp:
+        """
+        获取t之后的下一个交易日（不含t） / Next trading day strictly after t
+        
+        Args:
+            t: 时间 / Time
+        
+        Returns:
+            pd.Timestamp: 下一个交易日 / Next trading day
+        """
+        day = np.busday_offset(_to_day(t), 1, roll="backward", busdaycal=self._busdaycal)
+        return _to_timestamp(day)
+    
+    def prev(self, t: TimeLike) -> pd.Timestamp:
+        """
+        获取t之前的上一个交易日（不含t） / Previous trading day strictly before t
+        
+        Args:
+            t: 时间 / Time
+        
+        Returns:
+            pd.Timestamp: 上一个交易日 / Previous trading day
+        """
+        day = np.busday_offset(_to_day(t), -1, roll="forward", busdaycal=self._busdaycal)
+        return _to_timestamp(day)
+    
+    def between(self, start: TimeLike, end: TimeLike) -> List[pd.Timestamp]:
+        """
+        获取区间内的所有交易日（包含边界） / All trading days in a range (inclusive)
+        
+        Args:
+            start: 开始时间 / Start time
+            end: 结束时间 / End time
+        
+        Returns:
+            List[pd.Timestamp]: 升序排列的交易日，start晚于end时为空 /
+                Trading days in ascending order, empty when start is after end
+        """
+        first, last = self.snap(start, end)
+        if first is None:
+            return []
+        days = np.arange(_to_day(first), _to_day(last) + 1, dtype="datetime64[D]")
+        days = days[np.is_busday(days, busdaycal=self._busdaycal)]
+        return [_to_timestamp(d) for d in days]
+    
+    def snap(
+        self,
+        start: Optional[TimeLike],
+        end: Optional[TimeLike]
+    ) -> Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]]:
+        """
+        把区间收缩到最近的交易日 / Snap a range inward to the nearest trading days
+        
+        start向后取第一个交易日，end向前取最后一个交易日；区间内没有交易日时
+        返回(None, None)。为None的边界保持为None。
+        start moves forward to the first trading day and end moves back to the
+        last one; (None, None) is returned when the range holds no trading day.
+        A None bound stays None.
+        
+        Args:
+            start: 开始时间 / Start time
+            end: 结束时间 / End time
+        
+        Returns:
+            Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]]: 收缩后的区间 / Snapped range
+        """
+        first = None
+        last = None
+        if start is not None:
+            first = _to_timestamp(
+                np.busday_offset(_to_day(start), 0, roll="forward", busdaycal=self._busdaycal)
+            )
+        if end is not None:
+            last = _to_timestamp(
+                np.busday_offset(_to_day(end), 0, roll="backward", busdaycal=self._busdaycal)
+            )
+        if first is not None and last is not None and first > last:
+            return None, None
+        return first, last
+    
+    def session_mask(self, index: pd.DatetimeIndex, freq: str = "day") -> np.ndarray:
+        """
+        标记索引中落在交易时段的行 / Mark the rows of an index that fall in trading sessions
+        
+        日频只看日期；日内频率还要求时刻落在某个交易时段内（包含开盘和收盘时刻，
+        兼容以开始或结束时刻标记的K线），因此午休期间的K线会被去掉。
+        Daily data only looks at the date; intraday data also needs the time of
+        day inside a session (open and close inclusive, so bars stamped by
+        either their start or end time pass), which drops lunch-break bars.
+        
+        Args:
+            index: 时间索引 / Time index
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            np.ndarray: 布尔掩码 / Boolean mask
+        """
+        if len(index) == 0:
+            return np.zeros(0, dtype=bool)
+        index = self.to_local(index)
+        days = index.normalize()
+        mask = np.is_busday(days.values.astype("datetime64[D]"), busdaycal=self._busdaycal)
+        if freq == "day" or not self._sessions:
+            return mask
+        
+        time_of_day = index - days
+        in_session = np.zeros(len(index), dtype=bool)
+        for open_time, close_time in self._sessions:
+            in_session |= np.asarray((time_of_day >= open_time) & (time_of_day <= close_time))
+        return mask & in_session
+    
+    def to_local(self, index: pd.DatetimeIndex) -> pd.DatetimeIndex:
+        """
+        转换为交易所本地时间（不带时区） / Convert to exchange-local wall time (naive)
+        
+        带时区的索引先转换到日历的时区再去掉时区，交易日和交易时段因此按当地日期和时刻判断，
+        夏令时切换前后同样正确；不带时区的索引视为已是本地时间，原样返回。日历没有时区时
+        直接去掉索引自带的时区。
+        A tz-aware index is converted to the calendar's timezone and then made
+        naive, so trading days and sessions are judged by local date and time
+        of day, across daylight-saving changes too; a naive index is taken as
+        local already and returned as is. Without a calendar timezone the
+        index's own timezone is dropped.
+        
+        Args:
+            index: 时间索引 / Time index
+        
+        Returns:
+            pd.DatetimeIndex: 不带时区的本地时间 / Naive local times
+        """
+        index = pd.DatetimeIndex(index)
+        if index.tz is None:
+            return index
+        if self.timezone:
+            index = index.tz_convert(self.timezone)
+        return index.tz_localize(None)
+    
+    def to_utc(self, index: pd.DatetimeIndex) -> pd.DatetimeIndex:
+        """
+        把交易所本地时间转换为UTC / Convert exchange-local wall times to UTC
+        
+        见localize_index()；带时区的索引直接转换为UTC
+        See localize_index(); a tz-aware index is simply converted to UTC
+        
+        Args:
+            index: 不带时区的本地时间，或带时区的索引 / Naive local times, or a tz-aware index
+        
+        Returns:
+            pd.DatetimeIndex: UTC时间 / UTC times
+        
+        Raises:
+            ValueError: 日历没有时区，或有落在夏令时开始时跳过的一小时内的时间时抛出 /
+                Raised when the calendar has no timezone, or for a time inside the
+                hour skipped when daylight saving starts
+        """
+        if not self.timezone:
+            raise ValueError(f"calendar {self.market} has no timezone to convert from")
+        return localize_index(index, self.timezone)
+    
+    @classmethod
+    def from_file(cls, path: Union[str, Path], market: Optional[str] = None) -> "TradingCalendar":
+        """
+        从数据文件加载交易日历 / Load a trading calendar from a data file
+        
+        支持两种格式：YAML文件包含market、weekends、holidays、half_days、sessions等键；
+        文本文件每行一个休市日，以#开头的行为注释。
+        Two formats are supported: a YAML file with market, weekends, holidays,
+        half_days and sessions keys, or a text file with one holiday per line where lines
+        starting with # are comments.
+        
+        Args:
+            path: 文件路径 / File path
+            market: 市场名称，None时使用文件中的名称或文件名 /
+                Market name, None uses the one in the file or the file name
+        
+        Returns:
+            TradingCalendar: 交易日历 / Trading calendar
+        
+        Raises:
+            DataError: 文件不存在或格式错误时抛出 / Raised when the file is missing or malformed
+        """
+        path = Path(path)
+        try:
+            if path.suffix in (".yaml", ".yml"):
+                with open(path, "r", encoding="utf-8") as f:
+                    spec = yaml.safe_load(f) or {}
+                return cls(
+                    market=market or spec.get("market", path.stem),
+                    holidays=spec.get("holidays") or [],
+                    weekends=spec.get("weekends", ("Saturday", "Sunday")),
+                    timezone=spec.get("timezone"),
+                    half_days=spec.get("half_days") or [],
+                    sessions=[tuple(s) for s in spec.get("sessions") or []]
+                )
+            
+            with open(path, "r", encoding="utf-8") as f:
+                lines = [line.split("#", 1)[0].strip() for line in f]
+            return cls(market=market or path.stem, holidays=[line for line in lines if line])
+        
+        except Exception as e:
+            error_info = ErrorInfo(
+                error_code="DAT0019",
+                error_message_zh=f"加载交易日历失败: {path.name}: {str(e)}",
+                error_message_en=f"Failed to load trading calendar: {path.name}: {str(e)}",
+                category=ErrorCategory.DATA,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=f"path={path}",
+                suggested_actions=[
+                    "检查日历文件是否存在",
+                    "确认日期格式是否正确，如2025-01-01"
+                ],
+                recoverable=True,
+                original_exception=e
+            )
+            raise DataError(error_info) from e
+    
+    def __repr__(self) -> str:
+        return f"{type(self).__name__}(market={self.market!r}, holidays={len(self._holidays)})"
+
+
+class ContinuousCalendar(TradingCalendar):
+    """
+    连续日历 / Continuous calendar
+    
+    用于加密货币等7x24小时市场，每天都是交易日
+    For 24/7 markets such as crypto; every day is a trading day
+    """
+    
+    def __init__(self, market: str = "CRYPTO", timezone: Optional[str] = "UTC"):
+        """
+        初始化连续日历 / Initialize continuous calendar
+        
+        Args:
+            market: 市场名称 / Market name
+            timezone: 时区 / Timezone
+        """
+        super().__init__(market=market, holidays=[], weekends=(), timezone=timezone)
+
+
+# 已加载的日历缓存，键为大写的市场名称
+_calendars: Dict[str, TradingCalendar] = {}
+_calendars_lock = threading.Lock()
+
+
+def register_calendar(market: str, calendar: TradingCalendar) -> None:
+    """
+    注册交易日历 / Register a trading calendar
+    
+    同名日历会被覆盖，可用于提供自定义的休市表
+    A calendar registered under the same name is replaced, which lets callers
+    supply their own holiday tables
+    
+    Args:
+        market: 市场名称 / Market name
+        calendar: 交易日历 / Trading calendar
+    """
+    if not isinstance(calendar, TradingCalendar):
+        raise TypeError(f"calendar must be a TradingCalendar, got {type(calendar).__name__}")
+    with _calendars_lock:
+        _calendars[market.upper()] = calendar
+    get_logger(__name__).debug(f"已注册交易日历: {market}")
+
+
+def get_calendar(market: str) -> TradingCalendar:
+    """
+    获取市场的交易日历 / Get the trading calendar of a market
+    
+    首次使用时从config/calendars加载并缓存，之后直接返回缓存
+    Loaded from config/calendars on first use and cached afterwards
+    
+    Args:
+        market: 市场名称，如"SSE"、"SZSE"、"CRYPTO" / Market name, e.g. "SSE", "SZSE", "CRYPTO"
+    
+    Returns:
+        TradingCalendar: 交易日历 / Trading calendar
+    
+    Raises:
+        DataError: 未知市场时抛出 / Raised for an unknown market
+    """
+    key = market.upper()
+    with _calendars_lock:
+        calendar = _calendars.get(key)
+        if calendar is not None:
+            return calendar
+        
+        if key in CONTINUOUS_MARKETS:
+            calendar = ContinuousCalendar(market=key)
+        else:
+            path = _find_calendar_file(key)
+            if path is None:
+                error_info = ErrorInfo(
+                    error_code="DAT0018",
+                    error_message_zh=f"未知的交易日历: {market}",
+                    error_message_en=f"Unknown trading calendar: {market}",
+                    category=ErrorCategory.DATA,
+                    severity=ErrorSeverity.MEDIUM,
+                    technical_details=f"market={market}, calendar_dir={CALENDAR_DIR}",
+                    suggested_actions=[
+                        "使用 register_calendar() 注册自定义日历",
+                        f"在 {CALENDAR_DIR} 中添加日历文件"
+                    ],
+                    recoverable=True
+                )
+                raise DataError(error_info)
+            calendar = TradingCalendar.from_file(path)
+        
+        _calendars[key] = calendar
+    
+    get_logger(__name__).debug(f"已加载交易日历: {market} -> {calendar}")
+    return calendar
+
+
+def _find_calendar_file(key: str) -> Optional[Path]:
+    """按文件名或aliases查找日历文件 / Find a calendar file by name or aliases"""
+    if not CALENDAR_DIR.exists():
+        return None
+    for path in sorted(CALENDAR_DIR.glob("*.y*ml")):
+        if path.stem.upper() == key:
+            return path
+        try:
+            with open(path, "r", encoding="utf-8") as f:
+                spec = yaml.safe_load(f) or {}
+        except Exception:
+            continue
+        aliases = [str(a).upper() for a in spec.get("aliases", [])]
+        if key in aliases or str(spec.get("market", "")).upper() == key:
+            return path
+    return None
+
+
+def localize_time(value: TimeLike, timezone: str, ambiguous: str = "raise") -> pd.Timestamp:
+    """
+    把本地时间转换为带时区的时间 / Attach a timezone to a local time
+    
+    带时区的时间直接转换到timezone；不带时区的时间按timezone的当地时间解释。夏令时结束时
+    回拨的一小时内的时间出现两次，按ambiguous取其中一次，默认报错而不是静默选择；落在夏令时
+    开始时跳过的一小时内的时间不存在，总是报错。
+    A tz-aware time is converted to timezone; a naive one is read as wall time
+    there. A time in the hour repeated when daylight saving ends occurs twice
+    and ambiguous picks one, raising by default rather than choosing silently;
+    a time in the hour skipped when it starts doesn't exist and always raises.
+    
+    Args:
+        value: 时间，如"2025-11-02 01:30" / Time, e.g. "2025-11-02 01:30"
+        timezone: 时区名称，如"America/New_York" / Timezone name, e.g. "America/New_York"
+        ambiguous: "raise"、"earliest"或"latest" / "raise", "earliest" or "latest"
+    
+    Returns:
+        pd.Timestamp: timezone时区的时间 / Time in timezone
+    
+    Raises:
+        ValueError: ambiguous无效，或时间不唯一（ambiguous="raise"）或不存在时抛出 /
+            Raised for an invalid ambiguous, or a time that is ambiguous (with
+            ambiguous="raise") or doesn't exist
+    """
+    if ambiguous not in AMBIGUOUS_CHOICES:
+        raise ValueError(f"ambiguous must be one of {AMBIGUOUS_CHOICES}, got {ambiguous!r}")
+    ts = pd.Timestamp(value)
+    if ts.tzinfo is not None:
+        return ts.tz_convert(timezone)
+    flag = "NaT" if ambiguous == "raise" else ambiguous == "earliest"
+    localized = ts.tz_localize(timezone, ambiguous=flag, nonexistent="NaT")
+    if pd.isna(localized):
+        if pd.isna(ts.tz_localize(timezone, ambiguous=True, nonexistent="NaT")):
+            raise ValueError(f"{ts} does not exist in {timezone}: the clocks skip it when daylight saving starts")
+        raise ValueError(
+            f"{ts} occurs twice in {timezone} as daylight saving ends; "
+            f"pass ambiguous='earliest' or 'latest' to pick one"
+        )
+    return localized
+
+
+def localize_index(index: pd.DatetimeIndex, timezone: str) -> pd.DatetimeIndex:
+    """
+    把本地时间索引转换为UTC / Convert an index of local wall times to UTC
+    
+    夏令时结束时回拨的一小时内的K线由本地时间无法区分，按出现顺序解释：同一本地时间第一次出现
+    为夏令时，第二次为标准时间，因此转换后不会产生重复的时间戳。落在夏令时开始时跳过的一小时内
+    的时间不是有效的本地时间，报错而不是移动到相邻时刻，以免与已有的K线重复。
+    Bars in the hour repeated when daylight saving ends can't be told apart
+    by wall time, so they're read by order of appearance: the first
+    occurrence of a wall time is daylight time and the second standard time,
+    which leaves no duplicate timestamps after conversion. A time inside the
+    hour skipped when daylight saving starts is not a valid wall time and
+    raises rather than being moved next to an existing bar.
+    
+    Args:
+        index: 不带时区的本地时间，带时区时直接转换为UTC / Naive wall times; a tz-aware index is simply converted to UTC
+        timezone: 本地时间的时区 / Timezone of the wall times
+    
+    Returns:
+        pd.DatetimeIndex: UTC时间，名称不变 / UTC times under the same name
+    
+    Raises:
+        ValueError: 有不存在的本地时间时抛出 / Raised for wall times that don't exist
+    """
+    index = pd.DatetimeIndex(index)
+    if index.tz is not None:
+        return index.tz_convert("UTC")
+    repeated = pd.Series(index).duplicated().to_numpy()
+    localized = index.tz_localize(timezone, ambiguous=~repeated, nonexistent="NaT")
+    skipped = np.asarray(localized.isna()) & ~np.asarray(index.isna())
+    if skipped.any():
+        raise ValueError(
+            f"{index[skipped][0]} does not exist in {timezone}: "
+            f"the clocks skip it when daylight saving starts"
+        )
+    return localized.tz_convert("UTC")
+
+
+def trading_days(
+    start: TimeLike,
+    end: TimeLike,
+    market: Union[str, TradingCalendar] = "SSE"
+) -> List[pd.Timestamp]:
+    """
+    获取市场在区间内的交易日 / Get a market's trading days within a range
+    
+    Args:
+        start: 开始时间（包含） / Start time (inclusive)
+        end: 结束时间（包含） / End time (inclusive)
+        market: 市场名称（如"SSE"、"SZSE"）或交易日历 / Market name (e.g. "SSE", "SZSE") or calendar
+    
+    Returns:
+        List[pd.Timestamp]: 升序排列的交易日 / Trading days in ascending order
+    
+    Raises:
+        DataError: 未知市场时抛出 / Raised for an unknown market
+    """
+    calendar = get_calendar(market) if isinstance(market, str) else market
+    return calendar.between(start, end)
@@ -0,0 +1,418 @@
+"""
+标的池模块 / Universe Module
+把指数代码（如"SH000300"）展开为按时间点计算的成分股列表
+Expands index codes such as "SH000300" into point-in-time constituent lists
+"""
+
+import threading
+from datetime import date, datetime
+from pathlib import Path
+from typing import TYPE_CHECKING, Dict, Iterable, List, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+from .delisting import Delisting, get_delisting
+
+if TYPE_CHECKING:
+    from ..infrastructure.data_provider import DataProvider
+    from .universe_filter import FilteredUniverse, InstrumentFilter
+
+
+TimeLike = Union[str, date, datetime, pd.Timestamp]
+Period = Tuple[pd.Timestamp, pd.Timestamp]
+
+# 内置成分股文件目录，以及qlib数据包自带的instruments目录
+UNIVERSE_DIRS = (
+    Path(__file__).parent.parent.parent / "config" / "universes",
+    Path("~/.qlib/qlib_data/cn_data/instruments").expanduser(),
+)
+
+# 指数代码对应的成分股文件名（与qlib的股票池名称一致）
+INDEX_ALIASES = {
+    "SH000300": ("csi300", "hs300"),
+    "SH000905": ("csi500", "zz500"),
+    "SH000906": ("csi800",),
+    "SH000852": ("csi1000",),
+}
+
+# 成分股文件中未写结束日期时使用的结束日期
+OPEN_END = pd.Timestamp("2099-12-31")
+
+
+def _to_day(value: TimeLike) -> pd.Timestamp:
+    """把时间转换为日期（去掉时分秒） / Convert a time to its calendar day"""
+    ts = pd.Timestamp(value)
+    if ts.tzinfo is not None:
+        ts = ts.tz_localize(None)
+    return ts.normalize()
+
+
+class Universe:
+    """
+    标的池 / Instrument universe
+    
+    记录每个标的的纳入、剔除时间段（包含两端），按时间点查询成分股，
+    避免回测中使用当前成分股回看历史时产生幸存者偏差。同一标的可以有多个时间段
+    （被剔除后再次纳入）。
+    Records the inclusion periods (both ends inclusive) of every instrument and
+    answers point-in-time membership queries, so backtests don't suffer the
+    survivorship bias of looking back with today's constituents. An
+    instrument may have several periods (removed and later re-added).
+    
+    已退市的标的在退市日（包含）之前按成分股时间段计算，退市日之后不再是成分股，
+    即使成分股文件中没有写结束日期。退市信息来自delistings参数，没有时查找全局注册的
+    退市信息（见delisting模块）。
+    A delisted instrument counts by its membership periods up to and including
+    its delisting date and is no member afterwards, even when the membership
+    file leaves the end open. Delistings come from the delistings argument and
+    otherwise from the global registry (see the delisting module).
+    """
+    
+    def __init__(
+        self,
+        name: str,
+        periods: Dict[str, Iterable[Tuple[TimeLike, Optional[TimeLike]]]],
+        delistings: Optional[Iterable[Delisting]] = None
+    ):
+        """
+        初始化标的池 / Initialize universe
+        
+        Args:
+            name: 标的池名称，如"SH000300" / Universe name, e.g. "SH000300"
+            periods: 标的代码到(纳入日期, 剔除前最后一日)列表的映射，结束日期为None表示至今 /
+                Instrument code to a list of (added, last day before removal);
+                a None end means still a member
+            delistings: 成分股的退市信息，未给出的标的查找全局注册的退市信息 /
+                Delistings of members; instruments not given are looked up in the global registry
+        """
+        self.name = name
+        self._delistings: Dict[str, Delisting] = {d.instrument: d for d in delistings or []}
+        self._periods: Dict[str, List[Period]] = {}
+        for instrument, spans in periods.items():
+            normalized = []
+            for start, end in spans:
+                start_ts = _to_day(start)
+                end_ts = OPEN_END if end is None else _to_day(end)
+                if start_ts > end_ts:
+                    raise ValueError(
+                        f"membership of {instrument} starts after it ends: {start_ts} > {end_ts}"
+                    )
+                normalized.append((start_ts, end_ts))
+            if normalized:
+                self._periods[instrument] = sorted(normalized)
+    
+    @property
+    def instruments(self) -> List[str]:
+        """曾经属于标的池的全部标的 / Every instrument that was ever a member"""
+        return sorted(self._periods)
+    
+    def periods(self, instrument: str) -> List[Period]:
+        """
+        获取标的的成分股时间段 / Get an instrument's membership periods
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            List[Period]: 升序排列的(开始, 结束)，截止到退市日，不是成分股时为空 /
+                Ascending (start, end) pairs cut at the delisting date, empty for a non-member
+        """
+        return self._active_periods(instrument)
+    
+    def delisting(self, instrument: str) -> Optional[Delisting]:
+        """
+        获取标的的退市信息 / Get the delisting of an instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+        
+        Returns:
+            Optional[Delisting]: 退市信息，未退市时为None / The delisting, None for a listed instrument
+        """
+        delisting = self._delistings.get(instrument)
+        return delisting if delisting is not None else get_delisting(instrument)
+    
+    def members(self, t: TimeLike) -> List[str]:
+        """
+        获取某日的成分股 / Get the constituents on a date
+        
+        Args:
+            t: 日期 / Date
+        
+        Returns:
+            List[str]: 排序后的标的代码 / Sorted instrument codes
+        """
+        day = _to_day(t)
+        return [
+            instrument for instrument in self.instruments
+            if any(start <= day <= end for start, end in self._active_periods(instrument))
+        ]
+    
+    def members_between(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> List[str]:
+        """
+        获取区间内任意时刻属于标的池的标的 / Instruments that were members at any time in a range
+        
+        Args:
+            start: 开始日期（包含），None表示不限 / Start date (inclusive), None for unbounded
+            end: 结束日期（包含），None表示不限 / End date (inclusive), None for unbounded
+        
+        Returns:
+            List[str]: 排序后的标的代码 / Sorted instrument codes
+        """
+        lower = None if start is None else _to_day(start)
+        upper = None if end is None else _to_day(end)
+        return [
+            instrument for instrument in self.instruments
+            if any(
+                (upper is None or period_start <= upper) and (lower is None or period_end >= lower)
+                for period_start, period_end in self._active_periods(instrument)
+            )
+        ]
+    
+    def is_member(self, instrument: str, t: TimeLike) -> bool:
+        """
+        判断标的在某日是否为成分股 / Whether an instrument is a member on a date
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            t: 日期 / Date
+        
+        Returns:
+            bool: 是成分股返回True / True for a member
+        """
+        day = _to_day(t)
+        return any(start <= day <= end for start, end in self._active_periods(instrument))
+    
+    def membership_mask(self, instrument: str, index: pd.DatetimeIndex) -> np.ndarray:
+        """
+        标记索引中标的属于标的池的行 / Mark the rows of an index where the instrument is a member
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            index: 时间索引 / Time index
+        
+        Returns:
+            np.ndarray: 布尔掩码 / Boolean mask
+        """
+        index = pd.DatetimeIndex(index)
+        if index.tz is not None:
+            index = index.tz_localize(None)
+        days = index.normalize()
+        mask = np.zeros(len(index), dtype=bool)
+        for start, end in self._active_periods(instrument):
+            mask |= np.asarray((days >= start) & (days <= end))
+        return mask
+    
+    def _active_periods(self, instrument: str) -> List[Period]:
+        """截止到退市日的成分股时间段 / Membership periods cut at the delisting date"""
+        periods = self._periods.get(instrument, [])
+        delisting = self.delisting(instrument) if periods else None
+        if delisting is None:
+            return list(periods)
+        last = delisting.date
+        return [(start, min(end, last)) for start, end in periods if start <= last]
+    
+    def filter(self, *filters: "InstrumentFilter", provider: Optional["DataProvider"] = None) -> "FilteredUniverse":
+        """
+        按时间点逐日筛选成分股 / Filter the constituents point-in-time, day by day
+        
+        Args:
+            *filters: 筛选条件，如MinADV(20, 1e7)、ExcludeST()，全部通过才保留 /
+                Filters such as MinADV(20, 1e7) or ExcludeST(), all of which must pass
+            provider: 加载筛选字段的数据提供者，None时使用全局默认提供者 /
+                Provider of the filter fields, None uses the global default
+        
+        Returns:
+            FilteredUniverse: 筛选后的标的池，见universe_filter模块 / Filtered universe, see the universe_filter module
+        """
+        from .universe_filter import FilteredUniverse
+        return FilteredUniverse(self, filters, provider)
+    
+    @classmethod
+    def from_file(cls, path: Union[str, Path], name: Optional[str] = None) -> "Universe":
+        """
+        从成分股文件加载标的池 / Load a universe from a membership file
+        
+        文件格式与qlib的instruments文件相同：每行为"标的代码 纳入日期 结束日期"，
+        以制表符或空格分隔，结束日期可省略；以#开头的行为注释。
+        The format is that of qlib's instruments files: one "instrument start
+        end" line per period, separated by tabs or spaces, with an optional end
+        date; lines starting with # are comments.
+        
+        Args:
+            path: 文件路径 / File path
+            name: 标的池名称，None时使用文件名 / Universe name, None uses the file name
+        
+        Returns:
+            Universe: 标的池 / Universe
+        
+        Raises:
+            DataError: 文件不存在或格式错误时抛出 / Raised when the file is missing or malformed
+        """
+        path = Path(path)
+        try:
+            periods: Dict[str, List[Tuple[str, Optional[str]]]] = {}
+            with open(path, "r", encoding="utf-8") as f:
+                for line_number, line in enumerate(f, start=1):
+                    parts = line.split("#", 1)[0].split()
+                    if not parts:
+                        continue
+                    if len(parts) not in (2, 3):
+                        raise ValueError(f"line {line_number}: expected 'instrument start [end]'")
+                    end = parts[2] if len(parts) == 3 else None
+                    periods.setdefault(parts[0].upper(), []).append((parts[1], end))
+            return cls(name or path.stem, periods)
+        
+        except Exception as e:
+            error_info = ErrorInfo(
+                error_code="DAT0021",
+                error_message_zh=f"加载成分股文件失败: {path.name}: {str(e)}",
+                error_message_en=f"Failed to load membership file: {path.name}: {str(e)}",
+                category=ErrorCategory.DATA,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=f"path={path}",
+                suggested_actions=[
+                    "检查成分股文件是否存在",
+                    "确认每行格式为: 标的代码 纳入日期 结束日期"
+                ],
+                recoverable=True,
+                original_exception=e
+            )
+            raise DataError(error_info) from e
+    
+    def __len__(self) -> int:
+        return len(self._periods)
+    
+    def __contains__(self, instrument: str) -> bool:
+        return instrument in self._periods
+    
+    def __repr__(self) -> str:
+        return f"{type(self).__name__}(name={self.name!r}, instruments={len(self._periods)})"
+
+
+# 已加载的标的池缓存，键为大写的名称
+_universes: Dict[str, Universe] = {}
+_universes_lock = threading.Lock()
+
+
+def register_universe(name: str, universe: Universe) -> None:
+    """
+    注册标的池 / Register a universe
+    
+    同名标的池会被覆盖 / A universe registered under the same name is replaced
+    
+    Args:
+        name: 名称，如"SH000300" / Name, e.g. "SH000300"
+        universe: 标的池 / Universe
+    """
+    if not isinstance(universe, Universe):
+        raise TypeError(f"universe must be a Universe, got {type(universe).__name__}")
+    with _universes_lock:
+        _universes[name.upper()] = universe
+    get_logger(__name__).debug(f"已注册标的池: {name}")
+
+
+def get_universe(code: str, data_dir: Optional[Union[str, Path]] = None) -> Universe:
+    """
+    获取指数的成分股标的池 / Get the constituent universe of an index
+    
+    首次使用时从成分股文件加载并缓存。文件按指数代码或对应的股票池名称查找，
+    如SH000300.txt或csi300.txt，依次搜索data_dir、config/universes和qlib数据包的
+    instruments目录。
+    Loaded from a membership file on first use and cached afterwards. The file
+    is looked up by index code or the matching pool name, e.g. SH000300.txt or
+    csi300.txt, in data_dir, config/universes and the instruments directory of
+    the qlib data bundle.
+    
+    Args:
+        code: 指数代码或股票池名称，如"SH000300"、"csi300" / Index code or pool name
+        data_dir: 额外的成分股文件目录 / Extra directory holding membership files
+    
+    Returns:
+        Universe: 标的池 / Universe
+    
+    Raises:
+        DataError: 找不到成分股文件时抛出 / Raised when no membership file is found
+    """
+    key = code.upper()
+    with _universes_lock:
+        universe = _universes.get(key)
+        if universe is not None:
+            return universe
+    
+    directories = ([Path(data_dir).expanduser()] if data_dir is not None else []) + list(UNIVERSE_DIRS)
+    path = _find_membership_file(key, directories)
+    if path is None:
+        error_info = ErrorInfo(
+            error_code="DAT0022",
+            error_message_zh=f"未找到标的池的成分股文件: {code}",
+            error_message_en=f"No membership file found for universe: {code}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"code={code}, searched={[str(d) for d in directories]}",
+            suggested_actions=[
+                "使用 register_universe() 注册标的池",
+                f"在 {UNIVERSE_DIRS[0]} 中添加 {code}.txt"
+            ],
+            recoverable=True
+        )
+        raise DataError(error_info)
+    
+    universe = Universe.from_file(path, name=code)
+    with _universes_lock:
+        _universes[key] = universe
+    get_logger(__name__).debug(f"已加载标的池: {code} -> {path}, 标的数量: {len(universe)}")
+    return universe
+
+
+def universe_members(
+    code: str,
+    t: TimeLike,
+    data_dir: Optional[Union[str, Path]] = None
+) -> List[str]:
+    """
+    获取指数在某日的成分股 / Get the constituents of an index on a date
+    
+    等价于get_universe(code, data_dir).members(t)。已退市的标的在退市日（成分股文件中的
+    结束日期或注册的退市日）之前仍是成分股，之后不再出现。
+    Same as get_universe(code, data_dir).members(t). A delisted instrument
+    stays a member up to its delisting day (the end date in the membership
+    file or the registered delisting date) and drops out afterwards.
+    
+    Args:
+        code: 指数代码或股票池名称，如"SH000300" / Index code or pool name, e.g. "SH000300"
+        t: 日期 / Date
+        data_dir: 额外的成分股文件目录 / Extra directory holding membership files
+    
+    Returns:
+        List[str]: 排序后的标的代码 / Sorted instrument codes
+    
+    Raises:
+        DataError: 找不到成分股文件时抛出 / Raised when no membership file is found
+    """
+    return get_universe(code, data_dir).members(t)
+
+
+def _find_membership_file(key: str, directories: List[Path]) -> Optional[Path]:
+    """按指数代码或股票池名称查找成分股文件 / Find a membership file by index code or pool name"""
+    names = {key.lower()}
+    names.update(alias.lower() for alias in INDEX_ALIASES.get(key, ()))
+    for directory in directories:
+        if not directory.is_dir():
+            continue
+        for path in sorted(directory.glob("*.txt")):
+            if path.stem.lower() in names:
+                return path
+    return None
@@ -0,0 +1,462 @@
+"""
+标的池筛选模块 / Universe Filter Module
+按流动性、上市时间、ST和停牌状态逐日筛选标的池的成分股
+Filters the constituents of a universe day by day on liquidity, listing
+age, ST and suspension status
+
+筛选按时间点计算：某日的结果只使用当日及之前的数据，因此一只股票从被标记为ST的那天起
+才被剔除，之前的成分股不受影响。每个筛选条件对一个标的一次性计算整段区间，结果按日缓存，
+之后每个交易日的查询只是查表。
+Filters are point-in-time: the result for a day only uses data up to and
+including that day, so a stock flagged ST drops out from that day forward
+and its earlier membership is unaffected. Each filter is computed once per
+instrument for a whole range and the results are cached per day, so
+querying on every trading day afterwards is a table lookup.
+
+Examples:
+    >>> universe = get_universe("SH000300").filter(
+    ...     MinListingDays(120), MinADV(20, 1e7), ExcludeST(), ExcludeSuspended(),
+    ...     provider=provider
+    ... )
+    >>> universe.members("2025-01-06")
+    >>> universe.exclusions("2025-01-06")
+    {'SH600010': ['ExcludeST()']}
+"""
+
+import threading
+from abc import ABC, abstractmethod
+from typing import Dict, Iterable, List, Optional, Tuple
+
+import numpy as np
+import pandas as pd
+
+from .universe import OPEN_END, TimeLike, Universe, _to_day
+from ..infrastructure.data_provider import DataProvider, InstrumentNotFoundError, get_default_provider
+from ..infrastructure.logger_system import get_logger
+
+
+# ST标记字段，非零表示当日为ST或*ST / ST flag field, nonzero on days the stock is ST or *ST
+ST_FIELD = "$st"
+
+# 按单个日期查询时向前多计算的天数，使长假中的日期也能找到之前最近的交易日
+# Extra days evaluated before a single-date query, so a date inside a long
+# holiday still finds the nearest earlier trading day
+_LOOKBEHIND = pd.Timedelta(days=14)
+
+
+class InstrumentFilter(ABC):
+    """
+    标的筛选条件 / Instrument filter
+    
+    实现者声明需要的字段和回看的交易日数，并对单个标的逐日给出是否通过
+    Implementations declare the fields and the number of trading days of
+    history they need, and tell day by day whether one instrument passes
+    """
+    
+    # 需要从数据提供者加载的字段 / Fields loaded from the data provider
+    fields: Tuple[str, ...] = ()
+    # 第一个筛选日之前需要的交易日数，None表示需要全部历史 /
+    # Trading days needed before the first filtered day, None for the whole history
+    lookback: Optional[int] = 0
+    
+    @abstractmethod
+    def evaluate(self, frame: pd.DataFrame) -> pd.Series:
+        """
+        逐日判断标的是否通过 / Tell day by day whether an instrument passes
+        
+        Args:
+            frame: 标的的fields数据，索引为交易日历，没有K线的交易日为NaN；至少从第一个筛选日
+                之前lookback个交易日开始 / The instrument's fields indexed by the trading
+                calendar, NaN on days without a bar, starting at least lookback
+                trading days before the first filtered day
+        
+        Returns:
+            pd.Series: 与frame索引相同的布尔序列，只能使用每行及之前的数据 /
+                Boolean series on frame's index, using only data up to each row
+        """
+    
+    @property
+    def name(self) -> str:
+        """在审计结果中显示的名称 / Name shown in audit results"""
+        return repr(self)
+    
+    def __repr__(self) -> str:
+        return f"{type(self).__name__}()"
+
+
+class MinListingDays(InstrumentFilter):
+    """
+    上市满一定交易日数 / Listed for at least a number of trading days
+    
+    上市日期取数据中第一根K线的日期，上市当日计为第1天；停牌的交易日也计入上市天数。
+    数据从上市之后才开始的标的按数据起始日计算。
+    The listing date is the first bar in the data and counts as day 1;
+    suspended trading days count towards the age. Instruments whose data
+    starts after their listing are aged from the start of the data.
+    """
+    
+    fields = ("$close",)
+    lookback = None
+    
+    def __init__(self, days: int):
+        """
+        Args:
+            days: 最少上市交易日数 / Minimum number of trading days since listing
+        """
+        if days < 1:
+            raise ValueError(f"days must be positive, got {days}")
+        self.days = days
+    
+    def evaluate(self, frame: pd.DataFrame) -> pd.Series:
+        listed = frame["$close"].notna().to_numpy()
+        if not listed.any():
+            return pd.Series(False, index=frame.index)
+        first = int(np.argmax(listed))
+        age = np.arange(len(frame)) - first + 1
+        return pd.Series(age >= self.days, index=frame.index)
+    
+    def __repr__(self) -> str:
+        return f"MinListingDays({self.days})"
+
+
+class MinADV(InstrumentFilter):
+    """
+    日均成交额不低于阈值 / Average daily traded value at or above a threshold
+    
+    成交额为$close * $volume，停牌日计为0；窗口内的交易日不足时不通过
+    Traded value is $close * $volume, counting suspended days as 0; fails
+    until the window holds enough trading days
+    """
+    
+    fields = ("$close", "$volume")
+    
+    def __init__(self, window: int, min_amount: float):
+        """
+        Args:
+            window: 计算均值的交易日数，包含当日 / Trading days averaged, including the day itself
+            min_amount: 日均成交额下限 / Minimum average daily traded value
+        """
+        if window < 1:
+            raise ValueError(f"window must be positive, got {window}")
+        if min_amount < 0:
+            raise ValueError(f"min_amount must be non-negative, got {min_amount}")
+        self.window = window
+        self.min_amount = min_amount
+        self.lookback = window - 1
+    
+    def evaluate(self, frame: pd.DataFrame) -> pd.Series:
+        amount = (frame["$close"] * frame["$volume"]).fillna(0.0)
+        adv = amount.rolling(self.window, min_periods=self.window).mean()
+        return adv >= self.min_amount
+    
+    def __repr__(self) -> str:
+        return f"MinADV({self.window}, {self.min_amount:g})"
+
+
+class ExcludeST(InstrumentFilter):
+    """
+    剔除ST股票 / Exclude ST stocks
+    
+    读取ST_FIELD，非零的交易日不通过；没有K线的交易日沿用之前最近的标记
+    Reads ST_FIELD and fails on nonzero days; days without a bar keep the
+    nearest earlier flag
+    """
+    
+    fields = (ST_FIELD,)
+    
+    def evaluate(self, frame: pd.DataFrame) -> pd.Series:
+        flag = frame[ST_FIELD].ffill().fillna(0.0)
+        return flag == 0
+
+
+class ExcludeSuspended(InstrumentFilter):
+    """
+    剔除停牌股票 / Exclude suspended stocks
+    
+    当日没有K线或成交量为0时视为停牌
+    A day without a bar or with zero volume counts as suspended
+    """
+    
+    fields = ("$volume",)
+    
+    def evaluate(self, frame: pd.DataFrame) -> pd.Series:
+        return frame["$volume"].fillna(0.0) > 0
+
+
+class FilteredUniverse(Universe):
+    """
+    逐日筛选后的标的池 / Universe filtered day by day
+    
+    成分股为原标的池在当日的成分股中通过所有筛选条件的标的。members()、is_member()、
+    membership_mask()等查询都应用筛选，因此可以直接传给DataManager.get_features()。
+    筛选结果只对交易日计算，非交易日使用之前最近交易日的结果。
+    The members are those of the base universe on a day that pass every
+    filter. members(), is_member(), membership_mask() and the other queries
+    all apply the filters, so the universe can be passed straight to
+    DataManager.get_features(). Filters are computed for trading days only;
+    other days use the result of the nearest earlier trading day.
+    
+    线程安全 / Thread-safe
+    """
+    
+    def __init__(
+        self,
+        base: Universe,
+        filters: Iterable[InstrumentFilter],
+        provider: Optional[DataProvider] = None
+    ):
+        """
+        初始化筛选后的标的池 / Initialize a filtered universe
+        
+        Args:
+            base: 原标的池 / Universe being filtered
+            filters: 筛选条件，全部通过才保留 / Filters, all of which must pass
+            provider: 加载筛选字段的数据提供者，None时使用全局默认提供者 /
+                Provider of the filter fields, None uses the global default
+        
+        Raises:
+            ValueError: 没有数据提供者或筛选条件重名时抛出 /
+                Raised without a provider or for filters sharing a name
+        """
+        super().__init__(base.name, {})
+        self._periods = base._periods
+        self._base = base
+        self._filters = list(filters)
+        names = [f.name for f in self._filters]
+        if len(set(names)) != len(names):
+            raise ValueError(f"filters must have distinct names, got {names}")
+        self._provider = provider or get_default_provider()
+        if self._provider is None:
+            raise ValueError("universe filters need a data provider, pass provider= or set a default provider")
+        self._lock = threading.RLock()
+        # 已计算的日期范围，以及每个筛选条件在范围内交易日上的结果（行为交易日，列为标的）
+        self._span: Optional[Tuple[pd.Timestamp, pd.Timestamp]] = None
+        self._passes: Dict[str, pd.DataFrame] = {}
+        self._members = pd.DataFrame(index=pd.DatetimeIndex([]), dtype=bool)
+        self._logger = get_logger(__name__)
+    
+    @property
+    def base(self) -> Universe:
+        """原标的池 / Universe being filtered"""
+        return self._base
+    
+    @property
+    def filters(self) -> List[InstrumentFilter]:
+        """筛选条件 / Filters"""
+        return list(self._filters)
+    
+    def members(self, t: TimeLike) -> List[str]:
+        """获取某日通过筛选的成分股 / Get the constituents on a date that pass the filters"""
+        day = _to_day(t)
+        row = self._row(self._members_between(day - _LOOKBEHIND, day), day)
+        return sorted(row.index[row.to_numpy()]) if row is not None else []
+    
+    def members_between(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> List[str]:
+        """
+        区间内任意交易日通过筛选的成分股 / Members passing the filters on any trading day in a range
+        
+        None表示交易日历的起止 / None stands for the ends of the trading calendar
+        """
+        table = self._members_between(start, end)
+        return sorted(table.columns[table.any(axis=0).to_numpy()])
+    
+    def is_member(self, instrument: str, t: TimeLike) -> bool:
+        """判断标的在某日是否为通过筛选的成分股 / Whether an instrument is a member passing the filters on a date"""
+        return instrument in self.members(t)
+    
+    def membership_mask(self, instrument: str, index: pd.DatetimeIndex) -> np.ndarray:
+        """标记索引中标的为通过筛选的成分股的行 / Mark the rows of an index where the instrument is a member passing the filters"""
+        index = pd.DatetimeIndex(index)
+        if index.tz is not None:
+            index = index.tz_localize(None)
+        if len(index) == 0:
+            return np.zeros(0, dtype=bool)
+        days = index.normalize()
+        table = self._members_between(days.min() - _LOOKBEHIND, days.max())
+        if instrument not in table.columns:
+            return np.zeros(len(index), dtype=bool)
+        column = table[instrument].reindex(days, method="ffill")
+        return column.fillna(False).to_numpy(dtype=bool)
+    
+    def membership(
+        self,
+        start: Optional[TimeLike] = None,
+        end: Optional[TimeLike] = None
+    ) -> pd.DataFrame:
+        """
+        获取区间内每个交易日的成分股 / Get the membership of every trading day in a range
+        
+        Args:
+            start: 开始日期（包含），None表示数据起始 / Start date (inclusive), None for the start of the data
+            end: 结束日期（包含），None表示数据结束 / End date (inclusive), None for the end of the data
+        
+        Returns:
+            pd.DataFrame: 行为交易日、列为区间内曾属于原标的池的标的的布尔表 /
+                Boolean frame with a row per trading day and a column per
+                instrument that was in the base universe during the range
+        """
+        return self._members_between(start, end).copy()
+    
+    def exclusions(self, t: TimeLike) -> Dict[str, List[str]]:
+        """
+        获取某日被筛选剔除的标的及原因 / Get the instruments filtered out on a date and why
+        
+        Args:
+            t: 日期 / Date
+        
+        Returns:
+            Dict[str, List[str]]: 当日属于原标的池但未通过筛选的标的，到未通过的筛选条件名称的映射 /
+                Instrument in the base universe that day but filtered out, to
+                the names of the filters it failed
+        """
+        day = _to_day(t)
+        with self._lock:
+            self._members_between(day - _LOOKBEHIND, day)
+            failed: Dict[str, List[str]] = {}
+            for name, passes in self._passes.items():
+                row = self._row(passes, day)
+                if row is None:
+                    continue
+                for instrument in row.index[~row.to_numpy()]:
+                    if self._base.is_member(instrument, day):
+                        failed.setdefault(instrument, []).append(name)
+        return {instrument: failed[instrument] for instrument in sorted(failed)}
+    
+    def _members_between(self, start: Optional[TimeLike], end: Optional[TimeLike]) -> pd.DataFrame:
+        """计算并返回区间内的成分股表 / Compute and return the membership table of a range"""
+        lower, upper = self._bounds(start, end)
+        with self._lock:
+            self._ensure(lower, upper)
+            return self._members.loc[lower:upper]
+    
+    def _bounds(
+        self,
+        start: Optional[TimeLike],
+        end: Optional[TimeLike]
+    ) -> Tuple[pd.Timestamp, pd.Timestamp]:
+        """把None替换为日历的起止日期 / Replace None bounds with the ends of the calendar"""
+        if start is not None and end is not None:
+            return _to_day(start), _to_day(end)
+        calendar = self._provider.calendar()
+        if not calendar:
+            return _to_day(start or OPEN_END), _to_day(end or OPEN_END)
+        lower = _to_day(calendar[0] if start is None else start)
+        upper = _to_day(calendar[-1] if end is None else end)
+        return lower, upper
+    
+    def _ensure(self, lower: pd.Timestamp, upper: pd.Timestamp) -> None:
+        """
+        计算缺少的日期范围，调用方持有锁 / Compute the missing part of a range; caller holds the lock
+        
+        已计算的范围只向两端扩展，每天逐日查询时只计算新增的日期
+        The computed span only grows at its ends, so querying day after day
+        only computes the new days
+        """
+        if lower > upper:
+            return
+        if self._span is None:
+            pieces = [(lower, upper)]
+        else:
+            computed_lower, computed_upper = self._span
+            pieces = []
+            if lower < computed_lower:
+                pieces.append((lower, computed_lower - pd.Timedelta(days=1)))
+            if upper > computed_upper:
+                pieces.append((computed_upper + pd.Timedelta(days=1), upper))
+            lower, upper = min(lower, computed_lower), max(upper, computed_upper)
+        if not pieces:
+            return
+        
+        for piece_lower, piece_upper in pieces:
+            members, passes = self._evaluate(piece_lower, piece_upper)
+            self._members = _stack(self._members, members)
+            for name, table in passes.items():
+                self._passes[name] = _stack(self._passes.get(name), table)
+        self._span = (lower, upper)
+    
+    def _evaluate(
+        self,
+        lower: pd.Timestamp,
+        upper: pd.Timestamp
+    ) -> Tuple[pd.DataFrame, Dict[str, pd.DataFrame]]:
+        """计算一段日期范围内的筛选结果 / Compute the filter results of one date range"""
+        calendar = _days(self._provider.calendar(end_time=upper.strftime("%Y-%m-%d")))
+        first = int(calendar.searchsorted(lower))
+        days = calendar[first:]
+        instruments = self._base.members_between(lower, upper)
+        passes = {f.name: pd.DataFrame(False, index=days, columns=instruments) for f in self._filters}
+        members = pd.DataFrame(False, index=days, columns=instruments)
+        if len(days) == 0 or not instruments:
+            return members, passes
+        
+        lookbacks = [f.lookback for f in self._filters]
+        if any(lookback is None for lookback in lookbacks):
+            history = calendar
+        else:
+            history = calendar[max(0, first - max(lookbacks, default=0)):]
+        fields = list(dict.fromkeys(field for f in self._filters for field in f.fields))
+        
+        for instrument in instruments:
+            frame = self._load(instrument, fields, history)
+            passed = self._base.membership_mask(instrument, days)
+            for f in self._filters:
+                result = f.evaluate(frame).reindex(days).fillna(False).to_numpy(dtype=bool)
+                passes[f.name][instrument] = result
+                passed = passed & result
+            members[instrument] = passed
+        self._logger.debug(
+            f"已筛选标的池: {self.name}, {lower.date()} ~ {upper.date()}, 标的数量: {len(instruments)}"
+        )
+        return members, passes
+    
+    def _load(self, instrument: str, fields: List[str], history: pd.DatetimeIndex) -> pd.DataFrame:
+        """加载筛选字段并对齐到交易日历，没有数据的标的为全NaN / Load the filter fields onto the calendar, all NaN without data"""
+        if not fields:
+            return pd.DataFrame(index=history)
+        try:
+            frame = self._provider.load_features(
+                instrument, fields,
+                start_time=history[0].strftime("%Y-%m-%d"),
+                end_time=history[-1].strftime("%Y-%m-%d")
+            )
+        except InstrumentNotFoundError as e:
+            self._logger.debug(f"标的没有数据，视为未通过筛选: {instrument}: {e}")
+            return pd.DataFrame(np.nan, index=history, columns=fields)
+        frame = frame.copy()
+        frame.index = _days(frame.index)
+        frame = frame[~frame.index.duplicated(keep="last")]
+        return frame.reindex(index=history, columns=fields)
+    
+    def _row(self, table: pd.DataFrame, day: pd.Timestamp) -> Optional[pd.Series]:
+        """取某日或之前最近交易日的行 / Take the row of a day or the nearest earlier trading day"""
+        position = int(table.index.searchsorted(day, side="right")) - 1
+        if position < 0:
+            return None
+        return table.iloc[position].astype(bool)
+    
+    def __repr__(self) -> str:
+        return (
+            f"{type(self).__name__}(name={self.name!r}, instruments={len(self._periods)}, "
+            f"filters={[f.name for f in self._filters]})"
+        )
+
+
+def _days(values) -> pd.DatetimeIndex:
+    """转换为去掉时区和时分秒的日期索引 / Convert to a day index without timezone or time of day"""
+    index = pd.DatetimeIndex(values)
+    if index.tz is not None:
+        index = index.tz_localize(None)
+    return index.normalize()
+
+
+def _stack(table: Optional[pd.DataFrame], piece: pd.DataFrame) -> pd.DataFrame:
+    """按日期合并两段结果，缺少的标的填False / Stack two ranges of results, filling absent instruments with False"""
+    if table is None or (table.empty and len(table.columns) == 0):
+        return piece.sort_index()
+    stacked = pd.concat([table, piece]).sort_index()
+    stacked = stacked[sorted(stacked.columns)]
+    return stacked.fillna(False).astype(bool)
@@ -0,0 +1,481 @@
+"""
+数据校验模块 / Data Validation Module
+检查获取到的单标的数据：时间索引是否严格递增（乱序的行和重复时间戳）、缺失的交易日、非交易日的K线、
+超过阈值的时间缺口、非正价格、最高价低于最低价和成交量异常，并可修复小的缺口和重复行，每一处修改
+都记录在报告中。校验需要显式调用（或在get_features()中开启），不会拖慢普通的读取。
+Checks a fetched per-instrument frame for an index that isn't strictly
+increasing (out-of-order rows and duplicate timestamps), missing trading
+days, bars on non-trading days, time gaps over a threshold, non-positive
+prices, highs below lows and volume spikes, and can repair small gaps and
+duplicates, recording every change in the report. Validation only runs when
+asked for (or turned on in get_features()), so normal reads don't pay for it.
+
+缺失交易日和非交易日的K线只在提供交易日历时检查：没有日历就无法区分停牌和休市。日内数据以“某个
+交易日没有任何K线”为缺失。
+Missing trading days and bars on non-trading days are only checked with a
+trading calendar, since without one a suspension can't be told from a
+holiday. For intraday data a day is missing when it has no bar at all.
+
+Examples:
+    >>> report = result["SH600000"].validate(get_calendar("SSE"))
+    >>> frame, report = result["SH600000"].repair(get_calendar("SSE"), max_fill_days=2)
+    >>> print(report)
+    >>> [issue.message for issue in result["SH600000"].validate(max_gap="10D").issues]
+"""
+
+from dataclasses import dataclass, field
+from enum import Enum
+from typing import Any, Dict, List, Optional, Tuple, Union
+
+import numpy as np
+import pandas as pd
+
+from ..utils.error_handler import DataError, ErrorInfo, ErrorCategory, ErrorSeverity
+from .trading_calendar import TradingCalendar
+
+
+# 检查非正价格的字段 / Fields checked for non-positive prices
+PRICE_FIELDS = ("$open", "$high", "$low", "$close")
+VOLUME_FIELD = "$volume"
+# 成交量标准分超过该值视为异常 / Volume z-scores above this count as spikes
+DEFAULT_VOLUME_ZSCORE = 5.0
+
+TimeLike = Union[str, pd.Timestamp]
+
+
+class IssueKind(Enum):
+    """数据问题类型 / Kind of data issue"""
+    MISSING_DAY = "missing_day"  # 缺失的交易日
+    DUPLICATE_TIMESTAMP = "duplicate_timestamp"  # 重复时间戳
+    NON_POSITIVE_PRICE = "non_positive_price"  # 价格小于等于0
+    HIGH_BELOW_LOW = "high_below_low"  # 最高价低于最低价
+    VOLUME_SPIKE = "volume_spike"  # 成交量异常
+    OUT_OF_ORDER = "out_of_order"  # 时间戳早于前一行
+    NON_TRADING_DAY = "non_trading_day"  # 非交易日的K线
+    GAP = "gap"  # 相邻两行的时间间隔超过阈值
+
+
+@dataclass(frozen=True)
+class Issue:
+    """
+    一个数据问题 / One data issue
+    
+    Attributes:
+        kind: 问题类型 / Kind of issue
+        time: 出问题的时间戳或交易日，时间缺口为缺口开始的时间 /
+            Timestamp or trading day of the issue; where the gap starts for a gap
+        field: 相关字段，与字段无关时为None / Field involved, None when not field-specific
+        value: 相关数值，如价格、成交量标准分或缺口的天数 /
+            Value involved, e.g. the price, the volume z-score or the length of a gap in days
+        other: 相关的另一个时间戳：乱序的行为前一行的时间，时间缺口为缺口结束的时间 /
+            The other timestamp involved: the previous row's for an out-of-order row, where the gap ends for a gap
+    """
+    kind: IssueKind
+    time: pd.Timestamp
+    field: Optional[str] = None
+    value: Optional[float] = None
+    other: Optional[pd.Timestamp] = None
+    
+    @property
+    def times(self) -> Tuple[pd.Timestamp, ...]:
+        """出问题的全部时间戳 / Every timestamp involved"""
+        return (self.time,) if self.other is None else (self.time, self.other)
+    
+    @property
+    def message(self) -> str:
+        """问题描述 / Description of the issue"""
+        kind = self.kind
+        if kind is IssueKind.MISSING_DAY:
+            return f"no data on trading day {self.time.date()}"
+        if kind is IssueKind.DUPLICATE_TIMESTAMP:
+            return f"timestamp {self.time} appears more than once"
+        if kind is IssueKind.OUT_OF_ORDER:
+            return f"timestamp {self.time} comes after {self.other}, the index is not increasing"
+        if kind is IssueKind.NON_TRADING_DAY:
+            return f"bar at {self.time} falls on a non-trading day"
+        if kind is IssueKind.GAP:
+            return f"no bars between {self.time} and {self.other} ({self.value:g} days)"
+        if kind is IssueKind.NON_POSITIVE_PRICE:
+            return f"{self.field} is {self.value:g} at {self.time}"
+        if kind is IssueKind.HIGH_BELOW_LOW:
+            return f"$high {self.value:g} is below $low at {self.time}"
+        return f"{self.field} z-score is {self.value:g} at {self.time}"
+
+
+class RepairAction(Enum):
+    """修复操作类型 / Kind of repair"""
+    FORWARD_FILL = "forward_fill"  # 用前一行补入缺失的交易日
+    DROP_DUPLICATE = "drop_duplicate"  # 删除重复时间戳的较早行
+
+
+@dataclass(frozen=True)
+class Repair:
+    """
+    一处修改 / One change made by a repair
+    
+    Attributes:
+        action: 修复操作 / Repair action
+        time: 补入或删除的行的时间 / Time of the inserted or dropped row
+        source: 补入的行复制自哪个时间，删除时为保留的行 /
+            Time the inserted row was copied from, or of the row kept when dropping
+    """
+    action: RepairAction
+    time: pd.Timestamp
+    source: Optional[pd.Timestamp] = None
+
+
+@dataclass
+class ValidationReport:
+    """
+    数据校验报告 / Validation report
+    
+    修复时issues为修复后仍然存在的问题，repairs为所做的每一处修改
+    After a repair, issues are the ones still present and repairs lists every
+    change that was made
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        issues: 发现的问题，按时间排序 / Issues found, in time order
+        repairs: 所做的修改 / Changes made
+    """
+    instrument: Optional[str] = None
+    issues: List[Issue] = field(default_factory=list)
+    repairs: List[Repair] = field(default_factory=list)
+    
+    @property
+    def ok(self) -> bool:
+        """是否没有问题 / Whether no issues were found"""
+        return not self.issues
+    
+    def of(self, kind: IssueKind) -> List[Issue]:
+        """
+        获取某种类型的问题 / Get the issues of one kind
+        
+        Args:
+            kind: 问题类型 / Kind of issue
+        
+        Returns:
+            List[Issue]: 该类型的问题 / Issues of that kind
+        """
+        return [issue for issue in self.issues if issue.kind == kind]
+    
+    @property
+    def missing_days(self) -> List[pd.Timestamp]:
+        """缺失的交易日 / Missing trading days"""
+        return [issue.time for issue in self.of(IssueKind.MISSING_DAY)]
+    
+    @property
+    def duplicates(self) -> List[pd.Timestamp]:
+        """重复的时间戳，每个只列一次 / Duplicated timestamps, each listed once"""
+        return [issue.time for issue in self.of(IssueKind.DUPLICATE_TIMESTAMP)]
+    
+    @property
+    def out_of_order(self) -> List[pd.Timestamp]:
+        """早于前一行的时间戳 / Timestamps earlier than the row before them"""
+        return [issue.time for issue in self.of(IssueKind.OUT_OF_ORDER)]
+    
+    @property
+    def gaps(self) -> List[Tuple[pd.Timestamp, pd.Timestamp]]:
+        """超过阈值的时间缺口，为(开始, 结束) / Gaps over the threshold as (start, end)"""
+        return [(issue.time, issue.other) for issue in self.of(IssueKind.GAP)]
+    
+    def counts(self) -> Dict[str, int]:
+        """各类型问题的数量 / Number of issues of each kind"""
+        return {kind.value: len(self.of(kind)) for kind in IssueKind}
+    
+    def to_dict(self) -> Dict[str, Any]:
+        """转换为可序列化的字典 / Convert to a serializable dict"""
+        return {
+            "instrument": self.instrument,
+            "ok": self.ok,
+            "issues": [
+                {
+                    "kind": i.kind.value,
+                    "time": i.time.isoformat(),
+                    "field": i.field,
+                    "value": i.value,
+                    "other": None if i.other is None else i.other.isoformat(),
+                    "message": i.message
+                }
+                for i in self.issues
+            ],
+            "repairs": [
+                {
+                    "action": r.action.value,
+                    "time": r.time.isoformat(),
+                    "source": None if r.source is None else r.source.isoformat()
+                }
+                for r in self.repairs
+            ],
+        }
+    
+    def __str__(self) -> str:
+        name = self.instrument or "-"
+        if self.ok and not self.repairs:
+            return f"{name}: 校验通过 / OK"
+        counts = ", ".join(f"{kind}={n}" for kind, n in self.counts().items() if n)
+        lines = [f"{name}: {counts or 'OK'}"]
+        for issue in self.issues:
+            detail = "" if issue.field is None else f" {issue.field}"
+            if issue.value is not None:
+                detail += f" = {issue.value:g}"
+            if issue.other is not None:
+                detail += f" ({issue.other})"
+            lines.append(f"  {issue.kind.value} {issue.time}{detail}")
+        for repair in self.repairs:
+            source = "" if repair.source is None else f" <- {repair.source}"
+            lines.append(f"  repaired {repair.action.value} {repair.time}{source}")
+        return "\n".join(lines)
+
+
+class DataValidationError(DataError):
+    """
+    数据校验失败错误 / Data validation error
+    
+    严格模式下标的数据未通过校验时记录在FeatureResult.errors中，report为完整的校验报告
+    Recorded in FeatureResult.errors in strict mode when an instrument's data
+    fails validation; report holds the full validation report
+    """
+    
+    def __init__(self, report: ValidationReport):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            report: 校验报告 / Validation report
+        """
+        self.report = report
+        counts = ", ".join(f"{kind}={n}" for kind, n in report.counts().items() if n)
+        error_info = ErrorInfo(
+            error_code="DAT0027",
+            error_message_zh=f"标的数据未通过校验: {report.instrument} ({counts})",
+            error_message_en=f"Data failed validation for instrument: {report.instrument} ({counts})",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=str(report),
+            suggested_actions=[
+                "检查数据源中对应日期的原始数据",
+                "使用repair修复小的缺口和重复行，或关闭严格模式"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+@dataclass(frozen=True)
+class ValidationOptions:
+    """
+    数据校验选项 / Validation options
+    
+    Attributes:
+        volume_zscore: 成交量标准分阈值，None表示不检查 / Volume z-score threshold, None disables the check
+        max_fill_days: 修复时最多向前填充的连续缺失交易日数，0表示不填充 /
+            Longest run of missing trading days a repair forward-fills, 0 disables filling
+        drop_duplicates: 修复时是否删除重复时间戳，保留最后一行 /
+            Whether a repair drops duplicate timestamps, keeping the last row
+        max_gap: 相邻两行的最大时间间隔，如"10D"，超过时报告时间缺口；None表示不检查 /
+            Longest time between consecutive rows, e.g. "10D", past which a gap is reported; None disables the check
+    """
+    volume_zscore: Optional[float] = DEFAULT_VOLUME_ZSCORE
+    max_fill_days: int = 0
+    drop_duplicates: bool = False
+    max_gap: Optional[Union[str, pd.Timedelta]] = None
+    
+    def __post_init__(self):
+        if self.max_fill_days < 0:
+            raise ValueError(f"max_fill_days must be non-negative, got {self.max_fill_days}")
+        if self.volume_zscore is not None and self.volume_zscore <= 0:
+            raise ValueError(f"volume_zscore must be positive, got {self.volume_zscore}")
+        if self.max_gap is not None:
+            object.__setattr__(self, "max_gap", _to_max_gap(self.max_gap))
+    
+    @property
+    def repairs(self) -> bool:
+        """是否进行任何修复 / Whether any repair is enabled"""
+        return self.max_fill_days > 0 or self.drop_duplicates
+
+
+def validate_frame(
+    frame: pd.DataFrame,
+    calendar: Optional[TradingCalendar] = None,
+    start: Optional[TimeLike] = None,
+    end: Optional[TimeLike] = None,
+    volume_zscore: Optional[float] = DEFAULT_VOLUME_ZSCORE,
+    instrument: Optional[str] = None,
+    max_gap: Optional[Union[str, pd.Timedelta]] = None
+) -> ValidationReport:
+    """
+    校验单标的数据 / Validate a per-instrument frame
+    
+    时间缺口按排序后的时间计算，因此乱序的行不会同时报告为缺口
+    Gaps are measured over the sorted timestamps, so an out-of-order row
+    isn't reported as a gap as well
+    
+    Args:
+        frame: 以时间为索引的数据 / Time-indexed frame
+        calendar: 交易日历，None表示不检查缺失交易日和非交易日的K线 /
+            Trading calendar, None skips the missing-day and non-trading-day checks
+        start: 检查缺失交易日的开始时间，None表示数据的第一行 /
+            Start of the missing-day check, None for the first row
+        end: 检查缺失交易日的结束时间，None表示数据的最后一行 /
+            End of the missing-day check, None for the last row
+        volume_zscore: 成交量标准分阈值，None表示不检查 / Volume z-score threshold, None disables the check
+        instrument: 报告中的标的代码 / Instrument code for the report
+        max_gap: 相邻两行的最大时间间隔，如"10D"，None表示不检查时间缺口 /
+            Longest time between consecutive rows, e.g. "10D"; None skips the gap check
+    
+    Returns:
+        ValidationReport: 校验报告 / Validation report
+    """
+    index = pd.DatetimeIndex(frame.index)
+    issues: List[Issue] = []
+    
+    if calendar is not None:
+        issues.extend(Issue(IssueKind.MISSING_DAY, day) for day in _missing_days(index, calendar, start, end))
+        days = (index if index.tz is None else index.tz_localize(None)).normalize()
+        closed = [day for day in days.unique() if not pd.isna(day) and not calendar.is_trading_day(day)]
+        for position in np.flatnonzero(days.isin(closed)):
+            issues.append(Issue(IssueKind.NON_TRADING_DAY, index[position]))
+    
+    duplicated = index[index.duplicated(keep="first")].unique()
+    issues.extend(Issue(IssueKind.DUPLICATE_TIMESTAMP, ts) for ts in duplicated)
+    
+    # 与前一行相同的时间戳已作为重复报告，这里只报告更早的
+    for position in np.flatnonzero(index[1:] < index[:-1]) + 1:
+        issues.append(Issue(IssueKind.OUT_OF_ORDER, index[position], other=index[position - 1]))
+    
+    if max_gap is not None and len(index) > 1:
+        threshold = _to_max_gap(max_gap)
+        ordered = index.dropna().unique().sort_values()
+        spans = ordered[1:] - ordered[:-1]
+        for position in np.flatnonzero(spans > threshold):
+            issues.append(Issue(
+                IssueKind.GAP, ordered[position], value=spans[position] / pd.Timedelta(days=1),
+                other=ordered[position + 1]
+            ))
+    
+    for name in PRICE_FIELDS:
+        if name in frame.columns:
+            values = frame[name].to_numpy(dtype=float)
+            for position in np.flatnonzero(values <= 0):
+                issues.append(Issue(IssueKind.NON_POSITIVE_PRICE, index[position], name, float(values[position])))
+    
+    if "$high" in frame.columns and "$low" in frame.columns:
+        high = frame["$high"].to_numpy(dtype=float)
+        low = frame["$low"].to_numpy(dtype=float)
+        for position in np.flatnonzero(high < low):
+            issues.append(Issue(IssueKind.HIGH_BELOW_LOW, index[position], "$high", float(high[position])))
+    
+    if volume_zscore is not None and VOLUME_FIELD in frame.columns:
+        volume = frame[VOLUME_FIELD].to_numpy(dtype=float)
+        valid = volume[np.isfinite(volume)]
+        std = valid.std(ddof=1) if len(valid) > 2 else 0.0
+        if std > 0:
+            with np.errstate(invalid="ignore"):
+                scores = (volume - valid.mean()) / std
+            for position in np.flatnonzero(scores > volume_zscore):
+                issues.append(Issue(IssueKind.VOLUME_SPIKE, index[position], VOLUME_FIELD, float(scores[position])))
+    
+    issues.sort(key=lambda issue: issue.time)
+    return ValidationReport(instrument=instrument, issues=issues)
+
+
+def repair_frame(
+    frame: pd.DataFrame,
+    options: ValidationOptions,
+    calendar: Optional[TradingCalendar] = None,
+    start: Optional[TimeLike] = None,
+    end: Optional[TimeLike] = None,
+    instrument: Optional[str] = None
+) -> Tuple[pd.DataFrame, ValidationReport]:
+    """
+    修复并重新校验单标的数据 / Repair a per-instrument frame and validate the result
+    
+    先删除重复时间戳（保留最后一行），再用缺口前的最后一行向前填充不超过max_fill_days个
+    连续交易日的缺口；更长的缺口、数据开始之前的缺口和其他问题保持原样，仍出现在报告中。
+    只有日线数据会被填充。
+    Duplicate timestamps are dropped first (keeping the last row), then gaps of
+    at most max_fill_days consecutive trading days are forward-filled from the
+    last row before the gap. Longer gaps, gaps before the first row and every
+    other issue are left alone and stay in the report. Only daily data is filled.
+    
+    Args:
+        frame: 以时间为索引的数据 / Time-indexed frame
+        options: 校验和修复选项 / Validation and repair options
+        calendar: 交易日历，填充缺口时需要 / Trading calendar, needed to fill gaps
+        start: 检查缺失交易日的开始时间 / Start of the missing-day check
+        end: 检查缺失交易日的结束时间 / End of the missing-day check
+        instrument: 报告中的标的代码 / Instrument code for the report
+    
+    Returns:
+        Tuple[pd.DataFrame, ValidationReport]: (修复后的数据, 修复后的校验报告，包含所有修改) /
+            (repaired frame, report of the repaired frame including every change)
+    """
+    repairs: List[Repair] = []
+    index = pd.DatetimeIndex(frame.index)
+    
+    if options.drop_duplicates and index.has_duplicates:
+        dropped = index.duplicated(keep="last")
+        for ts in index[dropped]:
+            repairs.append(Repair(RepairAction.DROP_DUPLICATE, ts, ts))
+        frame = frame[~dropped]
+        index = pd.DatetimeIndex(frame.index)
+    
+    daily = len(index) > 0 and bool((index == index.normalize()).all())
+    if calendar is not None and options.max_fill_days > 0 and daily and not index.has_duplicates:
+        missing = _missing_days(index, calendar, start, end)
+        fills = []
+        for gap in _runs(missing, calendar):
+            naive = index if index.tz is None else index.tz_localize(None)
+            source_position = naive.searchsorted(gap[0]) - 1
+            if len(gap) > options.max_fill_days or source_position < 0:
+                continue
+            source = index[source_position]
+            for day in gap:
+                fills.append((day, source))
+                repairs.append(Repair(RepairAction.FORWARD_FILL, day, source))
+        if fills:
+            filled = frame.loc[[source for _, source in fills]].copy()
+            days = pd.DatetimeIndex([day for day, _ in fills], name=frame.index.name)
+            filled.index = days if index.tz is None else days.tz_localize(index.tz)
+            frame = pd.concat([frame, filled]).sort_index(kind="stable")
+    
+    report = validate_frame(frame, calendar, start, end, options.volume_zscore, instrument, options.max_gap)
+    report.repairs = sorted(repairs, key=lambda repair: repair.time)
+    return frame, report
+
+
+def _to_max_gap(max_gap: Union[str, pd.Timedelta]) -> pd.Timedelta:
+    """把时间缺口阈值转换为Timedelta / Convert a gap threshold to a Timedelta"""
+    threshold = pd.Timedelta(max_gap)
+    if pd.isna(threshold) or threshold <= pd.Timedelta(0):
+        raise ValueError(f"max_gap must be a positive duration such as '10D', got {max_gap!r}")
+    return threshold
+
+
+def _missing_days(
+    index: pd.DatetimeIndex,
+    calendar: TradingCalendar,
+    start: Optional[TimeLike],
+    end: Optional[TimeLike]
+) -> List[pd.Timestamp]:
+    """区间内没有任何数据的交易日 / Trading days in the range with no data at all"""
+    if len(index) == 0 and (start is None or end is None):
+        return []
+    if index.tz is not None:
+        index = index.tz_localize(None)
+    lower = pd.Timestamp(start) if start is not None else index.min()
+    upper = pd.Timestamp(end) if end is not None else index.max()
+    present = set(index.normalize())
+    return [day for day in calendar.between(lower.normalize(), upper) if day not in present]
+
+
+def _runs(days: List[pd.Timestamp], calendar: TradingCalendar) -> List[List[pd.Timestamp]]:
+    """把缺失交易日分为连续的缺口 / Split missing trading days into consecutive gaps"""
+    runs: List[List[pd.Timestamp]] = []
+    for day in days:
+        if runs and calendar.next(runs[-1][-1]) == day:
+            runs[-1].append(day)
+        else:
+            runs.append([day])
+    return runs
@@ -3,8 +3,45 @@
 提供日志、qlib封装、MLflow追踪、交易API、通知服务等基础服务 / Provides logging, qlib wrapper, MLflow tracking, trading API, notification service and other infrastructure services
 """
 
-from .logger_system import LoggerSystem, get_logger, setup_logging
+from .logger_system import LoggerSystem, Logger, NullLogger, get_logger, set_logger, setup_logging
 from .qlib_wrapper import QlibWrapper, QlibInitializationError, QlibDataError
+from .data_provider import (
+    DataProvider,
+    ProviderConfig,
+    QlibDataProvider,
+    UnsupportedFrequencyError,
+    FundamentalsUnavailableError,
+    MetadataUnavailableError,
+    InstrumentNotFoundError,
+    FieldNotFoundError,
+    AdjustmentsUnavailableError,
+    ProviderUnhealthyError,
+    CorporateAction,
+    CashDividend,
+    Split,
+    RightsIssue,
+    Earnings,
+    SUPPORTED_FREQS,
+    FUNDAMENTAL_FIELDS,
+    Freq,
+    to_freq,
+    adjustment_factor,
+    corporate_actions_from,
+    earnings_from,
+    register_provider,
+    get_provider,
+    list_providers,
+    set_default_provider,
+    get_default_provider
+)
+from .csv_provider import CSVDataProvider
+from .parquet_provider import ParquetDataProvider, read_parquet, write_parquet
+from .reader_pool import ReaderPool
+from .cached_provider import CachedDataProvider, with_cache
+from .memory_cached_provider import CacheStats, MemoryCachedDataProvider, with_memory_cache
+from .chain_provider import ChainProvider, chain
+from .subscription import LiveBar, Subscription
+from .replay_provider import ReplayDataProvider
 from .mlflow_tracker import MLflowTracker, MLflowError
 from .trading_api_adapter import TradingAPIAdapter
 from .notification_service import (
@@ -16,11 +53,56 @@ from .notification_service import (
 
 __all__ = [
     'LoggerSystem',
+    'Logger',
+    'NullLogger',
     'get_logger',
+    'set_logger',
     'setup_logging',
     'QlibWrapper',
     'QlibInitializationError',
     'QlibDataError',
+    'DataProvider',
+    'ProviderConfig',
+    'QlibDataProvider',
+    'UnsupportedFrequencyError',
+    'FundamentalsUnavailableError',
+    'MetadataUnavailableError',
+    'InstrumentNotFoundError',
+    'FieldNotFoundError',
+    'AdjustmentsUnavailableError',
+    'ProviderUnhealthyError',
+    'CorporateAction',
+    'CashDividend',
+    'Split',
+    'RightsIssue',
+    'Earnings',
+    'SUPPORTED_FREQS',
+    'FUNDAMENTAL_FIELDS',
+    'Freq',
+    'to_freq',
+    'adjustment_factor',
+    'corporate_actions_from',
+    'earnings_from',
+    'register_provider',
+    'get_provider',
+    'list_providers',
+    'set_default_provider',
+    'get_default_provider',
+    'CSVDataProvider',
+    'ParquetDataProvider',
+    'read_parquet',
+    'write_parquet',
+    'ReaderPool',
+    'CachedDataProvider',
+    'with_cache',
+    'CacheStats',
+    'MemoryCachedDataProvider',
+    'with_memory_cache',
+    'ChainProvider',
+    'chain',
+    'LiveBar',
+    'Subscription',
+    'ReplayDataProvider',
     'MLflowTracker',
     'MLflowError',
     'TradingAPIAdapter',
@@ -0,0 +1,353 @@
+"""
+带磁盘缓存的数据提供者模块 / Cached Data Provider Module
+包装任意数据提供者，把获取到的特征数据缓存在本地磁盘上
+Wraps any data provider and caches the fetched feature data on local disk
+"""
+
+import logging
+import time
+from typing import Dict, List, Optional, Tuple
+
+import pandas as pd
+
+from .data_provider import ALL_MARKET, DataProvider, QlibDataProvider
+from .logger_system import current_logger, get_logger, log_enabled
+from ..utils.feature_cache import CacheEntry, FeatureCache
+from .subscription import Subscription
+from ..utils.request_context import RequestContext
+
+
+Segment = Tuple[Optional[pd.Timestamp], Optional[pd.Timestamp]]
+
+
+def _to_bound(value: Optional[str]) -> Optional[pd.Timestamp]:
+    if value is None:
+        return None
+    ts = pd.Timestamp(value)
+    if ts.tzinfo is not None:
+        ts = ts.tz_localize(None)
+    return ts
+
+
+def _merge_bound(a: Optional[pd.Timestamp], b: Optional[pd.Timestamp], pick) -> Optional[pd.Timestamp]:
+    # None表示不限，合并后仍为不限
+    if a is None or b is None:
+        return None
+    return pick(a, b)
+
+
+class CachedDataProvider(DataProvider):
+    """
+    带磁盘缓存的数据提供者 / Data provider with a disk cache
+    
+    缓存按(标的, 字段, 频率)记录已覆盖的时间区间。请求区间完全落在已覆盖区间内时
+    （例如已缓存"2025-01-01..2025-06-30"，请求"2025-03-01..2025-04-30"）直接从缓存返回；
+    部分重叠时只向底层提供者请求缺失的头部或尾部，再与缓存合并。
+    The cache records the covered time range per (instrument, field,
+    frequency). A request inside the covered range (e.g. "2025-03-01..2025-04-30"
+    after "2025-01-01..2025-06-30" was cached) is served from the cache alone;
+    on partial overlap only the missing head or tail is fetched from the
+    underlying provider and merged in.
+    """
+    
+    def __init__(self, provider: DataProvider, cache: FeatureCache):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            provider: 底层数据提供者 / Underlying data provider
+            cache: 特征缓存 / Feature cache
+        """
+        self._provider = provider
+        self._cache = cache
+        self.name = f"{provider.name}+cache"
+        self._logger = get_logger(__name__)
+    
+    @property
+    def provider(self) -> DataProvider:
+        """底层数据提供者 / Underlying data provider"""
+        return self._provider
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """与底层提供者相同 / Same as the underlying provider"""
+        return self._provider.freqs
+    
+    @property
+    def adjusted_prices(self) -> bool:
+        """与底层提供者相同 / Same as the underlying provider"""
+        return self._provider.adjusted_prices
+    
+    @property
+    def cache(self) -> FeatureCache:
+        """特征缓存 / Feature cache"""
+        return self._cache
+    
+    def invalidate(self, instrument: Optional[str] = None) -> int:
+        """
+        使缓存失效 / Invalidate the cache
+        
+        Args:
+            instrument: 标的代码，None表示清除所有 / Instrument code, None clears everything
+        
+        Returns:
+            int: 删除的条目数 / Number of entries removed
+        """
+        return self._cache.invalidate(instrument)
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的特征数据，优先使用缓存 / Load feature data, serving from cache when possible
+        """
+        return self._load(instrument, fields, start_time, end_time, freq)
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        在请求上下文中加载特征数据，缓存未命中时把上下文传给底层提供者 /
+        Load feature data under a request context, passing it to the provider on a miss
+        """
+        ctx.check()
+        return self._load(instrument, fields, start_time, end_time, freq, ctx)
+    
+    def _load(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str,
+        ctx: Optional[RequestContext] = None
+    ) -> pd.DataFrame:
+        start, end = _to_bound(start_time), _to_bound(end_time)
+        
+        with self._cache.lock(instrument, freq):
+            entries = {field: self._cache.read(instrument, field, freq) for field in fields}
+            
+            # 按缺失区间对字段分组，缺失区间相同的字段一起获取
+            pending: Dict[Tuple[Segment, ...], List[str]] = {}
+            for field, entry in entries.items():
+                segments = self._missing_segments(entry, start, end)
+                if segments:
+                    pending.setdefault(tuple(segments), []).append(field)
+            
+            if not pending and log_enabled(logging.DEBUG):
+                current_logger().debug("特征缓存命中: %s %s %s 至 %s", instrument, fields, start_time, end_time)
+            
+            for segments, group in pending.items():
+                fetched = [
+                    self._fetch(instrument, group, seg_start, seg_end, freq, ctx)
+                    for seg_start, seg_end in segments
+                ]
+                if log_enabled(logging.DEBUG):
+                    current_logger().debug("特征缓存未命中: %s %s, 获取区间: %s", instrument, group, list(segments))
+                for field in group:
+                    entries[field] = self._store(
+                        instrument, field, freq, entries[field], fetched, start, end
+                    )
+        
+        columns = {field: self._slice(entries[field].series, start, end) for field in fields}
+        frame = pd.DataFrame(columns)
+        frame.index.name = "datetime"
+        return frame
+    
+    def _fetch(
+        self,
+        instrument: str,
+        fields: List[str],
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp],
+        freq: str,
+        ctx: Optional[RequestContext]
+    ) -> pd.DataFrame:
+        """从底层提供者获取一个区间 / Fetch one range from the underlying provider"""
+        if ctx is None:
+            return self._provider.load_features(
+                instrument, fields, start_time=start, end_time=end, freq=freq
+            )
+        return self._provider.load_features_ctx(
+            ctx, instrument, fields, start_time=start, end_time=end, freq=freq
+        )
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """获取底层提供者的交易日历 / Get the underlying provider's calendar"""
+        return self._provider.calendar(start_time=start_time, end_time=end_time, freq=freq)
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """在请求上下文中获取底层提供者的交易日历 / Get the provider's calendar under a request context"""
+        return self._provider.calendar_ctx(ctx, start_time=start_time, end_time=end_time, freq=freq)
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str = "1min"
+    ) -> Subscription:
+        """订阅底层提供者的实时K线，不经过缓存 / Subscribe to the provider's live bars, bypassing the cache"""
+        return self._provider.subscribe(ctx, instruments, fields, freq)
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """检查底层提供者，不经过缓存 / Check the underlying provider, bypassing the cache"""
+        self._provider.healthcheck(ctx)
+    
+    def close(self) -> None:
+        """关闭底层提供者 / Close the underlying provider"""
+        self._provider.close()
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """列出底层提供者的字段 / List the underlying provider's fields"""
+        return self._provider.list_fields(instrument, freq=freq)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """列出底层提供者的标的 / List the underlying provider's instruments"""
+        return self._provider.list_instruments(market, freq=freq)
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """获取底层提供者的基本面公告记录，不经过缓存 / Get the provider's fundamental records, bypassing the cache"""
+        return self._provider.fundamentals(instruments, fields, start_time=start_time, end_time=end_time)
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """在请求上下文中获取底层提供者的基本面公告记录 / Get the provider's fundamental records under a request context"""
+        return self._provider.fundamentals_ctx(ctx, instruments, fields, start_time=start_time, end_time=end_time)
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """获取底层提供者的除权除息记录，不经过缓存 / Get the provider's split and dividend records, bypassing the cache"""
+        return self._provider.adjustments(instrument, start_time=start_time, end_time=end_time)
+    
+    @staticmethod
+    def _missing_segments(
+        entry: Optional[CacheEntry],
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> List[Segment]:
+        """
+        计算需要从底层提供者获取的区间 / Compute the ranges to fetch from the provider
+        
+        头部区间和尾部区间都包含已覆盖区间的边界，合并时以新数据为准，
+        避免边界上的行被遗漏
+        Head and tail segments include the covered boundary; new data wins on
+        merge so boundary rows are never missed
+        """
+        if entry is None:
+            return [(start, end)]
+        if entry.covers(start, end):
+            return []
+        
+        segments: List[Segment] = []
+        if entry.start is not None and (start is None or start < entry.start):
+            segments.append((start, entry.start))
+        if entry.end is not None and (end is None or end > entry.end):
+            segments.append((entry.end, end))
+        return segments
+    
+    def _store(
+        self,
+        instrument: str,
+        field: str,
+        freq: str,
+        entry: Optional[CacheEntry],
+        fetched: List[pd.DataFrame],
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> CacheEntry:
+        """把新获取的数据合并进缓存并写回 / Merge fetched data into the cache and write it back"""
+        parts = [] if entry is None else [entry.series]
+        parts.extend(frame[field] for frame in fetched if frame is not None and not frame.empty)
+        
+        if parts:
+            series = pd.concat(parts)
+            series = series[~series.index.duplicated(keep="last")].sort_index()
+        else:
+            series = pd.Series(dtype=float, index=pd.DatetimeIndex([], name="datetime"))
+        series.name = field
+        
+        if entry is None:
+            new_start, new_end = start, end
+        else:
+            new_start = _merge_bound(entry.start, start, min)
+            new_end = _merge_bound(entry.end, end, max)
+        
+        merged = CacheEntry(series=series, start=new_start, end=new_end, created_at=time.time())
+        self._cache.write(instrument, field, freq, merged)
+        return merged
+    
+    @staticmethod
+    def _slice(
+        series: pd.Series,
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> pd.Series:
+        if start is not None:
+            series = series[series.index >= start]
+        if end is not None:
+            series = series[series.index <= end]
+        return series
+
+
+def with_cache(
+    cache_dir: str,
+    provider: Optional[DataProvider] = None,
+    ttl: Optional[float] = None
+) -> CachedDataProvider:
+    """
+    为数据提供者加上磁盘缓存 / Add a disk cache in front of a data provider
+    
+    Args:
+        cache_dir: 缓存目录 / Cache directory
+        provider: 底层数据提供者，None表示使用qlib提供者 / Underlying provider, None uses qlib
+        ttl: 缓存有效期（秒），None表示永不过期 / Cache TTL in seconds, None never expires
+    
+    Returns:
+        CachedDataProvider: 带缓存的提供者 / Cached provider
+    
+    Examples:
+        >>> provider = with_cache("~/.qlib_cache/features", CSVDataProvider("./data"))
+        >>> manager = DataManager(provider=provider)
+    """
+    if provider is None:
+        provider = QlibDataProvider()
+    return CachedDataProvider(provider, FeatureCache(cache_dir, ttl=ttl))
@@ -0,0 +1,377 @@
+"""
+链式数据提供者模块 / Chained Data Provider Module
+把多个数据提供者串成一个逻辑数据源，按顺序为每个标的找到提供数据的提供者
+Chains several data providers into one logical source, finding for each
+instrument, in order, the provider that serves it
+
+例如部分标的保存在本地CSV、其余在远程服务中时，一次查询即可覆盖两者；
+某个提供者有该标的但缺少部分字段时，缺少的字段继续向后查找，结果按时间对齐合并。
+For example with some instruments in local CSV files and the rest in a
+remote store, one query covers both; when a provider has the instrument but
+lacks some of the fields, the missing ones fall through to the providers
+after it and the parts are joined on time.
+"""
+
+from typing import Callable, Dict, List, Optional, Set, Tuple, TypeVar
+
+import pandas as pd
+
+from .data_provider import (
+    ALL_MARKET,
+    SUPPORTED_FREQS,
+    AdjustmentsUnavailableError,
+    CorporateAction,
+    DataProvider,
+    FieldNotFoundError,
+    FundamentalsUnavailableError,
+    InstrumentNotFoundError,
+    MetadataUnavailableError,
+    to_freq
+)
+from .logger_system import get_logger
+from ..utils.request_context import RequestContext
+
+
+T = TypeVar("T")
+
+
+class ChainProvider(DataProvider):
+    """
+    按顺序回退的数据提供者 / Data provider that falls back through a chain
+    
+    每个标的使用第一个有该标的的提供者；提供者抛出FieldNotFoundError时，它有的字段照常读取，
+    缺少的字段交给之后的提供者。所有提供者都没有该标的时抛出InstrumentNotFoundError，
+    多标的查询中只影响该标的。不支持所请求频率的提供者被跳过。
+    Each instrument comes from the first provider that has it; when a
+    provider raises FieldNotFoundError the fields it does have are read as
+    usual and the missing ones go to the providers after it. When no
+    provider has the instrument InstrumentNotFoundError is raised, which in a
+    multi-instrument query only affects that instrument. Providers without
+    the requested frequency are skipped.
+    
+    交易日历、标的列表和字段列表为各提供者的并集；基本面数据、除权除息记录和公司行为
+    按标的使用第一个提供它们的提供者。
+    The calendar, instrument list and field list are the union over the
+    providers; fundamentals, split and dividend records and corporate actions
+    come, per instrument, from the first provider that serves them.
+    
+    Examples:
+        >>> provider = ChainProvider(CSVDataProvider("./data"), GRPCProvider("feeds:50052"))
+        >>> manager = DataManager(provider=provider)
+    """
+    
+    def __init__(self, *providers: DataProvider):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            providers: 按优先顺序排列的数据提供者 / Data providers in order of preference
+        
+        Raises:
+            ValueError: 没有提供者，或提供者的adjusted_prices不一致时抛出 /
+                Raised without providers, or when they disagree on adjusted_prices
+        """
+        if not providers:
+            raise ValueError("ChainProvider needs at least one provider")
+        if len({provider.adjusted_prices for provider in providers}) > 1:
+            raise ValueError(
+                "providers in a chain must agree on adjusted_prices, got "
+                + ", ".join(f"{p.name}={p.adjusted_prices}" for p in providers)
+            )
+        self._providers: Tuple[DataProvider, ...] = tuple(providers)
+        self.name = f"chain({', '.join(provider.name for provider in providers)})"
+        self._logger = get_logger(__name__)
+    
+    @property
+    def providers(self) -> Tuple[DataProvider, ...]:
+        """按优先顺序排列的提供者 / Providers in order of preference"""
+        return self._providers
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """任一提供者支持的频率 / Frequencies any provider supports"""
+        available = {freq for provider in self._providers for freq in provider.freqs}
+        return tuple(freq for freq in SUPPORTED_FREQS if freq in available)
+    
+    @property
+    def adjusted_prices(self) -> bool:
+        """与各提供者相同 / Same as every provider"""
+        return self._providers[0].adjusted_prices
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        按顺序从提供者加载单个标的的特征数据 / Load one instrument's features from the providers in order
+        
+        Raises:
+            InstrumentNotFoundError: 所有提供者都没有该标的时抛出 / Raised when no provider has the instrument
+            FieldNotFoundError: 有该标的的提供者都缺少某些字段时抛出 /
+                Raised when some fields are missing from every provider that has the instrument
+        """
+        return self._load(instrument, fields, freq, lambda provider, names: provider.load_features(
+            instrument, names, start_time=start_time, end_time=end_time, freq=freq
+        ))
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """在请求上下文中按顺序从提供者加载特征数据 / Load features from the providers in order under a request context"""
+        ctx.check()
+        return self._load(instrument, fields, freq, lambda provider, names: provider.load_features_ctx(
+            ctx, instrument, names, start_time=start_time, end_time=end_time, freq=freq
+        ))
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """支持该频率的提供者的交易日历的并集 / Union of the calendars of the providers with the frequency"""
+        self.check_freq(freq)
+        sessions: Set[pd.Timestamp] = set()
+        for provider in self._serving(freq):
+            sessions.update(provider.calendar(start_time=start_time, end_time=end_time, freq=freq))
+        return sorted(sessions)
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """在请求上下文中获取交易日历的并集 / Get the union of the calendars under a request context"""
+        ctx.check()
+        self.check_freq(freq)
+        sessions: Set[pd.Timestamp] = set()
+        for provider in self._serving(freq):
+            sessions.update(provider.calendar_ctx(ctx, start_time=start_time, end_time=end_time, freq=freq))
+        return sorted(sessions)
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        有该标的的提供者的字段的并集 / Union of the fields of the providers that have the instrument
+        
+        Raises:
+            InstrumentNotFoundError: 所有提供者都没有该标的时抛出 / Raised when no provider has the instrument
+            MetadataUnavailableError: 没有提供者能列出字段时抛出 / Raised when no provider can list fields
+        """
+        fields: Set[str] = set()
+        found = listed = False
+        for provider in self._serving(freq):
+            try:
+                fields.update(provider.list_fields(instrument, freq=freq))
+                found = listed = True
+            except InstrumentNotFoundError:
+                listed = True
+            except MetadataUnavailableError:
+                continue
+        if not listed:
+            raise MetadataUnavailableError(self.name, "fields")
+        if not found:
+            raise InstrumentNotFoundError(instrument, self.name)
+        return sorted(fields)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """
+        各提供者的标的的并集 / Union of the providers' instruments
+        
+        Raises:
+            MetadataUnavailableError: 没有提供者能列出标的时抛出 / Raised when no provider can list instruments
+        """
+        instruments: Set[str] = set()
+        listed = False
+        for provider in self._serving(freq):
+            try:
+                instruments.update(provider.list_instruments(market, freq=freq))
+                listed = True
+            except MetadataUnavailableError:
+                continue
+        if not listed:
+            raise MetadataUnavailableError(self.name, "instruments")
+        return sorted(instruments)
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        按标的使用第一个有公告记录的提供者 / Use, per instrument, the first provider with announcement records
+        
+        Raises:
+            FundamentalsUnavailableError: 所有提供者都不提供某个标的的基本面数据时抛出 /
+                Raised when no provider serves fundamentals for an instrument
+        """
+        return self._fundamentals(instruments, lambda provider, code: provider.fundamentals(
+            [code], fields, start_time=start_time, end_time=end_time
+        ))
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """在请求上下文中按标的获取基本面公告记录 / Get fundamental records per instrument under a request context"""
+        ctx.check()
+        return self._fundamentals(instruments, lambda provider, code: provider.fundamentals_ctx(
+            ctx, [code], fields, start_time=start_time, end_time=end_time
+        ))
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """第一个提供除权除息记录的提供者的记录 / Records of the first provider serving them"""
+        return self._first(instrument, lambda provider: provider.adjustments(
+            instrument, start_time=start_time, end_time=end_time
+        ))
+    
+    def corporate_actions(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> List[CorporateAction]:
+        """第一个提供公司行为的提供者的事件 / Events of the first provider serving them"""
+        return self._first(instrument, lambda provider: provider.corporate_actions(
+            instrument, start_time=start_time, end_time=end_time
+        ))
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """
+        检查每个提供者 / Check every provider
+        
+        各提供者通常提供不同的标的，任一提供者不可用时整个链不可用
+        The providers usually serve different instruments, so the chain is
+        unhealthy as soon as any of them is
+        """
+        for provider in self._providers:
+            provider.healthcheck(ctx)
+    
+    def close(self) -> None:
+        """关闭所有提供者 / Close every provider"""
+        for provider in self._providers:
+            provider.close()
+    
+    def _serving(self, freq: str) -> List[DataProvider]:
+        """支持该频率的提供者 / Providers with the frequency"""
+        freq = to_freq(freq)
+        return [provider for provider in self._providers if freq in provider.freqs]
+    
+    def _load(
+        self,
+        instrument: str,
+        fields: List[str],
+        freq: str,
+        load: Callable[[DataProvider, List[str]], pd.DataFrame]
+    ) -> pd.DataFrame:
+        """
+        依次向提供者请求仍缺少的字段，合并读到的部分 /
+        Ask each provider in turn for the fields still missing and join the parts
+        """
+        self.check_freq(freq)
+        remaining = list(dict.fromkeys(fields))
+        parts: List[pd.DataFrame] = []
+        sources: List[DataProvider] = []
+        available: List[str] = []
+        found = False
+        for provider in self._serving(freq):
+            try:
+                parts.append(load(provider, remaining))
+            except InstrumentNotFoundError:
+                continue
+            except FieldNotFoundError as e:
+                found = True
+                available.extend(e.available)
+                missing = [f for f in remaining if f in set(e.fields)]
+                if not missing:
+                    raise
+                present = [f for f in remaining if f not in missing]
+                if present:
+                    parts.append(load(provider, present))
+                    sources.append(provider)
+                remaining = missing
+                continue
+            sources.append(provider)
+            remaining = []
+            break
+        
+        if remaining:
+            if not found:
+                raise InstrumentNotFoundError(
+                    instrument, self.name, f"tried {', '.join(p.name for p in self._serving(freq))}"
+                )
+            raise FieldNotFoundError(remaining, list(dict.fromkeys(available)), instrument, self.name)
+        if sources != [self._providers[0]]:
+            self._logger.debug(f"标的{instrument}由{', '.join(p.name for p in sources)}提供")
+        if len(parts) == 1:
+            return parts[0]
+        return pd.concat(parts, axis=1).sort_index()[list(dict.fromkeys(fields))]
+    
+    def _fundamentals(
+        self,
+        instruments: List[str],
+        load: Callable[[DataProvider, str], Dict[str, pd.DataFrame]]
+    ) -> Dict[str, pd.DataFrame]:
+        """按标的依次尝试提供者，有公告记录的优先于空记录 / Try the providers per instrument, preferring records over none"""
+        records: Dict[str, pd.DataFrame] = {}
+        for code in instruments:
+            for provider in self._providers:
+                try:
+                    frame = load(provider, code)[code]
+                except (FundamentalsUnavailableError, InstrumentNotFoundError):
+                    continue
+                if code not in records or not frame.empty:
+                    records[code] = frame
+                if not frame.empty:
+                    break
+            if code not in records:
+                raise FundamentalsUnavailableError(self.name, code)
+        return records
+    
+    def _first(self, instrument: str, load: Callable[[DataProvider], T]) -> T:
+        """第一个提供除权除息数据的提供者的结果 / Result of the first provider serving split and dividend data"""
+        for provider in self._providers:
+            try:
+                return load(provider)
+            except (AdjustmentsUnavailableError, InstrumentNotFoundError):
+                continue
+        raise AdjustmentsUnavailableError(self.name, instrument)
+
+
+def chain(*providers: DataProvider) -> ChainProvider:
+    """
+    把数据提供者串成按顺序回退的一个提供者 / Chain data providers into one that falls back in order
+    
+    Args:
+        providers: 按优先顺序排列的数据提供者 / Data providers in order of preference
+    
+    Returns:
+        ChainProvider: 链式提供者 / Chained provider
+    
+    Examples:
+        >>> provider = chain(CSVDataProvider("./local"), ParquetDataProvider("./archive"))
+        >>> provider.load_features("SH600000", ["$close", "$volume"])
+    """
+    return ChainProvider(*providers)
@@ -0,0 +1,561 @@
+"""
+CSV数据提供者模块 / CSV Data Provider Module
+从本地目录中的<INSTRUMENT>.csv文件读取OHLCV数据
+Reads OHLCV bars from <INSTRUMENT>.csv files in a local directory
+"""
+
+from pathlib import Path
+from typing import Dict, List, Optional, Tuple
+
+import pandas as pd
+
+from .data_provider import (
+    ALL_MARKET,
+    ANNOUNCE_DATE,
+    CASH_DIVIDEND,
+    EX_DATE,
+    FACTOR_FIELD,
+    PERIOD_END,
+    RIGHTS_PRICE,
+    RIGHTS_RATIO,
+    SPLIT_RATIO,
+    AdjustmentsUnavailableError,
+    DataProvider,
+    FieldNotFoundError,
+    FundamentalsUnavailableError,
+    InstrumentNotFoundError,
+    ProviderUnhealthyError,
+    SUPPORTED_FREQS,
+    adjustment_factor,
+    match_market
+)
+from .logger_system import get_logger
+from ..utils.request_context import RequestContext, ContextCancelledError
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+# CSV中可作为日期列的列名
+DATE_COLUMNS = ("date", "datetime")
+
+# 基本面公告记录所在的子目录
+FUNDAMENTALS_DIR = "fundamentals"
+
+# 除权除息记录所在的子目录
+ADJUSTMENTS_DIR = "adjustments"
+
+
+class CSVDataProvider(DataProvider):
+    """
+    CSV数据提供者 / CSV data provider
+    
+    每个标的对应一个CSV文件，表头包含日期列和行情列（如open, high, low,
+    close, volume），行情列映射为"$open"、"$close"等字段。表头与字段名不一致时
+    （如"Adj Close"、"trade_date"），可通过column_mapping指定映射。
+    不带时区的日期按交易所时区解释；返回的索引为交易所本地时间（不带时区），
+    与qlib返回的数据保持一致。
+    One CSV file per instrument; the header holds a date column plus bar
+    columns (open, high, low, close, volume, ...) that map to "$open",
+    "$close" and so on. Headers that don't match (e.g. "Adj Close",
+    "trade_date") can be mapped with column_mapping. Timezone-naive dates are interpreted in the exchange
+    timezone; the returned index is exchange-local wall time (naive), matching
+    what qlib returns.
+    
+    日频文件位于data_dir下，分钟数据位于以频率命名的子目录中，如
+    data_dir/5min/SH600000.csv，其datetime列为K线结束时刻。
+    Daily files live directly in data_dir; minute bars live in a subdirectory
+    named after the frequency, e.g. data_dir/5min/SH600000.csv, with a
+    datetime column holding each bar's end time.
+    
+    基本面数据位于data_dir/fundamentals/<INSTRUMENT>.csv，每行一次公告，包含announce_date列、
+    可选的period_end列和基本面字段列（如pe_ttm, pb, market_cap, turnover_rate）。
+    Fundamentals live in data_dir/fundamentals/<INSTRUMENT>.csv, one row per
+    announcement, with an announce_date column, an optional period_end column
+    and the fundamental columns (pe_ttm, pb, market_cap, turnover_rate, ...).
+    
+    除权除息记录位于data_dir/adjustments/<INSTRUMENT>.csv，每行一次除权除息，包含ex_date列和
+    split_ratio、dividend列中的一个或两个，配股另有rights_ratio和rights_price列（只用于
+    corporate_actions()）。行情文件没有factor列时，$factor由这些记录和原始收盘价计算。
+    Split and dividend records live in data_dir/adjustments/<INSTRUMENT>.csv,
+    one row per event, with an ex_date column and either or both of the
+    split_ratio and dividend columns, plus rights_ratio and rights_price for
+    rights issues (used by corporate_actions() only). When the bar file has no
+    factor column, $factor is computed from these records and the raw closes.
+    """
+    
+    name = "csv"
+    
+    # 分块读取CSV的行数，每块之间检查一次取消
+    READ_CHUNK_ROWS = 50_000
+    
+    def __init__(
+        self,
+        data_dir: str,
+        timezone: str = "Asia/Shanghai",
+        column_mapping: Optional[Dict[str, str]] = None
+    ):
+        """
+        初始化CSV提供者 / Initialize CSV provider
+        
+        Args:
+            data_dir: CSV文件目录 / Directory holding the CSV files
+            timezone: 交易所时区，用于解释不带时区的日期 / Exchange timezone for naive dates
+            column_mapping: CSV表头到字段名的映射（不区分大小写），如
+                {"trade_date": "date", "Adj Close": "$close", "vol": "$volume"}；
+                映射到"date"的列作为日期列 / CSV header to field name mapping
+                (case-insensitive); a column mapped to "date" is the date column
+        """
+        self._data_dir = Path(data_dir).expanduser()
+        self._timezone = timezone
+        self._column_mapping = {
+            src.strip().lower(): dst.strip().lower().lstrip("$")
+            for src, dst in (column_mapping or {}).items()
+        }
+        self._logger = get_logger(__name__)
+    
+    @property
+    def data_dir(self) -> Path:
+        """CSV文件目录 / CSV directory"""
+        return self._data_dir
+    
+    @property
+    def timezone(self) -> str:
+        """交易所时区 / Exchange timezone"""
+        return self._timezone
+    
+    @property
+    def column_mapping(self) -> Dict[str, str]:
+        """规范化后的列映射 / Normalized column mapping"""
+        return dict(self._column_mapping)
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """日频以及data_dir中存在子目录的分钟频率 / Daily plus minute frequencies with a subdirectory"""
+        return tuple(
+            freq for freq in SUPPORTED_FREQS
+            if freq == "day" or (self._data_dir / freq).is_dir()
+        )
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的特征数据 / Load feature data for a single instrument
+        
+        Raises:
+            UnsupportedFrequencyError: 没有该频率的子目录时抛出 /
+                Raised when there is no subdirectory for the frequency
+            DataError: 文件不存在、格式错误或字段缺失时抛出 /
+                Raised when the file is missing, malformed, or lacks a field
+        """
+        return self._load(instrument, fields, start_time, end_time, freq)
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        在请求上下文中加载特征数据，读取过程中可以取消 /
+        Load feature data under a request context, cancellable mid-read
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出，已打开的文件会被关闭 /
+                Raised when the context is done; the open file is closed
+        """
+        ctx.check()
+        return self._load(instrument, fields, start_time, end_time, freq, ctx)
+    
+    def _load(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str = "day",
+        ctx: Optional[RequestContext] = None
+    ) -> pd.DataFrame:
+        self.check_freq(freq)
+        frame = self._read_instrument(instrument, ctx, freq)
+        if FACTOR_FIELD in fields and FACTOR_FIELD not in frame.columns and "$close" in frame.columns:
+            path = self._adjustments_path(instrument)
+            if path.exists():
+                # 在整个文件上计算，因子以文件中的第一根K线为基准，与查询区间无关
+                frame[FACTOR_FIELD] = adjustment_factor(self._read_adjustments(instrument), frame["$close"])
+        
+        missing = [f for f in fields if f not in frame.columns]
+        if missing:
+            raise FieldNotFoundError(
+                missing, list(frame.columns), instrument, self.name,
+                f"file={self._instrument_path(instrument, freq)}"
+            )
+        
+        return self._filter_range(frame[fields], start_time, end_time)
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        从CSV表头列出字段，只读取表头 / List fields from the CSV header, reading only the header
+        
+        Raises:
+            DataError: 文件不存在或没有日期列时抛出 / Raised when the file is missing or has no date column
+        """
+        self.check_freq(freq)
+        path = self._require_file(instrument, freq)
+        try:
+            raw = pd.read_csv(path, nrows=0)
+            raw = self._apply_mapping(raw.rename(columns={c: c.strip().lower() for c in raw.columns}))
+            date_column = next((c for c in DATE_COLUMNS if c in raw.columns), None)
+            if date_column is None:
+                raise ValueError(f"no date column, expected one of {DATE_COLUMNS}")
+        except Exception as e:
+            raise self._parse_error(path, e, "date") from e
+        fields = {f"${c}" for c in raw.columns if c != date_column}
+        if "$close" in fields and self._adjustments_path(instrument).exists():
+            fields.add(FACTOR_FIELD)
+        return sorted(fields)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """
+        从目录中的CSV文件名列出标的，市场按交易所前缀匹配 /
+        List instruments from the CSV file names; markets match on the exchange prefix
+        """
+        self.check_freq(freq)
+        return sorted({
+            path.stem for path in self._freq_dir(freq).glob("*.csv") if match_market(path.stem, market)
+        })
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """
+        data_dir中至少有一个CSV文件，且第一个文件可以打开并有表头 /
+        data_dir holds at least one CSV file, and the first one opens and has a header
+        
+        只读取一行，不读取日历
+        Reads a single line rather than the whole calendar
+        """
+        ctx.check()
+        if not self._data_dir.is_dir():
+            raise ProviderUnhealthyError(self.name, f"data directory not found: {self._data_dir}")
+        path = next(iter(sorted(self._data_dir.glob("*.csv"))), None)
+        if path is None:
+            raise ProviderUnhealthyError(self.name, f"no CSV files in {self._data_dir}")
+        try:
+            with open(path, encoding="utf-8") as f:
+                header = f.readline()
+        except (OSError, UnicodeDecodeError) as e:
+            raise ProviderUnhealthyError(self.name, f"cannot read {path.name}: {e}") from e
+        if not header.strip():
+            raise ProviderUnhealthyError(self.name, f"{path.name} has no header")
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """
+        获取交易日历 / Get the trading calendar
+        
+        日历为该频率目录中所有CSV文件时间的并集
+        The calendar is the union of the timestamps of every CSV file for the frequency
+        """
+        self.check_freq(freq)
+        index = pd.DatetimeIndex([])
+        for path in sorted(self._freq_dir(freq).glob("*.csv")):
+            index = index.union(self._read_instrument(path.stem, freq=freq).index)
+        return self._calendar_between(index, start_time, end_time)
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """在请求上下文中获取交易日历，逐个文件检查取消 / Get the calendar, checking for cancellation per file"""
+        self.check_freq(freq)
+        index = pd.DatetimeIndex([])
+        for path in sorted(self._freq_dir(freq).glob("*.csv")):
+            ctx.check()
+            index = index.union(self._read_instrument(path.stem, ctx, freq).index)
+        return self._calendar_between(index, start_time, end_time)
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        读取基本面公告记录 / Read fundamental announcement records
+        
+        Raises:
+            FundamentalsUnavailableError: 标的没有基本面文件时抛出 / Raised when an instrument has no fundamentals file
+            DataError: 文件格式错误或字段缺失时抛出 / Raised when the file is malformed or lacks a field
+        """
+        return {
+            instrument: self._load_fundamentals(instrument, fields, start_time, end_time)
+            for instrument in instruments
+        }
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """在请求上下文中读取基本面公告记录，逐个文件检查取消 / Read fundamental records, checking for cancellation per file"""
+        records = {}
+        for instrument in instruments:
+            ctx.check()
+            records[instrument] = self._load_fundamentals(instrument, fields, start_time, end_time)
+        return records
+    
+    def _load_fundamentals(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str]
+    ) -> pd.DataFrame:
+        """读取并解析标的的基本面文件 / Read and parse the instrument's fundamentals file"""
+        path = self._data_dir / FUNDAMENTALS_DIR / f"{instrument}.csv"
+        if not path.exists():
+            raise FundamentalsUnavailableError(self.name, instrument, f"path={path}")
+        
+        try:
+            raw = pd.read_csv(path)
+            raw = raw.rename(columns={c: c.strip().lower() for c in raw.columns})
+            if ANNOUNCE_DATE not in raw.columns:
+                raise ValueError(f"no {ANNOUNCE_DATE} column")
+            
+            index = pd.DatetimeIndex(pd.to_datetime(raw[ANNOUNCE_DATE].astype(str)))
+            index = self._localize(index)
+            if PERIOD_END in raw.columns:
+                period_end = self._localize(pd.DatetimeIndex(pd.to_datetime(raw[PERIOD_END].astype(str))))
+            else:
+                period_end = pd.DatetimeIndex([pd.NaT] * len(raw))
+            
+            frame = raw.drop(columns=[c for c in (ANNOUNCE_DATE, PERIOD_END) if c in raw.columns])
+            frame.columns = [f"${c}" for c in frame.columns]
+            frame.insert(0, PERIOD_END, period_end)
+            frame.index = index
+            frame.index.name = ANNOUNCE_DATE
+        except Exception as e:
+            raise self._parse_error(path, e, ANNOUNCE_DATE) from e
+        
+        missing = [f for f in fields if f not in frame.columns]
+        if missing:
+            available = [c for c in frame.columns if c != PERIOD_END]
+            raise FieldNotFoundError(missing, available, instrument, self.name, f"file={path}")
+        
+        # 同一公告日的多条记录（如更正公告）保持文件中的顺序
+        frame = frame[[PERIOD_END] + list(fields)].sort_index(kind="stable")
+        return self._filter_range(frame, start_time, end_time)
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """
+        读取除权除息记录 / Read split and dividend records
+        
+        Raises:
+            AdjustmentsUnavailableError: 标的没有除权除息文件时抛出 / Raised when the instrument has no adjustments file
+            DataError: 文件格式错误时抛出 / Raised when the file is malformed
+        """
+        return self._filter_range(self._read_adjustments(instrument), start_time, end_time)
+    
+    def _read_adjustments(self, instrument: str) -> pd.DataFrame:
+        """
+        读取并解析标的的除权除息文件，缺少的列视为不拆分、不分红 /
+        Read and parse the instrument's adjustments file; absent columns mean no split or dividend
+        """
+        path = self._adjustments_path(instrument)
+        if not path.exists():
+            raise AdjustmentsUnavailableError(self.name, instrument, f"path={path}")
+        
+        try:
+            raw = pd.read_csv(path)
+            raw = raw.rename(columns={c: c.strip().lower() for c in raw.columns})
+            if EX_DATE not in raw.columns:
+                raise ValueError(f"no {EX_DATE} column")
+            
+            index = self._localize(pd.DatetimeIndex(pd.to_datetime(raw[EX_DATE].astype(str))))
+            columns = {
+                SPLIT_RATIO: raw[SPLIT_RATIO].fillna(1.0) if SPLIT_RATIO in raw.columns else 1.0,
+                CASH_DIVIDEND: raw[CASH_DIVIDEND].fillna(0.0) if CASH_DIVIDEND in raw.columns else 0.0,
+            }
+            # 配股列只在文件中有时保留
+            for name in (RIGHTS_RATIO, RIGHTS_PRICE):
+                if name in raw.columns:
+                    columns[name] = raw[name]
+            frame = pd.DataFrame(columns, index=raw.index).astype(float)
+            frame.index = index
+            frame.index.name = EX_DATE
+        except Exception as e:
+            raise self._parse_error(path, e, EX_DATE) from e
+        return frame.sort_index(kind="stable")
+    
+    def _adjustments_path(self, instrument: str) -> Path:
+        """标的对应的除权除息文件路径 / Path of an instrument's adjustments file"""
+        return self._data_dir / ADJUSTMENTS_DIR / f"{instrument}.csv"
+    
+    def _calendar_between(
+        self,
+        index: pd.DatetimeIndex,
+        start_time: Optional[str],
+        end_time: Optional[str]
+    ) -> List[pd.Timestamp]:
+        """截取日历区间 / Clip the calendar to a range"""
+        dates = pd.Series(index=index, dtype=float)
+        return list(self._filter_range(dates, start_time, end_time).index)
+    
+    def _filter_range(self, frame, start_time: Optional[str], end_time: Optional[str]):
+        """按时间范围过滤（包含边界） / Filter by time range (inclusive)"""
+        if start_time is not None:
+            frame = frame[frame.index >= self._to_local(start_time)]
+        if end_time is not None:
+            frame = frame[frame.index <= self._to_local(end_time)]
+        return frame
+    
+    def _freq_dir(self, freq: str) -> Path:
+        """频率对应的CSV目录 / CSV directory of a frequency"""
+        return self._data_dir if freq == "day" else self._data_dir / freq
+    
+    def _instrument_path(self, instrument: str, freq: str = "day") -> Path:
+        """标的对应的CSV路径 / CSV path of an instrument"""
+        return self._freq_dir(freq) / f"{instrument}.csv"
+    
+    def _read_instrument(
+        self,
+        instrument: str,
+        ctx: Optional[RequestContext] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        读取并解析标的的CSV文件 / Read and parse the instrument's CSV file
+        
+        提供ctx时分块读取，每块之间检查取消；文件在任何情况下都会被关闭
+        With ctx the file is read in chunks, checking for cancellation between
+        them; the file is closed in every case
+        
+        Returns:
+            pd.DataFrame: 以交易所本地时间为索引、"$"前缀字段为列的数据 /
+                Frame indexed by exchange-local time with "$"-prefixed columns
+        """
+        path = self._require_file(instrument, freq)
+        
+        try:
+            if ctx is None:
+                raw = pd.read_csv(path)
+            else:
+                with open(path, "r", encoding="utf-8") as f:
+                    parts = []
+                    for part in pd.read_csv(f, chunksize=self.READ_CHUNK_ROWS):
+                        ctx.check()
+                        parts.append(part)
+                raw = pd.concat(parts) if parts else pd.read_csv(path)
+            columns = {c: c.strip().lower() for c in raw.columns}
+            raw = raw.rename(columns=columns)
+            raw = self._apply_mapping(raw)
+            
+            date_column = next((c for c in DATE_COLUMNS if c in raw.columns), None)
+            if date_column is None:
+                raise ValueError(f"no date column, expected one of {DATE_COLUMNS}")
+            
+            # 按字符串解析，避免20250102这样的整数日期被当作时间戳
+            index = pd.DatetimeIndex(pd.to_datetime(raw[date_column].astype(str)))
+            index = self._localize(index)
+            
+            frame = raw.drop(columns=[date_column])
+            frame.columns = [f"${c}" for c in frame.columns]
+            frame.index = index
+            frame.index.name = "datetime"
+            
+            self._logger.debug(f"读取CSV: {path}, 行数: {len(frame)}, 字段: {list(frame.columns)}")
+            return frame.sort_index()
+        
+        except ContextCancelledError:
+            self._logger.debug(f"读取CSV已取消: {path}")
+            raise
+        except Exception as e:
+            raise self._parse_error(path, e, "date") from e
+    
+    def _require_file(self, instrument: str, freq: str = "day") -> Path:
+        """标的对应的CSV路径，文件不存在时抛出错误 / CSV path of an instrument, raising when the file is missing"""
+        path = self._instrument_path(instrument, freq)
+        if not path.exists():
+            raise InstrumentNotFoundError(instrument, self.name, f"path={path}")
+        return path
+    
+    def _parse_error(self, path: Path, error: Exception, date_column: str) -> DataError:
+        """构造CSV解析失败的错误 / Build the error for a CSV that fails to parse"""
+        error_info = ErrorInfo(
+            error_code="DAT0014",
+            error_message_zh=f"解析CSV文件失败: {path.name}: {str(error)}",
+            error_message_en=f"Failed to parse CSV file: {path.name}: {str(error)}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"path={path}",
+            suggested_actions=[
+                f"检查CSV表头是否包含{date_column}列",
+                "确认日期格式是否正确，如2025-01-02"
+            ],
+            recoverable=True,
+            original_exception=error
+        )
+        return DataError(error_info)
+    
+    def _apply_mapping(self, raw: pd.DataFrame) -> pd.DataFrame:
+        """
+        按column_mapping重命名列 / Rename columns according to column_mapping
+        
+        映射目标与未映射的同名列冲突时，以映射列为准
+        A mapped column wins over an unmapped column of the same name
+        """
+        mapped = {src: dst for src, dst in self._column_mapping.items() if src in raw.columns}
+        if not mapped:
+            return raw
+        
+        targets = set(mapped.values())
+        if "date" in targets or "datetime" in targets:
+            # 映射出的日期列优先于CSV中默认的日期列
+            targets.update(DATE_COLUMNS)
+        shadowed = [c for c in raw.columns if c in targets and c not in mapped]
+        return raw.drop(columns=shadowed).rename(columns=mapped)
+    
+    def _localize(self, index: pd.DatetimeIndex) -> pd.DatetimeIndex:
+        """
+        转换为交易所本地时间（不带时区） / Convert to exchange-local naive time
+        
+        不带时区的时间视为交易所时区，带时区的时间转换到交易所时区
+        Naive times are taken as exchange time; aware times are converted to it
+        """
+        if index.tz is not None:
+            index = index.tz_convert(self._timezone).tz_localize(None)
+        return index
+    
+    def _to_local(self, value: str) -> pd.Timestamp:
+        """把查询时间转换为交易所本地时间 / Convert a query time to exchange-local time"""
+        ts = pd.Timestamp(value)
+        if ts.tzinfo is not None:
+            ts = ts.tz_convert(self._timezone).tz_localize(None)
+        return ts
@@ -0,0 +1,1371 @@
+"""
+数据提供者模块 / Data Provider Module
+定义特征数据提供者接口和全局注册表，默认提供者基于qlib
+Defines the feature data provider interface and a global registry; the default provider is backed by qlib
+"""
+
+import difflib
+import threading
+from abc import ABC, abstractmethod
+from dataclasses import dataclass
+from enum import Enum
+from pathlib import Path
+from typing import Dict, List, Optional, Tuple, Union
+
+import pandas as pd
+
+from .logger_system import get_logger
+from .qlib_wrapper import QlibWrapper
+from .subscription import PollingFeed, Subscription
+from ..utils.request_context import ContextCancelledError, RequestContext
+from ..utils.error_handler import (
+    DataError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+# features()支持的数据频率，"day"以外均为日内频率
+SUPPORTED_FREQS = ("1min", "5min", "15min", "60min", "day")
+
+
+class Freq(Enum):
+    """
+    数据频率 / Data frequency
+    
+    可以代替频率字符串传给get_features()等接口，取值即SUPPORTED_FREQS中的字符串
+    Can stand in for the frequency string wherever one is taken, such as
+    get_features(); the values are the strings in SUPPORTED_FREQS
+    """
+    DAY = "day"  # 日线
+    MIN60 = "60min"  # 60分钟K线
+    MIN15 = "15min"  # 15分钟K线
+    MIN5 = "5min"  # 5分钟K线
+    MIN1 = "1min"  # 1分钟K线
+
+
+FreqLike = Union[str, Freq]
+
+# 基本面字段，由fundamentals()按公告日提供，而不是随K线提供
+FUNDAMENTAL_FIELDS = ("$pe_ttm", "$pb", "$market_cap", "$turnover_rate")
+
+# fundamentals()返回数据的索引名和报告期列 / Index name and report period column of fundamentals() records
+ANNOUNCE_DATE = "announce_date"
+PERIOD_END = "period_end"
+
+# 复权因子字段；复权价 = 原始价 * 复权因子 / Adjustment factor field; adjusted price = raw price * factor
+FACTOR_FIELD = "$factor"
+
+# adjustments()返回数据的索引名和列：拆分比例（每股变为几股）和每股现金分红 /
+# Index name and columns of adjustments() records: split ratio (new shares per share) and cash dividend per share
+EX_DATE = "ex_date"
+SPLIT_RATIO = "split_ratio"
+CASH_DIVIDEND = "dividend"
+# adjustments()可选的配股列：每股可配新股数和配股价 / Optional rights issue columns: new shares offered per share and subscription price
+RIGHTS_RATIO = "rights_ratio"
+RIGHTS_PRICE = "rights_price"
+
+# list_instruments()中表示所有标的的市场名 / Market name that lists every instrument in list_instruments()
+ALL_MARKET = "all"
+
+
+@dataclass
+class ProviderConfig:
+    """
+    文件型提供者的资源配置 / Resource settings of file-backed providers
+    
+    保持文件打开并复用的提供者（如ParquetDataProvider）最多同时打开max_open_readers个读取器，
+    空闲超过idle_timeout秒的读取器被关闭
+    Providers that keep files open for reuse (such as ParquetDataProvider)
+    hold at most max_open_readers readers at a time and close readers idle
+    for longer than idle_timeout seconds
+    
+    Attributes:
+        max_open_readers: 同时打开的读取器上限 / Upper bound on open readers
+        idle_timeout: 空闲读取器保留的秒数，None表示一直保留到close() /
+            Seconds an idle reader is kept, None keeps it until close()
+    """
+    max_open_readers: int = 64
+    idle_timeout: Optional[float] = 60.0
+    
+    def __post_init__(self):
+        if self.max_open_readers < 1:
+            raise ValueError(f"max_open_readers must be positive, got {self.max_open_readers}")
+        if self.idle_timeout is not None and self.idle_timeout < 0:
+            raise ValueError(f"idle_timeout must be non-negative, got {self.idle_timeout}")
+
+
+def is_fundamental(field: str) -> bool:
+    """
+    判断是否为基本面字段 / Whether a field is a fundamental field
+    
+    Args:
+        field: 原始字段，如"$pb" / Raw field, e.g. "$pb"
+    
+    Returns:
+        bool: 属于FUNDAMENTAL_FIELDS时返回True / True for a member of FUNDAMENTAL_FIELDS
+    """
+    return field in FUNDAMENTAL_FIELDS
+
+
+def to_freq(freq: FreqLike) -> str:
+    """
+    把频率转换为频率字符串 / Convert a frequency to its string form
+    
+    接受Freq、"5min"这样的取值或"Min5"这样的成员名（不区分大小写）；其他字符串原样返回，
+    由check_freq()报错
+    Takes a Freq, a value such as "5min" or a member name such as "Min5"
+    (case-insensitive); any other string is returned as is for check_freq()
+    to reject
+    
+    Args:
+        freq: 数据频率 / Data frequency
+    
+    Returns:
+        str: 频率字符串，如"5min" / Frequency string, e.g. "5min"
+    """
+    if isinstance(freq, Freq):
+        return freq.value
+    member = Freq.__members__.get(str(freq).upper())
+    return member.value if member is not None else freq
+
+
+def is_intraday(freq: str) -> bool:
+    """
+    判断是否为日内频率 / Whether a frequency is intraday
+    
+    Args:
+        freq: 数据频率 / Data frequency
+    
+    Returns:
+        bool: 分钟级频率返回True / True for minute frequencies
+    """
+    return freq != "day"
+
+
+def freq_minutes(freq: str) -> int:
+    """
+    日内频率对应的分钟数 / Minutes per bar of an intraday frequency
+    
+    Args:
+        freq: 日内频率，如"5min" / Intraday frequency, e.g. "5min"
+    
+    Returns:
+        int: 每根K线的分钟数 / Minutes per bar
+    """
+    return int(freq[:-len("min")])
+
+
+def match_market(instrument: str, market: Optional[str]) -> bool:
+    """
+    判断标的是否属于市场 / Whether an instrument belongs to a market
+    
+    本地文件没有股票池信息，市场按交易所前缀匹配，如"SH"匹配"SH600000"
+    Local files carry no pool membership, so markets match on the exchange
+    prefix, e.g. "SH" matches "SH600000"
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+        market: 交易所前缀（不区分大小写），None或"all"表示所有标的 /
+            Exchange prefix (case-insensitive), None or "all" for every instrument
+    
+    Returns:
+        bool: 属于该市场时返回True / True when the instrument belongs to the market
+    """
+    if market is None or market.lower() == ALL_MARKET:
+        return True
+    return instrument.upper().startswith(market.upper())
+
+
+def adjustment_factor(adjustments: pd.DataFrame, closes: pd.Series) -> pd.Series:
+    """
+    由除权除息记录计算后复权因子 / Compute the backward adjustment factor from split and dividend records
+    
+    因子在第一根K线上为1，每个除权日起乘以split_ratio * 前收盘价 / (前收盘价 - dividend)，
+    前收盘价为除权日之前最后一个有效的收盘价；早于第一根K线和晚于最后一根K线的记录不影响因子。
+    The factor is 1 on the first bar and is multiplied from each ex-date on by
+    split_ratio * prev_close / (prev_close - dividend), prev_close being the
+    last valid close before the ex-date; records before the first bar or after
+    the last one leave it unchanged.
+    
+    Args:
+        adjustments: 以除权日（EX_DATE）为索引、包含SPLIT_RATIO和/或CASH_DIVIDEND列的记录 /
+            Records indexed by ex-date (EX_DATE) with SPLIT_RATIO and/or CASH_DIVIDEND columns
+        closes: 以时间为索引、升序排列的原始收盘价 / Raw closes, time-indexed in ascending order
+    
+    Returns:
+        pd.Series: 与closes索引相同的复权因子 / Adjustment factor on closes' index
+    
+    Raises:
+        ValueError: 拆分比例不是正数或分红不小于前收盘价时抛出 /
+            Raised for a non-positive split ratio or a dividend not below the previous close
+    """
+    factor = pd.Series(1.0, index=closes.index, name=FACTOR_FIELD)
+    if adjustments.empty or closes.empty:
+        return factor
+    
+    for ex_date, record in adjustments.sort_index(kind="stable").iterrows():
+        # 除权日当天或之后的第一根K线
+        position = int(closes.index.searchsorted(pd.Timestamp(ex_date), side="left"))
+        previous = closes.iloc[:position].dropna()
+        if position >= len(closes) or previous.empty:
+            continue
+        split = float(record.get(SPLIT_RATIO, 1.0))
+        dividend = float(record.get(CASH_DIVIDEND, 0.0))
+        split = 1.0 if pd.isna(split) else split
+        dividend = 0.0 if pd.isna(dividend) else dividend
+        prev_close = float(previous.iloc[-1])
+        if split <= 0 or dividend >= prev_close:
+            raise ValueError(
+                f"invalid adjustment on {pd.Timestamp(ex_date).date()}: split_ratio={split}, "
+                f"dividend={dividend}, previous close={prev_close}"
+            )
+        factor.iloc[position:] *= split * prev_close / (prev_close - dividend)
+    return factor
+
+
+@dataclass(frozen=True)
+class CorporateAction:
+    """
+    公司行为事件 / Corporate action event
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        ex_date: 除权除息日，业绩公告为公告日 / Ex-date; the announcement date for earnings
+    """
+    instrument: str
+    ex_date: pd.Timestamp
+    
+    kind = "action"
+    
+    @property
+    def magnitude(self) -> float:
+        """事件的主要数值，如每股分红或拆股比例，没有时为NaN / Headline value such as the dividend or split ratio, NaN when there is none"""
+        return float("nan")
+
+
+@dataclass(frozen=True)
+class CashDividend(CorporateAction):
+    """
+    现金分红 / Cash dividend
+    
+    Attributes:
+        per_share: 每股税前分红，以标的的计价货币表示 / Pre-tax dividend per share in the instrument's quote currency
+    """
+    per_share: float
+    
+    kind = "dividend"
+    
+    @property
+    def magnitude(self) -> float:
+        return self.per_share
+
+
+@dataclass(frozen=True)
+class Split(CorporateAction):
+    """
+    拆股、送股或转增 / Split or bonus issue
+    
+    Attributes:
+        ratio: 每股变为几股，如10送3为1.3 / New shares per share, e.g. 1.3 for a 3-for-10 bonus issue
+    """
+    ratio: float
+    
+    kind = "split"
+    
+    @property
+    def magnitude(self) -> float:
+        return self.ratio
+
+
+@dataclass(frozen=True)
+class RightsIssue(CorporateAction):
+    """
+    配股 / Rights issue
+    
+    Attributes:
+        ratio: 每股可配新股数，如10配3为0.3 / New shares offered per share held, e.g. 0.3 for 3-for-10
+        price: 配股价，以标的的计价货币表示 / Subscription price in the instrument's quote currency
+    """
+    ratio: float
+    price: float
+    
+    kind = "rights"
+    
+    @property
+    def magnitude(self) -> float:
+        return self.ratio
+
+
+@dataclass(frozen=True)
+class Earnings(CorporateAction):
+    """
+    业绩公告 / Earnings announcement
+    
+    ex_date为公告日。业绩公告不改变持仓，回测引擎只把它提供给策略，例如在公告前不开新仓
+    ex_date is the announcement date. An announcement leaves positions as
+    they are; the backtest engine only shows it to the strategy, e.g. to
+    avoid opening positions into it
+    
+    Attributes:
+        period_end: 报告期末，未知时为None / Fiscal period end, None when unknown
+    """
+    period_end: Optional[pd.Timestamp] = None
+    
+    kind = "earnings"
+
+
+def corporate_actions_from(instrument: str, adjustments: pd.DataFrame) -> List[CorporateAction]:
+    """
+    把除权除息记录转换为公司行为事件 / Turn split and dividend records into corporate action events
+    
+    同一除权日依次为分红、拆股和配股：分红按除权前的股数计算，配股按拆股后的股数计算
+    Events of one ex-date come as dividend, split, then rights issue: the
+    dividend is paid on the shares before the split and rights are offered
+    on the shares after it
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+        adjustments: adjustments()返回的记录，可以包含RIGHTS_RATIO和RIGHTS_PRICE列 /
+            Records as adjustments() returns them, optionally with RIGHTS_RATIO and RIGHTS_PRICE columns
+    
+    Returns:
+        List[CorporateAction]: 按除权日升序排列的事件，不拆股、不分红、不配股的记录不产生事件 /
+            Events in ex-date order; records without a split, dividend or rights issue yield none
+    
+    Raises:
+        ValueError: 拆股比例不是正数、分红为负数或配股缺少正的配股价时抛出 /
+            Raised for a non-positive split ratio, a negative dividend or rights without a positive price
+    """
+    events: List[CorporateAction] = []
+    for ex_date, record in adjustments.sort_index(kind="stable").iterrows():
+        ex_date = pd.Timestamp(ex_date)
+        split, dividend = _record_value(record, SPLIT_RATIO, 1.0), _record_value(record, CASH_DIVIDEND, 0.0)
+        rights, price = _record_value(record, RIGHTS_RATIO, 0.0), _record_value(record, RIGHTS_PRICE, 0.0)
+        if split <= 0 or dividend < 0 or rights < 0 or (rights > 0 and not price > 0):
+            raise ValueError(
+                f"invalid corporate action of {instrument} on {ex_date.date()}: split_ratio={split}, "
+                f"dividend={dividend}, rights_ratio={rights}, rights_price={price}"
+            )
+        if dividend > 0:
+            events.append(CashDividend(instrument, ex_date, dividend))
+        if split != 1.0:
+            events.append(Split(instrument, ex_date, split))
+        if rights > 0:
+            events.append(RightsIssue(instrument, ex_date, rights, price))
+    return events
+
+
+def earnings_from(instrument: str, records: pd.DataFrame) -> List[Earnings]:
+    """
+    把基本面公告记录转换为业绩公告事件 / Turn fundamental announcement records into earnings events
+    
+    同一公告日的多条记录只产生一个事件
+    Several records on one announcement date yield a single event
+    
+    Args:
+        instrument: 标的代码 / Instrument code
+        records: fundamentals()返回的一个标的的记录，以公告日为索引，可以包含PERIOD_END列 /
+            One instrument's records as fundamentals() returns them, indexed by
+            announcement date, optionally with a PERIOD_END column
+    
+    Returns:
+        List[Earnings]: 按公告日升序排列的事件 / Events in announcement date order
+    """
+    events: Dict[pd.Timestamp, Earnings] = {}
+    for announced, record in records.sort_index(kind="stable").iterrows():
+        announced = pd.Timestamp(announced)
+        period = record.get(PERIOD_END)
+        period = None if period is None or pd.isna(period) else pd.Timestamp(period)
+        events.setdefault(announced, Earnings(instrument, announced, period))
+    return list(events.values())
+
+
+def _record_value(record: pd.Series, name: str, default: float) -> float:
+    """记录中的数值，缺少或为NaN时取default / Numeric value of a record, default when absent or NaN"""
+    value = record.get(name, default)
+    return default if pd.isna(value) else float(value)
+
+
+def suggest_fields(missing: List[str], available: List[str]) -> Dict[str, str]:
+    """
+    为拼写错误的字段找出最接近的可用字段 / Find the closest available field for misspelled ones
+    
+    Args:
+        missing: 不存在的字段 / Fields that don't exist
+        available: 可用字段 / Available fields
+    
+    Returns:
+        Dict[str, str]: 字段到建议字段的映射，找不到相近字段的不包含在内 /
+            Mapping of field to suggestion; fields without a close match are left out
+    """
+    by_lower = {name.lower(): name for name in available}
+    suggestions = {}
+    for field in missing:
+        match = difflib.get_close_matches(field.lower(), list(by_lower), n=1)
+        if match:
+            suggestions[field] = by_lower[match[0]]
+    return suggestions
+
+
+class UnsupportedFrequencyError(DataError):
+    """
+    不支持的数据频率错误 / Unsupported frequency error
+    
+    频率不在SUPPORTED_FREQS中，或提供者没有该频率的数据时抛出
+    Raised when the frequency is not in SUPPORTED_FREQS or the provider has
+    no data at that frequency
+    """
+    
+    def __init__(self, freq: str, provider: str, available: Tuple[str, ...]):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            freq: 请求的频率 / Requested frequency
+            provider: 提供者名称 / Provider name
+            available: 提供者支持的频率 / Frequencies the provider supports
+        """
+        self.freq = freq
+        self.available = tuple(available)
+        daily_only = freq in SUPPORTED_FREQS and self.available == ("day",)
+        error_info = ErrorInfo(
+            error_code="DAT0020",
+            error_message_zh=(
+                f"数据提供者 {provider} 只有日线数据，不支持频率: {freq}" if daily_only
+                else f"数据提供者 {provider} 不支持频率: {freq}"
+            ),
+            error_message_en=(
+                f"Data provider {provider} only has daily bars, cannot serve frequency: {freq}" if daily_only
+                else f"Data provider {provider} does not support frequency: {freq}"
+            ),
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"freq={freq}, provider={provider}, available={list(available)}",
+            suggested_actions=[
+                f"可用的频率: {', '.join(available) or '无'}",
+                f"频率取值: {', '.join(SUPPORTED_FREQS)}"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class FundamentalsUnavailableError(DataError):
+    """
+    基本面数据不可用错误 / Fundamentals unavailable error
+    
+    提供者不提供基本面数据，或没有该标的的基本面数据时抛出
+    Raised when the provider serves no fundamentals at all, or none for the instrument
+    """
+    
+    def __init__(self, provider: str, instrument: Optional[str] = None, details: str = ""):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            provider: 提供者名称 / Provider name
+            instrument: 标的代码，None表示提供者完全不提供基本面数据 /
+                Instrument code, None when the provider serves no fundamentals at all
+            details: 技术细节 / Technical details
+        """
+        self.instrument = instrument
+        if instrument is None:
+            message_zh = f"数据提供者 {provider} 不提供基本面数据"
+            message_en = f"Data provider {provider} does not serve fundamentals"
+        else:
+            message_zh = f"数据提供者 {provider} 没有标的的基本面数据: {instrument}"
+            message_en = f"Data provider {provider} has no fundamentals for instrument: {instrument}"
+        error_info = ErrorInfo(
+            error_code="DAT0026",
+            error_message_zh=message_zh,
+            error_message_en=message_en,
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=details or f"provider={provider}, instrument={instrument}",
+            suggested_actions=[
+                f"基本面字段: {', '.join(FUNDAMENTAL_FIELDS)}",
+                "使用提供基本面数据的提供者，或从字段中去掉基本面字段"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class AdjustmentsUnavailableError(DataError):
+    """
+    除权除息数据不可用错误 / Adjustments unavailable error
+    
+    提供者不提供除权除息记录，或没有该标的的记录时抛出
+    Raised when the provider serves no split and dividend records at all, or none for the instrument
+    """
+    
+    def __init__(self, provider: str, instrument: Optional[str] = None, details: str = ""):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            provider: 提供者名称 / Provider name
+            instrument: 标的代码，None表示提供者完全不提供除权除息记录 /
+                Instrument code, None when the provider serves no records at all
+            details: 技术细节 / Technical details
+        """
+        self.instrument = instrument
+        if instrument is None:
+            message_zh = f"数据提供者 {provider} 不提供除权除息数据"
+            message_en = f"Data provider {provider} does not serve split and dividend records"
+        else:
+            message_zh = f"数据提供者 {provider} 没有标的的除权除息数据: {instrument}"
+            message_en = f"Data provider {provider} has no split and dividend records for instrument: {instrument}"
+        error_info = ErrorInfo(
+            error_code="DAT0031",
+            error_message_zh=message_zh,
+            error_message_en=message_en,
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=details or f"provider={provider}, instrument={instrument}",
+            suggested_actions=[
+                f"在行情数据中提供{FACTOR_FIELD}列，或提供{EX_DATE}、{SPLIT_RATIO}、{CASH_DIVIDEND}记录",
+                "不需要复权时使用adjust=\"none\""
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class InstrumentNotFoundError(DataError):
+    """
+    标的不存在错误 / Instrument not found error
+    
+    提供者中没有该标的时抛出，与区间内没有数据（DAT0010）不同。多标的查询中记录在
+    FeatureResult.errors中，可以用isinstance或FeatureFetchError.of()区分。
+    Raised when the provider has no such instrument at all, as opposed to no
+    data in the requested range (DAT0010). In a multi-instrument query it is
+    recorded in FeatureResult.errors and can be told apart with isinstance or
+    FeatureFetchError.of().
+    """
+    
+    def __init__(self, instrument: str, provider: str, details: str = ""):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            provider: 提供者名称 / Provider name
+            details: 技术细节，如查找的文件路径 / Technical details such as the path looked up
+        """
+        self.instrument = instrument
+        error_info = ErrorInfo(
+            error_code="DAT0029",
+            error_message_zh=f"数据提供者 {provider} 中没有标的: {instrument}",
+            error_message_en=f"Instrument not found in data provider {provider}: {instrument}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=details or f"provider={provider}, instrument={instrument}",
+            suggested_actions=[
+                "检查标的代码是否正确",
+                "使用list_instruments()查看可用的标的"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class FieldNotFoundError(DataError):
+    """
+    字段不存在错误 / Field not found error
+    
+    请求的字段不在标的的数据中时抛出，错误信息中给出拼写最接近的可用字段
+    Raised when requested fields are absent from the instrument's data; the
+    message suggests the closest available spelling
+    """
+    
+    def __init__(
+        self,
+        fields: List[str],
+        available: List[str],
+        instrument: Optional[str] = None,
+        provider: Optional[str] = None,
+        details: str = ""
+    ):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            fields: 不存在的字段 / Missing fields
+            available: 可用字段 / Available fields
+            instrument: 标的代码 / Instrument code
+            provider: 提供者名称 / Provider name
+            details: 技术细节，如文件路径 / Technical details such as the file path
+        """
+        self.fields = list(fields)
+        self.instrument = instrument
+        self.available = [str(name) for name in available]
+        self.suggestions = suggest_fields(self.fields, self.available)
+        hint = ", ".join(self.suggestions.values())
+        where = f"{provider}: {instrument}" if provider else instrument or "-"
+        error_info = ErrorInfo(
+            error_code="DAT0030",
+            error_message_zh=f"字段不存在 {self.fields}: {where}" + (f"，是否指 {hint}?" if hint else ""),
+            error_message_en=f"Fields {self.fields} not found: {where}" + (f" (did you mean {hint}?)" if hint else ""),
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=", ".join(
+                part for part in (details, f"available={self.available}") if part
+            ),
+            suggested_actions=[
+                f"可用字段: {', '.join(self.available) or '无'}",
+                "使用list_fields()查看标的可用的字段"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class MetadataUnavailableError(DataError):
+    """
+    元数据不可用错误 / Metadata unavailable error
+    
+    提供者无法列出字段或标的时抛出
+    Raised when the provider cannot list its fields or instruments
+    """
+    
+    def __init__(self, provider: str, what: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            provider: 提供者名称 / Provider name
+            what: 无法列出的内容，"fields"或"instruments" / What can't be listed, "fields" or "instruments"
+        """
+        error_info = ErrorInfo(
+            error_code="DAT0028",
+            error_message_zh=f"数据提供者 {provider} 不支持列出{'字段' if what == 'fields' else '标的'}",
+            error_message_en=f"Data provider {provider} cannot list {what}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.LOW,
+            technical_details=f"provider={provider}, what={what}",
+            suggested_actions=["使用支持元数据查询的提供者，如csv、parquet或qlib"],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class ProviderUnhealthyError(DataError):
+    """
+    数据提供者不可用错误 / Provider unhealthy error
+    
+    healthcheck()发现提供者无法提供数据时抛出，如数据目录不存在、文件无法打开或日历为空
+    Raised by healthcheck() when the provider can't serve data, e.g. its data
+    directory is missing, its files can't be opened or its calendar is empty
+    """
+    
+    def __init__(self, provider: str, reason: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            provider: 提供者名称 / Provider name
+            reason: 不可用的原因（英文） / Why the provider is unhealthy, in English
+        """
+        self.provider = provider
+        self.reason = reason
+        error_info = ErrorInfo(
+            error_code="DAT0040",
+            error_message_zh=f"数据提供者 {provider} 不可用: {reason}",
+            error_message_en=f"Data provider {provider} is unhealthy: {reason}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.HIGH,
+            technical_details=f"provider={provider}, reason={reason}",
+            suggested_actions=[
+                "检查数据目录或数据服务是否可以访问",
+                "检查数据是否已经下载或初始化"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+class DataProvider(ABC):
+    """
+    特征数据提供者接口 / Feature data provider interface
+    
+    实现者按标的返回以时间为索引、以字段名（如"$close"）为列的DataFrame，
+    并提供数据覆盖范围内的交易日历。同一份策略代码可以在测试中使用本地CSV，
+    在生产中使用qlib数据源，而无需修改调用方。
+    Implementations return, per instrument, a DataFrame indexed by time with
+    field names (such as "$close") as columns, and expose the trading calendar
+    of the data they cover. The same strategy code can run against local CSV
+    dumps in tests and the qlib source in production without changing call sites.
+    """
+    
+    name: str = "base"
+    
+    # 返回的价格是否已经是后复权价（原始价 * $factor）；为False时返回原始成交价
+    adjusted_prices: bool = False
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """
+        提供者支持的数据频率 / Frequencies the provider supports
+        
+        默认只支持日频，提供分钟数据的实现应覆盖此属性
+        Daily only by default; implementations serving minute bars override it
+        """
+        return ("day",)
+    
+    def check_freq(self, freq: FreqLike) -> None:
+        """
+        检查频率是否受支持 / Check that a frequency is supported
+        
+        Args:
+            freq: 数据频率 / Data frequency
+        
+        Raises:
+            UnsupportedFrequencyError: 不支持时抛出，提供者只有日线时错误信息会说明 /
+                Raised when unsupported; the message says so when the provider only has daily bars
+        """
+        available = self.freqs
+        freq = to_freq(freq)
+        if freq not in SUPPORTED_FREQS or freq not in available:
+            raise UnsupportedFrequencyError(freq, self.name, available)
+    
+    @abstractmethod
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的特征数据 / Load feature data for a single instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            fields: 字段列表，如["$close"] / Field list, e.g. ["$close"]
+            start_time: 开始时间（包含） / Start time (inclusive)
+            end_time: 结束时间（包含） / End time (inclusive)
+            freq: 数据频率，取值见freqs / Data frequency, one of freqs
+        
+        Returns:
+            pd.DataFrame: 以完整时间戳（pd.Timestamp）为索引的数据，日内数据的时间戳
+                为K线结束时刻 / Data indexed by full timestamps; intraday bars are
+                stamped with their end time
+        
+        Raises:
+            DataError: 加载失败时抛出 / Raised when loading fails
+        """
+        raise NotImplementedError
+    
+    @abstractmethod
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """
+        获取交易日历 / Get the trading calendar
+        
+        Args:
+            start_time: 开始时间（包含） / Start time (inclusive)
+            end_time: 结束时间（包含） / End time (inclusive)
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            List[pd.Timestamp]: 升序排列的交易时间 / Trading timestamps in ascending order
+        
+        Raises:
+            DataError: 获取失败时抛出 / Raised when loading fails
+        """
+        raise NotImplementedError
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        在请求上下文中加载单个标的的特征数据 / Load one instrument's features under a request context
+        
+        默认实现在调用load_features前后检查上下文；能够中途中断I/O的提供者
+        应覆盖此方法，在读取过程中检查取消并关闭已打开的文件或连接。
+        The default checks the context before and after load_features;
+        providers that can interrupt their I/O should override it to check for
+        cancellation while reading and close any files or connections they opened.
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        ctx.check()
+        data = self.load_features(
+            instrument, fields,
+            start_time=start_time, end_time=end_time, freq=freq
+        )
+        ctx.check()
+        return data
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """
+        在请求上下文中获取交易日历 / Get the trading calendar under a request context
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        ctx.check()
+        calendar = self.calendar(start_time=start_time, end_time=end_time, freq=freq)
+        ctx.check()
+        return calendar
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """
+        检查提供者能否提供数据 / Check that the provider can serve data
+        
+        供服务的/healthz和/readyz使用，应当快速返回。默认实现要求日频交易日历不为空；
+        可以更廉价地检查（如只打开一个文件）的提供者应覆盖此方法。
+        Backs the server's /healthz and /readyz and should return quickly. The
+        default requires a non-empty daily calendar; providers with a cheaper
+        check (say, opening one file) override it.
+        
+        Args:
+            ctx: 请求上下文 / Request context
+        
+        Raises:
+            ProviderUnhealthyError: 提供者不可用时抛出 / Raised when the provider is unhealthy
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        try:
+            calendar = self.calendar_ctx(ctx)
+        except (ContextCancelledError, ProviderUnhealthyError):
+            raise
+        except Exception as e:
+            raise ProviderUnhealthyError(self.name, f"failed to load the calendar: {e}") from e
+        if not calendar:
+            raise ProviderUnhealthyError(self.name, "calendar is empty")
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        列出标的可用的字段 / List the fields available for an instrument
+        
+        默认实现抛出错误，能够列出字段的提供者应覆盖此方法
+        The default raises; providers that can list their fields override it
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            List[str]: 排序、去重后的字段，如["$close", "$open"] / Sorted, deduplicated fields, e.g. ["$close", "$open"]
+        
+        Raises:
+            MetadataUnavailableError: 提供者不支持列出字段时抛出 / Raised when the provider cannot list fields
+            DataError: 标的不存在时抛出 / Raised when the instrument doesn't exist
+        """
+        raise MetadataUnavailableError(self.name, "fields")
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """
+        列出市场中的标的 / List the instruments of a market
+        
+        默认实现抛出错误，能够列出标的的提供者应覆盖此方法
+        The default raises; providers that can list their instruments override it
+        
+        Args:
+            market: 市场或股票池，"all"表示所有标的 / Market or pool, "all" for every instrument
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            List[str]: 排序、去重后的标的代码 / Sorted, deduplicated instrument codes
+        
+        Raises:
+            MetadataUnavailableError: 提供者不支持列出标的时抛出 / Raised when the provider cannot list instruments
+        """
+        raise MetadataUnavailableError(self.name, "instruments")
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        加载基本面数据的公告记录 / Load the announcement records of fundamental fields
+        
+        每条记录是一次公告，以公告日而不是报告期末为索引，保证按时点对齐时不会提前看到数据；
+        按时点对齐和向前填充由core.fundamentals完成。默认实现抛出错误，提供基本面数据的
+        提供者应覆盖此方法。
+        Each record is one announcement, indexed by its announcement date rather
+        than the fiscal period end, so point-in-time alignment never exposes a
+        value early; alignment and forward-filling happen in core.fundamentals.
+        The default raises; providers serving fundamentals override it.
+        
+        Args:
+            instruments: 标的代码列表 / Instrument codes
+            fields: 基本面字段，取值见FUNDAMENTAL_FIELDS / Fundamental fields, from FUNDAMENTAL_FIELDS
+            start_time: 公告日下限（包含） / Earliest announcement date (inclusive)
+            end_time: 公告日上限（包含） / Latest announcement date (inclusive)
+        
+        Returns:
+            Dict[str, pd.DataFrame]: 标的代码到记录的映射；每个DataFrame以公告日（ANNOUNCE_DATE）为
+                升序索引，包含PERIOD_END列和fields列，没有公告的标的为空DataFrame /
+                Mapping of instrument code to records, each indexed by announcement
+                date (ANNOUNCE_DATE) in ascending order with a PERIOD_END column and
+                the fields; an instrument without announcements maps to an empty frame
+        
+        Raises:
+            FundamentalsUnavailableError: 提供者不提供基本面数据时抛出 /
+                Raised when the provider serves no fundamentals
+        """
+        raise FundamentalsUnavailableError(self.name)
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        在请求上下文中加载基本面数据的公告记录 / Load fundamental announcement records under a request context
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        ctx.check()
+        records = self.fundamentals(instruments, fields, start_time=start_time, end_time=end_time)
+        ctx.check()
+        return records
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """
+        加载标的的除权除息记录 / Load an instrument's split and dividend records
+        
+        用adjustment_factor()把记录换算为$factor。默认实现抛出错误，提供除权除息数据的
+        提供者应覆盖此方法。
+        adjustment_factor() turns the records into $factor. The default raises;
+        providers serving split and dividend records override it.
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            start_time: 除权日下限（包含） / Earliest ex-date (inclusive)
+            end_time: 除权日上限（包含） / Latest ex-date (inclusive)
+        
+        Returns:
+            pd.DataFrame: 以除权日（EX_DATE）为升序索引、包含SPLIT_RATIO和CASH_DIVIDEND列的记录 /
+                Records indexed by ex-date (EX_DATE) in ascending order with SPLIT_RATIO and CASH_DIVIDEND columns
+        
+        Raises:
+            AdjustmentsUnavailableError: 提供者不提供除权除息数据时抛出 /
+                Raised when the provider serves no split and dividend records
+        """
+        raise AdjustmentsUnavailableError(self.name)
+    
+    def corporate_actions(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> List[CorporateAction]:
+        """
+        加载标的的公司行为事件 / Load an instrument's corporate action events
+        
+        默认实现由adjustments()的记录转换（见corporate_actions_from()），有独立事件源的提供者
+        可以覆盖此方法
+        The default converts adjustments() records (see
+        corporate_actions_from()); providers with a separate event source
+        can override it
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            start_time: 除权日下限（包含） / Earliest ex-date (inclusive)
+            end_time: 除权日上限（包含） / Latest ex-date (inclusive)
+        
+        Returns:
+            List[CorporateAction]: 按除权日升序排列的CashDividend、Split和RightsIssue事件 /
+                CashDividend, Split and RightsIssue events in ex-date order
+        
+        Raises:
+            AdjustmentsUnavailableError: 提供者不提供除权除息数据时抛出 /
+                Raised when the provider serves no split and dividend records
+        """
+        return corporate_actions_from(instrument, self.adjustments(instrument, start_time=start_time, end_time=end_time))
+    
+    def earnings(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> List[Earnings]:
+        """
+        加载标的的业绩公告事件 / Load an instrument's earnings announcement events
+        
+        默认实现由fundamentals()的公告日转换（见earnings_from()），有独立业绩日历的提供者
+        可以覆盖此方法
+        The default converts the announcement dates of fundamentals() (see
+        earnings_from()); providers with a separate earnings calendar can
+        override it
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            start_time: 公告日下限（包含） / Earliest announcement date (inclusive)
+            end_time: 公告日上限（包含） / Latest announcement date (inclusive)
+        
+        Returns:
+            List[Earnings]: 按公告日升序排列的事件 / Events in announcement date order
+        
+        Raises:
+            FundamentalsUnavailableError: 提供者不提供基本面数据时抛出 /
+                Raised when the provider serves no fundamentals
+        """
+        records = self.fundamentals([instrument], [], start_time=start_time, end_time=end_time)
+        return earnings_from(instrument, records.get(instrument, pd.DataFrame()))
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str = "1min"
+    ) -> Subscription:
+        """
+        订阅实时K线 / Subscribe to live bars
+        
+        默认实现在后台线程中于每个频率边界之后调用load_features_ctx读取最近的K线，
+        能够主动推送的数据源应覆盖此方法。投递规则见Subscription。
+        The default polls load_features_ctx for the latest bars on a background
+        thread shortly after every frequency boundary; sources that can push
+        should override it. See Subscription for the delivery rules.
+        
+        Args:
+            ctx: 请求上下文，取消或超时时关闭订阅 / Request context; the subscription closes when it is done
+            instruments: 标的代码列表 / Instrument codes
+            fields: 字段列表，如["$close", "$volume"] / Field list, e.g. ["$close", "$volume"]
+            freq: 数据频率，取值见freqs / Data frequency, one of freqs
+        
+        Returns:
+            Subscription: 可迭代的K线订阅 / Iterable bar subscription
+        
+        Raises:
+            UnsupportedFrequencyError: 频率不受支持时抛出 / Raised for an unsupported frequency
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        ctx.check()
+        self.check_freq(freq)
+        subscription = Subscription(ctx, instruments, fields, freq)
+        return PollingFeed(self.load_features_ctx, subscription).start()
+    
+    def close(self) -> None:
+        """
+        释放提供者持有的文件或连接 / Release the files or connections the provider holds
+        
+        默认不做任何事；保持文件打开的提供者应覆盖此方法
+        Does nothing by default; providers that keep files open override it
+        """
+    
+    def features(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> Dict[str, pd.DataFrame]:
+        """
+        加载多个标的的特征数据 / Load feature data for several instruments
+        
+        默认实现逐个调用load_features，支持批量查询的数据源可以覆盖此方法
+        The default calls load_features per instrument; sources with a batch
+        query can override it
+        
+        Args:
+            instruments: 标的代码列表 / Instrument codes
+            fields: 字段列表 / Field list
+            start_time: 开始时间（包含） / Start time (inclusive)
+            end_time: 结束时间（包含） / End time (inclusive)
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            Dict[str, pd.DataFrame]: 标的代码到数据的映射，顺序与instruments一致 /
+                Mapping of instrument code to frame, in the order of instruments
+        
+        Raises:
+            UnsupportedFrequencyError: 频率不受支持时抛出 / Raised for an unsupported frequency
+            DataError: 任一标的加载失败时抛出 / Raised when any instrument fails to load
+        """
+        self.check_freq(freq)
+        return {
+            instrument: self.load_features(
+                instrument, fields,
+                start_time=start_time, end_time=end_time, freq=freq
+            )
+            for instrument in instruments
+        }
+
+
+class QlibDataProvider(DataProvider):
+    """
+    基于qlib的数据提供者 / qlib-backed data provider
+    """
+    
+    name = "qlib"
+    
+    # qlib数据中的价格已乘以$factor / qlib prices are already multiplied by $factor
+    adjusted_prices = True
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """qlib数据目录提供日频和1分钟数据 / qlib data directories ship daily and 1-minute bars"""
+        return ("1min", "day")
+    
+    def __init__(self, qlib_wrapper: Optional[QlibWrapper] = None):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            qlib_wrapper: QlibWrapper实例，如果为None则创建新实例 / QlibWrapper instance
+        """
+        self._qlib_wrapper = qlib_wrapper or QlibWrapper()
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """加载单个标的的特征数据 / Load feature data for a single instrument"""
+        data = self._qlib_wrapper.get_data(
+            instruments=[instrument],
+            fields=fields,
+            start_time=start_time,
+            end_time=end_time,
+            freq=freq
+        )
+        
+        # qlib返回(instrument, datetime)多级索引，去掉标的层级
+        if (
+            data is not None
+            and isinstance(data.index, pd.MultiIndex)
+            and "instrument" in data.index.names
+        ):
+            if instrument in data.index.get_level_values("instrument"):
+                data = data.xs(instrument, level="instrument")
+            else:
+                data = data.iloc[0:0]
+        
+        return data
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """qlib已初始化且交易日历不为空 / qlib is initialized and its calendar is not empty"""
+        if not self._qlib_wrapper.is_initialized():
+            raise ProviderUnhealthyError(self.name, "qlib is not initialized")
+        super().healthcheck(ctx)
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """获取qlib交易日历 / Get the qlib trading calendar"""
+        calendar = self._qlib_wrapper.get_calendar(
+            start_time=start_time,
+            end_time=end_time,
+            freq=freq
+        )
+        return [pd.Timestamp(ts) for ts in calendar]
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        从qlib数据目录的features/<instrument>/<field>.<freq>.bin文件列出字段 /
+        List fields from the features/<instrument>/<field>.<freq>.bin files of the qlib data directory
+        
+        Raises:
+            DataError: qlib未初始化时抛出 / Raised when qlib is not initialized
+            InstrumentNotFoundError: 没有该标的的数据时抛出 / Raised when there is no such instrument
+        """
+        self.check_freq(freq)
+        directory = self._data_dir() / "features" / instrument.lower()
+        if not directory.is_dir():
+            raise InstrumentNotFoundError(instrument, self.name, f"path={directory}")
+        suffix = f".{freq}.bin"
+        return sorted({
+            f"${path.name[:-len(suffix)]}" for path in directory.iterdir() if path.name.endswith(suffix)
+        })
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """
+        从qlib数据目录的instruments/<market>.txt索引列出标的 /
+        List instruments from the instruments/<market>.txt index of the qlib data directory
+        
+        Raises:
+            DataError: qlib未初始化或股票池不存在时抛出 / Raised when qlib is not initialized or the pool doesn't exist
+        """
+        path = self._data_dir() / "instruments" / f"{market.lower()}.txt"
+        if not path.exists():
+            error_info = ErrorInfo(
+                error_code="DAT0004",
+                error_message_zh=f"qlib数据中没有股票池: {market}",
+                error_message_en=f"Market not found in qlib data: {market}",
+                category=ErrorCategory.DATA,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=f"path={path}",
+                suggested_actions=[
+                    f"可用的股票池: {', '.join(sorted(p.stem for p in path.parent.glob('*.txt'))) or '无'}"
+                ],
+                recoverable=True
+            )
+            raise DataError(error_info)
+        with open(path, "r", encoding="utf-8") as f:
+            # 每行为"代码\t纳入日期\t剔除日期"
+            return sorted({line.split("\t")[0].strip().upper() for line in f if line.strip()})
+    
+    def _data_dir(self) -> Path:
+        """qlib数据目录 / qlib data directory"""
+        provider_uri = self._qlib_wrapper.get_provider_uri()
+        if provider_uri is None:
+            error_info = ErrorInfo(
+                error_code="DAT0002",
+                error_message_zh="qlib未初始化，请先调用init()方法",
+                error_message_en="qlib not initialized, please call init() first",
+                category=ErrorCategory.DATA,
+                severity=ErrorSeverity.HIGH,
+                technical_details="QlibDataProvider metadata requested before initialization",
+                suggested_actions=["调用 QlibWrapper.init() 方法初始化qlib"],
+                recoverable=True
+            )
+            raise DataError(error_info)
+        return Path(provider_uri)
+
+
+# 全局提供者注册表
+_registry: Dict[str, DataProvider] = {}
+_registry_lock = threading.Lock()
+# 全局默认提供者，None表示由DataManager使用其自身的qlib提供者
+_default_provider: Optional[DataProvider] = None
+
+
+def register_provider(name: str, provider: DataProvider) -> None:
+    """
+    注册数据提供者 / Register a data provider
+    
+    同名提供者会被覆盖 / A provider registered under the same name is replaced
+    
+    Args:
+        name: 提供者名称 / Provider name
+        provider: 提供者实例 / Provider instance
+    """
+    if not isinstance(provider, DataProvider):
+        raise TypeError(f"provider must be a DataProvider, got {type(provider).__name__}")
+    
+    with _registry_lock:
+        _registry[name] = provider
+    get_logger(__name__).debug(f"已注册数据提供者: {name}")
+
+
+def get_provider(name: str) -> DataProvider:
+    """
+    获取已注册的数据提供者 / Get a registered data provider
+    
+    Args:
+        name: 提供者名称 / Provider name
+    
+    Returns:
+        DataProvider: 提供者实例 / Provider instance
+    
+    Raises:
+        DataError: 提供者未注册时抛出 / Raised when the provider is not registered
+    """
+    with _registry_lock:
+        provider = _registry.get(name)
+        available = sorted(_registry.keys())
+    
+    if provider is None:
+        error_info = ErrorInfo(
+            error_code="DAT0011",
+            error_message_zh=f"数据提供者未注册: {name}",
+            error_message_en=f"Data provider not registered: {name}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.HIGH,
+            technical_details=f"name={name}, registered={available}",
+            suggested_actions=[
+                "使用 register_provider() 注册提供者",
+                f"可用的提供者: {', '.join(available) or '无'}"
+            ],
+            recoverable=True
+        )
+        raise DataError(error_info)
+    
+    return provider
+
+
+def list_providers() -> List[str]:
+    """
+    列出已注册的数据提供者名称 / List registered provider names
+    
+    Returns:
+        List[str]: 排序后的名称列表 / Sorted names
+    """
+    with _registry_lock:
+        return sorted(_registry.keys())
+
+
+def set_default_provider(provider: Optional[Union[str, DataProvider]]) -> None:
+    """
+    设置全局默认数据提供者 / Set the global default data provider
+    
+    未显式指定提供者的DataManager会使用该提供者，传入None恢复为qlib提供者
+    DataManagers created without an explicit provider use it; pass None to
+    restore the qlib provider
+    
+    Args:
+        provider: 提供者实例、已注册的提供者名称或None /
+            Provider instance, registered provider name, or None
+    
+    Raises:
+        DataError: 名称未注册时抛出 / Raised when the name is not registered
+    """
+    global _default_provider
+    
+    if isinstance(provider, str):
+        provider = get_provider(provider)
+    elif provider is not None and not isinstance(provider, DataProvider):
+        raise TypeError(f"provider must be a DataProvider, got {type(provider).__name__}")
+    
+    with _registry_lock:
+        _default_provider = provider
+    get_logger(__name__).info(
+        f"默认数据提供者已设置为: {provider.name if provider else 'qlib'}"
+    )
+
+
+def get_default_provider() -> Optional[DataProvider]:
+    """
+    获取全局默认数据提供者 / Get the global default data provider
+    
+    Returns:
+        Optional[DataProvider]: 未设置时返回None / None when not set
+    """
+    with _registry_lock:
+        return _default_provider
@@ -1,13 +1,19 @@
 """
 日志系统模块
 提供统一的日志记录、日志轮转和日志级别管理功能
+
+特征数据查询路径（提供者选择、缓存命中、逐标的耗时、对齐填充、跳过的标的）另外通过
+set_logger()安装的可插拔日志记录器输出，默认不输出任何内容。
+The feature query path (provider selection, cache hits, per-instrument
+timing, alignment fills, skipped instruments) logs through the pluggable
+logger installed with set_logger() instead, which is silent by default.
 """
 
 import logging
 import os
 from logging.handlers import RotatingFileHandler
 from pathlib import Path
-from typing import Optional
+from typing import Any, Optional, Protocol
 
 
 class LoggerSystem:
@@ -241,3 +247,91 @@ def setup_logging(
         backup_count: 保留的备份日志文件数量
     """
     _logger_system.setup(log_dir, log_level, log_format, max_bytes, backup_count)
+
+
+class Logger(Protocol):
+    """
+    可插拔日志接口 / Pluggable logger interface
+    
+    与logging.Logger兼容：消息使用%格式，参数只在该级别启用时才格式化，因此logging.Logger、
+    structlog或适配后的loguru记录器都可以直接安装。isEnabledFor()可选，缺少时视为所有级别都启用。
+    Compatible with logging.Logger: messages use %-style formatting and the
+    arguments are only formatted when the level is enabled, so a
+    logging.Logger, a structlog logger or an adapted loguru logger can be
+    installed as is. isEnabledFor() is optional; without it every level counts
+    as enabled.
+    """
+    
+    def debug(self, msg: str, *args: Any) -> None: ...
+    
+    def info(self, msg: str, *args: Any) -> None: ...
+    
+    def warning(self, msg: str, *args: Any) -> None: ...
+    
+    def error(self, msg: str, *args: Any) -> None: ...
+
+
+class NullLogger:
+    """丢弃所有消息的日志记录器，所有级别均未启用 / Logger that drops everything, with every level disabled"""
+    
+    def isEnabledFor(self, level: int) -> bool:
+        return False
+    
+    def debug(self, msg: str, *args: Any) -> None:
+        pass
+    
+    def info(self, msg: str, *args: Any) -> None:
+        pass
+    
+    def warning(self, msg: str, *args: Any) -> None:
+        pass
+    
+    def error(self, msg: str, *args: Any) -> None:
+        pass
+
+
+_NULL_LOGGER = NullLogger()
+_logger: Logger = _NULL_LOGGER
+
+
+def set_logger(logger: Optional[Logger]) -> None:
+    """
+    安装特征数据查询路径使用的日志记录器 / Install the logger used by the feature query path
+    
+    Args:
+        logger: 日志记录器，如logging.getLogger("features")；None恢复为不输出的默认记录器 /
+            Logger such as logging.getLogger("features"); None restores the silent default
+    """
+    global _logger
+    _logger = _NULL_LOGGER if logger is None else logger
+
+
+def current_logger() -> Logger:
+    """
+    获取当前安装的日志记录器 / Get the installed logger
+    
+    Returns:
+        Logger: set_logger()安装的记录器，未安装时为NullLogger / The logger from set_logger(), NullLogger if none
+    """
+    return _logger
+
+
+def log_enabled(level: int) -> bool:
+    """
+    检查当前记录器是否启用某个级别 / Check whether the installed logger has a level enabled
+    
+    调用方在构造日志参数（如计时、计数）之前检查，级别未启用时不做任何额外工作
+    Callers check this before building log arguments such as timings or
+    counts, so a disabled level costs nothing beyond this call
+    
+    Args:
+        level: logging模块的级别，如logging.DEBUG / Level from the logging module, e.g. logging.DEBUG
+    
+    Returns:
+        bool: 是否启用 / Whether the level is enabled
+    """
+    logger = _logger
+    if logger is _NULL_LOGGER:
+        return False
+    is_enabled = getattr(logger, "isEnabledFor", None)
+    return True if is_enabled is None else bool(is_enabled(level))
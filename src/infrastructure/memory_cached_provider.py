@@ -0,0 +1,333 @@
+"""
+带内存缓存的数据提供者模块 / Memory-Cached Data Provider Module
+包装任意数据提供者，用容量有限的LRU缓存保存重复查询的特征数据
+Wraps any data provider and keeps repeated feature queries in a bounded LRU cache
+
+磁盘缓存（CachedDataProvider）按区间合并数据，适合跨进程复用；内存缓存只按
+完全相同的查询命中，但不需要读写文件，适合研究时在同一进程内重复请求同一组
+(标的, 字段, 区间)的场景。两者可以叠加使用。
+The disk cache (CachedDataProvider) merges ranges and is shared across
+processes; the memory cache only hits on identical queries but never touches
+files, which suits research sessions that request the same (instrument,
+fields, range) over and over in one process. The two can be stacked.
+"""
+
+import logging
+import threading
+from collections import OrderedDict
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple
+
+import pandas as pd
+
+from .data_provider import ALL_MARKET, DataProvider, QlibDataProvider
+from .logger_system import current_logger, get_logger, log_enabled
+from .subscription import Subscription
+from ..utils.request_context import RequestContext
+
+
+# (标的, 排序去重后的字段, 开始, 结束, 频率)
+CacheKey = Tuple[str, Tuple[str, ...], Optional[pd.Timestamp], Optional[pd.Timestamp], str]
+
+
+def _to_bound(value) -> Optional[pd.Timestamp]:
+    if value is None:
+        return None
+    ts = pd.Timestamp(value)
+    if ts.tzinfo is not None:
+        ts = ts.tz_localize(None)
+    return ts
+
+
+@dataclass(frozen=True)
+class CacheStats:
+    """
+    缓存统计 / Cache statistics
+    
+    Attributes:
+        hits: 命中次数 / Number of hits
+        misses: 未命中次数 / Number of misses
+        evictions: 因容量不足淘汰的条目数 / Entries evicted for capacity
+        entries: 当前条目数 / Current number of entries
+        max_entries: 最大条目数 / Maximum number of entries
+    """
+    hits: int
+    misses: int
+    evictions: int
+    entries: int
+    max_entries: int
+    
+    @property
+    def hit_rate(self) -> float:
+        """命中率，没有查询时为0 / Hit rate, 0 before any query"""
+        total = self.hits + self.misses
+        return self.hits / total if total else 0.0
+
+
+class MemoryCachedDataProvider(DataProvider):
+    """
+    带内存LRU缓存的数据提供者 / Data provider with an in-memory LRU cache
+    
+    缓存键为规范化后的(标的, 字段, 开始, 结束, 频率)：字段去重并排序，时间统一为
+    不带时区的pd.Timestamp，因此["$open", "$close"]与["$close", "$open"]、
+    "2025-01-01"与pd.Timestamp("2025-01-01")命中同一条目。返回的列顺序仍与请求一致。
+    The key is the normalized (instrument, fields, start, end, frequency):
+    fields are deduplicated and sorted and times become tz-naive
+    pd.Timestamps, so ["$open", "$close"] and ["$close", "$open"], or
+    "2025-01-01" and pd.Timestamp("2025-01-01"), share one entry. Columns are
+    still returned in the requested order.
+    
+    缓存只保存副本，每次返回新的副本，调用方修改返回的DataFrame不会影响缓存。
+    可以在多个线程中并发使用；并发请求同一个未缓存的键时可能各自访问一次底层提供者。
+    The cache keeps its own copy and hands out a fresh copy on every call, so
+    callers may mutate the returned DataFrame without corrupting the cache. It
+    is safe for concurrent use; concurrent misses on the same key may each
+    reach the underlying provider once.
+    """
+    
+    def __init__(self, provider: DataProvider, max_entries: int = 256):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            provider: 底层数据提供者 / Underlying data provider
+            max_entries: 最多缓存的查询数，超出时淘汰最久未使用的条目 /
+                Maximum cached queries; the least recently used entry is evicted beyond it
+        
+        Raises:
+            ValueError: max_entries不是正数时抛出 / Raised when max_entries is not positive
+        """
+        if max_entries < 1:
+            raise ValueError(f"max_entries must be >= 1, got {max_entries}")
+        self._provider = provider
+        self._max_entries = max_entries
+        self._entries: "OrderedDict[CacheKey, pd.DataFrame]" = OrderedDict()
+        self._lock = threading.Lock()
+        self._hits = 0
+        self._misses = 0
+        self._evictions = 0
+        self.name = f"{provider.name}+memory"
+        self._logger = get_logger(__name__)
+    
+    @property
+    def provider(self) -> DataProvider:
+        """底层数据提供者 / Underlying data provider"""
+        return self._provider
+    
+    @property
+    def max_entries(self) -> int:
+        """最大条目数 / Maximum number of entries"""
+        return self._max_entries
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """与底层提供者相同 / Same as the underlying provider"""
+        return self._provider.freqs
+    
+    @property
+    def adjusted_prices(self) -> bool:
+        """与底层提供者相同 / Same as the underlying provider"""
+        return self._provider.adjusted_prices
+    
+    def stats(self) -> CacheStats:
+        """
+        获取缓存统计 / Get cache statistics
+        
+        Returns:
+            CacheStats: 命中、未命中、淘汰次数和当前条目数 /
+                Hits, misses, evictions and the current number of entries
+        """
+        with self._lock:
+            return CacheStats(
+                hits=self._hits,
+                misses=self._misses,
+                evictions=self._evictions,
+                entries=len(self._entries),
+                max_entries=self._max_entries
+            )
+    
+    def clear(self) -> int:
+        """
+        清空缓存，统计计数保持不变 / Empty the cache, keeping the statistics
+        
+        Returns:
+            int: 删除的条目数 / Number of entries removed
+        """
+        with self._lock:
+            count = len(self._entries)
+            self._entries.clear()
+        self._logger.info(f"内存特征缓存已清空, 条目数: {count}")
+        return count
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的特征数据，优先使用缓存 / Load feature data, serving from cache when possible
+        """
+        return self._load(instrument, fields, start_time, end_time, freq)
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        在请求上下文中加载特征数据，缓存未命中时把上下文传给底层提供者 /
+        Load feature data under a request context, passing it to the provider on a miss
+        """
+        ctx.check()
+        return self._load(instrument, fields, start_time, end_time, freq, ctx)
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """获取底层提供者的交易日历 / Get the underlying provider's calendar"""
+        return self._provider.calendar(start_time=start_time, end_time=end_time, freq=freq)
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """在请求上下文中获取底层提供者的交易日历 / Get the provider's calendar under a request context"""
+        return self._provider.calendar_ctx(ctx, start_time=start_time, end_time=end_time, freq=freq)
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str = "1min"
+    ) -> Subscription:
+        """订阅底层提供者的实时K线，不经过缓存 / Subscribe to the provider's live bars, bypassing the cache"""
+        return self._provider.subscribe(ctx, instruments, fields, freq)
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """检查底层提供者，不经过缓存 / Check the underlying provider, bypassing the cache"""
+        self._provider.healthcheck(ctx)
+    
+    def close(self) -> None:
+        """关闭底层提供者 / Close the underlying provider"""
+        self._provider.close()
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """列出底层提供者的字段 / List the underlying provider's fields"""
+        return self._provider.list_fields(instrument, freq=freq)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """列出底层提供者的标的 / List the underlying provider's instruments"""
+        return self._provider.list_instruments(market, freq=freq)
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """获取底层提供者的基本面公告记录，不经过缓存 / Get the provider's fundamental records, bypassing the cache"""
+        return self._provider.fundamentals(instruments, fields, start_time=start_time, end_time=end_time)
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """在请求上下文中获取底层提供者的基本面公告记录 / Get the provider's fundamental records under a request context"""
+        return self._provider.fundamentals_ctx(ctx, instruments, fields, start_time=start_time, end_time=end_time)
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """获取底层提供者的除权除息记录，不经过缓存 / Get the provider's split and dividend records, bypassing the cache"""
+        return self._provider.adjustments(instrument, start_time=start_time, end_time=end_time)
+    
+    def _load(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str,
+        ctx: Optional[RequestContext] = None
+    ) -> pd.DataFrame:
+        requested = list(dict.fromkeys(fields))
+        key = (instrument, tuple(sorted(requested)), _to_bound(start_time), _to_bound(end_time), freq)
+        
+        with self._lock:
+            frame = self._entries.get(key)
+            if frame is not None:
+                self._entries.move_to_end(key)
+                self._hits += 1
+                if log_enabled(logging.DEBUG):
+                    current_logger().debug("内存特征缓存命中: %s %s", instrument, requested)
+                return frame[requested].copy()
+            self._misses += 1
+        if log_enabled(logging.DEBUG):
+            current_logger().debug("内存特征缓存未命中: %s %s", instrument, requested)
+        
+        # 在锁外访问底层提供者，慢查询不阻塞其他键
+        if ctx is None:
+            frame = self._provider.load_features(
+                instrument, list(key[1]), start_time=start_time, end_time=end_time, freq=freq
+            )
+        else:
+            frame = self._provider.load_features_ctx(
+                ctx, instrument, list(key[1]), start_time=start_time, end_time=end_time, freq=freq
+            )
+        if frame is None:
+            return frame
+        
+        with self._lock:
+            self._entries[key] = frame.copy()
+            self._entries.move_to_end(key)
+            while len(self._entries) > self._max_entries:
+                evicted, _ = self._entries.popitem(last=False)
+                self._evictions += 1
+                self._logger.debug(f"内存特征缓存淘汰: {evicted[0]} {list(evicted[1])}")
+        return frame[requested].copy()
+
+
+def with_memory_cache(
+    max_entries: int = 256,
+    provider: Optional[DataProvider] = None
+) -> MemoryCachedDataProvider:
+    """
+    为数据提供者加上内存LRU缓存 / Add an in-memory LRU cache in front of a data provider
+    
+    Args:
+        max_entries: 最多缓存的查询数 / Maximum cached queries
+        provider: 底层数据提供者，None表示使用qlib提供者 / Underlying provider, None uses qlib
+    
+    Returns:
+        MemoryCachedDataProvider: 带内存缓存的提供者 / Memory-cached provider
+    
+    Examples:
+        >>> provider = with_memory_cache(512, CSVDataProvider("./data"))
+        >>> manager = DataManager(provider=provider)
+        >>> provider.stats().hit_rate
+    """
+    if provider is None:
+        provider = QlibDataProvider()
+    return MemoryCachedDataProvider(provider, max_entries)
@@ -0,0 +1,528 @@
+"""
+Parquet数据提供者模块 / Parquet Data Provider Module
+从本地目录中的<INSTRUMENT>.parquet文件按列读取OHLCV数据，并提供单个文件的读写函数
+Reads OHLCV bars column-wise from <INSTRUMENT>.parquet files in a local
+directory, plus functions to write and read a single file
+"""
+
+from pathlib import Path
+from typing import List, Optional, Tuple
+
+import pandas as pd
+
+from .data_provider import (
+    ALL_MARKET,
+    DataProvider,
+    FieldNotFoundError,
+    InstrumentNotFoundError,
+    ProviderConfig,
+    ProviderUnhealthyError,
+    SUPPORTED_FREQS,
+    match_market
+)
+from .logger_system import get_logger
+from .reader_pool import ReaderPool
+from ..utils.request_context import RequestContext, ContextCancelledError
+from ..utils.error_handler import (
+    DataError,
+    SystemError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+try:
+    import pyarrow as pa
+    import pyarrow.parquet as pq
+    PYARROW_AVAILABLE = True
+except ImportError:
+    PYARROW_AVAILABLE = False
+    pa = None
+    pq = None
+
+
+# Parquet中可作为日期列的列名
+DATE_COLUMNS = ("datetime", "date")
+
+# write_parquet默认的行组大小，约为一年的日线
+DEFAULT_ROW_GROUP_ROWS = 250
+
+# write_parquet支持的压缩算法
+COMPRESSIONS = ("snappy", "zstd", "gzip", "none")
+
+# 文件元数据中保存标的代码的键
+INSTRUMENT_METADATA_KEY = b"instrument"
+
+
+def _require_pyarrow() -> None:
+    """pyarrow未安装时抛出错误 / Raise when pyarrow is not installed"""
+    if PYARROW_AVAILABLE:
+        return
+    error_info = ErrorInfo(
+        error_code="SYS0005",
+        error_message_zh="pyarrow未安装，无法读取Parquet文件",
+        error_message_en="pyarrow not installed, cannot read Parquet files",
+        category=ErrorCategory.SYSTEM,
+        severity=ErrorSeverity.HIGH,
+        technical_details="pyarrow module not found",
+        suggested_actions=["安装pyarrow: pip install pyarrow"],
+        recoverable=False
+    )
+    raise SystemError(error_info)
+
+
+def write_parquet(
+    path: str,
+    frame: pd.DataFrame,
+    row_group_size: int = DEFAULT_ROW_GROUP_ROWS,
+    compression: str = "snappy",
+    instrument: Optional[str] = None
+) -> None:
+    """
+    按ParquetDataProvider的布局写入Parquet文件 / Write a Parquet file in the ParquetDataProvider layout
+    
+    数据按时间排序后写入，每个行组保存一段连续的时间区间，时间索引写为datetime列，
+    字段列去掉"$"前缀，列的类型保持不变
+    Rows are sorted by time before writing so that each row group holds a
+    contiguous time range; the index becomes the datetime column, field
+    columns drop their "$" prefix and keep their dtypes
+    
+    Args:
+        path: 文件路径 / File path
+        frame: 以时间为索引的数据 / Time-indexed data
+        row_group_size: 每个行组的行数 / Rows per row group
+        compression: 压缩算法，见COMPRESSIONS / Compression codec, see COMPRESSIONS
+        instrument: 写入文件元数据的标的代码 / Instrument code stored in the file metadata
+    
+    Raises:
+        ValueError: 压缩算法不受支持时抛出 / Raised for an unsupported compression codec
+        SystemError: pyarrow未安装时抛出 / Raised when pyarrow is not installed
+    """
+    if compression not in COMPRESSIONS:
+        raise ValueError(f"compression must be one of {COMPRESSIONS}, got {compression!r}")
+    _require_pyarrow()
+    data = frame.sort_index(kind="stable")
+    data = data.rename(columns={c: str(c).lstrip("$") for c in data.columns})
+    data.index = pd.DatetimeIndex(data.index, name="datetime")
+    table = pa.Table.from_pandas(data.reset_index(), preserve_index=False)
+    if instrument is not None:
+        metadata = dict(table.schema.metadata or {})
+        metadata[INSTRUMENT_METADATA_KEY] = instrument.encode("utf-8")
+        table = table.replace_schema_metadata(metadata)
+    Path(path).parent.mkdir(parents=True, exist_ok=True)
+    pq.write_table(table, path, row_group_size=row_group_size, compression=compression)
+
+
+def read_parquet(
+    path: str,
+    fields: Optional[List[str]] = None,
+    start_time: Optional[str] = None,
+    end_time: Optional[str] = None,
+    timezone: str = "Asia/Shanghai"
+) -> pd.DataFrame:
+    """
+    读取单个Parquet文件 / Read a single Parquet file
+    
+    只解码请求的字段列，并跳过区间之外的行组。文件可以由write_parquet写入，也可以是
+    pandas的to_parquet()或qlib导出的同样结构的文件（时间为datetime/date列或索引）。
+    Only the requested field columns are decoded and row groups outside the
+    range are skipped. The file may come from write_parquet or be one with the
+    same layout written by pandas' to_parquet() or exported from qlib (time in
+    a datetime/date column or in the index).
+    
+    Args:
+        path: 文件路径 / File path
+        fields: 字段列表，如["$close"]，None表示读取所有列 / Fields such as ["$close"], None reads every column
+        start_time: 开始时间 / Start time
+        end_time: 结束时间 / End time
+        timezone: 交易所时区，带时区的时间转换到该时区 / Exchange timezone for aware times
+    
+    Returns:
+        pd.DataFrame: 以datetime为索引的数据，attrs["instrument"]为文件元数据中的标的代码，
+            没有时为文件名 / Frame indexed by datetime; attrs["instrument"] holds the
+            instrument from the file metadata, or the file name without one
+    
+    Raises:
+        DataError: 文件不存在、格式错误或字段缺失时抛出 /
+            Raised when the file is missing, malformed, or lacks a field
+        SystemError: pyarrow未安装时抛出 / Raised when pyarrow is not installed
+    
+    Examples:
+        >>> write_parquet("SH600000.parquet", frame, compression="zstd", instrument="SH600000")
+        >>> close = read_parquet("SH600000.parquet", ["$close"])
+    """
+    file_path = Path(path).expanduser()
+    provider = ParquetDataProvider(str(file_path.parent), timezone=timezone, config=ProviderConfig(1, None))
+    try:
+        frame = provider._read(file_path, file_path.stem, fields, start_time, end_time)
+    finally:
+        provider.close()
+    stored = (pq.read_schema(file_path).metadata or {}).get(INSTRUMENT_METADATA_KEY)
+    frame.attrs["instrument"] = stored.decode("utf-8") if stored else file_path.stem
+    return frame
+
+
+class ParquetDataProvider(DataProvider):
+    """
+    Parquet数据提供者 / Parquet data provider
+    
+    每个标的对应一个Parquet文件，包含datetime（或date）列和行情列（如open、close，
+    也可以带"$"前缀），行情列映射为"$open"、"$close"等字段。每个行组保存一段连续的
+    时间区间，读取时根据行组中日期列的统计信息跳过查询区间之外的行组，并且只解码
+    请求的字段列，因此字段多、跨度长的数据读取比CSV快得多。
+    One Parquet file per instrument with a datetime (or date) column plus bar
+    columns (open, close, ..., with or without a "$" prefix) that map to
+    "$open", "$close" and so on. Each row group holds a contiguous time range;
+    reads use the date column statistics of each row group to skip row groups
+    outside the query window, and only decode the requested field columns, so
+    wide, long reads are much faster than CSV.
+    
+    日频文件位于data_dir下，分钟数据位于以频率命名的子目录中，与CSVDataProvider一致。
+    Daily files live directly in data_dir and minute bars in a subdirectory
+    named after the frequency, as with CSVDataProvider.
+    
+    打开的文件在并发读取之间复用，数量受config.max_open_readers限制，见ReaderPool；
+    不再使用时调用close()关闭。
+    Open files are reused across concurrent reads, bounded by
+    config.max_open_readers (see ReaderPool); call close() once done.
+    """
+    
+    name = "parquet"
+    
+    def __init__(
+        self,
+        data_dir: str,
+        timezone: str = "Asia/Shanghai",
+        config: Optional[ProviderConfig] = None
+    ):
+        """
+        初始化Parquet提供者 / Initialize Parquet provider
+        
+        Args:
+            data_dir: Parquet文件目录 / Directory holding the Parquet files
+            timezone: 交易所时区，带时区的时间转换到该时区 / Exchange timezone for aware times
+            config: 打开文件数等资源配置，None表示使用默认值 / Resource settings such as open files, None for the defaults
+        
+        Raises:
+            SystemError: pyarrow未安装时抛出 / Raised when pyarrow is not installed
+        """
+        _require_pyarrow()
+        config = config or ProviderConfig()
+        self._data_dir = Path(data_dir).expanduser()
+        self._timezone = timezone
+        self._readers = ReaderPool(pq.ParquetFile, config.max_open_readers, config.idle_timeout)
+        self._logger = get_logger(__name__)
+    
+    @property
+    def data_dir(self) -> Path:
+        """Parquet文件目录 / Parquet directory"""
+        return self._data_dir
+    
+    @property
+    def readers(self) -> ReaderPool:
+        """复用已打开文件的读取器池 / Pool reusing the open files"""
+        return self._readers
+    
+    def close(self) -> None:
+        """关闭所有打开的文件，之后不能再读取 / Close every open file; no reads are possible afterwards"""
+        self._readers.close()
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """日频以及data_dir中存在子目录的分钟频率 / Daily plus minute frequencies with a subdirectory"""
+        return tuple(
+            freq for freq in SUPPORTED_FREQS
+            if freq == "day" or (self._data_dir / freq).is_dir()
+        )
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的特征数据 / Load feature data for a single instrument
+        
+        Raises:
+            UnsupportedFrequencyError: 没有该频率的子目录时抛出 /
+                Raised when there is no subdirectory for the frequency
+            DataError: 文件不存在、格式错误或字段缺失时抛出 /
+                Raised when the file is missing, malformed, or lacks a field
+        """
+        return self._load(instrument, fields, start_time, end_time, freq)
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        在请求上下文中加载特征数据，每个行组之间检查取消 /
+        Load feature data under a request context, checking for cancellation between row groups
+        """
+        ctx.check()
+        return self._load(instrument, fields, start_time, end_time, freq, ctx)
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """
+        data_dir中至少有一个Parquet文件，且第一个文件的schema可以读取 /
+        data_dir holds at least one Parquet file, and the first one's schema can be read
+        """
+        ctx.check()
+        if not PYARROW_AVAILABLE:
+            raise ProviderUnhealthyError(self.name, "pyarrow is not installed")
+        if not self._data_dir.is_dir():
+            raise ProviderUnhealthyError(self.name, f"data directory not found: {self._data_dir}")
+        path = next(iter(sorted(self._data_dir.glob("*.parquet"))), None)
+        if path is None:
+            raise ProviderUnhealthyError(self.name, f"no Parquet files in {self._data_dir}")
+        try:
+            pq.read_schema(path)
+        except Exception as e:
+            raise ProviderUnhealthyError(self.name, f"cannot read {path.name}: {e}") from e
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """
+        获取交易日历 / Get the trading calendar
+        
+        日历为该频率目录中所有Parquet文件时间的并集，只读取日期列
+        The calendar is the union of the timestamps of every Parquet file for the
+        frequency; only the date column is read
+        """
+        self.check_freq(freq)
+        index = pd.DatetimeIndex([])
+        for path in sorted(self._freq_dir(freq).glob("*.parquet")):
+            frame = self._load(path.stem, [], start_time, end_time, freq)
+            index = index.union(frame.index)
+        return list(index)
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        从Parquet文件的schema列出字段，不读取数据 / List fields from the Parquet schema without reading any data
+        
+        Raises:
+            DataError: 文件不存在或没有日期列时抛出 / Raised when the file is missing or has no date column
+        """
+        self.check_freq(freq)
+        path = self._require_file(self._instrument_path(instrument, freq), instrument)
+        try:
+            schema = pq.read_schema(path)
+            date_column = self._date_column(schema, {name.lower(): name for name in schema.names})
+            if date_column is None:
+                raise ValueError(f"no date column, expected one of {DATE_COLUMNS}")
+        except Exception as e:
+            raise self._parse_error(path, e) from e
+        return sorted({self._field_name(name) for name in schema.names if name != date_column})
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """
+        从目录中的Parquet文件名列出标的，市场按交易所前缀匹配 /
+        List instruments from the Parquet file names; markets match on the exchange prefix
+        """
+        self.check_freq(freq)
+        return sorted({
+            path.stem for path in self._freq_dir(freq).glob("*.parquet") if match_market(path.stem, market)
+        })
+    
+    def _load(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str = "day",
+        ctx: Optional[RequestContext] = None
+    ) -> pd.DataFrame:
+        self.check_freq(freq)
+        return self._read(self._instrument_path(instrument, freq), instrument, fields, start_time, end_time, ctx)
+    
+    def _read(
+        self,
+        path: Path,
+        instrument: str,
+        fields: Optional[List[str]],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        ctx: Optional[RequestContext] = None
+    ) -> pd.DataFrame:
+        """读取一个Parquet文件，fields为None时读取所有列 / Read one Parquet file; None fields reads every column"""
+        self._require_file(path, instrument)
+        
+        start = None if start_time is None else self._to_local(start_time)
+        end = None if end_time is None else self._to_local(end_time)
+        
+        try:
+            with self._readers.reader(path, ctx) as parquet_file:
+                return self._read_file(parquet_file, path, instrument, fields, start, end, ctx)
+        except (DataError, ContextCancelledError):
+            raise
+        except Exception as e:
+            raise self._parse_error(path, e) from e
+    
+    def _read_file(
+        self,
+        parquet_file,
+        path: Path,
+        instrument: str,
+        fields: Optional[List[str]],
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp],
+        ctx: Optional[RequestContext]
+    ) -> pd.DataFrame:
+        """从已打开的Parquet文件读取 / Read from an open Parquet file"""
+        schema = parquet_file.schema_arrow
+        columns = {name.lower(): name for name in schema.names}
+        date_column = self._date_column(schema, columns)
+        if date_column is None:
+            raise ValueError(f"no date column, expected one of {DATE_COLUMNS}")
+        if fields is None:
+            fields = [self._field_name(name) for name in schema.names if name != date_column]
+        
+        field_columns = {}
+        for field in fields:
+            name = field.lower()
+            column = columns.get(name) or columns.get(name.lstrip("$"))
+            if column is not None:
+                field_columns[field] = column
+        missing = [f for f in fields if f not in field_columns]
+        if missing:
+            available = [self._field_name(name) for name in schema.names if name != date_column]
+            raise FieldNotFoundError(missing, available, instrument, self.name, f"file={path}")
+        
+        groups = self._row_groups_in_range(parquet_file, date_column, start, end)
+        read_columns = [date_column] + list(dict.fromkeys(field_columns.values()))
+        tables = []
+        for group in groups:
+            if ctx is not None:
+                ctx.check()
+            tables.append(parquet_file.read_row_group(group, columns=read_columns))
+        if tables:
+            table = pa.concat_tables(tables)
+        else:
+            table = parquet_file.schema_arrow.empty_table().select(read_columns)
+        raw = table.to_pandas()
+        
+        index = self._localize(pd.DatetimeIndex(pd.to_datetime(raw[date_column])))
+        # pyarrow可能以微秒精度返回时间，统一为与CSV提供者相同的纳秒精度
+        index = index.astype("datetime64[ns]")
+        frame = pd.DataFrame(
+            {field: raw[column].to_numpy() for field, column in field_columns.items()},
+            index=index,
+            columns=list(fields)
+        )
+        frame.index.name = "datetime"
+        if start is not None:
+            frame = frame[frame.index >= start]
+        if end is not None:
+            frame = frame[frame.index <= end]
+        
+        self._logger.debug(
+            f"读取Parquet: {path}, 行组: {len(groups)}/{parquet_file.num_row_groups}, "
+            f"行数: {len(frame)}, 字段: {list(fields)}"
+        )
+        return frame.sort_index()
+    
+    def _require_file(self, path: Path, instrument: str) -> Path:
+        """文件不存在时抛出错误 / Raise when the file is missing"""
+        if not path.exists():
+            raise InstrumentNotFoundError(instrument, self.name, f"path={path}")
+        return path
+    
+    @staticmethod
+    def _parse_error(path: Path, error: Exception) -> DataError:
+        """构造Parquet解析失败的错误 / Build the error for a Parquet file that fails to parse"""
+        error_info = ErrorInfo(
+            error_code="DAT0025",
+            error_message_zh=f"解析Parquet文件失败: {path.name}: {str(error)}",
+            error_message_en=f"Failed to parse Parquet file: {path.name}: {str(error)}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"path={path}",
+            suggested_actions=[
+                "检查Parquet文件是否包含datetime列",
+                "确认文件没有损坏"
+            ],
+            recoverable=True,
+            original_exception=error
+        )
+        return DataError(error_info)
+    
+    @staticmethod
+    def _date_column(schema, columns) -> Optional[str]:
+        """
+        时间列：datetime或date列，否则为pandas写入的索引列 /
+        The datetime or date column, else the index column pandas wrote
+        """
+        date_column = next((columns[c] for c in DATE_COLUMNS if c in columns), None)
+        if date_column is None:
+            # 未命名的DatetimeIndex被pandas写为__index_level_0__
+            index_columns = (schema.pandas_metadata or {}).get("index_columns", [])
+            date_column = next((c for c in index_columns if isinstance(c, str)), None)
+        return date_column
+    
+    @staticmethod
+    def _field_name(column: str) -> str:
+        """列名对应的字段名，如close为$close，表达式列保持不变 / Field of a column: close is $close, expression columns stay as is"""
+        name = column.lstrip("$")
+        return f"${name}" if name.isidentifier() else column
+    
+    def _row_groups_in_range(
+        self,
+        parquet_file,
+        date_column: str,
+        start: Optional[pd.Timestamp],
+        end: Optional[pd.Timestamp]
+    ) -> List[int]:
+        """
+        选出与查询区间重叠的行组 / Pick the row groups overlapping the query window
+        
+        行组的最小、最大日期与区间边界相等时保留，没有统计信息的行组总是读取
+        Row groups whose min or max equals a bound are kept; row groups without
+        statistics are always read
+        """
+        column_index = parquet_file.schema_arrow.get_field_index(date_column)
+        groups = []
+        for group in range(parquet_file.num_row_groups):
+            statistics = parquet_file.metadata.row_group(group).column(column_index).statistics
+            if statistics is None or not statistics.has_min_max:
+                groups.append(group)
+                continue
+            lower = self._to_local(statistics.min)
+            upper = self._to_local(statistics.max)
+            if (start is not None and upper < start) or (end is not None and lower > end):
+                continue
+            groups.append(group)
+        return groups
+    
+    def _freq_dir(self, freq: str) -> Path:
+        """频率对应的Parquet目录 / Parquet directory of a frequency"""
+        return self._data_dir if freq == "day" else self._data_dir / freq
+    
+    def _instrument_path(self, instrument: str, freq: str = "day") -> Path:
+        """标的对应的Parquet路径 / Parquet path of an instrument"""
+        return self._freq_dir(freq) / f"{instrument}.parquet"
+    
+    def _localize(self, index: pd.DatetimeIndex) -> pd.DatetimeIndex:
+        """转换为交易所本地时间（不带时区） / Convert to exchange-local naive time"""
+        if index.tz is not None:
+            index = index.tz_convert(self._timezone).tz_localize(None)
+        return index
+    
+    def _to_local(self, value) -> pd.Timestamp:
+        """把时间转换为交易所本地时间 / Convert a time to exchange-local time"""
+        ts = pd.Timestamp(value)
+        if ts.tzinfo is not None:
+            ts = ts.tz_convert(self._timezone).tz_localize(None)
+        return ts
@@ -0,0 +1,298 @@
+"""
+文件读取器池模块 / File Reader Pool Module
+在多个线程之间复用数量有限的已打开文件读取器，避免并发读取时耗尽文件描述符
+Shares a bounded number of open file readers between threads so that
+concurrent reads can't exhaust file descriptors
+
+同一时刻一个读取器只借给一个线程使用，因此读取器本身不需要是线程安全的。打开的读取器
+总数（使用中和空闲的）不超过max_open，已满时新的读取请求等待其他线程归还；空闲超过
+idle_timeout的读取器由后台线程关闭。文件在读取器打开之后被修改时，下次借出前重新打开。
+A reader is lent to one thread at a time, so readers need not be thread-safe
+themselves. The number of open readers, in use and idle, never exceeds
+max_open; when full, new reads wait for another thread to return one. A
+background thread closes readers idle for longer than idle_timeout, and a
+reader whose file changed after it was opened is reopened before it is lent
+again.
+
+Examples:
+    >>> pool = ReaderPool(pq.ParquetFile, max_open=64, idle_timeout=60.0)
+    >>> with pool.reader(path) as parquet_file:
+    ...     table = parquet_file.read_row_group(0)
+    >>> pool.close()
+"""
+
+import threading
+import time
+from contextlib import contextmanager
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Any, Callable, Dict, Iterator, List, Optional, Tuple
+
+from .logger_system import get_logger
+from ..utils.request_context import RequestContext
+
+
+# 等待归还读取器时检查上下文的间隔（秒） / Interval in seconds between context checks while waiting for a reader
+_WAIT_INTERVAL = 0.05
+
+
+@dataclass
+class _Idle:
+    """空闲的读取器 / An idle reader"""
+    reader: Any
+    mtime_ns: int
+    returned_at: float
+
+
+class ReaderPool:
+    """
+    有上限的文件读取器池 / Bounded pool of open file readers
+    
+    线程安全 / Thread-safe
+    """
+    
+    def __init__(
+        self,
+        opener: Callable[[Path], Any],
+        max_open: int = 64,
+        idle_timeout: Optional[float] = 60.0,
+        closer: Optional[Callable[[Any], None]] = None
+    ):
+        """
+        初始化读取器池 / Initialize the pool
+        
+        Args:
+            opener: 按路径打开读取器的函数，如pq.ParquetFile / Opens a reader for a path, e.g. pq.ParquetFile
+            max_open: 同时打开的读取器上限 / Upper bound on open readers
+            idle_timeout: 空闲读取器保留的秒数，None表示一直保留到close() /
+                Seconds an idle reader is kept, None keeps it until close()
+            closer: 关闭读取器的函数，默认调用其close()方法 / Closes a reader, calling its close() by default
+        
+        Raises:
+            ValueError: max_open不是正数或idle_timeout为负数时抛出 /
+                Raised when max_open is not positive or idle_timeout is negative
+        """
+        if max_open < 1:
+            raise ValueError(f"max_open must be positive, got {max_open}")
+        if idle_timeout is not None and idle_timeout < 0:
+            raise ValueError(f"idle_timeout must be non-negative, got {idle_timeout}")
+        self._opener = opener
+        self._closer = closer or _close_reader
+        self._max_open = max_open
+        self._idle_timeout = idle_timeout
+        self._condition = threading.Condition()
+        self._idle: Dict[Path, List[_Idle]] = {}
+        self._open = 0
+        self._closed = False
+        self._stopped = threading.Event()
+        self._janitor: Optional[threading.Thread] = None
+        self._logger = get_logger(__name__)
+    
+    @property
+    def max_open(self) -> int:
+        """同时打开的读取器上限 / Upper bound on open readers"""
+        return self._max_open
+    
+    @property
+    def open_count(self) -> int:
+        """当前打开的读取器数，包括使用中和空闲的 / Readers open now, in use or idle"""
+        with self._condition:
+            return self._open
+    
+    @property
+    def idle_count(self) -> int:
+        """当前空闲的读取器数 / Readers idle now"""
+        with self._condition:
+            return sum(len(entries) for entries in self._idle.values())
+    
+    @contextmanager
+    def reader(self, path: Path, ctx: Optional[RequestContext] = None) -> Iterator[Any]:
+        """
+        借用一个读取器，退出时归还 / Borrow a reader, returning it on exit
+        
+        读取过程中抛出错误时读取器被关闭而不是归还，避免复用状态不确定的读取器
+        A reader is closed rather than returned when the read raises, so a
+        reader in an unknown state is never reused
+        
+        Args:
+            path: 文件路径 / File path
+            ctx: 请求上下文，等待读取器时检查取消 / Request context checked while waiting for a reader
+        
+        Yields:
+            读取器 / The reader
+        
+        Raises:
+            ContextCancelledError: 等待期间上下文取消或超时时抛出 / Raised when the context is done while waiting
+            RuntimeError: 池已关闭时抛出 / Raised once the pool is closed
+        """
+        path = Path(path)
+        reader, mtime_ns = self._acquire(path, ctx)
+        try:
+            yield reader
+        except BaseException:
+            self._discard(reader)
+            raise
+        self._release(path, reader, mtime_ns)
+    
+    def close(self) -> None:
+        """
+        关闭所有空闲读取器，并拒绝之后的借用；使用中的读取器在归还时关闭 /
+        Close every idle reader and refuse later borrows; readers in use are closed when returned
+        """
+        with self._condition:
+            self._closed = True
+            stale = self._take_idle(lambda entry: True)
+            self._condition.notify_all()
+        self._stopped.set()
+        self._close_all(stale)
+    
+    def sweep(self) -> int:
+        """
+        立即关闭空闲超时的读取器 / Close the readers past their idle timeout now
+        
+        Returns:
+            int: 关闭的读取器数 / Number of readers closed
+        """
+        if self._idle_timeout is None:
+            return 0
+        deadline = time.monotonic() - self._idle_timeout
+        with self._condition:
+            stale = self._take_idle(lambda entry: entry.returned_at <= deadline)
+            if stale:
+                self._condition.notify_all()
+        self._close_all(stale)
+        return len(stale)
+    
+    def _acquire(self, path: Path, ctx: Optional[RequestContext]) -> Tuple[Any, int]:
+        """取出空闲读取器或占用一个新的名额 / Take an idle reader, or claim a slot for a new one"""
+        mtime_ns = _mtime_ns(path)
+        stale = []
+        found = None
+        with self._condition:
+            while True:
+                if self._closed:
+                    raise RuntimeError("reader pool is closed")
+                entries = self._idle.pop(path, [])
+                while entries and found is None:
+                    entry = entries.pop()
+                    if entry.mtime_ns == mtime_ns:
+                        found = entry.reader
+                    else:
+                        # 文件已被修改，旧的读取器作废
+                        stale.append(entry.reader)
+                        self._open -= 1
+                if entries:
+                    self._idle[path] = entries
+                if found is not None:
+                    break
+                if self._open >= self._max_open:
+                    # 已满时关闭最久未用的其他文件的空闲读取器，腾出名额
+                    oldest = self._oldest_idle()
+                    if oldest is not None:
+                        stale.append(self._idle[oldest].pop(0).reader)
+                        if not self._idle[oldest]:
+                            del self._idle[oldest]
+                        self._open -= 1
+                if self._open < self._max_open:
+                    self._open += 1
+                    break
+                if ctx is not None:
+                    ctx.check()
+                self._condition.wait(_WAIT_INTERVAL)
+        self._close_all(stale)
+        if found is not None:
+            return found, mtime_ns
+        
+        try:
+            reader = self._opener(path)
+        except BaseException:
+            with self._condition:
+                self._open -= 1
+                self._condition.notify_all()
+            raise
+        self._start_janitor()
+        return reader, mtime_ns
+    
+    def _release(self, path: Path, reader: Any, mtime_ns: int) -> None:
+        """归还读取器；池已关闭时关闭它 / Return a reader, closing it once the pool is closed"""
+        with self._condition:
+            if not self._closed:
+                self._idle.setdefault(path, []).append(_Idle(reader, mtime_ns, time.monotonic()))
+                self._condition.notify_all()
+                return
+            self._open -= 1
+            self._condition.notify_all()
+        self._close_all([reader])
+    
+    def _discard(self, reader: Any) -> None:
+        """关闭读取器并释放名额 / Close a reader and free its slot"""
+        with self._condition:
+            self._open -= 1
+            self._condition.notify_all()
+        self._close_all([reader])
+    
+    def _oldest_idle(self) -> Optional[Path]:
+        """空闲最久的读取器所在的路径 / Path holding the reader idle for the longest"""
+        oldest = None
+        for path, entries in self._idle.items():
+            if entries and (oldest is None or entries[0].returned_at < self._idle[oldest][0].returned_at):
+                oldest = path
+        return oldest
+    
+    def _take_idle(self, predicate: Callable[[_Idle], bool]) -> List[Any]:
+        """移出满足条件的空闲读取器，调用方持有锁 / Remove the idle readers matching predicate; caller holds the lock"""
+        taken = []
+        for path in list(self._idle):
+            kept = []
+            for entry in self._idle[path]:
+                (taken if predicate(entry) else kept).append(entry)
+            if kept:
+                self._idle[path] = kept
+            else:
+                del self._idle[path]
+        self._open -= len(taken)
+        return [entry.reader for entry in taken]
+    
+    def _close_all(self, readers: List[Any]) -> None:
+        for reader in readers:
+            try:
+                self._closer(reader)
+            except Exception as e:
+                self._logger.warning(f"关闭读取器失败: {e}")
+    
+    def _start_janitor(self) -> None:
+        """需要时启动关闭空闲读取器的后台线程 / Start the thread closing idle readers when needed"""
+        if self._idle_timeout is None:
+            return
+        with self._condition:
+            if self._janitor is not None or self._closed:
+                return
+            self._janitor = threading.Thread(target=self._run_janitor, name="reader-pool-janitor", daemon=True)
+            self._janitor.start()
+    
+    def _run_janitor(self) -> None:
+        # 没有打开的读取器或池已关闭时退出，下次打开读取器时重新启动
+        interval = max(self._idle_timeout / 2, _WAIT_INTERVAL)
+        while not self._stopped.wait(interval):
+            self.sweep()
+            with self._condition:
+                if self._open == 0:
+                    self._janitor = None
+                    return
+        with self._condition:
+            self._janitor = None
+
+
+def _mtime_ns(path: Path) -> int:
+    """文件的修改时间，文件不存在时为-1 / Modification time of a file, -1 when it is missing"""
+    try:
+        return path.stat().st_mtime_ns
+    except OSError:
+        return -1
+
+
+def _close_reader(reader: Any) -> None:
+    """调用读取器的close()方法（如果有） / Call the reader's close() when it has one"""
+    close = getattr(reader, "close", None)
+    if close is not None:
+        close()
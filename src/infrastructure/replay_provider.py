@@ -0,0 +1,191 @@
+"""
+回放数据提供者模块 / Replay Data Provider Module
+把历史K线按时间顺序重新推送，用于测试实时订阅和模拟盘逻辑
+Replays historical bars in time order, for testing live subscriptions and
+paper-trading logic
+"""
+
+import threading
+from typing import Dict, List, Optional, Tuple
+
+import pandas as pd
+
+from .data_provider import ALL_MARKET, DataProvider, FieldNotFoundError, InstrumentNotFoundError, match_market
+from .subscription import LiveBar, Subscription
+from ..utils.request_context import RequestContext
+
+
+class ReplayDataProvider(DataProvider):
+    """
+    回放数据提供者 / Replay data provider
+    
+    load_features()与普通提供者一样按区间返回数据；subscribe()按K线时间依次推送每一行。
+    每个标的的行按给定顺序回放：早于该标的已回放时间的行模拟迟到的K线，与已回放行
+    时间相同的行模拟数据源的修订，两者都以revised=True投递，与实时数据源的行为一致。
+    load_features() returns ranges like any provider, and subscribe() pushes
+    one row at a time in bar-time order. Each instrument's rows are replayed
+    in the order given: a row older than what was already replayed simulates
+    a late bar and a row repeating a replayed time simulates a source
+    revision, both delivered with revised=True as a live source would.
+    
+    Examples:
+        >>> provider = ReplayDataProvider({"SH600000": history}, freq="1min", speed=60)
+        >>> for bar in provider.subscribe(RequestContext(), ["SH600000"], ["$close"], "1min"):
+        ...     strategy.on_bar(bar)
+    """
+    
+    name = "replay"
+    
+    def __init__(
+        self,
+        frames: Dict[str, pd.DataFrame],
+        freq: str = "day",
+        speed: Optional[float] = None
+    ):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            frames: 标的代码到以时间为索引的历史数据的映射 / Instrument code to time-indexed history
+            freq: 数据的频率 / Frequency of the data
+            speed: 回放速度，市场时间与真实时间之比（如60表示真实1秒回放1分钟），
+                None表示不等待、尽快回放 / Replay speed as market time over wall time
+                (60 replays one minute per second); None replays as fast as possible
+        
+        Raises:
+            ValueError: speed不是正数时抛出 / Raised when speed is not positive
+        """
+        if speed is not None and speed <= 0:
+            raise ValueError(f"speed must be positive, got {speed}")
+        self._frames = {code: frame for code, frame in frames.items()}
+        self._freq = freq
+        self._speed = speed
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """回放数据的频率 / Frequency of the replayed data"""
+        return (self._freq,)
+    
+    @property
+    def speed(self) -> Optional[float]:
+        """回放速度 / Replay speed"""
+        return self._speed
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """
+        加载单个标的的历史数据，重复的时间保留最后一行 / Load an instrument's history, keeping the last row of a repeated time
+        
+        Raises:
+            InstrumentNotFoundError: 没有该标的时抛出 / Raised for an unknown instrument
+            FieldNotFoundError: 缺少字段时抛出 / Raised when a field is missing
+        """
+        frame = self._frames.get(instrument)
+        if frame is None:
+            raise InstrumentNotFoundError(instrument, self.name)
+        missing = [f for f in fields if f not in frame.columns]
+        if missing:
+            raise FieldNotFoundError(missing, [str(c) for c in frame.columns], instrument, self.name)
+        frame = frame[~frame.index.duplicated(keep="last")].sort_index()[list(fields)]
+        if start_time is not None:
+            frame = frame[frame.index >= pd.Timestamp(start_time)]
+        if end_time is not None:
+            frame = frame[frame.index <= pd.Timestamp(end_time)]
+        return frame
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """所有标的时间的并集 / Union of every instrument's timestamps"""
+        index = pd.DatetimeIndex([])
+        for frame in self._frames.values():
+            index = index.union(pd.DatetimeIndex(frame.index))
+        if start_time is not None:
+            index = index[index >= pd.Timestamp(start_time)]
+        if end_time is not None:
+            index = index[index <= pd.Timestamp(end_time)]
+        return list(index)
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """
+        回放数据的列 / Columns of the replayed data
+        
+        Raises:
+            InstrumentNotFoundError: 没有该标的时抛出 / Raised for an unknown instrument
+        """
+        frame = self._frames.get(instrument)
+        if frame is None:
+            raise InstrumentNotFoundError(instrument, self.name)
+        return sorted({str(column) for column in frame.columns})
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """回放数据中的标的，市场按交易所前缀匹配 / Replayed instruments; markets match on the exchange prefix"""
+        return sorted(code for code in self._frames if match_market(code, market))
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str = "1min"
+    ) -> Subscription:
+        """
+        回放订阅标的的历史K线，回放结束后订阅关闭 / Replay the subscribed instruments' bars; the subscription closes when done
+        """
+        ctx.check()
+        self.check_freq(freq)
+        subscription = Subscription(ctx, instruments, fields, freq)
+        thread = threading.Thread(
+            target=self._replay, args=(subscription,), name="bar-replay", daemon=True
+        )
+        thread.start()
+        return subscription
+    
+    def _events(self, subscription: Subscription) -> List[Tuple[pd.Timestamp, str, pd.Timestamp, Dict[str, float]]]:
+        """
+        按到达时间排列的(到达时间, 标的, K线时间, 字段值) / (arrival, instrument, bar time, values) in arrival order
+        
+        一行的到达时间为该标的到这一行为止的最大K线时间，因此迟到和修订的行
+        紧跟在它们之前的最新K线之后推送
+        A row arrives at the latest bar time of its instrument so far, so late
+        and revised rows follow right after the newest bar before them
+        """
+        events = []
+        for code in subscription.instruments:
+            frame = self._frames.get(code)
+            if frame is None or frame.empty:
+                continue
+            frame = frame.reindex(columns=subscription.fields)
+            times = pd.DatetimeIndex(frame.index)
+            arrivals = pd.Series(times).cummax()
+            for arrival, time, row in zip(arrivals, times, frame.itertuples(index=False, name=None)):
+                values = {name: float(value) for name, value in zip(subscription.fields, row)}
+                events.append((arrival, code, time, values))
+        # 稳定排序，同一到达时间内保持标的的请求顺序和行顺序
+        events.sort(key=lambda event: event[0])
+        return events
+    
+    def _replay(self, subscription: Subscription) -> None:
+        try:
+            previous = None
+            for arrival, code, time, values in self._events(subscription):
+                if self._speed is not None and previous is not None and arrival > previous:
+                    delay = (arrival - previous).total_seconds() / self._speed
+                    if subscription.wait(delay):
+                        return
+                if subscription.closed:
+                    return
+                previous = arrival
+                subscription.publish(LiveBar(code, time, values))
+        except Exception as e:
+            subscription.close(e)
+        subscription.close()
@@ -0,0 +1,400 @@
+"""
+实时K线订阅模块 / Live Bar Subscription Module
+为模拟盘等实时场景按标的推送新K线，并对重复、迟到和修订的K线做统一处理
+Pushes new bars per instrument for live use such as paper trading, with
+uniform handling of duplicate, late and revised bars
+
+投递约定 / Delivery rules:
+    - 同一标的的K线按时间升序投递 / Bars of one instrument are delivered in ascending time order
+    - 时间和字段值都相同的K线只投递一次 / A bar with the same time and values is delivered once
+    - 已投递时间的K线字段值改变，或早于该标的最新已投递时间的K线，
+      以revised=True投递 / A bar whose values changed since it was delivered, or
+      that is older than the instrument's latest delivered bar, is delivered
+      with revised=True
+    - 请求上下文取消或超时后订阅关闭，已缓冲的K线仍可读取，之后迭代正常结束 /
+      Once the request context is done the subscription closes; buffered bars
+      can still be read and iteration then ends normally
+"""
+
+import math
+import queue
+import threading
+from collections import OrderedDict
+from dataclasses import dataclass, field
+from typing import Callable, Dict, Iterator, List, Optional, Tuple
+
+import pandas as pd
+
+from .logger_system import get_logger
+from ..utils.request_context import ContextCancelledError, RequestContext
+
+
+# 每个标的保留用于去重和识别修订的最近K线数
+DEFAULT_HISTORY = 1024
+
+# 队列中表示订阅已关闭的标记
+_CLOSED = object()
+
+
+@dataclass(frozen=True)
+class LiveBar:
+    """
+    实时K线 / Live bar
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        time: K线时间（结束时刻） / Bar time (end of the bar)
+        fields: 字段名到数值的映射，如{"$close": 10.2} / Field name to value, e.g. {"$close": 10.2}
+        revised: 是否为迟到或修订的K线 / Whether the bar is late or revised
+    """
+    instrument: str
+    time: pd.Timestamp
+    fields: Dict[str, float] = field(default_factory=dict)
+    revised: bool = False
+    
+    def __getitem__(self, name: str) -> float:
+        return self.fields[name]
+
+
+def _same_values(a: Dict[str, float], b: Dict[str, float]) -> bool:
+    """比较字段值，两个NaN视为相等 / Compare field values, treating two NaNs as equal"""
+    if a.keys() != b.keys():
+        return False
+    for key, value in a.items():
+        other = b[key]
+        if value != other and not (math.isnan(value) and math.isnan(other)):
+            return False
+    return True
+
+
+class Subscription:
+    """
+    K线订阅 / Bar subscription
+    
+    类似通道：生产者（提供者的后台线程）调用publish()，消费者迭代订阅或调用next()。
+    Works like a channel: the producer (a provider's background thread) calls
+    publish() and consumers iterate the subscription or call next().
+    
+    Examples:
+        >>> ctx = RequestContext()
+        >>> subscription = provider.subscribe(ctx, ["SH600000"], ["$close"], "1min")
+        >>> for bar in subscription:
+        ...     if bar.revised:
+        ...         recompute(bar)
+        >>> ctx.cancel()  # 在其他线程中结束订阅 / end the subscription from another thread
+    """
+    
+    def __init__(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str,
+        history: int = DEFAULT_HISTORY
+    ):
+        """
+        初始化订阅 / Initialize subscription
+        
+        Args:
+            ctx: 请求上下文，取消或超时时关闭订阅 / Request context; the subscription closes when it is done
+            instruments: 标的代码列表 / Instrument codes
+            fields: 字段列表 / Field list
+            freq: 数据频率 / Data frequency
+            history: 每个标的保留的最近K线数 / Recent bars kept per instrument
+        
+        Raises:
+            ValueError: history不是正数时抛出 / Raised when history is not positive
+        """
+        if history < 1:
+            raise ValueError(f"history must be >= 1, got {history}")
+        self._ctx = ctx
+        self._instruments = list(dict.fromkeys(instruments))
+        self._fields = list(fields)
+        self._freq = freq
+        self._history = history
+        self._queue: "queue.Queue" = queue.Queue()
+        self._lock = threading.Lock()
+        self._closed = threading.Event()
+        self._drained = False
+        self._error: Optional[Exception] = None
+        self._seen: Dict[str, "OrderedDict[pd.Timestamp, Dict[str, float]]"] = {
+            code: OrderedDict() for code in self._instruments
+        }
+        self._latest: Dict[str, pd.Timestamp] = {}
+        self._logger = get_logger(__name__)
+        ctx.on_cancel(self.close)
+    
+    @property
+    def context(self) -> RequestContext:
+        """请求上下文 / Request context"""
+        return self._ctx
+    
+    @property
+    def instruments(self) -> List[str]:
+        """订阅的标的 / Subscribed instruments"""
+        return list(self._instruments)
+    
+    @property
+    def fields(self) -> List[str]:
+        """订阅的字段 / Subscribed fields"""
+        return list(self._fields)
+    
+    @property
+    def freq(self) -> str:
+        """数据频率 / Data frequency"""
+        return self._freq
+    
+    @property
+    def closed(self) -> bool:
+        """是否已关闭 / Whether the subscription is closed"""
+        return self._closed.is_set()
+    
+    @property
+    def error(self) -> Optional[Exception]:
+        """生产者因错误结束时的错误 / Error the producer stopped with, if any"""
+        return self._error
+    
+    def publish(self, bar: LiveBar) -> bool:
+        """
+        投递一根K线 / Deliver a bar
+        
+        由提供者调用。重复的K线被丢弃；修订或迟到的K线标记revised后投递。
+        Called by providers. Duplicates are dropped; revised or late bars are
+        delivered with revised set.
+        
+        Args:
+            bar: K线 / Bar
+        
+        Returns:
+            bool: 已投递返回True，重复、未订阅的标的或订阅已关闭时返回False /
+                True when delivered; False for a duplicate, an unsubscribed
+                instrument or a closed subscription
+        """
+        with self._lock:
+            if self.closed or bar.instrument not in self._seen:
+                return False
+            seen = self._seen[bar.instrument]
+            previous = seen.get(bar.time)
+            if previous is not None and _same_values(previous, bar.fields):
+                return False
+            
+            latest = self._latest.get(bar.instrument)
+            revised = bar.revised or previous is not None or (latest is not None and bar.time < latest)
+            if revised and not bar.revised:
+                bar = LiveBar(bar.instrument, bar.time, dict(bar.fields), revised=True)
+            
+            seen[bar.time] = dict(bar.fields)
+            seen.move_to_end(bar.time)
+            while len(seen) > self._history:
+                seen.popitem(last=False)
+            if latest is None or bar.time > latest:
+                self._latest[bar.instrument] = bar.time
+            self._queue.put(bar)
+        return True
+    
+    def publish_frame(self, instrument: str, frame: Optional[pd.DataFrame]) -> int:
+        """
+        按时间升序投递一个标的的多根K线 / Deliver an instrument's bars in ascending time order
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            frame: 以时间为索引的数据，缺少的订阅字段为NaN /
+                Time-indexed data; subscribed fields it lacks are NaN
+        
+        Returns:
+            int: 实际投递的K线数 / Number of bars delivered
+        """
+        if frame is None or frame.empty:
+            return 0
+        frame = frame.reindex(columns=self._fields).sort_index(kind="stable")
+        delivered = 0
+        for time, row in zip(frame.index, frame.itertuples(index=False, name=None)):
+            values = {name: float(value) for name, value in zip(self._fields, row)}
+            delivered += self.publish(LiveBar(instrument, pd.Timestamp(time), values))
+        return delivered
+    
+    def close(self, error: Optional[Exception] = None) -> None:
+        """
+        关闭订阅，重复调用无效 / Close the subscription; later calls have no effect
+        
+        Args:
+            error: 生产者出错结束时传入的错误 / Error when the producer stops on a failure
+        """
+        with self._lock:
+            if self.closed:
+                return
+            if error is not None and not isinstance(error, ContextCancelledError):
+                self._error = error
+            self._closed.set()
+            self._queue.put(_CLOSED)
+        if error is not None:
+            self._logger.warning(f"K线订阅因错误关闭: {error}")
+        else:
+            self._logger.debug(f"K线订阅已关闭 - 标的: {self._instruments}")
+    
+    def wait(self, timeout: Optional[float] = None) -> bool:
+        """
+        等待订阅关闭，供生产者在两次推送之间休眠 / Wait for the subscription to close, for producers sleeping between pushes
+        
+        Args:
+            timeout: 最长等待秒数 / Maximum seconds to wait
+        
+        Returns:
+            bool: 已关闭返回True / True once closed
+        """
+        remaining = self._ctx.remaining()
+        if remaining is not None:
+            timeout = remaining if timeout is None else min(timeout, remaining)
+        self._closed.wait(timeout)
+        if self._ctx.cancelled:
+            self.close()
+        return self.closed
+    
+    def next(self, timeout: Optional[float] = None) -> Tuple[Optional[LiveBar], bool]:
+        """
+        获取下一根K线 / Get the next bar
+        
+        Args:
+            timeout: 最长等待秒数，None表示一直等待 / Maximum seconds to wait, None blocks
+        
+        Returns:
+            Tuple[Optional[LiveBar], bool]: (K线, 是否仍然打开)；超时为(None, True)，
+                关闭且已读完为(None, False) / (bar, open); (None, True) on timeout and
+                (None, False) once closed and drained
+        """
+        if self._drained:
+            return None, False
+        try:
+            item = self._queue.get(timeout=timeout)
+        except queue.Empty:
+            return None, True
+        if item is _CLOSED:
+            self._drained = True
+            return None, False
+        return item, True
+    
+    def __iter__(self) -> Iterator[LiveBar]:
+        return self
+    
+    def __next__(self) -> LiveBar:
+        bar, ok = self.next()
+        if not ok:
+            raise StopIteration
+        return bar
+
+
+def bar_step(freq: str) -> pd.Timedelta:
+    """
+    单根K线的时长 / Duration of one bar
+    
+    Args:
+        freq: 数据频率，如"1min"、"day" / Data frequency, e.g. "1min" or "day"
+    
+    Returns:
+        pd.Timedelta: K线时长 / Bar duration
+    """
+    if freq == "day":
+        return pd.Timedelta(days=1)
+    return pd.Timedelta(minutes=int(freq[:-len("min")]))
+
+
+class PollingFeed:
+    """
+    轮询推送 / Polling feed
+    
+    在每个频率边界（如每分钟整点）之后稍作等待，读取最近revision_bars根K线并投递，
+    因此提供者在这段时间内修订的K线会以revised=True再次投递。加载失败只记录警告，
+    在下一个边界重试。
+    Shortly after each frequency boundary (e.g. every whole minute) the
+    latest revision_bars bars are loaded and published, so bars the provider
+    revises within that window are delivered again with revised=True. Load
+    failures are logged and retried at the next boundary.
+    """
+    
+    def __init__(
+        self,
+        loader: Callable[..., Optional[pd.DataFrame]],
+        subscription: Subscription,
+        delay: float = 1.0,
+        revision_bars: int = 2,
+        clock: Callable[[], pd.Timestamp] = pd.Timestamp.now
+    ):
+        """
+        初始化轮询 / Initialize feed
+        
+        Args:
+            loader: 与load_features_ctx参数相同的加载函数 / Loader taking load_features_ctx's arguments
+            subscription: 订阅 / Subscription
+            delay: 每个边界之后等待的秒数，留给数据源落盘 / Seconds to wait after each boundary for the source to publish
+            revision_bars: 每次读取的最近K线数 / Recent bars read on every poll
+            clock: 当前时间，与提供者的时间戳使用同一时区 /
+                Current time, in the same timezone as the provider's timestamps
+        """
+        if revision_bars < 1:
+            raise ValueError(f"revision_bars must be >= 1, got {revision_bars}")
+        self._loader = loader
+        self._subscription = subscription
+        self._delay = delay
+        self._revision_bars = revision_bars
+        self._clock = clock
+        self._step = bar_step(subscription.freq)
+        self._logger = get_logger(__name__)
+        self._thread = threading.Thread(target=self._run, name="bar-polling-feed", daemon=True)
+    
+    def start(self) -> Subscription:
+        """
+        启动后台线程 / Start the background thread
+        
+        Returns:
+            Subscription: 被推送的订阅 / The subscription being fed
+        """
+        self._thread.start()
+        return self._subscription
+    
+    def poll(self, now: pd.Timestamp) -> int:
+        """
+        读取并投递now之前已经结束的最近K线 / Load and publish the latest bars that ended by now
+        
+        Args:
+            now: 当前时间 / Current time
+        
+        Returns:
+            int: 投递的K线数 / Number of bars delivered
+        """
+        subscription = self._subscription
+        start = now - self._step * self._revision_bars
+        delivered = 0
+        for code in subscription.instruments:
+            try:
+                frame = self._loader(
+                    subscription.context, code, subscription.fields,
+                    start_time=start, end_time=now, freq=subscription.freq
+                )
+            except ContextCancelledError:
+                raise
+            except Exception as e:
+                self._logger.warning(f"标的 {code} 轮询失败，将在下一个边界重试: {str(e)}")
+                continue
+            if frame is not None and not frame.empty:
+                frame = frame[frame.index <= now]
+            delivered += subscription.publish_frame(code, frame)
+        return delivered
+    
+    def _run(self) -> None:
+        subscription = self._subscription
+        try:
+            while not subscription.closed:
+                now = self._clock()
+                if self._step >= pd.Timedelta(days=1):
+                    boundary = now.normalize() + self._step
+                else:
+                    boundary = now.floor(self._step) + self._step
+                wait = (boundary - now).total_seconds() + self._delay
+                if subscription.wait(wait):
+                    break
+                self.poll(self._clock())
+        except ContextCancelledError:
+            pass
+        except Exception as e:
+            subscription.close(e)
+        subscription.close()
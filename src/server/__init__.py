@@ -0,0 +1,23 @@
+"""
+Server Module / 服务模块
+
+This module serves feature data over HTTP and gRPC, and shares a data
+provider with remote workers over gRPC.
+本模块通过HTTP和gRPC提供特征数据服务，并通过gRPC把数据提供者共享给远程机器。
+"""
+
+from .feature_server import FeatureServer, frame_to_json, listen_and_serve
+from .grpc_server import FeatureServicer, create_grpc_server, grpc_protos, listen_and_serve_grpc
+from .frame_codec import FrameCodecError, decode_frame, encode_frame
+from .data_service import DataServicer, create_data_server, listen_and_serve_data
+from .grpc_client import DataServiceError, DataServiceUnavailableError, GRPCProvider
+from .health import HealthMonitor, WarmupProbe
+
+__all__ = [
+    'FeatureServer', 'frame_to_json', 'listen_and_serve',
+    'FeatureServicer', 'create_grpc_server', 'grpc_protos', 'listen_and_serve_grpc',
+    'FrameCodecError', 'decode_frame', 'encode_frame',
+    'DataServicer', 'create_data_server', 'listen_and_serve_data',
+    'DataServiceError', 'DataServiceUnavailableError', 'GRPCProvider',
+    'HealthMonitor', 'WarmupProbe'
+]
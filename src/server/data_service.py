@@ -0,0 +1,264 @@
+"""
+数据提供者gRPC服务模块 / Data Provider gRPC Server Module
+实现protos/data.proto中的DataService，把一个数据提供者共享给其他机器上的GRPCProvider
+Implements DataService from protos/data.proto, sharing one data provider with
+GRPCProvider clients on other machines
+
+与FeatureService不同，DataService不经过DataManager，不计算表达式也不缓存，只是把提供者
+接口原样搬到网络上；客户端的DataManager照常处理表达式、缓存和对齐。
+Unlike FeatureService, DataService bypasses DataManager: it evaluates no
+expressions and caches nothing, carrying the provider interface over the
+network as is, while the client's DataManager handles expressions, caching
+and alignment as usual.
+
+提供者抛出的数据错误以对应的状态码返回，错误码和出错的标的放在尾部元数据error-code和
+instrument中，客户端据此还原为同类错误。同时处理的请求超过max_concurrent_requests时，
+新请求立即以RESOURCE_EXHAUSTED失败；一个订阅在存续期间一直占用一个名额。
+Data errors raised by the provider map to matching status codes with the
+error code and failing instrument in the error-code and instrument trailing
+metadata, so the client can raise the same kind of error. Past
+max_concurrent_requests in flight, new RPCs fail at once with
+RESOURCE_EXHAUSTED; a subscription holds its slot for as long as it stays open.
+
+依赖grpcio和grpcio-tools，zstd压缩需要zstandard / Requires grpcio and grpcio-tools; zstd needs zstandard
+"""
+
+from concurrent.futures import ThreadPoolExecutor
+from typing import Any, Callable, Iterator, Optional, Tuple
+
+import pandas as pd
+
+from ..infrastructure.data_provider import ALL_MARKET, DataProvider
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import QlibTradingError
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from .frame_codec import COMPRESSION_NONE, COMPRESSION_ZSTD, ZSTD_AVAILABLE, encode_frame
+from .grpc_server import _cancelled_status, _request_context, grpc, grpc_protos
+
+
+DATA_PROTO_FILE = "data.proto"
+
+# 携带错误码和出错标的的尾部元数据键 / Trailing metadata keys carrying the error code and failing instrument
+ERROR_CODE_KEY = "error-code"
+INSTRUMENT_KEY = "instrument"
+
+# 数据帧可能超过gRPC默认的4MB消息上限 / Frames can exceed gRPC's default 4MB message limit
+MESSAGE_OPTIONS = [
+    ("grpc.max_send_message_length", -1),
+    ("grpc.max_receive_message_length", -1),
+]
+
+# 错误码到状态码名称的映射，其余错误为INTERNAL
+_STATUS_BY_CODE = {
+    "DAT0020": "INVALID_ARGUMENT",  # 不支持的频率
+    "DAT0026": "UNIMPLEMENTED",  # 没有基本面数据
+    "DAT0028": "UNIMPLEMENTED",  # 不能列出字段或标的
+    "DAT0029": "NOT_FOUND",  # 标的不存在
+    "DAT0030": "NOT_FOUND",  # 字段不存在
+    "DAT0031": "UNIMPLEMENTED",  # 没有除权除息数据
+}
+
+
+def _time(value: str) -> Optional[str]:
+    return value or None
+
+
+class DataServicer:
+    """
+    DataService的实现 / DataService implementation
+    
+    Examples:
+        >>> server, port = create_data_server("0.0.0.0:50052", CSVDataProvider("./data"), max_concurrent_requests=16)
+        >>> server.start()
+    """
+    
+    def __init__(self, provider: DataProvider):
+        """
+        初始化服务 / Initialize servicer
+        
+        Args:
+            provider: 共享的数据提供者 / Data provider to share
+        """
+        self._provider = provider
+        self._protos, _ = grpc_protos(DATA_PROTO_FILE)
+        self._logger = get_logger(__name__)
+    
+    def Describe(self, request, context):
+        provider = self._provider
+        return self._protos.ProviderInfo(
+            name=provider.name, freqs=list(provider.freqs), adjusted_prices=provider.adjusted_prices
+        )
+    
+    def Features(self, request, context):
+        def load(ctx: RequestContext):
+            freq = request.freq or "day"
+            self._provider.check_freq(freq)
+            compression = self._compression(request.compression)
+            frames = []
+            for instrument in request.instruments:
+                frame = self._provider.load_features_ctx(
+                    ctx, instrument, list(request.fields),
+                    start_time=_time(request.start), end_time=_time(request.end), freq=freq
+                )
+                frames.append(self._protos.Frame(instrument=instrument, data=encode_frame(frame, compression)))
+            return self._protos.FramesResponse(frames=frames)
+        return self._call(context, "Features", load)
+    
+    def Calendar(self, request, context):
+        def load(ctx: RequestContext):
+            calendar = self._provider.calendar_ctx(
+                ctx, start_time=_time(request.start), end_time=_time(request.end), freq=request.freq or "day"
+            )
+            frame = pd.DataFrame(index=pd.DatetimeIndex(calendar))
+            return self._protos.Frame(data=encode_frame(frame, self._compression(request.compression)))
+        return self._call(context, "Calendar", load)
+    
+    def Fundamentals(self, request, context):
+        def load(ctx: RequestContext):
+            records = self._provider.fundamentals_ctx(
+                ctx, list(request.instruments), list(request.fields),
+                start_time=_time(request.start), end_time=_time(request.end)
+            )
+            compression = self._compression(request.compression)
+            return self._protos.FramesResponse(frames=[
+                self._protos.Frame(instrument=instrument, data=encode_frame(frame, compression))
+                for instrument, frame in records.items()
+            ])
+        return self._call(context, "Fundamentals", load)
+    
+    def Adjustments(self, request, context):
+        def load(ctx: RequestContext):
+            ctx.check()
+            frame = self._provider.adjustments(
+                request.instrument, start_time=_time(request.start), end_time=_time(request.end)
+            )
+            return self._protos.Frame(
+                instrument=request.instrument, data=encode_frame(frame, self._compression(request.compression))
+            )
+        return self._call(context, "Adjustments", load)
+    
+    def ListFields(self, request, context):
+        return self._call(context, "ListFields", lambda ctx: self._protos.NamesResponse(
+            names=self._provider.list_fields(request.instrument, freq=request.freq or "day")
+        ))
+    
+    def ListInstruments(self, request, context):
+        return self._call(context, "ListInstruments", lambda ctx: self._protos.NamesResponse(
+            names=self._provider.list_instruments(request.market or ALL_MARKET, freq=request.freq or "day")
+        ))
+    
+    def Subscribe(self, request, context) -> Iterator[Any]:
+        """
+        推送实时K线 / Push live bars
+        
+        客户端取消或断开时RPC结束，请求上下文随之取消并关闭提供者的订阅
+        A client cancel or disconnect ends the RPC, which cancels the request
+        context and with it closes the provider's subscription
+        """
+        subscription = self._call(context, "Subscribe", lambda ctx: self._provider.subscribe(
+            ctx, list(request.instruments), list(request.fields), request.freq or "1min"
+        ))
+        for bar in subscription:
+            yield self._protos.Bar(
+                instrument=bar.instrument, time=bar.time.isoformat(), values=bar.fields, revised=bar.revised
+            )
+        if subscription.error is not None:
+            self._abort(context, "Subscribe", subscription.error)
+    
+    def _compression(self, value: int) -> str:
+        """服务端没有zstandard时退回不压缩 / Fall back to none when the server lacks zstandard"""
+        if value == self._protos.COMPRESSION_ZSTD and ZSTD_AVAILABLE:
+            return COMPRESSION_ZSTD
+        return COMPRESSION_NONE
+    
+    def _call(self, context, method: str, fn: Callable[[RequestContext], Any]) -> Any:
+        ctx = _request_context(context)
+        try:
+            return fn(ctx)
+        except Exception as e:
+            self._abort(context, method, e)
+    
+    def _abort(self, context, method: str, error: Exception) -> None:
+        """以错误对应的状态码结束RPC，总是抛出异常 / End the RPC with the error's status code; always raises"""
+        if isinstance(error, ContextCancelledError):
+            context.abort(*_cancelled_status(error))
+        if isinstance(error, QlibTradingError):
+            code = error.error_info.error_code
+            status = _STATUS_BY_CODE.get(code)
+            if status is None:
+                self._logger.error(f"数据服务请求失败 - 方法: {method}, 错误码: {code}: {str(error)}")
+            metadata = [(ERROR_CODE_KEY, code)]
+            if getattr(error, "instrument", None):
+                metadata.append((INSTRUMENT_KEY, error.instrument))
+            context.set_trailing_metadata(tuple(metadata))
+            context.abort(getattr(grpc.StatusCode, status or "INTERNAL"), error.error_info.error_message_en)
+        self._logger.error(f"数据服务请求失败 - 方法: {method}: {str(error)}")
+        context.abort(grpc.StatusCode.INTERNAL, str(error))
+
+
+def create_data_server(
+    address: str,
+    provider: DataProvider,
+    max_workers: int = 8,
+    max_concurrent_requests: Optional[int] = None
+) -> Tuple[Any, int]:
+    """
+    创建已注册DataService、尚未启动的gRPC服务 / Create a gRPC server with DataService registered, not yet started
+    
+    Args:
+        address: 监听地址，如"0.0.0.0:50052"，端口为0时由系统分配 /
+            Listen address such as "0.0.0.0:50052"; port 0 lets the system pick one
+        provider: 共享的数据提供者 / Data provider to share
+        max_workers: 处理请求的线程数 / Worker threads handling requests
+        max_concurrent_requests: 同时处理的请求上限，超出时返回RESOURCE_EXHAUSTED，None表示不限 /
+            Cap on RPCs in flight, beyond which calls get RESOURCE_EXHAUSTED; None for no cap
+    
+    Returns:
+        Tuple[grpc.Server, int]: (服务, 实际监听端口) / (server, bound port)
+    
+    Raises:
+        ValueError: max_concurrent_requests不是正数时抛出 / Raised when max_concurrent_requests is not positive
+        SystemError: grpcio或grpcio-tools未安装时抛出 / Raised when grpcio or grpcio-tools is missing
+    """
+    if max_concurrent_requests is not None and max_concurrent_requests < 1:
+        raise ValueError(f"max_concurrent_requests must be >= 1, got {max_concurrent_requests}")
+    _, services = grpc_protos(DATA_PROTO_FILE)
+    server = grpc.server(
+        ThreadPoolExecutor(max_workers=max_workers),
+        options=MESSAGE_OPTIONS,
+        maximum_concurrent_rpcs=max_concurrent_requests
+    )
+    services.add_DataServiceServicer_to_server(DataServicer(provider), server)
+    port = server.add_insecure_port(address)
+    return server, port
+
+
+def listen_and_serve_data(
+    address: str,
+    provider: DataProvider,
+    ctx: Optional[RequestContext] = None,
+    grace: float = 5.0,
+    max_workers: int = 8,
+    max_concurrent_requests: Optional[int] = None
+) -> None:
+    """
+    在address上提供数据服务，直到ctx取消或超时 / Serve DataService on address until ctx is done
+    
+    Args:
+        address: 监听地址 / Listen address
+        provider: 共享的数据提供者 / Data provider to share
+        ctx: 控制服务生命周期的上下文，None表示一直运行 / Context controlling the server's lifetime, None runs forever
+        grace: 关闭时等待正在处理的请求的秒数 / Seconds in-flight RPCs get at shutdown
+        max_workers: 处理请求的线程数 / Worker threads handling requests
+        max_concurrent_requests: 同时处理的请求上限，None表示不限 / Cap on RPCs in flight, None for no cap
+    """
+    logger = get_logger(__name__)
+    ctx = ctx or background()
+    server, port = create_data_server(address, provider, max_workers, max_concurrent_requests)
+    server.start()
+    logger.info(f"数据提供者gRPC服务已启动, 提供者: {provider.name}, 端口: {port}")
+    try:
+        ctx.wait()
+    finally:
+        server.stop(grace).wait()
+        logger.info(f"数据提供者gRPC服务已关闭, 端口: {port}")
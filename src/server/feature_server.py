@@ -0,0 +1,356 @@
+"""
+特征数据HTTP服务模块 / Feature HTTP Server Module
+通过REST接口以JSON提供特征数据，供Notebook或网页前端直接查询
+Serves feature data as JSON over REST, so notebooks and web front ends can
+query it directly
+    
+    GET /features?instruments=SH000300,SH000905&fields=$close,$volume&start=2025-01-01&end=2025-06-30
+
+返回以标的代码为键的JSON，缺失值为null / Returns JSON keyed by instrument code, with null for missing values:
+    
+    {"SH000300": {"dates": ["2025-01-02", ...], "columns": {"$close": [3820.1, ...], "$volume": [...]}}}
+
+参数 / Parameters:
+    instruments: 逗号分隔的标的代码，必填 / Comma-separated instrument codes, required
+    fields: 逗号分隔的字段或表达式，必填；表达式内部的逗号不会被拆分，也可以重复该参数 /
+        Comma-separated fields or expressions, required; commas inside an
+        expression are not split, and the parameter may also be repeated
+    start, end: 开始和结束时间，可选，"2025-01-01"或带偏移的RFC3339时间如"2025-01-01T09:30:00+08:00" /
+        Start and end time, optional; "2025-01-01" or RFC3339 with an offset
+        such as "2025-01-01T09:30:00+08:00"
+    freq: 数据频率，默认为"day" / Data frequency, "day" by default
+
+参数错误返回400，未知标的返回404，响应体为{"error": "..."}形式的说明。
+Bad parameters return 400 and unknown instruments 404, with an
+{"error": "..."} body describing the problem.
+
+负载均衡使用GET /healthz（数据提供者可用时返回200）和GET /readyz（另外要求预热查询已经成功），
+不可用时返回503，见server.health。
+Load balancers use GET /healthz (200 while the data provider is healthy)
+and GET /readyz (which also requires the warm-up query to have succeeded);
+both return 503 otherwise, see server.health.
+"""
+
+import json
+import math
+import threading
+from http import HTTPStatus
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from typing import Any, Dict, List, Optional, Tuple, Union
+from urllib.parse import parse_qs, urlsplit
+
+import pandas as pd
+
+from ..core.data_manager import DataManager
+from ..core.expression_engine import ExpressionError
+from ..core.request_time import RequestTimeError, parse_request_range
+from ..infrastructure.data_provider import DataProvider, SUPPORTED_FREQS, UnsupportedFrequencyError
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import QlibTradingError
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from .health import DEFAULT_HEALTH_TIMEOUT, HEALTH_PATH, READY_PATH, HealthMonitor, WarmupProbe
+
+
+FEATURES_PATH = "/features"
+
+# 单个请求的默认超时秒数
+DEFAULT_REQUEST_TIMEOUT = 30.0
+
+# 表示标的不存在或区间内没有数据的错误码
+NOT_FOUND_CODES = ("DAT0010", "DAT0029")
+
+_PARAMETERS = ("instruments", "fields", "start", "end", "freq")
+
+Address = Union[str, Tuple[str, int]]
+
+
+class _BadRequest(ValueError):
+    """请求参数错误 / Invalid request parameters"""
+
+
+def _parse_address(address: Address) -> Tuple[str, int]:
+    """把"host:port"解析为(host, port)，host为空表示监听所有地址 / Parse "host:port"; an empty host listens on all addresses"""
+    if isinstance(address, tuple):
+        return address
+    host, sep, port = address.rpartition(":")
+    if not sep or not port.isdigit():
+        raise ValueError(f"address must look like 'host:port', got {address!r}")
+    return host, int(port)
+
+
+def _split_top_level(text: str) -> List[str]:
+    """按括号外的逗号拆分，表达式参数中的逗号保留 / Split on commas outside parentheses, keeping those in expression arguments"""
+    parts, depth, current = [], 0, []
+    for ch in text:
+        if ch == "," and depth == 0:
+            parts.append("".join(current))
+            current = []
+            continue
+        if ch == "(":
+            depth += 1
+        elif ch == ")":
+            depth -= 1
+        current.append(ch)
+    parts.append("".join(current))
+    return [part.strip() for part in parts if part.strip()]
+
+
+def _list_param(params: Dict[str, List[str]], name: str) -> List[str]:
+    items = []
+    for value in params.get(name, []):
+        items.extend(_split_top_level(value))
+    if not items:
+        raise _BadRequest(f"missing required parameter: {name}")
+    return list(dict.fromkeys(items))
+
+
+def _single_param(params: Dict[str, List[str]], name: str) -> Optional[str]:
+    values = params.get(name)
+    if not values:
+        return None
+    if len(values) > 1:
+        raise _BadRequest(f"parameter {name} given more than once")
+    return values[0].strip() or None
+
+
+def _error_body(error: Exception) -> Dict[str, Any]:
+    """英文错误说明，系统错误附带错误码和详情 / English error description, with code and details for system errors"""
+    if isinstance(error, QlibTradingError):
+        info = error.error_info
+        body = {"error": info.error_message_en, "code": info.error_code}
+        if info.technical_details:
+            body["details"] = info.technical_details
+        return body
+    return {"error": str(error)}
+
+
+def _error_code(error: Exception) -> Optional[str]:
+    if isinstance(error, QlibTradingError):
+        return error.error_info.error_code
+    return None
+
+
+def _json_value(value: Any) -> Any:
+    """NaN和无穷转为null / NaN and infinities become null"""
+    if isinstance(value, float) and not math.isfinite(value):
+        return None
+    return value
+
+
+def frame_to_json(frame: pd.DataFrame, fields: List[str], freq: str = "day") -> Dict[str, Any]:
+    """
+    把单个标的的数据转为JSON对象 / Convert one instrument's data to a JSON object
+    
+    Args:
+        frame: 以时间为索引的数据 / Time-indexed data
+        fields: 输出的列 / Columns to output
+        freq: 数据频率，日频的日期不带时间 / Data frequency; daily dates carry no time of day
+    
+    Returns:
+        Dict[str, Any]: {"dates": [...], "columns": {field: [...]}}
+    """
+    index = pd.DatetimeIndex(frame.index)
+    if freq == "day":
+        dates = [ts.strftime("%Y-%m-%d") for ts in index]
+    else:
+        dates = [ts.isoformat() for ts in index]
+    columns = {
+        field: [_json_value(value) for value in frame[field].tolist()]
+        for field in fields
+    }
+    return {"dates": dates, "columns": columns}
+
+
+class _FeatureHandler(BaseHTTPRequestHandler):
+    """
+    把GET请求转给FeatureServer.query() / Forwards GET requests to FeatureServer.query()
+    
+    使用默认的HTTP/1.0，每个响应后关闭连接，关闭服务时不会被空闲的长连接阻塞
+    Keeps the default HTTP/1.0 so every connection closes after its response
+    and shutdown is never held up by idle keep-alive connections
+    """
+    
+    def do_GET(self) -> None:
+        url = urlsplit(self.path)
+        path = url.path.rstrip("/")
+        if path in (HEALTH_PATH, READY_PATH):
+            ok, body = self.server.health.health() if path == HEALTH_PATH else self.server.health.readiness()
+            self._send_json(HTTPStatus.OK if ok else HTTPStatus.SERVICE_UNAVAILABLE, body)
+            return
+        if path != FEATURES_PATH:
+            self._send_json(HTTPStatus.NOT_FOUND, {"error": f"unknown path: {url.path}"})
+            return
+        status, body = self.server.query(parse_qs(url.query, keep_blank_values=True))
+        self._send_json(status, body)
+    
+    def _send_json(self, status: HTTPStatus, body: Dict[str, Any]) -> None:
+        payload = json.dumps(body, ensure_ascii=False, allow_nan=False).encode("utf-8")
+        self.send_response(status)
+        self.send_header("Content-Type", "application/json; charset=utf-8")
+        self.send_header("Content-Length", str(len(payload)))
+        self.end_headers()
+        self.wfile.write(payload)
+    
+    def log_message(self, format: str, *args: Any) -> None:
+        self.server.logger.debug(f"{self.address_string()} {format % args}")
+
+
+class FeatureServer(ThreadingHTTPServer):
+    """
+    特征数据HTTP服务 / Feature data HTTP server
+    
+    每个请求在单独的线程中处理。关闭时不再接受新连接，并等待正在处理的请求完成。
+    Each request is handled on its own thread. Shutting down stops accepting
+    connections and waits for in-flight requests to finish.
+    
+    Examples:
+        >>> server = FeatureServer("127.0.0.1:8080", CSVDataProvider("./data"))
+        >>> ctx = RequestContext()
+        >>> threading.Thread(target=server.serve, args=(ctx,)).start()
+        >>> ctx.cancel()  # 优雅关闭 / graceful shutdown
+    """
+    
+    # 跟踪请求线程，server_close()时等待它们结束
+    daemon_threads = False
+    block_on_close = True
+    
+    def __init__(
+        self,
+        address: Address,
+        provider: Optional[DataProvider] = None,
+        manager: Optional[DataManager] = None,
+        request_timeout: Optional[float] = DEFAULT_REQUEST_TIMEOUT,
+        warmup: Optional[WarmupProbe] = None,
+        health_timeout: Optional[float] = DEFAULT_HEALTH_TIMEOUT
+    ):
+        """
+        初始化服务并绑定地址 / Initialize the server and bind the address
+        
+        Args:
+            address: 监听地址，如"127.0.0.1:8080"，端口为0时由系统分配 /
+                Listen address such as "127.0.0.1:8080"; port 0 lets the system pick one
+            provider: 数据提供者，None表示使用管理器的默认提供者 / Data provider, None uses the manager's default
+            manager: 数据管理器，None表示新建 / Data manager, None creates one
+            request_timeout: 单个请求的超时秒数，None表示不限 / Per-request timeout in seconds, None for no limit
+            warmup: serve()启动后运行的预热查询，None表示启动即就绪 /
+                Warm-up query run once serve() starts, None is ready at once
+            health_timeout: 单次健康检查的超时秒数 / Timeout of one health check in seconds
+        
+        Raises:
+            ValueError: 地址格式错误时抛出 / Raised when the address is malformed
+            OSError: 地址无法绑定时抛出 / Raised when the address cannot be bound
+        """
+        self._provider = provider
+        self._manager = manager or DataManager(provider=provider)
+        self._request_timeout = request_timeout
+        self.health = HealthMonitor(self._manager, provider, warmup, health_timeout)
+        self.logger = get_logger(__name__)
+        super().__init__(_parse_address(address), _FeatureHandler)
+    
+    @property
+    def address(self) -> str:
+        """实际监听的"host:port" / The "host:port" actually listened on"""
+        host, port = self.server_address[:2]
+        return f"{host}:{port}"
+    
+    def query(self, params: Dict[str, List[str]]) -> Tuple[HTTPStatus, Dict[str, Any]]:
+        """
+        处理一次特征查询 / Handle one feature query
+        
+        Args:
+            params: 解析后的查询参数，如parse_qs()的结果 / Parsed query parameters, as from parse_qs()
+        
+        Returns:
+            Tuple[HTTPStatus, Dict[str, Any]]: 状态码和JSON响应体 / Status code and JSON body
+        """
+        try:
+            unknown = sorted(set(params) - set(_PARAMETERS))
+            if unknown:
+                raise _BadRequest(f"unknown parameters: {', '.join(unknown)}")
+            instruments = _list_param(params, "instruments")
+            fields = _list_param(params, "fields")
+            start = _single_param(params, "start")
+            end = _single_param(params, "end")
+            freq = _single_param(params, "freq") or "day"
+            if freq not in SUPPORTED_FREQS:
+                raise _BadRequest(f"unsupported freq: {freq!r}, expected one of {', '.join(SUPPORTED_FREQS)}")
+            try:
+                parse_request_range(start, end, self._manager.timezone, start_field="start", end_field="end")
+            except RequestTimeError as e:
+                raise _BadRequest(str(e))
+        except _BadRequest as e:
+            return HTTPStatus.BAD_REQUEST, {"error": str(e)}
+        
+        ctx = RequestContext(timeout=self._request_timeout)
+        try:
+            result = self._manager.get_features_ctx(
+                ctx, instruments, fields,
+                start_time=start, end_time=end, freq=freq, provider=self._provider
+            )
+        except (ExpressionError, UnsupportedFrequencyError) as e:
+            return HTTPStatus.BAD_REQUEST, _error_body(e)
+        except ContextCancelledError:
+            return HTTPStatus.GATEWAY_TIMEOUT, {"error": f"request timed out after {self._request_timeout}s"}
+        except Exception as e:
+            self.logger.error(f"特征查询失败 - 标的: {instruments}, 字段: {fields}: {str(e)}")
+            return HTTPStatus.INTERNAL_SERVER_ERROR, _error_body(e)
+        
+        unknown_codes = [
+            code for code, error in result.errors.items() if _error_code(error) in NOT_FOUND_CODES
+        ]
+        if unknown_codes:
+            return HTTPStatus.NOT_FOUND, {
+                "error": f"unknown instruments or no data in range: {', '.join(unknown_codes)}",
+                "instruments": unknown_codes
+            }
+        if result.errors:
+            self.logger.error(f"特征查询部分失败 - 标的: {list(result.errors)}")
+            return HTTPStatus.INTERNAL_SERVER_ERROR, {
+                "error": "failed to load features",
+                "instruments": {code: _error_body(error) for code, error in result.errors.items()}
+            }
+        return HTTPStatus.OK, {code: frame_to_json(frame, fields, freq) for code, frame in result.items()}
+    
+    def serve(self, ctx: Optional[RequestContext] = None) -> None:
+        """
+        提供服务直到ctx取消或超时，然后优雅关闭 / Serve until ctx is done, then shut down gracefully
+        
+        Args:
+            ctx: 控制服务生命周期的上下文，None表示一直运行 / Context controlling the server's lifetime, None runs forever
+        """
+        ctx = ctx or background()
+        thread = threading.Thread(target=self.serve_forever, name="feature-server", daemon=True)
+        thread.start()
+        self.logger.info(f"特征数据服务已启动: http://{self.address}{FEATURES_PATH}")
+        self.health.start_warm_up()
+        try:
+            ctx.wait()
+        finally:
+            self.shutdown()
+            thread.join()
+            # 等待正在处理的请求完成
+            self.server_close()
+            self.logger.info(f"特征数据服务已关闭: {self.address}")
+
+
+def listen_and_serve(
+    address: Address,
+    provider: Optional[DataProvider] = None,
+    ctx: Optional[RequestContext] = None,
+    warmup: Optional[WarmupProbe] = None
+) -> None:
+    """
+    在address上提供特征数据服务，直到ctx取消或超时 / Serve feature data on address until ctx is done
+    
+    Args:
+        address: 监听地址，如"0.0.0.0:8080" / Listen address such as "0.0.0.0:8080"
+        provider: 数据提供者，None表示使用默认提供者 / Data provider, None uses the default
+        ctx: 控制服务生命周期的上下文，None表示一直运行 / Context controlling the server's lifetime, None runs forever
+        warmup: 启动后运行的预热查询，None表示不预热 / Warm-up query run after starting, None skips it
+    
+    Examples:
+        >>> ctx = RequestContext()
+        >>> signal.signal(signal.SIGTERM, lambda *_: ctx.cancel("SIGTERM"))
+        >>> listen_and_serve(":8080", CSVDataProvider("./data"), ctx)
+    """
+    FeatureServer(address, provider, warmup=warmup).serve(ctx)
@@ -0,0 +1,200 @@
+"""
+数据帧列式编码模块 / Columnar Frame Codec Module
+把DataFrame编码为紧凑的列式字节串，供gRPC数据服务传输
+Encodes DataFrames as compact columnar bytes for the gRPC data service
+
+格式 / Layout:
+    b"QTF1" | 标志字节 / flags byte | 正文 / body
+    正文 / body = 头部长度(uint32小端) / header length (uint32 LE) | JSON头部 / JSON header | 各列数据 / column buffers
+
+标志字节的最低位表示正文经过zstd压缩。头部记录行数、索引和各列的名称与类型；
+数值、布尔和时间列按小端原始数组依次存放（时间为纳秒整数，带时区的按UTC存放并在头部
+记录时区），其他类型的列按JSON列表存放在头部中，解码后为object列。
+The lowest bit of the flags byte marks a zstd-compressed body. The header
+records the row count, the index and each column's name and type; numeric,
+boolean and datetime columns follow as raw little-endian arrays in order
+(datetimes as nanosecond integers, tz-aware ones in UTC with the timezone in
+the header), while columns of any other type travel as JSON lists inside the
+header and decode as object columns.
+
+zstd压缩需要zstandard包 / zstd compression requires the zstandard package
+"""
+
+import json
+import struct
+from typing import Any, Dict, List, Optional, Tuple
+
+import numpy as np
+import pandas as pd
+
+try:
+    import zstandard
+    ZSTD_AVAILABLE = True
+except ImportError:
+    ZSTD_AVAILABLE = False
+    zstandard = None
+
+
+MAGIC = b"QTF1"
+
+# 压缩方式 / Compression modes
+COMPRESSION_NONE = "none"
+COMPRESSION_ZSTD = "zstd"
+COMPRESSIONS = (COMPRESSION_NONE, COMPRESSION_ZSTD)
+
+_FLAG_ZSTD = 0x01
+_HEADER_LENGTH = struct.Struct("<I")
+_DATETIME = "datetime64[ns]"
+_OBJECT = "object"
+
+
+class FrameCodecError(ValueError):
+    """数据帧无法编码或字节串无法解码 / A frame can't be encoded or bytes can't be decoded"""
+
+
+def _datetime_ns(values: Any) -> Tuple[np.ndarray, Optional[str]]:
+    """时间转换为纳秒整数和时区 / Datetimes as nanosecond integers and a timezone"""
+    index = pd.DatetimeIndex(values)
+    tz = None if index.tz is None else str(index.tz)
+    if tz is not None:
+        index = index.tz_convert("UTC").tz_localize(None)
+    return index.astype(_DATETIME).asi8, tz
+
+
+def _from_ns(values: np.ndarray, tz: Optional[str]) -> pd.DatetimeIndex:
+    index = pd.DatetimeIndex(values.view(_DATETIME))
+    return index if tz is None else index.tz_localize("UTC").tz_convert(tz)
+
+
+def _json_value(value: Any) -> Any:
+    """NA和NaT转换为None，numpy标量转换为Python标量 / NA and NaT become None, numpy scalars Python scalars"""
+    if value is pd.NA or value is pd.NaT:
+        return None
+    if isinstance(value, np.generic):
+        return value.item()
+    return value
+
+
+def _encode_values(name: Any, values: Any, buffers: List[bytes]) -> Dict[str, Any]:
+    """编码一列或索引，返回其头部描述 / Encode a column or the index and return its header entry"""
+    dtype = values.dtype
+    if pd.api.types.is_datetime64_any_dtype(dtype):
+        ns, tz = _datetime_ns(values)
+        buffers.append(ns.astype("<i8").tobytes())
+        return {"name": name, "dtype": _DATETIME, "tz": tz}
+    if isinstance(dtype, np.dtype) and dtype.kind in "biuf":
+        little = dtype.newbyteorder("<")
+        buffers.append(np.asarray(values).astype(little, copy=False).tobytes())
+        return {"name": name, "dtype": little.str}
+    try:
+        encoded = [_json_value(value) for value in values]
+        json.dumps(encoded)
+    except (TypeError, ValueError) as e:
+        raise FrameCodecError(f"column {name!r} of dtype {dtype} can't be encoded: {e}") from e
+    return {"name": name, "dtype": _OBJECT, "values": encoded}
+
+
+def encode_frame(frame: pd.DataFrame, compression: str = COMPRESSION_NONE, level: int = 3) -> bytes:
+    """
+    把DataFrame编码为字节串 / Encode a DataFrame as bytes
+    
+    Args:
+        frame: 数据帧 / Frame
+        compression: "none"或"zstd" / "none" or "zstd"
+        level: zstd压缩级别 / zstd compression level
+    
+    Returns:
+        bytes: 编码后的字节串 / Encoded bytes
+    
+    Raises:
+        FrameCodecError: 某列无法编码，或请求zstd压缩但zstandard未安装时抛出 /
+            Raised when a column can't be encoded, or zstd is requested without zstandard
+    """
+    if compression not in COMPRESSIONS:
+        raise FrameCodecError(f"unknown compression: {compression!r}, expected one of {', '.join(COMPRESSIONS)}")
+    if compression == COMPRESSION_ZSTD and not ZSTD_AVAILABLE:
+        raise FrameCodecError("zstd compression requires the zstandard package")
+    
+    buffers: List[bytes] = []
+    header = {
+        "rows": len(frame),
+        "index": _encode_values(frame.index.name, frame.index, buffers),
+        "columns": [_encode_values(name, frame.iloc[:, i], buffers) for i, name in enumerate(frame.columns)],
+    }
+    header_bytes = json.dumps(header, separators=(",", ":")).encode("utf-8")
+    body = _HEADER_LENGTH.pack(len(header_bytes)) + header_bytes + b"".join(buffers)
+    
+    flags = 0
+    if compression == COMPRESSION_ZSTD:
+        body = zstandard.ZstdCompressor(level=level).compress(body)
+        flags |= _FLAG_ZSTD
+    return MAGIC + bytes([flags]) + body
+
+
+def _decode_values(entry: Dict[str, Any], rows: int, body: memoryview, offset: int) -> Tuple[Any, int]:
+    """解码一列或索引，返回(数据, 新偏移) / Decode a column or the index, returning (values, new offset)"""
+    dtype = entry["dtype"]
+    if dtype == _OBJECT:
+        if len(entry["values"]) != rows:
+            raise FrameCodecError(f"column {entry['name']!r} has {len(entry['values'])} values, expected {rows}")
+        values = np.empty(rows, dtype=object)
+        values[:] = entry["values"]
+        return values, offset
+    numpy_dtype = np.dtype("<i8" if dtype == _DATETIME else dtype)
+    size = rows * numpy_dtype.itemsize
+    if offset + size > len(body):
+        raise FrameCodecError("truncated frame data")
+    values = np.frombuffer(body, dtype=numpy_dtype, count=rows, offset=offset).copy()
+    if dtype == _DATETIME:
+        return _from_ns(values, entry.get("tz")), offset + size
+    return values.astype(numpy_dtype.newbyteorder("="), copy=False), offset + size
+
+
+def decode_frame(data: bytes) -> pd.DataFrame:
+    """
+    把encode_frame()的结果解码为DataFrame / Decode the output of encode_frame() into a DataFrame
+    
+    Args:
+        data: 编码后的字节串 / Encoded bytes
+    
+    Returns:
+        pd.DataFrame: 数据帧 / Frame
+    
+    Raises:
+        FrameCodecError: 字节串格式错误，或经过zstd压缩但zstandard未安装时抛出 /
+            Raised for malformed bytes, or zstd-compressed bytes without zstandard
+    """
+    if len(data) < len(MAGIC) + 1 or data[:len(MAGIC)] != MAGIC:
+        raise FrameCodecError("not an encoded frame")
+    flags = data[len(MAGIC)]
+    body = data[len(MAGIC) + 1:]
+    if flags & _FLAG_ZSTD:
+        if not ZSTD_AVAILABLE:
+            raise FrameCodecError("frame is zstd-compressed but the zstandard package is not installed")
+        try:
+            body = zstandard.ZstdDecompressor().decompress(body)
+        except zstandard.ZstdError as e:
+            raise FrameCodecError(f"corrupt zstd frame: {e}") from e
+    
+    try:
+        (length,) = _HEADER_LENGTH.unpack_from(body, 0)
+        header = json.loads(bytes(body[_HEADER_LENGTH.size:_HEADER_LENGTH.size + length]).decode("utf-8"))
+        rows = header["rows"]
+        view = memoryview(body)
+        offset = _HEADER_LENGTH.size + length
+        index, offset = _decode_values(header["index"], rows, view, offset)
+        columns = []
+        for entry in header["columns"]:
+            values, offset = _decode_values(entry, rows, view, offset)
+            columns.append(values)
+    except FrameCodecError:
+        raise
+    except (struct.error, KeyError, TypeError, ValueError) as e:
+        raise FrameCodecError(f"malformed frame header: {e}") from e
+    
+    if not isinstance(index, pd.DatetimeIndex):
+        index = pd.Index(index)
+    index.name = header["index"]["name"]
+    frame = pd.DataFrame({i: values for i, values in enumerate(columns)}, index=index)
+    frame.columns = pd.Index([entry["name"] for entry in header["columns"]], dtype=object)
+    return frame
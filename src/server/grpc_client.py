@@ -0,0 +1,437 @@
+"""
+远程数据提供者模块 / Remote Data Provider Module
+通过gRPC访问data_service共享的数据提供者，实现与本地提供者相同的DataProvider接口
+Reaches a data provider shared by data_service over gRPC, behind the same
+DataProvider interface as a local provider
+
+策略代码和DataManager不需要区分本地和远程提供者。每次调用的截止时间取请求上下文的剩余
+时间和timeout中较小的一个，上下文取消时正在进行的调用随之取消。服务端的数据错误还原为
+同类错误（如InstrumentNotFoundError）；服务不可用或繁忙时抛出DataServiceUnavailableError，
+属于NetworkError，默认的重试策略会重试。
+Strategy code and DataManager can't tell a remote provider from a local one.
+Each call's deadline is the smaller of the request context's remaining time
+and timeout, and cancelling the context cancels the call in flight. Data
+errors from the server come back as the same kind of error (such as
+InstrumentNotFoundError); an unavailable or busy service raises
+DataServiceUnavailableError, a NetworkError the default retry policy retries.
+
+依赖grpcio和grpcio-tools，zstd压缩需要zstandard / Requires grpcio and grpcio-tools; zstd needs zstandard
+"""
+
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+import pandas as pd
+
+from ..infrastructure.data_provider import (
+    ALL_MARKET,
+    AdjustmentsUnavailableError,
+    DataProvider,
+    FundamentalsUnavailableError,
+    InstrumentNotFoundError,
+    MetadataUnavailableError,
+    ProviderUnhealthyError,
+    UnsupportedFrequencyError
+)
+from ..infrastructure.logger_system import get_logger
+from ..infrastructure.subscription import LiveBar, Subscription
+from ..utils.error_handler import DataError, NetworkError, ErrorInfo, ErrorCategory, ErrorSeverity
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from .data_service import DATA_PROTO_FILE, ERROR_CODE_KEY, INSTRUMENT_KEY, MESSAGE_OPTIONS
+from .frame_codec import COMPRESSION_ZSTD, COMPRESSIONS, ZSTD_AVAILABLE, decode_frame
+from .grpc_server import grpc, grpc_protos
+
+
+# 服务不可用或繁忙，稍后重试可能成功的状态码名称
+_TRANSIENT_STATUSES = ("UNAVAILABLE", "RESOURCE_EXHAUSTED")
+
+
+class DataServiceError(DataError):
+    """
+    远程数据服务请求失败错误 / Remote data service request error
+    
+    服务端返回了无法还原为具体数据错误的失败，status为gRPC状态码名称
+    Raised for server failures that don't map to a specific data error;
+    status is the gRPC status code name
+    """
+    
+    def __init__(self, address: str, status: str, details: str, code: Optional[str] = None):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            address: 服务地址 / Service address
+            status: gRPC状态码名称 / gRPC status code name
+            details: 服务端的错误说明 / Server's error description
+            code: 服务端的错误码 / Server's error code
+        """
+        self.status = status
+        self.code = code
+        error_info = ErrorInfo(
+            error_code="DAT0034",
+            error_message_zh=f"远程数据服务 {address} 请求失败: {details or status}",
+            error_message_en=f"Remote data service {address} request failed: {details or status}",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"address={address}, status={status}, code={code}",
+            suggested_actions=["查看数据服务的日志"],
+            recoverable=False
+        )
+        super().__init__(error_info)
+
+
+class DataServiceUnavailableError(NetworkError):
+    """
+    远程数据服务不可用错误 / Remote data service unavailable error
+    
+    服务无法连接（UNAVAILABLE）或同时处理的请求已达上限（RESOURCE_EXHAUSTED）时抛出
+    Raised when the service can't be reached (UNAVAILABLE) or is at its
+    concurrent-request limit (RESOURCE_EXHAUSTED)
+    """
+    
+    def __init__(self, address: str, status: str, details: str):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            address: 服务地址 / Service address
+            status: gRPC状态码名称 / gRPC status code name
+            details: 错误说明 / Error description
+        """
+        self.status = status
+        error_info = ErrorInfo(
+            error_code="NET0001",
+            error_message_zh=f"远程数据服务 {address} 暂时不可用: {details or status}",
+            error_message_en=f"Remote data service {address} is unavailable: {details or status}",
+            category=ErrorCategory.NETWORK,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"address={address}, status={status}",
+            suggested_actions=[
+                "检查数据服务是否在运行以及网络连接",
+                "服务繁忙时稍后重试，或增大服务端的max_concurrent_requests"
+            ],
+            recoverable=True
+        )
+        super().__init__(error_info)
+
+
+def _bound(value: Optional[Any]) -> str:
+    return "" if value is None else str(value)
+
+
+class GRPCProvider(DataProvider):
+    """
+    远程数据提供者 / Remote data provider
+    
+    Examples:
+        >>> provider = GRPCProvider("data-host:50052", compression="zstd")
+        >>> manager = DataManager(provider=provider)
+        >>> result = manager.get_features(["SH600000"], ["$close", "Mean($close,5)"])
+    """
+    
+    name = "grpc"
+    
+    def __init__(
+        self,
+        address: str,
+        timeout: Optional[float] = 30.0,
+        compression: str = "none",
+        channel: Optional[Any] = None
+    ):
+        """
+        初始化提供者 / Initialize provider
+        
+        Args:
+            address: 服务地址，如"data-host:50052" / Service address such as "data-host:50052"
+            timeout: 每次调用的最长秒数，None表示只受请求上下文限制 /
+                Maximum seconds per call, None leaves only the request context's deadline
+            compression: 数据帧的压缩方式，"none"或"zstd" / Frame compression, "none" or "zstd"
+            channel: 已创建的gRPC通道，如带TLS凭证的通道；None表示新建不加密的通道 /
+                Existing gRPC channel, such as one with TLS credentials; None opens an insecure channel
+        
+        Raises:
+            ValueError: compression无效，或为"zstd"但zstandard未安装时抛出 /
+                Raised for an unknown compression, or "zstd" without zstandard
+            SystemError: grpcio或grpcio-tools未安装时抛出 / Raised when grpcio or grpcio-tools is missing
+        """
+        if compression not in COMPRESSIONS:
+            raise ValueError(f"unknown compression: {compression!r}, expected one of {', '.join(COMPRESSIONS)}")
+        if compression == COMPRESSION_ZSTD and not ZSTD_AVAILABLE:
+            raise ValueError("zstd compression requires the zstandard package")
+        self._protos, services = grpc_protos(DATA_PROTO_FILE)
+        self._address = address
+        self._timeout = timeout
+        self._compression = (
+            self._protos.COMPRESSION_ZSTD if compression == COMPRESSION_ZSTD else self._protos.COMPRESSION_NONE
+        )
+        self._owns_channel = channel is None
+        self._channel = channel or grpc.insecure_channel(address, options=MESSAGE_OPTIONS)
+        self._stub = services.DataServiceStub(self._channel)
+        self._info = None
+        self._info_lock = threading.Lock()
+        self._logger = get_logger(__name__)
+    
+    @property
+    def address(self) -> str:
+        """服务地址 / Service address"""
+        return self._address
+    
+    @property
+    def remote_name(self) -> str:
+        """服务端提供者的名称 / Name of the server's provider"""
+        return self._describe().name
+    
+    @property
+    def freqs(self) -> Tuple[str, ...]:
+        """与服务端提供者相同 / Same as the server's provider"""
+        return tuple(self._describe().freqs)
+    
+    @property
+    def adjusted_prices(self) -> bool:
+        """与服务端提供者相同 / Same as the server's provider"""
+        return self._describe().adjusted_prices
+    
+    def load_features(
+        self,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """加载单个标的的特征数据 / Load feature data for a single instrument"""
+        return self.load_features_ctx(background(), instrument, fields, start_time, end_time, freq)
+    
+    def load_features_ctx(
+        self,
+        ctx: RequestContext,
+        instrument: str,
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> pd.DataFrame:
+        """在请求上下文中加载单个标的的特征数据 / Load one instrument's features under a request context"""
+        return self._features(ctx, [instrument], fields, start_time, end_time, freq)[instrument]
+    
+    def features(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> Dict[str, pd.DataFrame]:
+        """一次请求加载多个标的的特征数据 / Load several instruments' features in one request"""
+        return self._features(background(), instruments, fields, start_time, end_time, freq)
+    
+    def calendar(
+        self,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """获取交易日历 / Get the trading calendar"""
+        return self.calendar_ctx(background(), start_time, end_time, freq)
+    
+    def calendar_ctx(
+        self,
+        ctx: RequestContext,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None,
+        freq: str = "day"
+    ) -> List[pd.Timestamp]:
+        """在请求上下文中获取交易日历 / Get the trading calendar under a request context"""
+        response = self._call(ctx, self._stub.Calendar, self._protos.CalendarRequest(
+            start=_bound(start_time), end=_bound(end_time), freq=freq, compression=self._compression
+        ), freq=freq)
+        return list(decode_frame(response.data).index)
+    
+    def fundamentals(
+        self,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """加载基本面数据的公告记录 / Load the announcement records of fundamental fields"""
+        return self.fundamentals_ctx(background(), instruments, fields, start_time, end_time)
+    
+    def fundamentals_ctx(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> Dict[str, pd.DataFrame]:
+        """在请求上下文中加载基本面数据的公告记录 / Load fundamental announcement records under a request context"""
+        response = self._call(ctx, self._stub.Fundamentals, self._protos.FundamentalsRequest(
+            instruments=list(instruments), fields=list(fields),
+            start=_bound(start_time), end=_bound(end_time), compression=self._compression
+        ))
+        return {frame.instrument: decode_frame(frame.data) for frame in response.frames}
+    
+    def adjustments(
+        self,
+        instrument: str,
+        start_time: Optional[str] = None,
+        end_time: Optional[str] = None
+    ) -> pd.DataFrame:
+        """加载标的的除权除息记录 / Load an instrument's split and dividend records"""
+        response = self._call(background(), self._stub.Adjustments, self._protos.AdjustmentsRequest(
+            instrument=instrument, start=_bound(start_time), end=_bound(end_time), compression=self._compression
+        ), instrument=instrument)
+        return decode_frame(response.data)
+    
+    def list_fields(self, instrument: str, freq: str = "day") -> List[str]:
+        """列出服务端提供者的字段 / List the server provider's fields"""
+        response = self._call(background(), self._stub.ListFields, self._protos.ListFieldsRequest(
+            instrument=instrument, freq=freq
+        ), instrument=instrument, freq=freq, what="fields")
+        return list(response.names)
+    
+    def list_instruments(self, market: str = ALL_MARKET, freq: str = "day") -> List[str]:
+        """列出服务端提供者的标的 / List the server provider's instruments"""
+        response = self._call(background(), self._stub.ListInstruments, self._protos.ListInstrumentsRequest(
+            market=market, freq=freq
+        ), freq=freq, what="instruments")
+        return list(response.names)
+    
+    def subscribe(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        freq: str = "1min"
+    ) -> Subscription:
+        """
+        订阅服务端提供者的实时K线 / Subscribe to the server provider's live bars
+        
+        K线由后台线程从服务端的流中读取并投递；流因错误结束时订阅以对应的错误关闭
+        A background thread reads bars off the server stream and publishes
+        them; when the stream fails the subscription closes with the matching error
+        """
+        ctx.check()
+        self.check_freq(freq)
+        subscription = Subscription(ctx, instruments, fields, freq)
+        # 订阅长期存在，只受请求上下文的截止时间限制
+        call = self._stub.Subscribe(
+            self._protos.SubscribeRequest(instruments=list(instruments), fields=list(fields), freq=freq),
+            timeout=ctx.remaining()
+        )
+        ctx.on_cancel(call.cancel)
+        threading.Thread(
+            target=self._forward, args=(call, subscription), name="grpc-subscription", daemon=True
+        ).start()
+        return subscription
+    
+    def healthcheck(self, ctx: RequestContext) -> None:
+        """
+        服务端可以访问 / The server is reachable
+        
+        每次都重新调用Describe，不使用缓存的服务端信息
+        Calls Describe every time instead of the cached server info
+        """
+        try:
+            self._call(ctx, self._stub.Describe, self._protos.DescribeRequest())
+        except ContextCancelledError as e:
+            if ctx.err() is not None:
+                raise
+            raise ProviderUnhealthyError(self.name, f"{self._address} timed out") from e
+        except (DataError, NetworkError) as e:
+            raise ProviderUnhealthyError(self.name, f"{self._address} is unreachable: {e}") from e
+    
+    def close(self) -> None:
+        """关闭自己创建的通道 / Close the channel if this provider opened it"""
+        if self._owns_channel:
+            self._channel.close()
+    
+    def _features(
+        self,
+        ctx: RequestContext,
+        instruments: List[str],
+        fields: List[str],
+        start_time: Optional[str],
+        end_time: Optional[str],
+        freq: str
+    ) -> Dict[str, pd.DataFrame]:
+        instruments = list(instruments)
+        response = self._call(ctx, self._stub.Features, self._protos.FeaturesRequest(
+            instruments=instruments, fields=list(fields),
+            start=_bound(start_time), end=_bound(end_time), freq=freq, compression=self._compression
+        ), instrument=instruments[0] if len(instruments) == 1 else None, freq=freq)
+        return {frame.instrument: decode_frame(frame.data) for frame in response.frames}
+    
+    def _describe(self):
+        with self._info_lock:
+            if self._info is None:
+                self._info = self._call(background(), self._stub.Describe, self._protos.DescribeRequest())
+            return self._info
+    
+    def _forward(self, call, subscription: Subscription) -> None:
+        """把服务端的K线投递到本地订阅 / Publish the server's bars to the local subscription"""
+        fields = subscription.fields
+        try:
+            for bar in call:
+                values = {field: bar.values[field] for field in fields if field in bar.values}
+                subscription.publish(LiveBar(bar.instrument, pd.Timestamp(bar.time), values, bar.revised))
+        except grpc.RpcError as e:
+            # 本地上下文取消时流以CANCELLED结束，属于正常关闭
+            subscription.close(None if subscription.context.cancelled else self._error(e, freq=subscription.freq))
+            return
+        subscription.close()
+    
+    def _call(self, ctx: RequestContext, method, request, **error_args) -> Any:
+        """
+        在请求上下文中调用一个方法 / Call a method under a request context
+        
+        Raises:
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+        """
+        ctx.check()
+        timeout = self._timeout
+        remaining = ctx.remaining()
+        if remaining is not None:
+            timeout = remaining if timeout is None else min(timeout, remaining)
+        future = method.future(request, timeout=timeout)
+        ctx.on_cancel(future.cancel)
+        try:
+            return future.result()
+        except grpc.FutureCancelledError:
+            raise ctx.err() or ContextCancelledError(reason="rpc cancelled")
+        except grpc.RpcError as e:
+            raise self._error(e, **error_args) from e
+    
+    def _error(
+        self,
+        error,
+        instrument: Optional[str] = None,
+        freq: Optional[str] = None,
+        what: Optional[str] = None
+    ) -> Exception:
+        """把gRPC错误还原为本地错误 / Turn a gRPC error back into a local error"""
+        status = error.code()
+        details = error.details() or ""
+        metadata = dict(error.trailing_metadata() or ())
+        code = metadata.get(ERROR_CODE_KEY)
+        instrument = metadata.get(INSTRUMENT_KEY) or instrument
+        remote = f"address={self._address}, {details}"
+        if status == grpc.StatusCode.DEADLINE_EXCEEDED:
+            return ContextCancelledError(deadline_exceeded=True, reason=details)
+        if status == grpc.StatusCode.CANCELLED:
+            return ContextCancelledError(reason=details or "rpc cancelled")
+        if code == "DAT0029" and instrument:
+            return InstrumentNotFoundError(instrument, self.name, remote)
+        if code == "DAT0020" and freq:
+            return UnsupportedFrequencyError(freq, self.name, self.freqs)
+        if code == "DAT0026":
+            return FundamentalsUnavailableError(self.name, instrument, remote)
+        if code == "DAT0031":
+            return AdjustmentsUnavailableError(self.name, instrument, remote)
+        if code == "DAT0028" and what:
+            return MetadataUnavailableError(self.name, what)
+        if status.name in _TRANSIENT_STATUSES:
+            return DataServiceUnavailableError(self._address, status.name, details)
+        self._logger.error(f"远程数据服务请求失败 - 地址: {self._address}, 状态: {status.name}: {details}")
+        return DataServiceError(self._address, status.name, details, code)
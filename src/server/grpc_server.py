@@ -0,0 +1,329 @@
+"""
+特征数据gRPC服务模块 / Feature gRPC Server Module
+实现protos/features.proto中的FeatureService，供服务之间低延迟调用
+Implements FeatureService from protos/features.proto for low-latency
+service-to-service calls
+
+消息类和服务桩在运行时由grpc.protos_and_services()从features.proto生成，不需要
+提交生成的代码；其他语言的客户端可以用protoc从同一个文件生成。
+Message classes and service stubs are generated from features.proto at runtime
+by grpc.protos_and_services(), so no generated code is checked in; clients in
+other languages can run protoc on the same file.
+
+客户端的截止时间传递到请求上下文，超时或客户端取消时正在进行的提供者读取随之中止。
+The client's deadline becomes the request context's deadline, so a timeout
+or a client cancel aborts the provider reads in flight.
+
+Health对应HTTP服务的/healthz和/readyz，不可用时以UNAVAILABLE结束，见server.health。
+Health mirrors the HTTP server's /healthz and /readyz and ends with
+UNAVAILABLE when failing; see server.health.
+
+依赖grpcio和grpcio-tools / Requires grpcio and grpcio-tools
+"""
+
+import functools
+import sys
+from concurrent.futures import ThreadPoolExecutor
+from pathlib import Path
+from typing import Any, Iterator, List, Optional, Tuple
+
+import pandas as pd
+
+from ..core.data_manager import DataManager
+from ..core.expression_engine import ExpressionError
+from ..core.feature_stream import CHUNK_BY_MONTH, FeatureRequest
+from ..core.request_time import RequestTimeError, parse_request_range
+from ..infrastructure.data_provider import DataProvider, SUPPORTED_FREQS, UnsupportedFrequencyError
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import SystemError, ErrorInfo, ErrorCategory, ErrorSeverity
+from ..utils.request_context import ContextCancelledError, RequestContext, background
+from .feature_server import NOT_FOUND_CODES, _error_body, _error_code
+from .health import HealthMonitor, WarmupProbe
+
+try:
+    import grpc
+    GRPC_AVAILABLE = True
+except ImportError:
+    GRPC_AVAILABLE = False
+    grpc = None
+
+
+PROTO_DIR = Path(__file__).parent / "protos"
+PROTO_FILE = "features.proto"
+
+
+@functools.lru_cache(maxsize=None)
+def grpc_protos(proto_file: str = PROTO_FILE) -> Tuple[Any, Any]:
+    """
+    从proto文件生成消息和服务模块 / Generate the message and service modules from a proto file
+    
+    Args:
+        proto_file: protos目录下的文件名，默认为features.proto / File name under protos, features.proto by default
+    
+    Returns:
+        Tuple[Any, Any]: (消息模块, 服务模块)，如features_pb2和features_pb2_grpc /
+            (messages, services), e.g. features_pb2 and features_pb2_grpc
+    
+    Raises:
+        SystemError: grpcio或grpcio-tools未安装时抛出 / Raised when grpcio or grpcio-tools is missing
+    """
+    try:
+        import grpc_tools  # noqa: F401  protos_and_services()需要 / needed by protos_and_services()
+    except ImportError:
+        grpc_tools = None
+    if not GRPC_AVAILABLE or grpc_tools is None:
+        error_info = ErrorInfo(
+            error_code="SYS0007",
+            error_message_zh="grpcio或grpcio-tools未安装，无法启动gRPC服务",
+            error_message_en="grpcio or grpcio-tools not installed, cannot run the gRPC service",
+            category=ErrorCategory.SYSTEM,
+            severity=ErrorSeverity.HIGH,
+            technical_details="grpc or grpc_tools module not found",
+            suggested_actions=["安装gRPC: pip install grpcio grpcio-tools"],
+            recoverable=False
+        )
+        raise SystemError(error_info)
+    if str(PROTO_DIR) not in sys.path:
+        sys.path.append(str(PROTO_DIR))
+    return grpc.protos_and_services(proto_file)
+
+
+def _request_context(context) -> RequestContext:
+    """把gRPC的截止时间和取消传给请求上下文 / Carry the gRPC deadline and cancellation into a request context"""
+    ctx = RequestContext(timeout=context.time_remaining())
+    # RPC结束时（包括正常完成）触发，此时取消上下文没有副作用
+    context.add_callback(lambda: ctx.cancel("rpc terminated"))
+    return ctx
+
+
+def _cancelled_status(error: ContextCancelledError) -> Tuple[Any, str]:
+    if error.deadline_exceeded:
+        return grpc.StatusCode.DEADLINE_EXCEEDED, "deadline exceeded"
+    return grpc.StatusCode.CANCELLED, f"cancelled: {error.reason}" if error.reason else "cancelled"
+
+
+class _InvalidArgument(ValueError):
+    """请求参数错误 / Invalid request arguments"""
+
+
+class FeatureServicer:
+    """
+    FeatureService的实现 / FeatureService implementation
+    
+    Examples:
+        >>> server, port = create_grpc_server("127.0.0.1:50051", CSVDataProvider("./data"))
+        >>> server.start()
+    """
+    
+    def __init__(
+        self,
+        provider: Optional[DataProvider] = None,
+        manager: Optional[DataManager] = None,
+        timezone: str = "Asia/Shanghai",
+        warmup: Optional[WarmupProbe] = None
+    ):
+        """
+        初始化服务 / Initialize servicer
+        
+        Args:
+            provider: 数据提供者，None表示使用管理器的默认提供者 / Data provider, None uses the manager's default
+            manager: 数据管理器，None表示新建 / Data manager, None creates one
+            timezone: 交易所时区，用于解释请求的start和end，并把K线时间转换为Unix秒 /
+                Exchange timezone for interpreting the request's start and end and
+                for converting bar times to Unix seconds
+            warmup: 预热查询，None表示启动即就绪；由health.start_warm_up()运行 /
+                Warm-up query, None is ready at once; run by health.start_warm_up()
+        """
+        self._provider = provider
+        self._manager = manager or DataManager(provider=provider)
+        self._timezone = timezone
+        self.health = HealthMonitor(self._manager, provider, warmup)
+        self._protos, _ = grpc_protos()
+        self._logger = get_logger(__name__)
+    
+    def Features(self, request, context):
+        """一次返回所有标的的数据 / Return every instrument's data at once"""
+        code, message, response = self._features(request, context)
+        if code is not None:
+            context.abort(code, message)
+        return response
+    
+    def FeaturesStream(self, request, context) -> Iterator[Any]:
+        """
+        按时间分块返回数据 / Return data in time chunks
+        
+        context.abort()抛出异常结束RPC，已发送的块仍然有效
+        context.abort() raises to end the RPC; chunks already sent stay valid
+        """
+        try:
+            instruments, fields, start, end, freq = self._validate(request)
+            chunk_by = request.chunk_bars or CHUNK_BY_MONTH
+            if request.chunk_bars < 0:
+                raise _InvalidArgument(f"chunk_bars must be non-negative, got {request.chunk_bars}")
+        except _InvalidArgument as e:
+            context.abort(grpc.StatusCode.INVALID_ARGUMENT, str(e))
+        
+        ctx = _request_context(context)
+        try:
+            iterator = self._manager.get_features_stream(FeatureRequest(
+                instruments, fields, start_time=start, end_time=end, freq=freq,
+                chunk_by=chunk_by, provider=self._provider, context=ctx, timezone=self._timezone
+            ))
+        except (ExpressionError, UnsupportedFrequencyError) as e:
+            context.abort(grpc.StatusCode.INVALID_ARGUMENT, _error_body(e)["error"])
+        
+        while True:
+            chunk, ok = iterator.next()
+            if not ok:
+                break
+            yield self._protos.FeaturesChunk(
+                data=self._instrument_message(chunk.instrument, chunk.frame, fields, freq),
+                sequence=chunk.sequence
+            )
+        
+        if iterator.error is not None:
+            context.abort(*_cancelled_status(iterator.error))
+        elif iterator.errors:
+            context.abort(*self._failure_status(iterator.errors))
+    
+    def Health(self, request, context):
+        """存活或就绪检查 / Liveness or readiness check"""
+        ok, body = self.health.readiness() if request.readiness else self.health.health()
+        if not ok:
+            context.abort(grpc.StatusCode.UNAVAILABLE, body.get("error") or body["status"])
+        return self._protos.HealthResponse(status=body["status"], provider=body["provider"])
+    
+    def _features(self, request, context) -> Tuple[Optional[Any], str, Any]:
+        """返回(状态码, 说明, 响应)，成功时状态码为None / Return (code, message, response); code is None on success"""
+        try:
+            instruments, fields, start, end, freq = self._validate(request)
+        except _InvalidArgument as e:
+            return grpc.StatusCode.INVALID_ARGUMENT, str(e), None
+        
+        ctx = _request_context(context)
+        try:
+            result = self._manager.get_features_ctx(
+                ctx, instruments, fields,
+                start_time=start, end_time=end, freq=freq, provider=self._provider,
+                timezone=self._timezone
+            )
+        except (ExpressionError, UnsupportedFrequencyError) as e:
+            return grpc.StatusCode.INVALID_ARGUMENT, _error_body(e)["error"], None
+        except ContextCancelledError as e:
+            return _cancelled_status(e) + (None,)
+        except Exception as e:
+            self._logger.error(f"gRPC特征查询失败 - 标的: {instruments}, 字段: {fields}: {str(e)}")
+            return grpc.StatusCode.INTERNAL, _error_body(e)["error"], None
+        
+        if result.errors:
+            return self._failure_status(result.errors) + (None,)
+        response = self._protos.FeaturesResponse(instruments=[
+            self._instrument_message(code, frame, fields, freq) for code, frame in result.items()
+        ])
+        return None, "", response
+    
+    def _validate(self, request) -> Tuple[List[str], List[str], Optional[str], Optional[str], str]:
+        instruments = list(dict.fromkeys(code.strip() for code in request.instruments if code.strip()))
+        fields = list(dict.fromkeys(field.strip() for field in request.fields if field.strip()))
+        if not instruments:
+            raise _InvalidArgument("missing required field: instruments")
+        if not fields:
+            raise _InvalidArgument("missing required field: fields")
+        start, end = request.start or None, request.end or None
+        try:
+            parse_request_range(start, end, self._timezone, start_field="start", end_field="end")
+        except RequestTimeError as e:
+            raise _InvalidArgument(str(e))
+        freq = request.freq or "day"
+        if freq not in SUPPORTED_FREQS:
+            raise _InvalidArgument(f"unsupported freq: {freq!r}, expected one of {', '.join(SUPPORTED_FREQS)}")
+        return instruments, fields, start, end, freq
+    
+    def _failure_status(self, errors) -> Tuple[Any, str]:
+        unknown = [code for code, error in errors.items() if _error_code(error) in NOT_FOUND_CODES]
+        if unknown:
+            return grpc.StatusCode.NOT_FOUND, f"unknown instruments or no data in range: {', '.join(unknown)}"
+        self._logger.error(f"gRPC特征查询部分失败 - 标的: {list(errors)}")
+        details = "; ".join(f"{code}: {_error_body(error)['error']}" for code, error in errors.items())
+        return grpc.StatusCode.INTERNAL, f"failed to load features: {details}"
+    
+    def _instrument_message(self, code: str, frame: pd.DataFrame, fields: List[str], freq: str):
+        index = pd.DatetimeIndex(frame.index)
+        if index.tz is None:
+            index = index.tz_localize(self._timezone)
+        seconds = (index.asi8 // 1_000_000_000).tolist()
+        columns = [
+            self._protos.Column(field=field, values=frame[field].astype(float).tolist())
+            for field in fields
+        ]
+        return self._protos.InstrumentFeatures(instrument=code, timestamps=seconds, columns=columns)
+
+
+def create_grpc_server(
+    address: str,
+    provider: Optional[DataProvider] = None,
+    manager: Optional[DataManager] = None,
+    max_workers: int = 8,
+    warmup: Optional[WarmupProbe] = None
+) -> Tuple[Any, int]:
+    """
+    创建已注册FeatureService、尚未启动的gRPC服务 / Create a gRPC server with FeatureService registered, not yet started
+    
+    配置了预热查询时，预热在后台立即开始，完成前Health(readiness=true)返回UNAVAILABLE
+    With a warm-up query the warm-up starts in the background right away,
+    and Health(readiness=true) returns UNAVAILABLE until it completes
+    
+    Args:
+        address: 监听地址，如"0.0.0.0:50051"，端口为0时由系统分配 /
+            Listen address such as "0.0.0.0:50051"; port 0 lets the system pick one
+        provider: 数据提供者，None表示使用默认提供者 / Data provider, None uses the default
+        manager: 数据管理器，None表示新建 / Data manager, None creates one
+        max_workers: 处理请求的线程数 / Worker threads handling requests
+        warmup: 预热查询，None表示不预热 / Warm-up query, None skips it
+    
+    Returns:
+        Tuple[grpc.Server, int]: (服务, 实际监听端口) / (server, bound port)
+    
+    Raises:
+        SystemError: grpcio或grpcio-tools未安装时抛出 / Raised when grpcio or grpcio-tools is missing
+    """
+    _, services = grpc_protos()
+    server = grpc.server(ThreadPoolExecutor(max_workers=max_workers))
+    servicer = FeatureServicer(provider, manager, warmup=warmup)
+    services.add_FeatureServiceServicer_to_server(servicer, server)
+    port = server.add_insecure_port(address)
+    servicer.health.start_warm_up()
+    return server, port
+
+
+def listen_and_serve_grpc(
+    address: str,
+    provider: Optional[DataProvider] = None,
+    ctx: Optional[RequestContext] = None,
+    grace: float = 5.0,
+    warmup: Optional[WarmupProbe] = None
+) -> None:
+    """
+    在address上提供gRPC服务，直到ctx取消或超时 / Serve gRPC on address until ctx is done
+    
+    关闭时不再接受新请求，正在处理的请求最多再运行grace秒
+    On shutdown new RPCs are rejected and in-flight ones get up to grace
+    seconds to finish
+    
+    Args:
+        address: 监听地址 / Listen address
+        provider: 数据提供者，None表示使用默认提供者 / Data provider, None uses the default
+        ctx: 控制服务生命周期的上下文，None表示一直运行 / Context controlling the server's lifetime, None runs forever
+        grace: 关闭时等待正在处理的请求的秒数 / Seconds in-flight RPCs get at shutdown
+        warmup: 预热查询，None表示不预热 / Warm-up query, None skips it
+    """
+    logger = get_logger(__name__)
+    ctx = ctx or background()
+    server, port = create_grpc_server(address, provider, warmup=warmup)
+    server.start()
+    logger.info(f"特征数据gRPC服务已启动, 端口: {port}")
+    try:
+        ctx.wait()
+    finally:
+        server.stop(grace).wait()
+        logger.info(f"特征数据gRPC服务已关闭, 端口: {port}")
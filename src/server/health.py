@@ -0,0 +1,222 @@
+"""
+服务健康检查模块 / Server Health Check Module
+为负载均衡提供存活和就绪检查：存活检查调用数据提供者的healthcheck()，就绪检查另外要求
+可选的预热查询已经成功
+Backs the load balancer's liveness and readiness checks: liveness calls the
+data provider's healthcheck(), and readiness also requires the optional
+warm-up query to have succeeded
+
+预热查询在服务启动后于后台运行一次，用于提前打开文件、加载日历和填充缓存，避免第一个
+真实请求变慢；查询失败时服务保持未就绪，可以再次调用warm_up()重试。没有配置预热时，
+服务启动即就绪。
+The warm-up query runs once in the background after the server starts, to
+open files, load the calendar and fill caches before the first real request;
+when it fails the server stays not ready and warm_up() can be called again.
+Without a warm-up the server is ready as soon as it starts.
+
+Examples:
+    >>> probe = WarmupProbe("SH000300", ["$close"], start="2025-01-01")
+    >>> server = FeatureServer(":8080", CSVDataProvider("./data"), warmup=probe)
+"""
+
+import threading
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional, Tuple
+
+from ..core.data_manager import DataManager
+from ..infrastructure.data_provider import DataProvider, SUPPORTED_FREQS
+from ..infrastructure.logger_system import get_logger
+from ..utils.error_handler import QlibTradingError
+from ..utils.request_context import RequestContext
+
+
+HEALTH_PATH = "/healthz"
+READY_PATH = "/readyz"
+
+# 单次健康检查的默认超时秒数，应短于负载均衡检查的间隔
+DEFAULT_HEALTH_TIMEOUT = 5.0
+
+# 预热查询的默认超时秒数
+DEFAULT_WARMUP_TIMEOUT = 60.0
+
+
+@dataclass(frozen=True)
+class WarmupProbe:
+    """
+    预热查询 / Warm-up query
+    
+    查询必须返回非空数据才算成功
+    The query only succeeds when it returns rows
+    
+    Attributes:
+        instrument: 标的代码 / Instrument code
+        fields: 字段或表达式 / Fields or expressions
+        start: 开始时间，None表示不限 / Start time, None for no bound
+        end: 结束时间，None表示不限 / End time, None for no bound
+        freq: 数据频率 / Data frequency
+        timeout: 超时秒数，None表示不限 / Timeout in seconds, None for no limit
+    """
+    instrument: str
+    fields: List[str] = field(default_factory=lambda: ["$close"])
+    start: Optional[str] = None
+    end: Optional[str] = None
+    freq: str = "day"
+    timeout: Optional[float] = DEFAULT_WARMUP_TIMEOUT
+    
+    def __post_init__(self):
+        if not self.instrument:
+            raise ValueError("warm-up instrument must not be empty")
+        if not self.fields:
+            raise ValueError("warm-up fields must not be empty")
+        if self.freq not in SUPPORTED_FREQS:
+            raise ValueError(f"unsupported freq: {self.freq!r}, expected one of {', '.join(SUPPORTED_FREQS)}")
+        object.__setattr__(self, "fields", list(self.fields))
+
+
+class HealthMonitor:
+    """
+    服务的存活和就绪状态 / Liveness and readiness of a server
+    
+    HTTP和gRPC服务共用，线程安全
+    Shared by the HTTP and gRPC servers; thread-safe
+    """
+    
+    def __init__(
+        self,
+        manager: DataManager,
+        provider: Optional[DataProvider] = None,
+        warmup: Optional[WarmupProbe] = None,
+        timeout: Optional[float] = DEFAULT_HEALTH_TIMEOUT
+    ):
+        """
+        初始化状态 / Initialize state
+        
+        Args:
+            manager: 服务使用的数据管理器 / Data manager of the server
+            provider: 服务使用的数据提供者，None表示管理器的默认提供者 / Provider of the server, None for the manager's default
+            warmup: 预热查询，None表示不预热、启动即就绪 / Warm-up query, None skips it and is ready at once
+            timeout: 单次健康检查的超时秒数 / Timeout of one health check in seconds
+        """
+        self._manager = manager
+        self._provider = provider
+        self._warmup = warmup
+        self._timeout = timeout
+        self._lock = threading.Lock()
+        self._warmed = warmup is None
+        self._warmup_error: Optional[str] = None
+        self._warming = False
+        self._logger = get_logger(__name__)
+    
+    @property
+    def warmup(self) -> Optional[WarmupProbe]:
+        """预热查询 / Warm-up query"""
+        return self._warmup
+    
+    @property
+    def warmed_up(self) -> bool:
+        """预热查询是否已经成功，没有配置预热时为True / Whether the warm-up succeeded, True without one"""
+        with self._lock:
+            return self._warmed
+    
+    def warm_up(self, ctx: Optional[RequestContext] = None) -> bool:
+        """
+        运行预热查询 / Run the warm-up query
+        
+        已经成功或没有配置预热时直接返回True，另一个预热正在运行时返回False；失败时记录原因，
+        由readiness()返回
+        Returns True at once after a success or without a warm-up, and False
+        while another warm-up is running; a failure is recorded and reported by
+        readiness()
+        
+        Args:
+            ctx: 请求上下文，None表示使用预热查询的超时 / Request context, None uses the probe's timeout
+        
+        Returns:
+            bool: 预热是否成功 / Whether the warm-up succeeded
+        """
+        with self._lock:
+            if self._warmed:
+                return True
+            if self._warming:
+                return False
+            self._warming = True
+        probe = self._warmup
+        ctx = ctx or RequestContext(timeout=probe.timeout)
+        error: Optional[str] = None
+        try:
+            result = self._manager.get_features_ctx(
+                ctx, [probe.instrument], probe.fields,
+                start_time=probe.start, end_time=probe.end, freq=probe.freq, provider=self._provider
+            )
+            frame = result.get(probe.instrument)
+            if probe.instrument in result.errors:
+                error = _message(result.errors[probe.instrument])
+            elif frame is None or frame.empty:
+                error = f"warm-up query returned no data for {probe.instrument}"
+        except Exception as e:
+            error = _message(e)
+        
+        with self._lock:
+            self._warming = False
+            self._warmed = error is None
+            self._warmup_error = error
+        if error is None:
+            self._logger.info(f"预热查询完成 - 标的: {probe.instrument}, 字段: {probe.fields}")
+        else:
+            self._logger.error(f"预热查询失败 - 标的: {probe.instrument}, 字段: {probe.fields}: {error}")
+        return error is None
+    
+    def start_warm_up(self) -> Optional[threading.Thread]:
+        """
+        在后台线程中运行预热查询 / Run the warm-up query on a background thread
+        
+        Returns:
+            Optional[threading.Thread]: 预热线程，不需要预热时为None / Warm-up thread, None when nothing has to run
+        """
+        if self.warmed_up:
+            return None
+        thread = threading.Thread(target=self.warm_up, name="server-warmup", daemon=True)
+        thread.start()
+        return thread
+    
+    def health(self) -> Tuple[bool, Dict[str, Any]]:
+        """
+        存活检查：数据提供者是否可用 / Liveness check: whether the data provider is healthy
+        
+        Returns:
+            Tuple[bool, Dict[str, Any]]: (是否可用, JSON响应体) / (healthy, JSON body)
+        """
+        provider = self._provider or self._manager.provider
+        body: Dict[str, Any] = {"provider": provider.name}
+        try:
+            provider.healthcheck(RequestContext(timeout=self._timeout))
+        except Exception as e:
+            self._logger.warning(f"数据提供者健康检查失败 - {provider.name}: {_message(e)}")
+            return False, {"status": "unhealthy", **body, "error": _message(e)}
+        return True, {"status": "ok", **body}
+    
+    def readiness(self) -> Tuple[bool, Dict[str, Any]]:
+        """
+        就绪检查：预热已经成功且数据提供者可用 / Readiness check: warmed up and the provider healthy
+        
+        Returns:
+            Tuple[bool, Dict[str, Any]]: (是否就绪, JSON响应体) / (ready, JSON body)
+        """
+        with self._lock:
+            warmed, warming, error = self._warmed, self._warming, self._warmup_error
+        if not warmed:
+            body: Dict[str, Any] = {"status": "warming_up" if warming or error is None else "warmup_failed"}
+            if error is not None:
+                body["error"] = error
+            return False, body
+        healthy, body = self.health()
+        if not healthy:
+            return False, body
+        return True, {**body, "status": "ready"}
+
+
+def _message(error: Exception) -> str:
+    """英文错误说明 / English error description"""
+    if isinstance(error, QlibTradingError):
+        return error.error_info.error_message_en
+    return str(error) or type(error).__name__
@@ -0,0 +1,222 @@
+"""
+特征数据磁盘缓存模块 / Feature Data Disk Cache Module
+按(标的, 频率, 字段)在磁盘上缓存已获取的特征序列，并记录其覆盖的时间区间
+Caches fetched feature series on disk per (instrument, frequency, field),
+together with the time range each entry covers
+"""
+
+import os
+import tempfile
+import threading
+import time
+from contextlib import contextmanager
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Dict, Iterator, Optional, Tuple
+from urllib.parse import quote
+
+import numpy as np
+import pandas as pd
+
+from ..infrastructure.logger_system import get_logger
+
+
+# 表示"不限"的时间边界
+_UNBOUNDED = np.iinfo(np.int64).min
+
+
+def _encode_bound(bound: Optional[pd.Timestamp]) -> int:
+    return _UNBOUNDED if bound is None else int(bound.value)
+
+
+def _decode_bound(value: int) -> Optional[pd.Timestamp]:
+    return None if int(value) == _UNBOUNDED else pd.Timestamp(int(value))
+
+
+@dataclass
+class CacheEntry:
+    """
+    缓存条目 / Cache entry
+    
+    Attributes:
+        series: 缓存的序列 / Cached series
+        start: 覆盖区间开始（包含），None表示不限 / Covered range start (inclusive), None for unbounded
+        end: 覆盖区间结束（包含），None表示不限 / Covered range end (inclusive), None for unbounded
+        created_at: 写入时间（Unix时间戳） / Write time (Unix timestamp)
+    """
+    series: pd.Series
+    start: Optional[pd.Timestamp]
+    end: Optional[pd.Timestamp]
+    created_at: float
+    
+    def covers(self, start: Optional[pd.Timestamp], end: Optional[pd.Timestamp]) -> bool:
+        """
+        是否完整覆盖请求区间 / Whether the entry fully covers a requested range
+        
+        Args:
+            start: 请求开始时间，None表示不限 / Requested start, None for unbounded
+            end: 请求结束时间，None表示不限 / Requested end, None for unbounded
+        
+        Returns:
+            bool: 完整覆盖时返回True / True when fully covered
+        """
+        start_ok = self.start is None or (start is not None and start >= self.start)
+        end_ok = self.end is None or (end is not None and end <= self.end)
+        return start_ok and end_ok
+
+
+class FeatureCache:
+    """
+    特征数据磁盘缓存 / Feature data disk cache
+    
+    每个(标的, 频率, 字段)保存为一个压缩的npz文件（int64纳秒时间戳和float64数值），
+    写入先写临时文件再原子替换，因此并发的读者不会读到写了一半的文件。
+    同一标的的读改写通过lock()串行化，不同标的之间互不阻塞。
+    Each (instrument, frequency, field) is stored as one compressed npz file
+    (int64 nanosecond timestamps plus float64 values). Writes go to a temporary
+    file that is atomically renamed, so concurrent readers never see a partial
+    file. Read-modify-write of one instrument is serialized with lock(); other
+    instruments are not blocked.
+    """
+    
+    def __init__(self, cache_dir: str, ttl: Optional[float] = None):
+        """
+        初始化缓存 / Initialize cache
+        
+        Args:
+            cache_dir: 缓存目录 / Cache directory
+            ttl: 条目有效期（秒），None表示永不过期 / Entry TTL in seconds, None never expires
+        """
+        self._cache_dir = Path(cache_dir).expanduser()
+        self._cache_dir.mkdir(parents=True, exist_ok=True)
+        self._ttl = ttl
+        self._locks: Dict[Tuple[str, str], threading.RLock] = {}
+        self._locks_guard = threading.Lock()
+        self._logger = get_logger(__name__)
+        
+        self._logger.info(f"特征缓存初始化 - 缓存目录: {self._cache_dir}, TTL: {ttl}秒")
+    
+    @property
+    def cache_dir(self) -> Path:
+        """缓存目录 / Cache directory"""
+        return self._cache_dir
+    
+    @contextmanager
+    def lock(self, instrument: str, freq: str) -> Iterator[None]:
+        """
+        锁定标的的缓存条目 / Lock the cache entries of an instrument
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            freq: 数据频率 / Data frequency
+        """
+        key = (instrument, freq)
+        with self._locks_guard:
+            instrument_lock = self._locks.setdefault(key, threading.RLock())
+        with instrument_lock:
+            yield
+    
+    def read(self, instrument: str, field: str, freq: str) -> Optional[CacheEntry]:
+        """
+        读取缓存条目 / Read a cache entry
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            field: 字段名 / Field name
+            freq: 数据频率 / Data frequency
+        
+        Returns:
+            Optional[CacheEntry]: 缓存条目，不存在、已过期或损坏时返回None /
+                The entry, or None when absent, expired, or corrupt
+        """
+        path = self._entry_path(instrument, field, freq)
+        if not path.exists():
+            return None
+        
+        try:
+            with np.load(path) as data:
+                created_at = float(data["created_at"])
+                if self._ttl is not None and time.time() - created_at >= self._ttl:
+                    self._logger.debug(f"特征缓存过期: {instrument} {field} {freq}")
+                    path.unlink(missing_ok=True)
+                    return None
+                
+                index = pd.DatetimeIndex(data["index"].astype("datetime64[ns]"), name="datetime")
+                series = pd.Series(data["values"], index=index, name=field)
+                return CacheEntry(
+                    series=series,
+                    start=_decode_bound(data["start"]),
+                    end=_decode_bound(data["end"]),
+                    created_at=created_at
+                )
+        except Exception as e:
+            self._logger.warning(f"读取特征缓存失败，忽略该条目: {path}, 错误: {str(e)}")
+            return None
+    
+    def write(self, instrument: str, field: str, freq: str, entry: CacheEntry) -> None:
+        """
+        写入缓存条目 / Write a cache entry
+        
+        Args:
+            instrument: 标的代码 / Instrument code
+            field: 字段名 / Field name
+            freq: 数据频率 / Data frequency
+            entry: 缓存条目 / Cache entry
+        """
+        path = self._entry_path(instrument, field, freq)
+        path.parent.mkdir(parents=True, exist_ok=True)
+        
+        index = pd.DatetimeIndex(entry.series.index)
+        if index.tz is not None:
+            index = index.tz_localize(None)
+        
+        fd, tmp_name = tempfile.mkstemp(dir=path.parent, suffix=".tmp")
+        try:
+            with os.fdopen(fd, "wb") as f:
+                np.savez_compressed(
+                    f,
+                    index=index.asi8,
+                    values=entry.series.to_numpy(dtype=np.float64),
+                    start=np.int64(_encode_bound(entry.start)),
+                    end=np.int64(_encode_bound(entry.end)),
+                    created_at=np.float64(entry.created_at)
+                )
+            os.replace(tmp_name, path)
+        except Exception:
+            Path(tmp_name).unlink(missing_ok=True)
+            raise
+        
+        self._logger.debug(
+            f"特征缓存已写入: {instrument} {field} {freq}, "
+            f"区间: {entry.start} 至 {entry.end}, 行数: {len(entry.series)}"
+        )
+    
+    def invalidate(self, instrument: Optional[str] = None) -> int:
+        """
+        使缓存失效 / Invalidate cache entries
+        
+        Args:
+            instrument: 标的代码，None表示清除所有 / Instrument code, None clears everything
+        
+        Returns:
+            int: 删除的条目数 / Number of entries removed
+        """
+        pattern = f"*/{self._safe_name(instrument)}/*.npz" if instrument else "*/*/*.npz"
+        count = 0
+        for path in self._cache_dir.glob(pattern):
+            path.unlink(missing_ok=True)
+            count += 1
+        
+        self._logger.info(f"特征缓存已失效: {instrument or '全部'}, 条目数: {count}")
+        return count
+    
+    def _entry_path(self, instrument: str, field: str, freq: str) -> Path:
+        return (
+            self._cache_dir / self._safe_name(freq) / self._safe_name(instrument)
+            / f"{self._safe_name(field)}.npz"
+        )
+    
+    @staticmethod
+    def _safe_name(name: str) -> str:
+        """把名称转换为安全的文件名 / Turn a name into a safe file name"""
+        return quote(name, safe="")
@@ -0,0 +1,134 @@
+"""
+可重现的随机数流模块 / Reproducible Random Streams Module
+从一个根种子按名称派生相互独立的随机数流，同一个种子和名称总是得到同一个序列，
+与线程调度和调用顺序无关
+Derives independent random streams from one root seed by name; the same seed
+and name always give the same sequence, whatever the thread scheduling or the
+order of the calls
+
+派生种子使用splitmix64混合根种子和名称的哈希，名称的哈希不依赖PYTHONHASHSEED，
+因此不同的进程之间也一致。
+Derived seeds mix the root seed with a hash of each name through splitmix64;
+the name hash doesn't depend on PYTHONHASHSEED, so it holds across processes
+too.
+
+Examples:
+    >>> streams = RandomStreams(42)
+    >>> streams.stream("ranking").random() == RandomStreams(42).stream("ranking").random()
+    True
+    >>> fold_seed = derive_seed(42, "fold", 3)
+"""
+
+import hashlib
+import random
+from typing import Dict, Hashable, Tuple
+
+
+_MASK64 = (1 << 64) - 1
+
+# 种子的取值范围，与random.SystemRandom().randrange(2 ** 63)一致
+SEED_BOUND = 1 << 63
+
+
+def new_seed() -> int:
+    """从系统熵源选取一个种子 / Pick a seed from the system's entropy source"""
+    return random.SystemRandom().randrange(SEED_BOUND)
+
+
+def splitmix64(x: int) -> int:
+    """
+    splitmix64的一步，把64位整数打散为另一个64位整数 / One splitmix64 step, scrambling a 64-bit integer into another
+    
+    Args:
+        x: 输入，只使用低64位 / Input; only the low 64 bits are used
+    
+    Returns:
+        int: 64位输出 / 64-bit output
+    """
+    x = (x + 0x9E3779B97F4A7C15) & _MASK64
+    x = ((x ^ (x >> 30)) * 0xBF58476D1CE4E5B9) & _MASK64
+    x = ((x ^ (x >> 27)) * 0x94D049BB133111EB) & _MASK64
+    return x ^ (x >> 31)
+
+
+def _key_bits(key: Hashable) -> int:
+    """名称的64位哈希，类型不同的名称（如1和"1"）哈希不同 / 64-bit hash of a name; 1 and "1" differ"""
+    text = f"{type(key).__name__}:{key!r}".encode("utf-8")
+    return int.from_bytes(hashlib.blake2b(text, digest_size=8).digest(), "little")
+
+
+def derive_seed(seed: int, *keys: Hashable) -> int:
+    """
+    从根种子和名称派生种子 / Derive a seed from a root seed and names
+    
+    Args:
+        seed: 根种子 / Root seed
+        *keys: 名称，如("fold", 3)；没有名称时返回打散后的根种子 /
+            Names such as ("fold", 3); with none the scrambled root seed is returned
+    
+    Returns:
+        int: [0, 2**63)内的种子 / Seed in [0, 2**63)
+    """
+    state = splitmix64(seed & _MASK64)
+    for key in keys:
+        state = splitmix64(state ^ _key_bits(key))
+    return state >> 1
+
+
+class RandomStreams:
+    """
+    按名称取用的随机数流集合 / Random streams looked up by name
+    
+    每个名称对应一个random.Random，第一次取用时用derive_seed(seed, *keys)播种，
+    之后返回同一个对象，因此序列只取决于种子、名称和该流自身的调用次数。
+    对象可以pickle，回测检查点用它保存随机数流的状态。
+    Each name maps to a random.Random seeded with derive_seed(seed, *keys) on
+    first use and returned as is afterwards, so a sequence depends only on the
+    seed, the name and the calls made on that stream. Instances pickle, which
+    is how backtest checkpoints keep the streams' state.
+    """
+    
+    def __init__(self, seed: int):
+        """
+        初始化随机数流 / Initialize the streams
+        
+        Args:
+            seed: 根种子 / Root seed
+        """
+        self._seed = seed
+        self._streams: Dict[Tuple[Hashable, ...], random.Random] = {}
+    
+    @property
+    def seed(self) -> int:
+        """根种子 / Root seed"""
+        return self._seed
+    
+    def stream(self, *keys: Hashable) -> random.Random:
+        """
+        获取名称对应的随机数流 / Get the stream for a name
+        
+        Args:
+            *keys: 名称，没有名称时为默认流 / Names; none for the default stream
+        
+        Returns:
+            random.Random: 该名称的随机数流 / The name's stream
+        """
+        rng = self._streams.get(keys)
+        if rng is None:
+            rng = self._streams[keys] = random.Random(derive_seed(self._seed, *keys))
+        return rng
+    
+    def spawn(self, *keys: Hashable) -> "RandomStreams":
+        """
+        派生一组独立的随机数流 / Spawn an independent set of streams
+        
+        Args:
+            *keys: 名称，如("fold", 3) / Names such as ("fold", 3)
+        
+        Returns:
+            RandomStreams: 以derive_seed(seed, *keys)为根种子的随机数流 / Streams rooted at derive_seed(seed, *keys)
+        """
+        return RandomStreams(derive_seed(self._seed, *keys))
+    
+    def __repr__(self) -> str:
+        return f"RandomStreams({self._seed})"
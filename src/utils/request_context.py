@@ -0,0 +1,220 @@
+"""
+请求上下文模块 / Request Context Module
+为耗时的数据获取等操作提供取消和超时控制
+Provides cancellation and deadlines for long-running operations such as data fetches
+"""
+
+import threading
+import time
+from typing import Callable, List, Optional
+
+from .error_handler import (
+    SystemError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+
+
+class ContextCancelledError(SystemError):
+    """
+    上下文已取消错误 / Context cancelled error
+    
+    deadline_exceeded为True表示因超时而取消，否则为主动取消
+    deadline_exceeded is True when the deadline passed, False for an explicit cancel
+    """
+    
+    def __init__(self, deadline_exceeded: bool = False, reason: Optional[str] = None):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            deadline_exceeded: 是否因超时取消 / Whether the deadline passed
+            reason: 取消原因 / Cancellation reason
+        """
+        self.deadline_exceeded = deadline_exceeded
+        self.reason = reason
+        if deadline_exceeded:
+            error_info = ErrorInfo(
+                error_code="SYS0004",
+                error_message_zh="操作超时",
+                error_message_en="Deadline exceeded",
+                category=ErrorCategory.SYSTEM,
+                severity=ErrorSeverity.MEDIUM,
+                technical_details=reason,
+                suggested_actions=["缩小查询范围", "增大超时时间"],
+                recoverable=True
+            )
+        else:
+            error_info = ErrorInfo(
+                error_code="SYS0003",
+                error_message_zh=f"操作已取消{': ' + reason if reason else ''}",
+                error_message_en=f"Operation cancelled{': ' + reason if reason else ''}",
+                category=ErrorCategory.SYSTEM,
+                severity=ErrorSeverity.LOW,
+                technical_details=reason,
+                suggested_actions=["如需结果请重新发起请求"],
+                recoverable=True
+            )
+        super().__init__(error_info)
+
+
+class RequestContext:
+    """
+    请求上下文 / Request context
+    
+    携带取消信号和截止时间。子上下文在父上下文取消时一同取消，
+    截止时间取两者中较早的一个。
+    Carries a cancellation signal and a deadline. A child context is
+    cancelled together with its parent, and its deadline is the earlier of
+    the two.
+    
+    Examples:
+        >>> ctx = RequestContext(timeout=30)
+        >>> result = manager.get_features_ctx(ctx, ["SH600000"], ["$close"])
+        >>> ctx.cancel()  # 在其他线程中取消 / cancel from another thread
+    """
+    
+    def __init__(
+        self,
+        timeout: Optional[float] = None,
+        parent: Optional["RequestContext"] = None
+    ):
+        """
+        初始化上下文 / Initialize context
+        
+        Args:
+            timeout: 超时时间（秒），None表示不限 / Timeout in seconds, None for no deadline
+            parent: 父上下文 / Parent context
+        """
+        self._parent = parent
+        self._event = threading.Event()
+        self._lock = threading.Lock()
+        self._error: Optional[ContextCancelledError] = None
+        self._callbacks: List[Callable[[], None]] = []
+        
+        deadline = None if timeout is None else time.monotonic() + timeout
+        if parent is not None and parent.deadline is not None:
+            deadline = parent.deadline if deadline is None else min(deadline, parent.deadline)
+        self._deadline = deadline
+        
+        if parent is not None:
+            parent.on_cancel(lambda: self._set_error(parent.err()))
+    
+    @property
+    def deadline(self) -> Optional[float]:
+        """截止时间（time.monotonic()时钟） / Deadline on the time.monotonic() clock"""
+        return self._deadline
+    
+    def remaining(self) -> Optional[float]:
+        """
+        距离截止时间的剩余秒数 / Seconds left until the deadline
+        
+        Returns:
+            Optional[float]: 没有截止时间时返回None / None without a deadline
+        """
+        if self._deadline is None:
+            return None
+        return max(0.0, self._deadline - time.monotonic())
+    
+    def cancel(self, reason: Optional[str] = None) -> None:
+        """
+        取消上下文 / Cancel the context
+        
+        Args:
+            reason: 取消原因 / Cancellation reason
+        """
+        self._set_error(ContextCancelledError(reason=reason))
+    
+    def err(self) -> Optional[ContextCancelledError]:
+        """
+        获取取消原因 / Get the cancellation error
+        
+        Returns:
+            Optional[ContextCancelledError]: 未取消时返回None / None while still active
+        """
+        if self._error is None and self._deadline is not None and time.monotonic() >= self._deadline:
+            self._set_error(ContextCancelledError(deadline_exceeded=True))
+        return self._error
+    
+    @property
+    def cancelled(self) -> bool:
+        """是否已取消或超时 / Whether cancelled or past the deadline"""
+        return self.err() is not None
+    
+    def check(self) -> None:
+        """
+        已取消时抛出错误 / Raise if the context is done
+        
+        Raises:
+            ContextCancelledError: 已取消或超时时抛出 / Raised when cancelled or past the deadline
+        """
+        error = self.err()
+        if error is not None:
+            raise error
+    
+    def wait(self, timeout: Optional[float] = None) -> bool:
+        """
+        等待上下文结束 / Wait for the context to finish
+        
+        Args:
+            timeout: 最长等待秒数 / Maximum seconds to wait
+        
+        Returns:
+            bool: 上下文已结束返回True / True when the context is done
+        """
+        remaining = self.remaining()
+        if remaining is not None:
+            timeout = remaining if timeout is None else min(timeout, remaining)
+        self._event.wait(timeout)
+        return self.cancelled
+    
+    def on_cancel(self, callback: Callable[[], None]) -> None:
+        """
+        注册取消回调，已取消时立即调用 / Register a cancel callback, called at once if already done
+        
+        可用于在取消时关闭已打开的文件或连接。超时不会主动触发回调，
+        而是在下一次err()/check()检查到时触发。
+        Useful for closing files or connections on cancel. A deadline does not
+        fire callbacks by itself; they fire when err()/check() next notices it.
+        
+        Args:
+            callback: 无参数回调 / Zero-argument callback
+        """
+        with self._lock:
+            if self._error is None:
+                self._callbacks.append(callback)
+                return
+        callback()
+    
+    def child(self, timeout: Optional[float] = None) -> "RequestContext":
+        """
+        派生子上下文 / Derive a child context
+        
+        Args:
+            timeout: 子上下文的超时时间（秒） / Child timeout in seconds
+        
+        Returns:
+            RequestContext: 子上下文 / Child context
+        """
+        return RequestContext(timeout=timeout, parent=self)
+    
+    def _set_error(self, error: Optional[ContextCancelledError]) -> None:
+        with self._lock:
+            if self._error is not None or error is None:
+                return
+            self._error = error
+            callbacks, self._callbacks = self._callbacks, []
+        self._event.set()
+        for callback in callbacks:
+            callback()
+
+
+def background() -> RequestContext:
+    """
+    获取不会取消、没有截止时间的上下文 / Get a context that is never cancelled and has no deadline
+    
+    Returns:
+        RequestContext: 新的空上下文 / A fresh empty context
+    """
+    return RequestContext()
@@ -0,0 +1,171 @@
+"""
+重试模块 / Retry Module
+对网络抖动等暂时性错误按指数退避重试，退避期间响应请求上下文的取消和超时
+Retries transient failures such as network hiccups with exponential backoff,
+honouring request context cancellation and deadlines while backing off
+"""
+
+import random
+from dataclasses import dataclass, field
+from typing import Callable, Optional, Tuple, Type, TypeVar
+
+from .error_handler import (
+    NetworkError,
+    SystemError,
+    ErrorInfo,
+    ErrorCategory,
+    ErrorSeverity
+)
+from .request_context import ContextCancelledError, RequestContext
+
+
+T = TypeVar("T")
+
+# 默认视为暂时性、值得重试的错误
+TRANSIENT_ERRORS: Tuple[Type[BaseException], ...] = (NetworkError, ConnectionError, TimeoutError)
+
+
+class RetryExhaustedError(SystemError):
+    """
+    重试次数用尽错误 / Retry exhausted error
+    
+    last_error为最后一次尝试的错误，instrument为失败的标的（与标的无关时为None）
+    last_error is the error of the final attempt and instrument the instrument
+    that failed (None when the call is not per instrument)
+    """
+    
+    def __init__(self, instrument: Optional[str], attempts: int, last_error: Exception):
+        """
+        初始化错误 / Initialize error
+        
+        Args:
+            instrument: 失败的标的 / Instrument that failed
+            attempts: 尝试次数 / Number of attempts made
+            last_error: 最后一次尝试的错误 / Error of the final attempt
+        """
+        self.instrument = instrument
+        self.attempts = attempts
+        self.last_error = last_error
+        target = f" {instrument}" if instrument else ""
+        error_info = ErrorInfo(
+            error_code="SYS0006",
+            error_message_zh=f"重试{attempts}次后仍然失败{target}: {last_error}",
+            error_message_en=f"Still failing{target} after {attempts} attempts: {last_error}",
+            category=ErrorCategory.NETWORK,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details=f"instrument={instrument}, attempts={attempts}, last_error={last_error!r}",
+            suggested_actions=[
+                "检查网络连接和数据源状态",
+                "增大重试次数或退避时间"
+            ],
+            recoverable=True,
+            original_exception=last_error
+        )
+        super().__init__(error_info)
+
+
+@dataclass(frozen=True)
+class RetryPolicy:
+    """
+    重试策略 / Retry policy
+    
+    第n次重试前等待min(max_delay, initial_delay * multiplier ** (n - 1))秒，
+    再乘以[1 - jitter, 1 + jitter]之间的随机系数，避免多个请求同时重试
+    The n-th retry waits min(max_delay, initial_delay * multiplier ** (n - 1))
+    seconds, scaled by a random factor in [1 - jitter, 1 + jitter] so that
+    concurrent requests don't retry in lockstep
+    
+    Attributes:
+        max_attempts: 包括第一次在内的最多尝试次数，1表示不重试 /
+            Maximum attempts including the first, 1 disables retries
+        initial_delay: 第一次重试前的等待秒数 / Seconds before the first retry
+        max_delay: 单次等待的上限秒数 / Upper bound of a single wait in seconds
+        multiplier: 每次重试等待时间的倍数 / Growth factor of the wait per retry
+        jitter: 随机抖动比例，取值[0, 1] / Random jitter fraction in [0, 1]
+        retry_on: 需要重试的错误类型 / Error types to retry
+        seed: 抖动随机数的种子，None时每个策略使用不可复现的随机序列 /
+            Seed of the jitter random numbers; None gives each policy a non-reproducible sequence
+    
+    Examples:
+        >>> policy = RetryPolicy(max_attempts=5, initial_delay=0.2)
+        >>> manager.get_features_ctx(ctx, codes, ["$close"], retry=policy)
+    """
+    max_attempts: int = 3
+    initial_delay: float = 0.5
+    max_delay: float = 10.0
+    multiplier: float = 2.0
+    jitter: float = 0.1
+    retry_on: Tuple[Type[BaseException], ...] = TRANSIENT_ERRORS
+    seed: Optional[int] = None
+    _rng: random.Random = field(init=False, repr=False, compare=False)
+    
+    def __post_init__(self):
+        if self.max_attempts < 1:
+            raise ValueError(f"max_attempts must be >= 1, got {self.max_attempts}")
+        if self.initial_delay < 0 or self.max_delay < 0:
+            raise ValueError(f"delays must be non-negative, got {self.initial_delay} and {self.max_delay}")
+        if self.multiplier < 1:
+            raise ValueError(f"multiplier must be >= 1, got {self.multiplier}")
+        if not 0 <= self.jitter <= 1:
+            raise ValueError(f"jitter must be in [0, 1], got {self.jitter}")
+        object.__setattr__(self, "_rng", random.Random(self.seed))
+    
+    def delay(self, retry: int) -> float:
+        """
+        第retry次重试前的等待秒数 / Seconds to wait before the retry-th retry
+        
+        Args:
+            retry: 重试序号，从1开始 / Retry number, starting at 1
+        
+        Returns:
+            float: 等待秒数 / Seconds to wait
+        """
+        base = min(self.max_delay, self.initial_delay * self.multiplier ** (retry - 1))
+        return max(0.0, base * (1 + self._rng.uniform(-self.jitter, self.jitter)))
+    
+    def is_transient(self, error: BaseException) -> bool:
+        """是否为需要重试的错误，上下文取消永不重试 / Whether to retry the error; cancellation never is"""
+        return isinstance(error, self.retry_on) and not isinstance(error, ContextCancelledError)
+    
+    def call(
+        self,
+        ctx: RequestContext,
+        fn: Callable[[], T],
+        instrument: Optional[str] = None,
+        on_retry: Optional[Callable[[int, Exception, float], None]] = None
+    ) -> T:
+        """
+        调用fn，遇到暂时性错误时退避后重试 / Call fn, backing off and retrying on transient errors
+        
+        Args:
+            ctx: 请求上下文，退避期间取消或超时立即停止 / Request context; a cancel or deadline during backoff stops at once
+            fn: 无参数的调用 / Zero-argument call
+            instrument: 写入RetryExhaustedError的标的 / Instrument recorded in RetryExhaustedError
+            on_retry: 每次重试前的回调，参数为(尝试序号, 错误, 等待秒数) /
+                Called before each retry with (attempt, error, wait seconds)
+        
+        Returns:
+            fn的返回值 / fn's return value
+        
+        Raises:
+            RetryExhaustedError: 所有尝试都因暂时性错误失败时抛出 / Raised when every attempt fails transiently
+            ContextCancelledError: 上下文已取消或超时时抛出 / Raised when the context is done
+            其他错误原样抛出，不重试 / Other errors propagate without a retry
+        """
+        last_error: Optional[Exception] = None
+        for attempt in range(1, self.max_attempts + 1):
+            ctx.check()
+            try:
+                return fn()
+            except Exception as e:
+                if not self.is_transient(e):
+                    raise
+                last_error = e
+            if attempt == self.max_attempts:
+                break
+            wait = self.delay(attempt)
+            if on_retry is not None:
+                on_retry(attempt, last_error, wait)
+            if ctx.wait(wait):
+                ctx.check()
+        raise RetryExhaustedError(instrument, self.max_attempts, last_error) from last_error
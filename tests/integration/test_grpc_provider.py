@@ -0,0 +1,208 @@
+"""
+Integration tests for the gRPC data service and GRPCProvider
+gRPC数据服务和远程数据提供者集成测试
+"""
+
+import threading
+
+import pandas as pd
+import pytest
+
+grpc = pytest.importorskip("grpc")
+pytest.importorskip("grpc_tools")
+
+from src.core.data_manager import DataManager
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import (
+    FundamentalsUnavailableError,
+    InstrumentNotFoundError,
+    UnsupportedFrequencyError
+)
+from src.infrastructure.subscription import LiveBar, Subscription
+from src.server.data_service import create_data_server
+from src.server.frame_codec import ZSTD_AVAILABLE
+from src.server.grpc_client import DataServiceUnavailableError, GRPCProvider
+from src.utils.request_context import ContextCancelledError, RequestContext
+
+
+CSV_CONTENT = """date,open,close,volume
+2025-01-02,10.0,10.2,1000
+2025-01-03,10.2,10.6,1200
+2025-01-06,10.6,10.4,900
+2025-01-07,10.4,10.8,1100
+"""
+
+FUNDAMENTALS_CSV = """announce_date,period_end,pe_ttm,pb
+2024-10-30,2024-09-30,10.0,1.0
+2025-04-29,2025-03-31,13.0,1.3
+"""
+
+
+class GatedProvider(CSVDataProvider):
+    """Blocks feature reads until the gate opens or the request context is done"""
+    
+    def __init__(self, data_dir):
+        super().__init__(data_dir)
+        self.entered = threading.Event()
+        self.gate = threading.Event()
+        self.cancelled = threading.Event()
+    
+    def load_features_ctx(self, ctx, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.entered.set()
+        ctx.on_cancel(self.gate.set)
+        self.gate.wait(5)
+        if ctx.cancelled:
+            self.cancelled.set()
+            ctx.check()
+        return super().load_features_ctx(ctx, instrument, fields, start_time, end_time, freq)
+
+
+class PushingProvider(CSVDataProvider):
+    """Publishes fixed bars and keeps the subscription open until the context is done"""
+    
+    bars = [
+        LiveBar("SH600000", pd.Timestamp("2025-01-08"), {"$close": 10.9}),
+        LiveBar("SH600000", pd.Timestamp("2025-01-09"), {"$close": 11.0}),
+        LiveBar("SH600000", pd.Timestamp("2025-01-09"), {"$close": 11.1}),
+    ]
+    
+    def subscribe(self, ctx, instruments, fields, freq="1min"):
+        subscription = Subscription(ctx, instruments, fields, freq)
+        for bar in self.bars:
+            subscription.publish(bar)
+        return subscription
+
+
+@pytest.fixture
+def data_dir(tmp_path):
+    for code in ("SH600000", "SZ000001"):
+        (tmp_path / f"{code}.csv").write_text(CSV_CONTENT)
+    (tmp_path / "fundamentals").mkdir()
+    (tmp_path / "fundamentals" / "SH600000.csv").write_text(FUNDAMENTALS_CSV)
+    return str(tmp_path)
+
+
+@pytest.fixture
+def serve():
+    servers, clients = [], []
+    
+    def start(provider, compression="none", **kwargs):
+        server, port = create_data_server("127.0.0.1:0", provider, **kwargs)
+        server.start()
+        servers.append(server)
+        client = GRPCProvider(f"127.0.0.1:{port}", compression=compression)
+        clients.append(client)
+        return client
+    
+    yield start
+    for client in clients:
+        client.close()
+    for server in servers:
+        server.stop(None)
+
+
+class TestGRPCProvider:
+    """远程数据提供者测试类"""
+    
+    @pytest.mark.parametrize("compression", [
+        "none",
+        pytest.param("zstd", marks=pytest.mark.skipif(not ZSTD_AVAILABLE, reason="zstandard not installed")),
+    ])
+    def test_features_match_local(self, data_dir, serve, compression):
+        local = CSVDataProvider(data_dir)
+        remote = serve(local, compression)
+        
+        pd.testing.assert_frame_equal(
+            remote.load_features("SH600000", ["$close", "$volume"], "2025-01-03", "2025-01-06"),
+            local.load_features("SH600000", ["$close", "$volume"], "2025-01-03", "2025-01-06")
+        )
+        batch = remote.features(["SZ000001", "SH600000"], ["$open"])
+        assert list(batch) == ["SZ000001", "SH600000"]
+        pd.testing.assert_frame_equal(batch["SH600000"], local.load_features("SH600000", ["$open"]))
+    
+    def test_calendar_fundamentals_and_metadata(self, data_dir, serve):
+        local = CSVDataProvider(data_dir)
+        remote = serve(local)
+        
+        assert remote.calendar("2025-01-03") == local.calendar("2025-01-03")
+        assert remote.freqs == local.freqs
+        assert remote.remote_name == "csv"
+        assert remote.list_instruments() == ["SH600000", "SZ000001"]
+        assert remote.list_fields("SH600000") == local.list_fields("SH600000")
+        
+        records = remote.fundamentals(["SH600000"], ["pe_ttm"])
+        pd.testing.assert_frame_equal(records["SH600000"], local.fundamentals(["SH600000"], ["pe_ttm"])["SH600000"])
+    
+    def test_errors_keep_their_type(self, data_dir, serve):
+        remote = serve(CSVDataProvider(data_dir))
+        
+        with pytest.raises(InstrumentNotFoundError) as exc_info:
+            remote.load_features("SH999999", ["$close"])
+        assert exc_info.value.instrument == "SH999999"
+        with pytest.raises(UnsupportedFrequencyError):
+            remote.load_features("SH600000", ["$close"], freq="5min")
+        with pytest.raises(FundamentalsUnavailableError):
+            remote.fundamentals(["SZ000001"], ["pe_ttm"])
+    
+    def test_data_manager_over_grpc(self, data_dir, serve):
+        """表达式由客户端的DataManager计算，结果与本地相同"""
+        local = CSVDataProvider(data_dir)
+        remote = serve(local)
+        fields = ["$close", "Mean($close,2)"]
+        
+        expected = DataManager(enable_cache=False, provider=local).get_features("SH600000", fields)
+        actual = DataManager(enable_cache=False, provider=remote).get_features("SH600000", fields)
+        
+        pd.testing.assert_frame_equal(actual["SH600000"], expected["SH600000"])
+    
+    def test_deadline_cancels_server_reads(self, data_dir, serve):
+        provider = GatedProvider(data_dir)
+        remote = serve(provider)
+        
+        with pytest.raises(ContextCancelledError) as exc_info:
+            remote.load_features_ctx(RequestContext(timeout=0.3), "SH600000", ["$close"])
+        
+        assert exc_info.value.deadline_exceeded
+        assert provider.cancelled.wait(2)
+    
+    def test_cancel_aborts_call(self, data_dir, serve):
+        provider = GatedProvider(data_dir)
+        remote = serve(provider)
+        ctx = RequestContext()
+        threading.Thread(target=lambda: provider.entered.wait(5) and ctx.cancel("stop")).start()
+        
+        with pytest.raises(ContextCancelledError):
+            remote.load_features_ctx(ctx, "SH600000", ["$close"])
+        assert provider.cancelled.wait(2)
+    
+    def test_concurrent_request_limit(self, data_dir, serve):
+        provider = GatedProvider(data_dir)
+        remote = serve(provider, max_concurrent_requests=1)
+        results = []
+        first = threading.Thread(target=lambda: results.append(remote.load_features("SH600000", ["$close"])))
+        first.start()
+        assert provider.entered.wait(5)
+        
+        with pytest.raises(DataServiceUnavailableError) as exc_info:
+            remote.load_features("SZ000001", ["$close"])
+        
+        assert exc_info.value.status == "RESOURCE_EXHAUSTED"
+        provider.gate.set()
+        first.join(5)
+        assert len(results[0]) == 4
+    
+    def test_subscribe_streams_bars(self, data_dir, serve):
+        remote = serve(PushingProvider(data_dir))
+        ctx = RequestContext()
+        
+        subscription = remote.subscribe(ctx, ["SH600000"], ["$close"], "day")
+        bars = [subscription.next(timeout=5)[0] for _ in range(3)]
+        
+        assert [(bar.time, bar["$close"], bar.revised) for bar in bars] == [
+            (pd.Timestamp("2025-01-08"), 10.9, False),
+            (pd.Timestamp("2025-01-09"), 11.0, False),
+            (pd.Timestamp("2025-01-09"), 11.1, True),
+        ]
+        ctx.cancel()
+        assert subscription.next(timeout=5) == (None, False)
+        assert subscription.error is None
@@ -0,0 +1,132 @@
+"""
+Integration tests for the feature gRPC server
+特征数据gRPC服务集成测试
+"""
+
+import threading
+
+import numpy as np
+import pytest
+
+grpc = pytest.importorskip("grpc")
+pytest.importorskip("grpc_tools")
+
+from src.core.data_manager import DataManager
+from src.server.grpc_server import create_grpc_server, grpc_protos
+from tests.unit._providers import StaticProvider
+
+
+class SlowProvider(StaticProvider):
+    """Waits on the request context and records whether it was cancelled"""
+    
+    name = "slow"
+    
+    def __init__(self):
+        super().__init__()
+        self.cancelled = threading.Event()
+    
+    def load_features_ctx(self, ctx, instrument, fields, start_time=None, end_time=None, freq="day"):
+        if ctx.wait(5):
+            self.cancelled.set()
+            ctx.check()
+        return super().load_features_ctx(ctx, instrument, fields, start_time, end_time, freq)
+
+
+def _serve(provider):
+    server, port = create_grpc_server(
+        "127.0.0.1:0", manager=DataManager(enable_cache=False, provider=provider)
+    )
+    server.start()
+    channel = grpc.insecure_channel(f"127.0.0.1:{port}")
+    _, services = grpc_protos()
+    return server, channel, services.FeatureServiceStub(channel)
+
+
+@pytest.fixture
+def protos():
+    return grpc_protos()[0]
+
+
+@pytest.fixture
+def stub():
+    server, channel, stub = _serve(StaticProvider())
+    yield stub
+    channel.close()
+    server.stop(None)
+
+
+class TestFeatureService:
+    """FeatureService测试类"""
+    
+    def test_features(self, stub, protos):
+        response = stub.Features(protos.FeaturesRequest(
+            instruments=["SH000300"], fields=["$close", "$volume"],
+            start="2025-01-03", end="2025-01-05"
+        ))
+        
+        assert len(response.instruments) == 1
+        data = response.instruments[0]
+        assert data.instrument == "SH000300"
+        # 2025-01-03 00:00 Asia/Shanghai
+        assert data.timestamps[0] == 1735833600
+        assert [column.field for column in data.columns] == ["$close", "$volume"]
+        close = list(data.columns[0].values)
+        assert close[0] == 11.0 and np.isnan(close[1]) and close[2] == 12.0
+        assert list(data.columns[1].values) == [200.0, 300.0, 400.0]
+    
+    def test_rfc3339_offset_is_converted(self, stub, protos):
+        """带时区偏移的时间换算为交易所时间"""
+        response = stub.Features(protos.FeaturesRequest(
+            instruments=["SH000300"], fields=["$close"],
+            start="2025-01-03T16:00:00Z", end="2025-01-04T16:00:00Z"
+        ))
+        
+        # 2025-01-04 00:00 和 2025-01-05 00:00 Asia/Shanghai
+        assert list(response.instruments[0].timestamps) == [1735920000, 1736006400]
+    
+    def test_stream(self, stub, protos):
+        chunks = list(stub.FeaturesStream(protos.FeaturesRequest(
+            instruments=["SH000300"], fields=["$volume"], chunk_bars=2
+        )))
+        
+        assert [chunk.sequence for chunk in chunks] == [0, 1, 2]
+        values = [v for chunk in chunks for v in chunk.data.columns[0].values]
+        assert values == [100.0, 200.0, 300.0, 400.0, 500.0]
+    
+    @pytest.mark.parametrize("request_kwargs", [
+        {"fields": ["$close"]},
+        {"instruments": ["SH000300"]},
+        {"instruments": ["SH000300"], "fields": ["$close"], "start": "not-a-date"},
+        {"instruments": ["SH000300"], "fields": ["$close"], "start": "2025-02-01", "end": "2025-01-01"},
+        {"instruments": ["SH000300"], "fields": ["$close"], "freq": "3min"},
+        {"instruments": ["SH000300"], "fields": ["Mean($close"]},
+    ])
+    def test_invalid_argument(self, stub, protos, request_kwargs):
+        with pytest.raises(grpc.RpcError) as exc_info:
+            stub.Features(protos.FeaturesRequest(**request_kwargs))
+        
+        assert exc_info.value.code() == grpc.StatusCode.INVALID_ARGUMENT
+    
+    def test_unknown_instrument(self, stub, protos):
+        with pytest.raises(grpc.RpcError) as exc_info:
+            stub.Features(protos.FeaturesRequest(instruments=["SZ399999"], fields=["$close"]))
+        
+        assert exc_info.value.code() == grpc.StatusCode.NOT_FOUND
+        assert "SZ399999" in exc_info.value.details()
+    
+    def test_deadline_cancels_provider_reads(self, protos):
+        """客户端超时传递到提供者，读取随之中止"""
+        provider = SlowProvider()
+        server, channel, stub = _serve(provider)
+        try:
+            with pytest.raises(grpc.RpcError) as exc_info:
+                stub.Features(
+                    protos.FeaturesRequest(instruments=["SH000300"], fields=["$close"]),
+                    timeout=0.2
+                )
+            
+            assert exc_info.value.code() == grpc.StatusCode.DEADLINE_EXCEEDED
+            assert provider.cancelled.wait(2)
+        finally:
+            channel.close()
+            server.stop(None)
@@ -0,0 +1,102 @@
+"""
+Shared fake data providers and frame builders for the unit tests
+单元测试共用的假数据提供者和数据构造函数
+"""
+
+import threading
+
+import numpy as np
+import pandas as pd
+
+from src.core.feature_frame import FeatureFrame
+from src.infrastructure.data_provider import DataProvider, InstrumentNotFoundError
+
+
+def clip_range(frame, start_time=None, end_time=None):
+    """Keep the rows within [start_time, end_time], either end may be open"""
+    if start_time is not None:
+        frame = frame[frame.index >= pd.Timestamp(start_time)]
+    if end_time is not None:
+        frame = frame[frame.index <= pd.Timestamp(end_time)]
+    return frame
+
+
+def daily_bars(start, periods, close=10.0):
+    """Business-day closes rising by 1 from close, with volumes rising from 1000"""
+    index = pd.bdate_range(start, periods=periods, name="datetime")
+    return pd.DataFrame({
+        "$close": [close + i for i in range(periods)],
+        "$volume": [1000.0 + i for i in range(periods)],
+    }, index=index)
+
+
+def column_frame(days, column, values):
+    """One-column FeatureFrame over the given days"""
+    return FeatureFrame({column: values}, index=pd.DatetimeIndex(days, name="datetime"))
+
+
+class FakeProvider(DataProvider):
+    """Serves a mutable frame per instrument over the requested range and records every request"""
+    
+    name = "fake"
+    
+    def __init__(self, frames, days=()):
+        self.frames = frames
+        self.days = list(days)
+        self.calls = []
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.calls.append((instrument, start_time, end_time))
+        if instrument not in self.frames:
+            raise InstrumentNotFoundError(instrument, self.name)
+        return pd.DataFrame(clip_range(self.frames[instrument][fields], start_time, end_time))
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(self.days)
+    
+    def list_instruments(self, market="all", freq="day"):
+        return sorted(self.frames)
+
+
+class StaticProvider(DataProvider):
+    """Serves a fixed daily series for SH000300 only"""
+    
+    name = "static"
+    
+    def __init__(self):
+        index = pd.date_range("2025-01-02", periods=5, freq="D", name="datetime")
+        self.frame = pd.DataFrame({
+            "$close": [10.0, 11.0, np.nan, 12.0, 13.0],
+            "$volume": [100.0, 200.0, 300.0, 400.0, 500.0],
+        }, index=index)
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        if instrument != "SH000300":
+            return pd.DataFrame(columns=fields)
+        return clip_range(self.frame[fields], start_time, end_time)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(self.frame.index)
+
+
+class CountingProvider(DataProvider):
+    """Serves a fixed daily series from 2025-01-01 to end and records every request"""
+    
+    name = "counting"
+    
+    def __init__(self, end="2025-12-31"):
+        index = pd.date_range("2025-01-01", end, freq="D", name="datetime")
+        self.frame = pd.DataFrame({
+            "$close": [float(i) for i in range(len(index))],
+            "$open": [float(i) + 0.5 for i in range(len(index))],
+        }, index=index)
+        self.calls = []
+        self._lock = threading.Lock()
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        with self._lock:
+            self.calls.append((instrument, tuple(fields), start_time, end_time))
+        return clip_range(self.frame[fields], start_time, end_time)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(self.frame.index)
@@ -0,0 +1,216 @@
+"""
+Unit tests for P&L attribution
+盈亏归因单元测试
+"""
+
+from dataclasses import replace
+
+import pandas as pd
+import pytest
+
+from src.application.attribution import UNCLASSIFIED_SECTOR
+from src.application.backtest_engine import EngineConfig, Order, OrderSide, Strategy, percent_commission, run
+from src.core.feature_frame import FeatureFrame
+from src.core import sectors
+from src.core.sectors import register_sector
+from src.infrastructure.data_provider import CashDividend, Split
+
+
+INDEX = pd.bdate_range("2025-01-02", "2025-02-28")
+SPLIT_DAY = pd.Timestamp("2025-01-15")
+
+
+def _frame(base, step, split=None):
+    """价格逐日上涨，拆股日起原始价格除以拆股比例 / Prices rise daily and divide by the ratio from the split on"""
+    closes = [(base + step * i) / (2.0 if split is not None and day >= split else 1.0) for i, day in enumerate(INDEX)]
+    opens = [closes[0]] + closes[:-1]
+    if split is not None:
+        # 拆股日以拆股后的价格开盘
+        opens[INDEX.get_loc(split)] /= 2.0
+    return FeatureFrame({
+        "$open": opens,
+        "$high": [max(o, c) * 1.01 for o, c in zip(opens, closes)],
+        "$low": [min(o, c) * 0.99 for o, c in zip(opens, closes)],
+        "$close": closes,
+    }, index=INDEX)
+
+
+class Scripted(Strategy):
+    """按日期下固定的订单 / Places fixed orders on given days"""
+    
+    def __init__(self, orders):
+        self.orders = {pd.Timestamp(day): list(items) for day, items in orders.items()}
+    
+    def on_bar(self, ctx, portfolio, bars):
+        return self.orders.get(ctx.time)
+
+
+@pytest.fixture
+def data():
+    return {
+        "SH600000": _frame(10.0, 0.1, split=SPLIT_DAY),
+        "SZ000001": _frame(20.0, -0.05),
+    }
+
+
+def _run(data, orders, **kwargs):
+    config = EngineConfig(
+        start_time="2025-01-01",
+        end_time="2025-02-28",
+        data=data,
+        initial_cash=100_000.0,
+        commission=percent_commission(0.001, minimum=1.0),
+        corporate_actions={
+            "SH600000": [
+                CashDividend("SH600000", pd.Timestamp("2025-01-10"), 0.5),
+                Split("SH600000", SPLIT_DAY, 2.0),
+            ]
+        },
+        dividend_tax_rate=0.1,
+        **kwargs
+    )
+    return run(config, Scripted(orders))
+
+
+@pytest.fixture
+def result(data):
+    return _run(data, {
+        "2025-01-02": [Order("SH600000", OrderSide.BUY, 1000)],
+        "2025-01-06": [Order("SZ000001", OrderSide.BUY, 500)],
+        "2025-01-20": [Order("SZ000001", OrderSide.SELL, 500)],
+        "2025-02-05": [Order("SH600000", OrderSide.SELL, 2000)],
+        "2025-02-10": [Order("SZ000001", OrderSide.BUY, 500)],
+    })
+
+
+class TestBreakdown:
+    """盈亏分解测试类"""
+    
+    def test_pieces_reconcile_with_equity(self, result):
+        report = result.attribution()
+        
+        assert report.change == pytest.approx(result.final_equity - 100_000.0)
+        assert abs(report.residual) <= report.tolerance
+        assert report.reconciles()
+        for rows in (report.by_instrument, report.by_month):
+            for row in rows:
+                assert row.total == pytest.approx(row.price + row.dividends - row.costs)
+            assert sum(row.total for row in rows) == pytest.approx(report.change, abs=report.tolerance)
+    
+    def test_dividends_and_costs(self, result):
+        report = result.attribution()
+        
+        rows = {row.key: row for row in report.by_instrument}
+        # 1000股每股0.5的税前分红，代扣的10%计入成本
+        assert rows["SH600000"].dividends == pytest.approx(500.0)
+        assert rows["SZ000001"].dividends == 0.0
+        breakdown = result.pnl_breakdown()
+        assert report.total.costs == pytest.approx(breakdown.costs)
+        assert report.total.price == pytest.approx(breakdown.gross - 500.0)
+    
+    def test_by_month(self, result):
+        report = result.attribution()
+        
+        assert [row.key for row in report.by_month] == ["2025-01", "2025-02"]
+        assert report.by_month[0].dividends == pytest.approx(500.0)
+        assert report.by_month[1].dividends == 0.0
+    
+    def test_by_sector(self, result, monkeypatch):
+        monkeypatch.setattr(sectors, "_SECTORS", {})
+        assert result.attribution().by_sector == []
+        
+        register_sector("SH600000", "银行")
+        report = result.attribution()
+        
+        assert {row.key for row in report.by_sector} == {"银行", UNCLASSIFIED_SECTOR}
+        rows = {row.key: row for row in report.by_instrument}
+        bank = next(row for row in report.by_sector if row.key == "银行")
+        assert bank.total == pytest.approx(rows["SH600000"].total)
+        assert report.reconciles()
+    
+    def test_fails_when_pieces_do_not_add_up(self, result):
+        report = result.attribution()
+        
+        report.by_month[0].price += 1.0
+        
+        assert not report.reconciles()
+    
+    def test_requires_instrument_pnl(self, result):
+        with pytest.raises(ValueError):
+            replace(result, instrument_pnl=FeatureFrame()).attribution()
+        with pytest.raises(ValueError):
+            replace(result, initial_cash=None).attribution()
+
+
+class TestTradeStats:
+    """逐笔交易统计测试类"""
+    
+    def test_closed_trades(self, result, data):
+        trades = result.attribution().trades
+        
+        # 2月11日买入的SZ000001仍然持有，不计入
+        assert [(t.instrument, t.exit_time) for t in trades] == [
+            ("SZ000001", pd.Timestamp("2025-01-21")), ("SH600000", pd.Timestamp("2025-02-06"))
+        ]
+        sz, sh = trades
+        assert (sz.direction, sz.quantity, sz.holding_days) == (1, 500, 10)
+        assert sz.entry_price == data["SZ000001"]["$open"].loc["2025-01-07"]
+        assert sz.return_ == pytest.approx(sz.exit_price / sz.entry_price - 1)
+        # 拆股后按2000股和拆股后的价格计算
+        assert sh.quantity == pytest.approx(2000)
+        assert sh.entry_price == pytest.approx(data["SH600000"]["$open"].loc["2025-01-03"] / 2.0)
+        assert sh.exit_price == data["SH600000"]["$open"].loc["2025-02-06"]
+        fills = [t for t in result.trades if t.instrument == "SH600000"]
+        assert sh.pnl == pytest.approx(sum(t.realized_pnl - t.commission for t in fills))
+        assert sh.mae is None and sh.mfe is None
+    
+    def test_excursions(self, result, data):
+        sz, sh = result.attribution(prices=data).trades
+        
+        frame = data["SH600000"].loc["2025-01-03":"2025-02-06"]
+        adjusted = frame["$high"].where(frame.index >= SPLIT_DAY, frame["$high"] / 2.0)
+        assert sh.mfe == pytest.approx(adjusted.max() / sh.entry_price - 1)
+        assert sh.mae <= 0.0
+        # SZ000001持有期间单边下跌
+        frame = data["SZ000001"].loc["2025-01-07":"2025-01-21"]
+        assert sz.mae == pytest.approx(frame["$low"].min() / sz.entry_price - 1)
+        assert sz.mae < 0.0 <= sz.mfe
+    
+    def test_reversal_splits_the_fill(self, data):
+        result = _run(data, {
+            "2025-01-20": [Order("SZ000001", OrderSide.BUY, 100)],
+            "2025-01-22": [Order("SZ000001", OrderSide.SELL, 300)],
+            "2025-01-27": [Order("SZ000001", OrderSide.BUY, 200)],
+        }, allow_short=True)
+        
+        long, short = result.attribution().trades
+        
+        assert (long.direction, long.quantity, long.exit_time) == (1, 100, pd.Timestamp("2025-01-23"))
+        assert (short.direction, short.quantity, short.entry_time) == (-1, 200, pd.Timestamp("2025-01-23"))
+        # 价格下跌，空头盈利
+        assert short.return_ > 0
+        fills = {t.time: t for t in result.trades}
+        reversal = fills[pd.Timestamp("2025-01-23")]
+        assert long.pnl + short.pnl == pytest.approx(sum(t.realized_pnl - t.commission for t in result.trades))
+        assert short.pnl == pytest.approx(
+            fills[pd.Timestamp("2025-01-28")].realized_pnl - fills[pd.Timestamp("2025-01-28")].commission
+            - reversal.commission * 2 / 3
+        )
+
+
+class TestExport:
+    """CSV导出测试类"""
+    
+    def test_write_csv(self, result, data, tmp_path):
+        report = result.attribution(prices=data)
+        
+        report.write_csv(tmp_path / "attribution")
+        
+        instruments = pd.read_csv(tmp_path / "attribution" / "attribution_instruments.csv")
+        assert instruments.columns.tolist() == ["key", "price", "dividends", "costs", "total"]
+        assert instruments["total"].sum() == pytest.approx(report.change, abs=report.tolerance)
+        trades = pd.read_csv(tmp_path / "attribution" / "attribution_trades.csv")
+        assert trades["instrument"].tolist() == ["SZ000001", "SH600000"]
+        assert "return" in trades.columns and "mae" in trades.columns
+        assert (tmp_path / "attribution" / "attribution_months.csv").exists()
+        assert (tmp_path / "attribution" / "attribution_sectors.csv").exists()
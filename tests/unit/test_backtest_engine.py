@@ -0,0 +1,1520 @@
+"""
+回测引擎单元测试 / Backtest Engine Unit Tests
+"""
+
+import io
+import json
+import logging
+import os
+import signal
+import sys
+import time
+from dataclasses import replace
+
+import numpy as np
+import pytest
+import pandas as pd
+
+from src.application.backtest_engine import (
+    A_SHARE_ROUNDING,
+    AShareCostModel,
+    BacktestEngine,
+    BacktestInterruptedError,
+    BarContext,
+    CombinedCost,
+    CostModel,
+    EngineConfig,
+    EngineResult,
+    ExecutionMode,
+    Fill,
+    FillKind,
+    FixedBpsCommission,
+    FixedBpsSlippage,
+    LimitAction,
+    LookaheadError,
+    LotRoundingError,
+    LotSize,
+    Order,
+    OrderSide,
+    OrderType,
+    PerShareCommission,
+    RandomSlippage,
+    RiskLimitError,
+    RiskLimits,
+    RoundingPolicy,
+    Snapshotter,
+    SpreadSlippage,
+    Strategy,
+    SuspensionPolicy,
+    TickSize,
+    VolumeShareSlippage,
+    ZeroCost,
+    fixed_bps_slippage,
+    percent_commission,
+    pre_trade_check,
+    resume,
+    run
+)
+from src.core.currency import FXProvider
+from src.core.expression_engine import ExpressionError
+from src.core.feature_frame import Bar, FeatureFrame, FeatureResult
+from src.core.money import RoundingMode
+from src.core.portfolio import Portfolio
+from src.core.universe import Universe
+from src.infrastructure.data_provider import CashDividend, Earnings, RightsIssue, Split
+from src.utils.error_handler import BacktestError
+
+
+def _frame(opens, closes, start="2025-01-02"):
+    index = pd.bdate_range(start, periods=len(closes))
+    return FeatureFrame({"$open": opens, "$close": closes}, index=index)
+
+
+@pytest.fixture
+def data():
+    return {
+        "SH600000": _frame([10.0, 11.0, 12.0, 13.0, 14.0], [10.5, 11.5, 12.5, 13.5, 14.5]),
+        "SZ000001": _frame([20.0, 20.0, 20.0, 20.0, 20.0], [20.0, 20.0, 20.0, 20.0, 20.0]),
+    }
+
+
+def _config(data, **kwargs):
+    kwargs.setdefault("initial_cash", 1000.0)
+    return EngineConfig(start_time="2025-01-01", end_time="2025-01-31", data=data, **kwargs)
+
+
+class BuyOnce(Strategy):
+    """第一根K线买入固定数量"""
+    
+    def __init__(self, instrument="SH600000", quantity=10):
+        self.instrument = instrument
+        self.quantity = quantity
+        self.seen = []
+    
+    def on_bar(self, ctx, portfolio, bars):
+        self.seen.append(ctx.time)
+        if len(self.seen) == 1:
+            return [Order(self.instrument, OrderSide.BUY, self.quantity)]
+        return None
+
+
+class TestBacktestEngine:
+    """回测引擎测试类 / Backtest Engine Test Class"""
+    
+    def test_fills_at_next_open(self, data):
+        """订单在下一根K线的开盘价成交"""
+        result = run(_config(data), BuyOnce())
+        
+        assert len(result.trades) == 1
+        trade = result.trades[0]
+        assert trade.time == pd.Timestamp("2025-01-03")
+        assert trade.price == 11.0
+        assert result.positions == {"SH600000": 10}
+        assert result.cash == pytest.approx(1000.0 - 110.0)
+    
+    def test_fills_at_next_close(self, data):
+        result = run(_config(data, execution_mode=ExecutionMode.NEXT_CLOSE), BuyOnce())
+        
+        assert result.trades[0].price == 11.5
+    
+    def test_fills_at_same_close(self, data):
+        """SAME_CLOSE以策略看到的收盘价立即成交"""
+        result = run(_config(data, execution_mode="same_close"), BuyOnce())
+        
+        trade = result.trades[0]
+        assert trade.time == pd.Timestamp("2025-01-02")
+        assert trade.price == 10.5
+        assert result.daily_positions["SH600000"].iloc[0] == 10
+    
+    def test_fills_at_next_vwap(self, data):
+        """NEXT_VWAP在下一根K线按$vwap成交，没有$vwap时用(最高 + 最低 + 收盘) / 3近似"""
+        frame = data["SH600000"]
+        frame["$high"] = frame["$close"] + 0.5
+        frame["$low"] = frame["$open"] - 0.5
+        frame["$volume"] = 1000.0
+        
+        typical = run(_config(data, execution_mode="next_vwap"), BuyOnce())
+        frame["$vwap"] = [10.2, 11.2, 12.2, 13.2, 14.2]
+        exact = run(_config(data, execution_mode="next_vwap"), BuyOnce())
+        
+        assert typical.trades[0].time == pd.Timestamp("2025-01-03")
+        assert typical.trades[0].price == pytest.approx((12.0 + 10.5 + 11.5) / 3)
+        assert exact.trades[0].price == pytest.approx(11.2)
+    
+    def test_limit_orders_trigger_on_bar_range_under_next_vwap(self, data, caplog):
+        """NEXT_VWAP下限价按K线最高、最低价判断，成交价取均价且不劣于限价"""
+        frame = data["SH600000"]
+        frame["$high"] = frame["$close"] + 0.5
+        frame["$low"] = frame["$open"] - 0.5
+        frame["$volume"] = 1000.0
+        
+        def buying(limit):
+            def on_bar(ctx, portfolio, bars):
+                if ctx.time == pd.Timestamp("2025-01-02"):
+                    return [Order("SH600000", OrderSide.BUY, 10, limit_price=limit)]
+                return None
+            return on_bar
+        
+        with caplog.at_level(logging.WARNING):
+            typical = run(_config(data, execution_mode="next_vwap"), buying(11.0))
+        frame["$vwap"] = [10.2, 11.2, 12.2, 13.2, 14.2]
+        inside, above, outside = (
+            run(_config(data, execution_mode="next_vwap"), buying(limit)) for limit in (10.8, 11.5, 10.4)
+        )
+        
+        # 01-03的范围为[10.5, 12.0]，典型价格约11.33，均价11.2
+        assert [(t.time, t.price) for t in typical.trades] == [(pd.Timestamp("2025-01-03"), 11.0)]
+        assert any("$vwap" in record.getMessage() for record in caplog.records)
+        assert [t.price for t in inside.trades] == [10.8]
+        assert [t.price for t in above.trades] == [pytest.approx(11.2)]
+        assert not outside.trades
+    
+    def test_execution_mode_changes_prices_not_trades(self, data):
+        """同一策略在不同执行方式下成交笔数相同，成交价不同"""
+        for frame in data.values():
+            frame["$volume"] = 1000.0
+        
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.BUY, 10)]
+            if ctx.time == pd.Timestamp("2025-01-06"):
+                return [Order("SH600000", OrderSide.SELL, 10)]
+            return None
+        
+        results = [
+            run(_config(data, execution_mode=mode), on_bar)
+            for mode in (ExecutionMode.SAME_CLOSE, ExecutionMode.NEXT_OPEN, ExecutionMode.NEXT_VWAP)
+        ]
+        
+        assert [len(result.trades) for result in results] == [2, 2, 2]
+        # 当日收盘价、次日开盘价、次日开盘和收盘价的均值
+        assert [[t.price for t in result.trades] for result in results] == [
+            [10.5, 12.5], [11.0, 13.0], [pytest.approx(11.25), pytest.approx(13.25)]
+        ]
+    
+    def test_next_vwap_needs_volume(self, data):
+        with pytest.raises(BacktestError) as exc_info:
+            run(_config(data, execution_mode=ExecutionMode.NEXT_VWAP), BuyOnce())
+        
+        assert exc_info.value.error_info.error_code == "BCK0003"
+        assert "$volume" in exc_info.value.error_info.error_message_en
+    
+    def test_equity_curve(self, data):
+        """权益曲线按每日收盘价估值"""
+        result = run(_config(data), BuyOnce())
+        
+        assert len(result.equity_curve) == 5
+        assert result.equity_curve.iloc[0] == 1000.0
+        # 第二天以11.0买入10股，收盘价11.5
+        assert result.equity_curve.iloc[1] == pytest.approx(890.0 + 115.0)
+        assert result.final_equity == pytest.approx(890.0 + 145.0)
+        assert result.returns.iloc[0] == 0.0
+    
+    def test_no_lookahead(self, data):
+        """on_bar只能看到当前及之前的K线"""
+        checked = []
+        
+        def strategy(ctx, portfolio, bars):
+            for code in ctx.instruments:
+                history = ctx.history(code)
+                assert history.index.max() <= ctx.time
+            assert bars["SH600000"].time == ctx.time
+            checked.append(len(ctx.history("SH600000")))
+            return []
+        
+        run(_config(data), strategy)
+        
+        assert checked == [1, 2, 3, 4, 5]
+    
+    def test_slippage_and_commission(self, data):
+        config = _config(
+            data,
+            slippage=fixed_bps_slippage(100),
+            commission=percent_commission(0.01, minimum=5.0)
+        )
+        result = run(config, BuyOnce())
+        
+        trade = result.trades[0]
+        assert trade.price == pytest.approx(11.11)
+        assert trade.commission == 5.0
+        assert result.cash == pytest.approx(1000.0 - 111.1 - 5.0)
+    
+    def test_insufficient_cash_rejected(self, data):
+        result = run(_config(data), BuyOnce(quantity=1000))
+        
+        assert result.trades == []
+        assert len(result.rejected_orders) == 1
+        assert result.cash == 1000.0
+    
+    def test_sell_beyond_position_rejected(self, data):
+        def strategy(ctx, portfolio, bars):
+            return [Order("SH600000", "sell", 1)]
+        
+        result = run(_config(data), strategy)
+        
+        assert result.trades == []
+        # 最后一根K线的订单在回测结束时未成交
+        assert len(result.rejected_orders) == 5
+    
+    def test_round_trip(self, data):
+        bars = []
+        
+        def strategy(ctx, portfolio, today):
+            bars.append(ctx.time)
+            if len(bars) == 1:
+                return [Order("SH600000", OrderSide.BUY, 10)]
+            if len(bars) == 2:
+                assert portfolio.position("SH600000") == 10
+                return [Order("SH600000", OrderSide.SELL, portfolio.position("SH600000"))]
+            return None
+        
+        result = run(_config(data), strategy)
+        
+        assert [t.side for t in result.trades] == [OrderSide.BUY, OrderSide.SELL]
+        assert result.positions == {}
+        assert result.cash == pytest.approx(1000.0 - 110.0 + 120.0)
+    
+    def test_calendar_skips_missing_bars(self, data):
+        """停牌日没有K线时订单被拒绝"""
+        data["SH600000"] = data["SH600000"].drop(pd.Timestamp("2025-01-03"))
+        
+        result = run(_config(data), BuyOnce())
+        
+        assert result.trades == []
+        assert len(result.equity_curve) == 5
+    
+    def test_strategy_error(self, data):
+        def strategy(ctx, portfolio, bars):
+            raise RuntimeError("boom")
+        
+        with pytest.raises(BacktestError) as exc_info:
+            run(_config(data), strategy)
+        assert exc_info.value.error_info.error_code == "BCK0002"
+    
+    def test_no_trading_days(self, data):
+        config = EngineConfig(start_time="2024-01-01", end_time="2024-01-31", data=data)
+        
+        with pytest.raises(BacktestError):
+            BacktestEngine(config).run(BuyOnce())
+    
+    def test_missing_price_field(self):
+        frame = FeatureFrame({"$close": [1.0]}, index=pd.bdate_range("2025-01-02", periods=1))
+        
+        with pytest.raises(BacktestError) as exc_info:
+            run(_config({"SH600000": frame}), BuyOnce())
+        assert exc_info.value.error_info.error_code == "BCK0003"
+    
+    def test_invalid_order(self):
+        with pytest.raises(ValueError):
+            Order("SH600000", OrderSide.BUY, 0)
+        with pytest.raises(ValueError):
+            Order("SH600000", "hold", 1)
+        with pytest.raises(ValueError):
+            Order("SH600000", OrderSide.BUY, 1, limit_price=-1.0)
+        with pytest.raises(ValueError):
+            Order("SH600000", OrderSide.BUY, 1, valid_for=0)
+    
+    def test_limit_order_waits_then_fills(self, data):
+        """限价单在价格到达前保持有效"""
+        order = Order("SH600000", OrderSide.SELL, 1, limit_price=13.0, valid_for=None)
+        
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.BUY, 1), order]
+            return None
+        
+        result = run(_config(data), on_bar)
+        
+        assert [(t.side, t.price) for t in result.trades] == [(OrderSide.BUY, 11.0), (OrderSide.SELL, 13.0)]
+        assert result.trades[1].time == pd.Timestamp("2025-01-07")
+    
+    def test_limit_order_expires(self, data):
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.BUY, 1, limit_price=5.0, valid_for=2)]
+            return None
+        
+        result = run(_config(data), on_bar)
+        
+        assert result.trades == []
+        assert len(result.rejected_orders) == 1
+        assert result.rejected_orders[0].time == pd.Timestamp("2025-01-06")
+        assert "过期" in result.rejected_orders[0].reason
+    
+    def test_limit_price_caps_slippage(self, data):
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.BUY, 1, limit_price=11.05)]
+            return None
+        
+        result = run(_config(data, slippage=fixed_bps_slippage(100)), on_bar)
+        
+        assert result.trades[0].price == 11.05
+    
+    def test_short_selling_toggle(self, data):
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.SELL, 10)]
+            return None
+        
+        assert run(_config(data), on_bar).trades == []
+        
+        result = run(_config(data, allow_short=True), on_bar)
+        assert result.positions == {"SH600000": -10}
+        assert result.cash == pytest.approx(1110.0)
+        # 空头在价格上涨时亏损
+        assert result.final_equity == pytest.approx(1110.0 - 145.0)
+    
+    def test_portfolio_copy_is_isolated(self, data):
+        """策略修改组合副本不影响回测"""
+        def on_bar(ctx, portfolio, bars):
+            portfolio._cash = 0.0
+            return None
+        
+        result = run(_config(data), on_bar)
+        
+        assert result.cash == 1000.0
+    
+    def test_result_date_range_slicing(self, data):
+        """结果可以和价格数据一样按日期区间截取"""
+        result = run(_config(data), BuyOnce())
+        
+        window = result["2025-01-02", "2025-01-03"]
+        
+        assert len(window.equity_curve) == 2
+        assert list(window.daily_positions["SH600000"]) == [0.0, 10.0]
+        assert window.positions == {"SH600000": 10.0}
+        assert window.cash == pytest.approx(890.0)
+        assert len(window.trades) == 1
+        assert result.slice("2025-01-06").trades == []
+        assert len(result.slice(end="2025-01-02").daily_positions) == 1
+    
+    def test_fetches_through_data_manager(self, data):
+        """未提供data时通过get_features获取"""
+        class FakeManager:
+            def get_features(self, instruments, fields, **kwargs):
+                self.fields = fields
+                return FeatureResult({code: data[code] for code in instruments})
+        
+        manager = FakeManager()
+        config = EngineConfig(
+            start_time="2025-01-01",
+            end_time="2025-01-31",
+            instruments=["SH600000"],
+            fields=["Mean($close, 5)"]
+        )
+        
+        result = run(config, BuyOnce(), data_manager=manager)
+        
+        assert manager.fields == ["$open", "$close", "Mean($close, 5)"]
+        assert len(result.trades) == 1
+
+
+class TestLookaheadGuard:
+    """未来函数防护测试类"""
+    
+    def test_reading_a_later_bar_raises(self, data):
+        def strategy(ctx, portfolio, bars):
+            ctx.history("SH600000").bar_at(ctx.time + pd.Timedelta(days=1))
+        
+        with pytest.raises(LookaheadError) as exc_info:
+            run(_config(data), strategy)
+        
+        error = exc_info.value
+        assert error.instrument == "SH600000"
+        assert error.fields == ["$open", "$close"]
+        assert error.time == pd.Timestamp("2025-01-03")
+        assert error.as_of == pd.Timestamp("2025-01-02")
+    
+    def test_date_ranges_past_the_bar_raise(self, data):
+        def strategy(ctx, portfolio, bars):
+            ctx.history("SZ000001", 3)["2025-01-01", "2025-01-31"]
+        
+        with pytest.raises(LookaheadError):
+            run(_config(data), strategy)
+    
+    def test_history_is_a_view(self, data):
+        """受保护的历史数据不复制回测数据"""
+        views = []
+        
+        def strategy(ctx, portfolio, bars):
+            history = ctx.history("SH600000")
+            views.append(np.shares_memory(history["$close"].to_numpy(), data["SH600000"]["$close"].to_numpy()))
+            assert history.slice(None, ctx.time).index[-1] == ctx.time
+        
+        run(_config(data), strategy)
+        
+        assert views == [True] * 5
+    
+    def test_future_reference_fields_rejected(self, data):
+        config = _config(data, fields=["Ref($close,-1)/$close - 1"])
+        
+        with pytest.raises(ExpressionError) as exc_info:
+            run(config, BuyOnce())
+        assert exc_info.value.position == 0
+    
+    def test_guard_can_be_disabled(self, data):
+        seen = []
+        
+        def strategy(ctx, portfolio, bars):
+            seen.append(ctx.history("SH600000").bar_at(ctx.time + pd.Timedelta(days=1)))
+        
+        run(_config(data, fields=["Ref($close,-1)"], lookahead_guard=False), strategy)
+        
+        assert seen == [(None, False)] * 5
+
+
+class TestUniverseMembership:
+    """回测中按时间点使用标的池"""
+    
+    @pytest.fixture
+    def universe(self):
+        # SH600000在1月6日之后被剔除，SZ000001于1月7日纳入，SH600004于1月6日退市
+        return Universe("pool", {
+            "SH600000": [("2025-01-01", "2025-01-06")],
+            "SZ000001": [("2025-01-07", None)],
+            "SH600004": [("2025-01-01", "2025-01-06")],
+        })
+    
+    @pytest.fixture
+    def pool_data(self, data):
+        return dict(data, SH600004=_frame([5.0, 5.0, 5.0], [5.0, 5.0, 5.0]))
+    
+    def test_members_change_mid_backtest(self, pool_data, universe):
+        seen = {}
+        
+        def strategy(ctx, portfolio, bars):
+            seen[ctx.time] = (sorted(bars), ctx.members, len(ctx.history("SH600004")))
+            return []
+        
+        run(_config(pool_data, instruments=universe), strategy)
+        
+        assert seen[pd.Timestamp("2025-01-06")] == (["SH600000", "SH600004"], ["SH600000", "SH600004"], 3)
+        # 退市的标的在退市日之后不再出现，但历史数据保留
+        assert seen[pd.Timestamp("2025-01-07")] == (["SZ000001"], ["SZ000001"], 3)
+        assert [day.day for day in seen] == [2, 3, 6, 7, 8]
+    
+    def test_removed_member_can_only_be_sold(self, pool_data, universe):
+        """剔除后买入被拒绝，已有持仓仍可卖出"""
+        def strategy(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-02"):
+                return [Order("SH600000", OrderSide.BUY, 10)]
+            if ctx.time == pd.Timestamp("2025-01-06"):
+                return [Order("SH600000", OrderSide.BUY, 5)]
+            if ctx.time == pd.Timestamp("2025-01-07"):
+                return [Order("SH600000", OrderSide.SELL, portfolio.position("SH600000"))]
+            return None
+        
+        result = run(_config(pool_data, instruments=universe), strategy)
+        
+        assert [(t.time.day, t.side) for t in result.trades] == [(3, OrderSide.BUY), (8, OrderSide.SELL)]
+        assert result.positions == {}
+        assert len(result.rejected_orders) == 1
+        assert "标的池" in result.rejected_orders[0].reason
+
+
+def _round_trip(ctx, portfolio, bars):
+    """第一根K线买入10股，第二根K线全部卖出"""
+    if ctx.time == pd.Timestamp("2025-01-02"):
+        return [Order("SH600000", OrderSide.BUY, 10)]
+    if ctx.time == pd.Timestamp("2025-01-03"):
+        return [Order("SH600000", OrderSide.SELL, portfolio.position("SH600000"))]
+    return None
+
+
+class TestCostModels:
+    """交易成本模型测试类"""
+    
+    def test_zero_cost(self, data):
+        """无摩擦时净现金变化等于价差"""
+        result = run(_config(data, cost_model=ZeroCost()), _round_trip)
+        
+        assert [t.commission for t in result.trades] == [0.0, 0.0]
+        assert [t.price for t in result.trades] == [11.0, 12.0]
+        assert result.cash == pytest.approx(1000.0 - 110.0 + 120.0)
+    
+    def test_fixed_bps_commission(self, data):
+        result = run(_config(data, cost_model=FixedBpsCommission(100)), _round_trip)
+        
+        # 买入110的1%，卖出120的1%
+        assert [t.commission for t in result.trades] == pytest.approx([1.1, 1.2])
+        assert result.cash == pytest.approx(1000.0 - 110.0 - 1.1 + 120.0 - 1.2)
+    
+    def test_fixed_bps_minimum(self, data):
+        result = run(_config(data, cost_model=FixedBpsCommission(3, minimum=5.0)), _round_trip)
+        
+        assert [t.commission for t in result.trades] == [5.0, 5.0]
+        assert result.cash == pytest.approx(1000.0 + 10.0 - 10.0)
+    
+    def test_per_share_commission(self, data):
+        result = run(_config(data, cost_model=PerShareCommission(0.05)), _round_trip)
+        
+        assert [t.commission for t in result.trades] == pytest.approx([0.5, 0.5])
+        assert result.cash == pytest.approx(1000.0 + 10.0 - 1.0)
+    
+    def test_volume_share_slippage_direction(self):
+        """买入价上浮，卖出价下浮"""
+        frame = _frame([10.0, 11.0, 12.0], [10.5, 11.5, 12.5])
+        frame["$volume"] = [100.0, 100.0, 100.0]
+        
+        result = run(_config({"SH600000": frame}, cost_model=VolumeShareSlippage(0.1)), _round_trip)
+        
+        # 10股占成交量的10%，冲击为0.1 * 0.1 ** 2 = 0.1%
+        buy, sell = result.trades
+        assert buy.price == pytest.approx(11.0 * 1.001)
+        assert sell.price == pytest.approx(12.0 * 0.999)
+        assert buy.price > 11.0 and sell.price < 12.0
+        assert result.cash == pytest.approx(1000.0 - 110.11 + 119.88)
+    
+    def test_volume_share_without_volume_is_conservative(self, data):
+        """没有成交量数据时按订单等于全部成交量计算"""
+        result = run(_config(data, cost_model=VolumeShareSlippage(0.01)), _round_trip)
+        
+        assert [t.price for t in result.trades] == pytest.approx([11.11, 11.88])
+    
+    def test_combined_cost(self):
+        frame = _frame([10.0, 11.0, 12.0], [10.5, 11.5, 12.5])
+        frame["$volume"] = [100.0, 100.0, 100.0]
+        model = CombinedCost(PerShareCommission(0.1), VolumeShareSlippage(0.1))
+        
+        result = run(_config({"SH600000": frame}, cost_model=model), _round_trip)
+        
+        assert [t.commission for t in result.trades] == pytest.approx([1.0, 1.0])
+        assert result.cash == pytest.approx(1000.0 - 110.11 - 1.0 + 119.88 - 1.0)
+    
+    def test_negative_slippage_rejected(self, data):
+        """模型不能让滑点对交易者有利"""
+        class Favourable(CostModel):
+            def slippage(self, order, ref_price, volume=None):
+                return -0.5
+        
+        with pytest.raises(ValueError):
+            run(_config(data, cost_model=Favourable()), _round_trip)
+    
+    def test_cost_model_excludes_functions(self, data):
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(data, cost_model=ZeroCost(), commission=percent_commission(0.001)))
+    
+    def test_volume_is_fetched_when_needed(self, data):
+        class FakeManager:
+            def get_features(self, instruments, fields, **kwargs):
+                self.fields = fields
+                return FeatureResult({code: data[code] for code in instruments})
+        
+        manager = FakeManager()
+        config = EngineConfig(
+            start_time="2025-01-01",
+            end_time="2025-01-31",
+            instruments=["SH600000"],
+            cost_model=CombinedCost(FixedBpsCommission(3), VolumeShareSlippage())
+        )
+        
+        run(config, BuyOnce(), data_manager=manager)
+        
+        assert manager.fields == ["$open", "$close", "$volume"]
+    
+    def test_a_share_costs(self):
+        model = AShareCostModel()
+        buy = Order("SH600000", OrderSide.BUY, 1000)
+        sell = Order("SH600000", OrderSide.SELL, 1000)
+        
+        # 佣金取最低5元，上交所另收0.001%的过户费；印花税只在卖出时收取
+        assert model.commission(buy, 10.0) == pytest.approx(5.1)
+        assert model.tax(buy, 10.0) == 0.0
+        assert model.commission(sell, 11.0) == pytest.approx(5.11)
+        assert model.tax(sell, 11.0) == pytest.approx(5.5)
+        assert model.commission(Order("SZ000001", OrderSide.BUY, 1000), 10.0) == pytest.approx(5.0)
+        assert model.commission(Order("SH600000", OrderSide.BUY, 100000), 10.0) == pytest.approx(250.0 + 10.0)
+    
+    def test_tax_is_charged_to_cash(self, data):
+        model = AShareCostModel(min_commission=0.0, transfer_fee_rate=0.0, stamp_tax_rate=0.01)
+        
+        result = run(_config(data, cost_model=model), _round_trip)
+        
+        assert [t.tax for t in result.trades] == pytest.approx([0.0, 1.2])
+        assert result.cash == pytest.approx(1000.0 - 110.0 + 120.0 - 230.0 * 0.00025 - 1.2)
+    
+    def test_slippage_models(self, data):
+        fixed = run(_config(data, cost_model=FixedBpsSlippage(100)), _round_trip)
+        spread = run(_config(data, cost_model=SpreadSlippage(200)), _round_trip)
+        
+        # 固定1%；价差2%时跨过一半价差，同样为1%
+        for result in (fixed, spread):
+            assert [t.price for t in result.trades] == pytest.approx([11.11, 11.88])
+            assert [t.slippage for t in result.trades] == pytest.approx([1.1, 1.2])
+            assert [t.commission for t in result.trades] == [0.0, 0.0]
+        assert SpreadSlippage(0, tick=0.02).slippage(Order("SH600000", OrderSide.BUY, 1), 10.0) == pytest.approx(0.01)
+    
+    def test_pnl_breakdown(self, data):
+        model = CombinedCost(AShareCostModel(min_commission=1.0), FixedBpsSlippage(50))
+        
+        result = run(_config(data, cost_model=model), _round_trip)
+        breakdown = result.pnl_breakdown()
+        
+        assert breakdown.net == pytest.approx(result.final_equity - 1000.0)
+        # 不计成本时买入110、卖出120
+        assert breakdown.gross == pytest.approx(10.0)
+        assert breakdown.commission == pytest.approx(2.0 + (110.55 + 119.4) * 0.00001)
+        assert breakdown.tax == pytest.approx(119.4 * 0.0005)
+        assert breakdown.slippage == pytest.approx(0.55 + 0.6)
+        assert breakdown.to_dict()["net"] == pytest.approx(breakdown.net)
+        assert result.slice("2025-01-06").pnl_breakdown().gross == pytest.approx(120.0 - 115.0)
+    
+    def test_seeded_random_slippage_is_reproducible(self, data):
+        """相同种子的随机滑点回测逐笔相同，不同种子则不同"""
+        model = CombinedCost(FixedBpsCommission(3), RandomSlippage(20, 10))
+        
+        first = run(_config(data, cost_model=model, seed=42), _round_trip)
+        second = run(_config(data, cost_model=model, seed=42), _round_trip)
+        other = run(_config(data, cost_model=model, seed=43), _round_trip)
+        
+        pd.testing.assert_series_equal(first.equity_curve, second.equity_curve)
+        assert first.trades == second.trades
+        assert first.seed == 42
+        assert [t.price for t in first.trades] != [t.price for t in other.trades]
+        assert first.trades[0].price >= 11.0 and first.trades[1].price <= 12.0
+    
+    def test_unseeded_run_records_its_seed(self, data):
+        """未指定种子时结果记录实际使用的种子，用它可以复现"""
+        model = RandomSlippage(20, 10)
+        
+        result = run(_config(data, cost_model=model), _round_trip)
+        replay = run(_config(data, cost_model=model, seed=result.seed), _round_trip)
+        
+        assert result.seed is not None
+        assert replay.trades == result.trades
+        with pytest.raises(ValueError):
+            RandomSlippage(-1, 10)
+    
+    def test_foreign_instruments_value_in_base_currency(self, data):
+        """港股按当日汇率折算为人民币，汇率变动计入权益"""
+        data = dict(data, HK00700=_frame([100.0] * 5, [100.0] * 5))
+        rates = pd.Series([0.9, 0.9, 0.95, 0.95, 0.95], index=pd.bdate_range("2025-01-02", periods=5))
+        
+        result = run(_config(data, fx=FXProvider({"HKDCNY": rates})), BuyOnce("HK00700", 10))
+        
+        trade = result.trades[0]
+        assert (trade.price, trade.fx_rate) == (100.0, 0.9)
+        assert result.cash == pytest.approx(1000.0 - 900.0)
+        assert result.equity_curve.iloc[-1] == pytest.approx(100.0 + 950.0)
+        assert list(result.currency_exposure.columns) == ["HKD"]
+        assert result.currency_exposure["HKD"].tolist() == pytest.approx([0.0, 900.0, 950.0, 950.0, 950.0])
+        with pytest.raises(BacktestError) as exc_info:
+            run(_config(data), BuyOnce())
+        assert exc_info.value.error_info.error_code == "BCK0008"
+
+
+def _bars(*rows):
+    """按(开, 高, 低, 收)构造日线，首根K线为下单日，成交量均为1000"""
+    index = pd.bdate_range("2025-01-02", periods=len(rows) + 1)
+    opens, highs, lows, closes = zip((10.0, 10.0, 10.0, 10.0), *rows)
+    return {"SH600000": FeatureFrame({
+        "$open": opens, "$high": highs, "$low": lows, "$close": closes, "$volume": 1000.0
+    }, index=index)}
+
+
+def _submit(*orders):
+    """在首根K线下达给定订单"""
+    def on_bar(ctx, portfolio, bars):
+        if ctx.time == pd.Timestamp("2025-01-02"):
+            return list(orders)
+        return None
+    return on_bar
+
+
+def _order(side, quantity=10, **kwargs):
+    return Order("SH600000", side, quantity, **kwargs)
+
+
+class TestOrderTypes:
+    """限价、止损、止损限价单和有效期测试类"""
+    
+    def _run(self, data, *orders, **kwargs):
+        kwargs.setdefault("initial_cash", 100_000.0)
+        return run(_config(data, allow_short=True, **kwargs), _submit(*orders))
+    
+    def test_order_type_inferred_from_prices(self):
+        assert _order("buy").order_type is OrderType.MARKET
+        assert _order("buy", limit_price=10.0).order_type is OrderType.LIMIT
+        assert _order("buy", stop_price=10.0).order_type is OrderType.STOP
+        assert _order("buy", limit_price=10.0, stop_price=9.0).order_type is OrderType.STOP_LIMIT
+        assert _order("buy", tif="gtc").valid_for is None
+        assert _order("buy", tif="ioc", valid_for=5).valid_for == 1
+    
+    def test_invalid_order_types(self):
+        with pytest.raises(ValueError):
+            _order("buy", order_type="limit")
+        with pytest.raises(ValueError):
+            _order("buy", limit_price=10.0, order_type=OrderType.STOP)
+        with pytest.raises(ValueError):
+            _order("buy", stop_price=-1.0)
+        with pytest.raises(ValueError):
+            _order("buy", tif="week")
+    
+    def test_limit_buy_fills_when_low_reaches_limit(self):
+        result = self._run(_bars((10.2, 10.5, 9.7, 10.1)), _order("buy", limit_price=9.8))
+        
+        assert [(t.time, t.price) for t in result.trades] == [(pd.Timestamp("2025-01-03"), 9.8)]
+    
+    def test_limit_sell_fills_when_high_reaches_limit(self):
+        result = self._run(
+            _bars((10.2, 10.5, 9.7, 10.1)),
+            _order("sell", limit_price=10.4),
+            _order("sell", limit_price=10.6)
+        )
+        
+        assert [(t.side, t.price) for t in result.trades] == [(OrderSide.SELL, 10.4)]
+        assert len(result.rejected_orders) == 1
+    
+    def test_limit_gap_through_fills_at_open(self):
+        """开盘跳空越过限价、开盘价已经优于限价时以开盘价成交，而不是限价"""
+        result = self._run(
+            _bars((10.2, 10.5, 10.0, 10.1)),
+            _order("buy", limit_price=10.5),
+            _order("sell", limit_price=9.9)
+        )
+        
+        assert [t.price for t in result.trades] == [10.2, 10.2]
+    
+    def test_day_order_expires_at_session_end(self):
+        """DAY订单在下一根K线未成交时于当日收盘过期"""
+        data = _bars((10.2, 10.5, 10.0, 10.1), (10.0, 10.1, 9.6, 9.8))
+        
+        day = self._run(data, _order("buy", limit_price=9.7))
+        
+        assert day.trades == []
+        assert len(day.rejected_orders) == 1
+        assert day.rejected_orders[0].time == pd.Timestamp("2025-01-03")
+        assert "过期" in day.rejected_orders[0].reason
+    
+    def test_gtc_order_carries_to_next_session(self):
+        data = _bars((10.2, 10.5, 10.0, 10.1), (10.0, 10.1, 9.6, 9.8))
+        
+        gtc = self._run(data, _order("buy", limit_price=9.7, tif="gtc"))
+        
+        assert [(t.time, t.price) for t in gtc.trades] == [(pd.Timestamp("2025-01-06"), 9.7)]
+        assert gtc.rejected_orders == []
+    
+    def test_gtc_survives_several_days(self):
+        flat = (10.0, 10.1, 9.9, 10.0)
+        data = _bars(flat, flat, flat, (9.6, 9.7, 9.4, 9.5))
+        
+        result = self._run(data, _order("buy", limit_price=9.6, tif="gtc"))
+        
+        assert [(t.time, t.price) for t in result.trades] == [(pd.Timestamp("2025-01-08"), 9.6)]
+        assert result.rejected_orders == []
+    
+    def test_stop_never_triggers(self):
+        """未触发的GTC止损单一直有效，回测结束时记为未成交"""
+        flat = (10.0, 10.1, 9.9, 10.0)
+        
+        result = self._run(_bars(flat, flat, flat), _order("sell", stop_price=9.5, tif="gtc"))
+        
+        assert result.trades == []
+        assert len(result.rejected_orders) == 1
+        assert result.rejected_orders[0].time == pd.Timestamp("2025-01-07")
+        assert "回测结束前未能成交" in result.rejected_orders[0].reason
+    
+    def test_stop_triggers_off_high_and_low(self):
+        result = self._run(
+            _bars((10.2, 10.5, 10.1, 10.3)),
+            _order("buy", stop_price=10.4),
+            _order("sell", stop_price=10.15),
+            _order("buy", stop_price=10.6)
+        )
+        
+        assert [(t.side, t.price) for t in result.trades] == [(OrderSide.BUY, 10.4), (OrderSide.SELL, 10.15)]
+        assert "未触发止损价10.6" in result.rejected_orders[0].reason
+    
+    def test_gap_through_stop_fills_at_open(self):
+        """开盘即越过止损价时以开盘价成交，而不是止损价"""
+        result = self._run(
+            _bars((9.0, 9.2, 8.8, 9.1)),
+            _order("sell", stop_price=9.5),
+            _order("buy", stop_price=8.5)
+        )
+        
+        assert [t.price for t in result.trades] == [9.0, 9.0]
+    
+    def test_stop_limit_triggered_intrabar(self):
+        result = self._run(
+            _bars((10.2, 10.5, 10.1, 10.3)),
+            _order("buy", stop_price=10.4, limit_price=10.45),
+            _order("buy", stop_price=10.4, limit_price=10.3)
+        )
+        
+        assert [t.price for t in result.trades] == [10.4]
+        # 在K线中途触发，触发后价格是否回到限价未知，不成交
+        assert "已触发止损价10.4" in result.rejected_orders[0].reason
+    
+    def test_stop_limit_gap_past_limit_stays_triggered(self):
+        """跳空越过止损价和限价时已触发但不成交，之后的K线按限价单撮合"""
+        data = _bars((10.8, 11.0, 10.6, 10.9), (10.3, 10.35, 10.2, 10.3))
+        
+        result = self._run(data, _order("buy", stop_price=10.4, limit_price=10.45, tif="gtc"))
+        
+        # 第二根K线的最高价低于止损价，只有已触发的订单才能成交
+        assert [(t.time, t.price) for t in result.trades] == [(pd.Timestamp("2025-01-06"), 10.3)]
+    
+    def test_ioc_cancels_when_unfilled(self):
+        data = _bars((10.2, 10.5, 10.0, 10.1), (9.0, 9.0, 9.0, 9.0))
+        
+        result = self._run(data, _order("buy", limit_price=9.5, tif="ioc"))
+        
+        assert result.trades == []
+        assert result.rejected_orders[0].time == pd.Timestamp("2025-01-03")
+        assert "IOC" in result.rejected_orders[0].reason
+    
+    def test_close_modes_use_close_only(self):
+        result = self._run(
+            _bars((10.2, 10.5, 9.7, 10.1)),
+            _order("buy", limit_price=9.8),
+            _order("buy", limit_price=10.1),
+            execution_mode=ExecutionMode.NEXT_CLOSE
+        )
+        
+        assert [t.price for t in result.trades] == [10.1]
+
+
+class TestParticipation:
+    """按成交量比例部分成交测试类"""
+    
+    @pytest.fixture
+    def data(self):
+        flat = (10.0, 10.0, 10.0, 10.0)
+        return _bars(flat, flat, flat)
+    
+    def _run(self, data, *orders):
+        return run(_config(data, initial_cash=100_000.0, participation_rate=0.1), _submit(*orders))
+    
+    def test_gtc_carries_remainder(self, data):
+        result = self._run(data, _order("buy", 150, tif="gtc"))
+        
+        assert [(t.time.day, t.quantity) for t in result.trades] == [(3, pytest.approx(100)), (6, pytest.approx(50))]
+        assert result.positions["SH600000"] == pytest.approx(150)
+    
+    @pytest.mark.parametrize("tif, reason", [("day", "过期"), ("ioc", "IOC")])
+    def test_remainder_cancelled(self, data, tif, reason):
+        result = self._run(data, _order("buy", 150, tif=tif))
+        
+        assert [t.quantity for t in result.trades] == [pytest.approx(100)]
+        rejected = result.rejected_orders[0]
+        assert rejected.order.quantity == pytest.approx(50)
+        assert reason in rejected.reason
+    
+    def test_orders_share_bar_volume(self, data):
+        result = self._run(data, _order("buy", 80), _order("buy", 80))
+        
+        assert [t.quantity for t in result.trades] == [pytest.approx(80), pytest.approx(20)]
+        assert result.rejected_orders[0].order.quantity == pytest.approx(60)
+    
+    def test_invalid_rate_and_missing_volume(self, data):
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(data, participation_rate=1.5))
+        frame = _frame([10.0, 11.0], [10.5, 11.5])
+        with pytest.raises(BacktestError) as exc_info:
+            run(_config({"SH600000": frame}, participation_rate=0.1), BuyOnce())
+        assert exc_info.value.error_info.error_code == "BCK0003"
+
+
+class TestRiskLimits:
+    """风险限制测试类"""
+    
+    @pytest.fixture
+    def data(self):
+        flat = (10.0, 10.0, 10.0, 10.0)
+        return _bars(flat, flat, flat)
+    
+    def _run(self, data, *orders, **limits):
+        config = _config(data, initial_cash=100_000.0, risk_limits=RiskLimits(**limits))
+        return run(config, _submit(*orders))
+    
+    def test_position_weight_rejects(self, data):
+        result = self._run(data, _order("buy", 2500), max_position_weight=0.2)
+        
+        assert result.trades == []
+        assert "max_position_weight" in result.rejected_orders[0].reason
+    
+    def test_position_weight_trims(self, data):
+        result = self._run(data, _order("buy", 2500), max_position_weight=0.2, action="trim")
+        
+        assert [t.quantity for t in result.trades] == [2000]
+        rejected = result.rejected_orders[0]
+        assert rejected.order.quantity == pytest.approx(500)
+        assert "削减" in rejected.reason
+    
+    def test_gross_exposure_counts_earlier_fills(self, data):
+        """同一根K线上先成交的订单计入后一笔订单的假想组合"""
+        rejected = self._run(data, _order("buy", 3000), _order("buy", 3000), max_gross_exposure=0.5)
+        trimmed = self._run(
+            data, _order("buy", 3000), _order("buy", 3000),
+            max_gross_exposure=0.5, action={"max_gross_exposure": LimitAction.TRIM}
+        )
+        
+        assert [t.quantity for t in rejected.trades] == [3000]
+        assert "max_gross_exposure" in rejected.rejected_orders[0].reason
+        assert [t.quantity for t in trimmed.trades] == [3000, 2000]
+    
+    def test_daily_turnover(self, data):
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time.day in (2, 3):
+                return [_order("buy", 500), _order("buy", 600)]
+            return None
+        
+        result = run(
+            _config(data, initial_cash=100_000.0, risk_limits=RiskLimits(max_daily_turnover=0.1)), on_bar
+        )
+        
+        # 每天只有第一笔订单在换手率限制之内
+        assert [(t.time.day, t.quantity) for t in result.trades] == [(3, 500), (6, 500)]
+        assert all("max_daily_turnover" in r.reason for r in result.rejected_orders)
+    
+    def test_volume_share_trims(self, data):
+        result = self._run(data, _order("buy", 80), max_volume_share=0.05, action="trim")
+        
+        assert [t.quantity for t in result.trades] == [50]
+    
+    def test_pre_trade_check(self):
+        """已经超过限制的持仓可以减仓，但不能继续加仓"""
+        portfolio = Portfolio(100_000.0)
+        portfolio.buy("SH600000", 5000, 10.0)
+        limits = RiskLimits(max_position_weight=0.2)
+        sell = _order("sell", 1000)
+        
+        assert pre_trade_check(portfolio, sell, limits, 10.0) is sell
+        with pytest.raises(RiskLimitError) as exc_info:
+            pre_trade_check(portfolio, _order("buy", 1), limits, 10.0)
+        assert exc_info.value.limit == "max_position_weight"
+        
+        trimmed = pre_trade_check(
+            portfolio, _order("buy", 2000), RiskLimits(max_position_weight=0.6, action="trim"), 10.0
+        )
+        assert trimmed.quantity == 1000
+    
+    def test_invalid_limits(self):
+        with pytest.raises(ValueError):
+            RiskLimits(max_position_weight=-0.1)
+        with pytest.raises(ValueError):
+            RiskLimits(max_volume_share=1.5)
+        with pytest.raises(ValueError):
+            RiskLimits(max_gross_exposure=1.0, action={"max_leverage": "trim"})
+        with pytest.raises(ValueError):
+            RiskLimits(action="warn")
+
+
+class TakesRights(BuyOnce):
+    """第一根K线买入，认购所有配股"""
+    
+    def __init__(self):
+        super().__init__()
+        self.offers = []
+    
+    def on_rights_issue(self, offer, entitled, portfolio):
+        self.offers.append((offer.ex_date, entitled, portfolio.position(offer.instrument)))
+        return True
+
+
+class TestCorporateActions:
+    """公司行为测试类"""
+    
+    def _config(self, data, *actions, **kwargs):
+        events = {}
+        for action in actions:
+            events.setdefault(action.instrument, []).append(action)
+        return _config(data, corporate_actions=events, **kwargs)
+    
+    def test_dividend_and_split(self, data):
+        """01-03以11.0买入10股，01-06分红每股0.5扣税10%，01-07一拆二"""
+        config = self._config(
+            data,
+            CashDividend("SZ000001", pd.Timestamp("2025-01-03"), 1.0),
+            CashDividend("SH600000", pd.Timestamp("2025-01-06"), 0.5),
+            Split("SH600000", pd.Timestamp("2025-01-07"), 2.0),
+            dividend_tax_rate=0.1
+        )
+        
+        result = run(config, BuyOnce())
+        
+        # 没有持仓的SZ000001不记录
+        assert [(r.time.day, r.kind) for r in result.corporate_actions] == [(6, "dividend"), (7, "split")]
+        dividend, split = result.corporate_actions
+        assert (dividend.quantity, dividend.cash, dividend.tax) == (10, pytest.approx(4.5), pytest.approx(0.5))
+        assert (split.quantity, split.new_quantity, split.cash) == (10, 20, 0.0)
+        assert result.positions == {"SH600000": pytest.approx(20)}
+        assert result.cash == pytest.approx(1000 - 110 + 4.5)
+        assert result.cash_curve.iloc[2] == pytest.approx(894.5)
+        assert result.final_equity == pytest.approx(894.5 + 20 * 14.5)
+        assert result.pnl_breakdown().tax == pytest.approx(0.5)
+        frame = result.corporate_actions_frame()
+        assert frame["kind"].tolist() == ["dividend", "split"]
+        assert result.slice("2025-01-07").corporate_actions == [split]
+    
+    def test_split_rescales_cost(self, data):
+        config = self._config(data, Split("SH600000", pd.Timestamp("2025-01-06"), 2.0))
+        
+        class Check(BuyOnce):
+            def on_bar(self, ctx, portfolio, bars):
+                if ctx.time == pd.Timestamp("2025-01-06"):
+                    self.cost = portfolio.avg_cost("SH600000")
+                return super().on_bar(ctx, portfolio, bars)
+        
+        strategy = Check()
+        run(config, strategy)
+        
+        assert strategy.cost == pytest.approx(5.5)
+    
+    def test_rights_taken_up(self, data):
+        """10配3，配股价8.0"""
+        config = self._config(data, RightsIssue("SH600000", pd.Timestamp("2025-01-06"), 0.3, 8.0))
+        strategy = TakesRights()
+        
+        result = run(config, strategy)
+        
+        assert strategy.offers == [(pd.Timestamp("2025-01-06"), pytest.approx(3), 10)]
+        rights = result.trades[-1]
+        assert (rights.kind, rights.side, rights.price, rights.commission) == (FillKind.RIGHTS, OrderSide.BUY, 8.0, 0.0)
+        assert rights.quantity == pytest.approx(3)
+        record = result.corporate_actions[0]
+        assert (record.new_quantity, record.cash, record.note) == (pytest.approx(13), pytest.approx(-24), "")
+        assert result.positions == {"SH600000": pytest.approx(13)}
+        assert result.cash == pytest.approx(1000 - 110 - 24)
+        assert result.trades_frame()["kind"].tolist() == ["trade", "rights"]
+    
+    def test_rights_declined_or_unaffordable(self, data):
+        offer = RightsIssue("SH600000", pd.Timestamp("2025-01-06"), 0.3, 8.0)
+        
+        declined = run(self._config(data, offer), BuyOnce())
+        unaffordable = run(self._config(data, offer, initial_cash=120.0), TakesRights())
+        
+        for result, note in ((declined, "放弃"), (unaffordable, "现金不足")):
+            record = result.corporate_actions[0]
+            assert (record.new_quantity, record.cash) == (10, 0.0)
+            assert note in record.note
+            assert result.positions == {"SH600000": 10}
+            assert [t.kind for t in result.trades] == [FillKind.TRADE]
+    
+    def test_actions_seen_by_strategy(self, data):
+        """01-04（周六）的分红在01-06生效，01-08有业绩公告，没有持仓的标的也能看到事件"""
+        dividend = CashDividend("SH600000", pd.Timestamp("2025-01-04"), 0.5)
+        split = Split("SZ000001", pd.Timestamp("2025-01-07"), 2.0)
+        earnings = Earnings("SH600000", pd.Timestamp("2025-01-08"), pd.Timestamp("2024-12-31"))
+        config = self._config(data, dividend, split, earnings)
+        
+        class Watch(BuyOnce):
+            def __init__(self):
+                super().__init__()
+                self.today, self.ahead = {}, {}
+            
+            def on_bar(self, ctx, portfolio, bars):
+                self.today[ctx.time.day] = ctx.actions()
+                self.ahead[ctx.time.day] = ctx.upcoming_actions(2, "SH600000")
+                return super().on_bar(ctx, portfolio, bars)
+        
+        strategy = Watch()
+        result = run(config, strategy)
+        
+        assert strategy.today == {2: [], 3: [], 6: [dividend], 7: [split], 8: [earnings]}
+        assert strategy.ahead == {2: [dividend], 3: [dividend], 6: [earnings], 7: [earnings], 8: []}
+        assert [(a.kind, a.magnitude) for a in (dividend, split)] == [("dividend", 0.5), ("split", 2.0)]
+        # 业绩公告不改变持仓
+        assert [r.kind for r in result.corporate_actions] == ["dividend"]
+        with pytest.raises(ValueError):
+            BarContext(pd.Timestamp("2025-01-02"), {}).upcoming_actions(-1)
+    
+    def test_invalid_config(self, data):
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(data, corporate_actions=True, adjust="pre"))
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(data, dividend_tax_rate=1.5))
+        BacktestEngine(_config(data, corporate_actions=True, adjust="none"))
+
+
+class TestSuspension:
+    """停牌测试类"""
+    
+    @pytest.fixture
+    def halted(self):
+        """01-03和01-06停牌（成交量为0），01-07以15.0跳空复牌"""
+        frame = _frame([10.0, 10.5, 10.5, 15.0, 16.0], [10.5, 10.5, 10.5, 15.5, 16.5])
+        frame["$volume"] = [100.0, 0.0, 0.0, 100.0, 100.0]
+        return {"SH600000": frame}
+    
+    def test_carry_until_resumption(self, halted):
+        result = run(_config(halted), BuyOnce())
+        
+        fill, = result.trades
+        assert (fill.time, fill.price) == (pd.Timestamp("2025-01-07"), 15.0)
+        assert fill.resumption_gap == pytest.approx(15.0 / 10.5 - 1)
+        assert result.resumption_fills == [fill]
+        assert result.rejected_orders == []
+    
+    def test_reject_and_expire(self, halted):
+        rejected = run(_config(halted, suspension=SuspensionPolicy.REJECT), BuyOnce())
+        expired = run(_config(halted, suspension="expire", suspension_expiry=1), BuyOnce())
+        
+        for result, time, reason in (
+            (rejected, "2025-01-03", "停牌"), (expired, "2025-01-06", "订单已过期")
+        ):
+            assert result.trades == []
+            record, = result.rejected_orders
+            assert record.time == pd.Timestamp(time)
+            assert reason in record.reason
+    
+    def test_explicit_flag_and_illiquid_mark(self):
+        """01-03买入后01-06、01-07由$suspended标记停牌，停牌日的收盘价不用于估值"""
+        frame = _frame([10.0, 11.0, 99.0, 99.0, 13.0], [10.5, 11.5, 99.0, 99.0, 13.5])
+        frame["$suspended"] = [0.0, 0.0, 1.0, 1.0, float("nan")]
+        
+        class Watch(BuyOnce):
+            def __init__(self):
+                super().__init__()
+                self.illiquid = []
+            
+            def on_bar(self, ctx, portfolio, bars):
+                self.illiquid.append(portfolio.illiquid)
+                return super().on_bar(ctx, portfolio, bars)
+        
+        strategy = Watch()
+        result = run(_config({"SH600000": frame}), strategy)
+        
+        assert strategy.illiquid == [[], [], ["SH600000"], ["SH600000"], []]
+        assert result.equity_curve.iloc[2:4].tolist() == pytest.approx([1000 - 110 + 115] * 2)
+        assert result.resumption_fills == []
+    
+    def test_bar_tradable(self):
+        assert Bar(pd.Timestamp("2025-01-02"), {"$close": 10.0}).tradable
+        assert not Bar(pd.Timestamp("2025-01-02"), {"$close": 10.0, "$volume": 0.0}).tradable
+        assert not Bar(pd.Timestamp("2025-01-02"), {"$volume": 100.0, "$suspended": 1.0}).tradable
+    
+    def test_invalid_config(self, halted):
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(halted, suspension="expire"))
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(halted, suspension="skip"))
+
+
+class TestRoundingPolicy:
+    """价格和数量取整测试类"""
+    
+    def test_tick_snapping(self):
+        tick = TickSize(0.01)
+        
+        assert tick.snap(10.234) == 10.23
+        assert tick.snap(10.235) == 10.24
+        assert tick.snap(10.239, RoundingMode.DOWN) == 10.23
+        assert tick.snap(10.231, RoundingMode.UP) == 10.24
+        assert TickSize(0.05).snap(1.07) == 1.05
+        with pytest.raises(ValueError):
+            TickSize(0.0)
+    
+    def test_lot_rounding_both_directions(self):
+        lot = LotSize(100)
+        
+        assert lot.round(150) == 100
+        assert lot.round(150, RoundingMode.UP) == 200
+        assert lot.round(150, RoundingMode.HALF_UP) == 200
+        assert lot.round(250, RoundingMode.HALF_EVEN) == 200
+        assert lot.round(99) == 0
+        with pytest.raises(ValueError):
+            LotSize(0)
+    
+    def test_apply_to_order(self):
+        order = Order("SH600000", OrderSide.BUY, 150, limit_price=10.234)
+        
+        rounded = A_SHARE_ROUNDING.apply(order)
+        
+        assert (rounded.quantity, rounded.limit_price) == (100, 10.23)
+        assert RoundingPolicy(lot=LotSize(100), quantity_mode="up").apply(order).quantity == 200
+        with pytest.raises(LotRoundingError):
+            A_SHARE_ROUNDING.apply(Order("SH600000", OrderSide.BUY, 50))
+        # 卖出全部持仓时保留零股
+        assert A_SHARE_ROUNDING.apply(Order("SH600000", OrderSide.SELL, 130), held=130).quantity == 130
+    
+    def test_engine_rounds_orders_and_fills(self, data):
+        """150股向下取整为100股，成交价11.011取整为11.01"""
+        config = _config(
+            data, initial_cash=10000.0, slippage=fixed_bps_slippage(10), rounding_policy=A_SHARE_ROUNDING
+        )
+        
+        result = run(config, BuyOnce(quantity=150))
+        up = run(replace(config, rounding_policy=replace(A_SHARE_ROUNDING, quantity_mode="up")), BuyOnce(quantity=150))
+        other_market = run(replace(config, rounding_policy={"SZ": A_SHARE_ROUNDING}), BuyOnce(quantity=150))
+        
+        fill, = result.trades
+        assert (fill.quantity, fill.price) == (100, 11.01)
+        assert [t.quantity for t in up.trades] == [200]
+        assert [(t.quantity, t.price) for t in other_market.trades] == [(150, pytest.approx(11.011))]
+    
+    def test_engine_rejects_zero_lots(self, data):
+        result = run(_config(data, rounding_policy=A_SHARE_ROUNDING), BuyOnce(quantity=50))
+        
+        assert result.trades == []
+        record, = result.rejected_orders
+        assert (record.time, record.order.quantity) == (pd.Timestamp("2025-01-02"), 50)
+        assert "不足一手" in record.reason
+
+
+class Alternating(Strategy, Snapshotter):
+    """奇数根K线买入、偶数根卖出，首根K线另下一笔不会成交的GTC限价单；计数器是跨K线的状态"""
+    
+    def __init__(self, crash_on=None):
+        self.count = 0
+        self.crash_on = crash_on
+    
+    def on_bar(self, ctx, portfolio, bars):
+        self.count += 1
+        if self.count == self.crash_on:
+            raise RuntimeError("process died")
+        side = OrderSide.BUY if self.count % 2 else OrderSide.SELL
+        orders = [Order("SH600000", side, 10)]
+        if self.count == 1:
+            orders.append(Order("SZ000001", OrderSide.BUY, 1, limit_price=1.0, tif="gtc"))
+        return orders
+    
+    def snapshot(self):
+        return {"count": self.count}
+    
+    def restore(self, state):
+        self.count = state["count"]
+
+
+class TestCheckpoint:
+    """检查点和恢复测试类"""
+    
+    def test_resume_matches_uninterrupted_run(self, data, tmp_path):
+        """中途崩溃后从检查点恢复，结果与不中断的回测逐笔相同"""
+        path = tmp_path / "backtest.ckpt"
+        model = CombinedCost(FixedBpsCommission(3), RandomSlippage(20, 10))
+        config = _config(data, cost_model=model, checkpoint_path=path, checkpoint_every=2)
+        
+        expected = run(_config(data, cost_model=model, seed=7), Alternating())
+        with pytest.raises(BacktestError):
+            run(replace(config, seed=7), Alternating(crash_on=4))
+        resumed = resume(replace(config, seed=None), path, Alternating())
+        
+        pd.testing.assert_series_equal(resumed.equity_curve, expected.equity_curve, check_exact=True)
+        pd.testing.assert_series_equal(resumed.cash_curve, expected.cash_curve, check_exact=True)
+        assert resumed.trades == expected.trades
+        assert resumed.rejected_orders == expected.rejected_orders
+        assert resumed.rejected_orders[-1].order.instrument == "SZ000001"
+        assert resumed.seed == 7
+    
+    @pytest.mark.skipif(sys.platform == "win32", reason="needs POSIX signals")
+    def test_sigterm_writes_checkpoint(self, data, tmp_path):
+        path = tmp_path / "backtest.ckpt"
+        handler = signal.getsignal(signal.SIGTERM)
+        sent = []
+        
+        def on_bar(ctx, portfolio, bars):
+            if ctx.time == pd.Timestamp("2025-01-06") and not sent:
+                sent.append(ctx.time)
+                os.kill(os.getpid(), signal.SIGTERM)
+            return [Order("SH600000", OrderSide.BUY, 1)]
+        
+        with pytest.raises(BacktestInterruptedError) as exc_info:
+            run(_config(data, checkpoint_path=path, seed=1), on_bar)
+        
+        assert exc_info.value.time == pd.Timestamp("2025-01-06")
+        assert exc_info.value.error_info.error_code == "BCK0009"
+        assert signal.getsignal(signal.SIGTERM) == handler
+        resumed = resume(_config(data, checkpoint_path=path), path, on_bar)
+        expected = run(_config(data, seed=1), on_bar)
+        pd.testing.assert_series_equal(resumed.equity_curve, expected.equity_curve, check_exact=True)
+        assert resumed.trades == expected.trades
+    
+    def test_mismatched_or_missing_checkpoint(self, data, tmp_path):
+        path = tmp_path / "backtest.ckpt"
+        run(_config(data, checkpoint_path=path, checkpoint_every=2), Alternating())
+        
+        for config, strategy in [
+            (EngineConfig(start_time="2025-01-01", end_time="2025-01-07", data=data), Alternating()),
+            (_config(data), _round_trip),
+        ]:
+            with pytest.raises(BacktestError) as exc_info:
+                resume(config, path, strategy)
+            assert exc_info.value.error_info.error_code == "BCK0010"
+        with pytest.raises(BacktestError):
+            resume(_config(data), tmp_path / "missing.ckpt", Alternating())
+        with pytest.raises(ValueError):
+            BacktestEngine(_config(data, checkpoint_every=2))
+
+
+class RandomPicker(Strategy, Snapshotter):
+    """每根K线随机选一个标的买入1至3股，计数器是跨K线的状态"""
+    
+    def __init__(self, crash_on=None):
+        self.count = 0
+        self.crash_on = crash_on
+    
+    def on_bar(self, ctx, portfolio, bars):
+        self.count += 1
+        if self.count == self.crash_on:
+            raise RuntimeError("process died")
+        rng = ctx.rng()
+        return [Order(rng.choice(sorted(bars)), OrderSide.BUY, rng.randint(1, 3))]
+    
+    def snapshot(self):
+        return {"count": self.count}
+    
+    def restore(self, state):
+        self.count = state["count"]
+
+
+class TestStrategyRandom:
+    """策略随机数流测试类"""
+    
+    def test_same_seed_same_trades(self, data):
+        first = run(_config(data, seed=42), RandomPicker())
+        second = run(_config(data, seed=42), RandomPicker())
+        
+        assert first.trades == second.trades
+        assert len(first.trades) == 4
+    
+    def test_streams_follow_the_seed(self, data):
+        seen = []
+        
+        def on_bar(ctx, portfolio, bars):
+            seen.append((ctx.rng().random(), ctx.rng("noise").random()))
+        
+        run(_config(data, seed=1), on_bar)
+        first, seen[:] = list(seen), []
+        run(_config(data, seed=2), on_bar)
+        
+        assert first != seen
+        # 同一个名称的流跨K线延续，不同名称的流互相独立
+        assert len({value for pair in first for value in pair}) == 2 * len(first)
+    
+    def test_resume_continues_the_stream(self, data, tmp_path):
+        path = tmp_path / "backtest.ckpt"
+        config = _config(data, seed=7, checkpoint_path=path, checkpoint_every=2)
+        
+        expected = run(_config(data, seed=7), RandomPicker())
+        with pytest.raises(BacktestError):
+            run(config, RandomPicker(crash_on=4))
+        resumed = resume(config, path, RandomPicker())
+        
+        assert resumed.trades == expected.trades
+    
+    def test_context_outside_an_engine(self):
+        with pytest.raises(ValueError):
+            BarContext(pd.Timestamp("2025-01-02"), {}).rng()
+
+
+class TestResultExport:
+    """回测结果导出测试类"""
+    
+    @pytest.fixture
+    def result(self, data):
+        return run(_config(data), _round_trip)
+    
+    def test_drawdown_and_equity_frame(self, result):
+        frame = result.equity_frame()
+        
+        assert list(frame.columns) == ["equity", "cash", "return", "drawdown"]
+        assert (frame["drawdown"] <= 0).all()
+        assert frame["cash"].iloc[-1] == result.cash
+    
+    def test_write_csv(self, result, tmp_path):
+        result.write_equity_csv(tmp_path / "equity.csv")
+        result.write_trades_csv(tmp_path / "trades.csv")
+        
+        equity = pd.read_csv(tmp_path / "equity.csv", index_col="date", parse_dates=True)
+        trades = pd.read_csv(tmp_path / "trades.csv")
+        assert equity["equity"].tolist() == pytest.approx(result.equity_curve.tolist())
+        assert trades["side"].tolist() == ["buy", "sell"]
+        assert trades["value"].tolist() == pytest.approx([t.value for t in result.trades])
+    
+    def test_write_csv_directory(self, result, tmp_path):
+        """按目录导出权益、成交和持仓，时间为RFC3339"""
+        result.write_csv(tmp_path / "out")
+        
+        equity = (tmp_path / "out" / "equity.csv").read_text().splitlines()
+        positions = (tmp_path / "out" / "positions.csv").read_text().splitlines()
+        trades = pd.read_csv(tmp_path / "out" / "trades.csv")
+        assert equity[0] == "date,equity,cash,return,drawdown"
+        assert equity[1] == "2025-01-02T00:00:00+08:00,1000.0,1000.0,0.0,0.0"
+        assert positions[:3] == ["date,SH600000", "2025-01-02T00:00:00+08:00,0.0", "2025-01-03T00:00:00+08:00,10.0"]
+        assert list(trades.columns) == [
+            "time", "instrument", "side", "quantity", "price", "value", "commission", "tax", "slippage", "kind",
+            "entry_time", "exit_time", "realized_pnl"
+        ]
+        # 01-03以11.0买入，01-06以12.0卖出
+        buy, sell = trades.to_dict(orient="records")
+        assert (buy["entry_time"], buy["realized_pnl"]) == ("2025-01-03T00:00:00+08:00", 0.0)
+        assert pd.isna(buy["exit_time"])
+        assert (sell["entry_time"], sell["exit_time"]) == ("2025-01-03T00:00:00+08:00", "2025-01-06T00:00:00+08:00")
+        assert (sell["side"], sell["quantity"], sell["price"], sell["realized_pnl"]) == ("sell", 10.0, 12.0, 10.0)
+    
+    def test_write_json(self, result):
+        buffer = io.StringIO()
+        
+        result.write_json(buffer)
+        
+        document = json.loads(buffer.getvalue())
+        assert [row["equity"] for row in document["equity"]] == result.equity_curve.tolist()
+        assert document["equity"][0]["date"] == "2025-01-02T00:00:00+08:00"
+        assert document["daily_positions"][1] == {"date": "2025-01-03T00:00:00+08:00", "SH600000": 10.0}
+        assert document["trades"][0]["exit_time"] is None
+        assert document["trades"][1]["realized_pnl"] == 10.0
+        assert (document["initial_cash"], document["positions"], document["seed"]) == (1000.0, {}, result.seed)
+    
+    def test_export_round_trips_floats(self, tmp_path):
+        """浮点数原样读回，反手时剩余数量在反手成交上开仓"""
+        index = pd.bdate_range("2025-01-02", periods=3)
+        trades = [
+            Fill(time=index[0], instrument="SH600000", side=OrderSide.BUY, quantity=10, price=0.1 + 0.2, commission=0.0),
+            Fill(time=index[1], instrument="SH600000", side=OrderSide.SELL, quantity=15, price=1 / 3, commission=0.0),
+            Fill(time=index[2], instrument="SH600000", side=OrderSide.BUY, quantity=5, price=0.3, commission=0.0),
+        ]
+        result = EngineResult(
+            equity_curve=pd.Series([1000.0, 1000.0 / 3, 1e-17], index=index), trades=trades, positions={}, cash=0.0
+        )
+        
+        result.write_csv(tmp_path)
+        
+        equity = pd.read_csv(tmp_path / "equity.csv")
+        frame = pd.read_csv(tmp_path / "trades.csv")
+        assert equity["equity"].tolist() == result.equity_curve.tolist()
+        assert frame["price"].tolist() == [0.1 + 0.2, 1 / 3, 0.3]
+        assert frame["entry_time"].tolist() == [
+            "2025-01-02T00:00:00+08:00", "2025-01-02T00:00:00+08:00", "2025-01-03T00:00:00+08:00"
+        ]
+        assert frame["exit_time"].fillna("").tolist() == [
+            "", "2025-01-03T00:00:00+08:00", "2025-01-06T00:00:00+08:00"
+        ]
+    
+    def test_write_html_is_self_contained(self, result, tmp_path):
+        path = tmp_path / "report" / "result.html"
+        
+        result.write_html(path, title="Round <trip>")
+        
+        text = path.read_text(encoding="utf-8")
+        assert "Round &lt;trip&gt;" in text
+        assert text.count("<svg") == 3
+        assert 'class="sortable"' in text and "SH600000" in text
+        # 不引用外部脚本、样式或图片
+        assert "src=" not in text and "<link" not in text
+    
+    def test_ten_year_report_renders_quickly(self, tmp_path):
+        index = pd.bdate_range("2015-01-01", periods=2520)
+        rng = np.random.default_rng(0)
+        equity = pd.Series(1e6 * np.cumprod(1 + rng.normal(0.0003, 0.01, len(index))), index=index)
+        trades = [
+            Fill(time=index[i % len(index)], instrument=f"SH60{i % 50:04d}", side=OrderSide.BUY,
+                 quantity=100, price=10.0, commission=5.0)
+            for i in range(5000)
+        ]
+        result = EngineResult(
+            equity_curve=equity,
+            trades=trades,
+            positions={},
+            cash=0.0,
+            cash_curve=equity * 0.1,
+            initial_cash=1e6
+        )
+        
+        started = time.perf_counter()
+        result.write_html(tmp_path / "long.html")
+        
+        assert time.perf_counter() - started < 1.0
+        assert "2024" in (tmp_path / "long.html").read_text(encoding="utf-8")
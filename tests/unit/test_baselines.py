@@ -0,0 +1,109 @@
+"""
+基准策略单元测试 / Baseline Strategy Unit Tests
+"""
+
+import pytest
+import pandas as pd
+
+from src.application.backtest_engine import EngineConfig, OrderSide, run
+from src.application.baselines import BuyAndHold, EqualWeight
+from src.core.feature_frame import FeatureFrame
+from src.core.trading_calendar import TradingCalendar
+
+
+@pytest.fixture
+def calendar():
+    return TradingCalendar("TEST")
+
+
+@pytest.fixture
+def data():
+    index = pd.bdate_range("2025-01-02", "2025-04-04")
+    # 每日以前一日收盘价开盘，按收盘价计算的目标持仓在次日开盘时正好买得起
+    closes = [10.0 + 0.1 * i for i in range(len(index))]
+    opens = [10.0] + closes[:-1]
+    return {
+        "SH600000": FeatureFrame({"$open": opens, "$close": closes}, index=index),
+        "SZ000001": FeatureFrame({"$open": 20.0, "$close": 20.0}, index=index),
+    }
+
+
+def _config(data, calendar):
+    return EngineConfig(
+        start_time="2025-01-01",
+        end_time="2025-04-04",
+        data=data,
+        initial_cash=100_000.0,
+        calendar=calendar
+    )
+
+
+class TestBuyAndHold:
+    """BuyAndHold测试类"""
+    
+    def test_single_round_of_orders(self, data, calendar):
+        strategy = BuyAndHold("SH600000")
+        
+        result = run(_config(data, calendar), strategy)
+        
+        # 1月2日收盘后下单，1月3日开盘成交，之后不再交易
+        assert strategy.entry_time == pd.Timestamp("2025-01-02")
+        assert [(t.time, t.side, t.quantity) for t in result.trades] == [
+            (pd.Timestamp("2025-01-03"), OrderSide.BUY, 10000)
+        ]
+        assert result.positions == {"SH600000": 10000}
+    
+    def test_tracks_underlying_return(self, data, calendar):
+        result = run(_config(data, calendar), BuyAndHold("SH600000"))
+        
+        closes = data["SH600000"]["$close"]
+        # 满仓持有，每日收益与标的相同
+        assert result.equity_curve.iloc[-1] / 100_000.0 - 1 == pytest.approx(closes.iloc[-1] / closes.iloc[0] - 1)
+        equity = result.equity_curve.reindex(closes.index)
+        assert equity.pct_change().iloc[1:].to_numpy() == pytest.approx(closes.pct_change().iloc[1:].to_numpy())
+    
+    def test_partial_weight(self, data, calendar):
+        result = run(_config(data, calendar), BuyAndHold("SZ000001", weight=0.5))
+        
+        assert result.positions == {"SZ000001": 2500}
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            BuyAndHold("SH600000", weight=0)
+        with pytest.raises(ValueError):
+            BuyAndHold("SH600000", weight=1.5)
+
+
+class TestEqualWeight:
+    """EqualWeight测试类"""
+    
+    def _buy_days(self, result):
+        return sorted({t.time for t in result.trades})
+    
+    def test_no_rebalance(self, data, calendar):
+        strategy = EqualWeight(["SH600000", "SZ000001"], calendar=calendar)
+        
+        result = run(_config(data, calendar), strategy)
+        
+        assert strategy.rebalance_dates == [pd.Timestamp("2025-01-02")]
+        assert self._buy_days(result) == [pd.Timestamp("2025-01-03")]
+        assert result.positions == {"SH600000": 5000, "SZ000001": 2500}
+    
+    def test_monthly_and_quarterly(self, data, calendar):
+        codes = ["SH600000", "SZ000001"]
+        monthly = EqualWeight(codes, "monthly", calendar=calendar)
+        quarterly = EqualWeight(codes, "quarterly", calendar=calendar)
+        
+        run(_config(data, calendar), monthly)
+        run(_config(data, calendar), quarterly)
+        
+        assert monthly.rebalance_dates == [
+            pd.Timestamp(d) for d in ("2025-01-02", "2025-01-31", "2025-02-28", "2025-03-31")
+        ]
+        assert quarterly.rebalance_dates == [pd.Timestamp("2025-01-02"), pd.Timestamp("2025-03-31")]
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            EqualWeight([])
+        with pytest.raises(ValueError):
+            EqualWeight(["SH600000"], "weekly")
@@ -0,0 +1,129 @@
+"""
+自定义指数单元测试 / Custom Index Unit Tests
+"""
+
+import math
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.application.benchmark_index import MissingPrice, build_index
+from src.application.rebalance import EveryNDays
+from src.core.feature_frame import FeatureFrame
+from src.core.trading_calendar import TradingCalendar
+from src.core.universe import Universe
+
+
+# 2025年1月6日（周一）至1月10日（周五）
+DAYS = pd.bdate_range("2025-01-06", periods=5)
+
+
+@pytest.fixture
+def calendar():
+    return TradingCalendar("TEST")
+
+
+def _frame(closes, caps=None):
+    columns = {"$close": closes}
+    if caps is not None:
+        columns["$market_cap"] = caps
+    return FeatureFrame(columns, index=DAYS)
+
+
+def _levels(index):
+    return [round(level, 6) for level in index.tolist()]
+
+
+class TestBuildIndex:
+    """指数编制测试类"""
+    
+    def test_equal_weight(self, calendar):
+        prices = {
+            "SH600000": _frame([10.0, 11.0, 11.0, 12.0, 12.0]),
+            "SZ000001": _frame([20.0, 20.0, 22.0, 22.0, 22.0]),
+        }
+        
+        index = build_index(
+            ["SH600000", "SZ000001"], "equal", [], prices, calendar=calendar, start_time="2025-01-03"
+        )
+        
+        # 第一个有价格的交易日之前为NaN
+        assert math.isnan(index.iloc[0])
+        assert _levels(index.iloc[1:]) == [1000.0, 1050.0, 1100.0, 1150.0, 1150.0]
+        assert index.name == "index"
+    
+    def test_rebalance_keeps_level(self, calendar):
+        prices = {
+            "SH600000": _frame([10.0, 11.0, 11.0, 13.2, 13.2]),
+            "SZ000001": _frame([20.0, 20.0, 24.0, 24.0, 24.0]),
+        }
+        codes = ["SH600000", "SZ000001"]
+        
+        held = build_index(codes, "equal", [], prices, calendar=calendar)
+        rebalanced = build_index(codes, "equal", EveryNDays(2), prices, calendar=calendar)
+        
+        # 1月8日收盘后恢复等权，当日点位不变，之后按新的份数计算
+        assert round(held.iloc[2], 6) == round(rebalanced.iloc[2], 6) == 1150.0
+        assert round(held.iloc[3], 6) == 1260.0
+        assert round(rebalanced.iloc[3], 6) == 1265.0
+    
+    def test_market_cap_and_explicit_weights(self, calendar):
+        prices = {
+            "SH600000": _frame([10.0, 11.0, 11.0, 11.0, 11.0], caps=[300.0, np.nan, np.nan, np.nan, np.nan]),
+            "SZ000001": _frame([20.0] * 5, caps=[100.0] * 5),
+            "SZ000002": _frame([5.0, 50.0, 50.0, 50.0, 50.0], caps=[100.0] * 5),
+        }
+        
+        by_cap = build_index(["SH600000", "SZ000001"], "market_cap", [], prices, calendar=calendar)
+        explicit = build_index(
+            ["SH600000", "SZ000001", "SZ000002"], {"SH600000": 3, "SZ000001": 1}, [], prices, calendar=calendar
+        )
+        
+        assert _levels(by_cap)[:2] == [1000.0, 1075.0]
+        # 不在权重映射中的SZ000002不纳入
+        assert _levels(explicit)[:2] == [1000.0, 1075.0]
+    
+    def test_leaver_taken_out_at_last_price(self, calendar):
+        # SH600000在1月7日之后被剔除，1月8日的下跌不计入指数
+        universe = Universe("pool", {
+            "SH600000": [("2025-01-06", "2025-01-07")],
+            "SZ000001": [("2025-01-06", None)],
+        })
+        prices = {
+            "SH600000": _frame([10.0, 11.0, 5.0, 5.0, 5.0]),
+            "SZ000001": _frame([20.0, 20.0, 22.0, 22.0, 22.0]),
+        }
+        
+        index = build_index(universe, "equal", [], prices, calendar=calendar)
+        
+        assert _levels(index) == [1000.0, 1050.0, 1155.0, 1155.0, 1155.0]
+    
+    def test_missing_price(self, calendar):
+        prices = {
+            "SH600000": _frame([10.0, 11.0, np.nan, 12.1, 12.1]),
+            "SZ000001": _frame([20.0, 20.0, 22.0, 22.0, 22.0]),
+        }
+        codes = ["SH600000", "SZ000001"]
+        
+        redistributed = build_index(codes, "equal", [], prices, calendar=calendar)
+        carried = build_index(codes, "equal", [], prices, calendar=calendar, missing=MissingPrice.CARRY)
+        
+        # 移出当日只按SZ000001计算，恢复报价后重新等权
+        assert _levels(redistributed) == [1000.0, 1050.0, 1155.0, 1155.0, 1155.0]
+        # 沿用11元的最后价格
+        assert _levels(carried) == [1000.0, 1050.0, 1100.0, 1155.0, 1155.0]
+    
+    def test_invalid(self, calendar):
+        prices = {"SH600000": _frame([10.0] * 5)}
+        
+        with pytest.raises(ValueError):
+            build_index(["SH600000"], "equal", [], prices, calendar=calendar, base=0)
+        with pytest.raises(ValueError):
+            build_index(["SH600000"], {"SH600000": -1}, [], prices, calendar=calendar)
+        with pytest.raises(ValueError):
+            build_index(["SH600000"], "market_cap", [], prices, calendar=calendar)
+        with pytest.raises(ValueError):
+            build_index(["SH600000"], "price", [], prices, calendar=calendar)
+        with pytest.raises(ValueError):
+            build_index(["SH600000"], "equal", [], {}, calendar=calendar)
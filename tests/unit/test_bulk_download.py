@@ -0,0 +1,133 @@
+"""
+Unit tests for bulk downloads
+批量下载单元测试
+"""
+
+import hashlib
+import time
+
+import pytest
+
+pytest.importorskip("pyarrow")
+
+from src.core.bulk_download import DownloadOptions, DownloadSpec, bulk_download
+from src.core.data_manager import DataManager
+from src.core.universe import Universe
+from src.infrastructure.parquet_provider import read_parquet
+from src.utils.request_context import ContextCancelledError, RequestContext
+from tests.unit._providers import FakeProvider, daily_bars
+
+
+FIELDS = ["$close", "$volume"]
+
+
+@pytest.fixture
+def provider():
+    return FakeProvider({
+        "SH600000": daily_bars("2025-01-02", 20),
+        "SZ000001": daily_bars("2025-01-02", 15, close=20.0),
+        "SH600519": daily_bars("2025-01-02", 10, close=1500.0),
+    })
+
+
+@pytest.fixture
+def manager(provider):
+    return DataManager(enable_cache=False, provider=provider)
+
+
+def _spec(codes=("SH600000", "SZ000001", "SH600519")):
+    return DownloadSpec(list(codes), FIELDS, start="2025-01-01", end="2025-01-31")
+
+
+class TestBulkDownload:
+    """bulk_download测试类"""
+    
+    def test_writes_parquet_and_manifest(self, manager, tmp_path):
+        manifest = bulk_download(RequestContext(), _spec(), tmp_path, manager=manager)
+        
+        assert list(manifest.files) == ["SH600000", "SZ000001", "SH600519"]
+        assert manifest.complete
+        entry = manifest.files["SH600000"]
+        stored = read_parquet(str(tmp_path / "SH600000.parquet"), FIELDS)
+        # 20根K线都在区间内
+        assert entry.rows == len(stored) == 20
+        assert entry.path == "SH600000.parquet"
+        assert entry.sha256 == hashlib.sha256((tmp_path / "SH600000.parquet").read_bytes()).hexdigest()
+        assert manifest.total_rows == 20 + 15 + 10
+        assert manifest.to_dict()["files"][0]["resumed"] is False
+    
+    def test_resume_skips_complete_files(self, manager, provider, tmp_path):
+        first = bulk_download(RequestContext(), _spec(), tmp_path, manager=manager)
+        (tmp_path / "SZ000001.parquet").unlink()
+        provider.calls.clear()
+        
+        second = bulk_download(RequestContext(), _spec(), tmp_path, manager=manager)
+        
+        assert [code for code, _, _ in provider.calls] == ["SZ000001"]
+        assert [e.resumed for e in second.files.values()] == [True, False, True]
+        assert {c: e.sha256 for c, e in second.files.items()} == {c: e.sha256 for c, e in first.files.items()}
+        assert second.total_rows == first.total_rows
+    
+    def test_file_missing_a_field_is_downloaded_again(self, manager, provider, tmp_path):
+        bulk_download(RequestContext(), DownloadSpec(["SH600000"], ["$close"]), tmp_path, manager=manager)
+        provider.calls.clear()
+        
+        manifest = bulk_download(RequestContext(), DownloadSpec(["SH600000"], FIELDS), tmp_path, manager=manager)
+        
+        assert [code for code, _, _ in provider.calls] == ["SH600000"]
+        assert not manifest.files["SH600000"].resumed
+    
+    def test_failures_do_not_stop_the_rest(self, manager, tmp_path):
+        manifest = bulk_download(RequestContext(), _spec(["SH600000", "SH688888"]), tmp_path, manager=manager)
+        
+        assert list(manifest.files) == ["SH600000"]
+        assert list(manifest.failed) == ["SH688888"]
+        assert not manifest.complete
+        assert not (tmp_path / "SH688888.parquet").exists()
+    
+    def test_universe_and_progress(self, manager, tmp_path):
+        universe = Universe("pool", {
+            "SH600000": [("2025-01-01", None)],
+            "SZ000001": [("2025-01-01", None)],
+            "SH600519": [("2026-01-01", None)],
+        })
+        calls = []
+        
+        manifest = bulk_download(
+            RequestContext(), DownloadSpec(universe, FIELDS, start="2025-01-01", end="2025-01-31"), tmp_path,
+            DownloadOptions(max_workers=2, progress=lambda done, total: calls.append((done, total))),
+            manager=manager
+        )
+        
+        # 区间内不是成分股的标的不下载
+        assert sorted(manifest.files) == ["SH600000", "SZ000001"]
+        assert calls[-1] == (2, 2)
+        assert [done for done, _ in calls] == sorted(done for done, _ in calls)
+    
+    def test_rate_limit(self, manager, tmp_path):
+        started = time.monotonic()
+        
+        bulk_download(RequestContext(), _spec(), tmp_path, DownloadOptions(rate_limit=10.0), manager=manager)
+        
+        # 三个请求之间至少间隔两个0.1秒
+        assert time.monotonic() - started >= 0.2
+    
+    def test_cancelled_context(self, manager, tmp_path):
+        ctx = RequestContext()
+        ctx.cancel("stop")
+        
+        with pytest.raises(ContextCancelledError):
+            bulk_download(ctx, _spec(), tmp_path, manager=manager)
+        assert list(tmp_path.iterdir()) == []
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            DownloadSpec(["SH600000"], [])
+        with pytest.raises(ValueError):
+            DownloadSpec(["SH600000"], ["Mean($close, 5)"])
+        with pytest.raises(ValueError):
+            DownloadSpec(["SH600000"], FIELDS, freq="2day")
+        with pytest.raises(ValueError):
+            DownloadOptions(max_workers=0)
+        with pytest.raises(ValueError):
+            DownloadOptions(rate_limit=0)
@@ -0,0 +1,106 @@
+"""
+Unit tests for the disk-cached data provider
+磁盘缓存数据提供者单元测试
+"""
+
+import threading
+
+import pandas as pd
+import pytest
+
+from src.infrastructure.cached_provider import CachedDataProvider, with_cache
+from src.utils.feature_cache import FeatureCache
+from tests.unit._providers import CountingProvider
+
+
+@pytest.fixture
+def inner():
+    return CountingProvider()
+
+
+@pytest.fixture
+def provider(inner, tmp_path):
+    return with_cache(str(tmp_path / "cache"), provider=inner)
+
+
+class TestCachedDataProvider:
+    """CachedDataProvider测试类"""
+    
+    def test_sub_range_served_from_cache(self, provider, inner):
+        """已缓存区间的子区间不再访问底层提供者"""
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-06-30")
+        frame = provider.load_features("SH600000", ["$close"], "2025-03-01", "2025-04-30")
+        
+        assert len(inner.calls) == 1
+        assert frame.index[0] == pd.Timestamp("2025-03-01")
+        assert frame.index[-1] == pd.Timestamp("2025-04-30")
+        assert frame["$close"].iloc[0] == inner.frame.loc["2025-03-01", "$close"]
+    
+    def test_only_missing_tail_fetched(self, provider, inner):
+        """部分重叠时只获取缺失的尾部"""
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-06-30")
+        frame = provider.load_features("SH600000", ["$close"], "2025-03-01", "2025-08-31")
+        
+        assert len(inner.calls) == 2
+        _, _, tail_start, tail_end = inner.calls[1]
+        assert tail_start == pd.Timestamp("2025-06-30")
+        assert tail_end == pd.Timestamp("2025-08-31")
+        assert frame.index.is_unique
+        assert len(frame) == len(pd.date_range("2025-03-01", "2025-08-31"))
+    
+    def test_new_field_fetched_separately(self, provider, inner):
+        """未缓存的字段单独获取，已缓存的字段不重复获取"""
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        frame = provider.load_features("SH600000", ["$close", "$open"], "2025-01-01", "2025-01-31")
+        
+        assert inner.calls[1][1] == ("$open",)
+        assert list(frame.columns) == ["$close", "$open"]
+    
+    def test_survives_restart(self, inner, tmp_path):
+        """缓存保存在磁盘上，新实例可以直接使用"""
+        cache_dir = str(tmp_path / "cache")
+        with_cache(cache_dir, provider=inner).load_features(
+            "SH600000", ["$close"], "2025-01-01", "2025-01-31"
+        )
+        with_cache(cache_dir, provider=inner).load_features(
+            "SH600000", ["$close"], "2025-01-10", "2025-01-20"
+        )
+        
+        assert len(inner.calls) == 1
+    
+    def test_invalidate(self, provider, inner):
+        """invalidate()之后重新获取"""
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        provider.load_features("SZ000001", ["$close"], "2025-01-01", "2025-01-31")
+        
+        assert provider.invalidate("SH600000") == 1
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        provider.load_features("SZ000001", ["$close"], "2025-01-01", "2025-01-31")
+        
+        assert [call[0] for call in inner.calls] == ["SH600000", "SZ000001", "SH600000"]
+    
+    def test_ttl_expiry(self, inner, tmp_path):
+        """过期的条目被重新获取"""
+        provider = CachedDataProvider(inner, FeatureCache(str(tmp_path), ttl=0))
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        
+        assert len(inner.calls) == 2
+    
+    def test_concurrent_readers(self, provider, inner):
+        """多线程并发读取同一标的时只获取一次"""
+        results = []
+        
+        def read():
+            results.append(
+                provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-06-30")
+            )
+        
+        threads = [threading.Thread(target=read) for _ in range(8)]
+        for t in threads:
+            t.start()
+        for t in threads:
+            t.join()
+        
+        assert len(inner.calls) == 1
+        assert all(frame.equals(results[0]) for frame in results)
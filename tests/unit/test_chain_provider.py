@@ -0,0 +1,122 @@
+"""
+Unit tests for the chained data provider
+链式数据提供者单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.infrastructure.chain_provider import ChainProvider, chain
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import (
+    AdjustmentsUnavailableError,
+    FieldNotFoundError,
+    InstrumentNotFoundError
+)
+
+
+LOCAL_CSV = """date,open,close
+2025-01-02,10.0,10.2
+2025-01-03,10.2,10.6
+2025-01-06,10.6,10.4
+"""
+
+REMOTE_CSV = """date,close,volume
+2025-01-02,10.3,1000
+2025-01-03,10.7,1200
+2025-01-06,10.5,900
+2025-01-07,10.8,1100
+"""
+
+
+@pytest.fixture
+def local(tmp_path):
+    (tmp_path / "local").mkdir()
+    (tmp_path / "local" / "SH600000.csv").write_text(LOCAL_CSV)
+    return CSVDataProvider(str(tmp_path / "local"))
+
+
+@pytest.fixture
+def remote(tmp_path):
+    (tmp_path / "remote").mkdir()
+    (tmp_path / "remote" / "SH600000.csv").write_text(REMOTE_CSV)
+    (tmp_path / "remote" / "SZ000001.csv").write_text(REMOTE_CSV)
+    (tmp_path / "remote" / "adjustments").mkdir()
+    (tmp_path / "remote" / "adjustments" / "SH600000.csv").write_text("ex_date,split_ratio\n2025-01-06,2\n")
+    return CSVDataProvider(str(tmp_path / "remote"))
+
+
+@pytest.fixture
+def provider(local, remote):
+    return chain(local, remote)
+
+
+class TestChainProvider:
+    """ChainProvider测试类"""
+    
+    def test_first_provider_wins(self, provider, local):
+        """两个提供者都有的字段使用第一个提供者的数据"""
+        pd.testing.assert_frame_equal(
+            provider.load_features("SH600000", ["$close"]), local.load_features("SH600000", ["$close"])
+        )
+    
+    def test_instrument_served_by_second_provider(self, provider, remote):
+        frame = provider.load_features("SZ000001", ["$close", "$volume"], "2025-01-03", "2025-01-06")
+        
+        pd.testing.assert_frame_equal(
+            frame, remote.load_features("SZ000001", ["$close", "$volume"], "2025-01-03", "2025-01-06")
+        )
+    
+    def test_field_split_across_providers(self, provider):
+        """$open只在第一个提供者中，$volume只在第二个中，按时间合并"""
+        frame = provider.load_features("SH600000", ["$volume", "$open", "$close"])
+        
+        assert list(frame.columns) == ["$volume", "$open", "$close"]
+        assert list(frame.index) == list(pd.to_datetime(["2025-01-02", "2025-01-03", "2025-01-06", "2025-01-07"]))
+        assert frame["$close"].tolist()[:3] == [10.2, 10.6, 10.4]
+        assert frame["$volume"].tolist() == [1000, 1200, 900, 1100]
+        assert pd.isna(frame["$open"].iloc[-1])
+    
+    def test_not_found_errors(self, provider):
+        with pytest.raises(InstrumentNotFoundError) as unknown:
+            provider.load_features("SH999999", ["$close"])
+        with pytest.raises(FieldNotFoundError) as missing:
+            provider.load_features("SH600000", ["$close", "$vwap"])
+        
+        assert unknown.value.instrument == "SH999999"
+        assert missing.value.fields == ["$vwap"]
+        assert "$volume" in missing.value.available
+    
+    def test_data_manager_reports_missing_instruments(self, provider):
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(["SH600000", "SZ000001", "SH999999"], ["$open", "$volume"])
+        
+        assert list(result) == ["SH600000"]
+        assert list(result.error.of(InstrumentNotFoundError)) == ["SH999999"]
+        assert list(result.error.of(FieldNotFoundError)) == ["SZ000001"]
+    
+    def test_metadata_is_the_union(self, provider):
+        assert provider.name == "chain(csv, csv)"
+        assert provider.calendar()[-1] == pd.Timestamp("2025-01-07")
+        assert len(provider.calendar()) == 4
+        assert provider.list_instruments() == ["SH600000", "SZ000001"]
+        # 第二个提供者有除权除息记录，因此也有$factor
+        assert provider.list_fields("SH600000") == ["$close", "$factor", "$open", "$volume"]
+        with pytest.raises(InstrumentNotFoundError):
+            provider.list_fields("SH999999")
+    
+    def test_adjustments_fall_through(self, provider):
+        assert list(provider.adjustments("SH600000").index) == [pd.Timestamp("2025-01-06")]
+        with pytest.raises(AdjustmentsUnavailableError):
+            provider.adjustments("SZ000001")
+    
+    def test_invalid_chain(self, local, tmp_path):
+        class Adjusted(CSVDataProvider):
+            adjusted_prices = True
+        
+        with pytest.raises(ValueError):
+            ChainProvider()
+        with pytest.raises(ValueError):
+            ChainProvider(local, Adjusted(str(tmp_path)))
@@ -0,0 +1,109 @@
+"""
+Unit tests for pair spreads and the ADF test
+配对价差和ADF检验单元测试
+"""
+
+import math
+import random
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.cointegration import adf_critical_values, adf_p_value, adf_test, ols_beta, spread
+from src.core.stats import InsufficientDataError
+
+
+NAN = float("nan")
+
+
+def _ar1(seed, n=500, phi=0.5):
+    """平稳的AR(1)序列 / Stationary AR(1) series"""
+    rng = random.Random(seed)
+    values = [0.0]
+    for _ in range(n - 1):
+        values.append(phi * values[-1] + rng.gauss(0, 1))
+    return values
+
+
+def _random_walk(seed, n=500):
+    """从100开始的随机游走 / Random walk starting at 100"""
+    rng = random.Random(seed)
+    values = [100.0]
+    for _ in range(n - 1):
+        values.append(values[-1] + rng.gauss(0, 1))
+    return values
+
+
+class TestSpread:
+    """价差和对冲比例测试类"""
+    
+    def test_spread(self):
+        assert spread([10.0, 11.0, NAN], [4.0, 5.0, 6.0], 2.0)[:2] == [2.0, 1.0]
+        assert math.isnan(spread([10.0, 11.0, NAN], [4.0, 5.0, 6.0], 2.0)[2])
+        assert spread(pd.Series([3.0]), np.array([1.0]), 0.5) == [2.5]
+    
+    def test_ols_beta(self):
+        x = [1.0, 2.0, 3.0, 4.0, NAN]
+        y = [3.0, 5.0, 7.0, 9.0, 100.0]
+        
+        assert ols_beta(y, x) == pytest.approx(2.0)
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            spread([1.0, 2.0], [1.0], 1.0)
+        with pytest.raises(ValueError):
+            spread([1.0], [1.0], NAN)
+        with pytest.raises(ValueError):
+            ols_beta([1.0, 2.0], [3.0, 3.0])
+        with pytest.raises(InsufficientDataError):
+            ols_beta([1.0, NAN], [1.0, 2.0])
+
+
+class TestADF:
+    """ADF检验测试类"""
+    
+    def test_stationary_series_has_low_p_value(self):
+        stat, p_value = adf_test(_ar1(1))
+        
+        assert stat < adf_critical_values(499)["1%"]
+        assert p_value == 0.01
+    
+    def test_random_walk_has_high_p_value(self):
+        stat, p_value = adf_test(_random_walk(1))
+        
+        assert stat > adf_critical_values(499)["10%"]
+        assert p_value > 0.5
+    
+    def test_cointegrated_pair(self):
+        """a = 2b + 平稳噪声：a本身不平稳，价差平稳"""
+        b = _random_walk(1)
+        a = [2.0 * x + e for x, e in zip(b, _ar1(2))]
+        
+        beta = ols_beta(a, b)
+        
+        assert beta == pytest.approx(2.0, abs=0.01)
+        assert adf_test(spread(a, b, beta)).p_value < 0.05
+        assert adf_test(a).p_value > 0.5
+    
+    def test_fixed_lags(self):
+        assert adf_test(_ar1(1, n=60), lags=2).p_value < 0.05
+        assert adf_test(_random_walk(1, n=60), lags=0).p_value > 0.5
+        # NaN被去掉
+        assert adf_test(_ar1(1, n=60) + [NAN], lags=2) == adf_test(_ar1(1, n=60), lags=2)
+    
+    def test_p_value_interpolation(self):
+        assert adf_critical_values(100) == {"1%": -3.51, "5%": -2.89, "10%": -2.58}
+        assert adf_p_value(-2.86, 10 ** 9) == pytest.approx(0.05)
+        assert adf_p_value(-2.89, 100) == pytest.approx(0.05)
+        assert adf_p_value(-10.0, 100) == 0.01
+        assert adf_p_value(5.0, 100) == 0.99
+        assert 0.10 < adf_p_value(-1.5, 100) < 0.90
+    
+    def test_invalid(self):
+        with pytest.raises(InsufficientDataError):
+            adf_test([1.0, 2.0, 1.5, 2.5])
+        with pytest.raises(ValueError):
+            adf_test([1.0] * 50)
+        with pytest.raises(ValueError):
+            adf_test(_ar1(1), lags=-1)
@@ -0,0 +1,84 @@
+"""
+Unit tests for the correlation matrix
+相关系数矩阵单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.correlation import correlation_matrix
+from src.core.stats import InsufficientDataError
+
+
+RETURNS_A = [0.01, -0.02, 0.03, 0.00, 0.015, -0.01]
+RETURNS_C = [0.02, 0.01, -0.01, 0.005, -0.02, 0.03]
+
+
+def _frame(returns, start="2025-01-02"):
+    """由收益率构造以100为起点的收盘价 / Build closes starting at 100 from returns"""
+    closes = 100.0 * np.cumprod([1.0] + [1.0 + r for r in returns])
+    index = pd.bdate_range(start, periods=len(closes), name="datetime")
+    return pd.DataFrame({"$close": closes}, index=index)
+
+
+@pytest.fixture
+def basket():
+    return {
+        "A": _frame(RETURNS_A),
+        "B": _frame([2 * r for r in RETURNS_A]),
+        "C": _frame(RETURNS_C),
+    }
+
+
+class TestCorrelationMatrix:
+    """correlation_matrix测试类"""
+    
+    def test_known_three_instruments(self, basket):
+        matrix = correlation_matrix(basket, "$close", min_periods=5)
+        
+        expected = np.corrcoef(RETURNS_A, RETURNS_C)[0, 1]
+        assert matrix.instruments == ["A", "B", "C"]
+        assert matrix.get("A", "B") == pytest.approx(1.0)
+        assert matrix.get("A", "C") == pytest.approx(expected)
+        assert matrix.get("C", "B") == pytest.approx(expected)
+        assert np.diag(matrix.frame).tolist() == [1.0, 1.0, 1.0]
+        pd.testing.assert_frame_equal(matrix.frame, matrix.frame.T)
+        assert matrix.excluded == {}
+    
+    def test_missing_bars_use_overlapping_returns(self, basket):
+        """每对标的只使用两者都有收益率的时刻"""
+        basket["C"].iloc[3, 0] = np.nan
+        
+        matrix = correlation_matrix(basket, "$close", min_periods=3)
+        
+        # 第4根K线缺失，第3、4期收益率随之缺失
+        keep = [0, 1, 4, 5]
+        expected = np.corrcoef(
+            [RETURNS_A[i] for i in keep], [RETURNS_C[i] for i in keep]
+        )[0, 1]
+        assert matrix.get("A", "C") == pytest.approx(expected)
+    
+    def test_insufficient_data_is_excluded(self, basket):
+        """数据不足的标的列在excluded中，而不是作为NaN行出现"""
+        basket["D"] = _frame([0.01, 0.02])
+        basket["E"] = pd.DataFrame({"$open": [1.0]})
+        basket["F"] = _frame([0.01, -0.01, 0.02, 0.0, 0.01, 0.03], start="2025-01-07")
+        basket["G"] = _frame([0.0] * 6)
+        
+        matrix = correlation_matrix(basket, "$close", min_periods=5)
+        
+        assert matrix.instruments == ["A", "B", "C"]
+        assert set(matrix.excluded) == {"D", "E", "F", "G"}
+        assert "overlapping" in matrix.excluded["F"]
+        assert not matrix.frame.isna().any().any()
+        with pytest.raises(KeyError, match="excluded"):
+            matrix.get("A", "D")
+    
+    def test_fewer_than_two_instruments(self, basket):
+        with pytest.raises(InsufficientDataError, match="B"):
+            correlation_matrix({"A": basket["A"], "B": _frame([0.01])}, "$close", min_periods=5)
+    
+    def test_invalid_min_periods(self, basket):
+        with pytest.raises(ValueError):
+            correlation_matrix(basket, "$close", min_periods=1)
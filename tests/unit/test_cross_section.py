@@ -0,0 +1,92 @@
+"""
+Unit tests for cross-sectional operations
+截面运算单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.cross_section import cs_demean, cs_rank, cs_winsorize, cs_zscore, to_wide
+
+
+@pytest.fixture
+def wide():
+    """三个时刻、四个标的，第二行缺少一个标的 / Three timestamps by four instruments, one missing on the second row"""
+    index = pd.date_range("2025-01-02", periods=3, freq="D", name="datetime")
+    return pd.DataFrame({
+        "A": [1.0, 4.0, 2.0],
+        "B": [2.0, np.nan, 2.0],
+        "C": [3.0, 2.0, 2.0],
+        "D": [4.0, 6.0, 2.0],
+    }, index=index)
+
+
+class TestCrossSection:
+    """截面运算测试"""
+    
+    def test_rank_excludes_missing(self, wide):
+        """缺失的标的不参与排名，结果形状不变"""
+        result = cs_rank(wide)
+        
+        assert result.shape == wide.shape
+        assert list(result.iloc[0]) == [0.25, 0.5, 0.75, 1.0]
+        assert result.iloc[1]["A"] == pytest.approx(2 / 3)
+        assert np.isnan(result.iloc[1]["B"])
+        # 全部相同取平均排名
+        assert list(result.iloc[2]) == [0.625] * 4
+    
+    def test_demean_ignores_missing(self, wide):
+        """均值只用有效值计算"""
+        result = cs_demean(wide)
+        
+        assert list(result.iloc[0]) == [-1.5, -0.5, 0.5, 1.5]
+        assert result.iloc[1]["A"] == pytest.approx(0.0)
+        assert result.iloc[1]["D"] == pytest.approx(2.0)
+        assert np.isnan(result.iloc[1]["B"])
+    
+    def test_zscore(self, wide):
+        """标准分使用样本标准差，没有离散度的行为NaN"""
+        result = cs_zscore(wide)
+        
+        row = wide.iloc[0]
+        expected = (row - row.mean()) / row.std(ddof=1)
+        assert list(result.iloc[0]) == pytest.approx(list(expected))
+        assert result.iloc[1].dropna().mean() == pytest.approx(0.0)
+        assert np.isnan(result.iloc[1]["B"])
+        assert result.iloc[2].isna().all()
+    
+    def test_winsorize_clips_to_row_quantiles(self):
+        """每行截断到该行的分位数"""
+        values = pd.DataFrame([list(range(11)) + [100.0]], dtype=float)
+        
+        result = cs_winsorize(values, 0.1, 0.9)
+        
+        lower, upper = values.iloc[0].quantile([0.1, 0.9])
+        assert result.iloc[0].min() == pytest.approx(lower)
+        assert result.iloc[0].max() == pytest.approx(upper)
+        assert result.shape == values.shape
+    
+    def test_winsorize_keeps_missing(self, wide):
+        """缺失值保持为NaN，不影响分位数"""
+        result = cs_winsorize(wide, 0.0, 0.5)
+        
+        assert np.isnan(result.iloc[1]["B"])
+        assert result.iloc[1]["D"] == pytest.approx(4.0)
+    
+    @pytest.mark.parametrize("lower, upper", [(-0.1, 0.9), (0.6, 0.4), (0.1, 1.5)])
+    def test_winsorize_invalid_quantiles(self, wide, lower, upper):
+        """分位数必须满足0 <= lower <= upper <= 1"""
+        with pytest.raises(ValueError):
+            cs_winsorize(wide, lower, upper)
+    
+    def test_to_wide(self):
+        """多标的结果转为宽表，时间取并集"""
+        a = pd.DataFrame({"$close": [1.0, 2.0]}, index=pd.to_datetime(["2025-01-02", "2025-01-03"]))
+        b = pd.DataFrame({"$close": [3.0]}, index=pd.to_datetime(["2025-01-03"]))
+        
+        result = to_wide({"A": a, "B": b}, "$close")
+        
+        assert list(result.columns) == ["A", "B"]
+        assert len(result) == 2
+        assert np.isnan(result.loc["2025-01-02", "B"])
@@ -0,0 +1,439 @@
+"""
+Unit tests for CSVDataProvider and the provider registry
+CSV数据提供者和提供者注册表单元测试
+"""
+
+import pytest
+import pandas as pd
+
+from src.core.feature_stream import FeatureRequest
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import (
+    DataProvider,
+    FieldNotFoundError,
+    Freq,
+    InstrumentNotFoundError,
+    MetadataUnavailableError,
+    ProviderUnhealthyError,
+    UnsupportedFrequencyError,
+    register_provider,
+    get_provider,
+    set_default_provider,
+    get_default_provider,
+    to_freq
+)
+from src.core.data_manager import DataManager
+from src.utils.error_handler import DataError
+from src.utils.request_context import RequestContext, ContextCancelledError
+
+
+MINUTE_CSV_CONTENT = """datetime,open,close,volume
+2025-01-02 09:35:00,10.0,10.1,100
+2025-01-02 11:30:00,10.1,10.2,80
+2025-01-02 12:00:00,10.2,10.2,0
+2025-01-02 13:05:00,10.2,10.3,90
+2025-01-03 09:35:00,10.3,10.4,120
+"""
+
+
+CSV_CONTENT = """date,open,high,low,close,volume
+2025-01-02,10.0,10.5,9.8,10.2,1000
+2025-01-03,10.2,10.8,10.1,10.6,1200
+2025-01-06,10.6,10.9,10.3,10.4,900
+"""
+
+
+MAPPED_CSV_CONTENT = """trade_date,Open,Adj Close,Close,vol
+20250102,10.0,10.1,10.2,1000
+20250107,10.6,10.3,10.4,900
+"""
+
+
+def _session_csv(step):
+    """2025-01-02一个完整交易日的K线，以结束时刻标记，另有集合竞价、午休和收盘后的行"""
+    times = [pd.Timestamp("2025-01-02 09:25"), pd.Timestamp("2025-01-02 12:00"), pd.Timestamp("2025-01-02 15:30")]
+    for open_time, close_time in (("09:30", "11:30"), ("13:00", "15:00")):
+        times.extend(pd.date_range(f"2025-01-02 {open_time}", f"2025-01-02 {close_time}", freq=f"{step}min")[1:])
+    rows = [f"{t:%Y-%m-%d %H:%M:%S},10.0,10.0,100" for t in sorted(times)]
+    return "datetime,open,close,volume\n" + "\n".join(rows) + "\n"
+
+
+@pytest.fixture
+def csv_dir(tmp_path):
+    """Create a directory with one instrument CSV"""
+    (tmp_path / "SH600000.csv").write_text(CSV_CONTENT)
+    return tmp_path
+
+
+class TestCSVDataProvider:
+    """CSVDataProvider测试类"""
+    
+    def test_header_maps_to_fields(self, csv_dir):
+        """表头列映射为$字段"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        frame = provider.load_features(
+            "SH600000", ["$open", "$high", "$low", "$close", "$volume"]
+        )
+        
+        assert list(frame.columns) == ["$open", "$high", "$low", "$close", "$volume"]
+        assert len(frame) == 3
+        assert frame["$close"].iloc[0] == 10.2
+        assert isinstance(frame.index, pd.DatetimeIndex)
+    
+    def test_time_range_filter(self, csv_dir):
+        """start_time/end_time过滤包含边界"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        frame = provider.load_features(
+            "SH600000", ["$close"],
+            start_time="2025-01-03",
+            end_time="2025-01-06"
+        )
+        
+        assert list(frame["$close"]) == [10.6, 10.4]
+    
+    def test_timezone_aware_query_converted(self, csv_dir):
+        """带时区的查询时间转换为交易所时区"""
+        provider = CSVDataProvider(str(csv_dir), timezone="Asia/Shanghai")
+        
+        # 2025-01-02T16:00Z == 2025-01-03 00:00 in Shanghai
+        frame = provider.load_features(
+            "SH600000", ["$close"],
+            start_time="2025-01-02T16:00:00+00:00"
+        )
+        
+        assert frame.index[0] == pd.Timestamp("2025-01-03")
+    
+    def test_missing_field(self, csv_dir):
+        """请求CSV中不存在的字段时报错"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        with pytest.raises(DataError) as exc_info:
+            provider.load_features("SH600000", ["$close", "$vwap"])
+        
+        assert "$vwap" in str(exc_info.value)
+    
+    def test_misspelled_field_suggestion(self, csv_dir):
+        """拼错的字段在错误信息中给出最接近的可用字段"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        with pytest.raises(DataError) as exc_info:
+            provider.load_features("SH600000", ["$clsoe"])
+        
+        assert "did you mean $close?" in exc_info.value.error_info.error_message_en
+    
+    def test_typed_not_found_errors(self, csv_dir):
+        """未知标的和缺失字段分别抛出InstrumentNotFoundError和FieldNotFoundError"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        with pytest.raises(InstrumentNotFoundError) as unknown:
+            provider.load_features("SZ000001", ["$close"])
+        with pytest.raises(FieldNotFoundError) as missing:
+            provider.load_features("SH600000", ["$close", "$clsoe", "$vwap"])
+        
+        assert unknown.value.instrument == "SZ000001"
+        assert missing.value.fields == ["$clsoe", "$vwap"]
+        assert missing.value.instrument == "SH600000"
+        assert missing.value.suggestions["$clsoe"] == "$close"
+    
+    def test_unknown_instrument_does_not_fail_others(self, csv_dir):
+        """未知标的记录在结果的错误中，其他标的正常返回"""
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(csv_dir)))
+        
+        result = manager.get_features(["SH600000", "SZ000001"], ["$close"])
+        
+        assert list(result) == ["SH600000"]
+        assert list(result.error.of(InstrumentNotFoundError)) == ["SZ000001"]
+        assert result.error.of(FieldNotFoundError) == {}
+    
+    def test_list_fields_reads_header(self, csv_dir, monkeypatch):
+        """list_fields()只读取表头，结果排序"""
+        provider = CSVDataProvider(str(csv_dir), column_mapping={"volume": "vol"})
+        monkeypatch.setattr(provider, "_read_instrument", None)
+        
+        assert provider.list_fields("SH600000") == ["$close", "$high", "$low", "$open", "$vol"]
+        with pytest.raises(DataError):
+            provider.list_fields("SZ000001")
+    
+    def test_list_instruments(self, csv_dir):
+        """list_instruments()列出文件名，市场按交易所前缀匹配"""
+        (csv_dir / "SZ000001.csv").write_text("date,close\n2025-01-02,5.0\n")
+        (csv_dir / "notes.txt").write_text("not a csv")
+        provider = CSVDataProvider(str(csv_dir))
+        
+        assert provider.list_instruments() == ["SH600000", "SZ000001"]
+        assert provider.list_instruments("sz") == ["SZ000001"]
+        
+        manager = DataManager(enable_cache=False, provider=provider)
+        assert manager.list_instruments("SH") == ["SH600000"]
+        assert manager.list_fields("SZ000001") == ["$close"]
+    
+    def test_list_metadata_unsupported(self, csv_dir):
+        """未实现元数据查询的提供者抛出MetadataUnavailableError"""
+        class Bare(DataProvider):
+            def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+                return pd.DataFrame(columns=fields)
+            
+            def calendar(self, start_time=None, end_time=None, freq="day"):
+                return []
+        
+        with pytest.raises(MetadataUnavailableError):
+            Bare().list_fields("SH600000")
+        with pytest.raises(MetadataUnavailableError):
+            Bare().list_instruments()
+    
+    def test_missing_file(self, csv_dir):
+        """标的文件不存在时报错"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        with pytest.raises(DataError):
+            provider.load_features("SZ000001", ["$close"])
+    
+    def test_registered_provider_used_by_features(self, csv_dir):
+        """注册的提供者可以按名称在get_features中使用"""
+        provider = CSVDataProvider(str(csv_dir))
+        register_provider("local_csv", provider)
+        
+        assert get_provider("local_csv") is provider
+        
+        manager = DataManager(enable_cache=False)
+        result = manager.get_features(
+            ["SH600000", "SZ000001"], ["$close"], provider="local_csv"
+        )
+        
+        assert list(result.keys()) == ["SH600000"]
+        assert "SZ000001" in result.errors
+    
+    def test_unknown_provider(self):
+        """未注册的提供者名称报错"""
+        with pytest.raises(DataError):
+            get_provider("no_such_provider")
+    
+    
+    def test_column_mapping(self, tmp_path):
+        """column_mapping把非标准表头映射为字段"""
+        (tmp_path / "SH600000.csv").write_text(MAPPED_CSV_CONTENT)
+        provider = CSVDataProvider(
+            str(tmp_path),
+            column_mapping={"trade_date": "date", "Adj Close": "$close", "VOL": "volume"}
+        )
+        
+        frame = provider.load_features("SH600000", ["$open", "$close", "$volume"])
+        
+        # 映射后的Adj Close覆盖原始的Close列
+        assert list(frame["$close"]) == [10.1, 10.3]
+        assert list(frame["$volume"]) == [1000, 900]
+        assert frame.index[0] == pd.Timestamp("2025-01-02")
+    
+    def test_calendar_is_union_of_files(self, csv_dir):
+        """日历为所有CSV日期的并集，并支持时间范围"""
+        (csv_dir / "SZ000001.csv").write_text(
+            "date,close\n2025-01-02,5.0\n2025-01-07,5.1\n"
+        )
+        provider = CSVDataProvider(str(csv_dir))
+        
+        calendar = provider.calendar(start_time="2025-01-03")
+        
+        assert calendar == [
+            pd.Timestamp("2025-01-03"),
+            pd.Timestamp("2025-01-06"),
+            pd.Timestamp("2025-01-07"),
+        ]
+    
+    def test_features_batch(self, csv_dir):
+        """features()按标的返回数据，任一标的失败时报错"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        frames = provider.features(["SH600000"], ["$close"])
+        assert list(frames.keys()) == ["SH600000"]
+        
+        with pytest.raises(DataError):
+            provider.features(["SH600000", "SZ000001"], ["$close"])
+    
+    def test_load_with_context(self, csv_dir):
+        """load_features_ctx()分块读取的结果与load_features()一致"""
+        provider = CSVDataProvider(str(csv_dir))
+        provider.READ_CHUNK_ROWS = 1
+        
+        frame = provider.load_features_ctx(RequestContext(), "SH600000", ["$close"])
+        
+        assert frame.equals(provider.load_features("SH600000", ["$close"]))
+    
+    def test_cancel_mid_read(self, csv_dir, monkeypatch):
+        """读取过程中取消时抛出ContextCancelledError而不是DataError，并关闭文件"""
+        provider = CSVDataProvider(str(csv_dir))
+        provider.READ_CHUNK_ROWS = 1
+        ctx = RequestContext()
+        checks = []
+        original_check = ctx.check
+        
+        def check():
+            checks.append(1)
+            if len(checks) == 3:
+                ctx.cancel("stop")
+            original_check()
+        
+        monkeypatch.setattr(ctx, "check", check)
+        opened = []
+        real_open = open
+        
+        def tracking_open(*args, **kwargs):
+            handle = real_open(*args, **kwargs)
+            opened.append(handle)
+            return handle
+        
+        monkeypatch.setattr("builtins.open", tracking_open)
+        
+        with pytest.raises(ContextCancelledError):
+            provider.load_features_ctx(ctx, "SH600000", ["$close"])
+        assert opened and all(handle.closed for handle in opened)
+    
+    def test_healthcheck(self, csv_dir, tmp_path_factory):
+        CSVDataProvider(str(csv_dir)).healthcheck(RequestContext())
+        
+        empty = tmp_path_factory.mktemp("empty")
+        with pytest.raises(ProviderUnhealthyError, match="no CSV files"):
+            CSVDataProvider(str(empty)).healthcheck(RequestContext())
+        with pytest.raises(ProviderUnhealthyError, match="not found"):
+            CSVDataProvider(str(empty / "missing")).healthcheck(RequestContext())
+
+
+class TestIntradayCSV:
+    """分钟数据测试类"""
+    
+    @pytest.fixture
+    def minute_dir(self, csv_dir):
+        (csv_dir / "5min").mkdir()
+        (csv_dir / "5min" / "SH600000.csv").write_text(MINUTE_CSV_CONTENT)
+        return csv_dir
+    
+    def test_freqs_follow_subdirectories(self, minute_dir):
+        """有子目录的频率才受支持"""
+        assert CSVDataProvider(str(minute_dir)).freqs == ("5min", "day")
+    
+    def test_minute_bars_carry_full_timestamps(self, minute_dir):
+        """分钟数据的索引为完整时间戳"""
+        provider = CSVDataProvider(str(minute_dir))
+        
+        frame = provider.load_features("SH600000", ["$close"], end_time="2025-01-02 13:05", freq="5min")
+        
+        assert frame.index[0] == pd.Timestamp("2025-01-02 09:35")
+        assert frame.index[-1] == pd.Timestamp("2025-01-02 13:05")
+    
+    def test_unsupported_freq(self, csv_dir):
+        """没有数据的频率立即报错"""
+        provider = CSVDataProvider(str(csv_dir))
+        
+        with pytest.raises(UnsupportedFrequencyError) as exc_info:
+            provider.load_features("SH600000", ["$close"], freq="1min")
+        assert exc_info.value.error_info.error_code == "DAT0020"
+        assert exc_info.value.available == ("day",)
+        with pytest.raises(UnsupportedFrequencyError):
+            provider.calendar(freq="2min")
+    
+    def test_features_intraday_respects_sessions(self, minute_dir):
+        """按交易日历获取分钟数据时去掉午休的K线，只有日期的结束时间包含当天所有K线"""
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(minute_dir)))
+        
+        result = manager.get_features(
+            "SH600000", ["$close"],
+            start_time="2025-01-02", end_time="2025-01-02",
+            freq="5min", calendar="SSE"
+        )
+        
+        assert list(result["SH600000"].index) == [
+            pd.Timestamp("2025-01-02 09:35"),
+            pd.Timestamp("2025-01-02 11:30"),
+            pd.Timestamp("2025-01-02 13:05"),
+        ]
+    
+    @pytest.mark.parametrize("freq, step, bars", [
+        (Freq.MIN1, 1, 240),
+        (Freq.MIN5, 5, 48),
+        (Freq.MIN15, 15, 16),
+        (Freq.MIN60, 60, 4),
+    ])
+    def test_full_session_bar_count(self, csv_dir, freq, step, bars):
+        """上交所一个交易日4小时连续竞价，分钟K线数为240/步长"""
+        (csv_dir / freq.value).mkdir()
+        (csv_dir / freq.value / "SH600000.csv").write_text(_session_csv(step))
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(csv_dir)))
+        
+        result = manager.get_features(
+            "SH600000", ["$close"], start_time="2025-01-02", end_time="2025-01-02", freq=freq, calendar="SSE"
+        )
+        
+        frame = result["SH600000"]
+        assert len(frame) == bars
+        assert frame.index[0] == pd.Timestamp("2025-01-02 09:30") + pd.Timedelta(minutes=step)
+        assert frame.index[-1] == pd.Timestamp("2025-01-02 15:00")
+        assert frame.bar_interval() == pd.Timedelta(minutes=step)
+    
+    def test_daily_only_provider_says_so(self, csv_dir):
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(csv_dir)))
+        
+        with pytest.raises(UnsupportedFrequencyError) as exc_info:
+            manager.get_features("SH600000", ["$close"], freq=Freq.MIN5)
+        
+        assert exc_info.value.freq == "5min"
+        assert "only has daily bars" in exc_info.value.error_info.error_message_en
+    
+    def test_freq_names(self):
+        assert to_freq(Freq.MIN15) == "15min"
+        assert to_freq("Min60") == "60min"
+        assert to_freq("day") == "day"
+        assert to_freq("2min") == "2min"
+        assert FeatureRequest(["SH600000"], ["$close"], freq=Freq.MIN1).freq == "1min"
+    
+    def test_features_unsupported_freq_fails_fast(self, csv_dir):
+        """不支持的频率不会记为单个标的的错误"""
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(csv_dir)))
+        
+        with pytest.raises(UnsupportedFrequencyError):
+            manager.get_features(["SH600000", "SZ000001"], ["$close"], freq="15min")
+
+
+class TestDefaultProvider:
+    """全局默认提供者测试类"""
+    
+    def test_default_provider_used_without_call_site_changes(self, csv_dir):
+        """设置默认提供者后DataManager无需修改调用即可使用"""
+        provider = CSVDataProvider(str(csv_dir))
+        set_default_provider(provider)
+        try:
+            assert get_default_provider() is provider
+            
+            manager = DataManager(enable_cache=False)
+            result = manager.get_features("SH600000", ["$close"])
+            calendar = manager.get_calendar(end_time="2025-01-03")
+            
+            assert list(result["SH600000"]["$close"]) == [10.2, 10.6, 10.4]
+            assert calendar == [pd.Timestamp("2025-01-02"), pd.Timestamp("2025-01-03")]
+        finally:
+            set_default_provider(None)
+        
+        assert get_default_provider() is None
+    
+    def test_explicit_provider_wins_over_default(self, csv_dir, tmp_path_factory):
+        """构造时显式传入的提供者优先于全局默认提供者"""
+        other_dir = tmp_path_factory.mktemp("other")
+        (other_dir / "SH600000.csv").write_text("date,close\n2025-01-02,99.0\n")
+        
+        set_default_provider(CSVDataProvider(str(csv_dir)))
+        try:
+            manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(other_dir)))
+            result = manager.get_features("SH600000", ["$close"])
+            assert list(result["SH600000"]["$close"]) == [99.0]
+        finally:
+            set_default_provider(None)
+    
+    def test_set_default_by_name(self, csv_dir):
+        """可以按注册名称设置默认提供者"""
+        provider = CSVDataProvider(str(csv_dir))
+        register_provider("default_csv", provider)
+        set_default_provider("default_csv")
+        try:
+            assert get_default_provider() is provider
+        finally:
+            set_default_provider(None)
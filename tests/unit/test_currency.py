@@ -0,0 +1,70 @@
+"""
+Unit tests for instrument currencies and FX rates
+标的货币和汇率单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core import currency
+from src.core.currency import FXProvider, FXRateUnavailableError, get_currency, register_currency
+from src.infrastructure.csv_provider import CSVDataProvider
+
+
+@pytest.fixture(autouse=True)
+def no_registrations(monkeypatch):
+    monkeypatch.setattr(currency, "_CURRENCIES", {})
+
+
+@pytest.fixture
+def hkd():
+    index = pd.to_datetime(["2025-01-02", "2025-01-03", "2025-01-06"])
+    return pd.Series([0.92, 0.93, 0.91], index=index)
+
+
+class TestCurrency:
+    """标的货币测试类"""
+    
+    def test_prefix_and_registration(self):
+        assert get_currency("SH600000") == "CNY"
+        assert get_currency("HK00700") == "HKD"
+        assert get_currency("AAPL") == "CNY"
+        
+        register_currency("AAPL", "usd")
+        
+        assert get_currency("AAPL") == "USD"
+        with pytest.raises(ValueError):
+            register_currency("AAPL", "dollar")
+
+
+class TestFXProvider:
+    """汇率提供者测试类"""
+    
+    def test_carries_rate_forward_within_staleness(self, hkd):
+        fx = FXProvider({"HKDCNY": hkd}, max_staleness="3D")
+        
+        assert fx.rate("HKD", "CNY", "2025-01-03") == 0.93
+        assert fx.rate("HKD", "CNY", "2025-01-08") == 0.91
+        assert fx.rate("CNY", "CNY", "2025-01-08") == 1.0
+        with pytest.raises(FXRateUnavailableError) as exc_info:
+            fx.rate("HKD", "CNY", "2025-01-10")
+        assert exc_info.value.last == pd.Timestamp("2025-01-06")
+        with pytest.raises(FXRateUnavailableError):
+            fx.rate("HKD", "CNY", "2025-01-01")
+    
+    def test_inverse_and_missing_pairs(self, hkd):
+        fx = FXProvider({"CNYHKD": 1.0 / hkd})
+        
+        assert fx.rate("HKD", "CNY", "2025-01-06") == pytest.approx(0.91)
+        assert fx.rates("HKD", "CNY").name == "HKDCNY"
+        with pytest.raises(FXRateUnavailableError) as exc_info:
+            fx.rate("USD", "CNY", "2025-01-06")
+        assert exc_info.value.pair == "USDCNY" and exc_info.value.time is None
+    
+    def test_reads_data_provider(self, tmp_path):
+        (tmp_path / "HKDCNY.csv").write_text("date,close\n2025-01-02,0.92\n2025-01-03,0.93\n")
+        fx = FXProvider(CSVDataProvider(str(tmp_path)))
+        
+        assert fx.rate("HKD", "CNY", "2025-01-03") == 0.93
+        with pytest.raises(FXRateUnavailableError):
+            fx.rate("USD", "CNY", "2025-01-03")
@@ -1,19 +1,30 @@
 """
 Unit tests for DataManager
 """
+import threading
+import time
+
 import pytest
 import pandas as pd
+from concurrent.futures import Future
 from unittest.mock import Mock, MagicMock, patch
 from datetime import datetime
 
 from src.core.data_manager import (
     DataManager,
+    FeatureOptions,
     MissingValueStrategy,
     ValidationResult,
     DataInfo
 )
+from src.core.trading_calendar import FillPolicy
 from src.infrastructure.qlib_wrapper import QlibWrapper, QlibDataError
 from src.utils.error_handler import DataError
+from src.infrastructure.data_provider import DataProvider
+from src.utils.request_context import RequestContext, ContextCancelledError, background
+from src.utils.retry import RetryExhaustedError, RetryPolicy
+from src.core.feature_frame import FeatureFetchError, PartialFetchError
+from src.core.request_time import RequestTimeError
 
 
 class TestDataManager:
@@ -328,3 +339,593 @@ class TestDataManager:
         manager = DataManager(qlib_wrapper=mock_wrapper)
         
         assert manager.qlib_wrapper is mock_wrapper
+
+
+def _make_instrument_frame(instrument, closes):
+    """Build a qlib-style (instrument, datetime) frame for one instrument"""
+    dates = pd.date_range("2025-01-02", periods=len(closes), freq="D")
+    index = pd.MultiIndex.from_product(
+        [[instrument], dates], names=["instrument", "datetime"]
+    )
+    return pd.DataFrame({"$close": closes}, index=index)
+
+
+class TestGetFeatures:
+    """Test suite for DataManager.get_features"""
+    
+    def _make_manager(self, frames):
+        mock_wrapper = Mock(spec=QlibWrapper)
+        
+        def get_data(instruments, fields, start_time, end_time, freq):
+            code = instruments[0]
+            if code not in frames:
+                raise KeyError(f"unknown instrument {code}")
+            return frames[code]
+        
+        mock_wrapper.get_data = Mock(side_effect=get_data)
+        return DataManager(qlib_wrapper=mock_wrapper, enable_cache=False)
+    
+    def test_single_instrument_string(self):
+        """A single code still returns a map keyed by that code"""
+        manager = self._make_manager({
+            "SH000300": _make_instrument_frame("SH000300", [1.0, 2.0, 3.0])
+        })
+        
+        result = manager.get_features("SH000300", ["$close"])
+        
+        assert list(result.keys()) == ["SH000300"]
+        assert list(result["SH000300"]["$close"]) == [1.0, 2.0, 3.0]
+        assert result.error is None
+    
+    def test_multiple_instruments_in_request_order(self):
+        """Results are keyed per instrument in the requested order"""
+        manager = self._make_manager({
+            "SH000300": _make_instrument_frame("SH000300", [1.0, 2.0]),
+            "SH000905": _make_instrument_frame("SH000905", [3.0, 4.0]),
+            "SZ399006": _make_instrument_frame("SZ399006", [5.0, 6.0]),
+        })
+        
+        result = manager.get_features(
+            ["SZ399006", "SH000300", "SH000905"], ["$close"]
+        )
+        
+        assert list(result.keys()) == ["SZ399006", "SH000300", "SH000905"]
+        assert result["SH000905"]["$close"].iloc[-1] == 4.0
+        assert not isinstance(result["SH000300"].index, pd.MultiIndex)
+    
+    def test_failed_instrument_does_not_abort_others(self):
+        """A failing symbol is reported in the error while others return"""
+        manager = self._make_manager({
+            "SH000300": _make_instrument_frame("SH000300", [1.0, 2.0]),
+        })
+        
+        result = manager.get_features(["SH000300", "BAD001"], ["$close"])
+        
+        assert list(result.keys()) == ["SH000300"]
+        assert "BAD001" in result.errors
+        assert "BAD001" in result.error.errors
+        with pytest.raises(DataError):
+            result.raise_for_errors()
+    
+    def test_empty_instrument_reported_as_error(self):
+        """An instrument with no rows is an explicit error, not silently dropped"""
+        manager = self._make_manager({
+            "SH000300": _make_instrument_frame("SH000300", [1.0]),
+            "SZ399001": _make_instrument_frame("SZ399001", []),
+        })
+        
+        result = manager.get_features(["SH000300", "SZ399001"], ["$close"])
+        
+        assert "SZ399001" in result.errors
+        assert isinstance(result.errors["SZ399001"], DataError)
+    
+    def test_instrument_lookup(self):
+        """instrument() returns (frame, ok) for present and absent codes"""
+        manager = self._make_manager({
+            "SZ399001": _make_instrument_frame("SZ399001", [7.0, 8.0]),
+        })
+        
+        result = manager.get_features(
+            ["SZ399001", "SH000905"], ["$close"], max_workers=1
+        )
+        
+        frame, ok = result.instrument("SZ399001")
+        assert ok
+        assert frame["$close"].iloc[0] == 7.0
+        
+        frame, ok = result.instrument("SH000905")
+        assert not ok
+        assert frame is None
+    
+    def test_invalid_max_workers(self):
+        """max_workers must be positive"""
+        with pytest.raises(ValueError):
+            DataManager(qlib_wrapper=Mock(spec=QlibWrapper), max_workers=0)
+    
+    def test_calendar_snaps_range_and_drops_non_sessions(self):
+        """With a calendar the range snaps to trading days and weekend rows are dropped"""
+        manager = self._make_manager({
+            # 2025-01-02 (Thu) to 2025-01-07 (Tue), including a weekend
+            "SH600000": _make_instrument_frame("SH600000", [1.0, 2.0, 3.0, 4.0, 5.0, 6.0]),
+        })
+        
+        result = manager.get_features(
+            "SH600000", ["$close", "Ref($close,1)"],
+            start_time="2025-01-01", end_time="2025-01-05",
+            calendar="SSE"
+        )
+        
+        call = manager.qlib_wrapper.get_data.call_args
+        assert call.kwargs["start_time"] == "2025-01-02"
+        assert call.kwargs["end_time"] == "2025-01-03"
+        
+        frame = result["SH600000"]
+        assert list(frame.index) == [
+            pd.Timestamp("2025-01-02"), pd.Timestamp("2025-01-03"),
+            pd.Timestamp("2025-01-06"), pd.Timestamp("2025-01-07"),
+        ]
+        # Ref shifts across sessions, skipping the weekend rows
+        assert frame["Ref($close,1)"].iloc[2] == 2.0
+    
+    def test_rfc3339_times_are_exchange_local(self):
+        """RFC3339 times reach the provider as exchange-local wall time"""
+        manager = self._make_manager({
+            "SH600000": _make_instrument_frame("SH600000", [1.0, 2.0, 3.0]),
+        })
+        
+        manager.get_features(
+            "SH600000", ["$close"],
+            start_time="2025-01-02T01:30:00Z", end_time="2025-01-04T00:00:00+08:00"
+        )
+        
+        call = manager.qlib_wrapper.get_data.call_args
+        assert call.kwargs["start_time"] == "2025-01-02 09:30:00"
+        assert call.kwargs["end_time"] == "2025-01-04"
+    
+    def test_request_timezone(self):
+        """The request timezone wins over the manager default"""
+        manager = self._make_manager({
+            "SH600000": _make_instrument_frame("SH600000", [1.0, 2.0, 3.0]),
+        })
+        
+        manager.get_features(
+            "SH600000", ["$close"], start_time="2025-01-02T14:30:00Z", timezone="America/New_York"
+        )
+        
+        assert manager.qlib_wrapper.get_data.call_args.kwargs["start_time"] == "2025-01-02 09:30:00"
+        assert manager.timezone == "Asia/Shanghai"
+    
+    @pytest.mark.parametrize("start, end, field", [
+        ("2025-01-02 09:30", None, "start_time"),
+        (None, "01/05/2025", "end_time"),
+        ("2025-01-05", "2025-01-02", "start_time"),
+    ])
+    def test_bad_request_times(self, start, end, field):
+        """Bad or inverted times fail before any fetch and name the field"""
+        manager = self._make_manager({
+            "SH600000": _make_instrument_frame("SH600000", [1.0]),
+        })
+        
+        with pytest.raises(RequestTimeError) as exc_info:
+            manager.get_features("SH600000", ["$close"], start_time=start, end_time=end)
+        
+        assert exc_info.value.field == field
+        assert field in str(exc_info.value)
+        manager.qlib_wrapper.get_data.assert_not_called()
+    
+    def test_cross_sectional_expression(self):
+        """Cross-sectional fields are computed across every requested instrument"""
+        manager = self._make_manager({
+            "SH600000": _make_instrument_frame("SH600000", [1.0, 2.0, 3.0]),
+            "SZ000001": _make_instrument_frame("SZ000001", [10.0, 11.0, 12.0]),
+            "SZ000002": _make_instrument_frame("SZ000002", [5.0, 6.0, 9.0]),
+        })
+        
+        result = manager.get_features(
+            ["SH600000", "SZ000001", "SZ000002"],
+            ["CSRank($close/Ref($close,1)-1)", "$close"]
+        )
+        
+        frame = result["SH600000"]
+        assert list(frame.columns) == ["CSRank($close/Ref($close,1)-1)", "$close"]
+        assert pd.isna(frame.iloc[0, 0])
+        assert frame.iloc[1, 0] == pytest.approx(1.0)
+        assert result["SZ000001"].iloc[2, 0] == pytest.approx(1 / 3)
+        assert list(result["SZ000002"]["$close"]) == [5.0, 6.0, 9.0]
+    
+    
+    def _make_gapped_manager(self):
+        # SZ000001 has no bar on 2025-01-03
+        gapped = _make_instrument_frame("SZ000001", [10.0, 11.0, 12.0]).iloc[[0, 2]]
+        return self._make_manager({
+            "SH600000": _make_instrument_frame("SH600000", [1.0, 2.0]),
+            "SZ000001": gapped,
+        })
+    
+    @pytest.mark.parametrize("policy, expected, rows", [
+        (FillPolicy.NAN, [10.0, None], 2),
+        (FillPolicy.FORWARD_FILL, [10.0, 10.0], 2),
+        (FillPolicy.DROP, [10.0], 1),
+    ])
+    def test_align_fill_policies(self, policy, expected, rows):
+        """Aligned frames share identical rows, missing bars follow the fill policy"""
+        manager = self._make_gapped_manager()
+        
+        result = manager.get_features(
+            ["SH600000", "SZ000001"], ["$close"],
+            start_time="2025-01-02", end_time="2025-01-03",
+            calendar="SSE", align=True, fill_policy=policy
+        )
+        
+        assert len(result["SH600000"]) == len(result["SZ000001"]) == rows
+        assert result["SH600000"].index.equals(result["SZ000001"].index)
+        closes = [None if pd.isna(v) else v for v in result["SZ000001"]["$close"]]
+        assert closes == expected
+    
+    def test_align_fill_policy_per_field(self):
+        """Prices forward-fill while volume zero-fills; expressions follow their fields or the default"""
+        dates = pd.date_range("2025-01-02", periods=2, freq="D")
+        index = pd.MultiIndex.from_product([["SZ000001"], dates], names=["instrument", "datetime"])
+        # SZ000001 has no bar on 2025-01-03
+        gapped = pd.DataFrame({"$close": [10.0, 11.0], "$volume": [100.0, 200.0]}, index=index).iloc[[0]]
+        full = pd.DataFrame(
+            {"$close": [1.0, 2.0], "$volume": [5.0, 6.0]},
+            index=index.set_levels(["SH600000"], level="instrument")
+        )
+        manager = self._make_manager({"SH600000": full, "SZ000001": gapped})
+        fields = ["$close", "$volume", "$close*2", "$close*$volume"]
+        
+        def fetch(fill_policy):
+            result = manager.get_features(
+                ["SH600000", "SZ000001"], fields,
+                start_time="2025-01-02", end_time="2025-01-03",
+                calendar="SSE", align=True, fill_policy=fill_policy
+            )
+            return [None if pd.isna(v) else v for v in result["SZ000001"].iloc[1]]
+        
+        assert fetch({"$close": FillPolicy.FORWARD_FILL, "$volume": FillPolicy.ZERO}) == [10.0, 0.0, 20.0, None]
+        assert fetch({"$close": "ffill", "$volume": "zero", "*": "bfill", "$close*$volume": "zero"}) == (
+            [10.0, 0.0, 20.0, 0.0]
+        )
+        assert fetch({"$volume": FillPolicy.ZERO, "*": FillPolicy.FORWARD_FILL}) == [10.0, 0.0, 20.0, 1000.0]
+        with pytest.raises(ValueError):
+            fetch({"$close": FillPolicy.DROP})
+
+
+class BlockingProvider(DataProvider):
+    """Blocks every load until released, to cancel fetches mid-flight"""
+    
+    name = "blocking"
+    
+    def __init__(self, fast=()):
+        self.started = threading.Event()
+        self.release = threading.Event()
+        self.loads = []
+        self.fast = set(fast)
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.loads.append(instrument)
+        if instrument not in self.fast:
+            self.started.set()
+            self.release.wait(5)
+        return _make_instrument_frame(instrument, [1.0]).droplevel("instrument")
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return []
+
+
+class TestGetFeaturesContext:
+    """Test suite for DataManager.get_features_ctx"""
+    
+    def test_cancelled_before_start(self):
+        """An already-cancelled context raises without touching the provider"""
+        provider = BlockingProvider()
+        manager = DataManager(enable_cache=False, provider=provider)
+        ctx = RequestContext()
+        ctx.cancel()
+        
+        with pytest.raises(ContextCancelledError):
+            manager.get_features_ctx(ctx, ["SH600000"], ["$close"])
+        assert provider.loads == []
+    
+    def test_cancel_mid_fetch_returns_promptly(self):
+        """Cancelling while a provider blocks raises instead of waiting for it"""
+        provider = BlockingProvider()
+        manager = DataManager(enable_cache=False, provider=provider)
+        ctx = RequestContext()
+        
+        def cancel_when_started():
+            provider.started.wait(5)
+            ctx.cancel("client went away")
+        
+        threading.Thread(target=cancel_when_started).start()
+        begin = time.monotonic()
+        try:
+            with pytest.raises(ContextCancelledError) as exc_info:
+                manager.get_features_ctx(ctx, ["SH600000", "SZ000001"], ["$close"], max_workers=1)
+            assert time.monotonic() - begin < 2
+            assert exc_info.value.reason == "client went away"
+        finally:
+            provider.release.set()
+    
+    def test_deadline_exceeded(self):
+        """A context timeout surfaces as a deadline error, not a per-instrument error"""
+        provider = BlockingProvider()
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        try:
+            with pytest.raises(ContextCancelledError) as exc_info:
+                manager.get_features_ctx(RequestContext(timeout=0.05), ["SH600000"], ["$close"])
+            assert exc_info.value.deadline_exceeded
+        finally:
+            provider.release.set()
+    
+    def test_get_features_is_uncancellable_wrapper(self):
+        """get_features() keeps working without a context"""
+        provider = BlockingProvider()
+        provider.release.set()
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(["SH600000"], ["$close"])
+        
+        assert result.error is None
+        assert list(result["SH600000"]["$close"]) == [1.0]
+    
+    def test_cancel_returns_completed_instruments(self):
+        """Cancelling mid-fetch keeps the instruments that already completed"""
+        provider = BlockingProvider(fast={"SH600000"})
+        manager = DataManager(enable_cache=False, provider=provider)
+        ctx = RequestContext()
+        
+        def cancel_when_started():
+            provider.started.wait(5)
+            time.sleep(0.05)
+            ctx.cancel("client went away")
+        
+        threading.Thread(target=cancel_when_started).start()
+        try:
+            with pytest.raises(PartialFetchError) as exc_info:
+                manager.get_features_ctx(ctx, ["SH600000", "SZ000001"], ["$close"], max_workers=2)
+        finally:
+            provider.release.set()
+        
+        error = exc_info.value
+        assert isinstance(error, ContextCancelledError)
+        assert error.reason == "client went away"
+        assert list(error.result) == ["SH600000"]
+        assert error.pending == ["SZ000001"]
+        assert isinstance(error.cause, ContextCancelledError)
+    
+    def test_timeout_option(self):
+        """A per-request timeout applies without a deadline on the context"""
+        provider = BlockingProvider()
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        try:
+            begin = time.monotonic()
+            with pytest.raises(ContextCancelledError) as exc_info:
+                manager.get_features_ctx(RequestContext(), ["SH600000"], ["$close"], timeout=0.05)
+            assert time.monotonic() - begin < 2
+            assert exc_info.value.deadline_exceeded
+        finally:
+            provider.release.set()
+
+
+class SlowProvider(DataProvider):
+    """Sleeps per instrument and fails the ones listed in bad"""
+    
+    name = "slow"
+    
+    def __init__(self, delays, bad=()):
+        self.delays = dict(delays)
+        self.bad = set(bad)
+        self.release = threading.Event()
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        if instrument in self.bad:
+            raise ValueError(f"corrupt file ({instrument})")
+        delay = self.delays.get(instrument, 0.0)
+        if delay is None:
+            self.release.wait(5)
+        else:
+            time.sleep(delay)
+        return _make_instrument_frame(instrument, [1.0]).droplevel("instrument")
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return []
+
+
+class TestWorkerPool:
+    """Test suite for the worker pool behind get_features"""
+    
+    def test_default_workers_follow_cpu_count(self):
+        """max_workers defaults to the CPU count"""
+        with patch("src.core.data_manager.os.cpu_count", return_value=3):
+            manager = DataManager(qlib_wrapper=Mock(spec=QlibWrapper))
+        
+        assert manager._max_workers == 3
+    
+    def test_result_order_ignores_completion_order(self):
+        """Instruments come back in request order even when later ones finish first"""
+        codes = ["SH600000", "SH600001", "SH600002", "SH600003"]
+        provider = SlowProvider({code: 0.04 * (len(codes) - i) for i, code in enumerate(codes)})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(codes, ["$close", "$close*2"], max_workers=4)
+        
+        assert list(result) == codes
+        assert all(list(frame.columns) == ["$close", "$close*2"] for frame in result.values())
+    
+    def test_progress(self):
+        """The progress callback sees a growing done count ending at the total"""
+        codes = ["SH600000", "SH600001", "SZ000001"]
+        provider = SlowProvider({"SH600001": 0.05, "SZ000001": 0.1})
+        manager = DataManager(enable_cache=False, provider=provider)
+        calls = []
+        
+        manager.get_features(
+            codes, ["$close"], max_workers=3, progress=lambda done, total: calls.append((done, total))
+        )
+        
+        assert calls[-1] == (3, 3)
+        assert [done for done, _ in calls] == sorted(set(done for done, _ in calls))
+        assert all(total == 3 for _, total in calls)
+    
+    def test_progress_once_per_instrument(self):
+        """Instruments finishing together are still reported one by one, on the calling thread"""
+        codes = [f"SH60{i:04d}" for i in range(12)]
+        provider = SlowProvider({}, bad={"SH600003"})
+        manager = DataManager(enable_cache=False, provider=provider)
+        calls = []
+        
+        manager.get_features(
+            codes, ["$close"], max_workers=6,
+            progress=lambda done, total: calls.append((done, total, threading.current_thread()))
+        )
+        
+        # 失败的标的也计入进度
+        assert [(done, total) for done, total, _ in calls] == [(i, 12) for i in range(1, 13)]
+        assert {thread for _, _, thread in calls} == {threading.current_thread()}
+    
+    def test_fail_fast_reports_the_finished_round(self):
+        """fail_fast still reports every future that finished in the failing round"""
+        futures = [Future() for _ in range(3)]
+        futures[0].set_result(None)
+        futures[1].set_exception(ValueError("corrupt file"))
+        futures[2].set_result(None)
+        manager = DataManager(enable_cache=False, provider=SlowProvider({}))
+        calls = []
+        
+        failed = manager._wait_all(background(), futures, lambda done, total: calls.append((done, total)), True)
+        
+        assert failed is futures[1]
+        assert calls == [(1, 3), (2, 3), (3, 3)]
+    
+    def test_errors_are_isolated_by_default(self):
+        """Without fail_fast a failing instrument is only recorded in errors"""
+        provider = SlowProvider({}, bad={"SZ000001"})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(["SH600000", "SZ000001"], ["$close"])
+        
+        assert list(result) == ["SH600000"]
+        assert isinstance(result.errors["SZ000001"], ValueError)
+    
+    def test_fail_fast_cancels_the_rest(self):
+        """With fail_fast the first failure cancels the other workers and names the instrument"""
+        provider = SlowProvider({"SH600000": None, "SH600001": None}, bad={"SZ000001"})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        begin = time.monotonic()
+        try:
+            with pytest.raises(FeatureFetchError) as exc_info:
+                manager.get_features(
+                    ["SH600000", "SH600001", "SZ000001"], ["$close"], max_workers=3, fail_fast=True
+                )
+            assert time.monotonic() - begin < 2
+        finally:
+            provider.release.set()
+        
+        assert list(exc_info.value.errors) == ["SZ000001"]
+        assert isinstance(exc_info.value.errors["SZ000001"], ValueError)
+
+
+class TestFeatureOptions:
+    """Test suite for the per-call FeatureOptions"""
+    
+    def test_options_are_reused_and_overridden(self):
+        """One options object serves several calls, and keywords override its fields"""
+        manager = DataManager(enable_cache=False, provider=SlowProvider({}))
+        calls = []
+        options = FeatureOptions(max_workers=1, progress=lambda done, total: calls.append((done, total)))
+        
+        manager.get_features(["SH600000"], ["$close"], options=options)
+        manager.get_features(["SH600000", "SZ000001"], ["$close"], options=options, progress=None)
+        manager.get_features_ctx(RequestContext(), ["SZ000001"], ["$close"], options=options)
+        
+        assert calls == [(1, 1), (1, 1)]
+        assert FeatureOptions.of(options, {}) is options
+    
+    def test_unknown_and_conflicting_options(self):
+        """Unknown names and unsupported combinations fail before any fetch"""
+        manager = DataManager(enable_cache=False, provider=SlowProvider({}))
+        
+        with pytest.raises(TypeError, match="unknown feature options: workers"):
+            manager.get_features(["SH600000"], ["$close"], workers=2)
+        with pytest.raises(ValueError):
+            FeatureOptions(lazy=True, align=True)
+        with pytest.raises(ValueError):
+            FeatureOptions.of(FeatureOptions(utc=True), {"align": True})
+        with pytest.raises(AttributeError):
+            FeatureOptions().freq = "5min"
+
+
+class FlakyProvider(DataProvider):
+    """Fails with a connection error a set number of times per instrument"""
+    
+    name = "flaky"
+    
+    def __init__(self, failures):
+        self.failures = dict(failures)
+        self.attempts = {}
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.attempts[instrument] = self.attempts.get(instrument, 0) + 1
+        if self.attempts[instrument] <= self.failures.get(instrument, 0):
+            raise ConnectionError(f"connection reset ({instrument})")
+        return _make_instrument_frame(instrument, [1.0]).droplevel("instrument")
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        self.attempts["calendar"] = self.attempts.get("calendar", 0) + 1
+        if self.attempts["calendar"] <= self.failures.get("calendar", 0):
+            raise TimeoutError("read timed out")
+        return [pd.Timestamp("2025-01-02")]
+
+
+class TestRetry:
+    """Test suite for retrying transient provider failures"""
+    
+    POLICY = RetryPolicy(max_attempts=3, initial_delay=0.0, jitter=0.0)
+    
+    def test_transient_failures_are_retried(self):
+        """Instruments recover after transient failures within the attempt budget"""
+        provider = FlakyProvider({"SH600000": 2})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(["SH600000", "SZ000001"], ["$close"], retry=self.POLICY)
+        
+        assert result.error is None
+        assert provider.attempts == {"SH600000": 3, "SZ000001": 1}
+    
+    def test_exhausted_retries_are_recorded(self):
+        """An instrument that keeps failing is recorded with the last error"""
+        provider = FlakyProvider({"SH600000": 5})
+        manager = DataManager(enable_cache=False, provider=provider, retry_policy=self.POLICY)
+        
+        result = manager.get_features(["SH600000", "SZ000001"], ["$close"])
+        
+        error = result.errors["SH600000"]
+        assert isinstance(error, RetryExhaustedError)
+        assert error.instrument == "SH600000"
+        assert error.attempts == 3
+        assert isinstance(error.last_error, ConnectionError)
+        assert list(result) == ["SZ000001"]
+    
+    def test_no_retry_by_default(self):
+        """Without a policy the provider error is recorded as is"""
+        provider = FlakyProvider({"SH600000": 1})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features(["SH600000"], ["$close"])
+        
+        assert isinstance(result.errors["SH600000"], ConnectionError)
+        assert provider.attempts == {"SH600000": 1}
+    
+    def test_calendar_is_retried(self):
+        provider = FlakyProvider({"calendar": 1})
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        calendar = manager.get_calendar(retry=self.POLICY)
+        
+        assert calendar == [pd.Timestamp("2025-01-02")]
+        assert provider.attempts["calendar"] == 2
@@ -0,0 +1,149 @@
+"""
+Unit tests for incremental data updates
+增量数据更新单元测试
+"""
+
+import os
+
+import pandas as pd
+import pytest
+
+from src.core.data_update import CacheStore, ParquetStore, update
+from src.utils.feature_cache import FeatureCache
+from tests.unit._providers import FakeProvider, daily_bars
+
+
+FIELDS = ["$close", "$volume"]
+
+
+@pytest.fixture
+def provider():
+    return FakeProvider({"SH600000": daily_bars("2025-01-02", 20)})
+
+
+@pytest.fixture
+def cache_store(tmp_path):
+    return CacheStore(FeatureCache(str(tmp_path / "cache")))
+
+
+class TestCacheStoreUpdate:
+    """特征缓存存储的增量更新测试类"""
+    
+    def test_first_update_fetches_full_history(self, cache_store, provider):
+        summary = update(cache_store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15")
+        
+        result = summary.instruments["SH600000"]
+        assert result.full_history
+        assert summary.rows_added == {"SH600000": 10}
+        assert result.last_time == pd.Timestamp("2025-01-15")
+        assert provider.calls == [("SH600000", None, "2025-01-15")]
+    
+    def test_only_new_bars_fetched(self, cache_store, provider):
+        update(cache_store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15", overlap=2)
+        
+        summary = update(cache_store, ["SH600000"], FIELDS, provider=provider, overlap=2)
+        
+        # 从倒数第二根已存储的K线开始获取
+        assert provider.calls[-1][1] == pd.Timestamp("2025-01-14")
+        assert summary.rows_added == {"SH600000": 10}
+        assert summary.rows_revised == {"SH600000": 0}
+        entry = cache_store.cache.read("SH600000", "$close", "day")
+        assert entry.series.tolist() == provider.frames["SH600000"]["$close"].tolist()
+        assert entry.end == pd.Timestamp("2025-01-29")
+    
+    def test_nothing_new(self, cache_store, provider):
+        update(cache_store, ["SH600000"], FIELDS, provider=provider)
+        before = cache_store.cache.read("SH600000", "$close", "day").created_at
+        
+        summary = update(cache_store, ["SH600000"], FIELDS, provider=provider)
+        
+        assert summary.rows_added == {"SH600000": 0}
+        # 没有变化时不重写存储
+        assert cache_store.cache.read("SH600000", "$close", "day").created_at == before
+    
+    def test_restated_last_bar_is_reconciled(self, cache_store, provider):
+        update(cache_store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15")
+        provider.frames["SH600000"].loc["2025-01-15", "$close"] = 99.0
+        
+        summary = update(cache_store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-16")
+        
+        assert summary.rows_added == {"SH600000": 1}
+        assert summary.rows_revised == {"SH600000": 1}
+        series = cache_store.cache.read("SH600000", "$close", "day").series
+        assert series.loc["2025-01-15"] == 99.0
+        assert series.index.is_unique and len(series) == 11
+    
+    def test_new_field_refetches_history(self, cache_store, provider):
+        update(cache_store, ["SH600000"], ["$close"], provider=provider, end_time="2025-01-15")
+        
+        summary = update(cache_store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15")
+        
+        assert summary.instruments["SH600000"].full_history
+        assert len(cache_store.cache.read("SH600000", "$volume", "day").series) == 10
+    
+    def test_failures_are_isolated(self, cache_store, provider):
+        summary = update(cache_store, ["SZ000001", "SH600000"], FIELDS, provider=provider)
+        
+        assert list(summary.failed) == ["SZ000001"]
+        assert summary.rows_added == {"SH600000": 20}
+    
+    def test_invalid_arguments(self, cache_store, provider):
+        with pytest.raises(ValueError):
+            update(cache_store, ["SH600000"], [], provider=provider)
+        with pytest.raises(ValueError):
+            update(cache_store, ["SH600000"], FIELDS, provider=provider, overlap=0)
+
+
+class TestParquetStoreUpdate:
+    """Parquet目录存储的增量更新测试类"""
+    
+    @pytest.fixture
+    def store(self, tmp_path):
+        pytest.importorskip("pyarrow")
+        return ParquetStore(str(tmp_path / "parquet"))
+    
+    def test_appends_and_revises(self, store, provider):
+        from src.infrastructure.parquet_provider import read_parquet
+        
+        update(store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15")
+        provider.frames["SH600000"].loc["2025-01-14", "$volume"] = 5.0
+        
+        summary = update(store, ["SH600000"], FIELDS, provider=provider)
+        
+        assert summary.rows_added == {"SH600000": 10}
+        assert summary.rows_revised == {"SH600000": 1}
+        stored = read_parquet(str(store.data_dir / "SH600000.parquet"))
+        pd.testing.assert_frame_equal(stored, provider.frames["SH600000"], check_freq=False)
+        assert stored.attrs["instrument"] == "SH600000"
+    
+    def test_columns_not_updated_are_kept(self, store, provider):
+        from src.infrastructure.parquet_provider import read_parquet, write_parquet
+        
+        frame = provider.frames["SH600000"].iloc[:10].assign(**{"$factor": 2.0})
+        write_parquet(str(store.data_dir / "SH600000.parquet"), frame, instrument="SH600000")
+        
+        update(store, ["SH600000"], FIELDS, provider=provider)
+        
+        stored = read_parquet(str(store.data_dir / "SH600000.parquet"))
+        assert len(stored) == 20
+        assert stored["$factor"].iloc[:10].tolist() == [2.0] * 10
+        assert stored["$factor"].iloc[10:].isna().all()
+    
+    def test_failed_write_leaves_file_intact(self, store, provider, monkeypatch):
+        from src.core import data_update
+        
+        update(store, ["SH600000"], FIELDS, provider=provider, end_time="2025-01-15")
+        path = store.data_dir / "SH600000.parquet"
+        before = path.read_bytes()
+        
+        def crash(tmp_name, frame, **kwargs):
+            with open(tmp_name, "wb") as f:
+                f.write(b"PAR1 truncated")
+            raise OSError("disk full")
+        monkeypatch.setattr(data_update, "write_parquet", crash)
+        summary = update(store, ["SH600000"], FIELDS, provider=provider)
+        
+        assert "disk full" in summary.failed["SH600000"]
+        assert path.read_bytes() == before
+        # 临时文件已被删除
+        assert os.listdir(store.data_dir) == ["SH600000.parquet"]
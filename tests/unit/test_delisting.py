@@ -0,0 +1,211 @@
+"""
+Unit tests for delisted instruments
+退市标的单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import EngineConfig, FillKind, Order, OrderSide, run
+from src.core import delisting as delisting_module
+from src.core.data_manager import DataManager
+from src.core.delisting import Delisting, get_delisting, register_delisting
+from src.core.feature_frame import FeatureFrame
+from src.core.trading_calendar import FillPolicy
+from src.core.universe import Universe
+from tests.unit._providers import FakeProvider
+
+
+# 2025-01-02至2025-01-08的5个交易日，SH600000于1月6日退市
+DAYS = pd.bdate_range("2025-01-02", periods=5, name="datetime")
+
+
+@pytest.fixture(autouse=True)
+def registry(monkeypatch):
+    monkeypatch.setattr(delisting_module, "_DELISTINGS", {})
+
+
+@pytest.fixture
+def data():
+    return {
+        "SH600000": FeatureFrame({"$open": [10.0, 11.0, 12.0, 13.0, 14.0],
+                                  "$close": [10.5, 11.5, 12.5, 13.5, 14.5]}, index=DAYS),
+        "SZ000001": FeatureFrame({"$open": [20.0] * 5, "$close": [20.0] * 5}, index=DAYS),
+    }
+
+
+def _config(data, **kwargs):
+    return EngineConfig(start_time="2025-01-01", end_time="2025-01-31", data=data, initial_cash=1000.0, **kwargs)
+
+
+def _buy_first_bar(ctx, portfolio, bars):
+    if ctx.time == DAYS[0]:
+        return [Order("SH600000", OrderSide.BUY, 10)]
+    return None
+
+
+class TestDelisting:
+    """退市信息测试类"""
+    
+    def test_settlement(self):
+        assert Delisting("SH600000", "2025-01-06", settlement_price=8.0).settlement(12.5) == 8.0
+        assert Delisting("SH600000", "2025-01-06", recovery_rate=0.5).settlement(12.5) == 6.25
+        assert Delisting("SH600000", "2025-01-06").settlement(12.5) == 12.5
+        assert Delisting("SH600000", "2025-01-06", recovery_rate=0.0).settlement(None) == 0.0
+        with pytest.raises(ValueError):
+            Delisting("SH600000", "2025-01-06").settlement(None)
+    
+    def test_dates(self):
+        delisting = Delisting("SH600000", "2025-01-06 15:00")
+        
+        assert delisting.date == pd.Timestamp("2025-01-06")
+        assert not delisting.is_delisted("2025-01-06 14:55")
+        assert delisting.is_delisted("2025-01-07")
+        assert list(delisting.delisted_mask(DAYS)) == [False, False, False, True, True]
+    
+    @pytest.mark.parametrize("kwargs", [
+        {"settlement_price": 8.0, "recovery_rate": 0.5},
+        {"settlement_price": -1.0},
+        {"recovery_rate": 1.5},
+    ])
+    def test_invalid(self, kwargs):
+        with pytest.raises(ValueError):
+            Delisting("SH600000", "2025-01-06", **kwargs)
+    
+    def test_registry(self):
+        register_delisting(Delisting("SH600000", "2025-01-06"))
+        
+        assert get_delisting("SH600000").date == pd.Timestamp("2025-01-06")
+        assert get_delisting("SZ000001") is None
+        with pytest.raises(TypeError):
+            register_delisting("SH600000")
+
+
+class TestUniverseDelisting:
+    """标的池按退市日截止成分股测试类"""
+    
+    def test_members_until_delisting(self):
+        """成分股文件没有写结束日期，退市日之后不再是成分股"""
+        universe = Universe(
+            "pool", {"SH600000": [("2025-01-01", None)], "SZ000001": [("2025-01-01", None)]},
+            delistings=[Delisting("SH600000", "2025-01-06")]
+        )
+        
+        assert universe.members("2025-01-06") == ["SH600000", "SZ000001"]
+        assert universe.members("2025-01-07") == ["SZ000001"]
+        assert universe.members_between("2025-01-01", "2025-01-31") == ["SH600000", "SZ000001"]
+        assert universe.members_between("2025-01-07") == ["SZ000001"]
+        assert universe.periods("SH600000") == [(pd.Timestamp("2025-01-01"), pd.Timestamp("2025-01-06"))]
+        assert list(universe.membership_mask("SH600000", DAYS)) == [True, True, True, False, False]
+    
+    def test_registered_delistings(self):
+        universe = Universe("pool", {"SH600000": [("2025-01-01", None)]})
+        register_delisting(Delisting("SH600000", "2025-01-06"))
+        
+        assert universe.is_member("SH600000", "2025-01-06")
+        assert not universe.is_member("SH600000", "2025-01-07")
+        assert universe.delisting("SH600000") is get_delisting("SH600000")
+
+
+class TestFeaturesEndAtDelisting:
+    """get_features在退市日截止测试类"""
+    
+    def test_bars_end_on_delisting_date(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06"))
+        manager = DataManager(enable_cache=False, provider=FakeProvider(data, DAYS))
+        
+        result = manager.get_features(["SH600000", "SZ000001"], ["$close"], "2025-01-02", "2025-01-08")
+        
+        assert result["SH600000"].index[-1] == pd.Timestamp("2025-01-06")
+        assert len(result["SZ000001"]) == 5
+        assert result.error is None
+    
+    def test_alignment_does_not_fill_past_delisting(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06"))
+        manager = DataManager(enable_cache=False, provider=FakeProvider(data, DAYS))
+        
+        result = manager.get_features(
+            ["SH600000", "SZ000001"], ["$close"], "2025-01-02", "2025-01-08",
+            align=True, fill_policy=FillPolicy.FORWARD_FILL
+        )
+        
+        frame = result["SH600000"]
+        assert len(frame) == 5
+        assert frame.loc["2025-01-06", "$close"] == 12.5
+        assert frame["$close"].iloc[3:].isna().all()
+
+
+class TestEngineDelisting:
+    """回测中的退市强制平仓测试类"""
+    
+    def test_forced_liquidation_at_settlement(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06", settlement_price=8.0))
+        
+        result = run(_config(data), _buy_first_bar)
+        
+        assert [(t.time, t.side, t.price, t.kind) for t in result.trades] == [
+            (DAYS[1], OrderSide.BUY, 11.0, FillKind.TRADE),
+            (DAYS[2], OrderSide.SELL, 8.0, FillKind.DELIST),
+        ]
+        assert result.positions == {}
+        assert result.cash == pytest.approx(1000.0 - 110.0 + 80.0)
+        assert result.equity_curve.iloc[-1] == pytest.approx(970.0)
+        assert result.trades_frame()["kind"].tolist() == ["trade", "delist"]
+    
+    def test_recovery_rate(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06", recovery_rate=0.5))
+        
+        result = run(_config(data), _buy_first_bar)
+        
+        assert result.trades[-1].price == pytest.approx(12.5 * 0.5)
+    
+    def test_write_off(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06", recovery_rate=0.0))
+        
+        result = run(_config(data), _buy_first_bar)
+        
+        assert result.trades[-1].price == 0.0
+        assert result.final_equity == pytest.approx(890.0)
+    
+    def test_suspended_before_delisting(self, data):
+        """停牌至退市的标的在退市日按最后一个收盘价结算"""
+        data["SH600000"] = data["SH600000"].iloc[:2]
+        register_delisting(Delisting("SH600000", "2025-01-07"))
+        
+        result = run(_config(data), _buy_first_bar)
+        
+        settlement = result.trades[-1]
+        assert (settlement.time, settlement.price, settlement.kind) == (DAYS[3], 11.5, FillKind.DELIST)
+    
+    def test_no_data_or_orders_after_delisting(self, data):
+        register_delisting(Delisting("SH600000", "2025-01-06"))
+        seen = {}
+        
+        def strategy(ctx, portfolio, bars):
+            seen[ctx.time] = (sorted(bars), len(ctx.history("SH600000")))
+            if ctx.time == DAYS[3]:
+                return [Order("SH600000", OrderSide.BUY, 10)]
+            return None
+        
+        result = run(_config(data), strategy)
+        
+        assert seen[DAYS[4]] == (["SZ000001"], 3)
+        assert result.trades == []
+        assert "退市" in result.rejected_orders[0].reason
+    
+    def test_universe_includes_names_before_delisting(self, data):
+        universe = Universe(
+            "pool", {"SH600000": [("2025-01-01", None)], "SZ000001": [("2025-01-01", None)]},
+            delistings=[Delisting("SH600000", "2025-01-06", settlement_price=8.0)]
+        )
+        members = {}
+        
+        def strategy(ctx, portfolio, bars):
+            members[ctx.time] = ctx.members
+            return _buy_first_bar(ctx, portfolio, bars)
+        
+        result = run(_config(data, instruments=universe), strategy)
+        
+        assert members[DAYS[2]] == ["SH600000", "SZ000001"]
+        assert members[DAYS[3]] == ["SZ000001"]
+        assert result.trades[-1].kind is FillKind.DELIST
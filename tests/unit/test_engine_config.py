@@ -0,0 +1,167 @@
+"""
+回测配置文件单元测试 / Backtest Configuration File Unit Tests
+"""
+
+import io
+import json
+
+import pytest
+
+from src.application.backtest_engine import (
+    AShareCostModel,
+    CombinedCost,
+    EngineConfig,
+    ExecutionMode,
+    FixedBpsSlippage,
+    LimitAction,
+    RandomSlippage,
+    RiskLimits
+)
+from src.application.engine_config import engine_config_to_dict, load_engine_config
+from src.core.portfolio import CostBasis
+from src.core.price_adjustment import AdjustMode
+
+
+MINIMAL = """
+start_time: 2020-01-01
+end_time: 2024-12-31
+instruments: SH000300
+"""
+
+FULL = """
+start_time: 2020-01-01
+end_time: 2024-12-31
+instruments: [SH600000, SZ000001]
+fields: [$volume, "Mean($close, 5)"]
+initial_cash: 5e5
+execution_mode: next_vwap
+cost_model:
+  commission: {type: a_share, commission_rate: 0.0003, min_commission: 5}
+  slippage: {type: random, mean_bps: 5, std_bps: 2}
+allow_short: true
+participation_rate: 0.1
+risk_limits: {max_position_weight: 0.2, action: trim}
+cost_basis: fifo
+seed: 42
+calendar: SSE
+adjust: PRE
+"""
+
+
+def _load(text, **kwargs):
+    return load_engine_config(io.StringIO(text), **kwargs)
+
+
+class TestLoad:
+    """读取配置测试类"""
+    
+    def test_minimal_document_uses_defaults(self):
+        config = _load(MINIMAL)
+        
+        # 日期保持为字符串，不被YAML解析为date
+        assert (config.start_time, config.end_time) == ("2020-01-01", "2024-12-31")
+        assert config.instruments == "SH000300"
+        defaults = EngineConfig(start_time="2020-01-01", end_time="2024-12-31", instruments="SH000300")
+        assert config == defaults
+    
+    def test_fully_specified_document(self):
+        config = _load(FULL)
+        
+        assert config.instruments == ["SH600000", "SZ000001"]
+        assert config.fields == ["$volume", "Mean($close, 5)"]
+        assert config.initial_cash == 500_000.0
+        assert config.execution_mode is ExecutionMode.NEXT_VWAP
+        assert isinstance(config.cost_model, CombinedCost)
+        commission, slippage = config.cost_model._commission, config.cost_model._slippage
+        assert isinstance(commission, AShareCostModel)
+        assert (commission.commission_rate, commission.min_commission) == (0.0003, 5)
+        assert isinstance(slippage, RandomSlippage) and (slippage.mean_bps, slippage.std_bps) == (5, 2)
+        assert config.risk_limits == RiskLimits(max_position_weight=0.2, action=LimitAction.TRIM)
+        assert (config.allow_short, config.participation_rate, config.seed) == (True, 0.1, 42)
+        assert config.cost_basis is CostBasis.FIFO
+        assert config.adjust is AdjustMode.PRE
+        assert config.calendar == "SSE"
+    
+    def test_json_document(self, tmp_path):
+        path = tmp_path / "backtest.json"
+        path.write_text(json.dumps({
+            "start_time": "2020-01-01", "end_time": "2020-12-31", "instruments": ["SH600000"],
+            "cost_model": {"type": "fixed_bps_slippage", "bps": 3}
+        }))
+        
+        config = load_engine_config(path)
+        
+        assert isinstance(config.cost_model, FixedBpsSlippage) and config.cost_model.bps == 3
+    
+    def test_invalid_date_names_the_key(self):
+        with pytest.raises(ValueError) as exc_info:
+            _load(MINIMAL.replace("2024-12-31", "2024-02-30"))
+        
+        assert "end_time" in str(exc_info.value)
+        assert "'2024-02-30' is not a valid date" in str(exc_info.value)
+    
+    def test_unknown_keys(self):
+        text = MINIMAL + "initial_cahs: 1000\n"
+        
+        with pytest.raises(ValueError) as exc_info:
+            _load(text)
+        config = _load(text, strict=False)
+        
+        assert "did you mean initial_cash?" in str(exc_info.value)
+        assert config.initial_cash == EngineConfig("2020-01-01", "2024-12-31").initial_cash
+        with pytest.raises(ValueError):
+            _load(MINIMAL + "cost_model: {type: zero, bps: 1}\n")
+    
+    @pytest.mark.parametrize("extra, message", [
+        ("execution_mode: tomorrow\n", "execution_mode must be one of"),
+        ("initial_cash: lots\n", "initial_cash must be a number"),
+        ("cost_model: {type: magic}\n", "cost_model.type must be one of"),
+        ("cost_model: {commission: {type: zero}}\n", "slippage missing"),
+        ("participation_rate: 2\n", "participation_rate must be in (0, 1]"),
+        ("risk_limits: {max_position_weight: -1}\n", "risk_limits: max_position_weight"),
+        ("data: {}\n", "can't be set in a document"),
+    ])
+    def test_invalid_values(self, extra, message):
+        with pytest.raises(ValueError) as exc_info:
+            _load(MINIMAL + extra)
+        
+        assert message in str(exc_info.value)
+    
+    def test_missing_or_reversed_dates(self):
+        with pytest.raises(ValueError, match="end_time is required"):
+            _load("start_time: 2020-01-01\ninstruments: SH000300\n")
+        with pytest.raises(ValueError, match="is after end_time"):
+            _load(MINIMAL.replace("2020-01-01", "2025-01-01"))
+        with pytest.raises(ValueError, match="not a valid YAML or JSON document"):
+            _load("start_time: [2020-01-01\n")
+
+
+class TestWrite:
+    """写出配置测试类"""
+    
+    def test_round_trip(self, tmp_path):
+        config = _load(FULL)
+        
+        for name in ("backtest.yaml", "backtest.json"):
+            path = tmp_path / name
+            config.write(path)
+            assert engine_config_to_dict(load_engine_config(path)) == engine_config_to_dict(config)
+        assert json.loads((tmp_path / "backtest.json").read_text())["execution_mode"] == "next_vwap"
+    
+    def test_only_non_defaults_are_written(self):
+        stream = io.StringIO()
+        
+        _load(MINIMAL).write(stream)
+        
+        assert _load(stream.getvalue()) == _load(MINIMAL)
+        assert engine_config_to_dict(_load(MINIMAL)) == {
+            "start_time": "2020-01-01", "end_time": "2024-12-31", "instruments": "SH000300"
+        }
+    
+    def test_code_only_settings_are_refused(self):
+        config = EngineConfig(start_time="2020-01-01", end_time="2020-12-31", data={})
+        
+        with pytest.raises(ValueError, match="data can't be written"):
+            config.write(io.StringIO())
+        with pytest.raises(ValueError, match="format must be"):
+            _load(MINIMAL).write(io.StringIO(), format="toml")
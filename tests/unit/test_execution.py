@@ -0,0 +1,180 @@
+"""
+Unit tests for execution scheduling
+订单执行调度单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import EngineConfig, ExecutionMode, Order, OrderSide, Strategy, run
+from src.application.execution import ExecutionScheduler, ScheduleStatus
+from src.core.feature_frame import FeatureFrame
+
+
+INDEX = pd.bdate_range("2025-01-02", periods=20)
+
+
+def _data(volumes=None):
+    """价格每日上涨0.1，开盘价等于收盘价 / Prices rise 0.1 a day, opening at the close"""
+    closes = [10.0 + 0.1 * i for i in range(len(INDEX))]
+    return {
+        "SH600000": FeatureFrame({
+            "$open": closes,
+            "$close": closes,
+            "$volume": volumes or [10_000.0] * len(INDEX),
+        }, index=INDEX),
+        "SZ000001": FeatureFrame({"$open": 20.0, "$close": 20.0, "$volume": 10_000.0}, index=INDEX),
+    }
+
+
+class Scripted(Strategy):
+    """按交易日序号下固定的订单 / Places fixed orders on given bar numbers"""
+    
+    def __init__(self, orders):
+        self.orders = {INDEX[i]: list(items) for i, items in orders.items()}
+    
+    def on_bar(self, ctx, portfolio, bars):
+        return self.orders.get(ctx.time)
+
+
+def _run(scheduler, volumes=None, **kwargs):
+    config = EngineConfig(
+        start_time=str(INDEX[0].date()),
+        end_time=str(INDEX[-1].date()),
+        data=_data(volumes),
+        initial_cash=1_000_000.0,
+        **kwargs
+    )
+    return run(config, scheduler)
+
+
+def _fills(result, code="SH600000"):
+    return [(t.time, t.quantity) for t in result.trades if t.instrument == code]
+
+
+class TestSlicing:
+    """子订单拆分测试类"""
+    
+    def test_twap(self):
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 5000)]}), horizon=5, max_participation=None
+        )
+        
+        result = _run(scheduler)
+        
+        # 决策K线起每根K线一笔，在下一根K线开盘成交
+        assert _fills(result) == [(INDEX[i], 1000) for i in range(1, 6)]
+        report, = scheduler.reports(result)
+        assert (report.status, report.filled, report.slices) == (ScheduleStatus.COMPLETE, 5000, 5)
+        assert report.end_time == INDEX[5]
+        assert not scheduler.active
+    
+    def test_vwap_follows_relative_volume(self):
+        volumes = [10_000.0, 30_000.0] + [10_000.0] * (len(INDEX) - 2)
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 3000)]}),
+            style="vwap", horizon=3, max_participation=None, volume_lookback=2
+        )
+        
+        result = _run(scheduler, volumes)
+        
+        # 第二根K线的成交量是之前的3倍：2000 * 3 / (3 + 1) = 1500
+        assert [q for _, q in _fills(result)] == [1000, 1500, 500]
+    
+    def test_participation_cap_extends(self):
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 8000)]}), horizon=4, max_participation=0.1
+        )
+        
+        result = _run(scheduler)
+        
+        # 每根K线最多成交量的10%即1000股，horizon之后继续直到完成
+        assert _fills(result) == [(INDEX[i], 1000) for i in range(1, 9)]
+        assert scheduler.reports(result)[0].status is ScheduleStatus.COMPLETE
+    
+    def test_max_extension_and_cancel(self):
+        def scheduler(**kwargs):
+            return ExecutionScheduler(
+                Scripted({0: [Order("SH600000", OrderSide.BUY, 8000)]}), horizon=4, max_participation=0.1, **kwargs
+            )
+        
+        extended, cancelled = scheduler(max_extension=2), scheduler(horizon_policy="cancel")
+        extended_report, = extended.reports(_run(extended))
+        cancelled_report, = cancelled.reports(_run(cancelled))
+        
+        assert (extended_report.status, extended_report.filled) == (ScheduleStatus.CANCELLED, 6000)
+        assert extended_report.end_time == INDEX[6]
+        assert (cancelled_report.status, cancelled_report.filled) == (ScheduleStatus.CANCELLED, 4000)
+        assert cancelled_report.unfilled == 4000
+    
+    def test_new_order_supersedes_and_non_market_orders_pass_through(self):
+        scheduler = ExecutionScheduler(Scripted({
+            0: [Order("SH600000", OrderSide.BUY, 5000), Order("SZ000001", OrderSide.BUY, 300, limit_price=25.0)],
+            2: [Order("SH600000", OrderSide.BUY, 1000)],
+        }), horizon=5, max_participation=None)
+        
+        result = _run(scheduler)
+        
+        assert _fills(result, "SZ000001") == [(INDEX[1], 300)]
+        first, second = scheduler.reports(result)
+        # 第2根K线开盘的成交来自第1根K线的子订单，仍属于被取代的计划
+        assert (first.status, first.filled) == (ScheduleStatus.SUPERSEDED, 2000)
+        assert (second.status, second.filled) == (ScheduleStatus.COMPLETE, 1000)
+        assert [q for t, q in _fills(result) if t > INDEX[2]] == [200] * 5
+    
+    def test_invalid(self):
+        inner = Scripted({})
+        with pytest.raises(ValueError):
+            ExecutionScheduler(inner, horizon=0)
+        with pytest.raises(ValueError):
+            ExecutionScheduler(inner, max_participation=1.5)
+        with pytest.raises(ValueError):
+            ExecutionScheduler(inner, style="pov")
+        with pytest.raises(ValueError):
+            ExecutionScheduler(inner, horizon_policy="wait")
+
+
+class TestShortfall:
+    """执行缺口测试类"""
+    
+    def test_rising_prices_cost_a_buyer(self):
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 5000)]}), horizon=5, max_participation=None
+        )
+        
+        report, = scheduler.reports(_run(scheduler))
+        
+        # 决策价为第0根K线收盘价10.0，成交均价为第1至5根K线开盘价的均值10.3
+        assert report.decision_price == pytest.approx(10.0)
+        assert report.average_price == pytest.approx(10.3)
+        assert report.execution_cost == pytest.approx(0.3 * 5000)
+        assert report.opportunity_cost == 0.0
+        assert report.shortfall_bps == pytest.approx(300.0)
+        assert report.to_dict()["status"] == "complete"
+    
+    def test_cancelled_remainder_is_opportunity_cost(self):
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 8000)]}),
+            horizon=4, max_participation=0.1, horizon_policy="cancel"
+        )
+        
+        report, = scheduler.reports(_run(scheduler))
+        
+        # 成交第1至4根K线共4000股，均价10.25；第4根K线取消时收盘价为10.4
+        assert report.execution_cost == pytest.approx(0.25 * 4000)
+        assert report.end_price == pytest.approx(10.4)
+        assert report.opportunity_cost == pytest.approx(0.4 * 4000)
+        assert report.shortfall_bps == pytest.approx(2600 / 80_000 * 1e4)
+    
+    def test_same_close(self):
+        scheduler = ExecutionScheduler(
+            Scripted({0: [Order("SH600000", OrderSide.BUY, 5000)]}),
+            horizon=5, max_participation=None, execution_mode="same_close"
+        )
+        
+        result = _run(scheduler, execution_mode=ExecutionMode.SAME_CLOSE)
+        report, = scheduler.reports(result)
+        
+        assert _fills(result) == [(INDEX[i], 1000) for i in range(5)]
+        assert report.filled == 5000
+        assert report.average_price == pytest.approx(10.2)
@@ -0,0 +1,400 @@
+"""
+Unit tests for the field expression engine
+字段表达式引擎单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core import indicators
+from src.core.expression_engine import (
+    ExpressionError,
+    parse_expression,
+    is_raw_field,
+    register_function,
+    tokenize
+)
+
+
+@pytest.fixture
+def price_frame():
+    """Simple OHLC frame / 简单的OHLC数据"""
+    index = pd.date_range("2025-01-02", periods=5, freq="D")
+    return pd.DataFrame({
+        "$open": [10.0, 11.0, 12.0, 13.0, 14.0],
+        "$high": [11.0, 12.0, 13.0, 14.0, 15.0],
+        "$low": [9.0, 10.0, 11.0, 12.0, 13.0],
+        "$close": [10.5, 11.5, 12.5, 13.5, 14.5],
+    }, index=index)
+
+
+class TestTokenizer:
+    """词法分析测试"""
+    
+    def test_tokens(self):
+        """字段、数字、函数名和运算符被正确切分"""
+        tokens = tokenize("Mean($close, 20) >= 1.5e2")
+        kinds = [t.kind for t in tokens]
+        assert kinds == ["NAME", "OP", "FIELD", "OP", "NUMBER", "OP", "OP", "NUMBER", "END"]
+        assert tokens[2].value == "$close"
+        assert tokens[6].value == ">="
+    
+    def test_unexpected_character(self):
+        """非法字符报告其位置"""
+        with pytest.raises(ExpressionError) as exc_info:
+            tokenize("$close # 2")
+        assert exc_info.value.position == 7
+
+
+class TestExpressionEvaluation:
+    """表达式计算测试"""
+    
+    def test_arithmetic(self, price_frame):
+        """算术运算"""
+        result = parse_expression("($high+$low)/2").evaluate(price_frame)
+        assert list(result) == [10.0, 11.0, 12.0, 13.0, 14.0]
+    
+    def test_ref_return(self, price_frame):
+        """Ref计算收益率，前n行为NaN"""
+        result = parse_expression("$close/Ref($close,1)-1").evaluate(price_frame)
+        assert np.isnan(result.iloc[0])
+        assert result.iloc[1] == pytest.approx(11.5 / 10.5 - 1)
+    
+    def test_rolling_lead_in_is_nan(self, price_frame):
+        """滚动窗口前window-1行为NaN"""
+        result = parse_expression("Mean($close,3)").evaluate(price_frame)
+        assert result.isna().sum() == 2
+        assert result.iloc[2] == pytest.approx(11.5)
+    
+    def test_comparison_returns_zero_one(self, price_frame):
+        """比较运算返回0/1，NaN输入结果为NaN"""
+        result = parse_expression("$close > Ref($close,1)").evaluate(price_frame)
+        assert np.isnan(result.iloc[0])
+        assert list(result.iloc[1:]) == [1.0, 1.0, 1.0, 1.0]
+    
+    def test_division_by_zero_is_nan(self, price_frame):
+        """除以0结果为NaN"""
+        result = parse_expression("$close/($close-$close)").evaluate(price_frame)
+        assert result.isna().all()
+    
+    def test_fields_collected(self):
+        """收集引用的原始字段"""
+        expression = parse_expression("Std($close,5)/Mean($volume,5)+$close")
+        assert expression.fields == ["$close", "$volume"]
+
+
+class TestExpressionErrors:
+    """表达式错误测试"""
+    
+    def test_unbalanced_open_paren(self):
+        """缺少右括号时指向左括号"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("Mean($close,5")
+        assert exc_info.value.position == 4
+    
+    def test_unbalanced_close_paren(self):
+        """多余的右括号"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("$close)")
+        assert exc_info.value.position == 6
+    
+    def test_unknown_field_with_known_fields(self):
+        """提供可用字段时在解析阶段拒绝未知字段"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("$close/$opne", known_fields=["$close", "$open"])
+        assert exc_info.value.position == 7
+    
+    def test_unknown_function(self):
+        """未知函数"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("Foo($close,1)")
+        assert exc_info.value.position == 0
+    
+    def test_window_must_be_integer(self):
+        """窗口参数必须为正整数常量"""
+        with pytest.raises(ExpressionError):
+            parse_expression("Mean($close,2.5)")
+        with pytest.raises(ExpressionError):
+            parse_expression("Mean($close,0)")
+    
+    def test_is_raw_field(self):
+        """区分原始字段和表达式"""
+        assert is_raw_field("$close")
+        assert not is_raw_field("$close/$open")
+        assert not is_raw_field("Ref($close,1)")
+    
+    def test_future_reference_position(self):
+        """负偏移的Ref引用未来数据"""
+        assert parse_expression("Ref($close,1)/$close").future_reference_position is None
+        assert parse_expression("Ref($close, -2) / Ref($close, -1) - 1").future_reference_position == 0
+        assert parse_expression("$close - Mean(Ref($close,-1),5)").future_reference_position == 14
+
+
+class TestPrecedenceAndNesting:
+    """运算符优先级与嵌套调用测试"""
+    
+    def test_multiplication_binds_tighter(self, price_frame):
+        """乘除优先于加减"""
+        result = parse_expression("$open + $close * 2").evaluate(price_frame)
+        assert result.iloc[0] == pytest.approx(10.0 + 10.5 * 2)
+    
+    def test_parentheses_override(self, price_frame):
+        """括号改变优先级"""
+        result = parse_expression("($open + $close) * 2").evaluate(price_frame)
+        assert result.iloc[0] == pytest.approx((10.0 + 10.5) * 2)
+    
+    def test_left_associative_subtraction(self, price_frame):
+        """减法左结合"""
+        result = parse_expression("$high - $low - 1").evaluate(price_frame)
+        assert list(result) == [1.0] * 5
+    
+    def test_unary_minus(self, price_frame):
+        """一元负号"""
+        result = parse_expression("-$close + 1").evaluate(price_frame)
+        assert result.iloc[0] == pytest.approx(-9.5)
+    
+    def test_comparison_lowest_precedence(self, price_frame):
+        """比较运算优先级最低"""
+        result = parse_expression("$high - $low > 1.5").evaluate(price_frame)
+        assert list(result) == [1.0] * 5
+    
+    def test_nested_calls(self, price_frame):
+        """嵌套函数调用"""
+        result = parse_expression("Mean(Ref($close,1),2)").evaluate(price_frame)
+        assert result.isna().sum() == 2
+        assert result.iloc[2] == pytest.approx((10.5 + 11.5) / 2)
+    
+    def test_sum(self, price_frame):
+        """Sum滚动求和"""
+        result = parse_expression("Sum($high-$low,3)").evaluate(price_frame)
+        assert result.isna().sum() == 2
+        assert result.iloc[4] == pytest.approx(6.0)
+    
+    def test_ref_shifts_within_instrument(self):
+        """多标的数据中Ref不跨标的偏移"""
+        index = pd.MultiIndex.from_product(
+            [["SH600000", "SZ000001"], pd.date_range("2025-01-02", periods=3, freq="D")],
+            names=["instrument", "datetime"]
+        )
+        frame = pd.DataFrame({"$close": [1.0, 2.0, 3.0, 10.0, 20.0, 30.0]}, index=index)
+        
+        result = parse_expression("Ref($close,1)").evaluate(frame)
+        
+        assert result.index.equals(frame.index)
+        assert np.isnan(result.loc[("SZ000001", pd.Timestamp("2025-01-02"))])
+        assert result.loc[("SZ000001", pd.Timestamp("2025-01-03"))] == 10.0
+
+
+class TestFunctionRegistry:
+    """函数注册测试"""
+    
+    def test_register_function(self, price_frame):
+        """注册自定义函数后可在表达式中使用"""
+        register_function("Delta", 2, lambda s, n: s - s.shift(n), int_args=(1,), min_int=1)
+        result = parse_expression("Delta($close,2)").evaluate(price_frame)
+        assert result.iloc[2] == pytest.approx(2.0)
+    
+    def test_function_failure_points_at_call(self, price_frame):
+        """函数计算失败时错误指向函数名位置"""
+        def broken(series):
+            raise RuntimeError("boom")
+        register_function("Broken", 1, broken)
+        
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("1 + Broken($close)").evaluate(price_frame)
+        assert exc_info.value.position == 4
+    
+    def test_missing_field_points_at_field(self, price_frame):
+        """数据中缺少字段时错误指向字段位置"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("$close / $vwap").evaluate(price_frame)
+        assert exc_info.value.position == 9
+    
+    def test_arity_error(self):
+        """参数个数错误"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("$close + Sum($close)")
+        assert exc_info.value.position == 9
+
+
+@pytest.fixture
+def panel_frame():
+    """三个标的的多级索引数据，SZ000002缺少第三天 / Three instruments, SZ000002 missing the third day"""
+    dates = pd.date_range("2025-01-02", periods=3, freq="D")
+    index = pd.MultiIndex.from_product(
+        [["SH600000", "SZ000001", "SZ000002"], dates], names=["instrument", "datetime"]
+    )
+    closes = [1.0, 2.0, 3.0, 10.0, 11.0, 12.0, 5.0, 6.0, np.nan]
+    return pd.DataFrame({"$close": closes}, index=index)
+
+
+class TestCrossSectionalFunctions:
+    """截面函数测试"""
+    
+    def test_rank_across_instruments(self, panel_frame):
+        """CSRank在同一时刻的标的之间排名"""
+        result = parse_expression("CSRank($close)").evaluate(panel_frame)
+        
+        assert result.index.equals(panel_frame.index)
+        day = pd.Timestamp("2025-01-02")
+        assert result.loc[("SH600000", day)] == pytest.approx(1 / 3)
+        assert result.loc[("SZ000001", day)] == pytest.approx(1.0)
+    
+    def test_missing_instrument_excluded(self, panel_frame):
+        """某时刻缺失的标的不参与统计"""
+        result = parse_expression("CSDemean($close)").evaluate(panel_frame)
+        
+        day = pd.Timestamp("2025-01-04")
+        assert result.loc[("SH600000", day)] == pytest.approx(3.0 - 7.5)
+        assert np.isnan(result.loc[("SZ000002", day)])
+    
+    def test_composes_with_time_series(self, panel_frame):
+        """截面函数的参数可以是时间序列表达式，Ref不跨标的偏移"""
+        result = parse_expression("CSRank($close/Ref($close,1)-1)").evaluate(panel_frame)
+        
+        first = pd.Timestamp("2025-01-02")
+        assert result.xs(first, level="datetime").isna().all()
+        second = pd.Timestamp("2025-01-03")
+        # 收益率：SH600000为100%，SZ000001为10%，SZ000002为20%
+        assert result.loc[("SH600000", second)] == pytest.approx(1.0)
+        assert result.loc[("SZ000001", second)] == pytest.approx(1 / 3)
+    
+    def test_time_series_over_cross_section(self, panel_frame):
+        """时间序列函数作用于截面结果时按标的计算"""
+        result = parse_expression("Ref(CSRank($close),1) + 1").evaluate(panel_frame)
+        
+        assert np.isnan(result.loc[("SZ000001", pd.Timestamp("2025-01-02"))])
+        assert result.loc[("SZ000001", pd.Timestamp("2025-01-03"))] == pytest.approx(2.0)
+    
+    def test_winsorize(self, panel_frame):
+        """CSWinsorize截断到截面分位数"""
+        result = parse_expression("CSWinsorize($close, 0, 0.5)").evaluate(panel_frame)
+        
+        day = pd.Timestamp("2025-01-02")
+        assert result.loc[("SZ000001", day)] == pytest.approx(5.0)
+        assert result.loc[("SH600000", day)] == pytest.approx(1.0)
+    
+    def test_mask_limits_statistics(self, panel_frame):
+        """mask为False的行不参与截面统计"""
+        mask = pd.Series(True, index=panel_frame.index)
+        mask[("SZ000001", pd.Timestamp("2025-01-02"))] = False
+        
+        result = parse_expression("CSRank($close)").evaluate(panel_frame, mask=mask)
+        
+        day = pd.Timestamp("2025-01-02")
+        assert result.loc[("SZ000002", day)] == pytest.approx(1.0)
+        assert np.isnan(result.loc[("SZ000001", day)])
+    
+    def test_winsorize_bounds_must_be_constants(self):
+        """CSWinsorize的分位数必须为数值常量"""
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("CSWinsorize($close, $open, 0.9)")
+        assert exc_info.value.position == 20
+    
+    def test_single_instrument_rejected(self, price_frame):
+        """在单个标的上使用截面函数时报错并指向函数位置"""
+        expression = parse_expression("1 + CSZScore($close)")
+        
+        assert expression.cross_sectional
+        assert expression.cross_section_position == 4
+        with pytest.raises(ExpressionError) as exc_info:
+            expression.evaluate(price_frame)
+        assert exc_info.value.position == 4
+    
+    def test_lookback_ignores_constant_arguments(self):
+        """数值常量参数不计入历史行数"""
+        assert parse_expression("CSWinsorize(Ref($close,5), 0.05, 0.95)").lookback == 5
+
+
+@pytest.fixture
+def bars():
+    """60根带有波动的日线 / 60 daily bars with some noise"""
+    rng = np.random.default_rng(7)
+    close = 20.0 + np.cumsum(rng.normal(0, 0.3, 60))
+    index = pd.bdate_range("2025-01-02", periods=60)
+    return pd.DataFrame({
+        "$high": close + rng.uniform(0.1, 0.5, 60),
+        "$low": close - rng.uniform(0.1, 0.5, 60),
+        "$close": close,
+    }, index=index)
+
+
+class TestIndicatorFunctions:
+    """技术指标表达式函数测试类"""
+    
+    @staticmethod
+    def _values(bars, field="$close"):
+        return bars[field].to_numpy()
+    
+    def test_ema_difference_is_macd(self, bars):
+        dif = parse_expression("EMA($close,12)-EMA($close,26)").evaluate(bars)
+        macd = parse_expression("MACD($close,12,26)").evaluate(bars)
+        
+        expected = indicators.macd(self._values(bars), 12, 26, 9)
+        assert dif.isna().sum() == 25
+        np.testing.assert_allclose(dif.to_numpy(), expected.macd, equal_nan=True)
+        np.testing.assert_allclose(macd.to_numpy(), expected.macd, equal_nan=True)
+    
+    def test_ema_seeded_from_sma(self, bars):
+        result = parse_expression("EMA($close,5)").evaluate(bars)
+        
+        assert result.iloc[4] == pytest.approx(bars["$close"].iloc[:5].mean())
+        assert result.index.equals(bars.index)
+    
+    def test_macd_signal_and_histogram(self, bars):
+        signal = parse_expression("MACDSignal($close,12,26,9)").evaluate(bars)
+        hist = parse_expression("MACDHist($close,12,26,9)").evaluate(bars)
+        
+        expected = indicators.macd(self._values(bars), 12, 26, 9)
+        np.testing.assert_allclose(signal.to_numpy(), expected.signal, equal_nan=True)
+        np.testing.assert_allclose(hist.to_numpy(), expected.histogram, equal_nan=True)
+    
+    @pytest.mark.parametrize("text, func", [
+        ("RSI($close,14)", lambda v: indicators.rsi(v, 14)),
+        ("WMA($close,10)", lambda v: indicators.wma(v, 10)),
+        ("BollUpper($close,20,2)", lambda v: indicators.bollinger(v, 20, 2.0).upper),
+        ("BollLower($close,20,1.5)", lambda v: indicators.bollinger(v, 20, 1.5).lower),
+    ])
+    def test_single_series_indicators(self, bars, text, func):
+        result = parse_expression(text).evaluate(bars)
+        
+        np.testing.assert_allclose(result.to_numpy(), func(self._values(bars)), equal_nan=True)
+    
+    def test_high_low_close_indicators(self, bars):
+        high, low, close = (self._values(bars, f) for f in ("$high", "$low", "$close"))
+        
+        atr = parse_expression("ATR($high,$low,$close,14)").evaluate(bars)
+        j = parse_expression("KDJJ($high,$low,$close,9,3,3)").evaluate(bars)
+        
+        np.testing.assert_allclose(atr.to_numpy(), indicators.atr(high, low, close, 14), equal_nan=True)
+        np.testing.assert_allclose(j.to_numpy(), indicators.kdj(high, low, close, 9, 3, 3).j, equal_nan=True)
+    
+    def test_nested_indicators(self, bars):
+        result = parse_expression("EMA(RSI($close,5),3) - 50").evaluate(bars)
+        
+        expected = np.asarray(indicators.ema(indicators.rsi(self._values(bars), 5), 3)) - 50
+        np.testing.assert_allclose(result.to_numpy(), expected, equal_nan=True)
+    
+    def test_per_instrument(self, bars):
+        """多标的数据中指标在每个标的内部递推"""
+        panel = pd.concat({"SH600000": bars, "SZ000001": bars * 2}, names=["instrument", "datetime"])
+        
+        result = parse_expression("EMA($close,5)").evaluate(panel)
+        
+        expected = indicators.ema(self._values(bars) * 2, 5)
+        np.testing.assert_allclose(result.loc["SZ000001"].to_numpy(), expected, equal_nan=True)
+    
+    def test_lookback_covers_warm_up(self):
+        assert parse_expression("WMA($close,10)").lookback == 9
+        assert parse_expression("EMA($close,12)").lookback == 130
+        assert parse_expression("RSI(Ref($close,1),14)").lookback == 281
+    
+    def test_argument_errors(self, bars):
+        with pytest.raises(ExpressionError):
+            parse_expression("MACD($close,12)")
+        with pytest.raises(ExpressionError):
+            parse_expression("BollUpper($close,20,$open)")
+        with pytest.raises(ExpressionError) as exc_info:
+            parse_expression("MACD($close,26,12)").evaluate(bars)
+        assert "fast must be smaller than slow" in str(exc_info.value.error_info.error_message_en)
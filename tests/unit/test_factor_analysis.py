@@ -0,0 +1,278 @@
+"""
+Unit tests for factor evaluation
+因子评估单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.factor_analysis import (
+    compare,
+    evaluate,
+    forward_returns,
+    quantile_buckets,
+    quantile_labels,
+    top_minus_bottom
+)
+
+
+@pytest.fixture
+def index():
+    return pd.date_range("2025-01-02", periods=3, freq="D", name="datetime")
+
+
+@pytest.fixture
+def returns(index):
+    return pd.DataFrame({
+        "A": [0.01, 0.04, 0.02],
+        "B": [0.02, 0.03, -0.01],
+        "C": [0.03, 0.02, 0.05],
+        "D": [0.04, 0.01, 0.00],
+    }, index=index)
+
+
+class TestForwardReturns:
+    """forward_returns测试类"""
+    
+    def test_shifts_by_horizon(self):
+        prices = pd.DataFrame({"A": [10.0, 11.0, 12.1, 13.31]})
+        
+        one = forward_returns(prices, 1)["A"]
+        two = forward_returns(prices, 2)["A"]
+        
+        assert one.iloc[:3].tolist() == pytest.approx([0.1, 0.1, 0.1])
+        assert np.isnan(one.iloc[3])
+        assert two.iloc[:2].tolist() == pytest.approx([0.21, 0.21])
+        assert two.iloc[2:].isna().all()
+    
+    def test_missing_price_gives_missing_return(self):
+        prices = pd.DataFrame({"A": [10.0, np.nan, 12.0]})
+        
+        result = forward_returns(prices, 1)["A"]
+        
+        assert result.isna().all()
+    
+    @pytest.mark.parametrize("horizon", [0, -1, 1.5, True])
+    def test_invalid_horizon(self, horizon):
+        with pytest.raises(ValueError):
+            forward_returns(pd.DataFrame({"A": [1.0, 2.0]}), horizon)
+
+
+class TestEvaluate:
+    """evaluate测试类"""
+    
+    def test_perfect_factor(self, returns):
+        report = evaluate(returns, returns, quantiles=2)
+        
+        assert report.ic.tolist() == pytest.approx([1.0] * 3)
+        assert report.rank_ic.tolist() == pytest.approx([1.0] * 3)
+        assert report.ic_mean == pytest.approx(1.0)
+        assert (report.long_short > 0).all()
+    
+    def test_rank_ic_ignores_scale(self, returns):
+        """单调变换不改变Rank IC，但会改变IC"""
+        report = evaluate(returns ** 3, returns, quantiles=2)
+        
+        assert report.rank_ic.tolist() == pytest.approx([1.0] * 3)
+        assert report.ic.iloc[0] < 1.0
+    
+    def test_ic_uses_pairs_valid_in_both(self, returns):
+        """因子缺失的标的不参与当行的IC"""
+        factor = pd.DataFrame({
+            "A": [1.0, 1.0, 3.0],
+            "B": [2.0, np.nan, 1.0],
+            "C": [3.0, 2.0, 2.0],
+            "D": [4.0, 4.0, np.inf],
+        }, index=returns.index)
+        
+        report = evaluate(factor, returns, quantiles=2)
+        
+        expected = np.corrcoef([1.0, 2.0, 4.0], [0.04, 0.02, 0.01])[0, 1]
+        assert report.ic.iloc[1] == pytest.approx(expected)
+        # 正负无穷视为缺失
+        expected = np.corrcoef([3.0, 1.0, 2.0], [0.02, -0.01, 0.05])[0, 1]
+        assert report.ic.iloc[2] == pytest.approx(expected)
+    
+    def test_quantile_returns(self, returns):
+        report = evaluate(returns, returns, quantiles=2)
+        
+        first = report.quantile_returns.iloc[0]
+        assert list(report.quantile_returns.columns) == [1, 2]
+        assert first[1] == pytest.approx(0.015)
+        assert first[2] == pytest.approx(0.035)
+        assert report.long_short.iloc[0] == pytest.approx(0.02)
+        assert report.mean_quantile_returns[2] > report.mean_quantile_returns[1]
+    
+    def test_rows_with_too_few_instruments(self, returns):
+        """有效标的少于分位数个数的行不分组，少于两个的行IC为NaN"""
+        factor = returns.copy()
+        factor.iloc[1, 1:] = np.nan
+        
+        report = evaluate(factor, returns, quantiles=2)
+        
+        assert np.isnan(report.ic.iloc[1])
+        assert report.quantile_returns.iloc[1].isna().all()
+        assert report.to_dict()["periods"] == 2
+    
+    def test_turnover(self, index):
+        factor = pd.DataFrame({
+            "A": [1.0, 4.0, 4.0],
+            "B": [2.0, 3.0, 3.0],
+            "C": [3.0, 2.0, 2.0],
+            "D": [4.0, 1.0, 1.0],
+        }, index=index)
+        returns = pd.DataFrame(0.01, index=index, columns=factor.columns)
+        
+        report = evaluate(factor, returns, quantiles=2)
+        
+        top = report.turnover[2]
+        assert np.isnan(top.iloc[0])
+        assert top.iloc[1:].tolist() == [1.0, 0.0]
+        assert report.mean_turnover == pytest.approx(0.5)
+    
+    def test_aligns_on_common_instruments(self, returns):
+        factor = returns[["A", "B", "C"]].assign(E=1.0)
+        
+        report = evaluate(factor, returns, quantiles=3)
+        
+        assert report.ic.tolist() == pytest.approx([1.0] * 3)
+    
+    @pytest.mark.parametrize("quantiles", [1, 0, 2.5])
+    def test_invalid_quantiles(self, returns, quantiles):
+        with pytest.raises(ValueError):
+            evaluate(returns, returns, quantiles=quantiles)
+
+
+class TestReportExport:
+    """评估结果导出测试类"""
+    
+    def test_to_frame_and_csv(self, returns, tmp_path):
+        report = evaluate(returns, returns, quantiles=2)
+        path = tmp_path / "factor.csv"
+        
+        report.to_csv(str(path))
+        
+        frame = pd.read_csv(path, index_col=0, parse_dates=True)
+        assert list(frame.columns) == [
+            "ic", "rank_ic", "q1", "q2", "long_short", "turnover_q1", "turnover_q2"
+        ]
+        assert len(frame) == 3
+    
+    def test_compare(self, returns):
+        reports = {
+            "perfect": evaluate(returns, returns, quantiles=2),
+            "inverse": evaluate(-returns, returns, quantiles=2),
+        }
+        
+        table = compare(reports)
+        
+        assert list(table.index) == ["perfect", "inverse"]
+        assert table.loc["perfect", "ic_mean"] == pytest.approx(1.0)
+        assert table.loc["inverse", "ic_mean"] == pytest.approx(-1.0)
+        assert table.loc["inverse", "long_short"] < 0
+        assert "q2_return" in table.columns
+    
+    def test_str(self, returns):
+        text = str(evaluate(returns, returns, quantiles=2))
+        
+        assert "ICIR" in text
+        assert "Q2" in text
+
+
+@pytest.fixture
+def frames(index):
+    closes = {
+        "A": [1.0, 1.0, 1.0],
+        "B": [2.0, 1.0, 2.0],
+        "C": [3.0, 2.0, np.nan],
+        "D": [4.0, 3.0, np.nan],
+    }
+    return {code: pd.DataFrame({"$close": values}, index=index) for code, values in closes.items()}
+
+
+class TestQuantileBuckets:
+    """分位数分桶测试类"""
+    
+    def test_even_split(self, frames, index):
+        result = quantile_buckets(frames, "$close", buckets=2)
+        
+        assert result[index[0]] == [["A", "B"], ["C", "D"]]
+    
+    def test_ties_share_a_bucket(self, frames, index):
+        result = quantile_buckets(frames, "$close", buckets=4)
+        
+        # A和B的因子值相同，平均排名1.5
+        assert result[index[1]] == [[], ["A", "B"], ["C"], ["D"]]
+    
+    def test_fewer_instruments_than_buckets(self, frames, index):
+        result = quantile_buckets(frames, "$close", buckets=5)
+        
+        groups = result[index[2]]
+        assert len(groups) == 5
+        assert [g for g in groups if g] == [["A"], ["B"]]
+        assert groups.index(["A"]) < groups.index(["B"])
+    
+    def test_expression(self, frames, index):
+        """表达式可以使用截面函数，取负号后顺序反转"""
+        ranked = quantile_buckets(frames, "CSRank($close)", buckets=2)
+        inverse = quantile_buckets(frames, "-$close", buckets=2)
+        
+        assert ranked == quantile_buckets(frames, "$close", buckets=2)
+        assert inverse[index[0]] == [["D", "C"], ["B", "A"]]
+    
+    def test_missing_dates_left_out(self, index):
+        frames = {"A": pd.DataFrame({"$close": [np.nan, 1.0, 2.0]}, index=index)}
+        
+        assert list(quantile_buckets(frames, "$close", buckets=2)) == list(index[1:])
+        assert quantile_buckets({}, "$close") == {}
+    
+    def test_labels(self):
+        factor = pd.DataFrame({"A": [1.0, 5.0], "B": [2.0, np.nan], "C": [3.0, 4.0]})
+        
+        labels = quantile_labels(factor, 3)
+        
+        assert labels.iloc[0].tolist() == [1.0, 2.0, 3.0]
+        assert labels.loc[1, "A"] == 3.0 and labels.loc[1, "C"] == 1.0
+        assert np.isnan(labels.loc[1, "B"])
+    
+    @pytest.mark.parametrize("buckets", [1, 0, 2.5, True])
+    def test_invalid_buckets(self, frames, buckets):
+        with pytest.raises(ValueError):
+            quantile_buckets(frames, "$close", buckets=buckets)
+    
+    def test_top_minus_bottom(self, frames, returns, index):
+        buckets = quantile_buckets(frames, "$close", buckets=2)
+        
+        spread = top_minus_bottom(buckets, returns)
+        
+        assert spread.index.tolist() == list(index)
+        # 第一天: (C, D) - (A, B)
+        assert spread.iloc[0] == pytest.approx((0.03 + 0.04) / 2 - (0.01 + 0.02) / 2)
+        # 第三天只有A、B两个标的，各占一个桶
+        assert spread.iloc[2] == pytest.approx(-0.01 - 0.02)
+    
+    def test_top_minus_bottom_matches_evaluate_with_ties(self, returns, index):
+        """相同的因子值在evaluate和quantile_buckets中落在同一组，两者的多空收益一致"""
+        factor = pd.DataFrame({
+            "A": [1.0, 2.0, 1.0],
+            "B": [1.0, 2.0, 3.0],
+            "C": [2.0, 2.0, 3.0],
+            "D": [3.0, 1.0, 4.0],
+        }, index=index)
+        frames = {code: pd.DataFrame({"$close": factor[code]}) for code in factor.columns}
+        
+        spread = top_minus_bottom(quantile_buckets(frames, "$close", buckets=4), returns)
+        report = evaluate(factor, returns, quantiles=4)
+        
+        assert spread.notna().all()
+        assert report.long_short.tolist() == pytest.approx(spread.tolist())
+        # 第二天A、B、C并列，最高组为空，多空收益取(A, B, C)减D
+        assert report.long_short.iloc[1] == pytest.approx((0.04 + 0.03 + 0.02) / 3 - 0.01)
+    
+    def test_top_minus_bottom_single_bucket(self, returns, index):
+        buckets = {index[0]: [["A"], []], pd.Timestamp("2030-01-01"): [["A"], ["B"]]}
+        
+        spread = top_minus_bottom(buckets, returns)
+        
+        assert spread.isna().all()
@@ -0,0 +1,404 @@
+"""
+Unit tests for FeatureFrame typed accessors
+FeatureFrame类型化访问方法单元测试
+"""
+
+import numpy as np
+import pytest
+import pandas as pd
+
+from src.core.feature_frame import Bar, FeatureFrame, FeatureResult
+from src.core.trading_calendar import get_calendar
+from src.infrastructure.data_provider import Freq
+from src.utils.error_handler import DataError
+
+
+@pytest.fixture
+def frame():
+    """Three trading days with a weekend gap / 包含周末间隔的三个交易日"""
+    index = pd.DatetimeIndex(
+        ["2025-01-02", "2025-01-03", "2025-01-06"], name="datetime"
+    )
+    return FeatureFrame(
+        {"$close": [10.2, 10.6, 10.4], "$volume": [1000.0, 1200.0, 900.0]},
+        index=index
+    )
+
+
+class TestFeatureFrameRange:
+    """range()测试类"""
+    
+    def test_range_returns_bars(self, frame):
+        """返回区间内的Bar列表"""
+        bars = frame.range("2025-01-03", "2025-01-06")
+        
+        assert [bar.time for bar in bars] == [
+            pd.Timestamp("2025-01-03"), pd.Timestamp("2025-01-06")
+        ]
+        assert bars[0].fields == {"$close": 10.6, "$volume": 1200.0}
+        assert bars[1]["$close"] == 10.4
+    
+    def test_range_clamps_to_available_data(self, frame):
+        """超出数据范围的区间被截取"""
+        bars = frame.range("2024-12-01", "2025-12-31")
+        assert len(bars) == 3
+    
+    def test_range_without_bars_is_empty(self, frame):
+        """区间内没有K线时返回空列表而不是报错"""
+        assert frame.range("2025-01-04", "2025-01-05") == []
+        assert frame.range("2026-01-01", "2026-02-01") == []
+    
+    def test_inverted_range_is_error(self, frame):
+        """开始时间晚于结束时间时报错"""
+        with pytest.raises(DataError):
+            frame.range("2025-01-06", "2025-01-02")
+
+
+class TestFeatureFrameColumn:
+    """column()测试类"""
+    
+    def test_column(self, frame):
+        """返回数值和对应时间"""
+        values, times = frame.column("$close")
+        
+        assert values == [10.2, 10.6, 10.4]
+        assert times[0] == pd.Timestamp("2025-01-02")
+        assert len(values) == len(times)
+    
+    def test_missing_column_is_error(self, frame):
+        """字段不存在时报错而不是KeyError"""
+        with pytest.raises(DataError):
+            frame.column("$vwap")
+        with pytest.raises(DataError):
+            frame.column_array("$vwap")
+    
+    def test_column_array_is_a_read_only_view(self, frame):
+        """float64列不复制，写入时报错"""
+        values, index = frame.column_array("$close")
+        
+        assert values.tolist() == [10.2, 10.6, 10.4]
+        assert index is frame.index
+        assert np.shares_memory(values, frame["$close"].to_numpy())
+        with pytest.raises(ValueError):
+            values[0] = 0.0
+        assert frame["$close"].iloc[0] == 10.2
+    
+    def test_column_array_converts_other_dtypes(self):
+        frame = FeatureFrame(
+            {"$volume": np.array([1000, 1200], dtype=np.int64)}, index=pd.bdate_range("2025-01-02", periods=2)
+        )
+        
+        values, _ = frame.column_array("$volume")
+        
+        assert values.dtype == np.float64
+        assert values.tolist() == [1000.0, 1200.0]
+        assert frame.column("$volume")[0] == [1000.0, 1200.0]
+        assert all(type(v) is float for v in frame.column("$volume")[0])
+    
+    def test_returns(self, frame):
+        """收益率比价格少一期，时间为每期结束时"""
+        simple, times = frame.returns("$close")
+        log, _ = frame.returns("$close", kind="log")
+        
+        assert simple == pytest.approx([10.6 / 10.2 - 1, 10.4 / 10.6 - 1])
+        assert log == pytest.approx([np.log(10.6 / 10.2), np.log(10.4 / 10.6)])
+        assert times == list(frame.index[1:])
+        with pytest.raises(DataError):
+            frame.returns("$vwap")
+
+
+class TestBackwardCompatibility:
+    """原有索引方式兼容性测试"""
+    
+    def test_tuple_date_indexing(self, frame):
+        """frame["start", "end"]按日期区间切片"""
+        window = frame["2025-01-01", "2025-01-03"]
+        
+        assert isinstance(window, FeatureFrame)
+        assert list(window["$close"]) == [10.2, 10.6]
+    
+    def test_column_and_slice_indexing(self, frame):
+        """列索引和切片保持DataFrame行为"""
+        assert list(frame["$close"]) == [10.2, 10.6, 10.4]
+        assert len(frame["2025-01-03":"2025-01-06"]) == 2
+        assert isinstance(frame, pd.DataFrame)
+    
+    def test_result_wraps_frames(self, frame):
+        """FeatureResult中的数据为FeatureFrame"""
+        result = FeatureResult({"SH600000": pd.DataFrame(frame)})
+        
+        found, ok = result.instrument("SH600000")
+        assert ok
+        assert isinstance(found, FeatureFrame)
+        assert found.range("2025-01-02", "2025-01-02") == [
+            Bar(pd.Timestamp("2025-01-02"), {"$close": 10.2, "$volume": 1000.0})
+        ]
+
+
+class TestFeatureFrameSlicing:
+    """slice()/bar_at()/last()测试类"""
+    
+    def test_slice_clamps_non_trading_days(self, frame):
+        """落在周末的边界截取到区间内最近的行"""
+        window = frame.slice("2025-01-04", "2025-01-05")
+        assert len(window) == 0
+        
+        window = frame.slice("2025-01-03", "2025-01-05")
+        assert list(window.index) == [pd.Timestamp("2025-01-03")]
+    
+    def test_inverted_slice_is_empty(self, frame):
+        """开始时间晚于结束时间时返回空视图"""
+        window = frame.slice("2025-01-06", "2025-01-02")
+        
+        assert isinstance(window, FeatureFrame)
+        assert window.empty
+        assert list(window.columns) == ["$close", "$volume"]
+    
+    def test_slice_shares_memory(self, frame):
+        """切片与原数据共享内存"""
+        window = frame.slice("2025-01-03", "2025-01-06")
+        assert np.shares_memory(window["$close"].to_numpy(), frame["$close"].to_numpy())
+    
+    def test_bar_at(self, frame):
+        """按日期获取单根K线"""
+        bar, ok = frame.bar_at("2025-01-03")
+        assert ok
+        assert bar.time == pd.Timestamp("2025-01-03")
+        assert bar["$close"] == 10.6
+        
+        assert frame.bar_at("2025-01-04") == (None, False)
+    
+    def test_last(self, frame):
+        """last(n)返回最后n行"""
+        assert list(frame.last(2)["$close"]) == [10.6, 10.4]
+        assert len(frame.last(10)) == 3
+        assert frame.last(0).empty
+        with pytest.raises(ValueError):
+            frame.last(-1)
+
+
+@pytest.fixture
+def minute_frame():
+    """两个交易日的1分钟K线，以K线结束时刻标记"""
+    index = pd.DatetimeIndex([
+        "2025-01-02 09:31", "2025-01-02 09:32", "2025-01-02 11:30",
+        "2025-01-02 13:01", "2025-01-02 15:00",
+        "2025-01-03 09:31", "2025-01-03 09:32",
+    ], name="datetime")
+    return FeatureFrame({
+        "$open": [10.0, 10.1, 10.4, 10.3, 10.6, 11.0, 11.2],
+        "$high": [10.2, 10.5, 10.4, 10.9, 10.7, 11.3, 11.4],
+        "$low": [9.9, 10.0, 10.2, 10.1, 10.5, 10.9, 11.1],
+        "$close": [10.1, 10.4, 10.3, 10.6, 10.55, 11.2, 11.3],
+        "$volume": [100.0, 200.0, 50.0, np.nan, 150.0, 300.0, 100.0],
+    }, index=index)
+
+
+class TestResampleBars:
+    """resample_bars测试类"""
+    
+    def test_daily_ohlcv(self, minute_frame):
+        """按日聚合：开盘取第一个、最高取最大、最低取最小、收盘取最后一个、成交量求和"""
+        daily = minute_frame.resample_bars("day")
+        
+        assert isinstance(daily, FeatureFrame)
+        assert list(daily.index) == [pd.Timestamp("2025-01-02"), pd.Timestamp("2025-01-03")]
+        first = daily.iloc[0]
+        assert first["$open"] == 10.0
+        assert first["$high"] == 10.9
+        assert first["$low"] == 9.9
+        assert first["$close"] == 10.55
+        assert first["$volume"] == 500.0
+        assert daily.iloc[1]["$volume"] == 400.0
+    
+    def test_session_anchored_hourly_bars(self, minute_frame):
+        """提供交易日历时60分钟K线以开盘时刻为起点，午休不产生K线"""
+        hourly = minute_frame.resample_bars("60min", calendar=get_calendar("SSE"))
+        
+        assert list(hourly.index[:3]) == [
+            pd.Timestamp("2025-01-02 10:30"),
+            pd.Timestamp("2025-01-02 11:30"),
+            pd.Timestamp("2025-01-02 14:00"),
+        ]
+        assert hourly.loc["2025-01-02 10:30", "$volume"] == 300.0
+        # 只有缺失值的区间成交量为NaN而不是0
+        assert np.isnan(hourly.loc["2025-01-02 14:00", "$volume"])
+        assert hourly.loc["2025-01-02 15:00", "$close"] == 10.55
+    
+    def test_clock_aligned_without_calendar(self, minute_frame):
+        """没有交易日历时按整点对齐"""
+        bars = minute_frame.resample_bars("5min")
+        
+        assert bars.index[0] == pd.Timestamp("2025-01-02 09:35")
+        assert bars.iloc[0]["$high"] == 10.5
+    
+    def test_invalid_freq(self, minute_frame):
+        with pytest.raises(ValueError):
+            minute_frame.resample_bars("daily")
+
+
+@pytest.fixture
+def daily_frame():
+    """2025-03-24（周一）至2025-04-09（周三）的工作日日线，4月从周二开始"""
+    index = pd.bdate_range("2025-03-24", "2025-04-09", name="datetime")
+    closes = [float(i) for i in range(len(index))]
+    return FeatureFrame({
+        "$open": [c - 0.5 for c in closes],
+        "$high": [c + 1.0 for c in closes],
+        "$low": [c - 1.0 for c in closes],
+        "$close": closes,
+        "$volume": [100.0] * len(closes),
+    }, index=index)
+
+
+class TestResamplePeriods:
+    """周线、月线重采样测试类"""
+    
+    def test_weekly_bars_span_month_boundary(self, daily_frame):
+        """跨月的一周不被拆开，以区间内最后一行的日期为索引"""
+        weekly = daily_frame.resample_bars("week")
+        
+        assert list(weekly.index) == [
+            pd.Timestamp("2025-03-28"), pd.Timestamp("2025-04-04"), pd.Timestamp("2025-04-09")
+        ]
+        bar = weekly.iloc[1]
+        assert bar["$open"] == 4.5
+        assert bar["$high"] == 10.0
+        assert bar["$low"] == 4.0
+        assert bar["$close"] == 9.0
+        assert bar["$volume"] == 500.0
+    
+    def test_month_starting_mid_week(self, daily_frame):
+        """月中开始的周不影响月线：4月的开盘取4月1日（周二）"""
+        monthly = daily_frame.resample_bars("month")
+        
+        assert list(monthly.index) == [pd.Timestamp("2025-03-31"), pd.Timestamp("2025-04-09")]
+        april = monthly.iloc[1]
+        assert april["$open"] == 5.5
+        assert april["$low"] == 5.0
+        assert april["$close"] == 12.0
+        assert april["$volume"] == 700.0
+        assert monthly.iloc[0]["$volume"] == 600.0
+    
+    def test_partial_periods_flagged(self, daily_frame):
+        """区间中途结束的末尾K线和中途开始的首个K线标记为不完整"""
+        weekly = daily_frame.resample_bars("week")
+        monthly = daily_frame.resample_bars("month")
+        
+        assert list(weekly["complete"]) == [True, True, False]
+        assert list(monthly["complete"]) == [False, False]
+        assert list(weekly.columns)[-1] == "complete"
+    
+    def test_holiday_week_complete_with_calendar(self, daily_frame):
+        """按交易日历判断：清明节前结束的一周是完整的"""
+        # 2025-03-31至2025-04-03，4月4日为上交所休市日
+        week = daily_frame.iloc[5:9]
+        
+        assert list(week.resample_bars("week", calendar=get_calendar("SSE"))["complete"]) == [True]
+        assert list(week.resample_bars("week")["complete"]) == [False]
+    
+    def test_empty_frame(self):
+        """空数据返回空结果"""
+        empty = FeatureFrame({"$close": []}, index=pd.DatetimeIndex([], name="datetime"))
+        
+        result = empty.resample_bars("month")
+        
+        assert len(result) == 0
+        assert list(result.columns) == ["$close", "complete"]
+
+
+class TestUpsamplingChecks:
+    """升采样检查测试类"""
+    
+    def test_bar_interval(self, minute_frame, daily_frame):
+        assert minute_frame.bar_interval() == pd.Timedelta(minutes=1)
+        assert daily_frame.bar_interval() == pd.Timedelta(days=1)
+        assert minute_frame.resample_bars(Freq.MIN5).bar_interval() >= pd.Timedelta(minutes=5)
+        assert FeatureFrame({"$close": [1.0]}, index=pd.DatetimeIndex(["2025-01-02 09:31"])).bar_interval() is None
+    
+    def test_can_resample(self, minute_frame, daily_frame):
+        assert minute_frame.can_resample(Freq.MIN1)
+        assert minute_frame.can_resample("60min") and minute_frame.can_resample("week")
+        assert daily_frame.can_resample(Freq.DAY) and daily_frame.can_resample("month")
+        assert not daily_frame.can_resample(Freq.MIN60)
+        assert not minute_frame.resample_bars("15min").can_resample(Freq.MIN5)
+    
+    def test_upsampling_is_rejected(self, daily_frame):
+        """日线不能转换为分钟线"""
+        with pytest.raises(ValueError, match="upsampling"):
+            daily_frame.resample_bars(Freq.MIN5)
+
+
+class TestSnapshot:
+    """二进制快照测试类"""
+    
+    @pytest.fixture
+    def frame(self):
+        index = pd.date_range("2025-01-02 09:31", periods=5, freq="min", name="datetime")
+        frame = FeatureFrame({
+            "$close": [10.1, np.nan, 0.1 + 0.2, -0.0, np.inf],
+            "$volume": np.array([1, 2, 3, 4, 2 ** 62], dtype=np.int64),
+            "$limit_up": [True, False, False, True, False],
+        }, index=index)
+        frame.attrs["instrument"] = "SH600000"
+        return frame
+    
+    def test_round_trip_is_bit_exact(self, frame, tmp_path):
+        path = tmp_path / "SH600000.qtfs"
+        
+        frame.save(path)
+        loaded = FeatureFrame.load(path)
+        
+        assert isinstance(loaded, FeatureFrame)
+        assert list(loaded.columns) == list(frame.columns)
+        assert loaded.index.equals(frame.index) and loaded.index.name == "datetime"
+        assert list(loaded.dtypes) == list(frame.dtypes)
+        # NaN、-0.0等按位比较
+        original = frame["$close"].to_numpy().view(np.uint64)
+        assert (loaded["$close"].to_numpy().view(np.uint64) == original).all()
+        assert loaded["$volume"].iloc[-1] == 2 ** 62
+        assert loaded.attrs["instrument"] == "SH600000"
+    
+    def test_stream_and_timezone(self, frame):
+        import io
+        aware = frame.tz_localize("Asia/Shanghai")
+        buffer = io.BytesIO()
+        
+        aware.save(buffer)
+        buffer.seek(0)
+        loaded = FeatureFrame.load(buffer)
+        
+        assert loaded.index.equals(aware.index)
+        assert str(loaded.index.tz) == "Asia/Shanghai"
+    
+    def test_empty_frame(self, tmp_path):
+        empty = FeatureFrame({"$close": []}, index=pd.DatetimeIndex([]), dtype=float)
+        
+        empty.save(tmp_path / "empty.qtfs")
+        loaded = FeatureFrame.load(tmp_path / "empty.qtfs")
+        
+        assert loaded.empty and list(loaded.columns) == ["$close"]
+        assert "instrument" not in loaded.attrs
+    
+    def test_rejects_unsupported_frames(self, frame, tmp_path):
+        with pytest.raises(ValueError):
+            frame.assign(name="a").save(tmp_path / "x.qtfs")
+        with pytest.raises(ValueError):
+            frame.reset_index().save(tmp_path / "x.qtfs")
+    
+    def test_bad_snapshots(self, frame, tmp_path):
+        path = tmp_path / "bad.qtfs"
+        frame.save(path)
+        data = path.read_bytes()
+        
+        path.write_bytes(data[:-3])
+        with pytest.raises(DataError):
+            FeatureFrame.load(path)
+        path.write_bytes(b"PAR1" + data[4:])
+        with pytest.raises(DataError):
+            FeatureFrame.load(path)
+        # 未知的格式版本
+        path.write_bytes(data[:4] + bytes([99]) + data[5:])
+        with pytest.raises(DataError) as exc_info:
+            FeatureFrame.load(path)
+        assert "version 99" in str(exc_info.value.error_info.error_message_en)
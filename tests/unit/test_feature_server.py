@@ -0,0 +1,225 @@
+"""
+Unit tests for the feature HTTP server
+特征数据HTTP服务单元测试
+"""
+
+import json
+import threading
+import time
+import urllib.error
+import urllib.request
+from urllib.parse import urlencode
+
+import pytest
+
+from src.server.feature_server import FeatureServer
+from src.server.health import WarmupProbe
+from src.utils.request_context import RequestContext
+from tests.unit._providers import StaticProvider
+
+
+class GatedProvider(StaticProvider):
+    """load_features等到gate打开才返回，用于观察预热完成之前的状态"""
+    
+    def __init__(self):
+        super().__init__()
+        self.gate = threading.Event()
+    
+    def load_features(self, *args, **kwargs):
+        self.gate.wait(timeout=5)
+        return super().load_features(*args, **kwargs)
+
+
+class EmptyProvider(StaticProvider):
+    """日历为空，健康检查失败"""
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return []
+
+
+def _serve(server):
+    """在后台运行服务，返回用于关闭的上下文和线程 / Run the server in the background, returning the context and thread stopping it"""
+    ctx = RequestContext()
+    thread = threading.Thread(target=server.serve, args=(ctx,), daemon=True)
+    thread.start()
+    return ctx, thread
+
+
+@pytest.fixture
+def server():
+    """在随机端口上运行的服务，测试结束后关闭 / Server on a random port, shut down after the test"""
+    server = FeatureServer("127.0.0.1:0", StaticProvider())
+    ctx, thread = _serve(server)
+    yield server
+    ctx.cancel()
+    thread.join(timeout=5)
+
+
+def get(server, path, **params):
+    """发送GET请求，返回(状态码, JSON) / Send a GET request and return (status, JSON)"""
+    url = f"http://{server.address}{path}"
+    if params:
+        url += "?" + urlencode(params, doseq=True)
+    try:
+        with urllib.request.urlopen(url, timeout=5) as response:
+            return response.status, json.loads(response.read())
+    except urllib.error.HTTPError as e:
+        return e.code, json.loads(e.read())
+
+
+class TestFeatureServer:
+    """FeatureServer测试类"""
+    
+    def test_features_as_json(self, server):
+        """返回日期和各字段的值，缺失值为null"""
+        status, body = get(
+            server, "/features",
+            instruments="SH000300", fields="$close,$volume", start="2025-01-03", end="2025-01-05"
+        )
+        
+        assert status == 200
+        assert body == {
+            "SH000300": {
+                "dates": ["2025-01-03", "2025-01-04", "2025-01-05"],
+                "columns": {"$close": [11.0, None, 12.0], "$volume": [200.0, 300.0, 400.0]}
+            }
+        }
+    
+    def test_expression_with_commas(self, server):
+        """表达式参数中的逗号不拆分字段"""
+        status, body = get(server, "/features", instruments="SH000300", fields="$close,Ref($close,1)")
+        
+        assert status == 200
+        columns = body["SH000300"]["columns"]
+        assert list(columns) == ["$close", "Ref($close,1)"]
+        assert columns["Ref($close,1)"][:2] == [None, 10.0]
+    
+    def test_repeated_fields_parameter(self, server):
+        """fields可以重复给出"""
+        status, body = get(server, "/features", instruments="SH000300", fields=["$close", "$volume"])
+        
+        assert status == 200
+        assert list(body["SH000300"]["columns"]) == ["$close", "$volume"]
+    
+    @pytest.mark.parametrize("params, message", [
+        ({"fields": "$close"}, "instruments"),
+        ({"instruments": "SH000300"}, "fields"),
+        ({"instruments": "SH000300", "fields": "$close", "start": "not-a-date"}, "start"),
+        ({"instruments": "SH000300", "fields": "$close", "start": "2025-02-01", "end": "2025-01-01"}, "after"),
+        ({"instruments": "SH000300", "fields": "$close", "freq": "2min"}, "freq"),
+        ({"instruments": "SH000300", "fields": "$close", "limit": "10"}, "limit"),
+    ])
+    def test_bad_parameters(self, server, params, message):
+        """参数错误返回400和说明"""
+        status, body = get(server, "/features", **params)
+        
+        assert status == 400
+        assert message in body["error"]
+    
+    def test_bad_expression(self, server):
+        """表达式语法错误返回400和错误位置"""
+        status, body = get(server, "/features", instruments="SH000300", fields="Mean($close,")
+        
+        assert status == 400
+        assert body["code"] == "DAT0015"
+        assert "^" in body["details"]
+    
+    def test_frequency_not_served_by_provider(self, server):
+        """提供者不支持的频率返回400"""
+        status, body = get(server, "/features", instruments="SH000300", fields="$close", freq="5min")
+        
+        assert status == 400
+        assert body["code"] == "DAT0020"
+    
+    def test_unknown_instrument(self, server):
+        """未知标的返回404并列出标的"""
+        status, body = get(server, "/features", instruments="SH000300,SZ399999", fields="$close")
+        
+        assert status == 404
+        assert body["instruments"] == ["SZ399999"]
+    
+    def test_unknown_path(self, server):
+        """未知路径返回404"""
+        status, body = get(server, "/bars")
+        
+        assert status == 404
+        assert "/bars" in body["error"]
+    
+    def test_graceful_shutdown(self):
+        """取消上下文后serve()返回，端口不再接受连接"""
+        server = FeatureServer("127.0.0.1:0", StaticProvider())
+        address = server.address
+        ctx = RequestContext()
+        thread = threading.Thread(target=server.serve, args=(ctx,), daemon=True)
+        thread.start()
+        assert get(server, "/features", instruments="SH000300", fields="$close")[0] == 200
+        
+        ctx.cancel()
+        thread.join(timeout=5)
+        
+        assert not thread.is_alive()
+        with pytest.raises(urllib.error.URLError):
+            urllib.request.urlopen(f"http://{address}/features", timeout=1)
+    
+    def test_invalid_address(self):
+        """地址必须形如host:port"""
+        with pytest.raises(ValueError):
+            FeatureServer("localhost", StaticProvider())
+
+
+class TestHealth:
+    """/healthz和/readyz测试类"""
+    
+    def test_ready_without_warm_up(self, server):
+        assert get(server, "/healthz") == (200, {"status": "ok", "provider": "static"})
+        assert get(server, "/readyz") == (200, {"status": "ready", "provider": "static"})
+    
+    def test_not_ready_until_warm_up_succeeds(self):
+        provider = GatedProvider()
+        server = FeatureServer("127.0.0.1:0", provider, warmup=WarmupProbe("SH000300", ["$close"]))
+        ctx, thread = _serve(server)
+        try:
+            status, body = get(server, "/readyz")
+            assert (status, body["status"]) == (503, "warming_up")
+            # 预热期间存活检查不受影响
+            assert get(server, "/healthz")[0] == 200
+            
+            provider.gate.set()
+            deadline = time.monotonic() + 5
+            while get(server, "/readyz")[0] != 200 and time.monotonic() < deadline:
+                time.sleep(0.01)
+            
+            assert get(server, "/readyz") == (200, {"status": "ready", "provider": "static"})
+        finally:
+            provider.gate.set()
+            ctx.cancel()
+            thread.join(timeout=5)
+    
+    def test_failed_warm_up(self):
+        server = FeatureServer("127.0.0.1:0", StaticProvider(), warmup=WarmupProbe("SZ399999", ["$close"]))
+        try:
+            assert not server.health.warm_up()
+            
+            ready, body = server.health.readiness()
+            assert not ready
+            assert body["status"] == "warmup_failed" and body["error"]
+        finally:
+            server.server_close()
+    
+    def test_unhealthy_provider(self):
+        server = FeatureServer("127.0.0.1:0", EmptyProvider())
+        ctx, thread = _serve(server)
+        try:
+            status, body = get(server, "/healthz")
+            assert (status, body["status"]) == (503, "unhealthy")
+            assert "calendar is empty" in body["error"]
+            assert get(server, "/readyz")[0] == 503
+        finally:
+            ctx.cancel()
+            thread.join(timeout=5)
+    
+    def test_invalid_probe(self):
+        with pytest.raises(ValueError):
+            WarmupProbe("SH000300", [])
+        with pytest.raises(ValueError):
+            WarmupProbe("SH000300", freq="2min")
@@ -0,0 +1,167 @@
+"""
+Unit tests for streaming feature reads
+特征数据流式读取单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.feature_stream import FeatureRequest, plan_windows
+from src.infrastructure.data_provider import DataProvider
+from src.utils.request_context import RequestContext, ContextCancelledError
+from tests.unit._providers import clip_range
+
+
+class MemoryProvider(DataProvider):
+    """Serves business-day closes for a few instruments from memory"""
+    
+    name = "memory"
+    
+    def __init__(self, instruments=("SH600000", "SZ000001")):
+        self.index = pd.bdate_range("2025-01-01", "2025-06-30", name="datetime")
+        self.frames = {
+            code: pd.DataFrame(
+                {"$close": [float(i + offset * 1000) for i in range(len(self.index))]},
+                index=self.index
+            )
+            for offset, code in enumerate(instruments)
+        }
+        self.requests = []
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.requests.append((instrument, start_time, end_time))
+        return clip_range(self.frames[instrument][fields], start_time, end_time)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        index = self.index
+        if start_time is not None:
+            index = index[index >= pd.Timestamp(start_time)]
+        if end_time is not None:
+            index = index[index <= pd.Timestamp(end_time)]
+        return list(index)
+
+
+@pytest.fixture
+def provider():
+    return MemoryProvider()
+
+
+@pytest.fixture
+def manager(provider):
+    return DataManager(enable_cache=False, provider=provider)
+
+
+def _collect(iterator):
+    chunks = []
+    while True:
+        chunk, ok = iterator.next()
+        if not ok:
+            break
+        chunks.append(chunk)
+    return chunks
+
+
+class TestFeatureStream:
+    """FeatureIterator测试类"""
+    
+    def test_monthly_chunks_in_order(self, manager):
+        """按月分块，标的按请求顺序、块按时间升序输出"""
+        iterator = manager.get_features_stream(FeatureRequest(
+            ["SZ000001", "SH600000"], ["$close"],
+            start_time="2025-01-01", end_time="2025-03-31"
+        ))
+        
+        chunks = _collect(iterator)
+        
+        assert [(c.instrument, c.sequence) for c in chunks] == [
+            ("SZ000001", 0), ("SZ000001", 1), ("SZ000001", 2),
+            ("SH600000", 0), ("SH600000", 1), ("SH600000", 2),
+        ]
+        assert chunks[1].start == pd.Timestamp("2025-02-03")
+        assert chunks[1].end == pd.Timestamp("2025-02-28")
+        assert all(a.end < b.start for a, b in zip(chunks[:2], chunks[1:3]))
+    
+    def test_stream_matches_eager(self, manager):
+        """拼接后的流式结果与一次性获取一致，包括跨块的表达式"""
+        fields = ["$close", "Mean($close,5)", "Ref($close,3)"]
+        eager = manager.get_features("SH600000", fields)["SH600000"]
+        
+        iterator = manager.get_features_stream(
+            FeatureRequest("SH600000", fields, chunk_by=7)
+        )
+        streamed = pd.concat([c.frame for c in _collect(iterator)])
+        
+        pd.testing.assert_frame_equal(
+            pd.DataFrame(streamed), pd.DataFrame(eager), check_freq=False
+        )
+    
+    def test_fixed_row_chunks(self, manager):
+        """按固定行数分块"""
+        iterator = manager.get_features_stream(FeatureRequest(
+            "SH600000", ["$close"],
+            start_time="2025-01-01", end_time="2025-01-31", chunk_by=10
+        ))
+        
+        sizes = [len(c.frame) for c in _collect(iterator)]
+        
+        assert sizes == [10, 10, 3]
+    
+    def test_each_chunk_is_loaded_separately(self, manager, provider):
+        """每个块单独向提供者请求"""
+        _collect(manager.get_features_stream(FeatureRequest(
+            "SH600000", ["$close"], start_time="2025-01-01", end_time="2025-02-28"
+        )))
+        
+        assert provider.requests == [
+            ("SH600000", pd.Timestamp("2025-01-01"), pd.Timestamp("2025-01-31")),
+            ("SH600000", pd.Timestamp("2025-02-03"), pd.Timestamp("2025-02-28")),
+        ]
+    
+    def test_failed_instrument_is_skipped(self, manager):
+        """失败的标的记录在errors中，其他标的继续输出"""
+        iterator = manager.get_features_stream(FeatureRequest(
+            ["BAD001", "SH600000"], ["$close"], start_time="2025-01-01", end_time="2025-01-31"
+        ))
+        
+        chunks = _collect(iterator)
+        
+        assert [c.instrument for c in chunks] == ["SH600000"]
+        assert "BAD001" in iterator.errors
+    
+    def test_cancellation_stops_iteration(self, manager):
+        """取消上下文后迭代结束，error为取消原因"""
+        ctx = RequestContext()
+        iterator = manager.get_features_stream(FeatureRequest(
+            "SH600000", ["$close"], context=ctx
+        ))
+        
+        chunk, ok = iterator.next()
+        assert ok
+        ctx.cancel("client went away")
+        
+        assert iterator.next() == (None, False)
+        assert isinstance(iterator.error, ContextCancelledError)
+        with pytest.raises(ContextCancelledError):
+            next(iter(iterator))
+    
+    def test_invalid_chunk_by(self):
+        """非法的分块方式"""
+        with pytest.raises(ValueError):
+            FeatureRequest("SH600000", ["$close"], chunk_by="week")
+        with pytest.raises(ValueError):
+            FeatureRequest("SH600000", ["$close"], chunk_by=0)
+
+
+class TestPlanWindows:
+    """plan_windows()测试类"""
+    
+    def test_month_windows(self):
+        """按月划分"""
+        sessions = list(pd.bdate_range("2025-01-30", "2025-02-04"))
+        
+        assert plan_windows(sessions, "month") == [
+            (pd.Timestamp("2025-01-30"), pd.Timestamp("2025-01-31")),
+            (pd.Timestamp("2025-02-03"), pd.Timestamp("2025-02-04")),
+        ]
+        assert plan_windows([], "month") == []
@@ -0,0 +1,63 @@
+"""
+Unit tests for the columnar frame codec
+列式数据帧编码单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.server.frame_codec import ZSTD_AVAILABLE, FrameCodecError, decode_frame, encode_frame
+
+
+@pytest.fixture
+def frame():
+    index = pd.DatetimeIndex(["2025-01-02", "2025-01-03", "2025-01-06"], name="datetime")
+    return pd.DataFrame({
+        "$close": [10.2, np.nan, 10.4],
+        "$volume": np.array([1000, 1200, 900], dtype=np.int64),
+        "limit_up": [False, True, False],
+        "period_end": pd.to_datetime(["2024-09-30", None, "2024-12-31"]),
+        "note": ["a", None, "c"],
+    }, index=index)
+
+
+class TestFrameCodec:
+    """列式编码测试类"""
+    
+    def test_round_trip(self, frame):
+        pd.testing.assert_frame_equal(decode_frame(encode_frame(frame)), frame)
+    
+    @pytest.mark.skipif(not ZSTD_AVAILABLE, reason="zstandard not installed")
+    def test_zstd_round_trip(self, frame):
+        large = pd.DataFrame({"$close": np.ones(10_000)}, index=pd.date_range("2025-01-01", periods=10_000, freq="min"))
+        
+        compressed = encode_frame(large, "zstd")
+        
+        assert len(compressed) < len(encode_frame(large)) // 10
+        pd.testing.assert_frame_equal(decode_frame(compressed), large, check_freq=False)
+        pd.testing.assert_frame_equal(decode_frame(encode_frame(frame, "zstd")), frame)
+    
+    def test_timezone_and_empty_frames(self):
+        aware = pd.DataFrame(
+            {"$close": [1.0]}, index=pd.DatetimeIndex(["2025-01-02 09:31"]).tz_localize("Asia/Shanghai")
+        )
+        empty = pd.DataFrame(columns=["$close"], dtype=float)
+        
+        pd.testing.assert_frame_equal(decode_frame(encode_frame(aware)), aware)
+        pd.testing.assert_frame_equal(decode_frame(encode_frame(empty)), empty)
+        assert decode_frame(encode_frame(pd.DataFrame(index=pd.DatetimeIndex(["2025-01-02"])))).index[0] == (
+            pd.Timestamp("2025-01-02")
+        )
+    
+    def test_invalid_input(self, frame):
+        data = encode_frame(frame)
+        
+        with pytest.raises(FrameCodecError):
+            decode_frame(b"not a frame")
+        with pytest.raises(FrameCodecError):
+            decode_frame(data[:-8])
+        with pytest.raises(FrameCodecError):
+            encode_frame(frame, "gzip")
+        with pytest.raises(FrameCodecError):
+            encode_frame(pd.DataFrame({"x": [object()]}))
@@ -0,0 +1,188 @@
+"""
+Unit tests for frame alignment and join
+数据对齐与合并单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.feature_frame import FeatureFrame, FeatureResult
+from src.core.trading_calendar import FillPolicy
+from tests.unit._providers import column_frame
+
+
+@pytest.fixture
+def minute():
+    times = ["2025-01-02 09:31", "2025-01-02 15:00", "2025-01-03 09:31", "2025-01-06 09:31"]
+    return column_frame(times, "$close", [10.0, 10.5, 10.4, 10.8])
+
+
+@pytest.fixture
+def daily():
+    return column_frame(["2025-01-02", "2025-01-03", "2025-01-07"], "factor", [1.0, 2.0, 3.0])
+
+
+class TestAlignWith:
+    """FeatureFrame.align_with测试类"""
+    
+    def test_outer_leaves_nan(self):
+        left = column_frame(["2025-01-02", "2025-01-03"], "a", [1.0, 2.0])
+        right = column_frame(["2025-01-03", "2025-01-06"], "b", [5.0, 6.0])
+        
+        a, b = left.align_with(right)
+        
+        assert list(a.index) == list(b.index) == list(pd.to_datetime(["2025-01-02", "2025-01-03", "2025-01-06"]))
+        assert a["a"].tolist()[:2] == [1.0, 2.0] and np.isnan(a["a"].iloc[2])
+        assert np.isnan(b["b"].iloc[0])
+    
+    def test_fill_methods_only_fill_added_rows(self):
+        left = column_frame(["2025-01-02", "2025-01-06"], "a", [1.0, np.nan])
+        right = column_frame(["2025-01-02", "2025-01-03", "2025-01-06"], "b", [4.0, 5.0, 6.0])
+        
+        a, _ = left.align_with(right, FillPolicy.FORWARD_FILL)
+        # 新增的行取之前最近的行，已有的NaN保持不变
+        assert a.loc["2025-01-03", "a"] == 1.0
+        assert np.isnan(a.loc["2025-01-06", "a"])
+        
+        _, b = column_frame(["2025-01-01", "2025-01-02"], "c", [0.0, 0.0]).align_with(right, "bfill")
+        assert b.loc["2025-01-01", "b"] == 4.0
+    
+    def test_inner_and_left(self):
+        left = column_frame(["2025-01-02", "2025-01-03"], "a", [1.0, 2.0])
+        right = column_frame(["2025-01-03", "2025-01-06"], "b", [5.0, 6.0])
+        
+        inner, _ = left.align_with(right, how="inner")
+        kept, filled = left.align_with(right, "ffill", how="left")
+        
+        assert list(inner.index) == [pd.Timestamp("2025-01-03")]
+        assert list(kept.index) == list(left.index)
+        assert np.isnan(filled["b"].iloc[0]) and filled["b"].iloc[1] == 5.0
+    
+    def test_invalid_arguments(self, daily):
+        with pytest.raises(ValueError):
+            daily.align_with(daily, how="right")
+        with pytest.raises(ValueError):
+            daily.align_with(daily, FillPolicy.DROP)
+        with pytest.raises(ValueError, match="duplicate"):
+            pd.concat([daily, daily]).pipe(FeatureFrame).align_with(daily)
+
+
+class TestDailyOntoMinute:
+    """日线合并到分钟线测试类"""
+    
+    def test_broadcast_without_lookahead(self, minute, daily):
+        joined = minute.join_with(daily)
+        
+        assert list(joined.index) == list(minute.index)
+        # 1月2日的两根K线都取当日的日线值，不会看到1月3日的值
+        assert joined["factor"].tolist()[:3] == [1.0, 1.0, 2.0]
+        # 1月6日没有日线
+        assert np.isnan(joined["factor"].iloc[3])
+    
+    def test_missing_day_fill(self, minute, daily):
+        assert minute.join_with(daily, method="ffill")["factor"].iloc[3] == 2.0
+        assert minute.join_with(daily, method="bfill")["factor"].iloc[3] == 3.0
+    
+    def test_inner_drops_days_without_daily_value(self, minute, daily):
+        joined = minute.join_with(daily, how="inner")
+        
+        assert list(joined.index) == list(minute.index[:3])
+    
+    def test_outer_keeps_daily_rows_without_bars(self, minute, daily):
+        joined = minute.join_with(daily, how="outer", method="ffill")
+        
+        assert joined.index[-1] == pd.Timestamp("2025-01-07")
+        assert joined.loc["2025-01-07", "factor"] == 3.0
+        assert joined.loc["2025-01-07", "$close"] == 10.8
+
+
+class TestJoinWith:
+    """FeatureFrame.join_with测试类"""
+    
+    def test_column_collision_suffixes(self):
+        left = column_frame(["2025-01-02"], "$close", [1.0])
+        right = column_frame(["2025-01-02"], "$close", [2.0])
+        left.attrs["instrument"] = "SH600000"
+        
+        joined = left.join_with(right)
+        named = left.join_with(right, suffixes=("_a", "_b"))
+        
+        assert list(joined.columns) == ["$close", "$close_right"]
+        assert list(named.columns) == ["$close_a", "$close_b"]
+        assert joined.attrs["instrument"] == "SH600000"
+        assert isinstance(joined, FeatureFrame)
+        with pytest.raises(ValueError, match="suffixes"):
+            left.join_with(right, suffixes=("", ""))
+        with pytest.raises(ValueError, match="both sides"):
+            left.join_with(right, suffixes=None)
+    
+    def test_inner_drops_non_overlapping_dates(self):
+        price = column_frame(["2025-01-02", "2025-01-03", "2025-01-06"], "$close", [10.0, 10.5, 10.2])
+        factor = column_frame(["2025-01-03", "2025-01-06", "2025-01-07"], "$pb", [1.1, 1.2, 1.3])
+        
+        joined = price.join_with(factor, how="inner", suffixes=None)
+        
+        assert list(joined.index) == list(pd.to_datetime(["2025-01-03", "2025-01-06"]))
+        assert joined.columns.tolist() == ["$close", "$pb"]
+        assert joined["$pb"].tolist() == [1.1, 1.2]
+    
+    def test_outer_introduces_nan(self):
+        price = column_frame(["2025-01-02", "2025-01-03"], "$close", [10.0, 10.5])
+        factor = column_frame(["2025-01-03", "2025-01-06"], "$pb", [1.1, 1.2])
+        
+        joined = price.join_with(factor, how="outer")
+        left = price.join_with(factor, how="left")
+        
+        assert len(joined) == 3
+        assert np.isnan(joined.loc["2025-01-02", "$pb"]) and np.isnan(joined.loc["2025-01-06", "$close"])
+        assert joined.loc["2025-01-03"].tolist() == [10.5, 1.1]
+        assert list(left.index) == list(price.index) and np.isnan(left["$pb"].iloc[0])
+
+
+class TestFeatureResultJoin:
+    """FeatureResult按标的合并测试类"""
+    
+    @pytest.fixture
+    def results(self):
+        days = ["2025-01-02", "2025-01-03"]
+        prices = FeatureResult(
+            {"SH600000": column_frame(days, "$close", [10.0, 10.2]), "SZ000001": column_frame(days, "$close", [5.0, 5.1])},
+            {"SZ000002": ValueError("no data")}
+        )
+        factors = FeatureResult(
+            {"SZ000001": column_frame(days[1:], "factor", [0.5]), "SZ000002": column_frame(days, "factor", [0.1, 0.2])}
+        )
+        return prices, factors
+    
+    def test_inner(self, results):
+        prices, factors = results
+        
+        joined = prices.join_with(factors, how="inner", method="ffill")
+        
+        assert joined.instruments == ["SZ000001"]
+        assert list(joined["SZ000001"].index) == [pd.Timestamp("2025-01-03")]
+        assert joined["SZ000001"]["factor"].tolist() == [0.5]
+    
+    def test_left_and_outer(self, results):
+        prices, factors = results
+        
+        left = prices.join_with(factors)
+        outer = prices.join_with(factors, how="outer")
+        
+        assert left.instruments == ["SH600000", "SZ000001"]
+        assert left["SH600000"]["factor"].isna().all()
+        assert "SZ000002" in left.errors
+        assert outer.instruments == ["SH600000", "SZ000001", "SZ000002"]
+        assert outer["SZ000002"]["$close"].isna().all()
+        assert outer["SZ000002"]["factor"].tolist() == [0.1, 0.2]
+        assert outer.errors == {}
+    
+    def test_align_with(self, results):
+        prices, factors = results
+        
+        left, right = prices.align_with(factors, how="outer")
+        
+        assert left.instruments == right.instruments == ["SH600000", "SZ000001", "SZ000002"]
+        assert list(left["SZ000001"].index) == list(right["SZ000001"].index)
+        assert right["SH600000"].columns.tolist() == ["factor"]
@@ -0,0 +1,185 @@
+"""
+Unit tests for point-in-time fundamental fields
+基本面字段按时点对齐单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.feature_stream import FeatureRequest
+from src.core.fundamentals import align_point_in_time, to_staleness
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import DataProvider, FundamentalsUnavailableError
+
+
+# 2025-04-29同日先后发布年报和一季报，一季报（最后一条）生效
+FUNDAMENTALS_CSV = """announce_date,period_end,pe_ttm,pb,market_cap,turnover_rate
+2024-10-30,2024-09-30,10.0,1.0,100.0,0.5
+2025-04-29,2024-12-31,12.0,1.2,120.0,0.6
+2025-04-29,2025-03-31,13.0,1.3,130.0,0.7
+"""
+
+
+@pytest.fixture
+def provider(tmp_path):
+    index = pd.bdate_range("2024-10-01", "2025-05-30")
+    prices = pd.DataFrame({"date": index.strftime("%Y-%m-%d"), "close": 10.0})
+    prices.to_csv(tmp_path / "SH600000.csv", index=False)
+    (tmp_path / "fundamentals").mkdir()
+    (tmp_path / "fundamentals" / "SH600000.csv").write_text(FUNDAMENTALS_CSV)
+    return CSVDataProvider(str(tmp_path))
+
+
+def _get(provider, fields, start="2024-10-01", end="2025-05-30", **kwargs):
+    manager = DataManager(enable_cache=False, provider=provider, **kwargs)
+    result = manager.get_features("SH600000", fields, start_time=start, end_time=end)
+    result.raise_for_errors()
+    return result["SH600000"]
+
+
+class PricesOnlyProvider(DataProvider):
+    """Serves prices only, without fundamentals"""
+    
+    name = "static"
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        index = pd.bdate_range("2025-01-02", periods=3, name="datetime")
+        return pd.DataFrame({f: 1.0 for f in fields}, index=index)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(pd.bdate_range("2025-01-02", periods=3))
+
+
+class TestAlignPointInTime:
+    """align_point_in_time测试类"""
+    
+    def test_values_start_on_announcement_date(self):
+        records = pd.DataFrame(
+            {"$pb": [1.0, 2.0]},
+            index=pd.DatetimeIndex(["2025-01-03", "2025-01-07"])
+        )
+        index = pd.bdate_range("2025-01-02", "2025-01-08")
+        
+        frame = align_point_in_time(records, index, ["$pb"], None)
+        
+        values = frame["$pb"].tolist()
+        assert np.isnan(values[0])
+        assert values[1:] == [1.0, 1.0, 1.0, 2.0, 2.0]
+    
+    def test_missing_field_keeps_previous_announcement(self):
+        """某次公告缺少的字段沿用该字段上一次的值"""
+        records = pd.DataFrame(
+            {"$pb": [1.0, np.nan], "$pe_ttm": [10.0, 11.0]},
+            index=pd.DatetimeIndex(["2025-01-02", "2025-01-06"])
+        )
+        index = pd.DatetimeIndex(["2025-01-06"])
+        
+        frame = align_point_in_time(records, index, ["$pe_ttm", "$pb"], None)
+        
+        assert list(frame.columns) == ["$pe_ttm", "$pb"]
+        assert frame.iloc[0].tolist() == [11.0, 1.0]
+    
+    def test_staleness(self):
+        records = pd.DataFrame({"$pb": [1.0]}, index=pd.DatetimeIndex(["2025-01-02"]))
+        index = pd.DatetimeIndex(["2025-01-02", "2025-01-12", "2025-01-13"])
+        
+        frame = align_point_in_time(records, index, ["$pb"], pd.Timedelta(days=10))
+        
+        assert frame["$pb"].tolist()[:2] == [1.0, 1.0]
+        assert np.isnan(frame["$pb"].iloc[2])
+    
+    def test_no_records(self):
+        frame = align_point_in_time(pd.DataFrame(), pd.DatetimeIndex(["2025-01-02"]), ["$pb"])
+        
+        assert frame["$pb"].isna().all()
+    
+    def test_negative_staleness(self):
+        with pytest.raises(ValueError):
+            to_staleness("-1D")
+
+
+class TestFundamentalFields:
+    """基本面字段测试类"""
+    
+    def test_not_visible_at_period_end(self, provider):
+        """报告期末到公告日之间仍是上一次公告的值"""
+        frame = _get(provider, ["$close", "$pe_ttm"])
+        
+        assert np.isnan(frame.loc["2024-10-29", "$pe_ttm"])
+        assert frame.loc["2024-10-30", "$pe_ttm"] == 10.0
+        assert frame.loc["2025-03-31", "$pe_ttm"] == 10.0
+        assert frame.loc["2025-04-28", "$pe_ttm"] == 10.0
+        assert frame.loc["2025-04-29", "$pe_ttm"] == 13.0
+        assert frame.loc["2025-05-30", "$pe_ttm"] == 13.0
+        assert list(frame.columns) == ["$close", "$pe_ttm"]
+    
+    def test_all_fields(self, provider):
+        frame = _get(provider, ["$pe_ttm", "$pb", "$market_cap", "$turnover_rate"], start="2025-05-06")
+        
+        assert frame.iloc[0].tolist() == [13.0, 1.3, 130.0, 0.7]
+    
+    def test_range_start_carries_earlier_announcement(self, provider):
+        """区间开始之前的公告在区间开头仍然可见"""
+        frame = _get(provider, ["$close", "$pb"], start="2025-01-02", end="2025-01-10")
+        
+        assert (frame["$pb"] == 1.0).all()
+    
+    def test_max_staleness(self, provider):
+        frame = _get(provider, ["$close", "$pb"], fundamental_staleness="30D")
+        
+        assert frame.loc["2024-11-29", "$pb"] == 1.0
+        assert np.isnan(frame.loc["2024-12-02", "$pb"])
+        assert np.isnan(frame.loc["2025-04-28", "$pb"])
+        assert frame.loc["2025-04-29", "$pb"] == 1.3
+    
+    def test_only_fundamental_fields_use_calendar(self, provider):
+        frame = _get(provider, ["$market_cap"], start="2025-04-28", end="2025-04-30")
+        
+        assert list(frame.index) == list(pd.bdate_range("2025-04-28", "2025-04-30"))
+        assert frame["$market_cap"].tolist() == [100.0, 130.0, 130.0]
+    
+    def test_expression_over_fundamentals(self, provider):
+        frame = _get(provider, ["$close / $pe_ttm"], start="2025-04-28", end="2025-04-29")
+        
+        assert frame["$close / $pe_ttm"].tolist() == pytest.approx([1.0, 10.0 / 13.0])
+    
+    def test_stream_matches_eager(self, provider):
+        manager = DataManager(enable_cache=False, provider=provider)
+        iterator = manager.get_features_stream(FeatureRequest(
+            ["SH600000"], ["$close", "$pb"], start_time="2025-01-02", end_time="2025-05-30"
+        ))
+        streamed = pd.concat([chunk.frame for chunk in iterator])
+        
+        expected = _get(provider, ["$close", "$pb"], start="2025-01-02")
+        pd.testing.assert_frame_equal(pd.DataFrame(streamed), pd.DataFrame(expected), check_freq=False)
+    
+    def test_csv_records_are_indexed_by_announcement(self, provider):
+        records = provider.fundamentals(["SH600000"], ["$pe_ttm"], start_time="2025-01-01")["SH600000"]
+        
+        assert records.index.name == "announce_date"
+        assert list(records.index) == [pd.Timestamp("2025-04-29")] * 2
+        assert list(records["period_end"]) == [pd.Timestamp("2024-12-31"), pd.Timestamp("2025-03-31")]
+    
+    def test_missing_fundamentals_file(self, provider):
+        with pytest.raises(FundamentalsUnavailableError):
+            provider.fundamentals(["SZ000001"], ["$pb"])
+    
+    def test_provider_without_fundamentals(self):
+        """不提供基本面数据的提供者记录为该标的的错误"""
+        manager = DataManager(enable_cache=False, provider=PricesOnlyProvider())
+        
+        result = manager.get_features(["SH600000"], ["$close", "$pb"])
+        
+        assert "SH600000" not in result
+        error = result.errors["SH600000"]
+        assert isinstance(error, FundamentalsUnavailableError)
+        assert error.error_info.error_code == "DAT0026"
+    
+    def test_price_fields_unaffected(self):
+        manager = DataManager(enable_cache=False, provider=PricesOnlyProvider())
+        
+        result = manager.get_features(["SH600000"], ["$close"])
+        
+        assert result["SH600000"]["$close"].tolist() == [1.0, 1.0, 1.0]
@@ -0,0 +1,187 @@
+"""
+Unit tests for futures contracts and continuous contract stitching
+期货合约和连续合约拼接单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core import futures
+from src.core.futures import (
+    AdjustMethod,
+    ContinuousFuturesProvider,
+    ExpiryRoll,
+    FuturesSpec,
+    InstrumentType,
+    VolumeRoll,
+    contract_expiry,
+    get_futures_spec,
+    instrument_type,
+    is_continuous,
+    register_futures,
+    stitch
+)
+from src.core.trading_calendar import TradingCalendar
+from src.infrastructure.data_provider import InstrumentNotFoundError
+from src.utils.error_handler import DataError
+from tests.unit._providers import FakeProvider
+
+
+# 2025-01-06至2025-01-24的15个交易日，IF2501在1月17日（第三个星期五）到期
+DAYS = pd.bdate_range("2025-01-06", "2025-01-24", name="datetime")
+
+
+def _contract(days, close, volumes):
+    return pd.DataFrame({
+        "$open": [close + i - 0.5 for i in range(len(days))],
+        "$close": [close + i for i in range(len(days))],
+        "$volume": volumes,
+    }, index=days)
+
+
+@pytest.fixture
+def contracts():
+    front = DAYS[DAYS <= "2025-01-17"]
+    return {
+        # 近月成交量逐日减少，次月逐日增加，1月10日次月成交量首次反超
+        "IF2501.CFE": _contract(front, 100.0, [1000.0 - 100 * i for i in range(len(front))]),
+        "IF2502.CFE": _contract(DAYS, 110.0, [300.0 + 100 * i for i in range(len(DAYS))]),
+    }
+
+
+class TestSpecs:
+    """期货品种测试类"""
+    
+    def test_lookup(self):
+        assert get_futures_spec("IF2503.CFE").multiplier == 300
+        assert get_futures_spec("IC.CFE").multiplier == 200
+        assert get_futures_spec("SH600000") is None
+        assert instrument_type("IF2503.CFE") is InstrumentType.FUTURES
+        assert instrument_type("SH600000") is InstrumentType.STOCK
+    
+    def test_continuous_code(self):
+        assert is_continuous("IF.CFE")
+        assert not is_continuous("IF2503.CFE")
+        assert not is_continuous("XX.CFE")
+        assert get_futures_spec("IF.CFE").contract_code(2025, 3) == "IF2503.CFE"
+    
+    def test_register(self, monkeypatch):
+        monkeypatch.setattr(futures, "_SPECS", dict(futures._SPECS))
+        register_futures(FuturesSpec("T", "CFE", 10000.0, 0.02))
+        
+        assert get_futures_spec("T2503.CFE").multiplier == 10000
+        with pytest.raises(ValueError):
+            register_futures(FuturesSpec("TF", "CFE", 10000.0, 0.0))
+    
+    def test_expiry_is_third_friday(self):
+        assert contract_expiry("IF2503.CFE") == pd.Timestamp("2025-03-21")
+        assert contract_expiry("IF2501.CFE") == pd.Timestamp("2025-01-17")
+        assert contract_expiry("IF.CFE") is None
+        
+        calendar = TradingCalendar("TEST", holidays=["2025-03-21"])
+        assert contract_expiry("IF2503.CFE", calendar) == pd.Timestamp("2025-03-24")
+
+
+class TestStitch:
+    """连续合约拼接测试类"""
+    
+    def test_expiry_roll(self, contracts):
+        series = stitch("IF.CFE", contracts, ExpiryRoll(2), AdjustMethod.NONE)
+        
+        assert [r.time for r in series.rolls] == [pd.Timestamp("2025-01-15")]
+        assert series.contracts[:"2025-01-15"].eq("IF2501.CFE").all()
+        assert series.contracts["2025-01-16":].eq("IF2502.CFE").all()
+        assert series.frame.index.equals(DAYS)
+        # 不复权时换月处保留跳空
+        assert series.frame.loc["2025-01-15", "$close"] == contracts["IF2501.CFE"].loc["2025-01-15", "$close"]
+    
+    def test_volume_roll(self, contracts):
+        series = stitch("IF.CFE", contracts, VolumeRoll(), AdjustMethod.NONE)
+        
+        roll = series.rolls[0]
+        assert roll.time == pd.Timestamp("2025-01-10")
+        assert (roll.from_contract, roll.to_contract) == ("IF2501.CFE", "IF2502.CFE")
+        assert series.roll_on("2025-01-10") == roll
+        assert series.roll_on("2025-01-13") is None
+    
+    def test_difference_adjustment(self, contracts):
+        """次月比近月高10点，差值复权后整条序列等于次月价格"""
+        series = stitch("IF.CFE", contracts, ExpiryRoll(2), AdjustMethod.DIFFERENCE)
+        
+        expected = contracts["IF2502.CFE"]
+        assert series.rolls[0].gap == pytest.approx(10.0)
+        assert series.frame["$close"].tolist() == pytest.approx(expected["$close"].tolist())
+        assert series.frame["$open"].tolist() == pytest.approx(expected["$open"].tolist())
+        # 成交量不复权
+        assert series.frame.loc["2025-01-06", "$volume"] == 1000.0
+    
+    def test_ratio_adjustment(self, contracts):
+        series = stitch("IF.CFE", contracts, ExpiryRoll(2), AdjustMethod.RATIO)
+        
+        roll = series.rolls[0]
+        front = contracts["IF2501.CFE"]
+        assert roll.ratio == pytest.approx(117.0 / 107.0)
+        assert series.frame.loc["2025-01-06", "$close"] == pytest.approx(front.loc["2025-01-06", "$close"] * roll.ratio)
+        assert series.frame.loc["2025-01-16", "$close"] == contracts["IF2502.CFE"].loc["2025-01-16", "$close"]
+    
+    def test_forced_roll_when_front_ends(self, contracts):
+        """成交量从未反超但近月数据结束时，在最后一个共同交易日换月"""
+        contracts["IF2502.CFE"]["$volume"] = 1.0
+        
+        series = stitch("IF.CFE", contracts, VolumeRoll(), AdjustMethod.NONE)
+        
+        assert [r.time for r in series.rolls] == [pd.Timestamp("2025-01-17")]
+    
+    def test_no_roll_before_expiry(self, contracts):
+        short = {code: frame[:"2025-01-10"] for code, frame in contracts.items()}
+        
+        series = stitch("IF.CFE", short, ExpiryRoll(2))
+        
+        assert series.rolls == [] and series.contracts.eq("IF2501.CFE").all()
+    
+    def test_schedule(self, contracts):
+        schedule = stitch("IF.CFE", contracts, ExpiryRoll(2)).schedule()
+        
+        assert list(schedule.index) == [pd.Timestamp("2025-01-15")]
+        assert schedule.iloc[0]["to_contract"] == "IF2502.CFE"
+        assert schedule.iloc[0]["gap"] == pytest.approx(10.0)
+    
+    def test_missing_volume(self, contracts):
+        frames = {code: frame[["$close"]] for code, frame in contracts.items()}
+        
+        with pytest.raises(DataError):
+            stitch("IF.CFE", frames, VolumeRoll())
+
+
+class TestContinuousFuturesProvider:
+    """连续合约数据提供者测试类"""
+    
+    def test_loads_continuous_contract(self, contracts):
+        provider = ContinuousFuturesProvider(FakeProvider(contracts, DAYS), ExpiryRoll(2), AdjustMethod.DIFFERENCE)
+        
+        frame = provider.load_features("IF.CFE", ["$close"], "2025-01-06", "2025-01-24")
+        
+        assert list(frame.columns) == ["$close"]
+        assert frame["$close"].tolist() == pytest.approx(contracts["IF2502.CFE"]["$close"].tolist())
+        assert list(provider.roll_schedule("IF.CFE").index) == [pd.Timestamp("2025-01-15")]
+    
+    def test_passes_other_codes_through(self, contracts):
+        provider = ContinuousFuturesProvider(FakeProvider(contracts, DAYS))
+        
+        frame = provider.load_features("IF2501.CFE", ["$close"])
+        
+        assert frame.equals(contracts["IF2501.CFE"][["$close"]])
+        assert "IF.CFE" in provider.list_instruments()
+    
+    def test_explicit_contracts(self, contracts):
+        provider = ContinuousFuturesProvider(
+            FakeProvider(contracts, DAYS), ExpiryRoll(2), contracts={"IF.CFE": ["IF2502.CFE", "IF2503.CFE"]}
+        )
+        
+        series = provider.continuous("IF.CFE")
+        
+        assert series.rolls == [] and series.contracts.eq("IF2502.CFE").all()
+        with pytest.raises(InstrumentNotFoundError):
+            provider.continuous("IC.CFE")
+        with pytest.raises(ValueError):
+            provider.continuous("IF2501.CFE")
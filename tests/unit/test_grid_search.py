@@ -0,0 +1,174 @@
+"""
+参数网格搜索单元测试 / Parameter Grid Search Unit Tests
+"""
+
+import io
+
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import EngineConfig, Order, OrderSide, RandomSlippage, Strategy
+from src.application.grid_search import (
+    GridSearchConfig,
+    PartialGridSearchError,
+    grid_search,
+    parameter_grid
+)
+from src.core.feature_frame import FeatureFrame
+from src.utils.request_context import RequestContext
+
+
+DAYS = pd.bdate_range("2025-01-02", periods=20)
+
+
+@pytest.fixture
+def data():
+    closes = [10.0 * 1.01 ** i for i in range(len(DAYS))]
+    opens = [closes[0]] + closes[:-1]
+    return {"SH600000": FeatureFrame({"$open": opens, "$close": closes}, index=DAYS)}
+
+
+def _config(data, **kwargs):
+    engine = EngineConfig(
+        start_time="2025-01-01", end_time="2025-01-31", data=data, initial_cash=1000.0,
+        cost_model=kwargs.pop("cost_model", None), seed=kwargs.pop("seed", None)
+    )
+    return GridSearchConfig(engine=engine, **kwargs)
+
+
+class BuyAndHold(Strategy):
+    """第一根K线买入params["quantity"]股"""
+    
+    def __init__(self, params):
+        self.quantity = int(params["quantity"])
+        self.bought = False
+    
+    def on_bar(self, ctx, portfolio, bars):
+        if self.bought:
+            return None
+        self.bought = True
+        return [Order("SH600000", OrderSide.BUY, self.quantity)]
+
+
+class RandomTrader(Strategy):
+    """每根K线从ctx.rng()抽签决定买入还是卖出，数量不超过params["size"]股"""
+    
+    def __init__(self, params):
+        self.size = int(params["size"])
+    
+    def on_bar(self, ctx, portfolio, bars):
+        rng = ctx.rng()
+        held = portfolio.positions.get("SH600000", 0.0)
+        if held > 0 and rng.random() < 0.5:
+            return [Order("SH600000", OrderSide.SELL, rng.randint(1, int(held)))]
+        return [Order("SH600000", OrderSide.BUY, rng.randint(1, self.size))]
+
+
+class TestParameterGrid:
+    """参数网格测试类"""
+    
+    def test_cartesian_product(self):
+        assert parameter_grid({"fast": [5, 10], "slow": [30, 60]}) == [
+            {"fast": 5.0, "slow": 30.0},
+            {"fast": 5.0, "slow": 60.0},
+            {"fast": 10.0, "slow": 30.0},
+            {"fast": 10.0, "slow": 60.0},
+        ]
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            parameter_grid({})
+        with pytest.raises(ValueError):
+            parameter_grid({"fast": []})
+
+
+class TestGridSearch:
+    """网格搜索测试类"""
+    
+    def test_ranked_by_metric(self, data):
+        result = grid_search(
+            _config(data, metric="total_return", max_workers=2), BuyAndHold, {"quantity": [10, 50, 30]}
+        )
+        
+        assert [run.params["quantity"] for run in result.runs] == [50.0, 30.0, 10.0]
+        assert result.best.params == {"quantity": 50.0}
+        assert result.best.value("total_return") > result.runs[-1].value("total_return")
+        assert result.errors == []
+    
+    def test_lower_is_better_metrics(self, data):
+        result = grid_search(_config(data, metric="max_drawdown"), BuyAndHold, {"quantity": [50, 10]})
+        
+        values = [run.value("max_drawdown") for run in result.runs]
+        assert values == sorted(values)
+    
+    def test_table_and_csv(self, data):
+        result = grid_search(_config(data, metric="total_return"), BuyAndHold, {"quantity": [10, 50]})
+        
+        table = result.table()
+        exported = pd.read_csv(io.StringIO(result.to_csv()), index_col="rank")
+        
+        assert list(table.index) == [1, 2]
+        assert list(table.columns[:2]) == ["quantity", "total_return"]
+        assert table["trades"].tolist() == [1, 1]
+        pd.testing.assert_frame_equal(exported, table, check_dtype=False)
+    
+    def test_same_seed_for_every_run(self, data):
+        """所有组合共用一个随机种子，传回种子可以重现结果"""
+        config = _config(data, cost_model=RandomSlippage(20, 10), metric="total_return")
+        
+        first = grid_search(config, BuyAndHold, {"quantity": [10, 50]})
+        again = grid_search(_config(
+            data, cost_model=RandomSlippage(20, 10), metric="total_return", seed=first.seed
+        ), BuyAndHold, {"quantity": [10, 50]})
+        
+        assert {run.result.seed for run in first.runs} == {first.seed}
+        for run, repeated in zip(first.runs, again.runs):
+            pd.testing.assert_series_equal(run.result.equity_curve, repeated.result.equity_curve)
+    
+    def test_parallel_runs_are_bit_identical(self, data):
+        """相同的种子和数据，无论并发数和线程调度如何，每个组合的成交逐笔相同"""
+        grid = {"size": [1, 2, 3, 4, 5, 6, 7, 8]}
+        
+        def trades(max_workers):
+            result = grid_search(
+                _config(data, cost_model=RandomSlippage(20, 10), seed=11, max_workers=max_workers), RandomTrader, grid
+            )
+            return {run.params["size"]: run.result.trades for run in result.runs}
+        
+        first = trades(4)
+        
+        assert trades(4) == first
+        assert trades(1) == first
+        assert first[1.0] != first[8.0]
+    
+    def test_cancel_lets_running_finish(self, data):
+        ctx = RequestContext()
+        
+        def factory(params):
+            ctx.cancel("enough")
+            return BuyAndHold(params)
+        
+        with pytest.raises(PartialGridSearchError) as error:
+            grid_search(_config(data, max_workers=1), factory, {"quantity": [10, 20, 30]}, ctx=ctx)
+        
+        assert [run.params for run in error.value.result.runs] == [{"quantity": 10.0}]
+        assert error.value.pending == [{"quantity": 20.0}, {"quantity": 30.0}]
+        assert error.value.reason == "enough"
+    
+    def test_failed_combination_is_recorded(self, data):
+        def factory(params):
+            if params["quantity"] == 20:
+                raise RuntimeError("bad parameters")
+            return BuyAndHold(params)
+        
+        result = grid_search(_config(data), factory, {"quantity": [10, 20, 30]})
+        
+        assert len(result.runs) == 2
+        assert [params for params, _ in result.errors] == [{"quantity": 20.0}]
+        assert isinstance(result.errors[0][1], RuntimeError)
+    
+    def test_invalid_options(self, data):
+        with pytest.raises(ValueError):
+            grid_search(_config(data, metric="alpha"), BuyAndHold, {"quantity": [10]})
+        with pytest.raises(ValueError):
+            grid_search(_config(data, max_workers=-1), BuyAndHold, {"quantity": [10]})
@@ -0,0 +1,137 @@
+"""
+Unit tests for missing-value imputation
+缺失值填充单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.feature_frame import FeatureFrame, FeatureResult
+from src.core.imputation import ExcessiveImputationError, ImputeMethod
+from tests.unit._providers import column_frame
+
+NAN = float("nan")
+
+DAYS = ["2025-01-02", "2025-01-03", "2025-01-06", "2025-01-07", "2025-01-08", "2025-01-09"]
+
+
+def _frame(values, days=DAYS, column="$close"):
+    return column_frame(days, column, values)
+
+
+def _values(frame, column="$close"):
+    return [None if np.isnan(v) else v for v in frame[column]]
+
+
+class TestFillFrame:
+    """FeatureFrame.fill_missing测试类"""
+    
+    def test_ffill_with_max_gap(self):
+        frame = _frame([1.0, NAN, 3.0, NAN, NAN, NAN])
+        
+        filled, report = frame.fill_missing("ffill", max_gap=2)
+        
+        # 连续3个缺失值超过max_gap，整段保留为NaN
+        assert _values(filled) == [1.0, 1.0, 3.0, None, None, None]
+        assert report.method == ImputeMethod.FORWARD_FILL
+        assert (report.filled, report.remaining) == ({"$close": 1}, {"$close": 3})
+        assert report.fraction("$close") == pytest.approx(1 / 6)
+        # 默认返回新数据
+        assert np.isnan(frame["$close"].iloc[1])
+    
+    def test_bfill_and_constant(self):
+        frame = _frame([NAN, 2.0, NAN, 4.0, NAN, NAN])
+        
+        assert _values(frame.fill_missing("bfill")[0]) == [2.0, 2.0, 4.0, 4.0, None, None]
+        filled, report = frame.fill_missing("constant", value=0.0)
+        assert _values(filled) == [0.0, 2.0, 0.0, 4.0, 0.0, 0.0]
+        assert report.total == 4
+        with pytest.raises(ValueError):
+            frame.fill_missing("constant")
+    
+    def test_inplace(self):
+        frame = _frame([1.0, NAN, 3.0, 4.0, 5.0, 6.0])
+        frame.attrs["instrument"] = "SH600000"
+        
+        filled, report = frame.fill_missing("ffill", inplace=True)
+        
+        assert filled is frame
+        assert _values(frame)[1] == 1.0
+        assert report.filled == {"$close": 1}
+    
+    def test_interpolate_within_day(self):
+        times = ["2025-01-02 14:58", "2025-01-02 14:59", "2025-01-02 15:00", "2025-01-03 09:31", "2025-01-03 09:32"]
+        frame = _frame([10.0, NAN, 11.0, NAN, 12.0], days=times)
+        
+        filled, report = frame.fill_missing("interpolate")
+        
+        # 当日第一根K线之前没有数据，不跨隔夜插值
+        assert _values(filled) == [10.0, 10.5, 11.0, None, 12.0]
+        assert report.filled == {"$close": 1}
+        with pytest.raises(ValueError):
+            _frame([1.0, NAN, 3.0, 4.0, 5.0, 6.0]).fill_missing("interpolate")
+    
+    def test_reject_excessive_imputation(self):
+        frame = _frame([1.0, NAN, NAN, 4.0, NAN, 6.0])
+        frame.attrs["instrument"] = "SH600000"
+        
+        _, report = frame.fill_missing("ffill")
+        
+        assert report.exceeds(0.4) == ["$close"] and report.exceeds(0.5) == []
+        with pytest.raises(ExcessiveImputationError) as info:
+            frame.fill_missing("ffill", max_fraction=0.4)
+        assert info.value.report.filled == {"$close": 3}
+    
+    def test_invalid(self):
+        frame = _frame([1.0, NAN, 3.0, 4.0, 5.0, 6.0])
+        with pytest.raises(ValueError):
+            frame.fill_missing("mean")
+        with pytest.raises(ValueError):
+            frame.fill_missing("ffill", max_gap=0)
+        with pytest.raises(ValueError):
+            frame.fill_missing("cs_median")
+        with pytest.raises(ValueError):
+            frame.fill_missing("ffill", columns=["$open"])
+
+
+class TestFillResult:
+    """FeatureResult.fill_missing测试类"""
+    
+    @pytest.fixture
+    def result(self):
+        return FeatureResult({
+            "A": _frame([1.0, NAN, 3.0, 4.0, 5.0, NAN]),
+            "B": _frame([2.0, 20.0, NAN, NAN, NAN, NAN]),
+            "C": _frame([3.0, 30.0, 9.0, 10.0, 11.0, NAN]),
+        })
+    
+    def test_cross_sectional_median(self, result):
+        filled, reports = result.fill_missing("cs_median")
+        
+        assert _values(filled["A"]) == [1.0, 25.0, 3.0, 4.0, 5.0, None]
+        assert _values(filled["B"]) == [2.0, 20.0, 6.0, 7.0, 8.0, None]
+        assert reports["B"].filled == {"$close": 3}
+        assert reports["A"].remaining == {"$close": 1}
+    
+    def test_median_ignores_later_dates(self, result):
+        before = result.fill_missing("cs_median")[0]["B"]["$close"].iloc[2]
+        result["C"].loc[pd.Timestamp("2025-01-09"), "$close"] = 1000.0
+        
+        after = result.fill_missing("cs_median")[0]["B"]["$close"].iloc[2]
+        
+        assert before == after == 6.0
+    
+    def test_rejected_instruments_become_errors(self, result):
+        filled, reports = result.fill_missing("cs_median", max_fraction=0.4)
+        
+        assert filled.instruments == ["A", "C"]
+        assert isinstance(filled.errors["B"], ExcessiveImputationError)
+        assert set(reports) == {"A", "B", "C"}
+    
+    def test_per_instrument_methods(self, result):
+        filled, reports = result.fill_missing("ffill", max_gap=1)
+        
+        assert _values(filled["A"]) == [1.0, 1.0, 3.0, 4.0, 5.0, 5.0]
+        assert _values(filled["B"]) == [2.0, 20.0, None, None, None, None]
+        assert isinstance(filled["A"], FeatureFrame)
@@ -0,0 +1,305 @@
+"""
+Unit tests for technical indicators
+技术指标单元测试
+"""
+
+import functools
+import math
+
+import numpy as np
+import pytest
+import pandas as pd
+
+from src.core import indicators
+from src.core.feature_frame import FeatureFrame
+
+
+PRICES = [44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42,
+          45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28, 46.00]
+
+
+# 与PRICES对应的最高价和最低价
+HIGHS = [p + 0.4 + 0.05 * (i % 3) for i, p in enumerate(PRICES)]
+LOWS = [p - 0.3 - 0.05 * (i % 4) for i, p in enumerate(PRICES)]
+
+
+def _nan_count(values):
+    return sum(1 for v in values if math.isnan(v))
+
+
+def _reference_wma(values, window):
+    """逐窗口按定义计算的WMA"""
+    out = [math.nan] * len(values)
+    for i in range(window - 1, len(values)):
+        chunk = values[i - window + 1:i + 1]
+        out[i] = sum((j + 1) * v for j, v in enumerate(chunk)) / (window * (window + 1) / 2)
+    return out
+
+
+def _reference_atr(highs, lows, closes, window):
+    """按Wilder原始定义逐步计算的ATR"""
+    ranges = [
+        max(highs[i] - lows[i], abs(highs[i] - closes[i - 1]), abs(lows[i] - closes[i - 1]))
+        for i in range(1, len(closes))
+    ]
+    out = [math.nan] * len(closes)
+    value = sum(ranges[:window]) / window
+    out[window] = value
+    for i in range(window, len(ranges)):
+        value = (value * (window - 1) + ranges[i]) / window
+        out[i + 1] = value
+    return out
+
+
+def _reference_kdj(highs, lows, closes, window, m1, m2):
+    """通达信公式SMA(RSV,m1,1)、SMA(K,m2,1)的逐步计算"""
+    k = d = 50.0
+    ks, ds = [math.nan] * len(closes), [math.nan] * len(closes)
+    for i in range(window - 1, len(closes)):
+        hhv = max(highs[i - window + 1:i + 1])
+        llv = min(lows[i - window + 1:i + 1])
+        rsv = (closes[i] - llv) / (hhv - llv) * 100
+        k = (rsv + (m1 - 1) * k) / m1
+        d = (k + (m2 - 1) * d) / m2
+        ks[i], ds[i] = k, d
+    return ks, ds
+
+
+class TestMovingAverages:
+    """SMA/EMA测试类"""
+    
+    def test_sma_lead_in_and_values(self):
+        result = indicators.sma([1.0, 2.0, 3.0, 4.0, 5.0], 3)
+        
+        assert _nan_count(result[:2]) == 2
+        assert result[2:] == pytest.approx([2.0, 3.0, 4.0])
+    
+    def test_ema_matches_pandas_after_seed(self):
+        """以简单平均为初值后与pandas的递推结果一致"""
+        result = indicators.ema(PRICES, 5)
+        
+        seed = float(np.mean(PRICES[:5]))
+        expected = pd.Series([seed] + PRICES[5:]).ewm(span=5, adjust=False).mean()
+        assert _nan_count(result) == 4
+        assert result[4:] == pytest.approx(list(expected))
+    
+    def test_ema_is_stable_for_long_series(self):
+        """长序列上常数输入的EMA保持不变，随机游走不会发散"""
+        constant = indicators.ema([3.0] * 200_000, 50)
+        assert constant[-1] == pytest.approx(3.0, abs=1e-12)
+        
+        rng = np.random.default_rng(0)
+        walk = 100.0 + np.cumsum(rng.normal(0, 1, 200_000))
+        result = indicators.ema(walk, 30)
+        assert np.isfinite(result[-1])
+        assert abs(result[-1] - walk[-30:].mean()) < 20
+    
+    @pytest.mark.parametrize("func", [indicators.sma, indicators.ema, indicators.rsi])
+    def test_window_larger_than_series_is_all_nan(self, func):
+        result = func([1.0, 2.0, 3.0], 5)
+        
+        assert len(result) == 3
+        assert _nan_count(result) == 3
+    
+    @pytest.mark.parametrize("func", [indicators.sma, indicators.ema, indicators.rsi, indicators.bollinger])
+    def test_zero_window_is_error(self, func):
+        with pytest.raises(ValueError):
+            func(PRICES, 0)
+    
+    def test_nan_input(self):
+        """SMA中包含NaN的窗口为NaN，EMA跳过NaN"""
+        values = [1.0, 2.0, float("nan"), 4.0, 5.0, 6.0]
+        
+        assert _nan_count(indicators.sma(values, 2)) == 3
+        ema = indicators.ema(values, 2)
+        assert not math.isnan(ema[1]) and math.isnan(ema[2]) and not math.isnan(ema[-1])
+
+
+class TestRSI:
+    """RSI测试类"""
+    
+    def test_known_value(self):
+        """经典示例数据的14日RSI约为70.53"""
+        result = indicators.rsi(PRICES, 14)
+        
+        assert _nan_count(result) == 14
+        assert result[14] == pytest.approx(70.53, abs=0.01)
+    
+    def test_bounds(self):
+        assert indicators.rsi([1.0, 2.0, 3.0, 4.0], 2)[-1] == 100.0
+        assert indicators.rsi([4.0, 3.0, 2.0, 1.0], 2)[-1] == 0.0
+        assert indicators.rsi([1.0, 1.0, 1.0], 2)[-1] == 50.0
+
+
+class TestMACDAndBollinger:
+    """MACD/布林带测试类"""
+    
+    def test_macd_lead_in(self):
+        values = list(np.linspace(10.0, 20.0, 60))
+        result = indicators.macd(values, fast=12, slow=26, signal=9)
+        
+        assert len(result.macd) == len(result.signal) == len(result.histogram) == 60
+        assert _nan_count(result.macd) == 25
+        assert _nan_count(result.signal) == 33
+        assert result.histogram[-1] == pytest.approx(result.macd[-1] - result.signal[-1])
+        # 持续上涨时快线在慢线之上
+        assert result.macd[-1] > 0
+    
+    def test_macd_invalid_windows(self):
+        with pytest.raises(ValueError):
+            indicators.macd(PRICES, fast=26, slow=12)
+    
+    def test_bollinger(self):
+        bands = indicators.bollinger([1.0, 2.0, 3.0, 4.0], window=2, k=2.0)
+        
+        assert _nan_count(bands.middle) == 1
+        assert bands.middle[1:] == pytest.approx([1.5, 2.5, 3.5])
+        assert bands.upper[1] == pytest.approx(2.5)
+        assert bands.lower[1] == pytest.approx(0.5)
+    
+    def test_bollinger_matches_reference(self):
+        bands = indicators.bollinger(PRICES, window=5, k=2.0)
+        
+        window = PRICES[-5:]
+        mean = sum(window) / 5
+        std = math.sqrt(sum((v - mean) ** 2 for v in window) / 5)
+        assert bands.upper[-1] == pytest.approx(mean + 2 * std)
+        assert bands.lower[-1] == pytest.approx(mean - 2 * std)
+    
+    def test_accepts_column_output(self):
+        """可以直接使用FeatureFrame.column()的数值输出"""
+        index = pd.bdate_range("2025-01-01", periods=len(PRICES))
+        frame = FeatureFrame({"$close": PRICES}, index=index)
+        values, times = frame.column("$close")
+        
+        result = indicators.sma(values, 3)
+        
+        assert len(result) == len(times)
+
+
+class TestWMA:
+    """WMA测试类"""
+    
+    def test_matches_reference(self):
+        result = indicators.wma(PRICES, 4)
+        
+        assert _nan_count(result) == 3
+        assert result[3:] == pytest.approx(_reference_wma(PRICES, 4)[3:])
+        # 权重为1, 2, 3
+        assert indicators.wma([1.0, 2.0, 6.0], 3)[-1] == pytest.approx((1 + 4 + 18) / 6)
+    
+    def test_nan_window(self):
+        result = indicators.wma([1.0, float("nan"), 3.0, 4.0], 2)
+        
+        assert _nan_count(result) == 3 and result[-1] == pytest.approx((3 + 8) / 3)
+
+
+class TestATR:
+    """ATR测试类"""
+    
+    def test_matches_reference(self):
+        result = indicators.atr(HIGHS, LOWS, PRICES, 5)
+        
+        expected = _reference_atr(HIGHS, LOWS, PRICES, 5)
+        assert _nan_count(result) == 5
+        assert result[5:] == pytest.approx(expected[5:])
+    
+    def test_gap_uses_prior_close(self):
+        """跳空时真实波幅以前收盘价计算"""
+        result = indicators.atr([10.0, 12.0, 12.5], [9.0, 11.5, 12.0], [9.5, 12.0, 12.2], 1)
+        
+        assert math.isnan(result[0])
+        assert result[1:] == pytest.approx([12.0 - 9.5, 0.5])
+    
+    def test_invalid_input(self):
+        with pytest.raises(ValueError):
+            indicators.atr(HIGHS, LOWS[:-1], PRICES, 5)
+        with pytest.raises(ValueError):
+            indicators.atr(HIGHS, LOWS, PRICES, 0)
+
+
+class TestKDJ:
+    """KDJ测试类"""
+    
+    def test_matches_reference(self):
+        result = indicators.kdj(HIGHS, LOWS, PRICES, 9, 3, 3)
+        
+        ks, ds = _reference_kdj(HIGHS, LOWS, PRICES, 9, 3, 3)
+        assert _nan_count(result.k) == 8
+        assert result.k[8:] == pytest.approx(ks[8:])
+        assert result.d[8:] == pytest.approx(ds[8:])
+        assert result.j[-1] == pytest.approx(3 * ks[-1] - 2 * ds[-1])
+    
+    def test_flat_range_keeps_state(self):
+        """窗口内最高等于最低时K、D保持上一期的值"""
+        result = indicators.kdj([2.0, 3.0, 3.0, 3.0], [1.0, 3.0, 3.0, 3.0], [1.5, 3.0, 3.0, 3.0], 2, 3, 3)
+        
+        # 第二根K线RSV为100
+        k = (100.0 + 2 * 50.0) / 3
+        assert result.k[1] == pytest.approx(k)
+        assert result.k[2] == result.k[3] == pytest.approx(k)
+
+
+def _fail_on_short(values):
+    """短于5个值的序列抛出错误"""
+    if len(values) < 5:
+        raise ValueError("too short")
+    return indicators.sma(values, 5)
+
+
+class TestApply:
+    """apply测试类"""
+    
+    def _frames(self, count):
+        rng = np.random.default_rng(0)
+        index = pd.bdate_range("2025-01-01", periods=60, name="datetime")
+        return {
+            f"SH{600000 + i}": FeatureFrame({"$close": 100.0 + np.cumsum(rng.normal(0, 1, len(index)))}, index=index)
+            for i in range(count)
+        }
+    
+    @pytest.mark.parametrize("processes", [False, True])
+    def test_matches_sequential(self, processes):
+        frames = self._frames(40)
+        fn = functools.partial(indicators.macd, fast=5, slow=10, signal=3)
+        
+        result = indicators.apply(frames, fn, max_workers=4, processes=processes)
+        
+        assert list(result) == list(frames)
+        for code, frame in frames.items():
+            np.testing.assert_allclose(result[code], fn(frame["$close"]))
+    
+    def test_error_does_not_affect_others(self):
+        frames = {"SH600000": [1.0, 2.0, 3.0, 4.0, 5.0, 6.0], "SH600001": [1.0, 2.0], "SH600002": [5.0] * 5}
+        
+        with pytest.raises(indicators.IndicatorApplyError) as error:
+            indicators.apply(frames, _fail_on_short, max_workers=3)
+        
+        assert list(error.value.errors) == ["SH600001"]
+        assert list(error.value.of(ValueError)) == ["SH600001"]
+        assert list(error.value.results) == ["SH600000", "SH600002"]
+        assert error.value.results["SH600000"][-1] == pytest.approx(4.0)
+    
+    def test_missing_field_is_reported(self):
+        frames = self._frames(2)
+        frames["SH999999"] = pd.DataFrame({"$open": [1.0, 2.0]})
+        
+        with pytest.raises(indicators.IndicatorApplyError) as error:
+            indicators.apply(frames, functools.partial(indicators.sma, window=5))
+        
+        assert list(error.value.errors) == ["SH999999"]
+        assert len(error.value.results) == 2
+    
+    def test_values_are_read_only(self):
+        frame = pd.DataFrame({"$close": [1.0, 2.0, 3.0]})
+        
+        def write(values):
+            values[0] = 0.0
+        
+        with pytest.raises(indicators.IndicatorApplyError):
+            indicators.apply({"SH600000": frame}, write)
+        assert frame["$close"].tolist() == [1.0, 2.0, 3.0]
+    
+    def test_invalid_workers(self):
+        with pytest.raises(ValueError):
+            indicators.apply({}, indicators.sma, max_workers=-1)
@@ -0,0 +1,93 @@
+"""
+Unit tests for instrument code normalization
+标的代码规范化单元测试
+"""
+
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.instrument import InstrumentCodeError, normalize_instrument, split_instrument
+from src.infrastructure.csv_provider import CSVDataProvider
+
+
+CSV_CONTENT = """date,open,close
+2025-01-02,10.0,10.2
+2025-01-03,10.2,10.6
+"""
+
+
+class TestNormalizeInstrument:
+    """normalize_instrument测试类"""
+    
+    @pytest.mark.parametrize("code, expected", [
+        ("SH000300", "SH000300"),
+        ("sh000300", "SH000300"),
+        ("000300.SH", "SH000300"),
+        ("000300.sh", "SH000300"),
+        ("sh.000300", "SH000300"),
+        ("SH.000300", "SH000300"),
+        ("sh:000300", "SH000300"),
+        ("000300.SS", "SH000300"),
+        ("600000.XSHG", "SH600000"),
+        ("  SZ000001 ", "SZ000001"),
+        ("000001.SZ", "SZ000001"),
+        ("000001.XSHE", "SZ000001"),
+        ("sz.399001", "SZ399001"),
+        ("430047.BJ", "BJ430047"),
+        ("bj430047", "BJ430047"),
+        ("00700.HK", "HK00700"),
+        ("0700.HK", "HK00700"),
+        ("hk.00700", "HK00700"),
+        ("if2503.cfe", "IF2503.CFE"),
+        ("IF.CFE", "IF.CFE"),
+        ("aapl", "AAPL"),
+        ("HKDCNY", "HKDCNY"),
+    ])
+    def test_aliases(self, code, expected):
+        assert normalize_instrument(code) == expected
+    
+    @pytest.mark.parametrize("code, reason", [
+        ("", "empty code"),
+        ("600000", "expected an exchange prefix or suffix"),
+        ("BAD001", "expected an exchange prefix or suffix"),
+        ("XX600000", "unknown exchange prefix 'XX'"),
+        ("600000.NYSE", "unknown exchange suffix 'NYSE'"),
+        ("SH60000", "SH symbols have 6 digits"),
+        ("6000001.SH", "SH symbols have 6 digits"),
+        ("SH-600000", "expected an exchange prefix or suffix"),
+    ])
+    def test_unknown_formats(self, code, reason):
+        with pytest.raises(InstrumentCodeError) as error:
+            normalize_instrument(code)
+        
+        assert error.value.code == code
+        assert error.value.reason.startswith(reason)
+    
+    def test_split(self):
+        assert split_instrument("600000.SH") == ("SH", "600000")
+        assert split_instrument("hk.700") == ("HK", "00700")
+        assert split_instrument("IF2503.CFE") == ("CFE", "IF2503")
+        assert split_instrument("AAPL") == ("", "AAPL")
+        with pytest.raises(InstrumentCodeError):
+            split_instrument("600000")
+
+
+class TestGetFeaturesAliases:
+    """get_features接受代码别名"""
+    
+    @pytest.fixture
+    def manager(self, tmp_path):
+        (tmp_path / "SH600000.csv").write_text(CSV_CONTENT)
+        return DataManager(enable_cache=False, provider=CSVDataProvider(str(tmp_path)))
+    
+    def test_aliases_resolve_to_one_instrument(self, manager):
+        result = manager.get_features(["600000.SH", "sh.600000", "SH600000"], ["$close"])
+        
+        assert list(result) == ["SH600000"]
+        assert result["SH600000"]["$close"].tolist() == [10.2, 10.6]
+    
+    def test_unknown_format_is_reported(self, manager):
+        result = manager.get_features(["sh600000", "600000"], ["$close"])
+        
+        assert list(result) == ["SH600000"]
+        assert isinstance(result.errors["600000"], InstrumentCodeError)
@@ -0,0 +1,207 @@
+"""
+Unit tests for lazily loaded feature frames
+延迟加载特征数据单元测试
+"""
+
+import threading
+import time
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.expression_engine import register_function
+from src.core.feature_frame import FeatureFrame
+from src.core.lazy_frame import LazyFeatureFrame
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import FieldNotFoundError, InstrumentNotFoundError
+
+
+CSV_CONTENT = """date,open,close,volume
+2025-01-02,10.0,10.2,1000
+2025-01-03,10.2,10.6,1200
+2025-01-06,10.6,10.4,900
+2025-01-07,10.4,10.8,1100
+"""
+
+
+class FieldRecordingProvider(CSVDataProvider):
+    """记录每次读取的字段 / Records the fields of every read"""
+    
+    def __init__(self, data_dir):
+        super().__init__(data_dir)
+        self.reads = []
+    
+    def load_features_ctx(self, ctx, instrument, fields, start_time=None, end_time=None, freq="day"):
+        self.reads.append((instrument, list(fields)))
+        return super().load_features_ctx(ctx, instrument, fields, start_time, end_time, freq)
+
+
+@pytest.fixture
+def provider(tmp_path):
+    for code in ("SH600000", "SZ000001"):
+        (tmp_path / f"{code}.csv").write_text(CSV_CONTENT)
+    return FieldRecordingProvider(str(tmp_path))
+
+
+@pytest.fixture
+def manager(provider):
+    return DataManager(enable_cache=False, provider=provider)
+
+
+class TestLazyFeatures:
+    """get_features(lazy=True)测试类"""
+    
+    def test_nothing_loaded_up_front(self, manager, provider):
+        result = manager.get_features(["SH600000", "SZ000001"], ["$open", "$close"], lazy=True)
+        
+        assert list(result) == ["SH600000", "SZ000001"]
+        assert isinstance(result["SH600000"], LazyFeatureFrame)
+        assert result["SH600000"].loaded == []
+        assert provider.reads == []
+    
+    def test_field_loaded_on_first_access(self, manager, provider):
+        frame = manager.get_features("SH600000", ["$open", "$close", "$volume"], lazy=True)["SH600000"]
+        
+        values, index = frame.column_array("$close")
+        frame.column("$close")
+        
+        assert values.tolist() == [10.2, 10.6, 10.4, 10.8]
+        assert values.dtype == np.float64 and values.flags.c_contiguous
+        assert not values.flags.writeable
+        assert list(index) == list(pd.to_datetime(["2025-01-02", "2025-01-03", "2025-01-06", "2025-01-07"]))
+        assert frame.loaded == ["$close"]
+        assert provider.reads == [("SH600000", ["$close"])]
+    
+    def test_expression_loads_its_raw_fields(self, manager, provider):
+        frame = manager.get_features("SH600000", ["$open", "$close/Ref($close,1)-1"], lazy=True)["SH600000"]
+        
+        returns = frame["$close/Ref($close,1)-1"]
+        
+        assert returns.iloc[1] == pytest.approx(10.6 / 10.2 - 1)
+        assert provider.reads == [("SH600000", ["$close"])]
+    
+    def test_load_matches_eager_result(self, manager):
+        fields = ["$open", "$close", "$volume"]
+        eager = manager.get_features("SH600000", fields, "2025-01-03", "2025-01-06")["SH600000"]
+        
+        frame = manager.get_features("SH600000", fields, "2025-01-03", "2025-01-06", lazy=True)["SH600000"].load()
+        
+        assert isinstance(frame, FeatureFrame)
+        pd.testing.assert_frame_equal(frame, eager, check_dtype=False, check_freq=False)
+    
+    def test_slice_shares_memory(self, manager, provider):
+        frame = manager.get_features("SH600000", ["$open", "$close"], lazy=True)["SH600000"]
+        
+        window = frame.slice("2025-01-03", "2025-01-06")
+        assert provider.reads == []
+        values, index = window.column_array("$close")
+        
+        assert values.tolist() == [10.6, 10.4]
+        assert np.shares_memory(values, frame.column_array("$close")[0])
+        assert len(window.slice("2025-01-06")) == 1
+        assert len(provider.reads) == 1
+    
+    def test_concurrent_access_loads_once(self, tmp_path):
+        (tmp_path / "SH600000.csv").write_text(CSV_CONTENT)
+        
+        class SlowProvider(FieldRecordingProvider):
+            def load_features_ctx(self, *args, **kwargs):
+                time.sleep(0.05)
+                return super().load_features_ctx(*args, **kwargs)
+        
+        provider = SlowProvider(str(tmp_path))
+        manager = DataManager(enable_cache=False, provider=provider)
+        frame = manager.get_features("SH600000", ["$open", "$close"], lazy=True)["SH600000"]
+        results = []
+        
+        def read(name):
+            results.append(frame.column_array(name)[0])
+        
+        threads = [threading.Thread(target=read, args=(name,)) for name in ["$close", "$open"] * 4]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+        
+        assert sorted(fields for _, fields in provider.reads) == [["$close"], ["$open"]]
+        assert len(results) == 8
+    
+    def test_errors_raised_on_access(self, manager):
+        result = manager.get_features(["SH600000", "SH999999"], ["$close", "$vwap"], lazy=True)
+        
+        with pytest.raises(InstrumentNotFoundError):
+            result["SH999999"].column_array("$close")
+        with pytest.raises(FieldNotFoundError):
+            result["SH600000"].column_array("$vwap")
+        with pytest.raises(FieldNotFoundError):
+            result["SH600000"].column_array("$high")
+    
+    def test_unsupported_options(self, manager):
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], align=True, lazy=True)
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], strict=True, lazy=True)
+        with pytest.raises(ValueError):
+            manager.get_features(["SH600000", "SZ000001"], ["CSRank($close)"], lazy=True)
+
+
+class TestDeferredExpressions:
+    """get_features(defer_expressions=True)测试类"""
+    
+    @pytest.fixture
+    def calls(self):
+        calls = []
+        
+        def counted(series):
+            calls.append(len(series))
+            return series * 2
+        
+        register_function("Counted", 1, counted)
+        return calls
+    
+    def test_unread_expression_never_evaluated(self, manager, provider, calls):
+        fields = ["$close", "Counted($open)", "Counted($close)"]
+        frame = manager.get_features("SH600000", fields, defer_expressions=True)["SH600000"]
+        
+        # 原始字段已经加载，表达式尚未计算
+        assert isinstance(frame, LazyFeatureFrame)
+        assert frame.loaded == ["$close"]
+        assert len(provider.reads) == 1
+        assert calls == []
+        
+        frame["Counted($close)"]
+        values, _ = frame.column_array("Counted($close)")
+        
+        assert values.tolist() == [20.4, 21.2, 20.8, 21.6]
+        assert calls == [4]
+        assert frame.loaded == ["$close", "Counted($close)"]
+        assert len(provider.reads) == 1
+    
+    def test_matches_eager_result(self, manager, calls):
+        fields = ["$close", "Counted($open)", "$close/Ref($close,1)-1"]
+        eager = manager.get_features("SH600000", fields, "2025-01-03", "2025-01-06")["SH600000"]
+        
+        frame = manager.get_features(
+            "SH600000", fields, "2025-01-03", "2025-01-06", defer_expressions=True
+        )["SH600000"].load()
+        
+        pd.testing.assert_frame_equal(frame, eager, check_dtype=False, check_freq=False)
+    
+    def test_concurrent_access_evaluates_once(self, manager, calls):
+        frame = manager.get_features("SH600000", ["$close", "Counted($open)"], defer_expressions=True)["SH600000"]
+        
+        threads = [threading.Thread(target=frame.column_array, args=("Counted($open)",)) for _ in range(8)]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+        
+        assert calls == [4]
+    
+    def test_unsupported_options(self, manager):
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], align=True, defer_expressions=True)
+        with pytest.raises(ValueError):
+            manager.get_features(["SH600000", "SZ000001"], ["CSRank($close)"], defer_expressions=True)
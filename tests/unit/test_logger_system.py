@@ -4,9 +4,21 @@ Unit tests for LoggerSystem
 import logging
 from pathlib import Path
 
+import pandas as pd
 import pytest
 
-from src.infrastructure.logger_system import LoggerSystem, get_logger, setup_logging
+from src.core.data_manager import DataManager
+from src.infrastructure.data_provider import DataProvider
+from src.infrastructure.logger_system import (
+    LoggerSystem,
+    NullLogger,
+    current_logger,
+    get_logger,
+    log_enabled,
+    set_logger,
+    setup_logging
+)
+from src.infrastructure.memory_cached_provider import with_memory_cache
 
 
 class TestLoggerSystem:
@@ -216,3 +228,127 @@ class TestLoggerSystemErrorHandling:
             content = f.read()
             assert "Test error" in content
             assert "Traceback" in content or "ValueError" in content
+
+
+class RecordingLogger:
+    """Records formatted messages at or above a level"""
+    
+    def __init__(self, level=logging.DEBUG):
+        self.level = level
+        self.records = []
+    
+    def isEnabledFor(self, level):
+        return level >= self.level
+    
+    def _record(self, level, msg, args):
+        assert level >= self.level, f"{logging.getLevelName(level)} called while disabled: {msg}"
+        self.records.append((level, msg % args))
+    
+    def debug(self, msg, *args):
+        self._record(logging.DEBUG, msg, args)
+    
+    def info(self, msg, *args):
+        self._record(logging.INFO, msg, args)
+    
+    def warning(self, msg, *args):
+        self._record(logging.WARNING, msg, args)
+    
+    def error(self, msg, *args):
+        self._record(logging.ERROR, msg, args)
+    
+    def messages(self, level):
+        return [message for record_level, message in self.records if record_level == level]
+
+
+class GappyProvider(DataProvider):
+    """SH600000 has every day, SZ000001 misses one, SZ999999 has nothing"""
+    
+    name = "gappy"
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        index = pd.date_range("2025-01-02", periods=3, freq="D", name="datetime")
+        if instrument == "SZ000001":
+            index = index.delete(1)
+        elif instrument == "SZ999999":
+            return pd.DataFrame(columns=fields)
+        return pd.DataFrame({field: 1.0 for field in fields}, index=index)
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return list(pd.date_range("2025-01-02", periods=3, freq="D"))
+
+
+@pytest.fixture
+def install():
+    """安装日志记录器，测试结束后恢复默认"""
+    def install(logger):
+        set_logger(logger)
+        return logger
+    yield install
+    set_logger(None)
+
+
+def _query(manager):
+    return manager.get_features(
+        ["SH600000", "SZ000001", "SZ999999"], ["$close"],
+        start_time="2025-01-02", end_time="2025-01-04", align=True
+    )
+
+
+class TestPluggableLogger:
+    """可插拔日志记录器测试"""
+    
+    def test_default_is_silent(self):
+        assert isinstance(current_logger(), NullLogger)
+        assert not log_enabled(logging.ERROR)
+    
+    def test_features_query_logs(self, install):
+        """特征查询记录提供者选择、缓存命中、逐标的耗时、对齐填充和跳过的标的"""
+        logger = install(RecordingLogger())
+        manager = DataManager(enable_cache=False, provider=with_memory_cache(provider=GappyProvider()))
+        
+        _query(manager)
+        _query(manager)
+        
+        debug = logger.messages(logging.DEBUG)
+        warnings = logger.messages(logging.WARNING)
+        assert any("使用数据提供者: gappy+memory" in m for m in debug)
+        assert any("内存特征缓存未命中: SH600000" in m for m in debug)
+        assert any("内存特征缓存命中: SH600000" in m for m in debug)
+        assert any(m.startswith("标的 SH600000 获取完成") and "耗时" in m for m in debug)
+        assert any("SZ000001 对齐时补入 1 根缺失K线" in m for m in warnings)
+        assert any(m.startswith("跳过标的 SZ999999") for m in warnings)
+        assert not any("SH600000 对齐" in m for m in warnings)
+    
+    def test_disabled_levels_are_not_called(self, install):
+        """级别未启用时不调用记录器，也不构造参数"""
+        logger = install(RecordingLogger(level=logging.WARNING))
+        manager = DataManager(enable_cache=False, provider=GappyProvider())
+        
+        result = _query(manager)
+        
+        assert set(result) == {"SH600000", "SZ000001"}
+        assert logger.messages(logging.DEBUG) == []
+        assert len(logger.messages(logging.WARNING)) == 2
+    
+    def test_logger_without_level_check(self, install):
+        """没有isEnabledFor()的记录器视为所有级别都启用"""
+        calls = []
+        
+        class Minimal:
+            def debug(self, msg, *args):
+                calls.append(msg % args)
+            info = warning = error = debug
+        
+        install(Minimal())
+        
+        assert log_enabled(logging.DEBUG)
+        _query(DataManager(enable_cache=False, provider=GappyProvider()))
+        assert calls
+    
+    def test_stdlib_logger(self, install, caplog):
+        install(logging.getLogger("features"))
+        
+        with caplog.at_level(logging.WARNING, logger="features"):
+            _query(DataManager(enable_cache=False, provider=GappyProvider()))
+        
+        assert any("SZ999999" in record.getMessage() for record in caplog.records)
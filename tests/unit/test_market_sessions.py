@@ -0,0 +1,142 @@
+"""
+Unit tests for instrument sessions and timezones
+标的交易时段与时区单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.feature_frame import FeatureFrame
+from src.core.market_sessions import instrument_calendar, instrument_market, register_instrument_calendar
+from src.core.trading_calendar import get_calendar, localize_index, localize_time
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.utils.error_handler import DataError
+
+
+NEW_YORK = "America/New_York"
+
+CSV_CONTENT = """date,open,close,volume
+2025-01-02,10.0,10.2,1000
+2025-01-03,10.2,10.6,1200
+"""
+
+
+def _us_minutes(*days):
+    """纽约当地时间的每30分钟K线 / Half-hourly bars in New York wall time"""
+    times = [pd.Timestamp(f"{day} 09:30") + pd.Timedelta(minutes=30 * i) for day in days for i in range(14)]
+    return pd.DatetimeIndex(times, name="datetime")
+
+
+class TestInstrumentCalendar:
+    """标的所在市场的日历测试类"""
+    
+    def test_market_by_code(self):
+        assert instrument_market("SH600000") == "SSE"
+        assert instrument_market("00700.HK") == "HKEX"
+        assert instrument_market("aapl") == "NYSE"
+        # 6位字母的汇率和期货合约使用A股日历
+        assert instrument_market("HKDCNY") == "CN"
+        assert instrument_market("IF2503.CFE") == "CN"
+    
+    def test_session_metadata(self):
+        hk, us = instrument_calendar("HK00700"), instrument_calendar("AAPL")
+        
+        assert hk.timezone == "Asia/Hong_Kong"
+        assert hk.breaks == [(pd.Timedelta("12:00:00"), pd.Timedelta("13:00:00"))]
+        assert us.timezone == NEW_YORK
+        assert us.sessions == [(pd.Timedelta("09:30:00"), pd.Timedelta("16:00:00"))]
+        assert us.breaks == []
+        assert instrument_calendar("SH600000").breaks == [(pd.Timedelta("11:30:00"), pd.Timedelta("13:00:00"))]
+    
+    def test_register(self):
+        register_instrument_calendar("TSTHK", "HKEX")
+        
+        assert instrument_market("tsthk") == "HKEX"
+        with pytest.raises(DataError):
+            register_instrument_calendar("TSTXX", "NO_SUCH_MARKET")
+
+
+class TestDaylightSaving:
+    """夏令时切换测试类"""
+    
+    def test_sessions_follow_daylight_saving(self):
+        utc = get_calendar("NYSE").to_utc(_us_minutes("2025-03-07", "2025-03-10"))
+        
+        # 3月9日开始夏令时，开盘的UTC时刻提前一小时
+        assert utc[0] == pd.Timestamp("2025-03-07 14:30", tz="UTC")
+        assert utc[14] == pd.Timestamp("2025-03-10 13:30", tz="UTC")
+        assert utc.is_unique
+        assert get_calendar("NYSE").session_mask(utc, "30min").all()
+    
+    def test_hourly_bars_across_daylight_saving(self):
+        utc = get_calendar("NYSE").to_utc(_us_minutes("2025-03-07", "2025-03-10"))
+        frame = FeatureFrame({"$close": [float(i) for i in range(len(utc))]}, index=utc)
+        
+        hourly = frame.resample_bars("60min", calendar=get_calendar("NYSE"))
+        
+        # 两天各7根K线，按当地10:30开始对齐
+        assert len(hourly) == 14 and hourly.index.is_unique
+        assert hourly.index[0] == pd.Timestamp("2025-03-07 15:30", tz="UTC")
+        assert hourly.index[7] == pd.Timestamp("2025-03-10 14:30", tz="UTC")
+        assert hourly["$close"].iloc[6] == 13.0
+    
+    def test_repeated_hour_read_in_order(self):
+        index = pd.DatetimeIndex(["2025-11-02 00:30", "2025-11-02 01:30", "2025-11-02 01:30", "2025-11-02 02:30"])
+        
+        utc = localize_index(index, NEW_YORK)
+        
+        assert list(utc.hour) == [4, 5, 6, 7]
+    
+    def test_skipped_hour_raises(self):
+        with pytest.raises(ValueError):
+            localize_index(pd.DatetimeIndex(["2025-03-09 01:30", "2025-03-09 02:30"]), NEW_YORK)
+    
+    def test_ambiguous_time_must_be_resolved(self):
+        with pytest.raises(ValueError):
+            localize_time("2025-11-02 01:30", NEW_YORK)
+        
+        earliest = localize_time("2025-11-02 01:30", NEW_YORK, ambiguous="earliest")
+        latest = localize_time("2025-11-02 01:30", NEW_YORK, ambiguous="latest")
+        
+        assert latest - earliest == pd.Timedelta(hours=1)
+        with pytest.raises(ValueError):
+            localize_time("2025-11-02 01:30", NEW_YORK, ambiguous="first")
+
+
+class TestUtcFeatures:
+    """get_features(utc=True)测试类"""
+    
+    @pytest.fixture
+    def manager(self, tmp_path):
+        for code in ("SH600000", "AAPL"):
+            (tmp_path / f"{code}.csv").write_text(CSV_CONTENT)
+        return DataManager(enable_cache=False, provider=CSVDataProvider(str(tmp_path)))
+    
+    def test_each_market_converted_from_its_timezone(self, manager):
+        result = manager.get_features(["SH600000", "AAPL"], ["$close"], utc=True)
+        
+        sh, us = result["SH600000"], result["AAPL"]
+        assert sh.index[0] == pd.Timestamp("2025-01-01 16:00", tz="UTC")
+        assert us.index[0] == pd.Timestamp("2025-01-02 05:00", tz="UTC")
+        assert (sh.attrs["timezone"], us.attrs["timezone"]) == ("Asia/Shanghai", NEW_YORK)
+        assert us.attrs["display_tz"] == "Asia/Shanghai"
+        # 日线按交易所当地日期划分，而不是UTC零点
+        assert list(sh.resample_bars("day").index) == [pd.Timestamp("2025-01-02"), pd.Timestamp("2025-01-03")]
+    
+    def test_slice_by_local_date(self, manager):
+        us = manager.get_features("AAPL", ["$close"], utc=True, display_tz=NEW_YORK)["AAPL"]
+        
+        assert us.slice("2025-01-03").index.tolist() == [pd.Timestamp("2025-01-03 05:00", tz="UTC")]
+        sliced = us.slice("2025-01-02", "2025-01-02", display_tz="Asia/Shanghai")
+        assert sliced.empty
+        
+        us.attrs.pop("display_tz")
+        with pytest.raises(ValueError):
+            us.slice("2025-01-03")
+    
+    def test_unsupported_options(self, manager):
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], utc=True, lazy=True)
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], utc=True, align=True)
@@ -0,0 +1,128 @@
+"""
+Unit tests for the memory-cached data provider
+内存缓存数据提供者单元测试
+"""
+
+import threading
+
+import pandas as pd
+import pytest
+
+from src.infrastructure.memory_cached_provider import MemoryCachedDataProvider, with_memory_cache
+from tests.unit._providers import CountingProvider
+
+
+@pytest.fixture
+def inner():
+    return CountingProvider(end="2025-03-31")
+
+
+@pytest.fixture
+def provider(inner):
+    return with_memory_cache(2, provider=inner)
+
+
+class TestMemoryCachedDataProvider:
+    """MemoryCachedDataProvider测试类"""
+    
+    def test_repeated_query_served_from_cache(self, provider, inner):
+        """相同查询只访问一次底层提供者"""
+        first = provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        second = provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        
+        assert len(inner.calls) == 1
+        pd.testing.assert_frame_equal(first, second)
+        stats = provider.stats()
+        assert (stats.hits, stats.misses, stats.entries) == (1, 1, 1)
+        assert stats.hit_rate == pytest.approx(0.5)
+    
+    def test_key_is_normalized(self, provider, inner):
+        """字段顺序和时间写法不同的相同查询命中同一条目，列顺序与请求一致"""
+        provider.load_features("SH600000", ["$open", "$close"], "2025-01-01", "2025-01-31")
+        frame = provider.load_features(
+            "SH600000", ["$close", "$open"], pd.Timestamp("2025-01-01"), "2025-01-31 00:00:00"
+        )
+        
+        assert len(inner.calls) == 1
+        assert list(frame.columns) == ["$close", "$open"]
+    
+    def test_different_range_is_a_miss(self, provider, inner):
+        """区间不同时为不同的条目"""
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-02-28")
+        provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31", freq="60min")
+        
+        assert len(inner.calls) == 3
+    
+    def test_returns_defensive_copies(self, provider, inner):
+        """修改返回的数据不影响缓存"""
+        frame = provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        frame.iloc[0, 0] = -1.0
+        frame["extra"] = 1.0
+        
+        cached = provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        cached.iloc[1, 0] = -2.0
+        again = provider.load_features("SH600000", ["$close"], "2025-01-01", "2025-01-31")
+        
+        assert list(again.columns) == ["$close"]
+        assert again.iloc[0, 0] == 0.0
+        assert again.iloc[1, 0] == 1.0
+        assert inner.frame.iloc[0, 0] == 0.0
+    
+    def test_least_recently_used_evicted(self, provider, inner):
+        """超出容量时淘汰最久未使用的条目"""
+        provider.load_features("A", ["$close"])
+        provider.load_features("B", ["$close"])
+        provider.load_features("A", ["$close"])
+        provider.load_features("C", ["$close"])
+        
+        provider.load_features("A", ["$close"])
+        assert len(inner.calls) == 3
+        provider.load_features("B", ["$close"])
+        assert len(inner.calls) == 4
+        assert provider.stats().evictions == 2
+        assert provider.stats().entries == 2
+    
+    def test_clear(self, provider, inner):
+        """清空后重新访问底层提供者，统计保持不变"""
+        provider.load_features("SH600000", ["$close"])
+        
+        assert provider.clear() == 1
+        provider.load_features("SH600000", ["$close"])
+        assert len(inner.calls) == 2
+        assert provider.stats().misses == 2
+    
+    def test_concurrent_use(self, inner):
+        """多线程并发查询时统计一致"""
+        provider = MemoryCachedDataProvider(inner, max_entries=8)
+        errors = []
+        
+        def worker(code):
+            try:
+                for _ in range(50):
+                    frame = provider.load_features(code, ["$close"], "2025-01-01", "2025-01-31")
+                    assert len(frame) == 31
+            except Exception as e:
+                errors.append(e)
+        
+        threads = [threading.Thread(target=worker, args=(f"SH60000{i}",)) for i in range(4)]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+        
+        assert not errors
+        stats = provider.stats()
+        assert stats.hits + stats.misses == 200
+        assert stats.misses == len(inner.calls)
+    
+    def test_invalid_max_entries(self, inner):
+        """max_entries必须为正数"""
+        with pytest.raises(ValueError):
+            MemoryCachedDataProvider(inner, max_entries=0)
+    
+    def test_delegates_metadata(self, provider, inner):
+        """名称、频率和日历来自底层提供者"""
+        assert provider.name == "counting+memory"
+        assert provider.freqs == inner.freqs
+        assert provider.calendar() == inner.calendar()
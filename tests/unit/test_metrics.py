@@ -0,0 +1,501 @@
+"""
+Unit tests for performance metrics
+绩效指标单元测试
+"""
+
+import math
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import EngineConfig, EngineResult, percent_commission, run
+from src.application.baselines import EqualWeight
+from src.core import metrics
+from src.core.feature_frame import FeatureFrame
+from src.core.trading_calendar import TradingCalendar
+
+
+def _returns(values, start="2025-01-02"):
+    return pd.Series(values, index=pd.bdate_range(start, periods=len(values)))
+
+
+class TestPeriodsPerYear:
+    """年化因子测试类"""
+    
+    def test_daily_and_minute(self):
+        assert metrics.periods_per_year("day") == 252
+        assert metrics.periods_per_year("1min") == 252 * 240
+        assert metrics.periods_per_year("5min") == 252 * 48
+        assert metrics.periods_per_year("60min") == 252 * 4
+        assert metrics.periods_per_year(52) == 52
+    
+    def test_unsupported(self):
+        with pytest.raises(ValueError):
+            metrics.periods_per_year("week")
+        with pytest.raises(ValueError):
+            metrics.periods_per_year(0)
+
+
+class TestPriceReturns:
+    """价格收益率测试类"""
+    
+    def test_simple_vs_log(self):
+        prices = _returns([100.0, 110.0, 99.0, 99.0])
+        
+        simple = metrics.price_returns(prices)
+        log = metrics.price_returns(prices, metrics.ReturnKind.LOG)
+        
+        assert simple.tolist() == pytest.approx([0.1, -0.1, 0.0])
+        assert log.tolist() == pytest.approx([math.log(1.1), math.log(0.9), 0.0])
+        assert list(simple.index) == list(prices.index[1:])
+        # 对数收益率可加，简单收益率可乘
+        assert log.sum() == pytest.approx(math.log(99.0 / 100.0))
+        assert (1 + simple).prod() == pytest.approx(0.99)
+        # 小幅变动时两者接近，对数收益率总是不大于简单收益率
+        assert (log <= simple + 1e-12).all()
+    
+    def test_non_positive_prices(self):
+        prices = _returns([10.0, 0.0, 11.0, 12.0])
+        
+        returns = metrics.price_returns(prices, "log")
+        
+        # 涉及0价格的两期为NaN，之后恢复正常
+        assert np.isnan(returns.iloc[0]) and np.isnan(returns.iloc[1])
+        assert returns.iloc[2] == pytest.approx(math.log(12.0 / 11.0))
+        with pytest.raises(ValueError, match="non-positive"):
+            metrics.price_returns(prices, invalid="raise")
+    
+    def test_short_and_invalid_arguments(self):
+        assert metrics.price_returns([10.0]).empty
+        assert metrics.price_returns([]).empty
+        with pytest.raises(ValueError):
+            metrics.price_returns([1.0, 2.0], kind="compound")
+        with pytest.raises(ValueError):
+            metrics.price_returns([1.0, 2.0], invalid="skip")
+
+
+class TestReturnMetrics:
+    """收益和风险指标测试类"""
+    
+    def test_annualized_return_full_year(self):
+        returns = _returns([0.001] * 252)
+        
+        assert metrics.annualized_return(returns) == pytest.approx(1.001 ** 252 - 1)
+    
+    def test_short_series_does_not_divide_by_zero(self):
+        """空序列、单期和常数序列不会除零"""
+        for values in ([], [0.01], [0.01, 0.01]):
+            returns = _returns(values)
+            assert math.isfinite(metrics.annualized_return(returns))
+            assert metrics.sharpe(returns) == 0.0
+            assert metrics.calmar(returns) == 0.0
+        assert metrics.annualized_vol(_returns([0.01])) == 0.0
+        assert metrics.sortino(_returns([0.01, 0.02])) == 0.0
+    
+    def test_nan_gaps_are_skipped(self):
+        with_gaps = _returns([0.01, float("nan"), -0.02, float("nan"), 0.03])
+        without = _returns([0.01, -0.02, 0.03])
+        
+        assert metrics.sharpe(with_gaps) == pytest.approx(metrics.sharpe(without))
+        assert metrics.annualized_vol(with_gaps) == pytest.approx(metrics.annualized_vol(without))
+    
+    def test_sharpe_matches_definition(self):
+        rng = np.random.default_rng(1)
+        values = rng.normal(0.0005, 0.01, 500)
+        rf = 0.02
+        
+        excess = values - rf / 252
+        expected = excess.mean() / excess.std(ddof=1) * math.sqrt(252)
+        assert metrics.sharpe(_returns(values), rf=rf) == pytest.approx(expected)
+    
+    def test_minute_frequency_scales_vol(self):
+        values = _returns([0.001, -0.001] * 50)
+        
+        daily = metrics.annualized_vol(values, "day")
+        minute = metrics.annualized_vol(values, "1min")
+        assert minute == pytest.approx(daily * math.sqrt(240))
+    
+    def test_sortino_ignores_upside(self):
+        values = _returns([0.02, -0.01, 0.03, -0.01])
+        
+        downside = math.sqrt((0.01 ** 2 + 0.01 ** 2) / 4)
+        expected = np.mean([0.02, -0.01, 0.03, -0.01]) / downside * math.sqrt(252)
+        assert metrics.sortino(values) == pytest.approx(expected)
+
+
+class TestDrawdown:
+    """最大回撤测试类"""
+    
+    def test_peak_and_trough_dates(self):
+        returns = _returns([0.10, -0.10, 0.20, -0.50, 0.10])
+        
+        drawdown = metrics.max_drawdown(returns)
+        
+        assert drawdown.magnitude == pytest.approx(0.5)
+        assert drawdown.peak == returns.index[2]
+        assert drawdown.trough == returns.index[3]
+    
+    def test_drawdown_from_initial_value(self):
+        """一开始就下跌时高点为第一期"""
+        drawdown = metrics.max_drawdown(_returns([-0.1, -0.1, 0.05]))
+        
+        assert drawdown.magnitude == pytest.approx(1 - 0.81)
+        assert drawdown.peak == pd.Timestamp("2025-01-02")
+    
+    def test_no_drawdown(self):
+        assert metrics.max_drawdown(_returns([0.01, 0.02])) == (0.0, None, None)
+        assert metrics.max_drawdown(_returns([])) == (0.0, None, None)
+    
+    def test_calmar(self):
+        returns = _returns([0.01, -0.05, 0.02] * 84)
+        
+        expected = metrics.annualized_return(returns) / metrics.max_drawdown(returns).magnitude
+        assert metrics.calmar(returns) == pytest.approx(expected)
+
+
+class TestBenchmarkMetrics:
+    """相对基准指标测试类"""
+    
+    # 手工计算：cov=1.75e-4，基准方差=3.25e-4/3，beta=21/13；
+    # 主动收益为[0.005, 0.01, -0.005, 0.01]，均值0.005，样本标准差sqrt(5e-5)
+    STRATEGY = [0.01, 0.02, -0.01, 0.03]
+    BENCHMARK = [0.005, 0.01, -0.005, 0.02]
+    
+    def test_reference_values(self):
+        assert metrics.beta(self.STRATEGY, self.BENCHMARK) == pytest.approx(21 / 13)
+        # 每期阿尔法 0.0125 - 21/13 * 0.0075 = 0.005/13，每年4期
+        assert metrics.alpha(self.STRATEGY, self.BENCHMARK, freq=4) == pytest.approx(0.02 / 13)
+        assert metrics.information_ratio(self.STRATEGY, self.BENCHMARK, freq=4) == pytest.approx(math.sqrt(2))
+    
+    def test_alpha_with_risk_free(self):
+        # 每期无风险收益0.01：(0.0025 - 21/13 * -0.0025) * 4
+        expected = (0.0025 + 21 / 13 * 0.0025) * 4
+        
+        assert metrics.alpha(self.STRATEGY, self.BENCHMARK, rf=0.04, freq=4) == pytest.approx(expected)
+    
+    def test_benchmark_against_itself(self):
+        returns = _returns(self.BENCHMARK)
+        
+        assert metrics.beta(returns, returns) == pytest.approx(1.0)
+        assert metrics.alpha(returns, returns) == pytest.approx(0.0)
+        # 跟踪误差为0
+        assert math.isnan(metrics.information_ratio(returns, returns))
+    
+    def test_zero_variance_benchmark(self):
+        flat = [0.001] * 4
+        
+        assert math.isnan(metrics.beta(self.STRATEGY, flat))
+        assert math.isnan(metrics.alpha(self.STRATEGY, flat))
+        assert math.isnan(metrics.beta([0.01], [0.02]))
+    
+    def test_nan_periods_dropped_pairwise(self):
+        strategy = self.STRATEGY + [math.nan, 0.05]
+        benchmark = self.BENCHMARK + [0.01, math.nan]
+        
+        assert metrics.beta(strategy, benchmark) == pytest.approx(21 / 13)
+    
+    def test_misaligned_series(self):
+        with pytest.raises(ValueError):
+            metrics.beta(self.STRATEGY, self.BENCHMARK[:3])
+        with pytest.raises(ValueError):
+            metrics.information_ratio(_returns(self.STRATEGY), _returns(self.BENCHMARK, start="2025-02-03"))
+    
+    def test_tracking_error(self):
+        expected = math.sqrt(5e-5) * 2
+        
+        assert metrics.tracking_error(self.STRATEGY, self.BENCHMARK, freq=4) == pytest.approx(expected)
+        assert math.isnan(metrics.tracking_error([0.01], [0.02]))
+
+
+class TestRelative:
+    """相对基准综合指标测试类"""
+    
+    STRATEGY = TestBenchmarkMetrics.STRATEGY
+    BENCHMARK = TestBenchmarkMetrics.BENCHMARK
+    
+    def test_full_period_metrics(self):
+        report = metrics.relative(_returns(self.STRATEGY), _returns(self.BENCHMARK), window=3, freq=4)
+        
+        assert report.periods == 4 and report.dropped == 0
+        assert report.beta == pytest.approx(21 / 13)
+        assert report.alpha == pytest.approx(0.02 / 13)
+        assert report.tracking_error == pytest.approx(math.sqrt(5e-5) * 2)
+        assert report.information_ratio == pytest.approx(math.sqrt(2))
+        # 基准上涨的三期：策略均值0.02，基准均值0.035/3
+        assert report.up_capture == pytest.approx(0.02 / (0.035 / 3))
+        assert report.down_capture == pytest.approx(2.0)
+        assert report.active_returns.tolist() == pytest.approx([0.005, 0.01, -0.005, 0.01])
+        assert report.to_dict()["beta"] == report.beta
+    
+    def test_rolling_beta(self):
+        report = metrics.relative(_returns(self.STRATEGY), _returns(self.BENCHMARK), window=3)
+        
+        rolling = report.rolling_beta
+        assert rolling.isna().tolist() == [True, True, False, False]
+        assert rolling.iloc[-1] == pytest.approx(metrics.beta(self.STRATEGY[1:], self.BENCHMARK[1:]))
+        assert rolling.index.equals(_returns(self.STRATEGY).index)
+    
+    def test_rolling_beta_with_flat_benchmark(self):
+        benchmark = _returns([0.01, 0.01, 0.01, 0.02])
+        
+        report = metrics.relative(_returns(self.STRATEGY), benchmark, window=3)
+        
+        assert math.isnan(report.rolling_beta.iloc[2])
+        assert math.isfinite(report.rolling_beta.iloc[3])
+    
+    def test_aligns_on_common_dates(self):
+        strategy = _returns(self.STRATEGY + [0.5])
+        benchmark = _returns(self.BENCHMARK)
+        
+        report = metrics.relative(strategy, benchmark, window=3, freq=4, max_dropped=0.25)
+        
+        assert report.dropped == 1 and report.periods == 4
+        assert report.beta == pytest.approx(21 / 13)
+    
+    def test_strict_mode_rejects_large_gaps(self):
+        strategy = _returns(self.STRATEGY + [0.5])
+        benchmark = _returns(self.BENCHMARK)
+        
+        # 默认只记录警告
+        assert metrics.relative(strategy, benchmark, window=3).dropped == 1
+        with pytest.raises(ValueError):
+            metrics.relative(strategy, benchmark, window=3, strict=True)
+    
+    def test_equity_input(self):
+        equity = _returns([100.0] + [100.0 * v for v in np.cumprod([1 + r for r in self.STRATEGY])])
+        index = _returns([100.0] + [100.0 * v for v in np.cumprod([1 + r for r in self.BENCHMARK])])
+        
+        report = metrics.relative(equity, index, window=3, freq=4, kind="equity")
+        
+        assert report.periods == 4
+        assert report.beta == pytest.approx(21 / 13)
+    
+    def test_active_drawdown(self):
+        strategy = _returns([0.0, 0.0, 0.0])
+        benchmark = _returns([0.1, 0.0, -0.05])
+        
+        report = metrics.relative(strategy, benchmark, window=2)
+        
+        assert report.active_drawdown.magnitude == pytest.approx(1 - 1 / 1.1)
+        assert report.active_drawdown.trough == strategy.index[0]
+    
+    def test_invalid_arguments(self):
+        returns = _returns(self.STRATEGY)
+        with pytest.raises(ValueError):
+            metrics.relative(returns, returns, window=1)
+        with pytest.raises(ValueError):
+            metrics.relative(returns, returns, kind="prices")
+        with pytest.raises(ValueError):
+            metrics.relative(returns, returns, max_dropped=1.5)
+
+
+class TestTradeMetrics:
+    """交易统计测试类"""
+    
+    def test_win_rate_and_profit_factor(self):
+        pnls = [100.0, -50.0, 30.0, -25.0]
+        
+        assert metrics.win_rate(pnls) == 0.5
+        assert metrics.profit_factor(pnls) == pytest.approx(130.0 / 75.0)
+    
+    def test_objects_with_pnl(self):
+        class Trade:
+            def __init__(self, pnl):
+                self.pnl = pnl
+        
+        assert metrics.win_rate([Trade(1.0), Trade(-1.0), Trade(2.0)]) == pytest.approx(2 / 3)
+    
+    def test_edge_cases(self):
+        assert metrics.win_rate([]) == 0.0
+        assert metrics.profit_factor([]) == 0.0
+        assert metrics.profit_factor([10.0]) == math.inf
+
+
+class TestSummary:
+    """绩效汇总测试类"""
+    
+    def test_summary_from_equity(self):
+        equity = _returns([100.0, 110.0, 99.0, 120.0])
+        
+        result = metrics.summary(equity, kind="equity", trades=[5.0, -1.0])
+        
+        assert result.periods == 3
+        assert result.total_return == pytest.approx(0.2)
+        assert result.max_drawdown.magnitude == pytest.approx(0.1)
+        assert result.max_drawdown.peak == equity.index[1]
+        assert result.win_rate == 0.5
+        assert "Sharpe" in str(result)
+        assert result.to_dict()["max_drawdown_trough"] == equity.index[2]
+    
+    def test_summary_from_equity_matches_equity_curve(self):
+        """权益序列的汇总与EquityCurve使用相同的收益率，首个点不计为一期"""
+        equity = _returns([100.0, 110.0, 99.0, 120.0, 118.0])
+        curve = metrics.EquityCurve(equity)
+        
+        result = metrics.summary(equity, kind="equity")
+        
+        assert result.sharpe == pytest.approx(curve.sharpe())
+        assert result.annualized_vol == pytest.approx(curve.volatility())
+        assert result.max_drawdown == curve.max_drawdown()
+        assert result.annualized_return == pytest.approx(metrics.annualized_return(equity.pct_change().iloc[1:]))
+    
+    def test_summary_from_equity_drawdown_from_start(self):
+        equity = _returns([100.0, 90.0, 95.0])
+        
+        result = metrics.summary(equity, kind="equity")
+        
+        assert result.max_drawdown.magnitude == pytest.approx(0.1)
+        assert result.max_drawdown.peak == equity.index[0]
+        assert result.max_drawdown.trough == equity.index[1]
+    
+    def test_summary_without_trades(self):
+        result = metrics.summary(_returns([0.01, -0.01]))
+        
+        assert result.win_rate is None
+        assert result.profit_factor is None
+    
+    def test_invalid_kind(self):
+        with pytest.raises(ValueError):
+            metrics.summary(_returns([0.01]), kind="prices")
+
+
+def _curve(values, start="2025-01-02"):
+    return metrics.EquityCurve(values, pd.bdate_range(start, periods=len(values)))
+
+
+class TestEquityCurve:
+    """权益曲线测试类，参考值为手工计算"""
+    
+    @pytest.mark.parametrize("values,risk_free,periods,expected", [
+        ([100.0, 110.0, 99.0, 108.9], 0.0, 252, 4.582576),
+        ([100.0, 102.0, 101.0, 104.0], 0.03, 12, 1.817128),
+        ([100.0, 100.0, 100.0], 0.0, 252, 0.0),
+        ([100.0, 110.0], 0.0, 252, 0.0),
+        ([100.0], 0.0, 252, 0.0),
+        ([], 0.0, 252, 0.0),
+    ])
+    def test_sharpe(self, values, risk_free, periods, expected):
+        result = _curve(values).sharpe(risk_free, periods)
+        
+        assert result == pytest.approx(expected, abs=1e-6)
+        assert not math.isnan(result)
+    
+    @pytest.mark.parametrize("values,periods,expected", [
+        ([100.0, 110.0, 99.0, 108.9], 252, 1.833030),
+        ([100.0, 102.0, 101.0, 104.0], 12, 0.071319),
+        ([100.0, 100.0, 100.0], 252, 0.0),
+        ([100.0], 252, 0.0),
+    ])
+    def test_volatility(self, values, periods, expected):
+        assert _curve(values).volatility(periods) == pytest.approx(expected, abs=1e-6)
+    
+    @pytest.mark.parametrize("values,expected,peak,trough", [
+        ([100.0, 120.0, 90.0, 130.0, 117.0], 0.25, 1, 2),
+        ([100.0, 90.0, 80.0, 85.0], 0.20, 0, 2),
+        ([100.0, 101.0, 102.0], 0.0, None, None),
+        ([100.0], 0.0, None, None),
+    ])
+    def test_max_drawdown(self, values, expected, peak, trough):
+        curve = _curve(values)
+        
+        depth, peak_time, trough_time = curve.max_drawdown()
+        
+        assert depth == pytest.approx(expected)
+        index = curve.series.index
+        assert peak_time == (None if peak is None else index[peak])
+        assert trough_time == (None if trough is None else index[trough])
+    
+    @pytest.mark.parametrize("values,timestamps,expected", [
+        ([100.0, 110.0], ["2021-01-01", "2022-01-01 06:00"], 0.10),
+        ([100.0, 115.0, 121.0], ["2021-01-01", "2022-03-01", "2023-01-01 12:00"], 0.10),
+        ([100.0, 80.0], ["2021-01-01", "2022-01-01 06:00"], -0.20),
+        ([100.0], ["2021-01-01"], 0.0),
+        ([100.0, 110.0], ["2021-01-01", "2021-01-01"], 0.0),
+    ])
+    def test_cagr(self, values, timestamps, expected):
+        curve = metrics.EquityCurve(values, timestamps)
+        
+        assert curve.cagr() == pytest.approx(expected)
+    
+    def test_nan_points_dropped(self):
+        curve = _curve([100.0, float("nan"), 110.0, 99.0, 108.9])
+        
+        assert len(curve) == 4
+        assert curve.sharpe() == pytest.approx(4.582576, abs=1e-6)
+    
+    def test_mismatched_lengths(self):
+        with pytest.raises(ValueError):
+            metrics.EquityCurve([100.0, 101.0], ["2025-01-02"])
+    
+    def test_summary_includes_cagr(self):
+        equity = pd.Series([100.0, 110.0], index=pd.DatetimeIndex(["2021-01-01", "2022-01-01 06:00"]))
+        
+        assert metrics.summary(equity, kind="equity").cagr == pytest.approx(0.10)
+        assert metrics.summary(equity.pct_change()).cagr is None
+
+
+class TestAttribution:
+    """按标的的收益和风险归因测试类"""
+    
+    @pytest.fixture
+    def result(self):
+        index = pd.bdate_range("2025-01-02", "2025-04-30")
+        steps = np.arange(len(index))
+        data = {
+            "SH600000": FeatureFrame({"$close": 10.0 + 0.05 * steps + 0.3 * np.sin(steps)}, index=index),
+            "SZ000001": FeatureFrame({"$close": 20.0 - 0.02 * steps + 0.5 * np.cos(steps / 2)}, index=index),
+            "SH601318": FeatureFrame({"$close": 30.0 + 0.0 * steps}, index=index),
+        }
+        data = {code: frame.assign(**{"$open": frame["$close"]}) for code, frame in data.items()}
+        config = EngineConfig(
+            start_time="2025-01-01",
+            end_time="2025-04-30",
+            data=data,
+            initial_cash=1_000_000.0,
+            calendar=TradingCalendar("TEST"),
+            commission=percent_commission(0.001, minimum=5.0)
+        )
+        return run(config, EqualWeight(sorted(data), "monthly", calendar=TradingCalendar("TEST")))
+    
+    def test_contributions_sum_to_total_return(self, result):
+        items = metrics.attribution(result)
+        
+        assert {item.instrument for item in items} == {"SH600000", "SZ000001", "SH601318"}
+        total = result.final_equity / result.initial_cash - 1
+        assert sum(item.return_contribution for item in items) == pytest.approx(total, abs=1e-8)
+        assert sum(item.pnl for item in items) == pytest.approx(result.final_equity - result.initial_cash, abs=1e-4)
+        # 价格不变的标的只承担手续费
+        flat = next(item for item in items if item.instrument == "SH601318")
+        assert flat.pnl < 0
+        # 按收益贡献的绝对值从大到小排列
+        magnitudes = [abs(item.return_contribution) for item in items]
+        assert magnitudes == sorted(magnitudes, reverse=True)
+    
+    def test_volatility_contributions_sum_to_volatility(self, result):
+        items = metrics.attribution(result)
+        
+        returns = result.equity_curve / result.equity_curve.shift(1).fillna(result.initial_cash) - 1
+        expected = metrics.annualized_vol(returns)
+        assert expected > 0
+        assert sum(item.volatility_contribution for item in items) == pytest.approx(expected, rel=1e-6)
+    
+    def test_sliced_result(self, result):
+        sliced = result["2025-03-03", "2025-04-30"]
+        
+        items = metrics.attribution(sliced)
+        
+        total = sliced.final_equity / sliced.initial_cash - 1
+        assert sum(item.return_contribution for item in items) == pytest.approx(total, abs=1e-9)
+    
+    def test_without_positions(self):
+        index = pd.bdate_range("2025-01-02", periods=3)
+        result = EngineResult(
+            equity_curve=pd.Series(1000.0, index=index), trades=[], positions={}, cash=1000.0, initial_cash=1000.0
+        )
+        
+        assert metrics.attribution(result) == []
+        result.instrument_pnl = FeatureFrame({"SH600000": [0.0, 1.0, 2.0]}, index=index)
+        result.initial_cash = 0.0
+        with pytest.raises(ValueError):
+            metrics.attribution(result)
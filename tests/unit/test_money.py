@@ -0,0 +1,71 @@
+"""
+Unit tests for fixed-point money
+定点金额单元测试
+"""
+
+import pickle
+from decimal import Decimal
+
+import pytest
+
+from src.core.money import INT64_MAX, Money, MoneyOverflowError, RoundingMode
+
+
+class TestMoney:
+    """定点金额测试类"""
+    
+    def test_exact_sums(self):
+        assert Money.of(0.1) + Money.of(0.2) == Money.of(0.3)
+        assert Money.total(Money.of(0.01) for _ in range(10000)) == Money.of(100)
+        assert Money.of("12.3456").units == 123456
+        assert Money.of(Decimal("-1.5")) - Money.of(1) == Money.of(-2.5)
+    
+    @pytest.mark.parametrize("mode,expected", [
+        (RoundingMode.HALF_EVEN, ["1.0000", "1.0002", "-1.0000"]),
+        (RoundingMode.HALF_UP, ["1.0001", "1.0002", "-1.0001"]),
+        (RoundingMode.DOWN, ["1.0000", "1.0001", "-1.0000"]),
+        (RoundingMode.UP, ["1.0001", "1.0002", "-1.0001"]),
+    ])
+    def test_rounding(self, mode, expected):
+        assert [str(Money.of(x, mode)) for x in (1.00005, 1.00015, -1.00005)] == expected
+    
+    def test_multiplication(self):
+        assert Money.of(100).times(0.00025) == Money.of("0.025")
+        assert Money(5) * 0.5 == Money(2)
+        assert Money(5).times(0.5, RoundingMode.HALF_UP) == Money(3)
+        assert 3 * Money.of(1.5) == Money.of(4.5)
+    
+    def test_conversions(self):
+        money = Money.of(1234.5)
+        
+        assert float(money) == 1234.5
+        assert str(money) == "1234.5000"
+        assert repr(money) == "Money('1234.5000')"
+        assert -money < Money(0) < abs(-money)
+        assert not Money(0)
+        assert pickle.loads(pickle.dumps(money)) == money
+    
+    def test_overflow(self):
+        biggest = Money(INT64_MAX)
+        
+        with pytest.raises(MoneyOverflowError):
+            biggest + Money(1)
+        with pytest.raises(MoneyOverflowError):
+            -biggest - Money(2)
+        with pytest.raises(MoneyOverflowError):
+            biggest * 2
+        with pytest.raises(MoneyOverflowError):
+            Money.of(1e15)
+        assert isinstance(MoneyOverflowError("x"), OverflowError)
+    
+    @pytest.mark.parametrize("amount", [float("nan"), float("inf"), "ten"])
+    def test_invalid_amount(self, amount):
+        with pytest.raises(ValueError):
+            Money.of(amount)
+    
+    def test_no_implicit_floats(self):
+        with pytest.raises(TypeError):
+            Money.of(1) + 1.0
+        with pytest.raises(TypeError):
+            Money(1.5)
+        assert Money.of(1) != 1.0
@@ -0,0 +1,153 @@
+"""
+模拟盘单元测试 / Paper Trading Unit Tests
+"""
+
+import json
+
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import EngineConfig, Order, OrderSide, Snapshotter, Strategy
+from src.application.paper_trading import PaperTrader, PaperTraderConfig
+from src.infrastructure.subscription import LiveBar, Subscription
+from src.utils.request_context import RequestContext
+
+
+def _t(minute):
+    return pd.Timestamp(f"2025-01-02 09:{minute}")
+
+
+def _feed(bars, codes=("SH600000",)):
+    """投递K线后关闭的订阅 / Subscription closed after the bars are published"""
+    ctx = RequestContext()
+    subscription = Subscription(ctx, list(codes), ["$open", "$close"], "1min")
+    for code, time, open_, close in bars:
+        subscription.publish(LiveBar(code, time, {"$open": open_, "$close": close}))
+    ctx.cancel()
+    return subscription
+
+
+class BuyOnce(Strategy, Snapshotter):
+    """第一次调用时买入quantity股，记录每次调用的时间和K线"""
+    
+    def __init__(self, quantity=100):
+        self.quantity = quantity
+        self.bought = False
+        self.calls = []
+    
+    def on_bar(self, ctx, portfolio, bars):
+        self.calls.append((ctx.time, sorted(bars)))
+        if self.bought:
+            return None
+        self.bought = True
+        return [Order("SH600000", OrderSide.BUY, self.quantity)]
+    
+    def snapshot(self):
+        return {"bought": self.bought}
+    
+    def restore(self, state):
+        self.bought = state["bought"]
+
+
+@pytest.fixture
+def config(tmp_path):
+    return PaperTraderConfig(
+        engine=EngineConfig("", "", instruments=["SH600000"], initial_cash=10000.0),
+        state_path=tmp_path / "paper.pkl",
+        reconciliation_path=tmp_path / "reconciliation.jsonl"
+    )
+
+
+def _clock():
+    return pd.Timestamp("2025-01-02 15:00")
+
+
+class TestPaperTrader:
+    """模拟盘测试类"""
+    
+    def test_fills_on_next_bar(self, config):
+        trader = PaperTrader(config, BuyOnce(), clock=_clock)
+        
+        result = trader.run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t(32), 10.5, 11.0),
+            ("SH600000", _t(33), 11.0, 11.0),
+        ]))
+        
+        assert [(f.time, f.quantity, f.price) for f in result.trades] == [(_t(32), 100, 10.5)]
+        assert result.portfolio.position("SH600000") == 100
+        assert result.equity_curve.index.tolist() == [_t(31), _t(32), _t(33)]
+        assert result.equity_curve.iloc[-1] == pytest.approx(10000.0 - 1050.0 + 1100.0)
+        record = result.reconciliation[0]
+        assert (record.submitted, record.time) == (_t(31), _t(32))
+        assert (record.expected_quantity, record.filled_quantity) == (100, 100)
+        assert record.price_gap == pytest.approx(0.05)
+        assert config.state_path.exists()
+    
+    def test_restart_resumes_from_state(self, config):
+        PaperTrader(config, BuyOnce(), clock=_clock).run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t(32), 10.5, 11.0),
+        ]))
+        
+        strategy = BuyOnce()
+        trader = PaperTrader(config, strategy, clock=_clock)
+        # 重新连接时订阅再次推送已处理的K线
+        result = trader.run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t(32), 10.5, 11.0),
+            ("SH600000", _t(33), 11.0, 12.0),
+        ]))
+        
+        assert strategy.calls == [(_t(33), ["SH600000"])]
+        assert len(result.trades) == 1
+        assert result.portfolio.position("SH600000") == 100
+        assert result.last_time == _t(33)
+        assert len(result.equity_curve) == 3
+    
+    def test_clock_skew(self, config):
+        strategy = BuyOnce()
+        clock = lambda: pd.Timestamp("2025-01-02 09:32")
+        
+        PaperTrader(config, strategy, clock=clock).run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t("32:04"), 10.0, 10.0),
+            ("SH600000", _t(33), 10.0, 10.0),
+        ]))
+        
+        # 比时钟晚4秒的K线在允许范围内，晚1分钟的K线被丢弃
+        assert [time for time, _ in strategy.calls] == [_t(31), _t("32:04")]
+    
+    def test_waits_for_every_instrument(self, config):
+        strategy = BuyOnce()
+        
+        PaperTrader(config, strategy, clock=_clock).run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t(32), 10.0, 10.0),
+            ("SZ000001", _t(32), 20.0, 20.0),
+            ("SZ000001", _t(31), 20.0, 20.0),
+        ], codes=("SH600000", "SZ000001")))
+        
+        # 09:31在收到更晚的K线时处理，之后才到达的09:31的K线被忽略
+        assert strategy.calls == [(_t(31), ["SH600000"]), (_t(32), ["SH600000", "SZ000001"])]
+    
+    def test_rejection_is_reconciled(self, config):
+        result = PaperTrader(config, BuyOnce(quantity=10000), clock=_clock).run(_feed([
+            ("SH600000", _t(31), 10.0, 10.0),
+            ("SH600000", _t(32), 10.0, 10.0),
+        ]))
+        
+        assert result.trades == []
+        record = result.reconciliation[0]
+        assert record.filled_quantity == 0 and record.reason
+        logged = [json.loads(line) for line in config.reconciliation_path.read_text(encoding="utf-8").splitlines()]
+        assert len(logged) == 1
+        assert logged[0]["filled_quantity"] == 0 and logged[0]["fill_price"] is None
+        assert result.reconciliation_frame()["reason"].tolist() == [record.reason]
+    
+    def test_invalid(self, config):
+        ctx = RequestContext()
+        with pytest.raises(ValueError):
+            PaperTrader(config, BuyOnce()).run(Subscription(ctx, ["SH600000"], ["$close"], "1min"))
+        with pytest.raises(ValueError):
+            PaperTrader(PaperTraderConfig(config.engine, config.state_path, max_clock_skew=-1), BuyOnce())
@@ -0,0 +1,305 @@
+"""
+Unit tests for ParquetDataProvider
+Parquet数据提供者单元测试
+"""
+
+import os
+from concurrent.futures import ThreadPoolExecutor
+
+import pytest
+import pandas as pd
+
+pytest.importorskip("pyarrow")
+
+from src.core.feature_frame import FeatureFrame
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import ProviderConfig
+from src.infrastructure.parquet_provider import ParquetDataProvider, read_parquet, write_parquet
+from src.utils.error_handler import DataError
+from src.utils.request_context import RequestContext, ContextCancelledError
+
+
+FIELDS = ["$open", "$high", "$low", "$close", "$volume"]
+
+
+def _make_frame(days=20):
+    index = pd.bdate_range("2025-01-01", periods=days, name="datetime")
+    return pd.DataFrame(
+        {field: [float(i + offset) for i in range(days)] for offset, field in enumerate(FIELDS)},
+        index=index
+    )
+
+
+@pytest.fixture
+def frame():
+    return _make_frame()
+
+
+@pytest.fixture
+def parquet_dir(tmp_path, frame):
+    # 每个行组5行，共4个行组
+    write_parquet(str(tmp_path / "SH600000.parquet"), frame, row_group_size=5)
+    return tmp_path
+
+
+class TestParquetDataProvider:
+    """ParquetDataProvider测试类"""
+    
+    def test_round_trip(self, parquet_dir, frame):
+        """读取结果与写入的数据一致"""
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        loaded = provider.load_features("SH600000", FIELDS)
+        
+        pd.testing.assert_frame_equal(loaded, frame, check_freq=False)
+    
+    def test_only_requested_columns(self, parquet_dir, monkeypatch):
+        """只解码请求的字段列"""
+        import pyarrow.parquet as pq
+        provider = ParquetDataProvider(str(parquet_dir))
+        read_columns = []
+        original = pq.ParquetFile.read_row_group
+        
+        def spy(self, group, columns=None, **kwargs):
+            read_columns.append(list(columns))
+            return original(self, group, columns=columns, **kwargs)
+        
+        monkeypatch.setattr(pq.ParquetFile, "read_row_group", spy)
+        loaded = provider.load_features("SH600000", ["$close"])
+        
+        assert list(loaded.columns) == ["$close"]
+        assert all(columns == ["datetime", "close"] for columns in read_columns)
+    
+    def test_row_groups_outside_window_are_skipped(self, parquet_dir, frame):
+        """查询区间之外的行组不会被读取"""
+        provider = ParquetDataProvider(str(parquet_dir))
+        import pyarrow.parquet as pq
+        parquet_file = pq.ParquetFile(parquet_dir / "SH600000.parquet")
+        
+        # 第二个行组为frame.index[5:10]
+        groups = provider._row_groups_in_range(
+            parquet_file, "datetime", frame.index[6], frame.index[8]
+        )
+        assert groups == [1]
+    
+    @pytest.mark.parametrize("lo, hi", [(4, 5), (5, 9), (9, 10), (0, 19), (10, 10)])
+    def test_pushdown_keeps_boundary_rows(self, parquet_dir, frame, lo, hi):
+        """区间边界落在行组首尾时不会丢行"""
+        provider = ParquetDataProvider(str(parquet_dir))
+        start, end = frame.index[lo], frame.index[hi]
+        
+        loaded = provider.load_features(
+            "SH600000", ["$close"],
+            start_time=start.strftime("%Y-%m-%d"), end_time=end.strftime("%Y-%m-%d")
+        )
+        
+        assert list(loaded.index) == list(frame.index[lo:hi + 1])
+    
+    def test_matches_csv_provider(self, tmp_path, frame):
+        """与CSV提供者返回相同的数据"""
+        csv_frame = frame.rename(columns=lambda c: c.lstrip("$"))
+        csv_frame.index.name = "date"
+        csv_frame.to_csv(tmp_path / "SH600000.csv")
+        write_parquet(str(tmp_path / "SH600000.parquet"), frame, row_group_size=3)
+        
+        kwargs = dict(start_time="2025-01-08", end_time="2025-01-21")
+        expected = CSVDataProvider(str(tmp_path)).load_features("SH600000", FIELDS, **kwargs)
+        loaded = ParquetDataProvider(str(tmp_path)).load_features("SH600000", FIELDS, **kwargs)
+        
+        pd.testing.assert_frame_equal(loaded, expected, check_dtype=False)
+    
+    def test_empty_window(self, parquet_dir):
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        loaded = provider.load_features("SH600000", ["$close"], start_time="2026-01-01")
+        
+        assert loaded.empty
+        assert list(loaded.columns) == ["$close"]
+    
+    def test_missing_field_and_file(self, parquet_dir):
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        with pytest.raises(DataError):
+            provider.load_features("SH600000", ["$vwap"])
+        with pytest.raises(DataError):
+            provider.load_features("SZ000001", ["$close"])
+    
+    def test_misspelled_field_suggestion(self, parquet_dir):
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        with pytest.raises(DataError) as exc_info:
+            provider.load_features("SH600000", ["$Volumn"])
+        
+        assert "did you mean $volume?" in exc_info.value.error_info.error_message_en
+    
+    def test_list_fields_and_instruments(self, parquet_dir, frame):
+        """字段来自schema，标的来自文件名"""
+        write_parquet(str(parquet_dir / "SZ000001.parquet"), frame[["$close"]])
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        assert provider.list_fields("SH600000") == sorted(FIELDS)
+        assert provider.list_fields("SZ000001") == ["$close"]
+        assert provider.list_instruments() == ["SH600000", "SZ000001"]
+        assert provider.list_instruments("SH") == ["SH600000"]
+        with pytest.raises(DataError):
+            provider.list_fields("SZ000002")
+    
+    def test_calendar(self, parquet_dir, frame):
+        provider = ParquetDataProvider(str(parquet_dir))
+        
+        assert provider.calendar(end_time="2025-01-03") == list(frame.index[:3])
+    
+    def test_cancelled_context(self, parquet_dir):
+        provider = ParquetDataProvider(str(parquet_dir))
+        ctx = RequestContext()
+        ctx.cancel()
+        
+        with pytest.raises(ContextCancelledError):
+            provider.load_features_ctx(ctx, "SH600000", ["$close"])
+
+
+def _open_fds():
+    return len(os.listdir("/proc/self/fd"))
+
+
+class TestConcurrentReads:
+    """并发读取时复用打开的文件测试类"""
+    
+    @pytest.fixture
+    def wide_dir(self, tmp_path, frame):
+        for i in range(8):
+            write_parquet(str(tmp_path / f"SH60000{i}.parquet"), frame + i, row_group_size=5)
+        return tmp_path
+    
+    def test_stress_bounded_readers(self, wide_dir, frame):
+        """200个并发读取共享有限的读取器，读取结果正确"""
+        provider = ParquetDataProvider(str(wide_dir), config=ProviderConfig(max_open_readers=4))
+        codes = [f"SH60000{i % 8}" for i in range(200)]
+        peak = []
+        
+        def load(code):
+            loaded = provider.load_features(code, ["$close"], start_time="2025-01-08")
+            peak.append(provider.readers.open_count)
+            return code, loaded
+        
+        with ThreadPoolExecutor(max_workers=32) as executor:
+            results = list(executor.map(load, codes))
+        
+        for code, loaded in results:
+            offset = int(code[-1])
+            expected = (frame[["$close"]] + offset).loc["2025-01-08":]
+            pd.testing.assert_frame_equal(loaded, expected, check_freq=False)
+        assert max(peak) <= 4
+        provider.close()
+        assert provider.readers.open_count == 0
+    
+    @pytest.mark.skipif(not os.path.isdir("/proc/self/fd"), reason="needs /proc to count descriptors")
+    def test_no_descriptor_leak(self, wide_dir):
+        before = _open_fds()
+        provider = ParquetDataProvider(str(wide_dir), config=ProviderConfig(max_open_readers=2))
+        
+        with ThreadPoolExecutor(max_workers=16) as executor:
+            list(executor.map(lambda i: provider.load_features(f"SH60000{i % 8}", ["$close"]), range(200)))
+        assert _open_fds() <= before + 2
+        provider.close()
+        
+        assert _open_fds() <= before
+    
+    def test_rewritten_file_is_reread(self, tmp_path, frame):
+        write_parquet(str(tmp_path / "SH600000.parquet"), frame)
+        provider = ParquetDataProvider(str(tmp_path))
+        provider.load_features("SH600000", ["$close"])
+        
+        write_parquet(str(tmp_path / "SH600000.parquet"), frame.iloc[:3])
+        stat = (tmp_path / "SH600000.parquet").stat()
+        os.utime(tmp_path / "SH600000.parquet", ns=(stat.st_atime_ns, stat.st_mtime_ns + 1_000_000_000))
+        
+        assert len(provider.load_features("SH600000", ["$close"])) == 3
+    
+    def test_invalid_config(self):
+        with pytest.raises(ValueError):
+            ProviderConfig(max_open_readers=0)
+
+
+class TestParquetFiles:
+    """write_parquet/read_parquet测试类"""
+    
+    @pytest.mark.parametrize("compression", ["snappy", "zstd", "none"])
+    def test_round_trip_preserves_types(self, tmp_path, frame, compression):
+        """时间索引、float64列和标的代码在读写后保持不变"""
+        path = str(tmp_path / "data.parquet")
+        write_parquet(path, frame, compression=compression, instrument="SH600000")
+        
+        loaded = read_parquet(path)
+        
+        expected = frame.copy()
+        expected.attrs["instrument"] = "SH600000"
+        pd.testing.assert_frame_equal(loaded, expected, check_freq=False)
+        assert all(dtype == "float64" for dtype in loaded.dtypes)
+        assert loaded.index.dtype == "datetime64[ns]"
+        assert loaded.attrs["instrument"] == "SH600000"
+    
+    def test_compression_is_recorded(self, tmp_path, frame):
+        """压缩算法写入文件的列元数据"""
+        import pyarrow.parquet as pq
+        path = tmp_path / "data.parquet"
+        write_parquet(str(path), frame, compression="zstd")
+        
+        column = pq.ParquetFile(path).metadata.row_group(0).column(1)
+        
+        assert column.compression == "ZSTD"
+    
+    def test_invalid_compression(self, tmp_path, frame):
+        with pytest.raises(ValueError):
+            write_parquet(str(tmp_path / "data.parquet"), frame, compression="lzma")
+    
+    def test_single_field_decodes_one_column(self, tmp_path, frame, monkeypatch):
+        """读取单个字段只解码该列"""
+        import pyarrow.parquet as pq
+        path = str(tmp_path / "data.parquet")
+        write_parquet(path, frame, row_group_size=5)
+        read_columns = []
+        original = pq.ParquetFile.read_row_group
+        
+        def spy(self, group, columns=None, **kwargs):
+            read_columns.append(list(columns))
+            return original(self, group, columns=columns, **kwargs)
+        
+        monkeypatch.setattr(pq.ParquetFile, "read_row_group", spy)
+        loaded = read_parquet(path, ["$close"], start_time="2025-01-08", end_time="2025-01-14")
+        
+        assert list(loaded.columns) == ["$close"]
+        assert len(loaded) == 5
+        assert read_columns and all(columns == ["datetime", "close"] for columns in read_columns)
+    
+    def test_instrument_defaults_to_file_name(self, tmp_path, frame):
+        path = str(tmp_path / "SZ000001.parquet")
+        write_parquet(path, frame)
+        
+        assert read_parquet(path).attrs["instrument"] == "SZ000001"
+    
+    @pytest.mark.parametrize("index_name", ["datetime", None])
+    def test_reads_pandas_files(self, tmp_path, frame, index_name):
+        """读取pandas的to_parquet()写入的文件，包括未命名的时间索引"""
+        path = tmp_path / "pandas.parquet"
+        data = frame.copy()
+        data.index.name = index_name
+        data.to_parquet(path)
+        
+        loaded = read_parquet(str(path), ["$close", "$volume"])
+        
+        assert list(loaded["$close"]) == list(frame["$close"])
+        assert list(loaded.index) == list(frame.index)
+    
+    def test_feature_frame_round_trip(self, tmp_path, frame):
+        """FeatureFrame读写保留标的代码"""
+        path = str(tmp_path / "frame.parquet")
+        source = FeatureFrame(frame)
+        source.attrs["instrument"] = "SH600000"
+        source.write_parquet(path, compression="zstd")
+        
+        loaded = FeatureFrame.read_parquet(path, ["$close"])
+        
+        assert isinstance(loaded, FeatureFrame)
+        assert loaded.attrs["instrument"] == "SH600000"
+        assert list(loaded["$close"]) == list(frame["$close"])
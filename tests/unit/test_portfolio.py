@@ -0,0 +1,543 @@
+"""
+Unit tests for portfolio accounting
+组合核算单元测试
+"""
+
+from dataclasses import dataclass
+import random
+from datetime import datetime
+
+import pytest
+
+from src.core.currency import FXRateUnavailableError
+from src.core.money import Money, RoundingMode
+from src.core.portfolio import (
+    CostBasis,
+    InsufficientCashError,
+    Lot,
+    Portfolio,
+    ShortSellingError
+)
+
+
+@dataclass
+class FakeFill:
+    """与backtest_engine.Fill属性相同的成交 / Fill with the attributes of backtest_engine.Fill"""
+    instrument: str
+    side: str
+    quantity: float
+    price: float
+    commission: float = 0.0
+    time: datetime = None
+
+
+class TestAverageCost:
+    """平均成本测试类"""
+    
+    def test_multiple_buys_update_average_cost(self):
+        """多次买入按数量加权更新平均成本"""
+        portfolio = Portfolio(10000.0)
+        
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.buy("SH600000", 300, 12.0)
+        
+        assert portfolio.position("SH600000") == 400
+        assert portfolio.avg_cost("SH600000") == pytest.approx((100 * 10.0 + 300 * 12.0) / 400)
+        assert portfolio.cash == pytest.approx(10000.0 - 1000.0 - 3600.0)
+    
+    def test_partial_sells_keep_average_cost(self):
+        """分批卖出时平均成本不变，按平均成本结算已实现盈亏"""
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.buy("SH600000", 100, 14.0)
+        
+        first = portfolio.sell("SH600000", 50, 15.0)
+        second = portfolio.sell("SH600000", 50, 11.0)
+        
+        assert first == pytest.approx(50 * 3.0)
+        assert second == pytest.approx(-50 * 1.0)
+        assert portfolio.avg_cost("SH600000") == pytest.approx(12.0)
+        assert portfolio.position("SH600000") == 100
+        assert portfolio.realized_pnl("SH600000") == pytest.approx(100.0)
+    
+    def test_closing_resets_average_cost(self):
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.sell("SH600000", 100, 12.0)
+        
+        assert portfolio.positions == {}
+        assert portfolio.avg_cost("SH600000") == 0.0
+        assert portfolio.realized_pnl() == pytest.approx(200.0)
+        
+        portfolio.buy("SH600000", 10, 20.0)
+        assert portfolio.avg_cost("SH600000") == pytest.approx(20.0)
+
+
+class TestShortSelling:
+    """做空测试类"""
+    
+    def test_sell_crossing_from_long_to_short(self):
+        """从多头直接卖成空头：先平多头，剩余部分以成交价开空"""
+        portfolio = Portfolio(10000.0, allow_short=True)
+        portfolio.buy("SH600000", 100, 10.0)
+        
+        realized = portfolio.sell("SH600000", 150, 12.0)
+        
+        assert realized == pytest.approx(100 * 2.0)
+        assert portfolio.position("SH600000") == -50
+        assert portfolio.avg_cost("SH600000") == pytest.approx(12.0)
+        assert portfolio.cash == pytest.approx(10000.0 - 1000.0 + 1800.0)
+        
+        portfolio.mark_to_market({"SH600000": 11.0})
+        assert portfolio.unrealized_pnl("SH600000") == pytest.approx(50.0)
+        assert portfolio.equity == pytest.approx(portfolio.cash - 50 * 11.0)
+    
+    def test_cover_short(self):
+        portfolio = Portfolio(10000.0, allow_short=True)
+        portfolio.sell("SH600000", 100, 10.0)
+        portfolio.sell("SH600000", 100, 12.0)
+        
+        assert portfolio.avg_cost("SH600000") == pytest.approx(11.0)
+        assert portfolio.buy("SH600000", 150, 9.0) == pytest.approx(150 * 2.0)
+        assert portfolio.position("SH600000") == -50
+        
+        # 回补并反手做多
+        assert portfolio.buy("SH600000", 100, 10.0) == pytest.approx(50 * 1.0)
+        assert portfolio.position("SH600000") == 50
+        assert portfolio.avg_cost("SH600000") == pytest.approx(10.0)
+    
+    def test_shorting_disabled_by_default(self):
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        
+        with pytest.raises(ShortSellingError) as exc_info:
+            portfolio.sell("SH600000", 150, 12.0)
+        
+        assert exc_info.value.error_info.error_code == "BCK0005"
+        assert portfolio.position("SH600000") == 100
+        assert portfolio.cash == pytest.approx(9000.0)
+
+
+class TestCashAndPnL:
+    """现金和盈亏测试类"""
+    
+    def test_insufficient_cash(self):
+        portfolio = Portfolio(1000.0)
+        
+        with pytest.raises(InsufficientCashError):
+            portfolio.buy("SH600000", 100, 10.0, commission=5.0)
+        
+        assert portfolio.cash == 1000.0
+        assert portfolio.positions == {}
+    
+    def test_mark_to_market_and_totals(self):
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0, commission=5.0)
+        portfolio.buy("SZ000001", 200, 20.0, commission=5.0)
+        
+        portfolio.mark_to_market({"SH600000": 11.0, "SZ000001": 19.0, "SH601318": float("nan")})
+        
+        assert portfolio.unrealized_pnl() == pytest.approx(100.0 - 200.0)
+        assert portfolio.commissions == pytest.approx(10.0)
+        assert portfolio.total_pnl == pytest.approx(portfolio.equity - portfolio.initial_cash)
+        assert portfolio.holding("SH600000").market_value == pytest.approx(1100.0)
+        assert portfolio.holding("SH601318") is None
+    
+    def test_pnl_by_instrument(self):
+        """每个标的的盈亏扣除自己的费用、计入自己的分红，合计等于total_pnl"""
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0, commission=5.0)
+        portfolio.buy("SZ000001", 100, 20.0, commission=5.0)
+        portfolio.sell("SZ000001", 100, 21.0, commission=5.0)
+        portfolio.pay_dividend("SH600000", 0.5, tax_rate=0.1)
+        portfolio.mark_to_market({"SH600000": 11.0})
+        
+        pnl = portfolio.pnl_by_instrument()
+        
+        assert pnl == {"SH600000": pytest.approx(100.0 - 5.0 + 45.0), "SZ000001": pytest.approx(100.0 - 10.0)}
+        assert sum(pnl.values()) == pytest.approx(portfolio.total_pnl)
+        assert Portfolio.from_dict(portfolio.to_dict()).pnl_by_instrument() == pnl
+    
+    def test_illiquid_keeps_last_price(self):
+        """停牌的标的不按新价格估值，复牌后恢复"""
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.mark_to_market({"SH600000": 11.0})
+        
+        portfolio.mark_to_market({"SH600000": 5.0, "SZ000001": 20.0}, illiquid=["SH600000", "SZ000001"])
+        
+        assert portfolio.holding("SH600000").market_value == pytest.approx(1100.0)
+        assert portfolio.illiquid == ["SH600000"]
+        assert portfolio.is_illiquid("SZ000001")
+        assert Portfolio.from_dict(portfolio.copy().to_dict()).illiquid == ["SH600000"]
+        
+        portfolio.mark_to_market({"SH600000": 12.0}, illiquid=[])
+        assert portfolio.holding("SH600000").market_value == pytest.approx(1200.0)
+        assert portfolio.illiquid == []
+    
+    def test_copy_is_independent(self):
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        
+        other = portfolio.copy()
+        other.sell("SH600000", 100, 11.0)
+        
+        assert portfolio.position("SH600000") == 100
+        assert other.position("SH600000") == 0
+    
+    @pytest.mark.parametrize("seed", range(20))
+    @pytest.mark.parametrize("basis", list(CostBasis))
+    def test_flat_round_trips_cost_exactly_the_fees(self, seed, basis):
+        """随机买卖最终平仓后，现金正好等于初始现金减去全部费用"""
+        rng = random.Random(seed)
+        prices = {"SH600000": 10.37, "SZ000001": 3.71, "SH601318": 48.09}
+        portfolio = Portfolio(1_000_000.0, cost_basis=basis)
+        fees = []
+        
+        def trade(side, code, quantity):
+            commission = quantity * prices[code] * 0.00025 + rng.choice([0.0, 0.1, 0.2])
+            fees.append(Money.of(commission))
+            getattr(portfolio, side)(code, quantity, prices[code], commission)
+        
+        for _ in range(200):
+            code = rng.choice(sorted(prices))
+            held = portfolio.position(code)
+            if held > 0 and rng.random() < 0.5:
+                trade("sell", code, rng.randint(1, int(held)))
+            else:
+                trade("buy", code, rng.randint(1, 500))
+        for code, held in portfolio.positions.items():
+            trade("sell", code, held)
+        
+        assert portfolio.positions == {}
+        assert portfolio.cash_money == Money.of(1_000_000.0) - Money.total(fees)
+        assert portfolio.commissions_money == Money.total(fees)
+        assert portfolio.cash == float(portfolio.cash_money)
+    
+    def test_rounding_mode(self):
+        """手续费按组合的舍入方式记入现金"""
+        even = Portfolio(1000.0)
+        up = Portfolio(1000.0, rounding=RoundingMode.HALF_UP)
+        for portfolio in (even, up):
+            portfolio.buy("SH600000", 1, 10.0, commission=0.00005)
+        
+        assert even.cash_money == Money.of("990")
+        assert up.cash_money == Money.of("989.9999")
+        assert even.commissions == 0.0
+    
+    def test_buy_all_cash(self):
+        """浮点误差不会让正好用完现金的买入失败"""
+        portfolio = Portfolio(0.3)
+        portfolio.buy("SH600000", 3, 0.1)
+        
+        assert portfolio.cash_money == Money(0)
+    
+    @pytest.mark.parametrize("quantity,price", [(0, 10.0), (-1, 10.0), (1, 0.0), (1, float("nan"))])
+    def test_invalid_fill(self, quantity, price):
+        with pytest.raises(ValueError):
+            Portfolio(10000.0).buy("SH600000", quantity, price)
+
+
+class TestFifo:
+    """先进先出法测试类"""
+    
+    def test_partial_close_settles_oldest_lot_first(self):
+        portfolio = Portfolio(10000.0, cost_basis="fifo")
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.buy("SH600000", 100, 14.0)
+        
+        assert portfolio.sell("SH600000", 150, 15.0) == pytest.approx(100 * 5.0 + 50 * 1.0)
+        assert portfolio.holding("SH600000").lots == [Lot(50, 14.0)]
+        assert portfolio.avg_cost("SH600000") == pytest.approx(14.0)
+        assert [e.open_price for e in portfolio.ledger] == [10.0, 14.0]
+        assert [e.quantity for e in portfolio.ledger] == [100, 50]
+    
+    def test_average_differs_from_fifo(self):
+        """同一组成交在两种方法下已实现盈亏不同，总盈亏相同"""
+        results = {}
+        for basis in CostBasis:
+            portfolio = Portfolio(10000.0, cost_basis=basis)
+            portfolio.buy("SH600000", 100, 10.0)
+            portfolio.buy("SH600000", 100, 14.0)
+            portfolio.sell("SH600000", 100, 15.0)
+            portfolio.mark_to_market({"SH600000": 15.0})
+            results[basis] = (portfolio.realized_pnl(), portfolio.total_pnl)
+        
+        assert results[CostBasis.AVERAGE][0] == pytest.approx(300.0)
+        assert results[CostBasis.FIFO][0] == pytest.approx(500.0)
+        assert results[CostBasis.AVERAGE][1] == pytest.approx(results[CostBasis.FIFO][1])
+    
+    def test_flip_opens_new_lot_at_fill_price(self):
+        portfolio = Portfolio(10000.0, allow_short=True, cost_basis=CostBasis.FIFO)
+        portfolio.buy("SH600000", 50, 10.0)
+        portfolio.buy("SH600000", 50, 11.0)
+        
+        realized = portfolio.sell("SH600000", 130, 12.0)
+        
+        assert realized == pytest.approx(50 * 2.0 + 50 * 1.0)
+        assert portfolio.position("SH600000") == -30
+        assert portfolio.holding("SH600000").lots == [Lot(30, 12.0)]
+        
+        assert portfolio.buy("SH600000", 30, 13.0) == pytest.approx(-30.0)
+        assert portfolio.positions == {}
+        assert portfolio.holding("SH600000").lots == []
+        assert portfolio.avg_cost("SH600000") == 0.0
+
+
+class TestFillsAndLedger:
+    """成交记录和已实现盈亏明细测试类"""
+    
+    def test_apply_fill(self):
+        portfolio = Portfolio(10000.0)
+        day = datetime(2025, 1, 3)
+        
+        portfolio.apply_fill(FakeFill("SH600000", "buy", 100, 10.0, commission=5.0, time=day))
+        realized = portfolio.apply_fill(FakeFill("SH600000", "sell", 40, 12.0, commission=5.0, time=day))
+        
+        assert realized == pytest.approx(80.0)
+        assert portfolio.position("SH600000") == 60
+        # 现金包含两笔手续费
+        assert portfolio.cash == pytest.approx(10000.0 - 1000.0 - 5.0 + 480.0 - 5.0)
+        entry = portfolio.ledger[0]
+        assert (entry.time, entry.instrument, entry.quantity, entry.open_price, entry.close_price) == (
+            day, "SH600000", 40, 10.0, 12.0
+        )
+    
+    def test_apply_fill_invalid_side(self):
+        with pytest.raises(ValueError):
+            Portfolio(10000.0).apply_fill(FakeFill("SH600000", "hold", 1, 10.0))
+    
+    def test_flat_positions_are_cleaned_up(self):
+        """平仓后的标的不再出现在持仓中，但保留已实现盈亏"""
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.sell("SH600000", 100, 11.0)
+        
+        assert portfolio.positions == {}
+        assert portfolio.holdings == {}
+        assert portfolio.market_value == 0.0
+        assert portfolio.realized_pnl("SH600000") == pytest.approx(100.0)
+    
+    def test_short_cover_ledger_quantity_is_negative(self):
+        portfolio = Portfolio(10000.0, allow_short=True)
+        portfolio.sell("SH600000", 100, 10.0)
+        portfolio.buy("SH600000", 100, 9.0)
+        
+        assert portfolio.ledger[0].quantity == -100
+        assert portfolio.ledger[0].pnl == pytest.approx(100.0)
+    
+    def test_settle(self):
+        """退市结算不收手续费，结算价可以为0"""
+        portfolio = Portfolio(10000.0)
+        portfolio.buy("SH600000", 100, 10.0, commission=5.0)
+        portfolio.buy("SH600004", 50, 4.0)
+        
+        assert portfolio.settle("SH600000", 8.0) == pytest.approx(-200.0)
+        assert portfolio.settle("SH600004", 0.0) == pytest.approx(-200.0)
+        assert portfolio.settle("SZ000001", 5.0) == 0.0
+        assert portfolio.positions == {}
+        assert portfolio.cash == pytest.approx(10000.0 - 1005.0 - 200.0 + 800.0)
+        with pytest.raises(ValueError):
+            portfolio.settle("SH600000", -1.0)
+    
+    def test_dividends(self):
+        """多头扣税后收到分红，空头支付全额分红，total_pnl包含分红"""
+        portfolio = Portfolio(10000.0, allow_short=True)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.sell("SZ000001", 50, 20.0)
+        
+        assert portfolio.pay_dividend("SH600000", 0.5, tax_rate=0.1) == (pytest.approx(45.0), pytest.approx(5.0))
+        assert portfolio.pay_dividend("SZ000001", 1.0, tax_rate=0.1) == (pytest.approx(-50.0), 0.0)
+        assert portfolio.pay_dividend("SH600004", 1.0) == (0.0, 0.0)
+        assert portfolio.dividends == pytest.approx(-5.0)
+        assert portfolio.cash == pytest.approx(10000.0 - 1000.0 + 1000.0 - 5.0)
+        assert portfolio.total_pnl() == pytest.approx(portfolio.equity - portfolio.initial_cash)
+        assert Portfolio.from_dict(portfolio.to_dict()).dividends == pytest.approx(-5.0)
+        assert portfolio.copy().dividends == pytest.approx(-5.0)
+        with pytest.raises(ValueError):
+            portfolio.pay_dividend("SH600000", -0.1)
+        with pytest.raises(ValueError):
+            portfolio.pay_dividend("SH600000", 0.1, tax_rate=1.5)
+    
+    @pytest.mark.parametrize("basis", [CostBasis.AVERAGE, CostBasis.FIFO])
+    def test_split(self, basis):
+        """拆股不改变市值、现金和盈亏"""
+        portfolio = Portfolio(10000.0, cost_basis=basis)
+        portfolio.buy("SH600000", 100, 10.0)
+        portfolio.buy("SH600000", 100, 12.0)
+        portfolio.mark_to_market({"SH600000": 13.0})
+        equity, pnl = portfolio.equity, portfolio.total_pnl()
+        
+        assert portfolio.split("SH600000", 2.0) == pytest.approx(400)
+        
+        assert portfolio.avg_cost("SH600000") == pytest.approx(5.5)
+        assert portfolio.holding("SH600000").mark == pytest.approx(6.5)
+        assert (portfolio.equity, portfolio.total_pnl()) == (pytest.approx(equity), pytest.approx(pnl))
+        if basis is CostBasis.FIFO:
+            assert portfolio.holding("SH600000").lots == [Lot(200, 5.0), Lot(200, 6.0)]
+        assert portfolio.sell("SH600000", 200, 6.5) == pytest.approx(300.0 if basis is CostBasis.FIFO else 200.0)
+        assert portfolio.split("SZ000001", 2.0) == 0.0
+        with pytest.raises(ValueError):
+            portfolio.split("SH600000", 0.0)
+
+
+class TestSerialization:
+    """JSON序列化测试类"""
+    
+    @pytest.mark.parametrize("basis", list(CostBasis))
+    def test_round_trip(self, basis):
+        portfolio = Portfolio(10000.0, allow_short=True, cost_basis=basis)
+        portfolio.buy("SH600000", 100, 10.0, commission=1.0, time=datetime(2025, 1, 2))
+        portfolio.buy("SH600000", 50, 12.0)
+        portfolio.sell("SH600000", 120, 13.0, commission=1.0, time=datetime(2025, 1, 3))
+        portfolio.sell("SZ000001", 10, 20.0)
+        portfolio.mark_to_market({"SH600000": 12.5, "SZ000001": 19.0})
+        
+        restored = Portfolio.from_json(portfolio.to_json())
+        
+        assert restored.to_dict() == portfolio.to_dict()
+        assert restored.cost_basis is basis
+        assert restored.equity == pytest.approx(portfolio.equity)
+        assert restored.ledger == portfolio.ledger
+        assert restored.holding("SH600000") == portfolio.holding("SH600000")
+        
+        # 恢复后继续记账的结果一致
+        assert restored.sell("SH600000", 30, 14.0) == pytest.approx(portfolio.sell("SH600000", 30, 14.0))
+        assert restored.to_dict() == portfolio.to_dict()
+    
+    def test_amounts_saved_exactly(self):
+        portfolio = Portfolio(10000.0, rounding=RoundingMode.DOWN)
+        portfolio.buy("SH600000", 100, 10.0, commission=0.12345)
+        data = portfolio.to_dict()
+        
+        assert (data["cash"], data["commissions"], data["rounding"]) == ("8999.8766", "0.1234", "down")
+        assert Portfolio.from_dict(data).cash_money == portfolio.cash_money
+        
+        # 旧版本保存的浮点数金额
+        data.update(cash=8999.8766, initial_cash=10000.0, commissions=0.1234)
+        del data["rounding"]
+        legacy = Portfolio.from_dict(data)
+        assert legacy.cash_money == portfolio.cash_money
+        assert legacy.rounding is RoundingMode.HALF_EVEN
+    
+    def test_invalid_data(self):
+        with pytest.raises(ValueError):
+            Portfolio.from_json('{"cash": 1.0}')
+
+
+class TestFutures:
+    """期货保证金核算测试类"""
+    
+    def test_open_holds_margin_not_notional(self):
+        portfolio = Portfolio(200000.0)
+        
+        portfolio.buy("IF2503.CFE", 1, 4000.0, commission=10.0)
+        
+        assert portfolio.cash == pytest.approx(199990.0)
+        assert portfolio.margin == pytest.approx(4000.0 * 300 * 0.12)
+        assert portfolio.market_value == pytest.approx(4000.0 * 300)
+        assert portfolio.equity == pytest.approx(199990.0)
+    
+    def test_pnl_uses_multiplier(self):
+        portfolio = Portfolio(200000.0)
+        portfolio.buy("IF2503.CFE", 1, 4000.0)
+        
+        portfolio.mark_to_market({"IF2503.CFE": 4010.0})
+        assert portfolio.unrealized_pnl() == pytest.approx(3000.0)
+        assert portfolio.equity == pytest.approx(203000.0)
+        
+        realized = portfolio.sell("IF2503.CFE", 1, 4020.0, commission=10.0)
+        assert realized == pytest.approx(6000.0)
+        assert portfolio.cash == pytest.approx(200000.0 + 6000.0 - 10.0)
+        assert portfolio.margin == 0.0
+        assert portfolio.total_pnl == pytest.approx(portfolio.equity - portfolio.initial_cash)
+    
+    def test_insufficient_margin(self):
+        """可用保证金（权益减已占用保证金）不足以开新仓时拒绝，平仓不受限制"""
+        portfolio = Portfolio(200000.0)
+        portfolio.buy("IF2503.CFE", 1, 4000.0)
+        
+        with pytest.raises(InsufficientCashError):
+            portfolio.buy("IF2503.CFE", 1, 4000.0)
+        portfolio.sell("IF2503.CFE", 1, 3990.0)
+        assert portfolio.positions == {}
+    
+    def test_short_without_allow_short(self):
+        portfolio = Portfolio(200000.0)
+        
+        portfolio.sell("IC2503.CFE", 1, 5000.0)
+        portfolio.mark_to_market({"IC2503.CFE": 4990.0})
+        
+        assert portfolio.position("IC2503.CFE") == -1
+        assert portfolio.unrealized_pnl("IC2503.CFE") == pytest.approx(10.0 * 200)
+        with pytest.raises(ShortSellingError):
+            portfolio.sell("SH600000", 100, 10.0)
+    
+    def test_reversal_needs_margin_for_new_side_only(self):
+        portfolio = Portfolio(150000.0, cost_basis=CostBasis.FIFO)
+        portfolio.buy("IF2503.CFE", 1, 4000.0)
+        
+        # 卖出2手：平掉1手多头，新开1手空头
+        portfolio.sell("IF2503.CFE", 2, 4000.0)
+        
+        assert portfolio.position("IF2503.CFE") == -1
+        assert portfolio.margin == pytest.approx(144000.0)
+    
+    def test_round_trip_keeps_multiplier(self):
+        portfolio = Portfolio(200000.0)
+        portfolio.buy("IF2503.CFE", 1, 4000.0)
+        
+        data = portfolio.to_dict()
+        restored = Portfolio.from_dict(data)
+        for item in data["positions"]:
+            del item["multiplier"], item["margin_rate"]
+        legacy = Portfolio.from_dict(data)
+        
+        assert restored.holding("IF2503.CFE").multiplier == 300
+        assert legacy.holding("IF2503.CFE") == restored.holding("IF2503.CFE")
+
+
+class TestMultiCurrency:
+    """外币标的折算测试类"""
+    
+    def test_fills_and_marks_convert_to_base(self):
+        portfolio = Portfolio(100000.0)
+        portfolio.set_fx_rates({"HKD": 0.9})
+        
+        portfolio.buy("HK00700", 100, 300.0, commission=10.0)
+        portfolio.buy("SH600000", 1000, 10.0)
+        
+        assert portfolio.cash == pytest.approx(100000.0 - 27000.0 - 9.0 - 10000.0)
+        assert portfolio.avg_cost("HK00700") == pytest.approx(270.0)
+        assert portfolio.holding("HK00700").currency == "HKD"
+        
+        # 港币升值同样计入盈亏
+        portfolio.mark_to_market({"HK00700": 310.0, "SH600000": 10.0}, {"HKD": 0.95})
+        assert portfolio.currency_exposure() == pytest.approx({"HKD": 29450.0, "CNY": 10000.0})
+        assert portfolio.unrealized_pnl("HK00700") == pytest.approx(2450.0)
+        assert portfolio.equity == pytest.approx(62991.0 + 29450.0 + 10000.0)
+        assert portfolio.sell("HK00700", 100, 310.0) == pytest.approx(2450.0)
+        assert portfolio.total_pnl == pytest.approx(portfolio.equity - portfolio.initial_cash)
+    
+    def test_missing_rate_rejects_fill(self):
+        portfolio = Portfolio(100000.0)
+        
+        with pytest.raises(FXRateUnavailableError) as exc_info:
+            portfolio.buy("HK00700", 100, 300.0)
+        
+        assert exc_info.value.pair == "HKDCNY"
+        assert portfolio.cash == 100000.0 and portfolio.positions == {}
+        with pytest.raises(ValueError):
+            portfolio.set_fx_rates({"HKD": 0.0})
+    
+    def test_base_currency_and_rates_round_trip(self):
+        portfolio = Portfolio(100000.0, base_currency="HKD")
+        portfolio.set_fx_rates({"CNY": 1.08})
+        portfolio.buy("SH600000", 100, 10.0)
+        
+        restored = Portfolio.from_json(portfolio.to_json())
+        
+        assert restored.to_dict() == portfolio.to_dict()
+        assert (restored.base_currency, restored.fx_rates) == ("HKD", {"CNY": 1.08})
+        assert restored.fx_rate("SH600000") == 1.08 and restored.fx_rate("HK00700") == 1.0
+        assert restored.copy().to_dict() == portfolio.to_dict()
@@ -0,0 +1,266 @@
+"""
+Unit tests for price adjustment
+复权单元测试
+"""
+
+import pytest
+import pandas as pd
+
+from src.core.data_manager import DataManager
+from src.core.feature_frame import FeatureFrame
+from src.core.price_adjustment import AdjustMode, adjust_prices, needs_factor, to_adjust_mode
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.infrastructure.data_provider import (
+    AdjustmentsUnavailableError,
+    CashDividend,
+    Earnings,
+    RightsIssue,
+    Split,
+    adjustment_factor,
+    corporate_actions_from,
+    earnings_from
+)
+
+
+# 2025-01-06为10送10的除权日，复权因子从1变为2
+SPLIT_CSV = """date,open,close,volume,factor
+2025-01-02,19.8,20.0,1000,1.0
+2025-01-03,20.0,20.4,1200,1.0
+2025-01-06,10.2,10.3,2600,2.0
+2025-01-07,10.3,10.5,2400,2.0
+"""
+
+
+# 同样的行情，不带复权因子列，拆分记录单独存放
+RAW_CSV = """date,open,close,volume
+2025-01-02,19.8,20.0,1000
+2025-01-03,20.0,20.4,1200
+2025-01-06,10.2,10.3,2600
+2025-01-07,10.3,10.5,2400
+"""
+
+
+@pytest.fixture
+def manager(tmp_path):
+    (tmp_path / "SH600000.csv").write_text(SPLIT_CSV)
+    return DataManager(enable_cache=False, provider=CSVDataProvider(str(tmp_path)))
+
+
+def _closes(manager, adjust, **kwargs):
+    result = manager.get_features("SH600000", ["$close"], adjust=adjust, **kwargs)
+    return list(result["SH600000"]["$close"])
+
+
+class TestAdjustedFeatures:
+    """get_features复权测试类"""
+    
+    def test_none_returns_raw_prices(self, manager):
+        assert _closes(manager, "none") == [20.0, 20.4, 10.3, 10.5]
+        assert _closes(manager, None) == [20.0, 20.4, 10.3, 10.5]
+    
+    def test_post_adjusted(self, manager):
+        """后复权以上市首日为基准，除权日前的价格不变"""
+        assert _closes(manager, "post") == pytest.approx([20.0, 20.4, 20.6, 21.0])
+    
+    def test_pre_adjusted(self, manager):
+        """前复权以区间最后一天为基准，除权日后的价格不变"""
+        assert _closes(manager, "pre") == pytest.approx([10.0, 10.2, 10.3, 10.5])
+    
+    def test_pre_and_post_differ_by_split_ratio(self, manager):
+        """跨除权日时前、后复权序列之比等于拆分比例"""
+        pre, post = _closes(manager, "pre"), _closes(manager, "post")
+        
+        assert [p / q for p, q in zip(pre, post)] == pytest.approx([0.5] * 4)
+    
+    def test_pre_base_follows_query_window(self, manager):
+        """查询区间不含除权日时前复权等于原始价"""
+        assert _closes(manager, "pre", end_time="2025-01-03") == [20.0, 20.4]
+    
+    def test_returns_across_split_use_adjusted_prices(self, manager):
+        """表达式使用复权后的价格，除权日收益率不再是-50%"""
+        result = manager.get_features(
+            "SH600000", ["$close/Ref($close,1)-1"], adjust=AdjustMode.PRE
+        )
+        
+        returns = list(result["SH600000"]["$close/Ref($close,1)-1"])
+        assert returns[2] == pytest.approx(10.3 / 10.2 - 1)
+    
+    def test_factor_is_requestable_and_volume_scaled(self, manager):
+        """$factor可以直接请求，成交量按相反比例换算"""
+        result = manager.get_features("SH600000", ["$volume", "$factor"], adjust="post")
+        frame = result["SH600000"]
+        
+        assert list(frame["$factor"]) == [1.0, 1.0, 2.0, 2.0]
+        assert list(frame["$volume"]) == pytest.approx([1000, 1200, 1300, 1200])
+    
+    def test_unknown_mode(self, manager):
+        with pytest.raises(ValueError):
+            manager.get_features("SH600000", ["$close"], adjust="forward")
+
+
+class TestAdjustPrices:
+    """adjust_prices测试类"""
+    
+    def test_adjusted_source_converts_back_to_raw(self):
+        """提供者返回后复权价（如qlib）时可以换算回原始价"""
+        index = pd.bdate_range("2025-01-02", periods=3)
+        data = pd.DataFrame({"$close": [20.0, 20.6, 21.0], "$factor": [1.0, 2.0, 2.0]}, index=index)
+        
+        raw = adjust_prices(data, AdjustMode.NONE, adjusted_source=True)
+        pre = adjust_prices(data, AdjustMode.PRE, adjusted_source=True)
+        
+        assert list(raw["$close"]) == pytest.approx([20.0, 10.3, 10.5])
+        assert list(pre["$close"]) == pytest.approx([10.0, 10.3, 10.5])
+    
+    def test_missing_factor_carried_forward(self):
+        index = pd.bdate_range("2025-01-02", periods=3)
+        data = pd.DataFrame({"$close": [10.0, 10.0, 10.0], "$factor": [1.0, None, 2.0]}, index=index)
+        
+        assert list(adjust_prices(data, AdjustMode.POST)["$close"]) == [10.0, 10.0, 20.0]
+    
+    def test_needs_factor(self):
+        assert not needs_factor(["$close"], AdjustMode.NONE, adjusted_source=False)
+        assert not needs_factor(["$close"], AdjustMode.POST, adjusted_source=True)
+        assert not needs_factor(["$amount"], AdjustMode.PRE, adjusted_source=False)
+        assert needs_factor(["$close"], AdjustMode.PRE, adjusted_source=False)
+        assert to_adjust_mode("POST") == AdjustMode.POST
+
+
+class TestAdjustmentRecords:
+    """由除权除息记录计算复权因子测试类"""
+    
+    @pytest.fixture
+    def provider(self, tmp_path):
+        (tmp_path / "SH600000.csv").write_text(RAW_CSV)
+        (tmp_path / "adjustments").mkdir()
+        (tmp_path / "adjustments" / "SH600000.csv").write_text("ex_date,split_ratio\n2025-01-06,2\n")
+        return CSVDataProvider(str(tmp_path))
+    
+    def test_split_gives_continuous_close(self, provider):
+        """10送10的拆分记录得到连续的复权收盘价"""
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        pre = _closes(manager, "pre")
+        post = _closes(manager, "post")
+        
+        assert pre == pytest.approx([10.0, 10.2, 10.3, 10.5])
+        assert post == pytest.approx([20.0, 20.4, 20.6, 21.0])
+        assert pre[2] / pre[1] - 1 == pytest.approx(10.3 / 10.2 - 1)
+    
+    def test_volume_inversely_adjusted(self, provider):
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        result = manager.get_features("SH600000", ["$volume", "$factor"], adjust="pre")
+        
+        assert list(result["SH600000"]["$factor"]) == [1.0, 1.0, 2.0, 2.0]
+        assert list(result["SH600000"]["$volume"]) == pytest.approx([2000, 2400, 2600, 2400])
+    
+    def test_records_are_loadable(self, provider):
+        records = provider.adjustments("SH600000")
+        
+        assert list(records.index) == [pd.Timestamp("2025-01-06")]
+        assert records.iloc[0].tolist() == [2.0, 0.0]
+        assert "$factor" in provider.list_fields("SH600000")
+    
+    def test_corporate_actions(self, tmp_path):
+        """同一除权日依次为分红、拆股和配股，没有行为的记录不产生事件"""
+        (tmp_path / "SH600000.csv").write_text(RAW_CSV)
+        (tmp_path / "adjustments").mkdir()
+        (tmp_path / "adjustments" / "SH600000.csv").write_text(
+            "ex_date,split_ratio,dividend,rights_ratio,rights_price\n"
+            "2025-01-03,1,0,,\n"
+            "2025-01-06,1.3,0.2,0.3,8.0\n"
+        )
+        provider = CSVDataProvider(str(tmp_path))
+        ex_date = pd.Timestamp("2025-01-06")
+        
+        actions = provider.corporate_actions("SH600000")
+        
+        assert actions == [
+            CashDividend("SH600000", ex_date, 0.2),
+            Split("SH600000", ex_date, 1.3),
+            RightsIssue("SH600000", ex_date, 0.3, 8.0),
+        ]
+        assert provider.corporate_actions("SH600000", end_time="2025-01-03") == []
+        manager = DataManager(enable_cache=False, provider=provider)
+        assert manager.get_corporate_actions(["SH600000", "SZ000001"]) == {"SH600000": actions, "SZ000001": []}
+    
+    def test_dividend_and_split_in_range(self, tmp_path):
+        """区间只包含01-06的分红和01-07的拆股，业绩公告按要求合并"""
+        (tmp_path / "SH600000.csv").write_text(RAW_CSV)
+        (tmp_path / "adjustments").mkdir()
+        (tmp_path / "adjustments" / "SH600000.csv").write_text(
+            "ex_date,split_ratio,dividend\n"
+            "2024-06-03,1,0.1\n"
+            "2025-01-06,1,0.2\n"
+            "2025-01-07,2,0\n"
+            "2025-06-03,1,0.3\n"
+        )
+        provider = CSVDataProvider(str(tmp_path))
+        announced = pd.DataFrame(
+            {"period_end": pd.to_datetime(["2024-09-30", "2024-12-31", "2024-12-31"])},
+            index=pd.DatetimeIndex(["2024-10-30", "2025-01-07", "2025-01-07"], name="announce_date")
+        )
+        provider.fundamentals = lambda instruments, fields, start_time=None, end_time=None: {
+            code: announced.loc[start_time:end_time] for code in instruments
+        }
+        manager = DataManager(enable_cache=False, provider=provider)
+        
+        actions = manager.get_corporate_actions("SH600000", "2025-01-01", "2025-01-31")["SH600000"]
+        events = manager.get_corporate_actions("SH600000", "2025-01-01", "2025-01-31", earnings=True)["SH600000"]
+        
+        assert actions == [
+            CashDividend("SH600000", pd.Timestamp("2025-01-06"), 0.2),
+            Split("SH600000", pd.Timestamp("2025-01-07"), 2.0),
+        ]
+        assert [(a.ex_date.day, a.kind, a.magnitude) for a in actions] == [(6, "dividend", 0.2), (7, "split", 2.0)]
+        assert events == actions + [Earnings("SH600000", pd.Timestamp("2025-01-07"), pd.Timestamp("2024-12-31"))]
+        assert pd.isna(events[-1].magnitude)
+        assert earnings_from("SH600000", pd.DataFrame()) == []
+    
+    def test_invalid_corporate_actions(self):
+        records = pd.DataFrame(
+            {"split_ratio": [1.0], "dividend": [0.0], "rights_ratio": [0.3]},
+            index=pd.DatetimeIndex(["2025-01-06"], name="ex_date")
+        )
+        
+        with pytest.raises(ValueError):
+            corporate_actions_from("SH600000", records)
+        with pytest.raises(ValueError):
+            corporate_actions_from("SH600000", records.assign(rights_ratio=0.0, split_ratio=0.0))
+    
+    def test_missing_records(self, tmp_path):
+        (tmp_path / "SH600000.csv").write_text(RAW_CSV)
+        provider = CSVDataProvider(str(tmp_path))
+        
+        with pytest.raises(AdjustmentsUnavailableError):
+            provider.adjustments("SH600000")
+        assert "$factor" not in provider.list_fields("SH600000")
+    
+    def test_dividend_factor(self):
+        """分红按前收盘价换算，早于第一根K线的记录不影响因子"""
+        closes = pd.Series([20.0, 20.4, 20.0], index=pd.bdate_range("2025-01-02", periods=3))
+        records = pd.DataFrame(
+            {"split_ratio": [2.0, 1.0, 2.0], "dividend": [0.0, 0.4, 0.4]},
+            index=pd.DatetimeIndex(["2024-12-02", "2025-01-06", "2025-02-03"], name="ex_date")
+        )
+        
+        factor = adjustment_factor(records, closes)
+        
+        assert list(factor) == pytest.approx([1.0, 1.0, 20.4 / 20.0])
+        with pytest.raises(ValueError):
+            adjustment_factor(records.assign(dividend=25.0), closes)
+    
+    def test_frame_adjust(self):
+        frame = FeatureFrame(
+            {"$close": [20.0, 10.3], "$volume": [100.0, 200.0], "$factor": [1.0, 2.0]},
+            index=pd.bdate_range("2025-01-03", periods=2)
+        )
+        frame.attrs["instrument"] = "SH600000"
+        
+        adjusted = frame.adjust("pre")
+        
+        assert list(adjusted["$close"]) == pytest.approx([10.0, 10.3])
+        assert list(adjusted["$volume"]) == pytest.approx([200.0, 200.0])
+        assert adjusted.attrs["instrument"] == "SH600000"
+        assert list(frame["$close"]) == [20.0, 10.3]
@@ -0,0 +1,113 @@
+"""
+Unit tests for the query syntax
+查询语法单元测试
+"""
+
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.query import Query, QuerySyntaxError, parse_query
+from src.core.universe import Universe, register_universe
+from src.infrastructure.csv_provider import CSVDataProvider
+
+
+CSV_CONTENT = """date,open,close
+2025-01-02,10.0,10.2
+2025-01-03,10.2,10.6
+2025-01-06,10.6,10.4
+2025-01-07,10.4,10.8
+"""
+
+
+@pytest.fixture
+def manager(tmp_path):
+    for code in ("SH600000", "SZ000001", "SH600004"):
+        (tmp_path / f"{code}.csv").write_text(CSV_CONTENT)
+    return DataManager(enable_cache=False, provider=CSVDataProvider(str(tmp_path)))
+
+
+class TestParseQuery:
+    """parse_query测试类"""
+    
+    def test_full_query(self):
+        assert parse_query("SH000300.$close[2025-01-01:2025-06-30]@5min") == Query(
+            instruments=["SH000300"], field="$close", start_time="2025-01-01", end_time="2025-06-30", freq="5min"
+        )
+    
+    def test_defaults(self):
+        """时间区间和频率可以省略，开始或结束留空表示不限"""
+        assert parse_query("SH600000.$close") == Query(instruments=["SH600000"], field="$close")
+        assert parse_query("SH600000.$close[:2025-06-30]").start_time is None
+        assert parse_query("SH600000.$close[2025-01-01:]@Min15").freq == "15min"
+    
+    def test_instrument_list_and_expression(self):
+        query = parse_query("SH600000, SZ000001.Mean($close, 5) / Ref($close, 1)[2025-01-01:2025-06-30]")
+        
+        assert query.instruments == ["SH600000", "SZ000001"]
+        assert query.field == "Mean($close, 5) / Ref($close, 1)"
+    
+    def test_wildcard(self):
+        query = parse_query("CSI300.*.$close[2025-01-01:2025-06-30]")
+        
+        assert query.instruments == []
+        assert query.universe == "CSI300"
+    
+    def test_rfc3339_times(self):
+        """RFC3339时间本身带冒号"""
+        query = parse_query("SH600000.$close[2025-01-02T09:30:00+08:00:2025-01-02T15:00:00+08:00]@1min")
+        
+        assert query.start_time == "2025-01-02T09:30:00+08:00"
+        assert query.end_time == "2025-01-02T15:00:00+08:00"
+    
+    @pytest.mark.parametrize("text, position", [
+        ("", 0),
+        ("SH600000$close", 8),
+        ("SH600000,.$close", 9),
+        ("SH600000.", 9),
+        ("SH600000.Mean($close, 5", 23),
+        ("SH600000.$close + Foo($close)", 18),
+        ("SH600000.$close[2025-01-01]", 26),
+        ("SH600000.$close[2025-13-01:2025-06-30]", 16),
+        ("SH600000.$close[2025-01-01:2025-06-30", 15),
+        ("SH600000.$close@weekly", 16),
+        ("SH600000.$close[2025-01-01:2025-06-30]x", 38),
+        ("SH000300,SH000905.*.$close", 18),
+    ])
+    def test_errors_point_at_offending_character(self, text, position):
+        with pytest.raises(QuerySyntaxError) as error:
+            parse_query(text)
+        
+        assert error.value.position == position
+        assert error.value.error_info.technical_details == f"{text}\n{' ' * position}^"
+
+
+class TestDataManagerQuery:
+    """DataManager.query测试类"""
+    
+    def test_same_result_as_get_features(self, manager):
+        result = manager.query("SH600000,SZ000001.$close/Ref($close,1)-1[2025-01-03:2025-01-06]")
+        expected = manager.get_features(
+            ["SH600000", "SZ000001"], ["$close/Ref($close,1)-1"], "2025-01-03", "2025-01-06"
+        )
+        
+        assert list(result) == ["SH600000", "SZ000001"]
+        for code in expected:
+            pd.testing.assert_frame_equal(result[code], expected[code])
+    
+    def test_wildcard_expands_constituents(self, manager):
+        register_universe("QUERY_POOL", Universe("QUERY_POOL", {
+            "SH600000": [("2025-01-01", None)],
+            "SH600004": [("2025-01-01", "2025-01-03")],
+        }))
+        
+        result = manager.query("QUERY_POOL.*.$close[2025-01-02:2025-01-07]")
+        
+        assert sorted(result) == ["SH600000", "SH600004"]
+        assert len(result["SH600000"]) == 4
+        assert list(result["SH600004"].index) == list(pd.to_datetime(["2025-01-02", "2025-01-03"]))
+    
+    def test_options_are_passed_through(self, manager):
+        result = manager.query("SH600000.$close[2025-01-02:2025-01-03]", adjust="none")
+        
+        assert result["SH600000"]["$close"].tolist() == [10.2, 10.6]
@@ -0,0 +1,194 @@
+"""
+Unit tests for ReaderPool
+文件读取器池单元测试
+"""
+
+import os
+import threading
+import time
+
+import pytest
+
+from src.infrastructure.reader_pool import ReaderPool
+from src.utils.request_context import ContextCancelledError, RequestContext
+
+
+class FakeReader:
+    """Records whether it was closed"""
+    
+    def __init__(self, path):
+        self.path = path
+        self.closed = False
+    
+    def close(self):
+        self.closed = True
+
+
+class Opener:
+    """Opens FakeReaders and keeps every one it opened"""
+    
+    def __init__(self):
+        self.opened = []
+        self.lock = threading.Lock()
+    
+    def __call__(self, path):
+        reader = FakeReader(path)
+        with self.lock:
+            self.opened.append(reader)
+        return reader
+
+
+@pytest.fixture
+def files(tmp_path):
+    paths = [tmp_path / f"{name}.bin" for name in ("a", "b", "c")]
+    for path in paths:
+        path.write_bytes(b"x")
+    return paths
+
+
+class TestReaderPool:
+    """ReaderPool测试类"""
+    
+    def test_reuses_readers(self, files):
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=2, idle_timeout=None)
+        
+        with pool.reader(files[0]) as first:
+            pass
+        with pool.reader(files[0]) as second:
+            assert pool.idle_count == 0
+        
+        assert first is second
+        assert len(opener.opened) == 1
+        assert pool.open_count == pool.idle_count == 1
+    
+    def test_bounded_open_readers(self, files):
+        """已满且没有空闲读取器时等待归还"""
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=2, idle_timeout=None)
+        release = threading.Event()
+        borrowed = threading.Barrier(3)
+        
+        def hold(path):
+            with pool.reader(path):
+                borrowed.wait(5)
+                release.wait(5)
+        
+        holders = [threading.Thread(target=hold, args=(path,)) for path in files[:2]]
+        for thread in holders:
+            thread.start()
+        borrowed.wait(5)
+        
+        def borrow():
+            with pool.reader(files[2]):
+                pass
+        
+        waiter = threading.Thread(target=borrow)
+        waiter.start()
+        waiter.join(0.2)
+        assert waiter.is_alive()
+        assert pool.open_count == 2
+        
+        release.set()
+        waiter.join(5)
+        for thread in holders:
+            thread.join(5)
+        assert not waiter.is_alive()
+        # 第三个文件打开前关闭了一个空闲读取器
+        assert pool.open_count == 2
+        assert sum(reader.closed for reader in opener.opened) == 1
+    
+    def test_wait_checks_context(self, files):
+        pool = ReaderPool(Opener(), max_open=1, idle_timeout=None)
+        ctx = RequestContext(timeout=0.1)
+        
+        with pool.reader(files[0]):
+            with pytest.raises(ContextCancelledError):
+                with pool.reader(files[1], ctx):
+                    pass
+        
+        assert pool.open_count == 1
+    
+    def test_idle_readers_are_closed(self, files):
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=4, idle_timeout=0.05)
+        
+        with pool.reader(files[0]):
+            pass
+        deadline = time.monotonic() + 5
+        while pool.open_count and time.monotonic() < deadline:
+            time.sleep(0.02)
+        
+        assert pool.open_count == 0
+        assert opener.opened[0].closed
+    
+    def test_sweep(self, files):
+        pool = ReaderPool(Opener(), max_open=4, idle_timeout=3600)
+        
+        with pool.reader(files[0]):
+            pass
+        
+        assert pool.sweep() == 0
+        pool._idle_timeout = 0
+        assert pool.sweep() == 1
+        assert pool.open_count == 0
+    
+    def test_modified_file_is_reopened(self, files):
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=2, idle_timeout=None)
+        
+        with pool.reader(files[0]) as first:
+            pass
+        stat = files[0].stat()
+        os.utime(files[0], ns=(stat.st_atime_ns, stat.st_mtime_ns + 1_000_000_000))
+        with pool.reader(files[0]) as second:
+            pass
+        
+        assert second is not first
+        assert first.closed
+        assert pool.open_count == 1
+    
+    def test_failed_read_discards_reader(self, files):
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=2, idle_timeout=None)
+        
+        with pytest.raises(ValueError):
+            with pool.reader(files[0]):
+                raise ValueError("corrupt")
+        
+        assert opener.opened[0].closed
+        assert pool.open_count == 0
+    
+    def test_failed_open_frees_slot(self, files):
+        def failing(path):
+            raise OSError("too many open files")
+        pool = ReaderPool(failing, max_open=1, idle_timeout=None)
+        
+        with pytest.raises(OSError):
+            with pool.reader(files[0]):
+                pass
+        
+        assert pool.open_count == 0
+    
+    def test_close(self, files):
+        opener = Opener()
+        pool = ReaderPool(opener, max_open=2, idle_timeout=None)
+        
+        with pool.reader(files[0]):
+            with pool.reader(files[1]):
+                pass
+            pool.close()
+            # 使用中的读取器在归还时关闭
+            assert opener.opened[1].closed and not opener.opened[0].closed
+        
+        assert all(reader.closed for reader in opener.opened)
+        assert pool.open_count == 0
+        with pytest.raises(RuntimeError):
+            with pool.reader(files[0]):
+                pass
+    
+    def test_invalid_arguments(self):
+        with pytest.raises(ValueError):
+            ReaderPool(Opener(), max_open=0)
+        with pytest.raises(ValueError):
+            ReaderPool(Opener(), idle_timeout=-1)
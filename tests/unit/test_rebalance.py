@@ -0,0 +1,219 @@
+"""
+定期调仓单元测试 / Rebalancing Unit Tests
+"""
+
+import pytest
+import pandas as pd
+
+from src.application.backtest_engine import EngineConfig, OrderSide, Strategy, run
+from src.application.rebalance import (
+    CalendarDays,
+    DateList,
+    EveryNDays,
+    MonthEnd,
+    MonthStart,
+    QuarterEnd,
+    TargetWeightStrategy,
+    Weekly,
+    normalize_weights,
+    target_orders
+)
+from src.core.feature_frame import FeatureFrame
+from src.core.portfolio import Portfolio
+from src.core.trading_calendar import TradingCalendar
+from src.utils.error_handler import BacktestError
+
+
+@pytest.fixture
+def calendar():
+    # 1月31日（周五）休市，1月的最后一个交易日为1月30日
+    return TradingCalendar("TEST", holidays=["2025-01-31"])
+
+
+# 元旦、1月31日（周五）、3月3日（周一）、5月1日至2日和6月2日（周一）休市
+HOLIDAYS = TradingCalendar(
+    "TEST_HOLIDAYS", holidays=["2025-01-01", "2025-01-31", "2025-03-03", "2025-05-01", "2025-05-02", "2025-06-02"]
+)
+
+
+def _days(*days):
+    return [pd.Timestamp(d) for d in days]
+
+
+def _orders(orders):
+    return [(o.instrument, o.side, o.quantity) for o in orders]
+
+
+class TestSchedules:
+    """调仓计划测试类"""
+    
+    def test_month_end(self, calendar):
+        assert MonthEnd().dates("2025-01-01", "2025-02-28", calendar) == _days("2025-01-30", "2025-02-28")
+    
+    def test_quarter_end(self, calendar):
+        assert QuarterEnd().dates("2025-01-01", "2025-07-15", calendar) == _days("2025-03-31", "2025-06-30")
+    
+    def test_every_n_days(self, calendar):
+        """从第一个交易日起每3个交易日"""
+        assert EveryNDays(3).dates("2025-01-01", "2025-01-10", calendar) == _days(
+            "2025-01-02", "2025-01-07", "2025-01-10"
+        )
+        with pytest.raises(ValueError):
+            EveryNDays(0)
+    
+    def test_date_list_rolls_forward(self, calendar):
+        """周末和休市日顺延到下一个交易日"""
+        schedule = DateList(["2025-01-04", "2025-01-31", "2025-01-08"])
+        
+        assert schedule.dates("2025-01-01", "2025-02-10", calendar) == _days(
+            "2025-01-06", "2025-01-08", "2025-02-03"
+        )
+    
+    @pytest.mark.parametrize("schedule, start, end, expected", [
+        # 每月1日是休市日或周末时，顺延到当月第一个交易日
+        (MonthStart(), "2025-01-01", "2025-06-30", [
+            "2025-01-02", "2025-02-03", "2025-03-04", "2025-04-01", "2025-05-05", "2025-06-03"
+        ]),
+        # 3月3日周一休市，顺延到周二
+        (Weekly(0), "2025-02-24", "2025-03-16", ["2025-02-24", "2025-03-04", "2025-03-10"]),
+        (Weekly("Friday"), "2025-01-01", "2025-02-05", [
+            "2025-01-03", "2025-01-10", "2025-01-17", "2025-01-24", "2025-02-03"
+        ]),
+        # 31日在2月和4月按当月最后一天处理
+        (CalendarDays(31, 15), "2025-01-01", "2025-04-30", [
+            "2025-01-15", "2025-02-03", "2025-02-17", "2025-02-28", "2025-03-17", "2025-03-31", "2025-04-15",
+            "2025-04-30"
+        ]),
+        (CalendarDays(1), "2025-01-01", "2025-06-30", [
+            "2025-01-02", "2025-02-03", "2025-03-04", "2025-04-01", "2025-05-05", "2025-06-03"
+        ]),
+    ])
+    def test_calendar_schedules(self, schedule, start, end, expected):
+        assert schedule.dates(start, end, HOLIDAYS) == _days(*expected)
+    
+    def test_month_start_skips_a_mid_month_start(self):
+        """回测从月中开始时，第一天不是月初"""
+        assert MonthStart().dates("2025-01-15", "2025-02-10", HOLIDAYS) == _days("2025-02-03")
+    
+    @pytest.mark.parametrize("make", [
+        lambda: Weekly(7),
+        lambda: Weekly("Funday"),
+        lambda: CalendarDays(),
+        lambda: CalendarDays(0),
+        lambda: CalendarDays(32),
+    ])
+    def test_invalid_schedules(self, make):
+        with pytest.raises(ValueError):
+            make()
+    
+    def test_repr(self):
+        assert repr(Weekly(2)) == "Weekly('Wednesday')"
+        assert repr(CalendarDays(31, 15, 15)) == "CalendarDays(15, 31)"
+
+
+class TestTargetOrders:
+    """目标权重订单测试类"""
+    
+    def test_normalize_weights(self):
+        assert normalize_weights({"A": 1.0, "B": 3.0, "C": 0.0}) == {"A": 0.25, "B": 0.75}
+        assert normalize_weights({}) == {}
+        with pytest.raises(ValueError, match="sum to 1"):
+            normalize_weights({"A": 0.5}, "reject")
+        with pytest.raises(ValueError):
+            normalize_weights({"A": -0.5, "B": 1.5})
+    
+    def test_lots_and_sells_first(self):
+        """目标持仓向下取整到整手，不在目标中的持仓（含零股）全部卖出"""
+        portfolio = Portfolio(100_000.0)
+        portfolio.buy("C", 150, 10.0)
+        
+        orders = target_orders(portfolio, {"A": 0.5, "B": 0.5}, {"A": 10.0, "B": 33.0, "C": 10.0})
+        
+        assert _orders(orders) == [
+            ("C", OrderSide.SELL, 150),
+            ("A", OrderSide.BUY, 5000),
+            ("B", OrderSide.BUY, 1500),
+        ]
+    
+    def test_min_trade_value_skips_dust(self):
+        portfolio = Portfolio(100_000.0)
+        portfolio.buy("A", 4950, 10.0)
+        
+        orders = target_orders(portfolio, {"A": 0.5, "B": 0.5}, {"A": 10.0, "B": 10.0}, min_trade_value=1000.0)
+        
+        assert _orders(orders) == [("B", OrderSide.BUY, 5000)]
+    
+    def test_turnover_cap(self):
+        orders = target_orders(Portfolio(100_000.0), {"A": 1.0}, {"A": 10.0}, max_turnover=0.25)
+        
+        assert _orders(orders) == [("A", OrderSide.BUY, 2500)]
+    
+    def test_instrument_without_price_is_skipped(self):
+        orders = target_orders(Portfolio(100_000.0), {"A": 0.5, "B": 0.5}, {"A": 10.0})
+        
+        assert _orders(orders) == [("A", OrderSide.BUY, 5000)]
+
+
+class TestTargetWeightStrategy:
+    """TargetWeightStrategy测试类"""
+    
+    @pytest.fixture
+    def data(self):
+        index = pd.bdate_range("2025-01-02", "2025-02-05")
+        return {
+            "SH600000": FeatureFrame({"$open": 10.0, "$close": 10.0}, index=index),
+            "SZ000001": FeatureFrame({"$open": 20.0, "$close": 20.0}, index=index),
+        }
+    
+    def _config(self, data, calendar):
+        return EngineConfig(
+            start_time="2025-01-01",
+            end_time="2025-02-05",
+            data=data,
+            initial_cash=100_000.0,
+            calendar=calendar
+        )
+    
+    def test_rebalances_at_month_end(self, data, calendar):
+        strategy = TargetWeightStrategy(
+            lambda ctx: {"SH600000": 0.5, "SZ000001": 1.5}, MonthEnd(), calendar=calendar
+        )
+        
+        result = run(self._config(data, calendar), strategy)
+        
+        assert strategy.rebalance_dates == _days("2025-01-30")
+        assert {t.time for t in result.trades} == {pd.Timestamp("2025-02-03")}
+        # 权重归一化为0.25和0.75，SZ000001的3750股取整为3700股
+        assert result.positions == {"SH600000": 2500, "SZ000001": 3700}
+    
+    def test_rejects_unnormalized_weights(self, data, calendar):
+        strategy = TargetWeightStrategy(
+            lambda ctx: {"SH600000": 0.5}, MonthEnd(), calendar=calendar, weight_policy="reject"
+        )
+        
+        with pytest.raises(BacktestError):
+            run(self._config(data, calendar), strategy)
+    
+    def test_uses_the_engine_calendar(self, data, calendar):
+        strategy = TargetWeightStrategy(lambda ctx: {"SH600000": 1.0}, MonthStart(), calendar=None)
+        
+        run(self._config(data, calendar), strategy)
+        
+        assert strategy.rebalance_dates == _days("2025-01-02", "2025-02-03")
+        with pytest.raises(BacktestError):
+            run(self._config(data, None), TargetWeightStrategy(lambda ctx: {}, MonthStart(), calendar=None))
+    
+    def test_context_is_due(self, data):
+        class Recorder(Strategy):
+            def __init__(self):
+                self.due = []
+            
+            def on_bar(self, ctx, portfolio, bars):
+                if ctx.is_due(Weekly("Friday")):
+                    self.due.append(ctx.time)
+        
+        strategy = Recorder()
+        
+        run(self._config(data, HOLIDAYS), strategy)
+        
+        assert strategy.due == _days("2025-01-03", "2025-01-10", "2025-01-17", "2025-01-24", "2025-02-03")
@@ -0,0 +1,97 @@
+"""
+Unit tests for RequestContext
+请求上下文单元测试
+"""
+
+import threading
+import time
+
+import pytest
+
+from src.utils.request_context import RequestContext, ContextCancelledError, background
+
+
+class TestRequestContext:
+    """RequestContext测试类"""
+    
+    def test_background_is_never_done(self):
+        """background()没有截止时间，也不会被取消"""
+        ctx = background()
+        
+        assert ctx.deadline is None
+        assert ctx.remaining() is None
+        assert ctx.err() is None
+        ctx.check()
+    
+    def test_cancel_sets_error(self):
+        """取消后check()抛出带原因的错误"""
+        ctx = RequestContext()
+        ctx.cancel("client went away")
+        
+        assert ctx.cancelled
+        assert not ctx.err().deadline_exceeded
+        with pytest.raises(ContextCancelledError) as exc_info:
+            ctx.check()
+        assert exc_info.value.reason == "client went away"
+        assert exc_info.value.error_info.error_code == "SYS0003"
+    
+    def test_deadline_exceeded(self):
+        """超过截止时间后视为已取消"""
+        ctx = RequestContext(timeout=0.01)
+        time.sleep(0.02)
+        
+        assert ctx.remaining() == 0.0
+        assert ctx.err().deadline_exceeded
+        assert ctx.err().error_info.error_code == "SYS0004"
+    
+    def test_first_error_wins(self):
+        """重复取消保留第一次的原因"""
+        ctx = RequestContext()
+        ctx.cancel("first")
+        ctx.cancel("second")
+        
+        assert ctx.err().reason == "first"
+    
+    def test_child_follows_parent(self):
+        """父上下文取消时子上下文一同取消，子上下文取消不影响父上下文"""
+        parent = RequestContext()
+        child = parent.child()
+        sibling = parent.child()
+        
+        child.cancel()
+        assert not parent.cancelled
+        assert not sibling.cancelled
+        
+        parent.cancel("shutdown")
+        assert sibling.err().reason == "shutdown"
+    
+    def test_child_deadline_is_earliest(self):
+        """子上下文的截止时间不晚于父上下文"""
+        parent = RequestContext(timeout=10)
+        
+        assert parent.child(timeout=60).deadline == parent.deadline
+        assert parent.child(timeout=1).deadline < parent.deadline
+    
+    def test_on_cancel_callbacks(self):
+        """取消时调用回调，已取消时注册的回调立即调用"""
+        ctx = RequestContext()
+        calls = []
+        ctx.on_cancel(lambda: calls.append("before"))
+        
+        ctx.cancel()
+        ctx.on_cancel(lambda: calls.append("after"))
+        
+        assert calls == ["before", "after"]
+    
+    def test_wait_returns_on_cancel(self):
+        """wait()在其他线程取消后返回"""
+        ctx = RequestContext()
+        timer = threading.Timer(0.01, ctx.cancel)
+        timer.start()
+        
+        assert ctx.wait(timeout=5)
+        timer.join()
+    
+    def test_wait_times_out(self):
+        """未取消时wait()在超时后返回False"""
+        assert not RequestContext().wait(timeout=0.01)
@@ -0,0 +1,120 @@
+"""
+请求时间解析单元测试 / Request Time Parsing Unit Tests
+"""
+
+from datetime import date, datetime
+
+import pandas as pd
+import pytest
+
+from src.core.request_time import (
+    RequestTimeError,
+    check_timezone,
+    format_request_time,
+    parse_request_range,
+    parse_request_time
+)
+
+
+class TestParseRequestTime:
+    """请求时间解析测试类"""
+    
+    def test_date_only_is_exchange_midnight(self):
+        assert parse_request_time("2025-01-01", "start_time") == pd.Timestamp("2025-01-01")
+        assert parse_request_time("2025-01-01", "start_time", "America/New_York") == pd.Timestamp("2025-01-01")
+    
+    @pytest.mark.parametrize("value, expected", [
+        ("2025-01-01T09:30:00+08:00", "2025-01-01 09:30:00"),
+        ("2025-01-01T01:30:00Z", "2025-01-01 09:30:00"),
+        ("2024-12-31T20:30:00-05:00", "2025-01-01 09:30:00"),
+        ("2025-01-01T09:30:00.250+08:00", "2025-01-01 09:30:00.250"),
+    ])
+    def test_rfc3339_converted_to_exchange_time(self, value, expected):
+        ts = parse_request_time(value, "start_time")
+        
+        assert ts == pd.Timestamp(expected)
+        assert ts.tzinfo is None
+    
+    def test_exchange_timezone(self):
+        assert parse_request_time("2025-01-01T14:30:00Z", "start_time", "America/New_York") == \
+            pd.Timestamp("2025-01-01 09:30")
+    
+    def test_datetime_objects(self):
+        """不带时区的对象视为交易所本地时间 / Naive objects are exchange-local"""
+        assert parse_request_time(date(2025, 1, 1), "start_time") == pd.Timestamp("2025-01-01")
+        assert parse_request_time(datetime(2025, 1, 1, 9, 30), "start_time") == pd.Timestamp("2025-01-01 09:30")
+        aware = pd.Timestamp("2025-01-01 01:30", tz="UTC")
+        assert parse_request_time(aware, "start_time") == pd.Timestamp("2025-01-01 09:30")
+    
+    def test_empty_is_unbounded(self):
+        assert parse_request_time(None, "start_time") is None
+        assert parse_request_time("", "start_time") is None
+    
+    @pytest.mark.parametrize("value", [
+        "not-a-date",
+        "2025/01/01",
+        "20250101",
+        "2025-01-01 09:30",
+        "2025-01-01T09:30:00",
+        "2025-01-01T09:30+08:00",
+        "2025-02-30",
+        "2025-13-01T09:30:00+08:00",
+    ])
+    def test_rejected_strings_name_the_field(self, value):
+        with pytest.raises(RequestTimeError) as exc_info:
+            parse_request_time(value, "end_time")
+        
+        assert exc_info.value.field == "end_time"
+        assert exc_info.value.value == value
+        assert "end_time" in str(exc_info.value)
+    
+    def test_rejected_type(self):
+        with pytest.raises(RequestTimeError, match="start_time"):
+            parse_request_time(20250101, "start_time")
+
+
+class TestParseRequestRange:
+    """请求区间解析测试类"""
+    
+    def test_range(self):
+        start, end = parse_request_range("2025-01-01", "2025-01-02T15:00:00+08:00")
+        
+        assert (start, end) == (pd.Timestamp("2025-01-01"), pd.Timestamp("2025-01-02 15:00"))
+        assert parse_request_range(None, "2025-01-02") == (None, pd.Timestamp("2025-01-02"))
+    
+    def test_inverted_range(self):
+        with pytest.raises(RequestTimeError) as exc_info:
+            parse_request_range("2025-02-01", "2025-01-01")
+        
+        assert exc_info.value.field == "start_time"
+        assert "start_time 2025-02-01 is after end_time 2025-01-01" in str(exc_info.value)
+    
+    def test_inverted_after_conversion(self):
+        """比较的是换算到交易所时区后的时间 / Times are compared after conversion"""
+        with pytest.raises(RequestTimeError, match="after"):
+            parse_request_range("2025-01-01T10:00:00+08:00", "2025-01-01T01:00:00Z")
+    
+    def test_date_only_end_includes_the_day(self):
+        start, end = parse_request_range("2025-01-01T09:30:00+08:00", "2025-01-01")
+        
+        assert start == pd.Timestamp("2025-01-01 09:30")
+        with pytest.raises(RequestTimeError):
+            parse_request_range("2025-01-02T00:00:00+08:00", "2025-01-01")
+    
+    def test_field_names(self):
+        with pytest.raises(RequestTimeError, match="invalid start:"):
+            parse_request_range("bad", None, start_field="start", end_field="end")
+    
+    def test_unknown_timezone(self):
+        with pytest.raises(ValueError, match="timezone"):
+            parse_request_range("2025-01-01", None, timezone="Mars/Olympus")
+        assert check_timezone("UTC") == "UTC"
+
+
+class TestFormatRequestTime:
+    """请求时间格式化测试类"""
+    
+    def test_format(self):
+        assert format_request_time(pd.Timestamp("2025-01-01")) == "2025-01-01"
+        assert format_request_time(pd.Timestamp("2025-01-01 09:30")) == "2025-01-01 09:30:00"
+        assert format_request_time(None) is None
@@ -0,0 +1,151 @@
+"""
+Unit tests for retry policies
+重试策略单元测试
+"""
+
+import threading
+import time
+
+import pytest
+
+from src.utils.error_handler import DataError, ErrorCategory, ErrorInfo, ErrorSeverity, NetworkError
+from src.utils.request_context import ContextCancelledError, RequestContext
+from src.utils.retry import RetryExhaustedError, RetryPolicy
+
+
+def _network_error():
+    return NetworkError(ErrorInfo(
+        error_code="NET0001",
+        error_message_zh="连接失败",
+        error_message_en="Connection failed",
+        category=ErrorCategory.NETWORK,
+        severity=ErrorSeverity.MEDIUM,
+        technical_details="",
+        suggested_actions=[]
+    ))
+
+
+class Flaky:
+    """前failures次调用抛出error / Raises error on the first failures calls"""
+    
+    def __init__(self, failures, error=ConnectionError):
+        self.failures = failures
+        self.error = error
+        self.calls = 0
+    
+    def __call__(self):
+        self.calls += 1
+        if self.calls <= self.failures:
+            raise self.error() if isinstance(self.error, type) else self.error
+        return "ok"
+
+
+class TestRetryPolicy:
+    """RetryPolicy测试类"""
+    
+    def test_delay_grows_exponentially_up_to_max(self):
+        """等待时间按倍数增长，不超过max_delay"""
+        policy = RetryPolicy(initial_delay=0.5, multiplier=2.0, max_delay=3.0, jitter=0.0)
+        
+        assert [policy.delay(n) for n in range(1, 5)] == [0.5, 1.0, 2.0, 3.0]
+    
+    def test_jitter_bounds(self):
+        """抖动在[1 - jitter, 1 + jitter]倍之间"""
+        policy = RetryPolicy(initial_delay=1.0, jitter=0.2)
+        
+        delays = [policy.delay(1) for _ in range(200)]
+        
+        assert all(0.8 <= d <= 1.2 for d in delays)
+        assert len(set(delays)) > 1
+    
+    def test_seeded_jitter_is_reproducible(self):
+        """相同种子给出相同的等待序列"""
+        delays = lambda seed: [RetryPolicy(jitter=0.5, seed=seed).delay(n) for n in range(1, 4)]
+        
+        assert delays(7) == delays(7)
+        assert delays(7) != delays(8)
+    
+    @pytest.mark.parametrize("kwargs", [
+        {"max_attempts": 0},
+        {"initial_delay": -1.0},
+        {"multiplier": 0.5},
+        {"jitter": 1.5},
+    ])
+    def test_invalid_policy(self, kwargs):
+        with pytest.raises(ValueError):
+            RetryPolicy(**kwargs)
+    
+    @pytest.mark.parametrize("error", [ConnectionError, TimeoutError, _network_error()])
+    def test_transient_errors_are_retried(self, error):
+        """暂时性错误重试后成功"""
+        policy = RetryPolicy(max_attempts=3, initial_delay=0.0)
+        fn = Flaky(2, error)
+        
+        assert policy.call(RequestContext(), fn) == "ok"
+        assert fn.calls == 3
+    
+    def test_exhausted(self):
+        """重试用尽时记录最后的错误和标的"""
+        policy = RetryPolicy(max_attempts=2, initial_delay=0.0)
+        retries = []
+        
+        with pytest.raises(RetryExhaustedError) as exc_info:
+            policy.call(
+                RequestContext(), Flaky(5), instrument="SH600000",
+                on_retry=lambda attempt, error, wait: retries.append(attempt)
+            )
+        
+        error = exc_info.value
+        assert error.instrument == "SH600000"
+        assert error.attempts == 2
+        assert isinstance(error.last_error, ConnectionError)
+        assert error.__cause__ is error.last_error
+        assert retries == [1]
+    
+    def test_permanent_error_is_not_retried(self):
+        """非暂时性错误立即抛出"""
+        policy = RetryPolicy(max_attempts=5, initial_delay=0.0)
+        fn = Flaky(1, ValueError)
+        
+        with pytest.raises(ValueError):
+            policy.call(RequestContext(), fn)
+        assert fn.calls == 1
+    
+    def test_data_error_is_not_retried(self):
+        policy = RetryPolicy(max_attempts=5, initial_delay=0.0)
+        fn = Flaky(1, DataError(ErrorInfo(
+            error_code="DAT0010",
+            error_message_zh="没有数据",
+            error_message_en="No data",
+            category=ErrorCategory.DATA,
+            severity=ErrorSeverity.MEDIUM,
+            technical_details="",
+            suggested_actions=[]
+        )))
+        
+        with pytest.raises(DataError):
+            policy.call(RequestContext(), fn)
+        assert fn.calls == 1
+    
+    def test_cancel_during_backoff(self):
+        """退避期间取消上下文立即停止"""
+        policy = RetryPolicy(max_attempts=3, initial_delay=10.0, jitter=0.0)
+        ctx = RequestContext()
+        threading.Timer(0.05, ctx.cancel).start()
+        fn = Flaky(5)
+        
+        begin = time.monotonic()
+        with pytest.raises(ContextCancelledError):
+            policy.call(ctx, fn)
+        
+        assert time.monotonic() - begin < 2
+        assert fn.calls == 1
+    
+    def test_deadline_during_backoff(self):
+        """退避超过截止时间时抛出超时错误"""
+        policy = RetryPolicy(max_attempts=3, initial_delay=10.0, jitter=0.0)
+        
+        with pytest.raises(ContextCancelledError) as exc_info:
+            policy.call(RequestContext(timeout=0.05), Flaky(5))
+        
+        assert exc_info.value.deadline_exceeded
@@ -0,0 +1,126 @@
+"""
+Unit tests for rolling window operations
+滚动窗口单元测试
+"""
+
+import math
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.rolling import Rolling, rolling
+
+
+@pytest.fixture
+def series():
+    rng = np.random.default_rng(7)
+    values = 100.0 + np.cumsum(rng.normal(0, 1, 300))
+    values[[5, 6, 50, 120, 121, 122]] = np.nan
+    return values
+
+
+def _assert_matches(result, expected):
+    expected = list(expected)
+    assert len(result) == len(expected)
+    for got, want in zip(result, expected):
+        if math.isnan(want):
+            assert math.isnan(got)
+        else:
+            assert got == pytest.approx(want, rel=1e-9, abs=1e-9)
+
+
+class TestRolling:
+    """滚动窗口测试类"""
+    
+    @pytest.mark.parametrize("method", ["mean", "sum", "std", "min", "max"])
+    @pytest.mark.parametrize("window,min_periods", [(1, None), (5, None), (20, None), (20, 10), (400, 1)])
+    def test_matches_pandas(self, series, method, window, min_periods):
+        """结果与pandas的rolling一致（包括NaN和min_periods）"""
+        result = getattr(rolling(series, window, min_periods), method)()
+        
+        expected = getattr(
+            pd.Series(series).rolling(window, min_periods=min_periods or window), method
+        )()
+        _assert_matches(result, expected)
+    
+    def test_lead_in(self):
+        result = rolling([1.0, 2.0, 3.0, 4.0], 3).mean()
+        
+        assert math.isnan(result[0]) and math.isnan(result[1])
+        assert result[2:] == pytest.approx([2.0, 3.0])
+    
+    def test_min_periods_with_nan(self):
+        values = [1.0, float("nan"), 3.0, float("nan"), 5.0]
+        
+        strict = rolling(values, 3).mean()
+        relaxed = rolling(values, 3, min_periods=2).mean()
+        
+        assert all(math.isnan(v) for v in strict)
+        assert math.isnan(relaxed[1])
+        assert relaxed[2:] == pytest.approx([2.0, 3.0, 4.0])
+    
+    def test_extrema_ignore_nan(self):
+        values = [3.0, float("nan"), 1.0, 4.0, float("nan"), 2.0]
+        
+        assert rolling(values, 3, min_periods=1).max() == pytest.approx([3.0, 3.0, 3.0, 4.0, 4.0, 4.0])
+        assert rolling(values, 3, min_periods=1).min() == pytest.approx([3.0, 3.0, 1.0, 1.0, 1.0, 2.0])
+    
+    def test_std_is_stable_for_large_values(self):
+        """大数值上的小波动不会因累加和相减而丢失精度"""
+        values = 1e6 + np.tile([0.0, 0.001, 0.002], 100_000)
+        
+        result = rolling(values, 3).std()
+        
+        assert result[-1] == pytest.approx(0.001, rel=1e-4)
+        assert min(result[2:]) >= 0.0
+    
+    def test_rank(self):
+        values = [3.0, 1.0, 2.0, 2.0, float("nan"), 5.0]
+        
+        result = rolling(values, 3, min_periods=1).rank()
+        
+        assert result[0] == pytest.approx(1.0)
+        assert result[1] == pytest.approx(0.5)
+        assert result[2] == pytest.approx(2 / 3)
+        # 与前一个2.0并列，平均排名(1 + 2) / 2 = 1.5
+        assert result[3] == pytest.approx(1.5 / 3)
+        assert math.isnan(result[4])
+        assert result[5] == pytest.approx(1.0)
+    
+    def test_rank_matches_pandas(self, series):
+        result = rolling(series, 10).rank()
+        
+        expected = pd.Series(series).rolling(10).rank(pct=True)
+        _assert_matches(result, expected)
+    
+    def test_corr_and_cov_match_pandas(self, series):
+        rng = np.random.default_rng(8)
+        other = series * 0.5 + rng.normal(0, 1, len(series))
+        other[[10, 200]] = np.nan
+        
+        x, y = pd.Series(series), pd.Series(other)
+        _assert_matches(rolling(series, 20).cov(other), x.rolling(20).cov(y))
+        _assert_matches(rolling(series, 20).corr(other), x.rolling(20).corr(y))
+    
+    def test_corr_with_constant_is_nan(self):
+        result = rolling([1.0, 2.0, 3.0, 4.0], 3).corr([5.0, 5.0, 5.0, 5.0])
+        
+        assert all(math.isnan(v) for v in result)
+    
+    def test_long_series(self):
+        """分钟线长度的序列在O(n)内完成"""
+        values = np.random.default_rng(9).normal(0, 1, 1_000_000)
+        
+        result = Rolling(values, 240).max()
+        
+        assert len(result) == len(values)
+        assert result[-1] == pytest.approx(values[-240:].max())
+    
+    def test_invalid_arguments(self):
+        with pytest.raises(ValueError):
+            rolling([1.0], 0)
+        with pytest.raises(ValueError):
+            rolling([1.0], 3, min_periods=4)
+        with pytest.raises(ValueError):
+            rolling([1.0, 2.0], 2).corr([1.0])
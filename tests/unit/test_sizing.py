@@ -0,0 +1,152 @@
+"""
+Unit tests for position sizing
+仓位管理单元测试
+"""
+
+import math
+import statistics
+
+import pandas as pd
+import pytest
+
+from src.application.backtest_engine import AShareCostModel, EngineConfig, OrderSide, run
+from src.application.sizing import FixedFraction, FixedShares, SignalStrategy, VolatilityTarget
+from src.core.feature_frame import FeatureFrame
+from src.core.portfolio import Portfolio
+
+
+def _order(order):
+    return None if order is None else (order.instrument, order.side, order.quantity)
+
+
+def _volatile(r, n=20):
+    """正负交替的收益率 / Returns alternating between +r and -r"""
+    return [r if i % 2 else -r for i in range(n)]
+
+
+class TestSizers:
+    """仓位管理规则测试类"""
+    
+    def test_fixed_shares(self):
+        portfolio = Portfolio(100_000.0)
+        portfolio.buy("SH600000", 300, 10.0)
+        
+        assert _order(FixedShares(1000).order("SH600000", 1.0, portfolio, 10.0)) == ("SH600000", OrderSide.BUY, 700)
+        assert _order(FixedShares(1000).order("SH600000", -0.2, portfolio, 10.0)) == (
+            "SH600000", OrderSide.SELL, 1300
+        )
+        assert _order(FixedShares(300).order("SH600000", 1.0, portfolio, 10.0)) is None
+        with pytest.raises(ValueError):
+            FixedShares(150)
+    
+    def test_fixed_fraction(self):
+        portfolio = Portfolio(100_000.0)
+        sizer = FixedFraction(0.1)
+        
+        assert sizer.quantity("SH600000", 1.0, portfolio, 10.0) == 1000
+        # 信号缩放仓位，并向零取整到整手
+        assert sizer.quantity("SH600000", 0.5, portfolio, 33.0) == 100
+        assert sizer.quantity("SH600000", -1.0, portfolio, 10.0) == -1000
+        assert sizer.quantity("SH600000", 0.0, portfolio, 10.0) == 0
+        with pytest.raises(ValueError):
+            FixedFraction(1.5)
+        with pytest.raises(ValueError):
+            sizer.quantity("SH600000", float("nan"), portfolio, 10.0)
+    
+    def test_volatility_target(self):
+        portfolio = Portfolio(1_000_000.0)
+        sizer = VolatilityTarget(0.15, lookback=20, lot_size=1)
+        vol = statistics.stdev(_volatile(0.02)) * math.sqrt(252)
+        
+        assert sizer.target(1.0, portfolio, 10.0, _volatile(0.02)) == pytest.approx(0.15 / vol * 100_000)
+        # 波动率翻倍，仓位减半
+        assert sizer.target(1.0, portfolio, 10.0, _volatile(0.04)) == pytest.approx(0.15 / vol * 50_000)
+        # 只使用最近lookback期，更早的NaN不影响
+        assert sizer.target(1.0, portfolio, 10.0, [float("nan")] * 5 + _volatile(0.02)) == pytest.approx(
+            sizer.target(1.0, portfolio, 10.0, _volatile(0.02))
+        )
+    
+    def test_volatility_target_limits(self):
+        portfolio = Portfolio(1_000_000.0)
+        sizer = VolatilityTarget(0.15, lookback=20, max_leverage=2.0)
+        
+        # 低波动时按max_leverage持仓，波动为0时也是
+        assert sizer.target(1.0, portfolio, 10.0, _volatile(0.0001)) == pytest.approx(200_000)
+        assert sizer.target(1.0, portfolio, 10.0, [0.0] * 20) == pytest.approx(200_000)
+        # 收益率不足lookback期时不交易
+        assert sizer.target(1.0, portfolio, 10.0, _volatile(0.02, n=19)) is None
+        assert sizer.order("SH600000", 1.0, portfolio, 10.0, returns=_volatile(0.02, n=19)) is None
+        with pytest.raises(ValueError):
+            sizer.target(1.0, portfolio, 10.0)
+        with pytest.raises(ValueError):
+            VolatilityTarget(0.15, lookback=1)
+
+
+class TestInsufficientCash:
+    """现金不足时缩小仓位测试类"""
+    
+    def test_scales_down_to_affordable_lots(self):
+        portfolio = Portfolio(10_000.0)
+        
+        # 目标为2000股，现金只够买1000股
+        assert FixedShares(2000).quantity("SH600000", 1.0, portfolio, 10.0) == 1000
+        assert FixedFraction(1.0).quantity("SH600000", 1.0, portfolio, 10.0, cash=5050.0) == 500
+    
+    def test_fees_are_included(self):
+        """1000股需要10000元加5元最低佣金，只能买900股"""
+        portfolio = Portfolio(10_000.0)
+        costs = AShareCostModel()
+        
+        order = FixedFraction(1.0).order("SH600000", 1.0, portfolio, 10.0, cost_model=costs)
+        
+        assert _order(order) == ("SH600000", OrderSide.BUY, 900)
+        portfolio.buy("SH600000", 900, 10.0, costs.commission(order, 10.0) + costs.tax(order, 10.0))
+    
+    def test_nothing_affordable(self):
+        portfolio = Portfolio(500.0)
+        
+        assert FixedShares(100).order("SH600000", 1.0, portfolio, 10.0) is None
+        # 卖出不受现金限制
+        assert FixedShares(100).quantity("SH600000", -1.0, portfolio, 10.0) == -100
+
+
+class TestSignalStrategy:
+    """SignalStrategy测试类"""
+    
+    @pytest.fixture
+    def data(self):
+        index = pd.bdate_range("2025-01-02", periods=5)
+        return {
+            "SH600000": FeatureFrame({"$open": 10.0, "$close": 10.0}, index=index),
+            "SZ000001": FeatureFrame({"$open": 20.0, "$close": 20.0}, index=index),
+        }
+    
+    def _config(self, data, **kwargs):
+        return EngineConfig(start_time="2025-01-01", end_time="2025-01-31", data=data, initial_cash=100_000.0, **kwargs)
+    
+    def test_buys_share_the_cash(self, data):
+        """第一笔买单用完现金后，第二笔不再下单，而不是被引擎拒绝"""
+        strategy = SignalStrategy(lambda ctx: {"SH600000": 1.0, "SZ000001": 1.0}, FixedFraction(1.0))
+        
+        result = run(self._config(data), strategy)
+        
+        assert result.positions == {"SH600000": 10_000}
+        assert result.rejected_orders == []
+    
+    def test_scaled_order_fills_with_fees(self, data):
+        costs = AShareCostModel()
+        strategy = SignalStrategy(lambda ctx: {"SH600000": 1.0}, FixedFraction(1.0), cost_model=costs)
+        
+        result = run(self._config(data, cost_model=costs), strategy)
+        
+        assert result.positions == {"SH600000": 9_900}
+        assert result.rejected_orders == []
+    
+    def test_volatility_target_waits_for_history(self, data):
+        strategy = SignalStrategy(lambda ctx: {"SH600000": 1.0}, VolatilityTarget(0.15, lookback=3))
+        
+        result = run(self._config(data), strategy)
+        
+        # 第4根K线才有3期收益率；价格不变，波动为0，按权益全额持仓
+        assert [t.time for t in result.trades] == [pd.Timestamp("2025-01-08")]
+        assert result.positions == {"SH600000": 10_000}
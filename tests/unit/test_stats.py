@@ -0,0 +1,80 @@
+"""
+Unit tests for NaN-aware statistics
+忽略NaN的统计函数单元测试
+"""
+
+import math
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core import stats
+
+
+NAN = float("nan")
+
+
+def _same(actual, expected):
+    if math.isnan(expected):
+        return math.isnan(actual)
+    return actual == pytest.approx(expected)
+
+
+class TestNanReductions:
+    """nan_sum/nan_mean/nan_std测试类"""
+    
+    @pytest.mark.parametrize("values,expected_sum,expected_mean,expected_std", [
+        ([1.0, 2.0, 3.0, 4.0], 10.0, 2.5, np.std([1.0, 2.0, 3.0, 4.0], ddof=1)),
+        ([1.0, NAN, 3.0, NAN], 4.0, 2.0, np.std([1.0, 3.0], ddof=1)),
+        ([NAN, NAN, NAN], NAN, NAN, NAN),
+        ([], NAN, NAN, NAN),
+        ([NAN, 5.0], 5.0, 5.0, NAN),
+        (pd.Series([2.0, NAN, 4.0]), 6.0, 3.0, np.std([2.0, 4.0], ddof=1)),
+        (np.array([-1.0, 1.0, NAN]), 0.0, 0.0, np.std([-1.0, 1.0], ddof=1)),
+    ])
+    def test_reductions(self, values, expected_sum, expected_mean, expected_std):
+        assert _same(stats.nan_sum(values), expected_sum)
+        assert _same(stats.nan_mean(values), expected_mean)
+        assert _same(stats.nan_std(values), expected_std)
+    
+    def test_population_std(self):
+        assert stats.nan_std([1.0, NAN, 3.0], ddof=0) == pytest.approx(1.0)
+    
+    def test_all_nan_does_not_warn(self):
+        """全部为NaN时不产生numpy的RuntimeWarning"""
+        with np.errstate(all="raise"):
+            assert math.isnan(stats.nan_mean([NAN, NAN]))
+            assert math.isnan(stats.nan_std([NAN, NAN]))
+    
+    def test_two_dimensional_input(self):
+        with pytest.raises(ValueError):
+            stats.nan_mean([[1.0, 2.0]])
+
+
+class TestNanCorrelation:
+    """nan_correlation测试类"""
+    
+    @pytest.mark.parametrize("a,b,expected", [
+        ([1.0, 2.0, 3.0], [2.0, 4.0, 6.0], 1.0),
+        ([1.0, 2.0, 3.0], [3.0, 2.0, 1.0], -1.0),
+        # 只使用两边都有值的位置：(1, 1), (3, 3), (4, 4)
+        ([1.0, NAN, 3.0, 4.0, 5.0], [1.0, 2.0, 3.0, 4.0, NAN], 1.0),
+        ([1.0, 2.0, NAN, 4.0], [2.0, 1.0, 9.0, 3.0], np.corrcoef([1.0, 2.0, 4.0], [2.0, 1.0, 3.0])[0, 1]),
+        ([1.0, 1.0, 1.0], [1.0, 2.0, 3.0], NAN),
+    ])
+    def test_values(self, a, b, expected):
+        assert _same(stats.nan_correlation(a, b), expected)
+    
+    @pytest.mark.parametrize("a,b", [
+        ([NAN, NAN, NAN], [NAN, NAN, NAN]),
+        ([1.0, NAN, 3.0], [NAN, 2.0, 3.0]),
+        ([], []),
+    ])
+    def test_fewer_than_two_pairs(self, a, b):
+        with pytest.raises(stats.InsufficientDataError):
+            stats.nan_correlation(a, b)
+    
+    def test_length_mismatch(self):
+        with pytest.raises(ValueError):
+            stats.nan_correlation([1.0, 2.0], [1.0, 2.0, 3.0])
@@ -0,0 +1,220 @@
+"""
+Unit tests for live bar subscriptions
+实时K线订阅单元测试
+"""
+
+import threading
+
+import pandas as pd
+import pytest
+
+from src.infrastructure.data_provider import FieldNotFoundError, InstrumentNotFoundError
+from src.infrastructure.replay_provider import ReplayDataProvider
+from src.infrastructure.subscription import LiveBar, PollingFeed, Subscription
+from src.utils.request_context import RequestContext
+
+
+def bar(time, close, code="SH600000"):
+    return LiveBar(code, pd.Timestamp(time), {"$close": close})
+
+
+def minute_frame(times, closes):
+    index = pd.DatetimeIndex(pd.to_datetime(times), name="datetime")
+    return pd.DataFrame({"$close": closes}, index=index)
+
+
+@pytest.fixture
+def subscription():
+    return Subscription(RequestContext(), ["SH600000"], ["$close"], "1min")
+
+
+def drain(subscription):
+    """读取已缓冲的K线 / Read the buffered bars"""
+    bars = []
+    while True:
+        item, ok = subscription.next(timeout=0)
+        if item is None:
+            return bars
+        bars.append(item)
+
+
+class TestSubscription:
+    """Subscription测试类"""
+    
+    def test_duplicate_bar_is_dropped(self, subscription):
+        """时间和值都相同的K线只投递一次"""
+        assert subscription.publish(bar("2025-01-02 09:31", 10.0))
+        assert not subscription.publish(bar("2025-01-02 09:31", 10.0))
+        
+        bars = drain(subscription)
+        assert len(bars) == 1
+        assert not bars[0].revised
+    
+    def test_changed_values_are_revised(self, subscription):
+        """已投递时间的值改变时以revised投递"""
+        subscription.publish(bar("2025-01-02 09:31", 10.0))
+        subscription.publish(bar("2025-01-02 09:31", 10.5))
+        
+        bars = drain(subscription)
+        assert [b["$close"] for b in bars] == [10.0, 10.5]
+        assert [b.revised for b in bars] == [False, True]
+    
+    def test_late_bar_is_revised(self, subscription):
+        """早于最新已投递时间的K线以revised投递"""
+        subscription.publish(bar("2025-01-02 09:32", 10.0))
+        subscription.publish(bar("2025-01-02 09:31", 9.0))
+        subscription.publish(bar("2025-01-02 09:33", 11.0))
+        
+        bars = drain(subscription)
+        assert [b.revised for b in bars] == [False, True, False]
+    
+    def test_unsubscribed_instrument_is_dropped(self, subscription):
+        """未订阅的标的不投递"""
+        assert not subscription.publish(bar("2025-01-02 09:31", 10.0, code="SZ000001"))
+        assert drain(subscription) == []
+    
+    def test_publish_frame_sorts_by_time(self, subscription):
+        """publish_frame按时间升序投递，缺少的字段为NaN"""
+        frame = minute_frame(["2025-01-02 09:33", "2025-01-02 09:31"], [11.0, 10.0])
+        
+        assert subscription.publish_frame("SH600000", frame) == 2
+        bars = drain(subscription)
+        assert [b.time for b in bars] == list(pd.to_datetime(["2025-01-02 09:31", "2025-01-02 09:33"]))
+        assert not any(b.revised for b in bars)
+    
+    def test_cancel_closes_after_buffered_bars(self):
+        """取消上下文后已缓冲的K线仍可读取，之后迭代结束"""
+        ctx = RequestContext()
+        subscription = Subscription(ctx, ["SH600000"], ["$close"], "1min")
+        subscription.publish(bar("2025-01-02 09:31", 10.0))
+        
+        ctx.cancel()
+        
+        assert subscription.closed
+        assert not subscription.publish(bar("2025-01-02 09:32", 10.5))
+        assert [b["$close"] for b in subscription] == [10.0]
+        assert subscription.next(timeout=0) == (None, False)
+        assert subscription.error is None
+    
+    def test_next_times_out_while_open(self, subscription):
+        """打开时超时返回(None, True)"""
+        assert subscription.next(timeout=0.01) == (None, True)
+    
+    def test_close_records_error(self, subscription):
+        """生产者出错时记录错误"""
+        error = RuntimeError("feed down")
+        subscription.close(error)
+        subscription.close()
+        
+        assert subscription.error is error
+        assert list(subscription) == []
+
+
+class TestPollingFeed:
+    """PollingFeed测试类"""
+    
+    def test_poll_publishes_new_and_revised_bars(self, subscription):
+        """轮询投递新K线，数据源修订的K线再次投递"""
+        source = {"frame": minute_frame(["2025-01-02 09:30", "2025-01-02 09:31"], [10.0, 10.2])}
+        calls = []
+        
+        def loader(ctx, code, fields, start_time=None, end_time=None, freq="day"):
+            calls.append((code, start_time, end_time, freq))
+            frame = source["frame"]
+            return frame[(frame.index >= start_time) & (frame.index <= end_time)]
+        
+        feed = PollingFeed(loader, subscription, revision_bars=2)
+        assert feed.poll(pd.Timestamp("2025-01-02 09:31")) == 2
+        
+        source["frame"] = minute_frame(
+            ["2025-01-02 09:30", "2025-01-02 09:31", "2025-01-02 09:32"], [10.0, 10.3, 10.4]
+        )
+        assert feed.poll(pd.Timestamp("2025-01-02 09:32")) == 2
+        
+        bars = drain(subscription)
+        assert [(b.time.minute, b["$close"], b.revised) for b in bars] == [
+            (30, 10.0, False), (31, 10.2, False), (31, 10.3, True), (32, 10.4, False)
+        ]
+        assert calls[0] == (
+            "SH600000", pd.Timestamp("2025-01-02 09:29"), pd.Timestamp("2025-01-02 09:31"), "1min"
+        )
+    
+    def test_poll_failure_is_skipped(self, subscription):
+        """加载失败不会中断轮询"""
+        def loader(ctx, code, fields, start_time=None, end_time=None, freq="day"):
+            raise IOError("source unavailable")
+        
+        feed = PollingFeed(loader, subscription)
+        
+        assert feed.poll(pd.Timestamp("2025-01-02 09:31")) == 0
+        assert not subscription.closed
+
+
+class TestReplayDataProvider:
+    """ReplayDataProvider测试类"""
+    
+    def test_replay_delivers_in_order_and_closes(self):
+        """回放按时间投递所有标的，结束后关闭订阅"""
+        provider = ReplayDataProvider({
+            "A": minute_frame(["2025-01-02 09:31", "2025-01-02 09:33"], [1.0, 3.0]),
+            "B": minute_frame(["2025-01-02 09:32"], [2.0]),
+        }, freq="1min")
+        
+        bars = list(provider.subscribe(RequestContext(), ["A", "B"], ["$close"], "1min"))
+        
+        assert [(b.instrument, b["$close"]) for b in bars] == [("A", 1.0), ("B", 2.0), ("A", 3.0)]
+    
+    def test_replay_late_and_revised_rows(self):
+        """迟到和重复时间的行以revised投递，完全相同的行被丢弃"""
+        frame = minute_frame(
+            ["2025-01-02 09:31", "2025-01-02 09:33", "2025-01-02 09:32",
+             "2025-01-02 09:33", "2025-01-02 09:33"],
+            [1.0, 3.0, 2.0, 3.5, 3.5]
+        )
+        provider = ReplayDataProvider({"A": frame}, freq="1min")
+        
+        bars = list(provider.subscribe(RequestContext(), ["A"], ["$close"], "1min"))
+        
+        assert [(b.time.minute, b["$close"], b.revised) for b in bars] == [
+            (31, 1.0, False), (33, 3.0, False), (32, 2.0, True), (33, 3.5, True)
+        ]
+    
+    def test_load_features_keeps_last_revision(self):
+        """load_features按时间排序，重复时间保留最后一行"""
+        frame = minute_frame(["2025-01-02 09:32", "2025-01-02 09:31", "2025-01-02 09:32"], [2.0, 1.0, 2.5])
+        provider = ReplayDataProvider({"A": frame}, freq="1min")
+        
+        result = provider.load_features("A", ["$close"], freq="1min")
+        
+        assert list(result["$close"]) == [1.0, 2.5]
+    
+    def test_load_features_typed_errors(self):
+        """未知标的和缺失字段抛出对应的错误，而不是返回空数据或NaN列"""
+        provider = ReplayDataProvider({"A": minute_frame(["2025-01-02 09:31"], [1.0])}, freq="1min")
+        
+        with pytest.raises(InstrumentNotFoundError):
+            provider.load_features("B", ["$close"], freq="1min")
+        with pytest.raises(FieldNotFoundError) as exc_info:
+            provider.load_features("A", ["$close", "$vwap"], freq="1min")
+        
+        assert exc_info.value.fields == ["$vwap"]
+    
+    def test_cancel_stops_slow_replay(self):
+        """取消上下文后慢速回放立即结束"""
+        frame = minute_frame(["2025-01-02 09:31", "2025-01-02 09:32"], [1.0, 2.0])
+        provider = ReplayDataProvider({"A": frame}, freq="1min", speed=1)
+        ctx = RequestContext()
+        subscription = provider.subscribe(ctx, ["A"], ["$close"], "1min")
+        
+        first, ok = subscription.next(timeout=5)
+        assert ok and first["$close"] == 1.0
+        
+        timer = threading.Timer(0.05, ctx.cancel)
+        timer.start()
+        assert list(subscription) == []
+        timer.join()
+    
+    def test_invalid_speed(self):
+        """回放速度必须为正数"""
+        with pytest.raises(ValueError):
+            ReplayDataProvider({}, speed=0)
@@ -0,0 +1,183 @@
+"""
+Unit tests for trading calendars
+交易日历单元测试
+"""
+
+import pytest
+import pandas as pd
+
+from src.core.trading_calendar import (
+    TradingCalendar,
+    ContinuousCalendar,
+    get_calendar,
+    register_calendar,
+    trading_days
+)
+from src.utils.error_handler import DataError
+
+
+@pytest.fixture
+def sse():
+    """内置的上交所日历"""
+    return get_calendar("SSE")
+
+
+class TestTradingCalendar:
+    """TradingCalendar测试类"""
+    
+    def test_weekends_and_holidays(self, sse):
+        """周末和春节不是交易日"""
+        assert sse.is_trading_day("2025-01-27")
+        assert not sse.is_trading_day("2025-01-25")  # Saturday
+        assert not sse.is_trading_day("2025-01-29")  # Spring Festival
+        assert not sse.is_trading_day("2025-02-08")  # make-up working Saturday
+    
+    def test_next_and_prev_skip_holidays(self, sse):
+        """next/prev跳过春节假期，且不包含自身"""
+        assert sse.next("2025-01-27") == pd.Timestamp("2025-02-05")
+        assert sse.prev("2025-02-05") == pd.Timestamp("2025-01-27")
+        assert sse.next("2025-01-29") == pd.Timestamp("2025-02-05")
+        assert sse.prev("2025-01-29") == pd.Timestamp("2025-01-27")
+    
+    def test_between(self, sse):
+        """between包含边界，只返回交易日"""
+        days = sse.between("2025-01-01", "2025-01-10")
+        
+        assert days[0] == pd.Timestamp("2025-01-02")
+        assert days[-1] == pd.Timestamp("2025-01-10")
+        assert len(days) == 7
+        assert sse.between("2025-01-10", "2025-01-01") == []
+        assert sse.between("2025-01-29", "2025-02-04") == []
+    
+    def test_snap(self, sse):
+        """区间收缩到最近的交易日"""
+        assert sse.snap("2025-01-01", "2025-01-05") == (
+            pd.Timestamp("2025-01-02"), pd.Timestamp("2025-01-03")
+        )
+        assert sse.snap("2025-01-29", "2025-02-03") == (None, None)
+    
+    def test_time_of_day_ignored(self, sse):
+        """只看日期部分"""
+        assert sse.is_trading_day(pd.Timestamp("2025-01-02 14:30"))
+        assert sse.next(pd.Timestamp("2025-01-02 14:30")) == pd.Timestamp("2025-01-03")
+    
+    def test_session_mask(self, sse):
+        """标记落在交易日的行"""
+        index = pd.date_range("2025-01-03", periods=4, freq="D")
+        assert list(sse.session_mask(index)) == [True, False, False, True]
+    
+    def test_intraday_session_mask_drops_lunch_break(self, sse):
+        """日内频率下午休和收盘后的K线不在交易时段内"""
+        index = pd.DatetimeIndex([
+            "2025-01-02 09:31", "2025-01-02 11:30", "2025-01-02 12:00",
+            "2025-01-02 13:01", "2025-01-02 15:00", "2025-01-02 15:30",
+            "2025-01-04 10:00",
+        ])
+        
+        assert list(sse.session_mask(index, "1min")) == [True, True, False, True, True, False, False]
+        assert list(sse.session_mask(index)) == [True] * 6 + [False]
+    
+    def test_sessions_loaded_from_file(self, sse):
+        """内置日历包含上午和下午两个交易时段"""
+        assert sse.sessions == [
+            (pd.Timedelta("09:30:00"), pd.Timedelta("11:30:00")),
+            (pd.Timedelta("13:00:00"), pd.Timedelta("15:00:00")),
+        ]
+        assert sse.with_holidays(["2025-01-06"]).sessions == sse.sessions
+    
+    def test_aliases_share_cached_calendar(self):
+        """别名指向同一个缓存的日历"""
+        assert get_calendar("SSE") is get_calendar("szse")
+    
+    def test_unknown_market(self):
+        """未知市场报错"""
+        with pytest.raises(DataError):
+            get_calendar("NO_SUCH_MARKET")
+
+
+class TestTradingDays:
+    """trading_days()与半日市测试类"""
+    
+    def test_trading_days_by_market(self):
+        """按市场名称获取交易日"""
+        days = trading_days("2025-09-29", "2025-10-10", market="SZSE")
+        
+        assert days == [
+            pd.Timestamp("2025-09-29"),
+            pd.Timestamp("2025-09-30"),
+            pd.Timestamp("2025-10-09"),
+            pd.Timestamp("2025-10-10"),
+        ]
+    
+    def test_half_days_are_trading_days(self):
+        """半日市仍是交易日"""
+        calendar = TradingCalendar(
+            "HKEX", holidays=["2025-12-25"], half_days=["2025-12-24"]
+        )
+        
+        assert calendar.is_trading_day("2025-12-24")
+        assert calendar.is_half_day("2025-12-24")
+        assert not calendar.is_half_day("2025-12-23")
+    
+    def test_with_holidays_plugs_in_custom_table(self, sse):
+        """合并自定义休市表得到新日历，原日历不变"""
+        custom = sse.with_holidays(["2025-01-02"], market="SSE_CUSTOM")
+        
+        assert not custom.is_trading_day("2025-01-02")
+        assert not custom.is_trading_day("2025-01-29")
+        assert sse.is_trading_day("2025-01-02")
+        assert trading_days("2025-01-01", "2025-01-03", market=custom) == [
+            pd.Timestamp("2025-01-03")
+        ]
+
+
+class TestCalendarFiles:
+    """日历数据文件测试类"""
+    
+    def test_text_file(self, tmp_path):
+        """文本文件每行一个休市日"""
+        path = tmp_path / "custom.txt"
+        path.write_text("# custom holidays\n2025-03-03\n2025-03-04  # two days\n")
+        
+        calendar = TradingCalendar.from_file(path)
+        
+        assert calendar.market == "custom"
+        assert calendar.next("2025-02-28") == pd.Timestamp("2025-03-05")
+    
+    def test_yaml_file_and_register(self, tmp_path):
+        """YAML文件可以指定周末，注册后可按名称获取"""
+        path = tmp_path / "mideast.yaml"
+        path.write_text(
+            'market: "MIDEAST"\n'
+            'weekends: ["Friday", "Saturday"]\n'
+            'holidays: ["2025-01-05"]\n'
+        )
+        
+        calendar = TradingCalendar.from_file(path)
+        register_calendar("MIDEAST", calendar)
+        
+        assert get_calendar("mideast") is calendar
+        assert calendar.is_trading_day("2025-01-04") is False  # Saturday
+        assert calendar.is_trading_day("2025-01-05") is False  # holiday Sunday
+        assert calendar.is_trading_day("2025-01-06")
+    
+    def test_malformed_file(self, tmp_path):
+        """格式错误的文件报错"""
+        path = tmp_path / "bad.txt"
+        path.write_text("not-a-date\n")
+        
+        with pytest.raises(DataError):
+            TradingCalendar.from_file(path)
+
+
+class TestContinuousCalendar:
+    """ContinuousCalendar测试类"""
+    
+    def test_every_day_trades(self):
+        """7x24小时市场每天都是交易日"""
+        calendar = get_calendar("CRYPTO")
+        
+        assert isinstance(calendar, ContinuousCalendar)
+        assert calendar.is_trading_day("2025-01-04")
+        assert calendar.next("2025-01-03") == pd.Timestamp("2025-01-04")
+        assert len(calendar.between("2025-01-01", "2025-01-31")) == 31
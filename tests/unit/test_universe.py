@@ -0,0 +1,228 @@
+"""
+Unit tests for instrument universes
+标的池单元测试
+"""
+
+import pytest
+import pandas as pd
+
+from src.core.data_manager import DataManager
+from src.core.universe import Universe, get_universe, register_universe, universe_members
+from src.core.universe_filter import ExcludeST, ExcludeSuspended, MinADV, MinListingDays
+from src.infrastructure.csv_provider import CSVDataProvider
+from src.utils.error_handler import DataError
+
+
+MEMBERSHIP = """# instrument start end
+SH600000\t2020-01-01\t2099-12-31
+SH600004\t2020-01-01\t2025-01-02
+SZ000001\t2025-01-06
+SH600010\t2020-01-01\t2022-06-30
+SH600010\t2024-12-16\t2099-12-31
+"""
+
+
+@pytest.fixture
+def membership_file(tmp_path):
+    path = tmp_path / "csi300.txt"
+    path.write_text(MEMBERSHIP)
+    return path
+
+
+@pytest.fixture
+def universe(membership_file):
+    return Universe.from_file(membership_file, name="SH000300")
+
+
+class TestUniverse:
+    """Universe测试类"""
+    
+    def test_members_are_point_in_time(self, universe):
+        """按日期返回当时的成分股，处理纳入和剔除"""
+        assert universe.members("2025-01-02") == ["SH600000", "SH600004", "SH600010"]
+        assert universe.members("2025-01-03") == ["SH600000", "SH600010"]
+        assert universe.members("2025-01-06") == ["SH600000", "SH600010", "SZ000001"]
+        assert universe.members("2023-01-03") == ["SH600000", "SH600004"]
+    
+    def test_members_between(self, universe):
+        """区间内任意时刻属于标的池的标的都会返回"""
+        assert universe.members_between("2025-01-02", "2025-01-06") == [
+            "SH600000", "SH600004", "SH600010", "SZ000001"
+        ]
+        assert universe.members_between("2022-07-01", "2024-12-01") == ["SH600000", "SH600004"]
+    
+    def test_membership_mask(self, universe):
+        """成分股期间的行被标记"""
+        index = pd.DatetimeIndex(["2022-06-30", "2023-01-03", "2024-12-16 10:30"])
+        assert list(universe.membership_mask("SH600010", index)) == [True, False, True]
+        assert not universe.membership_mask("SH999999", index).any()
+    
+    def test_inverted_period(self):
+        with pytest.raises(ValueError):
+            Universe("bad", {"SH600000": [("2025-01-02", "2024-01-01")]})
+    
+    def test_malformed_file(self, tmp_path):
+        path = tmp_path / "broken.txt"
+        path.write_text("SH600000\n")
+        with pytest.raises(DataError):
+            Universe.from_file(path)
+
+
+class TestGetUniverse:
+    """get_universe测试类"""
+    
+    def test_index_code_resolves_pool_file(self, membership_file):
+        """指数代码查找对应的股票池文件"""
+        universe = get_universe("SH000300", data_dir=membership_file.parent)
+        
+        assert universe.name == "SH000300"
+        assert "SZ000001" in universe
+    
+    def test_universe_members(self, membership_file):
+        """结束日期之前仍是成分股，之后不再出现"""
+        assert "SH600004" in universe_members("SH000300", "2025-01-02", data_dir=membership_file.parent)
+        assert "SH600004" not in universe_members("SH000300", "2025-01-03", data_dir=membership_file.parent)
+    
+    def test_registered_universe(self):
+        universe = Universe("custom", {"SH600000": [("2025-01-01", None)]})
+        register_universe("my_pool", universe)
+        
+        assert get_universe("MY_POOL") is universe
+    
+    def test_unknown_universe(self, tmp_path):
+        with pytest.raises(DataError):
+            get_universe("SH999999", data_dir=tmp_path)
+
+
+class TestFeaturesWithUniverse:
+    """get_features接受标的池"""
+    
+    def test_fetches_members_point_in_time(self, tmp_path, universe):
+        """只获取区间内的成分股，每个标的只保留成分股期间的行"""
+        dates = ["2025-01-02", "2025-01-03", "2025-01-06"]
+        for code in ["SH600000", "SH600004", "SZ000001", "SH600010", "SH600036"]:
+            rows = "\n".join(f"{d},{i + 1.0}" for i, d in enumerate(dates))
+            (tmp_path / f"{code}.csv").write_text(f"date,close\n{rows}\n")
+        manager = DataManager(enable_cache=False, provider=CSVDataProvider(str(tmp_path)))
+        
+        result = manager.get_features(
+            universe, ["$close", "Ref($close,1)"],
+            start_time="2025-01-02", end_time="2025-01-06"
+        )
+        
+        assert list(result.keys()) == ["SH600000", "SH600004", "SH600010", "SZ000001"]
+        assert list(result["SH600004"].index) == [pd.Timestamp("2025-01-02")]
+        # 纳入首日的Ref仍能看到纳入前的数据
+        assert list(result["SZ000001"]["Ref($close,1)"]) == [2.0]
+        assert result.error is None
+
+
+DAYS = ["2025-01-02", "2025-01-03", "2025-01-06", "2025-01-07", "2025-01-08", "2025-01-09", "2025-01-10", "2025-01-13"]
+
+
+@pytest.fixture
+def provider(tmp_path):
+    """
+    SH600000正常交易；SH600004自1月8日起为ST；SZ000001于1月7日上市；
+    SH600010在1月8日没有K线、1月9日成交量为0；SH600036成交额很小
+    """
+    def write(code, volumes, st=None):
+        st = st or [0] * len(DAYS)
+        rows = [f"{d},10.0,{v},{s}" for d, v, s in zip(DAYS, volumes, st) if v is not None]
+        (tmp_path / f"{code}.csv").write_text("date,close,volume,st\n" + "\n".join(rows) + "\n")
+    
+    write("SH600000", [1e6] * 8)
+    write("SH600004", [1e6] * 8, [0, 0, 0, 0, 1, 1, 1, 1])
+    write("SZ000001", [None] * 3 + [1e6] * 5)
+    write("SH600010", [1e6] * 4 + [None, 0] + [1e6] * 2)
+    write("SH600036", [1e3] * 8)
+    return CSVDataProvider(str(tmp_path))
+
+
+@pytest.fixture
+def pool():
+    codes = ["SH600000", "SH600004", "SZ000001", "SH600010", "SH600036"]
+    return Universe("pool", {code: [("2025-01-01", None)] for code in codes})
+
+
+class TestUniverseFilters:
+    """标的池筛选测试类"""
+    
+    def test_st_drops_out_from_flag_date(self, pool, provider):
+        """标记为ST的当日起剔除，之前的成分股不变"""
+        universe = pool.filter(ExcludeST(), provider=provider)
+        
+        assert "SH600004" in universe.members("2025-01-07")
+        assert "SH600004" not in universe.members("2025-01-08")
+        assert universe.membership("2025-01-02", "2025-01-13")["SH600004"].tolist() == [True] * 4 + [False] * 4
+        assert universe.exclusions("2025-01-09") == {"SH600004": ["ExcludeST()"]}
+    
+    def test_min_listing_days(self, pool, provider):
+        """上市当日计为第1天"""
+        universe = pool.filter(MinListingDays(3), provider=provider)
+        
+        assert universe.members("2025-01-03") == []
+        assert not universe.is_member("SZ000001", "2025-01-08")
+        assert universe.is_member("SZ000001", "2025-01-09")
+    
+    def test_min_adv(self, pool, provider):
+        """窗口内交易日不足时不通过，停牌日成交额计为0"""
+        universe = pool.filter(MinADV(2, 5e6), provider=provider)
+        
+        assert universe.members("2025-01-02") == []
+        assert universe.members("2025-01-03") == ["SH600000", "SH600004", "SH600010"]
+        assert not universe.is_member("SH600010", "2025-01-09")
+        assert universe.is_member("SH600010", "2025-01-10")
+        assert "SH600036" not in universe.members_between("2025-01-02", "2025-01-13")
+    
+    def test_exclude_suspended(self, pool, provider):
+        """没有K线或成交量为0的交易日剔除"""
+        universe = pool.filter(ExcludeSuspended(), provider=provider)
+        
+        mask = universe.membership_mask("SH600010", pd.DatetimeIndex(DAYS[3:7]))
+        assert list(mask) == [True, False, False, True]
+        assert not universe.is_member("SZ000001", "2025-01-06")
+    
+    def test_exclusions_name_every_failed_filter(self, pool, provider):
+        universe = pool.filter(ExcludeST(), ExcludeSuspended(), MinADV(2, 5e6), provider=provider)
+        
+        assert universe.exclusions("2025-01-08") == {
+            "SH600004": ["ExcludeST()"],
+            "SH600010": ["ExcludeSuspended()"],
+            "SH600036": ["MinADV(2, 5e+06)"],
+        }
+        assert universe.members("2025-01-08") == ["SH600000", "SZ000001"]
+    
+    def test_non_trading_day_uses_previous_day(self, pool, provider):
+        universe = pool.filter(ExcludeST(), ExcludeSuspended(), provider=provider)
+        
+        assert universe.members("2025-01-11") == universe.members("2025-01-10")
+    
+    def test_daily_queries_match_range(self, pool, provider):
+        """逐日查询只计算新增日期，结果与一次计算整个区间相同"""
+        filters = (MinListingDays(2), MinADV(2, 5e6), ExcludeST(), ExcludeSuspended())
+        daily = pool.filter(*filters, provider=provider)
+        whole = pool.filter(*filters, provider=provider)
+        
+        members = [daily.members(day) for day in DAYS]
+        
+        expected = whole.membership("2025-01-02", "2025-01-13")
+        assert members == [sorted(expected.columns[row.to_numpy()]) for _, row in expected.iterrows()]
+        assert daily.membership("2025-01-02", "2025-01-13").equals(expected)
+    
+    def test_get_features_with_filtered_universe(self, pool, provider):
+        manager = DataManager(enable_cache=False, provider=provider)
+        universe = pool.filter(ExcludeST(), provider=provider)
+        
+        result = manager.get_features(universe, ["$close"], start_time="2025-01-02", end_time="2025-01-13")
+        
+        assert result["SH600004"].index[-1] == pd.Timestamp("2025-01-07")
+        assert len(result["SH600000"]) == 8
+    
+    def test_invalid_filters(self, pool, provider):
+        with pytest.raises(ValueError):
+            MinADV(0, 1e7)
+        with pytest.raises(ValueError):
+            MinListingDays(0)
+        with pytest.raises(ValueError):
+            pool.filter(ExcludeST(), ExcludeST(), provider=provider)
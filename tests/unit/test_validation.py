@@ -0,0 +1,292 @@
+"""
+Unit tests for data validation and repair
+数据校验与修复单元测试
+"""
+
+import numpy as np
+import pandas as pd
+import pytest
+
+from src.core.data_manager import DataManager
+from src.core.feature_frame import FeatureFrame
+from src.core.trading_calendar import TradingCalendar
+from src.core.validation import DataValidationError, IssueKind, RepairAction, ValidationOptions
+from src.infrastructure.data_provider import DataProvider
+
+
+# 2025-01-08（周三）休市
+CALENDAR = TradingCalendar("TEST", holidays=["2025-01-08"])
+
+
+def _frame(days):
+    index = pd.DatetimeIndex(days, name="datetime")
+    return FeatureFrame({
+        "$open": 10.0,
+        "$high": 11.0,
+        "$low": 9.0,
+        "$close": 10.5,
+        "$volume": 1000.0,
+    }, index=index)
+
+
+@pytest.fixture
+def days():
+    return [d for d in CALENDAR.between("2025-01-02", "2025-01-17")]
+
+
+class FrameProvider(DataProvider):
+    """Serves fixed frames keyed by instrument"""
+    
+    name = "frames"
+    
+    def __init__(self, frames):
+        self.frames = frames
+    
+    def load_features(self, instrument, fields, start_time=None, end_time=None, freq="day"):
+        frame = self.frames.get(instrument)
+        if frame is None:
+            return pd.DataFrame(columns=fields)
+        return pd.DataFrame(frame)[fields]
+    
+    def calendar(self, start_time=None, end_time=None, freq="day"):
+        return CALENDAR.between(start_time or "2025-01-02", end_time or "2025-01-17")
+
+
+class TestValidate:
+    """FeatureFrame.validate测试类"""
+    
+    def test_clean_frame(self, days):
+        """休市日不算缺失"""
+        report = _frame(days).validate(CALENDAR)
+        
+        assert report.ok
+        assert pd.Timestamp("2025-01-08") not in days
+    
+    def test_missing_trading_days(self, days):
+        gaps = [pd.Timestamp(d) for d in ["2025-01-07", "2025-01-13", "2025-01-14", "2025-01-15"]]
+        frame = _frame([d for d in days if d not in gaps])
+        
+        report = frame.validate(CALENDAR)
+        
+        assert report.missing_days == gaps
+        assert not report.ok
+    
+    def test_range_bounds(self, days):
+        """start和end扩大检查范围，数据开始之前的交易日同样算缺失"""
+        report = _frame(days[2:]).validate(CALENDAR, start="2025-01-01", end="2025-01-17")
+        
+        assert report.missing_days == days[:2]
+    
+    def test_no_calendar_skips_missing_days(self, days):
+        report = _frame(days[::2]).validate()
+        
+        assert report.ok
+    
+    def test_duplicates(self, days):
+        frame = _frame(days + [pd.Timestamp("2025-01-06"), pd.Timestamp("2025-01-06")]).sort_index()
+        
+        report = frame.validate(CALENDAR)
+        
+        assert report.duplicates == [pd.Timestamp("2025-01-06")]
+    
+    def test_duplicate_and_out_of_order_rows(self):
+        frame = _frame([
+            "2025-01-02", "2025-01-03", "2025-01-06", "2025-01-06", "2025-01-09", "2025-01-07", "2025-01-10"
+        ])
+        
+        report = frame.validate(CALENDAR)
+        
+        assert [i.kind for i in report.issues] == [IssueKind.DUPLICATE_TIMESTAMP, IssueKind.OUT_OF_ORDER]
+        assert report.duplicates == [pd.Timestamp("2025-01-06")]
+        assert report.out_of_order == [pd.Timestamp("2025-01-07")]
+        issue = report.of(IssueKind.OUT_OF_ORDER)[0]
+        assert issue.times == (pd.Timestamp("2025-01-07"), pd.Timestamp("2025-01-09"))
+        assert "not increasing" in issue.message
+        assert "more than once" in report.issues[0].message
+    
+    def test_non_trading_day_bars(self, days):
+        """休市日和周末的K线只在提供日历时报告"""
+        frame = _frame(sorted(days + [pd.Timestamp("2025-01-08"), pd.Timestamp("2025-01-11")]))
+        
+        report = frame.validate(CALENDAR)
+        
+        assert [i.time for i in report.of(IssueKind.NON_TRADING_DAY)] == [
+            pd.Timestamp("2025-01-08"), pd.Timestamp("2025-01-11")
+        ]
+        assert frame.validate().ok
+    
+    def test_gaps(self, days):
+        """周末的3天间隔不超过阈值"""
+        frame = _frame(days[:3] + days[8:])
+        
+        report = frame.validate(max_gap="3D")
+        
+        assert report.gaps == [(pd.Timestamp("2025-01-06"), pd.Timestamp("2025-01-15"))]
+        assert report.of(IssueKind.GAP)[0].value == 9
+        assert frame.validate().ok
+        with pytest.raises(ValueError):
+            frame.validate(max_gap="-1D")
+    
+    def test_prices(self, days):
+        frame = _frame(days)
+        frame.loc["2025-01-10", "$close"] = 0.0
+        frame.loc["2025-01-13", "$low"] = -1.0
+        frame.loc["2025-01-14", "$high"] = 8.0
+        
+        report = frame.validate(CALENDAR)
+        
+        non_positive = report.of(IssueKind.NON_POSITIVE_PRICE)
+        assert [(i.time, i.field, i.value) for i in non_positive] == [
+            (pd.Timestamp("2025-01-10"), "$close", 0.0),
+            (pd.Timestamp("2025-01-13"), "$low", -1.0),
+        ]
+        assert [i.time for i in report.of(IssueKind.HIGH_BELOW_LOW)] == [pd.Timestamp("2025-01-14")]
+        assert report.counts()["non_positive_price"] == 2
+    
+    def test_volume_spike(self, days):
+        frame = _frame(days)
+        frame["$volume"] = np.arange(len(days), dtype=float) + 1000.0
+        frame.loc["2025-01-09", "$volume"] = 1e6
+        
+        report = frame.validate(volume_zscore=2.5)
+        
+        spikes = report.of(IssueKind.VOLUME_SPIKE)
+        assert [i.time for i in spikes] == [pd.Timestamp("2025-01-09")]
+        assert spikes[0].value > 2.5
+        assert frame.validate(volume_zscore=None).ok
+    
+    def test_missing_values_are_not_issues(self, days):
+        frame = _frame(days)
+        frame.loc["2025-01-10", ["$close", "$volume"]] = np.nan
+        
+        assert frame.validate(CALENDAR, volume_zscore=2.0).ok
+    
+    def test_report_serializes(self, days):
+        frame = _frame(days[1:])
+        
+        data = frame.validate(CALENDAR, start="2025-01-02").to_dict()
+        
+        assert data["ok"] is False
+        assert data["issues"] == [
+            {
+                "kind": "missing_day",
+                "time": "2025-01-02T00:00:00",
+                "field": None,
+                "value": None,
+                "other": None,
+                "message": "no data on trading day 2025-01-02"
+            }
+        ]
+        assert "missing_day=1" in str(frame.validate(CALENDAR, start="2025-01-02"))
+
+
+class TestRepair:
+    """FeatureFrame.repair测试类"""
+    
+    def test_fills_small_gaps_only(self, days):
+        gaps = [pd.Timestamp(d) for d in ["2025-01-07", "2025-01-13", "2025-01-14", "2025-01-15"]]
+        frame = _frame([d for d in days if d not in gaps])
+        frame.loc["2025-01-06", "$close"] = 12.0
+        
+        repaired, report = frame.repair(CALENDAR, max_fill_days=2)
+        
+        assert repaired.loc["2025-01-07", "$close"] == 12.0
+        assert repaired.index.is_monotonic_increasing
+        assert [(r.action, r.time, r.source) for r in report.repairs] == [
+            (RepairAction.FORWARD_FILL, pd.Timestamp("2025-01-07"), pd.Timestamp("2025-01-06"))
+        ]
+        # 三天的缺口超过max_fill_days，仍然报告
+        assert report.missing_days == gaps[1:]
+        assert isinstance(repaired, FeatureFrame)
+    
+    def test_gap_before_first_row_is_not_filled(self, days):
+        repaired, report = _frame(days[1:]).repair(CALENDAR, start="2025-01-02")
+        
+        assert report.repairs == []
+        assert report.missing_days == [days[0]]
+        assert len(repaired) == len(days) - 1
+    
+    def test_drops_duplicates_keeping_last(self, days):
+        frame = pd.concat([_frame(days), _frame(["2025-01-06"]).assign(**{"$close": 11.0})]).sort_index(kind="stable")
+        
+        repaired, report = FeatureFrame(frame).repair(CALENDAR)
+        
+        assert report.ok
+        assert repaired.loc["2025-01-06", "$close"] == 11.0
+        assert [(r.action, r.time) for r in report.repairs] == [
+            (RepairAction.DROP_DUPLICATE, pd.Timestamp("2025-01-06"))
+        ]
+    
+    def test_repair_leaves_original_untouched(self, days):
+        frame = _frame(days[:2] + days[3:])
+        
+        frame.repair(CALENDAR)
+        
+        assert len(frame) == len(days) - 1
+    
+    def test_invalid_options(self):
+        with pytest.raises(ValueError):
+            ValidationOptions(max_fill_days=-1)
+        with pytest.raises(ValueError):
+            ValidationOptions(volume_zscore=0)
+        with pytest.raises(ValueError):
+            ValidationOptions(max_gap="0D")
+
+
+class TestStrictFeatures:
+    """get_features严格模式测试类"""
+    
+    @pytest.fixture
+    def manager(self, days):
+        bad = _frame(days)
+        bad.loc["2025-01-10", "$close"] = 0.0
+        gappy = _frame(days[:2] + days[3:])
+        provider = FrameProvider({"SH600000": _frame(days), "SZ000001": bad, "SZ000002": gappy})
+        return DataManager(enable_cache=False, provider=provider)
+    
+    def test_strict_returns_error_instead_of_frame(self, manager):
+        result = manager.get_features(
+            ["SH600000", "SZ000001"], ["$close"],
+            start_time="2025-01-02", end_time="2025-01-17", strict=True
+        )
+        
+        assert list(result) == ["SH600000"]
+        error = result.errors["SZ000001"]
+        assert isinstance(error, DataValidationError)
+        assert error.error_info.error_code == "DAT0027"
+        assert error.report.of(IssueKind.NON_POSITIVE_PRICE)[0].time == pd.Timestamp("2025-01-10")
+        assert result.reports["SH600000"].ok
+    
+    def test_calendar_enables_missing_day_check(self, manager):
+        kwargs = dict(start_time="2025-01-02", end_time="2025-01-17", strict=True)
+        
+        without = manager.get_features(["SZ000002"], ["$close"], **kwargs)
+        with_calendar = manager.get_features(["SZ000002"], ["$close"], calendar=CALENDAR, **kwargs)
+        
+        assert "SZ000002" in without
+        assert with_calendar.errors["SZ000002"].report.missing_days == [pd.Timestamp("2025-01-06")]
+    
+    def test_strict_with_repair(self, manager):
+        result = manager.get_features(
+            ["SZ000002"], ["$close"], start_time="2025-01-02", end_time="2025-01-17",
+            calendar=CALENDAR, strict=True, validation=ValidationOptions(max_fill_days=1)
+        )
+        
+        frame = result["SZ000002"]
+        assert pd.Timestamp("2025-01-06") in frame.index
+        assert result.reports["SZ000002"].repairs[0].action == RepairAction.FORWARD_FILL
+    
+    def test_non_strict_reports_without_failing(self, manager):
+        result = manager.get_features(
+            ["SZ000001"], ["$close"], start_time="2025-01-02", end_time="2025-01-17",
+            validation=ValidationOptions()
+        )
+        
+        assert "SZ000001" in result
+        assert not result.reports["SZ000001"].ok
+    
+    def test_no_validation_by_default(self, manager):
+        result = manager.get_features(["SZ000001"], ["$close"])
+        
+        assert "SZ000001" in result
+        assert result.reports == {}
@@ -0,0 +1,254 @@
+"""
+滚动前推回测单元测试 / Walk-Forward Backtest Unit Tests
+"""
+
+import math
+from dataclasses import replace
+
+import pytest
+import pandas as pd
+
+from src.application.backtest_engine import EngineConfig, Order, OrderSide, Strategy
+from src.application.walk_forward import WalkForwardConfig, fold_windows, period_windows, to_period, walk_forward
+from src.core.feature_frame import FeatureFrame
+from src.utils.error_handler import BacktestError
+
+
+# 2025-01-02起的20个工作日
+DAYS = pd.bdate_range("2025-01-02", periods=20)
+
+
+@pytest.fixture
+def data():
+    closes = [10.0 * 1.01 ** i for i in range(len(DAYS))]
+    opens = [closes[0]] + closes[:-1]
+    return {"SH600000": FeatureFrame({"$open": opens, "$close": closes}, index=DAYS)}
+
+
+def _config(data, **kwargs):
+    engine = EngineConfig(start_time="2025-01-01", end_time="2025-01-31", data=data, initial_cash=1000.0)
+    return WalkForwardConfig(engine=engine, **kwargs)
+
+
+class BuyAndHold(Strategy):
+    """第一根K线买入固定数量，并记录看到的最晚历史"""
+    
+    def __init__(self, quantity=50):
+        self.quantity = quantity
+        self.times = []
+        self.history_ends = []
+    
+    def on_bar(self, ctx, portfolio, bars):
+        self.times.append(ctx.time)
+        self.history_ends.append(ctx.history("SH600000").index[-1])
+        if len(self.times) == 1:
+            return [Order("SH600000", OrderSide.BUY, self.quantity)]
+        return None
+
+
+class TestFoldWindows:
+    """窗口切分测试类"""
+    
+    def test_rolling(self):
+        assert fold_windows(10, 4, 2) == [(0, 4, 6), (2, 6, 8), (4, 8, 10)]
+    
+    def test_partial_window(self):
+        """最后一个不足test_size的窗口按keep_partial丢弃或保留"""
+        assert fold_windows(11, 4, 2)[-1] == (4, 8, 10)
+        assert fold_windows(11, 4, 2, keep_partial=True)[-1] == (6, 10, 11)
+    
+    def test_step_and_anchored(self):
+        assert fold_windows(11, 4, 2, step=3) == [(1, 4, 6), (4, 7, 9)]
+        assert fold_windows(10, 4, 2, anchored=True) == [(0, 4, 6), (0, 6, 8), (0, 8, 10)]
+        assert fold_windows(4, 0, 2) == [(0, 0, 2), (2, 2, 4)]
+    
+    def test_invalid(self):
+        with pytest.raises(ValueError):
+            fold_windows(10, 4, 0)
+        with pytest.raises(ValueError):
+            fold_windows(10, -1, 2)
+        with pytest.raises(ValueError):
+            fold_windows(10, 4, 3, step=2)
+
+
+class TestPeriodWindows:
+    """日历期间窗口测试类"""
+    
+    YEAR = pd.bdate_range("2024-01-01", "2024-12-31")
+    
+    def _dates(self, windows):
+        days = self.YEAR
+        return [(days[a].date().isoformat(), days[b].date().isoformat(), days[c - 1].date().isoformat())
+                for a, b, c in windows]
+    
+    def test_months(self):
+        windows = period_windows(self.YEAR, "6M", "3M", start="2024-01-01", end="2024-12-31")
+        
+        assert self._dates(windows) == [
+            ("2024-01-01", "2024-07-01", "2024-09-30"),
+            ("2024-04-01", "2024-10-01", "2024-12-31"),
+        ]
+    
+    def test_boundaries_snap_to_trading_days(self):
+        """2024-06-01是星期六，测试窗口从下一个交易日开始"""
+        windows = period_windows(self.YEAR, "5M", "2M")
+        
+        assert self._dates(windows)[0] == ("2024-01-01", "2024-06-03", "2024-07-31")
+        assert len(windows) == 3
+        kept = period_windows(self.YEAR, "5M", "2M", keep_partial=True)
+        assert len(kept) == 4 and kept[-1][2] == len(self.YEAR)
+    
+    def test_step_and_anchored(self):
+        windows = period_windows(self.YEAR, "3M", "2M", step="4M", anchored=True)
+        
+        assert [w[0] for w in windows] == [0, 0]
+        assert self._dates(windows)[1][1] == "2024-08-01"
+    
+    def test_to_period(self):
+        assert pd.Timestamp("2024-01-31") + to_period("1M") == pd.Timestamp("2024-02-29")
+        assert pd.Timestamp("2024-01-01") + to_period("2y") == pd.Timestamp("2026-01-01")
+        assert pd.Timestamp("2024-01-01") + to_period("13W") == pd.Timestamp("2024-04-01")
+    
+    @pytest.mark.parametrize("kwargs", [
+        {"train_size": "6M", "test_size": "3M", "step": "2M"},
+        {"train_size": "6X", "test_size": "3M"},
+        {"train_size": "6M", "test_size": "0M"},
+        {"train_size": 5, "test_size": "3M"},
+    ])
+    def test_invalid(self, kwargs):
+        with pytest.raises(ValueError):
+            period_windows(self.YEAR, **kwargs)
+
+
+class TestWalkForward:
+    """滚动前推回测测试类"""
+    
+    def test_folds_and_stitched_curve(self, data):
+        folds = []
+        
+        def factory(fold):
+            folds.append(fold)
+            return BuyAndHold()
+        
+        result = walk_forward(_config(data, train_size=8, test_size=4), factory)
+        
+        assert [f.number for f in folds] == [0, 1, 2]
+        assert [f.test_start for f in folds] == [DAYS[8], DAYS[12], DAYS[16]]
+        assert result.equity_curve.index.equals(DAYS[8:])
+        # 拼接的权益等于各折权益倍数的连乘
+        growth = math.prod(f.result.final_equity / 1000.0 for f in result.folds)
+        assert result.equity_curve.iloc[-1] == pytest.approx(1000.0 * growth)
+        assert result.metrics.total_return == pytest.approx(growth - 1.0)
+    
+    def test_each_fold_starts_flat(self, data):
+        result = walk_forward(_config(data, train_size=8, test_size=4), lambda fold: BuyAndHold())
+        
+        for item in result.folds:
+            assert len(item.result.trades) == 1
+            assert item.result.trades[0].time == item.fold.test_start + pd.offsets.BDay(1)
+            assert item.metrics.periods == 4
+            # 首日没有持仓，收益率相对期初资金为0
+            assert item.returns.iloc[0] == 0.0
+    
+    def test_train_data_and_history(self, data):
+        """训练数据截止于训练窗口，测试窗口内的历史不超过当日"""
+        strategies = []
+        
+        def factory(fold):
+            train = fold.train_data["SH600000"]
+            assert train.index[0] == fold.train_start and train.index[-1] == fold.train_end
+            assert fold.train_end < fold.test_start
+            strategies.append(BuyAndHold())
+            return strategies[-1]
+        
+        walk_forward(_config(data, train_size=8, test_size=4), factory)
+        
+        for strategy in strategies:
+            assert strategy.history_ends == strategy.times
+    
+    def test_fold_seeds(self, data):
+        """各折的种子由根种子和折的序号派生，传回根种子可以重现"""
+        draws = []
+        
+        def factory(fold):
+            def on_bar(ctx, portfolio, bars):
+                draws.append((fold.number, ctx.rng().random()))
+            return on_bar
+        
+        result = walk_forward(_config(data, train_size=8, test_size=4), factory)
+        first, draws[:] = list(draws), []
+        engine = replace(_config(data).engine, seed=result.seed)
+        again = walk_forward(WalkForwardConfig(engine=engine, train_size=8, test_size=4), factory)
+        
+        seeds = [f.fold.seed for f in result.folds]
+        assert len(set(seeds)) == 3
+        assert [f.result.seed for f in result.folds] == seeds
+        assert [f.fold.seed for f in again.folds] == seeds
+        assert draws == first
+        # 各折的随机数流互相独立
+        assert len({value for _, value in first}) == len(first)
+    
+    def test_partial_final_window(self, data):
+        dropped = walk_forward(_config(data, train_size=8, test_size=5), lambda fold: BuyAndHold())
+        kept = walk_forward(_config(data, train_size=8, test_size=5, keep_partial=True), lambda fold: BuyAndHold())
+        
+        assert len(dropped.folds) == 2 and dropped.equity_curve.index[-1] == DAYS[17]
+        assert len(kept.folds) == 3 and kept.folds[-1].fold.partial
+        assert kept.equity_curve.index[-1] == DAYS[-1]
+    
+    def test_fold_table(self, data):
+        result = walk_forward(_config(data, train_size=8, test_size=4), lambda fold: BuyAndHold())
+        
+        table = result.fold_table()
+        assert list(table.index) == [0, 1, 2]
+        assert table["trades"].tolist() == [1, 1, 1]
+        assert table["total_return"].tolist() == pytest.approx([f.metrics.total_return for f in result.folds])
+    
+    def test_period_windows(self, data):
+        """两周训练、一周测试，最后一个不完整的窗口被丢弃"""
+        folds = []
+        
+        def factory(fold):
+            folds.append(fold)
+            return BuyAndHold()
+        
+        result = walk_forward(_config(data, train_size="2W", test_size="1W"), factory)
+        
+        assert [f.test_start for f in folds] == [pd.Timestamp("2025-01-15"), pd.Timestamp("2025-01-22")]
+        assert [f.test_end for f in folds] == [pd.Timestamp("2025-01-21"), pd.Timestamp("2025-01-28")]
+        assert folds[0].train_start == DAYS[0] and folds[0].train_end == pd.Timestamp("2025-01-14")
+        assert result.equity_curve.index[-1] == pd.Timestamp("2025-01-28")
+        assert len(result.fold_table()) == 2
+    
+    def test_short_windows_are_skipped(self, data):
+        """只有1个交易日的最后一个窗口少于min_test_size，被跳过"""
+        kept = walk_forward(
+            _config(data, train_size="2W", test_size="1W", keep_partial=True), lambda fold: BuyAndHold()
+        )
+        skipped = walk_forward(
+            _config(data, train_size="2W", test_size="1W", keep_partial=True, min_test_size=2),
+            lambda fold: BuyAndHold()
+        )
+        
+        assert len(kept.folds) == 3 and kept.folds[-1].fold.partial
+        assert len(skipped.folds) == 2
+        assert skipped.skipped == [(pd.Timestamp("2025-01-29"), pd.Timestamp("2025-01-29"))]
+    
+    def test_min_train_size(self, data):
+        """扩展窗口的第一折只有4个训练日，被跳过"""
+        config = _config(data, train_size=4, test_size=4, anchored=True, min_train_size=8)
+        
+        result = walk_forward(config, lambda fold: BuyAndHold())
+        
+        assert [f.fold.test_start for f in result.folds] == [DAYS[8], DAYS[12], DAYS[16]]
+        assert result.skipped == [(DAYS[4], DAYS[7])]
+        with pytest.raises(BacktestError):
+            walk_forward(_config(data, train_size=4, test_size=4, min_train_size=5), lambda fold: BuyAndHold())
+    
+    def test_mixed_window_kinds(self, data):
+        with pytest.raises(ValueError):
+            walk_forward(_config(data, train_size="2W", test_size=5), lambda fold: BuyAndHold())
+    
+    def test_not_enough_days(self, data):
+        with pytest.raises(BacktestError):
+            walk_forward(_config(data, train_size=18, test_size=5), lambda fold: BuyAndHold())